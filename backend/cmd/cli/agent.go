@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	ws "github.com/jacklau/prism/internal/api/websocket"
+)
+
+// runAgent runs a one-shot agent task, streaming its output to stdout.
+// Progress and tool calls go to stderr so the output can be piped.
+func runAgent(args []string) error {
+	fs, server := newFlagSet("agent run")
+	task := fs.String("task", "", "the task for the agent (required)")
+	provider := fs.String("provider", os.Getenv("PRISM_PROVIDER"), "LLM provider (default: $PRISM_PROVIDER)")
+	model := fs.String("model", os.Getenv("PRISM_MODEL"), "model (default: $PRISM_MODEL)")
+	systemPrompt := fs.String("system", "", "system prompt")
+	taskContext := fs.String("context", "", "additional context for the task")
+	conversationID := fs.String("conversation", "", "save the run to a conversation")
+	priority := fs.Int("priority", 0, "queue priority; higher runs first")
+	maxTokens := fs.Int("max-tokens", 0, "stop after this many tokens (0: no limit)")
+	maxToolCalls := fs.Int("max-tool-calls", 0, "stop after this many tool calls (0: no limit)")
+	timeout := fs.Duration("timeout", 0, "stop after this long (0: no limit)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *task == "" {
+		return errors.New("--task is required")
+	}
+	if *provider == "" || *model == "" {
+		return errors.New("--provider and --model are required")
+	}
+
+	c, err := newClient(*server)
+	if err != nil {
+		return err
+	}
+	cn, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer cn.close()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	msg := &ws.IncomingMessage{
+		Type:           ws.TypeAgentRun,
+		ConversationID: *conversationID,
+		Content:        *task,
+		Context:        *taskContext,
+		Priority:       *priority,
+		AgentConfig: &ws.AgentConfig{
+			Provider:     *provider,
+			Model:        *model,
+			SystemPrompt: *systemPrompt,
+		},
+	}
+	if *maxTokens > 0 || *maxToolCalls > 0 || *timeout > 0 {
+		msg.Budget = &ws.AgentBudget{
+			MaxTokens:       *maxTokens,
+			MaxToolCalls:    *maxToolCalls,
+			MaxDurationSecs: int(timeout.Seconds()),
+		}
+	}
+	if err := cn.send(msg); err != nil {
+		return fmt.Errorf("failed to start agent: %w", err)
+	}
+
+	// The connection is ours alone, so the first agent reported is this run
+	var agentID string
+	streamed := false
+	for {
+		select {
+		case <-interrupts:
+			if agentID == "" {
+				return errors.New("interrupted")
+			}
+			fmt.Fprintln(os.Stderr, "\nStopping agent...")
+			cn.send(&ws.IncomingMessage{Type: ws.TypeAgentStop, AgentID: agentID})
+
+		case msg, ok := <-cn.messages:
+			if !ok {
+				return fmt.Errorf("connection closed: %v", cn.err)
+			}
+			if msg.AgentID != "" {
+				if agentID == "" {
+					agentID = msg.AgentID
+				} else if msg.AgentID != agentID {
+					continue
+				}
+			}
+
+			switch msg.Type {
+			case ws.TypeAgentQueued:
+				if msg.Queue != nil {
+					fmt.Fprintf(os.Stderr, "Queued (position %d of %d)\n", msg.Queue.Position, msg.Queue.QueueSize)
+				}
+
+			case ws.TypeAgentStarted:
+				fmt.Fprintf(os.Stderr, "Agent %s started\n", msg.AgentID)
+
+			case ws.TypeAgentStreamChunk:
+				fmt.Print(msg.Delta)
+				streamed = true
+
+			case ws.TypeAgentToolCall:
+				fmt.Fprintf(os.Stderr, "\n[tool] %s %s\n", msg.ToolName, formatParameters(msg.Parameters))
+
+			case ws.TypeAgentCompleted:
+				if !streamed {
+					fmt.Print(msg.Output)
+				}
+				fmt.Println()
+				fmt.Fprintf(os.Stderr, "Completed in %s\n", time.Duration(msg.Duration)*time.Millisecond)
+				return nil
+
+			case ws.TypeAgentFailed:
+				fmt.Println()
+				return fmt.Errorf("agent failed: %s", msg.Error)
+
+			case ws.TypeAgentCancelled:
+				fmt.Println()
+				return errors.New("agent cancelled")
+
+			case ws.TypeError:
+				return newServerError(msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/jacklau/prism/internal/api/handlers"
+	ws "github.com/jacklau/prism/internal/api/websocket"
+)
+
+// runChat chats with a conversation. With a message argument it sends that
+// one message and exits; otherwise it reads messages from stdin until EOF or
+// /exit.
+func runChat(args []string) error {
+	fs, server := newFlagSet("chat")
+	conversationID := fs.String("conversation", "", "continue an existing conversation")
+	provider := fs.String("provider", os.Getenv("PRISM_PROVIDER"), "provider for a new conversation (default: $PRISM_PROVIDER)")
+	model := fs.String("model", os.Getenv("PRISM_MODEL"), "model for a new conversation (default: $PRISM_MODEL)")
+	systemPrompt := fs.String("system", "", "system prompt for a new conversation")
+	autoApprove := fs.Bool("yes", false, "run tools without asking for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := newClient(*server)
+	if err != nil {
+		return err
+	}
+
+	if *conversationID == "" {
+		if *provider == "" || *model == "" {
+			return errors.New("--provider and --model are required to start a new conversation")
+		}
+		var conv handlers.ConversationDTO
+		err := c.do("POST", "/conversations", handlers.CreateConversationRequest{
+			Provider:     *provider,
+			Model:        *model,
+			SystemPrompt: *systemPrompt,
+		}, &conv)
+		if err != nil {
+			return err
+		}
+		*conversationID = conv.ID
+		fmt.Fprintf(os.Stderr, "Conversation %s (%s/%s)\n", conv.ID, conv.Provider, conv.Model)
+	}
+
+	cn, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer cn.close()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	s := &chatSession{
+		conn:           cn,
+		conversationID: *conversationID,
+		autoApprove:    *autoApprove,
+		in:             bufio.NewReader(os.Stdin),
+		interrupts:     interrupts,
+	}
+
+	if fs.NArg() > 0 {
+		return s.send(strings.Join(fs.Args(), " "))
+	}
+
+	fmt.Fprintln(os.Stderr, "Type a message, or /exit to quit. Ctrl-C stops a response.")
+	for {
+		fmt.Fprint(os.Stderr, "> ")
+		line, err := s.in.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "/exit" || line == "/quit" {
+			return nil
+		}
+		if line != "" {
+			// Errors reported by the server end the response, not the chat
+			var serverErr serverError
+			if err := s.send(line); errors.As(err, &serverErr) {
+				fmt.Fprintln(os.Stderr, "error:", serverErr)
+			} else if err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			fmt.Fprintln(os.Stderr)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// chatSession is an open chat with one conversation
+type chatSession struct {
+	conn           *conn
+	conversationID string
+	autoApprove    bool
+	in             *bufio.Reader
+	interrupts     chan os.Signal
+}
+
+// send sends a message and prints the response as it streams, until the
+// assistant's turn is over
+func (s *chatSession) send(content string) error {
+	s.drain()
+	err := s.conn.send(&ws.IncomingMessage{
+		Type:           ws.TypeChatMessage,
+		ConversationID: s.conversationID,
+		Content:        content,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	pendingTools := 0
+	var streamErr error
+	for {
+		select {
+		case <-s.interrupts:
+			s.conn.send(&ws.IncomingMessage{Type: ws.TypeChatStop, ConversationID: s.conversationID})
+
+		case msg, ok := <-s.conn.messages:
+			if !ok {
+				return fmt.Errorf("connection closed: %v", s.conn.err)
+			}
+			if msg.ConversationID != "" && msg.ConversationID != s.conversationID {
+				continue
+			}
+
+			switch msg.Type {
+			case ws.TypeChatChunk:
+				fmt.Print(msg.Delta)
+
+			case ws.TypeToolStarted:
+				fmt.Fprintf(os.Stderr, "\n[tool] %s %s\n", msg.ToolName, formatParameters(msg.Parameters))
+
+			case ws.TypeToolCompleted:
+				if msg.Status != "" && msg.Status != "success" {
+					fmt.Fprintf(os.Stderr, "[tool] %s\n", msg.Status)
+				}
+
+			case ws.TypeToolConfirm:
+				approved := s.autoApprove
+				if !approved {
+					fmt.Println()
+					approved = confirm(s.in, fmt.Sprintf("Run %s %s?", msg.ToolName, formatParameters(msg.Parameters)))
+				}
+				pendingTools++
+				s.conn.send(&ws.IncomingMessage{
+					Type:           ws.TypeToolConfirm,
+					ConversationID: s.conversationID,
+					ExecutionID:    msg.ExecutionID,
+					Approved:       approved,
+				})
+
+			case ws.TypeAgentCheckIn:
+				fmt.Println()
+				if confirm(s.in, msg.Message+" Continue?") {
+					s.conn.send(&ws.IncomingMessage{Type: ws.TypeAgentContinue, ConversationID: s.conversationID})
+				}
+
+			case ws.TypeError:
+				// A failed stream still completes; other errors end the turn
+				if msg.Code == "stream_error" {
+					streamErr = newServerError(msg)
+					continue
+				}
+				fmt.Println()
+				return newServerError(msg)
+
+			case ws.TypeChatComplete:
+				// A response that hands off to a tool is followed by another
+				// once the tool result is in; the turn is over when a
+				// response finishes without one
+				if pendingTools > 0 {
+					pendingTools--
+					continue
+				}
+				if msg.FinishReason == "tool_calls" {
+					continue
+				}
+				fmt.Println()
+				return streamErr
+			}
+		}
+	}
+}
+
+// serverError is an error the server reported over the WebSocket
+type serverError string
+
+func newServerError(msg *ws.OutgoingMessage) serverError {
+	if msg.Message != "" {
+		return serverError(msg.Message)
+	}
+	return serverError(msg.Error)
+}
+
+func (e serverError) Error() string {
+	return string(e)
+}
+
+// drain discards messages left over from the previous turn
+func (s *chatSession) drain() {
+	for {
+		select {
+		case _, ok := <-s.conn.messages:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// formatParameters renders tool parameters on one line
+func formatParameters(parameters interface{}) string {
+	if parameters == nil {
+		return ""
+	}
+	data, err := json.Marshal(parameters)
+	if err != nil {
+		return ""
+	}
+	const maxLen = 200
+	if len(data) > maxLen {
+		return string(data[:maxLen]) + "..."
+	}
+	return string(data)
+}
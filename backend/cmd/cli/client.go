@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/jacklau/prism/internal/api/handlers"
+	ws "github.com/jacklau/prism/internal/api/websocket"
+)
+
+const (
+	defaultServer = "http://localhost:8080"
+
+	// credentialsFile holds the server address and tokens saved by login
+	credentialsFile = "cli.json"
+)
+
+// errUnauthorized is returned when the server rejects the saved credentials
+var errUnauthorized = errors.New("not signed in: run `prism login` first")
+
+// credentials are saved between runs in the user's config directory
+type credentials struct {
+	Server       string `json:"server"`
+	Email        string `json:"email,omitempty"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// credentialsPath returns where credentials are saved
+func credentialsPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config directory: %w", err)
+	}
+	return filepath.Join(configDir, "prism", credentialsFile), nil
+}
+
+// loadCredentials reads the saved credentials. Missing credentials are not an
+// error; PRISM_TOKEN overrides the saved access token.
+func loadCredentials() (*credentials, error) {
+	creds := &credentials{}
+
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, creds); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if token := os.Getenv("PRISM_TOKEN"); token != "" {
+		creds.AccessToken = token
+		creds.RefreshToken = ""
+	}
+	return creds, nil
+}
+
+// save writes the credentials, readable only by the current user
+func (c *credentials) save() error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	return nil
+}
+
+// client talks to the Prism API
+type client struct {
+	server string
+	creds  *credentials
+	http   *http.Client
+}
+
+// newClient creates a client for server, falling back to PRISM_URL, the
+// server saved by login, then the default local address
+func newClient(server string) (*client, error) {
+	creds, err := loadCredentials()
+	if err != nil {
+		return nil, err
+	}
+	if server == "" {
+		server = os.Getenv("PRISM_URL")
+	}
+	if server == "" {
+		server = creds.Server
+	}
+	if server == "" {
+		server = defaultServer
+	}
+	return &client{
+		server: strings.TrimRight(server, "/"),
+		creds:  creds,
+		http:   &http.Client{Timeout: 2 * time.Minute},
+	}, nil
+}
+
+// setTokens stores the tokens from an auth response and saves them
+func (c *client) setTokens(resp *handlers.AuthResponse) error {
+	c.creds.Server = c.server
+	c.creds.Email = resp.User.Email
+	c.creds.AccessToken = resp.AccessToken
+	c.creds.RefreshToken = resp.RefreshToken
+	return c.creds.save()
+}
+
+// do sends a JSON request to the API and decodes the JSON response into out.
+// An expired access token is refreshed once and the request retried.
+func (c *client) do(method, path string, body, out interface{}) error {
+	err := c.send(method, path, body, out)
+	if !errors.Is(err, errUnauthorized) || c.creds.RefreshToken == "" {
+		return err
+	}
+	if err := c.refresh(); err != nil {
+		return err
+	}
+	return c.send(method, path, body, out)
+}
+
+// send performs a single API request
+func (c *client) send(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.server+"/api/v1"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.creds.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.creds.AccessToken)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", c.server, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized && c.creds.AccessToken != "" {
+		return errUnauthorized
+	}
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s %s: %s", method, path, apiErr.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// refresh exchanges the refresh token for a new token pair
+func (c *client) refresh() error {
+	var resp handlers.AuthResponse
+	err := c.send("POST", "/auth/refresh", handlers.RefreshRequest{RefreshToken: c.creds.RefreshToken}, &resp)
+	if err != nil {
+		return errUnauthorized
+	}
+	return c.setTokens(&resp)
+}
+
+// connect opens the WebSocket connection, checking the credentials first so
+// an expired token is refreshed before the upgrade
+func (c *client) connect() (*conn, error) {
+	if c.creds.AccessToken == "" {
+		return nil, errUnauthorized
+	}
+	if err := c.do("GET", "/auth/me", nil, nil); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(c.server + "/api/v1/ws")
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+
+	dialer := *fastws.DefaultDialer
+	dialer.Subprotocols = []string{"auth", c.creds.AccessToken}
+	wsConn, _, err := dialer.Dial(u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", u, err)
+	}
+
+	cn := &conn{ws: wsConn, messages: make(chan *ws.OutgoingMessage, 256)}
+	go cn.readLoop()
+	return cn, nil
+}
+
+// conn is an open WebSocket connection. Server messages are delivered on
+// messages, which is closed when the connection drops.
+type conn struct {
+	ws       *fastws.Conn
+	messages chan *ws.OutgoingMessage
+	err      error
+}
+
+// readLoop decodes server messages until the connection closes
+func (c *conn) readLoop() {
+	defer close(c.messages)
+	for {
+		var msg ws.OutgoingMessage
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			c.err = err
+			return
+		}
+		c.messages <- &msg
+	}
+}
+
+// send writes a message to the server
+func (c *conn) send(msg *ws.IncomingMessage) error {
+	return c.ws.WriteJSON(msg)
+}
+
+// close closes the connection
+func (c *conn) close() error {
+	c.ws.WriteMessage(fastws.CloseMessage, fastws.FormatCloseMessage(fastws.CloseNormalClosure, ""))
+	return c.ws.Close()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// maxSyncFileSize skips files too large to send as a single request
+const maxSyncFileSize = 1 << 20
+
+// skippedDirs are never synced
+var skippedDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"__pycache__":  true,
+	".venv":        true,
+}
+
+// writeFileRequest is the body of a sandbox file write
+type writeFileRequest struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// runFilesSync uploads the text files in a directory to the sandbox,
+// overwriting files with the same path
+func runFilesSync(args []string) error {
+	fs, server := newFlagSet("files sync")
+	dest := fs.String("to", "", "sandbox directory to sync into (default: the sandbox root)")
+	dryRun := fs.Bool("dry-run", false, "list the files that would be uploaded")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	dir := "."
+	if fs.NArg() > 1 {
+		return errors.New("usage: prism files sync [flags] [directory]")
+	}
+	if fs.NArg() == 1 {
+		dir = fs.Arg(0)
+	}
+
+	c, err := newClient(*server)
+	if err != nil {
+		return err
+	}
+
+	uploaded, skipped := 0, 0
+	err = filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != dir && skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join(*dest, filepath.ToSlash(rel))
+
+		content, reason, err := readSyncFile(p, d)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			fmt.Fprintf(os.Stderr, "skip %s (%s)\n", rel, reason)
+			skipped++
+			return nil
+		}
+
+		if *dryRun {
+			fmt.Println(target)
+			uploaded++
+			return nil
+		}
+		if err := c.do("POST", "/sandbox/files", writeFileRequest{Path: target, Content: content}, nil); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", rel, err)
+		}
+		fmt.Println(target)
+		uploaded++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	verb := "Uploaded"
+	if *dryRun {
+		verb = "Would upload"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d files, skipped %d\n", verb, uploaded, skipped)
+	return nil
+}
+
+// readSyncFile reads a file to upload. The sandbox stores text, so binary
+// and oversized files are skipped with a reason instead.
+func readSyncFile(p string, d os.DirEntry) (string, string, error) {
+	info, err := d.Info()
+	if err != nil {
+		return "", "", err
+	}
+	if info.Size() > maxSyncFileSize {
+		return "", "too large", nil
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return "", "", err
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return "", "binary", nil
+	}
+	return string(data), "", nil
+}
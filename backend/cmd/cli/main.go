@@ -0,0 +1,162 @@
+// Command prism is a terminal client for the Prism API. It chats with a
+// conversation, runs one-shot agent tasks and syncs a local directory into
+// the sandbox, so the backend can be used without the web UI.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jacklau/prism/internal/api/handlers"
+)
+
+const usage = `Usage: prism <command> [flags]
+
+Commands:
+  login         Sign in and save credentials
+  logout        Forget saved credentials
+  chat          Chat with a conversation in the terminal
+  agent run     Run a one-shot agent task
+  files sync    Upload a directory to the sandbox
+  run           Run a job file locally, without a server (for CI)
+
+Commands other than run accept --server (default: $PRISM_URL, the server
+used at login, or ` + defaultServer + `). Set PRISM_TOKEN to use an
+access token instead of saved credentials.
+
+Run "prism <command> -h" for a command's flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	command, args := os.Args[1], os.Args[2:]
+	if (command == "agent" || command == "files") && len(args) > 0 {
+		command, args = command+" "+args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "login":
+		err = runLogin(args)
+	case "logout":
+		err = runLogout(args)
+	case "chat":
+		err = runChat(args)
+	case "agent run":
+		err = runAgent(args)
+	case "files sync":
+		err = runFilesSync(args)
+	case "run":
+		err = runJob(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	var status exitStatus
+	if errors.As(err, &status) {
+		os.Exit(int(status))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet creates the flag set for a command, with the shared --server flag
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("prism "+name, flag.ContinueOnError)
+	server := fs.String("server", "", "Prism server URL")
+	return fs, server
+}
+
+// runLogin signs in with an email and password, or with the local token
+// printed by a server running in desktop mode
+func runLogin(args []string) error {
+	fs, server := newFlagSet("login")
+	email := fs.String("email", "", "account email (prompted if omitted)")
+	localToken := fs.String("local-token", "", "sign in to a desktop mode server with its local token")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := newClient(*server)
+	if err != nil {
+		return err
+	}
+	c.creds.AccessToken = ""
+	c.creds.RefreshToken = ""
+
+	var resp handlers.AuthResponse
+	if *localToken != "" {
+		err = c.do("POST", "/auth/local", handlers.LocalLoginRequest{Token: *localToken}, &resp)
+	} else {
+		in := bufio.NewReader(os.Stdin)
+		if *email == "" {
+			*email = prompt(in, "Email: ")
+		}
+		// Passwords can be piped in for scripts; typed input is echoed
+		password := os.Getenv("PRISM_PASSWORD")
+		if password == "" {
+			password = prompt(in, "Password: ")
+		}
+		err = c.do("POST", "/auth/login", handlers.LoginRequest{Email: *email, Password: password}, &resp)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := c.setTokens(&resp); err != nil {
+		return err
+	}
+	fmt.Printf("Signed in to %s as %s\n", c.server, resp.User.Email)
+	return nil
+}
+
+// runLogout removes the saved tokens. Sessions on the server are left alone
+// so other devices stay signed in.
+func runLogout(args []string) error {
+	fs, _ := newFlagSet("logout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	creds, err := loadCredentials()
+	if err != nil {
+		return err
+	}
+	creds.AccessToken = ""
+	creds.RefreshToken = ""
+	if err := creds.save(); err != nil {
+		return err
+	}
+	fmt.Println("Signed out")
+	return nil
+}
+
+// prompt prints label and reads a line from in
+func prompt(in *bufio.Reader, label string) string {
+	fmt.Print(label)
+	line, _ := in.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// confirm asks a yes/no question, defaulting to no
+func confirm(in *bufio.Reader, question string) bool {
+	answer := strings.ToLower(prompt(in, question+" [y/N] "))
+	return answer == "y" || answer == "yes"
+}
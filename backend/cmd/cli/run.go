@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jacklau/prism/internal/headless"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/llm/anthropic"
+	"github.com/jacklau/prism/internal/llm/google"
+	"github.com/jacklau/prism/internal/llm/ollama"
+	"github.com/jacklau/prism/internal/llm/openai"
+)
+
+// Exit statuses of prism run
+const (
+	exitJobFailed  = 1 // A task failed or its check did not pass
+	exitJobInvalid = 2 // The job could not be loaded or run
+)
+
+// exitStatus is returned by commands that exit with a specific status
+type exitStatus int
+
+func (s exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(s))
+}
+
+// runJob executes a job file locally, without a server, and exits non-zero
+// when a task fails. Provider API keys are read from the environment.
+func runJob(args []string) error {
+	fs := flag.NewFlagSet("prism run", flag.ContinueOnError)
+	configPath := fs.String("config", "", "job file (required)")
+	repoDir := fs.String("repo", ".", "repository checkout to run against")
+	outputDir := fs.String("output", "prism-results", "directory for results.json, outputs and patches")
+	quiet := fs.Bool("quiet", false, "don't stream agent output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *configPath == "" {
+		fmt.Fprintln(os.Stderr, "error: --config is required")
+		return exitStatus(exitJobInvalid)
+	}
+
+	job, err := headless.LoadJob(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return exitStatus(exitJobInvalid)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var log io.Writer = os.Stderr
+	if *quiet {
+		log = nil
+	}
+	report, err := headless.NewRunner(newLLMManager()).Run(ctx, job, headless.Options{
+		RepoDir:   *repoDir,
+		OutputDir: *outputDir,
+		Log:       log,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return exitStatus(exitJobInvalid)
+	}
+
+	for _, task := range report.Tasks {
+		line := fmt.Sprintf("%-8s %s", task.Status, task.Name)
+		if task.Error != "" {
+			line += ": " + task.Error
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("Results written to %s\n", *outputDir)
+
+	if report.Status != headless.StatusPassed {
+		return exitStatus(exitJobFailed)
+	}
+	return nil
+}
+
+// newLLMManager registers the providers with API keys from the environment.
+// Ollama needs no key and is always available.
+func newLLMManager() *llm.Manager {
+	manager := llm.NewManager()
+
+	ollamaHost := os.Getenv("OLLAMA_HOST")
+	if ollamaHost == "" {
+		ollamaHost = "http://localhost:11434"
+	}
+	manager.RegisterProvider(ollama.NewClient(ollamaHost))
+	manager.RegisterProvider(openai.NewClient(os.Getenv("OPENAI_API_KEY")))
+	manager.RegisterProvider(anthropic.NewClient(os.Getenv("ANTHROPIC_API_KEY")))
+
+	googleKey := os.Getenv("GOOGLE_API_KEY")
+	if googleKey == "" {
+		googleKey = os.Getenv("GEMINI_API_KEY")
+	}
+	manager.RegisterProvider(google.NewClient(googleKey))
+
+	return manager
+}
@@ -1,35 +1,90 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/jacklau/prism/internal/agent"
 	"github.com/jacklau/prism/internal/api/routes"
 	"github.com/jacklau/prism/internal/api/websocket"
+	"github.com/jacklau/prism/internal/cluster"
 	"github.com/jacklau/prism/internal/config"
 	"github.com/jacklau/prism/internal/database"
 	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/desktop"
 	"github.com/jacklau/prism/internal/integrations"
+	"github.com/jacklau/prism/internal/integrations/confluence"
 	"github.com/jacklau/prism/internal/integrations/discord"
+	"github.com/jacklau/prism/internal/integrations/email"
+	"github.com/jacklau/prism/internal/integrations/github"
+	"github.com/jacklau/prism/internal/integrations/linear"
+	"github.com/jacklau/prism/internal/integrations/matrix"
+	"github.com/jacklau/prism/internal/integrations/mattermost"
+	"github.com/jacklau/prism/internal/integrations/notion"
 	"github.com/jacklau/prism/internal/integrations/posthog"
 	"github.com/jacklau/prism/internal/integrations/slack"
+	"github.com/jacklau/prism/internal/integrations/webhooks"
 	"github.com/jacklau/prism/internal/llm"
 	"github.com/jacklau/prism/internal/llm/anthropic"
 	"github.com/jacklau/prism/internal/llm/google"
 	"github.com/jacklau/prism/internal/llm/ollama"
 	"github.com/jacklau/prism/internal/llm/openai"
+	"github.com/jacklau/prism/internal/lsp"
 	"github.com/jacklau/prism/internal/sandbox"
 	"github.com/jacklau/prism/internal/security"
+	"github.com/jacklau/prism/internal/services/audit"
+	"github.com/jacklau/prism/internal/services/changes"
+	"github.com/jacklau/prism/internal/services/checkpoint"
 	"github.com/jacklau/prism/internal/services/coderunner"
+	"github.com/jacklau/prism/internal/services/concurrency"
+	"github.com/jacklau/prism/internal/services/contextpack"
+	"github.com/jacklau/prism/internal/services/digest"
+	"github.com/jacklau/prism/internal/services/discordbot"
+	"github.com/jacklau/prism/internal/services/docsources"
+	"github.com/jacklau/prism/internal/services/eval"
+	"github.com/jacklau/prism/internal/services/filehistory"
+	"github.com/jacklau/prism/internal/services/gitwriter"
+	"github.com/jacklau/prism/internal/services/guest"
+	"github.com/jacklau/prism/internal/services/instructions"
+	"github.com/jacklau/prism/internal/services/linearbot"
+	"github.com/jacklau/prism/internal/services/loginaudit"
+	"github.com/jacklau/prism/internal/services/modelinfo"
+	"github.com/jacklau/prism/internal/services/onboarding"
+	"github.com/jacklau/prism/internal/services/pinning"
+	"github.com/jacklau/prism/internal/services/prreview"
+	"github.com/jacklau/prism/internal/services/ratelimit"
+	"github.com/jacklau/prism/internal/services/slackbot"
+	"github.com/jacklau/prism/internal/services/speech"
+	"github.com/jacklau/prism/internal/services/summarizing"
+	"github.com/jacklau/prism/internal/services/titling"
+	"github.com/jacklau/prism/internal/services/transcription"
+	"github.com/jacklau/prism/internal/services/usage"
+	"github.com/jacklau/prism/internal/services/webhookqueue"
+	"github.com/jacklau/prism/internal/storage"
 	"github.com/jacklau/prism/internal/mcp"
 	"github.com/jacklau/prism/internal/tools"
 	"github.com/jacklau/prism/internal/tools/builtin"
 )
 
 func main() {
+	desktopMode := flag.Bool("desktop", false, "run as a local desktop app: bind to localhost, sign in automatically and open the browser")
+	flag.Parse()
+
+	// Desktop mode keeps its data in the user's config directory
+	if *desktopMode {
+		dataDir, err := desktop.Prepare()
+		if err != nil {
+			log.Fatalf("Failed to prepare desktop mode: %v", err)
+		}
+		log.Printf("Desktop mode: data directory %s", dataDir)
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -60,14 +115,64 @@ func main() {
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db.DB)
 	sessionRepo := repository.NewSessionRepository(db.DB)
+	accountTokenRepo := repository.NewAccountTokenRepository(db.DB)
 	conversationRepo := repository.NewConversationRepository(db.DB)
-	messageRepo := repository.NewMessageRepository(db.DB)
+	conversationRepo.SetEncryption(encryptionService, cfg.MessagesEncrypt)
+	messageRepo := repository.NewMessageRepository(db.DB, encryptionService, cfg.MessagesEncrypt)
+	conversationShareRepo := repository.NewConversationShareRepository(db.DB)
+	shareLinkRepo := repository.NewShareLinkRepository(db.DB)
 	webhookRepo := repository.NewWebhookRepository(db.DB, encryptionService)
 	providerKeyRepo := repository.NewProviderKeyRepository(db.DB)
+	organizationRepo := repository.NewOrganizationRepository(db.DB)
 	integrationRepo := repository.NewIntegrationRepository(db.DB, encryptionService)
-	fileHistoryRepo := repository.NewFileHistoryRepository(db.DB)
+	fileHistoryRepo := repository.NewFileHistoryRepository(db.DB, encryptionService, repository.FileHistoryOptions{
+		Encrypt:         cfg.FileHistoryEncrypt,
+		MaxBytesPerUser: cfg.FileHistoryMaxBytesPerUser,
+	})
 	workspaceRepo := repository.NewWorkspaceRepository(db.DB)
 	todoRepo := repository.NewTodoRepository(db.DB)
+	pinnedFileRepo := repository.NewPinnedFileRepository(db.DB)
+	feedbackRepo := repository.NewFeedbackRepository(db.DB)
+	checkpointRepo := repository.NewCheckpointRepository(db.DB)
+	auditScheduleRepo := repository.NewAuditScheduleRepository(db.DB)
+	digestScheduleRepo := repository.NewDigestScheduleRepository(db.DB)
+	preferencesRepo := repository.NewUserPreferencesRepository(db.DB)
+	outboundWebhookRepo := repository.NewOutboundWebhookRepository(db.DB, encryptionService)
+	slackLinkRepo := repository.NewSlackLinkRepository(db.DB)
+	usageRepo := repository.NewUsageRepository(db.DB)
+	idempotencyRepo := repository.NewIdempotencyRepository(db.DB)
+	secretRepo := repository.NewSecretRepository(db.DB, encryptionService)
+	toolResultRepo := repository.NewToolResultRepository(db.DB, encryptionService, cfg.MessagesEncrypt)
+	llmDebugRepo := repository.NewLLMDebugRepository(db.DB, encryptionService, cfg.MessagesEncrypt)
+	contextPackRepo := repository.NewContextPackRepository(db.DB)
+	workspaceSummaryRepo := repository.NewWorkspaceSummaryRepository(db.DB)
+	evalRepo := repository.NewEvalRepository(db.DB)
+
+	// Replies still streaming when the server last stopped keep what was
+	// generated, marked as interrupted
+	if n, err := messageRepo.InterruptPartials(); err != nil {
+		log.Printf("Failed to recover interrupted replies: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted replies", n)
+	}
+
+	// Secrets vault: {{secret:NAME}} references are resolved server-side, at
+	// the point of use, so raw values never reach prompts or chat history
+	secretVault := security.NewSecretVault(secretRepo.GetValue)
+
+	// Desktop mode signs the browser in as a single local user
+	var desktopUser *repository.User
+	var desktopToken string
+	if *desktopMode {
+		desktopUser, err = desktop.EnsureLocalUser(userRepo)
+		if err != nil {
+			log.Fatalf("Failed to create local user: %v", err)
+		}
+		desktopToken, err = desktop.NewLocalToken()
+		if err != nil {
+			log.Fatalf("Failed to generate local token: %v", err)
+		}
+	}
 
 	// Initialize code runner for GitHub webhook automation
 	var codeRunner *coderunner.Runner
@@ -77,10 +182,34 @@ func main() {
 			MemoryLimit:   cfg.CodeRunnerMemoryLimit,
 			CPULimit:      cfg.CodeRunnerCPULimit,
 			Timeout:       cfg.CodeRunnerTimeout,
+			GoImage:       cfg.CodeRunnerGoImage,
+			RustImage:     cfg.CodeRunnerRustImage,
+			JavaImage:     cfg.CodeRunnerJavaImage,
+			CImage:        cfg.CodeRunnerCImage,
+			CacheVolumes:  cfg.CodeRunnerCacheVolumes,
 		})
 		log.Println("Code runner initialized")
 	}
 
+	// Initialize object storage for build artifacts and checkpoint backups
+	// (local disk by default, or an S3-compatible bucket shared by replicas)
+	objectStore, err := storage.New(storage.Config{
+		Backend:  cfg.StorageBackend,
+		LocalDir: cfg.UploadDir,
+		S3: storage.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			Prefix:          cfg.S3Prefix,
+			PathStyle:       cfg.S3ForcePathStyle,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize object storage: %v", err)
+	}
+
 	// Initialize sandbox service for terminal/build functionality
 	sandboxService, err := sandbox.NewService(cfg)
 	if err != nil {
@@ -89,20 +218,29 @@ func main() {
 		log.Println("Sandbox service initialized")
 		// Attach workspace repository for workspace persistence
 		sandboxService.SetWorkspaceRepository(workspaceRepo)
+		sandboxService.SetObjectStore(objectStore)
+		// Sign the tokens that let browsers open build previews
+		sandboxService.SetPreviewTokens(jwtService.GeneratePreviewToken)
 	}
 
-	// Initialize tool registry with built-in tools
-	toolRegistry := tools.NewRegistry()
-	if sandboxService != nil {
-		toolConfig := builtin.Config{
-			FileHistoryRepo: fileHistoryRepo,
-			TodoRepo:        todoRepo,
-		}
-		if err := builtin.RegisterAll(toolRegistry, sandboxService, codeRunner, db.DB, toolConfig); err != nil {
-			log.Printf("Warning: Failed to register built-in tools: %v", err)
-		} else {
-			log.Println("Built-in tools registered")
+	// Initialize WebSocket hub
+	wsHub := websocket.NewHub()
+	go wsHub.Run()
+
+	// Join the other replicas when running behind a load balancer; the hub's
+	// messages are relayed to the clients connected to them
+	var clusterNode *cluster.Cluster
+	if cfg.RedisURL != "" {
+		clusterNode, err = cluster.New(cluster.Config{
+			RedisURL: cfg.RedisURL,
+			Prefix:   cfg.RedisPrefix,
+		})
+		if err != nil {
+			log.Fatalf("Failed to join cluster: %v", err)
 		}
+		clusterNode.AttachHub(wsHub)
+		clusterNode.Start()
+		log.Printf("Joined cluster as node %s", clusterNode.NodeID())
 	}
 
 	// Initialize LLM manager
@@ -125,15 +263,39 @@ func main() {
 	googleClient := google.NewClient("")
 	llmManager.RegisterProvider(googleClient)
 
+	// Cache each provider's models, refreshing them in the background
+	llmManager.SetModelCacheTTL(cfg.ModelCacheTTL)
+	llmManager.StartModelRefresh()
+
 	log.Printf("Registered %d LLM providers", len(llmManager.ListProviders()))
 
-	// Initialize WebSocket hub
-	wsHub := websocket.NewHub()
-	go wsHub.Run()
+	// Checks provider keys with a minimal request to the provider
+	keyValidator := llm.NewKeyValidator(llmManager, cfg.ProviderKeyCheckTTL)
+
+	// Model capabilities, from provider metadata plus local overrides
+	modelInfoService := modelinfo.NewService(llmManager, repository.NewModelOverrideRepository(db.DB))
+
+	// Per-user caps on running agents, swarms, builds and background shells,
+	// which admins can override per user
+	concurrencyLimiter := concurrency.NewLimiter(concurrency.Limits{
+		Agents: cfg.UserMaxConcurrentAgents,
+		Swarms: cfg.UserMaxConcurrentSwarms,
+		Builds: cfg.UserMaxConcurrentBuilds,
+		Shells: cfg.UserMaxConcurrentShells,
+	}, cfg.ConcurrencyQueueTimeout, repository.NewConcurrencyLimitRepository(db.DB))
 
 	// Initialize integrations manager
 	integrationManager := integrations.NewManager()
 
+	// Skip notifications users have opted out of in their preferences
+	integrationManager.SetNotificationFilter(func(userID string, eventType integrations.EventType) bool {
+		prefs, err := preferencesRepo.Get(userID)
+		if err != nil || prefs == nil {
+			return true
+		}
+		return prefs.WantsNotification(string(eventType))
+	})
+
 	// Register Discord integration
 	discordClient := discord.NewClient(&discord.Config{
 		WebhookURL: cfg.DiscordWebhookURL,
@@ -151,6 +313,24 @@ func main() {
 	})
 	integrationManager.RegisterNotification(slackClient)
 
+	// Register Matrix integration
+	matrixClient := matrix.NewClient(&matrix.Config{
+		HomeserverURL: cfg.MatrixHomeserverURL,
+		AccessToken:   cfg.MatrixAccessToken,
+		RoomID:        cfg.MatrixRoomID,
+		Enabled:       cfg.MatrixEnabled,
+	})
+	integrationManager.RegisterNotification(matrixClient)
+
+	// Register Mattermost integration
+	mattermostClient := mattermost.NewClient(&mattermost.Config{
+		WebhookURL: cfg.MattermostWebhookURL,
+		Channel:    cfg.MattermostChannel,
+		Username:   cfg.MattermostUsername,
+		Enabled:    cfg.MattermostEnabled,
+	})
+	integrationManager.RegisterNotification(mattermostClient)
+
 	// Register PostHog integration
 	posthogClient := posthog.NewClient(&posthog.Config{
 		APIKey:        cfg.PostHogAPIKey,
@@ -161,11 +341,352 @@ func main() {
 	})
 	integrationManager.RegisterAnalytics(posthogClient)
 
+	// Send users' events to their own Discord and Slack webhooks as well, and
+	// leave users who turned PostHog off out of analytics
+	integrationManager.SetUserIntegrationsLoader(func(userID string) (*integrations.UserIntegrations, error) {
+		user := &integrations.UserIntegrations{}
+
+		discordSettings, err := integrationRepo.GetDiscordSettings(userID)
+		if err != nil {
+			return nil, err
+		}
+		if discordSettings != nil && discordSettings.Enabled && discordSettings.WebhookURL != "" &&
+			!(discordClient.Enabled() && discordSettings.WebhookURL == cfg.DiscordWebhookURL) {
+			user.Notifications = append(user.Notifications, discord.NewClient(&discord.Config{
+				WebhookURL: discordSettings.WebhookURL,
+				Enabled:    true,
+			}))
+		}
+
+		slackSettings, err := integrationRepo.GetSlackSettings(userID)
+		if err != nil {
+			return nil, err
+		}
+		if slackSettings != nil && slackSettings.Enabled && slackSettings.WebhookURL != "" &&
+			!(slackClient.Enabled() && slackSettings.WebhookURL == cfg.SlackWebhookURL) {
+			user.Notifications = append(user.Notifications, slack.NewClient(&slack.Config{
+				WebhookURL: slackSettings.WebhookURL,
+				ChannelID:  slackSettings.ChannelID,
+				Enabled:    true,
+			}))
+		}
+
+		posthogSettings, err := integrationRepo.GetPostHogSettings(userID)
+		if err != nil {
+			return nil, err
+		}
+		if posthogSettings != nil && !posthogSettings.Enabled {
+			user.DisabledAnalytics = append(user.DisabledAnalytics, posthogClient.Name())
+		}
+
+		return user, nil
+	}, cfg.IntegrationSettingsCacheTTL)
+
+	// Register email (SMTP) notifications; recipients and events come from each user's preferences
+	var emailClient *email.Client
+	if cfg.SMTPEnabled {
+		emailClient = email.NewClient(&email.Config{
+			Host:        cfg.SMTPHost,
+			Port:        cfg.SMTPPort,
+			Username:    cfg.SMTPUsername,
+			Password:    cfg.SMTPPassword,
+			From:        cfg.SMTPFrom,
+			FromName:    cfg.SMTPFromName,
+			ImplicitTLS: cfg.SMTPImplicitTLS,
+			Enabled:     cfg.SMTPEnabled,
+			AppURL:      cfg.FrontendURL,
+		}, integrationRepo, userRepo)
+		integrationManager.RegisterSubscriber(emailClient)
+	}
+
+	// Register outbound webhooks (user-registered URLs receiving signed event payloads)
+	var webhookDispatcher *webhooks.Dispatcher
+	if cfg.OutboundWebhooksEnabled {
+		webhookDispatcher = webhooks.NewDispatcher(outboundWebhookRepo, webhooks.Config{
+			MaxAttempts: cfg.OutboundWebhookMaxAttempts,
+			Timeout:     cfg.OutboundWebhookTimeout,
+		})
+		webhookDispatcher.SetSecretVault(secretVault)
+		integrationManager.RegisterSubscriber(webhookDispatcher)
+	}
+
+	// Record usage for the in-app usage dashboard
+	integrationManager.RegisterSubscriber(usage.NewRecorder(usageRepo))
+
 	// Initialize agent manager for parallel agent execution
-	agentManager := agent.NewManager(llmManager, agent.DefaultManagerConfig())
+	agentManagerConfig := agent.DefaultManagerConfig()
+	agentManagerConfig.Pool.MinConcurrentAgents = cfg.AgentPoolMinWorkers
+	agentManagerConfig.Pool.MaxConcurrentAgents = cfg.AgentPoolMaxWorkers
+	agentManagerConfig.Pool.ScaleDownDelay = cfg.AgentPoolScaleDownDelay
+	agentManagerConfig.Pool.StarvationTimeout = cfg.AgentPoolStarvationTimeout
+	agentManagerConfig.Retention = cfg.AgentExecutionRetention
+	agentManagerConfig.MaxRetained = cfg.AgentExecutionMaxRetained
+	agentManager := agent.NewManager(llmManager, agentManagerConfig)
+	if clusterNode != nil && cfg.ClusterAgentLimit > 0 {
+		// Queued agent tasks also wait for a slot in the cluster-wide queue
+		agentManager.SetSharedQueue(clusterNode.AgentQueue(cfg.ClusterAgentLimit, cfg.AgentPoolStarvationTimeout))
+	}
+	// Swarm cost budgets use the same pricing as the model info API
+	agentManager.SetPricing(func(provider, model string) *llm.ModelPricing {
+		caps, err := modelInfoService.Get(provider, model)
+		if err != nil {
+			return nil
+		}
+		return caps.Pricing
+	})
 	agentManager.Start()
 	log.Println("Agent manager started")
 
+	// Initialize per-turn change tracking (built from file history)
+	var changeService *changes.Service
+	if sandboxService != nil {
+		changeService = changes.NewService(fileHistoryRepo, sandboxService)
+	}
+
+	// Initialize workspace checkpoints (shadow git repositories, requires git).
+	// The repositories are on local disk already, so they are only backed up
+	// to object storage when it is remote.
+	var checkpointService *checkpoint.Service
+	if sandboxService != nil && cfg.CheckpointsEnabled {
+		var checkpointStore storage.Store
+		if objectStore.Remote() {
+			checkpointStore = objectStore
+		}
+		checkpointService, err = checkpoint.NewService(checkpointRepo, sandboxService, checkpoint.Config{
+			Dir:             filepath.Join(cfg.UploadDir, "checkpoints"),
+			MaxPerWorkspace: cfg.CheckpointMaxPerWorkspace,
+			Timeout:         cfg.CheckpointTimeout,
+			Store:           checkpointStore,
+		})
+		if err != nil {
+			log.Printf("Warning: Workspace checkpoints disabled: %v", err)
+			checkpointService = nil
+		}
+	}
+
+	// Initialize project instruction loader (PRISM.md files in the workspace)
+	var projectInstructions *instructions.Loader
+	if sandboxService != nil && cfg.ProjectInstructionsEnabled {
+		projectInstructions = instructions.NewLoader(sandboxService, instructions.Config{
+			MaxBytes: cfg.ProjectInstructionsMaxBytes,
+		})
+	}
+
+	// Initialize dependency audits (scans run through the code runner)
+	var auditService *audit.Service
+	var auditScheduler *audit.Scheduler
+	if codeRunner != nil && cfg.DependencyAuditEnabled {
+		auditService = audit.NewService(codeRunner, audit.Config{
+			Timeout: cfg.DependencyAuditTimeout,
+		})
+		auditScheduler = audit.NewScheduler(auditService, auditScheduleRepo, integrationManager, cfg.DependencyAuditCheckInterval)
+		auditScheduler.Start()
+	}
+
+	// Send daily and weekly activity digests through the notification integrations
+	var digestService *digest.Service
+	if cfg.DigestEnabled {
+		digestService = digest.NewService(digestScheduleRepo, usageRepo, integrationManager, cfg.DigestCheckInterval)
+		digestService.Start()
+	}
+
+	// Record sign-ins, alerting users of new devices and repeated failures
+	loginAudit := loginaudit.NewService(repository.NewAuthEventRepository(db.DB), integrationManager, loginaudit.Config{
+		FailureThreshold: cfg.LoginFailureAlertThreshold,
+		FailureWindow:    cfg.LoginFailureAlertWindow,
+		Retention:        cfg.AuthEventRetention,
+	})
+
+	// Compact file history in the background: dedup older entries, encrypt
+	// plaintext content if enabled and enforce the per-user cap
+	fileHistoryCompactor := filehistory.NewCompactor(fileHistoryRepo, filehistory.Config{
+		MaxBytesPerUser: cfg.FileHistoryMaxBytesPerUser,
+		Interval:        cfg.FileHistoryCompactInterval,
+	})
+	fileHistoryCompactor.Start()
+
+	// Guest accounts are limited and purged, with their data, once idle
+	var guestService *guest.Service
+	if cfg.GuestModeEnabled {
+		guestService = guest.NewService(userRepo, sandboxService, checkpointService, guest.Config{
+			IdleTimeout: cfg.GuestIdleTimeout,
+			DeniedTools: cfg.GuestDeniedTools,
+		})
+		guestService.Start()
+	}
+
+	// Initialize pull request reviews (a reviewer agent per changed file),
+	// run from the REST API and by webhooks with an auto review
+	var prReviewService *prreview.Service
+	var prReviewer github.PullRequestReviewer
+	if cfg.PRReviewEnabled {
+		prReviewService = prreview.NewService(github.NewClient(), agentManager, userRepo, llmManager, providerKeyRepo, encryptionService, prreview.Config{
+			Provider:    cfg.PRReviewProvider,
+			Model:       cfg.PRReviewModel,
+			MaxFiles:    cfg.PRReviewMaxFiles,
+			FileTimeout: cfg.PRReviewFileTimeout,
+		})
+		prReviewer = prReviewService
+	}
+
+	// Initialize the git writer (commit messages and changelogs for
+	// workspace repositories)
+	var gitWriter *gitwriter.Writer
+	if sandboxService != nil {
+		gitWriter = gitwriter.NewWriter(sandboxService, llmManager, providerKeyRepo, encryptionService, gitwriter.Config{
+			Provider: cfg.GitSuggestProvider,
+			Model:    cfg.GitSuggestModel,
+		})
+	}
+
+	// Initialize Linear automation (issue webhooks run agents from each
+	// user's triggers; also serves the linear_search_issues tool)
+	var linearBot *linearbot.Bot
+	if cfg.LinearEnabled {
+		linearBot = linearbot.NewBot(linear.NewClient(), integrationRepo, agentManager, llmManager, providerKeyRepo, encryptionService, integrationManager, linearbot.Config{
+			Provider: cfg.LinearProvider,
+			Model:    cfg.LinearModel,
+			Timeout:  cfg.LinearAgentTimeout,
+		})
+	}
+
+	// Initialize documentation sources (serves the notion_* and
+	// confluence_* tools with each user's own credentials)
+	var docSources *docsources.Service
+	if cfg.DocSourcesEnabled {
+		docSources = docsources.NewService(notion.NewClient(), confluence.NewClient(), integrationRepo, docsources.Config{
+			MaxPageChars: cfg.DocSourceMaxPageChars,
+		})
+	}
+
+	// Initialize GitHub webhook delivery queue (deliveries are persisted and retried)
+	var webhookQueue *webhookqueue.Queue
+	if codeRunner != nil {
+		webhookQueue = webhookqueue.NewQueue(webhookRepo, github.NewDefaultWebhookHandler(codeRunner, prReviewer), integrationManager, webhookqueue.Config{
+			MaxAttempts: cfg.GitHubWebhookMaxAttempts,
+			BaseDelay:   cfg.GitHubWebhookRetryBaseDelay,
+			MaxDelay:    cfg.GitHubWebhookRetryMaxDelay,
+		})
+		webhookQueue.Start()
+	}
+
+	// Initialize language server manager (servers start on first use per workspace)
+	var lspManager *lsp.Manager
+	if sandboxService != nil && cfg.LSPEnabled {
+		lspManager = lsp.NewManager(lsp.Config{
+			IdleTimeout:     cfg.LSPIdleTimeout,
+			DiagnosticsWait: cfg.LSPDiagnosticsWait,
+		})
+	}
+
+	// Rate limits on sign-in and expensive actions; rejections are tracked as events
+	rateLimits := ratelimit.NewSet()
+	rateLimits.Add(ratelimit.NewLimiter(ratelimit.Login, cfg.RateLimitLoginPerMinute, time.Minute))
+	rateLimits.Add(ratelimit.NewLimiter(ratelimit.Register, cfg.RateLimitRegisterPerMinute, time.Minute))
+	rateLimits.Add(ratelimit.NewLimiter(ratelimit.Chat, cfg.RateLimitChatPerMinute, time.Minute))
+	rateLimits.Add(ratelimit.NewLimiter(ratelimit.Agent, cfg.RateLimitAgentPerMinute, time.Minute))
+	rateLimits.Add(ratelimit.NewLimiter(ratelimit.Tool, cfg.RateLimitToolPerMinute, time.Minute))
+	rateLimits.Add(ratelimit.NewLimiter(ratelimit.GuestChat, cfg.GuestRateLimitChatPerMinute, time.Minute))
+	rateLimits.Add(ratelimit.NewLimiter(ratelimit.GuestAgent, cfg.GuestRateLimitAgentPerMinute, time.Minute))
+	rateLimits.OnLimited = func(name, key string) {
+		log.Printf("Rate limit %s exceeded by %s", name, key)
+		event := &integrations.Event{
+			Type: integrations.EventRateLimited,
+			Data: map[string]interface{}{"limiter": name},
+		}
+		if name == ratelimit.Chat || name == ratelimit.Agent || name == ratelimit.Tool || name == ratelimit.GuestChat || name == ratelimit.GuestAgent {
+			event.UserID = key // Keyed by user; the auth limiters are keyed by IP
+		}
+		integrationManager.Track(event)
+	}
+
+	// Initialize tool registry with built-in tools
+	toolRegistry := tools.NewRegistry()
+	toolRegistry.SetDefaultTimeout(cfg.ToolTimeout)
+	toolRegistry.SetParamResolver(routes.NewToolSecretResolver(secretVault, cfg.ToolSecretTools))
+	for name, timeout := range cfg.ToolTimeoutOverrides {
+		toolRegistry.SetTimeout(name, timeout)
+	}
+	// The workspace context packer serves the pack_context tool, packs
+	// attached to conversations and agent.run's context_pack
+	var contextPacker *contextpack.Packer
+	if sandboxService != nil {
+		contextPacker = contextpack.NewPacker(sandboxService, contextpack.Config{
+			DefaultTokenBudget: cfg.ContextPackTokenBudget,
+			MaxTokenBudget:     cfg.ContextPackMaxTokenBudget,
+		})
+
+		toolConfig := builtin.Config{
+			FileHistoryRepo: fileHistoryRepo,
+			ChangeService:   changeService,
+			TodoRepo:        todoRepo,
+			OnTodosUpdated:  routes.NewPlanNotifier(wsHub),
+			AgentManager:    agentManager,
+			SpawnAgentConfig: &builtin.SpawnAgentConfig{
+				MaxDepth:      cfg.SubAgentMaxDepth,
+				MaxConcurrent: cfg.SubAgentMaxConcurrent,
+				Timeout:       cfg.SubAgentTimeout,
+			},
+			LSPManager:    lspManager,
+			AuditService:  auditService,
+			ContextPacker: contextPacker,
+			LinearBot:     linearBot,
+			DocSources:    docSources,
+
+			ConcurrencyLimiter: concurrencyLimiter,
+		}
+		if cfg.ToolAuditLog {
+			toolConfig.Middleware = append(toolConfig.Middleware, builtin.AuditMiddleware())
+		}
+		if cfg.RateLimitToolPerMinute > 0 {
+			toolConfig.Middleware = append(toolConfig.Middleware, builtin.RateLimitMiddleware(rateLimits))
+		}
+		if cfg.ToolRedactResults {
+			toolConfig.Middleware = append(toolConfig.Middleware, builtin.RedactSecretsMiddleware())
+		}
+		if projectInstructions != nil {
+			toolConfig.SpawnAgentConfig.Instructions = projectInstructions.Load
+		}
+		shellConfig := builtin.DefaultShellExecConfig()
+		if len(cfg.ShellAllowedCommands) > 0 {
+			shellConfig.AllowedCommands = cfg.ShellAllowedCommands
+		}
+		shellConfig.DeniedCommands = cfg.ShellDeniedCommands
+		if cfg.ShellMaxOutputBytes > 0 {
+			shellConfig.MaxOutputSize = cfg.ShellMaxOutputBytes
+		}
+		toolConfig.ShellExecConfig = &shellConfig
+		if err := builtin.RegisterAll(toolRegistry, sandboxService, codeRunner, db.DB, toolConfig); err != nil {
+			log.Printf("Warning: Failed to register built-in tools: %v", err)
+		} else {
+			log.Println("Built-in tools registered")
+		}
+	}
+
+	// Initialize repository onboarding summaries (analyzed on clone or on
+	// request, and added to chats in the workspace)
+	var repoAnalyzer *onboarding.Analyzer
+	if contextPacker != nil && cfg.RepoSummaryEnabled {
+		repoAnalyzer = onboarding.NewAnalyzer(sandboxService, contextPacker, agentManager, workspaceSummaryRepo, llmManager, providerKeyRepo, encryptionService, onboarding.Config{
+			Provider:    cfg.RepoSummaryProvider,
+			Model:       cfg.RepoSummaryModel,
+			Timeout:     cfg.RepoSummaryTimeout,
+			TokenBudget: cfg.RepoSummaryTokenBudget,
+		})
+		repoAnalyzer.Start()
+	}
+
+	// Initialize benchmark suites (agents run through the pool, their
+	// outputs checked by the code runner)
+	var evalService *eval.Service
+	if codeRunner != nil && cfg.EvalEnabled {
+		evalService = eval.NewService(agentManager, codeRunner, evalRepo, llmManager, providerKeyRepo, encryptionService, eval.Config{
+			CaseTimeout: cfg.EvalCaseTimeout,
+			MaxAttempts: cfg.EvalMaxAttempts,
+		})
+		evalService.Start()
+	}
+
 	// Initialize MCP components
 	mcpServer := mcp.NewServer(toolRegistry)
 	mcpClient := mcp.NewClient()
@@ -178,6 +699,23 @@ func main() {
 
 	// Initialize stdio MCP client for local MCP servers
 	stdioMCPClient := mcp.NewStdioClient()
+	stdioMCPClient.SetSecretVault(secretVault)
+	stdioMCPClient.SetEnabled(cfg.MCPStdioEnabled)
+	stdioPolicy := mcp.StdioPolicy{
+		AllowedCommands: cfg.MCPStdioAllowedCommands,
+		DeniedCommands:  cfg.MCPStdioDeniedCommands,
+		Sandbox:         cfg.MCPStdioSandbox,
+		SandboxImage:    cfg.MCPStdioSandboxImage,
+		SandboxNetwork:  cfg.MCPStdioSandboxNetwork,
+		MemoryLimitMB:   cfg.MCPStdioMemoryLimitMB,
+		CPULimit:        cfg.MCPStdioCPULimit,
+		MaxProcesses:    cfg.MCPStdioMaxProcesses,
+		MaxCPUSeconds:   cfg.MCPStdioMaxCPUSeconds,
+	}
+	if sandboxService != nil {
+		stdioPolicy.WorkspaceDir = sandboxService.GetOrCreateWorkDir
+	}
+	stdioMCPClient.SetPolicy(stdioPolicy)
 	stdioMCPRepo := mcp.NewStdioRepository(db.DB)
 
 	// Load all enabled stdio MCP servers from database
@@ -186,35 +724,182 @@ func main() {
 	}
 	log.Println("MCP server and clients initialized")
 
+	// Initialize conversation title generator
+	titleGenerator := titling.NewGenerator(llmManager, providerKeyRepo, encryptionService, titling.Config{
+		Provider: cfg.AutoTitleProvider,
+		Model:    cfg.AutoTitleModel,
+	})
+
+	// Initialize conversation summaries
+	summarizer := summarizing.NewSummarizer(llmManager, providerKeyRepo, encryptionService, summarizing.Config{
+		Provider: cfg.SummaryProvider,
+		Model:    cfg.SummaryModel,
+	})
+
+	// Initialize voice input transcription
+	transcriber := transcription.NewService(providerKeyRepo, encryptionService, transcription.Config{
+		LocalURL:    cfg.TranscriptionLocalURL,
+		LocalModel:  cfg.TranscriptionLocalModel,
+		OpenAIModel: cfg.TranscriptionOpenAIModel,
+		Timeout:     cfg.TranscriptionTimeout,
+	})
+
+	// Initialize text-to-speech for assistant messages
+	speechService := speech.NewService(providerKeyRepo, encryptionService, speech.Config{
+		OpenAIModel:       cfg.TTSOpenAIModel,
+		OpenAIVoice:       cfg.TTSOpenAIVoice,
+		ElevenLabsAPIKey:  cfg.ElevenLabsAPIKey,
+		ElevenLabsVoiceID: cfg.ElevenLabsVoiceID,
+		ElevenLabsModel:   cfg.ElevenLabsModel,
+		PiperURL:          cfg.TTSPiperURL,
+		PiperVoice:        cfg.TTSPiperVoice,
+		Timeout:           cfg.TTSTimeout,
+		MaxChars:          cfg.TTSMaxChars,
+	})
+
+	// Initialize Slack bot for /prism slash commands
+	var slackBot *slackbot.Bot
+	if cfg.SlackSigningSecret != "" && cfg.SlackBotToken != "" {
+		slackBot = slackbot.NewBot(
+			slackClient,
+			slackLinkRepo,
+			agentManager,
+			codeRunner,
+			sandboxService,
+			llmManager,
+			providerKeyRepo,
+			encryptionService,
+			integrationManager,
+			slackbot.Config{
+				SigningSecret: cfg.SlackSigningSecret,
+				Provider:      cfg.SlackBotProvider,
+				Model:         cfg.SlackBotModel,
+			},
+		)
+		log.Println("Slack bot initialized")
+	}
+
+	// Initialize Discord bot for /prism slash commands (connects to the gateway)
+	var discordBot *discordbot.Bot
+	if cfg.DiscordBotEnabled && cfg.DiscordBotToken != "" {
+		discordBot = discordbot.NewBot(
+			discordClient,
+			integrationRepo,
+			agentManager,
+			llmManager,
+			providerKeyRepo,
+			encryptionService,
+			integrationManager,
+			discordbot.Config{
+				BotToken: cfg.DiscordBotToken,
+				Provider: cfg.DiscordBotProvider,
+				Model:    cfg.DiscordBotModel,
+			},
+		)
+		discordBot.Start()
+		log.Println("Discord bot started")
+	}
+
+	// Initialize pinned file context builder (pinned files are read from the sandbox)
+	var pinnedContext *pinning.ContextBuilder
+	if sandboxService != nil {
+		pinnedContext = pinning.NewContextBuilder(pinnedFileRepo, sandboxService, pinning.Config{
+			TokenBudget: cfg.PinnedFilesTokenBudget,
+		})
+	}
+
 	// Setup routes
 	deps := &routes.Dependencies{
-		Config:             cfg,
-		JWTService:         jwtService,
-		EncryptionService:  encryptionService,
-		UserRepo:           userRepo,
-		SessionRepo:        sessionRepo,
-		ConversationRepo:   conversationRepo,
-		MessageRepo:        messageRepo,
-		WebhookRepo:        webhookRepo,
-		ProviderKeyRepo:    providerKeyRepo,
-		IntegrationRepo:    integrationRepo,
-		FileHistoryRepo:    fileHistoryRepo,
-		LLMManager:         llmManager,
-		WSHub:              wsHub,
-		IntegrationManager: integrationManager,
-		AgentManager:       agentManager,
-		CodeRunner:         codeRunner,
-		SandboxService:     sandboxService,
-		ToolRegistry:       toolRegistry,
-		MCPServer:          mcpServer,
-		MCPClient:          mcpClient,
-		MCPRepository:      mcpRepo,
-		StdioMCPClient:     stdioMCPClient,
-		StdioMCPRepository: stdioMCPRepo,
+		Config:                cfg,
+		JWTService:            jwtService,
+		EncryptionService:     encryptionService,
+		UserRepo:              userRepo,
+		SessionRepo:           sessionRepo,
+		AccountTokenRepo:      accountTokenRepo,
+		ConversationRepo:      conversationRepo,
+		MessageRepo:           messageRepo,
+		ConversationShareRepo: conversationShareRepo,
+		ShareLinkRepo:         shareLinkRepo,
+		WebhookRepo:           webhookRepo,
+		ProviderKeyRepo:       providerKeyRepo,
+		OrganizationRepo:      organizationRepo,
+		IntegrationRepo:       integrationRepo,
+		FileHistoryRepo:       fileHistoryRepo,
+		TodoRepo:              todoRepo,
+		PinnedFileRepo:        pinnedFileRepo,
+		FeedbackRepo:          feedbackRepo,
+		SecretRepo:            secretRepo,
+		SecretVault:           secretVault,
+		ToolResultRepo:        toolResultRepo,
+		LLMDebugRepo:          llmDebugRepo,
+		ContextPackRepo:       contextPackRepo,
+		ContextPacker:         contextPacker,
+		LLMManager:            llmManager,
+		KeyValidator:          keyValidator,
+		WSHub:                 wsHub,
+		Cluster:               clusterNode,
+		IntegrationManager:    integrationManager,
+		AgentManager:          agentManager,
+		CodeRunner:            codeRunner,
+		SandboxService:        sandboxService,
+		ToolRegistry:          toolRegistry,
+		MCPServer:             mcpServer,
+		MCPClient:             mcpClient,
+		MCPRepository:         mcpRepo,
+		StdioMCPClient:        stdioMCPClient,
+		StdioMCPRepository:    stdioMCPRepo,
+		TitleGenerator:        titleGenerator,
+		Summarizer:            summarizer,
+		PinnedContext:         pinnedContext,
+		ProjectInstructions:   projectInstructions,
+		ChangeService:         changeService,
+		Checkpoints:           checkpointService,
+		AuditService:          auditService,
+		AuditScheduleRepo:     auditScheduleRepo,
+		DigestService:         digestService,
+		DigestScheduleRepo:    digestScheduleRepo,
+		LoginAudit:            loginAudit,
+		PreferencesRepo:       preferencesRepo,
+		WebhookQueue:          webhookQueue,
+		PRReviewer:            prReviewService,
+		GitWriter:             gitWriter,
+		RepoAnalyzer:          repoAnalyzer,
+		Evals:                 evalService,
+		OutboundWebhookRepo:   outboundWebhookRepo,
+		WebhookDispatcher:     webhookDispatcher,
+		EmailClient:           emailClient,
+		SlackLinkRepo:         slackLinkRepo,
+		SlackBot:              slackBot,
+		DiscordBot:            discordBot,
+		LinearBot:             linearBot,
+		DocSources:            docSources,
+		UsageRepo:             usageRepo,
+		Transcriber:           transcriber,
+		SpeechService:         speechService,
+		RateLimits:            rateLimits,
+		Guests:                guestService,
+		FileHistoryCompactor:  fileHistoryCompactor,
+		ModelInfo:             modelInfoService,
+		IdempotencyRepo:       idempotencyRepo,
+		Concurrency:           concurrencyLimiter,
+		DesktopUser:           desktopUser,
+		DesktopToken:          desktopToken,
 	}
 
 	app := routes.Setup(deps)
 
+	// Open the browser once the server is accepting connections
+	if *desktopMode {
+		loginURL := desktop.LoginURL(cfg.Port, desktopToken)
+		app.Hooks().OnListen(func(fiber.ListenData) error {
+			log.Printf("Prism is running at %s", loginURL)
+			if err := desktop.OpenBrowser(loginURL); err != nil {
+				log.Printf("Failed to open browser, open the address above instead: %v", err)
+			}
+			return nil
+		})
+	}
+
 	// Graceful shutdown
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -227,10 +912,52 @@ func main() {
 		agentManager.Stop()
 		log.Println("Agent manager stopped")
 
+		// Stop refreshing provider models
+		llmManager.StopModelRefresh()
+
+		// Leave the cluster
+		if clusterNode != nil {
+			clusterNode.Stop()
+		}
+
 		// Stop all stdio MCP servers
 		stdioMCPClient.StopAll()
 		log.Println("Stdio MCP servers stopped")
 
+		// Stop scheduled dependency audits
+		if auditScheduler != nil {
+			auditScheduler.Stop()
+		}
+
+		// Stop sending activity digests
+		if digestService != nil {
+			digestService.Stop()
+		}
+
+		// Stop file history compaction
+		fileHistoryCompactor.Stop()
+
+		// Stop purging idle guests
+		if guestService != nil {
+			guestService.Stop()
+		}
+
+		// Stop webhook delivery retries
+		if webhookQueue != nil {
+			webhookQueue.Stop()
+		}
+
+		// Disconnect the Discord bot
+		if discordBot != nil {
+			discordBot.Stop()
+		}
+
+		// Stop language servers
+		if lspManager != nil {
+			lspManager.Stop()
+			log.Println("Language servers stopped")
+		}
+
 		// Close integrations manager
 		if err := integrationManager.Close(); err != nil {
 			log.Printf("Error closing integrations: %v", err)
@@ -14,10 +14,15 @@ type AgentStatus string
 
 const (
 	AgentStatusIdle      AgentStatus = "idle"
+	AgentStatusQueued    AgentStatus = "queued"
 	AgentStatusRunning   AgentStatus = "running"
 	AgentStatusCompleted AgentStatus = "completed"
 	AgentStatusFailed    AgentStatus = "failed"
 	AgentStatusCancelled AgentStatus = "cancelled"
+
+	// AgentStatusCancelledBeforeStart is for agents cancelled while still
+	// waiting for a worker, so their task never ran
+	AgentStatusCancelledBeforeStart AgentStatus = "cancelled_before_start"
 )
 
 // AgentConfig holds configuration for an agent
@@ -32,6 +37,15 @@ type AgentConfig struct {
 	MaxTokens     int               `json:"max_tokens,omitempty"`
 	Tools         []llm.ToolDefinition `json:"tools,omitempty"`
 	Metadata      map[string]string `json:"metadata,omitempty"`
+	JSONMode      bool              `json:"json_mode,omitempty"` // Responses are a JSON object, where the provider can enforce it
+
+	// Sampling controls beyond temperature, and deterministic mode for
+	// reproducible runs
+	llm.Sampling
+
+	// Credentials of the user the agent runs for, sent with its requests to
+	// Provider; nil uses the provider's own key
+	Credentials *llm.Credentials `json:"-"`
 }
 
 // Agent represents an autonomous agent that can execute tasks
@@ -51,21 +65,33 @@ type Agent struct {
 	llmManager  *llm.Manager
 	messages    []llm.Message
 	results     chan *AgentResult
-	events      chan *AgentEvent
+	events      *eventQueue[*AgentEvent]
+	done        chan struct{}
+
+	// onEvent, if set, observes every event in addition to the events channel
+	onEvent func(*AgentEvent)
+
+	// executionBudget, if set, is shared with the other agents of a batch
+	executionBudget *budgetTracker
 }
 
 // AgentResult represents the result of an agent's execution
+
 type AgentResult struct {
-	AgentID     string                 `json:"agent_id"`
-	TaskID      string                 `json:"task_id"`
-	Success     bool                   `json:"success"`
-	Output      string                 `json:"output,omitempty"`
-	ToolResults []ToolResult           `json:"tool_results,omitempty"`
-	Error       string                 `json:"error,omitempty"`
-	Usage       *llm.Usage             `json:"usage,omitempty"`
-	Metadata    map[string]interface{} `json:"metadata,omitempty"`
-	Duration    time.Duration          `json:"duration"`
-	CompletedAt time.Time              `json:"completed_at"`
+	AgentID        string                 `json:"agent_id"`
+	TaskID         string                 `json:"task_id"`
+	Success        bool                   `json:"success"`
+	Status         AgentStatus            `json:"status"` // completed, failed, cancelled or cancelled_before_start
+	Output         string                 `json:"output,omitempty"`
+	ToolResults    []ToolResult           `json:"tool_results,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+	Usage          *llm.Usage             `json:"usage,omitempty"`
+	TokensUsed     int                    `json:"tokens_used"` // Reported by the provider, or estimated if it didn't
+	ToolCalls      int                    `json:"tool_calls"`
+	BudgetExceeded string                 `json:"budget_exceeded,omitempty"` // The budget limit that stopped the agent, if any
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	Duration       time.Duration          `json:"duration"`
+	CompletedAt    time.Time              `json:"completed_at"`
 }
 
 // ToolResult represents the result of a tool execution
@@ -89,6 +115,7 @@ type AgentEvent struct {
 type AgentEventType string
 
 const (
+	AgentEventQueued        AgentEventType = "queued"
 	AgentEventStarted       AgentEventType = "started"
 	AgentEventThinking      AgentEventType = "thinking"
 	AgentEventStreamChunk   AgentEventType = "stream_chunk"
@@ -99,6 +126,11 @@ const (
 	AgentEventCancelled     AgentEventType = "cancelled"
 )
 
+// IsTerminal returns true for the event that ends an agent's run
+func (t AgentEventType) IsTerminal() bool {
+	return t == AgentEventCompleted || t == AgentEventFailed || t == AgentEventCancelled
+}
+
 // NewAgent creates a new agent instance
 func NewAgent(config AgentConfig, llmManager *llm.Manager) *Agent {
 	if config.ID == "" {
@@ -113,7 +145,8 @@ func NewAgent(config AgentConfig, llmManager *llm.Manager) *Agent {
 		llmManager: llmManager,
 		messages:   make([]llm.Message, 0),
 		results:    make(chan *AgentResult, 1),
-		events:     make(chan *AgentEvent, 100),
+		events:     newEventQueue[*AgentEvent](eventBufferSize),
+		done:       make(chan struct{}),
 	}
 }
 
@@ -125,7 +158,7 @@ func (a *Agent) Start(ctx context.Context, task *Task) error {
 		return ErrAgentAlreadyRunning
 	}
 
-	a.ctx, a.cancel = context.WithCancel(ctx)
+	a.ctx, a.cancel = context.WithCancel(llm.WithCredentials(ctx, a.Config.Credentials))
 	a.Status = AgentStatusRunning
 	now := time.Now()
 	a.StartedAt = &now
@@ -151,12 +184,72 @@ func (a *Agent) run(task *Task) {
 		if r := recover(); r != nil {
 			a.fail(ErrAgentPanicked.Error())
 		}
-		close(a.events)
+		a.events.close()
+		close(a.done)
 	}()
 
 	// Build initial messages
 	messages := a.buildMessages(task)
 
+	// Consumption, checked against the task's and execution's budgets as the
+	// response streams in. Tokens are estimated until the provider reports usage.
+	budget := newRunBudget(task, a.executionBudget)
+	var fullResponse string
+	var tokensUsed, outputTokens, toolCallCount int
+
+	exceed := func(limit, message string) {
+		a.mu.Lock()
+		a.Status = AgentStatusFailed
+		a.Error = message
+		now := time.Now()
+		a.CompletedAt = &now
+		a.mu.Unlock()
+
+		a.emitEvent(AgentEventFailed, map[string]interface{}{
+			"error":           message,
+			"budget_exceeded": limit,
+		})
+		a.results <- &AgentResult{
+			AgentID:        a.ID,
+			TaskID:         task.ID,
+			Success:        false,
+			Status:         AgentStatusFailed,
+			Error:          message,
+			Output:         fullResponse,
+			TokensUsed:     tokensUsed,
+			ToolCalls:      toolCallCount,
+			BudgetExceeded: limit,
+			Duration:       time.Since(startTime),
+			CompletedAt:    time.Now(),
+		}
+	}
+
+	// Budgets may already be used up, e.g. by earlier tasks of the same
+	// batch, or be too small for the prompt alone
+	for _, msg := range messages {
+		tokensUsed += llm.EstimateTokens(msg.Content)
+	}
+	if limit, message := budget.add(tokensUsed, 0); limit != "" {
+		exceed(limit, message)
+		return
+	}
+
+	// The time budget is enforced through the request's context
+	var chatCtx context.Context
+	var cancelChat context.CancelFunc
+	if deadline := budget.deadline(); !deadline.IsZero() {
+		chatCtx, cancelChat = context.WithDeadline(a.ctx, deadline)
+	} else {
+		chatCtx, cancelChat = context.WithCancel(a.ctx)
+	}
+	defer cancelChat()
+
+	// timedOut reports whether the time budget, rather than a cancellation,
+	// ended the request
+	timedOut := func() bool {
+		return chatCtx.Err() == context.DeadlineExceeded && a.ctx.Err() == nil
+	}
+
 	// Create chat request
 	req := &llm.ChatRequest{
 		Model:       a.Config.Model,
@@ -165,17 +258,25 @@ func (a *Agent) run(task *Task) {
 		Temperature: a.Config.Temperature,
 		MaxTokens:   a.Config.MaxTokens,
 		Stream:      true,
+		Sampling:    a.Config.Sampling,
+		JSONMode:    a.Config.JSONMode,
 	}
 
 	// Execute chat
-	stream, err := a.llmManager.Chat(a.ctx, a.Config.Provider, req)
+	stream, err := a.llmManager.Chat(chatCtx, a.Config.Provider, req)
 	if err != nil {
+		if timedOut() {
+			exceed(budget.exceeded())
+			return
+		}
 		a.fail(err.Error())
 		a.results <- &AgentResult{
 			AgentID:     a.ID,
 			TaskID:      task.ID,
 			Success:     false,
+			Status:      AgentStatusFailed,
 			Error:       err.Error(),
+			TokensUsed:  tokensUsed,
 			Duration:    time.Since(startTime),
 			CompletedAt: time.Now(),
 		}
@@ -183,7 +284,6 @@ func (a *Agent) run(task *Task) {
 	}
 
 	// Process stream
-	var fullResponse string
 	var toolCalls []llm.ToolCall
 	var usage *llm.Usage
 
@@ -202,8 +302,11 @@ func (a *Agent) run(task *Task) {
 				AgentID:     a.ID,
 				TaskID:      task.ID,
 				Success:     false,
+				Status:      AgentStatusCancelled,
 				Error:       "cancelled",
 				Output:      fullResponse,
+				TokensUsed:  tokensUsed,
+				ToolCalls:   toolCallCount,
 				Duration:    time.Since(startTime),
 				CompletedAt: time.Now(),
 			}
@@ -211,25 +314,38 @@ func (a *Agent) run(task *Task) {
 		default:
 		}
 
+		if timedOut() {
+			exceed(budget.exceeded())
+			return
+		}
+
 		if chunk.Error != nil {
 			a.fail(chunk.Error.Error())
 			a.results <- &AgentResult{
 				AgentID:     a.ID,
 				TaskID:      task.ID,
 				Success:     false,
+				Status:      AgentStatusFailed,
 				Error:       chunk.Error.Error(),
 				Output:      fullResponse,
+				TokensUsed:  tokensUsed,
+				ToolCalls:   toolCallCount,
 				Duration:    time.Since(startTime),
 				CompletedAt: time.Now(),
 			}
 			return
 		}
 
+		newTokens := 0
 		if chunk.Delta != "" {
 			fullResponse += chunk.Delta
 			a.emitEvent(AgentEventStreamChunk, map[string]interface{}{
 				"delta": chunk.Delta,
 			})
+
+			estimate := llm.EstimateTokens(fullResponse)
+			newTokens = estimate - outputTokens
+			outputTokens = estimate
 		}
 
 		if len(chunk.ToolCalls) > 0 {
@@ -246,6 +362,27 @@ func (a *Agent) run(task *Task) {
 		if chunk.Usage != nil {
 			usage = chunk.Usage
 		}
+
+		tokensUsed += newTokens
+		toolCallCount += len(chunk.ToolCalls)
+		if limit, message := budget.add(newTokens, len(chunk.ToolCalls)); limit != "" {
+			cancelChat()
+			exceed(limit, message)
+			return
+		}
+	}
+
+	// The stream also ends without an error when the time budget runs out
+	if timedOut() {
+		exceed(budget.exceeded())
+		return
+	}
+
+	// Replace the estimate with the provider's count. The response is already
+	// complete, so going over budget here only affects later tasks of a batch.
+	if usage != nil && usage.TotalTokens > 0 {
+		budget.add(usage.TotalTokens-tokensUsed, 0)
+		tokensUsed = usage.TotalTokens
 	}
 
 	// Mark as completed
@@ -264,8 +401,11 @@ func (a *Agent) run(task *Task) {
 		AgentID:     a.ID,
 		TaskID:      task.ID,
 		Success:     true,
+		Status:      AgentStatusCompleted,
 		Output:      fullResponse,
 		Usage:       usage,
+		TokensUsed:  tokensUsed,
+		ToolCalls:   toolCallCount,
 		Duration:    time.Since(startTime),
 		CompletedAt: time.Now(),
 	}
@@ -274,6 +414,10 @@ func (a *Agent) run(task *Task) {
 	if len(toolCalls) > 0 {
 		result.ToolResults = make([]ToolResult, len(toolCalls))
 		for i, tc := range toolCalls {
+			if task.recordedTools != nil {
+				result.ToolResults[i] = replayToolResult(task, tc)
+				continue
+			}
 			result.ToolResults[i] = ToolResult{
 				ToolCallID: tc.ID,
 				Name:       tc.Name,
@@ -304,6 +448,9 @@ func (a *Agent) buildMessages(task *Task) []llm.Message {
 		})
 	}
 
+	// Add the conversation the task continues, if any
+	messages = append(messages, task.History...)
+
 	// Add existing conversation history
 	messages = append(messages, a.messages...)
 
@@ -340,18 +487,63 @@ func (a *Agent) fail(errMsg string) {
 	})
 }
 
+// finishUnstarted ends an agent whose task never started, e.g. because it
+// was cancelled while still queued. It must not be called once Start has been.
+func (a *Agent) finishUnstarted(task *Task, status AgentStatus, errMsg string) {
+	a.mu.Lock()
+	a.Status = status
+	if status == AgentStatusFailed {
+		a.Error = errMsg
+	}
+	now := time.Now()
+	a.CompletedAt = &now
+	a.mu.Unlock()
+
+	switch status {
+	case AgentStatusCancelled:
+		a.emitEvent(AgentEventCancelled, nil)
+	case AgentStatusCancelledBeforeStart:
+		a.emitEvent(AgentEventCancelled, map[string]interface{}{
+			"status": string(status),
+		})
+	default:
+		a.emitEvent(AgentEventFailed, map[string]interface{}{
+			"error": errMsg,
+		})
+	}
+
+	a.results <- &AgentResult{
+		AgentID:     a.ID,
+		TaskID:      task.ID,
+		Success:     false,
+		Status:      status,
+		Error:       errMsg,
+		CompletedAt: now,
+	}
+	a.events.close()
+	close(a.done)
+}
+
+// setQueued marks the agent as waiting in the pool's queue
+func (a *Agent) setQueued() {
+	a.mu.Lock()
+	a.Status = AgentStatusQueued
+	a.mu.Unlock()
+}
+
 // emitEvent sends an event to the events channel
 func (a *Agent) emitEvent(eventType AgentEventType, data map[string]interface{}) {
-	select {
-	case a.events <- &AgentEvent{
+	event := &AgentEvent{
 		AgentID:   a.ID,
 		Type:      eventType,
 		Data:      data,
 		Timestamp: time.Now(),
-	}:
-	default:
-		// Event channel full, skip
 	}
+	if a.onEvent != nil {
+		a.onEvent(event)
+	}
+
+	a.events.push(event, eventType.IsTerminal())
 }
 
 // GetStatus returns the current status of the agent
@@ -366,9 +558,24 @@ func (a *Agent) Results() <-chan *AgentResult {
 	return a.results
 }
 
-// Events returns the events channel
+// Done returns a channel that is closed once the agent has finished running.
+// Unlike Results, waiting on Done does not consume the agent's result.
+func (a *Agent) Done() <-chan struct{} {
+	return a.done
+}
+
+// Events returns the events channel. Events are buffered for a slow reader;
+// if it falls too far behind, progress events are dropped (see DroppedEvents)
+// but the final completed, failed or cancelled event is always delivered.
+// The channel is closed after the final event.
 func (a *Agent) Events() <-chan *AgentEvent {
-	return a.events
+	return a.events.channel()
+}
+
+// DroppedEvents returns how many events were dropped because the events
+// channel's reader fell behind
+func (a *Agent) DroppedEvents() int64 {
+	return a.events.droppedCount()
 }
 
 // AddMessage adds a message to the agent's conversation history
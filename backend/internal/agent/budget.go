@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Budget limits the resources a task or execution may consume. Zero fields
+// are unlimited.
+type Budget struct {
+	MaxTokens    int           `json:"max_tokens,omitempty"`     // Prompt and completion tokens
+	MaxToolCalls int           `json:"max_tool_calls,omitempty"` // Tool calls requested by the model
+	MaxDuration  time.Duration `json:"max_duration,omitempty"`   // Wall-clock time
+}
+
+// Budget limits reported in AgentResult.BudgetExceeded
+const (
+	BudgetLimitTokens    = "tokens"
+	BudgetLimitToolCalls = "tool_calls"
+	BudgetLimitDuration  = "duration"
+)
+
+// budgetTracker accounts consumption against a budget. An execution's
+// tracker is shared by all of its agents, so its limits apply to the
+// execution as a whole rather than to each task.
+type budgetTracker struct {
+	budget   Budget
+	deadline time.Time
+
+	mu        sync.Mutex
+	tokens    int
+	toolCalls int
+}
+
+// newBudgetTracker starts tracking a budget. The duration limit counts from
+// now. Returns nil for a nil budget.
+func newBudgetTracker(budget *Budget) *budgetTracker {
+	if budget == nil {
+		return nil
+	}
+
+	tracker := &budgetTracker{budget: *budget}
+	if budget.MaxDuration > 0 {
+		tracker.deadline = time.Now().Add(budget.MaxDuration)
+	}
+	return tracker
+}
+
+// add records consumption and returns the limit that is now exceeded, if any
+func (t *budgetTracker) add(tokens, toolCalls int) string {
+	if t == nil {
+		return ""
+	}
+
+	t.mu.Lock()
+	t.tokens += tokens
+	t.toolCalls += toolCalls
+	t.mu.Unlock()
+
+	return t.exceeded()
+}
+
+// exceeded returns the limit that has been exceeded, if any
+func (t *budgetTracker) exceeded() string {
+	if t == nil {
+		return ""
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case t.budget.MaxTokens > 0 && t.tokens > t.budget.MaxTokens:
+		return BudgetLimitTokens
+	case t.budget.MaxToolCalls > 0 && t.toolCalls > t.budget.MaxToolCalls:
+		return BudgetLimitToolCalls
+	case !t.deadline.IsZero() && !time.Now().Before(t.deadline):
+		return BudgetLimitDuration
+	}
+	return ""
+}
+
+// message describes an exceeded limit
+func (t *budgetTracker) message(limit string) string {
+	switch limit {
+	case BudgetLimitTokens:
+		return fmt.Sprintf("%s: token budget of %d exhausted", ErrBudgetExceeded, t.budget.MaxTokens)
+	case BudgetLimitToolCalls:
+		return fmt.Sprintf("%s: tool call budget of %d exhausted", ErrBudgetExceeded, t.budget.MaxToolCalls)
+	case BudgetLimitDuration:
+		return fmt.Sprintf("%s: time budget of %s exhausted", ErrBudgetExceeded, t.budget.MaxDuration)
+	}
+	return ErrBudgetExceeded.Error()
+}
+
+// runBudget combines the budgets that apply to a single agent run: the
+// task's own and, for batch tasks, the execution's
+type runBudget []*budgetTracker
+
+// newRunBudget tracks the task's budget alongside the execution's, if any
+func newRunBudget(task *Task, execution *budgetTracker) runBudget {
+	var budget runBudget
+	if tracker := newBudgetTracker(task.Budget); tracker != nil {
+		budget = append(budget, tracker)
+	}
+	if execution != nil {
+		budget = append(budget, execution)
+	}
+	return budget
+}
+
+// add records consumption against every budget and returns a message for
+// the first exceeded limit, or "" if all are within budget
+func (b runBudget) add(tokens, toolCalls int) (string, string) {
+	var limit, message string
+	for _, tracker := range b {
+		if exceeded := tracker.add(tokens, toolCalls); exceeded != "" && limit == "" {
+			limit, message = exceeded, tracker.message(exceeded)
+		}
+	}
+	return limit, message
+}
+
+// exceeded returns the first exceeded limit and its message, or "" if all
+// budgets still have room
+func (b runBudget) exceeded() (string, string) {
+	for _, tracker := range b {
+		if limit := tracker.exceeded(); limit != "" {
+			return limit, tracker.message(limit)
+		}
+	}
+	return "", ""
+}
+
+// deadline returns the earliest duration limit, or the zero time if none
+func (b runBudget) deadline() time.Time {
+	var deadline time.Time
+	for _, tracker := range b {
+		if !tracker.deadline.IsZero() && (deadline.IsZero() || tracker.deadline.Before(deadline)) {
+			deadline = tracker.deadline
+		}
+	}
+	return deadline
+}
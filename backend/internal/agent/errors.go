@@ -14,16 +14,19 @@ var (
 var (
 	ErrPoolNotRunning = errors.New("agent pool is not running")
 	ErrQueueFull      = errors.New("task queue is full")
+	ErrAgentCancelled = errors.New("agent was cancelled before it started")
 )
 
 // Task errors
 var (
-	ErrTaskNotFound = errors.New("task not found")
-	ErrTaskTimeout  = errors.New("task execution timed out")
+	ErrTaskNotFound   = errors.New("task not found")
+	ErrTaskTimeout    = errors.New("task execution timed out")
+	ErrBudgetExceeded = errors.New("budget_exceeded")
 )
 
 // Manager errors
 var (
 	ErrManagerNotInitialized = errors.New("agent manager not initialized")
 	ErrInvalidAgentConfig    = errors.New("invalid agent configuration")
+	ErrExecutionRunning      = errors.New("execution is still running")
 )
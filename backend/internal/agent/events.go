@@ -0,0 +1,142 @@
+package agent
+
+import "sync"
+
+// eventBufferSize is how many undelivered events a subscriber may fall behind
+// by before non-terminal events are dropped
+const eventBufferSize = 1000
+
+// eventQueue delivers events to a single subscriber through a channel. Events
+// wait in the queue's buffer rather than in the channel, so producers never
+// block on a slow subscriber. When the buffer is full, non-terminal events are
+// dropped and counted; terminal events are always kept so the subscriber
+// learns how the run ended.
+type eventQueue[T any] struct {
+	out   chan T
+	limit int
+
+	mu      sync.Mutex
+	buffer  []T
+	dropped int64
+	closed  bool
+	started bool
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newEventQueue creates an event queue that buffers up to limit events
+func newEventQueue[T any](limit int) *eventQueue[T] {
+	return &eventQueue[T]{
+		out:   make(chan T),
+		limit: limit,
+		wake:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+	}
+}
+
+// channel returns the subscriber's channel. Delivery starts on first use;
+// until then events are only buffered, so a queue nobody reads from costs no
+// goroutine.
+func (q *eventQueue[T]) channel() <-chan T {
+	q.start()
+	return q.out
+}
+
+func (q *eventQueue[T]) start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.started {
+		q.started = true
+		go q.deliver()
+	}
+}
+
+// push queues an event without blocking
+func (q *eventQueue[T]) push(event T, terminal bool) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	if len(q.buffer) >= q.limit && !terminal {
+		q.dropped++
+		q.mu.Unlock()
+		return
+	}
+	q.buffer = append(q.buffer, event)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close ends the stream. The channel is closed once the buffered events have
+// been delivered.
+func (q *eventQueue[T]) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// cancel stops delivery immediately, discarding buffered events, and closes
+// the channel
+func (q *eventQueue[T]) cancel() {
+	q.stopOnce.Do(func() {
+		close(q.stop)
+	})
+	q.start()
+}
+
+// droppedCount returns how many events were dropped because the subscriber
+// fell too far behind
+func (q *eventQueue[T]) droppedCount() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// deliver forwards buffered events to the channel until the queue is closed
+// and drained, or cancelled
+func (q *eventQueue[T]) deliver() {
+	defer close(q.out)
+
+	for {
+		q.mu.Lock()
+		if len(q.buffer) == 0 {
+			closed := q.closed
+			q.mu.Unlock()
+			if closed {
+				return
+			}
+
+			select {
+			case <-q.wake:
+			case <-q.stop:
+				return
+			}
+			continue
+		}
+
+		event := q.buffer[0]
+		var zero T
+		q.buffer[0] = zero
+		q.buffer = q.buffer[1:]
+		q.mu.Unlock()
+
+		select {
+		case q.out <- event:
+		case <-q.stop:
+			return
+		}
+	}
+}
@@ -2,7 +2,9 @@ package agent
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jacklau/prism/internal/llm"
@@ -11,12 +13,22 @@ import (
 // ManagerConfig holds configuration for the agent manager
 type ManagerConfig struct {
 	Pool PoolConfig `json:"pool"`
+
+	// Finished executions and swarms are evicted from memory once they are
+	// older than the retention period, or when more than MaxRetained of each
+	// have finished, oldest first. Zero disables either limit.
+	Retention       time.Duration `json:"retention"`
+	MaxRetained     int           `json:"max_retained"`
+	JanitorInterval time.Duration `json:"janitor_interval"`
 }
 
 // DefaultManagerConfig returns the default manager configuration
 func DefaultManagerConfig() ManagerConfig {
 	return ManagerConfig{
-		Pool: DefaultPoolConfig(),
+		Pool:            DefaultPoolConfig(),
+		Retention:       24 * time.Hour,
+		MaxRetained:     1000,
+		JanitorInterval: 5 * time.Minute,
 	}
 }
 
@@ -37,6 +49,11 @@ type Manager struct {
 	executions   map[string]*Execution
 	executionsMu sync.RWMutex
 
+	// Garbage collection
+	janitorStop       chan struct{}
+	evictedExecutions int64
+	evictedSwarms     int64
+
 	// State
 	running bool
 	mu      sync.RWMutex
@@ -57,6 +74,17 @@ func NewManager(llmManager *llm.Manager, config ManagerConfig) *Manager {
 	}
 }
 
+// SetPricing sets how swarms price tokens for their cost budgets
+func (m *Manager) SetPricing(pricing PricingFunc) {
+	m.orchestrator.SetPricing(pricing)
+}
+
+// SetSharedQueue shares the pool's queue with other server replicas. It must
+// be called before Start.
+func (m *Manager) SetSharedQueue(queue SharedQueue) {
+	m.pool.SetSharedQueue(queue)
+}
+
 // Start initializes and starts the manager
 func (m *Manager) Start() {
 	m.mu.Lock()
@@ -65,9 +93,14 @@ func (m *Manager) Start() {
 		return
 	}
 	m.running = true
+	m.janitorStop = make(chan struct{})
 	m.mu.Unlock()
 
 	m.pool.Start()
+
+	if m.config.JanitorInterval > 0 {
+		go m.janitor(m.janitorStop)
+	}
 }
 
 // Stop gracefully shuts down the manager
@@ -78,11 +111,83 @@ func (m *Manager) Stop() {
 		return
 	}
 	m.running = false
+	close(m.janitorStop)
 	m.mu.Unlock()
 
 	m.pool.Stop()
 }
 
+// janitor periodically evicts finished executions and swarms until stopped
+func (m *Manager) janitor(stop <-chan struct{}) {
+	ticker := time.NewTicker(m.config.JanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.CollectGarbage()
+		}
+	}
+}
+
+// CollectGarbage evicts finished executions and swarms that are past the
+// retention period or beyond the history limit. It returns how many of each
+// were evicted.
+func (m *Manager) CollectGarbage() (executions, swarms int) {
+	var cutoff time.Time
+	if m.config.Retention > 0 {
+		cutoff = time.Now().Add(-m.config.Retention)
+	}
+
+	executions = m.evictExecutions(cutoff, m.config.MaxRetained)
+	swarms = m.orchestrator.evictSwarms(cutoff, m.config.MaxRetained)
+
+	atomic.AddInt64(&m.evictedExecutions, int64(executions))
+	atomic.AddInt64(&m.evictedSwarms, int64(swarms))
+	return executions, swarms
+}
+
+// evictExecutions removes finished executions that completed before the
+// cutoff, then the oldest ones beyond the limit. A zero cutoff or limit is
+// ignored.
+func (m *Manager) evictExecutions(cutoff time.Time, limit int) int {
+	m.executionsMu.Lock()
+	defer m.executionsMu.Unlock()
+
+	type finishedExecution struct {
+		id          string
+		completedAt time.Time
+	}
+	var finished []finishedExecution
+	evicted := 0
+	for id, execution := range m.executions {
+		completedAt, ok := execution.finishedAt()
+		if !ok {
+			continue
+		}
+		if !cutoff.IsZero() && completedAt.Before(cutoff) {
+			delete(m.executions, id)
+			evicted++
+			continue
+		}
+		finished = append(finished, finishedExecution{id, completedAt})
+	}
+
+	if limit > 0 && len(finished) > limit {
+		sort.Slice(finished, func(i, j int) bool {
+			return finished[i].completedAt.Before(finished[j].completedAt)
+		})
+		for _, f := range finished[:len(finished)-limit] {
+			delete(m.executions, f.id)
+			evicted++
+		}
+	}
+
+	return evicted
+}
+
 // RegisterConfig registers a named agent configuration for reuse
 func (m *Manager) RegisterConfig(name string, config AgentConfig) {
 	m.configsMu.Lock()
@@ -110,8 +215,41 @@ func (m *Manager) ListConfigs() map[string]AgentConfig {
 	return configs
 }
 
-// RunTask executes a single task with a new agent
-func (m *Manager) RunTask(ctx context.Context, task *Task, config AgentConfig) (*Execution, error) {
+// ExecutionOption configures an execution
+type ExecutionOption func(*executionOptions)
+
+type executionOptions struct {
+	budget   *Budget
+	owner    string
+	replayOf string
+}
+
+// WithExecutionBudget limits the resources an execution's tasks may consume
+// together. For a single task it applies when the task has no budget of its own.
+func WithExecutionBudget(budget Budget) ExecutionOption {
+	return func(o *executionOptions) {
+		o.budget = &budget
+	}
+}
+
+// WithOwner records the user an execution runs for
+func WithOwner(userID string) ExecutionOption {
+	return func(o *executionOptions) {
+		o.owner = userID
+	}
+}
+
+func newExecutionOptions(opts []ExecutionOption) *executionOptions {
+	options := &executionOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// RunTask executes a single task with a new agent. The task waits in the
+// pool's queue, by priority, until a worker is free.
+func (m *Manager) RunTask(ctx context.Context, task *Task, config AgentConfig, opts ...ExecutionOption) (*Execution, error) {
 	m.mu.RLock()
 	if !m.running {
 		m.mu.RUnlock()
@@ -124,8 +262,13 @@ func (m *Manager) RunTask(ctx context.Context, task *Task, config AgentConfig) (
 		return nil, ErrInvalidAgentConfig
 	}
 
-	// Create agent and execute
-	agent, err := m.pool.SubmitImmediate(task, config)
+	options := newExecutionOptions(opts)
+	if task.Budget == nil {
+		task.Budget = options.budget
+	}
+
+	// Create agent and queue the task
+	agent, err := m.pool.Enqueue(task, config)
 	if err != nil {
 		return nil, err
 	}
@@ -135,6 +278,9 @@ func (m *Manager) RunTask(ctx context.Context, task *Task, config AgentConfig) (
 		Type:      ExecutionTypeSingle,
 		Tasks:     []*Task{task},
 		Agents:    []*Agent{agent},
+		Budget:    task.Budget,
+		Owner:     options.owner,
+		ReplayOf:  options.replayOf,
 		Status:    ExecutionStatusRunning,
 		StartedAt: time.Now(),
 	}
@@ -159,7 +305,7 @@ func (m *Manager) RunTaskWithConfig(ctx context.Context, task *Task, configName
 }
 
 // RunParallel executes multiple tasks in parallel
-func (m *Manager) RunParallel(ctx context.Context, tasks []*Task, config AgentConfig) (*Execution, error) {
+func (m *Manager) RunParallel(ctx context.Context, tasks []*Task, config AgentConfig, opts ...ExecutionOption) (*Execution, error) {
 	m.mu.RLock()
 	if !m.running {
 		m.mu.RUnlock()
@@ -174,6 +320,8 @@ func (m *Manager) RunParallel(ctx context.Context, tasks []*Task, config AgentCo
 
 	// Create batch task
 	batch := NewBatchTask(tasks, true, m.config.Pool.MaxConcurrentAgents)
+	options := newExecutionOptions(opts)
+	batch.Budget = options.budget
 
 	// Submit batch
 	batchExec, err := m.pool.SubmitBatch(batch, config)
@@ -186,9 +334,13 @@ func (m *Manager) RunParallel(ctx context.Context, tasks []*Task, config AgentCo
 		Type:           ExecutionTypeParallel,
 		Tasks:          tasks,
 		Agents:         batchExec.Agents,
+		Budget:         batch.Budget,
+		Owner:          options.owner,
+		ReplayOf:       options.replayOf,
 		Status:         ExecutionStatusRunning,
 		StartedAt:      time.Now(),
 		batchExecution: batchExec,
+		collected:      make(chan struct{}),
 	}
 
 	m.executionsMu.Lock()
@@ -202,7 +354,7 @@ func (m *Manager) RunParallel(ctx context.Context, tasks []*Task, config AgentCo
 }
 
 // RunSequential executes multiple tasks sequentially
-func (m *Manager) RunSequential(ctx context.Context, tasks []*Task, config AgentConfig) (*Execution, error) {
+func (m *Manager) RunSequential(ctx context.Context, tasks []*Task, config AgentConfig, opts ...ExecutionOption) (*Execution, error) {
 	m.mu.RLock()
 	if !m.running {
 		m.mu.RUnlock()
@@ -217,6 +369,8 @@ func (m *Manager) RunSequential(ctx context.Context, tasks []*Task, config Agent
 
 	// Create batch task (sequential)
 	batch := NewBatchTask(tasks, false, 1)
+	options := newExecutionOptions(opts)
+	batch.Budget = options.budget
 
 	// Submit batch
 	batchExec, err := m.pool.SubmitBatch(batch, config)
@@ -229,9 +383,13 @@ func (m *Manager) RunSequential(ctx context.Context, tasks []*Task, config Agent
 		Type:           ExecutionTypeSequential,
 		Tasks:          tasks,
 		Agents:         batchExec.Agents,
+		Budget:         batch.Budget,
+		Owner:          options.owner,
+		ReplayOf:       options.replayOf,
 		Status:         ExecutionStatusRunning,
 		StartedAt:      time.Now(),
 		batchExecution: batchExec,
+		collected:      make(chan struct{}),
 	}
 
 	m.executionsMu.Lock()
@@ -257,29 +415,37 @@ func (m *Manager) monitorExecution(execution *Execution) {
 	case result := <-agent.Results():
 		execution.mu.Lock()
 		execution.Results = []*AgentResult{result}
-		if result.Success {
-			execution.Status = ExecutionStatusCompleted
-		} else {
-			execution.Status = ExecutionStatusFailed
-			execution.Error = result.Error
+		if !execution.Status.cancelled() {
+			if result.Success {
+				execution.Status = ExecutionStatusCompleted
+			} else {
+				execution.Status = ExecutionStatusFailed
+				execution.Error = result.Error
+			}
+			now := time.Now()
+			execution.CompletedAt = &now
 		}
-		now := time.Now()
-		execution.CompletedAt = &now
 		execution.mu.Unlock()
 	}
 }
 
 // monitorBatchExecution monitors a batch execution
 func (m *Manager) monitorBatchExecution(execution *Execution, batchExec *BatchExecution) {
+	defer close(execution.collected)
+
 	// Collect results as they come in
 	results := make([]*AgentResult, 0, len(execution.Tasks))
 	for result := range batchExec.ResultsChan() {
 		results = append(results, result)
 	}
 
-	// Update execution status
+	// Update execution status, unless it was cancelled
 	execution.mu.Lock()
+	defer execution.mu.Unlock()
 	execution.Results = results
+	if execution.Status.cancelled() {
+		return
+	}
 	execution.Status = ExecutionStatusCompleted
 
 	// Check if any failed
@@ -292,7 +458,19 @@ func (m *Manager) monitorBatchExecution(execution *Execution, batchExec *BatchEx
 
 	now := time.Now()
 	execution.CompletedAt = &now
-	execution.mu.Unlock()
+}
+
+// QueuePosition returns the 1-based queue position of a single-task
+// execution, or 0 once it has started
+func (m *Manager) QueuePosition(id string) (int, error) {
+	execution, err := m.GetExecution(id)
+	if err != nil {
+		return 0, err
+	}
+	if len(execution.Tasks) == 0 {
+		return 0, nil
+	}
+	return m.pool.QueuePosition(execution.Tasks[0].ID), nil
 }
 
 // GetExecution retrieves an execution by ID
@@ -319,7 +497,9 @@ func (m *Manager) ListExecutions() []*Execution {
 	return executions
 }
 
-// CancelExecution cancels an execution by ID
+// CancelExecution cancels an execution by ID. Agents still queued are
+// removed from the queue; if none of them had started, the execution ends as
+// ExecutionStatusCancelledBeforeStart.
 func (m *Manager) CancelExecution(id string) error {
 	m.executionsMu.RLock()
 	execution, ok := m.executions[id]
@@ -329,13 +509,19 @@ func (m *Manager) CancelExecution(id string) error {
 		return ErrTaskNotFound
 	}
 
-	// Stop all agents in the execution
+	// Stop all agents in the execution, including any still queued
+	beforeStart := len(execution.Agents) > 0
 	for _, agent := range execution.Agents {
-		agent.Stop()
+		if !m.pool.stopAgent(agent) {
+			beforeStart = false
+		}
 	}
 
 	execution.mu.Lock()
 	execution.Status = ExecutionStatusCancelled
+	if beforeStart {
+		execution.Status = ExecutionStatusCancelledBeforeStart
+	}
 	now := time.Now()
 	execution.CompletedAt = &now
 	execution.mu.Unlock()
@@ -358,22 +544,29 @@ func (m *Manager) Stats() *ManagerStats {
 	m.executionsMu.RLock()
 	defer m.executionsMu.RUnlock()
 
+	workers, busy := m.pool.Workers()
 	stats := &ManagerStats{
 		TotalExecutions:  len(m.executions),
 		ActiveAgents:     m.pool.ActiveAgents(),
 		QueuedTasks:      m.pool.QueueSize(),
+		Workers:          workers,
+		BusyWorkers:      busy,
 		RegisteredConfigs: len(m.configs),
+		EvictedExecutions: atomic.LoadInt64(&m.evictedExecutions),
+		EvictedSwarms:     atomic.LoadInt64(&m.evictedSwarms),
+		DroppedEvents:     m.pool.eventBroadcaster.Dropped(),
 	}
+	stats.ActiveSwarms, stats.RetainedSwarms = m.orchestrator.swarmCounts()
 
 	for _, exec := range m.executions {
-		switch exec.Status {
+		switch exec.GetStatus() {
 		case ExecutionStatusRunning:
 			stats.RunningExecutions++
 		case ExecutionStatusCompleted:
 			stats.CompletedExecutions++
 		case ExecutionStatusFailed:
 			stats.FailedExecutions++
-		case ExecutionStatusCancelled:
+		case ExecutionStatusCancelled, ExecutionStatusCancelledBeforeStart:
 			stats.CancelledExecutions++
 		}
 	}
@@ -400,8 +593,17 @@ const (
 	ExecutionStatusPartiallyCompleted ExecutionStatus = "partially_completed"
 	ExecutionStatusFailed             ExecutionStatus = "failed"
 	ExecutionStatusCancelled          ExecutionStatus = "cancelled"
+
+	// ExecutionStatusCancelledBeforeStart is for executions cancelled
+	// before any of their agents left the queue
+	ExecutionStatusCancelledBeforeStart ExecutionStatus = "cancelled_before_start"
 )
 
+// cancelled reports whether the execution was cancelled
+func (s ExecutionStatus) cancelled() bool {
+	return s == ExecutionStatusCancelled || s == ExecutionStatusCancelledBeforeStart
+}
+
 // Execution represents the execution of one or more tasks
 type Execution struct {
 	ID          string          `json:"id"`
@@ -409,13 +611,32 @@ type Execution struct {
 	Tasks       []*Task         `json:"tasks"`
 	Agents      []*Agent        `json:"-"` // Don't expose internal agents
 	Results     []*AgentResult  `json:"results,omitempty"`
+	Budget      *Budget         `json:"budget,omitempty"`
 	Status      ExecutionStatus `json:"status"`
 	Error       string          `json:"error,omitempty"`
 	StartedAt   time.Time       `json:"started_at"`
 	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	Owner       string          `json:"-"`                   // User the execution runs for, if any
+	ReplayOf    string          `json:"replay_of,omitempty"` // Execution this one replays
 
 	mu             sync.RWMutex
 	batchExecution *BatchExecution
+	collected      chan struct{} // Closed once a batch's results are stored
+}
+
+// finishedAt returns when the execution finished, or false if it is still
+// pending or running
+func (e *Execution) finishedAt() (time.Time, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.Status == ExecutionStatusPending || e.Status == ExecutionStatusRunning {
+		return time.Time{}, false
+	}
+	if e.CompletedAt == nil {
+		return e.StartedAt, true
+	}
+	return *e.CompletedAt, true
 }
 
 // GetStatus returns the current execution status (thread-safe)
@@ -432,10 +653,10 @@ func (e *Execution) GetResults() []*AgentResult {
 	return append([]*AgentResult{}, e.Results...)
 }
 
-// Wait blocks until the execution is complete
+// Wait blocks until the execution is complete and its results are stored
 func (e *Execution) Wait() {
-	if e.batchExecution != nil {
-		e.batchExecution.Wait()
+	if e.collected != nil {
+		<-e.collected
 		return
 	}
 
@@ -458,8 +679,18 @@ type ManagerStats struct {
 	CancelledExecutions int `json:"cancelled_executions"`
 	ActiveAgents        int `json:"active_agents"`
 	QueuedTasks         int `json:"queued_tasks"`
+	Workers             int `json:"workers"`
+	BusyWorkers         int `json:"busy_workers"`
 	RegisteredConfigs   int `json:"registered_configs"`
 	ActiveSwarms        int `json:"active_swarms"`
+	RetainedSwarms      int `json:"retained_swarms"`
+
+	// Evicted since the manager started
+	EvictedExecutions int64 `json:"evicted_executions"`
+	EvictedSwarms     int64 `json:"evicted_swarms"`
+
+	// Events subscribers missed by falling behind; terminal events are never dropped
+	DroppedEvents int64 `json:"dropped_events"`
 }
 
 // ==================== Swarm/Multi-Agent Operations ====================
@@ -496,8 +727,9 @@ func (m *Manager) CancelSwarm(id string) error {
 	return m.orchestrator.CancelSwarm(id)
 }
 
-// RunMultiAgent is a convenience method to run multiple agents with different roles on a task
-func (m *Manager) RunMultiAgent(ctx context.Context, task string, strategy SwarmStrategy, agentConfigs []AgentRoleConfig, baseConfig AgentConfig) (*Swarm, error) {
+// RunMultiAgent is a convenience method to run multiple agents with different roles on a task.
+// Options may be nil for the default timeout and no budget.
+func (m *Manager) RunMultiAgent(ctx context.Context, task string, strategy SwarmStrategy, agentConfigs []AgentRoleConfig, baseConfig AgentConfig, options *SwarmOptions) (*Swarm, error) {
 	m.mu.RLock()
 	if !m.running {
 		m.mu.RUnlock()
@@ -519,6 +751,9 @@ func (m *Manager) RunMultiAgent(ctx context.Context, task string, strategy Swarm
 		if agentConfigs[i].Config.MaxTokens == 0 {
 			agentConfigs[i].Config.MaxTokens = baseConfig.MaxTokens
 		}
+		if agentConfigs[i].Config.Sampling.IsZero() {
+			agentConfigs[i].Config.Sampling = baseConfig.Sampling
+		}
 	}
 
 	swarmConfig := SwarmConfig{
@@ -527,6 +762,11 @@ func (m *Manager) RunMultiAgent(ctx context.Context, task string, strategy Swarm
 		AgentConfigs: agentConfigs,
 		SynthesizerConfig: &baseConfig,
 	}
+	if options != nil {
+		swarmConfig.Timeout = options.Timeout
+		swarmConfig.Budget = options.Budget
+		swarmConfig.EarlyStop = options.EarlyStop
+	}
 
 	swarm := m.CreateSwarm(swarmConfig)
 	if err := m.RunSwarm(ctx, swarm.ID, task); err != nil {
@@ -555,5 +795,5 @@ func (m *Manager) QuickSwarm(ctx context.Context, task string, roles []AgentRole
 		Model:    model,
 	}
 
-	return m.RunMultiAgent(ctx, task, StrategyParallel, agentConfigs, baseConfig)
+	return m.RunMultiAgent(ctx, task, StrategyParallel, agentConfigs, baseConfig, nil)
 }
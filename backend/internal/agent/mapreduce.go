@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// maxSubtasks caps how many subtasks a map-reduce planner may hand out
+const maxSubtasks = 20
+
+// SwarmSubtask is a part of a map-reduce swarm's task, worked on by one agent
+type SwarmSubtask struct {
+	Index       int    `json:"index"` // 1-based, in the planner's order
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	AgentID     string `json:"agent_id,omitempty"` // Set once an agent takes it
+	Success     bool   `json:"success"`
+	Error       string `json:"error,omitempty"`
+}
+
+// GetSubtasks returns how a map-reduce swarm split its task (thread-safe)
+func (s *Swarm) GetSubtasks() []SwarmSubtask {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]SwarmSubtask{}, s.Subtasks...)
+}
+
+// plannedSubtask is a subtask as the planner writes it. Planners may also
+// give plain strings.
+type plannedSubtask struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// UnmarshalJSON accepts a subtask object or a plain string
+func (p *plannedSubtask) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		p.Description = text
+		return nil
+	}
+
+	type subtask plannedSubtask
+	return json.Unmarshal(data, (*subtask)(p))
+}
+
+// listItemPattern matches numbered or bulleted list items
+var listItemPattern = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*•])\s+(.+)$`)
+
+// parseSubtasks extracts the subtasks from a planner's response. Planners are
+// asked for JSON, {"subtasks": [{"title", "description"}]}, but a bare array
+// or, from models that ignore the request, a numbered list are accepted too.
+func parseSubtasks(output string) []SwarmSubtask {
+	var planned []plannedSubtask
+
+	if start := strings.IndexAny(output, "{["); start >= 0 {
+		text := output[start:]
+		if end := strings.LastIndexAny(text, "}]"); end >= 0 {
+			text = text[:end+1]
+		}
+
+		var wrapped struct {
+			Subtasks []plannedSubtask `json:"subtasks"`
+		}
+		if err := json.Unmarshal([]byte(text), &wrapped); err == nil && len(wrapped.Subtasks) > 0 {
+			planned = wrapped.Subtasks
+		} else if err := json.Unmarshal([]byte(text), &planned); err != nil {
+			planned = nil
+		}
+	}
+
+	if len(planned) == 0 {
+		for _, line := range strings.Split(output, "\n") {
+			if match := listItemPattern.FindStringSubmatch(line); match != nil {
+				planned = append(planned, plannedSubtask{Description: strings.TrimSpace(match[1])})
+			}
+		}
+	}
+
+	subtasks := make([]SwarmSubtask, 0, len(planned))
+	for _, p := range planned {
+		title := strings.TrimSpace(p.Title)
+		description := strings.TrimSpace(p.Description)
+		if description == "" {
+			description = title
+		}
+		if description == "" {
+			continue
+		}
+		if title == "" {
+			title = summarizeSubtask(description)
+		}
+
+		subtasks = append(subtasks, SwarmSubtask{
+			Index:       len(subtasks) + 1,
+			Title:       title,
+			Description: description,
+		})
+		if len(subtasks) == maxSubtasks {
+			break
+		}
+	}
+	return subtasks
+}
+
+// summarizeSubtask makes a title from a subtask's first words
+func summarizeSubtask(description string) string {
+	const maxTitleWords = 8
+	words := strings.Fields(description)
+	if len(words) <= maxTitleWords {
+		return strings.Join(words, " ")
+	}
+	return strings.Join(words[:maxTitleWords], " ") + "..."
+}
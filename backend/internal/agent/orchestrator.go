@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -53,6 +54,8 @@ type SwarmConfig struct {
 	Timeout         time.Duration     `json:"timeout"`
 	AgentConfigs    []AgentRoleConfig `json:"agent_configs"`
 	SynthesizerConfig *AgentConfig    `json:"synthesizer_config,omitempty"` // For combining results
+	Budget          *SwarmBudget       `json:"budget,omitempty"`
+	EarlyStop       EarlyStopCondition `json:"-"`
 }
 
 // AgentRoleConfig configures an agent with a specific role
@@ -71,6 +74,7 @@ type Swarm struct {
 	Agents      []*SwarmAgent `json:"agents"`
 	Messages    []SwarmMessage `json:"messages"` // Inter-agent communication
 	Results     []SwarmResult `json:"results"`
+	Subtasks    []SwarmSubtask `json:"subtasks,omitempty"` // How a map-reduce swarm split its task
 	FinalOutput string        `json:"final_output,omitempty"`
 	CreatedAt   time.Time     `json:"created_at"`
 	StartedAt   *time.Time    `json:"started_at,omitempty"`
@@ -81,7 +85,13 @@ type Swarm struct {
 	ctx         context.Context
 	cancel      context.CancelFunc
 	llmManager  *llm.Manager
-	events      chan *SwarmEvent
+	events      *eventQueue[*SwarmEvent]
+
+	// Consumption shared by all of the swarm's agents
+	budget      *budgetTracker
+	pricing     PricingFunc
+	cost        float64
+	stopReason  string
 }
 
 // SwarmStatus represents the status of a swarm
@@ -155,11 +165,22 @@ const (
 	SwarmEventProgress        SwarmEventType = "progress"
 )
 
+// IsTerminal returns true for events that end a swarm or one of its agents.
+// These are delivered even when a slow reader causes other events to be dropped.
+func (t SwarmEventType) IsTerminal() bool {
+	switch t {
+	case SwarmEventAgentCompleted, SwarmEventAgentFailed, SwarmEventCompleted, SwarmEventFailed, SwarmEventCancelled:
+		return true
+	}
+	return false
+}
+
 // Orchestrator manages multi-agent swarms
 type Orchestrator struct {
 	llmManager *llm.Manager
 	swarms     map[string]*Swarm
 	swarmsMu   sync.RWMutex
+	pricing    PricingFunc
 
 	// Default role prompts
 	rolePrompts map[AgentRole]string
@@ -176,6 +197,12 @@ func NewOrchestrator(llmManager *llm.Manager) *Orchestrator {
 	return o
 }
 
+// SetPricing sets how swarms price their agents' tokens for cost budgets.
+// Without it, swarm costs are reported as zero.
+func (o *Orchestrator) SetPricing(pricing PricingFunc) {
+	o.pricing = pricing
+}
+
 // initDefaultRolePrompts sets up default system prompts for each role
 func (o *Orchestrator) initDefaultRolePrompts() {
 	o.rolePrompts[RoleGeneral] = "You are a helpful AI assistant."
@@ -256,6 +283,12 @@ func (o *Orchestrator) CreateSwarm(config SwarmConfig) *Swarm {
 		config.Timeout = 10 * time.Minute
 	}
 
+	// The tracker counts tokens even without a token budget, for progress
+	budget := Budget{}
+	if config.Budget != nil {
+		budget.MaxTokens = config.Budget.MaxTokens
+	}
+
 	swarm := &Swarm{
 		ID:         config.ID,
 		Config:     config,
@@ -265,7 +298,9 @@ func (o *Orchestrator) CreateSwarm(config SwarmConfig) *Swarm {
 		Results:    make([]SwarmResult, 0),
 		CreatedAt:  time.Now(),
 		llmManager: o.llmManager,
-		events:     make(chan *SwarmEvent, 100),
+		events:     newEventQueue[*SwarmEvent](eventBufferSize),
+		budget:     newBudgetTracker(&budget),
+		pricing:    o.pricing,
 	}
 
 	o.swarmsMu.Lock()
@@ -302,7 +337,7 @@ func (o *Orchestrator) RunSwarm(ctx context.Context, swarmID string, task string
 
 	// Run based on strategy
 	go func() {
-		defer close(swarm.events)
+		defer swarm.events.close()
 
 		var err error
 		switch swarm.Config.Strategy {
@@ -323,13 +358,21 @@ func (o *Orchestrator) RunSwarm(ctx context.Context, swarmID string, task string
 		swarm.mu.Lock()
 		now := time.Now()
 		swarm.CompletedAt = &now
+		if swarm.stopReason != "" {
+			// Stopping early cancels whatever was still running, so the
+			// swarm ends with the best output it has
+			err = swarm.finishEarly()
+		}
 		if err != nil {
 			swarm.Status = SwarmStatusFailed
 			swarm.Error = err.Error()
 			swarm.emitEvent(SwarmEventFailed, "", "", map[string]interface{}{"error": err.Error()})
 		} else {
 			swarm.Status = SwarmStatusCompleted
-			swarm.emitEvent(SwarmEventCompleted, "", "", map[string]interface{}{"output": swarm.FinalOutput})
+			swarm.emitEvent(SwarmEventCompleted, "", "", map[string]interface{}{
+				"output":      swarm.FinalOutput,
+				"stop_reason": swarm.stopReason,
+			})
 		}
 		swarm.mu.Unlock()
 	}()
@@ -363,9 +406,7 @@ func (o *Orchestrator) runParallelStrategy(swarm *Swarm, task string) error {
 
 	// Collect results
 	for result := range resultsChan {
-		swarm.mu.Lock()
-		swarm.Results = append(swarm.Results, result)
-		swarm.mu.Unlock()
+		swarm.addResult(result)
 	}
 
 	// Synthesize results
@@ -388,9 +429,7 @@ func (o *Orchestrator) runPipelineStrategy(swarm *Swarm, task string) error {
 		sa.Input = currentInput
 		result := o.runAgent(swarm, sa, currentInput)
 
-		swarm.mu.Lock()
-		swarm.Results = append(swarm.Results, result)
-		swarm.mu.Unlock()
+		swarm.addResult(result)
 
 		if !result.Success {
 			return fmt.Errorf("agent %s failed: %s", sa.ID, result.Error)
@@ -435,13 +474,16 @@ func (o *Orchestrator) runDebateStrategy(swarm *Swarm, task string) error {
 		go func(agent *SwarmAgent) {
 			defer wg.Done()
 			result := o.runAgent(swarm, agent, task)
-			swarm.mu.Lock()
-			swarm.Results = append(swarm.Results, result)
-			swarm.mu.Unlock()
+			swarm.addResult(result)
 		}(sa)
 	}
 	wg.Wait()
 
+	// The swarm may have stopped early, e.g. on consensus
+	if err := swarm.ctx.Err(); err != nil {
+		return err
+	}
+
 	// Round 2: Each agent critiques others and refines
 	critiques := make([]string, 0)
 	for i, sa := range agents {
@@ -465,6 +507,7 @@ Please:
 3. Provide an improved final response that incorporates the best ideas`,
 			task, swarm.Results[i].Output, otherOutputs)
 
+		swarm.renewAgent(sa)
 		result := o.runAgent(swarm, sa, critiquePrompt)
 		critiques = append(critiques, result.Output)
 	}
@@ -475,53 +518,104 @@ Please:
 
 // runMapReduceStrategy splits task, runs in parallel, then combines
 func (o *Orchestrator) runMapReduceStrategy(swarm *Swarm, task string) error {
+	agents := o.createAgentsFromConfig(swarm)
+
 	// First, use a planner agent to split the task
 	plannerConfig := AgentConfig{
 		Provider:     swarm.Config.AgentConfigs[0].Config.Provider,
 		Model:        swarm.Config.AgentConfigs[0].Config.Model,
 		SystemPrompt: o.rolePrompts[RolePlanner],
+		Sampling:     swarm.Config.AgentConfigs[0].Config.Sampling,
+		Credentials:  swarm.Config.AgentConfigs[0].Config.Credentials,
+		JSONMode:     true,
 	}
 
-	plannerAgent := NewAgent(plannerConfig, swarm.llmManager)
-	planTask := NewTask(fmt.Sprintf(`Break down this task into %d independent subtasks that can be worked on in parallel:
+	plannerAgent := swarm.newAgent(plannerConfig)
+	planTask := NewTask(fmt.Sprintf(`Break down this task into independent subtasks that can be worked on in parallel. %d agents are available; any further subtasks wait for an agent to finish, so aim for about %d.
 
 Task: %s
 
-Output a numbered list of subtasks, one per line.`, len(swarm.Config.AgentConfigs), task))
+Respond with only a JSON object of this form:
+{"subtasks": [{"title": "a few words naming the subtask", "description": "what to do, with enough context to work on it alone"}]}`, len(agents), len(agents), task))
 
 	if err := plannerAgent.Start(swarm.ctx, planTask); err != nil {
 		return err
 	}
 
 	// Wait for planner result
-	var subtasks string
+	var subtasks []SwarmSubtask
 	select {
 	case result := <-plannerAgent.Results():
+		swarm.account(plannerAgent, result)
 		if !result.Success {
 			return fmt.Errorf("planning failed: %s", result.Error)
 		}
-		subtasks = result.Output
+		subtasks = parseSubtasks(result.Output)
 	case <-swarm.ctx.Done():
 		return swarm.ctx.Err()
 	}
 
-	// Create agents and assign subtasks
-	agents := o.createAgentsFromConfig(swarm)
+	// A plan that can't be read leaves the task whole
+	if len(subtasks) == 0 {
+		subtasks = []SwarmSubtask{{Index: 1, Title: summarizeSubtask(task), Description: task}}
+	}
+
+	// Agents without a subtask are left out of the swarm
+	if len(agents) > len(subtasks) {
+		unused := len(agents) - len(subtasks)
+		agents = agents[:len(subtasks)]
+		swarm.mu.Lock()
+		swarm.Agents = swarm.Agents[:len(swarm.Agents)-unused]
+		swarm.mu.Unlock()
+	}
+
+	swarm.mu.Lock()
+	swarm.Subtasks = subtasks
+	swarm.mu.Unlock()
+
+	// Each agent takes the next subtask from the queue until none are left
+	queue := make(chan int, len(subtasks))
+	for i := range subtasks {
+		queue <- i
+	}
+	close(queue)
 
-	// Simple subtask distribution (in practice, would parse the planner output)
 	var wg sync.WaitGroup
-	for i, sa := range agents {
+	for _, sa := range agents {
 		wg.Add(1)
-		agentTask := fmt.Sprintf("As part of a larger task, work on this subtask:\n\nOverall task: %s\n\nSubtasks identified:\n%s\n\nYou are agent %d. Focus on your portion of the work.",
-			task, subtasks, i+1)
-
-		go func(agent *SwarmAgent, t string) {
+		go func(agent *SwarmAgent) {
 			defer wg.Done()
-			result := o.runAgent(swarm, agent, t)
-			swarm.mu.Lock()
-			swarm.Results = append(swarm.Results, result)
-			swarm.mu.Unlock()
-		}(sa, agentTask)
+			first := true
+			for i := range queue {
+				if swarm.ctx.Err() != nil {
+					return
+				}
+				if !first {
+					swarm.renewAgent(agent)
+				}
+				first = false
+
+				swarm.mu.Lock()
+				subtask := &swarm.Subtasks[i]
+				subtask.AgentID = agent.ID
+				agentTask := fmt.Sprintf("As part of a larger task, work on this subtask:\n\nOverall task: %s\n\nYour subtask (%d of %d): %s\n%s\n\nOther agents handle the other subtasks. Focus on your portion of the work.",
+					task, subtask.Index, len(swarm.Subtasks), subtask.Title, subtask.Description)
+				swarm.mu.Unlock()
+
+				result := o.runAgent(swarm, agent, agentTask)
+				result.Metadata = map[string]interface{}{
+					"subtask":       subtasks[i].Index,
+					"subtask_title": subtasks[i].Title,
+				}
+
+				swarm.mu.Lock()
+				subtask.Success = result.Success
+				subtask.Error = result.Error
+				swarm.mu.Unlock()
+
+				swarm.addResult(result)
+			}
+		}(sa)
 	}
 	wg.Wait()
 
@@ -536,9 +630,11 @@ func (o *Orchestrator) runSpecialistStrategy(swarm *Swarm, task string) error {
 		Provider:     swarm.Config.AgentConfigs[0].Config.Provider,
 		Model:        swarm.Config.AgentConfigs[0].Config.Model,
 		SystemPrompt: "You are a task analyzer. Given a task, identify which specialist roles would be most helpful.",
+		Sampling:     swarm.Config.AgentConfigs[0].Config.Sampling,
+		Credentials:  swarm.Config.AgentConfigs[0].Config.Credentials,
 	}
 
-	analyzerAgent := NewAgent(analyzerConfig, swarm.llmManager)
+	analyzerAgent := swarm.newAgent(analyzerConfig)
 
 	// Build list of available roles
 	availableRoles := make([]string, 0)
@@ -561,6 +657,7 @@ For each specialist that should be involved, explain what aspect of the task the
 	// Wait for analysis
 	select {
 	case result := <-analyzerAgent.Results():
+		swarm.account(analyzerAgent, result)
 		if !result.Success {
 			return fmt.Errorf("analysis failed: %s", result.Error)
 		}
@@ -583,9 +680,7 @@ Apply your expertise to this task. Focus on the aspects most relevant to your sp
 		go func(agent *SwarmAgent, t string) {
 			defer wg.Done()
 			result := o.runAgent(swarm, agent, t)
-			swarm.mu.Lock()
-			swarm.Results = append(swarm.Results, result)
-			swarm.mu.Unlock()
+			swarm.addResult(result)
 		}(sa, specialistTask)
 	}
 	wg.Wait()
@@ -616,7 +711,7 @@ func (o *Orchestrator) createAgentsFromConfig(swarm *Swarm) []*SwarmAgent {
 				}
 			}
 
-			agent := NewAgent(config, swarm.llmManager)
+			agent := swarm.newAgent(config)
 
 			sa := &SwarmAgent{
 				ID:     agent.ID,
@@ -633,6 +728,14 @@ func (o *Orchestrator) createAgentsFromConfig(swarm *Swarm) []*SwarmAgent {
 	return agents
 }
 
+// renewAgent gives a swarm agent a fresh agent with the same config for
+// another run, since an agent runs only once
+func (s *Swarm) renewAgent(sa *SwarmAgent) {
+	config := sa.Agent.Config
+	config.ID = uuid.New().String()
+	sa.Agent = s.newAgent(config)
+}
+
 // runAgent runs a single agent and returns the result
 func (o *Orchestrator) runAgent(swarm *Swarm, sa *SwarmAgent, input string) SwarmResult {
 	startTime := time.Now()
@@ -676,6 +779,8 @@ func (o *Orchestrator) runAgent(swarm *Swarm, sa *SwarmAgent, input string) Swar
 	// Wait for result
 	select {
 	case result := <-sa.Agent.Results():
+		defer swarm.account(sa.Agent, result)
+
 		now := time.Now()
 		sa.CompletedAt = &now
 		sa.Output = result.Output
@@ -716,6 +821,10 @@ func (o *Orchestrator) runAgent(swarm *Swarm, sa *SwarmAgent, input string) Swar
 
 // synthesizeResults combines all agent results into a final output
 func (o *Orchestrator) synthesizeResults(swarm *Swarm) error {
+	if err := swarm.ctx.Err(); err != nil {
+		return err
+	}
+
 	swarm.emitEvent(SwarmEventSynthesizing, "", "", nil)
 
 	// If only one result, use it directly
@@ -736,10 +845,37 @@ func (o *Orchestrator) synthesizeResults(swarm *Swarm) error {
 	synthConfig.SystemPrompt = o.rolePrompts[RoleSynthesizer]
 	synthConfig.ID = uuid.New().String()
 
-	// Build synthesis prompt
+	// Build synthesis prompt. Map-reduce results are labelled with their
+	// subtask, in the planner's order, so the synthesis can attribute them.
+	swarm.mu.RLock()
+	results := make([]SwarmResult, len(swarm.Results))
+	copy(results, swarm.Results)
+	bySubtask := len(swarm.Subtasks) > 0
+	swarm.mu.RUnlock()
+
+	if bySubtask {
+		sort.SliceStable(results, func(i, j int) bool {
+			return subtaskIndex(results[i]) < subtaskIndex(results[j])
+		})
+	}
+
 	resultsText := ""
-	for i, result := range swarm.Results {
-		resultsText += fmt.Sprintf("\n--- Agent %d (%s) ---\n%s\n", i+1, result.Role, result.Output)
+	for i, result := range results {
+		label := fmt.Sprintf("Agent %d (%s)", i+1, result.Role)
+		if bySubtask {
+			title, _ := result.Metadata["subtask_title"].(string)
+			label = fmt.Sprintf("Subtask %d: %s (%s agent)", subtaskIndex(result), title, result.Role)
+		}
+		output := result.Output
+		if !result.Success {
+			output = fmt.Sprintf("(failed: %s)\n%s", result.Error, result.Output)
+		}
+		resultsText += fmt.Sprintf("\n--- %s ---\n%s\n", label, output)
+	}
+
+	attribution := ""
+	if bySubtask {
+		attribution = "\n5. Attribute each part of the response to the subtask it comes from, citing the subtask's number and title, and point out subtasks that failed"
 	}
 
 	synthPrompt := fmt.Sprintf(`You have received outputs from multiple specialized agents working on a task.
@@ -750,11 +886,11 @@ Your task is to:
 1. Identify the key insights and contributions from each agent
 2. Resolve any conflicts or contradictions
 3. Synthesize a comprehensive, coherent final response
-4. Ensure nothing important is lost in the synthesis
+4. Ensure nothing important is lost in the synthesis%s
 
-Provide the synthesized final response:`, resultsText)
+Provide the synthesized final response:`, resultsText, attribution)
 
-	synthesizer := NewAgent(synthConfig, swarm.llmManager)
+	synthesizer := swarm.newAgent(synthConfig)
 	synthTask := NewTask(synthPrompt)
 
 	if err := synthesizer.Start(swarm.ctx, synthTask); err != nil {
@@ -763,6 +899,7 @@ Provide the synthesized final response:`, resultsText)
 
 	select {
 	case result := <-synthesizer.Results():
+		swarm.account(synthesizer, result)
 		if !result.Success {
 			return fmt.Errorf("synthesis failed: %s", result.Error)
 		}
@@ -776,25 +913,35 @@ Provide the synthesized final response:`, resultsText)
 	}
 }
 
+// subtaskIndex returns the map-reduce subtask a result is for, or 0
+func subtaskIndex(result SwarmResult) int {
+	index, _ := result.Metadata["subtask"].(int)
+	return index
+}
+
 // emitEvent sends an event from the swarm
 func (s *Swarm) emitEvent(eventType SwarmEventType, agentID string, role AgentRole, data map[string]interface{}) {
-	select {
-	case s.events <- &SwarmEvent{
+	s.events.push(&SwarmEvent{
 		SwarmID:   s.ID,
 		Type:      eventType,
 		AgentID:   agentID,
 		Role:      role,
 		Data:      data,
 		Timestamp: time.Now(),
-	}:
-	default:
-		// Channel full, skip
-	}
+	}, eventType.IsTerminal())
 }
 
-// Events returns the swarm's event channel
+// Events returns the swarm's event channel. Events are buffered for a slow
+// reader; if it falls too far behind, output events are dropped (see
+// DroppedEvents) but completion and failure events are always delivered.
 func (s *Swarm) Events() <-chan *SwarmEvent {
-	return s.events
+	return s.events.channel()
+}
+
+// DroppedEvents returns how many events were dropped because the events
+// channel's reader fell behind
+func (s *Swarm) DroppedEvents() int64 {
+	return s.events.droppedCount()
 }
 
 // Stop cancels the swarm execution
@@ -832,6 +979,83 @@ func (o *Orchestrator) ListSwarms() []*Swarm {
 	return swarms
 }
 
+// finishedAt returns when the swarm finished, or false if it is still running.
+// Swarms that were created but never run count as finished when created.
+func (s *Swarm) finishedAt() (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.CompletedAt != nil {
+		return *s.CompletedAt, true
+	}
+	if s.StartedAt == nil {
+		return s.CreatedAt, true
+	}
+	return time.Time{}, false
+}
+
+// Wait blocks until the swarm has finished
+func (s *Swarm) Wait() {
+	for {
+		if _, finished := s.finishedAt(); finished {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// evictSwarms removes finished swarms that completed before the cutoff, then
+// the oldest ones beyond the limit. A zero cutoff or limit is ignored.
+func (o *Orchestrator) evictSwarms(cutoff time.Time, limit int) int {
+	o.swarmsMu.Lock()
+	defer o.swarmsMu.Unlock()
+
+	type finishedSwarm struct {
+		id          string
+		completedAt time.Time
+	}
+	var finished []finishedSwarm
+	evicted := 0
+	for id, swarm := range o.swarms {
+		completedAt, ok := swarm.finishedAt()
+		if !ok {
+			continue
+		}
+		if !cutoff.IsZero() && completedAt.Before(cutoff) {
+			delete(o.swarms, id)
+			evicted++
+			continue
+		}
+		finished = append(finished, finishedSwarm{id, completedAt})
+	}
+
+	if limit > 0 && len(finished) > limit {
+		sort.Slice(finished, func(i, j int) bool {
+			return finished[i].completedAt.Before(finished[j].completedAt)
+		})
+		for _, f := range finished[:len(finished)-limit] {
+			delete(o.swarms, f.id)
+			evicted++
+		}
+	}
+
+	return evicted
+}
+
+// swarmCounts returns how many swarms are running and how many are kept in
+// memory in total
+func (o *Orchestrator) swarmCounts() (active, retained int) {
+	o.swarmsMu.RLock()
+	defer o.swarmsMu.RUnlock()
+
+	for _, swarm := range o.swarms {
+		if _, finished := swarm.finishedAt(); !finished {
+			active++
+		}
+	}
+	return active, len(o.swarms)
+}
+
 // CancelSwarm cancels a running swarm
 func (o *Orchestrator) CancelSwarm(id string) error {
 	swarm, err := o.GetSwarm(id)
@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"log"
 	"sync"
 	"time"
 
@@ -11,21 +12,69 @@ import (
 
 // PoolConfig holds configuration for the agent pool
 type PoolConfig struct {
+	MinConcurrentAgents int           `json:"min_concurrent_agents"`
 	MaxConcurrentAgents int           `json:"max_concurrent_agents"`
 	DefaultTimeout      time.Duration `json:"default_timeout"`
 	QueueCapacity       int           `json:"queue_capacity"`
+	ScaleDownDelay      time.Duration `json:"scale_down_delay"`   // How long demand must stay below the worker count before a worker is removed
+	StarvationTimeout   time.Duration `json:"starvation_timeout"` // How long a queued task waits before its priority is raised a level
 }
 
 // DefaultPoolConfig returns the default pool configuration
 func DefaultPoolConfig() PoolConfig {
 	return PoolConfig{
+		MinConcurrentAgents: 2,
 		MaxConcurrentAgents: 10,
 		DefaultTimeout:      5 * time.Minute,
 		QueueCapacity:       100,
+		ScaleDownDelay:      30 * time.Second,
+		StarvationTimeout:   time.Minute,
 	}
 }
 
-// Pool manages a pool of agents for parallel task execution
+// schedulerInterval is how often the scheduler scales down idle workers and
+// refreshes queue positions as waiting tasks age
+const schedulerInterval = time.Second
+
+// sharedQueueTimeout bounds each call to a shared queue
+const sharedQueueTimeout = 5 * time.Second
+
+// SharedQueue coordinates the pools of several server replicas, so tasks
+// queued anywhere in the cluster start in priority order and no more than the
+// cluster's agent limit run at once. Tasks still run on the replica they were
+// submitted to.
+type SharedQueue interface {
+	// Admit offers tasks this pool has free workers for and returns the IDs
+	// of those that may start now. Offers that aren't admitted keep their
+	// place until they're offered again or withdrawn.
+	Admit(ctx context.Context, offers []QueuedTask) ([]string, error)
+	// Withdraw removes offered tasks that are no longer waiting to start
+	Withdraw(ctx context.Context, taskIDs []string) error
+	// Refresh extends the leases of admitted tasks that are still running.
+	// A task whose lease runs out (e.g. its replica died) frees its slot.
+	Refresh(ctx context.Context, taskIDs []string) error
+	// Release frees an admitted task's slot
+	Release(ctx context.Context, taskID string) error
+}
+
+// QueuedTask describes a task offered to a shared queue
+type QueuedTask struct {
+	ID       string
+	Priority TaskPriority
+	QueuedAt time.Time
+}
+
+// queuedAgent is an agent waiting in the queue for a worker
+type queuedAgent struct {
+	agent    *Agent
+	task     *Task
+	position int // last position reported to the agent's listeners
+}
+
+// Pool manages a pool of agents for parallel task execution. Queued tasks are
+// run by workers in priority order; the number of workers grows with the
+// queue up to MaxConcurrentAgents and shrinks back to MinConcurrentAgents
+// once demand has dropped for ScaleDownDelay.
 type Pool struct {
 	config     PoolConfig
 	llmManager *llm.Manager
@@ -34,13 +83,24 @@ type Pool struct {
 	agents    map[string]*Agent
 	agentsMu  sync.RWMutex
 
-	// Task queue
-	taskQueue *TaskQueue
-	queueMu   sync.Mutex
+	// Task queue and workers, guarded by queueMu
+	taskQueue    *TaskQueue
+	queued       map[string]*queuedAgent // by task ID
+	waiting      map[*Agent]*Task        // batch agents not yet queued
+	workers      int
+	busy         int
+	lastDemandAt time.Time
+	queueMu      sync.Mutex
+
+	// Cluster-wide queue, if any: tasks offered to it and tasks admitted by
+	// it that are still running, guarded by queueMu
+	shared  SharedQueue
+	offered map[string]bool
+	leased  map[string]bool
 
 	// Concurrency control
-	semaphore chan struct{}
-	wg        sync.WaitGroup
+	wake chan struct{}
+	wg   sync.WaitGroup
 
 	// Lifecycle
 	ctx    context.Context
@@ -58,18 +118,42 @@ type Pool struct {
 func NewPool(llmManager *llm.Manager, config PoolConfig) *Pool {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	if config.MaxConcurrentAgents < 1 {
+		config.MaxConcurrentAgents = 1
+	}
+	if config.MinConcurrentAgents < 1 {
+		config.MinConcurrentAgents = 1
+	}
+	if config.MinConcurrentAgents > config.MaxConcurrentAgents {
+		config.MinConcurrentAgents = config.MaxConcurrentAgents
+	}
+
+	taskQueue := NewTaskQueue(config.QueueCapacity)
+	taskQueue.agingInterval = config.StarvationTimeout
+
 	return &Pool{
 		config:           config,
 		llmManager:       llmManager,
 		agents:           make(map[string]*Agent),
-		taskQueue:        NewTaskQueue(config.QueueCapacity),
-		semaphore:        make(chan struct{}, config.MaxConcurrentAgents),
+		taskQueue:        taskQueue,
+		queued:           make(map[string]*queuedAgent),
+		waiting:          make(map[*Agent]*Task),
+		offered:          make(map[string]bool),
+		leased:           make(map[string]bool),
+		workers:          config.MinConcurrentAgents,
+		wake:             make(chan struct{}, 1),
 		ctx:              ctx,
 		cancel:           cancel,
 		eventBroadcaster: NewEventBroadcaster(),
 	}
 }
 
+// SetSharedQueue makes queued tasks wait for a cluster-wide queue as well as
+// a free worker. It must be called before Start.
+func (p *Pool) SetSharedQueue(queue SharedQueue) {
+	p.shared = queue
+}
+
 // Start begins the pool's background processing
 func (p *Pool) Start() {
 	p.runMu.Lock()
@@ -80,10 +164,10 @@ func (p *Pool) Start() {
 	p.running = true
 	p.runMu.Unlock()
 
-	go p.processQueue()
+	go p.schedule()
 }
 
-// Stop gracefully shuts down the pool
+// Stop gracefully shuts down the pool. Tasks still in the queue are cancelled.
 func (p *Pool) Stop() {
 	p.runMu.Lock()
 	if !p.running {
@@ -94,39 +178,355 @@ func (p *Pool) Stop() {
 	p.runMu.Unlock()
 
 	p.cancel()
+
+	p.queueMu.Lock()
+	pending := make([]*queuedAgent, 0, len(p.queued)+len(p.waiting))
+	for _, entry := range p.queued {
+		pending = append(pending, entry)
+	}
+	for agent, task := range p.waiting {
+		pending = append(pending, &queuedAgent{agent: agent, task: task})
+	}
+	p.taskQueue.Clear()
+	p.queued = make(map[string]*queuedAgent)
+	p.waiting = make(map[*Agent]*Task)
+	withdrawn := p.takeOffers(nil)
+	p.queueMu.Unlock()
+
+	p.withdrawShared(withdrawn)
+
+	for _, entry := range pending {
+		entry.agent.finishUnstarted(entry.task, AgentStatusCancelledBeforeStart, "cancelled before start")
+	}
+
 	p.wg.Wait()
 	p.eventBroadcaster.Close()
 }
 
-// processQueue continuously processes tasks from the queue
-func (p *Pool) processQueue() {
+// schedule hands queued tasks to free workers until the pool is stopped
+func (p *Pool) schedule() {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-p.ctx.Done():
 			return
-		default:
-			p.queueMu.Lock()
-			task := p.taskQueue.Pop()
-			p.queueMu.Unlock()
-
-			if task == nil {
-				// No tasks, wait a bit before checking again
-				time.Sleep(100 * time.Millisecond)
-				continue
+		case <-p.wake:
+		case <-ticker.C:
+			p.scaleDown()
+			p.refreshShared()
+		}
+		p.dispatch()
+	}
+}
+
+// notify wakes the scheduler
+func (p *Pool) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch starts as many queued tasks as there are free workers (and, with
+// a shared queue, cluster slots) and tells the agents still waiting about
+// their new queue positions
+func (p *Pool) dispatch() {
+	var admitted map[string]bool
+	if p.shared != nil {
+		admitted = p.admitShared()
+	}
+
+	p.queueMu.Lock()
+	if p.ctx.Err() != nil {
+		p.queueMu.Unlock()
+		p.releaseShared(admitted)
+		return
+	}
+
+	p.scaleUp()
+	for p.busy < p.workers {
+		task := p.nextTask(admitted)
+		if task == nil {
+			break
+		}
+		entry := p.queued[task.ID]
+		delete(p.queued, task.ID)
+
+		p.busy++
+		p.wg.Add(1)
+		go p.runWorker(entry)
+	}
+
+	// Collect position changes while locked, emit them after
+	type positionUpdate struct {
+		entry    *queuedAgent
+		position int
+		priority TaskPriority
+	}
+	var updates []positionUpdate
+	ordered := p.taskQueue.Ordered()
+	now := time.Now()
+	for i, task := range ordered {
+		entry := p.queued[task.ID]
+		if entry.position != i+1 {
+			entry.position = i + 1
+			updates = append(updates, positionUpdate{entry, i + 1, p.taskQueue.EffectivePriority(task, now)})
+		}
+	}
+	p.queueMu.Unlock()
+
+	// Slots of tasks cancelled since they were admitted
+	p.releaseShared(admitted)
+
+	for _, u := range updates {
+		u.entry.agent.emitEvent(AgentEventQueued, map[string]interface{}{
+			"task_id":    u.entry.task.ID,
+			"position":   u.position,
+			"queue_size": len(ordered),
+			"priority":   int(u.priority),
+		})
+	}
+}
+
+// nextTask removes the next task to start from the queue, or returns nil if
+// none may start. With a shared queue only admitted tasks may start; they're
+// removed from admitted, which is left with those that can't. Must be called
+// with queueMu held.
+func (p *Pool) nextTask(admitted map[string]bool) *Task {
+	if p.shared == nil {
+		return p.taskQueue.Pop()
+	}
+	for _, task := range p.taskQueue.Ordered() {
+		if admitted[task.ID] {
+			delete(admitted, task.ID)
+			delete(p.offered, task.ID)
+			p.taskQueue.Remove(task.ID)
+			p.leased[task.ID] = true
+			return task
+		}
+	}
+	return nil
+}
+
+// admitShared offers the queued tasks this pool has free workers for to the
+// shared queue, withdrawing earlier offers that no longer qualify, and
+// returns the IDs of the tasks admitted. If the shared queue can't be
+// reached, the offered tasks are admitted so agents keep running within this
+// pool's own limit.
+func (p *Pool) admitShared() map[string]bool {
+	p.queueMu.Lock()
+	p.scaleUp()
+	var offers []QueuedTask
+	if free := p.workers - p.busy; free > 0 {
+		for _, task := range p.taskQueue.Ordered() {
+			if len(offers) == free {
+				break
 			}
+			offers = append(offers, QueuedTask{ID: task.ID, Priority: task.Priority, QueuedAt: task.queuedAt})
+		}
+	}
+	withdrawn := p.takeOffers(offers)
+	p.queueMu.Unlock()
+
+	p.withdrawShared(withdrawn)
+	if len(offers) == 0 {
+		return nil
+	}
 
-			// Execute the task
-			p.executeTask(task)
+	ctx, cancel := context.WithTimeout(context.Background(), sharedQueueTimeout)
+	defer cancel()
+	ids, err := p.shared.Admit(ctx, offers)
+	if err != nil {
+		log.Printf("Failed to reach the shared agent queue, starting tasks locally: %v", err)
+		ids = make([]string, len(offers))
+		for i, offer := range offers {
+			ids[i] = offer.ID
 		}
 	}
+
+	admitted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		admitted[id] = true
+	}
+	return admitted
 }
 
-// Submit submits a task to the pool for execution
-func (p *Pool) Submit(task *Task, agentConfig AgentConfig) (string, error) {
+// takeOffers records the tasks now offered to the shared queue and returns
+// the IDs of earlier offers that are no longer. Must be called with queueMu
+// held.
+func (p *Pool) takeOffers(offers []QueuedTask) []string {
+	offered := make(map[string]bool, len(offers))
+	for _, offer := range offers {
+		offered[offer.ID] = true
+	}
+	var withdrawn []string
+	for id := range p.offered {
+		if !offered[id] {
+			withdrawn = append(withdrawn, id)
+		}
+	}
+	p.offered = offered
+	return withdrawn
+}
+
+// withdrawShared withdraws offers from the shared queue
+func (p *Pool) withdrawShared(taskIDs []string) {
+	if p.shared == nil || len(taskIDs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedQueueTimeout)
+	defer cancel()
+	if err := p.shared.Withdraw(ctx, taskIDs); err != nil {
+		log.Printf("Failed to withdraw tasks from the shared agent queue: %v", err)
+	}
+}
+
+// releaseShared frees the shared queue slots of admitted tasks
+func (p *Pool) releaseShared(taskIDs map[string]bool) {
+	if p.shared == nil {
+		return
+	}
+	for id := range taskIDs {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedQueueTimeout)
+		if err := p.shared.Release(ctx, id); err != nil {
+			log.Printf("Failed to release shared agent queue slot: %v", err)
+		}
+		cancel()
+	}
+}
+
+// refreshShared extends the shared queue leases of running tasks
+func (p *Pool) refreshShared() {
+	if p.shared == nil {
+		return
+	}
+	p.queueMu.Lock()
+	taskIDs := make([]string, 0, len(p.leased))
+	for id := range p.leased {
+		taskIDs = append(taskIDs, id)
+	}
+	p.queueMu.Unlock()
+	if len(taskIDs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sharedQueueTimeout)
+	defer cancel()
+	if err := p.shared.Refresh(ctx, taskIDs); err != nil {
+		log.Printf("Failed to refresh shared agent queue leases: %v", err)
+	}
+}
+
+// scaleUp adds workers for queued tasks, up to the maximum. Must be called
+// with queueMu held.
+func (p *Pool) scaleUp() {
+	demand := p.busy + p.taskQueue.Len()
+	if demand >= p.workers {
+		p.lastDemandAt = time.Now()
+	}
+	if demand > p.workers {
+		p.workers = demand
+		if p.workers > p.config.MaxConcurrentAgents {
+			p.workers = p.config.MaxConcurrentAgents
+		}
+	}
+}
+
+// scaleDown removes a worker once demand has stayed below the worker count
+// for the scale-down delay. Workers are removed one at a time, each after a
+// further delay, so short lulls don't shrink the pool.
+func (p *Pool) scaleDown() {
+	p.queueMu.Lock()
+	defer p.queueMu.Unlock()
+
+	demand := p.busy + p.taskQueue.Len()
+	if demand >= p.workers || p.workers <= p.config.MinConcurrentAgents {
+		return
+	}
+	if time.Since(p.lastDemandAt) < p.config.ScaleDownDelay {
+		return
+	}
+	p.workers--
+	p.lastDemandAt = time.Now()
+}
+
+// runWorker runs a task taken from the queue and frees its worker afterwards
+func (p *Pool) runWorker(entry *queuedAgent) {
+	defer p.wg.Done()
+	defer func() {
+		p.queueMu.Lock()
+		p.busy--
+		leased := p.leased[entry.task.ID]
+		delete(p.leased, entry.task.ID)
+		p.queueMu.Unlock()
+		if leased {
+			p.releaseShared(map[string]bool{entry.task.ID: true})
+		}
+		p.notify()
+	}()
+
+	p.runAgent(entry.agent, entry.task)
+}
+
+// register tracks an agent and forwards its events to pool subscribers
+func (p *Pool) register(agent *Agent) {
+	agent.onEvent = p.eventBroadcaster.Broadcast
+
+	p.agentsMu.Lock()
+	p.agents[agent.ID] = agent
+	p.agentsMu.Unlock()
+}
+
+// enqueue queues a task for an already registered agent. It fails with
+// ErrAgentCancelled if the agent was stopped while waiting to be queued.
+func (p *Pool) enqueue(agent *Agent, task *Task) error {
+	p.queueMu.Lock()
+	delete(p.waiting, agent)
+	select {
+	case <-agent.Done():
+		p.queueMu.Unlock()
+		return ErrAgentCancelled
+	default:
+	}
+	if !p.taskQueue.Push(task) {
+		p.queueMu.Unlock()
+		return ErrQueueFull
+	}
+	agent.setQueued()
+	p.queued[task.ID] = &queuedAgent{agent: agent, task: task}
+	p.queueMu.Unlock()
+
+	p.notify()
+	return nil
+}
+
+// runQueued queues a task for an agent and waits until the agent has
+// finished, failing the agent if the queue is full
+func (p *Pool) runQueued(agent *Agent, task *Task) {
+	if err := p.enqueue(agent, task); err != nil {
+		// A cancelled agent has already finished
+		if err != ErrAgentCancelled {
+			agent.finishUnstarted(task, AgentStatusFailed, err.Error())
+		}
+		return
+	}
+
+	select {
+	case <-agent.Done():
+	case <-p.ctx.Done():
+	}
+}
+
+// Enqueue creates an agent for a task and queues it. The agent starts once a
+// worker is free and no higher priority task is waiting; until then it emits
+// queued events with its position.
+func (p *Pool) Enqueue(task *Task, agentConfig AgentConfig) (*Agent, error) {
 	p.runMu.RLock()
 	if !p.running {
 		p.runMu.RUnlock()
-		return "", ErrPoolNotRunning
+		return nil, ErrPoolNotRunning
 	}
 	p.runMu.RUnlock()
 
@@ -135,17 +535,29 @@ func (p *Pool) Submit(task *Task, agentConfig AgentConfig) (string, error) {
 		task.AgentConfig = &agentConfig
 	}
 
-	p.queueMu.Lock()
-	if !p.taskQueue.Push(task) {
-		p.queueMu.Unlock()
-		return "", ErrQueueFull
+	agent := NewAgent(agentConfig, p.llmManager)
+	p.register(agent)
+
+	if err := p.enqueue(agent, task); err != nil {
+		p.agentsMu.Lock()
+		delete(p.agents, agent.ID)
+		p.agentsMu.Unlock()
+		return nil, err
 	}
-	p.queueMu.Unlock()
 
+	return agent, nil
+}
+
+// Submit submits a task to the pool for execution
+func (p *Pool) Submit(task *Task, agentConfig AgentConfig) (string, error) {
+	if _, err := p.Enqueue(task, agentConfig); err != nil {
+		return "", err
+	}
 	return task.ID, nil
 }
 
-// SubmitImmediate creates an agent and executes a task immediately (bypassing queue)
+// SubmitImmediate creates an agent and executes a task immediately, bypassing
+// the queue and the worker limit
 func (p *Pool) SubmitImmediate(task *Task, agentConfig AgentConfig) (*Agent, error) {
 	p.runMu.RLock()
 	if !p.running {
@@ -156,11 +568,7 @@ func (p *Pool) SubmitImmediate(task *Task, agentConfig AgentConfig) (*Agent, err
 
 	// Create the agent
 	agent := NewAgent(agentConfig, p.llmManager)
-
-	// Register the agent
-	p.agentsMu.Lock()
-	p.agents[agent.ID] = agent
-	p.agentsMu.Unlock()
+	p.register(agent)
 
 	// Execute asynchronously
 	p.wg.Add(1)
@@ -172,7 +580,9 @@ func (p *Pool) SubmitImmediate(task *Task, agentConfig AgentConfig) (*Agent, err
 	return agent, nil
 }
 
-// SubmitBatch submits multiple tasks for parallel execution
+// SubmitBatch submits multiple tasks for parallel execution. The tasks go
+// through the pool's queue, so MaxParallel only limits how many of them are
+// queued or running at once.
 func (p *Pool) SubmitBatch(batch *BatchTask, defaultConfig AgentConfig) (*BatchExecution, error) {
 	p.runMu.RLock()
 	if !p.running {
@@ -190,6 +600,9 @@ func (p *Pool) SubmitBatch(batch *BatchTask, defaultConfig AgentConfig) (*BatchE
 		done:        make(chan struct{}),
 	}
 
+	// The batch's budget is shared by all of its agents
+	budget := newBudgetTracker(batch.Budget)
+
 	// Create agents for all tasks
 	for i, task := range batch.Tasks {
 		config := defaultConfig
@@ -199,12 +612,18 @@ func (p *Pool) SubmitBatch(batch *BatchTask, defaultConfig AgentConfig) (*BatchE
 		config.ID = uuid.New().String()
 
 		agent := NewAgent(config, p.llmManager)
+		agent.executionBudget = budget
 		execution.Agents[i] = agent
+		p.register(agent)
+	}
 
-		p.agentsMu.Lock()
-		p.agents[agent.ID] = agent
-		p.agentsMu.Unlock()
+	// Agents wait here until the batch queues them, so they can be
+	// cancelled before they start
+	p.queueMu.Lock()
+	for i, task := range batch.Tasks {
+		p.waiting[execution.Agents[i]] = task
 	}
+	p.queueMu.Unlock()
 
 	// Execute based on parallel flag
 	if batch.Parallel {
@@ -236,7 +655,7 @@ func (p *Pool) executeBatchParallel(execution *BatchExecution, maxParallel int)
 			defer func() { <-semaphore }()
 
 			// Run the agent
-			p.runAgent(agent, t)
+			p.runQueued(agent, t)
 
 			// Collect result
 			select {
@@ -268,7 +687,7 @@ func (p *Pool) executeBatchSequential(execution *BatchExecution) {
 		agent := execution.Agents[i]
 
 		// Run the agent
-		p.runAgent(agent, task)
+		p.runQueued(agent, task)
 
 		// Collect result
 		select {
@@ -290,41 +709,6 @@ func (p *Pool) executeBatchSequential(execution *BatchExecution) {
 	execution.Batch.CompletedAt = &now
 }
 
-// executeTask executes a single task from the queue
-func (p *Pool) executeTask(task *Task) {
-	// Acquire semaphore
-	select {
-	case p.semaphore <- struct{}{}:
-	case <-p.ctx.Done():
-		return
-	}
-
-	p.wg.Add(1)
-	go func() {
-		defer p.wg.Done()
-		defer func() { <-p.semaphore }()
-
-		// Create agent from task config
-		config := AgentConfig{
-			Provider: "openai", // Default provider
-			Model:    "gpt-4",  // Default model
-		}
-		if task.AgentConfig != nil {
-			config = *task.AgentConfig
-		}
-
-		agent := NewAgent(config, p.llmManager)
-
-		// Register the agent
-		p.agentsMu.Lock()
-		p.agents[agent.ID] = agent
-		p.agentsMu.Unlock()
-
-		// Run the agent
-		p.runAgent(agent, task)
-	}()
-}
-
 // runAgent runs an agent with a task
 func (p *Pool) runAgent(agent *Agent, task *Task) {
 	// Set up timeout
@@ -336,27 +720,25 @@ func (p *Pool) runAgent(agent *Agent, task *Task) {
 	ctx, cancel := context.WithTimeout(p.ctx, timeout)
 	defer cancel()
 
-	// Forward events to broadcaster
-	go func() {
-		for event := range agent.Events() {
-			p.eventBroadcaster.Broadcast(event)
-		}
-	}()
-
 	// Start the agent
 	if err := agent.Start(ctx, task); err != nil {
 		return
 	}
 
-	// Wait for completion or cancellation
+	// Wait for completion or cancellation. The result itself is left on the
+	// results channel for whoever submitted the task.
 	select {
-	case <-agent.Results():
+	case <-agent.Done():
 		// Agent completed
 	case <-ctx.Done():
 		agent.Stop()
 	}
 
-	// Cleanup agent after some time
+	p.releaseLater(agent)
+}
+
+// releaseLater stops tracking a finished agent after some time
+func (p *Pool) releaseLater(agent *Agent) {
 	go func() {
 		time.Sleep(5 * time.Minute)
 		p.agentsMu.Lock()
@@ -389,7 +771,8 @@ func (p *Pool) ListAgents() []*Agent {
 	return agents
 }
 
-// StopAgent stops a specific agent by ID
+// StopAgent stops a specific agent by ID. An agent that hasn't started yet
+// finishes with AgentStatusCancelledBeforeStart and frees its queue position.
 func (p *Pool) StopAgent(agentID string) error {
 	p.agentsMu.RLock()
 	agent, ok := p.agents[agentID]
@@ -399,10 +782,58 @@ func (p *Pool) StopAgent(agentID string) error {
 		return ErrAgentNotFound
 	}
 
-	agent.Stop()
+	p.stopAgent(agent)
 	return nil
 }
 
+// stopAgent cancels an agent, removing it from the queue if it hasn't
+// started. It reports whether the agent was cancelled before it started.
+func (p *Pool) stopAgent(agent *Agent) bool {
+	p.queueMu.Lock()
+	task, waiting := p.waiting[agent]
+	delete(p.waiting, agent)
+	if !waiting {
+		for taskID, e := range p.queued {
+			if e.agent == agent {
+				task = e.task
+				p.taskQueue.Remove(taskID)
+				delete(p.queued, taskID)
+				break
+			}
+		}
+	}
+	if task == nil {
+		p.queueMu.Unlock()
+		agent.Stop()
+		return false
+	}
+
+	// Finished while still locked, so a batch about to queue the agent
+	// sees it's done
+	agent.finishUnstarted(task, AgentStatusCancelledBeforeStart, "cancelled before start")
+	p.queueMu.Unlock()
+	p.releaseLater(agent)
+
+	// Positions behind the cancelled task have moved up
+	p.notify()
+	return true
+}
+
+// QueuePosition returns a queued task's 1-based position, or 0 if the task
+// isn't waiting in the queue
+func (p *Pool) QueuePosition(taskID string) int {
+	p.queueMu.Lock()
+	defer p.queueMu.Unlock()
+	return p.taskQueue.Position(taskID)
+}
+
+// Workers returns the current number of workers and how many of them are busy
+func (p *Pool) Workers() (workers, busy int) {
+	p.queueMu.Lock()
+	defer p.queueMu.Unlock()
+	return p.workers, p.busy
+}
+
 // QueueSize returns the current size of the task queue
 func (p *Pool) QueueSize() int {
 	p.queueMu.Lock()
@@ -468,17 +899,22 @@ func (e *BatchExecution) GetResults() []*AgentResult {
 	return append([]*AgentResult{}, e.Results...)
 }
 
-// EventBroadcaster broadcasts events to multiple subscribers
+// EventBroadcaster broadcasts events to multiple subscribers. Each
+// subscriber has its own buffered queue, so a slow subscriber neither blocks
+// the agents nor delays the other subscribers.
 type EventBroadcaster struct {
-	subscribers map[chan *AgentEvent]struct{}
+	subscribers map[<-chan *AgentEvent]*eventQueue[*AgentEvent]
 	mu          sync.RWMutex
 	closed      bool
+
+	// Events dropped for subscribers that have since unsubscribed
+	dropped int64
 }
 
 // NewEventBroadcaster creates a new event broadcaster
 func NewEventBroadcaster() *EventBroadcaster {
 	return &EventBroadcaster{
-		subscribers: make(map[chan *AgentEvent]struct{}),
+		subscribers: make(map[<-chan *AgentEvent]*eventQueue[*AgentEvent]),
 	}
 }
 
@@ -493,27 +929,27 @@ func (b *EventBroadcaster) Subscribe() <-chan *AgentEvent {
 		return ch
 	}
 
-	ch := make(chan *AgentEvent, 100)
-	b.subscribers[ch] = struct{}{}
+	queue := newEventQueue[*AgentEvent](eventBufferSize)
+	ch := queue.channel()
+	b.subscribers[ch] = queue
 	return ch
 }
 
-// Unsubscribe removes a subscription
+// Unsubscribe removes a subscription and closes its channel
 func (b *EventBroadcaster) Unsubscribe(ch <-chan *AgentEvent) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	// Convert to send channel for map lookup
-	for sub := range b.subscribers {
-		if sub == ch {
-			close(sub)
-			delete(b.subscribers, sub)
-			return
-		}
+	queue, ok := b.subscribers[ch]
+	if !ok {
+		return
 	}
+	queue.cancel()
+	b.dropped += queue.droppedCount()
+	delete(b.subscribers, ch)
 }
 
-// Broadcast sends an event to all subscribers
+// Broadcast sends an event to all subscribers without blocking
 func (b *EventBroadcaster) Broadcast(event *AgentEvent) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
@@ -522,16 +958,24 @@ func (b *EventBroadcaster) Broadcast(event *AgentEvent) {
 		return
 	}
 
-	for ch := range b.subscribers {
-		select {
-		case ch <- event:
-		default:
-			// Subscriber channel full, skip
-		}
+	for _, queue := range b.subscribers {
+		queue.push(event, event.Type.IsTerminal())
 	}
 }
 
-// Close closes all subscriber channels
+// Dropped returns how many events subscribers have missed by falling behind
+func (b *EventBroadcaster) Dropped() int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	dropped := b.dropped
+	for _, queue := range b.subscribers {
+		dropped += queue.droppedCount()
+	}
+	return dropped
+}
+
+// Close closes all subscriber channels once their buffered events are delivered
 func (b *EventBroadcaster) Close() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -541,8 +985,8 @@ func (b *EventBroadcaster) Close() {
 	}
 
 	b.closed = true
-	for ch := range b.subscribers {
-		close(ch)
+	for _, queue := range b.subscribers {
+		queue.close()
 	}
-	b.subscribers = make(map[chan *AgentEvent]struct{})
+	b.subscribers = make(map[<-chan *AgentEvent]*eventQueue[*AgentEvent])
 }
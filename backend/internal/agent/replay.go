@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jacklau/prism/internal/llm"
+)
+
+// ReplayOptions changes how a replayed execution runs. Fields left empty keep
+// the original execution's values.
+type ReplayOptions struct {
+	Provider     string
+	Model        string
+	SystemPrompt string
+	Temperature  float64
+	MaxTokens    int
+	Sampling     llm.Sampling // Replaces the original's sampling controls when any is set
+}
+
+// apply overrides a config with the options that are set
+func (o ReplayOptions) apply(config AgentConfig) AgentConfig {
+	if o.Provider != "" {
+		config.Provider = o.Provider
+	}
+	if o.Model != "" {
+		config.Model = o.Model
+	}
+	if o.SystemPrompt != "" {
+		config.SystemPrompt = o.SystemPrompt
+	}
+	if o.Temperature != 0 {
+		config.Temperature = o.Temperature
+	}
+	if o.MaxTokens > 0 {
+		config.MaxTokens = o.MaxTokens
+	}
+	if !o.Sampling.IsZero() {
+		config.Sampling = o.Sampling
+	}
+	return config
+}
+
+// Replay re-runs a finished execution's tasks, with the same prompts, context
+// and history, against another model or config. Tool calls the new run makes
+// are answered from the tool results recorded in the tasks' history where the
+// same tool was called with the same parameters, so a replay never has side
+// effects. The replay is a new execution whose ReplayOf is the original's ID.
+func (m *Manager) Replay(ctx context.Context, id string, opts ReplayOptions, execOpts ...ExecutionOption) (*Execution, error) {
+	original, err := m.GetExecution(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, finished := original.finishedAt(); !finished {
+		return nil, ErrExecutionRunning
+	}
+
+	original.mu.RLock()
+	executionType := original.Type
+	budget := original.Budget
+	var config AgentConfig
+	if len(original.Agents) > 0 {
+		config = original.Agents[0].Config
+	}
+	tasks := make([]*Task, len(original.Tasks))
+	for i, task := range original.Tasks {
+		tasks[i] = replayTask(task, original.ID, opts)
+	}
+	original.mu.RUnlock()
+
+	if len(tasks) == 0 {
+		return nil, ErrTaskNotFound
+	}
+	config = opts.apply(config)
+	config.ID = ""
+
+	// Keep the original's execution budget unless the options set another
+	if budget != nil {
+		execOpts = append([]ExecutionOption{WithExecutionBudget(*budget)}, execOpts...)
+	}
+	execOpts = append(execOpts, func(o *executionOptions) {
+		o.replayOf = original.ID
+	})
+
+	switch executionType {
+	case ExecutionTypeSingle:
+		return m.RunTask(ctx, tasks[0], config, execOpts...)
+	case ExecutionTypeSequential:
+		return m.RunSequential(ctx, tasks, config, execOpts...)
+	default:
+		return m.RunParallel(ctx, tasks, config, execOpts...)
+	}
+}
+
+// replayTask copies a task for a replay, with a new ID and the options
+// applied to its own agent config
+func replayTask(task *Task, originalID string, opts ReplayOptions) *Task {
+	replay := NewTask(task.Prompt,
+		WithContext(task.Context),
+		WithPriority(task.Priority),
+		WithTimeout(task.Timeout),
+		WithHistory(task.History),
+	)
+	if task.AgentConfig != nil {
+		config := opts.apply(*task.AgentConfig)
+		config.ID = ""
+		replay.AgentConfig = &config
+	}
+	if task.Budget != nil {
+		budget := *task.Budget
+		replay.Budget = &budget
+	}
+	for key, value := range task.Metadata {
+		replay.Metadata[key] = value
+	}
+	replay.Metadata["replay_of"] = originalID
+	replay.Metadata["replay_of_task"] = task.ID
+	replay.recordedTools = recordToolResults(task.History)
+	return replay
+}
+
+// recordToolResults indexes the outputs of the tool calls in a conversation
+// by tool name and parameters
+func recordToolResults(history []llm.Message) map[string]string {
+	calls := make(map[string]string)
+	for _, msg := range history {
+		for _, tc := range msg.ToolCalls {
+			calls[tc.ID] = toolCallKey(tc.Name, tc.Parameters)
+		}
+	}
+
+	recorded := make(map[string]string)
+	for _, msg := range history {
+		if msg.Role != "tool" {
+			continue
+		}
+		if key, ok := calls[msg.ToolCallID]; ok {
+			recorded[key] = msg.Content
+		}
+	}
+	return recorded
+}
+
+// toolCallKey identifies a tool call by its name and parameters. Parameters
+// are marshalled with sorted keys, so the same call always has the same key.
+func toolCallKey(name string, params map[string]interface{}) string {
+	encoded, _ := json.Marshal(params)
+	return name + "\x00" + string(encoded)
+}
+
+// replayToolResult answers a tool call made during a replay from the
+// recorded results
+func replayToolResult(task *Task, tc llm.ToolCall) ToolResult {
+	result := ToolResult{
+		ToolCallID: tc.ID,
+		Name:       tc.Name,
+		Metadata:   map[string]interface{}{"replayed": true},
+	}
+	if output, ok := task.recordedTools[toolCallKey(tc.Name, tc.Parameters)]; ok {
+		result.Output = output
+	} else {
+		result.Error = "no recorded result for this call; tools don't run in a replay"
+	}
+	return result
+}
@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jacklau/prism/internal/llm"
+)
+
+// SwarmBudget limits what a swarm's agents may consume together, including
+// its planner and synthesizer. Zero fields are unlimited.
+type SwarmBudget struct {
+	MaxTokens int     `json:"max_tokens,omitempty"` // Prompt and completion tokens, enforced as responses stream
+	MaxCost   float64 `json:"max_cost,omitempty"`   // US dollars at the models' prices, checked as each agent finishes
+}
+
+// SwarmOptions are the limits and stop condition of a single swarm run
+type SwarmOptions struct {
+	Timeout   time.Duration      // Wall-clock limit, or the default if zero
+	Budget    *SwarmBudget       // Consumption shared by all agents, unlimited if nil
+	EarlyStop EarlyStopCondition // Optional
+}
+
+// Reasons a swarm stopped early, reported in SwarmUsage.StopReason
+const (
+	SwarmStopTokenBudget = "token_budget"
+	SwarmStopCostBudget  = "cost_budget"
+	SwarmStopConsensus   = "consensus"
+)
+
+// SwarmUsage is what a swarm's agents have consumed so far, against its limits
+type SwarmUsage struct {
+	Tokens     int           `json:"tokens"`
+	Cost       float64       `json:"cost"` // Tokens of models without known pricing cost nothing
+	Elapsed    time.Duration `json:"elapsed"`
+	MaxTokens  int           `json:"max_tokens,omitempty"`
+	MaxCost    float64       `json:"max_cost,omitempty"`
+	Timeout    time.Duration `json:"timeout"`
+	StopReason string        `json:"stop_reason,omitempty"`
+}
+
+// EarlyStopCondition is checked each time a swarm agent finishes, with the
+// results so far and the number of agents that haven't finished. Returning a
+// reason stops the swarm: running agents are cancelled, no more are started,
+// and the latest successful output becomes the final output.
+type EarlyStopCondition func(results []SwarmResult, pending int) string
+
+// PricingFunc returns a model's pricing, or nil if it isn't known
+type PricingFunc func(provider, model string) *llm.ModelPricing
+
+// ConsensusEarlyStop stops a swarm once all of its agents have finished and
+// their outputs agree at least as much as threshold (see ConsensusScore). A
+// debate then skips its critique round, and other strategies skip synthesis.
+func ConsensusEarlyStop(threshold float64) EarlyStopCondition {
+	return func(results []SwarmResult, pending int) string {
+		if pending > 0 {
+			return ""
+		}
+
+		var outputs []string
+		for _, result := range results {
+			if result.Success && result.Output != "" {
+				outputs = append(outputs, result.Output)
+			}
+		}
+		if len(outputs) < 2 || ConsensusScore(outputs) < threshold {
+			return ""
+		}
+		return SwarmStopConsensus
+	}
+}
+
+// ConsensusScore measures how much outputs agree, from 0 to 1, as the mean
+// overlap of the words used by each pair of outputs
+func ConsensusScore(outputs []string) float64 {
+	if len(outputs) < 2 {
+		return 1
+	}
+
+	words := make([]map[string]bool, len(outputs))
+	for i, output := range outputs {
+		words[i] = make(map[string]bool)
+		for _, word := range strings.Fields(strings.ToLower(output)) {
+			if word = strings.Trim(word, ".,;:!?\"'()[]{}*`"); word != "" {
+				words[i][word] = true
+			}
+		}
+	}
+
+	var total float64
+	pairs := 0
+	for i := 0; i < len(words); i++ {
+		for j := i + 1; j < len(words); j++ {
+			total += jaccard(words[i], words[j])
+			pairs++
+		}
+	}
+	return total / float64(pairs)
+}
+
+// jaccard returns the size of two sets' intersection over their union
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// newAgent creates an agent whose consumption counts against the swarm's
+// budget
+func (s *Swarm) newAgent(config AgentConfig) *Agent {
+	agent := NewAgent(config, s.llmManager)
+	agent.executionBudget = s.budget
+	return agent
+}
+
+// account records an agent's result against the swarm's budget, stops the
+// swarm if it is used up or its early stop condition is met, and reports
+// progress
+func (s *Swarm) account(agent *Agent, result *AgentResult) {
+	cost := 0.0
+	if s.pricing != nil {
+		if pricing := s.pricing(agent.Config.Provider, agent.Config.Model); pricing != nil {
+			if result.Usage != nil {
+				cost = (float64(result.Usage.PromptTokens)*pricing.InputPerMillion +
+					float64(result.Usage.CompletionTokens)*pricing.OutputPerMillion) / 1e6
+			} else {
+				// Without the provider's split, price the estimate as input
+				cost = float64(result.TokensUsed) * pricing.InputPerMillion / 1e6
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.cost += cost
+	costExceeded := s.Config.Budget != nil && s.Config.Budget.MaxCost > 0 && s.cost > s.Config.Budget.MaxCost
+	s.mu.Unlock()
+
+	switch {
+	case s.budget.exceeded() == BudgetLimitTokens:
+		s.stopEarly(SwarmStopTokenBudget)
+	case costExceeded:
+		s.stopEarly(SwarmStopCostBudget)
+	}
+
+	s.emitEvent(SwarmEventProgress, "", "", map[string]interface{}{
+		"usage": s.Usage(),
+	})
+}
+
+// addResult records an agent's result and checks the early stop condition
+func (s *Swarm) addResult(result SwarmResult) {
+	s.mu.Lock()
+	s.Results = append(s.Results, result)
+	var reason string
+	if s.Config.EarlyStop != nil {
+		pending := 0
+		for _, sa := range s.Agents {
+			if sa.Status == AgentStatusIdle || sa.Status == AgentStatusRunning {
+				pending++
+			}
+		}
+		results := make([]SwarmResult, len(s.Results))
+		copy(results, s.Results)
+		reason = s.Config.EarlyStop(results, pending)
+	}
+	s.mu.Unlock()
+
+	if reason != "" {
+		s.stopEarly(reason)
+	}
+}
+
+// stopEarly cancels the rest of the swarm's work, keeping the first reason
+func (s *Swarm) stopEarly(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopReason != "" || s.Status != SwarmStatusRunning {
+		return
+	}
+	s.stopReason = reason
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// finishEarly sets the final output of a swarm that stopped early to its
+// latest successful output, unless it already has one. The caller must hold
+// s.mu.
+func (s *Swarm) finishEarly() error {
+	if s.FinalOutput != "" {
+		return nil
+	}
+	for i := len(s.Results) - 1; i >= 0; i-- {
+		if s.Results[i].Success && s.Results[i].Output != "" {
+			s.FinalOutput = s.Results[i].Output
+			return nil
+		}
+	}
+	return fmt.Errorf("swarm stopped early (%s) before any agent succeeded", s.stopReason)
+}
+
+// Usage returns what the swarm's agents have consumed so far
+func (s *Swarm) Usage() SwarmUsage {
+	tokens := 0
+	if s.budget != nil {
+		s.budget.mu.Lock()
+		tokens = s.budget.tokens
+		s.budget.mu.Unlock()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	usage := SwarmUsage{
+		Tokens:     tokens,
+		Cost:       s.cost,
+		Timeout:    s.Config.Timeout,
+		StopReason: s.stopReason,
+	}
+	if s.Config.Budget != nil {
+		usage.MaxTokens = s.Config.Budget.MaxTokens
+		usage.MaxCost = s.Config.Budget.MaxCost
+	}
+	if s.StartedAt != nil {
+		end := time.Now()
+		if s.CompletedAt != nil {
+			end = *s.CompletedAt
+		}
+		usage.Elapsed = end.Sub(*s.StartedAt)
+	}
+	return usage
+}
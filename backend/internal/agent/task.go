@@ -1,9 +1,11 @@
 package agent
 
 import (
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/llm"
 )
 
 // TaskStatus represents the current status of a task
@@ -37,10 +39,19 @@ type Task struct {
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
 	CreatedAt   time.Time              `json:"created_at"`
 	Timeout     time.Duration          `json:"timeout,omitempty"` // Optional timeout for task execution
+	Budget      *Budget                `json:"budget,omitempty"`  // Optional resource limits for this task
+	History     []llm.Message          `json:"-"`                 // Optional prior conversation placed before the prompt
 
 	// Callback configuration
 	CallbackURL  string            `json:"callback_url,omitempty"`
 	CallbackData map[string]string `json:"callback_data,omitempty"`
+
+	// queuedAt is when the task entered the pool's queue
+	queuedAt time.Time
+
+	// recordedTools holds the tool outputs a replayed task answers its tool
+	// calls with, keyed by toolCallKey; nil unless the task is a replay
+	recordedTools map[string]string
 }
 
 // TaskOption is a functional option for configuring a task
@@ -105,6 +116,20 @@ func WithTimeout(timeout time.Duration) TaskOption {
 	}
 }
 
+// WithBudget sets resource limits for the task
+func WithBudget(budget Budget) TaskOption {
+	return func(t *Task) {
+		t.Budget = &budget
+	}
+}
+
+// WithHistory sets prior conversation messages for the agent to continue from
+func WithHistory(history []llm.Message) TaskOption {
+	return func(t *Task) {
+		t.History = history
+	}
+}
+
 // WithCallback sets the callback URL and data
 func WithCallback(url string, data map[string]string) TaskOption {
 	return func(t *Task) {
@@ -119,6 +144,7 @@ type BatchTask struct {
 	Tasks       []*Task                `json:"tasks"`
 	Parallel    bool                   `json:"parallel"` // If true, execute tasks in parallel
 	MaxParallel int                    `json:"max_parallel,omitempty"` // Max concurrent tasks (0 = unlimited)
+	Budget      *Budget                `json:"budget,omitempty"` // Optional resource limits shared by all tasks
 	Status      TaskStatus             `json:"status"`
 	Results     []*AgentResult         `json:"results,omitempty"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
@@ -140,10 +166,14 @@ func NewBatchTask(tasks []*Task, parallel bool, maxParallel int) *BatchTask {
 	}
 }
 
-// TaskQueue represents a priority queue for tasks
+// TaskQueue represents a priority queue for tasks. Tasks of equal priority
+// are taken in the order they were queued. When an aging interval is set, a
+// task's priority is raised one level for every interval it has waited, so
+// low priority tasks are not starved by a steady stream of higher ones.
 type TaskQueue struct {
-	tasks    []*Task
-	capacity int
+	tasks         []*Task
+	capacity      int
+	agingInterval time.Duration
 }
 
 // NewTaskQueue creates a new task queue with the given capacity
@@ -154,46 +184,94 @@ func NewTaskQueue(capacity int) *TaskQueue {
 	}
 }
 
-// Push adds a task to the queue based on priority
+// Push adds a task to the end of the queue
 func (q *TaskQueue) Push(task *Task) bool {
 	if len(q.tasks) >= q.capacity {
 		return false
 	}
 
-	// Find insertion point based on priority (higher priority first)
-	insertIdx := len(q.tasks)
-	for i, t := range q.tasks {
-		if task.Priority > t.Priority {
-			insertIdx = i
-			break
-		}
-	}
-
-	// Insert at the correct position
-	q.tasks = append(q.tasks, nil)
-	copy(q.tasks[insertIdx+1:], q.tasks[insertIdx:])
-	q.tasks[insertIdx] = task
-
+	task.queuedAt = time.Now()
+	q.tasks = append(q.tasks, task)
 	return true
 }
 
 // Pop removes and returns the highest priority task
 func (q *TaskQueue) Pop() *Task {
-	if len(q.tasks) == 0 {
+	idx := q.next(time.Now())
+	if idx < 0 {
 		return nil
 	}
 
-	task := q.tasks[0]
-	q.tasks = q.tasks[1:]
+	task := q.tasks[idx]
+	q.tasks = append(q.tasks[:idx], q.tasks[idx+1:]...)
 	return task
 }
 
 // Peek returns the highest priority task without removing it
 func (q *TaskQueue) Peek() *Task {
-	if len(q.tasks) == 0 {
+	idx := q.next(time.Now())
+	if idx < 0 {
 		return nil
 	}
-	return q.tasks[0]
+	return q.tasks[idx]
+}
+
+// Remove removes a task from the queue, returning false if it isn't queued
+func (q *TaskQueue) Remove(taskID string) bool {
+	for i, t := range q.tasks {
+		if t.ID == taskID {
+			q.tasks = append(q.tasks[:i], q.tasks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Ordered returns the queued tasks in the order they would currently be popped
+func (q *TaskQueue) Ordered() []*Task {
+	now := time.Now()
+	ordered := append([]*Task{}, q.tasks...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return q.EffectivePriority(ordered[i], now) > q.EffectivePriority(ordered[j], now)
+	})
+	return ordered
+}
+
+// Position returns a task's 1-based position in the queue, or 0 if it isn't queued
+func (q *TaskQueue) Position(taskID string) int {
+	for i, t := range q.Ordered() {
+		if t.ID == taskID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// EffectivePriority returns a queued task's priority after aging
+func (q *TaskQueue) EffectivePriority(task *Task, now time.Time) TaskPriority {
+	priority := task.Priority
+	if q.agingInterval > 0 && priority < TaskPriorityUrgent {
+		priority += TaskPriority(now.Sub(task.queuedAt) / q.agingInterval)
+		if priority > TaskPriorityUrgent {
+			priority = TaskPriorityUrgent
+		}
+	}
+	return priority
+}
+
+// next returns the index of the task to pop next, or -1 if the queue is empty.
+// The earliest queued task wins among those with the same effective priority.
+func (q *TaskQueue) next(now time.Time) int {
+	best := -1
+	var bestPriority TaskPriority
+	for i, t := range q.tasks {
+		priority := q.EffectivePriority(t, now)
+		if best < 0 || priority > bestPriority {
+			best = i
+			bestPriority = priority
+		}
+	}
+	return best
 }
 
 // Len returns the number of tasks in the queue
@@ -0,0 +1,112 @@
+// Package apierror defines the error envelope every REST and WebSocket error
+// uses. The envelope keeps the human-readable "error" message existing
+// clients show, and adds a machine-readable code and, for invalid requests,
+// the fields that failed:
+//
+//	{"error": "email must be a valid email address", "code": "validation_failed",
+//	 "fields": [{"field": "email", "rule": "email", "message": "..."}]}
+package apierror
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/validation"
+)
+
+// Error codes. Clients should branch on these rather than on messages.
+const (
+	CodeInvalidRequest   = "invalid_request"   // Malformed body or parameters
+	CodeValidationFailed = "validation_failed" // Fields broke validation rules; see fields
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodePayloadTooLarge  = "payload_too_large"
+	CodeUnprocessable    = "unprocessable"
+	CodeRateLimited      = "rate_limited"
+	CodeLimitReached     = "limit_reached" // Too much of the user's work is already running
+	CodeInternal         = "internal_error"
+	CodeUpstream         = "upstream_error" // A provider or other external service failed
+	CodeUnavailable      = "unavailable"    // The feature is disabled or not configured
+)
+
+// Response is the error envelope
+type Response struct {
+	Error  string                  `json:"error"`
+	Code   string                  `json:"code"`
+	Fields []validation.FieldError `json:"fields,omitempty"`
+}
+
+// Error is an API error with an HTTP status. Handlers return it and the
+// app's error handler writes the envelope.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New creates an API error
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest creates an invalid_request error
+func BadRequest(message string) *Error {
+	return New(fiber.StatusBadRequest, CodeInvalidRequest, message)
+}
+
+// CodeForStatus returns the code for errors that don't name one
+func CodeForStatus(status int) string {
+	switch status {
+	case fiber.StatusBadRequest:
+		return CodeInvalidRequest
+	case fiber.StatusUnauthorized:
+		return CodeUnauthorized
+	case fiber.StatusForbidden:
+		return CodeForbidden
+	case fiber.StatusNotFound, fiber.StatusMethodNotAllowed:
+		return CodeNotFound
+	case fiber.StatusConflict:
+		return CodeConflict
+	case fiber.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case fiber.StatusUnprocessableEntity:
+		return CodeUnprocessable
+	case fiber.StatusTooManyRequests:
+		return CodeRateLimited
+	case fiber.StatusBadGateway, fiber.StatusGatewayTimeout:
+		return CodeUpstream
+	case fiber.StatusServiceUnavailable, fiber.StatusNotImplemented:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// From converts any error into a status and envelope
+func From(err error) (int, *Response) {
+	var apiErr *Error
+	var fieldErrs validation.Errors
+	var fiberErr *fiber.Error
+
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.Status, &Response{Error: apiErr.Message, Code: apiErr.Code}
+	case errors.As(err, &fieldErrs):
+		return fiber.StatusBadRequest, &Response{
+			Error:  fieldErrs.Error(),
+			Code:   CodeValidationFailed,
+			Fields: fieldErrs,
+		}
+	case errors.As(err, &fiberErr):
+		return fiberErr.Code, &Response{Error: fiberErr.Message, Code: CodeForStatus(fiberErr.Code)}
+	}
+	return fiber.StatusInternalServerError, &Response{Error: err.Error(), Code: CodeInternal}
+}
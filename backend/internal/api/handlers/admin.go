@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/services/filehistory"
+)
+
+// AdminHandler handles server maintenance endpoints for admins
+type AdminHandler struct {
+	fileHistory *filehistory.Compactor
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(fileHistory *filehistory.Compactor) *AdminHandler {
+	return &AdminHandler{fileHistory: fileHistory}
+}
+
+// GetFileHistoryStats reports how much file history is stored and how much
+// of it dedup saves
+func (h *AdminHandler) GetFileHistoryStats(c *fiber.Ctx) error {
+	stats, err := h.fileHistory.Stats()
+	if err != nil {
+		log.Printf("Failed to get file history stats: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get file history stats",
+		})
+	}
+
+	return c.JSON(stats)
+}
+
+// CompactFileHistory runs a file history compaction now and reports what it
+// did
+func (h *AdminHandler) CompactFileHistory(c *fiber.Ctx) error {
+	report, err := h.fileHistory.Compact()
+	if errors.Is(err, filehistory.ErrCompactionRunning) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to compact file history: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to compact file history",
+		})
+	}
+
+	return c.JSON(report)
+}
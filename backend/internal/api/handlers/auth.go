@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"fmt"
-	"regexp"
+	"log"
+	"net"
 	"strings"
 	"time"
 
@@ -10,7 +12,18 @@ import (
 	"github.com/google/uuid"
 	"github.com/jacklau/prism/internal/api/middleware"
 	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations/email"
 	"github.com/jacklau/prism/internal/security"
+	"github.com/jacklau/prism/internal/services/loginaudit"
+)
+
+// maxAuthEventsLimit caps how many auth events one request lists
+const maxAuthEventsLimit = 200
+
+// How long emailed password reset and email change tokens stay valid
+const (
+	passwordResetTokenTTL = time.Hour
+	emailChangeTokenTTL   = 24 * time.Hour
 )
 
 // AuthHandler handles authentication endpoints
@@ -18,6 +31,16 @@ type AuthHandler struct {
 	userRepo    *repository.UserRepository
 	sessionRepo *repository.SessionRepository
 	jwtService  *security.JWTService
+
+	// Desktop mode: the single local user and the token that signs in as them
+	localUserID string
+	localToken  string
+
+	loginAudit *loginaudit.Service
+
+	// Password reset and email change; both need SMTP to send their tokens
+	accountTokenRepo *repository.AccountTokenRepository
+	emailClient      *email.Client
 }
 
 // NewAuthHandler creates a new auth handler
@@ -29,21 +52,82 @@ func NewAuthHandler(userRepo *repository.UserRepository, sessionRepo *repository
 	}
 }
 
+// SetLocalLogin enables signing in as the desktop mode's local user with a token
+func (h *AuthHandler) SetLocalLogin(userID, token string) {
+	h.localUserID = userID
+	h.localToken = token
+}
+
+// SetLoginAudit records sign-ins and registrations, and lets users list them
+func (h *AuthHandler) SetLoginAudit(audit *loginaudit.Service) {
+	h.loginAudit = audit
+}
+
+// SetAccountEmails enables password reset and email change, which email a
+// single-use token to the user
+func (h *AuthHandler) SetAccountEmails(tokenRepo *repository.AccountTokenRepository, emailClient *email.Client) {
+	h.accountTokenRepo = tokenRepo
+	h.emailClient = emailClient
+}
+
+// accountEmailsEnabled reports whether tokens can be emailed
+func (h *AuthHandler) accountEmailsEnabled() bool {
+	return h.accountTokenRepo != nil && h.emailClient != nil && h.emailClient.Enabled()
+}
+
+// recordAuth records a sign-in attempt or registration made by a request
+func (h *AuthHandler) recordAuth(c *fiber.Ctx, attempt loginaudit.Attempt) {
+	if h.loginAudit == nil {
+		return
+	}
+	attempt.IP = c.IP()
+	attempt.UserAgent = c.Get(fiber.HeaderUserAgent)
+	h.loginAudit.Record(attempt)
+}
+
 // RegisterRequest represents a registration request
 type RegisterRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,min=8,max=256"`
 }
 
 // LoginRequest represents a login request
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// ForgotPasswordRequest represents a request for a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required"`
+}
+
+// ResetPasswordRequest represents a password reset with an emailed token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=256"`
+}
+
+// ChangeEmailRequest represents a request to change the current user's email
+type ChangeEmailRequest struct {
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required"`
+}
+
+// ConfirmEmailRequest represents an email change confirmation with an
+// emailed token
+type ConfirmEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// LocalLoginRequest represents a desktop mode sign-in request
+type LocalLoginRequest struct {
+	Token string `json:"token" validate:"required"`
 }
 
 // RefreshRequest represents a token refresh request
 type RefreshRequest struct {
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
 // AuthResponse represents an authentication response
@@ -59,31 +143,17 @@ type UserDTO struct {
 	ID        string    `json:"id"`
 	Email     string    `json:"email"`
 	CreatedAt time.Time `json:"created_at"`
+	IsGuest   bool      `json:"is_guest,omitempty"`
 }
 
 // Register handles user registration
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	var req RegisterRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
-	// Validate email
 	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
-	if !isValidEmail(req.Email) {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid email format",
-		})
-	}
-
-	// Validate password
-	if len(req.Password) < 8 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "password must be at least 8 characters",
-		})
-	}
 
 	// Check if email already exists
 	exists, err := h.userRepo.EmailExists(req.Email)
@@ -131,6 +201,13 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
+	h.recordAuth(c, loginaudit.Attempt{
+		UserID:  user.ID,
+		Email:   user.Email,
+		Kind:    repository.AuthEventRegister,
+		Success: true,
+	})
+
 	return c.Status(fiber.StatusCreated).JSON(AuthResponse{
 		AccessToken:  tokens.AccessToken,
 		RefreshToken: tokens.RefreshToken,
@@ -146,10 +223,8 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 // Login handles user login
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req LoginRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
 	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
@@ -162,6 +237,11 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 	if user == nil {
+		h.recordAuth(c, loginaudit.Attempt{
+			Email:  req.Email,
+			Kind:   repository.AuthEventLogin,
+			Reason: loginaudit.ReasonUnknownEmail,
+		})
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "invalid email or password",
 		})
@@ -169,6 +249,12 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 
 	// Verify password
 	if !security.VerifyPassword(req.Password, user.PasswordHash) {
+		h.recordAuth(c, loginaudit.Attempt{
+			UserID: user.ID,
+			Email:  req.Email,
+			Kind:   repository.AuthEventLogin,
+			Reason: loginaudit.ReasonWrongPassword,
+		})
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "invalid email or password",
 		})
@@ -191,6 +277,13 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
+	h.recordAuth(c, loginaudit.Attempt{
+		UserID:  user.ID,
+		Email:   user.Email,
+		Kind:    repository.AuthEventLogin,
+		Success: true,
+	})
+
 	return c.JSON(AuthResponse{
 		AccessToken:  tokens.AccessToken,
 		RefreshToken: tokens.RefreshToken,
@@ -203,6 +296,38 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	})
 }
 
+// ListAuthEvents returns the current user's recent sign-ins, failed sign-in
+// attempts and registration, newest first
+func (h *AuthHandler) ListAuthEvents(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+	if h.loginAudit == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "sign-in history is not available",
+		})
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > maxAuthEventsLimit {
+		limit = maxAuthEventsLimit
+	}
+
+	events, err := h.loginAudit.List(userID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list sign-in history",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"events": events,
+	})
+}
+
 // Logout handles user logout
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	userID := middleware.GetUserID(c)
@@ -227,10 +352,8 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 // Refresh handles token refresh
 func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
 	var req RefreshRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Validate refresh token
@@ -324,15 +447,10 @@ func (h *AuthHandler) Me(c *fiber.Ctx) error {
 		ID:        user.ID,
 		Email:     user.Email,
 		CreatedAt: user.CreatedAt,
+		IsGuest:   user.IsGuest,
 	})
 }
 
-// isValidEmail validates an email address
-func isValidEmail(email string) bool {
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	return emailRegex.MatchString(email)
-}
-
 // GuestLogin handles guest login - creates a temporary guest account
 func (h *AuthHandler) GuestLogin(c *fiber.Ctx) error {
 	// Generate a unique guest identifier
@@ -349,7 +467,7 @@ func (h *AuthHandler) GuestLogin(c *fiber.Ctx) error {
 	}
 
 	// Create guest user
-	user, err := h.userRepo.Create(guestEmail, passwordHash)
+	user, err := h.userRepo.CreateGuest(guestEmail, passwordHash)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to create guest account",
@@ -381,6 +499,315 @@ func (h *AuthHandler) GuestLogin(c *fiber.Ctx) error {
 			ID:        user.ID,
 			Email:     user.Email,
 			CreatedAt: user.CreatedAt,
+			IsGuest:   true,
+		},
+	})
+}
+
+// LocalLogin signs in as the desktop mode's local user. Only requests from
+// localhost carrying the token issued at startup are accepted.
+func (h *AuthHandler) LocalLogin(c *fiber.Ctx) error {
+	if h.localToken == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "local login is not enabled",
+		})
+	}
+
+	if ip := net.ParseIP(c.IP()); ip == nil || !ip.IsLoopback() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "local login is only available from this machine",
+		})
+	}
+
+	var req LocalLoginRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(h.localToken)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid local token",
+		})
+	}
+
+	user, err := h.userRepo.GetByID(h.localUserID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get local user",
+		})
+	}
+
+	// Generate tokens
+	tokens, err := h.jwtService.GenerateTokenPair(user.ID, user.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to generate tokens",
+		})
+	}
+
+	// Create session
+	refreshTokenHash := security.HashAPIKey(tokens.RefreshToken)
+	_, err = h.sessionRepo.Create(user.ID, refreshTokenHash, time.Now().Add(7*24*time.Hour))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create session",
+		})
+	}
+
+	return c.JSON(AuthResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+		User: UserDTO{
+			ID:        user.ID,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt,
+		},
+	})
+}
+
+// ForgotPassword emails a password reset token to an account. It responds
+// the same whether or not the account exists so as not to reveal which
+// emails are registered.
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	if !h.accountEmailsEnabled() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "password reset is not available",
+		})
+	}
+
+	var req ForgotPasswordRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+
+	user, err := h.userRepo.GetByEmail(req.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get user",
+		})
+	}
+
+	// Guest accounts have no real address to send to
+	if user != nil && !user.IsGuest {
+		token, err := security.GenerateRandomString(32)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to generate token",
+			})
+		}
+		expiresAt := time.Now().Add(passwordResetTokenTTL)
+		if _, err := h.accountTokenRepo.Create(user.ID, repository.AccountTokenPasswordReset, security.HashAPIKey(token), "", expiresAt); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to create token",
+			})
+		}
+		if err := h.emailClient.SendAccountToken(user.Email, email.EventPasswordReset, token, expiresAt); err != nil {
+			log.Printf("Failed to send password reset email to user %s: %v", user.ID, err)
+		}
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "if an account with that email exists, a password reset email has been sent",
+	})
+}
+
+// ResetPassword sets a new password with an emailed token and signs the
+// user out everywhere
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	if !h.accountEmailsEnabled() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "password reset is not available",
+		})
+	}
+
+	var req ResetPasswordRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	token, err := h.accountTokenRepo.Consume(repository.AccountTokenPasswordReset, security.HashAPIKey(req.Token))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check token",
+		})
+	}
+	if token == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid or expired token",
+		})
+	}
+
+	passwordHash, err := security.HashPassword(req.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to hash password",
+		})
+	}
+	if err := h.userRepo.UpdatePassword(token.UserID, passwordHash); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update password",
+		})
+	}
+
+	// Whoever knew the old password may still hold a refresh token
+	if err := h.sessionRepo.DeleteByUserID(token.UserID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to sign out sessions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "password reset",
+	})
+}
+
+// ChangeEmail emails a confirmation token to the address the current user
+// wants to change their email to. The email changes once it is confirmed.
+func (h *AuthHandler) ChangeEmail(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+	if !h.accountEmailsEnabled() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "email change is not available",
+		})
+	}
+
+	var req ChangeEmailRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get user",
+		})
+	}
+	if user == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "user not found",
+		})
+	}
+	if user.IsGuest {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "guest accounts cannot change their email",
+		})
+	}
+	if !security.VerifyPassword(req.Password, user.PasswordHash) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid password",
+		})
+	}
+	if req.Email == user.Email {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "email is unchanged",
+		})
+	}
+
+	exists, err := h.userRepo.EmailExists(req.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check email",
+		})
+	}
+	if exists {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "email already registered",
+		})
+	}
+
+	token, err := security.GenerateRandomString(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to generate token",
+		})
+	}
+	expiresAt := time.Now().Add(emailChangeTokenTTL)
+	if _, err := h.accountTokenRepo.Create(user.ID, repository.AccountTokenEmailChange, security.HashAPIKey(token), req.Email, expiresAt); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create token",
+		})
+	}
+	if err := h.emailClient.SendAccountToken(req.Email, email.EventEmailChange, token, expiresAt); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to send confirmation email: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":    "confirmation email sent",
+		"email":      req.Email,
+		"expires_at": expiresAt,
+	})
+}
+
+// ConfirmEmail changes a user's email to the address an emailed token was
+// sent to
+func (h *AuthHandler) ConfirmEmail(c *fiber.Ctx) error {
+	if !h.accountEmailsEnabled() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "email change is not available",
+		})
+	}
+
+	var req ConfirmEmailRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	token, err := h.accountTokenRepo.Consume(repository.AccountTokenEmailChange, security.HashAPIKey(req.Token))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check token",
+		})
+	}
+	if token == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid or expired token",
+		})
+	}
+
+	// Someone may have registered the address since the token was sent
+	exists, err := h.userRepo.EmailExists(token.NewEmail)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check email",
+		})
+	}
+	if exists {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "email already registered",
+		})
+	}
+
+	if err := h.userRepo.UpdateEmail(token.UserID, token.NewEmail); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update email",
+		})
+	}
+
+	user, err := h.userRepo.GetByID(token.UserID)
+	if err != nil || user == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get user",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "email changed",
+		"user": UserDTO{
+			ID:        user.ID,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt,
 		},
 	})
 }
@@ -1,61 +1,205 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jacklau/prism/internal/api/middleware"
 	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/services/titling"
 )
 
+// maxMessagePageSize limits how many messages one page can hold
+const maxMessagePageSize = 1000
+
 // ChatHandler handles chat endpoints
 type ChatHandler struct {
 	conversationRepo *repository.ConversationRepository
 	messageRepo      *repository.MessageRepository
+	shareRepo        *repository.ConversationShareRepository
+	titleGenerator   *titling.Generator
+	feedbackRepo     *repository.FeedbackRepository
+	toolResultRepo   *repository.ToolResultRepository
+	preferencesRepo  *repository.UserPreferencesRepository
+	sandboxService   *sandbox.Service
+	onDeleted        func(conversationID string)
 }
 
 // NewChatHandler creates a new chat handler
-func NewChatHandler(conversationRepo *repository.ConversationRepository, messageRepo *repository.MessageRepository) *ChatHandler {
+func NewChatHandler(conversationRepo *repository.ConversationRepository, messageRepo *repository.MessageRepository, shareRepo *repository.ConversationShareRepository) *ChatHandler {
 	return &ChatHandler{
 		conversationRepo: conversationRepo,
 		messageRepo:      messageRepo,
+		shareRepo:        shareRepo,
+	}
+}
+
+// SetTitleGenerator enables title regeneration for conversations
+func (h *ChatHandler) SetTitleGenerator(generator *titling.Generator) {
+	h.titleGenerator = generator
+}
+
+// SetFeedbackRepo includes the user's ratings when listing messages
+func (h *ChatHandler) SetFeedbackRepo(feedbackRepo *repository.FeedbackRepository) {
+	h.feedbackRepo = feedbackRepo
+}
+
+// SetToolResultRepo enables fetching the full results of truncated tool
+// messages
+func (h *ChatHandler) SetToolResultRepo(toolResultRepo *repository.ToolResultRepository) {
+	h.toolResultRepo = toolResultRepo
+}
+
+// SetPreferencesRepo fills in new conversations' provider, model and system
+// prompt from the user's preferences when the request leaves them out
+func (h *ChatHandler) SetPreferencesRepo(preferencesRepo *repository.UserPreferencesRepository) {
+	h.preferencesRepo = preferencesRepo
+}
+
+// SetSandboxService fills in new conversations' provider and model from the
+// current workspace's settings, ahead of the user's preferences
+func (h *ChatHandler) SetSandboxService(sandboxService *sandbox.Service) {
+	h.sandboxService = sandboxService
+}
+
+// SetOnDeleted registers a callback run for each conversation after it is
+// deleted
+func (h *ChatHandler) SetOnDeleted(fn func(conversationID string)) {
+	h.onDeleted = fn
+}
+
+// canRead reports whether a user owns a conversation or has it shared with them
+func (h *ChatHandler) canRead(conv *repository.Conversation, userID string) (bool, error) {
+	if conv.UserID == userID {
+		return true, nil
+	}
+	if h.shareRepo == nil {
+		return false, nil
+	}
+	share, err := h.shareRepo.Get(conv.ID, userID)
+	if err != nil {
+		return false, err
 	}
+	return share != nil, nil
 }
 
 // ConversationDTO represents a conversation response
 type ConversationDTO struct {
-	ID           string    `json:"id"`
-	Title        string    `json:"title"`
-	Provider     string    `json:"provider"`
-	Model        string    `json:"model"`
-	SystemPrompt string    `json:"system_prompt,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              string     `json:"id"`
+	Title           string     `json:"title"`
+	Provider        string     `json:"provider"`
+	Model           string     `json:"model"`
+	SystemPrompt    string     `json:"system_prompt,omitempty"`
+	OwnerID         string     `json:"owner_id,omitempty"`
+	Version         int64      `json:"version,omitempty"`
+	Folder          string     `json:"folder,omitempty"`
+	Tags            []string   `json:"tags,omitempty"`
+	PinnedAt        *time.Time `json:"pinned_at,omitempty"`
+	ArchivedAt      *time.Time `json:"archived_at,omitempty"`
+	ToolHistoryKeep *int       `json:"tool_history_keep,omitempty"` // Recent tool results sent to models whole; omitted when the default applies
+	LLMDebug        bool       `json:"llm_debug,omitempty"`         // Provider requests are captured for debugging
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// toConversationDTO converts a conversation for a response
+func toConversationDTO(conv *repository.Conversation) ConversationDTO {
+	return ConversationDTO{
+		ID:              conv.ID,
+		Title:           conv.Title,
+		Provider:        conv.Provider,
+		Model:           conv.Model,
+		SystemPrompt:    conv.SystemPrompt,
+		Folder:          conv.Folder,
+		Tags:            conv.Tags,
+		PinnedAt:        conv.PinnedAt,
+		ArchivedAt:      conv.ArchivedAt,
+		ToolHistoryKeep: conv.ToolHistoryKeep,
+		LLMDebug:        conv.LLMDebug,
+		CreatedAt:       conv.CreatedAt,
+		UpdatedAt:       conv.UpdatedAt,
+	}
 }
 
 // MessageDTO represents a message response
 type MessageDTO struct {
-	ID         string                   `json:"id"`
-	Role       string                   `json:"role"`
-	Content    string                   `json:"content"`
-	ToolCalls  []map[string]interface{} `json:"tool_calls,omitempty"`
-	ToolCallID string                   `json:"tool_call_id,omitempty"`
-	CreatedAt  time.Time                `json:"created_at"`
+	ID              string                   `json:"id"`
+	Role            string                   `json:"role"`
+	Content         string                   `json:"content"`
+	ToolCalls       []map[string]interface{} `json:"tool_calls,omitempty"`
+	ToolCallID      string                   `json:"tool_call_id,omitempty"`
+	Metadata        map[string]interface{}   `json:"metadata,omitempty"`          // Provider and model that answered, or a turn's override
+	Feedback        string                   `json:"feedback,omitempty"`          // The user's rating of an assistant message: up or down
+	ClientMessageID string                   `json:"client_message_id,omitempty"` // ID the sending client gave a user message
+	Status          string                   `json:"status,omitempty"`            // partial while streaming, interrupted if the server stopped mid-reply
+	CreatedAt       time.Time                `json:"created_at"`
 }
 
-// CreateConversationRequest represents a request to create a conversation
+// CreateConversationRequest represents a request to create a conversation.
+// Provider, model and system prompt default to the user's preferences.
 type CreateConversationRequest struct {
-	Provider     string `json:"provider"`
-	Model        string `json:"model"`
-	SystemPrompt string `json:"system_prompt,omitempty"`
+	Provider     string `json:"provider,omitempty" validate:"max=64"`
+	Model        string `json:"model,omitempty" validate:"max=200"`
+	SystemPrompt string `json:"system_prompt,omitempty" validate:"max=20000"`
 }
 
-// UpdateConversationRequest represents a request to update a conversation
+// UpdateConversationRequest represents a request to update a conversation.
+// Omitted fields are left unchanged.
 type UpdateConversationRequest struct {
-	Title string `json:"title"`
+	Title    *string  `json:"title,omitempty" validate:"max=200"`
+	Archived *bool    `json:"archived,omitempty"`
+	Pinned   *bool    `json:"pinned,omitempty"`
+	Folder   *string  `json:"folder,omitempty" validate:"max=100"` // "" removes it from its folder
+	Tags     []string `json:"tags,omitempty" validate:"max=20"`    // Replaces the tags; [] clears them
+	// ToolHistoryKeep is how many recent tool results are sent to models
+	// whole, older ones being collapsed to a summary; 0 keeps them all
+	ToolHistoryKeep *int `json:"tool_history_keep,omitempty" validate:"min=0,max=10000"`
+	// ClearToolHistoryKeep goes back to the server's default
+	ClearToolHistoryKeep bool `json:"clear_tool_history_keep,omitempty"`
+	// LLMDebug captures the requests sent to providers for this
+	// conversation, and their raw responses, for GET /:id/llm-debug
+	LLMDebug *bool `json:"llm_debug,omitempty"`
 }
 
-// ListConversations lists all conversations for the current user
+// BulkConversationRequest represents an action applied to many conversations
+type BulkConversationRequest struct {
+	IDs    []string `json:"ids" validate:"required,max=500"`
+	Action string   `json:"action" validate:"required,oneof=archive unarchive pin unpin move tag untag delete"`
+	Folder string   `json:"folder,omitempty" validate:"max=100"` // For move; "" removes them from their folder
+	Tag    string   `json:"tag,omitempty" validate:"max=50"`     // For tag and untag
+}
+
+// maxTagLength is the longest tag a conversation can carry
+const maxTagLength = 50
+
+// normalizeTags trims and deduplicates tags, dropping empty ones. Returns an
+// error message if a tag is too long.
+func normalizeTags(tags []string) ([]string, string) {
+	seen := make(map[string]bool, len(tags))
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Sprintf("tags must be at most %d characters", maxTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized, ""
+}
+
+// ListConversations lists the current user's conversations. Archived ones
+// are left out unless ?archived=true (only archived) or ?archived=all; ?folder,
+// ?tag and ?pinned=true narrow the list further.
 func (h *ChatHandler) ListConversations(c *fiber.Ctx) error {
 	userID := middleware.GetUserID(c)
 	if userID == "" {
@@ -67,7 +211,24 @@ func (h *ChatHandler) ListConversations(c *fiber.Ctx) error {
 	limit := c.QueryInt("limit", 50)
 	offset := c.QueryInt("offset", 0)
 
-	conversations, err := h.conversationRepo.ListByUserID(userID, limit, offset)
+	filter := repository.ConversationFilter{
+		PinnedOnly: c.QueryBool("pinned", false),
+		Folder:     c.Query("folder"),
+		Tag:        c.Query("tag"),
+	}
+	switch c.Query("archived") {
+	case "", "false":
+	case "true", repository.ArchivedOnly:
+		filter.Archived = repository.ArchivedOnly
+	case repository.ArchivedAll:
+		filter.Archived = repository.ArchivedAll
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "archived must be one of: false, true, all",
+		})
+	}
+
+	conversations, err := h.conversationRepo.ListByUserID(userID, filter, limit, offset)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to list conversations",
@@ -76,15 +237,7 @@ func (h *ChatHandler) ListConversations(c *fiber.Ctx) error {
 
 	dtos := make([]ConversationDTO, len(conversations))
 	for i, conv := range conversations {
-		dtos[i] = ConversationDTO{
-			ID:           conv.ID,
-			Title:        conv.Title,
-			Provider:     conv.Provider,
-			Model:        conv.Model,
-			SystemPrompt: conv.SystemPrompt,
-			CreatedAt:    conv.CreatedAt,
-			UpdatedAt:    conv.UpdatedAt,
-		}
+		dtos[i] = toConversationDTO(conv)
 	}
 
 	return c.JSON(fiber.Map{
@@ -102,15 +255,36 @@ func (h *ChatHandler) CreateConversation(c *fiber.Ctx) error {
 	}
 
 	var req CreateConversationRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
+	if h.sandboxService != nil && (req.Provider == "" || req.Model == "") {
+		settings, err := h.sandboxService.WorkspaceSettings(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to get workspace settings",
+			})
+		}
+		if settings != nil {
+			repository.FillModel(&req.Provider, &req.Model, settings.DefaultProvider, settings.DefaultModel)
+		}
+	}
+	if h.preferencesRepo != nil && (req.Provider == "" || req.Model == "" || req.SystemPrompt == "") {
+		prefs, err := h.preferencesRepo.GetOrDefault(userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to get preferences",
+			})
+		}
+		repository.FillModel(&req.Provider, &req.Model, prefs.DefaultProvider, prefs.DefaultModel)
+		if req.SystemPrompt == "" {
+			req.SystemPrompt = prefs.DefaultSystemPrompt
+		}
+	}
 	if req.Provider == "" || req.Model == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "provider and model are required",
+			"error": "provider and model are required when no default is set in the workspace or preferences",
 		})
 	}
 
@@ -121,15 +295,7 @@ func (h *ChatHandler) CreateConversation(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(ConversationDTO{
-		ID:           conv.ID,
-		Title:        conv.Title,
-		Provider:     conv.Provider,
-		Model:        conv.Model,
-		SystemPrompt: conv.SystemPrompt,
-		CreatedAt:    conv.CreatedAt,
-		UpdatedAt:    conv.UpdatedAt,
-	})
+	return c.Status(fiber.StatusCreated).JSON(toConversationDTO(conv))
 }
 
 // GetConversation gets a conversation by ID
@@ -154,22 +320,30 @@ func (h *ChatHandler) GetConversation(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check ownership
-	if conv.UserID != userID {
+	// Check ownership or shared access
+	allowed, err := h.canRead(conv, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check conversation access",
+		})
+	}
+	if !allowed {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "access denied",
 		})
 	}
 
-	return c.JSON(ConversationDTO{
-		ID:           conv.ID,
-		Title:        conv.Title,
-		Provider:     conv.Provider,
-		Model:        conv.Model,
-		SystemPrompt: conv.SystemPrompt,
-		CreatedAt:    conv.CreatedAt,
-		UpdatedAt:    conv.UpdatedAt,
-	})
+	version, err := h.conversationRepo.GetVersion(conv.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get conversation",
+		})
+	}
+
+	dto := toConversationDTO(conv)
+	dto.OwnerID = conv.UserID
+	dto.Version = version
+	return c.JSON(dto)
 }
 
 // UpdateConversation updates a conversation
@@ -202,30 +376,210 @@ func (h *ChatHandler) UpdateConversation(c *fiber.Ctx) error {
 	}
 
 	var req UpdateConversationRequest
-	if err := c.BodyParser(&req); err != nil {
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	var tags []string
+	if req.Tags != nil {
+		var message string
+		if tags, message = normalizeTags(req.Tags); message != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": message,
+			})
+		}
+	}
+
+	ids := []string{convID}
+	if req.Title != nil {
+		err = h.conversationRepo.Update(convID, *req.Title)
+	}
+	if err == nil && req.Archived != nil {
+		_, err = h.conversationRepo.SetArchived(userID, ids, *req.Archived)
+	}
+	if err == nil && req.Pinned != nil {
+		_, err = h.conversationRepo.SetPinned(userID, ids, *req.Pinned)
+	}
+	if err == nil && req.Folder != nil {
+		_, err = h.conversationRepo.SetFolder(userID, ids, strings.TrimSpace(*req.Folder))
+	}
+	if err == nil && tags != nil {
+		err = h.conversationRepo.SetTags(convID, tags)
+	}
+	if err == nil && req.ToolHistoryKeep != nil {
+		err = h.conversationRepo.SetToolHistoryKeep(userID, convID, req.ToolHistoryKeep)
+	}
+	if err == nil && req.ClearToolHistoryKeep {
+		err = h.conversationRepo.SetToolHistoryKeep(userID, convID, nil)
+	}
+	if err == nil && req.LLMDebug != nil {
+		err = h.conversationRepo.SetLLMDebug(userID, convID, *req.LLMDebug)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update conversation",
+		})
+	}
+
+	conv, err = h.conversationRepo.GetByID(convID)
+	if err != nil || conv == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get conversation",
+		})
+	}
+	return c.JSON(toConversationDTO(conv))
+}
+
+// BulkUpdateConversations archives, pins, moves, tags or deletes many of the
+// current user's conversations at once. Conversations the user doesn't own
+// are skipped.
+func (h *ChatHandler) BulkUpdateConversations(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req BulkConversationRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	tag := strings.TrimSpace(req.Tag)
+	if (req.Action == "tag" || req.Action == "untag") && tag == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
+			"error": "tag is required",
 		})
 	}
 
-	if err := h.conversationRepo.Update(convID, req.Title); err != nil {
+	var updated int64
+	var err error
+	switch req.Action {
+	case "archive", "unarchive":
+		updated, err = h.conversationRepo.SetArchived(userID, req.IDs, req.Action == "archive")
+	case "pin", "unpin":
+		updated, err = h.conversationRepo.SetPinned(userID, req.IDs, req.Action == "pin")
+	case "move":
+		updated, err = h.conversationRepo.SetFolder(userID, req.IDs, strings.TrimSpace(req.Folder))
+	case "tag":
+		updated, err = h.conversationRepo.AddTag(userID, req.IDs, tag)
+	case "untag":
+		updated, err = h.conversationRepo.RemoveTag(userID, req.IDs, tag)
+	case "delete":
+		updated, err = h.conversationRepo.DeleteOwned(userID, req.IDs)
+	}
+	if err != nil {
+		log.Printf("Failed to %s conversations: %v", req.Action, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "failed to update conversation",
+			"error": "failed to update conversations",
+		})
+	}
+	if req.Action == "delete" && h.onDeleted != nil {
+		for _, id := range req.IDs {
+			h.onDeleted(id)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"action":  req.Action,
+		"updated": updated,
+	})
+}
+
+// ListFolders lists the current user's conversation folders and tags with
+// how many conversations each holds
+func (h *ChatHandler) ListFolders(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
 		})
 	}
 
-	conv.Title = req.Title
-	return c.JSON(ConversationDTO{
-		ID:           conv.ID,
-		Title:        conv.Title,
-		Provider:     conv.Provider,
-		Model:        conv.Model,
-		SystemPrompt: conv.SystemPrompt,
-		CreatedAt:    conv.CreatedAt,
-		UpdatedAt:    time.Now(),
+	folders, err := h.conversationRepo.ListFolders(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list folders",
+		})
+	}
+	tags, err := h.conversationRepo.ListTags(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list tags",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"folders": folders,
+		"tags":    tags,
 	})
 }
 
+// RegenerateTitle generates a new title for a conversation from its messages
+func (h *ChatHandler) RegenerateTitle(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	if h.titleGenerator == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "title generation not available",
+		})
+	}
+
+	convID := c.Params("id")
+	conv, err := h.conversationRepo.GetByID(convID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get conversation",
+		})
+	}
+	if conv == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "conversation not found",
+		})
+	}
+
+	// Check ownership
+	if conv.UserID != userID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "access denied",
+		})
+	}
+
+	messages, err := h.messageRepo.ListByConversationID(convID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get messages",
+		})
+	}
+
+	title, err := h.titleGenerator.Generate(c.Context(), userID, conv, messages)
+	if errors.Is(err, titling.ErrNoContent) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "conversation has no messages to title",
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to generate title for conversation %s: %v", convID, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to generate title",
+		})
+	}
+
+	if err := h.conversationRepo.Update(convID, title); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update conversation",
+		})
+	}
+
+	conv.Title = title
+	conv.UpdatedAt = time.Now()
+	return c.JSON(toConversationDTO(conv))
+}
+
 // DeleteConversation deletes a conversation
 func (h *ChatHandler) DeleteConversation(c *fiber.Ctx) error {
 	userID := middleware.GetUserID(c)
@@ -260,6 +614,9 @@ func (h *ChatHandler) DeleteConversation(c *fiber.Ctx) error {
 			"error": "failed to delete conversation",
 		})
 	}
+	if h.onDeleted != nil {
+		h.onDeleted(convID)
+	}
 
 	return c.JSON(fiber.Map{
 		"message": "conversation deleted",
@@ -293,15 +650,7 @@ func (h *ChatHandler) SearchConversations(c *fiber.Ctx) error {
 
 	dtos := make([]ConversationDTO, len(conversations))
 	for i, conv := range conversations {
-		dtos[i] = ConversationDTO{
-			ID:           conv.ID,
-			Title:        conv.Title,
-			Provider:     conv.Provider,
-			Model:        conv.Model,
-			SystemPrompt: conv.SystemPrompt,
-			CreatedAt:    conv.CreatedAt,
-			UpdatedAt:    conv.UpdatedAt,
-		}
+		dtos[i] = toConversationDTO(conv)
 	}
 
 	return c.JSON(fiber.Map{
@@ -309,7 +658,8 @@ func (h *ChatHandler) SearchConversations(c *fiber.Ctx) error {
 	})
 }
 
-// GetMessages gets all messages for a conversation
+// GetMessages gets a conversation's messages: all of them, or a page of
+// them before or after a message when a limit is given
 func (h *ChatHandler) GetMessages(c *fiber.Ctx) error {
 	userID := middleware.GetUserID(c)
 	if userID == "" {
@@ -331,19 +681,66 @@ func (h *ChatHandler) GetMessages(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check ownership
-	if conv.UserID != userID {
+	// Check ownership or shared access
+	allowed, err := h.canRead(conv, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check conversation access",
+		})
+	}
+	if !allowed {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "access denied",
 		})
 	}
 
-	messages, err := h.messageRepo.ListByConversationID(convID)
+	page := repository.MessagePage{
+		Before: c.Query("before"),
+		After:  c.Query("after"),
+		Limit:  c.QueryInt("limit", 0),
+	}
+	if page.Limit < 0 || page.Limit > maxMessagePageSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("limit must be between 0 and %d", maxMessagePageSize),
+		})
+	}
+	switch c.Query("order", "asc") {
+	case "asc":
+	case "desc":
+		page.Newest = true
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "order must be one of: asc, desc",
+		})
+	}
+
+	messages, hasMore, err := h.messageRepo.ListPage(convID, page)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "before and after must be IDs of messages in this conversation",
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to list messages",
 		})
 	}
+	total, err := h.messageRepo.CountByConversationID(convID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to count messages",
+		})
+	}
+
+	var feedback map[string]*repository.Feedback
+	if h.feedbackRepo != nil {
+		feedback, err = h.feedbackRepo.ListForConversation(convID, userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to get feedback",
+			})
+		}
+	}
 
 	dtos := make([]MessageDTO, len(messages))
 	for i, msg := range messages {
@@ -357,16 +754,91 @@ func (h *ChatHandler) GetMessages(c *fiber.Ctx) error {
 		}
 
 		dtos[i] = MessageDTO{
-			ID:         msg.ID,
-			Role:       msg.Role,
-			Content:    msg.Content,
-			ToolCalls:  toolCalls,
-			ToolCallID: msg.ToolCallID,
-			CreatedAt:  msg.CreatedAt,
+			ID:              msg.ID,
+			Role:            msg.Role,
+			Content:         msg.Content,
+			ToolCalls:       toolCalls,
+			ToolCallID:      msg.ToolCallID,
+			Metadata:        msg.Metadata,
+			ClientMessageID: msg.ClientMessageID,
+			Status:          msg.Status,
+			CreatedAt:       msg.CreatedAt,
+		}
+		if f := feedback[msg.ID]; f != nil {
+			dtos[i].Feedback = toFeedbackDTO(f).Rating
 		}
 	}
 
 	return c.JSON(fiber.Map{
 		"messages": dtos,
+		"total":    total,
+		"has_more": hasMore,
+	})
+}
+
+// GetToolResult returns the full result of a tool call. Results too big for
+// the context are truncated in the tool message, which holds the head and
+// tail only; this returns all of it.
+func (h *ChatHandler) GetToolResult(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, err := h.conversationRepo.GetByID(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get conversation",
+		})
+	}
+	if conv == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "conversation not found",
+		})
+	}
+
+	allowed, err := h.canRead(conv, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check conversation access",
+		})
+	}
+	if !allowed {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "access denied",
+		})
+	}
+
+	message, err := h.messageRepo.GetByID(c.Params("messageId"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get message",
+		})
+	}
+	if message == nil || message.ConversationID != conv.ID || message.Role != "tool" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "tool result not found",
+		})
+	}
+
+	content, truncated := message.Content, false
+	full, err := h.toolResultRepo.Get(message.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get tool result",
+		})
+	}
+	if full != nil {
+		content, truncated = full.Content, true
+	}
+
+	return c.JSON(fiber.Map{
+		"message_id":   message.ID,
+		"tool_call_id": message.ToolCallID,
+		"truncated":    truncated,
+		"size":         len(content),
+		"content":      content,
 	})
 }
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/services/checkpoint"
+)
+
+// CheckpointHandler handles workspace checkpoint endpoints
+type CheckpointHandler struct {
+	checkpoints *checkpoint.Service
+}
+
+// NewCheckpointHandler creates a new checkpoint handler
+func NewCheckpointHandler(checkpoints *checkpoint.Service) *CheckpointHandler {
+	return &CheckpointHandler{checkpoints: checkpoints}
+}
+
+// CreateCheckpointRequest represents a request to checkpoint the workspace
+type CreateCheckpointRequest struct {
+	Label string `json:"label,omitempty" validate:"max=200"`
+}
+
+// CheckpointDTO represents a checkpoint response
+type CheckpointDTO struct {
+	ID        string    `json:"id"`
+	Label     string    `json:"label"`
+	Trigger   string    `json:"trigger"`
+	CommitSHA string    `json:"commit_sha"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListCheckpoints returns the checkpoints for the user's current workspace
+func (h *CheckpointHandler) ListCheckpoints(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	workspacePath, checkpoints, err := h.checkpoints.List(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list checkpoints",
+		})
+	}
+
+	dtos := make([]CheckpointDTO, 0, len(checkpoints))
+	for _, cp := range checkpoints {
+		dtos = append(dtos, toCheckpointDTO(cp))
+	}
+
+	return c.JSON(fiber.Map{
+		"workspace_path": workspacePath,
+		"checkpoints":    dtos,
+	})
+}
+
+// CreateCheckpoint snapshots the user's current workspace
+func (h *CheckpointHandler) CreateCheckpoint(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req CreateCheckpointRequest
+	if len(c.Body()) > 0 {
+		if err := parseBody(c, &req); err != nil {
+			return err
+		}
+	}
+
+	label := strings.TrimSpace(req.Label)
+
+	cp, err := h.checkpoints.Create(c.Context(), userID, label, repository.CheckpointTriggerManual)
+	if err != nil {
+		log.Printf("Failed to create checkpoint for user %s: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create checkpoint",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(toCheckpointDTO(cp))
+}
+
+// RestoreCheckpoint resets the workspace to a checkpoint. The current state
+// is checkpointed first and returned as the backup.
+func (h *CheckpointHandler) RestoreCheckpoint(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	result, err := h.checkpoints.Restore(c.Context(), userID, c.Params("id"))
+	if errors.Is(err, checkpoint.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "checkpoint not found",
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to restore checkpoint %s: %v", c.Params("id"), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to restore checkpoint",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"checkpoint": toCheckpointDTO(result.Checkpoint),
+		"backup":     toCheckpointDTO(result.Backup),
+	})
+}
+
+// DeleteCheckpoint removes a checkpoint
+func (h *CheckpointHandler) DeleteCheckpoint(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	err := h.checkpoints.Delete(c.Context(), userID, c.Params("id"))
+	if errors.Is(err, checkpoint.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "checkpoint not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete checkpoint",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "checkpoint deleted successfully",
+	})
+}
+
+// toCheckpointDTO converts a checkpoint to its response form
+func toCheckpointDTO(cp *repository.Checkpoint) CheckpointDTO {
+	return CheckpointDTO{
+		ID:        cp.ID,
+		Label:     cp.Label,
+		Trigger:   cp.Trigger,
+		CommitSHA: cp.CommitSHA,
+		CreatedAt: cp.CreatedAt,
+	}
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/services/coderunner"
+)
+
+// CodeRunnerHandler handles code runner endpoints
+type CodeRunnerHandler struct {
+	runner *coderunner.Runner
+}
+
+// NewCodeRunnerHandler creates a new code runner handler
+func NewCodeRunnerHandler(runner *coderunner.Runner) *CodeRunnerHandler {
+	return &CodeRunnerHandler{runner: runner}
+}
+
+// ListEnvironments returns the supported execution environments with their
+// toolchain versions and availability
+func (h *CodeRunnerHandler) ListEnvironments(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"environments": h.runner.Environments(c.UserContext()),
+	})
+}
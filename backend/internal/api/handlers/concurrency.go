@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/apierror"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/services/concurrency"
+)
+
+// ConcurrencyHandler handles the admin endpoints for per-user concurrency
+// limits
+type ConcurrencyHandler struct {
+	limiter  *concurrency.Limiter
+	userRepo *repository.UserRepository
+}
+
+// NewConcurrencyHandler creates a new concurrency handler
+func NewConcurrencyHandler(limiter *concurrency.Limiter, userRepo *repository.UserRepository) *ConcurrencyHandler {
+	return &ConcurrencyHandler{limiter: limiter, userRepo: userRepo}
+}
+
+// ConcurrencyLimitDTO represents a user's concurrency limits. Omitted fields
+// use the server's defaults; zero is unlimited.
+type ConcurrencyLimitDTO struct {
+	UserID    string     `json:"user_id"`
+	Agents    *int       `json:"agents,omitempty"`
+	Swarms    *int       `json:"swarms,omitempty"`
+	Builds    *int       `json:"builds,omitempty"`
+	Shells    *int       `json:"shells,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// ListLimits returns the default limits and every user's overrides
+func (h *ConcurrencyHandler) ListLimits(c *fiber.Ctx) error {
+	overrides, err := h.limiter.ListOverrides()
+	if err != nil {
+		log.Printf("Failed to list concurrency limits: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list concurrency limits",
+		})
+	}
+
+	dtos := make([]ConcurrencyLimitDTO, len(overrides))
+	for i, override := range overrides {
+		dtos[i] = toConcurrencyLimitDTO(override)
+	}
+
+	return c.JSON(fiber.Map{
+		"defaults":         h.limiter.Defaults(),
+		"queue_timeout_ms": h.limiter.QueueTimeout().Milliseconds(),
+		"overrides":        dtos,
+	})
+}
+
+// GetUserLimits returns a user's limits and how much of each kind of work
+// they have running
+func (h *ConcurrencyHandler) GetUserLimits(c *fiber.Ctx) error {
+	userID := c.Params("userId")
+	if err := h.requireUser(userID); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"user_id": userID,
+		"limits":  h.limiter.UserLimits(userID),
+		"running": h.limiter.Running(userID),
+	})
+}
+
+// SetUserLimits replaces a user's overrides
+func (h *ConcurrencyHandler) SetUserLimits(c *fiber.Ctx) error {
+	userID := c.Params("userId")
+
+	var req ConcurrencyLimitDTO
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	for _, n := range []*int{req.Agents, req.Swarms, req.Builds, req.Shells} {
+		if n != nil && *n < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "limits must not be negative",
+			})
+		}
+	}
+
+	if err := h.requireUser(userID); err != nil {
+		return err
+	}
+
+	limit := &repository.ConcurrencyLimit{
+		UserID:    userID,
+		MaxAgents: req.Agents,
+		MaxSwarms: req.Swarms,
+		MaxBuilds: req.Builds,
+		MaxShells: req.Shells,
+	}
+	if err := h.limiter.SetOverride(limit); err != nil {
+		log.Printf("Failed to save concurrency limit: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save concurrency limits",
+		})
+	}
+
+	return c.JSON(toConcurrencyLimitDTO(limit))
+}
+
+// DeleteUserLimits returns a user to the default limits
+func (h *ConcurrencyHandler) DeleteUserLimits(c *fiber.Ctx) error {
+	if err := h.limiter.DeleteOverride(c.Params("userId")); err != nil {
+		log.Printf("Failed to delete concurrency limit: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete concurrency limits",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "concurrency limits reset to the defaults",
+	})
+}
+
+// requireUser returns an error unless the user exists
+func (h *ConcurrencyHandler) requireUser(userID string) error {
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		return apierror.New(fiber.StatusInternalServerError, apierror.CodeInternal, "failed to get user")
+	}
+	if user == nil {
+		return apierror.New(fiber.StatusNotFound, apierror.CodeNotFound, "user not found")
+	}
+	return nil
+}
+
+func toConcurrencyLimitDTO(limit *repository.ConcurrencyLimit) ConcurrencyLimitDTO {
+	updatedAt := limit.UpdatedAt
+	return ConcurrencyLimitDTO{
+		UserID:    limit.UserID,
+		Agents:    limit.MaxAgents,
+		Swarms:    limit.MaxSwarms,
+		Builds:    limit.MaxBuilds,
+		Shells:    limit.MaxShells,
+		UpdatedAt: &updatedAt,
+	}
+}
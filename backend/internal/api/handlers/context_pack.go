@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/services/contextpack"
+)
+
+// ContextPackHandler handles packing workspace context for conversations
+type ContextPackHandler struct {
+	packer           *contextpack.Packer
+	conversationRepo *repository.ConversationRepository
+	contextPackRepo  *repository.ContextPackRepository
+}
+
+// NewContextPackHandler creates a new context pack handler
+func NewContextPackHandler(
+	packer *contextpack.Packer,
+	conversationRepo *repository.ConversationRepository,
+	contextPackRepo *repository.ContextPackRepository,
+) *ContextPackHandler {
+	return &ContextPackHandler{
+		packer:           packer,
+		conversationRepo: conversationRepo,
+		contextPackRepo:  contextPackRepo,
+	}
+}
+
+// ConversationContextPackDTO represents the pack attached to a conversation
+type ConversationContextPackDTO struct {
+	Spec      contextpack.Spec `json:"spec"`
+	Content   string           `json:"content"`
+	Files     []string         `json:"files"`
+	Tokens    int              `json:"tokens"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// PackContext packs workspace context without attaching it, to preview a
+// pack or use it elsewhere
+func (h *ContextPackHandler) PackContext(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var spec contextpack.Spec
+	if err := parseBody(c, &spec); err != nil {
+		return err
+	}
+
+	bundle, err := h.packer.Pack(userID, spec)
+	if err != nil {
+		return packError(c, err)
+	}
+	return c.JSON(bundle)
+}
+
+// GetConversationPack returns the pack attached to a conversation
+func (h *ContextPackHandler) GetConversationPack(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	pack, err := h.contextPackRepo.Get(conv.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get context pack",
+		})
+	}
+	if pack == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "conversation has no context pack",
+		})
+	}
+
+	return c.JSON(toConversationContextPackDTO(pack))
+}
+
+// AttachConversationPack packs workspace context and attaches it to a
+// conversation, replacing any pack it had. The pack is a snapshot: it is
+// sent with every turn as packed, until it is attached again or removed.
+func (h *ContextPackHandler) AttachConversationPack(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	var spec contextpack.Spec
+	if err := parseBody(c, &spec); err != nil {
+		return err
+	}
+
+	bundle, err := h.packer.Pack(userID, spec)
+	if err != nil {
+		return packError(c, err)
+	}
+
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save context pack",
+		})
+	}
+	files := make([]string, 0, len(bundle.Files))
+	for _, file := range bundle.Files {
+		files = append(files, file.Path)
+	}
+	pack := &repository.ContextPack{
+		ConversationID: conv.ID,
+		UserID:         userID,
+		Spec:           string(specJSON),
+		Content:        bundle.Content,
+		Files:          files,
+		Tokens:         bundle.Tokens,
+	}
+	if err := h.contextPackRepo.Save(pack); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save context pack",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"pack":        toConversationContextPackDTO(pack),
+		"omitted":     bundle.Omitted,
+		"total_files": bundle.TotalFiles,
+	})
+}
+
+// DetachConversationPack removes the pack attached to a conversation
+func (h *ContextPackHandler) DetachConversationPack(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	removed, err := h.contextPackRepo.Delete(conv.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to remove context pack",
+		})
+	}
+	if !removed {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "conversation has no context pack",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "context pack removed successfully",
+	})
+}
+
+// packError responds to a failed pack
+func packError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, contextpack.ErrInvalidSpec) || errors.Is(err, contextpack.ErrNoFiles) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "failed to pack context",
+	})
+}
+
+// toConversationContextPackDTO converts a stored pack for a response
+func toConversationContextPackDTO(pack *repository.ContextPack) ConversationContextPackDTO {
+	dto := ConversationContextPackDTO{
+		Content:   pack.Content,
+		Files:     pack.Files,
+		Tokens:    pack.Tokens,
+		CreatedAt: pack.CreatedAt,
+	}
+	// The spec was encoded by AttachConversationPack, so it always decodes
+	_ = json.Unmarshal([]byte(pack.Spec), &dto.Spec)
+	return dto
+}
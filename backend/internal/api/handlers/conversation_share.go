@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+)
+
+// ConversationShareHandler handles conversation sharing endpoints
+type ConversationShareHandler struct {
+	conversationRepo *repository.ConversationRepository
+	shareRepo        *repository.ConversationShareRepository
+	userRepo         *repository.UserRepository
+	onSharesChanged  func(conversationID string)
+}
+
+// NewConversationShareHandler creates a new conversation share handler
+func NewConversationShareHandler(
+	conversationRepo *repository.ConversationRepository,
+	shareRepo *repository.ConversationShareRepository,
+	userRepo *repository.UserRepository,
+) *ConversationShareHandler {
+	return &ConversationShareHandler{
+		conversationRepo: conversationRepo,
+		shareRepo:        shareRepo,
+		userRepo:         userRepo,
+	}
+}
+
+// SetOnSharesChanged registers a callback run after a conversation is shared
+// or a share is removed
+func (h *ConversationShareHandler) SetOnSharesChanged(fn func(conversationID string)) {
+	h.onSharesChanged = fn
+}
+
+// ConversationShareDTO represents a conversation share response
+type ConversationShareDTO struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ShareConversationRequest represents a request to share a conversation
+type ShareConversationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"oneof=viewer editor"` // Defaults to viewer
+}
+
+// ShareConversation shares a conversation with another user by email
+func (h *ConversationShareHandler) ShareConversation(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	var req ShareConversationRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if req.Role == "" {
+		req.Role = repository.ShareRoleViewer
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	target, err := h.userRepo.GetByEmail(email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to look up user",
+		})
+	}
+	if target == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "user not found",
+		})
+	}
+	if target.ID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot share a conversation with yourself",
+		})
+	}
+
+	share, err := h.shareRepo.Upsert(conv.ID, target.ID, req.Role)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to share conversation",
+		})
+	}
+	if h.onSharesChanged != nil {
+		h.onSharesChanged(conv.ID)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(ConversationShareDTO{
+		UserID:    share.UserID,
+		Email:     share.Email,
+		Role:      share.Role,
+		CreatedAt: share.CreatedAt,
+	})
+}
+
+// ListShares lists the users a conversation is shared with
+func (h *ConversationShareHandler) ListShares(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	shares, err := h.shareRepo.ListByConversationID(conv.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list shares",
+		})
+	}
+
+	dtos := make([]ConversationShareDTO, len(shares))
+	for i, share := range shares {
+		dtos[i] = ConversationShareDTO{
+			UserID:    share.UserID,
+			Email:     share.Email,
+			Role:      share.Role,
+			CreatedAt: share.CreatedAt,
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"shares": dtos,
+	})
+}
+
+// RemoveShare revokes a user's access to a conversation. The owner can
+// remove anyone; a participant can remove themselves.
+func (h *ConversationShareHandler) RemoveShare(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	convID := c.Params("id")
+	targetID := c.Params("userId")
+
+	conv, err := h.conversationRepo.GetByID(convID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get conversation",
+		})
+	}
+	if conv == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "conversation not found",
+		})
+	}
+
+	if conv.UserID != userID && targetID != userID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "access denied",
+		})
+	}
+
+	if err := h.shareRepo.Delete(convID, targetID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to remove share",
+		})
+	}
+	if h.onSharesChanged != nil {
+		h.onSharesChanged(convID)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "share removed",
+	})
+}
+
+// ListSharedWithMe lists conversations other users have shared with the current user
+func (h *ConversationShareHandler) ListSharedWithMe(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conversations, err := h.shareRepo.ListSharedWithUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list shared conversations",
+		})
+	}
+
+	dtos := make([]ConversationDTO, len(conversations))
+	for i, conv := range conversations {
+		dtos[i] = ConversationDTO{
+			ID:           conv.ID,
+			Title:        conv.Title,
+			Provider:     conv.Provider,
+			Model:        conv.Model,
+			SystemPrompt: conv.SystemPrompt,
+			OwnerID:      conv.UserID,
+			CreatedAt:    conv.CreatedAt,
+			UpdatedAt:    conv.UpdatedAt,
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"conversations": dtos,
+	})
+}
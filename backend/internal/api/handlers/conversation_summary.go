@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+	"github.com/jacklau/prism/internal/services/summarizing"
+)
+
+// maxNotificationField keeps each part of a summary notification within the
+// field limits of Slack and Discord
+const maxNotificationField = 1000
+
+// ConversationSummaryHandler handles conversation summaries
+type ConversationSummaryHandler struct {
+	conversationRepo   *repository.ConversationRepository
+	messageRepo        *repository.MessageRepository
+	summarizer         *summarizing.Summarizer
+	integrationManager *integrations.Manager // nil if summaries can't be posted
+}
+
+// NewConversationSummaryHandler creates a new conversation summary handler
+func NewConversationSummaryHandler(
+	conversationRepo *repository.ConversationRepository,
+	messageRepo *repository.MessageRepository,
+	summarizer *summarizing.Summarizer,
+	integrationManager *integrations.Manager,
+) *ConversationSummaryHandler {
+	return &ConversationSummaryHandler{
+		conversationRepo:   conversationRepo,
+		messageRepo:        messageRepo,
+		summarizer:         summarizer,
+		integrationManager: integrationManager,
+	}
+}
+
+// SummarizeRequest represents a request to summarize a conversation
+type SummarizeRequest struct {
+	Provider string `json:"provider,omitempty" validate:"max=64"`
+	Model    string `json:"model,omitempty" validate:"max=200"`
+	Archive  bool   `json:"archive,omitempty"` // Archive the conversation once it is summarized
+	Notify   bool   `json:"notify,omitempty"`  // Post the summary to the configured Slack and Discord webhooks
+}
+
+// Summarize writes a summary of a conversation's decisions, touched files and
+// follow-ups, stores it on the conversation and returns it
+func (h *ConversationSummaryHandler) Summarize(c *fiber.Ctx) error {
+	var req SummarizeRequest
+	if len(c.Body()) > 0 {
+		if err := parseBody(c, &req); err != nil {
+			return err
+		}
+	}
+	if (req.Provider == "") != (req.Model == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "provider and model must be given together",
+		})
+	}
+
+	userID := middleware.GetUserID(c)
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	messages, err := h.messageRepo.ListByConversationID(conv.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get messages",
+		})
+	}
+
+	summary, err := h.summarizer.Summarize(c.Context(), userID, conv, messages, req.Provider, req.Model)
+	if errors.Is(err, summarizing.ErrNoContent) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to summarize conversation %s: %v", conv.ID, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to summarize conversation",
+		})
+	}
+
+	encoded, err := json.Marshal(summary)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save summary",
+		})
+	}
+	if err := h.conversationRepo.SetSummary(conv.ID, string(encoded)); err != nil {
+		log.Printf("Failed to save summary of conversation %s: %v", conv.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save summary",
+		})
+	}
+
+	if req.Archive {
+		if _, err := h.conversationRepo.SetArchived(userID, []string{conv.ID}, true); err != nil {
+			log.Printf("Failed to archive conversation %s: %v", conv.ID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "summary saved, but failed to archive conversation",
+			})
+		}
+	}
+
+	notified := req.Notify && h.integrationManager != nil
+	if notified {
+		h.integrationManager.Notify(&integrations.Event{
+			Type:           integrations.EventConversationSummarized,
+			UserID:         userID,
+			ConversationID: conv.ID,
+			Data:           summaryEventData(conv.Title, summary),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"summary":  summary,
+		"archived": req.Archive,
+		"notified": notified,
+	})
+}
+
+// GetSummary returns a conversation's stored summary
+func (h *ConversationSummaryHandler) GetSummary(c *fiber.Ctx) error {
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), middleware.GetUserID(c))
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	stored, err := h.conversationRepo.GetSummary(conv.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get summary",
+		})
+	}
+	if stored == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "conversation has not been summarized",
+		})
+	}
+
+	var summary summarizing.Summary
+	if err := json.Unmarshal([]byte(stored), &summary); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to read summary",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"summary": summary,
+	})
+}
+
+// summaryEventData renders a summary as the fields of a notification
+func summaryEventData(title string, summary *summarizing.Summary) map[string]interface{} {
+	data := map[string]interface{}{
+		"title":    title,
+		"overview": truncateField(summary.Overview),
+	}
+	for key, items := range map[string][]string{
+		"decisions":     summary.Decisions,
+		"files_touched": summary.FilesTouched,
+		"follow_ups":    summary.FollowUps,
+	} {
+		if len(items) > 0 {
+			data[key] = truncateField("• " + strings.Join(items, "\n• "))
+		}
+	}
+	return data
+}
+
+// truncateField cuts a notification field to its limit
+func truncateField(text string) string {
+	if runes := []rune(text); len(runes) > maxNotificationField {
+		return string(runes[:maxNotificationField]) + "..."
+	}
+	return text
+}
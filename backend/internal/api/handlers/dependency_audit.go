@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/services/audit"
+)
+
+const defaultAuditIntervalHours = 24
+
+// DependencyAuditHandler handles dependency audit endpoints for the
+// user's current workspace
+type DependencyAuditHandler struct {
+	auditService   *audit.Service
+	scheduleRepo   *repository.AuditScheduleRepository
+	sandboxService *sandbox.Service
+}
+
+// NewDependencyAuditHandler creates a new dependency audit handler
+func NewDependencyAuditHandler(auditService *audit.Service, scheduleRepo *repository.AuditScheduleRepository, sandboxService *sandbox.Service) *DependencyAuditHandler {
+	return &DependencyAuditHandler{
+		auditService:   auditService,
+		scheduleRepo:   scheduleRepo,
+		sandboxService: sandboxService,
+	}
+}
+
+// UpdateAuditScheduleRequest represents a request to configure scheduled audits
+type UpdateAuditScheduleRequest struct {
+	Enabled       *bool `json:"enabled,omitempty"`
+	IntervalHours int   `json:"interval_hours,omitempty" validate:"min=1,max=720"`
+}
+
+// AuditScheduleDTO represents a scheduled audit response
+type AuditScheduleDTO struct {
+	WorkspacePath          string     `json:"workspace_path"`
+	Enabled                bool       `json:"enabled"`
+	IntervalHours          int        `json:"interval_hours"`
+	LastRunAt              *time.Time `json:"last_run_at,omitempty"`
+	LastVulnerabilityCount int        `json:"last_vulnerability_count"`
+	LastError              string     `json:"last_error,omitempty"`
+}
+
+// RunAudit scans the current workspace's dependencies
+func (h *DependencyAuditHandler) RunAudit(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	workDir, err := h.sandboxService.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get workspace",
+		})
+	}
+
+	var ecosystems []string
+	if ecosystem := c.Query("ecosystem"); ecosystem != "" {
+		ecosystems = []string{ecosystem}
+	}
+
+	report, err := h.auditService.Audit(workDir, ecosystems)
+	if errors.Is(err, audit.ErrNoManifests) || errors.Is(err, audit.ErrUnsupportedEcosystem) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to audit dependencies for user %s: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to audit dependencies",
+		})
+	}
+
+	return c.JSON(report)
+}
+
+// GetSchedule returns the scheduled audit for the current workspace
+func (h *DependencyAuditHandler) GetSchedule(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	workDir, err := h.sandboxService.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get workspace",
+		})
+	}
+
+	schedule, err := h.scheduleRepo.GetByWorkspace(userID, workDir)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get audit schedule",
+		})
+	}
+	if schedule == nil {
+		return c.JSON(AuditScheduleDTO{
+			WorkspacePath: workDir,
+			Enabled:       false,
+			IntervalHours: defaultAuditIntervalHours,
+		})
+	}
+
+	return c.JSON(toAuditScheduleDTO(schedule))
+}
+
+// UpdateSchedule enables, disables or changes the interval of the scheduled
+// audit for the current workspace
+func (h *DependencyAuditHandler) UpdateSchedule(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req UpdateAuditScheduleRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	workDir, err := h.sandboxService.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get workspace",
+		})
+	}
+
+	existing, err := h.scheduleRepo.GetByWorkspace(userID, workDir)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get audit schedule",
+		})
+	}
+
+	enabled, intervalHours := true, defaultAuditIntervalHours
+	if existing != nil {
+		enabled, intervalHours = existing.Enabled, existing.IntervalHours
+	}
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	if req.IntervalHours > 0 {
+		intervalHours = req.IntervalHours
+	}
+
+	schedule, err := h.scheduleRepo.Upsert(userID, workDir, intervalHours, enabled)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save audit schedule",
+		})
+	}
+
+	return c.JSON(toAuditScheduleDTO(schedule))
+}
+
+// DeleteSchedule removes the scheduled audit for the current workspace
+func (h *DependencyAuditHandler) DeleteSchedule(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	workDir, err := h.sandboxService.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get workspace",
+		})
+	}
+
+	deleted, err := h.scheduleRepo.Delete(userID, workDir)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete audit schedule",
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "audit schedule not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "audit schedule deleted successfully",
+	})
+}
+
+// toAuditScheduleDTO converts a schedule to its response form
+func toAuditScheduleDTO(schedule *repository.AuditSchedule) AuditScheduleDTO {
+	return AuditScheduleDTO{
+		WorkspacePath:          schedule.WorkspacePath,
+		Enabled:                schedule.Enabled,
+		IntervalHours:          schedule.IntervalHours,
+		LastRunAt:              schedule.LastRunAt,
+		LastVulnerabilityCount: schedule.LastVulnerabilityCount,
+		LastError:              schedule.LastError,
+	}
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/services/digest"
+)
+
+const defaultDigestHour = 9
+
+// DigestHandler handles activity digest endpoints
+type DigestHandler struct {
+	service      *digest.Service
+	scheduleRepo *repository.DigestScheduleRepository
+}
+
+// NewDigestHandler creates a new digest handler
+func NewDigestHandler(service *digest.Service, scheduleRepo *repository.DigestScheduleRepository) *DigestHandler {
+	return &DigestHandler{
+		service:      service,
+		scheduleRepo: scheduleRepo,
+	}
+}
+
+// UpdateDigestRequest represents a request to configure activity digests.
+// Fields left out keep their current values.
+type UpdateDigestRequest struct {
+	Enabled   *bool  `json:"enabled,omitempty"`
+	Frequency string `json:"frequency,omitempty" validate:"oneof=daily weekly"`
+	Hour      *int   `json:"hour,omitempty" validate:"min=0,max=23"`
+	Weekday   *int   `json:"weekday,omitempty" validate:"min=0,max=6"` // 0 is Sunday
+	Timezone  string `json:"timezone,omitempty" validate:"max=64"`
+}
+
+// DigestScheduleDTO represents an activity digest schedule response
+type DigestScheduleDTO struct {
+	Enabled    bool       `json:"enabled"`
+	Frequency  string     `json:"frequency"`
+	Hour       int        `json:"hour"`
+	Weekday    int        `json:"weekday"`
+	Timezone   string     `json:"timezone"`
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	NextSendAt *time.Time `json:"next_send_at,omitempty"`
+}
+
+// GetDigest returns the current user's digest schedule
+func (h *DigestHandler) GetDigest(c *fiber.Ctx) error {
+	schedule, err := h.scheduleRepo.Get(middleware.GetUserID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get digest schedule",
+		})
+	}
+	if schedule == nil {
+		schedule = defaultDigestSchedule(middleware.GetUserID(c))
+		schedule.Enabled = false
+	}
+	return c.JSON(toDigestScheduleDTO(schedule))
+}
+
+// UpdateDigest enables, disables or reschedules the current user's digest
+func (h *DigestHandler) UpdateDigest(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req UpdateDigestRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	schedule, err := h.scheduleRepo.Get(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get digest schedule",
+		})
+	}
+	if schedule == nil {
+		schedule = defaultDigestSchedule(userID)
+	}
+
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	if req.Frequency != "" {
+		schedule.Frequency = req.Frequency
+	}
+	if req.Hour != nil {
+		schedule.Hour = *req.Hour
+	}
+	if req.Weekday != nil {
+		schedule.Weekday = time.Weekday(*req.Weekday)
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "unknown timezone: " + req.Timezone,
+			})
+		}
+		schedule.Timezone = req.Timezone
+	}
+
+	if err := h.scheduleRepo.Upsert(schedule); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save digest schedule",
+		})
+	}
+
+	saved, err := h.scheduleRepo.Get(userID)
+	if err != nil || saved == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get digest schedule",
+		})
+	}
+	return c.JSON(toDigestScheduleDTO(saved))
+}
+
+// DeleteDigest removes the current user's digest schedule
+func (h *DigestHandler) DeleteDigest(c *fiber.Ctx) error {
+	deleted, err := h.scheduleRepo.Delete(middleware.GetUserID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete digest schedule",
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "digest schedule not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Activity digests disabled",
+	})
+}
+
+// PreviewDigest returns the digest that would be sent now, without sending it
+func (h *DigestHandler) PreviewDigest(c *fiber.Ctx) error {
+	_, result, err := h.buildDigest(middleware.GetUserID(c))
+	if err != nil {
+		log.Printf("Failed to build digest: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to build digest",
+		})
+	}
+	return c.JSON(result)
+}
+
+// SendDigest sends the current user's digest now, even when there was no
+// activity. The schedule is left unchanged.
+func (h *DigestHandler) SendDigest(c *fiber.Ctx) error {
+	schedule, result, err := h.buildDigest(middleware.GetUserID(c))
+	if err != nil {
+		log.Printf("Failed to build digest: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to build digest",
+		})
+	}
+
+	h.service.Send(schedule, result)
+	return c.JSON(fiber.Map{
+		"message": "Digest sent",
+		"digest":  result,
+	})
+}
+
+// buildDigest builds the user's digest for the period ending now, using the
+// default schedule if they have none
+func (h *DigestHandler) buildDigest(userID string) (*repository.DigestSchedule, *digest.Digest, error) {
+	schedule, err := h.scheduleRepo.Get(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if schedule == nil {
+		schedule = defaultDigestSchedule(userID)
+	}
+
+	result, err := h.service.Build(schedule, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	return schedule, result, nil
+}
+
+// defaultDigestSchedule returns the schedule a new digest starts with: daily
+// at 9:00 UTC
+func defaultDigestSchedule(userID string) *repository.DigestSchedule {
+	return &repository.DigestSchedule{
+		UserID:    userID,
+		Frequency: repository.DigestDaily,
+		Hour:      defaultDigestHour,
+		Weekday:   time.Monday,
+		Timezone:  "UTC",
+		Enabled:   true,
+	}
+}
+
+// toDigestScheduleDTO converts a schedule to its response, with when the
+// next digest is due
+func toDigestScheduleDTO(schedule *repository.DigestSchedule) DigestScheduleDTO {
+	dto := DigestScheduleDTO{
+		Enabled:    schedule.Enabled,
+		Frequency:  schedule.Frequency,
+		Hour:       schedule.Hour,
+		Weekday:    int(schedule.Weekday),
+		Timezone:   schedule.Timezone,
+		LastSentAt: schedule.LastSentAt,
+	}
+	if schedule.Enabled {
+		next := nextDigestTime(schedule, time.Now())
+		dto.NextSendAt = &next
+	}
+	return dto
+}
+
+// nextDigestTime returns the first scheduled time after now
+func nextDigestTime(schedule *repository.DigestSchedule, now time.Time) time.Time {
+	if schedule.Frequency == repository.DigestWeekly {
+		return schedule.LastScheduled(now).AddDate(0, 0, 7)
+	}
+	return schedule.LastScheduled(now).AddDate(0, 0, 1)
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/services/discordbot"
+)
+
+// DiscordBotHandler handles Discord server linking and per-server bot settings
+type DiscordBotHandler struct {
+	bot  *discordbot.Bot
+	repo *repository.IntegrationRepository
+}
+
+// NewDiscordBotHandler creates a new Discord bot handler
+func NewDiscordBotHandler(bot *discordbot.Bot, repo *repository.IntegrationRepository) *DiscordBotHandler {
+	return &DiscordBotHandler{
+		bot:  bot,
+		repo: repo,
+	}
+}
+
+// UpdateDiscordGuildRequest represents a request to update a linked server's
+// bot settings. Omitted fields are unchanged.
+type UpdateDiscordGuildRequest struct {
+	ChannelID  *string `json:"channel_id"`
+	UseThreads *bool   `json:"use_threads"`
+	Provider   *string `json:"provider"`
+	Model      *string `json:"model"`
+	Enabled    *bool   `json:"enabled"`
+}
+
+// DiscordGuildResponse represents a linked Discord server in API responses
+type DiscordGuildResponse struct {
+	GuildID    string    `json:"guild_id"`
+	GuildName  string    `json:"guild_name,omitempty"`
+	ChannelID  string    `json:"channel_id,omitempty"`
+	UseThreads bool      `json:"use_threads"`
+	Provider   string    `json:"provider,omitempty"`
+	Model      string    `json:"model,omitempty"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (h *DiscordBotHandler) toDiscordGuildResponse(settings *repository.DiscordGuildSettings) DiscordGuildResponse {
+	name := settings.GuildName
+	if current := h.bot.GuildName(settings.GuildID); current != "" {
+		name = current
+	}
+	return DiscordGuildResponse{
+		GuildID:    settings.GuildID,
+		GuildName:  name,
+		ChannelID:  settings.ChannelID,
+		UseThreads: settings.UseThreads,
+		Provider:   settings.Provider,
+		Model:      settings.Model,
+		Enabled:    settings.Enabled,
+		CreatedAt:  settings.CreatedAt,
+		UpdatedAt:  settings.UpdatedAt,
+	}
+}
+
+// LinkGuild links a Discord server to the current user with a code from /prism link
+func (h *DiscordBotHandler) LinkGuild(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req struct {
+		Code string `json:"code" validate:"required"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	settings, err := h.bot.CompleteLink(req.Code, userID)
+	if errors.Is(err, discordbot.ErrInvalidLinkCode) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to link discord server",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(h.toDiscordGuildResponse(settings))
+}
+
+// ListGuilds returns the Discord servers linked to the current user
+func (h *DiscordBotHandler) ListGuilds(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	list, err := h.repo.ListDiscordGuildSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list discord servers",
+		})
+	}
+
+	response := make([]DiscordGuildResponse, 0, len(list))
+	for _, settings := range list {
+		response = append(response, h.toDiscordGuildResponse(settings))
+	}
+
+	return c.JSON(fiber.Map{
+		"guilds": response,
+	})
+}
+
+// UpdateGuild updates a linked Discord server's bot settings
+func (h *DiscordBotHandler) UpdateGuild(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	settings, err := h.repo.GetDiscordGuildSettings(c.Params("guildID"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get discord server",
+		})
+	}
+	if settings == nil || settings.UserID != userID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "discord server not found",
+		})
+	}
+
+	var req UpdateDiscordGuildRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if req.ChannelID != nil {
+		settings.ChannelID = *req.ChannelID
+	}
+	if req.UseThreads != nil {
+		settings.UseThreads = *req.UseThreads
+	}
+	if req.Provider != nil {
+		settings.Provider = *req.Provider
+	}
+	if req.Model != nil {
+		settings.Model = *req.Model
+	}
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if (settings.Provider == "") != (settings.Model == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "provider and model must be set together",
+		})
+	}
+
+	if err := h.repo.SetDiscordGuildSettings(settings); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update discord server",
+		})
+	}
+
+	return c.JSON(h.toDiscordGuildResponse(settings))
+}
+
+// DeleteGuild unlinks one of the current user's Discord servers
+func (h *DiscordBotHandler) DeleteGuild(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	deleted, err := h.repo.DeleteDiscordGuildSettings(c.Params("guildID"), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to unlink discord server",
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "discord server not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Discord server unlinked",
+	})
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations/confluence"
+	"github.com/jacklau/prism/internal/integrations/notion"
+	"github.com/jacklau/prism/internal/services/docsources"
+)
+
+// DocSourcesHandler handles connecting the Notion and Confluence accounts
+// the documentation tools read from
+type DocSourcesHandler struct {
+	docs *docsources.Service
+	repo *repository.IntegrationRepository
+}
+
+// NewDocSourcesHandler creates a new documentation sources handler
+func NewDocSourcesHandler(docs *docsources.Service, repo *repository.IntegrationRepository) *DocSourcesHandler {
+	return &DocSourcesHandler{
+		docs: docs,
+		repo: repo,
+	}
+}
+
+// SetNotionRequest represents a request to connect Notion with an internal
+// integration token
+type SetNotionRequest struct {
+	Token string `json:"token" validate:"required,max=500"`
+}
+
+// NotionSettingsResponse represents Notion settings in API responses. The
+// token is never returned.
+type NotionSettingsResponse struct {
+	Connected     bool       `json:"connected"`
+	WorkspaceName string     `json:"workspace_name,omitempty"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+}
+
+// SetConfluenceRequest represents a request to connect Confluence. Email is
+// required for Confluence Cloud API tokens and omitted for personal access
+// tokens.
+type SetConfluenceRequest struct {
+	BaseURL string `json:"base_url" validate:"required,url,max=2048"`
+	Email   string `json:"email" validate:"max=320"`
+	Token   string `json:"token" validate:"required,max=500"`
+}
+
+// ConfluenceSettingsResponse represents Confluence settings in API
+// responses. The token is never returned.
+type ConfluenceSettingsResponse struct {
+	Connected   bool       `json:"connected"`
+	BaseURL     string     `json:"base_url,omitempty"`
+	Email       string     `json:"email,omitempty"`
+	DisplayName string     `json:"display_name,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+func toNotionSettingsResponse(settings *repository.NotionSettings) NotionSettingsResponse {
+	if settings == nil {
+		return NotionSettingsResponse{}
+	}
+	return NotionSettingsResponse{
+		Connected:     settings.Token != "",
+		WorkspaceName: settings.WorkspaceName,
+		CreatedAt:     &settings.CreatedAt,
+		UpdatedAt:     &settings.UpdatedAt,
+	}
+}
+
+func toConfluenceSettingsResponse(settings *repository.ConfluenceSettings) ConfluenceSettingsResponse {
+	if settings == nil {
+		return ConfluenceSettingsResponse{}
+	}
+	return ConfluenceSettingsResponse{
+		Connected:   settings.Token != "",
+		BaseURL:     settings.BaseURL,
+		Email:       settings.Email,
+		DisplayName: settings.DisplayName,
+		CreatedAt:   &settings.CreatedAt,
+		UpdatedAt:   &settings.UpdatedAt,
+	}
+}
+
+// GetNotion returns the current user's Notion settings
+func (h *DocSourcesHandler) GetNotion(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	settings, err := h.repo.GetNotionSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get notion settings",
+		})
+	}
+
+	return c.JSON(toNotionSettingsResponse(settings))
+}
+
+// SetNotion connects Notion after checking the token
+func (h *DocSourcesHandler) SetNotion(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req SetNotionRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	settings, err := h.docs.ConnectNotion(userID, req.Token)
+	if errors.Is(err, notion.ErrUnauthorized) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "notion rejected the token",
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to connect Notion: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to reach notion",
+		})
+	}
+
+	return c.JSON(toNotionSettingsResponse(settings))
+}
+
+// DeleteNotion disconnects Notion
+func (h *DocSourcesHandler) DeleteNotion(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	if err := h.repo.DeleteNotionSettings(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete notion settings",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Notion integration disconnected",
+	})
+}
+
+// GetConfluence returns the current user's Confluence settings
+func (h *DocSourcesHandler) GetConfluence(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	settings, err := h.repo.GetConfluenceSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get confluence settings",
+		})
+	}
+
+	return c.JSON(toConfluenceSettingsResponse(settings))
+}
+
+// SetConfluence connects Confluence after checking the credentials
+func (h *DocSourcesHandler) SetConfluence(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req SetConfluenceRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	settings, err := h.docs.ConnectConfluence(userID, req.BaseURL, strings.TrimSpace(req.Email), req.Token)
+	switch {
+	case errors.Is(err, confluence.ErrInvalidURL):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "base_url must be an http or https URL",
+		})
+	case errors.Is(err, confluence.ErrUnauthorized):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "confluence rejected the credentials",
+		})
+	case errors.Is(err, confluence.ErrNotFound):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "no confluence site found at base_url",
+		})
+	case err != nil:
+		log.Printf("Failed to connect Confluence: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to reach confluence",
+		})
+	}
+
+	return c.JSON(toConfluenceSettingsResponse(settings))
+}
+
+// DeleteConfluence disconnects Confluence
+func (h *DocSourcesHandler) DeleteConfluence(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	if err := h.repo.DeleteConfluenceSettings(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete confluence settings",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Confluence integration disconnected",
+	})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/services/eval"
+)
+
+// EvalHandler handles benchmark suites and their runs
+type EvalHandler struct {
+	service *eval.Service
+}
+
+// NewEvalHandler creates a new eval handler
+func NewEvalHandler(service *eval.Service) *EvalHandler {
+	return &EvalHandler{service: service}
+}
+
+// ListSuites lists the user's suites
+func (h *EvalHandler) ListSuites(c *fiber.Ctx) error {
+	suites, err := h.service.ListSuites(middleware.GetUserID(c))
+	if err != nil {
+		return evalError(c, err, "failed to list suites")
+	}
+	return c.JSON(fiber.Map{
+		"suites": suites,
+	})
+}
+
+// CreateSuite creates a suite
+func (h *EvalHandler) CreateSuite(c *fiber.Ctx) error {
+	var req eval.SuiteRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	suite, err := h.service.CreateSuite(middleware.GetUserID(c), req)
+	if err != nil {
+		return evalError(c, err, "failed to create suite")
+	}
+	return c.Status(fiber.StatusCreated).JSON(suite)
+}
+
+// GetSuite returns a suite
+func (h *EvalHandler) GetSuite(c *fiber.Ctx) error {
+	suite, err := h.service.GetSuite(middleware.GetUserID(c), c.Params("id"))
+	if err != nil {
+		return evalError(c, err, "failed to get suite")
+	}
+	return c.JSON(suite)
+}
+
+// UpdateSuite replaces a suite's name, description and cases
+func (h *EvalHandler) UpdateSuite(c *fiber.Ctx) error {
+	var req eval.SuiteRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	suite, err := h.service.UpdateSuite(middleware.GetUserID(c), c.Params("id"), req)
+	if err != nil {
+		return evalError(c, err, "failed to update suite")
+	}
+	return c.JSON(suite)
+}
+
+// DeleteSuite deletes a suite with its runs
+func (h *EvalHandler) DeleteSuite(c *fiber.Ctx) error {
+	if err := h.service.DeleteSuite(middleware.GetUserID(c), c.Params("id")); err != nil {
+		return evalError(c, err, "failed to delete suite")
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// StartRun starts running a suite against a set of targets and returns the
+// running run. Poll GetRun for the results.
+func (h *EvalHandler) StartRun(c *fiber.Ctx) error {
+	var req eval.RunRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	run, err := h.service.StartRun(middleware.GetUserID(c), c.Params("id"), req)
+	if err != nil {
+		return evalError(c, err, "failed to start run")
+	}
+	return c.Status(fiber.StatusAccepted).JSON(run)
+}
+
+// ListRuns lists a suite's runs
+func (h *EvalHandler) ListRuns(c *fiber.Ctx) error {
+	runs, err := h.service.ListRuns(middleware.GetUserID(c), c.Params("id"))
+	if err != nil {
+		return evalError(c, err, "failed to list runs")
+	}
+	return c.JSON(fiber.Map{
+		"runs": runs,
+	})
+}
+
+// GetStats compares the targets a suite has been run against, across all
+// its runs
+func (h *EvalHandler) GetStats(c *fiber.Ctx) error {
+	stats, err := h.service.Stats(middleware.GetUserID(c), c.Params("id"))
+	if err != nil {
+		return evalError(c, err, "failed to get stats")
+	}
+	return c.JSON(fiber.Map{
+		"targets": stats,
+	})
+}
+
+// GetRun returns a run with its results and a summary per target
+func (h *EvalHandler) GetRun(c *fiber.Ctx) error {
+	run, err := h.service.GetRun(middleware.GetUserID(c), c.Params("id"))
+	if err != nil {
+		return evalError(c, err, "failed to get run")
+	}
+	return c.JSON(run)
+}
+
+// StopRun stops a run in progress
+func (h *EvalHandler) StopRun(c *fiber.Ctx) error {
+	stopped, err := h.service.StopRun(middleware.GetUserID(c), c.Params("id"))
+	if err != nil {
+		return evalError(c, err, "failed to stop run")
+	}
+	return c.JSON(fiber.Map{
+		"stopped": stopped,
+	})
+}
+
+// evalError responds to a failed eval request
+func evalError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, eval.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, eval.ErrInvalidRequest),
+		errors.Is(err, eval.ErrNoAPIKey):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	log.Printf("Eval request failed: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+)
+
+// recentFeedbackLimit is how many of the latest ratings the analytics list
+const recentFeedbackLimit = 20
+
+// FeedbackHandler handles ratings of assistant messages
+type FeedbackHandler struct {
+	feedbackRepo       *repository.FeedbackRepository
+	conversationRepo   *repository.ConversationRepository
+	messageRepo        *repository.MessageRepository
+	shareRepo          *repository.ConversationShareRepository
+	integrationManager *integrations.Manager // nil if ratings aren't forwarded to analytics
+}
+
+// NewFeedbackHandler creates a new feedback handler
+func NewFeedbackHandler(
+	feedbackRepo *repository.FeedbackRepository,
+	conversationRepo *repository.ConversationRepository,
+	messageRepo *repository.MessageRepository,
+	shareRepo *repository.ConversationShareRepository,
+	integrationManager *integrations.Manager,
+) *FeedbackHandler {
+	return &FeedbackHandler{
+		feedbackRepo:       feedbackRepo,
+		conversationRepo:   conversationRepo,
+		messageRepo:        messageRepo,
+		shareRepo:          shareRepo,
+		integrationManager: integrationManager,
+	}
+}
+
+// FeedbackRequest represents a rating of an assistant message
+type FeedbackRequest struct {
+	Rating  string `json:"rating" validate:"required,oneof=up down"`
+	Comment string `json:"comment,omitempty" validate:"max=2000"`
+}
+
+// FeedbackDTO represents a rating of an assistant message
+type FeedbackDTO struct {
+	ID             string    `json:"id"`
+	MessageID      string    `json:"message_id"`
+	ConversationID string    `json:"conversation_id"`
+	Rating         string    `json:"rating"`
+	Comment        string    `json:"comment,omitempty"`
+	Provider       string    `json:"provider"`
+	Model          string    `json:"model"`
+	Tools          []string  `json:"tools,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SetFeedback rates an assistant message up or down, with an optional
+// comment, replacing the user's earlier rating of it
+func (h *FeedbackHandler) SetFeedback(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, message, status, msg := h.resolveMessage(c.Params("id"), c.Params("messageId"), userID)
+	if message == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	var req FeedbackRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	messages, err := h.messageRepo.ListByConversationID(conv.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get messages",
+		})
+	}
+
+	// Messages record the model that answered when it wasn't the
+	// conversation's
+	provider, model := conv.Provider, conv.Model
+	if p, _ := message.Metadata["provider"].(string); p != "" {
+		provider = p
+	}
+	if m, _ := message.Metadata["model"].(string); m != "" {
+		model = m
+	}
+
+	feedback := &repository.Feedback{
+		MessageID:      message.ID,
+		ConversationID: conv.ID,
+		UserID:         userID,
+		Rating:         repository.FeedbackUp,
+		Comment:        strings.TrimSpace(req.Comment),
+		Provider:       provider,
+		Model:          model,
+		Tools:          turnTools(messages, message.ID),
+	}
+	if req.Rating == "down" {
+		feedback.Rating = repository.FeedbackDown
+	}
+	if err := h.feedbackRepo.Upsert(feedback); err != nil {
+		log.Printf("Failed to save feedback on message %s: %v", message.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save feedback",
+		})
+	}
+
+	if h.integrationManager != nil {
+		h.integrationManager.TrackMessageFeedback(userID, conv.ID, message.ID, provider, model,
+			req.Rating, feedback.Tools, feedback.Comment != "")
+	}
+
+	return c.JSON(toFeedbackDTO(feedback))
+}
+
+// DeleteFeedback removes the user's rating of an assistant message
+func (h *FeedbackHandler) DeleteFeedback(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	_, message, status, msg := h.resolveMessage(c.Params("id"), c.Params("messageId"), userID)
+	if message == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := h.feedbackRepo.Delete(message.ID, userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete feedback",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "feedback deleted",
+	})
+}
+
+// GetAnalytics totals the user's ratings per model and per tool over a time
+// window, given by the window query parameter (24h, 7d, 30d, 90d or all),
+// with their latest ratings
+func (h *FeedbackHandler) GetAnalytics(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	return h.analytics(c, userID)
+}
+
+// GetAllAnalytics is GetAnalytics across all users, for admins
+func (h *FeedbackHandler) GetAllAnalytics(c *fiber.Ctx) error {
+	return h.analytics(c, "")
+}
+
+// analytics reports ratings by one user, or by everyone if userID is ""
+func (h *FeedbackHandler) analytics(c *fiber.Ctx, userID string) error {
+	window := c.Query("window", defaultStatsWindow)
+	duration, ok := statsWindows[window]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "window must be one of 24h, 7d, 30d, 90d or all",
+		})
+	}
+
+	var since time.Time
+	if duration > 0 {
+		since = time.Now().Add(-duration)
+	}
+
+	models, err := h.feedbackRepo.CountByModel(userID, since)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get feedback",
+		})
+	}
+	tools, err := h.feedbackRepo.CountByTool(userID, since)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get feedback",
+		})
+	}
+	recent, err := h.feedbackRepo.ListRecent(userID, since, recentFeedbackLimit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get feedback",
+		})
+	}
+
+	var up, down int
+	for _, m := range models {
+		up += m.Up
+		down += m.Down
+	}
+	dtos := make([]FeedbackDTO, len(recent))
+	for i, f := range recent {
+		dtos[i] = toFeedbackDTO(f)
+	}
+
+	return c.JSON(fiber.Map{
+		"window": window,
+		"up":     up,
+		"down":   down,
+		"models": models,
+		"tools":  tools,
+		"recent": dtos,
+	})
+}
+
+// resolveMessage loads an assistant message the user can read, with its
+// conversation. On failure it returns a nil message with the HTTP status
+// and error message.
+func (h *FeedbackHandler) resolveMessage(convID, messageID, userID string) (*repository.Conversation, *repository.Message, int, string) {
+	conv, status, msg := getReadableConversation(h.conversationRepo, h.shareRepo, convID, userID, false)
+	if conv == nil {
+		return nil, nil, status, msg
+	}
+
+	message, err := h.messageRepo.GetByID(messageID)
+	if err != nil {
+		return nil, nil, fiber.StatusInternalServerError, "failed to get message"
+	}
+	if message == nil || message.ConversationID != conv.ID || message.Role != "assistant" {
+		return nil, nil, fiber.StatusNotFound, "message not found"
+	}
+
+	return conv, message, 0, ""
+}
+
+// turnTools lists the tools called in the turn that ended with the given
+// message, i.e. since the user message before it
+func turnTools(messages []*repository.Message, messageID string) []string {
+	end := -1
+	for i, msg := range messages {
+		if msg.ID == messageID {
+			end = i
+			break
+		}
+	}
+
+	seen := make(map[string]bool)
+	var tools []string
+	for i := end; i >= 0 && messages[i].Role != "user"; i-- {
+		for _, tc := range messages[i].ToolCalls {
+			if !seen[tc.Name] {
+				seen[tc.Name] = true
+				tools = append(tools, tc.Name)
+			}
+		}
+	}
+	sort.Strings(tools)
+	return tools
+}
+
+func toFeedbackDTO(f *repository.Feedback) FeedbackDTO {
+	rating := "up"
+	if f.Rating == repository.FeedbackDown {
+		rating = "down"
+	}
+	return FeedbackDTO{
+		ID:             f.ID,
+		MessageID:      f.MessageID,
+		ConversationID: f.ConversationID,
+		Rating:         rating,
+		Comment:        f.Comment,
+		Provider:       f.Provider,
+		Model:          f.Model,
+		Tools:          f.Tools,
+		CreatedAt:      f.CreatedAt,
+		UpdatedAt:      f.UpdatedAt,
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/services/changes"
+)
+
+// FileHistoryHandler handles file history endpoints
+type FileHistoryHandler struct {
+	changeService *changes.Service
+}
+
+// NewFileHistoryHandler creates a new file history handler
+func NewFileHistoryHandler(changeService *changes.Service) *FileHistoryHandler {
+	return &FileHistoryHandler{changeService: changeService}
+}
+
+// DiffHistory returns a unified diff between a history entry and either the
+// file's current content (against=current, the default) or the entry
+// recorded before it (against=previous)
+func (h *FileHistoryHandler) DiffHistory(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	against := c.Query("against", changes.AgainstCurrent)
+	if against != changes.AgainstCurrent && against != changes.AgainstPrevious {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "against must be current or previous",
+		})
+	}
+
+	result, err := h.changeService.DiffHistory(userID, c.Params("id"), against)
+	if errors.Is(err, changes.ErrHistoryNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "history entry not found",
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to diff history entry %s: %v", c.Params("id"), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to diff history entry",
+		})
+	}
+
+	return c.JSON(result)
+}
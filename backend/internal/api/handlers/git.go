@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/services/gitwriter"
+)
+
+// GitHandler handles writing commit messages and changelogs for workspace
+// repositories
+type GitHandler struct {
+	writer *gitwriter.Writer
+}
+
+// NewGitHandler creates a new git handler
+func NewGitHandler(writer *gitwriter.Writer) *GitHandler {
+	return &GitHandler{writer: writer}
+}
+
+// SuggestCommit suggests a conventional commit message for the staged
+// changes of a workspace repository, or its working tree changes when
+// nothing is staged. Nothing is committed.
+func (h *GitHandler) SuggestCommit(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req gitwriter.CommitRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	suggestion, err := h.writer.SuggestCommit(c.UserContext(), userID, req)
+	if err != nil {
+		return gitWriterError(c, err, "failed to suggest commit message")
+	}
+	return c.JSON(suggestion)
+}
+
+// Changelog writes a changelog of the commits between two refs of a
+// workspace repository
+func (h *GitHandler) Changelog(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req gitwriter.ChangelogRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	changelog, err := h.writer.Changelog(c.UserContext(), userID, req)
+	if err != nil {
+		return gitWriterError(c, err, "failed to generate changelog")
+	}
+	return c.JSON(changelog)
+}
+
+// gitWriterError responds to a failed commit message or changelog
+func gitWriterError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, gitwriter.ErrInvalidRequest),
+		errors.Is(err, gitwriter.ErrNotRepository),
+		errors.Is(err, gitwriter.ErrNoChanges),
+		errors.Is(err, gitwriter.ErrNoCommits),
+		errors.Is(err, gitwriter.ErrNoAPIKey):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	log.Printf("Git writer failed: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 
@@ -10,6 +11,8 @@ import (
 	"github.com/jacklau/prism/internal/integrations"
 	"github.com/jacklau/prism/internal/integrations/github"
 	"github.com/jacklau/prism/internal/services/coderunner"
+	"github.com/jacklau/prism/internal/services/prreview"
+	"github.com/jacklau/prism/internal/services/webhookqueue"
 )
 
 // GitHubHandler handles GitHub-related endpoints
@@ -19,6 +22,7 @@ type GitHubHandler struct {
 	codeRunner         *coderunner.Runner
 	defaultSecret      string
 	integrationManager *integrations.Manager
+	deliveryQueue      *webhookqueue.Queue
 }
 
 // NewGitHubHandler creates a new GitHub handler
@@ -27,20 +31,22 @@ func NewGitHubHandler(
 	codeRunner *coderunner.Runner,
 	defaultSecret string,
 	integrationManager *integrations.Manager,
+	deliveryQueue *webhookqueue.Queue,
+	reviewer *prreview.Service,
 ) *GitHubHandler {
-	handler := &GitHubHandler{
+	// Pull request events are only handled when reviews are available
+	var prReviewer github.PullRequestReviewer
+	if reviewer != nil {
+		prReviewer = reviewer
+	}
+	return &GitHubHandler{
 		webhookRepo:        webhookRepo,
-		webhookHandler:     github.NewWebhookHandler(),
+		webhookHandler:     github.NewDefaultWebhookHandler(codeRunner, prReviewer),
 		codeRunner:         codeRunner,
 		defaultSecret:      defaultSecret,
 		integrationManager: integrationManager,
+		deliveryQueue:      deliveryQueue,
 	}
-
-	// Register event processors
-	handler.webhookHandler.RegisterProcessor(github.NewIssueProcessor(codeRunner))
-	handler.webhookHandler.RegisterProcessor(github.NewIssueCommentProcessor(codeRunner))
-
-	return handler
 }
 
 // HandleWebhook handles incoming GitHub webhooks
@@ -126,6 +132,23 @@ func (h *GitHubHandler) HandleWebhook(c *fiber.Ctx) error {
 		})
 	}
 
+	// Deliveries for configured webhooks are persisted and retried on failure
+	if config.ID != "" && h.deliveryQueue != nil {
+		delivery, err := h.deliveryQueue.Enqueue(config, eventType, github.GetEventAction(event), deliveryID, body)
+		if err != nil {
+			log.Printf("Failed to enqueue webhook delivery: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to queue delivery",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message":     "webhook received",
+			"delivery":    deliveryID,
+			"delivery_id": delivery.ID,
+		})
+	}
+
 	// Process the event asynchronously
 	go func() {
 		if err := h.webhookHandler.HandleWebhook(eventType, event, config); err != nil {
@@ -147,29 +170,16 @@ func (h *GitHubHandler) CreateWebhookConfig(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
 	var req struct {
-		RepoFullName    string                    `json:"repo_full_name"`
-		WebhookSecret   string                    `json:"webhook_secret"`
+		RepoFullName    string                    `json:"repo_full_name" validate:"required,max=200"`
+		WebhookSecret   string                    `json:"webhook_secret" validate:"required,max=256"`
 		Events          []string                  `json:"events"`
 		AutoRunEnabled  bool                      `json:"auto_run_enabled"`
 		AutoRunTriggers []github.AutoRunTrigger   `json:"auto_run_triggers"`
+		AutoReview      *github.AutoReviewConfig  `json:"auto_review"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
-	}
-
-	if req.RepoFullName == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "repo_full_name is required",
-		})
-	}
-
-	if req.WebhookSecret == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "webhook_secret is required",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
 	config := &github.WebhookConfig{
@@ -179,6 +189,7 @@ func (h *GitHubHandler) CreateWebhookConfig(c *fiber.Ctx) error {
 		Events:          req.Events,
 		AutoRunEnabled:  req.AutoRunEnabled,
 		AutoRunTriggers: req.AutoRunTriggers,
+		AutoReview:      req.AutoReview,
 	}
 
 	if err := h.webhookRepo.Create(config); err != nil {
@@ -254,12 +265,11 @@ func (h *GitHubHandler) UpdateWebhookConfig(c *fiber.Ctx) error {
 		Events          []string                  `json:"events"`
 		AutoRunEnabled  *bool                     `json:"auto_run_enabled"`
 		AutoRunTriggers []github.AutoRunTrigger   `json:"auto_run_triggers"`
+		AutoReview      *github.AutoReviewConfig  `json:"auto_review"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Update fields
@@ -272,6 +282,9 @@ func (h *GitHubHandler) UpdateWebhookConfig(c *fiber.Ctx) error {
 	if req.AutoRunTriggers != nil {
 		config.AutoRunTriggers = req.AutoRunTriggers
 	}
+	if req.AutoReview != nil {
+		config.AutoReview = req.AutoReview
+	}
 
 	if err := h.webhookRepo.Update(config); err != nil {
 		log.Printf("Failed to update webhook config: %v", err)
@@ -402,15 +415,62 @@ func (h *GitHubHandler) GetWebhookDeliveries(c *fiber.Ctx) error {
 	})
 }
 
+// RedeliverWebhookDelivery reprocesses a failed or dead-lettered delivery
+func (h *GitHubHandler) RedeliverWebhookDelivery(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	configID := c.Params("id")
+	deliveryID := c.Params("deliveryID")
+
+	// Get existing config
+	config, err := h.webhookRepo.GetByID(configID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "webhook configuration not found",
+		})
+	}
+
+	// Verify ownership
+	if config.UserID != userID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "access denied",
+		})
+	}
+
+	if h.deliveryQueue == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "webhook delivery queue not available",
+		})
+	}
+
+	delivery, err := h.webhookRepo.GetDelivery(deliveryID)
+	if err != nil || delivery.WebhookID != configID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "delivery not found",
+		})
+	}
+
+	if err := h.deliveryQueue.Redeliver(delivery); err != nil {
+		if errors.Is(err, webhookqueue.ErrDeliveryInProgress) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		log.Printf("Failed to redeliver webhook delivery: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to redeliver",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(delivery)
+}
+
 // RunCode manually triggers a code execution
 func (h *GitHubHandler) RunCode(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
 	var req github.CodeRunRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Validate command
@@ -1,28 +1,57 @@
 package handlers
 
 import (
+	"errors"
+	"net/mail"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/jacklau/prism/internal/api/middleware"
 	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+	"github.com/jacklau/prism/internal/integrations/discord"
+	"github.com/jacklau/prism/internal/integrations/email"
+	"github.com/jacklau/prism/internal/integrations/slack"
 )
 
 // IntegrationHandler handles integration settings endpoints
 type IntegrationHandler struct {
-	integrationRepo *repository.IntegrationRepository
+	integrationRepo    *repository.IntegrationRepository
+	emailClient        *email.Client
+	integrationManager *integrations.Manager
 }
 
-// NewIntegrationHandler creates a new integration handler
-func NewIntegrationHandler(integrationRepo *repository.IntegrationRepository) *IntegrationHandler {
+// NewIntegrationHandler creates a new integration handler. emailClient may
+// be nil when SMTP is not configured.
+func NewIntegrationHandler(integrationRepo *repository.IntegrationRepository, emailClient *email.Client) *IntegrationHandler {
 	return &IntegrationHandler{
 		integrationRepo: integrationRepo,
+		emailClient:     emailClient,
+	}
+}
+
+// SetIntegrationManager sets the manager whose server-wide providers are
+// tested when a user hasn't configured their own, and whose cached copy of a
+// user's settings is refreshed when they change them
+func (h *IntegrationHandler) SetIntegrationManager(manager *integrations.Manager) {
+	h.integrationManager = manager
+}
+
+// invalidateUser makes the manager pick up a user's changed settings
+func (h *IntegrationHandler) invalidateUser(userID string) {
+	if h.integrationManager != nil {
+		h.integrationManager.InvalidateUser(userID)
 	}
 }
 
 // IntegrationStatusResponse represents the status of all integrations
 type IntegrationStatusResponse struct {
-	Discord IntegrationStatus `json:"discord"`
-	Slack   IntegrationStatus `json:"slack"`
-	PostHog IntegrationStatus `json:"posthog"`
+	Discord    IntegrationStatus `json:"discord"`
+	Slack      IntegrationStatus `json:"slack"`
+	PostHog    IntegrationStatus `json:"posthog"`
+	Email      IntegrationStatus `json:"email"`
+	Linear     IntegrationStatus `json:"linear"`
+	Notion     IntegrationStatus `json:"notion"`
+	Confluence IntegrationStatus `json:"confluence"`
 }
 
 // IntegrationStatus represents the status of a single integration
@@ -32,10 +61,18 @@ type IntegrationStatus struct {
 	ChannelID string `json:"channel_id,omitempty"`
 }
 
+// SetEmailRequest represents a request to set email notification preferences
+type SetEmailRequest struct {
+	Enabled            bool     `json:"enabled"`
+	Address            string   `json:"address,omitempty"`
+	Events             []string `json:"events"`
+	MinDurationSeconds int      `json:"min_duration_seconds" validate:"min=0"`
+}
+
 // SetIntegrationRequest represents a request to set integration settings
 type SetIntegrationRequest struct {
-	WebhookURL string `json:"webhook_url"`
-	ChannelID  string `json:"channel_id,omitempty"`
+	WebhookURL string `json:"webhook_url" validate:"url,max=2048"`
+	ChannelID  string `json:"channel_id,omitempty" validate:"max=200"`
 	Enabled    bool   `json:"enabled"`
 }
 
@@ -56,9 +93,13 @@ func (h *IntegrationHandler) GetStatus(c *fiber.Ctx) error {
 	}
 
 	response := IntegrationStatusResponse{
-		Discord: IntegrationStatus{Enabled: false, Connected: false},
-		Slack:   IntegrationStatus{Enabled: false, Connected: false},
-		PostHog: IntegrationStatus{Enabled: false, Connected: false},
+		Discord:    IntegrationStatus{Enabled: false, Connected: false},
+		Slack:      IntegrationStatus{Enabled: false, Connected: false},
+		PostHog:    IntegrationStatus{Enabled: false, Connected: false},
+		Email:      IntegrationStatus{Enabled: false, Connected: false},
+		Linear:     IntegrationStatus{Enabled: false, Connected: false},
+		Notion:     IntegrationStatus{Enabled: false, Connected: false},
+		Confluence: IntegrationStatus{Enabled: false, Connected: false},
 	}
 
 	if discord, ok := settings["discord"]; ok && discord != nil {
@@ -77,6 +118,51 @@ func (h *IntegrationHandler) GetStatus(c *fiber.Ctx) error {
 		response.PostHog.Connected = posthog.Enabled // PostHog doesn't have webhook
 	}
 
+	emailPrefs, err := h.integrationRepo.GetEmailPreferences(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get integration settings",
+		})
+	}
+	if emailPrefs != nil {
+		response.Email.Enabled = emailPrefs.Enabled
+	}
+	response.Email.Connected = h.emailClient != nil && h.emailClient.Enabled()
+
+	linearSettings, err := h.integrationRepo.GetLinearSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get integration settings",
+		})
+	}
+	if linearSettings != nil {
+		response.Linear.Enabled = linearSettings.Enabled
+		response.Linear.Connected = linearSettings.APIKey != ""
+	}
+
+	// Documentation sources have no enabled flag; they're on while connected
+	notionSettings, err := h.integrationRepo.GetNotionSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get integration settings",
+		})
+	}
+	if notionSettings != nil {
+		response.Notion.Connected = notionSettings.Token != ""
+		response.Notion.Enabled = response.Notion.Connected
+	}
+
+	confluenceSettings, err := h.integrationRepo.GetConfluenceSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get integration settings",
+		})
+	}
+	if confluenceSettings != nil {
+		response.Confluence.Connected = confluenceSettings.Token != ""
+		response.Confluence.Enabled = response.Confluence.Connected
+	}
+
 	return c.JSON(response)
 }
 
@@ -90,10 +176,8 @@ func (h *IntegrationHandler) SetDiscord(c *fiber.Ctx) error {
 	}
 
 	var req SetIntegrationRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Enable if webhook URL is provided
@@ -107,6 +191,7 @@ func (h *IntegrationHandler) SetDiscord(c *fiber.Ctx) error {
 			"error": "failed to save discord settings",
 		})
 	}
+	h.invalidateUser(userID)
 
 	return c.JSON(fiber.Map{
 		"message":   "Discord integration configured successfully",
@@ -129,6 +214,7 @@ func (h *IntegrationHandler) DeleteDiscord(c *fiber.Ctx) error {
 			"error": "failed to delete discord settings",
 		})
 	}
+	h.invalidateUser(userID)
 
 	return c.JSON(fiber.Map{
 		"message": "Discord integration disconnected",
@@ -145,10 +231,8 @@ func (h *IntegrationHandler) SetSlack(c *fiber.Ctx) error {
 	}
 
 	var req SetIntegrationRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Enable if webhook URL is provided
@@ -162,6 +246,7 @@ func (h *IntegrationHandler) SetSlack(c *fiber.Ctx) error {
 			"error": "failed to save slack settings",
 		})
 	}
+	h.invalidateUser(userID)
 
 	return c.JSON(fiber.Map{
 		"message":   "Slack integration configured successfully",
@@ -184,6 +269,7 @@ func (h *IntegrationHandler) DeleteSlack(c *fiber.Ctx) error {
 			"error": "failed to delete slack settings",
 		})
 	}
+	h.invalidateUser(userID)
 
 	return c.JSON(fiber.Map{
 		"message": "Slack integration disconnected",
@@ -200,10 +286,8 @@ func (h *IntegrationHandler) SetPostHog(c *fiber.Ctx) error {
 	}
 
 	var req SetIntegrationRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
 	if err := h.integrationRepo.SetPostHogSettings(userID, req.Enabled); err != nil {
@@ -211,6 +295,7 @@ func (h *IntegrationHandler) SetPostHog(c *fiber.Ctx) error {
 			"error": "failed to save posthog settings",
 		})
 	}
+	h.invalidateUser(userID)
 
 	return c.JSON(fiber.Map{
 		"message":   "PostHog integration configured successfully",
@@ -233,8 +318,226 @@ func (h *IntegrationHandler) DeletePostHog(c *fiber.Ctx) error {
 			"error": "failed to delete posthog settings",
 		})
 	}
+	h.invalidateUser(userID)
 
 	return c.JSON(fiber.Map{
 		"message": "PostHog integration disabled",
 	})
 }
+
+// GetEmail returns the current user's email notification preferences
+func (h *IntegrationHandler) GetEmail(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	prefs, err := h.integrationRepo.GetEmailPreferences(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get email settings",
+		})
+	}
+	if prefs == nil {
+		prefs = &repository.EmailPreferences{Events: email.DefaultEvents}
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled":              prefs.Enabled,
+		"address":              prefs.Address,
+		"events":               prefs.Events,
+		"min_duration_seconds": prefs.MinDurationSeconds,
+		"supported_events":     email.SupportedEvents,
+		"smtp_configured":      h.emailClient != nil && h.emailClient.Enabled(),
+	})
+}
+
+// SetEmail sets email notification preferences
+func (h *IntegrationHandler) SetEmail(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req SetEmailRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if req.Address != "" {
+		addr, err := mail.ParseAddress(req.Address)
+		if err != nil || addr.Name != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid email address",
+			})
+		}
+	}
+
+	events := req.Events
+	if events == nil {
+		events = email.DefaultEvents
+	}
+	for _, event := range events {
+		if !email.IsSupportedEvent(event) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "unsupported event: " + event,
+			})
+		}
+	}
+
+	prefs := &repository.EmailPreferences{
+		UserID:             userID,
+		Enabled:            req.Enabled,
+		Address:            req.Address,
+		Events:             events,
+		MinDurationSeconds: req.MinDurationSeconds,
+	}
+	if err := h.integrationRepo.SetEmailPreferences(prefs); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save email settings",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":   "Email notifications configured successfully",
+		"enabled":   req.Enabled,
+		"connected": h.emailClient != nil && h.emailClient.Enabled(),
+		"events":    events,
+	})
+}
+
+// DeleteEmail removes email notification preferences
+func (h *IntegrationHandler) DeleteEmail(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	if err := h.integrationRepo.DeleteEmailPreferences(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete email settings",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email notifications disabled",
+	})
+}
+
+// TestEmail sends a test email to the current user
+func (h *IntegrationHandler) TestEmail(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	if h.emailClient == nil || !h.emailClient.Enabled() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "email is not configured on this server",
+		})
+	}
+
+	to, err := h.emailClient.SendTest(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to send test email: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Test email sent",
+		"to":      to,
+	})
+}
+
+// TestIntegration sends a test notification or analytics event through an
+// integration and reports the delivery error, if any. Discord and Slack use
+// the user's own webhook when one is saved, and the server's otherwise.
+func (h *IntegrationHandler) TestIntegration(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	name := c.Params("name")
+	event := &integrations.Event{
+		Type:   integrations.EventIntegrationTest,
+		UserID: userID,
+		Data: map[string]interface{}{
+			"message": "This is a test notification from Prism. If you can read it, the " + name + " integration works.",
+		},
+	}
+
+	var err error
+	switch name {
+	case "email":
+		return h.TestEmail(c)
+	case "discord", "slack":
+		var settings *repository.IntegrationSettings
+		if name == "discord" {
+			settings, err = h.integrationRepo.GetDiscordSettings(userID)
+		} else {
+			settings, err = h.integrationRepo.GetSlackSettings(userID)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to get " + name + " settings",
+			})
+		}
+		if settings == nil || settings.WebhookURL == "" {
+			err = h.sendServerTest(name, event)
+			break
+		}
+		if name == "discord" {
+			err = discord.NewClient(&discord.Config{
+				WebhookURL: settings.WebhookURL,
+				Enabled:    true,
+			}).Send(event)
+		} else {
+			err = slack.NewClient(&slack.Config{
+				WebhookURL: settings.WebhookURL,
+				ChannelID:  settings.ChannelID,
+				Enabled:    true,
+			}).Send(event)
+		}
+	case "posthog", "matrix", "mattermost":
+		err = h.sendServerTest(name, event)
+	default:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "unknown integration: " + name,
+		})
+	}
+
+	if errors.Is(err, integrations.ErrProviderNotConfigured) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": name + " is not configured",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to send test notification: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Test notification sent",
+	})
+}
+
+// sendServerTest sends a test event through the server-wide provider
+func (h *IntegrationHandler) sendServerTest(name string, event *integrations.Event) error {
+	if h.integrationManager == nil {
+		return integrations.ErrProviderNotConfigured
+	}
+	return h.integrationManager.SendTest(name, event)
+}
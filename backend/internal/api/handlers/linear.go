@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations/linear"
+	"github.com/jacklau/prism/internal/services/linearbot"
+)
+
+// LinearHandler handles the Linear connection, its automation triggers and
+// the webhook Linear sends issue updates to
+type LinearHandler struct {
+	bot     *linearbot.Bot
+	repo    *repository.IntegrationRepository
+	baseURL string
+}
+
+// NewLinearHandler creates a new Linear handler. baseURL is the server's
+// public URL, used to build each user's webhook URL.
+func NewLinearHandler(bot *linearbot.Bot, repo *repository.IntegrationRepository, baseURL string) *LinearHandler {
+	return &LinearHandler{
+		bot:     bot,
+		repo:    repo,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// SetLinearRequest represents a request to connect Linear or update its
+// settings. Omitted fields are unchanged; the API key is required when
+// connecting.
+type SetLinearRequest struct {
+	APIKey        string           `json:"api_key" validate:"max=200"`
+	WebhookSecret string           `json:"webhook_secret" validate:"max=200"`
+	Provider      *string          `json:"provider"`
+	Model         *string          `json:"model"`
+	Triggers      []linear.Trigger `json:"triggers"`
+	Enabled       *bool            `json:"enabled"`
+}
+
+// LinearSettingsResponse represents Linear settings in API responses. The
+// API key and webhook secret are never returned.
+type LinearSettingsResponse struct {
+	Connected        bool             `json:"connected"`
+	Organization     string           `json:"organization,omitempty"`
+	Enabled          bool             `json:"enabled"`
+	Provider         string           `json:"provider,omitempty"`
+	Model            string           `json:"model,omitempty"`
+	Triggers         []linear.Trigger `json:"triggers"`
+	WebhookURL       string           `json:"webhook_url,omitempty"`
+	WebhookSecretSet bool             `json:"webhook_secret_set"`
+	CreatedAt        *time.Time       `json:"created_at,omitempty"`
+	UpdatedAt        *time.Time       `json:"updated_at,omitempty"`
+}
+
+func (h *LinearHandler) toLinearSettingsResponse(settings *repository.LinearSettings) LinearSettingsResponse {
+	if settings == nil {
+		return LinearSettingsResponse{Triggers: []linear.Trigger{}}
+	}
+	triggers := settings.Triggers
+	if triggers == nil {
+		triggers = []linear.Trigger{}
+	}
+	return LinearSettingsResponse{
+		Connected:        settings.APIKey != "",
+		Organization:     settings.Organization,
+		Enabled:          settings.Enabled,
+		Provider:         settings.Provider,
+		Model:            settings.Model,
+		Triggers:         triggers,
+		WebhookURL:       h.baseURL + "/api/v1/linear/webhook/" + settings.WebhookToken,
+		WebhookSecretSet: settings.WebhookSecret != "",
+		CreatedAt:        &settings.CreatedAt,
+		UpdatedAt:        &settings.UpdatedAt,
+	}
+}
+
+// GetLinear returns the current user's Linear settings
+func (h *LinearHandler) GetLinear(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	settings, err := h.repo.GetLinearSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get linear settings",
+		})
+	}
+
+	return c.JSON(h.toLinearSettingsResponse(settings))
+}
+
+// SetLinear connects Linear with an API key or updates its settings
+func (h *LinearHandler) SetLinear(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req SetLinearRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	settings, err := h.repo.GetLinearSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get linear settings",
+		})
+	}
+	if settings == nil {
+		settings = &repository.LinearSettings{UserID: userID, Enabled: true}
+	}
+
+	if apiKey := strings.TrimSpace(req.APIKey); apiKey != "" {
+		viewer, err := h.bot.CheckKey(apiKey)
+		if errors.Is(err, linear.ErrUnauthorized) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "linear rejected the API key",
+			})
+		}
+		if err != nil {
+			log.Printf("Failed to check Linear API key: %v", err)
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"error": "failed to reach linear",
+			})
+		}
+		settings.APIKey = apiKey
+		settings.Organization = viewer.Organization.Name
+	}
+	if settings.APIKey == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "api_key is required",
+		})
+	}
+
+	if secret := strings.TrimSpace(req.WebhookSecret); secret != "" {
+		settings.WebhookSecret = secret
+	}
+	if req.Provider != nil {
+		settings.Provider = *req.Provider
+	}
+	if req.Model != nil {
+		settings.Model = *req.Model
+	}
+	if (settings.Provider == "") != (settings.Model == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "provider and model must be set together",
+		})
+	}
+	if req.Triggers != nil {
+		if err := linear.ValidateTriggers(req.Triggers); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		settings.Triggers = req.Triggers
+	}
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+
+	if err := h.repo.SetLinearSettings(settings); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save linear settings",
+		})
+	}
+
+	return c.JSON(h.toLinearSettingsResponse(settings))
+}
+
+// DeleteLinear disconnects Linear, removing the API key and triggers
+func (h *LinearHandler) DeleteLinear(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	if err := h.repo.DeleteLinearSettings(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete linear settings",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Linear integration disconnected",
+	})
+}
+
+// HandleWebhook receives Linear issue webhooks. The user is identified by the
+// token in the URL and the request is verified with their webhook secret.
+func (h *LinearHandler) HandleWebhook(c *fiber.Ctx) error {
+	started, err := h.bot.HandleWebhook(c.Params("token"), c.Get("Linear-Signature"), c.Body())
+	switch {
+	case errors.Is(err, linearbot.ErrUnknownWebhook):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "unknown webhook",
+		})
+	case errors.Is(err, linear.ErrInvalidSignature), errors.Is(err, linear.ErrStaleRequest):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, linear.ErrInvalidPayload):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case err != nil:
+		log.Printf("Failed to handle Linear webhook: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to process webhook",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":   "webhook received",
+		"triggered": started,
+	})
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+)
+
+// LLMDebugHandler handles the provider traffic captured for conversations
+// with LLM debugging on
+type LLMDebugHandler struct {
+	conversationRepo *repository.ConversationRepository
+	debugRepo        *repository.LLMDebugRepository
+}
+
+// NewLLMDebugHandler creates a new LLM debug handler
+func NewLLMDebugHandler(conversationRepo *repository.ConversationRepository, debugRepo *repository.LLMDebugRepository) *LLMDebugHandler {
+	return &LLMDebugHandler{conversationRepo: conversationRepo, debugRepo: debugRepo}
+}
+
+// LLMDebugEntryDTO represents one captured provider request and its raw
+// response
+type LLMDebugEntryDTO struct {
+	ID             string            `json:"id"`
+	Provider       string            `json:"provider"`
+	Model          string            `json:"model"`
+	Method         string            `json:"method"`
+	URL            string            `json:"url"`
+	StatusCode     int               `json:"status_code"` // 0 if the request failed before a response
+	Error          string            `json:"error,omitempty"`
+	DurationMs     int64             `json:"duration_ms"`
+	RequestHeaders map[string]string `json:"request_headers"`
+	RequestBody    string            `json:"request_body"`
+	ResponseChunks []string          `json:"response_chunks"` // The response body in the pieces it arrived in
+	Truncated      bool              `json:"truncated,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// GetEntries returns whether a conversation has LLM debugging on and its
+// captured requests, newest first. Captured requests hold the whole prompt,
+// so only the owner may see them.
+func (h *LLMDebugHandler) GetEntries(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 || limit > 200 {
+		limit = 20
+	}
+	entries, err := h.debugRepo.ListByConversation(conv.ID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get LLM debug entries",
+		})
+	}
+
+	dtos := make([]LLMDebugEntryDTO, len(entries))
+	for i, entry := range entries {
+		dtos[i] = LLMDebugEntryDTO{
+			ID:             entry.ID,
+			Provider:       entry.Provider,
+			Model:          entry.Model,
+			Method:         entry.Method,
+			URL:            entry.URL,
+			StatusCode:     entry.StatusCode,
+			Error:          entry.Error,
+			DurationMs:     entry.Duration.Milliseconds(),
+			RequestHeaders: entry.RequestHeaders,
+			RequestBody:    entry.RequestBody,
+			ResponseChunks: entry.ResponseChunks,
+			Truncated:      entry.Truncated,
+			CreatedAt:      entry.CreatedAt,
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled": conv.LLMDebug,
+		"entries": dtos,
+	})
+}
+
+// ClearEntries deletes a conversation's captured requests
+func (h *LLMDebugHandler) ClearEntries(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := h.debugRepo.DeleteByConversation(conv.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete LLM debug entries",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "LLM debug entries deleted",
+	})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/services/modelinfo"
+)
+
+// ModelInfoHandler handles model capability endpoints
+type ModelInfoHandler struct {
+	modelInfo *modelinfo.Service
+}
+
+// NewModelInfoHandler creates a new model info handler
+func NewModelInfoHandler(modelInfo *modelinfo.Service) *ModelInfoHandler {
+	return &ModelInfoHandler{modelInfo: modelInfo}
+}
+
+// ModelOverrideDTO represents a local model override. Omitted fields keep
+// the provider's value.
+type ModelOverrideDTO struct {
+	Provider              string     `json:"provider"`
+	Model                 string     `json:"model"`
+	SupportsTools         *bool      `json:"supports_tools,omitempty"`
+	SupportsVision        *bool      `json:"supports_vision,omitempty"`
+	SupportsJSONMode      *bool      `json:"supports_json_mode,omitempty"`
+	ContextWindow         *int       `json:"context_window,omitempty"`
+	MaxOutputTokens       *int       `json:"max_output_tokens,omitempty"`
+	InputPricePerMillion  *float64   `json:"input_price_per_million,omitempty"`
+	OutputPricePerMillion *float64   `json:"output_price_per_million,omitempty"`
+	UpdatedAt             *time.Time `json:"updated_at,omitempty"`
+}
+
+// GetCapabilities returns what a model supports, so clients can enable
+// features per model
+func (h *ModelInfoHandler) GetCapabilities(c *fiber.Ctx) error {
+	model := modelNameParam(c)
+	if model == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "model is required",
+		})
+	}
+
+	caps, err := h.modelInfo.Get(c.Params("provider"), model)
+	if errors.Is(err, modelinfo.ErrProviderNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "unknown provider: " + c.Params("provider"),
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to get model capabilities: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get model capabilities",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"capabilities": caps,
+	})
+}
+
+// ListOverrides lists the local model overrides
+func (h *ModelInfoHandler) ListOverrides(c *fiber.Ctx) error {
+	overrides, err := h.modelInfo.ListOverrides()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list model overrides",
+		})
+	}
+
+	dtos := make([]ModelOverrideDTO, len(overrides))
+	for i, override := range overrides {
+		dtos[i] = toModelOverrideDTO(override)
+	}
+
+	return c.JSON(fiber.Map{
+		"overrides": dtos,
+	})
+}
+
+// SetOverride replaces a model's local override
+func (h *ModelInfoHandler) SetOverride(c *fiber.Ctx) error {
+	model := modelNameParam(c)
+	if model == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "model is required",
+		})
+	}
+
+	var req ModelOverrideDTO
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	for _, n := range []*int{req.ContextWindow, req.MaxOutputTokens} {
+		if n != nil && *n < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "token limits must not be negative",
+			})
+		}
+	}
+	for _, p := range []*float64{req.InputPricePerMillion, req.OutputPricePerMillion} {
+		if p != nil && *p < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "prices must not be negative",
+			})
+		}
+	}
+
+	override := &repository.ModelOverride{
+		Provider:              c.Params("provider"),
+		Model:                 model,
+		SupportsTools:         req.SupportsTools,
+		SupportsVision:        req.SupportsVision,
+		SupportsJSONMode:      req.SupportsJSONMode,
+		ContextWindow:         req.ContextWindow,
+		MaxOutputTokens:       req.MaxOutputTokens,
+		InputPricePerMillion:  req.InputPricePerMillion,
+		OutputPricePerMillion: req.OutputPricePerMillion,
+	}
+	err := h.modelInfo.SetOverride(override)
+	if errors.Is(err, modelinfo.ErrProviderNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "unknown provider: " + override.Provider,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to save model override: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save model override",
+		})
+	}
+
+	return c.JSON(toModelOverrideDTO(override))
+}
+
+// DeleteOverride removes a model's local override
+func (h *ModelInfoHandler) DeleteOverride(c *fiber.Ctx) error {
+	model := modelNameParam(c)
+	if model == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "model is required",
+		})
+	}
+
+	if err := h.modelInfo.DeleteOverride(c.Params("provider"), model); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete model override",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "model override deleted",
+	})
+}
+
+func toModelOverrideDTO(override *repository.ModelOverride) ModelOverrideDTO {
+	updatedAt := override.UpdatedAt
+	return ModelOverrideDTO{
+		Provider:              override.Provider,
+		Model:                 override.Model,
+		SupportsTools:         override.SupportsTools,
+		SupportsVision:        override.SupportsVision,
+		SupportsJSONMode:      override.SupportsJSONMode,
+		ContextWindow:         override.ContextWindow,
+		MaxOutputTokens:       override.MaxOutputTokens,
+		InputPricePerMillion:  override.InputPricePerMillion,
+		OutputPricePerMillion: override.OutputPricePerMillion,
+		UpdatedAt:             &updatedAt,
+	}
+}
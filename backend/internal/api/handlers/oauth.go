@@ -388,37 +388,10 @@ type GitHubRepo struct {
 
 // decryptGitHubToken decrypts a GitHub token stored as "nonce_hex:ciphertext_hex"
 func (h *OAuthHandler) decryptGitHubToken(encryptedToken string) (string, error) {
-	// Split into nonce and ciphertext
-	parts := make([]string, 2)
-	colonIdx := -1
-	for i, c := range encryptedToken {
-		if c == ':' {
-			colonIdx = i
-			break
-		}
-	}
-	if colonIdx == -1 {
-		return "", fmt.Errorf("invalid encrypted token format")
-	}
-	parts[0] = encryptedToken[:colonIdx]
-	parts[1] = encryptedToken[colonIdx+1:]
-
-	// Decode hex
-	nonce, err := hex.DecodeString(parts[0])
-	if err != nil {
-		return "", fmt.Errorf("failed to decode nonce: %w", err)
-	}
-	ciphertext, err := hex.DecodeString(parts[1])
+	plaintext, err := h.encryptionSvc.DecryptHex(encryptedToken)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
-	}
-
-	// Decrypt
-	plaintext, err := h.encryptionSvc.Decrypt(ciphertext, nonce)
-	if err != nil {
-		return "", fmt.Errorf("failed to decrypt: %w", err)
+		return "", err
 	}
-
 	return string(plaintext), nil
 }
 
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/llm/ollama"
+	"github.com/jacklau/prism/internal/services/modelinfo"
+)
+
+// pullProgressInterval limits how often download progress is pushed to the client
+const pullProgressInterval = 500 * time.Millisecond
+
+// OllamaPullEvent reports the state of a model pull
+type OllamaPullEvent struct {
+	PullID    string `json:"pull_id"`
+	Model     string `json:"model"`
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Done      bool   `json:"done"`
+	Error     string `json:"error,omitempty"`
+}
+
+// OllamaHandler handles local model management for the Ollama provider
+type OllamaHandler struct {
+	client     *ollama.Client
+	llmManager *llm.Manager
+	modelInfo  *modelinfo.Service // Optional
+	onPull     func(userID string, event OllamaPullEvent)
+
+	// Active pulls by model name, so the same model isn't downloaded twice
+	pulls   map[string]string
+	pullsMu sync.Mutex
+}
+
+// NewOllamaHandler creates a new Ollama handler. onPull, if set, receives
+// progress for pulls started by a user so it can be streamed to them.
+func NewOllamaHandler(client *ollama.Client, llmManager *llm.Manager, modelInfo *modelinfo.Service, onPull func(userID string, event OllamaPullEvent)) *OllamaHandler {
+	return &OllamaHandler{
+		client:     client,
+		llmManager: llmManager,
+		modelInfo:  modelInfo,
+		onPull:     onPull,
+		pulls:      make(map[string]string),
+	}
+}
+
+// PullModelRequest represents a request to download a model
+type PullModelRequest struct {
+	Name string `json:"name" validate:"required,max=200"`
+}
+
+// ListModels returns the models installed in Ollama
+func (h *OllamaHandler) ListModels(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	models, err := h.client.ListLocalModels(c.Context())
+	if err != nil {
+		log.Printf("Failed to list Ollama models: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to list Ollama models",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"models": models,
+		"pulls":  h.activePulls(),
+	})
+}
+
+// GetModel returns details for an installed model
+func (h *OllamaHandler) GetModel(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	name := modelNameParam(c)
+	if name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "model name is required",
+		})
+	}
+
+	info, err := h.client.ShowModel(c.Context(), name)
+	if errors.Is(err, ollama.ErrModelNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "model not found",
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to show Ollama model %s: %v", name, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to get model details",
+		})
+	}
+
+	response := fiber.Map{
+		"name":  name,
+		"model": info,
+	}
+	// Same capability details as other providers' models
+	if h.modelInfo != nil {
+		if caps, err := h.modelInfo.Get(h.client.Name(), name); err == nil {
+			response["capabilities"] = caps
+		}
+	}
+	return c.JSON(response)
+}
+
+// DeleteModel removes an installed model
+func (h *OllamaHandler) DeleteModel(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	name := modelNameParam(c)
+	if name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "model name is required",
+		})
+	}
+
+	err := h.client.DeleteModel(c.Context(), name)
+	if errors.Is(err, ollama.ErrModelNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "model not found",
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to delete Ollama model %s: %v", name, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to delete model",
+		})
+	}
+	h.refreshCatalog()
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "model deleted successfully",
+	})
+}
+
+// PullModel starts downloading a model in the background. Progress is
+// streamed to the requesting user over the websocket.
+func (h *OllamaHandler) PullModel(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req PullModelRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(req.Name)
+
+	h.pullsMu.Lock()
+	if pullID, ok := h.pulls[name]; ok {
+		h.pullsMu.Unlock()
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   "model is already being pulled",
+			"pull_id": pullID,
+		})
+	}
+	pullID := uuid.New().String()
+	h.pulls[name] = pullID
+	h.pullsMu.Unlock()
+
+	go h.runPull(userID, pullID, name)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"pull_id": pullID,
+		"model":   name,
+		"status":  "started",
+	})
+}
+
+// runPull downloads a model and reports progress until it finishes
+func (h *OllamaHandler) runPull(userID, pullID, name string) {
+	defer func() {
+		h.pullsMu.Lock()
+		delete(h.pulls, name)
+		h.pullsMu.Unlock()
+	}()
+
+	var lastStatus string
+	var lastSent time.Time
+	err := h.client.PullModel(context.Background(), name, func(progress ollama.PullProgress) {
+		// Always report status changes, but throttle byte-level progress
+		if progress.Status == lastStatus && time.Since(lastSent) < pullProgressInterval {
+			return
+		}
+		lastStatus = progress.Status
+		lastSent = time.Now()
+
+		h.notify(userID, OllamaPullEvent{
+			PullID:    pullID,
+			Model:     name,
+			Status:    progress.Status,
+			Digest:    progress.Digest,
+			Total:     progress.Total,
+			Completed: progress.Completed,
+		})
+	})
+
+	event := OllamaPullEvent{
+		PullID: pullID,
+		Model:  name,
+		Status: "success",
+		Done:   true,
+	}
+	if err != nil {
+		log.Printf("Failed to pull Ollama model %s: %v", name, err)
+		event.Status = "failed"
+		event.Error = err.Error()
+	} else {
+		h.refreshCatalog()
+	}
+	h.notify(userID, event)
+}
+
+// refreshCatalog updates the cached Ollama model list after a model is
+// pulled or deleted, so provider listings show the change straight away
+func (h *OllamaHandler) refreshCatalog() {
+	if _, err := h.llmManager.RefreshModels(context.Background(), h.client.Name()); err != nil {
+		log.Printf("Failed to refresh Ollama models: %v", err)
+	}
+}
+
+// notify delivers a pull event if a callback is configured
+func (h *OllamaHandler) notify(userID string, event OllamaPullEvent) {
+	if h.onPull != nil {
+		h.onPull(userID, event)
+	}
+}
+
+// activePulls returns the models currently being pulled
+func (h *OllamaHandler) activePulls() map[string]string {
+	h.pullsMu.Lock()
+	defer h.pullsMu.Unlock()
+
+	pulls := make(map[string]string, len(h.pulls))
+	for name, pullID := range h.pulls {
+		pulls[name] = pullID
+	}
+	return pulls
+}
+
+// modelNameParam reads the model name from the wildcard route parameter.
+// Model names may contain "/" and ":" (e.g. "library/llama3:8b").
+func modelNameParam(c *fiber.Ctx) string {
+	name, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(name)
+}
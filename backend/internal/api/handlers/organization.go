@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/security"
+)
+
+// OrganizationHandler handles organization endpoints: membership and the
+// provider keys admins share with members
+type OrganizationHandler struct {
+	orgRepo           *repository.OrganizationRepository
+	userRepo          *repository.UserRepository
+	encryptionService *security.EncryptionService
+	llmManager        *llm.Manager
+}
+
+// NewOrganizationHandler creates a new organization handler
+func NewOrganizationHandler(
+	orgRepo *repository.OrganizationRepository,
+	userRepo *repository.UserRepository,
+	encryptionService *security.EncryptionService,
+	llmManager *llm.Manager,
+) *OrganizationHandler {
+	return &OrganizationHandler{
+		orgRepo:           orgRepo,
+		userRepo:          userRepo,
+		encryptionService: encryptionService,
+		llmManager:        llmManager,
+	}
+}
+
+// OrganizationDTO represents an organization response
+type OrganizationDTO struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role,omitempty"` // The current user's role
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrganizationMemberDTO represents an organization member response
+type OrganizationMemberDTO struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrganizationKeyDTO represents a shared provider key (without the key)
+type OrganizationKeyDTO struct {
+	Provider  string    `json:"provider"`
+	BaseURL   string    `json:"base_url,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateOrganizationRequest represents a request to create an organization
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// AddOrganizationMemberRequest represents a request to add a member
+type AddOrganizationMemberRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"oneof=admin member"` // Defaults to member
+}
+
+// CreateOrganization creates an organization with the current user as admin
+func (h *OrganizationHandler) CreateOrganization(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req CreateOrganizationRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name is required",
+		})
+	}
+
+	org, err := h.orgRepo.Create(name, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create organization",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(toOrganizationDTO(org))
+}
+
+// ListOrganizations lists the organizations the current user belongs to
+func (h *OrganizationHandler) ListOrganizations(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	orgs, err := h.orgRepo.ListForUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list organizations",
+		})
+	}
+
+	dtos := make([]OrganizationDTO, len(orgs))
+	for i, org := range orgs {
+		dtos[i] = toOrganizationDTO(org)
+	}
+
+	return c.JSON(fiber.Map{
+		"organizations": dtos,
+	})
+}
+
+// GetOrganization returns an organization with its members and the
+// providers it shares keys for
+func (h *OrganizationHandler) GetOrganization(c *fiber.Ctx) error {
+	org, member, status, msg := h.getMembership(c, false)
+	if org == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	members, err := h.orgRepo.ListMembers(org.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list members",
+		})
+	}
+
+	keys, err := h.orgRepo.ListKeys(org.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list shared keys",
+		})
+	}
+
+	org.Role = member.Role
+	memberDTOs := make([]OrganizationMemberDTO, len(members))
+	for i, m := range members {
+		memberDTOs[i] = toOrganizationMemberDTO(m)
+	}
+	keyDTOs := make([]OrganizationKeyDTO, len(keys))
+	for i, key := range keys {
+		keyDTOs[i] = OrganizationKeyDTO{Provider: key.Provider, BaseURL: key.BaseURL, CreatedAt: key.CreatedAt}
+	}
+
+	return c.JSON(fiber.Map{
+		"organization": toOrganizationDTO(org),
+		"members":      memberDTOs,
+		"keys":         keyDTOs,
+	})
+}
+
+// DeleteOrganization deletes an organization, its shared keys and its usage
+// records
+func (h *OrganizationHandler) DeleteOrganization(c *fiber.Ctx) error {
+	org, _, status, msg := h.getMembership(c, true)
+	if org == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := h.orgRepo.Delete(org.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete organization",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "organization deleted",
+	})
+}
+
+// AddMember adds an existing user to an organization by email, or changes
+// their role if they already belong to it
+func (h *OrganizationHandler) AddMember(c *fiber.Ctx) error {
+	org, _, status, msg := h.getMembership(c, true)
+	if org == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	var req AddOrganizationMemberRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if req.Role == "" {
+		req.Role = repository.OrgRoleMember
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	target, err := h.userRepo.GetByEmail(email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to look up user",
+		})
+	}
+	if target == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "user not found",
+		})
+	}
+	if target.IsGuest {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "guest users cannot join organizations",
+		})
+	}
+
+	if req.Role != repository.OrgRoleAdmin {
+		if status, msg := h.checkNotLastAdmin(org.ID, target.ID); status != 0 {
+			return c.Status(status).JSON(fiber.Map{
+				"error": msg,
+			})
+		}
+	}
+
+	member, err := h.orgRepo.UpsertMember(org.ID, target.ID, req.Role)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to add member",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(toOrganizationMemberDTO(member))
+}
+
+// RemoveMember removes a user from an organization. Admins can remove
+// anyone; a member can remove themselves. The last admin can't leave.
+func (h *OrganizationHandler) RemoveMember(c *fiber.Ctx) error {
+	targetID := c.Params("userId")
+
+	org, member, status, msg := h.getMembership(c, false)
+	if org == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if member.Role != repository.OrgRoleAdmin && targetID != member.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "access denied",
+		})
+	}
+
+	if status, msg := h.checkNotLastAdmin(org.ID, targetID); status != 0 {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := h.orgRepo.RemoveMember(org.ID, targetID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to remove member",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "member removed",
+	})
+}
+
+// SetKey stores an encrypted provider key that members use when they don't
+// have their own
+func (h *OrganizationHandler) SetKey(c *fiber.Ctx) error {
+	org, member, status, msg := h.getMembership(c, true)
+	if org == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	provider := c.Params("provider")
+	if _, err := h.llmManager.GetProvider(provider); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "unknown provider: " + provider,
+		})
+	}
+
+	var req SetKeyRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if req.BaseURL != "" && !h.llmManager.SupportsBaseURL(provider) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "provider does not support a custom base URL: " + provider,
+		})
+	}
+
+	encryptedKey, nonce, err := h.encryptionService.Encrypt([]byte(req.APIKey))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to encrypt API key",
+		})
+	}
+
+	if err := h.orgRepo.SetKey(org.ID, provider, encryptedKey, nonce, req.BaseURL, member.UserID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save API key",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "shared API key saved successfully",
+	})
+}
+
+// DeleteKey removes an organization's shared key for a provider
+func (h *OrganizationHandler) DeleteKey(c *fiber.Ctx) error {
+	org, _, status, msg := h.getMembership(c, true)
+	if org == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := h.orgRepo.DeleteKey(org.ID, c.Params("provider")); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete API key",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "shared API key deleted successfully",
+	})
+}
+
+// GetUsage reports each member's use of the organization's shared keys over
+// a time window, given by the window query parameter (24h, 7d, 30d, 90d or
+// all)
+func (h *OrganizationHandler) GetUsage(c *fiber.Ctx) error {
+	org, _, status, msg := h.getMembership(c, true)
+	if org == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	window := c.Query("window", defaultStatsWindow)
+	duration, ok := statsWindows[window]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "window must be one of 24h, 7d, 30d, 90d or all",
+		})
+	}
+
+	var since time.Time
+	if duration > 0 {
+		since = time.Now().Add(-duration)
+	}
+
+	usage, err := h.orgRepo.Usage(org.ID, since)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get usage",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"window": window,
+		"usage":  usage,
+	})
+}
+
+// getMembership loads the organization in the route and the current user's
+// membership in it, requiring the admin role if requireAdmin is set. On
+// failure it returns a nil organization with the HTTP status and error
+// message.
+func (h *OrganizationHandler) getMembership(c *fiber.Ctx, requireAdmin bool) (*repository.Organization, *repository.OrganizationMember, int, string) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return nil, nil, fiber.StatusUnauthorized, "unauthorized"
+	}
+
+	org, err := h.orgRepo.GetByID(c.Params("id"))
+	if err != nil {
+		return nil, nil, fiber.StatusInternalServerError, "failed to get organization"
+	}
+
+	var member *repository.OrganizationMember
+	if org != nil {
+		member, err = h.orgRepo.GetMember(org.ID, userID)
+		if err != nil {
+			return nil, nil, fiber.StatusInternalServerError, "failed to get organization"
+		}
+	}
+	// Non-members can't tell whether an organization exists
+	if org == nil || member == nil {
+		return nil, nil, fiber.StatusNotFound, "organization not found"
+	}
+	if requireAdmin && member.Role != repository.OrgRoleAdmin {
+		return nil, nil, fiber.StatusForbidden, "organization admin required"
+	}
+
+	return org, member, 0, ""
+}
+
+// checkNotLastAdmin refuses to demote or remove an organization's only
+// admin, which would leave nobody able to manage it. Returns a zero status
+// if the change is allowed.
+func (h *OrganizationHandler) checkNotLastAdmin(orgID, userID string) (int, string) {
+	member, err := h.orgRepo.GetMember(orgID, userID)
+	if err != nil {
+		return fiber.StatusInternalServerError, "failed to get organization member"
+	}
+	if member == nil || member.Role != repository.OrgRoleAdmin {
+		return 0, ""
+	}
+
+	admins, err := h.orgRepo.CountAdmins(orgID)
+	if err != nil {
+		return fiber.StatusInternalServerError, "failed to get organization member"
+	}
+	if admins <= 1 {
+		return fiber.StatusConflict, "an organization needs at least one admin; delete it instead"
+	}
+	return 0, ""
+}
+
+func toOrganizationDTO(org *repository.Organization) OrganizationDTO {
+	return OrganizationDTO{
+		ID:        org.ID,
+		Name:      org.Name,
+		Role:      org.Role,
+		CreatedAt: org.CreatedAt,
+	}
+}
+
+func toOrganizationMemberDTO(member *repository.OrganizationMember) OrganizationMemberDTO {
+	return OrganizationMemberDTO{
+		UserID:    member.UserID,
+		Email:     member.Email,
+		Role:      member.Role,
+		CreatedAt: member.CreatedAt,
+	}
+}
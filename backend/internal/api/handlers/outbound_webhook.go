@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+	"github.com/jacklau/prism/internal/integrations/webhooks"
+)
+
+// OutboundWebhookHandler handles outbound webhook endpoints
+type OutboundWebhookHandler struct {
+	repo       *repository.OutboundWebhookRepository
+	dispatcher *webhooks.Dispatcher
+}
+
+// NewOutboundWebhookHandler creates a new outbound webhook handler
+func NewOutboundWebhookHandler(repo *repository.OutboundWebhookRepository, dispatcher *webhooks.Dispatcher) *OutboundWebhookHandler {
+	return &OutboundWebhookHandler{
+		repo:       repo,
+		dispatcher: dispatcher,
+	}
+}
+
+// OutboundWebhookRequest represents a request to create or update an outbound webhook
+type OutboundWebhookRequest struct {
+	URL     *string  `json:"url" validate:"url,max=2048"`
+	Secret  *string  `json:"secret" validate:"max=256"`
+	Events  []string `json:"events" validate:"max=50"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// OutboundWebhookResponse represents an outbound webhook in API responses.
+// The secret is never returned.
+type OutboundWebhookResponse struct {
+	ID             string     `json:"id"`
+	URL            string     `json:"url"`
+	Events         []string   `json:"events"`
+	Enabled        bool       `json:"enabled"`
+	HasSecret      bool       `json:"has_secret"`
+	LastDeliveryAt *time.Time `json:"last_delivery_at,omitempty"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func toOutboundWebhookResponse(webhook *repository.OutboundWebhook) OutboundWebhookResponse {
+	return OutboundWebhookResponse{
+		ID:             webhook.ID,
+		URL:            webhook.URL,
+		Events:         webhook.Events,
+		Enabled:        webhook.Enabled,
+		HasSecret:      webhook.Secret != "",
+		LastDeliveryAt: webhook.LastDeliveryAt,
+		LastStatusCode: webhook.LastStatusCode,
+		LastError:      webhook.LastError,
+		CreatedAt:      webhook.CreatedAt,
+		UpdatedAt:      webhook.UpdatedAt,
+	}
+}
+
+// ListOutboundWebhooks returns the current user's outbound webhooks
+func (h *OutboundWebhookHandler) ListOutboundWebhooks(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	list, err := h.repo.ListByUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list webhooks",
+		})
+	}
+
+	response := make([]OutboundWebhookResponse, 0, len(list))
+	for _, webhook := range list {
+		response = append(response, toOutboundWebhookResponse(webhook))
+	}
+
+	return c.JSON(fiber.Map{
+		"webhooks":         response,
+		"supported_events": webhooks.SupportedEvents,
+	})
+}
+
+// CreateOutboundWebhook registers a new outbound webhook
+func (h *OutboundWebhookHandler) CreateOutboundWebhook(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req OutboundWebhookRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if req.URL == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "url is required",
+		})
+	}
+	if len(req.Events) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "at least one event is required",
+		})
+	}
+
+	webhook := &repository.OutboundWebhook{
+		UserID:  userID,
+		Enabled: true,
+	}
+	if msg := applyOutboundWebhookRequest(webhook, &req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := h.repo.Create(webhook); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create webhook",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(toOutboundWebhookResponse(webhook))
+}
+
+// UpdateOutboundWebhook updates an outbound webhook. Omitted fields are unchanged.
+func (h *OutboundWebhookHandler) UpdateOutboundWebhook(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	webhook, err := h.repo.GetByID(c.Params("id"), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get webhook",
+		})
+	}
+	if webhook == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "webhook not found",
+		})
+	}
+
+	var req OutboundWebhookRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+	if req.Events != nil && len(req.Events) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "at least one event is required",
+		})
+	}
+	if msg := applyOutboundWebhookRequest(webhook, &req); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := h.repo.Update(webhook); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update webhook",
+		})
+	}
+
+	return c.JSON(toOutboundWebhookResponse(webhook))
+}
+
+// DeleteOutboundWebhook removes an outbound webhook
+func (h *OutboundWebhookHandler) DeleteOutboundWebhook(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	deleted, err := h.repo.Delete(c.Params("id"), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete webhook",
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "webhook not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Webhook deleted",
+	})
+}
+
+// TestOutboundWebhook sends a ping event to an outbound webhook and reports
+// the result
+func (h *OutboundWebhookHandler) TestOutboundWebhook(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	webhook, err := h.repo.GetByID(c.Params("id"), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get webhook",
+		})
+	}
+	if webhook == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "webhook not found",
+		})
+	}
+
+	result := h.dispatcher.Deliver(webhook, &integrations.Event{
+		Type:   webhooks.EventPing,
+		UserID: userID,
+		Data: map[string]interface{}{
+			"webhook_id": webhook.ID,
+		},
+	})
+
+	return c.JSON(fiber.Map{
+		"success": result.Error == "",
+		"result":  result,
+	})
+}
+
+// applyOutboundWebhookRequest copies the fields set in a request onto a
+// webhook, returning a validation message if any are invalid
+func applyOutboundWebhookRequest(webhook *repository.OutboundWebhook, req *OutboundWebhookRequest) string {
+	if req.URL != nil {
+		webhook.URL = *req.URL
+	}
+
+	if req.Events != nil {
+		seen := make(map[string]bool)
+		events := make([]string, 0, len(req.Events))
+		for _, event := range req.Events {
+			if !webhooks.IsSupportedEvent(event) {
+				return "unsupported event: " + event
+			}
+			if !seen[event] {
+				seen[event] = true
+				events = append(events, event)
+			}
+		}
+		webhook.Events = events
+	}
+
+	if req.Secret != nil {
+		webhook.Secret = *req.Secret
+	}
+	if req.Enabled != nil {
+		webhook.Enabled = *req.Enabled
+	}
+	return ""
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/sandbox"
+)
+
+// PinnedFileHandler handles pinning workspace files to a conversation
+type PinnedFileHandler struct {
+	conversationRepo *repository.ConversationRepository
+	pinnedFileRepo   *repository.PinnedFileRepository
+	sandboxService   *sandbox.Service
+	maxPinned        int
+}
+
+// NewPinnedFileHandler creates a new pinned file handler
+func NewPinnedFileHandler(
+	conversationRepo *repository.ConversationRepository,
+	pinnedFileRepo *repository.PinnedFileRepository,
+	sandboxService *sandbox.Service,
+	maxPinned int,
+) *PinnedFileHandler {
+	return &PinnedFileHandler{
+		conversationRepo: conversationRepo,
+		pinnedFileRepo:   pinnedFileRepo,
+		sandboxService:   sandboxService,
+		maxPinned:        maxPinned,
+	}
+}
+
+// PinFileRequest represents a request to pin a workspace file
+type PinFileRequest struct {
+	Path string `json:"path" validate:"required,max=4096"`
+}
+
+// PinnedFileDTO represents a pinned file response
+type PinnedFileDTO struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Exists    bool      `json:"exists"`
+	Size      int       `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListPinnedFiles returns the files pinned to a conversation
+func (h *PinnedFileHandler) ListPinnedFiles(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	files, err := h.pinnedFileRepo.ListByConversationID(conv.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list pinned files",
+		})
+	}
+
+	dtos := make([]PinnedFileDTO, 0, len(files))
+	for _, file := range files {
+		dtos = append(dtos, h.toPinnedFileDTO(file))
+	}
+
+	return c.JSON(fiber.Map{
+		"pinned_files": dtos,
+	})
+}
+
+// PinFile pins a workspace file to a conversation
+func (h *PinnedFileHandler) PinFile(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	var req PinFileRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	path := normalizePinnedPath(req.Path)
+	if path == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "path is required",
+		})
+	}
+
+	// The file must exist and be readable from the user's workspace
+	if _, err := h.sandboxService.GetFileContent(userID, path); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "file not found in workspace",
+		})
+	}
+
+	existing, err := h.pinnedFileRepo.GetByPath(conv.ID, path)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to pin file",
+		})
+	}
+	if existing == nil && h.maxPinned > 0 {
+		count, err := h.pinnedFileRepo.Count(conv.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to pin file",
+			})
+		}
+		if count >= h.maxPinned {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "too many pinned files for this conversation",
+			})
+		}
+	}
+
+	file, err := h.pinnedFileRepo.Pin(conv.ID, userID, path)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to pin file",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(h.toPinnedFileDTO(file))
+}
+
+// UnpinFile removes a pinned file from a conversation
+func (h *PinnedFileHandler) UnpinFile(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	removed, err := h.pinnedFileRepo.Unpin(conv.ID, c.Params("fileId"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to unpin file",
+		})
+	}
+	if !removed {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "pinned file not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "file unpinned successfully",
+	})
+}
+
+// toPinnedFileDTO converts a pinned file to its response form, including
+// whether the file is still present in the workspace
+func (h *PinnedFileHandler) toPinnedFileDTO(file *repository.PinnedFile) PinnedFileDTO {
+	dto := PinnedFileDTO{
+		ID:        file.ID,
+		Path:      file.Path,
+		CreatedAt: file.CreatedAt,
+	}
+	if content, err := h.sandboxService.GetFileContent(file.UserID, file.Path); err == nil {
+		dto.Exists = true
+		dto.Size = len(content)
+	}
+	return dto
+}
+
+// normalizePinnedPath cleans a workspace-relative path so the same file is
+// always stored under the same key
+func normalizePinnedPath(path string) string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return ""
+	}
+	path = filepath.ToSlash(filepath.Clean(path))
+	path = strings.TrimPrefix(path, "/")
+	if path == "." {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/agent"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/integrations/github"
+	"github.com/jacklau/prism/internal/services/prreview"
+)
+
+// PRReviewHandler handles agent reviews of GitHub pull requests
+type PRReviewHandler struct {
+	reviewer *prreview.Service
+}
+
+// NewPRReviewHandler creates a new pull request review handler
+func NewPRReviewHandler(reviewer *prreview.Service) *PRReviewHandler {
+	return &PRReviewHandler{reviewer: reviewer}
+}
+
+// ReviewPullRequest reviews a pull request, given by its URL, with a reviewer
+// agent per changed file and returns the aggregated findings. With post, the
+// findings are also posted to the pull request as a review through the
+// user's connected GitHub account. The request returns once every file has
+// been reviewed, which can take minutes for large pull requests.
+func (h *PRReviewHandler) ReviewPullRequest(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req prreview.Request
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	result, err := h.reviewer.Review(userID, req)
+	if err != nil {
+		return reviewError(c, err)
+	}
+	return c.JSON(result)
+}
+
+// reviewError responds to a failed review
+func reviewError(c *fiber.Ctx, err error) error {
+	var apiErr *github.APIError
+	switch {
+	case errors.Is(err, github.ErrInvalidPullRequestURL),
+		errors.Is(err, prreview.ErrNoReviewableFiles),
+		errors.Is(err, prreview.ErrNoAPIKey),
+		errors.Is(err, prreview.ErrGitHubNotConnected),
+		errors.Is(err, agent.ErrInvalidAgentConfig):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.As(err, &apiErr) && apiErr.StatusCode == fiber.StatusNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "pull request not found; connect GitHub to review private repositories",
+		})
+	case errors.As(err, &apiErr):
+		log.Printf("GitHub API error during pull request review: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": apiErr.Error(),
+		})
+	}
+
+	log.Printf("Pull request review failed: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "failed to review pull request",
+	})
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+)
+
+// maxUIHintsSize limits the stored size of a user's UI hints
+const maxUIHintsSize = 16 * 1024
+
+// PreferencesHandler handles user preferences endpoints
+type PreferencesHandler struct {
+	preferencesRepo *repository.UserPreferencesRepository
+}
+
+// NewPreferencesHandler creates a new preferences handler
+func NewPreferencesHandler(preferencesRepo *repository.UserPreferencesRepository) *PreferencesHandler {
+	return &PreferencesHandler{
+		preferencesRepo: preferencesRepo,
+	}
+}
+
+// UpdatePreferencesRequest represents a request to change the user's
+// preferences. Fields left out keep their current values.
+type UpdatePreferencesRequest struct {
+	DefaultProvider     *string  `json:"default_provider,omitempty" validate:"max=64"`
+	DefaultModel        *string  `json:"default_model,omitempty" validate:"max=200"`
+	DefaultSystemPrompt *string  `json:"default_system_prompt,omitempty" validate:"max=20000"`
+	DefaultTemperature  *float64 `json:"default_temperature,omitempty" validate:"min=0,max=2"`
+	// ClearDefaultTemperature goes back to the provider's default temperature
+	ClearDefaultTemperature bool     `json:"clear_default_temperature,omitempty"`
+	ToolConfirmation        string   `json:"tool_confirmation,omitempty" validate:"oneof=always read_only trusted"`
+	TrustedTools            []string `json:"trusted_tools,omitempty" validate:"max=100"`
+	MaxToolIterations       *int     `json:"max_tool_iterations,omitempty" validate:"min=0,max=1000"`
+	Timezone                string   `json:"timezone,omitempty" validate:"max=64"`
+
+	NotificationsEnabled *bool    `json:"notifications_enabled,omitempty"`
+	NotificationEvents   []string `json:"notification_events,omitempty" validate:"max=50"`
+
+	UIHints map[string]interface{} `json:"ui_hints,omitempty"`
+}
+
+// PreferencesDTO represents a user's preferences response
+type PreferencesDTO struct {
+	DefaultProvider      string                 `json:"default_provider"`
+	DefaultModel         string                 `json:"default_model"`
+	DefaultSystemPrompt  string                 `json:"default_system_prompt"`
+	DefaultTemperature   *float64               `json:"default_temperature"`
+	ToolConfirmation     string                 `json:"tool_confirmation"`
+	TrustedTools         []string               `json:"trusted_tools"`
+	MaxToolIterations    int                    `json:"max_tool_iterations"`
+	Timezone             string                 `json:"timezone"`
+	NotificationsEnabled bool                   `json:"notifications_enabled"`
+	NotificationEvents   []string               `json:"notification_events"`
+	UIHints              map[string]interface{} `json:"ui_hints"`
+	UpdatedAt            *time.Time             `json:"updated_at,omitempty"` // Omitted until preferences are first saved
+}
+
+// GetPreferences returns the current user's preferences
+func (h *PreferencesHandler) GetPreferences(c *fiber.Ctx) error {
+	prefs, err := h.preferencesRepo.GetOrDefault(middleware.GetUserID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get preferences",
+		})
+	}
+	return c.JSON(toPreferencesDTO(prefs))
+}
+
+// UpdatePreferences changes the current user's preferences
+func (h *PreferencesHandler) UpdatePreferences(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req UpdatePreferencesRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	prefs, err := h.preferencesRepo.GetOrDefault(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get preferences",
+		})
+	}
+
+	if req.DefaultProvider != nil {
+		prefs.DefaultProvider = *req.DefaultProvider
+	}
+	if req.DefaultModel != nil {
+		prefs.DefaultModel = *req.DefaultModel
+	}
+	if req.DefaultSystemPrompt != nil {
+		prefs.DefaultSystemPrompt = *req.DefaultSystemPrompt
+	}
+	if req.DefaultTemperature != nil {
+		prefs.DefaultTemperature = req.DefaultTemperature
+	}
+	if req.ClearDefaultTemperature {
+		prefs.DefaultTemperature = nil
+	}
+	if req.ToolConfirmation != "" {
+		prefs.ToolConfirmation = req.ToolConfirmation
+	}
+	if req.TrustedTools != nil {
+		prefs.TrustedTools = req.TrustedTools
+	}
+	if req.MaxToolIterations != nil {
+		prefs.MaxToolIterations = *req.MaxToolIterations
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "unknown timezone: " + req.Timezone,
+			})
+		}
+		prefs.Timezone = req.Timezone
+	}
+	if req.NotificationsEnabled != nil {
+		prefs.NotificationsEnabled = *req.NotificationsEnabled
+	}
+	if req.NotificationEvents != nil {
+		prefs.NotificationEvents = req.NotificationEvents
+	}
+	if req.UIHints != nil {
+		encoded, err := json.Marshal(req.UIHints)
+		if err != nil || len(encoded) > maxUIHintsSize {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "ui_hints must be at most 16KB",
+			})
+		}
+		prefs.UIHints = req.UIHints
+	}
+
+	if err := h.preferencesRepo.Upsert(prefs); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save preferences",
+		})
+	}
+
+	saved, err := h.preferencesRepo.GetOrDefault(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get preferences",
+		})
+	}
+	return c.JSON(toPreferencesDTO(saved))
+}
+
+// ResetPreferences restores the current user's preferences to the defaults
+func (h *PreferencesHandler) ResetPreferences(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if err := h.preferencesRepo.Delete(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to reset preferences",
+		})
+	}
+	return c.JSON(toPreferencesDTO(repository.DefaultUserPreferences(userID)))
+}
+
+// toPreferencesDTO converts preferences to their response
+func toPreferencesDTO(prefs *repository.UserPreferences) PreferencesDTO {
+	dto := PreferencesDTO{
+		DefaultProvider:      prefs.DefaultProvider,
+		DefaultModel:         prefs.DefaultModel,
+		DefaultSystemPrompt:  prefs.DefaultSystemPrompt,
+		DefaultTemperature:   prefs.DefaultTemperature,
+		ToolConfirmation:     prefs.ToolConfirmation,
+		TrustedTools:         prefs.TrustedTools,
+		MaxToolIterations:    prefs.MaxToolIterations,
+		Timezone:             prefs.Timezone,
+		NotificationsEnabled: prefs.NotificationsEnabled,
+		NotificationEvents:   prefs.NotificationEvents,
+		UIHints:              prefs.UIHints,
+	}
+	if !prefs.UpdatedAt.IsZero() {
+		updatedAt := prefs.UpdatedAt
+		dto.UpdatedAt = &updatedAt
+	}
+	return dto
+}
@@ -1,41 +1,59 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/proxy"
 	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/security"
 )
 
+// previewTokenParam carries a build preview token in the preview URL. The
+// proxy moves it into a cookie scoped to the build, so the pages and assets
+// the preview loads afterwards are authorized too.
+const previewTokenParam = "preview_token"
+
 // PreviewHandler handles preview-related HTTP requests
 type PreviewHandler struct {
 	sandboxService *sandbox.Service
+	jwtService     *security.JWTService
 }
 
 // NewPreviewHandler creates a new preview handler
-func NewPreviewHandler(sandboxService *sandbox.Service) *PreviewHandler {
+func NewPreviewHandler(sandboxService *sandbox.Service, jwtService *security.JWTService) *PreviewHandler {
 	return &PreviewHandler{
 		sandboxService: sandboxService,
+		jwtService:     jwtService,
 	}
 }
 
-// ListFiles lists files in the user's sandbox
+// ListFiles lists files in the user's sandbox. Without query parameters it
+// returns the whole tree; root, path (a directory to expand), depth, offset
+// and limit page through large trees instead.
 func (h *PreviewHandler) ListFiles(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
-	files, err := h.sandboxService.ListFiles(userID)
+	listing, err := h.sandboxService.ListDirectory(userID, sandbox.ListOptions{
+		Root:   c.Query("root"),
+		Path:   c.Query("path"),
+		Depth:  c.QueryInt("depth"),
+		Offset: c.QueryInt("offset"),
+		Limit:  c.QueryInt("limit"),
+	})
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": fmt.Sprintf("failed to list files: %v", err),
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"files": files,
-	})
+	return c.JSON(listing)
 }
 
 // GetFile gets the content of a specific file
@@ -59,6 +77,7 @@ func (h *PreviewHandler) GetFile(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"path":    filePath,
 		"content": content,
+		"hash":    sandbox.ContentHash(content),
 	})
 }
 
@@ -67,23 +86,24 @@ func (h *PreviewHandler) WriteFile(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
 	var req struct {
-		Path    string `json:"path"`
-		Content string `json:"content"`
+		Path         string `json:"path" validate:"required"`
+		Content      string `json:"content"`
+		ExpectedHash string `json:"expected_hash"` // Hash from GetFile; rejects the write if the file changed since
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
-	if req.Path == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "file path is required",
-		})
-	}
-
-	if err := h.sandboxService.WriteFile(userID, req.Path, req.Content); err != nil {
+	hash, err := h.sandboxService.WriteFileIfMatch(userID, req.Path, req.Content, req.ExpectedHash)
+	if err != nil {
+		var conflict *sandbox.FileConflictError
+		if errors.As(err, &conflict) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":        conflict.Error(),
+				"current_hash": conflict.CurrentHash,
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("failed to write file: %v", err),
 		})
@@ -92,6 +112,7 @@ func (h *PreviewHandler) WriteFile(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"success": true,
 		"path":    req.Path,
+		"hash":    hash,
 	})
 }
 
@@ -175,18 +196,78 @@ func (h *PreviewHandler) GetBuild(c *fiber.Ctx) error {
 		response["error"] = build.Error
 	}
 
-	if build.PreviewURL != "" {
-		response["preview_url"] = build.PreviewURL
+	if port := build.GetPort(); port != 0 {
+		response["port"] = port
+		response["preview_url"] = h.sandboxService.PreviewURL(build)
 	}
 
 	return c.JSON(response)
 }
 
-// StopBuild stops a running build
+// ProxyBuild forwards a preview request to the server a running build
+// started, on the port detected for it. The request must carry a preview
+// token for the build, from its preview URL or the cookie set from it.
+func (h *PreviewHandler) ProxyBuild(c *fiber.Ctx) error {
+	buildID := c.Params("id")
+
+	token := c.Query(previewTokenParam)
+	fromQuery := token != ""
+	if !fromQuery {
+		token = c.Cookies(previewTokenParam)
+	}
+	claims, err := h.jwtService.ValidatePreviewToken(token)
+	if err != nil || claims.Subject != buildID {
+		return c.Status(fiber.StatusUnauthorized).SendString("Preview link is invalid or has expired")
+	}
+
+	build, err := h.sandboxService.GetBuild(buildID)
+	if err != nil || build.UserID != claims.UserID {
+		return c.Status(fiber.StatusNotFound).SendString("Build not found")
+	}
+
+
+	port := build.GetPort()
+	if port == 0 || build.GetStatus() != sandbox.BuildStatusRunning {
+		return c.Status(fiber.StatusBadGateway).SendString("Build is not serving")
+	}
+
+	target := fmt.Sprintf("http://127.0.0.1:%d/%s", port, c.Params("*"))
+	query := string(c.Request().URI().QueryString())
+	if fromQuery {
+		args := c.Request().URI().QueryArgs()
+		args.Del(previewTokenParam)
+		query = args.String()
+	}
+	if query != "" {
+		target += "?" + query
+	}
+	// The server being previewed doesn't get Prism's cookie
+	c.Request().Header.DelCookie(previewTokenParam)
+	if err := proxy.Do(c, target); err != nil {
+		return err
+	}
+
+	// Set after proxying, which replaces the response
+	if fromQuery {
+		c.Cookie(&fiber.Cookie{
+			Name:     previewTokenParam,
+			Value:    token,
+			Path:     "/preview/build/" + buildID + "/",
+			Expires:  claims.ExpiresAt.Time,
+			Secure:   c.Protocol() == "https",
+			HTTPOnly: true,
+			SameSite: fiber.CookieSameSiteLaxMode,
+		})
+	}
+	return nil
+}
+
+// StopBuild stops a build, or cancels it if it hasn't started yet
 func (h *PreviewHandler) StopBuild(c *fiber.Ctx) error {
 	buildID := c.Params("id")
 
-	if err := h.sandboxService.StopBuild(buildID); err != nil {
+	status, err := h.sandboxService.StopBuild(buildID)
+	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": fmt.Sprintf("failed to stop build: %v", err),
 		})
@@ -194,9 +275,51 @@ func (h *PreviewHandler) StopBuild(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{
 		"success": true,
+		"status":  status,
 	})
 }
 
+// ListArtifacts lists the files kept from one of the user's builds
+func (h *PreviewHandler) ListArtifacts(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	buildID := c.Params("id")
+
+	artifacts, err := h.sandboxService.ListArtifacts(userID, buildID)
+	if err != nil {
+		if errors.Is(err, sandbox.ErrArtifactNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "build not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("failed to list artifacts: %v", err),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"build_id":  buildID,
+		"artifacts": artifacts,
+	})
+}
+
+// DownloadArtifact sends one of a build's artifacts as an attachment
+func (h *PreviewHandler) DownloadArtifact(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	r, artifact, err := h.sandboxService.OpenArtifact(userID, c.Params("id"), c.Params("*"))
+	if err != nil {
+		if !errors.Is(err, sandbox.ErrArtifactNotFound) {
+			log.Printf("Failed to open artifact: %v", err)
+		}
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "artifact not found",
+		})
+	}
+
+	c.Attachment(path.Base(artifact.Path))
+	return c.SendStream(r, int(artifact.Size))
+}
+
 // getContentType returns the content type for a file extension
 func getContentType(ext string) string {
 	contentTypes := map[string]string{
@@ -3,9 +3,8 @@ package handlers
 import (
 	"context"
 	"log"
-	"net/http"
-	"strings"
-	"time"
+	"sort"
+	"sync"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jacklau/prism/internal/api/middleware"
@@ -19,6 +18,10 @@ type ProviderHandler struct {
 	providerKeyRepo   *repository.ProviderKeyRepository
 	encryptionService *security.EncryptionService
 	llmManager        *llm.Manager
+	keyValidator      *llm.KeyValidator
+
+	// allowPrivateBaseURLs accepts base URLs on internal networks
+	allowPrivateBaseURLs bool
 }
 
 // NewProviderHandler creates a new provider handler
@@ -26,17 +29,47 @@ func NewProviderHandler(
 	providerKeyRepo *repository.ProviderKeyRepository,
 	encryptionService *security.EncryptionService,
 	llmManager *llm.Manager,
+	keyValidator *llm.KeyValidator,
 ) *ProviderHandler {
 	return &ProviderHandler{
 		providerKeyRepo:   providerKeyRepo,
 		encryptionService: encryptionService,
 		llmManager:        llmManager,
+		keyValidator:      keyValidator,
 	}
 }
 
+// SetAllowPrivateBaseURLs accepts base URLs on loopback and private
+// networks, for servers whose users run their own model servers
+func (h *ProviderHandler) SetAllowPrivateBaseURLs(allow bool) {
+	h.allowPrivateBaseURLs = allow
+}
+
+// checkBaseURL returns why a provider can't be given baseURL, or "" if it
+// can: the provider doesn't support one, or the URL points into the server's
+// network
+func (h *ProviderHandler) checkBaseURL(provider, baseURL string) string {
+	if baseURL == "" {
+		return ""
+	}
+	if !h.llmManager.SupportsBaseURL(provider) {
+		return "provider does not support a custom base URL: " + provider
+	}
+	if h.allowPrivateBaseURLs {
+		return ""
+	}
+	if err := security.CheckPublicURL(baseURL); err != nil {
+		return "invalid base_url: " + err.Error()
+	}
+	return ""
+}
+
 // SetKeyRequest represents a request to set an API key
 type SetKeyRequest struct {
-	APIKey string `json:"api_key"`
+	APIKey string `json:"api_key" validate:"required,max=1000"`
+	// BaseURL points an OpenAI-compatible provider at another server, such
+	// as vLLM, LM Studio, llama.cpp or a LiteLLM proxy
+	BaseURL string `json:"base_url,omitempty" validate:"max=500,url"`
 }
 
 // SetKey stores an encrypted API key for a provider
@@ -63,15 +96,12 @@ func (h *ProviderHandler) SetKey(c *fiber.Ctx) error {
 	}
 
 	var req SetKeyRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
-
-	if strings.TrimSpace(req.APIKey) == "" {
+	if msg := h.checkBaseURL(provider, req.BaseURL); msg != "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "api_key is required",
+			"error": msg,
 		})
 	}
 
@@ -84,15 +114,12 @@ func (h *ProviderHandler) SetKey(c *fiber.Ctx) error {
 	}
 
 	// Store the encrypted key
-	if err := h.providerKeyRepo.SetKey(userID, provider, encryptedKey, nonce); err != nil {
+	if err := h.providerKeyRepo.SetKey(userID, provider, encryptedKey, nonce, req.BaseURL); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to save API key",
 		})
 	}
 
-	// Also set the key on the provider instance for immediate use
-	h.llmManager.SetAPIKey(provider, req.APIKey)
-
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "API key saved successfully",
@@ -129,10 +156,15 @@ func (h *ProviderHandler) DeleteKey(c *fiber.Ctx) error {
 
 // ValidateKeyRequest represents a request to validate an API key
 type ValidateKeyRequest struct {
-	APIKey string `json:"api_key"`
+	APIKey  string `json:"api_key,omitempty" validate:"max=1000"`     // Defaults to the stored key
+	BaseURL string `json:"base_url,omitempty" validate:"max=500,url"` // Server to validate against
+	Model   string `json:"model,omitempty" validate:"max=200"`        // Model the key must be able to use
+	Refresh bool   `json:"refresh,omitempty"`                         // Check again even if a recent result is cached
 }
 
-// ValidateKey validates an API key with the provider
+// ValidateKey checks an API key with a minimal real request to the
+// provider and reports why it fails: an invalid key, no billing, a model the
+// key can't use, or the provider being unreachable
 func (h *ProviderHandler) ValidateKey(c *fiber.Ctx) error {
 	userID := middleware.GetUserID(c)
 	if userID == "" {
@@ -142,41 +174,122 @@ func (h *ProviderHandler) ValidateKey(c *fiber.Ctx) error {
 	}
 
 	provider := c.Params("provider")
-	if provider == "" {
+	if _, err := h.llmManager.GetProvider(provider); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "provider is required",
+			"error": "unknown provider: " + provider,
 		})
 	}
 
 	var req ValidateKeyRequest
-	if err := c.BodyParser(&req); err != nil {
+	if len(c.Body()) > 0 {
+		if err := parseBody(c, &req); err != nil {
+			return err
+		}
+	}
+	if msg := h.checkBaseURL(provider, req.BaseURL); msg != "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
+			"error": msg,
 		})
 	}
 
-	if strings.TrimSpace(req.APIKey) == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "api_key is required",
-		})
+	check := llm.KeyCheck{Key: req.APIKey, BaseURL: req.BaseURL, Model: req.Model}
+	if check.Key == "" && provider != "ollama" {
+		stored, err := h.storedKeyCheck(userID, provider)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to load API key",
+			})
+		}
+		if stored == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "api_key is required when no key is stored for " + provider,
+			})
+		}
+		check.Key = stored.Key
+		if check.BaseURL == "" {
+			check.BaseURL = stored.BaseURL
+		}
 	}
 
-	// Validate the API key by making a test request to the provider
-	valid, err := h.validateProviderKey(provider, req.APIKey)
+	status, err := h.keyValidator.Check(c.Context(), provider, check, req.Refresh)
 	if err != nil {
 		log.Printf("Provider key validation failed for %s: %v", provider, err)
-		return c.JSON(fiber.Map{
-			"valid":   false,
-			"message": "API key validation failed",
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to validate API key",
 		})
 	}
+	return c.JSON(status)
+}
 
+// ProviderKeyStatus is the state of a user's key for one provider
+type ProviderKeyStatus struct {
+	Provider   string         `json:"provider"`
+	HasKey     bool           `json:"has_key"`
+	Shared     bool           `json:"shared"` // Provided by an organization
+	BaseURL    string         `json:"base_url,omitempty"`
+	Validation *llm.KeyStatus `json:"validation,omitempty"` // Omitted for providers without a key
+}
+
+// ListKeyStatus validates the user's key for every provider, reusing recent
+// results unless refresh=true, for showing which keys work
+func (h *ProviderHandler) ListKeyStatus(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+	refresh := c.QueryBool("refresh")
+
+	providers := h.llmManager.ListProviders()
+	statuses := make([]ProviderKeyStatus, len(providers))
+	var wg sync.WaitGroup
+	for i, info := range providers {
+		key, err := h.providerKeyRepo.GetKey(userID, info.Name)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to check API key status",
+			})
+		}
+
+		statuses[i] = ProviderKeyStatus{Provider: info.Name}
+		check := llm.KeyCheck{}
+		if key != nil {
+			statuses[i].HasKey = true
+			statuses[i].Shared = key.OrganizationID != ""
+			statuses[i].BaseURL = key.BaseURL
+			decrypted, err := h.encryptionService.Decrypt(key.EncryptedKey, key.KeyNonce)
+			if err != nil {
+				continue
+			}
+			check = llm.KeyCheck{Key: string(decrypted), BaseURL: key.BaseURL}
+		} else if info.Name != "ollama" {
+			continue
+		}
+
+		wg.Add(1)
+		go func(status *ProviderKeyStatus, check llm.KeyCheck) {
+			defer wg.Done()
+			result, err := h.keyValidator.Check(context.Background(), status.Provider, check, refresh)
+			if err != nil {
+				log.Printf("Provider key validation failed for %s: %v", status.Provider, err)
+				return
+			}
+			status.Validation = &result
+		}(&statuses[i], check)
+	}
+	wg.Wait()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Provider < statuses[j].Provider
+	})
 	return c.JSON(fiber.Map{
-		"valid": valid,
+		"providers": statuses,
 	})
 }
 
-// GetKeyStatus returns whether a user has a key configured for a provider
+// GetKeyStatus returns whether a user has a key configured for a provider,
+// their own or one shared by an organization
 func (h *ProviderHandler) GetKeyStatus(c *fiber.Ctx) error {
 	userID := middleware.GetUserID(c)
 	if userID == "" {
@@ -192,20 +305,26 @@ func (h *ProviderHandler) GetKeyStatus(c *fiber.Ctx) error {
 		})
 	}
 
-	hasKey, err := h.providerKeyRepo.HasKey(userID, provider)
+	key, err := h.providerKeyRepo.GetKey(userID, provider)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to check API key status",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"has_key":  hasKey,
+	response := fiber.Map{
+		"has_key":  key != nil,
+		"shared":   key != nil && key.OrganizationID != "", // Provided by an organization
 		"provider": provider,
-	})
+	}
+	if key != nil && key.BaseURL != "" {
+		response["base_url"] = key.BaseURL
+	}
+	return c.JSON(response)
 }
 
-// ListKeys returns a list of providers the user has keys configured for
+// ListKeys returns a list of providers the user has keys configured for,
+// and the providers their organizations share keys for
 func (h *ProviderHandler) ListKeys(c *fiber.Ctx) error {
 	userID := middleware.GetUserID(c)
 	if userID == "" {
@@ -226,73 +345,29 @@ func (h *ProviderHandler) ListKeys(c *fiber.Ctx) error {
 		providers[i] = key.Provider
 	}
 
-	return c.JSON(fiber.Map{
-		"providers": providers,
-	})
-}
-
-// validateProviderKey validates an API key by making a simple API call
-func (h *ProviderHandler) validateProviderKey(provider, apiKey string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	switch provider {
-	case "openai":
-		return h.validateOpenAIKey(ctx, apiKey)
-	case "anthropic":
-		return h.validateAnthropicKey(ctx, apiKey)
-	case "ollama":
-		// Ollama doesn't require an API key
-		return true, nil
-	default:
-		// For unknown providers, just check if the key is non-empty
-		return len(apiKey) > 0, nil
-	}
-}
-
-// validateOpenAIKey validates an OpenAI API key
-func (h *ProviderHandler) validateOpenAIKey(ctx context.Context, apiKey string) (bool, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.openai.com/v1/models", nil)
+	shared, err := h.providerKeyRepo.ListSharedProviders(userID)
 	if err != nil {
-		return false, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, err
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list API keys",
+		})
 	}
-	defer resp.Body.Close()
 
-	return resp.StatusCode == http.StatusOK, nil
+	return c.JSON(fiber.Map{
+		"providers":        providers,
+		"shared_providers": shared, // Providers an organization shares a key for
+	})
 }
 
-// validateAnthropicKey validates an Anthropic API key
-func (h *ProviderHandler) validateAnthropicKey(ctx context.Context, apiKey string) (bool, error) {
-	// Anthropic doesn't have a simple list models endpoint
-	// We'll check the key format and make a minimal request
-	if !strings.HasPrefix(apiKey, "sk-ant-") {
-		return false, nil
+// storedKeyCheck returns the user's stored key for a provider, their own or
+// one shared by an organization, or nil if there is none
+func (h *ProviderHandler) storedKeyCheck(userID, provider string) (*llm.KeyCheck, error) {
+	key, err := h.providerKeyRepo.GetKey(userID, provider)
+	if err != nil || key == nil {
+		return nil, err
 	}
-
-	// Make a minimal request to check if the key is valid
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.anthropic.com/v1/messages", nil)
+	decrypted, err := h.encryptionService.Decrypt(key.EncryptedKey, key.KeyNonce)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-
-	req.Header.Set("x-api-key", apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, err
-	}
-	defer resp.Body.Close()
-
-	// 401 means invalid key, 405 means valid key but wrong method (which is fine)
-	return resp.StatusCode != http.StatusUnauthorized, nil
+	return &llm.KeyCheck{Key: string(decrypted), BaseURL: key.BaseURL}, nil
 }
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/apierror"
+	"github.com/jacklau/prism/internal/api/validation"
+	"github.com/jacklau/prism/internal/database/repository"
+)
+
+// parseBody decodes the request body into out and checks its validate tags.
+// Handlers return the error as-is; the app's error handler writes it in the
+// apierror envelope.
+func parseBody(c *fiber.Ctx, out interface{}) error {
+	if err := c.BodyParser(out); err != nil {
+		return apierror.BadRequest("invalid request body")
+	}
+	return validation.Struct(out)
+}
+
+// getOwnedConversation loads a conversation and verifies the user owns it.
+// On failure it returns a nil conversation with the HTTP status and error message.
+func getOwnedConversation(conversationRepo *repository.ConversationRepository, convID, userID string) (*repository.Conversation, int, string) {
+	conv, err := conversationRepo.GetByID(convID)
+	if err != nil {
+		return nil, fiber.StatusInternalServerError, "failed to get conversation"
+	}
+	if conv == nil {
+		return nil, fiber.StatusNotFound, "conversation not found"
+	}
+	if conv.UserID != userID {
+		return nil, fiber.StatusForbidden, "access denied"
+	}
+	return conv, 0, ""
+}
+
+// getReadableConversation loads a conversation the user owns or that is
+// shared with them. With write set, a share must give editor access.
+// On failure it returns a nil conversation with the HTTP status and error message.
+func getReadableConversation(conversationRepo *repository.ConversationRepository, shareRepo *repository.ConversationShareRepository, convID, userID string, write bool) (*repository.Conversation, int, string) {
+	conv, err := conversationRepo.GetByID(convID)
+	if err != nil {
+		return nil, fiber.StatusInternalServerError, "failed to get conversation"
+	}
+	if conv == nil {
+		return nil, fiber.StatusNotFound, "conversation not found"
+	}
+	if conv.UserID == userID {
+		return conv, 0, ""
+	}
+	if shareRepo == nil {
+		return nil, fiber.StatusForbidden, "access denied"
+	}
+	share, err := shareRepo.Get(conv.ID, userID)
+	if err != nil {
+		return nil, fiber.StatusInternalServerError, "failed to check conversation access"
+	}
+	if share == nil || (write && share.Role != repository.ShareRoleEditor) {
+		return nil, fiber.StatusForbidden, "access denied"
+	}
+	return conv, 0, ""
+}
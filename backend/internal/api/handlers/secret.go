@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/security"
+)
+
+// SecretHandler handles the user's secrets vault
+type SecretHandler struct {
+	secretRepo *repository.SecretRepository
+}
+
+// NewSecretHandler creates a new secret handler
+func NewSecretHandler(secretRepo *repository.SecretRepository) *SecretHandler {
+	return &SecretHandler{
+		secretRepo: secretRepo,
+	}
+}
+
+// SetSecretRequest represents a secret's value
+type SetSecretRequest struct {
+	Value string `json:"value" validate:"required,max=10000"`
+}
+
+// SecretDTO represents a secret, without its value
+type SecretDTO struct {
+	Name      string    `json:"name"`
+	Reference string    `json:"reference"` // How to use the secret in configs and tool parameters
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// List lists the user's secrets by name. Values are never returned.
+func (h *SecretHandler) List(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	secrets, err := h.secretRepo.List(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list secrets",
+		})
+	}
+
+	dtos := make([]SecretDTO, len(secrets))
+	for i, secret := range secrets {
+		dtos[i] = toSecretDTO(secret)
+	}
+
+	return c.JSON(fiber.Map{
+		"secrets": dtos,
+	})
+}
+
+// Set creates or replaces one of the user's secrets
+func (h *SecretHandler) Set(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	name := c.Params("name")
+	if !security.SecretNamePattern.MatchString(name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "secret names must be letters, digits and underscores, not starting with a digit, up to 64 characters",
+		})
+	}
+
+	var req SetSecretRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	secret, err := h.secretRepo.Set(userID, name, req.Value)
+	if err != nil {
+		log.Printf("Failed to save secret %s for user %s: %v", name, userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save secret",
+		})
+	}
+
+	return c.JSON(toSecretDTO(secret))
+}
+
+// Delete removes one of the user's secrets. References to it stop resolving.
+func (h *SecretHandler) Delete(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	deleted, err := h.secretRepo.Delete(userID, c.Params("name"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete secret",
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "secret not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "secret deleted",
+	})
+}
+
+func toSecretDTO(s *repository.Secret) SecretDTO {
+	return SecretDTO{
+		Name:      s.Name,
+		Reference: security.SecretReference(s.Name),
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
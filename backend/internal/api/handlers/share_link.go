@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/security"
+)
+
+const (
+	// maxSharedToolSummaryLength caps tool call parameter summaries in shared transcripts
+	maxSharedToolSummaryLength = 200
+	// maxSharedToolResultLength caps tool result content in shared transcripts
+	maxSharedToolResultLength = 1000
+)
+
+// ShareLinkHandler handles public conversation share link endpoints
+type ShareLinkHandler struct {
+	conversationRepo *repository.ConversationRepository
+	messageRepo      *repository.MessageRepository
+	linkRepo         *repository.ShareLinkRepository
+	jwtService       *security.JWTService
+	baseURL          string
+	defaultExpiry    time.Duration
+	maxExpiry        time.Duration
+}
+
+// NewShareLinkHandler creates a new share link handler
+func NewShareLinkHandler(
+	conversationRepo *repository.ConversationRepository,
+	messageRepo *repository.MessageRepository,
+	linkRepo *repository.ShareLinkRepository,
+	jwtService *security.JWTService,
+	baseURL string,
+	defaultExpiry, maxExpiry time.Duration,
+) *ShareLinkHandler {
+	return &ShareLinkHandler{
+		conversationRepo: conversationRepo,
+		messageRepo:      messageRepo,
+		linkRepo:         linkRepo,
+		jwtService:       jwtService,
+		baseURL:          strings.TrimSuffix(baseURL, "/"),
+		defaultExpiry:    defaultExpiry,
+		maxExpiry:        maxExpiry,
+	}
+}
+
+// CreateShareLinkRequest represents a request to create a share link
+type CreateShareLinkRequest struct {
+	ExpiresInHours int `json:"expires_in_hours,omitempty" validate:"min=0"`
+}
+
+// ShareLinkDTO represents a share link response
+type ShareLinkDTO struct {
+	ID        string     `json:"id"`
+	Token     string     `json:"token,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	ViewCount int        `json:"view_count"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// SharedTranscriptDTO represents a read-only conversation transcript
+type SharedTranscriptDTO struct {
+	Title     string             `json:"title"`
+	Provider  string             `json:"provider"`
+	Model     string             `json:"model"`
+	Messages  []SharedMessageDTO `json:"messages"`
+	CreatedAt time.Time          `json:"created_at"`
+	ExpiresAt time.Time          `json:"expires_at"`
+}
+
+// SharedMessageDTO represents a message in a shared transcript
+type SharedMessageDTO struct {
+	Role      string              `json:"role"`
+	Content   string              `json:"content"`
+	ToolCalls []SharedToolCallDTO `json:"tool_calls,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+// SharedToolCallDTO summarizes a tool call in a shared transcript
+type SharedToolCallDTO struct {
+	Name    string `json:"name"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// CreateLink creates a signed, expiring public link to a conversation
+func (h *ShareLinkHandler) CreateLink(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	var req CreateShareLinkRequest
+	if len(c.Body()) > 0 {
+		if err := parseBody(c, &req); err != nil {
+			return err
+		}
+	}
+
+	expiry := h.defaultExpiry
+	if req.ExpiresInHours > 0 {
+		expiry = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	if expiry > h.maxExpiry {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "expiry exceeds the maximum of " + h.maxExpiry.String(),
+		})
+	}
+
+	link, err := h.linkRepo.Create(conv.ID, userID, time.Now().Add(expiry))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create share link",
+		})
+	}
+
+	token, err := h.jwtService.GenerateShareToken(link.ID, conv.ID, link.ExpiresAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to sign share link",
+		})
+	}
+
+	dto := toShareLinkDTO(link)
+	dto.Token = token
+	dto.URL = h.baseURL + "/share/" + token
+
+	return c.Status(fiber.StatusCreated).JSON(dto)
+}
+
+// ListLinks lists the share links for a conversation
+func (h *ShareLinkHandler) ListLinks(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	links, err := h.linkRepo.ListByConversationID(conv.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list share links",
+		})
+	}
+
+	dtos := make([]ShareLinkDTO, len(links))
+	for i, link := range links {
+		dtos[i] = toShareLinkDTO(link)
+	}
+
+	return c.JSON(fiber.Map{
+		"links": dtos,
+	})
+}
+
+// RevokeLink revokes a share link so its token stops working
+func (h *ShareLinkHandler) RevokeLink(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getOwnedConversation(h.conversationRepo, c.Params("id"), userID)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	link, err := h.linkRepo.GetByID(c.Params("linkId"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get share link",
+		})
+	}
+	if link == nil || link.ConversationID != conv.ID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "share link not found",
+		})
+	}
+
+	if err := h.linkRepo.Revoke(link.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to revoke share link",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "share link revoked",
+	})
+}
+
+// GetSharedTranscript returns the read-only transcript for a share token as JSON
+func (h *ShareLinkHandler) GetSharedTranscript(c *fiber.Ctx) error {
+	transcript, status, msg := h.loadTranscript(c.Params("token"))
+	if transcript == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	return c.JSON(transcript)
+}
+
+// RenderSharedTranscript renders the read-only transcript for a share token as HTML
+func (h *ShareLinkHandler) RenderSharedTranscript(c *fiber.Ctx) error {
+	transcript, status, msg := h.loadTranscript(c.Params("token"))
+	if transcript == nil {
+		return c.Status(status).SendString(msg)
+	}
+
+	var buf bytes.Buffer
+	if err := sharedTranscriptTemplate.Execute(&buf, transcript); err != nil {
+		log.Printf("Failed to render shared transcript: %v", err)
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to render transcript")
+	}
+
+	c.Set("Content-Type", "text/html; charset=utf-8")
+	c.Set("X-Robots-Tag", "noindex")
+	return c.Send(buf.Bytes())
+}
+
+// loadTranscript validates a share token and builds the redacted transcript.
+// On failure it returns a nil transcript with the HTTP status and error message.
+func (h *ShareLinkHandler) loadTranscript(token string) (*SharedTranscriptDTO, int, string) {
+	claims, err := h.jwtService.ValidateShareToken(token)
+	if err != nil {
+		return nil, fiber.StatusNotFound, "share link is invalid or has expired"
+	}
+
+	link, err := h.linkRepo.GetByID(claims.ID)
+	if err != nil {
+		return nil, fiber.StatusInternalServerError, "failed to load share link"
+	}
+	if link == nil || link.ConversationID != claims.Subject || !link.IsActive() {
+		return nil, fiber.StatusNotFound, "share link is invalid or has expired"
+	}
+
+	conv, err := h.conversationRepo.GetByID(link.ConversationID)
+	if err != nil {
+		return nil, fiber.StatusInternalServerError, "failed to load conversation"
+	}
+	if conv == nil {
+		return nil, fiber.StatusNotFound, "conversation not found"
+	}
+
+	messages, err := h.messageRepo.ListByConversationID(conv.ID)
+	if err != nil {
+		return nil, fiber.StatusInternalServerError, "failed to load messages"
+	}
+
+	if err := h.linkRepo.IncrementViewCount(link.ID); err != nil {
+		log.Printf("Failed to record share link view: %v", err)
+	}
+
+	transcript := &SharedTranscriptDTO{
+		Title:     security.RedactSecrets(conv.Title),
+		Provider:  conv.Provider,
+		Model:     conv.Model,
+		Messages:  make([]SharedMessageDTO, 0, len(messages)),
+		CreatedAt: conv.CreatedAt,
+		ExpiresAt: link.ExpiresAt,
+	}
+
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			continue
+		}
+
+		content := security.RedactSecrets(msg.Content)
+		if msg.Role == "tool" {
+			content = truncateString(content, maxSharedToolResultLength)
+		}
+
+		shared := SharedMessageDTO{
+			Role:      msg.Role,
+			Content:   content,
+			CreatedAt: msg.CreatedAt,
+		}
+		for _, tc := range msg.ToolCalls {
+			shared.ToolCalls = append(shared.ToolCalls, SharedToolCallDTO{
+				Name:    tc.Name,
+				Summary: summarizeToolParameters(tc.Parameters),
+			})
+		}
+		transcript.Messages = append(transcript.Messages, shared)
+	}
+
+	return transcript, 0, ""
+}
+
+// toShareLinkDTO converts a share link to its response form
+func toShareLinkDTO(link *repository.ShareLink) ShareLinkDTO {
+	return ShareLinkDTO{
+		ID:        link.ID,
+		ExpiresAt: link.ExpiresAt,
+		RevokedAt: link.RevokedAt,
+		ViewCount: link.ViewCount,
+		Active:    link.IsActive(),
+		CreatedAt: link.CreatedAt,
+	}
+}
+
+// summarizeToolParameters renders redacted tool parameters as a short one-line summary
+func summarizeToolParameters(params map[string]interface{}) string {
+	if len(params) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(security.RedactValue(params))
+	if err != nil {
+		return ""
+	}
+	return truncateString(string(data), maxSharedToolSummaryLength)
+}
+
+// truncateString shortens s to at most maxLen runes, marking the cut with an ellipsis
+func truncateString(s string, maxLen int) string {
+	runes := []rune(s)
+	if len(runes) <= maxLen {
+		return s
+	}
+	return string(runes[:maxLen]) + "…"
+}
+
+// sharedTranscriptTemplate renders a shared conversation as a standalone page
+var sharedTranscriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Title}}{{.Title}}{{else}}Shared conversation{{end}} · Prism</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 860px; margin: 2rem auto; padding: 0 1rem; color: #1f2937; }
+header { border-bottom: 1px solid #e5e7eb; margin-bottom: 1.5rem; }
+.meta { color: #6b7280; font-size: 0.875rem; }
+.message { margin-bottom: 1.25rem; }
+.role { font-weight: 600; text-transform: capitalize; margin-bottom: 0.25rem; }
+.content { white-space: pre-wrap; word-wrap: break-word; }
+.tool { background: #f3f4f6; border-radius: 6px; padding: 0.5rem 0.75rem; font-family: ui-monospace, monospace; font-size: 0.8125rem; margin-top: 0.25rem; }
+.message.tool-result .content { font-family: ui-monospace, monospace; font-size: 0.8125rem; color: #4b5563; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{if .Title}}{{.Title}}{{else}}Shared conversation{{end}}</h1>
+<p class="meta">{{.Provider}} · {{.Model}} · read-only · link expires {{.ExpiresAt.Format "Jan 2, 2006"}}</p>
+</header>
+{{range .Messages}}
+<div class="message{{if eq .Role "tool"}} tool-result{{end}}">
+<div class="role">{{if eq .Role "tool"}}Tool result{{else}}{{.Role}}{{end}}</div>
+{{if .Content}}<div class="content">{{.Content}}</div>{{end}}
+{{range .ToolCalls}}<div class="tool">{{.Name}}{{if .Summary}} {{.Summary}}{{end}}</div>{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
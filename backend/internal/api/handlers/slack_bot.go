@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/services/slackbot"
+)
+
+// SlackBotHandler handles Slack slash commands and Slack account linking
+type SlackBotHandler struct {
+	bot   *slackbot.Bot
+	links *repository.SlackLinkRepository
+}
+
+// NewSlackBotHandler creates a new Slack bot handler
+func NewSlackBotHandler(bot *slackbot.Bot, links *repository.SlackLinkRepository) *SlackBotHandler {
+	return &SlackBotHandler{
+		bot:   bot,
+		links: links,
+	}
+}
+
+// SlackLinkResponse represents a linked Slack account in API responses
+type SlackLinkResponse struct {
+	SlackTeamID   string    `json:"slack_team_id"`
+	SlackUserID   string    `json:"slack_user_id"`
+	SlackUsername string    `json:"slack_username,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func toSlackLinkResponse(link *repository.SlackLink) SlackLinkResponse {
+	return SlackLinkResponse{
+		SlackTeamID:   link.SlackTeamID,
+		SlackUserID:   link.SlackUserID,
+		SlackUsername: link.SlackUsername,
+		CreatedAt:     link.CreatedAt,
+	}
+}
+
+// HandleCommand handles a /prism slash command from Slack
+func (h *SlackBotHandler) HandleCommand(c *fiber.Ctx) error {
+	// Verify against the raw body before parsing the form
+	if err := h.bot.Verify(c.Get("X-Slack-Request-Timestamp"), c.Get("X-Slack-Signature"), c.Body()); err != nil {
+		log.Printf("Rejected Slack command: %v", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid signature",
+		})
+	}
+
+	cmd := &slackbot.Command{
+		TeamID:      c.FormValue("team_id"),
+		UserID:      c.FormValue("user_id"),
+		UserName:    c.FormValue("user_name"),
+		ChannelID:   c.FormValue("channel_id"),
+		Text:        c.FormValue("text"),
+		ResponseURL: c.FormValue("response_url"),
+	}
+
+	return c.JSON(fiber.Map{
+		"response_type": "ephemeral",
+		"text":          h.bot.HandleCommand(cmd),
+	})
+}
+
+// LinkAccount links a Slack account to the current user with a code from /prism link
+func (h *SlackBotHandler) LinkAccount(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req struct {
+		Code string `json:"code" validate:"required"`
+	}
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	link, err := h.bot.CompleteLink(req.Code, userID)
+	if errors.Is(err, slackbot.ErrInvalidLinkCode) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to link slack account",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(toSlackLinkResponse(link))
+}
+
+// ListLinks returns the Slack accounts linked to the current user
+func (h *SlackBotHandler) ListLinks(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	links, err := h.links.ListByUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list slack links",
+		})
+	}
+
+	response := make([]SlackLinkResponse, 0, len(links))
+	for _, link := range links {
+		response = append(response, toSlackLinkResponse(link))
+	}
+
+	return c.JSON(fiber.Map{
+		"links": response,
+	})
+}
+
+// DeleteLink unlinks one of the current user's Slack accounts
+func (h *SlackBotHandler) DeleteLink(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	deleted, err := h.links.Unlink(c.Params("teamID"), c.Params("slackUserID"), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to unlink slack account",
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "slack link not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Slack account unlinked",
+	})
+}
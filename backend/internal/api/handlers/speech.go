@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/services/speech"
+)
+
+// SpeechHandler handles reading assistant messages aloud
+type SpeechHandler struct {
+	conversationRepo *repository.ConversationRepository
+	messageRepo      *repository.MessageRepository
+	shareRepo        *repository.ConversationShareRepository
+	service          *speech.Service
+}
+
+// NewSpeechHandler creates a new speech handler
+func NewSpeechHandler(
+	conversationRepo *repository.ConversationRepository,
+	messageRepo *repository.MessageRepository,
+	shareRepo *repository.ConversationShareRepository,
+	service *speech.Service,
+) *SpeechHandler {
+	return &SpeechHandler{
+		conversationRepo: conversationRepo,
+		messageRepo:      messageRepo,
+		shareRepo:        shareRepo,
+		service:          service,
+	}
+}
+
+// GetMessageSpeech streams an assistant message as audio. The optional
+// "provider" and "voice" query parameters pick the speech backend and voice.
+func (h *SpeechHandler) GetMessageSpeech(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	message, status, msg := h.resolveMessage(c.Params("id"), c.Params("messageId"), userID)
+	if message == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	// The audio keeps streaming after this handler returns, so it must not
+	// be tied to the request context
+	result, err := h.service.Synthesize(context.Background(), userID, &speech.Request{
+		Provider: c.Query("provider"),
+		Voice:    c.Query("voice"),
+		Text:     message.Content,
+	})
+	switch {
+	case errors.Is(err, speech.ErrUnknownProvider),
+		errors.Is(err, speech.ErrProviderNotReady),
+		errors.Is(err, speech.ErrNoProvider):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, speech.ErrNothingToSpeak):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case err != nil:
+		log.Printf("Failed to synthesize speech for message %s: %v", message.ID, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to synthesize speech",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, result.ContentType)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set("X-Speech-Provider", result.Provider)
+	return c.SendStream(result.Audio)
+}
+
+// ListProviders returns the speech providers available to the user. The
+// first one is used when a request doesn't name a provider.
+func (h *SpeechHandler) ListProviders(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"providers": h.service.Providers(userID),
+	})
+}
+
+// resolveMessage checks that the user may read the conversation and that the
+// message is an assistant message in it
+func (h *SpeechHandler) resolveMessage(convID, messageID, userID string) (*repository.Message, int, string) {
+	conv, status, msg := getReadableConversation(h.conversationRepo, h.shareRepo, convID, userID, false)
+	if conv == nil {
+		return nil, status, msg
+	}
+
+	message, err := h.messageRepo.GetByID(messageID)
+	if err != nil {
+		return nil, fiber.StatusInternalServerError, "failed to get message"
+	}
+	if message == nil || message.ConversationID != conv.ID || message.Role != "assistant" {
+		return nil, fiber.StatusNotFound, "message not found"
+	}
+
+	return message, 0, ""
+}
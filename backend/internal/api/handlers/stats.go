@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+)
+
+// statsWindows are the time windows the usage overview can be requested for
+var statsWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+	"all": 0,
+}
+
+// defaultStatsWindow is used when no window is requested
+const defaultStatsWindow = "30d"
+
+// StatsHandler handles usage statistics endpoints
+type StatsHandler struct {
+	repo *repository.UsageRepository
+}
+
+// NewStatsHandler creates a new stats handler
+func NewStatsHandler(repo *repository.UsageRepository) *StatsHandler {
+	return &StatsHandler{repo: repo}
+}
+
+// StatsOverviewResponse represents the usage overview for a time window
+type StatsOverviewResponse struct {
+	Window string     `json:"window"`
+	Since  *time.Time `json:"since,omitempty"`
+	repository.UsageSummary
+	BuildMinutes float64                  `json:"build_minutes"`
+	Daily        []*repository.DailyUsage `json:"daily"`
+}
+
+// GetOverview returns the current user's usage over a time window, given by
+// the window query parameter (24h, 7d, 30d, 90d or all)
+func (h *StatsHandler) GetOverview(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	window := c.Query("window", defaultStatsWindow)
+	duration, ok := statsWindows[window]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "window must be one of 24h, 7d, 30d, 90d or all",
+		})
+	}
+
+	var since time.Time
+	response := StatsOverviewResponse{Window: window}
+	if duration > 0 {
+		since = time.Now().Add(-duration)
+		response.Since = &since
+	}
+
+	summary, err := h.repo.Summarize(userID, since)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get usage summary",
+		})
+	}
+
+	daily, err := h.repo.Daily(userID, since)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get daily usage",
+		})
+	}
+
+	response.UsageSummary = *summary
+	response.BuildMinutes = math.Round(float64(summary.BuildDurationMs)/600) / 100
+	response.Daily = daily
+
+	return c.JSON(response)
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+)
+
+// timelinePreviewLength is how much of a message or tool result a timeline
+// event shows
+const timelinePreviewLength = 200
+
+// Timeline event types
+const (
+	TimelineMessage       = "message"
+	TimelineToolStarted   = "tool.started"
+	TimelineToolCompleted = "tool.completed"
+	TimelineFileChanged   = "file.changed"
+)
+
+// TimelineHandler handles a conversation's timeline: its messages, tool
+// calls, file changes, agent runs and builds in the order they happened
+type TimelineHandler struct {
+	conversationRepo *repository.ConversationRepository
+	messageRepo      *repository.MessageRepository
+	shareRepo        *repository.ConversationShareRepository
+	fileHistoryRepo  *repository.FileHistoryRepository
+	usageRepo        *repository.UsageRepository
+}
+
+// NewTimelineHandler creates a new timeline handler. The file history and
+// usage repositories are optional; without them, file changes or agent runs
+// and builds are left out.
+func NewTimelineHandler(
+	conversationRepo *repository.ConversationRepository,
+	messageRepo *repository.MessageRepository,
+	shareRepo *repository.ConversationShareRepository,
+	fileHistoryRepo *repository.FileHistoryRepository,
+	usageRepo *repository.UsageRepository,
+) *TimelineHandler {
+	return &TimelineHandler{
+		conversationRepo: conversationRepo,
+		messageRepo:      messageRepo,
+		shareRepo:        shareRepo,
+		fileHistoryRepo:  fileHistoryRepo,
+		usageRepo:        usageRepo,
+	}
+}
+
+// TimelineEvent is one entry of a conversation's timeline
+type TimelineEvent struct {
+	Type      string                 `json:"type"` // One of the Timeline constants, or e.g. "agent.completed" or "build.failed"
+	Time      time.Time              `json:"time"`
+	TurnID    string                 `json:"turn_id,omitempty"`    // The user message that started the turn it happened in
+	MessageID string                 `json:"message_id,omitempty"` // The message it was recorded in
+	Data      map[string]interface{} `json:"data"`
+}
+
+// GetTimeline returns a conversation's events, oldest first. types, a
+// comma-separated list such as "tool.started,tool.completed", limits them to
+// those types; a type ending in "*" matches by prefix, e.g. "build.*".
+func (h *TimelineHandler) GetTimeline(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	conv, status, msg := getReadableConversation(h.conversationRepo, h.shareRepo, c.Params("id"), userID, false)
+	if conv == nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	messages, err := h.messageRepo.ListByConversationID(conv.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get messages",
+		})
+	}
+	events := messageEvents(messages)
+
+	if h.fileHistoryRepo != nil {
+		changes, err := h.fileHistoryRepo.ListChangesByConversation(conv.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to get file changes",
+			})
+		}
+		for _, change := range changes {
+			events = append(events, TimelineEvent{
+				Type:   TimelineFileChanged,
+				Time:   change.CreatedAt,
+				TurnID: change.TurnID,
+				Data: map[string]interface{}{
+					"history_id": change.ID,
+					"path":       change.FilePath,
+					"operation":  change.Operation,
+				},
+			})
+		}
+	}
+
+	if h.usageRepo != nil {
+		runs, err := h.usageRepo.ListByConversation(conv.ID, repository.UsageKindAgent, repository.UsageKindBuild)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to get agent runs and builds",
+			})
+		}
+		for _, run := range runs {
+			events = append(events, TimelineEvent{
+				Type: run.Kind + "." + run.Status,
+				Time: run.CreatedAt,
+				Data: map[string]interface{}{
+					"name":        run.Name,
+					"duration_ms": run.DurationMs,
+					"started_at":  run.CreatedAt.Add(-time.Duration(run.DurationMs) * time.Millisecond),
+				},
+			})
+		}
+	}
+
+	// Events from different sources interleave by time; those recorded at
+	// the same moment keep the order they were gathered in
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	assignTurns(events)
+
+	if filter := c.Query("types"); filter != "" {
+		events = filterTimeline(events, strings.Split(filter, ","))
+	}
+
+	return c.JSON(fiber.Map{
+		"events": events,
+		"total":  len(events),
+	})
+}
+
+// messageEvents turns messages into timeline events: one per message with
+// text, plus a tool.started for each tool call and a tool.completed for each
+// tool result
+func messageEvents(messages []*repository.Message) []TimelineEvent {
+	// Tools run without confirmation finish before the message calling them
+	// is saved, so their calls are found up front and started just after the
+	// message before their result
+	calls := make(map[string]repository.ToolCall)
+	callMessages := make(map[string]*repository.Message)
+	for _, msg := range messages {
+		for _, tc := range msg.ToolCalls {
+			calls[tc.ID] = tc
+			callMessages[tc.ID] = msg
+		}
+	}
+	started := make(map[string]bool)
+	toolStarted := func(tc repository.ToolCall, at time.Time) TimelineEvent {
+		started[tc.ID] = true
+		return TimelineEvent{
+			Type:      TimelineToolStarted,
+			Time:      at,
+			MessageID: callMessages[tc.ID].ID,
+			Data: map[string]interface{}{
+				"tool_call_id": tc.ID,
+				"tool_name":    tc.Name,
+				"parameters":   tc.Parameters,
+			},
+		}
+	}
+
+	events := make([]TimelineEvent, 0, len(messages))
+	var previous time.Time
+	for _, msg := range messages {
+		if msg.Role == "tool" {
+			if tc, ok := calls[msg.ToolCallID]; ok && !started[tc.ID] {
+				at := previous
+				if at.IsZero() || callMessages[tc.ID].CreatedAt.Before(at) {
+					at = callMessages[tc.ID].CreatedAt
+				}
+				events = append(events, toolStarted(tc, at))
+			}
+
+			data := map[string]interface{}{
+				"tool_call_id": msg.ToolCallID,
+				"tool_name":    calls[msg.ToolCallID].Name,
+				"preview":      timelinePreview(msg.Content),
+			}
+			var result struct {
+				Success *bool `json:"success"`
+			}
+			if json.Unmarshal([]byte(msg.Content), &result) == nil && result.Success != nil {
+				data["success"] = *result.Success
+			}
+			events = append(events, TimelineEvent{
+				Type:      TimelineToolCompleted,
+				Time:      msg.CreatedAt,
+				MessageID: msg.ID,
+				Data:      data,
+			})
+			previous = msg.CreatedAt
+			continue
+		}
+
+		if msg.Content != "" || len(msg.ToolCalls) == 0 {
+			data := map[string]interface{}{
+				"role":    msg.Role,
+				"preview": timelinePreview(msg.Content),
+				"length":  len(msg.Content),
+			}
+			if msg.Status != "" {
+				data["status"] = msg.Status
+			}
+			events = append(events, TimelineEvent{
+				Type:      TimelineMessage,
+				Time:      msg.CreatedAt,
+				MessageID: msg.ID,
+				Data:      data,
+			})
+		}
+		for _, tc := range msg.ToolCalls {
+			if !started[tc.ID] {
+				events = append(events, toolStarted(tc, msg.CreatedAt))
+			}
+		}
+		previous = msg.CreatedAt
+	}
+	return events
+}
+
+// assignTurns sets the turn of events that don't have one to the latest user
+// message before them
+func assignTurns(events []TimelineEvent) {
+	turnID := ""
+	for i := range events {
+		if events[i].Type == TimelineMessage && events[i].Data["role"] == "user" {
+			turnID = events[i].MessageID
+		}
+		if events[i].TurnID == "" {
+			events[i].TurnID = turnID
+		}
+	}
+}
+
+// filterTimeline keeps the events whose type is in types, or starts with a
+// type ending in "*"
+func filterTimeline(events []TimelineEvent, types []string) []TimelineEvent {
+	filtered := make([]TimelineEvent, 0, len(events))
+	for _, event := range events {
+		for _, t := range types {
+			t = strings.TrimSpace(t)
+			if event.Type == t || (strings.HasSuffix(t, "*") && strings.HasPrefix(event.Type, strings.TrimSuffix(t, "*"))) {
+				filtered = append(filtered, event)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// timelinePreview returns the beginning of a message or tool result
+func timelinePreview(content string) string {
+	if len(content) <= timelinePreviewLength {
+		return content
+	}
+	return strings.ToValidUTF8(content[:timelinePreviewLength], "") + "..."
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/sandbox"
+)
+
+// TodoHandler handles the workspace plan (todo list) endpoints
+type TodoHandler struct {
+	todoRepo       *repository.TodoRepository
+	sandboxService *sandbox.Service
+	onUpdate       func(userID, workspacePath string, todos []*repository.Todo)
+}
+
+// NewTodoHandler creates a new todo handler. onUpdate, if set, is called
+// with the full list after every change so connected clients can refresh.
+func NewTodoHandler(
+	todoRepo *repository.TodoRepository,
+	sandboxService *sandbox.Service,
+	onUpdate func(userID, workspacePath string, todos []*repository.Todo),
+) *TodoHandler {
+	return &TodoHandler{
+		todoRepo:       todoRepo,
+		sandboxService: sandboxService,
+		onUpdate:       onUpdate,
+	}
+}
+
+// TodoDTO represents a todo response
+type TodoDTO struct {
+	ID         string    `json:"id"`
+	Content    string    `json:"content"`
+	ActiveForm string    `json:"active_form"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// TodoInput represents a todo in a replace request
+type TodoInput struct {
+	ID         string `json:"id,omitempty"`
+	Content    string `json:"content" validate:"required,max=1000"`
+	ActiveForm string `json:"active_form,omitempty" validate:"max=1000"`
+	Status     string `json:"status,omitempty" validate:"oneof=pending in_progress completed"`
+}
+
+// ReplaceTodosRequest represents a request to replace the whole plan
+type ReplaceTodosRequest struct {
+	Todos []TodoInput `json:"todos" validate:"max=200"`
+}
+
+// UpdateTodoRequest represents a request to change a todo's status
+type UpdateTodoRequest struct {
+	Status string `json:"status" validate:"required,oneof=pending in_progress completed"`
+}
+
+// ListTodos returns the plan for the user's current workspace
+func (h *TodoHandler) ListTodos(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	workspacePath, err := h.sandboxService.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get workspace",
+		})
+	}
+
+	todos, err := h.todoRepo.GetAll(userID, workspacePath)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list todos",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"workspace_path": workspacePath,
+		"todos":          toTodoDTOs(todos),
+	})
+}
+
+// ReplaceTodos replaces the plan for the user's current workspace
+func (h *TodoHandler) ReplaceTodos(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req ReplaceTodosRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	workspacePath, err := h.sandboxService.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get workspace",
+		})
+	}
+
+	todos := make([]repository.Todo, 0, len(req.Todos))
+	for _, input := range req.Todos {
+		content := strings.TrimSpace(input.Content)
+		if content == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "todo content is required",
+			})
+		}
+
+		status := input.Status
+		if status == "" {
+			status = repository.TodoStatusPending
+		}
+		if !repository.IsValidTodoStatus(status) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "status must be pending, in_progress, or completed",
+			})
+		}
+
+		activeForm := input.ActiveForm
+		if activeForm == "" {
+			activeForm = content
+		}
+
+		todos = append(todos, repository.Todo{
+			ID:            input.ID,
+			UserID:        userID,
+			WorkspacePath: workspacePath,
+			Content:       content,
+			ActiveForm:    activeForm,
+			Status:        status,
+		})
+	}
+
+	if err := h.todoRepo.ReplaceAll(userID, workspacePath, todos); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save todos",
+		})
+	}
+
+	return h.respondWithPlan(c, userID, workspacePath)
+}
+
+// UpdateTodo changes the status of a single todo, e.g. when the user checks it off
+func (h *TodoHandler) UpdateTodo(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req UpdateTodoRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	todo, err := h.todoRepo.GetByID(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get todo",
+		})
+	}
+	if todo == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "todo not found",
+		})
+	}
+	if todo.UserID != userID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "access denied",
+		})
+	}
+
+	if err := h.todoRepo.UpdateStatus(todo.ID, req.Status); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update todo",
+		})
+	}
+
+	return h.respondWithPlan(c, userID, todo.WorkspacePath)
+}
+
+// ClearTodos removes the plan for the user's current workspace
+func (h *TodoHandler) ClearTodos(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	workspacePath, err := h.sandboxService.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get workspace",
+		})
+	}
+
+	if err := h.todoRepo.DeleteAll(userID, workspacePath); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to clear todos",
+		})
+	}
+
+	return h.respondWithPlan(c, userID, workspacePath)
+}
+
+// respondWithPlan reloads the plan, notifies listeners and returns it
+func (h *TodoHandler) respondWithPlan(c *fiber.Ctx, userID, workspacePath string) error {
+	todos, err := h.todoRepo.GetAll(userID, workspacePath)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list todos",
+		})
+	}
+
+	if h.onUpdate != nil {
+		h.onUpdate(userID, workspacePath, todos)
+	}
+
+	return c.JSON(fiber.Map{
+		"workspace_path": workspacePath,
+		"todos":          toTodoDTOs(todos),
+	})
+}
+
+// toTodoDTOs converts todos to their response form
+func toTodoDTOs(todos []*repository.Todo) []TodoDTO {
+	dtos := make([]TodoDTO, len(todos))
+	for i, todo := range todos {
+		dtos[i] = TodoDTO{
+			ID:         todo.ID,
+			Content:    todo.Content,
+			ActiveForm: todo.ActiveForm,
+			Status:     todo.Status,
+			CreatedAt:  todo.CreatedAt,
+			UpdatedAt:  todo.UpdatedAt,
+		}
+	}
+	return dtos
+}
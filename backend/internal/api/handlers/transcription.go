@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/services/transcription"
+)
+
+// TranscriptionHandler handles speech-to-text for voice input
+type TranscriptionHandler struct {
+	service  *transcription.Service
+	maxBytes int64
+}
+
+// NewTranscriptionHandler creates a new transcription handler. Audio uploads
+// larger than maxBytes are rejected.
+func NewTranscriptionHandler(service *transcription.Service, maxBytes int64) *TranscriptionHandler {
+	return &TranscriptionHandler{
+		service:  service,
+		maxBytes: maxBytes,
+	}
+}
+
+// Transcribe converts an uploaded audio file to text. The audio is sent as
+// the multipart field "file"; "provider", "language" and "prompt" are
+// optional form fields.
+func (h *TranscriptionHandler) Transcribe(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "audio file is required",
+		})
+	}
+	if h.maxBytes > 0 && fileHeader.Size > h.maxBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": "audio file is too large",
+		})
+	}
+
+	audio, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to read audio file",
+		})
+	}
+	defer audio.Close()
+
+	result, err := h.service.Transcribe(c.Context(), userID, &transcription.Request{
+		Provider: c.FormValue("provider"),
+		Filename: fileHeader.Filename,
+		Audio:    audio,
+		Language: c.FormValue("language"),
+		Prompt:   c.FormValue("prompt"),
+	})
+	switch {
+	case errors.Is(err, transcription.ErrUnsupportedFormat),
+		errors.Is(err, transcription.ErrUnknownProvider),
+		errors.Is(err, transcription.ErrProviderNotReady),
+		errors.Is(err, transcription.ErrNoProvider):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, transcription.ErrTranscriptionEmpty):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "no speech was recognized",
+		})
+	case err != nil:
+		log.Printf("Failed to transcribe audio for user %s: %v", userID, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to transcribe audio",
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// ListProviders returns the transcription providers available to the user.
+// The first one is used when a request doesn't name a provider.
+func (h *TranscriptionHandler) ListProviders(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"providers": h.service.Providers(userID),
+	})
+}
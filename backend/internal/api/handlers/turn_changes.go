@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/services/changes"
+)
+
+// TurnChangesHandler handles reviewing and reverting the file changes made
+// during an assistant turn. A turn is identified by the ID of the user
+// message that started it.
+type TurnChangesHandler struct {
+	conversationRepo *repository.ConversationRepository
+	messageRepo      *repository.MessageRepository
+	shareRepo        *repository.ConversationShareRepository
+	changeService    *changes.Service
+}
+
+// NewTurnChangesHandler creates a new turn changes handler
+func NewTurnChangesHandler(
+	conversationRepo *repository.ConversationRepository,
+	messageRepo *repository.MessageRepository,
+	shareRepo *repository.ConversationShareRepository,
+	changeService *changes.Service,
+) *TurnChangesHandler {
+	return &TurnChangesHandler{
+		conversationRepo: conversationRepo,
+		messageRepo:      messageRepo,
+		shareRepo:        shareRepo,
+		changeService:    changeService,
+	}
+}
+
+// GetChanges returns the files changed in the user's workspace during a turn
+func (h *TurnChangesHandler) GetChanges(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	turnID, status, msg := h.resolveTurn(c.Params("id"), c.Params("turnId"), userID, false)
+	if turnID == "" {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	set, err := h.changeService.Summarize(userID, turnID)
+	if err != nil {
+		log.Printf("Failed to summarize changes for turn %s: %v", turnID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get changes",
+		})
+	}
+
+	return c.JSON(set)
+}
+
+// RevertTurn restores every file changed during a turn to its previous state
+func (h *TurnChangesHandler) RevertTurn(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	turnID, status, msg := h.resolveTurn(c.Params("id"), c.Params("turnId"), userID, true)
+	if turnID == "" {
+		return c.Status(status).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	result, err := h.changeService.Revert(userID, turnID)
+	if err != nil {
+		log.Printf("Failed to revert turn %s: %v", turnID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to revert changes",
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// resolveTurn checks that the user may access the conversation and that the
+// turn is a user message in it. Reverting requires owner or editor access.
+func (h *TurnChangesHandler) resolveTurn(convID, turnID, userID string, write bool) (string, int, string) {
+	conv, status, msg := getReadableConversation(h.conversationRepo, h.shareRepo, convID, userID, write)
+	if conv == nil {
+		return "", status, msg
+	}
+
+	message, err := h.messageRepo.GetByID(turnID)
+	if err != nil {
+		return "", fiber.StatusInternalServerError, "failed to get turn"
+	}
+	if message == nil || message.ConversationID != conv.ID || message.Role != "user" {
+		return "", fiber.StatusNotFound, "turn not found"
+	}
+
+	return message.ID, 0, ""
+}
@@ -2,25 +2,31 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/database/repository"
 	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/services/onboarding"
 	"github.com/sqweek/dialog"
 )
 
 // WorkspaceHandler handles workspace-related HTTP requests
 type WorkspaceHandler struct {
 	sandboxService *sandbox.Service
+	analyzer       *onboarding.Analyzer // Summarizes cloned repositories, if set
 }
 
 // NewWorkspaceHandler creates a new workspace handler
-func NewWorkspaceHandler(sandboxService *sandbox.Service) *WorkspaceHandler {
+func NewWorkspaceHandler(sandboxService *sandbox.Service, analyzer *onboarding.Analyzer) *WorkspaceHandler {
 	return &WorkspaceHandler{
 		sandboxService: sandboxService,
+		analyzer:       analyzer,
 	}
 }
 
@@ -32,26 +38,11 @@ func (h *WorkspaceHandler) SetDirectory(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
 	var req struct {
-		Directory string `json:"directory"`
+		Directory string `json:"directory" validate:"required,max=4096"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
-	}
-
-	if req.Directory == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "directory is required",
-		})
-	}
-
-	// Validate path length to prevent DOS
-	if len(req.Directory) > maxPathLength {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": fmt.Sprintf("directory path too long (max %d characters)", maxPathLength),
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Validate no null bytes (can cause issues in C-based file systems)
@@ -134,25 +125,18 @@ func (h *WorkspaceHandler) GetDirectory(c *fiber.Ctx) error {
 	})
 }
 
-// CloneGitHubRepo clones a GitHub repository into the workspace
+// CloneGitHubRepo clones a GitHub repository into the workspace and starts
+// an onboarding analysis of it
 func (h *WorkspaceHandler) CloneGitHubRepo(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
 	var req struct {
-		RepoURL string `json:"repo_url"`
-		Branch  string `json:"branch"`
+		RepoURL string `json:"repo_url" validate:"required,max=2048"`
+		Branch  string `json:"branch" validate:"max=255"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
-		})
-	}
-
-	if req.RepoURL == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "repo_url is required",
-		})
+	if err := parseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Validate URL format (basic check)
@@ -200,11 +184,23 @@ func (h *WorkspaceHandler) CloneGitHubRepo(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(fiber.Map{
+	response := fiber.Map{
 		"success": true,
 		"path":    clonePath,
 		"message": fmt.Sprintf("Successfully cloned %s", repoName),
-	})
+	}
+
+	// Explain the new repository in the background; chats in the workspace
+	// pick up the summary once it is ready
+	if h.analyzer != nil {
+		if summary, err := h.analyzer.AnalyzeClone(userID, repoName); err != nil {
+			log.Printf("Failed to start analysis of cloned repository %s: %v", clonePath, err)
+		} else {
+			response["summary_status"] = summary.Status
+		}
+	}
+
+	return c.JSON(response)
 }
 
 // OpenFolderPicker opens the native OS folder picker dialog and returns the selected path
@@ -494,6 +490,15 @@ func (h *WorkspaceHandler) RemoveWorkspace(c *fiber.Ctx) error {
 		})
 	}
 
+	// Close it first if it is open as a root
+	if roots, err := h.sandboxService.Roots(userID); err == nil {
+		for _, root := range roots {
+			if root.Path == workspace.Path && !root.Default {
+				_ = h.sandboxService.RemoveRoot(userID, root.Name)
+			}
+		}
+	}
+
 	if err := repo.Delete(workspaceID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("failed to remove workspace: %v", err),
@@ -564,29 +569,62 @@ func (h *WorkspaceHandler) SetCurrentWorkspace(c *fiber.Ctx) error {
 	})
 }
 
-// RenameFile renames a file in the workspace
-func (h *WorkspaceHandler) RenameFile(c *fiber.Ctx) error {
+// ListRoots lists the user's workspace roots. With a conversation_id query
+// parameter it also returns the root that conversation's tools default to.
+func (h *WorkspaceHandler) ListRoots(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	roots, err := h.sandboxService.Roots(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("failed to list workspace roots: %v", err),
+		})
+	}
+
+	response := fiber.Map{
+		"roots": roots,
+	}
+	if conversationID := c.Query("conversation_id"); conversationID != "" {
+		response["active"] = h.sandboxService.ActiveRoot(userID, conversationID)
+	}
+	return c.JSON(response)
+}
+
+// AddRoot opens another directory alongside the current workspace
+func (h *WorkspaceHandler) AddRoot(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
 	var req struct {
-		SourcePath string `json:"source_path"`
-		DestPath   string `json:"dest_path"`
+		Path string `json:"path" validate:"required,max=4096"`
+		Name string `json:"name" validate:"max=64"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if strings.ContainsRune(req.Path, '\x00') || !filepath.IsAbs(req.Path) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
+			"error": "path must be an absolute directory path",
 		})
 	}
 
-	if req.SourcePath == "" || req.DestPath == "" {
+	root, err := h.sandboxService.AddRoot(userID, filepath.Clean(req.Path), req.Name)
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "source_path and dest_path are required",
+			"error": err.Error(),
 		})
 	}
 
-	if err := h.sandboxService.RenameFile(userID, req.SourcePath, req.DestPath); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	return c.Status(fiber.StatusCreated).JSON(root)
+}
+
+// RemoveRoot closes a workspace root. The directory itself is untouched.
+func (h *WorkspaceHandler) RemoveRoot(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	if err := h.sandboxService.RemoveRoot(userID, c.Params("name")); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
@@ -596,26 +634,175 @@ func (h *WorkspaceHandler) RenameFile(c *fiber.Ctx) error {
 	})
 }
 
-// CreateDirectory creates a directory in the workspace
-func (h *WorkspaceHandler) CreateDirectory(c *fiber.Ctx) error {
+// SetActiveRoot sets the root a conversation's file tools default to
+func (h *WorkspaceHandler) SetActiveRoot(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
 	var req struct {
-		Path string `json:"path"`
+		ConversationID string `json:"conversation_id" validate:"required"`
+		Name           string `json:"name"` // Empty for the default root
 	}
 
-	if err := c.BodyParser(&req); err != nil {
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if err := h.sandboxService.SetActiveRoot(userID, req.ConversationID, req.Name); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid request body",
+			"error": err.Error(),
 		})
 	}
 
-	if req.Path == "" {
+	return c.JSON(fiber.Map{
+		"success": true,
+		"active":  req.Name,
+	})
+}
+
+// WorkspaceSettingsRequest represents the settings of the current workspace.
+// It replaces any settings the workspace had.
+type WorkspaceSettingsRequest struct {
+	DefaultProvider string   `json:"default_provider" validate:"max=64"`
+	DefaultModel    string   `json:"default_model" validate:"max=200"`
+	AllowedTools    []string `json:"allowed_tools" validate:"max=100"`
+	InstructionFile string   `json:"instruction_file" validate:"max=1024"`
+	BuildCommand    string   `json:"build_command" validate:"max=1024"`
+	TestCommand     string   `json:"test_command" validate:"max=1024"`
+
+	Env map[string]string `json:"env" validate:"max=100"`
+}
+
+// envNamePattern matches names allowed in workspace env settings
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// GetSettings returns the settings of the current workspace
+func (h *WorkspaceHandler) GetSettings(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	settings, err := h.sandboxService.WorkspaceSettings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("failed to get workspace settings: %v", err),
+		})
+	}
+	if settings == nil {
+		settings = &repository.WorkspaceSettings{}
+	}
+
+	return c.JSON(settings)
+}
+
+// UpdateSettings replaces the settings of the current workspace
+func (h *WorkspaceHandler) UpdateSettings(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var req WorkspaceSettingsRequest
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if req.DefaultModel != "" && req.DefaultProvider == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "path is required",
+			"error": "default_model requires default_provider",
+		})
+	}
+	instructionFile := ""
+	if req.InstructionFile != "" {
+		instructionFile = filepath.ToSlash(filepath.Clean(req.InstructionFile))
+		if filepath.IsAbs(req.InstructionFile) || instructionFile == ".." || strings.HasPrefix(instructionFile, "../") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "instruction_file must be a path inside the workspace",
+			})
+		}
+	}
+
+	for key, value := range req.Env {
+		if !envNamePattern.MatchString(key) || len(key) > 256 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid env variable name: " + key,
+			})
+		}
+		if !sandbox.IsAllowedEnvName(key) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "env variable " + key + " can't be set; only variables commands read as plain values are allowed",
+			})
+		}
+		if len(value) > 8192 || strings.ContainsRune(value, 0) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid value for env variable " + key,
+			})
+		}
+	}
+
+	settings := &repository.WorkspaceSettings{
+		DefaultProvider: req.DefaultProvider,
+		DefaultModel:    req.DefaultModel,
+		AllowedTools:    req.AllowedTools,
+		InstructionFile: instructionFile,
+		BuildCommand:    strings.TrimSpace(req.BuildCommand),
+		TestCommand:     strings.TrimSpace(req.TestCommand),
+		Env:             req.Env,
+	}
+	if err := h.sandboxService.SetWorkspaceSettings(userID, settings); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("failed to save workspace settings: %v", err),
+		})
+	}
+
+	return c.JSON(settings)
+}
+
+// DeleteSettings clears the settings of the current workspace
+func (h *WorkspaceHandler) DeleteSettings(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	if err := h.sandboxService.SetWorkspaceSettings(userID, nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("failed to clear workspace settings: %v", err),
 		})
 	}
 
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// RenameFile renames a file in the workspace
+func (h *WorkspaceHandler) RenameFile(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var req struct {
+		SourcePath string `json:"source_path" validate:"required"`
+		DestPath   string `json:"dest_path" validate:"required"`
+	}
+
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if err := h.sandboxService.RenameFile(userID, req.SourcePath, req.DestPath); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// CreateDirectory creates a directory in the workspace
+func (h *WorkspaceHandler) CreateDirectory(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var req struct {
+		Path string `json:"path" validate:"required"`
+	}
+
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
 	if err := h.sandboxService.CreateDirectory(userID, req.Path); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
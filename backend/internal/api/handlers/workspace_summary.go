@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/services/onboarding"
+)
+
+// WorkspaceSummaryHandler handles onboarding summaries of workspace
+// repositories
+type WorkspaceSummaryHandler struct {
+	analyzer *onboarding.Analyzer
+}
+
+// NewWorkspaceSummaryHandler creates a new workspace summary handler
+func NewWorkspaceSummaryHandler(analyzer *onboarding.Analyzer) *WorkspaceSummaryHandler {
+	return &WorkspaceSummaryHandler{analyzer: analyzer}
+}
+
+// AnalyzeWorkspace starts an onboarding analysis of a workspace directory
+// and returns its running summary. Poll GetSummary for the result.
+func (h *WorkspaceSummaryHandler) AnalyzeWorkspace(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req onboarding.Request
+	if err := parseBody(c, &req); err != nil {
+		return err
+	}
+
+	summary, err := h.analyzer.Analyze(userID, req)
+	if err != nil {
+		return summaryError(c, err, "failed to start analysis")
+	}
+	return c.Status(fiber.StatusAccepted).JSON(summary)
+}
+
+// GetSummary returns the onboarding summary of a workspace directory, given
+// by the dir query parameter
+func (h *WorkspaceSummaryHandler) GetSummary(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	summary, err := h.analyzer.Get(userID, c.Query("dir"))
+	if err != nil {
+		return summaryError(c, err, "failed to get summary")
+	}
+	if summary == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "directory has not been analyzed",
+		})
+	}
+	return c.JSON(summary)
+}
+
+// DeleteSummary removes the onboarding summary of a workspace directory, so
+// it is no longer added to chats
+func (h *WorkspaceSummaryHandler) DeleteSummary(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	removed, err := h.analyzer.Delete(userID, c.Query("dir"))
+	if err != nil {
+		return summaryError(c, err, "failed to delete summary")
+	}
+	if !removed {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "directory has not been analyzed",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// summaryError responds to a failed summary request
+func summaryError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, onboarding.ErrInvalidRequest),
+		errors.Is(err, onboarding.ErrNoAPIKey):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, onboarding.ErrAlreadyRunning):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	log.Printf("Workspace summary request failed: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireAdmin only lets through authenticated users whose email is one of
+// emails. Use it after AuthMiddleware.
+func RequireAdmin(emails []string) fiber.Handler {
+	admins := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		admins[strings.ToLower(email)] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		if !admins[strings.ToLower(GetEmail(c))] {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "admin access required",
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/apierror"
+)
+
+// ErrorCodes adds a machine-readable code, derived from the status, to JSON
+// error responses written without one, so every error follows the
+// apierror envelope
+func ErrorCodes() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		resp := c.Response()
+		status := resp.StatusCode()
+		if status < fiber.StatusBadRequest || resp.IsBodyStream() {
+			return nil
+		}
+		if !strings.HasPrefix(string(resp.Header.ContentType()), fiber.MIMEApplicationJSON) {
+			return nil
+		}
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(resp.Body(), &body); err != nil {
+			return nil
+		}
+		if _, ok := body["error"].(string); !ok {
+			return nil
+		}
+		if _, ok := body["code"]; ok {
+			return nil
+		}
+
+		body["code"] = apierror.CodeForStatus(status)
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil
+		}
+		resp.SetBodyRaw(data)
+		return nil
+	}
+}
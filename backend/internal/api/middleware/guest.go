@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/services/guest"
+)
+
+// DenyGuests rejects guests with a 403. Use it on authenticated routes that
+// reach outside the guest's own workspace or run arbitrary commands.
+func DenyGuests(guests *guest.Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if guests.IsGuest(GetUserID(c)) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "not available to guest users",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// GuestActivity records authenticated requests as guest activity, so guests
+// who are still using the app aren't purged
+func GuestActivity(guests *guest.Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		guests.Touch(GetUserID(c))
+		return err
+	}
+}
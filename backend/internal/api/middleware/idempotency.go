@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/database/repository"
+)
+
+const (
+	// IdempotencyKeyHeader names the header clients set to make a request
+	// safe to retry
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// maxIdempotencyKeyLength bounds keys; UUIDs and similar fit easily
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency makes POST endpoints with side effects safe to retry. A
+// request sent with an Idempotency-Key header runs once per user and key;
+// retries within ttl get the stored response back, marked with an
+// Idempotent-Replayed header, instead of running again. Requests without
+// the header run normally. Must come after AuthMiddleware.
+func Idempotency(repo *repository.IdempotencyRepository, ttl time.Duration) fiber.Handler {
+	var cleanupMu sync.Mutex
+	var lastCleanup time.Time
+
+	return func(c *fiber.Ctx) error {
+		key := c.Get(IdempotencyKeyHeader)
+		userID := GetUserID(c)
+		if repo == nil || key == "" || userID == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Idempotency-Key must be at most 255 characters",
+			})
+		}
+
+		// Expired keys are removed when a lookup finds them; sweep the rest
+		// occasionally so the table doesn't grow
+		cleanupMu.Lock()
+		if time.Since(lastCleanup) > time.Hour {
+			lastCleanup = time.Now()
+			go func() {
+				if _, err := repo.DeleteExpired(); err != nil {
+					log.Printf("Failed to delete expired idempotency keys: %v", err)
+				}
+			}()
+		}
+		cleanupMu.Unlock()
+
+		scope := c.Method() + " " + c.Path()
+		hash := sha256.Sum256(append([]byte(scope+"\n"), c.Body()...))
+		existing, err := repo.Begin(&repository.IdempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			Scope:       scope,
+			RequestHash: hex.EncodeToString(hash[:]),
+			ExpiresAt:   time.Now().Add(ttl),
+		})
+		if err != nil {
+			log.Printf("Idempotency lookup failed: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to check idempotency key",
+			})
+		}
+
+		if existing != nil {
+			return replayIdempotent(c, existing, hex.EncodeToString(hash[:]))
+		}
+
+		if err := c.Next(); err != nil {
+			// The app's error handler writes the response after this returns;
+			// nothing was stored, so the request may be retried
+			if releaseErr := repo.Release(userID, key); releaseErr != nil {
+				log.Printf("Failed to release idempotency key: %v", releaseErr)
+			}
+			return err
+		}
+
+		resp := c.Response()
+		status := resp.StatusCode()
+		if status >= fiber.StatusInternalServerError || resp.IsBodyStream() {
+			// Server errors are worth retrying, and streams can't be replayed
+			if err := repo.Release(userID, key); err != nil {
+				log.Printf("Failed to release idempotency key: %v", err)
+			}
+			return nil
+		}
+
+		if err := repo.Complete(userID, key, status, string(resp.Header.ContentType()), resp.Body()); err != nil {
+			log.Printf("Failed to store idempotent response: %v", err)
+		}
+		return nil
+	}
+}
+
+// replayIdempotent answers a retried request from its stored record
+func replayIdempotent(c *fiber.Ctx, record *repository.IdempotencyRecord, requestHash string) error {
+	if record.RequestHash != requestHash {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "Idempotency-Key was already used for a different request",
+		})
+	}
+	if !record.Completed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "a request with this Idempotency-Key is still in progress",
+		})
+	}
+
+	c.Set("Idempotent-Replayed", "true")
+	if record.ContentType != "" {
+		c.Set(fiber.HeaderContentType, record.ContentType)
+	}
+	return c.Status(record.ResponseStatus).Send(record.ResponseBody)
+}
@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/jacklau/prism/internal/services/ratelimit"
 )
 
 // RateLimiter creates a rate limiting middleware with the given configuration
@@ -46,3 +49,35 @@ func StrictRateLimiter(maxRequests int, window time.Duration) fiber.Handler {
 		},
 	})
 }
+
+// SlidingRateLimit applies the named limiter from limits, keyed by client IP,
+// or by user ID on authenticated routes. Rejected requests get a 429 with
+// Retry-After.
+func SlidingRateLimit(limits *ratelimit.Set, name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.IP()
+		if userID := GetUserID(c); userID != "" {
+			key = userID
+		}
+
+		ok, retryAfter := limits.Allow(name, key)
+		if ok {
+			return c.Next()
+		}
+
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(RetryAfterSeconds(retryAfter)))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":   "rate limit exceeded",
+			"message": "Too many requests. Please wait before trying again.",
+		})
+	}
+}
+
+// RetryAfterSeconds rounds a wait up to whole seconds, as Retry-After expects
+func RetryAfterSeconds(d time.Duration) int {
+	secs := int(math.Ceil(d.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
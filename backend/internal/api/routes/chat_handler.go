@@ -3,21 +3,28 @@ package routes
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/api/apierror"
 	"github.com/jacklau/prism/internal/api/websocket"
 	"github.com/jacklau/prism/internal/database/repository"
 	"github.com/jacklau/prism/internal/llm"
 	"github.com/jacklau/prism/internal/mcp"
+	"github.com/jacklau/prism/internal/services/instructions"
 	"github.com/jacklau/prism/internal/tools"
 	"github.com/jacklau/prism/internal/tools/builtin"
 )
 
-// activeGenerations tracks active chat generations for cancellation
-var activeGenerations = sync.Map{} // map[conversationID]context.CancelFunc
+// conversationParticipants caches the users with access to a shared conversation
+var conversationParticipants = sync.Map{} // map[conversationID][]string
+
+// titlingConversations tracks conversations with a title generation in progress
+var titlingConversations = sync.Map{} // map[conversationID]bool
 
 // iterationCounts tracks the number of tool executions per conversation for agentic loops
 var iterationCounts = sync.Map{} // map[conversationID]int
@@ -54,17 +61,259 @@ func resetIterationCount(conversationID string) {
 	iterationCounts.Delete(conversationID)
 }
 
-// getDefaultAutoApprovalConfig returns a default auto-approval config
-// In a full implementation, this would be loaded from user settings
-func getDefaultAutoApprovalConfig() *tools.AutoApprovalConfig {
-	return tools.DefaultAutoApprovalConfig()
+// pausedToolCall is a tool call held back because the agentic loop reached its
+// iteration cap; it is executed once the user sends agent.continue
+type pausedToolCall struct {
+	MessageID string
+	ToolCall  llm.ToolCall
+}
+
+// pausedToolCalls tracks tool calls waiting on a check-in, per conversation
+var (
+	pausedToolCalls   = make(map[string][]*pausedToolCall)
+	pausedToolCallsMu sync.Mutex
+)
+
+// takePausedToolCalls removes and returns the paused tool calls for a conversation
+func takePausedToolCalls(conversationID string) []*pausedToolCall {
+	pausedToolCallsMu.Lock()
+	defer pausedToolCallsMu.Unlock()
+	calls := pausedToolCalls[conversationID]
+	delete(pausedToolCalls, conversationID)
+	return calls
+}
+
+// checkIterationCap counts a tool call against the conversation's iteration cap.
+// Once the cap is reached the call is parked, the participants are asked to
+// check in, and false is returned so the caller stops the loop.
+func checkIterationCap(deps *Dependencies, client *websocket.Client, conversationID, messageID string, tc llm.ToolCall) bool {
+	approvalConfig := autoApprovalConfig(deps, client.UserID)
+	iterationCount := getIterationCount(conversationID)
+	if !approvalConfig.ShouldCheckIn(iterationCount) {
+		incrementIterationCount(conversationID)
+		return true
+	}
+
+	pausedToolCallsMu.Lock()
+	first := len(pausedToolCalls[conversationID]) == 0
+	pausedToolCalls[conversationID] = append(pausedToolCalls[conversationID], &pausedToolCall{
+		MessageID: messageID,
+		ToolCall:  tc,
+	})
+	pausedToolCallsMu.Unlock()
+
+	// Several tool calls may arrive in one response; only check in once
+	if first {
+		sendToParticipants(deps, client, conversationID, websocket.NewAgentCheckIn(
+			conversationID,
+			iterationCount,
+			"Agent has reached the maximum number of tool executions. Would you like to continue?",
+		))
+	}
+	return false
+}
+
+// accessOwner is the access level of a conversation's owner, alongside the share roles
+const accessOwner = "owner"
+
+// conversationAccess returns the caller's access level on a conversation:
+// "owner", a share role ("editor" or "viewer"), or "" if they have no access.
+// It also refreshes the cached participant list used for broadcasting.
+func conversationAccess(deps *Dependencies, conversation *repository.Conversation, userID string) (string, error) {
+	if deps.ConversationShareRepo == nil {
+		if conversation.UserID == userID {
+			return accessOwner, nil
+		}
+		return "", nil
+	}
+
+	shares, err := deps.ConversationShareRepo.ListByConversationID(conversation.ID)
+	if err != nil {
+		return "", err
+	}
+
+	participants := []string{conversation.UserID}
+	access := ""
+	if conversation.UserID == userID {
+		access = accessOwner
+	}
+	for _, share := range shares {
+		participants = append(participants, share.UserID)
+		if share.UserID == userID {
+			access = share.Role
+		}
+	}
+	conversationParticipants.Store(conversation.ID, participants)
+
+	return access, nil
+}
+
+// refreshConversationParticipants reloads the cached participants of a
+// conversation after its shares change, and drops them once it is deleted
+func refreshConversationParticipants(deps *Dependencies, conversationID string) {
+	if _, ok := conversationParticipants.Load(conversationID); !ok {
+		return
+	}
+	conversation, err := deps.ConversationRepo.GetByID(conversationID)
+	if err != nil || conversation == nil {
+		conversationParticipants.Delete(conversationID)
+		return
+	}
+	if _, err := conversationAccess(deps, conversation, ""); err != nil {
+		conversationParticipants.Delete(conversationID)
+	}
+}
+
+// canSendToConversation reports whether an access level allows driving the conversation
+func canSendToConversation(access string) bool {
+	return access == accessOwner || access == repository.ShareRoleEditor
+}
+
+// broadcastToParticipants sends a message to every participant of a shared
+// conversation except excludeUserID
+func broadcastToParticipants(deps *Dependencies, conversationID, excludeUserID string, msg *websocket.OutgoingMessage) {
+	if deps.WSHub == nil {
+		return
+	}
+	val, ok := conversationParticipants.Load(conversationID)
+	if !ok {
+		return
+	}
+	for _, userID := range val.([]string) {
+		if userID != excludeUserID {
+			deps.WSHub.SendToUser(userID, msg)
+		}
+	}
+}
+
+// sendToParticipants sends a message to the client and mirrors it to the
+// other participants of the conversation
+func sendToParticipants(deps *Dependencies, client *websocket.Client, conversationID string, msg *websocket.OutgoingMessage) {
+	client.SendMessage(msg)
+	broadcastToParticipants(deps, conversationID, client.UserID, msg)
+}
+
+// trackToolExecuted records a finished tool execution with the integrations manager
+func trackToolExecuted(deps *Dependencies, userID, conversationID, executionID, toolName, status string) {
+	if deps.IntegrationManager != nil {
+		deps.IntegrationManager.TrackToolExecuted(userID, conversationID, executionID, toolName, status)
+	}
+}
+
+// toolProgressInterval is the least time between a tool's progress updates
+// sent to clients
+const toolProgressInterval = 250 * time.Millisecond
+
+// toolProgressReporter sends a running tool's progress to the conversation's
+// participants as tool.progress messages. Call stop once the execution
+// returns so a tool still running after a timeout sends nothing more.
+func toolProgressReporter(deps *Dependencies, client *websocket.Client, conversationID, executionID, toolName string) (report tools.ProgressReporter, stop func()) {
+	return tools.ThrottleProgress(func(p tools.Progress) {
+		sendToParticipants(deps, client, conversationID, websocket.NewToolProgress(conversationID, executionID, toolName, &websocket.ToolProgressInfo{
+			Message: p.Message,
+			Current: p.Current,
+			Total:   p.Total,
+		}))
+	}, toolProgressInterval)
+}
+
+// autoApprovalConfig returns the user's tool confirmation settings from
+// their preferences, or the defaults if they have none
+func autoApprovalConfig(deps *Dependencies, userID string) *tools.AutoApprovalConfig {
+	config := tools.DefaultAutoApprovalConfig()
+	if deps.PreferencesRepo == nil {
+		return config
+	}
+	prefs, err := deps.PreferencesRepo.Get(userID)
+	if err != nil {
+		log.Printf("Failed to get preferences for user %s: %v", userID, err)
+		return config
+	}
+	if prefs == nil {
+		return config
+	}
+
+	if prefs.MaxToolIterations > 0 {
+		config.MaxIterations = prefs.MaxToolIterations
+	}
+	switch prefs.ToolConfirmation {
+	case repository.ConfirmReadOnly:
+		config.Enabled = true
+		config.AutoApproveReadOnly = true
+	case repository.ConfirmTrusted:
+		config.Enabled = true
+		config.AutoApproveReadOnly = true
+		config.TrustedTools = prefs.TrustedTools
+	}
+	return config
+}
+
+// clientMessageIDKey holds the ID a client gave the chat.message a turn answers
+type clientMessageIDKey struct{}
+
+// withClientMessageID tags a turn's context with the ID the client gave its
+// chat.message, which the turn's chat.chunk and chat.complete messages echo
+func withClientMessageID(ctx context.Context, clientMessageID string) context.Context {
+	if clientMessageID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, clientMessageIDKey{}, clientMessageID)
+}
+
+// withClientMessageIDOf tags a context resuming a turn with the ID the client
+// gave the chat.message that started it, if it gave one
+func withClientMessageIDOf(ctx context.Context, deps *Dependencies, turnID string) context.Context {
+	if turnID == "" {
+		return ctx
+	}
+	turn, err := deps.MessageRepo.GetByID(turnID)
+	if err != nil || turn == nil {
+		return ctx
+	}
+	return withClientMessageID(ctx, turn.ClientMessageID)
+}
+
+// tagClientMessage sets the client message ID of the turn a context belongs
+// to on an outgoing message
+func tagClientMessage(ctx context.Context, msg *websocket.OutgoingMessage) *websocket.OutgoingMessage {
+	if id, ok := ctx.Value(clientMessageIDKey{}).(string); ok {
+		msg.ClientMessageID = id
+	}
+	return msg
+}
+
+// withConversationModel records the conversation's provider and model on a tool context
+func withConversationModel(ctx context.Context, provider, model string) context.Context {
+	ctx = context.WithValue(ctx, builtin.ProviderKey, provider)
+	return context.WithValue(ctx, builtin.ModelKey, model)
+}
+
+// turnModel returns the provider and model the latest turn of a conversation
+// runs on: the override recorded on its user message, or the conversation's
+func turnModel(deps *Dependencies, conversation *repository.Conversation) (string, string) {
+	messages, err := deps.MessageRepo.ListByConversationID(conversation.ID)
+	if err != nil {
+		return conversation.Provider, conversation.Model
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "user" {
+			continue
+		}
+		provider, _ := messages[i].Metadata["provider"].(string)
+		model, _ := messages[i].Metadata["model"].(string)
+		if provider != "" && model != "" {
+			return provider, model
+		}
+		break
+	}
+	return conversation.Provider, conversation.Model
 }
 
 // handleChatMessage handles incoming chat messages and streams LLM responses
 func handleChatMessage(deps *Dependencies, client *websocket.Client, msg *websocket.IncomingMessage) {
 	// Validate conversation ID
 	if msg.ConversationID == "" {
-		client.SendMessage(websocket.NewError("invalid_request", "conversation_id is required"))
+		client.SendMessage(websocket.NewError(apierror.CodeInvalidRequest, "conversation_id is required"))
 		return
 	}
 
@@ -75,34 +324,101 @@ func handleChatMessage(deps *Dependencies, client *websocket.Client, msg *websoc
 		return
 	}
 	if conversation == nil {
-		client.SendMessage(websocket.NewError("not_found", "conversation not found"))
+		client.SendMessage(websocket.NewError(apierror.CodeNotFound, "conversation not found"))
+		return
+	}
+
+	// Verify the user owns the conversation or is an editor on it
+	access, err := conversationAccess(deps, conversation, client.UserID)
+	if err != nil {
+		client.SendMessage(websocket.NewError("database_error", "failed to check conversation access: "+err.Error()))
+		return
+	}
+	if !canSendToConversation(access) {
+		client.SendMessage(websocket.NewError(apierror.CodeForbidden, "not authorized to access this conversation"))
 		return
 	}
 
-	// Verify the conversation belongs to the user
-	if conversation.UserID != client.UserID {
-		client.SendMessage(websocket.NewError("forbidden", "not authorized to access this conversation"))
+	// The message may run this turn on another provider or model
+	provider, model := conversation.Provider, conversation.Model
+	if msg.Provider != "" && msg.Model == "" {
+		client.SendMessage(websocket.NewError(apierror.CodeInvalidRequest, "model is required when overriding the provider"))
 		return
 	}
+	if msg.Model != "" {
+		model = msg.Model
+		if msg.Provider != "" {
+			provider = msg.Provider
+		}
+	}
 
-	// Create cancellable context
+	// Create cancellable context; only one generation may run per conversation
 	ctx, cancel := context.WithCancel(context.Background())
-	activeGenerations.Store(msg.ConversationID, cancel)
+	gen, ok := generations.start(msg.ConversationID, client.UserID, generationChat, cancel)
+	if !ok {
+		cancel()
+		if replayDuplicateMessage(deps, client, msg, true) {
+			return
+		}
+		client.SendMessage(websocket.NewError("conversation_busy", "a response is already being generated for this conversation"))
+		return
+	}
 	defer func() {
-		activeGenerations.Delete(msg.ConversationID)
+		generations.finish(gen)
 		cancel()
 	}()
 
-	// Reset iteration count for new user message
+	// A retry of a message that was already saved isn't answered twice
+	if replayDuplicateMessage(deps, client, msg, false) {
+		return
+	}
+
+	// Bump the conversation version, rejecting stale sends from other participants
+	version, err := deps.ConversationRepo.IncrementVersion(msg.ConversationID, msg.ExpectedVersion)
+	if err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			conflict := websocket.NewError("version_conflict", "conversation was updated by another participant")
+			conflict.ConversationID = msg.ConversationID
+			if current, err := deps.ConversationRepo.GetVersion(msg.ConversationID); err == nil {
+				conflict.Version = current
+			}
+			client.SendMessage(conflict)
+			return
+		}
+		client.SendMessage(websocket.NewError("database_error", "failed to update conversation: "+err.Error()))
+		return
+	}
+
+	// Reset iteration count for new user message, dropping any loop paused at a check-in
 	resetIterationCount(msg.ConversationID)
+	takePausedToolCalls(msg.ConversationID)
 
 	// Save user message to database
-	userMsg, err := deps.MessageRepo.Create(msg.ConversationID, "user", msg.Content, nil, "")
+	var userMsg *repository.Message
+	if msg.ClientMessageID != "" {
+		userMsg, err = deps.MessageRepo.CreateFromClient(msg.ConversationID, msg.Content, msg.ClientMessageID)
+		// Another replica saved the same send in the meantime
+		if errors.Is(err, repository.ErrDuplicateMessage) && replayDuplicateMessage(deps, client, msg, true) {
+			return
+		}
+	} else {
+		userMsg, err = deps.MessageRepo.Create(msg.ConversationID, "user", msg.Content, nil, "")
+	}
 	if err != nil {
 		log.Printf("Failed to save user message: %v", err)
 		client.SendMessage(websocket.NewError("database_error", "failed to save message: "+err.Error()))
 		return
 	}
+	if msg.Model != "" {
+		// Recorded so tool continuations of this turn stay on the override
+		if err := deps.MessageRepo.SetMetadata(userMsg.ID, map[string]interface{}{"provider": provider, "model": model}); err != nil {
+			log.Printf("Failed to save message model override: %v", err)
+		}
+	}
+
+	// Let the other participants see the new message
+	broadcastToParticipants(deps, msg.ConversationID, client.UserID,
+		websocket.NewChatUserMessage(msg.ConversationID, userMsg.ID, client.UserID, msg.Content, version))
 
 	// Get message history
 	messages, err := deps.MessageRepo.ListByConversationID(msg.ConversationID)
@@ -113,13 +429,10 @@ func handleChatMessage(deps *Dependencies, client *websocket.Client, msg *websoc
 	}
 
 	// Build LLM messages
-	llmMessages := buildLLMMessages(conversation.SystemPrompt, messages, userMsg)
+	llmMessages := shapeHistory(deps, conversation, buildLLMMessages(buildSystemPrompt(deps, client.UserID, conversation), messages, userMsg))
 
-	// Get tools from registry if available
-	var toolDefs []llm.ToolDefinition
-	if deps.ToolRegistry != nil {
-		toolDefs = deps.ToolRegistry.ToLLMTools()
-	}
+	// Get tools from registry if available, less any the user may not use
+	toolDefs := registryTools(deps, client.UserID)
 
 	// Get HTTP MCP tools for the user and merge them
 	var mcpTools []*mcp.MCPToolWrapper
@@ -145,37 +458,212 @@ func handleChatMessage(deps *Dependencies, client *websocket.Client, msg *websoc
 
 	// Create chat request
 	req := &llm.ChatRequest{
-		Model:    conversation.Model,
+		Model:    model,
 		Messages: llmMessages,
 		Tools:    toolDefs,
 		Stream:   true,
 	}
 
-	// Stream response from LLM
+	// Checkpoint the workspace before tools get a chance to change it
+	if len(toolDefs) > 0 {
+		checkpointBeforeRun(deps, client.UserID, msg.Content)
+	}
+
+	// Stream response from LLM; file changes made by tools are grouped under this turn
+	ctx = withTurn(ctx, userMsg.ID)
+	ctx = withClientMessageID(ctx, msg.ClientMessageID)
 	messageID := uuid.New().String()
-	streamLLMResponseWithMCPAndStdio(ctx, deps, client, msg.ConversationID, conversation.Provider, messageID, req, mcpTools, stdioMCPTools)
+	streamLLMResponseWithMCPAndStdio(ctx, deps, client, msg.ConversationID, provider, messageID, req, mcpTools, stdioMCPTools)
+
+	sendChangesSummary(deps, client, msg.ConversationID, userMsg.ID)
+}
+
+// replayDuplicateMessage answers a retried chat.message whose first send was
+// already saved, reporting whether msg was such a retry. Rather than being
+// answered again, the client gets a chat.duplicate with the saved message's
+// ID and, if the turn has finished, the assistant messages answering it,
+// which it may have missed while disconnected. busy reports that the
+// conversation is generating, which may be the answer to the first send.
+func replayDuplicateMessage(deps *Dependencies, client *websocket.Client, msg *websocket.IncomingMessage, busy bool) bool {
+	if msg.ClientMessageID == "" {
+		return false
+	}
+	existing, err := deps.MessageRepo.GetByClientMessageID(msg.ConversationID, msg.ClientMessageID)
+	if err != nil {
+		client.SendMessage(websocket.NewError("database_error", "failed to check for a duplicate message: "+err.Error()))
+		return true
+	}
+	if existing == nil {
+		return false
+	}
+
+	messages, err := deps.MessageRepo.ListByConversationID(msg.ConversationID)
+	if err != nil {
+		client.SendMessage(websocket.NewError("database_error", "failed to get message history: "+err.Error()))
+		return true
+	}
+	var answers []*repository.Message
+	latest := false
+	for i, m := range messages {
+		if m.ID != existing.ID {
+			continue
+		}
+		latest = true
+		for _, next := range messages[i+1:] {
+			if next.Role == "user" {
+				latest = false
+				break
+			}
+			if next.Role == "assistant" && strings.TrimSpace(next.Content) != "" {
+				answers = append(answers, next)
+			}
+		}
+		break
+	}
+
+	if busy && latest {
+		client.SendMessage(websocket.NewChatDuplicate(msg.ConversationID, existing.ID, msg.ClientMessageID, "generating"))
+		return true
+	}
+	client.SendMessage(websocket.NewChatDuplicate(msg.ConversationID, existing.ID, msg.ClientMessageID, "completed"))
+	for _, answer := range answers {
+		reply := websocket.NewChatAssistantMessage(msg.ConversationID, answer.ID, answer.Content)
+		reply.ClientMessageID = msg.ClientMessageID
+		client.SendMessage(reply)
+	}
+	return true
 }
 
 // handleChatStop stops an ongoing chat generation
 func handleChatStop(deps *Dependencies, client *websocket.Client, msg *websocket.IncomingMessage) {
 	if msg.ConversationID == "" {
-		client.SendMessage(websocket.NewError("invalid_request", "conversation_id is required"))
+		client.SendMessage(websocket.NewError(apierror.CodeInvalidRequest, "conversation_id is required"))
+		return
+	}
+
+	conversation, err := deps.ConversationRepo.GetByID(msg.ConversationID)
+	if err != nil {
+		client.SendMessage(websocket.NewError("database_error", "failed to get conversation: "+err.Error()))
+		return
+	}
+	if conversation == nil {
+		client.SendMessage(websocket.NewError(apierror.CodeNotFound, "conversation not found"))
 		return
 	}
+	access, err := conversationAccess(deps, conversation, client.UserID)
+	if err != nil {
+		client.SendMessage(websocket.NewError("database_error", "failed to check conversation access: "+err.Error()))
+		return
+	}
+	if !canSendToConversation(access) {
+		client.SendMessage(websocket.NewError(apierror.CodeForbidden, "not authorized to access this conversation"))
+		return
+	}
+
+	// A generation ID stops one turn and the work it started, leaving the
+	// rest of the conversation running
+	if msg.GenerationID != "" {
+		if g, ok := generations.get(msg.GenerationID); ok && g.ConversationID == msg.ConversationID {
+			generations.stop(msg.GenerationID)
+		} else if deps.Cluster != nil {
+			// The generation may be running on another replica
+			forwardStop(deps, msg.ConversationID, msg.GenerationID)
+		} else {
+			client.SendMessage(websocket.NewError(apierror.CodeNotFound, "generation not found"))
+		}
+		return
+	}
+
+	generations.stopConversation(msg.ConversationID)
+	if deps.Cluster != nil {
+		// Some of its generations may be running on other replicas
+		forwardStop(deps, msg.ConversationID, "")
+	}
+
+	// A loop paused at a check-in is abandoned rather than resumed
+	takePausedToolCalls(msg.ConversationID)
+
+	sendToParticipants(deps, client, msg.ConversationID, websocket.NewChatComplete(msg.ConversationID, "", "stop"))
+}
+
+// handleAgentContinue resumes an agentic loop that paused at the iteration cap
+func handleAgentContinue(deps *Dependencies, client *websocket.Client, msg *websocket.IncomingMessage) {
+	if msg.ConversationID == "" {
+		client.SendMessage(websocket.NewError(apierror.CodeInvalidRequest, "conversation_id is required"))
+		return
+	}
+
+	conversation, err := deps.ConversationRepo.GetByID(msg.ConversationID)
+	if err != nil {
+		client.SendMessage(websocket.NewError("database_error", "failed to get conversation: "+err.Error()))
+		return
+	}
+	if conversation == nil {
+		client.SendMessage(websocket.NewError(apierror.CodeNotFound, "conversation not found"))
+		return
+	}
+	access, err := conversationAccess(deps, conversation, client.UserID)
+	if err != nil {
+		client.SendMessage(websocket.NewError("database_error", "failed to check conversation access: "+err.Error()))
+		return
+	}
+	if !canSendToConversation(access) {
+		client.SendMessage(websocket.NewError(apierror.CodeForbidden, "not authorized to access this conversation"))
+		return
+	}
+
+	// Resume under a cancellable context so chat.stop still works
+	ctx, cancel := context.WithCancel(context.Background())
+	gen, ok := generations.start(msg.ConversationID, client.UserID, generationContinue, cancel)
+	if !ok {
+		cancel()
+		client.SendMessage(websocket.NewError("conversation_busy", "a response is already being generated for this conversation"))
+		return
+	}
+	defer func() {
+		generations.finish(gen)
+		cancel()
+	}()
+
+	paused := takePausedToolCalls(msg.ConversationID)
+	if len(paused) == 0 {
+		client.SendMessage(websocket.NewError(apierror.CodeNotFound, "no paused agent loop for this conversation"))
+		return
+	}
+
+	// Grant a fresh batch of iterations
+	resetIterationCount(msg.ConversationID)
+
+	// Rebuild the MCP tool lookups the paused calls may route to
+	mcpToolMap := make(map[string]*mcp.MCPToolWrapper)
+	if deps.MCPClient != nil {
+		for _, t := range mcp.GetMCPToolsForUser(deps.MCPClient, client.UserID) {
+			mcpToolMap[t.Name()] = t
+		}
+	}
+	stdioMCPToolMap := make(map[string]*mcp.StdioMCPToolWrapper)
+	if deps.StdioMCPClient != nil {
+		for _, t := range mcp.GetStdioMCPToolsForUser(deps.StdioMCPClient, client.UserID) {
+			stdioMCPToolMap[t.Name()] = t
+		}
+	}
 
-	if cancel, ok := activeGenerations.Load(msg.ConversationID); ok {
-		cancel.(context.CancelFunc)()
-		activeGenerations.Delete(msg.ConversationID)
-		log.Printf("Generation stopped for conversation: %s", msg.ConversationID)
+	turnID := latestTurnID(deps, msg.ConversationID)
+	provider, model := turnModel(deps, conversation)
+	ctx = withConversationModel(ctx, provider, model)
+	ctx = withTurn(ctx, turnID)
+	ctx = withClientMessageIDOf(ctx, deps, turnID)
+	for _, p := range paused {
+		handleToolCallWithAllMCP(ctx, deps, client, msg.ConversationID, p.MessageID, p.ToolCall, mcpToolMap, stdioMCPToolMap)
 	}
 
-	client.SendMessage(websocket.NewChatComplete(msg.ConversationID, "", "stop"))
+	sendChangesSummary(deps, client, msg.ConversationID, turnID)
 }
 
 // handleToolConfirm handles tool confirmation (approve/reject)
 func handleToolConfirm(deps *Dependencies, client *websocket.Client, msg *websocket.IncomingMessage) {
 	if msg.ExecutionID == "" {
-		client.SendMessage(websocket.NewError("invalid_request", "execution_id is required"))
+		client.SendMessage(websocket.NewError(apierror.CodeInvalidRequest, "execution_id is required"))
 		return
 	}
 
@@ -187,21 +675,52 @@ func handleToolConfirm(deps *Dependencies, client *websocket.Client, msg *websoc
 	// Get pending execution
 	pending, ok := deps.ToolRegistry.GetPendingExecution(msg.ExecutionID)
 	if !ok {
-		client.SendMessage(websocket.NewError("not_found", "pending execution not found"))
+		client.SendMessage(websocket.NewError(apierror.CodeNotFound, "pending execution not found"))
 		return
 	}
 
+	// Only the owner or an editor of the conversation may confirm tools
+	if pending.UserID != client.UserID {
+		conversation, err := deps.ConversationRepo.GetByID(pending.ConversationID)
+		if err != nil || conversation == nil {
+			client.SendMessage(websocket.NewError(apierror.CodeNotFound, "conversation not found"))
+			return
+		}
+		access, err := conversationAccess(deps, conversation, client.UserID)
+		if err != nil || !canSendToConversation(access) {
+			client.SendMessage(websocket.NewError(apierror.CodeForbidden, "not authorized to access this conversation"))
+			return
+		}
+	}
+
 	if !msg.Approved {
 		// User rejected the tool execution
 		deps.ToolRegistry.RemovePendingExecution(msg.ExecutionID)
-		client.SendMessage(websocket.NewToolCompleted(pending.ConversationID, msg.ExecutionID, map[string]interface{}{
+		sendToParticipants(deps, client, pending.ConversationID, websocket.NewToolCompleted(pending.ConversationID, msg.ExecutionID, map[string]interface{}{
 			"status": "rejected",
 			"reason": "User rejected the tool execution",
 		}, "rejected"))
 		return
 	}
 
-	ctx := context.WithValue(context.Background(), builtin.UserIDKey, client.UserID)
+	// Run under a cancellable context so chat.stop can interrupt the tool.
+	// The tool belongs to the turn that proposed it when that's still running.
+	ctx, cancel := context.WithCancel(context.Background())
+	gen := generations.join(pending.ConversationID, client.UserID, generationTool, cancel)
+	defer func() {
+		generations.finish(gen)
+		cancel()
+	}()
+
+	ctx = context.WithValue(ctx, builtin.UserIDKey, client.UserID)
+	ctx = context.WithValue(ctx, builtin.ConversationIDKey, pending.ConversationID)
+	if conversation, err := deps.ConversationRepo.GetByID(pending.ConversationID); err == nil && conversation != nil {
+		provider, model := turnModel(deps, conversation)
+		ctx = withConversationModel(ctx, provider, model)
+	}
+	turnID := latestTurnID(deps, pending.ConversationID)
+	ctx = withTurn(ctx, turnID)
+	ctx = withClientMessageIDOf(ctx, deps, turnID)
 	var result interface{}
 	var status string
 
@@ -211,6 +730,10 @@ func handleToolConfirm(deps *Dependencies, client *websocket.Client, msg *websoc
 		mcpResult, err := executeMCPTool(ctx, deps, pending)
 		deps.ToolRegistry.RemovePendingExecution(msg.ExecutionID)
 
+		if errors.Is(err, tools.ErrToolCancelled) {
+			sendToParticipants(deps, client, pending.ConversationID, websocket.NewToolCancelled(pending.ConversationID, msg.ExecutionID, pending.ToolName, "stopped by user"))
+			return
+		}
 		if err != nil {
 			client.SendMessage(websocket.NewError("mcp_tool_error", err.Error()))
 			return
@@ -224,7 +747,13 @@ func handleToolConfirm(deps *Dependencies, client *websocket.Client, msg *websoc
 		}
 	} else {
 		// Execute local tool
-		toolResult, err := deps.ToolRegistry.ExecutePending(ctx, msg.ExecutionID)
+		report, stopProgress := toolProgressReporter(deps, client, pending.ConversationID, msg.ExecutionID, pending.ToolName)
+		toolResult, err := deps.ToolRegistry.ExecutePending(ctx, msg.ExecutionID, report)
+		stopProgress()
+		if errors.Is(err, tools.ErrToolCancelled) {
+			sendToParticipants(deps, client, pending.ConversationID, websocket.NewToolCancelled(pending.ConversationID, msg.ExecutionID, pending.ToolName, "stopped by user"))
+			return
+		}
 		if err != nil {
 			client.SendMessage(websocket.NewError("tool_error", err.Error()))
 			return
@@ -238,10 +767,13 @@ func handleToolConfirm(deps *Dependencies, client *websocket.Client, msg *websoc
 		}
 	}
 
-	client.SendMessage(websocket.NewToolCompleted(pending.ConversationID, msg.ExecutionID, result, status))
+	sendToParticipants(deps, client, pending.ConversationID, websocket.NewToolCompleted(pending.ConversationID, msg.ExecutionID, result, status))
+	trackToolExecuted(deps, client.UserID, pending.ConversationID, msg.ExecutionID, pending.ToolName, status)
 
 	// Continue the conversation with the tool result
 	continueConversationWithToolResult(ctx, deps, client, pending, result, status)
+
+	sendChangesSummary(deps, client, pending.ConversationID, turnID)
 }
 
 // continueConversationWithToolResult sends the tool result back to the LLM and streams the response
@@ -264,11 +796,15 @@ func continueConversationWithToolResult(ctx context.Context, deps *Dependencies,
 		resultJSON = []byte("{\"error\": \"failed to serialize result\"}")
 	}
 
-	// Save the tool result message to database
-	// The tool_call_id should reference the original tool call from the LLM
-	_, err = deps.MessageRepo.Create(pending.ConversationID, "tool", string(resultJSON), nil, pending.ToolCallID)
+	// Save the tool result message to database, cut down if it is too big
+	// for the context. The tool_call_id should reference the original tool
+	// call from the LLM.
+	content, truncated := tools.TruncateResult(string(resultJSON), deps.Config.ToolResultMaxBytes)
+	resultMsg, err := deps.MessageRepo.Create(pending.ConversationID, "tool", content, nil, pending.ToolCallID)
 	if err != nil {
 		log.Printf("Failed to save tool result message: %v", err)
+	} else if truncated {
+		saveFullToolResult(deps, resultMsg.ID, string(resultJSON))
 	}
 
 	// Get updated message history
@@ -279,13 +815,10 @@ func continueConversationWithToolResult(ctx context.Context, deps *Dependencies,
 	}
 
 	// Build LLM messages
-	llmMessages := buildLLMMessages(conversation.SystemPrompt, messages, nil)
+	llmMessages := shapeHistory(deps, conversation, buildLLMMessages(buildSystemPrompt(deps, client.UserID, conversation), messages, nil))
 
-	// Get tools from registry if available
-	var toolDefs []llm.ToolDefinition
-	if deps.ToolRegistry != nil {
-		toolDefs = deps.ToolRegistry.ToLLMTools()
-	}
+	// Get tools from registry if available, less any the user may not use
+	toolDefs := registryTools(deps, client.UserID)
 
 	// Get HTTP MCP tools for the user
 	var mcpTools []*mcp.MCPToolWrapper
@@ -307,9 +840,10 @@ func continueConversationWithToolResult(ctx context.Context, deps *Dependencies,
 		}
 	}
 
-	// Create chat request
+	// Create chat request, on the model the turn started with
+	provider, model := turnModel(deps, conversation)
 	req := &llm.ChatRequest{
-		Model:    conversation.Model,
+		Model:    model,
 		Messages: llmMessages,
 		Tools:    toolDefs,
 		Stream:   true,
@@ -317,7 +851,50 @@ func continueConversationWithToolResult(ctx context.Context, deps *Dependencies,
 
 	// Stream response from LLM
 	messageID := uuid.New().String()
-	streamLLMResponseWithMCPAndStdio(ctx, deps, client, pending.ConversationID, conversation.Provider, messageID, req, mcpTools, stdioMCPTools)
+	streamLLMResponseWithMCPAndStdio(ctx, deps, client, pending.ConversationID, provider, messageID, req, mcpTools, stdioMCPTools)
+}
+
+// saveFullToolResult keeps the whole result of a tool call whose message
+// holds a truncated copy, and marks the message as truncated
+func saveFullToolResult(deps *Dependencies, messageID, result string) {
+	if deps.ToolResultRepo != nil {
+		if err := deps.ToolResultRepo.Save(messageID, result); err != nil {
+			log.Printf("Failed to save full tool result for message %s: %v", messageID, err)
+			return
+		}
+	}
+	if err := deps.MessageRepo.SetMetadata(messageID, map[string]interface{}{
+		"truncated":   true,
+		"result_size": len(result),
+	}); err != nil {
+		log.Printf("Failed to mark tool result message %s truncated: %v", messageID, err)
+	}
+}
+
+// buildSystemPrompt returns the conversation's system prompt followed by the
+// workspace's project instructions, the onboarding summaries of its
+// repositories, the latest contents of its pinned files and its context
+// pack. Providers only take a single system message, so they all share it.
+func buildSystemPrompt(deps *Dependencies, userID string, conversation *repository.Conversation) string {
+	systemPrompt := conversation.SystemPrompt
+	if deps.ProjectInstructions != nil {
+		systemPrompt = instructions.Merge(systemPrompt, deps.ProjectInstructions.Load(userID))
+	}
+	if deps.RepoAnalyzer != nil {
+		systemPrompt = instructions.Merge(systemPrompt, deps.RepoAnalyzer.Context(userID))
+	}
+	if deps.PinnedContext != nil {
+		systemPrompt = instructions.Merge(systemPrompt, deps.PinnedContext.Build(conversation.ID))
+	}
+	if deps.ContextPackRepo != nil {
+		pack, err := deps.ContextPackRepo.Get(conversation.ID)
+		if err != nil {
+			log.Printf("Failed to get context pack for conversation %s: %v", conversation.ID, err)
+		} else if pack != nil {
+			systemPrompt = instructions.Merge(systemPrompt, pack.Content)
+		}
+	}
+	return systemPrompt
 }
 
 // buildLLMMessages converts database messages to LLM messages
@@ -332,8 +909,17 @@ func buildLLMMessages(systemPrompt string, history []*repository.Message, userMs
 		})
 	}
 
-	// Add message history
+	// Add message history, with one answer per comparison
+	answers := comparisonAnswers(history)
 	for _, msg := range history {
+		if compareID, _ := msg.Metadata["compare_id"].(string); compareID != "" && msg.Role == "assistant" && answers[compareID] != msg.ID {
+			continue
+		}
+		// A reply still streaming isn't part of the history yet
+		if msg.Status == repository.MessageStatusPartial {
+			continue
+		}
+
 		llmMsg := llm.Message{
 			Role:    msg.Role,
 			Content: msg.Content,
@@ -361,6 +947,49 @@ func buildLLMMessages(systemPrompt string, history []*repository.Message, userMs
 	return messages
 }
 
+// shapeHistory collapses all but a conversation's most recent tool results
+// in the messages sent to the model, so long tool-heavy sessions don't replay
+// every result in full
+func shapeHistory(deps *Dependencies, conversation *repository.Conversation, messages []llm.Message) []llm.Message {
+	keep := 0
+	if deps.Config != nil {
+		keep = deps.Config.ToolHistoryKeepRecent
+	}
+	if conversation.ToolHistoryKeep != nil {
+		keep = *conversation.ToolHistoryKeep
+	}
+	return tools.CollapseToolResults(messages, keep)
+}
+
+// loadProviderKey loads a user's API key for a provider from the database,
+// returns ctx carrying it for the provider's requests, and reports whether
+// the provider can be used
+func loadProviderKey(ctx context.Context, deps *Dependencies, userID, provider string) (context.Context, bool) {
+	creds := userCredentials(deps, userID, provider)
+	return llm.WithCredentials(ctx, creds), deps.LLMManager.CanUse(provider, creds)
+}
+
+// userCredentials returns a user's stored key and base URL for a provider,
+// or nil if they have none
+func userCredentials(deps *Dependencies, userID, provider string) *llm.Credentials {
+	return deps.LLMManager.UserCredentials(deps.ProviderKeyRepo, deps.EncryptionService, userID, provider)
+}
+
+// recordSharedKeyUsage attributes a request to the member who made it when
+// their key for the provider is shared by an organization
+func recordSharedKeyUsage(deps *Dependencies, userID, provider, model string, tokensUsed int) {
+	if provider == "ollama" || deps.ProviderKeyRepo == nil || deps.OrganizationRepo == nil {
+		return
+	}
+	providerKey, err := deps.ProviderKeyRepo.GetKey(userID, provider)
+	if err != nil || providerKey == nil || providerKey.OrganizationID == "" {
+		return
+	}
+	if err := deps.OrganizationRepo.RecordUsage(providerKey.OrganizationID, userID, provider, model, tokensUsed); err != nil {
+		log.Printf("Failed to record shared key usage: %v", err)
+	}
+}
+
 // streamLLMResponseWithMCPAndStdio streams the LLM response to the client with both HTTP and stdio MCP tool support
 func streamLLMResponseWithMCPAndStdio(ctx context.Context, deps *Dependencies, client *websocket.Client, conversationID, provider, messageID string, req *llm.ChatRequest, mcpTools []*mcp.MCPToolWrapper, stdioMCPTools []*mcp.StdioMCPToolWrapper) {
 	// Check if provider is set
@@ -369,24 +998,18 @@ func streamLLMResponseWithMCPAndStdio(ctx context.Context, deps *Dependencies, c
 		return
 	}
 
-	// Load user's API key from database for providers that require it (handles server restarts)
-	if provider != "ollama" && deps.ProviderKeyRepo != nil && deps.EncryptionService != nil {
-		providerKey, err := deps.ProviderKeyRepo.GetKey(client.UserID, provider)
-		if err == nil && providerKey != nil {
-			decryptedKey, err := deps.EncryptionService.Decrypt(providerKey.EncryptedKey, providerKey.KeyNonce)
-			if err == nil {
-				deps.LLMManager.SetAPIKey(provider, string(decryptedKey))
-			}
-		}
-	}
-
 	// Check if provider has a valid API key configured
-	if !deps.LLMManager.HasValidKey(provider) {
+	ctx, ok := loadProviderKey(ctx, deps, client.UserID, provider)
+	if !ok {
 		client.SendMessage(websocket.NewError("api_key_missing",
 			"API key not configured for provider: "+provider+". Please add your API key in Settings."))
 		return
 	}
 
+	// Let tools such as spawn_agent default to the conversation's model
+	ctx = withConversationModel(ctx, provider, req.Model)
+	ctx = withLLMDebug(ctx, deps, conversationID)
+
 	// Get the stream from LLM manager
 	stream, err := deps.LLMManager.Chat(ctx, provider, req)
 	if err != nil {
@@ -397,6 +1020,8 @@ func streamLLMResponseWithMCPAndStdio(ctx context.Context, deps *Dependencies, c
 	var fullResponse strings.Builder
 	var finishReason string
 	var collectedToolCalls []llm.ToolCall
+	var tokensUsed int
+	reply := newPartialReply(deps, conversationID)
 
 	// Build HTTP MCP tool lookup map for faster access
 	mcpToolMap := make(map[string]*mcp.MCPToolWrapper)
@@ -428,7 +1053,8 @@ func streamLLMResponseWithMCPAndStdio(ctx context.Context, deps *Dependencies, c
 		// Handle text delta
 		if chunk.Delta != "" {
 			fullResponse.WriteString(chunk.Delta)
-			client.SendMessage(websocket.NewChatChunk(conversationID, messageID, chunk.Delta))
+			reply.add(fullResponse.String())
+			sendToParticipants(deps, client, conversationID, tagClientMessage(ctx, websocket.NewChatChunk(conversationID, messageID, chunk.Delta)))
 		}
 
 		// Handle tool calls
@@ -444,15 +1070,32 @@ func streamLLMResponseWithMCPAndStdio(ctx context.Context, deps *Dependencies, c
 		if chunk.FinishReason != "" {
 			finishReason = chunk.FinishReason
 		}
+
+		// Usage statistics arrive with the final chunk
+		if chunk.Usage != nil {
+			tokensUsed = chunk.Usage.TotalTokens
+		}
 	}
 
 saveAndComplete:
+	recordSharedKeyUsage(deps, client.UserID, provider, req.Model, tokensUsed)
+
 	// Save assistant message to database (with tool calls if any)
 	if fullResponse.Len() > 0 || len(collectedToolCalls) > 0 {
 		toolCalls := convertToRepoToolCalls(collectedToolCalls)
-		_, err := deps.MessageRepo.Create(conversationID, "assistant", fullResponse.String(), toolCalls, "")
+		savedID, err := reply.save(fullResponse.String(), toolCalls)
 		if err != nil {
 			log.Printf("Failed to save assistant message: %v", err)
+		} else {
+			if tokensUsed > 0 {
+				if err := deps.MessageRepo.SetTokensUsed(savedID, tokensUsed); err != nil {
+					log.Printf("Failed to save message token usage: %v", err)
+				}
+			}
+			// Turns can override the conversation's model, so record which one answered
+			if err := deps.MessageRepo.SetMetadata(savedID, map[string]interface{}{"provider": provider, "model": req.Model}); err != nil {
+				log.Printf("Failed to save message metadata: %v", err)
+			}
 		}
 	}
 
@@ -460,7 +1103,12 @@ saveAndComplete:
 	if finishReason == "" {
 		finishReason = "stop"
 	}
-	client.SendMessage(websocket.NewChatComplete(conversationID, messageID, finishReason))
+	sendToParticipants(deps, client, conversationID, tagClientMessage(ctx, websocket.NewChatComplete(conversationID, messageID, finishReason)))
+
+	// Name the conversation once the first exchange is complete
+	if finishReason != "error" {
+		go autoTitleConversation(deps, client, conversationID)
+	}
 
 	// Track completion
 	if deps.IntegrationManager != nil {
@@ -468,6 +1116,134 @@ saveAndComplete:
 	}
 }
 
+// partialReply saves a streaming assistant reply every few chunks as a
+// partial message, so a restart mid-stream doesn't lose it
+type partialReply struct {
+	deps           *Dependencies
+	conversationID string
+	every          int // Chunks between saves; 0 only saves the finished reply
+	chunks         int
+	messageID      string // The partial message, once first saved
+}
+
+func newPartialReply(deps *Dependencies, conversationID string) *partialReply {
+	reply := &partialReply{deps: deps, conversationID: conversationID}
+	if deps.Config != nil {
+		reply.every = deps.Config.StreamPersistChunks
+	}
+	return reply
+}
+
+// add counts a chunk of the reply, saving the reply so far every few chunks
+func (p *partialReply) add(content string) {
+	if p.every <= 0 {
+		return
+	}
+	p.chunks++
+	if p.chunks%p.every != 0 {
+		return
+	}
+
+	if p.messageID == "" {
+		msg, err := p.deps.MessageRepo.CreatePartial(p.conversationID, content)
+		if err != nil {
+			log.Printf("Failed to save partial reply: %v", err)
+			return
+		}
+		p.messageID = msg.ID
+		return
+	}
+	if err := p.deps.MessageRepo.UpdatePartial(p.messageID, content); err != nil {
+		log.Printf("Failed to save partial reply: %v", err)
+	}
+}
+
+// save saves the finished reply, completing the partial message if one was
+// saved, and returns its message ID
+func (p *partialReply) save(content string, toolCalls []repository.ToolCall) (string, error) {
+	if p.messageID == "" {
+		msg, err := p.deps.MessageRepo.Create(p.conversationID, "assistant", content, toolCalls, "")
+		if err != nil {
+			return "", err
+		}
+		return msg.ID, nil
+	}
+	if err := p.deps.MessageRepo.Finalize(p.messageID, content, toolCalls); err != nil {
+		return "", err
+	}
+	return p.messageID, nil
+}
+
+// registryTools returns the registry's tool definitions, leaving out tools
+// the user may not use
+func registryTools(deps *Dependencies, userID string) []llm.ToolDefinition {
+	if deps.ToolRegistry == nil {
+		return nil
+	}
+
+	settings := workspaceSettings(deps, userID)
+	var toolDefs []llm.ToolDefinition
+	for _, def := range deps.ToolRegistry.ToLLMTools() {
+		if toolDenial(deps, settings, userID, def.Name) == "" {
+			toolDefs = append(toolDefs, def)
+		}
+	}
+	return toolDefs
+}
+
+// toolDenial returns why a user may not use a tool, or "" if they may
+func toolDenial(deps *Dependencies, settings *repository.WorkspaceSettings, userID, toolName string) string {
+	if deps.Guests.DeniesTool(userID, toolName) {
+		return "tool " + toolName + " is not available to guest users"
+	}
+	if !settings.AllowsTool(toolName) {
+		return "tool " + toolName + " is not allowed in this workspace"
+	}
+	return ""
+}
+
+// workspaceSettings returns the settings of the user's current workspace, or
+// nil if it has none
+func workspaceSettings(deps *Dependencies, userID string) *repository.WorkspaceSettings {
+	if deps.SandboxService == nil {
+		return nil
+	}
+	settings, err := deps.SandboxService.WorkspaceSettings(userID)
+	if err != nil {
+		log.Printf("Failed to get workspace settings for user %s: %v", userID, err)
+		return nil
+	}
+	return settings
+}
+
+// rejectDeniedTool fails a call to a tool the user may not use, such as a
+// guest asking for the shell or a tool outside the workspace's allowlist, and
+// lets the model carry on without it. Returns true if the call was rejected.
+func rejectDeniedTool(ctx context.Context, deps *Dependencies, client *websocket.Client, conversationID, messageID, executionID string, tc llm.ToolCall) bool {
+	reason := toolDenial(deps, workspaceSettings(deps, client.UserID), client.UserID, tc.Name)
+	if reason == "" {
+		return false
+	}
+
+	result := &tools.ToolResult{
+		Success: false,
+		Error:   reason,
+	}
+	sendToParticipants(deps, client, conversationID, websocket.NewToolCompleted(conversationID, executionID, result, "failed"))
+
+	pending := &tools.PendingExecution{
+		ID:             executionID,
+		ToolCallID:     tc.ID,
+		ToolName:       tc.Name,
+		Parameters:     tc.Parameters,
+		ConversationID: conversationID,
+		MessageID:      messageID,
+		UserID:         client.UserID,
+	}
+	continueConversationWithToolResult(ctx, deps, client, pending, result, "failed")
+	return true
+}
+
 // handleToolCall handles a tool call from the LLM
 func handleToolCall(ctx context.Context, deps *Dependencies, client *websocket.Client, conversationID, messageID string, tc llm.ToolCall) {
 	if deps.ToolRegistry == nil {
@@ -481,10 +1257,18 @@ func handleToolCall(ctx context.Context, deps *Dependencies, client *websocket.C
 		return
 	}
 
+	// Pause at the iteration cap until the user checks in
+	if !checkIterationCap(deps, client, conversationID, messageID, tc) {
+		return
+	}
+
 	executionID := uuid.New().String()
+	if rejectDeniedTool(ctx, deps, client, conversationID, messageID, executionID, tc) {
+		return
+	}
 
-	// Check if tool requires confirmation
-	if tool.RequiresConfirmation() {
+	// Check if tool requires confirmation, unless the user's preferences approve it
+	if tool.RequiresConfirmation() && !autoApprovalConfig(deps, client.UserID).ShouldAutoApprove(tc.Name, false) {
 		// Store pending execution with original tool call ID
 		pending := &tools.PendingExecution{
 			ID:             executionID,
@@ -498,7 +1282,7 @@ func handleToolCall(ctx context.Context, deps *Dependencies, client *websocket.C
 		deps.ToolRegistry.AddPendingExecution(pending)
 
 		// Send confirmation request to client
-		client.SendMessage(&websocket.OutgoingMessage{
+		sendToParticipants(deps, client, conversationID, &websocket.OutgoingMessage{
 			Type:           websocket.TypeToolConfirm,
 			ConversationID: conversationID,
 			ExecutionID:    executionID,
@@ -509,12 +1293,19 @@ func handleToolCall(ctx context.Context, deps *Dependencies, client *websocket.C
 	}
 
 	// Execute tool immediately (no confirmation needed)
-	client.SendMessage(websocket.NewToolStarted(conversationID, executionID, tc.Name, tc.Parameters))
+	sendToParticipants(deps, client, conversationID, websocket.NewToolStarted(conversationID, executionID, tc.Name, tc.Parameters))
 
-	// Add user ID to context
+	// Add user and conversation IDs to context
 	toolCtx := context.WithValue(ctx, builtin.UserIDKey, client.UserID)
-	result, err := deps.ToolRegistry.Execute(toolCtx, tc.Name, tc.Parameters)
+	toolCtx = context.WithValue(toolCtx, builtin.ConversationIDKey, conversationID)
+	report, stopProgress := toolProgressReporter(deps, client, conversationID, executionID, tc.Name)
+	result, err := deps.ToolRegistry.ExecuteWithProgress(toolCtx, tc.Name, tc.Parameters, report)
+	stopProgress()
 	if err != nil {
+		if errors.Is(err, tools.ErrToolCancelled) {
+			sendToParticipants(deps, client, conversationID, websocket.NewToolCancelled(conversationID, executionID, tc.Name, "stopped by user"))
+			return
+		}
 		client.SendMessage(websocket.NewError("tool_error", err.Error()))
 		return
 	}
@@ -524,7 +1315,8 @@ func handleToolCall(ctx context.Context, deps *Dependencies, client *websocket.C
 		status = "failed"
 	}
 
-	client.SendMessage(websocket.NewToolCompleted(conversationID, executionID, result, status))
+	sendToParticipants(deps, client, conversationID, websocket.NewToolCompleted(conversationID, executionID, result, status))
+	trackToolExecuted(deps, client.UserID, conversationID, executionID, tc.Name, status)
 
 	// Continue conversation with tool result (agentic loop)
 	pending := &tools.PendingExecution{
@@ -541,6 +1333,11 @@ func handleToolCall(ctx context.Context, deps *Dependencies, client *websocket.C
 
 // handleToolCallWithAllMCP handles a tool call, routing to local tools, HTTP MCP tools, or stdio MCP tools
 func handleToolCallWithAllMCP(ctx context.Context, deps *Dependencies, client *websocket.Client, conversationID, messageID string, tc llm.ToolCall, mcpToolMap map[string]*mcp.MCPToolWrapper, stdioMCPToolMap map[string]*mcp.StdioMCPToolWrapper) {
+	// Pause at the iteration cap until the user checks in
+	if !checkIterationCap(deps, client, conversationID, messageID, tc) {
+		return
+	}
+
 	executionID := uuid.New().String()
 
 	// Check if this is an HTTP MCP tool
@@ -566,9 +1363,12 @@ func handleToolCallWithAllMCP(ctx context.Context, deps *Dependencies, client *w
 		client.SendMessage(websocket.NewError("tool_not_found", "tool not found: "+tc.Name))
 		return
 	}
+	if rejectDeniedTool(ctx, deps, client, conversationID, messageID, executionID, tc) {
+		return
+	}
 
-	// Check if tool requires confirmation
-	if tool.RequiresConfirmation() {
+	// Check if tool requires confirmation, unless the user's preferences approve it
+	if tool.RequiresConfirmation() && !autoApprovalConfig(deps, client.UserID).ShouldAutoApprove(tc.Name, false) {
 		// Store pending execution with original tool call ID
 		pending := &tools.PendingExecution{
 			ID:             executionID,
@@ -582,7 +1382,7 @@ func handleToolCallWithAllMCP(ctx context.Context, deps *Dependencies, client *w
 		deps.ToolRegistry.AddPendingExecution(pending)
 
 		// Send confirmation request to client
-		client.SendMessage(&websocket.OutgoingMessage{
+		sendToParticipants(deps, client, conversationID, &websocket.OutgoingMessage{
 			Type:           websocket.TypeToolConfirm,
 			ConversationID: conversationID,
 			ExecutionID:    executionID,
@@ -593,12 +1393,19 @@ func handleToolCallWithAllMCP(ctx context.Context, deps *Dependencies, client *w
 	}
 
 	// Execute tool immediately (no confirmation needed)
-	client.SendMessage(websocket.NewToolStarted(conversationID, executionID, tc.Name, tc.Parameters))
+	sendToParticipants(deps, client, conversationID, websocket.NewToolStarted(conversationID, executionID, tc.Name, tc.Parameters))
 
-	// Add user ID to context
+	// Add user and conversation IDs to context
 	toolCtx := context.WithValue(ctx, builtin.UserIDKey, client.UserID)
-	result, err := deps.ToolRegistry.Execute(toolCtx, tc.Name, tc.Parameters)
+	toolCtx = context.WithValue(toolCtx, builtin.ConversationIDKey, conversationID)
+	report, stopProgress := toolProgressReporter(deps, client, conversationID, executionID, tc.Name)
+	result, err := deps.ToolRegistry.ExecuteWithProgress(toolCtx, tc.Name, tc.Parameters, report)
+	stopProgress()
 	if err != nil {
+		if errors.Is(err, tools.ErrToolCancelled) {
+			sendToParticipants(deps, client, conversationID, websocket.NewToolCancelled(conversationID, executionID, tc.Name, "stopped by user"))
+			return
+		}
 		client.SendMessage(websocket.NewError("tool_error", err.Error()))
 		return
 	}
@@ -608,7 +1415,8 @@ func handleToolCallWithAllMCP(ctx context.Context, deps *Dependencies, client *w
 		status = "failed"
 	}
 
-	client.SendMessage(websocket.NewToolCompleted(conversationID, executionID, result, status))
+	sendToParticipants(deps, client, conversationID, websocket.NewToolCompleted(conversationID, executionID, result, status))
+	trackToolExecuted(deps, client.UserID, conversationID, executionID, tc.Name, status)
 
 	// Continue conversation with tool result (agentic loop)
 	pending := &tools.PendingExecution{
@@ -625,26 +1433,16 @@ func handleToolCallWithAllMCP(ctx context.Context, deps *Dependencies, client *w
 
 // handleHTTPMCPToolCall handles execution of an HTTP MCP tool
 func handleHTTPMCPToolCall(ctx context.Context, deps *Dependencies, client *websocket.Client, conversationID, messageID, executionID, toolCallID string, mcpTool *mcp.MCPToolWrapper, params map[string]interface{}) {
-	// Get auto-approval config (would be loaded from user settings in production)
-	approvalConfig := getDefaultAutoApprovalConfig()
+	// Get the user's auto-approval config from their preferences
+	approvalConfig := autoApprovalConfig(deps, client.UserID)
 
-	// Track iteration count
-	iterationCount := incrementIterationCount(conversationID)
-
-	// Check if we've hit the max iterations and need to check in
-	if approvalConfig.ShouldCheckIn(iterationCount) {
-		client.SendMessage(websocket.NewAgentCheckIn(
-			conversationID,
-			iterationCount,
-			"Agent has reached the maximum number of tool executions. Would you like to continue?",
-		))
-		return
-	}
+	// Iteration count was already checked against the cap by the caller
+	iterationCount := getIterationCount(conversationID)
 
 	// Check if this tool should be auto-approved
 	if approvalConfig.ShouldAutoApprove(mcpTool.Name(), true) {
 		// Execute immediately - send tool started with HTTP MCP indicator
-		client.SendMessage(&websocket.OutgoingMessage{
+		sendToParticipants(deps, client, conversationID, &websocket.OutgoingMessage{
 			Type:           websocket.TypeToolStarted,
 			ConversationID: conversationID,
 			ExecutionID:    executionID,
@@ -655,7 +1453,15 @@ func handleHTTPMCPToolCall(ctx context.Context, deps *Dependencies, client *webs
 			MCPServerName:  mcpTool.Description(),
 		})
 
-		result, err := deps.MCPClient.ExecuteTool(ctx, mcpTool.ServerID(), mcpTool.OriginalName(), params)
+		result, err := tools.ExecuteWithTimeout(ctx, toolTimeout(deps, mcpTool.Name()), func(ctx context.Context) (interface{}, error) {
+			return runWithSecrets(deps.SecretVault, client.UserID, params, func(params map[string]interface{}) (interface{}, error) {
+				return deps.MCPClient.ExecuteTool(ctx, mcpTool.ServerID(), mcpTool.OriginalName(), params)
+			})
+		})
+		if errors.Is(err, tools.ErrToolCancelled) {
+			sendToParticipants(deps, client, conversationID, websocket.NewToolCancelled(conversationID, executionID, mcpTool.Name(), "stopped by user"))
+			return
+		}
 
 		var execResult *tools.ExecutionResult
 		if err != nil {
@@ -668,7 +1474,8 @@ func handleHTTPMCPToolCall(ctx context.Context, deps *Dependencies, client *webs
 		if !execResult.Success {
 			status = "failed"
 		}
-		client.SendMessage(websocket.NewToolCompleted(conversationID, executionID, execResult, status))
+		sendToParticipants(deps, client, conversationID, websocket.NewToolCompleted(conversationID, executionID, execResult, status))
+		trackToolExecuted(deps, client.UserID, conversationID, executionID, mcpTool.Name(), status)
 
 		// Continue agentic loop
 		pending := &tools.PendingExecution{
@@ -707,7 +1514,7 @@ func handleHTTPMCPToolCall(ctx context.Context, deps *Dependencies, client *webs
 	}
 
 	// Send confirmation request to client with MCP indicator
-	client.SendMessage(&websocket.OutgoingMessage{
+	sendToParticipants(deps, client, conversationID, &websocket.OutgoingMessage{
 		Type:           websocket.TypeToolConfirm,
 		ConversationID: conversationID,
 		ExecutionID:    executionID,
@@ -721,26 +1528,16 @@ func handleHTTPMCPToolCall(ctx context.Context, deps *Dependencies, client *webs
 
 // handleStdioMCPToolCall handles execution of a stdio MCP tool
 func handleStdioMCPToolCall(ctx context.Context, deps *Dependencies, client *websocket.Client, conversationID, messageID, executionID, toolCallID string, mcpTool *mcp.StdioMCPToolWrapper, params map[string]interface{}) {
-	// Get auto-approval config (would be loaded from user settings in production)
-	approvalConfig := getDefaultAutoApprovalConfig()
+	// Get the user's auto-approval config from their preferences
+	approvalConfig := autoApprovalConfig(deps, client.UserID)
 
-	// Track iteration count
-	iterationCount := incrementIterationCount(conversationID)
-
-	// Check if we've hit the max iterations and need to check in
-	if approvalConfig.ShouldCheckIn(iterationCount) {
-		client.SendMessage(websocket.NewAgentCheckIn(
-			conversationID,
-			iterationCount,
-			"Agent has reached the maximum number of tool executions. Would you like to continue?",
-		))
-		return
-	}
+	// Iteration count was already checked against the cap by the caller
+	iterationCount := getIterationCount(conversationID)
 
 	// Check if this tool should be auto-approved
 	if approvalConfig.ShouldAutoApprove(mcpTool.Name(), true) {
 		// Execute immediately - send tool started with stdio MCP indicator
-		client.SendMessage(&websocket.OutgoingMessage{
+		sendToParticipants(deps, client, conversationID, &websocket.OutgoingMessage{
 			Type:           websocket.TypeToolStarted,
 			ConversationID: conversationID,
 			ExecutionID:    executionID,
@@ -751,7 +1548,15 @@ func handleStdioMCPToolCall(ctx context.Context, deps *Dependencies, client *web
 			MCPServerName:  mcpTool.Description(),
 		})
 
-		result, err := deps.StdioMCPClient.ExecuteTool(ctx, mcpTool.ServerID(), mcpTool.OriginalName(), params)
+		result, err := tools.ExecuteWithTimeout(ctx, toolTimeout(deps, mcpTool.Name()), func(ctx context.Context) (interface{}, error) {
+			return runWithSecrets(deps.SecretVault, client.UserID, params, func(params map[string]interface{}) (interface{}, error) {
+				return deps.StdioMCPClient.ExecuteTool(ctx, mcpTool.ServerID(), mcpTool.OriginalName(), params)
+			})
+		})
+		if errors.Is(err, tools.ErrToolCancelled) {
+			sendToParticipants(deps, client, conversationID, websocket.NewToolCancelled(conversationID, executionID, mcpTool.Name(), "stopped by user"))
+			return
+		}
 
 		var execResult *tools.ExecutionResult
 		if err != nil {
@@ -764,7 +1569,8 @@ func handleStdioMCPToolCall(ctx context.Context, deps *Dependencies, client *web
 		if !execResult.Success {
 			status = "failed"
 		}
-		client.SendMessage(websocket.NewToolCompleted(conversationID, executionID, execResult, status))
+		sendToParticipants(deps, client, conversationID, websocket.NewToolCompleted(conversationID, executionID, execResult, status))
+		trackToolExecuted(deps, client.UserID, conversationID, executionID, mcpTool.Name(), status)
 
 		// Continue agentic loop
 		pending := &tools.PendingExecution{
@@ -804,7 +1610,7 @@ func handleStdioMCPToolCall(ctx context.Context, deps *Dependencies, client *web
 	}
 
 	// Send confirmation request to client with MCP indicator
-	client.SendMessage(&websocket.OutgoingMessage{
+	sendToParticipants(deps, client, conversationID, &websocket.OutgoingMessage{
 		Type:           websocket.TypeToolConfirm,
 		ConversationID: conversationID,
 		ExecutionID:    executionID,
@@ -817,7 +1623,8 @@ func handleStdioMCPToolCall(ctx context.Context, deps *Dependencies, client *web
 	})
 }
 
-// executeMCPTool executes an MCP tool (HTTP or stdio) after user confirmation
+// executeMCPTool executes an MCP tool (HTTP or stdio) after user confirmation.
+// It returns tools.ErrToolCancelled if ctx is cancelled before the tool finishes.
 func executeMCPTool(ctx context.Context, deps *Dependencies, pending *tools.PendingExecution) (*tools.ExecutionResult, error) {
 	var result interface{}
 	var err error
@@ -830,7 +1637,11 @@ func executeMCPTool(ctx context.Context, deps *Dependencies, pending *tools.Pend
 				Error:   "Stdio MCP client not available",
 			}, nil
 		}
-		result, err = deps.StdioMCPClient.ExecuteTool(ctx, pending.MCPServerID, pending.MCPToolName, pending.Parameters)
+		result, err = tools.ExecuteWithTimeout(ctx, toolTimeout(deps, pending.ToolName), func(ctx context.Context) (interface{}, error) {
+			return runWithSecrets(deps.SecretVault, pending.UserID, pending.Parameters, func(params map[string]interface{}) (interface{}, error) {
+				return deps.StdioMCPClient.ExecuteTool(ctx, pending.MCPServerID, pending.MCPToolName, params)
+			})
+		})
 	} else {
 		// Execute via HTTP MCP client
 		if deps.MCPClient == nil {
@@ -839,9 +1650,16 @@ func executeMCPTool(ctx context.Context, deps *Dependencies, pending *tools.Pend
 				Error:   "HTTP MCP client not available",
 			}, nil
 		}
-		result, err = deps.MCPClient.ExecuteTool(ctx, pending.MCPServerID, pending.MCPToolName, pending.Parameters)
+		result, err = tools.ExecuteWithTimeout(ctx, toolTimeout(deps, pending.ToolName), func(ctx context.Context) (interface{}, error) {
+			return runWithSecrets(deps.SecretVault, pending.UserID, pending.Parameters, func(params map[string]interface{}) (interface{}, error) {
+				return deps.MCPClient.ExecuteTool(ctx, pending.MCPServerID, pending.MCPToolName, params)
+			})
+		})
 	}
 
+	if errors.Is(err, tools.ErrToolCancelled) {
+		return nil, err
+	}
 	if err != nil {
 		return &tools.ExecutionResult{
 			Success: false,
@@ -855,6 +1673,62 @@ func executeMCPTool(ctx context.Context, deps *Dependencies, pending *tools.Pend
 	}, nil
 }
 
+// toolTimeout returns the execution timeout configured for a tool
+func toolTimeout(deps *Dependencies, name string) time.Duration {
+	if deps.ToolRegistry == nil {
+		return tools.DefaultToolTimeout
+	}
+	return deps.ToolRegistry.TimeoutFor(name)
+}
+
+// autoTitleConversation generates a title for an untitled conversation after
+// its first exchange and announces it to the participants
+func autoTitleConversation(deps *Dependencies, client *websocket.Client, conversationID string) {
+	if deps.TitleGenerator == nil || deps.Config == nil || !deps.Config.AutoTitleEnabled {
+		return
+	}
+
+	// Only one title generation per conversation at a time
+	if _, running := titlingConversations.LoadOrStore(conversationID, true); running {
+		return
+	}
+	defer titlingConversations.Delete(conversationID)
+
+	conversation, err := deps.ConversationRepo.GetByID(conversationID)
+	if err != nil || conversation == nil || conversation.Title != "" {
+		return
+	}
+
+	messages, err := deps.MessageRepo.ListByConversationID(conversationID)
+	if err != nil {
+		return
+	}
+	userMessages, hasReply := 0, false
+	for _, msg := range messages {
+		switch msg.Role {
+		case "user":
+			userMessages++
+		case "assistant":
+			hasReply = hasReply || strings.TrimSpace(msg.Content) != ""
+		}
+	}
+	if userMessages != 1 || !hasReply {
+		return
+	}
+
+	title, err := deps.TitleGenerator.Generate(context.Background(), conversation.UserID, conversation, messages)
+	if err != nil {
+		log.Printf("Failed to auto-title conversation %s: %v", conversationID, err)
+		return
+	}
+	if err := deps.ConversationRepo.Update(conversationID, title); err != nil {
+		log.Printf("Failed to save title for conversation %s: %v", conversationID, err)
+		return
+	}
+
+	sendToParticipants(deps, client, conversationID, websocket.NewConversationUpdated(conversationID, title))
+}
+
 // convertToRepoToolCalls converts LLM tool calls to repository format
 func convertToRepoToolCalls(llmCalls []llm.ToolCall) []repository.ToolCall {
 	if len(llmCalls) == 0 {
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/jacklau/prism/internal/database/repository"
+)
+
+// checkpointLabelLength caps how much of a prompt is used as a checkpoint label
+const checkpointLabelLength = 80
+
+// checkpointBeforeRun snapshots the user's workspace before an agent run so
+// its changes can be rolled back. Failures are logged and never block the run.
+func checkpointBeforeRun(deps *Dependencies, userID, prompt string) {
+	if deps.Checkpoints == nil {
+		return
+	}
+
+	label := strings.Join(strings.Fields(prompt), " ")
+	if len(label) > checkpointLabelLength {
+		label = strings.ToValidUTF8(label[:checkpointLabelLength], "") + "..."
+	}
+	label = "Before: " + label
+
+	if _, _, err := deps.Checkpoints.CreateIfChanged(context.Background(), userID, label, repository.CheckpointTriggerAgentRun); err != nil {
+		log.Printf("Failed to checkpoint workspace for user %s: %v", userID, err)
+	}
+}
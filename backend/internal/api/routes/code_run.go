@@ -0,0 +1,132 @@
+package routes
+
+import (
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/api/apierror"
+	ws "github.com/jacklau/prism/internal/api/websocket"
+	"github.com/jacklau/prism/internal/integrations"
+	"github.com/jacklau/prism/internal/integrations/github"
+	"github.com/jacklau/prism/internal/services/coderunner"
+)
+
+// handleCodeRun starts a streaming code run via WebSocket. Output is
+// published as code.output messages on the run's topic, which the requesting
+// client is subscribed to before the run starts.
+func handleCodeRun(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
+	if deps.CodeRunner == nil {
+		client.SendMessage(ws.NewError("code_runner_unavailable", "code runner not available"))
+		return
+	}
+
+	req := &github.CodeRunRequest{Environment: "shell"}
+	if msg.Params != nil {
+		if command, ok := msg.Params["command"].(string); ok {
+			req.Command = command
+		}
+		if environment, ok := msg.Params["environment"].(string); ok && environment != "" {
+			req.Environment = environment
+		}
+		if timeout, ok := msg.Params["timeout_seconds"].(float64); ok && timeout > 0 {
+			req.Timeout = int(timeout)
+		}
+	}
+
+	if req.Command == "" {
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "command is required"))
+		return
+	}
+	if err := coderunner.ValidateCommand(req.Command); err != nil {
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, err.Error()))
+		return
+	}
+
+	// Run in the user's workspace when one is available
+	if deps.SandboxService != nil {
+		if workDir, err := deps.SandboxService.GetOrCreateWorkDir(client.UserID); err == nil {
+			req.WorkDir = workDir
+		}
+	}
+
+	if deps.IntegrationManager != nil {
+		deps.IntegrationManager.Track(&integrations.Event{
+			Type:   "code.execution_requested",
+			UserID: client.UserID,
+			Data: map[string]interface{}{
+				"environment": req.Environment,
+				"command":     req.Command,
+				"streaming":   true,
+			},
+		})
+	}
+
+	// Subscribe before starting so no output is missed
+	runID := uuid.New().String()
+	topic := ws.CodeTopic(runID)
+	deps.WSHub.Subscribe(client, topic)
+
+	execution, err := deps.CodeRunner.Start(req, coderunner.StreamOptions{
+		RunID:  runID,
+		UserID: client.UserID,
+		OnOutput: func(line coderunner.OutputLine) {
+			deps.WSHub.Publish(client.UserID, ws.NewCodeOutput(runID, line.Content, line.Stream), topic)
+		},
+	})
+	if err != nil {
+		deps.WSHub.Unsubscribe(client, topic)
+		client.SendMessage(ws.NewError("code_run_error", err.Error()))
+		return
+	}
+
+	deps.WSHub.Publish(client.UserID, ws.NewCodeStarted(runID, req.Environment), topic)
+
+	go func() {
+		result := execution.Wait()
+
+		status := "success"
+		switch {
+		case execution.Cancelled():
+			status = "cancelled"
+		case result.ExitCode != 0:
+			status = "error"
+		}
+		deps.WSHub.Publish(client.UserID, ws.NewCodeCompleted(runID, status, result, result.Duration), topic)
+
+		if deps.IntegrationManager != nil {
+			deps.IntegrationManager.Track(&integrations.Event{
+				Type:   "code.execution_completed",
+				UserID: client.UserID,
+				Data: map[string]interface{}{
+					"environment": req.Environment,
+					"exit_code":   result.ExitCode,
+					"duration_ms": result.Duration,
+					"cancelled":   status == "cancelled",
+				},
+			})
+		}
+	}()
+}
+
+// handleCodeStop cancels a streaming code run via WebSocket
+func handleCodeStop(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
+	if deps.CodeRunner == nil {
+		client.SendMessage(ws.NewError("code_runner_unavailable", "code runner not available"))
+		return
+	}
+
+	runID := ""
+	if msg.Params != nil {
+		if id, ok := msg.Params["run_id"].(string); ok {
+			runID = id
+		}
+	}
+
+	if runID == "" {
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "run_id is required"))
+		return
+	}
+
+	if err := deps.CodeRunner.Stop(runID, client.UserID); err != nil {
+		client.SendMessage(ws.NewError(apierror.CodeNotFound, "run not found: "+runID))
+	}
+	// code.completed with status "cancelled" is published once the process exits
+}
@@ -0,0 +1,240 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/api/apierror"
+	"github.com/jacklau/prism/internal/api/websocket"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/llm"
+)
+
+// handleChatCompare sends one prompt to several provider/model pairs at once
+// and streams each answer in its own lane, so users can compare them. Every
+// answer is saved; later turns continue from the first lane's. Tools are not
+// offered, since the lanes would otherwise edit the workspace concurrently.
+func handleChatCompare(deps *Dependencies, client *websocket.Client, msg *websocket.IncomingMessage) {
+	if msg.ConversationID == "" {
+		client.SendMessage(websocket.NewError(apierror.CodeInvalidRequest, "conversation_id is required"))
+		return
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		client.SendMessage(websocket.NewError(apierror.CodeInvalidRequest, "content is required"))
+		return
+	}
+	if len(msg.Models) < 2 || len(msg.Models) > 4 {
+		client.SendMessage(websocket.NewError(apierror.CodeInvalidRequest, "models must list 2 to 4 provider/model pairs"))
+		return
+	}
+
+	conversation, err := deps.ConversationRepo.GetByID(msg.ConversationID)
+	if err != nil {
+		client.SendMessage(websocket.NewError("database_error", "failed to get conversation: "+err.Error()))
+		return
+	}
+	if conversation == nil {
+		client.SendMessage(websocket.NewError(apierror.CodeNotFound, "conversation not found"))
+		return
+	}
+
+	access, err := conversationAccess(deps, conversation, client.UserID)
+	if err != nil {
+		client.SendMessage(websocket.NewError("database_error", "failed to check conversation access: "+err.Error()))
+		return
+	}
+	if !canSendToConversation(access) {
+		client.SendMessage(websocket.NewError(apierror.CodeForbidden, "not authorized to access this conversation"))
+		return
+	}
+
+	// A comparison counts as the conversation's one running generation, so
+	// chat.stop cancels every lane; each lane can also be stopped on its own
+	ctx, cancel := context.WithCancel(context.Background())
+	gen, ok := generations.start(msg.ConversationID, client.UserID, generationCompare, cancel)
+	if !ok {
+		cancel()
+		client.SendMessage(websocket.NewError("conversation_busy", "a response is already being generated for this conversation"))
+		return
+	}
+	defer func() {
+		generations.finish(gen)
+		cancel()
+	}()
+
+	version, err := deps.ConversationRepo.IncrementVersion(msg.ConversationID, msg.ExpectedVersion)
+	if err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			conflict := websocket.NewError("version_conflict", "conversation was updated by another participant")
+			conflict.ConversationID = msg.ConversationID
+			if current, err := deps.ConversationRepo.GetVersion(msg.ConversationID); err == nil {
+				conflict.Version = current
+			}
+			client.SendMessage(conflict)
+			return
+		}
+		client.SendMessage(websocket.NewError("database_error", "failed to update conversation: "+err.Error()))
+		return
+	}
+
+	resetIterationCount(msg.ConversationID)
+	takePausedToolCalls(msg.ConversationID)
+
+	compareID := uuid.New().String()
+	userMsg, err := deps.MessageRepo.Create(msg.ConversationID, "user", msg.Content, nil, "")
+	if err != nil {
+		client.SendMessage(websocket.NewError("database_error", "failed to save message: "+err.Error()))
+		return
+	}
+	if err := deps.MessageRepo.SetMetadata(userMsg.ID, map[string]interface{}{"compare_id": compareID}); err != nil {
+		log.Printf("Failed to save comparison metadata: %v", err)
+	}
+	broadcastToParticipants(deps, msg.ConversationID, client.UserID,
+		websocket.NewChatUserMessage(msg.ConversationID, userMsg.ID, client.UserID, msg.Content, version))
+
+	messages, err := deps.MessageRepo.ListByConversationID(msg.ConversationID)
+	if err != nil {
+		client.SendMessage(websocket.NewError("database_error", "failed to get message history: "+err.Error()))
+		return
+	}
+	llmMessages := shapeHistory(deps, conversation, buildLLMMessages(buildSystemPrompt(deps, client.UserID, conversation), messages, userMsg))
+
+	lanes := make([]websocket.CompareLane, len(msg.Models))
+	for i, choice := range msg.Models {
+		lanes[i] = websocket.CompareLane{
+			MessageID: uuid.New().String(),
+			Provider:  choice.Provider,
+			Model:     choice.Model,
+		}
+	}
+	sendToParticipants(deps, client, msg.ConversationID, websocket.NewChatCompareStarted(msg.ConversationID, compareID, lanes))
+
+	var wg sync.WaitGroup
+	for i, lane := range lanes {
+		wg.Add(1)
+		laneCtx, laneCancel := context.WithCancel(ctx)
+		laneGen := generations.startChild(gen, generationCompareLane, laneCancel)
+		go func(i int, lane websocket.CompareLane) {
+			defer wg.Done()
+			defer func() {
+				generations.finish(laneGen)
+				laneCancel()
+			}()
+			streamCompareLane(laneCtx, deps, client, msg.ConversationID, compareID, i, lane, llmMessages)
+		}(i, lane)
+	}
+	wg.Wait()
+
+	sendToParticipants(deps, client, msg.ConversationID, websocket.NewChatCompareCompleted(msg.ConversationID, compareID))
+
+	go autoTitleConversation(deps, client, msg.ConversationID)
+}
+
+// streamCompareLane streams one model's answer in a comparison and saves it
+func streamCompareLane(ctx context.Context, deps *Dependencies, client *websocket.Client, conversationID, compareID string, index int, lane websocket.CompareLane, messages []llm.Message) {
+	laneError := func(code, message string) {
+		errMsg := websocket.NewError(code, message)
+		errMsg.ConversationID = conversationID
+		errMsg.MessageID = lane.MessageID
+		client.SendMessage(errMsg)
+		sendToParticipants(deps, client, conversationID, websocket.NewChatComplete(conversationID, lane.MessageID, "error"))
+	}
+
+	ctx, ok := loadProviderKey(ctx, deps, client.UserID, lane.Provider)
+	if !ok {
+		laneError("api_key_missing", "API key not configured for provider: "+lane.Provider+". Please add your API key in Settings.")
+		return
+	}
+
+	ctx = withLLMDebug(ctx, deps, conversationID)
+	stream, err := deps.LLMManager.Chat(ctx, lane.Provider, &llm.ChatRequest{
+		Model:    lane.Model,
+		Messages: messages,
+		Stream:   true,
+	})
+	if err != nil {
+		laneError("llm_error", "failed to start chat: "+err.Error())
+		return
+	}
+
+	var response strings.Builder
+	finishReason := ""
+	tokensUsed := 0
+	for chunk := range stream {
+		if ctx.Err() != nil {
+			finishReason = "stop"
+			break
+		}
+		if chunk.Error != nil {
+			errMsg := websocket.NewError("stream_error", chunk.Error.Error())
+			errMsg.ConversationID = conversationID
+			errMsg.MessageID = lane.MessageID
+			client.SendMessage(errMsg)
+			finishReason = "error"
+			break
+		}
+		if chunk.Delta != "" {
+			response.WriteString(chunk.Delta)
+			sendToParticipants(deps, client, conversationID, websocket.NewChatChunk(conversationID, lane.MessageID, chunk.Delta))
+		}
+		if chunk.FinishReason != "" {
+			finishReason = chunk.FinishReason
+		}
+		if chunk.Usage != nil {
+			tokensUsed = chunk.Usage.TotalTokens
+		}
+	}
+
+	recordSharedKeyUsage(deps, client.UserID, lane.Provider, lane.Model, tokensUsed)
+
+	if response.Len() > 0 {
+		saved, err := deps.MessageRepo.Create(conversationID, "assistant", response.String(), nil, "")
+		if err != nil {
+			log.Printf("Failed to save comparison answer: %v", err)
+		} else {
+			if tokensUsed > 0 {
+				if err := deps.MessageRepo.SetTokensUsed(saved.ID, tokensUsed); err != nil {
+					log.Printf("Failed to save message token usage: %v", err)
+				}
+			}
+			metadata := map[string]interface{}{
+				"provider":   lane.Provider,
+				"model":      lane.Model,
+				"compare_id": compareID,
+				"lane":       index,
+			}
+			if err := deps.MessageRepo.SetMetadata(saved.ID, metadata); err != nil {
+				log.Printf("Failed to save comparison metadata: %v", err)
+			}
+		}
+	}
+
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+	sendToParticipants(deps, client, conversationID, websocket.NewChatComplete(conversationID, lane.MessageID, finishReason))
+}
+
+// comparisonAnswers picks, for each comparison in a history, the answer
+// later turns continue from: the one from the lowest lane that was saved.
+// Returns message IDs keyed by comparison ID.
+func comparisonAnswers(history []*repository.Message) map[string]string {
+	answers := make(map[string]string)
+	lowest := make(map[string]float64)
+	for _, msg := range history {
+		compareID, _ := msg.Metadata["compare_id"].(string)
+		lane, ok := msg.Metadata["lane"].(float64)
+		if msg.Role != "assistant" || compareID == "" || !ok {
+			continue
+		}
+		if current, seen := lowest[compareID]; !seen || lane < current {
+			lowest[compareID] = lane
+			answers[compareID] = msg.ID
+		}
+	}
+	return answers
+}
@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jacklau/prism/internal/api/apierror"
+	ws "github.com/jacklau/prism/internal/api/websocket"
+	"github.com/jacklau/prism/internal/services/concurrency"
+)
+
+// runWithSlot starts a run once the user has a free slot for its kind of
+// work, and holds the slot until finished(id) returns. start returns the ID
+// of what it started, or "" if nothing started. A user at their limit is told
+// the run is queued; it starts when one of their others finishes, or fails
+// with limit_reached after the queue timeout. A queued run is dropped if the
+// client disconnects. abandoned, if not nil, is called when the run never
+// starts.
+func runWithSlot(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage, kind string, start func() string, finished func(id string), abandoned func()) {
+	run := func(release func()) {
+		id := start()
+		if id == "" {
+			release()
+			return
+		}
+		go func() {
+			defer release()
+			finished(id)
+		}()
+	}
+
+	if release, ok := deps.Concurrency.TryAcquire(client.UserID, kind); ok {
+		run(release)
+		return
+	}
+
+	client.SendMessage(ws.NewLimitQueued(&ws.LimitInfo{
+		RequestType: msg.Type,
+		Kind:        kind,
+		Limit:       deps.Concurrency.UserLimits(client.UserID).Of(kind),
+		Running:     deps.Concurrency.Running(client.UserID).Of(kind),
+		TimeoutMs:   deps.Concurrency.QueueTimeout().Milliseconds(),
+	}))
+
+	// Wait off the client's read loop, so its other messages are still handled
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-client.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		release, err := deps.Concurrency.Acquire(ctx, client.UserID, kind)
+		if err != nil {
+			if abandoned != nil {
+				abandoned()
+			}
+			if ctx.Err() != nil {
+				return // The client is gone
+			}
+			errMsg := ws.NewError(apierror.CodeLimitReached, err.Error())
+			var limitErr *concurrency.LimitError
+			if errors.As(err, &limitErr) {
+				errMsg.Metadata = map[string]interface{}{
+					"request_type": msg.Type,
+					"kind":         limitErr.Kind,
+					"limit":        limitErr.Limit,
+				}
+			}
+			client.SendMessage(errMsg)
+			return
+		}
+		run(release)
+	}()
+}
+
+// waitForExecution blocks until an agent execution finishes
+func waitForExecution(deps *Dependencies) func(id string) {
+	return func(id string) {
+		if execution, err := deps.AgentManager.GetExecution(id); err == nil {
+			execution.Wait()
+		}
+	}
+}
+
+// waitForSwarm blocks until a swarm finishes
+func waitForSwarm(deps *Dependencies) func(id string) {
+	return func(id string) {
+		if swarm, err := deps.AgentManager.GetSwarm(id); err == nil {
+			swarm.Wait()
+		}
+	}
+}
+
+// waitForBuild blocks until a build finishes
+func waitForBuild(deps *Dependencies) func(id string) {
+	return func(id string) {
+		for {
+			build, err := deps.SandboxService.GetBuild(id)
+			if err != nil || build.GetStatus().IsFinished() {
+				return
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/mcp"
+	"github.com/jacklau/prism/internal/services/modelinfo"
+)
+
+// messageOverheadTokens approximates the tokens a provider adds around each
+// message for its role and separators
+const messageOverheadTokens = 4
+
+// TurnTokenEstimate breaks down the estimated input tokens of a turn
+type TurnTokenEstimate struct {
+	System   int `json:"system"`
+	Messages int `json:"messages"`
+	Draft    int `json:"draft,omitempty"`
+	Tools    int `json:"tools"`
+	Total    int `json:"total"`
+}
+
+// TurnEstimate is the estimated size and cost of a conversation's next turn
+type TurnEstimate struct {
+	ConversationID  string            `json:"conversation_id"`
+	Provider        string            `json:"provider"`
+	Model           string            `json:"model"`
+	Tokens          TurnTokenEstimate `json:"tokens"`
+	MessageCount    int               `json:"message_count"`
+	ToolCount       int               `json:"tool_count"`
+	ContextWindow   int               `json:"context_window,omitempty"`    // 0 if unknown
+	ContextUsed     float64           `json:"context_used,omitempty"`      // Fraction of the context window the input fills
+	ExceedsContext  bool              `json:"exceeds_context"`             // The input won't fit the context window
+	MaxOutputTokens int               `json:"max_output_tokens,omitempty"` // 0 if unknown
+	Pricing         *llm.ModelPricing `json:"pricing,omitempty"`           // nil if unknown
+
+	// Costs in US dollars, nil without pricing: the input alone, and with
+	// the longest answer the model can give
+	InputCost *float64 `json:"input_cost,omitempty"`
+	MaxCost   *float64 `json:"max_cost,omitempty"`
+}
+
+// estimateTurn reports the token count and cost of the context the next turn
+// of a conversation would send: the system prompt with project instructions
+// and pinned files, the message history, an optional draft message given as
+// content, and the definitions of the tools offered. The turn's model can be
+// chosen with provider and model, as a chat.message override would; it
+// defaults to the one the conversation's turns run on. Tokens are counted
+// roughly from characters, so the figures are estimates.
+func estimateTurn(deps *Dependencies) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := middleware.GetUserID(c)
+
+		conversation, err := deps.ConversationRepo.GetByID(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to get conversation",
+			})
+		}
+		if conversation == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "conversation not found",
+			})
+		}
+
+		access, err := conversationAccess(deps, conversation, userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to check conversation access",
+			})
+		}
+		if !canSendToConversation(access) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "access denied",
+			})
+		}
+
+		provider, model := turnModel(deps, conversation)
+		if c.Query("provider") != "" && c.Query("model") == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "model is required when overriding the provider",
+			})
+		}
+		if c.Query("model") != "" {
+			model = c.Query("model")
+			if c.Query("provider") != "" {
+				provider = c.Query("provider")
+			}
+		}
+
+		history, err := deps.MessageRepo.ListByConversationID(conversation.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to get messages",
+			})
+		}
+
+		estimate := &TurnEstimate{
+			ConversationID: conversation.ID,
+			Provider:       provider,
+			Model:          model,
+		}
+
+		for _, msg := range shapeHistory(deps, conversation, buildLLMMessages(buildSystemPrompt(deps, userID, conversation), history, nil)) {
+			tokens := estimateMessageTokens(msg)
+			if msg.Role == "system" {
+				estimate.Tokens.System += tokens
+				continue
+			}
+			estimate.Tokens.Messages += tokens
+			estimate.MessageCount++
+		}
+		if draft := c.Query("content"); draft != "" {
+			estimate.Tokens.Draft = llm.EstimateTokens(draft) + messageOverheadTokens
+		}
+
+		toolDefs := turnTools(deps, userID)
+		estimate.ToolCount = len(toolDefs)
+		if len(toolDefs) > 0 {
+			if data, err := json.Marshal(toolDefs); err == nil {
+				estimate.Tokens.Tools = llm.EstimateTokens(string(data))
+			}
+		}
+
+		estimate.Tokens.Total = estimate.Tokens.System + estimate.Tokens.Messages + estimate.Tokens.Draft + estimate.Tokens.Tools
+
+		if deps.ModelInfo != nil {
+			caps, err := deps.ModelInfo.Get(provider, model)
+			if errors.Is(err, modelinfo.ErrProviderNotFound) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "provider not found",
+				})
+			}
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "failed to get model capabilities",
+				})
+			}
+			applyModelEstimate(estimate, caps)
+		}
+
+		return c.JSON(estimate)
+	}
+}
+
+// applyModelEstimate fills in the context use and costs of a turn on a model
+func applyModelEstimate(estimate *TurnEstimate, caps *modelinfo.Capabilities) {
+	estimate.ContextWindow = caps.ContextWindow
+	estimate.MaxOutputTokens = caps.MaxOutputTokens
+	if caps.ContextWindow > 0 {
+		estimate.ContextUsed = float64(estimate.Tokens.Total) / float64(caps.ContextWindow)
+		estimate.ExceedsContext = estimate.Tokens.Total > caps.ContextWindow
+	}
+
+	if caps.Pricing == nil {
+		return
+	}
+	estimate.Pricing = caps.Pricing
+	inputCost := float64(estimate.Tokens.Total) * caps.Pricing.InputPerMillion / 1e6
+	estimate.InputCost = &inputCost
+	if caps.MaxOutputTokens > 0 {
+		maxCost := inputCost + float64(caps.MaxOutputTokens)*caps.Pricing.OutputPerMillion/1e6
+		estimate.MaxCost = &maxCost
+	}
+}
+
+// turnTools returns the definitions of the tools a turn offers the user:
+// built-in tools they may use plus their HTTP and stdio MCP tools
+func turnTools(deps *Dependencies, userID string) []llm.ToolDefinition {
+	toolDefs := registryTools(deps, userID)
+	if deps.MCPClient != nil {
+		toolDefs = append(toolDefs, mcp.ToLLMToolDefinitions(mcp.GetMCPToolsForUser(deps.MCPClient, userID))...)
+	}
+	if deps.StdioMCPClient != nil {
+		toolDefs = append(toolDefs, mcp.StdioToLLMToolDefinitions(mcp.GetStdioMCPToolsForUser(deps.StdioMCPClient, userID))...)
+	}
+	return toolDefs
+}
+
+// estimateMessageTokens roughly estimates the tokens of a message, including
+// the tool calls it makes
+func estimateMessageTokens(msg llm.Message) int {
+	tokens := llm.EstimateTokens(msg.Content) + messageOverheadTokens
+	if len(msg.ToolCalls) > 0 {
+		if data, err := json.Marshal(msg.ToolCalls); err == nil {
+			tokens += llm.EstimateTokens(string(data))
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,333 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/api/middleware"
+	"github.com/jacklau/prism/internal/cluster"
+)
+
+// Kinds of generation
+const (
+	generationChat        = "chat"         // A chat.message turn
+	generationTool        = "tool"         // A confirmed tool call and the response continuing from it
+	generationContinue    = "continue"     // An agentic loop resumed after a check-in
+	generationAgent       = "agent"        // An agent.run continuing the conversation
+	generationCompare     = "compare"      // A chat.compare
+	generationCompareLane = "compare_lane" // One model's answer in a chat.compare
+)
+
+// generation is a piece of work running on a conversation that can be
+// stopped. Work started on behalf of another generation is registered as
+// its child, so stopping a generation stops its children too.
+type generation struct {
+	ID             string    `json:"id"`
+	ParentID       string    `json:"parent_id,omitempty"`
+	ConversationID string    `json:"conversation_id"`
+	UserID         string    `json:"user_id"`
+	Kind           string    `json:"kind"`
+	StartedAt      time.Time `json:"started_at"`
+	Stopping       bool      `json:"stopping"` // Stopped, but its work hasn't wound down yet
+
+	cancel context.CancelFunc
+}
+
+// generationRegistry tracks the generations running on this server. A
+// conversation runs one generation at a time, apart from generations that
+// have been stopped and are still winding down.
+type generationRegistry struct {
+	byID           map[string]*generation
+	byConversation map[string]map[string]*generation
+	mu             sync.Mutex
+}
+
+// generations tracks active generations for cancellation
+var generations = &generationRegistry{
+	byID:           make(map[string]*generation),
+	byConversation: make(map[string]map[string]*generation),
+}
+
+// add registers a generation; the caller holds the lock
+func (r *generationRegistry) add(conversationID, userID, kind, parentID string, cancel context.CancelFunc) *generation {
+	g := &generation{
+		ID:             uuid.New().String(),
+		ParentID:       parentID,
+		ConversationID: conversationID,
+		UserID:         userID,
+		Kind:           kind,
+		StartedAt:      time.Now(),
+		cancel:         cancel,
+	}
+	r.byID[g.ID] = g
+	if r.byConversation[conversationID] == nil {
+		r.byConversation[conversationID] = make(map[string]*generation)
+	}
+	r.byConversation[conversationID][g.ID] = g
+	return g
+}
+
+// running returns the conversation's running top-level generation, if any;
+// the caller holds the lock
+func (r *generationRegistry) running(conversationID string) *generation {
+	for _, g := range r.byConversation[conversationID] {
+		if g.ParentID == "" && !g.Stopping {
+			return g
+		}
+	}
+	return nil
+}
+
+// start registers a generation for a conversation, unless another one is
+// already running there
+func (r *generationRegistry) start(conversationID, userID, kind string, cancel context.CancelFunc) (*generation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running(conversationID) != nil {
+		return nil, false
+	}
+	return r.add(conversationID, userID, kind, "", cancel), true
+}
+
+// join registers work on a conversation as a child of the generation
+// running there, or as a generation of its own if none is
+func (r *generationRegistry) join(conversationID, userID, kind string, cancel context.CancelFunc) *generation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	parentID := ""
+	if parent := r.running(conversationID); parent != nil {
+		parentID = parent.ID
+	}
+	return r.add(conversationID, userID, kind, parentID, cancel)
+}
+
+// startChild registers work started on behalf of a generation
+func (r *generationRegistry) startChild(parent *generation, kind string, cancel context.CancelFunc) *generation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	child := r.add(parent.ConversationID, parent.UserID, kind, parent.ID, cancel)
+	child.Stopping = parent.Stopping
+	return child
+}
+
+// finish removes a generation once its work has ended. Only that generation
+// is removed, so one that started after it was stopped keeps running.
+func (r *generationRegistry) finish(g *generation) {
+	if g == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.byID, g.ID)
+	if conversation := r.byConversation[g.ConversationID]; conversation != nil {
+		delete(conversation, g.ID)
+		if len(conversation) == 0 {
+			delete(r.byConversation, g.ConversationID)
+		}
+	}
+}
+
+// stop cancels a generation and its descendants, reporting whether it was
+// running
+func (r *generationRegistry) stop(id string) bool {
+	r.mu.Lock()
+	g, ok := r.byID[id]
+	var stopped []*generation
+	if ok {
+		for _, other := range r.byConversation[g.ConversationID] {
+			if r.descendsFrom(other, id) {
+				other.Stopping = true
+				stopped = append(stopped, other)
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	// Cancel outside the lock; agent runs cancel through the agent manager
+	for _, s := range stopped {
+		s.cancel()
+	}
+	if ok {
+		log.Printf("Generation %s (%s) stopped for conversation: %s", id, g.Kind, g.ConversationID)
+	}
+	return ok
+}
+
+// descendsFrom reports whether g is the generation id or one of its
+// descendants; the caller holds the lock
+func (r *generationRegistry) descendsFrom(g *generation, id string) bool {
+	for g != nil {
+		if g.ID == id {
+			return true
+		}
+		g = r.byID[g.ParentID]
+	}
+	return false
+}
+
+// stopConversation cancels every generation of a conversation, reporting
+// whether any was running
+func (r *generationRegistry) stopConversation(conversationID string) bool {
+	r.mu.Lock()
+	var stopped []*generation
+	for _, g := range r.byConversation[conversationID] {
+		g.Stopping = true
+		stopped = append(stopped, g)
+	}
+	r.mu.Unlock()
+
+	for _, g := range stopped {
+		g.cancel()
+	}
+	if len(stopped) > 0 {
+		log.Printf("Generation stopped for conversation: %s", conversationID)
+	}
+	return len(stopped) > 0
+}
+
+// get returns a copy of a running generation
+func (r *generationRegistry) get(id string) (generation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	g, ok := r.byID[id]
+	if !ok {
+		return generation{}, false
+	}
+	return *g, true
+}
+
+// list returns copies of the running generations that keep accepts, oldest
+// first
+func (r *generationRegistry) list(keep func(g *generation) bool) []generation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := []generation{}
+	for _, g := range r.byID {
+		if keep(g) {
+			result = append(result, *g)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt.Before(result[j].StartedAt)
+	})
+	return result
+}
+
+// stopRemoteGeneration handles a stop request sent by another replica
+func stopRemoteGeneration(req *cluster.StopRequest) {
+	if req.GenerationID == "" {
+		generations.stopConversation(req.ConversationID)
+		takePausedToolCalls(req.ConversationID)
+		return
+	}
+	if g, ok := generations.get(req.GenerationID); ok && g.ConversationID == req.ConversationID {
+		generations.stop(req.GenerationID)
+	}
+}
+
+// forwardStop asks the other replicas to stop a conversation's generations,
+// or one generation if generationID is set, in case they're running there
+func forwardStop(deps *Dependencies, conversationID, generationID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := deps.Cluster.StopGeneration(ctx, &cluster.StopRequest{
+		ConversationID: conversationID,
+		GenerationID:   generationID,
+	})
+	if err != nil {
+		log.Printf("Failed to ask other replicas to stop conversation %s: %v", conversationID, err)
+	}
+}
+
+// listUserGenerations lists the generations running on this server that the
+// caller started
+func listUserGenerations(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	return c.JSON(fiber.Map{
+		"generations": generations.list(func(g *generation) bool {
+			return g.UserID == userID
+		}),
+	})
+}
+
+// listConversationGenerations lists the generations running on this server
+// for a conversation
+func listConversationGenerations(deps *Dependencies) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		conversationID := c.Params("id")
+		if status, message := checkGenerationAccess(deps, conversationID, middleware.GetUserID(c), false); status != 0 {
+			return c.Status(status).JSON(fiber.Map{"error": message})
+		}
+		return c.JSON(fiber.Map{
+			"generations": generations.list(func(g *generation) bool {
+				return g.ConversationID == conversationID
+			}),
+		})
+	}
+}
+
+// stopGenerations stops one of a conversation's generations and those it
+// started, or every generation of the conversation when no generation ID is
+// given. A generation not running here may be running on another replica, so
+// with a cluster the request is forwarded and accepted.
+func stopGenerations(deps *Dependencies) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		conversationID := c.Params("id")
+		generationID := c.Params("generationId")
+		if status, message := checkGenerationAccess(deps, conversationID, middleware.GetUserID(c), true); status != 0 {
+			return c.Status(status).JSON(fiber.Map{"error": message})
+		}
+
+		if generationID == "" {
+			stopped := generations.stopConversation(conversationID)
+			takePausedToolCalls(conversationID)
+			if deps.Cluster != nil {
+				forwardStop(deps, conversationID, "")
+			}
+			return c.JSON(fiber.Map{"stopped": stopped})
+		}
+
+		if g, ok := generations.get(generationID); ok {
+			if g.ConversationID != conversationID {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "generation not found",
+				})
+			}
+			generations.stop(generationID)
+			return c.JSON(fiber.Map{"stopped": true})
+		}
+		if deps.Cluster == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "generation not found",
+			})
+		}
+		forwardStop(deps, conversationID, generationID)
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"stopped": false})
+	}
+}
+
+// checkGenerationAccess checks the caller may see a conversation's
+// generations, or stop them if stop is set. It returns an HTTP status and
+// error message on failure, or a zero status.
+func checkGenerationAccess(deps *Dependencies, conversationID, userID string, stop bool) (int, string) {
+	conversation, err := deps.ConversationRepo.GetByID(conversationID)
+	if err != nil {
+		return fiber.StatusInternalServerError, "failed to get conversation"
+	}
+	if conversation == nil {
+		return fiber.StatusNotFound, "conversation not found"
+	}
+	access, err := conversationAccess(deps, conversation, userID)
+	if err != nil {
+		return fiber.StatusInternalServerError, "failed to check conversation access"
+	}
+	if access == "" || (stop && !canSendToConversation(access)) {
+		return fiber.StatusForbidden, "access denied"
+	}
+	return 0, ""
+}
@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jacklau/prism/internal/api/apierror"
+	ws "github.com/jacklau/prism/internal/api/websocket"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/sandbox"
+)
+
+// runIdempotent starts the work a WebSocket message asks for at most once
+// per idempotency key. start returns the ID of what it started (an
+// execution or build), or "" if it failed and may be retried. A retry of a
+// message that already started something gets replay(id) instead, which
+// reports on the existing run.
+func runIdempotent(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage, start func() string, replay func(id string)) {
+	if finish, ok := claimIdempotencyKey(deps, client, msg, replay); ok {
+		finish(start())
+	}
+}
+
+// runIdempotentWithSlot is runIdempotent for work limited per user by
+// runWithSlot. The key is claimed before the run waits for a slot, so a
+// retry of a queued message is told it is in progress rather than queued
+// again.
+func runIdempotentWithSlot(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage, kind string, start func() string, finished func(id string), replay func(id string)) {
+	finish, ok := claimIdempotencyKey(deps, client, msg, replay)
+	if !ok {
+		return
+	}
+	runWithSlot(deps, client, msg, kind,
+		func() string {
+			id := start()
+			finish(id)
+			return id
+		},
+		finished,
+		func() { finish("") })
+}
+
+// claimIdempotencyKey claims a message's idempotency key. It reports false
+// if the message must not run, having answered the client: with replay(id)
+// for a retry of a message that already started something, or an error.
+// Otherwise the caller runs the message and passes finish the ID of what it
+// started, or "" to release the key for a retry.
+func claimIdempotencyKey(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage, replay func(id string)) (finish func(id string), ok bool) {
+	if deps.IdempotencyRepo == nil || msg.IdempotencyKey == "" {
+		return func(string) {}, true
+	}
+
+	payload, _ := json.Marshal(msg)
+	hash := sha256.Sum256(payload)
+	requestHash := hex.EncodeToString(hash[:])
+
+	existing, err := deps.IdempotencyRepo.Begin(&repository.IdempotencyRecord{
+		UserID:      client.UserID,
+		Key:         msg.IdempotencyKey,
+		Scope:       "ws " + msg.Type,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().Add(deps.Config.IdempotencyKeyTTL),
+	})
+	if err != nil {
+		client.SendMessage(ws.NewError("database_error", "failed to check idempotency key: "+err.Error()))
+		return nil, false
+	}
+
+	if existing != nil {
+		switch {
+		case existing.RequestHash != requestHash:
+			client.SendMessage(ws.NewError(apierror.CodeUnprocessable, "idempotency_key was already used for a different request"))
+		case !existing.Completed:
+			client.SendMessage(ws.NewError(apierror.CodeConflict, "a request with this idempotency_key is still in progress"))
+		default:
+			replay(string(existing.ResponseBody))
+		}
+		return nil, false
+	}
+
+	return func(id string) {
+		var err error
+		if id == "" {
+			err = deps.IdempotencyRepo.Release(client.UserID, msg.IdempotencyKey)
+		} else {
+			err = deps.IdempotencyRepo.Complete(client.UserID, msg.IdempotencyKey, 0, "", []byte(id))
+		}
+		if err != nil {
+			log.Printf("Failed to record idempotency key: %v", err)
+		}
+	}, true
+}
+
+// replayAgentRun answers a retried agent run with the status of the
+// execution the first request started
+func replayAgentRun(deps *Dependencies, client *ws.Client, executionID string) {
+	handleAgentStatus(deps, client, &ws.IncomingMessage{
+		Type:        ws.TypeAgentStatus,
+		ExecutionID: executionID,
+	})
+}
+
+// replayBuildStart answers a retried build start by subscribing the client
+// to the build the first request started and reporting where it is
+func replayBuildStart(deps *Dependencies, client *ws.Client, buildID string) {
+	if deps.SandboxService == nil {
+		client.SendMessage(ws.NewError("sandbox_unavailable", "sandbox service not available"))
+		return
+	}
+
+	build, err := deps.SandboxService.GetBuild(buildID)
+	if err != nil {
+		client.SendMessage(ws.NewError("build_error", err.Error()))
+		return
+	}
+
+	deps.WSHub.Subscribe(client, ws.BuildTopic(build.ID))
+
+	switch build.Status {
+	case sandbox.BuildStatusSuccess, sandbox.BuildStatusFailed, sandbox.BuildStatusCancelled, sandbox.BuildStatusCancelledBeforeStart:
+		var duration int64
+		if build.EndTime != nil {
+			duration = build.EndTime.Sub(build.StartTime).Milliseconds()
+		}
+		previewURL := deps.SandboxService.PreviewURL(build)
+		client.SendMessage(ws.NewBuildCompleted(build.ID, build.Status == sandbox.BuildStatusSuccess, previewURL, duration))
+	default:
+		client.SendMessage(ws.NewBuildStarted(build.ID))
+	}
+}
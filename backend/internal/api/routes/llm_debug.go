@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"context"
+	"log"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/llm"
+)
+
+// withLLMDebug captures the provider traffic of chat requests made with the
+// returned context when the conversation has LLM debugging on
+func withLLMDebug(ctx context.Context, deps *Dependencies, conversationID string) context.Context {
+	if deps.LLMDebugRepo == nil {
+		return ctx
+	}
+	conversation, err := deps.ConversationRepo.GetByID(conversationID)
+	if err != nil || conversation == nil || !conversation.LLMDebug {
+		return ctx
+	}
+
+	return llm.WithDebugRecorder(ctx, func(exchange *llm.DebugExchange) {
+		entry := &repository.LLMDebugEntry{
+			ConversationID: conversationID,
+			Provider:       exchange.Provider,
+			Model:          exchange.Model,
+			Method:         exchange.Method,
+			URL:            exchange.URL,
+			StatusCode:     exchange.StatusCode,
+			Error:          exchange.Error,
+			Duration:       exchange.Duration,
+			RequestHeaders: exchange.RequestHeaders,
+			RequestBody:    exchange.RequestBody,
+			ResponseChunks: exchange.ResponseChunks,
+			Truncated:      exchange.Truncated,
+			CreatedAt:      exchange.StartedAt,
+		}
+		if err := deps.LLMDebugRepo.Create(entry, deps.Config.LLMDebugMaxEntries); err != nil {
+			log.Printf("Failed to save LLM debug entry: %v", err)
+		}
+	})
+}
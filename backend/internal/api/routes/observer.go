@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/api/apierror"
+	ws "github.com/jacklau/prism/internal/api/websocket"
+)
+
+// observerClientPrefix starts the client user ID of read-only observers, so
+// they never receive messages sent to a user
+const observerClientPrefix = "observer:"
+
+// handleObserverCreate hands out a token that lets another WebSocket
+// connection, such as a teammate's or a dashboard's, watch one of the
+// client's agent executions or swarms without being able to act on it
+func handleObserverCreate(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
+	if deps.AgentManager == nil {
+		client.SendMessage(ws.NewError("agent_unavailable", "agent manager not available"))
+		return
+	}
+
+	var topic string
+	switch {
+	case msg.ExecutionID != "" && msg.SwarmID != "":
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "only one of execution_id and swarm_id may be set"))
+		return
+
+	case msg.ExecutionID != "":
+		execution, err := deps.AgentManager.GetExecution(msg.ExecutionID)
+		if err != nil || execution.Owner == "" || execution.Owner != client.UserID {
+			client.SendMessage(ws.NewError(apierror.CodeNotFound, "execution not found"))
+			return
+		}
+		topic = ws.ExecutionTopic(execution.ID)
+
+	case msg.SwarmID != "":
+		// Swarms don't record who ran them, but their events are published
+		// to their user's topic, so a token for someone else's swarm sees
+		// nothing
+		swarm, err := deps.AgentManager.GetSwarm(msg.SwarmID)
+		if err != nil {
+			client.SendMessage(ws.NewError(apierror.CodeNotFound, "swarm not found"))
+			return
+		}
+		topic = ws.SwarmTopic(swarm.ID)
+
+	default:
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "execution_id or swarm_id is required"))
+		return
+	}
+
+	expiresAt := time.Now().Add(deps.Config.ObserverTokenTTL)
+	token, err := deps.JWTService.GenerateObserverToken(uuid.New().String(), client.UserID, topic, expiresAt)
+	if err != nil {
+		client.SendMessage(ws.NewError(apierror.CodeInternal, "failed to create observer token"))
+		return
+	}
+
+	client.SendMessage(ws.NewObserverToken(&ws.ObserverInfo{
+		Token:     token,
+		Topic:     topic,
+		ExpiresAt: expiresAt.UnixMilli(),
+	}))
+}
+
+// serveObserver streams a user's topic to a read-only observer connection.
+// Anything the observer sends is refused.
+func serveObserver(deps *Dependencies, c *websocket.Conn, ownerUserID, tokenID, topic string) {
+	client := ws.NewClient(deps.WSHub, c, observerClientPrefix+tokenID, func(client *ws.Client, msg *ws.IncomingMessage) {
+		client.SendMessage(ws.NewError(apierror.CodeForbidden, "observers can't send messages"))
+	})
+
+	deps.WSHub.Register(client)
+	deps.WSHub.Observe(client, ownerUserID, topic)
+	client.SendMessage(ws.NewSubscribed(topic))
+
+	go client.WritePump()
+	client.ReadPump()
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"github.com/jacklau/prism/internal/api/handlers"
+	ws "github.com/jacklau/prism/internal/api/websocket"
+)
+
+// NewModelPullNotifier returns a callback that streams Ollama model pull
+// progress to all of the requesting user's connected clients
+func NewModelPullNotifier(hub *ws.Hub) func(userID string, event handlers.OllamaPullEvent) {
+	return func(userID string, event handlers.OllamaPullEvent) {
+		if hub == nil {
+			return
+		}
+
+		hub.SendToUser(userID, ws.NewModelPullProgress(&ws.ModelPullInfo{
+			PullID:    event.PullID,
+			Provider:  "ollama",
+			Model:     event.Model,
+			Status:    event.Status,
+			Digest:    event.Digest,
+			Total:     event.Total,
+			Completed: event.Completed,
+			Done:      event.Done,
+		}, event.Error))
+	}
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	ws "github.com/jacklau/prism/internal/api/websocket"
+	"github.com/jacklau/prism/internal/database/repository"
+)
+
+// NewPlanNotifier returns a callback that pushes `plan.updated` events to all
+// of a user's connected clients whenever their workspace todo list changes
+func NewPlanNotifier(hub *ws.Hub) func(userID, workspacePath string, todos []*repository.Todo) {
+	return func(userID, workspacePath string, todos []*repository.Todo) {
+		if hub == nil {
+			return
+		}
+
+		items := make([]ws.TodoInfo, len(todos))
+		for i, todo := range todos {
+			items[i] = ws.TodoInfo{
+				ID:         todo.ID,
+				Content:    todo.Content,
+				ActiveForm: todo.ActiveForm,
+				Status:     todo.Status,
+			}
+		}
+
+		hub.SendToUser(userID, ws.NewPlanUpdated(workspacePath, items))
+	}
+}
@@ -2,66 +2,157 @@ package routes
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/etag"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/google/uuid"
 	"github.com/jacklau/prism/internal/agent"
+	"github.com/jacklau/prism/internal/api/apierror"
 	"github.com/jacklau/prism/internal/api/handlers"
 	"github.com/jacklau/prism/internal/api/middleware"
 	ws "github.com/jacklau/prism/internal/api/websocket"
+	"github.com/jacklau/prism/internal/cluster"
 	"github.com/jacklau/prism/internal/config"
 	"github.com/jacklau/prism/internal/database/repository"
 	"github.com/jacklau/prism/internal/integrations"
+	"github.com/jacklau/prism/internal/integrations/email"
+	"github.com/jacklau/prism/internal/integrations/webhooks"
 	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/llm/ollama"
 	"github.com/jacklau/prism/internal/mcp"
 	"github.com/jacklau/prism/internal/sandbox"
 	"github.com/jacklau/prism/internal/security"
+	"github.com/jacklau/prism/internal/services/audit"
+	"github.com/jacklau/prism/internal/services/changes"
+	"github.com/jacklau/prism/internal/services/checkpoint"
 	"github.com/jacklau/prism/internal/services/coderunner"
+	"github.com/jacklau/prism/internal/services/concurrency"
+	"github.com/jacklau/prism/internal/services/contextpack"
+	"github.com/jacklau/prism/internal/services/digest"
+	"github.com/jacklau/prism/internal/services/discordbot"
+	"github.com/jacklau/prism/internal/services/docsources"
+	"github.com/jacklau/prism/internal/services/eval"
+	"github.com/jacklau/prism/internal/services/filehistory"
+	"github.com/jacklau/prism/internal/services/gitwriter"
+	"github.com/jacklau/prism/internal/services/guest"
+	"github.com/jacklau/prism/internal/services/instructions"
+	"github.com/jacklau/prism/internal/services/linearbot"
+	"github.com/jacklau/prism/internal/services/loginaudit"
+	"github.com/jacklau/prism/internal/services/modelinfo"
+	"github.com/jacklau/prism/internal/services/onboarding"
+	"github.com/jacklau/prism/internal/services/pinning"
+	"github.com/jacklau/prism/internal/services/prreview"
+	"github.com/jacklau/prism/internal/services/ratelimit"
+	"github.com/jacklau/prism/internal/services/slackbot"
+	"github.com/jacklau/prism/internal/services/speech"
+	"github.com/jacklau/prism/internal/services/summarizing"
+	"github.com/jacklau/prism/internal/services/titling"
+	"github.com/jacklau/prism/internal/services/transcription"
+	"github.com/jacklau/prism/internal/services/webhookqueue"
 	"github.com/jacklau/prism/internal/tools"
+	"github.com/jacklau/prism/internal/web"
 )
 
 // Dependencies holds all the dependencies for the router
 type Dependencies struct {
-	Config             *config.Config
-	JWTService         *security.JWTService
-	EncryptionService  *security.EncryptionService
-	UserRepo           *repository.UserRepository
-	SessionRepo        *repository.SessionRepository
-	ConversationRepo   *repository.ConversationRepository
-	MessageRepo        *repository.MessageRepository
-	WebhookRepo        *repository.WebhookRepository
-	ProviderKeyRepo    *repository.ProviderKeyRepository
-	IntegrationRepo    *repository.IntegrationRepository
-	FileHistoryRepo    *repository.FileHistoryRepository
-	LLMManager         *llm.Manager
-	WSHub              *ws.Hub
-	IntegrationManager *integrations.Manager
-	AgentManager       *agent.Manager
-	CodeRunner         *coderunner.Runner
-	SandboxService     *sandbox.Service
-	ToolRegistry       *tools.Registry
-	MCPServer          *mcp.Server
-	MCPClient          *mcp.Client
-	MCPRepository      *mcp.Repository
-	StdioMCPClient     *mcp.StdioClient
-	StdioMCPRepository *mcp.StdioRepository
+	Config                *config.Config
+	JWTService            *security.JWTService
+	EncryptionService     *security.EncryptionService
+	UserRepo              *repository.UserRepository
+	SessionRepo           *repository.SessionRepository
+	AccountTokenRepo      *repository.AccountTokenRepository
+	ConversationRepo      *repository.ConversationRepository
+	MessageRepo           *repository.MessageRepository
+	ConversationShareRepo *repository.ConversationShareRepository
+	ShareLinkRepo         *repository.ShareLinkRepository
+	WebhookRepo           *repository.WebhookRepository
+	ProviderKeyRepo       *repository.ProviderKeyRepository
+	OrganizationRepo      *repository.OrganizationRepository
+	IntegrationRepo       *repository.IntegrationRepository
+	FileHistoryRepo       *repository.FileHistoryRepository
+	TodoRepo              *repository.TodoRepository
+	PinnedFileRepo        *repository.PinnedFileRepository
+	FeedbackRepo          *repository.FeedbackRepository
+	SecretRepo            *repository.SecretRepository
+	ToolResultRepo        *repository.ToolResultRepository
+	LLMDebugRepo          *repository.LLMDebugRepository
+	ContextPackRepo       *repository.ContextPackRepository
+	SecretVault           *security.SecretVault // Resolves {{secret:NAME}} references in tool parameters
+	LLMManager            *llm.Manager
+	KeyValidator          *llm.KeyValidator
+	WSHub                 *ws.Hub
+	Cluster               *cluster.Cluster // Other server replicas, when running behind a load balancer
+	IntegrationManager    *integrations.Manager
+	AgentManager          *agent.Manager
+	CodeRunner            *coderunner.Runner
+	SandboxService        *sandbox.Service
+	ToolRegistry          *tools.Registry
+	MCPServer             *mcp.Server
+	MCPClient             *mcp.Client
+	MCPRepository         *mcp.Repository
+	StdioMCPClient        *mcp.StdioClient
+	StdioMCPRepository    *mcp.StdioRepository
+	TitleGenerator        *titling.Generator
+	Summarizer            *summarizing.Summarizer
+	PinnedContext         *pinning.ContextBuilder
+	ContextPacker         *contextpack.Packer
+	ProjectInstructions   *instructions.Loader
+	ChangeService         *changes.Service
+	Checkpoints           *checkpoint.Service
+	AuditService          *audit.Service
+	AuditScheduleRepo     *repository.AuditScheduleRepository
+	DigestService         *digest.Service
+	DigestScheduleRepo    *repository.DigestScheduleRepository
+	LoginAudit            *loginaudit.Service // Records sign-ins and alerts on new devices and repeated failures
+	PreferencesRepo       *repository.UserPreferencesRepository
+	WebhookQueue          *webhookqueue.Queue
+	PRReviewer            *prreview.Service
+	GitWriter             *gitwriter.Writer
+	RepoAnalyzer          *onboarding.Analyzer
+	Evals                 *eval.Service
+	OutboundWebhookRepo   *repository.OutboundWebhookRepository
+	WebhookDispatcher     *webhooks.Dispatcher
+	EmailClient           *email.Client
+	SlackLinkRepo         *repository.SlackLinkRepository
+	SlackBot              *slackbot.Bot
+	DiscordBot            *discordbot.Bot
+	LinearBot             *linearbot.Bot
+	DocSources            *docsources.Service
+	UsageRepo             *repository.UsageRepository
+	Transcriber           *transcription.Service
+	SpeechService         *speech.Service
+	RateLimits            *ratelimit.Set
+	Guests                *guest.Service
+	FileHistoryCompactor  *filehistory.Compactor
+	ModelInfo             *modelinfo.Service
+	IdempotencyRepo       *repository.IdempotencyRepository
+	Concurrency           *concurrency.Limiter // Per-user caps on running agents, swarms, builds and shells
+	DesktopUser           *repository.User     // Desktop mode: the local user signed in with DesktopToken
+	DesktopToken          string
 }
 
 // Setup sets up the Fiber app with all routes
 func Setup(deps *Dependencies) *fiber.App {
 	app := fiber.New(fiber.Config{
 		ErrorHandler: errorHandler,
+		BodyLimit:    bodyLimit(deps.Config),
 	})
 
 	// Middleware
 	app.Use(recover.New())
 	app.Use(logger.New())
+	app.Use(middleware.ErrorCodes())
 	app.Use(middleware.SecurityHeaders())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     deps.Config.CORSAllowedOrigins,
@@ -80,16 +171,40 @@ func Setup(deps *Dependencies) *fiber.App {
 	// API v1
 	v1 := app.Group("/api/v1")
 
+	// Guests are purged after a spell of inactivity, so note when they're active
+	if deps.Guests != nil {
+		v1.Use(middleware.GuestActivity(deps.Guests))
+	}
+
+	// Retries of side-effecting requests sent with an Idempotency-Key replay
+	// the first response; applied per route after authentication
+	idempotent := middleware.Idempotency(deps.IdempotencyRepo, deps.Config.IdempotencyKeyTTL)
+
 	// Auth routes (no auth required)
 	authHandler := handlers.NewAuthHandler(deps.UserRepo, deps.SessionRepo, deps.JWTService)
+	if deps.LoginAudit != nil {
+		authHandler.SetLoginAudit(deps.LoginAudit)
+	}
+	if deps.EmailClient != nil {
+		authHandler.SetAccountEmails(deps.AccountTokenRepo, deps.EmailClient)
+	}
 	auth := v1.Group("/auth")
-	auth.Post("/register", authHandler.Register)
-	auth.Post("/login", authHandler.Login)
+	auth.Post("/register", middleware.SlidingRateLimit(deps.RateLimits, ratelimit.Register), authHandler.Register)
+	auth.Post("/login", middleware.SlidingRateLimit(deps.RateLimits, ratelimit.Login), authHandler.Login)
 	auth.Post("/refresh", authHandler.Refresh)
+	auth.Post("/password/forgot", middleware.SlidingRateLimit(deps.RateLimits, ratelimit.Login), authHandler.ForgotPassword)
+	auth.Post("/password/reset", middleware.SlidingRateLimit(deps.RateLimits, ratelimit.Login), authHandler.ResetPassword)
+	auth.Post("/email/confirm", middleware.SlidingRateLimit(deps.RateLimits, ratelimit.Login), authHandler.ConfirmEmail)
+
+	// Desktop mode sign-in with the token handed to the browser at startup
+	if deps.DesktopUser != nil && deps.DesktopToken != "" {
+		authHandler.SetLocalLogin(deps.DesktopUser.ID, deps.DesktopToken)
+		auth.Post("/local", authHandler.LocalLogin)
+	}
 
 	// Guest login route (if enabled)
 	if deps.Config.GuestModeEnabled {
-		auth.Post("/guest", authHandler.GuestLogin)
+		auth.Post("/guest", middleware.SlidingRateLimit(deps.RateLimits, ratelimit.Register), authHandler.GuestLogin)
 		v1.Get("/guest-mode", func(c *fiber.Ctx) error {
 			return c.JSON(fiber.Map{"enabled": true})
 		})
@@ -104,17 +219,127 @@ func Setup(deps *Dependencies) *fiber.App {
 	authProtected := auth.Group("", middleware.AuthMiddleware(deps.JWTService))
 	authProtected.Post("/logout", authHandler.Logout)
 	authProtected.Get("/me", authHandler.Me)
+	authProtected.Get("/events", authHandler.ListAuthEvents)
+	authProtected.Post("/email", authHandler.ChangeEmail)
 
 	// Chat routes (auth required)
-	chatHandler := handlers.NewChatHandler(deps.ConversationRepo, deps.MessageRepo)
+	chatHandler := handlers.NewChatHandler(deps.ConversationRepo, deps.MessageRepo, deps.ConversationShareRepo)
 	conversations := v1.Group("/conversations", middleware.AuthMiddleware(deps.JWTService))
 	conversations.Get("/", chatHandler.ListConversations)
 	conversations.Get("/search", chatHandler.SearchConversations)
+	conversations.Get("/folders", chatHandler.ListFolders)
+	conversations.Post("/bulk", chatHandler.BulkUpdateConversations)
 	conversations.Post("/", chatHandler.CreateConversation)
 	conversations.Get("/:id", chatHandler.GetConversation)
 	conversations.Patch("/:id", chatHandler.UpdateConversation)
 	conversations.Delete("/:id", chatHandler.DeleteConversation)
 	conversations.Get("/:id/messages", chatHandler.GetMessages)
+	conversations.Get("/:id/estimate", estimateTurn(deps))
+
+	// Everything that happened in a conversation, in order
+	timelineHandler := handlers.NewTimelineHandler(deps.ConversationRepo, deps.MessageRepo, deps.ConversationShareRepo, deps.FileHistoryRepo, deps.UsageRepo)
+	conversations.Get("/:id/timeline", timelineHandler.GetTimeline)
+
+	// Generations running on this server, which can be stopped one at a time
+	// or for a whole conversation
+	conversations.Get("/:id/generations", listConversationGenerations(deps))
+	conversations.Delete("/:id/generations", stopGenerations(deps))
+	conversations.Delete("/:id/generations/:generationId", stopGenerations(deps))
+	v1.Get("/generations", middleware.AuthMiddleware(deps.JWTService), listUserGenerations)
+	if deps.ToolResultRepo != nil {
+		chatHandler.SetToolResultRepo(deps.ToolResultRepo)
+		conversations.Get("/:id/messages/:messageId/result", chatHandler.GetToolResult)
+	}
+	if deps.LLMDebugRepo != nil {
+		// Provider requests captured for conversations with llm_debug on
+		llmDebugHandler := handlers.NewLLMDebugHandler(deps.ConversationRepo, deps.LLMDebugRepo)
+		conversations.Get("/:id/llm-debug", llmDebugHandler.GetEntries)
+		conversations.Delete("/:id/llm-debug", llmDebugHandler.ClearEntries)
+	}
+	if deps.PreferencesRepo != nil {
+		chatHandler.SetPreferencesRepo(deps.PreferencesRepo)
+	}
+	if deps.SandboxService != nil {
+		chatHandler.SetSandboxService(deps.SandboxService)
+	}
+	chatHandler.SetOnDeleted(func(conversationID string) {
+		refreshConversationParticipants(deps, conversationID)
+	})
+	if deps.TitleGenerator != nil {
+		chatHandler.SetTitleGenerator(deps.TitleGenerator)
+		conversations.Post("/:id/title", chatHandler.RegenerateTitle)
+	}
+	if deps.Summarizer != nil {
+		summaryHandler := handlers.NewConversationSummaryHandler(deps.ConversationRepo, deps.MessageRepo, deps.Summarizer, deps.IntegrationManager)
+		conversations.Get("/:id/summary", summaryHandler.GetSummary)
+		conversations.Post("/:id/summarize", summaryHandler.Summarize)
+	}
+
+	// Public share link routes (token-authenticated, read-only)
+	if deps.ShareLinkRepo != nil {
+		shareLinkHandler := handlers.NewShareLinkHandler(
+			deps.ConversationRepo,
+			deps.MessageRepo,
+			deps.ShareLinkRepo,
+			deps.JWTService,
+			deps.Config.BaseURL,
+			deps.Config.ShareLinkDefaultExpiry,
+			deps.Config.ShareLinkMaxExpiry,
+		)
+		conversations.Get("/:id/share-links", shareLinkHandler.ListLinks)
+		conversations.Post("/:id/share-links", shareLinkHandler.CreateLink)
+		conversations.Delete("/:id/share-links/:linkId", shareLinkHandler.RevokeLink)
+
+		shareLimiter := middleware.RateLimiter(deps.Config.RateLimitRequestsPerMinute, deps.Config.RateLimitBurst)
+		v1.Get("/share/:token", shareLimiter, shareLinkHandler.GetSharedTranscript)
+		app.Get("/share/:token", shareLimiter, shareLinkHandler.RenderSharedTranscript)
+	}
+
+	// Pinned context file routes
+	if deps.PinnedFileRepo != nil && deps.SandboxService != nil {
+		pinnedFileHandler := handlers.NewPinnedFileHandler(deps.ConversationRepo, deps.PinnedFileRepo, deps.SandboxService, deps.Config.PinnedFilesMaxCount)
+		conversations.Get("/:id/pinned-files", pinnedFileHandler.ListPinnedFiles)
+		conversations.Post("/:id/pinned-files", pinnedFileHandler.PinFile)
+		conversations.Delete("/:id/pinned-files/:fileId", pinnedFileHandler.UnpinFile)
+	}
+
+	// Workspace context packs attached to conversations
+	if deps.ContextPacker != nil && deps.ContextPackRepo != nil {
+		contextPackHandler := handlers.NewContextPackHandler(deps.ContextPacker, deps.ConversationRepo, deps.ContextPackRepo)
+		conversations.Get("/:id/context-pack", contextPackHandler.GetConversationPack)
+		conversations.Put("/:id/context-pack", contextPackHandler.AttachConversationPack)
+		conversations.Delete("/:id/context-pack", contextPackHandler.DetachConversationPack)
+	}
+
+	// Turn review routes (changes made by tools during an assistant turn)
+	if deps.ChangeService != nil {
+		turnChangesHandler := handlers.NewTurnChangesHandler(deps.ConversationRepo, deps.MessageRepo, deps.ConversationShareRepo, deps.ChangeService)
+		conversations.Get("/:id/turns/:turnId/changes", turnChangesHandler.GetChanges)
+		conversations.Post("/:id/turns/:turnId/revert", turnChangesHandler.RevertTurn)
+
+		// What changed between versions in file history
+		fileHistoryHandler := handlers.NewFileHistoryHandler(deps.ChangeService)
+		v1.Get("/files/history/:id/diff", middleware.AuthMiddleware(deps.JWTService), fileHistoryHandler.DiffHistory)
+	}
+
+	// Text-to-speech routes (listen to assistant messages)
+	if deps.SpeechService != nil {
+		speechHandler := handlers.NewSpeechHandler(deps.ConversationRepo, deps.MessageRepo, deps.ConversationShareRepo, deps.SpeechService)
+		conversations.Get("/:id/messages/:messageId/speech", speechHandler.GetMessageSpeech)
+		v1.Get("/speech/providers", middleware.AuthMiddleware(deps.JWTService), speechHandler.ListProviders)
+	}
+
+	// Conversation sharing routes
+	if deps.ConversationShareRepo != nil {
+		shareHandler := handlers.NewConversationShareHandler(deps.ConversationRepo, deps.ConversationShareRepo, deps.UserRepo)
+		shareHandler.SetOnSharesChanged(func(conversationID string) {
+			refreshConversationParticipants(deps, conversationID)
+		})
+		conversations.Get("/shared/with-me", shareHandler.ListSharedWithMe)
+		conversations.Get("/:id/shares", shareHandler.ListShares)
+		conversations.Post("/:id/shares", shareHandler.ShareConversation)
+		conversations.Delete("/:id/shares/:userId", shareHandler.RemoveShare)
+	}
 
 	// WebSocket route
 	v1.Use("/ws", func(c *fiber.Ctx) error {
@@ -150,9 +375,18 @@ func Setup(deps *Dependencies) *fiber.App {
 
 			claims, err := deps.JWTService.ValidateAccessToken(token)
 			if err != nil {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error": "invalid token",
-				})
+				// Read-only observers connect with an observer token instead
+				observer, observerErr := deps.JWTService.ValidateObserverToken(token)
+				if observerErr != nil {
+					return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+						"error": "invalid token",
+					})
+				}
+				c.Locals("userID", observer.UserID)
+				c.Locals("observerID", observer.ID)
+				c.Locals("observerTopic", observer.Subject)
+				c.Locals("wsProtocol", "auth")
+				return c.Next()
 			}
 
 			c.Locals("userID", claims.UserID)
@@ -164,8 +398,17 @@ func Setup(deps *Dependencies) *fiber.App {
 		return fiber.ErrUpgradeRequired
 	})
 
+	// Stop requests sent to another replica reach the generations running here
+	if deps.Cluster != nil {
+		deps.Cluster.OnStopGeneration(stopRemoteGeneration)
+	}
+
 	v1.Get("/ws", websocket.New(func(c *websocket.Conn) {
 		userID := c.Locals("userID").(string)
+		if topic, ok := c.Locals("observerTopic").(string); ok {
+			serveObserver(deps, c, userID, c.Locals("observerID").(string), topic)
+			return
+		}
 
 		client := ws.NewClient(deps.WSHub, c, userID, func(client *ws.Client, msg *ws.IncomingMessage) {
 			// Handle incoming messages
@@ -190,20 +433,95 @@ func Setup(deps *Dependencies) *fiber.App {
 			"providers": deps.LLMManager.ListProviders(),
 		})
 	})
+	providers.Get("/stats", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"providers": deps.LLMManager.Stats(),
+		})
+	})
+	providers.Get("/catalog", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"providers": deps.LLMManager.ModelCatalog(),
+		})
+	})
+	providers.Post("/:provider/models/refresh", func(c *fiber.Ctx) error {
+		if _, err := deps.LLMManager.GetProvider(c.Params("provider")); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "unknown provider: " + c.Params("provider"),
+			})
+		}
+		status, err := deps.LLMManager.RefreshModels(c.Context(), c.Params("provider"))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to refresh models",
+			})
+		}
+		return c.JSON(status)
+	})
+
+	// Rate limiter counters (auth required)
+	v1.Get("/ratelimits/stats", middleware.AuthMiddleware(deps.JWTService), func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"limiters": deps.RateLimits.Stats(),
+		})
+	})
+
+	// Agent manager statistics (auth required)
+	if deps.AgentManager != nil {
+		v1.Get("/agents/stats", middleware.AuthMiddleware(deps.JWTService), func(c *fiber.Ctx) error {
+			return c.JSON(deps.AgentManager.Stats())
+		})
+	}
 
 	// Provider key management routes
-	if deps.ProviderKeyRepo != nil {
-		providerHandler := handlers.NewProviderHandler(deps.ProviderKeyRepo, deps.EncryptionService, deps.LLMManager)
+	if deps.ProviderKeyRepo != nil && deps.KeyValidator != nil {
+		providerHandler := handlers.NewProviderHandler(deps.ProviderKeyRepo, deps.EncryptionService, deps.LLMManager, deps.KeyValidator)
+		if deps.Config != nil {
+			providerHandler.SetAllowPrivateBaseURLs(deps.Config.ProviderBaseURLAllowPrivate)
+		}
 		providers.Post("/:provider/key", providerHandler.SetKey)
 		providers.Delete("/:provider/key", providerHandler.DeleteKey)
 		providers.Post("/:provider/validate", providerHandler.ValidateKey)
 		providers.Get("/:provider/key/status", providerHandler.GetKeyStatus)
 		providers.Get("/keys", providerHandler.ListKeys)
+		providers.Get("/keys/status", providerHandler.ListKeyStatus)
+	}
+
+	// Organization routes: members and the provider keys admins share with them
+	if deps.OrganizationRepo != nil && deps.EncryptionService != nil {
+		orgHandler := handlers.NewOrganizationHandler(deps.OrganizationRepo, deps.UserRepo, deps.EncryptionService, deps.LLMManager)
+		orgs := v1.Group("/organizations", middleware.AuthMiddleware(deps.JWTService), middleware.DenyGuests(deps.Guests))
+		orgs.Post("/", orgHandler.CreateOrganization)
+		orgs.Get("/", orgHandler.ListOrganizations)
+		orgs.Get("/:id", orgHandler.GetOrganization)
+		orgs.Delete("/:id", orgHandler.DeleteOrganization)
+		orgs.Post("/:id/members", orgHandler.AddMember)
+		orgs.Delete("/:id/members/:userId", orgHandler.RemoveMember)
+		orgs.Put("/:id/keys/:provider", orgHandler.SetKey)
+		orgs.Delete("/:id/keys/:provider", orgHandler.DeleteKey)
+		orgs.Get("/:id/usage", orgHandler.GetUsage)
+	}
+
+	// Ollama local model management routes
+	if provider, err := deps.LLMManager.GetProvider("ollama"); err == nil {
+		if ollamaClient, ok := provider.(*ollama.Client); ok {
+			ollamaHandler := handlers.NewOllamaHandler(ollamaClient, deps.LLMManager, deps.ModelInfo, NewModelPullNotifier(deps.WSHub))
+			providers.Get("/ollama/models", ollamaHandler.ListModels)
+			providers.Post("/ollama/models/pull", ollamaHandler.PullModel)
+			providers.Get("/ollama/models/*", ollamaHandler.GetModel)
+			providers.Delete("/ollama/models/*", ollamaHandler.DeleteModel)
+		}
+	}
+
+	// Model capabilities. Registered after the Ollama routes, whose model
+	// details include the same capabilities.
+	if deps.ModelInfo != nil {
+		modelInfoHandler := handlers.NewModelInfoHandler(deps.ModelInfo)
+		providers.Get("/:provider/models/*", modelInfoHandler.GetCapabilities)
 	}
 
 	// Preview/Sandbox routes (auth required)
 	if deps.SandboxService != nil {
-		previewHandler := handlers.NewPreviewHandler(deps.SandboxService)
+		previewHandler := handlers.NewPreviewHandler(deps.SandboxService, deps.JWTService)
 		sandbox := v1.Group("/sandbox", middleware.AuthMiddleware(deps.JWTService))
 		sandbox.Get("/files", previewHandler.ListFiles)
 		sandbox.Get("/files/*", previewHandler.GetFile)
@@ -211,19 +529,80 @@ func Setup(deps *Dependencies) *fiber.App {
 		sandbox.Delete("/files/*", previewHandler.DeleteFile)
 		sandbox.Get("/builds/:id", previewHandler.GetBuild)
 		sandbox.Post("/builds/:id/stop", previewHandler.StopBuild)
+		sandbox.Get("/builds/:id/artifacts", previewHandler.ListArtifacts)
+		sandbox.Get("/builds/:id/artifacts/*", previewHandler.DownloadArtifact)
 
-		// Preview server (serves static files from sandbox)
+		// Preview server (proxies to a build's dev server, authorized by the
+		// token in its preview URL, or serves static files from sandbox)
+		app.All("/preview/build/:id/*", previewHandler.ProxyBuild)
 		app.Get("/preview/:userID/*", previewHandler.ServePreview)
 
 		// Workspace management routes (auth required)
-		workspaceHandler := handlers.NewWorkspaceHandler(deps.SandboxService)
+		workspaceHandler := handlers.NewWorkspaceHandler(deps.SandboxService, deps.RepoAnalyzer)
 		workspace := v1.Group("/workspace", middleware.AuthMiddleware(deps.JWTService))
+		// Guests are kept to their own ephemeral workspace: they can't open,
+		// browse or add other directories on the server
+		denyGuests := middleware.DenyGuests(deps.Guests)
 		workspace.Get("/directory", workspaceHandler.GetDirectory)
-		workspace.Post("/directory", workspaceHandler.SetDirectory)
-		workspace.Get("/browse", workspaceHandler.BrowseDirectories)
-		workspace.Post("/pick-folder", workspaceHandler.OpenFolderPicker)
+		workspace.Post("/directory", denyGuests, workspaceHandler.SetDirectory)
+		workspace.Get("/browse", denyGuests, workspaceHandler.BrowseDirectories)
+		workspace.Post("/pick-folder", denyGuests, workspaceHandler.OpenFolderPicker)
 		workspace.Get("/recent", workspaceHandler.ListRecentWorkspaces)
-		workspace.Post("/:id/current", workspaceHandler.SetCurrentWorkspace)
+		workspace.Get("/roots", workspaceHandler.ListRoots)
+		workspace.Post("/roots", denyGuests, workspaceHandler.AddRoot)
+		workspace.Put("/roots/active", workspaceHandler.SetActiveRoot)
+		workspace.Delete("/roots/:name", workspaceHandler.RemoveRoot)
+		// Guests can't set the build and test commands their workspace runs
+		workspace.Get("/settings", workspaceHandler.GetSettings)
+		workspace.Put("/settings", denyGuests, workspaceHandler.UpdateSettings)
+		workspace.Delete("/settings", denyGuests, workspaceHandler.DeleteSettings)
+		if deps.ContextPacker != nil {
+			workspace.Post("/context-pack", handlers.NewContextPackHandler(deps.ContextPacker, deps.ConversationRepo, deps.ContextPackRepo).PackContext)
+		}
+
+		// Workspace plan (todo list) routes
+		if deps.TodoRepo != nil {
+			todoHandler := handlers.NewTodoHandler(deps.TodoRepo, deps.SandboxService, NewPlanNotifier(deps.WSHub))
+			workspace.Get("/todos", todoHandler.ListTodos)
+			workspace.Put("/todos", todoHandler.ReplaceTodos)
+			workspace.Delete("/todos", todoHandler.ClearTodos)
+			workspace.Patch("/todos/:id", todoHandler.UpdateTodo)
+		}
+
+		// Workspace checkpoint routes (snapshot and rollback)
+		if deps.Checkpoints != nil {
+			checkpointHandler := handlers.NewCheckpointHandler(deps.Checkpoints)
+			workspace.Get("/checkpoints", checkpointHandler.ListCheckpoints)
+			workspace.Post("/checkpoints", checkpointHandler.CreateCheckpoint)
+			workspace.Post("/checkpoints/:id/restore", checkpointHandler.RestoreCheckpoint)
+			workspace.Delete("/checkpoints/:id", checkpointHandler.DeleteCheckpoint)
+		}
+
+		// Dependency audit routes (vulnerability scans of the current workspace)
+		if deps.AuditService != nil && deps.AuditScheduleRepo != nil {
+			auditHandler := handlers.NewDependencyAuditHandler(deps.AuditService, deps.AuditScheduleRepo, deps.SandboxService)
+			workspace.Post("/audit", auditHandler.RunAudit)
+			workspace.Get("/audit/schedule", auditHandler.GetSchedule)
+			workspace.Put("/audit/schedule", auditHandler.UpdateSchedule)
+			workspace.Delete("/audit/schedule", auditHandler.DeleteSchedule)
+		}
+
+		// Repository onboarding summary routes
+		if deps.RepoAnalyzer != nil {
+			summaryHandler := handlers.NewWorkspaceSummaryHandler(deps.RepoAnalyzer)
+			workspace.Post("/summary", summaryHandler.AnalyzeWorkspace)
+			workspace.Get("/summary", summaryHandler.GetSummary)
+			workspace.Delete("/summary", summaryHandler.DeleteSummary)
+		}
+
+		// Git writing routes (commit messages and changelogs)
+		if deps.GitWriter != nil {
+			gitHandler := handlers.NewGitHandler(deps.GitWriter)
+			workspace.Post("/git/suggest-commit", gitHandler.SuggestCommit)
+			workspace.Post("/git/changelog", gitHandler.Changelog)
+		}
+
+		workspace.Post("/:id/current", denyGuests, workspaceHandler.SetCurrentWorkspace)
 		workspace.Delete("/:id", workspaceHandler.RemoveWorkspace)
 	}
 
@@ -234,6 +613,8 @@ func Setup(deps *Dependencies) *fiber.App {
 			deps.CodeRunner,
 			deps.Config.GitHubWebhookSecret,
 			deps.IntegrationManager,
+			deps.WebhookQueue,
+			deps.PRReviewer,
 		)
 
 		// Public webhook endpoint (no auth - verified by signature)
@@ -242,15 +623,54 @@ func Setup(deps *Dependencies) *fiber.App {
 		// Webhook configuration routes (auth required)
 		github := v1.Group("/github", middleware.AuthMiddleware(deps.JWTService))
 		github.Get("/webhooks", githubHandler.GetWebhookConfigs)
-		github.Post("/webhooks", githubHandler.CreateWebhookConfig)
+		github.Post("/webhooks", idempotent, githubHandler.CreateWebhookConfig)
 		github.Get("/webhooks/:id", githubHandler.GetWebhookConfig)
 		github.Patch("/webhooks/:id", githubHandler.UpdateWebhookConfig)
 		github.Delete("/webhooks/:id", githubHandler.DeleteWebhookConfig)
 		github.Post("/webhooks/:id/test", githubHandler.TestWebhook)
 		github.Get("/webhooks/:id/deliveries", githubHandler.GetWebhookDeliveries)
+		github.Post("/webhooks/:id/deliveries/:deliveryID/redeliver", githubHandler.RedeliverWebhookDelivery)
 
 		// Code execution endpoint (auth required)
-		github.Post("/run", githubHandler.RunCode)
+		github.Post("/run", middleware.DenyGuests(deps.Guests), idempotent, githubHandler.RunCode)
+	}
+
+	// Pull request review routes
+	if deps.PRReviewer != nil {
+		prReviewHandler := handlers.NewPRReviewHandler(deps.PRReviewer)
+		v1.Post("/github/reviews", middleware.AuthMiddleware(deps.JWTService), middleware.DenyGuests(deps.Guests), idempotent, prReviewHandler.ReviewPullRequest)
+	}
+
+	// Benchmark suites run against providers and models
+	if deps.Evals != nil {
+		evalHandler := handlers.NewEvalHandler(deps.Evals)
+		evals := v1.Group("/evals", middleware.AuthMiddleware(deps.JWTService), middleware.DenyGuests(deps.Guests))
+		evals.Get("/suites", evalHandler.ListSuites)
+		evals.Post("/suites", evalHandler.CreateSuite)
+		evals.Get("/suites/:id", evalHandler.GetSuite)
+		evals.Put("/suites/:id", evalHandler.UpdateSuite)
+		evals.Delete("/suites/:id", evalHandler.DeleteSuite)
+		evals.Post("/suites/:id/runs", evalHandler.StartRun)
+		evals.Get("/suites/:id/runs", evalHandler.ListRuns)
+		evals.Get("/suites/:id/stats", evalHandler.GetStats)
+		evals.Get("/runs/:id", evalHandler.GetRun)
+		evals.Post("/runs/:id/stop", evalHandler.StopRun)
+	}
+
+	// Linear issue webhook (no auth - user identified by the token in the
+	// URL and verified by signature)
+	var linearHandler *handlers.LinearHandler
+	if deps.LinearBot != nil && deps.IntegrationRepo != nil {
+		linearHandler = handlers.NewLinearHandler(deps.LinearBot, deps.IntegrationRepo, deps.Config.BaseURL)
+		v1.Post("/linear/webhook/:token", linearHandler.HandleWebhook)
+	}
+
+	// Code runner routes
+	if deps.CodeRunner != nil {
+		codeRunnerHandler := handlers.NewCodeRunnerHandler(deps.CodeRunner)
+
+		code := v1.Group("/code", middleware.AuthMiddleware(deps.JWTService))
+		code.Get("/environments", codeRunnerHandler.ListEnvironments)
 	}
 
 	// OAuth routes
@@ -272,7 +692,7 @@ func Setup(deps *Dependencies) *fiber.App {
 
 		// GitHub clone (requires sandbox service)
 		if deps.SandboxService != nil {
-			workspaceHandler := handlers.NewWorkspaceHandler(deps.SandboxService)
+			workspaceHandler := handlers.NewWorkspaceHandler(deps.SandboxService, deps.RepoAnalyzer)
 			githubAccount.Post("/clone", workspaceHandler.CloneGitHubRepo)
 		}
 	}
@@ -294,13 +714,86 @@ func Setup(deps *Dependencies) *fiber.App {
 		// Register stdio MCP routes (connect to local MCP servers via stdin/stdout)
 		stdioHandler := mcp.NewStdioHandler(deps.StdioMCPClient, deps.StdioMCPRepository)
 		stdioProtected := v1.Group("", middleware.AuthMiddleware(deps.JWTService))
+		// Stdio servers are commands run on the server, so guests can't add or start them
+		stdioProtected.Use("/mcp/stdio", middleware.DenyGuests(deps.Guests))
 		stdioHandler.RegisterRoutes(stdioProtected)
 	}
 
+	// Usage statistics routes (for the usage dashboard)
+	if deps.UsageRepo != nil {
+		statsHandler := handlers.NewStatsHandler(deps.UsageRepo)
+		stats := v1.Group("/stats", middleware.AuthMiddleware(deps.JWTService))
+		stats.Get("/overview", statsHandler.GetOverview)
+	}
+
+	// Admin maintenance routes, for ADMIN_EMAILS and the desktop mode's local user
+	admins := append([]string{}, deps.Config.AdminEmails...)
+	if deps.DesktopUser != nil {
+		admins = append(admins, deps.DesktopUser.Email)
+	}
+	admin := v1.Group("/admin", middleware.AuthMiddleware(deps.JWTService), middleware.RequireAdmin(admins))
+	if deps.FileHistoryCompactor != nil {
+		adminHandler := handlers.NewAdminHandler(deps.FileHistoryCompactor)
+		admin.Get("/file-history/stats", adminHandler.GetFileHistoryStats)
+		admin.Post("/file-history/compact", adminHandler.CompactFileHistory)
+	}
+	if deps.StdioMCPClient != nil && deps.StdioMCPRepository != nil {
+		mcp.NewStdioHandler(deps.StdioMCPClient, deps.StdioMCPRepository).RegisterAdminRoutes(admin)
+	}
+	if deps.ModelInfo != nil {
+		modelInfoHandler := handlers.NewModelInfoHandler(deps.ModelInfo)
+		admin.Get("/model-overrides", modelInfoHandler.ListOverrides)
+		admin.Put("/model-overrides/:provider/*", modelInfoHandler.SetOverride)
+		admin.Delete("/model-overrides/:provider/*", modelInfoHandler.DeleteOverride)
+	}
+	if deps.Concurrency != nil {
+		concurrencyHandler := handlers.NewConcurrencyHandler(deps.Concurrency, deps.UserRepo)
+		admin.Get("/concurrency-limits", concurrencyHandler.ListLimits)
+		admin.Get("/concurrency-limits/:userId", concurrencyHandler.GetUserLimits)
+		admin.Put("/concurrency-limits/:userId", concurrencyHandler.SetUserLimits)
+		admin.Delete("/concurrency-limits/:userId", concurrencyHandler.DeleteUserLimits)
+	}
+
+	// Message feedback routes. Ratings are forwarded to analytics (PostHog)
+	// unless POSTHOG_TRACK_FEEDBACK is off.
+	if deps.FeedbackRepo != nil {
+		var analytics *integrations.Manager
+		if deps.Config.PostHogTrackFeedback {
+			analytics = deps.IntegrationManager
+		}
+		feedbackHandler := handlers.NewFeedbackHandler(deps.FeedbackRepo, deps.ConversationRepo, deps.MessageRepo, deps.ConversationShareRepo, analytics)
+		chatHandler.SetFeedbackRepo(deps.FeedbackRepo)
+		conversations.Put("/:id/messages/:messageId/feedback", feedbackHandler.SetFeedback)
+		conversations.Delete("/:id/messages/:messageId/feedback", feedbackHandler.DeleteFeedback)
+		v1.Get("/feedback", middleware.AuthMiddleware(deps.JWTService), feedbackHandler.GetAnalytics)
+		admin.Get("/feedback", feedbackHandler.GetAllAnalytics)
+	}
+
+	// Secrets vault routes. Values can be set but never read back; they are
+	// referenced as {{secret:NAME}} in MCP server env, webhooks and tool
+	// parameters.
+	if deps.SecretRepo != nil {
+		secretHandler := handlers.NewSecretHandler(deps.SecretRepo)
+		secrets := v1.Group("/secrets", middleware.AuthMiddleware(deps.JWTService))
+		secrets.Get("/", secretHandler.List)
+		secrets.Put("/:name", secretHandler.Set)
+		secrets.Delete("/:name", secretHandler.Delete)
+	}
+
+	// Voice input transcription routes
+	if deps.Transcriber != nil {
+		transcriptionHandler := handlers.NewTranscriptionHandler(deps.Transcriber, deps.Config.UploadMaxSize)
+		v1.Post("/transcribe", middleware.AuthMiddleware(deps.JWTService), transcriptionHandler.Transcribe)
+		v1.Get("/transcribe/providers", middleware.AuthMiddleware(deps.JWTService), transcriptionHandler.ListProviders)
+	}
+
 	// Integrations routes (for Settings page)
 	integrationsRoute := v1.Group("/integrations", middleware.AuthMiddleware(deps.JWTService))
 	if deps.IntegrationRepo != nil {
-		integrationHandler := handlers.NewIntegrationHandler(deps.IntegrationRepo)
+		integrationHandler := handlers.NewIntegrationHandler(deps.IntegrationRepo, deps.EmailClient)
+		if deps.IntegrationManager != nil {
+			integrationHandler.SetIntegrationManager(deps.IntegrationManager)
+		}
 		integrationsRoute.Get("/status", integrationHandler.GetStatus)
 		integrationsRoute.Post("/discord", integrationHandler.SetDiscord)
 		integrationsRoute.Delete("/discord", integrationHandler.DeleteDiscord)
@@ -308,7 +801,82 @@ func Setup(deps *Dependencies) *fiber.App {
 		integrationsRoute.Delete("/slack", integrationHandler.DeleteSlack)
 		integrationsRoute.Post("/posthog", integrationHandler.SetPostHog)
 		integrationsRoute.Delete("/posthog", integrationHandler.DeletePostHog)
-	} else {
+		integrationsRoute.Get("/email", integrationHandler.GetEmail)
+		integrationsRoute.Post("/email", integrationHandler.SetEmail)
+		integrationsRoute.Delete("/email", integrationHandler.DeleteEmail)
+		integrationsRoute.Post("/email/test", integrationHandler.TestEmail)
+		integrationsRoute.Post("/:name/test", integrationHandler.TestIntegration)
+
+		if deps.OutboundWebhookRepo != nil && deps.WebhookDispatcher != nil {
+			outboundHandler := handlers.NewOutboundWebhookHandler(deps.OutboundWebhookRepo, deps.WebhookDispatcher)
+			integrationsRoute.Get("/webhooks", outboundHandler.ListOutboundWebhooks)
+			integrationsRoute.Post("/webhooks", idempotent, outboundHandler.CreateOutboundWebhook)
+			integrationsRoute.Patch("/webhooks/:id", outboundHandler.UpdateOutboundWebhook)
+			integrationsRoute.Delete("/webhooks/:id", outboundHandler.DeleteOutboundWebhook)
+			integrationsRoute.Post("/webhooks/:id/test", outboundHandler.TestOutboundWebhook)
+		}
+	}
+
+	// Slack bot routes
+	if deps.SlackBot != nil && deps.SlackLinkRepo != nil {
+		slackBotHandler := handlers.NewSlackBotHandler(deps.SlackBot, deps.SlackLinkRepo)
+
+		// Public slash command endpoint (no auth - verified by signature)
+		v1.Post("/slack/commands", slackBotHandler.HandleCommand)
+
+		// Account linking routes (auth required)
+		integrationsRoute.Post("/slack/link", slackBotHandler.LinkAccount)
+		integrationsRoute.Get("/slack/links", slackBotHandler.ListLinks)
+		integrationsRoute.Delete("/slack/links/:teamID/:slackUserID", slackBotHandler.DeleteLink)
+	}
+
+	// Discord bot routes
+	if deps.DiscordBot != nil && deps.IntegrationRepo != nil {
+		discordBotHandler := handlers.NewDiscordBotHandler(deps.DiscordBot, deps.IntegrationRepo)
+		integrationsRoute.Post("/discord/guilds/link", discordBotHandler.LinkGuild)
+		integrationsRoute.Get("/discord/guilds", discordBotHandler.ListGuilds)
+		integrationsRoute.Patch("/discord/guilds/:guildID", discordBotHandler.UpdateGuild)
+		integrationsRoute.Delete("/discord/guilds/:guildID", discordBotHandler.DeleteGuild)
+	}
+
+	// User preferences routes
+	if deps.PreferencesRepo != nil {
+		preferencesHandler := handlers.NewPreferencesHandler(deps.PreferencesRepo)
+		preferences := v1.Group("/preferences", middleware.AuthMiddleware(deps.JWTService))
+		preferences.Get("/", preferencesHandler.GetPreferences)
+		preferences.Put("/", preferencesHandler.UpdatePreferences)
+		preferences.Delete("/", preferencesHandler.ResetPreferences)
+	}
+
+	// Activity digest routes
+	if deps.DigestService != nil && deps.DigestScheduleRepo != nil {
+		digestHandler := handlers.NewDigestHandler(deps.DigestService, deps.DigestScheduleRepo)
+		integrationsRoute.Get("/digest", digestHandler.GetDigest)
+		integrationsRoute.Put("/digest", digestHandler.UpdateDigest)
+		integrationsRoute.Delete("/digest", digestHandler.DeleteDigest)
+		integrationsRoute.Get("/digest/preview", digestHandler.PreviewDigest)
+		integrationsRoute.Post("/digest/send", digestHandler.SendDigest)
+	}
+
+	// Linear settings routes
+	if linearHandler != nil {
+		integrationsRoute.Get("/linear", linearHandler.GetLinear)
+		integrationsRoute.Post("/linear", linearHandler.SetLinear)
+		integrationsRoute.Delete("/linear", linearHandler.DeleteLinear)
+	}
+
+	// Notion and Confluence routes (documentation sources for the doc tools)
+	if deps.DocSources != nil && deps.IntegrationRepo != nil {
+		docSourcesHandler := handlers.NewDocSourcesHandler(deps.DocSources, deps.IntegrationRepo)
+		integrationsRoute.Get("/notion", docSourcesHandler.GetNotion)
+		integrationsRoute.Post("/notion", docSourcesHandler.SetNotion)
+		integrationsRoute.Delete("/notion", docSourcesHandler.DeleteNotion)
+		integrationsRoute.Get("/confluence", docSourcesHandler.GetConfluence)
+		integrationsRoute.Post("/confluence", docSourcesHandler.SetConfluence)
+		integrationsRoute.Delete("/confluence", docSourcesHandler.DeleteConfluence)
+	}
+
+	if deps.IntegrationRepo == nil {
 		// Fallback to config-based status if no repo
 		integrationsRoute.Get("/status", func(c *fiber.Ctx) error {
 			return c.JSON(fiber.Map{
@@ -324,17 +892,57 @@ func Setup(deps *Dependencies) *fiber.App {
 					"enabled":   deps.Config.PostHogEnabled,
 					"connected": deps.Config.PostHogAPIKey != "",
 				},
+				"matrix": fiber.Map{
+					"enabled":   deps.Config.MatrixEnabled,
+					"connected": deps.Config.MatrixHomeserverURL != "" && deps.Config.MatrixRoomID != "",
+				},
+				"mattermost": fiber.Map{
+					"enabled":   deps.Config.MattermostEnabled,
+					"connected": deps.Config.MattermostWebhookURL != "",
+				},
+				"email": fiber.Map{
+					"enabled":   deps.Config.SMTPEnabled,
+					"connected": deps.Config.SMTPHost != "",
+				},
 			})
 		})
 	}
 
+	// Frontend (single-binary deployment); registered last so API and
+	// other server routes take precedence over the SPA fallback
+	if deps.Config.ServeFrontend {
+		frontend, err := web.FS(deps.Config.FrontendDir)
+		if err != nil {
+			log.Printf("Warning: Not serving frontend: %v", err)
+		} else if frontend != nil {
+			app.Use(compress.New(), etag.New(), web.Handler(frontend))
+			log.Println("Serving frontend from the Go server")
+		}
+	}
+
 	return app
 }
 
+// bodyLimit returns the maximum request body size, leaving room for a
+// multipart upload of UPLOAD_MAX_SIZE bytes
+func bodyLimit(cfg *config.Config) int {
+	const multipartOverhead = 64 * 1024
+	if cfg == nil || int(cfg.UploadMaxSize)+multipartOverhead <= fiber.DefaultBodyLimit {
+		return fiber.DefaultBodyLimit
+	}
+	return int(cfg.UploadMaxSize) + multipartOverhead
+}
+
 // handleWebSocketMessage handles incoming WebSocket messages
 func handleWebSocketMessage(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
+	deps.Guests.Touch(client.UserID)
+
 	switch msg.Type {
 	case ws.TypeChatMessage:
+		if !allowWebSocketMessage(deps, client, ratelimit.Chat) {
+			return
+		}
+
 		// Track message sent event
 		if deps.IntegrationManager != nil {
 			deps.IntegrationManager.TrackMessageSent(client.UserID, msg.ConversationID, "")
@@ -343,6 +951,17 @@ func handleWebSocketMessage(deps *Dependencies, client *ws.Client, msg *ws.Incom
 		// Handle chat message with LLM streaming
 		handleChatMessage(deps, client, msg)
 
+	case ws.TypeChatCompare:
+		if !allowWebSocketMessage(deps, client, ratelimit.Chat) {
+			return
+		}
+		if deps.IntegrationManager != nil {
+			deps.IntegrationManager.TrackMessageSent(client.UserID, msg.ConversationID, "")
+		}
+
+		// Stream answers from several models side by side
+		handleChatCompare(deps, client, msg)
+
 	case ws.TypeChatStop:
 		// Track chat stopped event
 		if deps.IntegrationManager != nil {
@@ -356,6 +975,10 @@ func handleWebSocketMessage(deps *Dependencies, client *ws.Client, msg *ws.Incom
 		// Handle stopping generation
 		handleChatStop(deps, client, msg)
 
+	case ws.TypeAgentContinue:
+		// Resume an agentic loop paused at the iteration cap
+		handleAgentContinue(deps, client, msg)
+
 	case ws.TypeToolConfirm:
 		// Track tool approval/rejection
 		if deps.IntegrationManager != nil {
@@ -379,10 +1002,20 @@ func handleWebSocketMessage(deps *Dependencies, client *ws.Client, msg *ws.Incom
 
 	// Agent message handlers
 	case ws.TypeAgentRun:
-		handleAgentRun(deps, client, msg)
+		if allowWebSocketMessage(deps, client, ratelimit.Agent) {
+			runIdempotentWithSlot(deps, client, msg, concurrency.Agents,
+				func() string { return handleAgentRun(deps, client, msg) },
+				waitForExecution(deps),
+				func(id string) { replayAgentRun(deps, client, id) })
+		}
 
 	case ws.TypeAgentRunParallel:
-		handleAgentRunParallel(deps, client, msg)
+		if allowWebSocketMessage(deps, client, ratelimit.Agent) {
+			runIdempotentWithSlot(deps, client, msg, concurrency.Agents,
+				func() string { return handleAgentRunParallel(deps, client, msg) },
+				waitForExecution(deps),
+				func(id string) { replayAgentRun(deps, client, id) })
+		}
 
 	case ws.TypeAgentStop:
 		handleAgentStop(deps, client, msg)
@@ -390,12 +1023,23 @@ func handleWebSocketMessage(deps *Dependencies, client *ws.Client, msg *ws.Incom
 	case ws.TypeAgentStatus:
 		handleAgentStatus(deps, client, msg)
 
+	case ws.TypeAgentReplay:
+		if allowWebSocketMessage(deps, client, ratelimit.Agent) {
+			runWithSlot(deps, client, msg, concurrency.Agents,
+				func() string { return handleAgentReplay(deps, client, msg) },
+				waitForExecution(deps), nil)
+		}
+
 	case ws.TypeAgentList:
 		handleAgentList(deps, client, msg)
 
 	// Swarm/Multi-agent message handlers
 	case ws.TypeSwarmRun:
-		handleSwarmRun(deps, client, msg)
+		if allowWebSocketMessage(deps, client, ratelimit.Agent) {
+			runWithSlot(deps, client, msg, concurrency.Swarms,
+				func() string { return handleSwarmRun(deps, client, msg) },
+				waitForSwarm(deps), nil)
+		}
 
 	case ws.TypeSwarmStop:
 		handleSwarmStop(deps, client, msg)
@@ -408,17 +1052,46 @@ func handleWebSocketMessage(deps *Dependencies, client *ws.Client, msg *ws.Incom
 
 	// Preview/Sandbox message handlers
 	case ws.TypeBuildStart:
-		handleBuildStart(deps, client, msg)
+		if deniedToGuest(deps, client, "shell_execute") {
+			return
+		}
+		runIdempotentWithSlot(deps, client, msg, concurrency.Builds,
+			func() string { return handleBuildStart(deps, client, msg) },
+			waitForBuild(deps),
+			func(id string) { replayBuildStart(deps, client, id) })
 
 	case ws.TypeBuildStop:
 		handleBuildStop(deps, client, msg)
 
+	// Streaming code run handlers
+	case ws.TypeCodeRun:
+		if deniedToGuest(deps, client, "execute_code") {
+			return
+		}
+		handleCodeRun(deps, client, msg)
+
+	case ws.TypeCodeStop:
+		handleCodeStop(deps, client, msg)
+
 	case ws.TypeFileRequest:
 		handleFileRequest(deps, client, msg)
 
+	case ws.TypeFileList:
+		handleFileList(deps, client, msg)
+
 	case ws.TypeFileHistoryRequest:
 		handleFileHistoryRequest(deps, client, msg)
 
+	// Topic subscription handlers
+	case ws.TypeSubscribe:
+		handleSubscribe(deps, client, msg)
+
+	case ws.TypeUnsubscribe:
+		handleUnsubscribe(deps, client, msg)
+
+	case ws.TypeObserverCreate:
+		handleObserverCreate(deps, client, msg)
+
 	default:
 		client.SendMessage(ws.NewError("unknown_type", "unknown message type: "+msg.Type))
 
@@ -429,22 +1102,24 @@ func handleWebSocketMessage(deps *Dependencies, client *ws.Client, msg *ws.Incom
 	}
 }
 
-// handleAgentRun handles a single agent run request
-func handleAgentRun(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
+// handleAgentRun handles a single agent run request. Returns the execution
+// ID, or "" if the run didn't start.
+func handleAgentRun(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) string {
 	if deps.AgentManager == nil {
 		client.SendMessage(ws.NewError("agent_unavailable", "agent manager not available"))
-		return
+		return ""
 	}
 
 	if msg.AgentConfig == nil {
-		client.SendMessage(ws.NewError("invalid_request", "agent_config is required"))
-		return
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "agent_config is required"))
+		return ""
 	}
 
 	if msg.Content == "" {
-		client.SendMessage(ws.NewError("invalid_request", "content (prompt) is required"))
-		return
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "content (prompt) is required"))
+		return ""
 	}
+	applyAgentDefaults(deps, client.UserID, msg.AgentConfig)
 
 	// Create agent config
 	agentConfig := agent.AgentConfig{
@@ -454,43 +1129,194 @@ func handleAgentRun(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessa
 		SystemPrompt: msg.AgentConfig.SystemPrompt,
 		Temperature:  msg.AgentConfig.Temperature,
 		MaxTokens:    msg.AgentConfig.MaxTokens,
+		Sampling:     toSampling(msg.AgentConfig),
+		Credentials:  userCredentials(deps, client.UserID, msg.AgentConfig.Provider),
+	}
+
+	// Pack the workspace context the task asked for alongside what it gave
+	taskContext := msg.Context
+	if msg.ContextPack != nil {
+		if deps.ContextPacker == nil {
+			client.SendMessage(ws.NewError("context_pack_unavailable", "context packs are not available"))
+			return ""
+		}
+		bundle, err := deps.ContextPacker.Pack(client.UserID, contextpack.Spec{
+			Dir:         msg.ContextPack.Dir,
+			Globs:       msg.ContextPack.Globs,
+			Query:       msg.ContextPack.Query,
+			TokenBudget: msg.ContextPack.TokenBudget,
+		})
+		if err != nil {
+			code := "context_pack_error"
+			if errors.Is(err, contextpack.ErrInvalidSpec) || errors.Is(err, contextpack.ErrNoFiles) {
+				code = apierror.CodeInvalidRequest
+			}
+			client.SendMessage(ws.NewError(code, err.Error()))
+			return ""
+		}
+		taskContext = instructions.Merge(taskContext, bundle.Content)
 	}
 
 	// Create task
 	task := agent.NewTask(msg.Content,
-		agent.WithContext(msg.Context),
+		agent.WithContext(taskContext),
 		agent.WithPriority(agent.TaskPriority(msg.Priority)),
 	)
+	if msg.Budget != nil {
+		task.Budget = toAgentBudget(msg.Budget)
+	}
+
+	// A run bound to a conversation continues its chat history and uses its
+	// system prompt, which already includes the project instructions
+	var gen *generation
+	if msg.ConversationID != "" {
+		var systemPrompt string
+		var history []llm.Message
+		systemPrompt, history, gen = bindAgentRunToConversation(deps, client, msg, task.ID)
+		if gen == nil {
+			return ""
+		}
+		agentConfig.SystemPrompt = instructions.Merge(agentConfig.SystemPrompt, systemPrompt)
+		task.History = history
+	} else if deps.ProjectInstructions != nil {
+		agentConfig.SystemPrompt = instructions.Merge(agentConfig.SystemPrompt, deps.ProjectInstructions.Load(client.UserID))
+	}
+
+	checkpointBeforeRun(deps, client.UserID, msg.Content)
 
 	// Run the agent
-	execution, err := deps.AgentManager.RunTask(context.Background(), task, agentConfig)
+	execution, err := deps.AgentManager.RunTask(context.Background(), task, agentConfig, agent.WithOwner(client.UserID))
 	if err != nil {
+		generations.finish(gen)
 		client.SendMessage(ws.NewError("agent_error", err.Error()))
-		return
+		return ""
 	}
 
 	// Subscribe to events and forward them to the client
-	go forwardAgentEvents(deps, client, execution)
+	go forwardAgentEvents(deps, client, execution, msg.ConversationID, gen)
 
 	log.Printf("Agent started: id=%s, task=%s", execution.Agents[0].ID, task.ID)
+	return execution.ID
 }
 
-// handleAgentRunParallel handles a parallel agent run request
-func handleAgentRunParallel(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
+// bindAgentRunToConversation prepares an agent run that continues a
+// conversation. It checks the caller may send to the conversation, claims the
+// conversation so no chat response is generated alongside the run, and saves
+// the prompt as a user message. It returns the conversation's system prompt,
+// the chat history preceding the prompt and the run's generation, which the
+// caller finishes once the run ends; on failure the client has already been
+// sent an error and gen is nil.
+func bindAgentRunToConversation(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage, executionID string) (systemPrompt string, history []llm.Message, gen *generation) {
+	conversation, err := deps.ConversationRepo.GetByID(msg.ConversationID)
+	if err != nil {
+		client.SendMessage(ws.NewError("database_error", "failed to get conversation: "+err.Error()))
+		return "", nil, nil
+	}
+	if conversation == nil {
+		client.SendMessage(ws.NewError(apierror.CodeNotFound, "conversation not found"))
+		return "", nil, nil
+	}
+
+	access, err := conversationAccess(deps, conversation, client.UserID)
+	if err != nil {
+		client.SendMessage(ws.NewError("database_error", "failed to check conversation access: "+err.Error()))
+		return "", nil, nil
+	}
+	if !canSendToConversation(access) {
+		client.SendMessage(ws.NewError(apierror.CodeForbidden, "not authorized to access this conversation"))
+		return "", nil, nil
+	}
+
+	// Stopping the run's generation cancels the run
+	stop := context.CancelFunc(func() {
+		_ = deps.AgentManager.CancelExecution(executionID)
+	})
+	gen, ok := generations.start(msg.ConversationID, client.UserID, generationAgent, stop)
+	if !ok {
+		client.SendMessage(ws.NewError("conversation_busy", "a response is already being generated for this conversation"))
+		return "", nil, nil
+	}
+	release := func() {
+		generations.finish(gen)
+	}
+
+	version, err := deps.ConversationRepo.IncrementVersion(msg.ConversationID, msg.ExpectedVersion)
+	if err != nil {
+		release()
+		if errors.Is(err, repository.ErrVersionConflict) {
+			conflict := ws.NewError("version_conflict", "conversation was updated by another participant")
+			conflict.ConversationID = msg.ConversationID
+			if current, err := deps.ConversationRepo.GetVersion(msg.ConversationID); err == nil {
+				conflict.Version = current
+			}
+			client.SendMessage(conflict)
+			return "", nil, nil
+		}
+		client.SendMessage(ws.NewError("database_error", "failed to update conversation: "+err.Error()))
+		return "", nil, nil
+	}
+
+	// Load the history before saving the prompt, which the agent adds itself
+	messages, err := deps.MessageRepo.ListByConversationID(msg.ConversationID)
+	if err != nil {
+		release()
+		client.SendMessage(ws.NewError("database_error", "failed to get message history: "+err.Error()))
+		return "", nil, nil
+	}
+
+	userMsg, err := deps.MessageRepo.Create(msg.ConversationID, "user", msg.Content, nil, "")
+	if err != nil {
+		release()
+		client.SendMessage(ws.NewError("database_error", "failed to save message: "+err.Error()))
+		return "", nil, nil
+	}
+	broadcastToParticipants(deps, msg.ConversationID, client.UserID,
+		ws.NewChatUserMessage(msg.ConversationID, userMsg.ID, client.UserID, msg.Content, version))
+
+	return buildSystemPrompt(deps, client.UserID, conversation), shapeHistory(deps, conversation, buildLLMMessages("", messages, nil)), gen
+}
+
+// saveAgentOutput appends a finished agent run's output to its conversation
+// as an assistant message and shows it to the conversation's participants
+func saveAgentOutput(deps *Dependencies, client *ws.Client, conversationID, output string, tokensUsed int) {
+	if strings.TrimSpace(output) == "" {
+		return
+	}
+
+	saved, err := deps.MessageRepo.Create(conversationID, "assistant", output, nil, "")
+	if err != nil {
+		log.Printf("Failed to save agent output to conversation %s: %v", conversationID, err)
+		return
+	}
+	if tokensUsed > 0 {
+		if err := deps.MessageRepo.SetTokensUsed(saved.ID, tokensUsed); err != nil {
+			log.Printf("Failed to save message token usage: %v", err)
+		}
+	}
+
+	sendToParticipants(deps, client, conversationID, ws.NewChatAssistantMessage(conversationID, saved.ID, output))
+
+	go autoTitleConversation(deps, client, conversationID)
+}
+
+// handleAgentRunParallel handles a parallel agent run request. Returns the
+// execution ID, or "" if the run didn't start.
+func handleAgentRunParallel(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) string {
 	if deps.AgentManager == nil {
 		client.SendMessage(ws.NewError("agent_unavailable", "agent manager not available"))
-		return
+		return ""
 	}
 
 	if msg.AgentConfig == nil {
-		client.SendMessage(ws.NewError("invalid_request", "agent_config is required"))
-		return
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "agent_config is required"))
+		return ""
 	}
 
 	if len(msg.Tasks) == 0 {
-		client.SendMessage(ws.NewError("invalid_request", "tasks array is required"))
-		return
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "tasks array is required"))
+		return ""
 	}
+	applyAgentDefaults(deps, client.UserID, msg.AgentConfig)
 
 	// Create agent config
 	agentConfig := agent.AgentConfig{
@@ -500,6 +1326,11 @@ func handleAgentRunParallel(deps *Dependencies, client *ws.Client, msg *ws.Incom
 		SystemPrompt: msg.AgentConfig.SystemPrompt,
 		Temperature:  msg.AgentConfig.Temperature,
 		MaxTokens:    msg.AgentConfig.MaxTokens,
+		Sampling:     toSampling(msg.AgentConfig),
+		Credentials:  userCredentials(deps, client.UserID, msg.AgentConfig.Provider),
+	}
+	if deps.ProjectInstructions != nil {
+		agentConfig.SystemPrompt = instructions.Merge(agentConfig.SystemPrompt, deps.ProjectInstructions.Load(client.UserID))
 	}
 
 	// Create tasks
@@ -510,19 +1341,151 @@ func handleAgentRunParallel(deps *Dependencies, client *ws.Client, msg *ws.Incom
 			agent.WithContext(t.Context),
 			agent.WithMetadata(t.Metadata),
 		)
+		if t.Budget != nil {
+			tasks[i].Budget = toAgentBudget(t.Budget)
+		}
+	}
+
+	checkpointBeforeRun(deps, client.UserID, msg.Tasks[0].Prompt)
+
+	// The request's budget applies to all tasks together
+	opts := []agent.ExecutionOption{agent.WithOwner(client.UserID)}
+	if msg.Budget != nil {
+		opts = append(opts, agent.WithExecutionBudget(*toAgentBudget(msg.Budget)))
 	}
 
 	// Run agents in parallel
-	execution, err := deps.AgentManager.RunParallel(context.Background(), tasks, agentConfig)
+	execution, err := deps.AgentManager.RunParallel(context.Background(), tasks, agentConfig, opts...)
 	if err != nil {
 		client.SendMessage(ws.NewError("agent_error", err.Error()))
-		return
+		return ""
 	}
 
 	// Forward events and batch progress to client
 	go forwardBatchEvents(deps, client, execution)
 
 	log.Printf("Parallel agent execution started: id=%s, tasks=%d", execution.ID, len(tasks))
+	return execution.ID
+}
+
+// handleAgentReplay re-runs one of the client's finished executions with the
+// same tasks, optionally against another provider, model or config. Tool calls
+// are answered from the results recorded in the tasks' history rather than
+// run, so the replay has no side effects. Returns the execution ID, or "" if
+// the replay didn't start.
+func handleAgentReplay(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) string {
+	if deps.AgentManager == nil {
+		client.SendMessage(ws.NewError("agent_unavailable", "agent manager not available"))
+		return ""
+	}
+
+	if msg.ExecutionID == "" {
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "execution_id is required"))
+		return ""
+	}
+
+	// Only the user who ran an execution may replay it
+	original, err := deps.AgentManager.GetExecution(msg.ExecutionID)
+	if err != nil || original.Owner == "" || original.Owner != client.UserID {
+		client.SendMessage(ws.NewError(apierror.CodeNotFound, "execution not found"))
+		return ""
+	}
+
+	var opts agent.ReplayOptions
+	if msg.AgentConfig != nil {
+		opts = agent.ReplayOptions{
+			Provider:     msg.AgentConfig.Provider,
+			Model:        msg.AgentConfig.Model,
+			SystemPrompt: msg.AgentConfig.SystemPrompt,
+			Temperature:  msg.AgentConfig.Temperature,
+			MaxTokens:    msg.AgentConfig.MaxTokens,
+			Sampling:     toSampling(msg.AgentConfig),
+		}
+	}
+
+	execOpts := []agent.ExecutionOption{agent.WithOwner(client.UserID)}
+	if msg.Budget != nil {
+		execOpts = append(execOpts, agent.WithExecutionBudget(*toAgentBudget(msg.Budget)))
+	}
+
+	execution, err := deps.AgentManager.Replay(context.Background(), original.ID, opts, execOpts...)
+	if err != nil {
+		code := "agent_error"
+		if errors.Is(err, agent.ErrExecutionRunning) {
+			code = apierror.CodeInvalidRequest
+		}
+		client.SendMessage(ws.NewError(code, err.Error()))
+		return ""
+	}
+
+	client.SendMessage(&ws.OutgoingMessage{
+		Type:        ws.TypeAgentReplayStarted,
+		ExecutionID: execution.ID,
+		Metadata: map[string]interface{}{
+			"replay_of": original.ID,
+		},
+	})
+
+	if execution.Type == agent.ExecutionTypeSingle {
+		go forwardAgentEvents(deps, client, execution, "", nil)
+	} else {
+		go forwardBatchEvents(deps, client, execution)
+	}
+
+	log.Printf("Agent replay started: id=%s, replay_of=%s", execution.ID, original.ID)
+	return execution.ID
+}
+
+// toSampling converts the sampling controls of an agent config from a
+// WebSocket request
+func toSampling(config *ws.AgentConfig) llm.Sampling {
+	return llm.Sampling{
+		TopP:             config.TopP,
+		FrequencyPenalty: config.FrequencyPenalty,
+		PresencePenalty:  config.PresencePenalty,
+		Stop:             config.Stop,
+		Seed:             config.Seed,
+		Deterministic:    config.Deterministic,
+	}
+}
+
+// applyAgentDefaults fills in the provider, model, system prompt and
+// temperature an agent config leaves out, from the current workspace's
+// settings and then the user's preferences. A default model is only used with
+// its provider.
+func applyAgentDefaults(deps *Dependencies, userID string, config *ws.AgentConfig) {
+	if settings := workspaceSettings(deps, userID); settings != nil {
+		repository.FillModel(&config.Provider, &config.Model, settings.DefaultProvider, settings.DefaultModel)
+	}
+
+	if deps.PreferencesRepo == nil {
+		return
+	}
+	prefs, err := deps.PreferencesRepo.Get(userID)
+	if err != nil {
+		log.Printf("Failed to get preferences for user %s: %v", userID, err)
+		return
+	}
+	if prefs == nil {
+		return
+	}
+
+	repository.FillModel(&config.Provider, &config.Model, prefs.DefaultProvider, prefs.DefaultModel)
+	if config.SystemPrompt == "" {
+		config.SystemPrompt = prefs.DefaultSystemPrompt
+	}
+	if config.Temperature == 0 && !config.Deterministic && prefs.DefaultTemperature != nil {
+		config.Temperature = *prefs.DefaultTemperature
+	}
+}
+
+// toAgentBudget converts a budget from a WebSocket request
+func toAgentBudget(budget *ws.AgentBudget) *agent.Budget {
+	return &agent.Budget{
+		MaxTokens:    budget.MaxTokens,
+		MaxToolCalls: budget.MaxToolCalls,
+		MaxDuration:  time.Duration(budget.MaxDurationSecs) * time.Second,
+	}
 }
 
 // handleAgentStop handles an agent stop request
@@ -533,25 +1496,27 @@ func handleAgentStop(deps *Dependencies, client *ws.Client, msg *ws.IncomingMess
 	}
 
 	if msg.ExecutionID == "" && msg.AgentID == "" {
-		client.SendMessage(ws.NewError("invalid_request", "execution_id or agent_id is required"))
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "execution_id or agent_id is required"))
 		return
 	}
 
-	var err error
+	// The status is cancelled_before_start if nothing had started yet
+	status := agent.ExecutionStatusCancelled
 	if msg.ExecutionID != "" {
-		err = deps.AgentManager.CancelExecution(msg.ExecutionID)
-	}
-
-	if err != nil {
-		client.SendMessage(ws.NewError("agent_error", err.Error()))
-		return
+		if err := deps.AgentManager.CancelExecution(msg.ExecutionID); err != nil {
+			client.SendMessage(ws.NewError("agent_error", err.Error()))
+			return
+		}
+		if execution, err := deps.AgentManager.GetExecution(msg.ExecutionID); err == nil {
+			status = execution.GetStatus()
+		}
 	}
 
 	client.SendMessage(&ws.OutgoingMessage{
 		Type:        ws.TypeAgentCancelled,
 		ExecutionID: msg.ExecutionID,
 		AgentID:     msg.AgentID,
-		Status:      "cancelled",
+		Status:      string(status),
 	})
 }
 
@@ -563,7 +1528,7 @@ func handleAgentStatus(deps *Dependencies, client *ws.Client, msg *ws.IncomingMe
 	}
 
 	if msg.ExecutionID == "" {
-		client.SendMessage(ws.NewError("invalid_request", "execution_id is required"))
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "execution_id is required"))
 		return
 	}
 
@@ -637,48 +1602,88 @@ func handleAgentList(deps *Dependencies, client *ws.Client, msg *ws.IncomingMess
 	client.SendMessage(ws.NewAgentList(agents))
 }
 
-// forwardAgentEvents forwards agent events to the WebSocket client
-func forwardAgentEvents(deps *Dependencies, client *ws.Client, execution *agent.Execution) {
+// forwardAgentEvents forwards agent events to the WebSocket client. When the
+// run is bound to a conversation, its output is saved to the conversation and
+// its generation is finished once the run ends.
+func forwardAgentEvents(deps *Dependencies, client *ws.Client, execution *agent.Execution, conversationID string, gen *generation) {
+	defer generations.finish(gen)
 	if len(execution.Agents) == 0 {
 		return
 	}
 
+	startTime := time.Now()
 	agentInstance := execution.Agents[0]
 	taskID := ""
 	if len(execution.Tasks) > 0 {
 		taskID = execution.Tasks[0].ID
 	}
 
-	// Send started notification
-	client.SendMessage(ws.NewAgentStarted(agentInstance.ID, taskID))
+	// Observers of the execution see the same events as the client. Each
+	// event names the execution, which observer.create asks for.
+	topic := ws.ExecutionTopic(execution.ID)
+	send := func(msg *ws.OutgoingMessage) {
+		if msg.ExecutionID == "" {
+			msg.ExecutionID = execution.ID
+		}
+		client.SendMessage(msg)
+		deps.WSHub.Publish(client.UserID, msg, topic)
+	}
 
-	// Listen to agent events
+	// Listen to agent events. The agent may wait in the pool's queue first,
+	// in which case queued events report its position until it starts.
 	for event := range agentInstance.Events() {
 		switch event.Type {
+		case agent.AgentEventQueued:
+			position, _ := event.Data["position"].(int)
+			queueSize, _ := event.Data["queue_size"].(int)
+			priority, _ := event.Data["priority"].(int)
+			send(ws.NewAgentQueued(agentInstance.ID, taskID, &ws.QueueInfo{
+				Position:  position,
+				QueueSize: queueSize,
+				Priority:  priority,
+			}))
+		case agent.AgentEventStarted:
+			startTime = time.Now()
+			send(ws.NewAgentStarted(agentInstance.ID, taskID))
 		case agent.AgentEventStreamChunk:
 			if delta, ok := event.Data["delta"].(string); ok {
-				client.SendMessage(ws.NewAgentStreamChunk(agentInstance.ID, taskID, delta))
+				send(ws.NewAgentStreamChunk(agentInstance.ID, taskID, delta))
 			}
 		case agent.AgentEventToolCall:
 			toolName, _ := event.Data["name"].(string)
 			params := event.Data["parameters"]
-			client.SendMessage(ws.NewAgentToolCall(agentInstance.ID, taskID, toolName, params))
+			send(ws.NewAgentToolCall(agentInstance.ID, taskID, toolName, params))
 		case agent.AgentEventCompleted:
 			output, _ := event.Data["output"].(string)
 			// Wait for result to get duration
+			var durationMs int64
+			var tokensUsed int
 			select {
 			case result := <-agentInstance.Results():
-				client.SendMessage(ws.NewAgentCompleted(agentInstance.ID, taskID, output, result.Duration.Milliseconds()))
+				durationMs = result.Duration.Milliseconds()
+				tokensUsed = result.TokensUsed
+				send(ws.NewAgentCompleted(agentInstance.ID, taskID, output, durationMs))
 			case <-time.After(5 * time.Second):
-				client.SendMessage(ws.NewAgentCompleted(agentInstance.ID, taskID, output, 0))
+				send(ws.NewAgentCompleted(agentInstance.ID, taskID, output, 0))
+				durationMs = time.Since(startTime).Milliseconds()
+			}
+			if conversationID != "" {
+				saveAgentOutput(deps, client, conversationID, output, tokensUsed)
+			}
+			if deps.IntegrationManager != nil {
+				deps.IntegrationManager.TrackAgentFinished(client.UserID, conversationID, agentInstance.ID, agentInstance.Config.Name, false, "", durationMs)
 			}
 			return
 		case agent.AgentEventFailed:
 			errMsg, _ := event.Data["error"].(string)
-			client.SendMessage(ws.NewAgentFailed(agentInstance.ID, taskID, errMsg))
+			send(ws.NewAgentFailed(agentInstance.ID, taskID, errMsg))
+			if deps.IntegrationManager != nil {
+				deps.IntegrationManager.TrackAgentFinished(client.UserID, conversationID, agentInstance.ID, agentInstance.Config.Name, true, errMsg,
+					time.Since(startTime).Milliseconds())
+			}
 			return
 		case agent.AgentEventCancelled:
-			client.SendMessage(ws.NewAgentCancelled(agentInstance.ID, taskID))
+			send(ws.NewAgentCancelled(agentInstance.ID, taskID))
 			return
 		}
 	}
@@ -693,12 +1698,23 @@ func forwardBatchEvents(deps *Dependencies, client *ws.Client, execution *agent.
 	completedTasks := 0
 	failedTasks := 0
 
+	// Observers of the execution see the same events as the client. Each
+	// event names the execution, which observer.create asks for.
+	topic := ws.ExecutionTopic(execution.ID)
+	send := func(msg *ws.OutgoingMessage) {
+		if msg.ExecutionID == "" {
+			msg.ExecutionID = execution.ID
+		}
+		client.SendMessage(msg)
+		deps.WSHub.Publish(client.UserID, msg, topic)
+	}
+
 	// Subscribe to agent manager events
 	eventChan := deps.AgentManager.Subscribe()
 	defer deps.AgentManager.Unsubscribe(eventChan)
 
 	// Send initial progress
-	client.SendMessage(ws.NewAgentBatchProgress(execution.ID, &ws.BatchProgressInfo{
+	send(ws.NewAgentBatchProgress(execution.ID, &ws.BatchProgressInfo{
 		TotalTasks:     totalTasks,
 		CompletedTasks: 0,
 		FailedTasks:    0,
@@ -736,12 +1752,12 @@ func forwardBatchEvents(deps *Dependencies, client *ws.Client, execution *agent.
 							break
 						}
 					}
-					client.SendMessage(ws.NewAgentStreamChunk(event.AgentID, taskID, delta))
+					send(ws.NewAgentStreamChunk(event.AgentID, taskID, delta))
 				}
 
 			case agent.AgentEventCompleted:
 				completedTasks++
-				client.SendMessage(ws.NewAgentBatchProgress(execution.ID, &ws.BatchProgressInfo{
+				send(ws.NewAgentBatchProgress(execution.ID, &ws.BatchProgressInfo{
 					TotalTasks:     totalTasks,
 					CompletedTasks: completedTasks,
 					FailedTasks:    failedTasks,
@@ -752,7 +1768,7 @@ func forwardBatchEvents(deps *Dependencies, client *ws.Client, execution *agent.
 			case agent.AgentEventFailed:
 				failedTasks++
 				completedTasks++
-				client.SendMessage(ws.NewAgentBatchProgress(execution.ID, &ws.BatchProgressInfo{
+				send(ws.NewAgentBatchProgress(execution.ID, &ws.BatchProgressInfo{
 					TotalTasks:     totalTasks,
 					CompletedTasks: completedTasks,
 					FailedTasks:    failedTasks,
@@ -768,17 +1784,20 @@ func forwardBatchEvents(deps *Dependencies, client *ws.Client, execution *agent.
 				resultInfos := make([]ws.AgentResultInfo, len(results))
 				for i, r := range results {
 					resultInfos[i] = ws.AgentResultInfo{
-						AgentID:     r.AgentID,
-						TaskID:      r.TaskID,
-						Success:     r.Success,
-						Output:      r.Output,
-						Error:       r.Error,
-						Duration:    r.Duration.Milliseconds(),
-						CompletedAt: r.CompletedAt.UnixMilli(),
+						AgentID:        r.AgentID,
+						TaskID:         r.TaskID,
+						Success:        r.Success,
+						Output:         r.Output,
+						Error:          r.Error,
+						Duration:       r.Duration.Milliseconds(),
+						CompletedAt:    r.CompletedAt.UnixMilli(),
+						TokensUsed:     r.TokensUsed,
+						ToolCalls:      r.ToolCalls,
+						BudgetExceeded: r.BudgetExceeded,
 					}
 				}
 
-				client.SendMessage(ws.NewAgentBatchCompleted(
+				send(ws.NewAgentBatchCompleted(
 					execution.ID,
 					resultInfos,
 					time.Since(startTime).Milliseconds(),
@@ -788,7 +1807,7 @@ func forwardBatchEvents(deps *Dependencies, client *ws.Client, execution *agent.
 
 		case <-time.After(10 * time.Minute):
 			// Timeout for batch execution
-			client.SendMessage(ws.NewError("batch_timeout", "batch execution timed out"))
+			send(ws.NewError("batch_timeout", "batch execution timed out"))
 			return
 		}
 	}
@@ -796,16 +1815,17 @@ func forwardBatchEvents(deps *Dependencies, client *ws.Client, execution *agent.
 
 // ==================== Swarm/Multi-Agent Handlers ====================
 
-// handleSwarmRun handles a swarm run request
-func handleSwarmRun(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
+// handleSwarmRun handles a swarm run request. Returns the swarm ID, or "" if
+// the swarm didn't start.
+func handleSwarmRun(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) string {
 	if deps.AgentManager == nil {
 		client.SendMessage(ws.NewError("agent_unavailable", "agent manager not available"))
-		return
+		return ""
 	}
 
 	if msg.Content == "" {
-		client.SendMessage(ws.NewError("invalid_request", "content (task) is required"))
-		return
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "content (task) is required"))
+		return ""
 	}
 
 	// Build agent role configs
@@ -825,6 +1845,7 @@ func handleSwarmRun(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessa
 					Model:       rc.Config.Model,
 					Temperature: rc.Config.Temperature,
 					MaxTokens:   rc.Config.MaxTokens,
+					Sampling:    toSampling(rc.Config),
 				}
 			}
 			agentConfigs = append(agentConfigs, roleConfig)
@@ -843,6 +1864,7 @@ func handleSwarmRun(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessa
 					Model:       rc.Config.Model,
 					Temperature: rc.Config.Temperature,
 					MaxTokens:   rc.Config.MaxTokens,
+					Sampling:    toSampling(rc.Config),
 				}
 			}
 			agentConfigs = append(agentConfigs, roleConfig)
@@ -855,21 +1877,43 @@ func handleSwarmRun(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessa
 			{Role: agent.RoleTester, Count: 1},
 		}
 	} else {
-		client.SendMessage(ws.NewError("invalid_request", "swarm_config, agent_roles, or agent_config is required"))
-		return
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "swarm_config, agent_roles, or agent_config is required"))
+		return ""
 	}
 
-	// Get base config
+	// Get base config, from the user's preferences if the message has none
 	baseConfig := agent.AgentConfig{
 		Provider: "openai",
 		Model:    "gpt-4",
 	}
-	if msg.AgentConfig != nil {
+	if msg.AgentConfig == nil {
+		defaults := &ws.AgentConfig{}
+		applyAgentDefaults(deps, client.UserID, defaults)
+		if defaults.Provider != "" && defaults.Model != "" {
+			baseConfig = agent.AgentConfig{
+				Provider:    defaults.Provider,
+				Model:       defaults.Model,
+				Temperature: defaults.Temperature,
+			}
+		}
+	} else {
+		applyAgentDefaults(deps, client.UserID, msg.AgentConfig)
 		baseConfig = agent.AgentConfig{
 			Provider:    msg.AgentConfig.Provider,
 			Model:       msg.AgentConfig.Model,
 			Temperature: msg.AgentConfig.Temperature,
 			MaxTokens:   msg.AgentConfig.MaxTokens,
+			Sampling:    toSampling(msg.AgentConfig),
+		}
+	}
+
+	// Run every agent with the user's own keys
+	baseConfig.Credentials = userCredentials(deps, client.UserID, baseConfig.Provider)
+	for i := range agentConfigs {
+		if agentConfigs[i].Config.Provider == "" || agentConfigs[i].Config.Provider == baseConfig.Provider {
+			agentConfigs[i].Config.Credentials = baseConfig.Credentials
+		} else {
+			agentConfigs[i].Config.Credentials = userCredentials(deps, client.UserID, agentConfigs[i].Config.Provider)
 		}
 	}
 
@@ -881,17 +1925,38 @@ func handleSwarmRun(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessa
 		strategy = agent.SwarmStrategy(msg.SwarmConfig.Strategy)
 	}
 
+	// Wall-clock and budget limits, and stopping once the agents agree
+	var options *agent.SwarmOptions
+	if sc := msg.SwarmConfig; sc != nil {
+		options = &agent.SwarmOptions{
+			Timeout: time.Duration(sc.TimeoutSecs) * time.Second,
+		}
+		if sc.MaxTokens > 0 || sc.MaxCost > 0 {
+			options.Budget = &agent.SwarmBudget{
+				MaxTokens: sc.MaxTokens,
+				MaxCost:   sc.MaxCost,
+			}
+		}
+		if sc.ConsensusThreshold > 0 {
+			options.EarlyStop = agent.ConsensusEarlyStop(sc.ConsensusThreshold)
+		}
+	}
+
+	checkpointBeforeRun(deps, client.UserID, msg.Content)
+
 	// Run the swarm
-	swarm, err := deps.AgentManager.RunMultiAgent(context.Background(), msg.Content, strategy, agentConfigs, baseConfig)
+	swarm, err := deps.AgentManager.RunMultiAgent(context.Background(), msg.Content, strategy, agentConfigs, baseConfig, options)
 	if err != nil {
 		client.SendMessage(ws.NewError("swarm_error", err.Error()))
-		return
+		return ""
 	}
 
-	// Forward swarm events to client
+	// Subscribe the requesting client to the swarm stream and forward events
+	deps.WSHub.Subscribe(client, ws.SwarmTopic(swarm.ID))
 	go forwardSwarmEvents(deps, client, swarm)
 
 	log.Printf("Swarm started: id=%s, agents=%d, strategy=%s", swarm.ID, len(swarm.Agents), strategy)
+	return swarm.ID
 }
 
 // handleSwarmStop handles a swarm stop request
@@ -902,7 +1967,7 @@ func handleSwarmStop(deps *Dependencies, client *ws.Client, msg *ws.IncomingMess
 	}
 
 	if msg.SwarmID == "" {
-		client.SendMessage(ws.NewError("invalid_request", "swarm_id is required"))
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "swarm_id is required"))
 		return
 	}
 
@@ -922,7 +1987,7 @@ func handleSwarmStatus(deps *Dependencies, client *ws.Client, msg *ws.IncomingMe
 	}
 
 	if msg.SwarmID == "" {
-		client.SendMessage(ws.NewError("invalid_request", "swarm_id is required"))
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "swarm_id is required"))
 		return
 	}
 
@@ -971,7 +2036,9 @@ func handleSwarmStatus(deps *Dependencies, client *ws.Client, msg *ws.IncomingMe
 		Phase:           string(swarm.Status),
 	}
 
-	client.SendMessage(ws.NewSwarmStatus(swarm.ID, string(swarm.Status), agents, progress))
+	status := ws.NewSwarmStatus(swarm.ID, string(swarm.Status), agents, progress)
+	status.SwarmSubtasks = swarmSubtasks(swarm)
+	client.SendMessage(status)
 }
 
 // handleSwarmList handles a swarm list request
@@ -999,9 +2066,29 @@ func handleSwarmList(deps *Dependencies, client *ws.Client, msg *ws.IncomingMess
 	client.SendMessage(ws.NewSwarmList(infos))
 }
 
-// forwardSwarmEvents forwards swarm events to the WebSocket client
+// swarmSubtasks converts a map-reduce swarm's subtasks
+func swarmSubtasks(swarm *agent.Swarm) []ws.SwarmSubtaskInfo {
+	var infos []ws.SwarmSubtaskInfo
+	for _, subtask := range swarm.GetSubtasks() {
+		infos = append(infos, ws.SwarmSubtaskInfo{
+			Index:       subtask.Index,
+			Title:       subtask.Title,
+			Description: subtask.Description,
+			AgentID:     subtask.AgentID,
+			Success:     subtask.Success,
+			Error:       subtask.Error,
+		})
+	}
+	return infos
+}
+
+// forwardSwarmEvents publishes swarm events to the clients subscribed to the swarm topic
 func forwardSwarmEvents(deps *Dependencies, client *ws.Client, swarm *agent.Swarm) {
 	startTime := time.Now()
+	topic := ws.SwarmTopic(swarm.ID)
+	publish := func(msg *ws.OutgoingMessage) {
+		deps.WSHub.Publish(client.UserID, msg, topic)
+	}
 
 	// Build initial agent info
 	agents := make([]ws.SwarmAgentInfo, len(swarm.Agents))
@@ -1014,55 +2101,68 @@ func forwardSwarmEvents(deps *Dependencies, client *ws.Client, swarm *agent.Swar
 	}
 
 	// Send swarm started
-	client.SendMessage(ws.NewSwarmStarted(swarm.ID, agents))
+	publish(ws.NewSwarmStarted(swarm.ID, agents))
 
 	// Track progress
 	totalAgents := len(swarm.Agents)
 	completedAgents := 0
 	failedAgents := 0
+	phase := "running"
+	progress := func(usage agent.SwarmUsage) *ws.OutgoingMessage {
+		running := totalAgents - completedAgents
+		if running < 0 || phase != "running" {
+			running = 0
+		}
+		return ws.NewSwarmProgress(swarm.ID, &ws.SwarmProgressInfo{
+			TotalAgents:     totalAgents,
+			RunningAgents:   running,
+			CompletedAgents: completedAgents,
+			FailedAgents:    failedAgents,
+			Phase:           phase,
+			TokensUsed:      usage.Tokens,
+			Cost:            usage.Cost,
+			ElapsedMs:       usage.Elapsed.Milliseconds(),
+			MaxTokens:       usage.MaxTokens,
+			MaxCost:         usage.MaxCost,
+			TimeoutMs:       usage.Timeout.Milliseconds(),
+			StopReason:      usage.StopReason,
+		})
+	}
 
 	// Listen for events
 	for event := range swarm.Events() {
 		switch event.Type {
 		case agent.SwarmEventAgentStarted:
 			input, _ := event.Data["input"].(string)
-			client.SendMessage(ws.NewSwarmAgentStarted(swarm.ID, event.AgentID, string(event.Role), input))
+			publish(ws.NewSwarmAgentStarted(swarm.ID, event.AgentID, string(event.Role), input))
 
 		case agent.SwarmEventAgentOutput:
 			if delta, ok := event.Data["delta"].(string); ok {
-				client.SendMessage(ws.NewSwarmAgentOutput(swarm.ID, event.AgentID, string(event.Role), delta))
+				publish(ws.NewSwarmAgentOutput(swarm.ID, event.AgentID, string(event.Role), delta))
 			}
 
 		case agent.SwarmEventAgentCompleted:
 			completedAgents++
 			output, _ := event.Data["output"].(string)
 			duration, _ := event.Data["duration"].(int64)
-			client.SendMessage(ws.NewSwarmAgentCompleted(swarm.ID, event.AgentID, string(event.Role), output, duration))
-
-			// Send progress update
-			client.SendMessage(ws.NewSwarmProgress(swarm.ID, &ws.SwarmProgressInfo{
-				TotalAgents:     totalAgents,
-				RunningAgents:   totalAgents - completedAgents - failedAgents,
-				CompletedAgents: completedAgents,
-				FailedAgents:    failedAgents,
-				Phase:           "running",
-			}))
+			publish(ws.NewSwarmAgentCompleted(swarm.ID, event.AgentID, string(event.Role), output, duration))
 
 		case agent.SwarmEventAgentFailed:
 			failedAgents++
 			completedAgents++
 			errMsg, _ := event.Data["error"].(string)
-			client.SendMessage(ws.NewSwarmAgentFailed(swarm.ID, event.AgentID, string(event.Role), errMsg))
+			publish(ws.NewSwarmAgentFailed(swarm.ID, event.AgentID, string(event.Role), errMsg))
 
 		case agent.SwarmEventSynthesizing:
-			client.SendMessage(ws.NewSwarmSynthesizing(swarm.ID))
-			client.SendMessage(ws.NewSwarmProgress(swarm.ID, &ws.SwarmProgressInfo{
-				TotalAgents:     totalAgents,
-				RunningAgents:   0,
-				CompletedAgents: completedAgents,
-				FailedAgents:    failedAgents,
-				Phase:           "synthesizing",
-			}))
+			phase = "synthesizing"
+			publish(ws.NewSwarmSynthesizing(swarm.ID))
+			publish(progress(swarm.Usage()))
+
+		case agent.SwarmEventProgress:
+			// Sent as each agent finishes, with the swarm's consumption
+			if usage, ok := event.Data["usage"].(agent.SwarmUsage); ok {
+				publish(progress(usage))
+			}
 
 		case agent.SwarmEventCompleted:
 			// Get final agents info
@@ -1084,36 +2184,59 @@ func forwardSwarmEvents(deps *Dependencies, client *ws.Client, swarm *agent.Swar
 				}
 			}
 
-			client.SendMessage(ws.NewSwarmCompleted(
+			// Final consumption, and why the swarm stopped if it stopped early
+			phase = "completed"
+			publish(progress(swarm.Usage()))
+
+			completed := ws.NewSwarmCompleted(
 				swarm.ID,
 				swarm.FinalOutput,
 				finalAgents,
 				time.Since(startTime).Milliseconds(),
-			))
+			)
+			completed.SwarmSubtasks = swarmSubtasks(swarm)
+			publish(completed)
+			if deps.IntegrationManager != nil {
+				deps.IntegrationManager.TrackSwarmFinished(client.UserID, swarm.ID, string(swarm.Config.Strategy), totalAgents,
+					false, "", time.Since(startTime).Milliseconds())
+			}
 			return
 
 		case agent.SwarmEventFailed:
 			errMsg, _ := event.Data["error"].(string)
-			client.SendMessage(ws.NewSwarmFailed(swarm.ID, errMsg))
+			publish(ws.NewSwarmFailed(swarm.ID, errMsg))
+			if deps.IntegrationManager != nil {
+				deps.IntegrationManager.TrackSwarmFinished(client.UserID, swarm.ID, string(swarm.Config.Strategy), totalAgents,
+					true, errMsg, time.Since(startTime).Milliseconds())
+			}
 			return
 
 		case agent.SwarmEventCancelled:
-			client.SendMessage(ws.NewSwarmCancelled(swarm.ID))
+			publish(ws.NewSwarmCancelled(swarm.ID))
 			return
 		}
 	}
 }
 
-// handleBuildStart handles a build start request via WebSocket
-func handleBuildStart(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
+// handleBuildStart handles a build start request via WebSocket. Returns the
+// build ID, or "" if the build didn't start.
+func handleBuildStart(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) string {
 	if deps.SandboxService == nil {
 		client.SendMessage(ws.NewError("sandbox_unavailable", "sandbox service not available"))
-		return
+		return ""
 	}
 
-	// Get build command from params
+	// Get build command and artifact globs from params, falling back to the
+	// workspace's build command, split on spaces
 	command := "npm"
 	args := []string{"run", "dev"}
+	var artifactPaths []string
+
+	if settings := workspaceSettings(deps, client.UserID); settings != nil {
+		if fields := strings.Fields(settings.BuildCommand); len(fields) > 0 {
+			command, args = fields[0], fields[1:]
+		}
+	}
 
 	if msg.Params != nil {
 		if cmd, ok := msg.Params["command"].(string); ok && cmd != "" {
@@ -1127,24 +2250,64 @@ func handleBuildStart(deps *Dependencies, client *ws.Client, msg *ws.IncomingMes
 				}
 			}
 		}
+		if a, ok := msg.Params["artifacts"].([]interface{}); ok {
+			for _, path := range a {
+				if s, ok := path.(string); ok && s != "" {
+					artifactPaths = append(artifactPaths, s)
+				}
+			}
+		}
+	}
+
+	// A build started from a conversation shows on its timeline
+	conversationID := msg.ConversationID
+	if conversationID != "" {
+		conversation, err := deps.ConversationRepo.GetByID(conversationID)
+		if err != nil {
+			client.SendMessage(ws.NewError("database_error", "failed to get conversation: "+err.Error()))
+			return ""
+		}
+		if conversation == nil {
+			client.SendMessage(ws.NewError(apierror.CodeNotFound, "conversation not found"))
+			return ""
+		}
+		access, err := conversationAccess(deps, conversation, client.UserID)
+		if err != nil {
+			client.SendMessage(ws.NewError("database_error", "failed to check conversation access: "+err.Error()))
+			return ""
+		}
+		if !canSendToConversation(access) {
+			client.SendMessage(ws.NewError(apierror.CodeForbidden, "not authorized to access this conversation"))
+			return ""
+		}
+	}
+
+	// Subscribe the requesting client to the build stream before starting
+	// it, so none of its output is missed
+	buildID := uuid.New().String()
+	buildTopic := ws.BuildTopic(buildID)
+	deps.WSHub.Subscribe(client, buildTopic)
+
+	// Send the build started notification ahead of the first output line
+	var started sync.Once
+	notifyStarted := func() {
+		started.Do(func() {
+			deps.WSHub.Publish(client.UserID, ws.NewBuildStarted(buildID), buildTopic)
+		})
 	}
 
 	// Start the build
-	var buildID string
-	build, err := deps.SandboxService.StartBuild(client.UserID, command, args, func(line sandbox.OutputLine) {
-		// Forward build output to client via WebSocket
-		client.SendMessage(ws.NewBuildOutput(buildID, line.Content, line.Stream))
+	build, err := deps.SandboxService.StartBuild(buildID, client.UserID, command, args, artifactPaths, func(line sandbox.OutputLine) {
+		// Forward build output to clients subscribed to the build
+		notifyStarted()
+		deps.WSHub.Publish(client.UserID, ws.NewBuildOutput(buildID, line.Content, line.Stream), buildTopic)
 	})
-	if build != nil {
-		buildID = build.ID
-	}
 	if err != nil {
+		deps.WSHub.Unsubscribe(client, buildTopic)
 		client.SendMessage(ws.NewError("build_error", err.Error()))
-		return
+		return ""
 	}
-
-	// Send build started notification
-	client.SendMessage(ws.NewBuildStarted(build.ID))
+	notifyStarted()
 
 	// Monitor build completion in background
 	go func() {
@@ -1155,27 +2318,34 @@ func handleBuildStart(deps *Dependencies, client *ws.Client, msg *ws.IncomingMes
 			if err != nil {
 				return
 			}
-			if b.Status == sandbox.BuildStatusSuccess || b.Status == sandbox.BuildStatusFailed || b.Status == sandbox.BuildStatusCancelled {
+			if b.GetStatus().IsFinished() {
 				var duration int64
 				if b.EndTime != nil {
 					duration = b.EndTime.Sub(b.StartTime).Milliseconds()
 				}
-				previewURL := deps.SandboxService.GetPreviewServer(client.UserID)
-				client.SendMessage(ws.NewBuildCompleted(b.ID, b.Status == sandbox.BuildStatusSuccess, previewURL, duration))
+				previewURL := deps.SandboxService.PreviewURL(b)
+				deps.WSHub.Publish(client.UserID, ws.NewBuildCompleted(b.ID, b.Status == sandbox.BuildStatusSuccess, previewURL, duration), buildTopic)
 
-				// Also send files updated message
+				if deps.IntegrationManager != nil && b.Status != sandbox.BuildStatusCancelled && b.Status != sandbox.BuildStatusCancelledBeforeStart {
+					deps.IntegrationManager.TrackBuildFinished(client.UserID, conversationID, b.ID, strings.TrimSpace(b.Command+" "+strings.Join(b.Args, " ")),
+						b.Status == sandbox.BuildStatusSuccess, b.Error, duration)
+				}
+
+				// Also send files updated message to build and workspace subscribers
 				files, err := deps.SandboxService.ListFiles(client.UserID)
 				if err == nil {
 					wsFiles := make([]ws.FileInfo, len(files))
 					for i, f := range files {
 						wsFiles[i] = convertFileInfo(f)
 					}
-					client.SendMessage(ws.NewFilesUpdated(wsFiles))
+					deps.WSHub.Publish(client.UserID, ws.NewFilesUpdated(wsFiles), buildTopic, ws.TopicWorkspace)
 				}
 				return
 			}
 		}
 	}()
+
+	return build.ID
 }
 
 // handleBuildStop handles a build stop request via WebSocket
@@ -1193,11 +2363,12 @@ func handleBuildStop(deps *Dependencies, client *ws.Client, msg *ws.IncomingMess
 	}
 
 	if buildID == "" {
-		client.SendMessage(ws.NewError("invalid_request", "build_id is required"))
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "build_id is required"))
 		return
 	}
 
-	if err := deps.SandboxService.StopBuild(buildID); err != nil {
+	status, err := deps.SandboxService.StopBuild(buildID)
+	if err != nil {
 		client.SendMessage(ws.NewError("build_error", err.Error()))
 		return
 	}
@@ -1205,12 +2376,36 @@ func handleBuildStop(deps *Dependencies, client *ws.Client, msg *ws.IncomingMess
 	client.SendMessage(&ws.OutgoingMessage{
 		Type:    ws.TypeBuildCompleted,
 		BuildID: buildID,
-		Status:  "cancelled",
+		Status:  string(status),
 		Success: false,
 	})
 }
 
-// handleFileRequest handles a file content request via WebSocket
+// handleSubscribe subscribes the client to a topic stream
+func handleSubscribe(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
+	if !ws.IsValidTopic(msg.Topic) {
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "invalid topic: "+msg.Topic))
+		return
+	}
+
+	deps.WSHub.Subscribe(client, msg.Topic)
+	client.SendMessage(ws.NewSubscribed(msg.Topic))
+}
+
+// handleUnsubscribe removes the client's subscription to a topic stream
+func handleUnsubscribe(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
+	if msg.Topic == "" {
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "topic is required"))
+		return
+	}
+
+	deps.WSHub.Unsubscribe(client, msg.Topic)
+	client.SendMessage(ws.NewUnsubscribed(msg.Topic))
+}
+
+// handleFileRequest handles a file content request via WebSocket. Clients
+// that set the chunked param get large files in pieces (compressed if they
+// set compress), and can resume an interrupted transfer from offset.
 func handleFileRequest(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
 	if deps.SandboxService == nil {
 		client.SendMessage(ws.NewError("sandbox_unavailable", "sandbox service not available"))
@@ -1225,7 +2420,7 @@ func handleFileRequest(deps *Dependencies, client *ws.Client, msg *ws.IncomingMe
 	}
 
 	if filePath == "" {
-		client.SendMessage(ws.NewError("invalid_request", "path is required"))
+		client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "path is required"))
 		return
 	}
 
@@ -1235,7 +2430,67 @@ func handleFileRequest(deps *Dependencies, client *ws.Client, msg *ws.IncomingMe
 		return
 	}
 
-	client.SendMessage(ws.NewFileContent(filePath, content))
+	opts := ws.FileTransferOptions{Hash: sandbox.ContentHash(content)}
+	opts.Chunked, _ = msg.Params["chunked"].(bool)
+	opts.Compress, _ = msg.Params["compress"].(bool)
+	if v, ok := msg.Params["offset"].(float64); ok {
+		opts.Offset = int(v)
+	}
+
+	// Large files wait on the send buffer chunk by chunk, so they go out in
+	// the background rather than holding up the client's other messages
+	go func() {
+		if err := client.SendFile(filePath, content, opts); err != nil {
+			client.SendMessage(ws.NewError("file_error", err.Error()))
+		}
+	}()
+}
+
+// handleFileList sends a page of a directory listing via WebSocket. Params
+// are root, path (the directory to expand), depth, offset and limit.
+func handleFileList(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
+	if deps.SandboxService == nil {
+		client.SendMessage(ws.NewError("sandbox_unavailable", "sandbox service not available"))
+		return
+	}
+
+	opts := sandbox.ListOptions{}
+	if msg.Params != nil {
+		opts.Root, _ = msg.Params["root"].(string)
+		opts.Path, _ = msg.Params["path"].(string)
+		if v, ok := msg.Params["depth"].(float64); ok {
+			opts.Depth = int(v)
+		}
+		if v, ok := msg.Params["offset"].(float64); ok {
+			opts.Offset = int(v)
+		}
+		if v, ok := msg.Params["limit"].(float64); ok {
+			opts.Limit = int(v)
+		}
+	}
+
+	listing, err := deps.SandboxService.ListDirectory(client.UserID, opts)
+	if err != nil {
+		client.SendMessage(ws.NewError("file_error", err.Error()))
+		return
+	}
+
+	files := make([]ws.FileInfo, len(listing.Files))
+	for i, f := range listing.Files {
+		files[i] = convertFileInfo(f)
+	}
+
+	metadata := map[string]interface{}{
+		"total":  listing.Total,
+		"offset": listing.Offset,
+	}
+	if listing.Root != "" {
+		metadata["root"] = listing.Root
+	}
+	if listing.NextOffset > 0 {
+		metadata["next_offset"] = listing.NextOffset
+	}
+	client.SendMessage(ws.NewFileListing(listing.Path, files, metadata))
 }
 
 // convertFileInfo converts sandbox.FileInfo to ws.FileInfo
@@ -1246,6 +2501,7 @@ func convertFileInfo(f sandbox.FileInfo) ws.FileInfo {
 		IsDirectory: f.IsDirectory,
 		Size:        f.Size,
 		Modified:    f.Modified,
+		Collapsed:   f.Collapsed,
 	}
 	if len(f.Children) > 0 {
 		wsFile.Children = make([]ws.FileInfo, len(f.Children))
@@ -1256,7 +2512,7 @@ func convertFileInfo(f sandbox.FileInfo) ws.FileInfo {
 	return wsFile
 }
 
-// handleFileHistoryRequest handles file history list and content requests via WebSocket
+// handleFileHistoryRequest handles file history list, content and diff requests via WebSocket
 func handleFileHistoryRequest(deps *Dependencies, client *ws.Client, msg *ws.IncomingMessage) {
 	if deps.FileHistoryRepo == nil {
 		client.SendMessage(ws.NewError("history_unavailable", "file history not available"))
@@ -1281,7 +2537,7 @@ func handleFileHistoryRequest(deps *Dependencies, client *ws.Client, msg *ws.Inc
 			}
 		}
 		if historyID == "" {
-			client.SendMessage(ws.NewError("invalid_request", "history_id is required"))
+			client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "history_id is required"))
 			return
 		}
 
@@ -1303,6 +2559,39 @@ func handleFileHistoryRequest(deps *Dependencies, client *ws.Client, msg *ws.Inc
 			entry.CreatedAt.Format("2006-01-02 15:04:05"),
 		))
 
+	case "diff":
+		// Diff a history entry against the current file or the entry before it
+		historyID, _ := msg.Params["history_id"].(string)
+		against, _ := msg.Params["against"].(string)
+		if historyID == "" {
+			client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "history_id is required"))
+			return
+		}
+		if against == "" {
+			against = changes.AgainstCurrent
+		}
+		if against != changes.AgainstCurrent && against != changes.AgainstPrevious {
+			client.SendMessage(ws.NewError(apierror.CodeInvalidRequest, "against must be current or previous"))
+			return
+		}
+		if deps.ChangeService == nil {
+			client.SendMessage(ws.NewError("history_unavailable", "file history diffs not available"))
+			return
+		}
+
+		result, err := deps.ChangeService.DiffHistory(client.UserID, historyID, against)
+		if errors.Is(err, changes.ErrHistoryNotFound) {
+			client.SendMessage(ws.NewError("history_error", "history entry not found"))
+			return
+		}
+		if err != nil {
+			client.SendMessage(ws.NewError("history_error", err.Error()))
+			return
+		}
+
+		client.SendMessage(ws.NewFileHistoryDiff(result.HistoryID, result.Path, result.Against, result.AgainstID,
+			result.Diff, result.Additions, result.Deletions, result.DiffTruncated))
+
 	default:
 		// Default: list history entries
 		filePath := ""
@@ -1345,15 +2634,38 @@ func handleFileHistoryRequest(deps *Dependencies, client *ws.Client, msg *ws.Inc
 	}
 }
 
-// errorHandler handles errors globally
-func errorHandler(c *fiber.Ctx, err error) error {
-	code := fiber.StatusInternalServerError
+// allowWebSocketMessage checks the sender against the named rate limiter,
+// and guests also against its lower guest counterpart, telling them how long
+// to wait if they are over it
+func allowWebSocketMessage(deps *Dependencies, client *ws.Client, limiter string) bool {
+	ok, retryAfter := deps.RateLimits.Allow(limiter, client.UserID)
+	if ok && deps.Guests.IsGuest(client.UserID) {
+		ok, retryAfter = deps.RateLimits.Allow("guest_"+limiter, client.UserID)
+	}
+	if ok {
+		return true
+	}
 
-	if e, ok := err.(*fiber.Error); ok {
-		code = e.Code
+	seconds := middleware.RetryAfterSeconds(retryAfter)
+	errMsg := ws.NewError(apierror.CodeRateLimited, fmt.Sprintf("rate limit exceeded, try again in %ds", seconds))
+	errMsg.Metadata = map[string]interface{}{"retry_after": seconds}
+	client.SendMessage(errMsg)
+	return false
+}
+
+// deniedToGuest reports whether the sender is a guest who may not use the
+// named tool, telling them so. Messages that run commands directly are held
+// to the same limits as the tools that would run them.
+func deniedToGuest(deps *Dependencies, client *ws.Client, toolName string) bool {
+	if !deps.Guests.DeniesTool(client.UserID, toolName) {
+		return false
 	}
+	client.SendMessage(ws.NewError(apierror.CodeForbidden, "not available to guest users"))
+	return true
+}
 
-	return c.Status(code).JSON(fiber.Map{
-		"error": err.Error(),
-	})
+// errorHandler handles errors globally
+func errorHandler(c *fiber.Ctx, err error) error {
+	status, resp := apierror.From(err)
+	return c.Status(status).JSON(resp)
 }
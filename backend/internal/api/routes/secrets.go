@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jacklau/prism/internal/security"
+	"github.com/jacklau/prism/internal/tools"
+	"github.com/jacklau/prism/internal/tools/builtin"
+)
+
+// NewToolSecretResolver resolves {{secret:NAME}} references in the
+// parameters of the built-in tools named in allowed for the user they run
+// for. The LLM only ever sees the references: secrets are masked again in
+// what the tool returns and in its progress updates. Other tools fail if
+// given a reference, since masking only covers the call that resolved it: a
+// tool that sends a secret over the network, or stores it to be read back
+// later, would leak it.
+func NewToolSecretResolver(vault *security.SecretVault, allowed []string) tools.ParamResolver {
+	allowedTools := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		allowedTools[name] = true
+	}
+
+	return func(ctx context.Context, name string, params map[string]interface{}, report tools.ProgressReporter, run func(context.Context, map[string]interface{}, tools.ProgressReporter) (interface{}, error)) (interface{}, error) {
+		userID, _ := ctx.Value(builtin.UserIDKey).(string)
+		if vault == nil || userID == "" || !security.HasSecretReference(params) {
+			return run(ctx, params, report)
+		}
+		if !allowedTools[name] {
+			return nil, fmt.Errorf("secret references can't be used with the %s tool", name)
+		}
+		// Background commands outlive the call, and their command line and
+		// output can be read back later with other tools
+		if background, _ := params["run_in_background"].(bool); background {
+			return nil, fmt.Errorf("secret references can't be used with background commands")
+		}
+
+		resolvedParams, resolved, err := resolveSecrets(vault, userID, params)
+		if err != nil {
+			return nil, err
+		}
+		if report != nil && len(resolved) > 0 {
+			unmasked := report
+			report = func(p tools.Progress) {
+				p.Message = resolved.Mask(p.Message)
+				unmasked(p)
+			}
+		}
+
+		ctx = context.WithValue(ctx, builtin.SecretMaskKey, resolved.Mask)
+		result, err := run(ctx, resolvedParams, report)
+		return maskSecrets(resolved, result, err)
+	}
+}
+
+// runWithSecrets runs a tool with the secret references in its parameters
+// resolved, masking the secrets in its result and error. Parameters are
+// passed as given if there is no vault or user.
+func runWithSecrets(vault *security.SecretVault, userID string, params map[string]interface{}, run func(map[string]interface{}) (interface{}, error)) (interface{}, error) {
+	if vault == nil || userID == "" {
+		return run(params)
+	}
+
+	resolvedParams, resolved, err := resolveSecrets(vault, userID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := run(resolvedParams)
+	return maskSecrets(resolved, result, err)
+}
+
+// resolveSecrets resolves the secret references in a tool's parameters,
+// returning the secrets it used
+func resolveSecrets(vault *security.SecretVault, userID string, params map[string]interface{}) (map[string]interface{}, security.ResolvedSecrets, error) {
+	resolved := security.ResolvedSecrets{}
+	value, err := vault.ResolveValue(userID, params, resolved)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolvedParams, _ := value.(map[string]interface{})
+	return resolvedParams, resolved, nil
+}
+
+// maskSecrets masks resolved secrets in a tool's result and error
+func maskSecrets(resolved security.ResolvedSecrets, result interface{}, err error) (interface{}, error) {
+	if err != nil {
+		if masked := resolved.Mask(err.Error()); masked != err.Error() {
+			err = errors.New(masked)
+		}
+		return nil, err
+	}
+	return resolved.MaskValue(result), nil
+}
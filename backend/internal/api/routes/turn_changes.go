@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"context"
+	"log"
+
+	"github.com/jacklau/prism/internal/api/websocket"
+	"github.com/jacklau/prism/internal/services/changes"
+	"github.com/jacklau/prism/internal/tools/builtin"
+)
+
+// withTurn tags a tool context with the assistant turn it runs in. A turn is
+// identified by the user message that started it.
+func withTurn(ctx context.Context, turnID string) context.Context {
+	if turnID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, builtin.TurnIDKey, turnID)
+}
+
+// latestTurnID returns the ID of the most recent user message in a
+// conversation, i.e. the turn a resumed tool loop belongs to
+func latestTurnID(deps *Dependencies, conversationID string) string {
+	messages, err := deps.MessageRepo.ListByConversationID(conversationID)
+	if err != nil {
+		return ""
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].ID
+		}
+	}
+	return ""
+}
+
+// sendChangesSummary sends the files changed so far during a turn to the
+// conversation's participants. Nothing is sent if no files changed.
+func sendChangesSummary(deps *Dependencies, client *websocket.Client, conversationID, turnID string) {
+	if deps.ChangeService == nil || turnID == "" {
+		return
+	}
+
+	set, err := deps.ChangeService.Summarize(client.UserID, turnID)
+	if err != nil {
+		log.Printf("Failed to summarize changes for turn %s: %v", turnID, err)
+		return
+	}
+	if len(set.Files) == 0 {
+		return
+	}
+
+	sendToParticipants(deps, client, conversationID, websocket.NewChangesSummary(conversationID, toChangeSummaryInfo(set)))
+}
+
+// toChangeSummaryInfo converts a change set to its websocket form
+func toChangeSummaryInfo(set *changes.ChangeSet) *websocket.ChangeSummaryInfo {
+	info := &websocket.ChangeSummaryInfo{
+		TurnID:    set.TurnID,
+		Files:     make([]websocket.FileChangeInfo, 0, len(set.Files)),
+		Additions: set.Additions,
+		Deletions: set.Deletions,
+	}
+	for _, file := range set.Files {
+		info.Files = append(info.Files, websocket.FileChangeInfo{
+			Path:          file.Path,
+			Status:        file.Status,
+			Diff:          file.Diff,
+			DiffTruncated: file.DiffTruncated,
+			Additions:     file.Additions,
+			Deletions:     file.Deletions,
+		})
+	}
+	return info
+}
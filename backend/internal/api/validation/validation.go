@@ -0,0 +1,235 @@
+// Package validation checks API requests against rules declared in struct
+// tags.
+//
+// Rules are given in a `validate` tag as a comma-separated list:
+//
+//	required      the value must not be empty
+//	min=N, max=N  length for strings (in characters) and slices, value for numbers
+//	oneof=a b c   the value must be one of the listed words
+//	email         the value must be an email address
+//	url           the value must be an http or https URL
+//	uuid          the value must be a UUID
+//
+// Empty values pass every rule except required. Nested structs, pointers to
+// structs and lists of structs are validated too; field names are reported by
+// their json tag, e.g. "todos[2].content".
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var emailPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+// FieldError describes a field that failed a rule
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors is the list of fields that failed validation
+type Errors []FieldError
+
+// Error returns the first failure, which is what clients that only read the
+// message will show
+func (e Errors) Error() string {
+	if len(e) == 0 {
+		return "validation failed"
+	}
+	return e[0].Message
+}
+
+// Add records a failed rule
+func (e *Errors) Add(field, rule, message string) {
+	*e = append(*e, FieldError{Field: field, Rule: rule, Message: message})
+}
+
+// Err returns the errors, or nil if there are none
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Struct validates v, which must be a struct or a pointer to one. Returns
+// Errors if any rule fails.
+func Struct(v interface{}) error {
+	var errs Errors
+	validateStruct(reflect.ValueOf(v), "", &errs)
+	return errs.Err()
+}
+
+// validateStruct checks the fields of a struct value
+func validateStruct(v reflect.Value, prefix string, errs *Errors) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := prefix + fieldName(field)
+		value := v.Field(i)
+
+		if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+			for _, rule := range strings.Split(tag, ",") {
+				rule = strings.TrimSpace(rule)
+				if message := check(value, rule); message != "" {
+					key := rule
+					if i := strings.IndexByte(rule, '='); i >= 0 {
+						key = rule[:i]
+					}
+					errs.Add(name, key, name+" "+message)
+					break
+				}
+			}
+		}
+
+		// Descend into nested structs and lists of structs
+		inner := value
+		for inner.Kind() == reflect.Ptr && !inner.IsNil() {
+			inner = inner.Elem()
+		}
+		switch inner.Kind() {
+		case reflect.Struct:
+			if inner.Type().PkgPath() != "time" {
+				validateStruct(inner, name+".", errs)
+			}
+		case reflect.Slice, reflect.Array:
+			for j := 0; j < inner.Len(); j++ {
+				validateStruct(inner.Index(j), fmt.Sprintf("%s[%d].", name, j), errs)
+			}
+		}
+	}
+}
+
+// fieldName returns the name a field has in JSON
+func fieldName(field reflect.StructField) string {
+	if tag := field.Tag.Get("json"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// check applies one rule to a value, returning why it failed or ""
+func check(v reflect.Value, rule string) string {
+	name, param := rule, ""
+	if i := strings.IndexByte(rule, '='); i >= 0 {
+		name, param = rule[:i], rule[i+1:]
+	}
+
+	if name == "required" {
+		if isEmpty(v) {
+			return "is required"
+		}
+		return ""
+	}
+	if isEmpty(v) {
+		return ""
+	}
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	switch name {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validation: invalid %s rule %q", name, rule))
+		}
+		size, unit := measure(v)
+		if (name == "min" && size >= limit) || (name == "max" && size <= limit) {
+			return ""
+		}
+		bound := "at least"
+		if name == "max" {
+			bound = "at most"
+		}
+		switch unit {
+		case "characters":
+			return fmt.Sprintf("must be %s %s characters", bound, param)
+		case "items":
+			return fmt.Sprintf("must have %s %s items", bound, param)
+		}
+		return fmt.Sprintf("must be %s %s", bound, param)
+	case "oneof":
+		options := strings.Fields(param)
+		value := fmt.Sprint(v.Interface())
+		for _, option := range options {
+			if value == option {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(options, ", ")
+	case "email":
+		// Surrounding whitespace is left for handlers to trim
+		if !emailPattern.MatchString(strings.TrimSpace(v.String())) {
+			return "must be a valid email address"
+		}
+	case "url":
+		u, err := url.Parse(v.String())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be an http or https URL"
+		}
+	case "uuid":
+		if _, err := uuid.Parse(v.String()); err != nil {
+			return "must be a valid ID"
+		}
+	default:
+		panic(fmt.Sprintf("validation: unknown rule %q", rule))
+	}
+	return ""
+}
+
+// measure returns a value's size for min and max: the length of strings and
+// collections, with its unit, or the number itself
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), "characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), "items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	return 0, ""
+}
+
+// isEmpty reports whether a value is its type's zero value, or an empty or
+// whitespace-only string
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
@@ -3,9 +3,11 @@ package websocket
 import (
 	"encoding/json"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/gofiber/contrib/websocket"
+	"github.com/jacklau/prism/internal/api/validation"
 )
 
 const (
@@ -31,6 +33,12 @@ type Client struct {
 
 	// Message handler callback
 	OnMessage func(client *Client, msg *IncomingMessage)
+
+	// Set once the hub closes Send, so work still answering the client
+	// after it disconnects drops its messages instead of panicking
+	closed bool
+	done   chan struct{} // Closed with Send
+	mu     sync.RWMutex
 }
 
 // NewClient creates a new WebSocket client
@@ -41,6 +49,7 @@ func NewClient(hub *Hub, conn *websocket.Conn, userID string, onMessage func(*Cl
 		Send:      make(chan []byte, 256),
 		UserID:    userID,
 		OnMessage: onMessage,
+		done:      make(chan struct{}),
 	}
 }
 
@@ -74,6 +83,10 @@ func (c *Client) ReadPump() {
 			c.SendMessage(NewError("parse_error", "failed to parse message"))
 			continue
 		}
+		if err := validation.Struct(&msg); err != nil {
+			c.SendMessage(NewErrorFrom(err))
+			continue
+		}
 
 		// Handle the message
 		if c.OnMessage != nil {
@@ -121,19 +134,64 @@ func (c *Client) SendMessage(msg *OutgoingMessage) {
 		log.Printf("Failed to marshal message: %v", err)
 		return
 	}
+	c.SendRaw(data)
+}
+
+// SendMessageWait sends a message to the client, waiting up to timeout for
+// room in the send buffer instead of dropping it. Returns false if the
+// buffer stayed full or the client disconnected.
+func (c *Client) SendMessageWait(msg *OutgoingMessage, timeout time.Duration) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to marshal message: %v", err)
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
 	select {
 	case c.Send <- data:
-	default:
-		log.Printf("Client buffer full, dropping message")
+		return true
+	case <-c.done:
+		return false
+	case <-timer.C:
+		return false
 	}
 }
 
 // SendRaw sends raw bytes to the client
 func (c *Client) SendRaw(data []byte) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return
+	}
+
 	select {
 	case c.Send <- data:
 	default:
 		log.Printf("Client buffer full, dropping message")
 	}
 }
+
+// Done returns a channel that is closed once the client disconnects
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// close closes the send buffer; later messages are dropped. done is closed
+// first so senders waiting for room in the buffer give up and let go of mu.
+func (c *Client) close() {
+	close(c.done)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	close(c.Send)
+}
@@ -3,7 +3,11 @@ package websocket
 import (
 	"encoding/json"
 	"log"
+	"strings"
 	"sync"
+
+	"github.com/jacklau/prism/internal/api/apierror"
+	"github.com/jacklau/prism/internal/api/validation"
 )
 
 // Hub maintains the set of active clients and broadcasts messages
@@ -17,16 +21,41 @@ type Hub struct {
 	// Unregister requests from clients
 	unregister chan *Client
 
+	// Topic subscribers keyed by user-scoped topic (see topicKey)
+	topics map[string]map[*Client]bool
+
+	// Topics each client is subscribed to, used for cleanup on unregister
+	subscriptions map[*Client]map[string]bool
+
+	// Forwards messages to other server replicas, if any
+	relay Relay
+
 	// Mutex for thread-safe operations
 	mu sync.RWMutex
 }
 
+// Relay forwards messages sent through the hub to the hubs of other server
+// replicas. Relay must not block.
+type Relay interface {
+	Relay(msg *RelayedMessage)
+}
+
+// RelayedMessage is a message sent through the hub, addressed to a user's
+// clients or a user's clients subscribed to any of the topics
+type RelayedMessage struct {
+	UserID string          `json:"user_id,omitempty"`
+	Topics []string        `json:"topics,omitempty"`
+	Data   json.RawMessage `json:"data"`
+}
+
 // NewHub creates a new Hub
 func NewHub() *Hub {
 	return &Hub{
-		clients:    make(map[string]map[*Client]bool),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+		clients:       make(map[string]map[*Client]bool),
+		register:      make(chan *Client),
+		unregister:    make(chan *Client),
+		topics:        make(map[string]map[*Client]bool),
+		subscriptions: make(map[*Client]map[string]bool),
 	}
 }
 
@@ -50,7 +79,8 @@ func (h *Hub) Run() {
 				if len(h.clients[client.UserID]) == 0 {
 					delete(h.clients, client.UserID)
 				}
-				close(client.Send)
+				h.removeSubscriptions(client)
+				client.close()
 			}
 			h.mu.Unlock()
 			log.Printf("Client unregistered: user=%s", client.UserID)
@@ -60,25 +90,198 @@ func (h *Hub) Run() {
 
 // SendToUser sends a message to all clients of a user
 func (h *Hub) SendToUser(userID string, message interface{}) {
+	h.send(&RelayedMessage{UserID: userID}, message)
+}
+
+// Subscribe subscribes a client to a topic. Topics are scoped to the
+// client's user, so two users subscribing to the same topic name never
+// see each other's messages.
+func (h *Hub) Subscribe(client *Client, topic string) {
+	h.subscribe(client, topicKey(client.UserID, topic))
+}
+
+// Unsubscribe removes a client's subscription to a topic
+func (h *Hub) Unsubscribe(client *Client, topic string) {
+	key := topicKey(client.UserID, topic)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if subscribers, ok := h.topics[key]; ok {
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(h.topics, key)
+		}
+	}
+	if keys, ok := h.subscriptions[client]; ok {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(h.subscriptions, client)
+		}
+	}
+}
+
+// Observe subscribes a read-only observer client to another user's topic, so
+// it receives what is published to that user's subscribers of the topic
+func (h *Hub) Observe(client *Client, ownerUserID, topic string) {
+	h.subscribe(client, topicKey(ownerUserID, topic))
+}
+
+// subscribe adds a client to the subscribers of a topic key
+func (h *Hub) subscribe(client *Client, key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.topics[key] == nil {
+		h.topics[key] = make(map[*Client]bool)
+	}
+	h.topics[key][client] = true
+
+	if h.subscriptions[client] == nil {
+		h.subscriptions[client] = make(map[string]bool)
+	}
+	h.subscriptions[client][key] = true
+}
+
+// IsSubscribed reports whether a client is subscribed to a topic
+func (h *Hub) IsSubscribed(client *Client, topic string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.topics[topicKey(client.UserID, topic)][client]
+}
+
+// Publish sends a message to the user's clients subscribed to any of the
+// given topics. A client subscribed to several of the topics receives the
+// message only once.
+func (h *Hub) Publish(userID string, message interface{}, topics ...string) {
+	h.send(&RelayedMessage{UserID: userID, Topics: topics}, message)
+}
+
+// send delivers a message to this server's clients and relays it to the
+// other replicas
+func (h *Hub) send(msg *RelayedMessage, message interface{}) {
 	data, err := json.Marshal(message)
 	if err != nil {
 		log.Printf("Failed to marshal message: %v", err)
 		return
 	}
+	msg.Data = data
+
+	h.Deliver(msg)
+
+	h.mu.RLock()
+	relay := h.relay
+	h.mu.RUnlock()
+	if relay != nil {
+		relay.Relay(msg)
+	}
+}
 
+// Deliver sends a message to this server's clients only. It's called for
+// messages relayed from other replicas.
+func (h *Hub) Deliver(msg *RelayedMessage) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	if clients, ok := h.clients[userID]; ok {
-		for client := range clients {
+	switch {
+	case len(msg.Topics) == 0:
+		for client := range h.clients[msg.UserID] {
 			select {
-			case client.Send <- data:
+			case client.Send <- msg.Data:
 			default:
 				// Client buffer is full, skip
-				log.Printf("Client buffer full, skipping message for user=%s", userID)
+				log.Printf("Client buffer full, skipping message for user=%s", msg.UserID)
+			}
+		}
+
+	default:
+		sent := make(map[*Client]bool)
+		for _, topic := range msg.Topics {
+			for client := range h.topics[topicKey(msg.UserID, topic)] {
+				if sent[client] {
+					continue
+				}
+				sent[client] = true
+
+				select {
+				case client.Send <- msg.Data:
+				default:
+					log.Printf("Client buffer full, skipping message for user=%s topic=%s", msg.UserID, topic)
+				}
+			}
+		}
+	}
+}
+
+// SetRelay relays every message sent through the hub to the other server
+// replicas, whose hubs deliver it to their own clients
+func (h *Hub) SetRelay(relay Relay) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.relay = relay
+}
+
+// removeSubscriptions drops every topic subscription held by a client.
+// The caller must hold h.mu.
+func (h *Hub) removeSubscriptions(client *Client) {
+	for key := range h.subscriptions[client] {
+		if subscribers, ok := h.topics[key]; ok {
+			delete(subscribers, client)
+			if len(subscribers) == 0 {
+				delete(h.topics, key)
 			}
 		}
 	}
+	delete(h.subscriptions, client)
+}
+
+// topicKey scopes a topic to a user
+func topicKey(userID, topic string) string {
+	return userID + "|" + topic
+}
+
+// Topic prefixes clients may subscribe to
+const (
+	TopicBuild     = "build"
+	TopicCode      = "code"
+	TopicExecution = "execution"
+	TopicSwarm     = "swarm"
+	TopicWorkspace = "workspace"
+)
+
+// BuildTopic returns the topic for a build's output stream
+func BuildTopic(buildID string) string {
+	return TopicBuild + ":" + buildID
+}
+
+// CodeTopic returns the topic for a streaming code run's output
+func CodeTopic(runID string) string {
+	return TopicCode + ":" + runID
+}
+
+// ExecutionTopic returns the topic for an agent execution's event stream
+func ExecutionTopic(executionID string) string {
+	return TopicExecution + ":" + executionID
+}
+
+// SwarmTopic returns the topic for a swarm's event stream
+func SwarmTopic(swarmID string) string {
+	return TopicSwarm + ":" + swarmID
+}
+
+// IsValidTopic reports whether a topic name is one clients may subscribe to.
+// Valid topics are "workspace", "build:<id>", "code:<id>", "execution:<id>"
+// and "swarm:<id>".
+func IsValidTopic(topic string) bool {
+	if topic == TopicWorkspace {
+		return true
+	}
+	prefix, id, ok := strings.Cut(topic, ":")
+	if !ok || id == "" {
+		return false
+	}
+	return prefix == TopicBuild || prefix == TopicCode || prefix == TopicExecution || prefix == TopicSwarm
 }
 
 // Register registers a client with the hub
@@ -99,12 +302,50 @@ const (
 	TypeToolStarted   = "tool.started"
 	TypeToolCompleted = "tool.completed"
 	TypeToolConfirm   = "tool.confirm"
+	TypeToolCancelled = "tool.cancelled"
+	TypeToolProgress  = "tool.progress"
 	TypeError         = "error"
 	TypeChatStop      = "chat.stop"
+	TypeChatDuplicate = "chat.duplicate" // A chat.message was retried after its first send was saved
+
+	// Topic subscription message types
+	TypeSubscribe    = "subscribe"
+	TypeUnsubscribe  = "unsubscribe"
+	TypeSubscribed   = "subscribed"
+	TypeUnsubscribed = "unsubscribed"
+
+	// Read-only observer message types
+	TypeObserverCreate = "observer.create" // Get a token to watch an execution or swarm
+	TypeObserverToken  = "observer.token"
+
+	// Per-user concurrency message types
+	TypeLimitQueued = "limit.queued" // A run waits for one of the user's others to finish
+
+	// Model comparison message types
+	TypeChatCompare          = "chat.compare"           // Send one prompt to several models at once
+	TypeChatCompareStarted   = "chat.compare_started"   // Lists the lanes answers stream in
+	TypeChatCompareCompleted = "chat.compare_completed" // Every lane has finished
+
+	// Shared conversation message types
+	TypeChatUserMessage      = "chat.user_message"      // A participant sent a message in a shared conversation
+	TypeChatAssistantMessage = "chat.assistant_message" // An agent run's output, or an answer replayed to a retried chat.message
+
+	// Conversation metadata message types
+	TypeConversationUpdated = "conversation.updated" // e.g. a title was generated
+
+	// Plan (todo list) message types
+	TypePlanUpdated = "plan.updated"
+
+	// Turn review message types
+	TypeChangesSummary = "changes.summary" // Files changed by tools during an assistant turn
+
+	// Local model management message types
+	TypeModelPullProgress = "model.pull_progress"
 
 	// Agent message types
 	TypeAgentRun             = "agent.run"
 	TypeAgentRunParallel     = "agent.run_parallel"
+	TypeAgentQueued          = "agent.queued"
 	TypeAgentStarted         = "agent.started"
 	TypeAgentThinking        = "agent.thinking"
 	TypeAgentStreamChunk     = "agent.stream_chunk"
@@ -115,6 +356,8 @@ const (
 	TypeAgentCancelled       = "agent.cancelled"
 	TypeAgentStop            = "agent.stop"
 	TypeAgentStatus          = "agent.status"
+	TypeAgentReplay          = "agent.replay"         // Re-run a finished execution against another model or config
+	TypeAgentReplayStarted   = "agent.replay_started"
 	TypeAgentList            = "agent.list"
 	TypeAgentBatchProgress   = "agent.batch_progress"
 	TypeAgentBatchCompleted  = "agent.batch_completed"
@@ -131,6 +374,13 @@ const (
 	TypeBuildCompleted  = "build.completed"
 	TypeBuildStop       = "build.stop"
 
+	// Streaming code run message types
+	TypeCodeRun       = "code.run"
+	TypeCodeStarted   = "code.started"
+	TypeCodeOutput    = "code.output"
+	TypeCodeCompleted = "code.completed"
+	TypeCodeStop      = "code.stop"
+
 	// Shell execution message types
 	TypeShellStart     = "shell.start"
 	TypeShellOutput    = "shell.output"
@@ -143,6 +393,11 @@ const (
 	TypeFileHistoryRequest = "file.history_request"
 	TypeFileHistoryList    = "file.history_list"
 	TypeFileHistoryContent = "file.history_content"
+	TypeFileHistoryDiff    = "file.history_diff"
+	TypeFileList           = "file.list"     // Request a page of a directory listing
+	TypeFileListing        = "file.listing"  // Response to file.list
+	TypeFileChunk          = "file.chunk"    // Part of a large file sent in pieces
+	TypeFileComplete       = "file.complete" // Ends a chunked file transfer
 
 	// Swarm/Multi-agent message types
 	TypeSwarmCreate          = "swarm.create"
@@ -179,57 +434,121 @@ type Attachment struct {
 
 // IncomingMessage represents a message from the client
 type IncomingMessage struct {
-	Type           string                 `json:"type"`
+	Type           string                 `json:"type" validate:"required"`
 	ConversationID string                 `json:"conversation_id,omitempty"`
-	Content        string                 `json:"content,omitempty"`
+	Content        string                 `json:"content,omitempty" validate:"max=200000"`
 	Attachments    []Attachment           `json:"attachments,omitempty"`
 	ExecutionID    string                 `json:"execution_id,omitempty"`
 	Approved       bool                   `json:"approved,omitempty"`
 	Params         map[string]interface{} `json:"params,omitempty"`
+	Topic          string                 `json:"topic,omitempty"` // For subscribe/unsubscribe
+
+	// Optimistic locking for shared conversations
+	ExpectedVersion *int64 `json:"expected_version,omitempty"`
+
+	// ID the client gave a chat.message, echoed on the turn's chat.chunk and
+	// chat.complete messages; a retry with the same ID isn't sent again
+	ClientMessageID string `json:"client_message_id,omitempty" validate:"max=255"`
+
+	// Stops one generation of the conversation with chat.stop, rather than all of them
+	GenerationID string `json:"generation_id,omitempty" validate:"max=64"`
+
+	// Makes agent.run, agent.run_parallel and build.start safe to retry: a
+	// repeat with the same key reports on the first run instead of starting another
+	IdempotencyKey string `json:"idempotency_key,omitempty" validate:"max=255"`
 
 	// Chat options
 	Mode             string       `json:"mode,omitempty"`              // plan, ask-before-edits, edit-automatically
 	ExtendedThinking bool         `json:"extended_thinking,omitempty"`
 	FileContext      *FileContext `json:"file_context,omitempty"`
 
+	// Override the conversation's provider and model for one chat.message
+	Provider string `json:"provider,omitempty" validate:"max=64"`
+	Model    string `json:"model,omitempty" validate:"max=200"`
+
+	// Provider/model pairs a chat.compare sends its prompt to
+	Models []ModelChoice `json:"models,omitempty" validate:"max=4"`
+
 	// Agent-related fields
 	AgentID     string        `json:"agent_id,omitempty"`
 	Tasks       []AgentTask   `json:"tasks,omitempty"`       // For parallel execution
 	AgentConfig *AgentConfig  `json:"agent_config,omitempty"`
 	Context     string        `json:"context,omitempty"`
 	Priority    int           `json:"priority,omitempty"`
+	Budget      *AgentBudget  `json:"budget,omitempty"`      // For agent.run; shared by all tasks for agent.run_parallel
+	ContextPack *ContextPackSpec `json:"context_pack,omitempty"` // Workspace context packed into an agent.run task's context
 
 	// Swarm/Multi-agent fields
 	SwarmID      string            `json:"swarm_id,omitempty"`
 	SwarmConfig  *SwarmConfig      `json:"swarm_config,omitempty"`
-	Strategy     string            `json:"strategy,omitempty"`     // parallel, pipeline, debate, consensus, map_reduce, specialist
-	AgentRoles   []AgentRoleConfig `json:"agent_roles,omitempty"`  // Roles for multi-agent swarm
+	Strategy     string            `json:"strategy,omitempty" validate:"oneof=parallel pipeline debate consensus map_reduce specialist"`
+	AgentRoles   []AgentRoleConfig `json:"agent_roles,omitempty" validate:"max=20"` // Roles for multi-agent swarm
 }
 
 // SwarmConfig represents configuration for a multi-agent swarm
 type SwarmConfig struct {
 	Name         string            `json:"name,omitempty"`
-	Strategy     string            `json:"strategy"`       // parallel, pipeline, debate, consensus, map_reduce, specialist
-	MaxAgents    int               `json:"max_agents,omitempty"`
-	TimeoutSecs  int               `json:"timeout_secs,omitempty"`
-	AgentRoles   []AgentRoleConfig `json:"agent_roles"`
+	Strategy     string            `json:"strategy" validate:"oneof=parallel pipeline debate consensus map_reduce specialist"`
+	MaxAgents    int               `json:"max_agents,omitempty" validate:"min=0"`
+	TimeoutSecs  int               `json:"timeout_secs,omitempty" validate:"min=0"`
+	AgentRoles   []AgentRoleConfig `json:"agent_roles" validate:"max=20"`
 	Synthesizer  *AgentConfig      `json:"synthesizer,omitempty"` // Config for result synthesizer
+
+	// Budget shared by all of the swarm's agents, unlimited if zero
+	MaxTokens int     `json:"max_tokens,omitempty" validate:"min=0"`
+	MaxCost   float64 `json:"max_cost,omitempty" validate:"min=0"` // US dollars
+
+	// Stop once every agent has finished and their outputs agree at least
+	// this much, from 0 to 1. A debate then skips its critique round.
+	ConsensusThreshold float64 `json:"consensus_threshold,omitempty" validate:"min=0,max=1"`
 }
 
 // AgentRoleConfig represents an agent with a specific role
 type AgentRoleConfig struct {
 	Role         string       `json:"role"`         // general, planner, coder, reviewer, researcher, writer, analyst, debugger, tester, synthesizer
 	Config       *AgentConfig `json:"config,omitempty"`
-	Count        int          `json:"count,omitempty"`        // Number of agents with this role
+	Count        int          `json:"count,omitempty" validate:"min=0,max=10"` // Number of agents with this role
 	SystemPrompt string       `json:"system_prompt,omitempty"` // Override default role prompt
 }
 
 // AgentTask represents a task in a batch request
 type AgentTask struct {
 	ID       string                 `json:"id,omitempty"`
-	Prompt   string                 `json:"prompt"`
+	Prompt   string                 `json:"prompt" validate:"max=200000"`
 	Context  string                 `json:"context,omitempty"`
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Budget   *AgentBudget           `json:"budget,omitempty"`
+}
+
+// AgentBudget limits the resources an agent task may consume. Zero fields
+// are unlimited.
+type AgentBudget struct {
+	MaxTokens       int `json:"max_tokens,omitempty" validate:"min=0"`
+	MaxToolCalls    int `json:"max_tool_calls,omitempty" validate:"min=0"`
+	MaxDurationSecs int `json:"max_duration_secs,omitempty" validate:"min=0"`
+}
+
+// ContextPackSpec selects workspace files to pack into a task's context:
+// those under dir matching globs, ranked by query and fit to token_budget
+type ContextPackSpec struct {
+	Dir         string   `json:"dir,omitempty" validate:"max=4096"`
+	Globs       []string `json:"globs,omitempty" validate:"max=50"`
+	Query       string   `json:"query,omitempty" validate:"max=2000"`
+	TokenBudget int      `json:"token_budget,omitempty" validate:"min=0"`
+}
+
+// ModelChoice names a provider and model to run a prompt on
+type ModelChoice struct {
+	Provider string `json:"provider" validate:"required,max=64"`
+	Model    string `json:"model" validate:"required,max=200"`
+}
+
+// CompareLane is one model's answer stream in a chat.compare. Its chunks
+// carry its message ID.
+type CompareLane struct {
+	MessageID string `json:"message_id"`
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
 }
 
 // AgentConfig represents configuration for an agent
@@ -238,9 +557,20 @@ type AgentConfig struct {
 	Provider     string   `json:"provider"`
 	Model        string   `json:"model"`
 	SystemPrompt string   `json:"system_prompt,omitempty"`
-	Temperature  float64  `json:"temperature,omitempty"`
-	MaxTokens    int      `json:"max_tokens,omitempty"`
+	Temperature  float64  `json:"temperature,omitempty" validate:"min=0,max=2"`
+	MaxTokens    int      `json:"max_tokens,omitempty" validate:"min=0"`
 	Tools        []string `json:"tools,omitempty"` // Tool names to enable
+
+	// Sampling controls; providers ignore those they don't support
+	TopP             float64  `json:"top_p,omitempty" validate:"min=0,max=1"`
+	FrequencyPenalty float64  `json:"frequency_penalty,omitempty" validate:"min=-2,max=2"`
+	PresencePenalty  float64  `json:"presence_penalty,omitempty" validate:"min=-2,max=2"`
+	Stop             []string `json:"stop,omitempty" validate:"max=4"` // Sequences that end the response
+	Seed             *int64   `json:"seed,omitempty"`
+
+	// Deterministic runs the agent as reproducibly as its provider allows:
+	// temperature 0, top_k 1 where supported and a fixed seed
+	Deterministic bool `json:"deterministic,omitempty"`
 }
 
 // OutgoingMessage represents a message to the client
@@ -257,6 +587,16 @@ type OutgoingMessage struct {
 	Status         string      `json:"status,omitempty"`
 	Code           string      `json:"code,omitempty"`
 	Message        string      `json:"message,omitempty"`
+	Topic          string      `json:"topic,omitempty"`
+	Version        int64       `json:"version,omitempty"` // Conversation version after a send
+	UserID         string      `json:"user_id,omitempty"` // Sender in shared conversations
+	Title          string      `json:"title,omitempty"`
+
+	// ID the client gave the chat.message that started the turn
+	ClientMessageID string `json:"client_message_id,omitempty"`
+
+	// Fields that failed validation, for validation_failed errors
+	Fields []validation.FieldError `json:"fields,omitempty"`
 
 	// Agent-related fields
 	AgentID       string                 `json:"agent_id,omitempty"`
@@ -269,6 +609,9 @@ type OutgoingMessage struct {
 	Duration      int64                  `json:"duration,omitempty"`     // Duration in milliseconds
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
 
+	// Answer lanes of a model comparison
+	Lanes []CompareLane `json:"lanes,omitempty"`
+
 	// Preview/Sandbox-related fields
 	URL         string     `json:"url,omitempty"`
 	Content     string     `json:"content,omitempty"`
@@ -278,6 +621,7 @@ type OutgoingMessage struct {
 	Success     bool       `json:"success,omitempty"`
 	PreviewURL  string     `json:"preview_url,omitempty"`
 	BuildID     string     `json:"build_id,omitempty"`
+	RunID       string     `json:"run_id,omitempty"` // Streaming code run
 
 	// Swarm/Multi-agent fields
 	SwarmID       string           `json:"swarm_id,omitempty"`
@@ -285,6 +629,7 @@ type OutgoingMessage struct {
 	FinalOutput   string           `json:"final_output,omitempty"`
 	SwarmAgents   []SwarmAgentInfo `json:"swarm_agents,omitempty"`
 	SwarmProgress *SwarmProgressInfo `json:"swarm_progress,omitempty"`
+	SwarmSubtasks []SwarmSubtaskInfo `json:"swarm_subtasks,omitempty"` // How a map_reduce swarm split its task
 	AgentRole     string           `json:"agent_role,omitempty"`
 	Input         string           `json:"input,omitempty"`
 
@@ -296,6 +641,95 @@ type OutgoingMessage struct {
 
 	// Iteration tracking for agentic loops
 	IterationCount int `json:"iteration_count,omitempty"`
+
+	// Plan (todo list) fields
+	Todos []TodoInfo `json:"todos,omitempty"`
+
+	// Local model management fields
+	ModelPull *ModelPullInfo `json:"model_pull,omitempty"`
+
+	// Tool execution fields
+	ToolProgress *ToolProgressInfo `json:"tool_progress,omitempty"`
+
+	// Turn review fields
+	Changes *ChangeSummaryInfo `json:"changes,omitempty"`
+
+	// Agent queue fields
+	Queue *QueueInfo `json:"queue,omitempty"`
+
+	// Read-only observer fields
+	Observer *ObserverInfo `json:"observer,omitempty"`
+
+	// Per-user concurrency fields
+	Limit *LimitInfo `json:"limit,omitempty"`
+}
+
+// LimitInfo describes a run held back by the user's concurrency limit
+type LimitInfo struct {
+	RequestType string `json:"request_type"` // The message type that asked for the run, e.g. "agent.run"
+	Kind        string `json:"kind"`         // "agents", "swarms" or "builds"
+	Limit       int    `json:"limit"`
+	Running     int    `json:"running"`
+	TimeoutMs   int64  `json:"timeout_ms"` // How long the run waits before failing with limit_reached
+}
+
+// ObserverInfo is a token that lets another connection watch a topic stream
+type ObserverInfo struct {
+	Token     string `json:"token"`
+	Topic     string `json:"topic"`
+	ExpiresAt int64  `json:"expires_at"` // Unix milliseconds
+}
+
+// QueueInfo describes an agent task waiting in the agent pool's queue
+type QueueInfo struct {
+	Position  int `json:"position"` // 1-based; 1 runs next
+	QueueSize int `json:"queue_size"`
+	Priority  int `json:"priority"` // Effective priority, raised while the task waits
+}
+
+// ChangeSummaryInfo describes the files changed during one assistant turn
+type ChangeSummaryInfo struct {
+	TurnID    string           `json:"turn_id"`
+	Files     []FileChangeInfo `json:"files"`
+	Additions int              `json:"additions"`
+	Deletions int              `json:"deletions"`
+}
+
+// FileChangeInfo describes a single changed file with its unified diff
+type FileChangeInfo struct {
+	Path          string `json:"path"`
+	Status        string `json:"status"` // created, modified, deleted, renamed
+	Diff          string `json:"diff,omitempty"`
+	DiffTruncated bool   `json:"diff_truncated,omitempty"`
+	Additions     int    `json:"additions"`
+	Deletions     int    `json:"deletions"`
+}
+
+// ToolProgressInfo is an incremental status update from a running tool
+type ToolProgressInfo struct {
+	Message string `json:"message"`
+	Current int64  `json:"current,omitempty"`
+	Total   int64  `json:"total,omitempty"`
+}
+
+// ModelPullInfo represents the progress of a local model download
+type ModelPullInfo struct {
+	PullID    string `json:"pull_id"`
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Done      bool   `json:"done"`
+}
+
+// TodoInfo represents an item in the agent's visible plan
+type TodoInfo struct {
+	ID         string `json:"id"`
+	Content    string `json:"content"`
+	ActiveForm string `json:"active_form"`
+	Status     string `json:"status"` // pending, in_progress, completed
 }
 
 // SwarmAgentInfo represents information about an agent in a swarm
@@ -309,6 +743,17 @@ type SwarmAgentInfo struct {
 	CompletedAt *int64 `json:"completed_at,omitempty"`
 }
 
+// SwarmSubtaskInfo represents a map_reduce swarm's subtask and the agent
+// that worked on it
+type SwarmSubtaskInfo struct {
+	Index       int    `json:"index"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	AgentID     string `json:"agent_id,omitempty"`
+	Success     bool   `json:"success"`
+	Error       string `json:"error,omitempty"`
+}
+
 // SwarmProgressInfo represents the progress of a swarm
 type SwarmProgressInfo struct {
 	TotalAgents     int    `json:"total_agents"`
@@ -316,6 +761,15 @@ type SwarmProgressInfo struct {
 	CompletedAgents int    `json:"completed_agents"`
 	FailedAgents    int    `json:"failed_agents"`
 	Phase           string `json:"phase"` // "initializing", "running", "synthesizing", "completed"
+
+	// Budget consumption across all of the swarm's agents
+	TokensUsed int     `json:"tokens_used"`
+	Cost       float64 `json:"cost"` // US dollars
+	ElapsedMs  int64   `json:"elapsed_ms"`
+	MaxTokens  int     `json:"max_tokens,omitempty"`
+	MaxCost    float64 `json:"max_cost,omitempty"`
+	TimeoutMs  int64   `json:"timeout_ms,omitempty"`
+	StopReason string  `json:"stop_reason,omitempty"` // Set once the swarm is stopping early: token_budget, cost_budget, or consensus
 }
 
 // FileInfo represents a file in the sandbox
@@ -327,6 +781,7 @@ type FileInfo struct {
 	Content     string     `json:"content,omitempty"`
 	Size        int64      `json:"size,omitempty"`
 	Modified    int64      `json:"modified,omitempty"`
+	Collapsed   bool       `json:"collapsed,omitempty"` // Children weren't listed; send file.list with its path to expand it
 }
 
 // AgentInfo represents information about an agent
@@ -351,6 +806,11 @@ type AgentResultInfo struct {
 	Duration    int64                  `json:"duration"` // Duration in milliseconds
 	CompletedAt int64                  `json:"completed_at"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+
+	// Resource consumption
+	TokensUsed     int    `json:"tokens_used"`
+	ToolCalls      int    `json:"tool_calls"`
+	BudgetExceeded string `json:"budget_exceeded,omitempty"` // tokens, tool_calls or duration
 }
 
 // BatchProgressInfo represents the progress of a batch execution
@@ -382,6 +842,72 @@ func NewChatComplete(conversationID, messageID, finishReason string) *OutgoingMe
 	}
 }
 
+// NewChatDuplicate creates a message answering a retried chat.message. It
+// carries the ID the first send was saved with; status is "generating" while
+// the answer to it is still being streamed, otherwise "completed".
+func NewChatDuplicate(conversationID, messageID, clientMessageID, status string) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:            TypeChatDuplicate,
+		ConversationID:  conversationID,
+		MessageID:       messageID,
+		ClientMessageID: clientMessageID,
+		Status:          status,
+	}
+}
+
+// NewChatUserMessage creates a message notifying participants of a shared
+// conversation that another user sent a message
+func NewChatUserMessage(conversationID, messageID, userID, content string, version int64) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:           TypeChatUserMessage,
+		ConversationID: conversationID,
+		MessageID:      messageID,
+		UserID:         userID,
+		Content:        content,
+		Version:        version,
+	}
+}
+
+// NewChatAssistantMessage creates a message announcing an assistant message
+// that was added to a conversation outside of a streamed chat response
+func NewChatAssistantMessage(conversationID, messageID, content string) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:           TypeChatAssistantMessage,
+		ConversationID: conversationID,
+		MessageID:      messageID,
+		Content:        content,
+	}
+}
+
+// NewChatCompareStarted creates a message listing the lanes of a model
+// comparison, sent before any lane streams
+func NewChatCompareStarted(conversationID, compareID string, lanes []CompareLane) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:           TypeChatCompareStarted,
+		ConversationID: conversationID,
+		Metadata:       map[string]interface{}{"compare_id": compareID},
+		Lanes:          lanes,
+	}
+}
+
+// NewChatCompareCompleted creates a message marking the end of a model comparison
+func NewChatCompareCompleted(conversationID, compareID string) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:           TypeChatCompareCompleted,
+		ConversationID: conversationID,
+		Metadata:       map[string]interface{}{"compare_id": compareID},
+	}
+}
+
+// NewConversationUpdated creates a message announcing a conversation's new title
+func NewConversationUpdated(conversationID, title string) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:           TypeConversationUpdated,
+		ConversationID: conversationID,
+		Title:          title,
+	}
+}
+
 // NewToolStarted creates a new tool started message
 func NewToolStarted(conversationID, executionID, toolName string, parameters interface{}) *OutgoingMessage {
 	return &OutgoingMessage{
@@ -404,6 +930,38 @@ func NewToolCompleted(conversationID, executionID string, result interface{}, st
 	}
 }
 
+// NewToolCancelled creates a message for a tool execution cancelled before it finished
+func NewToolCancelled(conversationID, executionID, toolName, reason string) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:           TypeToolCancelled,
+		ConversationID: conversationID,
+		ExecutionID:    executionID,
+		ToolName:       toolName,
+		Status:         "cancelled",
+		Message:        reason,
+	}
+}
+
+// NewToolProgress creates a message with a running tool's latest progress
+func NewToolProgress(conversationID, executionID, toolName string, info *ToolProgressInfo) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:           TypeToolProgress,
+		ConversationID: conversationID,
+		ExecutionID:    executionID,
+		ToolName:       toolName,
+		ToolProgress:   info,
+	}
+}
+
+// NewChangesSummary creates a message summarizing the files changed during a turn
+func NewChangesSummary(conversationID string, info *ChangeSummaryInfo) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:           TypeChangesSummary,
+		ConversationID: conversationID,
+		Changes:        info,
+	}
+}
+
 // NewError creates a new error message
 func NewError(code, message string) *OutgoingMessage {
 	return &OutgoingMessage{
@@ -414,6 +972,60 @@ func NewError(code, message string) *OutgoingMessage {
 	}
 }
 
+// NewErrorFrom creates an error message from an API or validation error,
+// using the same code and fields as the REST error envelope
+func NewErrorFrom(err error) *OutgoingMessage {
+	_, resp := apierror.From(err)
+	msg := NewError(resp.Code, resp.Error)
+	msg.Fields = resp.Fields
+	return msg
+}
+
+// NewSubscribed creates a subscription acknowledgement message
+func NewSubscribed(topic string) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:  TypeSubscribed,
+		Topic: topic,
+	}
+}
+
+// NewObserverToken creates a message handing out an observer token
+func NewObserverToken(info *ObserverInfo) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:     TypeObserverToken,
+		Topic:    info.Topic,
+		Observer: info,
+	}
+}
+
+// NewLimitQueued creates a message saying a run is waiting for a slot
+func NewLimitQueued(info *LimitInfo) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:   TypeLimitQueued,
+		Status: "queued",
+		Limit:  info,
+	}
+}
+
+// NewUnsubscribed creates an unsubscription acknowledgement message
+func NewUnsubscribed(topic string) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:  TypeUnsubscribed,
+		Topic: topic,
+	}
+}
+
+// NewAgentQueued creates a new agent queued message
+func NewAgentQueued(agentID, taskID string, queue *QueueInfo) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:    TypeAgentQueued,
+		AgentID: agentID,
+		TaskID:  taskID,
+		Status:  "queued",
+		Queue:   queue,
+	}
+}
+
 // NewAgentStarted creates a new agent started message
 func NewAgentStarted(agentID, taskID string) *OutgoingMessage {
 	return &OutgoingMessage{
@@ -586,6 +1198,42 @@ func NewBuildCompleted(buildID string, success bool, previewURL string, duration
 	}
 }
 
+// Streaming code run message constructors
+
+// NewCodeStarted creates a new code run started message
+func NewCodeStarted(runID, environment string) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:    TypeCodeStarted,
+		RunID:   runID,
+		Content: environment,
+		Status:  "running",
+	}
+}
+
+// NewCodeOutput creates a new code run output message
+func NewCodeOutput(runID, content, stream string) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:    TypeCodeOutput,
+		RunID:   runID,
+		Content: content,
+		Stream:  stream,
+	}
+}
+
+// NewCodeCompleted creates a new code run completed message. Status is
+// "success", "error" or "cancelled"; result carries the exit code and the
+// complete output.
+func NewCodeCompleted(runID, status string, result interface{}, durationMs int64) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:     TypeCodeCompleted,
+		RunID:    runID,
+		Status:   status,
+		Success:  status == "success",
+		Result:   result,
+		Duration: durationMs,
+	}
+}
+
 // Shell command message constructors
 
 // NewShellStarted creates a new shell command started message
@@ -644,6 +1292,18 @@ func NewFilesUpdated(files []FileInfo) *OutgoingMessage {
 	}
 }
 
+// NewFileListing creates a file listing message. Metadata carries the root,
+// the total number of entries in the directory and the offset of the next
+// page, if any.
+func NewFileListing(dirPath string, files []FileInfo, metadata map[string]interface{}) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:     TypeFileListing,
+		FilePath: dirPath,
+		Files:    files,
+		Metadata: metadata,
+	}
+}
+
 // NewFileContent creates a new file content message
 func NewFileContent(filePath, content string) *OutgoingMessage {
 	return &OutgoingMessage{
@@ -653,6 +1313,25 @@ func NewFileContent(filePath, content string) *OutgoingMessage {
 	}
 }
 
+// NewFileChunk creates a message carrying part of a chunked file transfer
+func NewFileChunk(filePath, content string, metadata map[string]interface{}) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:     TypeFileChunk,
+		FilePath: filePath,
+		Content:  content,
+		Metadata: metadata,
+	}
+}
+
+// NewFileComplete creates a message marking the end of a chunked file transfer
+func NewFileComplete(filePath string, metadata map[string]interface{}) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:     TypeFileComplete,
+		FilePath: filePath,
+		Metadata: metadata,
+	}
+}
+
 // Swarm/Multi-agent message constructors
 
 // NewSwarmStarted creates a new swarm started message
@@ -781,6 +1460,21 @@ func NewSwarmList(swarms []SwarmAgentInfo) *OutgoingMessage {
 	}
 }
 
+// NewPlanUpdated creates a plan updated message carrying the full todo list
+func NewPlanUpdated(workspacePath string, todos []TodoInfo) *OutgoingMessage {
+	if todos == nil {
+		todos = []TodoInfo{}
+	}
+	return &OutgoingMessage{
+		Type:     TypePlanUpdated,
+		FilePath: workspacePath,
+		Todos:    todos,
+		Metadata: map[string]interface{}{
+			"count": len(todos),
+		},
+	}
+}
+
 // FileHistoryEntry represents a file history entry for WebSocket messages
 type FileHistoryEntry struct {
 	ID        string `json:"id"`
@@ -815,3 +1509,37 @@ func NewFileHistoryContent(historyID, filePath, content, operation, createdAt st
 		},
 	}
 }
+
+// NewFileHistoryDiff creates a message with a unified diff between a file
+// history entry and the version it was compared against
+func NewFileHistoryDiff(historyID, filePath, against, againstID, patch string, additions, deletions int, truncated bool) *OutgoingMessage {
+	metadata := map[string]interface{}{
+		"history_id": historyID,
+		"against":    against,
+		"additions":  additions,
+		"deletions":  deletions,
+	}
+	if againstID != "" {
+		metadata["against_id"] = againstID
+	}
+	if truncated {
+		metadata["diff_truncated"] = true
+	}
+	return &OutgoingMessage{
+		Type:     TypeFileHistoryDiff,
+		FilePath: filePath,
+		Content:  patch,
+		Metadata: metadata,
+	}
+}
+
+// NewModelPullProgress creates a model pull progress message
+func NewModelPullProgress(info *ModelPullInfo, errMsg string) *OutgoingMessage {
+	return &OutgoingMessage{
+		Type:      TypeModelPullProgress,
+		Status:    info.Status,
+		ModelPull: info,
+		Success:   info.Done && errMsg == "",
+		Error:     errMsg,
+	}
+}
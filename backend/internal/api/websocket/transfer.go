@@ -0,0 +1,116 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// fileChunkSize is the most file content sent in one file.chunk message
+	fileChunkSize = 256 * 1024
+
+	// compressMinSize is the smallest file worth gzipping for a client that
+	// accepts compressed chunks
+	compressMinSize = 64 * 1024
+)
+
+// FileTransferOptions controls how SendFile delivers a file
+type FileTransferOptions struct {
+	Chunked  bool   // Client accepts file.chunk messages for large files
+	Compress bool   // Client accepts gzip-compressed chunks
+	Offset   int    // Byte offset to start from, to resume a transfer
+	Hash     string // Content hash reported in file.complete
+}
+
+// SendFile sends a file's content to the client. Files up to one chunk, or
+// any file for a client that doesn't accept chunks, go in a single
+// file.content message. Larger files are split into file.chunk messages,
+// each holding the content from its byte offset, and end with a
+// file.complete message. Chunks wait for room in the send buffer rather
+// than being dropped, so they arrive in order and none go missing.
+func (c *Client) SendFile(filePath, content string, opts FileTransferOptions) error {
+	if opts.Offset < 0 || opts.Offset > len(content) {
+		return fmt.Errorf("offset %d is outside the file (%d bytes)", opts.Offset, len(content))
+	}
+	if opts.Offset < len(content) && !utf8.RuneStart(content[opts.Offset]) {
+		return fmt.Errorf("offset %d is inside a multi-byte character", opts.Offset)
+	}
+
+	if !opts.Chunked || (opts.Offset == 0 && len(content) <= fileChunkSize) {
+		c.SendMessage(NewFileContent(filePath, content))
+		return nil
+	}
+
+	encoding := ""
+	if opts.Compress && len(content)-opts.Offset >= compressMinSize {
+		encoding = "gzip"
+	}
+
+	transferID := uuid.New().String()
+	chunks := 0
+	for offset := opts.Offset; offset < len(content); chunks++ {
+		end := offset + fileChunkSize
+		if end >= len(content) {
+			end = len(content)
+		} else {
+			// Keep multi-byte characters whole so each chunk is valid text
+			for end > offset+1 && !utf8.RuneStart(content[end]) {
+				end--
+			}
+		}
+
+		data := content[offset:end]
+		if encoding == "gzip" {
+			compressed, err := gzipBase64(data)
+			if err != nil {
+				return err
+			}
+			data = compressed
+		}
+
+		metadata := map[string]interface{}{
+			"transfer_id": transferID,
+			"offset":      offset,
+			"length":      end - offset,
+			"size":        len(content),
+		}
+		if encoding != "" {
+			metadata["encoding"] = encoding
+		}
+		if !c.SendMessageWait(NewFileChunk(filePath, data, metadata), writeWait) {
+			return fmt.Errorf("client is not reading; file transfer aborted")
+		}
+		offset = end
+	}
+
+	complete := map[string]interface{}{
+		"transfer_id": transferID,
+		"size":        len(content),
+		"chunks":      chunks,
+	}
+	if opts.Hash != "" {
+		complete["hash"] = opts.Hash
+	}
+	if !c.SendMessageWait(NewFileComplete(filePath, complete), writeWait) {
+		return fmt.Errorf("client is not reading; file transfer aborted")
+	}
+	return nil
+}
+
+// gzipBase64 compresses text and encodes it for a JSON string field
+func gzipBase64(text string) (string, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(text)); err != nil {
+		return "", fmt.Errorf("failed to compress file chunk: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress file chunk: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
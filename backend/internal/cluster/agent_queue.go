@@ -0,0 +1,147 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jacklau/prism/internal/agent"
+)
+
+// leaseTTL is how long an offered or running task keeps its place without
+// being renewed. Pools renew them every second, so only tasks of replicas
+// that died or lost Redis expire.
+const leaseTTL = 15 * time.Second
+
+// strictPriority is the score step between priorities when tasks don't age,
+// longer than any task could wait
+const strictPriority = int64(100 * 365 * 24 * time.Hour / time.Millisecond)
+
+// admitScript adds offered tasks to the shared queue and admits those within
+// the first free slots of the cluster.
+//
+// KEYS: queue (task -> score), offer leases (task -> expiry), running
+// leases (task -> expiry)
+// ARGV: now, lease TTL, limit, then pairs of task ID and score
+const admitScript = `
+local now = tonumber(ARGV[1])
+local expires = now + tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+-- Forget tasks whose replicas stopped renewing them
+for _, id in ipairs(redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now)) do
+	redis.call('ZREM', KEYS[1], id)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', now)
+redis.call('ZREMRANGEBYSCORE', KEYS[3], '-inf', now)
+
+for i = 4, #ARGV, 2 do
+	redis.call('ZADD', KEYS[1], ARGV[i + 1], ARGV[i])
+	redis.call('ZADD', KEYS[2], expires, ARGV[i])
+end
+
+local admitted = {}
+local free = limit - redis.call('ZCARD', KEYS[3])
+for i = 4, #ARGV, 2 do
+	local id = ARGV[i]
+	local rank = redis.call('ZRANK', KEYS[1], id)
+	if rank and rank < free then
+		redis.call('ZREM', KEYS[1], id)
+		redis.call('ZREM', KEYS[2], id)
+		redis.call('ZADD', KEYS[3], expires, id)
+		free = free - 1
+		table.insert(admitted, id)
+	end
+end
+return admitted
+`
+
+// AgentQueue is an agent.SharedQueue kept in Redis. Each pool offers the
+// tasks it has free workers for; a task starts once it's among the first
+// tasks of the cluster-wide queue that fit within the limit. Replicas whose
+// workers are all busy offer nothing, so they never hold up the others.
+type AgentQueue struct {
+	cluster *Cluster
+	limit   int
+	aging   time.Duration
+}
+
+// AgentQueue returns a shared queue letting at most limit agent tasks run
+// across the cluster. Waiting tasks are ordered by priority, with a task
+// counting one priority higher for each aging interval it has waited,
+// approximating how each pool orders its own queue.
+func (c *Cluster) AgentQueue(limit int, aging time.Duration) *AgentQueue {
+	if limit < 1 {
+		limit = 1
+	}
+	return &AgentQueue{cluster: c, limit: limit, aging: aging}
+}
+
+// score returns a task's place in the queue; lower scores start first
+func (q *AgentQueue) score(task agent.QueuedTask) int64 {
+	step := strictPriority
+	if q.aging > 0 {
+		step = int64(q.aging / time.Millisecond)
+	}
+	return task.QueuedAt.UnixNano()/int64(time.Millisecond) - int64(task.Priority)*step
+}
+
+func (q *AgentQueue) Admit(ctx context.Context, offers []agent.QueuedTask) ([]string, error) {
+	args := []string{
+		"EVAL", admitScript, "3",
+		q.cluster.key("agents:queue"), q.cluster.key("agents:offers"), q.cluster.key("agents:running"),
+		strconv.FormatInt(nowMillis(), 10),
+		strconv.FormatInt(int64(leaseTTL/time.Millisecond), 10),
+		strconv.Itoa(q.limit),
+	}
+	for _, offer := range offers {
+		args = append(args, offer.ID, strconv.FormatInt(q.score(offer), 10))
+	}
+
+	reply, err := q.cluster.redis.Do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok && reply != nil {
+		return nil, fmt.Errorf("unexpected reply %v from admit script", reply)
+	}
+	admitted := make([]string, 0, len(items))
+	for _, item := range items {
+		if id, ok := item.(string); ok {
+			admitted = append(admitted, id)
+		}
+	}
+	return admitted, nil
+}
+
+func (q *AgentQueue) Withdraw(ctx context.Context, taskIDs []string) error {
+	if len(taskIDs) == 0 {
+		return nil
+	}
+	for _, key := range []string{q.cluster.key("agents:queue"), q.cluster.key("agents:offers")} {
+		if _, err := q.cluster.redis.Do(ctx, append([]string{"ZREM", key}, taskIDs...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *AgentQueue) Refresh(ctx context.Context, taskIDs []string) error {
+	if len(taskIDs) == 0 {
+		return nil
+	}
+	expires := strconv.FormatInt(nowMillis()+int64(leaseTTL/time.Millisecond), 10)
+	args := []string{"ZADD", q.cluster.key("agents:running")}
+	for _, id := range taskIDs {
+		args = append(args, expires, id)
+	}
+	_, err := q.cluster.redis.Do(ctx, args...)
+	return err
+}
+
+func (q *AgentQueue) Release(ctx context.Context, taskID string) error {
+	_, err := q.cluster.redis.Do(ctx, "ZREM", q.cluster.key("agents:running"), taskID)
+	return err
+}
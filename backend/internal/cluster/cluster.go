@@ -0,0 +1,219 @@
+// Package cluster lets several Prism servers run as replicas behind a load
+// balancer by sharing state through Redis. Messages sent through each
+// replica's websocket hub are relayed to the others, so they reach users
+// whichever replica holds their connection; stop requests reach the replica
+// running a generation; and agent tasks can wait in one cluster-wide queue
+// (see AgentQueue).
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/api/websocket"
+)
+
+// outboxSize is how many relayed hub messages may wait to be published
+// before new ones are dropped
+const outboxSize = 4096
+
+// Config holds configuration for joining a cluster
+type Config struct {
+	RedisURL string // redis://[[user]:password@]host[:port][/db], or rediss:// for TLS
+	// Prefix namespaces keys and channels, so several deployments can share
+	// one Redis
+	Prefix string
+}
+
+// envelope is a message published to the other replicas
+type envelope struct {
+	Node string `json:"node"`
+
+	// Exactly one of these is set
+	Hub  *websocket.RelayedMessage `json:"hub,omitempty"`
+	Stop *StopRequest              `json:"stop,omitempty"`
+}
+
+// StopRequest asks the replicas to stop a conversation's generations
+type StopRequest struct {
+	ConversationID string `json:"conversation_id"`
+	// GenerationID stops just that generation and those it started; without
+	// it every generation of the conversation is stopped
+	GenerationID string `json:"generation_id,omitempty"`
+}
+
+// Cluster connects this server to the other replicas
+type Cluster struct {
+	redis  *redisClient
+	nodeID string
+	prefix string
+
+	hub          *websocket.Hub
+	onGeneration func(req *StopRequest)
+	mu           sync.RWMutex
+
+	outbox chan []byte
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New connects to Redis and returns this server's handle on the cluster.
+// Call Start to begin exchanging messages with the other replicas.
+func New(config Config) (*Cluster, error) {
+	opts, err := parseRedisURL(config.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(config.Prefix, ":")
+	if prefix == "" {
+		prefix = "prism"
+	}
+
+	c := &Cluster{
+		redis:  newRedisClient(opts),
+		nodeID: uuid.New().String(),
+		prefix: prefix,
+		outbox: make(chan []byte, outboxSize),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if _, err := c.redis.Do(ctx, "PING"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NodeID returns the ID this server is known by in the cluster
+func (c *Cluster) NodeID() string {
+	return c.nodeID
+}
+
+// key returns a namespaced Redis key or channel name
+func (c *Cluster) key(name string) string {
+	return c.prefix + ":" + name
+}
+
+// Start subscribes to the other replicas' messages and begins relaying
+// this server's
+func (c *Cluster) Start() {
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	c.wg.Add(2)
+	go func() {
+		defer c.wg.Done()
+		c.redis.Subscribe(c.ctx, []string{c.key("hub"), c.key("generations")}, c.receive)
+	}()
+	go func() {
+		defer c.wg.Done()
+		c.publishOutbox()
+	}()
+}
+
+// Stop stops exchanging messages and closes the Redis connections
+func (c *Cluster) Stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	c.wg.Wait()
+	c.redis.Close()
+}
+
+// AttachHub relays the hub's messages to the other replicas and delivers
+// theirs to the hub's clients
+func (c *Cluster) AttachHub(hub *websocket.Hub) {
+	c.mu.Lock()
+	c.hub = hub
+	c.mu.Unlock()
+	hub.SetRelay(c)
+}
+
+// Relay queues a hub message for the other replicas. It never blocks; if
+// Redis can't keep up, the message is dropped.
+func (c *Cluster) Relay(msg *websocket.RelayedMessage) {
+	data, err := json.Marshal(envelope{Node: c.nodeID, Hub: msg})
+	if err != nil {
+		log.Printf("Failed to marshal relayed message: %v", err)
+		return
+	}
+	select {
+	case c.outbox <- data:
+	default:
+		log.Printf("Cluster outbox full, dropping relayed message for user=%s", msg.UserID)
+	}
+}
+
+// publishOutbox publishes relayed hub messages in the order they were sent
+func (c *Cluster) publishOutbox() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case data := <-c.outbox:
+			ctx, cancel := context.WithTimeout(c.ctx, redisTimeout)
+			if _, err := c.redis.Do(ctx, "PUBLISH", c.key("hub"), string(data)); err != nil && c.ctx.Err() == nil {
+				log.Printf("Failed to relay message to other replicas: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// OnStopGeneration registers the function that stops this server's
+// generations when another replica is asked to stop them
+func (c *Cluster) OnStopGeneration(fn func(req *StopRequest)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onGeneration = fn
+}
+
+// StopGeneration asks the other replicas to stop generations they're
+// running. The caller has checked the requester may stop them.
+func (c *Cluster) StopGeneration(ctx context.Context, req *StopRequest) error {
+	data, err := json.Marshal(envelope{Node: c.nodeID, Stop: req})
+	if err != nil {
+		return fmt.Errorf("failed to marshal stop request: %w", err)
+	}
+	if _, err := c.redis.Do(ctx, "PUBLISH", c.key("generations"), string(data)); err != nil {
+		return fmt.Errorf("failed to publish stop request: %w", err)
+	}
+	return nil
+}
+
+// receive handles a message published by a replica
+func (c *Cluster) receive(channel string, payload []byte) {
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		log.Printf("Failed to decode cluster message on %s: %v", channel, err)
+		return
+	}
+	if env.Node == c.nodeID {
+		return
+	}
+
+	c.mu.RLock()
+	hub, onGeneration := c.hub, c.onGeneration
+	c.mu.RUnlock()
+
+	switch {
+	case env.Hub != nil && hub != nil:
+		hub.Deliver(env.Hub)
+	case env.Stop != nil && env.Stop.ConversationID != "" && onGeneration != nil:
+		onGeneration(env.Stop)
+	}
+}
+
+// nowMillis returns the current time in Unix milliseconds. Leases are
+// compared against each replica's clock, so clocks are assumed to agree to
+// within a few seconds.
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
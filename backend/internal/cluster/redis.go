@@ -0,0 +1,360 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// redisTimeout bounds a single command when the context has no deadline
+	redisTimeout = 10 * time.Second
+
+	// maxIdleConns is how many connections are kept open between commands
+	maxIdleConns = 8
+)
+
+// RedisError is an error reply from the Redis server
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisOptions holds connection settings parsed from a redis:// URL
+type redisOptions struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      bool
+}
+
+// parseRedisURL parses redis://[[user]:password@]host[:port][/db], or
+// rediss:// for TLS
+func parseRedisURL(raw string) (*redisOptions, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("invalid redis URL scheme %q (use redis or rediss)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("redis URL has no host")
+	}
+
+	opts := &redisOptions{addr: u.Host, tls: u.Scheme == "rediss"}
+	if u.Port() == "" {
+		opts.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		opts.username = u.User.Username()
+		opts.password, _ = u.User.Password()
+		// redis://:password@host carries only a password
+		if _, hasPassword := u.User.Password(); !hasPassword {
+			opts.password, opts.username = opts.username, ""
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if opts.db, err = strconv.Atoi(db); err != nil || opts.db < 0 {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+	return opts, nil
+}
+
+// redisConn is a connection speaking RESP2
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// redisClient is a minimal Redis client covering the commands the cluster
+// uses. Connections are pooled; a connection that fails is discarded.
+type redisClient struct {
+	opts *redisOptions
+
+	idle []*redisConn
+	mu   sync.Mutex
+}
+
+func newRedisClient(opts *redisOptions) *redisClient {
+	return &redisClient{opts: opts}
+}
+
+// dial opens and authenticates a connection
+func (c *redisClient) dial(ctx context.Context) (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: redisTimeout, KeepAlive: 15 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", c.opts.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	if c.opts.tls {
+		host, _, _ := net.SplitHostPort(c.opts.addr)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to connect to redis: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	rc := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	setDeadline(ctx, conn)
+	if c.opts.password != "" {
+		args := []string{"AUTH", c.opts.password}
+		if c.opts.username != "" {
+			args = []string{"AUTH", c.opts.username, c.opts.password}
+		}
+		if _, err := rc.do(args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to authenticate with redis: %w", err)
+		}
+	}
+	if c.opts.db != 0 {
+		if _, err := rc.do("SELECT", strconv.Itoa(c.opts.db)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to select redis database: %w", err)
+		}
+	}
+	return rc, nil
+}
+
+// setDeadline applies the context's deadline, or the default timeout, to
+// the next reads and writes on a connection
+func setDeadline(ctx context.Context, conn net.Conn) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	conn.SetDeadline(deadline)
+}
+
+// Do sends a command and returns its reply: a string, an int64, nil, or a
+// []interface{} of those. Error replies are returned as RedisError.
+func (c *redisClient) Do(ctx context.Context, args ...string) (interface{}, error) {
+	c.mu.Lock()
+	var rc *redisConn
+	if n := len(c.idle); n > 0 {
+		rc = c.idle[n-1]
+		c.idle = c.idle[:n-1]
+	}
+	c.mu.Unlock()
+
+	reply, err := c.doOn(ctx, rc, args)
+	// An idle connection the server has since closed fails straight away;
+	// try once more on a new one
+	if rc != nil && (errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)) {
+		reply, err = c.doOn(ctx, nil, args)
+	}
+	if err != nil {
+		var redisErr RedisError
+		if !errors.As(err, &redisErr) {
+			return nil, fmt.Errorf("redis %s failed: %w", args[0], err)
+		}
+	}
+	return reply, err
+}
+
+// doOn sends a command on a connection, or a new one if rc is nil, and
+// returns the connection to the pool unless it failed
+func (c *redisClient) doOn(ctx context.Context, rc *redisConn, args []string) (interface{}, error) {
+	if rc == nil {
+		var err error
+		if rc, err = c.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	setDeadline(ctx, rc.conn)
+	reply, err := rc.do(args...)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		rc.conn.Close()
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if len(c.idle) < maxIdleConns {
+		c.idle = append(c.idle, rc)
+		rc = nil
+	}
+	c.mu.Unlock()
+	if rc != nil {
+		rc.conn.Close()
+	}
+	return reply, err
+}
+
+// Close closes the idle connections
+func (c *redisClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rc := range c.idle {
+		rc.conn.Close()
+	}
+	c.idle = nil
+}
+
+// Subscribe delivers messages published to the channels until the context
+// is cancelled, reconnecting with a backoff whenever the connection drops
+func (c *redisClient) Subscribe(ctx context.Context, channels []string, handler func(channel string, payload []byte)) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		connected, err := c.subscribe(ctx, channels, handler)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = time.Second
+		}
+		log.Printf("Redis subscription lost, reconnecting in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// subscribe runs one subscription connection until it fails, reporting
+// whether the subscription was established
+func (c *redisClient) subscribe(ctx context.Context, channels []string, handler func(channel string, payload []byte)) (bool, error) {
+	rc, err := c.dial(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer rc.conn.Close()
+
+	// Unblock the read below once the context is cancelled
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			rc.conn.Close()
+		case <-stop:
+		}
+	}()
+
+	setDeadline(ctx, rc.conn)
+	if err := rc.write(append([]string{"SUBSCRIBE"}, channels...)); err != nil {
+		return false, err
+	}
+	for range channels {
+		if _, err := rc.read(); err != nil {
+			return false, err
+		}
+	}
+
+	// Published messages arrive whenever they're sent; dead connections are
+	// detected by TCP keepalives
+	rc.conn.SetDeadline(time.Time{})
+	for {
+		reply, err := rc.read()
+		if err != nil {
+			return true, err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 || parts[0] != "message" {
+			continue
+		}
+		channel, _ := parts[1].(string)
+		payload, _ := parts[2].(string)
+		handler(channel, []byte(payload))
+	}
+}
+
+// do writes a command and reads its reply
+func (rc *redisConn) do(args ...string) (interface{}, error) {
+	if err := rc.write(args); err != nil {
+		return nil, err
+	}
+	return rc.read()
+}
+
+// write sends a command as an array of bulk strings
+func (rc *redisConn) write(args []string) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(rc.conn, sb.String())
+	return err
+}
+
+// read reads one reply
+func (rc *redisConn) read() (interface{}, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, RedisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed redis reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed redis reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		var redisErr error
+		for i := range items {
+			item, err := rc.read()
+			var itemErr RedisError
+			if errors.As(err, &itemErr) {
+				// Errors inside arrays (e.g. from EXEC) don't end the reply
+				redisErr = err
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, redisErr
+	}
+	return nil, fmt.Errorf("unexpected redis reply %q", line)
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -18,6 +19,10 @@ type Config struct {
 	BaseURL     string
 	FrontendURL string
 
+	// Frontend Hosting
+	ServeFrontend bool
+	FrontendDir   string
+
 	// Database
 	DatabaseURL string
 
@@ -27,6 +32,9 @@ type Config struct {
 	JWTAccessExpiry   time.Duration
 	JWTRefreshExpiry  time.Duration
 
+	// Users allowed to use the /admin endpoints, by email
+	AdminEmails []string
+
 	// GitHub OAuth
 	GitHubClientID     string
 	GitHubClientSecret string
@@ -35,16 +43,43 @@ type Config struct {
 	// Ollama
 	OllamaHost string
 
+	// How long provider key checks are remembered
+	ProviderKeyCheckTTL time.Duration
+
+	// Allow provider base URLs on loopback and private networks
+	ProviderBaseURLAllowPrivate bool
+
+	// How long provider model lists are cached
+	ModelCacheTTL time.Duration
+
 	// Sandbox
 	SandboxMemoryLimit string
 	SandboxCPULimit    string
 	SandboxTimeout     time.Duration
 	SandboxPreviewURL  string
+	SandboxShowHidden  bool // List and search dotfiles in workspaces; .gitignore/.prismignore rules still apply
+
+	// Build artifacts
+	SandboxArtifactPaths    []string // Globs, relative to the workspace, of files kept from successful builds
+	SandboxArtifactMaxBytes int64    // Most artifact bytes kept per build
+
+	// Shell tools
+	ShellAllowedCommands []string // Commands the shell tools may run; empty uses the built-in list
+	ShellDeniedCommands  []string // Commands the shell tools never run, even if allowed
+	ShellMaxOutputBytes  int      // Most stdout and stderr bytes kept per command
 
 	// Rate Limiting
 	RateLimitRequestsPerMinute int
 	RateLimitBurst             int
 
+	// Sliding-window limits on brute-forceable and expensive actions; 0 disables.
+	// Auth limits are per IP, chat, agent and tool limits per user.
+	RateLimitLoginPerMinute    int
+	RateLimitRegisterPerMinute int
+	RateLimitChatPerMinute     int
+	RateLimitAgentPerMinute    int
+	RateLimitToolPerMinute     int // Tool calls, agents' included; off by default
+
 	// CORS
 	CORSAllowedOrigins string
 
@@ -52,37 +87,295 @@ type Config struct {
 	UploadMaxSize int64
 	UploadDir     string
 
+	// Object storage for build artifacts and checkpoint backups
+	StorageBackend    string // local or s3
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3Prefix          string
+	S3ForcePathStyle  bool
+
 	// Discord Integration
 	DiscordEnabled    bool
 	DiscordWebhookURL string
 	DiscordBotToken   string
 
+	// Discord Bot (gateway connection for /prism commands)
+	DiscordBotEnabled  bool
+	DiscordBotProvider string
+	DiscordBotModel    string
+
 	// Slack Integration
 	SlackEnabled    bool
 	SlackWebhookURL string
 	SlackBotToken   string
 	SlackChannelID  string
 
+	// Slack Bot (slash commands)
+	SlackSigningSecret string
+	SlackBotProvider   string
+	SlackBotModel      string
+
+	// Matrix Integration
+	MatrixEnabled       bool
+	MatrixHomeserverURL string
+	MatrixAccessToken   string
+	MatrixRoomID        string
+
+	// Mattermost Integration
+	MattermostEnabled    bool
+	MattermostWebhookURL string
+	MattermostChannel    string
+	MattermostUsername   string
+
+	// Linear Integration (per-user API keys, issue webhooks and triggers)
+	LinearEnabled      bool
+	LinearProvider     string
+	LinearModel        string
+	LinearAgentTimeout time.Duration
+
+	// Documentation sources (per-user Notion and Confluence credentials)
+	DocSourcesEnabled     bool
+	DocSourceMaxPageChars int
+
 	// PostHog Analytics
 	PostHogEnabled       bool
 	PostHogAPIKey        string
 	PostHogEndpoint      string
 	PostHogBatchSize     int
 	PostHogFlushInterval time.Duration
+	PostHogTrackFeedback bool // Forward message ratings (without comments)
+
+	// How long the integrations manager caches a user's Discord, Slack and
+	// PostHog settings; changes made through the API apply right away
+	IntegrationSettingsCacheTTL time.Duration
+
+	// Email (SMTP) Notifications
+	SMTPEnabled     bool
+	SMTPHost        string
+	SMTPPort        int
+	SMTPUsername    string
+	SMTPPassword    string
+	SMTPFrom        string
+	SMTPFromName    string
+	SMTPImplicitTLS bool
+
+	// Outbound Webhooks
+	OutboundWebhooksEnabled    bool
+	OutboundWebhookMaxAttempts int
+	OutboundWebhookTimeout     time.Duration
 
 	// GitHub Webhooks
 	GitHubWebhookEnabled bool
 	GitHubWebhookSecret  string
 
+	// GitHub webhook delivery retries
+	GitHubWebhookMaxAttempts    int
+	GitHubWebhookRetryBaseDelay time.Duration
+	GitHubWebhookRetryMaxDelay  time.Duration
+
 	// Code Runner
 	CodeRunnerEnabled     bool
 	CodeRunnerDockerMode  bool
 	CodeRunnerMemoryLimit string
 	CodeRunnerCPULimit    string
 	CodeRunnerTimeout     time.Duration
+	CodeRunnerGoImage     string
+	CodeRunnerRustImage   string
+	CodeRunnerJavaImage   string
+	CodeRunnerCImage      string
+
+	// Named Docker volumes that persist dependency/build caches between runs
+	CodeRunnerCacheVolumes bool
+
+	// Stdio MCP servers: whether users may run them, which commands they may
+	// run, and whether they run in Docker containers with resource limits
+	MCPStdioEnabled         bool
+	MCPStdioAllowedCommands []string
+	MCPStdioDeniedCommands  []string
+	MCPStdioSandbox         bool
+	MCPStdioSandboxImage    string
+	MCPStdioSandboxNetwork  string
+	MCPStdioMemoryLimitMB   int
+	MCPStdioCPULimit        string
+	MCPStdioMaxProcesses    int
+	MCPStdioMaxCPUSeconds   int
 
 	// Guest Mode
 	GuestModeEnabled bool
+
+	// Guests idle this long are deleted with their workspace and data
+	GuestIdleTimeout time.Duration
+
+	// Tools guests may not use, and their lower chat and agent limits
+	GuestDeniedTools             []string
+	GuestRateLimitChatPerMinute  int
+	GuestRateLimitAgentPerMinute int
+
+	// Public Share Links
+	ShareLinkDefaultExpiry time.Duration
+	ShareLinkMaxExpiry     time.Duration
+
+	// How long tokens for read-only observers of agent executions and swarms stay valid
+	ObserverTokenTTL time.Duration
+
+	// How long the token in a build's preview URL stays valid
+	PreviewTokenTTL time.Duration
+
+	// How long a response is kept for retries that reuse its Idempotency-Key
+	IdempotencyKeyTTL time.Duration
+
+	// How many agent runs, swarms, builds and background shells each user may
+	// have running at once (0 is unlimited), and how long work over a limit
+	// waits for a slot. Admins can override the limits per user.
+	UserMaxConcurrentAgents int
+	UserMaxConcurrentSwarms int
+	UserMaxConcurrentBuilds int
+	UserMaxConcurrentShells int
+	ConcurrencyQueueTimeout time.Duration
+
+	// Sub-Agents (spawn_agent tool)
+	SubAgentMaxDepth      int
+	SubAgentMaxConcurrent int
+	SubAgentTimeout       time.Duration
+
+	// Tool Execution
+	ToolTimeout          time.Duration
+	ToolTimeoutOverrides map[string]time.Duration
+
+	// Built-in tools whose parameters may use {{secret:NAME}} references;
+	// others fail if given one
+	ToolSecretTools []string
+
+	// Tool results longer than this are cut down to their head and tail in
+	// the conversation; the full result is kept apart. 0 disables.
+	ToolResultMaxBytes int
+
+	// Log every tool call, and redact secrets from tool results and progress
+	ToolAuditLog      bool
+	ToolRedactResults bool
+
+	// All but this many of the most recent tool results are collapsed to a
+	// short summary in the history sent to models. 0 keeps them all whole.
+	ToolHistoryKeepRecent int
+
+	// Provider requests and responses kept per conversation with LLM
+	// debugging on; older ones are deleted. 0 keeps them all.
+	LLMDebugMaxEntries int
+
+	// Streamed assistant replies are saved as partial messages every this
+	// many chunks, so a restart mid-stream doesn't lose them. 0 disables.
+	StreamPersistChunks int
+
+	// Conversation Auto-Titling
+	AutoTitleEnabled  bool
+	AutoTitleProvider string
+	AutoTitleModel    string
+
+	// Conversation Summaries
+	SummaryProvider string
+	SummaryModel    string
+
+	// Activity Digests
+	DigestEnabled       bool
+	DigestCheckInterval time.Duration
+
+	// Sign-in Audit
+	LoginFailureAlertThreshold int
+	LoginFailureAlertWindow    time.Duration
+	AuthEventRetention         time.Duration
+
+	// Pinned Context Files
+	PinnedFilesTokenBudget int
+	PinnedFilesMaxCount    int
+
+	// Workspace context packs
+	ContextPackTokenBudget    int
+	ContextPackMaxTokenBudget int
+
+	// Project Instructions (PRISM.md)
+	ProjectInstructionsEnabled  bool
+	ProjectInstructionsMaxBytes int
+
+	// Workspace Checkpoints
+	CheckpointsEnabled        bool
+	CheckpointMaxPerWorkspace int
+	CheckpointTimeout         time.Duration
+
+	// Encrypt message content, tool calls and full tool results at rest
+	MessagesEncrypt bool
+
+	// File History
+	FileHistoryEncrypt         bool
+	FileHistoryMaxBytesPerUser int64
+	FileHistoryCompactInterval time.Duration
+
+	// Language Servers
+	LSPEnabled         bool
+	LSPIdleTimeout     time.Duration
+	LSPDiagnosticsWait time.Duration
+
+	// Dependency Audits
+	DependencyAuditEnabled       bool
+	DependencyAuditTimeout       time.Duration
+	DependencyAuditCheckInterval time.Duration
+
+	// Pull Request Reviews
+	PRReviewEnabled     bool
+	PRReviewProvider    string
+	PRReviewModel       string
+	PRReviewMaxFiles    int
+	PRReviewFileTimeout time.Duration
+
+	// Git Writing
+	GitSuggestProvider string
+	GitSuggestModel    string
+
+	// Repository Summaries
+	RepoSummaryEnabled     bool
+	RepoSummaryProvider    string
+	RepoSummaryModel       string
+	RepoSummaryTimeout     time.Duration
+	RepoSummaryTokenBudget int
+
+	// Benchmark Suites
+	EvalEnabled     bool
+	EvalCaseTimeout time.Duration
+	EvalMaxAttempts int
+
+	// Agent Pool
+	AgentPoolMinWorkers        int
+	AgentPoolMaxWorkers        int
+	AgentPoolScaleDownDelay    time.Duration
+	AgentPoolStarvationTimeout time.Duration
+
+	// Agent Execution History
+	AgentExecutionRetention   time.Duration
+	AgentExecutionMaxRetained int
+
+	// Horizontal Scaling
+	RedisURL          string
+	RedisPrefix       string
+	ClusterAgentLimit int
+
+	// Voice Transcription
+	TranscriptionLocalURL    string
+	TranscriptionLocalModel  string
+	TranscriptionOpenAIModel string
+	TranscriptionTimeout     time.Duration
+
+	// Text-to-Speech
+	TTSOpenAIModel    string
+	TTSOpenAIVoice    string
+	ElevenLabsAPIKey  string
+	ElevenLabsVoiceID string
+	ElevenLabsModel   string
+	TTSPiperURL       string
+	TTSPiperVoice     string
+	TTSTimeout        time.Duration
+	TTSMaxChars       int
 }
 
 func Load() (*Config, error) {
@@ -97,6 +390,10 @@ func Load() (*Config, error) {
 		BaseURL:     getEnv("BASE_URL", "http://localhost:8080"),
 		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5173"),
 
+		// Frontend Hosting - serves FRONTEND_DIR, or the build embedded with the embedfrontend tag
+		ServeFrontend: getBoolEnv("SERVE_FRONTEND", true),
+		FrontendDir:   getEnv("FRONTEND_DIR", ""),
+
 		// Database
 		DatabaseURL: getEnv("DATABASE_URL", "./data/prism.db"),
 
@@ -105,6 +402,7 @@ func Load() (*Config, error) {
 		JWTSecret:        getEnv("JWT_SECRET", "change-me-in-production"),
 		JWTAccessExpiry:  getDurationEnv("JWT_ACCESS_EXPIRY", 15*time.Minute),
 		JWTRefreshExpiry: getDurationEnv("JWT_REFRESH_EXPIRY", 7*24*time.Hour),
+		AdminEmails:      getListEnv("ADMIN_EMAILS", ""),
 
 		// GitHub OAuth
 		GitHubClientID:     getEnv("GITHUB_CLIENT_ID", ""),
@@ -114,15 +412,40 @@ func Load() (*Config, error) {
 		// Ollama
 		OllamaHost: getEnv("OLLAMA_HOST", "http://localhost:11434"),
 
+		// Provider key checks make a real request, so results are reused for a while
+		ProviderKeyCheckTTL: getDurationEnv("PROVIDER_KEY_CHECK_TTL", 10*time.Minute),
+
+		// Base URLs are requested by the server, so internal hosts are refused
+		// unless it serves only trusted users with their own model servers
+		ProviderBaseURLAllowPrivate: getBoolEnv("PROVIDER_BASE_URL_ALLOW_PRIVATE", false),
+
+		// Model lists are refreshed in the background each time this passes
+		ModelCacheTTL: getDurationEnv("MODEL_CACHE_TTL", 5*time.Minute),
+
 		// Sandbox
 		SandboxMemoryLimit: getEnv("SANDBOX_MEMORY_LIMIT", "512m"),
 		SandboxCPULimit:    getEnv("SANDBOX_CPU_LIMIT", "0.5"),
 		SandboxTimeout:     getDurationEnv("SANDBOX_TIMEOUT", 60*time.Second),
 		SandboxPreviewURL:  getEnv("SANDBOX_PREVIEW_URL", ""),
+		SandboxShowHidden:  getBoolEnv("SANDBOX_SHOW_HIDDEN", false),
+
+		// Build artifacts
+		SandboxArtifactPaths:    getListEnv("SANDBOX_ARTIFACT_PATHS", ""),
+		SandboxArtifactMaxBytes: getInt64Env("SANDBOX_ARTIFACT_MAX_BYTES", 100*1024*1024),
+
+		// Shell tools
+		ShellAllowedCommands: getListEnv("SHELL_ALLOWED_COMMANDS", ""),
+		ShellDeniedCommands:  getListEnv("SHELL_DENIED_COMMANDS", ""),
+		ShellMaxOutputBytes:  getIntEnv("SHELL_MAX_OUTPUT_BYTES", 1024*1024),
 
 		// Rate Limiting
 		RateLimitRequestsPerMinute: getIntEnv("RATE_LIMIT_REQUESTS_PER_MINUTE", 60),
 		RateLimitBurst:             getIntEnv("RATE_LIMIT_BURST", 10),
+		RateLimitLoginPerMinute:    getIntEnv("RATE_LIMIT_LOGIN_PER_MINUTE", 10),
+		RateLimitRegisterPerMinute: getIntEnv("RATE_LIMIT_REGISTER_PER_MINUTE", 5),
+		RateLimitChatPerMinute:     getIntEnv("RATE_LIMIT_CHAT_PER_MINUTE", 30),
+		RateLimitAgentPerMinute:    getIntEnv("RATE_LIMIT_AGENT_PER_MINUTE", 10),
+		RateLimitToolPerMinute:     getIntEnv("RATE_LIMIT_TOOL_PER_MINUTE", 0),
 
 		// CORS
 		CORSAllowedOrigins: getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:5173"),
@@ -131,37 +454,284 @@ func Load() (*Config, error) {
 		UploadMaxSize: getInt64Env("UPLOAD_MAX_SIZE", 10*1024*1024), // 10MB
 		UploadDir:     getEnv("UPLOAD_DIR", "./data/uploads"),
 
+		// Object Storage - local keeps files under UPLOAD_DIR; s3 works with
+		// AWS S3 or any compatible server (path-style addressing for MinIO)
+		StorageBackend:    getEnv("STORAGE_BACKEND", "local"),
+		S3Endpoint:        getEnv("S3_ENDPOINT", ""),
+		S3Region:          getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:          getEnv("S3_BUCKET", ""),
+		S3AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3Prefix:          getEnv("S3_PREFIX", ""),
+		S3ForcePathStyle:  getBoolEnv("S3_FORCE_PATH_STYLE", false),
+
 		// Discord Integration
 		DiscordEnabled:    getBoolEnv("DISCORD_ENABLED", false),
 		DiscordWebhookURL: getEnv("DISCORD_WEBHOOK_URL", ""),
 		DiscordBotToken:   getEnv("DISCORD_BOT_TOKEN", ""),
 
+		// Discord Bot - requires DISCORD_BOT_TOKEN
+		DiscordBotEnabled:  getBoolEnv("DISCORD_BOT_ENABLED", false),
+		DiscordBotProvider: getEnv("DISCORD_BOT_PROVIDER", "openai"),
+		DiscordBotModel:    getEnv("DISCORD_BOT_MODEL", "gpt-4"),
+
 		// Slack Integration
 		SlackEnabled:    getBoolEnv("SLACK_ENABLED", false),
 		SlackWebhookURL: getEnv("SLACK_WEBHOOK_URL", ""),
 		SlackBotToken:   getEnv("SLACK_BOT_TOKEN", ""),
 		SlackChannelID:  getEnv("SLACK_CHANNEL_ID", ""),
 
+		// Slack Bot - enabled when both the signing secret and bot token are set
+		SlackSigningSecret: getEnv("SLACK_SIGNING_SECRET", ""),
+		SlackBotProvider:   getEnv("SLACK_BOT_PROVIDER", "openai"),
+		SlackBotModel:      getEnv("SLACK_BOT_MODEL", "gpt-4"),
+
+		// Matrix Integration - the access token's user must have joined the room
+		MatrixEnabled:       getBoolEnv("MATRIX_ENABLED", false),
+		MatrixHomeserverURL: getEnv("MATRIX_HOMESERVER_URL", ""),
+		MatrixAccessToken:   getEnv("MATRIX_ACCESS_TOKEN", ""),
+		MatrixRoomID:        getEnv("MATRIX_ROOM_ID", ""),
+
+		// Mattermost Integration
+		MattermostEnabled:    getBoolEnv("MATTERMOST_ENABLED", false),
+		MattermostWebhookURL: getEnv("MATTERMOST_WEBHOOK_URL", ""),
+		MattermostChannel:    getEnv("MATTERMOST_CHANNEL", ""),
+		MattermostUsername:   getEnv("MATTERMOST_USERNAME", "Prism"),
+
+		// Linear Integration - users connect their own API key; provider and
+		// model run triggers for users who don't choose one
+		LinearEnabled:      getBoolEnv("LINEAR_ENABLED", true),
+		LinearProvider:     getEnv("LINEAR_PROVIDER", "openai"),
+		LinearModel:        getEnv("LINEAR_MODEL", "gpt-4"),
+		LinearAgentTimeout: getDurationEnv("LINEAR_AGENT_TIMEOUT", 10*time.Minute),
+
+		// Documentation sources - users connect their own Notion and
+		// Confluence accounts; pages read by tools are truncated to this size
+		DocSourcesEnabled:     getBoolEnv("DOC_SOURCES_ENABLED", true),
+		DocSourceMaxPageChars: getIntEnv("DOC_SOURCE_MAX_PAGE_CHARS", 40000),
+
 		// PostHog Analytics
 		PostHogEnabled:       getBoolEnv("POSTHOG_ENABLED", false),
 		PostHogAPIKey:        getEnv("POSTHOG_API_KEY", ""),
 		PostHogEndpoint:      getEnv("POSTHOG_ENDPOINT", "https://app.posthog.com"),
 		PostHogBatchSize:     getIntEnv("POSTHOG_BATCH_SIZE", 10),
 		PostHogFlushInterval: getDurationEnv("POSTHOG_FLUSH_INTERVAL", 30*time.Second),
+		PostHogTrackFeedback: getBoolEnv("POSTHOG_TRACK_FEEDBACK", true),
+
+		IntegrationSettingsCacheTTL: getDurationEnv("INTEGRATION_SETTINGS_CACHE_TTL", 5*time.Minute),
+
+		// Email (SMTP) Notifications - SMTP_IMPLICIT_TLS is for servers that expect TLS from the start (port 465)
+		SMTPEnabled:     getBoolEnv("SMTP_ENABLED", false),
+		SMTPHost:        getEnv("SMTP_HOST", ""),
+		SMTPPort:        getIntEnv("SMTP_PORT", 587),
+		SMTPUsername:    getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:    getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:        getEnv("SMTP_FROM", ""),
+		SMTPFromName:    getEnv("SMTP_FROM_NAME", "Prism"),
+		SMTPImplicitTLS: getBoolEnv("SMTP_IMPLICIT_TLS", false),
+
+		// Outbound Webhooks - user-registered URLs that receive signed event payloads
+		OutboundWebhooksEnabled:    getBoolEnv("OUTBOUND_WEBHOOKS_ENABLED", true),
+		OutboundWebhookMaxAttempts: getIntEnv("OUTBOUND_WEBHOOK_MAX_ATTEMPTS", 3),
+		OutboundWebhookTimeout:     getDurationEnv("OUTBOUND_WEBHOOK_TIMEOUT", 10*time.Second),
 
 		// GitHub Webhooks
 		GitHubWebhookEnabled: getBoolEnv("GITHUB_WEBHOOK_ENABLED", false),
 		GitHubWebhookSecret:  getEnv("GITHUB_WEBHOOK_SECRET", ""),
 
+		// GitHub webhook delivery retries
+		GitHubWebhookMaxAttempts:    getIntEnv("GITHUB_WEBHOOK_MAX_ATTEMPTS", 5),
+		GitHubWebhookRetryBaseDelay: getDurationEnv("GITHUB_WEBHOOK_RETRY_BASE_DELAY", 30*time.Second),
+		GitHubWebhookRetryMaxDelay:  getDurationEnv("GITHUB_WEBHOOK_RETRY_MAX_DELAY", time.Hour),
+
 		// Code Runner
 		CodeRunnerEnabled:     getBoolEnv("CODE_RUNNER_ENABLED", true),
 		CodeRunnerDockerMode:  getBoolEnv("CODE_RUNNER_DOCKER_MODE", false),
 		CodeRunnerMemoryLimit: getEnv("CODE_RUNNER_MEMORY_LIMIT", "512m"),
 		CodeRunnerCPULimit:    getEnv("CODE_RUNNER_CPU_LIMIT", "0.5"),
 		CodeRunnerTimeout:     getDurationEnv("CODE_RUNNER_TIMEOUT", 5*time.Minute),
+		CodeRunnerGoImage:     getEnv("CODE_RUNNER_GO_IMAGE", "golang:1.22-alpine"),
+		CodeRunnerRustImage:   getEnv("CODE_RUNNER_RUST_IMAGE", "rust:1-slim"),
+		CodeRunnerJavaImage:   getEnv("CODE_RUNNER_JAVA_IMAGE", "eclipse-temurin:21-jdk"),
+		CodeRunnerCImage:      getEnv("CODE_RUNNER_C_IMAGE", "gcc:13"),
+
+		CodeRunnerCacheVolumes: getBoolEnv("CODE_RUNNER_CACHE_VOLUMES", true),
+
+		// Stdio MCP servers
+		MCPStdioEnabled:         getBoolEnv("MCP_STDIO_ENABLED", true),
+		MCPStdioAllowedCommands: getListEnv("MCP_STDIO_ALLOWED_COMMANDS", ""),
+		MCPStdioDeniedCommands:  getListEnv("MCP_STDIO_DENIED_COMMANDS", ""),
+		MCPStdioSandbox:         getBoolEnv("MCP_STDIO_SANDBOX", false),
+		MCPStdioSandboxImage:    getEnv("MCP_STDIO_SANDBOX_IMAGE", "node:20-alpine"),
+		MCPStdioSandboxNetwork:  getEnv("MCP_STDIO_SANDBOX_NETWORK", "bridge"),
+		MCPStdioMemoryLimitMB:   getIntEnv("MCP_STDIO_MEMORY_LIMIT_MB", 1024),
+		MCPStdioCPULimit:        getEnv("MCP_STDIO_CPU_LIMIT", "1"),
+		MCPStdioMaxProcesses:    getIntEnv("MCP_STDIO_MAX_PROCESSES", 0),
+		MCPStdioMaxCPUSeconds:   getIntEnv("MCP_STDIO_MAX_CPU_SECONDS", 3600),
 
 		// Guest Mode - disabled by default for security
-		GuestModeEnabled: getBoolEnv("GUEST_MODE_ENABLED", false),
+		GuestModeEnabled:             getBoolEnv("GUEST_MODE_ENABLED", false),
+		GuestIdleTimeout:             getDurationEnv("GUEST_IDLE_TIMEOUT", 2*time.Hour),
+		GuestDeniedTools:             getListEnv("GUEST_DENIED_TOOLS", "shell_execute,run_shell,run_background,bash_output,kill_shell,execute_code,file_delete,query_database"),
+		GuestRateLimitChatPerMinute:  getIntEnv("GUEST_RATE_LIMIT_CHAT_PER_MINUTE", 5),
+		GuestRateLimitAgentPerMinute: getIntEnv("GUEST_RATE_LIMIT_AGENT_PER_MINUTE", 2),
+
+		// Public Share Links
+		ShareLinkDefaultExpiry: getDurationEnv("SHARE_LINK_DEFAULT_EXPIRY", 7*24*time.Hour),
+		ShareLinkMaxExpiry:     getDurationEnv("SHARE_LINK_MAX_EXPIRY", 30*24*time.Hour),
+
+		// Read-only observers
+		ObserverTokenTTL: getDurationEnv("OBSERVER_TOKEN_TTL", 24*time.Hour),
+
+		// Build previews
+		PreviewTokenTTL: getDurationEnv("PREVIEW_TOKEN_TTL", time.Hour),
+
+		// Idempotency keys
+		IdempotencyKeyTTL: getDurationEnv("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+
+		// Per-user concurrency
+		UserMaxConcurrentAgents: getIntEnv("USER_MAX_CONCURRENT_AGENTS", 5),
+		UserMaxConcurrentSwarms: getIntEnv("USER_MAX_CONCURRENT_SWARMS", 2),
+		UserMaxConcurrentBuilds: getIntEnv("USER_MAX_CONCURRENT_BUILDS", 2),
+		UserMaxConcurrentShells: getIntEnv("USER_MAX_CONCURRENT_SHELLS", 10),
+		ConcurrencyQueueTimeout: getDurationEnv("CONCURRENCY_QUEUE_TIMEOUT", 2*time.Minute),
+
+		// Sub-Agents (spawn_agent tool)
+		SubAgentMaxDepth:      getIntEnv("SUB_AGENT_MAX_DEPTH", 2),
+		SubAgentMaxConcurrent: getIntEnv("SUB_AGENT_MAX_CONCURRENT", 3),
+		SubAgentTimeout:       getDurationEnv("SUB_AGENT_TIMEOUT", 5*time.Minute),
+
+		// Tool Execution - overrides are "name=duration" pairs, e.g. "web_fetch=30s,shell_execute=30m"
+		ToolTimeout: getDurationEnv("TOOL_TIMEOUT", 5*time.Minute),
+		ToolTimeoutOverrides: getDurationMapEnv("TOOL_TIMEOUT_OVERRIDES", map[string]time.Duration{
+			"shell_execute": 31 * time.Minute, // shell_execute enforces its own timeout of up to 30 minutes
+			"run_shell":     31 * time.Minute,
+			"spawn_agent":   10 * time.Minute,
+			"execute_code":  10 * time.Minute,
+		}),
+		// Only tools that run commands, and so need confirmation, get secrets
+		ToolSecretTools:    getListEnv("TOOL_SECRET_TOOLS", "shell_execute,run_shell,run_tests,execute_code"),
+		ToolResultMaxBytes: getIntEnv("TOOL_RESULT_MAX_BYTES", 50000),
+		ToolAuditLog:       getBoolEnv("TOOL_AUDIT_LOG", false),
+		ToolRedactResults:  getBoolEnv("TOOL_REDACT_RESULTS", false),
+
+		// Older tool results are collapsed once a conversation has more than 10
+		ToolHistoryKeepRecent: getIntEnv("TOOL_HISTORY_KEEP_RECENT", 10),
+
+		// LLM debugging keeps the latest 50 requests of each conversation
+		LLMDebugMaxEntries: getIntEnv("LLM_DEBUG_MAX_ENTRIES", 50),
+
+		// Partial assistant replies are saved every 20 chunks
+		StreamPersistChunks: getIntEnv("STREAM_PERSIST_CHUNKS", 20),
+
+		// Conversation Auto-Titling - provider/model default to the conversation's own
+		AutoTitleEnabled:  getBoolEnv("AUTO_TITLE_ENABLED", true),
+		AutoTitleProvider: getEnv("AUTO_TITLE_PROVIDER", ""),
+		AutoTitleModel:    getEnv("AUTO_TITLE_MODEL", ""),
+
+		// Conversation Summaries - provider/model default to the conversation's own
+		SummaryProvider: getEnv("SUMMARY_PROVIDER", ""),
+		SummaryModel:    getEnv("SUMMARY_MODEL", ""),
+
+		// Activity Digests - the check interval is how often daily/weekly schedules are checked for being due
+		DigestEnabled:       getBoolEnv("DIGEST_ENABLED", true),
+		DigestCheckInterval: getDurationEnv("DIGEST_CHECK_INTERVAL", 5*time.Minute),
+
+		// Sign-in Audit - this many failed sign-ins within the window alert the user; 0 disables the alert
+		LoginFailureAlertThreshold: getIntEnv("LOGIN_FAILURE_ALERT_THRESHOLD", 5),
+		LoginFailureAlertWindow:    getDurationEnv("LOGIN_FAILURE_ALERT_WINDOW", 15*time.Minute),
+		AuthEventRetention:         getDurationEnv("AUTH_EVENT_RETENTION", 90*24*time.Hour),
+
+		// Pinned Context Files - budget is in approximate tokens across all pinned files
+		PinnedFilesTokenBudget: getIntEnv("PINNED_FILES_TOKEN_BUDGET", 8000),
+		PinnedFilesMaxCount:    getIntEnv("PINNED_FILES_MAX_COUNT", 10),
+
+		// Workspace context packs - budgets are in approximate tokens
+		ContextPackTokenBudget:    getIntEnv("CONTEXT_PACK_TOKEN_BUDGET", 8000),
+		ContextPackMaxTokenBudget: getIntEnv("CONTEXT_PACK_MAX_TOKEN_BUDGET", 50000),
+
+		// Project Instructions (PRISM.md)
+		ProjectInstructionsEnabled:  getBoolEnv("PROJECT_INSTRUCTIONS_ENABLED", true),
+		ProjectInstructionsMaxBytes: getIntEnv("PROJECT_INSTRUCTIONS_MAX_BYTES", 32*1024),
+
+		// Workspace Checkpoints - snapshots are kept in a shadow git repository under UPLOAD_DIR
+		CheckpointsEnabled:        getBoolEnv("CHECKPOINTS_ENABLED", true),
+		CheckpointMaxPerWorkspace: getIntEnv("CHECKPOINT_MAX_PER_WORKSPACE", 50),
+		CheckpointTimeout:         getDurationEnv("CHECKPOINT_TIMEOUT", 30*time.Second),
+
+		// Messages - only those saved while it is on are encrypted; search
+		// no longer matches their content
+		MessagesEncrypt: getBoolEnv("MESSAGES_ENCRYPT", false),
+
+		// File History - contents are deduplicated; the per-user cap prunes least recently used entries
+		FileHistoryEncrypt:         getBoolEnv("FILE_HISTORY_ENCRYPT", false),
+		FileHistoryMaxBytesPerUser: getInt64Env("FILE_HISTORY_MAX_BYTES_PER_USER", 100*1024*1024),
+		FileHistoryCompactInterval: getDurationEnv("FILE_HISTORY_COMPACT_INTERVAL", 24*time.Hour),
+
+		// Language Servers - gopls, typescript-language-server and pyright-langserver are used if on PATH
+		LSPEnabled:         getBoolEnv("LSP_ENABLED", true),
+		LSPIdleTimeout:     getDurationEnv("LSP_IDLE_TIMEOUT", 10*time.Minute),
+		LSPDiagnosticsWait: getDurationEnv("LSP_DIAGNOSTICS_WAIT", 5*time.Second),
+
+		// Dependency Audits - run through the code runner; the check interval is how often schedules are checked
+		DependencyAuditEnabled:       getBoolEnv("DEPENDENCY_AUDIT_ENABLED", true),
+		DependencyAuditTimeout:       getDurationEnv("DEPENDENCY_AUDIT_TIMEOUT", 5*time.Minute),
+		DependencyAuditCheckInterval: getDurationEnv("DEPENDENCY_AUDIT_CHECK_INTERVAL", 5*time.Minute),
+
+		// Pull Request Reviews - a reviewer agent per changed file, using the user's stored key for the provider
+		PRReviewEnabled:     getBoolEnv("PR_REVIEW_ENABLED", true),
+		PRReviewProvider:    getEnv("PR_REVIEW_PROVIDER", "openai"),
+		PRReviewModel:       getEnv("PR_REVIEW_MODEL", "gpt-4"),
+		PRReviewMaxFiles:    getIntEnv("PR_REVIEW_MAX_FILES", 30),
+		PRReviewFileTimeout: getDurationEnv("PR_REVIEW_FILE_TIMEOUT", 5*time.Minute),
+
+		// Git Writing - commit messages and changelogs for requests that don't choose a model
+		GitSuggestProvider: getEnv("GIT_SUGGEST_PROVIDER", "openai"),
+		GitSuggestModel:    getEnv("GIT_SUGGEST_MODEL", "gpt-4"),
+
+		// Repository Summaries - an analyst agent explains cloned repositories, using the user's stored key for the provider
+		RepoSummaryEnabled:     getBoolEnv("REPO_SUMMARY_ENABLED", true),
+		RepoSummaryProvider:    getEnv("REPO_SUMMARY_PROVIDER", "openai"),
+		RepoSummaryModel:       getEnv("REPO_SUMMARY_MODEL", "gpt-4"),
+		RepoSummaryTimeout:     getDurationEnv("REPO_SUMMARY_TIMEOUT", 5*time.Minute),
+		RepoSummaryTokenBudget: getIntEnv("REPO_SUMMARY_TOKEN_BUDGET", 12000),
+
+		// Benchmark Suites - agent runs checked by validation scripts in the code runner, using the user's stored keys
+		EvalEnabled:     getBoolEnv("EVAL_ENABLED", true),
+		EvalCaseTimeout: getDurationEnv("EVAL_CASE_TIMEOUT", 10*time.Minute),
+		EvalMaxAttempts: getIntEnv("EVAL_MAX_ATTEMPTS", 200),
+
+		// Agent Pool - workers scale between min and max with the queue; queued tasks gain a priority level per starvation timeout
+		AgentPoolMinWorkers:        getIntEnv("AGENT_POOL_MIN_WORKERS", 2),
+		AgentPoolMaxWorkers:        getIntEnv("AGENT_POOL_MAX_WORKERS", 10),
+		AgentPoolScaleDownDelay:    getDurationEnv("AGENT_POOL_SCALE_DOWN_DELAY", 30*time.Second),
+		AgentPoolStarvationTimeout: getDurationEnv("AGENT_POOL_STARVATION_TIMEOUT", time.Minute),
+
+		// Agent Execution History - finished executions and swarms are dropped from memory after the retention period or beyond the limit
+		AgentExecutionRetention:   getDurationEnv("AGENT_EXECUTION_RETENTION", 24*time.Hour),
+		AgentExecutionMaxRetained: getIntEnv("AGENT_EXECUTION_MAX_RETAINED", 1000),
+
+		// Horizontal Scaling - replicas sharing a Redis relay websocket messages and stop requests to each other; a cluster agent limit also shares the agent queue
+		RedisURL:          getEnv("REDIS_URL", ""),
+		RedisPrefix:       getEnv("REDIS_PREFIX", "prism"),
+		ClusterAgentLimit: getIntEnv("CLUSTER_AGENT_LIMIT", 0),
+
+		// Voice Transcription - OpenAI uses the user's stored key; the local URL points at a whisper.cpp or OpenAI-compatible endpoint
+		TranscriptionLocalURL:    getEnv("TRANSCRIPTION_LOCAL_URL", ""),
+		TranscriptionLocalModel:  getEnv("TRANSCRIPTION_LOCAL_MODEL", ""),
+		TranscriptionOpenAIModel: getEnv("TRANSCRIPTION_OPENAI_MODEL", "whisper-1"),
+		TranscriptionTimeout:     getDurationEnv("TRANSCRIPTION_TIMEOUT", 2*time.Minute),
+
+		// Text-to-Speech - OpenAI uses the user's stored key; long messages are spoken in chunks up to TTS_MAX_CHARS in total
+		TTSOpenAIModel:    getEnv("TTS_OPENAI_MODEL", "tts-1"),
+		TTSOpenAIVoice:    getEnv("TTS_OPENAI_VOICE", "alloy"),
+		ElevenLabsAPIKey:  getEnv("ELEVENLABS_API_KEY", ""),
+		ElevenLabsVoiceID: getEnv("ELEVENLABS_VOICE_ID", ""),
+		ElevenLabsModel:   getEnv("ELEVENLABS_MODEL", "eleven_multilingual_v2"),
+		TTSPiperURL:       getEnv("TTS_PIPER_URL", ""),
+		TTSPiperVoice:     getEnv("TTS_PIPER_VOICE", ""),
+		TTSTimeout:        getDurationEnv("TTS_TIMEOUT", 2*time.Minute),
+		TTSMaxChars:       getIntEnv("TTS_MAX_CHARS", 20000),
 	}
 
 	// Validate security configuration in production
@@ -239,6 +809,41 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// getDurationMapEnv parses a comma-separated list of name=duration pairs.
+// Entries from the environment are merged over the defaults.
+func getDurationMapEnv(key string, defaultValue map[string]time.Duration) map[string]time.Duration {
+	result := make(map[string]time.Duration, len(defaultValue))
+	for name, duration := range defaultValue {
+		result[name] = duration
+	}
+
+	value := os.Getenv(key)
+	if value == "" {
+		return result
+	}
+	for _, pair := range strings.Split(value, ",") {
+		name, raw, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if duration, err := time.ParseDuration(strings.TrimSpace(raw)); err == nil {
+			result[strings.TrimSpace(name)] = duration
+		}
+	}
+	return result
+}
+
+// getListEnv parses a comma-separated list, dropping empty entries
+func getListEnv(key, defaultValue string) []string {
+	var result []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
 func getBoolEnv(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if value == "true" || value == "1" || value == "yes" {
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Account token kinds
+const (
+	AccountTokenPasswordReset = "password_reset"
+	AccountTokenEmailChange   = "email_change"
+)
+
+// AccountToken is a single-use token emailed to a user to reset their
+// password or confirm a new email address. Only its hash is stored.
+type AccountToken struct {
+	ID        string
+	UserID    string
+	Kind      string
+	TokenHash string
+	NewEmail  string // The address being confirmed, for email changes
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// AccountTokenRepository handles account token database operations
+type AccountTokenRepository struct {
+	db *sql.DB
+}
+
+// NewAccountTokenRepository creates a new account token repository
+func NewAccountTokenRepository(db *sql.DB) *AccountTokenRepository {
+	return &AccountTokenRepository{db: db}
+}
+
+// Create stores a token, replacing any earlier token of the same kind for
+// the user so that only the latest email works
+func (r *AccountTokenRepository) Create(userID, kind, tokenHash, newEmail string, expiresAt time.Time) (*AccountToken, error) {
+	token := &AccountToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Kind:      kind,
+		TokenHash: tokenHash,
+		NewEmail:  newEmail,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM account_tokens WHERE user_id = ? AND kind = ?`, userID, kind); err != nil {
+		return nil, fmt.Errorf("failed to delete previous account tokens: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO account_tokens (id, user_id, kind, token_hash, new_email, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, token.ID, userID, kind, tokenHash, sql.NullString{String: newEmail, Valid: newEmail != ""}, expiresAt, token.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create account token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit account token: %w", err)
+	}
+	return token, nil
+}
+
+// Consume deletes a token of a kind and returns it, or nil if there is no
+// such token or it has expired. A token can be consumed only once.
+func (r *AccountTokenRepository) Consume(kind, tokenHash string) (*AccountToken, error) {
+	token := &AccountToken{}
+	var newEmail sql.NullString
+	err := r.db.QueryRow(`
+		SELECT id, user_id, kind, token_hash, new_email, expires_at, created_at
+		FROM account_tokens
+		WHERE token_hash = ? AND kind = ?
+	`, tokenHash, kind).Scan(&token.ID, &token.UserID, &token.Kind, &token.TokenHash, &newEmail, &token.ExpiresAt, &token.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account token: %w", err)
+	}
+	token.NewEmail = newEmail.String
+
+	// Whoever deletes the row first gets to use the token
+	result, err := r.db.Exec(`DELETE FROM account_tokens WHERE id = ?`, token.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume account token: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return nil, nil
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return nil, nil
+	}
+	return token, nil
+}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditSchedule represents a recurring dependency audit of a workspace
+type AuditSchedule struct {
+	ID            string
+	UserID        string
+	WorkspacePath string
+	IntervalHours int
+	Enabled       bool
+	// KnownVulnerabilities holds the keys of vulnerabilities found by the
+	// previous run, so only new ones are notified
+	KnownVulnerabilities   []string
+	LastVulnerabilityCount int
+	LastError              string
+	LastRunAt              *time.Time
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+}
+
+// Due reports whether the schedule should run at the given time
+func (s *AuditSchedule) Due(now time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	if s.LastRunAt == nil {
+		return true
+	}
+	return !now.Before(s.LastRunAt.Add(time.Duration(s.IntervalHours) * time.Hour))
+}
+
+// AuditScheduleRepository handles dependency audit schedule database operations
+type AuditScheduleRepository struct {
+	db *sql.DB
+}
+
+// NewAuditScheduleRepository creates a new audit schedule repository
+func NewAuditScheduleRepository(db *sql.DB) *AuditScheduleRepository {
+	return &AuditScheduleRepository{db: db}
+}
+
+// Upsert creates or updates the schedule for a workspace
+func (r *AuditScheduleRepository) Upsert(userID, workspacePath string, intervalHours int, enabled bool) (*AuditSchedule, error) {
+	now := time.Now()
+
+	_, err := r.db.Exec(`
+		INSERT INTO dependency_audit_schedules (id, user_id, workspace_path, interval_hours, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, workspace_path) DO UPDATE SET
+			interval_hours = excluded.interval_hours,
+			enabled = excluded.enabled,
+			updated_at = excluded.updated_at
+	`, uuid.New().String(), userID, workspacePath, intervalHours, enabled, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save audit schedule: %w", err)
+	}
+
+	return r.GetByWorkspace(userID, workspacePath)
+}
+
+// GetByWorkspace retrieves the schedule for a user's workspace
+func (r *AuditScheduleRepository) GetByWorkspace(userID, workspacePath string) (*AuditSchedule, error) {
+	row := r.db.QueryRow(`
+		SELECT id, user_id, workspace_path, interval_hours, enabled, known_vulnerabilities,
+			last_vulnerability_count, last_error, last_run_at, created_at, updated_at
+		FROM dependency_audit_schedules
+		WHERE user_id = ? AND workspace_path = ?
+	`, userID, workspacePath)
+
+	schedule, err := scanAuditSchedule(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// ListEnabled returns every enabled schedule
+func (r *AuditScheduleRepository) ListEnabled() ([]*AuditSchedule, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, workspace_path, interval_hours, enabled, known_vulnerabilities,
+			last_vulnerability_count, last_error, last_run_at, created_at, updated_at
+		FROM dependency_audit_schedules
+		WHERE enabled = 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []*AuditSchedule
+	for rows.Next() {
+		schedule, err := scanAuditSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit schedule: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+// RecordRun stores the outcome of a scheduled audit. On failure the known
+// vulnerabilities are left unchanged.
+func (r *AuditScheduleRepository) RecordRun(id string, runAt time.Time, known []string, count int, runErr string) error {
+	if runErr != "" {
+		_, err := r.db.Exec(`
+			UPDATE dependency_audit_schedules SET last_error = ?, last_run_at = ? WHERE id = ?
+		`, runErr, runAt, id)
+		if err != nil {
+			return fmt.Errorf("failed to record audit run: %w", err)
+		}
+		return nil
+	}
+
+	if known == nil {
+		known = []string{}
+	}
+	knownJSON, err := json.Marshal(known)
+	if err != nil {
+		return fmt.Errorf("failed to marshal known vulnerabilities: %w", err)
+	}
+
+	_, err = r.db.Exec(`
+		UPDATE dependency_audit_schedules
+		SET known_vulnerabilities = ?, last_vulnerability_count = ?, last_error = NULL, last_run_at = ?
+		WHERE id = ?
+	`, string(knownJSON), count, runAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to record audit run: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the schedule for a user's workspace
+func (r *AuditScheduleRepository) Delete(userID, workspacePath string) (bool, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM dependency_audit_schedules WHERE user_id = ? AND workspace_path = ?
+	`, userID, workspacePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete audit schedule: %w", err)
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// scanAuditSchedule scans a schedule from a row
+func scanAuditSchedule(row interface{ Scan(...interface{}) error }) (*AuditSchedule, error) {
+	schedule := &AuditSchedule{}
+	var knownJSON string
+	var lastError sql.NullString
+	var lastRunAt sql.NullTime
+
+	err := row.Scan(
+		&schedule.ID,
+		&schedule.UserID,
+		&schedule.WorkspacePath,
+		&schedule.IntervalHours,
+		&schedule.Enabled,
+		&knownJSON,
+		&schedule.LastVulnerabilityCount,
+		&lastError,
+		&lastRunAt,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(knownJSON), &schedule.KnownVulnerabilities); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal known vulnerabilities: %w", err)
+	}
+	schedule.LastError = lastError.String
+	if lastRunAt.Valid {
+		schedule.LastRunAt = &lastRunAt.Time
+	}
+	return schedule, nil
+}
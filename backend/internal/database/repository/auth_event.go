@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Auth event kinds
+const (
+	AuthEventLogin    = "login"
+	AuthEventRegister = "register"
+)
+
+// AuthEvent is a sign-in attempt or registration
+type AuthEvent struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"` // Empty for attempts on unknown emails
+	Email     string    `json:"-"` // The email the attempt was made with
+	Kind      string    `json:"kind"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"` // Why a failed attempt failed
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	NewDevice bool      `json:"new_device,omitempty"` // First success from this user agent
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuthEventRepository handles auth event database operations
+type AuthEventRepository struct {
+	db *sql.DB
+}
+
+// NewAuthEventRepository creates a new auth event repository
+func NewAuthEventRepository(db *sql.DB) *AuthEventRepository {
+	return &AuthEventRepository{db: db}
+}
+
+// Record stores an auth event
+func (r *AuthEventRepository) Record(event *AuthEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO auth_events (id, user_id, email, kind, success, reason, ip, user_agent, new_device, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, event.ID, sql.NullString{String: event.UserID, Valid: event.UserID != ""}, event.Email, event.Kind, event.Success,
+		sql.NullString{String: event.Reason, Valid: event.Reason != ""}, event.IP, event.UserAgent, event.NewDevice, event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record auth event: %w", err)
+	}
+	return nil
+}
+
+// ListByUser returns a user's auth events, newest first
+func (r *AuthEventRepository) ListByUser(userID string, limit int) ([]*AuthEvent, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, email, kind, success, COALESCE(reason, ''), ip, user_agent, new_device, created_at
+		FROM auth_events
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list auth events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*AuthEvent{}
+	for rows.Next() {
+		event := &AuthEvent{}
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Email, &event.Kind, &event.Success, &event.Reason,
+			&event.IP, &event.UserAgent, &event.NewDevice, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan auth event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list auth events: %w", err)
+	}
+	return events, nil
+}
+
+// KnownDevice reports whether a user has signed in or registered from a user
+// agent before, and whether they have signed in from anywhere before
+func (r *AuthEventRepository) KnownDevice(userID, userAgent string) (known bool, anySuccess bool, err error) {
+	err = r.db.QueryRow(`
+		SELECT COALESCE(MAX(user_agent = ?), 0), COUNT(*) > 0
+		FROM auth_events
+		WHERE user_id = ? AND success = 1
+	`, userAgent, userID).Scan(&known, &anySuccess)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to check known devices: %w", err)
+	}
+	return known, anySuccess, nil
+}
+
+// CountFailuresSince counts a user's failed sign-ins since a time
+func (r *AuthEventRepository) CountFailuresSince(userID string, since time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM auth_events
+		WHERE user_id = ? AND success = 0 AND created_at >= ?
+	`, userID, since).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count failed sign-ins: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteOlderThan removes auth events recorded before a time
+func (r *AuthEventRepository) DeleteOlderThan(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM auth_events WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old auth events: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Checkpoint triggers
+const (
+	CheckpointTriggerManual   = "manual"
+	CheckpointTriggerAgentRun = "agent_run"
+	CheckpointTriggerRestore  = "restore"
+)
+
+// Checkpoint represents a snapshot of a workspace, stored as a commit in a
+// shadow git repository managed by Prism
+type Checkpoint struct {
+	ID            string
+	UserID        string
+	WorkspacePath string
+	CommitSHA     string
+	TreeSHA       string
+	Label         string
+	Trigger       string // "manual", "agent_run", "restore"
+	CreatedAt     time.Time
+}
+
+// CheckpointRepository handles workspace checkpoint database operations
+type CheckpointRepository struct {
+	db *sql.DB
+}
+
+// NewCheckpointRepository creates a new checkpoint repository
+func NewCheckpointRepository(db *sql.DB) *CheckpointRepository {
+	return &CheckpointRepository{db: db}
+}
+
+// Create records a new checkpoint
+func (r *CheckpointRepository) Create(id, userID, workspacePath, commitSHA, treeSHA, label, trigger string) (*Checkpoint, error) {
+	if id == "" {
+		id = uuid.New().String()
+	}
+	now := time.Now()
+
+	_, err := r.db.Exec(
+		`INSERT INTO workspace_checkpoints (id, user_id, workspace_path, commit_sha, tree_sha, label, trigger, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, userID, workspacePath, commitSHA, treeSHA, label, trigger, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+
+	return &Checkpoint{
+		ID:            id,
+		UserID:        userID,
+		WorkspacePath: workspacePath,
+		CommitSHA:     commitSHA,
+		TreeSHA:       treeSHA,
+		Label:         label,
+		Trigger:       trigger,
+		CreatedAt:     now,
+	}, nil
+}
+
+// GetByID retrieves a checkpoint by ID
+func (r *CheckpointRepository) GetByID(id string) (*Checkpoint, error) {
+	cp := &Checkpoint{}
+	var label sql.NullString
+
+	err := r.db.QueryRow(
+		`SELECT id, user_id, workspace_path, commit_sha, tree_sha, label, trigger, created_at
+		 FROM workspace_checkpoints WHERE id = ?`,
+		id,
+	).Scan(&cp.ID, &cp.UserID, &cp.WorkspacePath, &cp.CommitSHA, &cp.TreeSHA, &label, &cp.Trigger, &cp.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkpoint: %w", err)
+	}
+
+	cp.Label = label.String
+	return cp, nil
+}
+
+// ListByWorkspace returns the checkpoints for a user's workspace, newest first
+func (r *CheckpointRepository) ListByWorkspace(userID, workspacePath string) ([]*Checkpoint, error) {
+	rows, err := r.db.Query(
+		`SELECT id, user_id, workspace_path, commit_sha, tree_sha, label, trigger, created_at
+		 FROM workspace_checkpoints
+		 WHERE user_id = ? AND workspace_path = ?
+		 ORDER BY created_at DESC, rowid DESC`,
+		userID, workspacePath,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var checkpoints []*Checkpoint
+	for rows.Next() {
+		cp := &Checkpoint{}
+		var label sql.NullString
+		if err := rows.Scan(&cp.ID, &cp.UserID, &cp.WorkspacePath, &cp.CommitSHA, &cp.TreeSHA, &label, &cp.Trigger, &cp.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan checkpoint: %w", err)
+		}
+		cp.Label = label.String
+		checkpoints = append(checkpoints, cp)
+	}
+
+	return checkpoints, rows.Err()
+}
+
+// GetLatest returns the most recent checkpoint for a user's workspace
+func (r *CheckpointRepository) GetLatest(userID, workspacePath string) (*Checkpoint, error) {
+	cp := &Checkpoint{}
+	var label sql.NullString
+
+	err := r.db.QueryRow(
+		`SELECT id, user_id, workspace_path, commit_sha, tree_sha, label, trigger, created_at
+		 FROM workspace_checkpoints
+		 WHERE user_id = ? AND workspace_path = ?
+		 ORDER BY created_at DESC, rowid DESC
+		 LIMIT 1`,
+		userID, workspacePath,
+	).Scan(&cp.ID, &cp.UserID, &cp.WorkspacePath, &cp.CommitSHA, &cp.TreeSHA, &label, &cp.Trigger, &cp.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest checkpoint: %w", err)
+	}
+
+	cp.Label = label.String
+	return cp, nil
+}
+
+// Delete removes a checkpoint record
+func (r *CheckpointRepository) Delete(id string) error {
+	_, err := r.db.Exec(`DELETE FROM workspace_checkpoints WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete checkpoint: %w", err)
+	}
+	return nil
+}
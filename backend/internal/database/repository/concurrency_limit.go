@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ConcurrencyLimit overrides how many agent runs, swarms, builds and
+// background shells a user may run at once. Nil fields use the server's
+// defaults; zero is unlimited.
+type ConcurrencyLimit struct {
+	UserID    string
+	MaxAgents *int
+	MaxSwarms *int
+	MaxBuilds *int
+	MaxShells *int
+	UpdatedAt time.Time
+}
+
+// ConcurrencyLimitRepository handles per-user concurrency limit database
+// operations
+type ConcurrencyLimitRepository struct {
+	db *sql.DB
+}
+
+// NewConcurrencyLimitRepository creates a new concurrency limit repository
+func NewConcurrencyLimitRepository(db *sql.DB) *ConcurrencyLimitRepository {
+	return &ConcurrencyLimitRepository{db: db}
+}
+
+const concurrencyLimitColumns = `user_id, max_agents, max_swarms, max_builds, max_shells, updated_at`
+
+// Upsert stores a user's limits, replacing any existing ones
+func (r *ConcurrencyLimitRepository) Upsert(limit *ConcurrencyLimit) error {
+	limit.UpdatedAt = time.Now()
+
+	_, err := r.db.Exec(`
+		INSERT INTO user_concurrency_limits (`+concurrencyLimitColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			max_agents = excluded.max_agents,
+			max_swarms = excluded.max_swarms,
+			max_builds = excluded.max_builds,
+			max_shells = excluded.max_shells,
+			updated_at = excluded.updated_at
+	`, limit.UserID, limit.MaxAgents, limit.MaxSwarms, limit.MaxBuilds, limit.MaxShells, limit.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save concurrency limit: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a user's limits, or nil if they use the defaults
+func (r *ConcurrencyLimitRepository) Get(userID string) (*ConcurrencyLimit, error) {
+	limit, err := scanConcurrencyLimit(r.db.QueryRow(`
+		SELECT `+concurrencyLimitColumns+`
+		FROM user_concurrency_limits
+		WHERE user_id = ?
+	`, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get concurrency limit: %w", err)
+	}
+	return limit, nil
+}
+
+// List retrieves the limits of every user who has them
+func (r *ConcurrencyLimitRepository) List() ([]*ConcurrencyLimit, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + concurrencyLimitColumns + `
+		FROM user_concurrency_limits
+		ORDER BY updated_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list concurrency limits: %w", err)
+	}
+	defer rows.Close()
+
+	limits := []*ConcurrencyLimit{}
+	for rows.Next() {
+		limit, err := scanConcurrencyLimit(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan concurrency limit: %w", err)
+		}
+		limits = append(limits, limit)
+	}
+
+	return limits, rows.Err()
+}
+
+// Delete removes a user's limits, returning them to the defaults
+func (r *ConcurrencyLimitRepository) Delete(userID string) error {
+	_, err := r.db.Exec(`DELETE FROM user_concurrency_limits WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete concurrency limit: %w", err)
+	}
+	return nil
+}
+
+func scanConcurrencyLimit(row interface{ Scan(...interface{}) error }) (*ConcurrencyLimit, error) {
+	limit := &ConcurrencyLimit{}
+	var agents, swarms, builds, shells sql.NullInt64
+
+	err := row.Scan(&limit.UserID, &agents, &swarms, &builds, &shells, &limit.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	limit.MaxAgents = nullInt(agents)
+	limit.MaxSwarms = nullInt(swarms)
+	limit.MaxBuilds = nullInt(builds)
+	limit.MaxShells = nullInt(shells)
+	return limit, nil
+}
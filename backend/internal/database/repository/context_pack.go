@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ContextPack is workspace context packed into a conversation
+type ContextPack struct {
+	ConversationID string
+	UserID         string
+	Spec           string   // JSON of the spec the pack was built from
+	Content        string   // The packed context
+	Files          []string // Files whose contents are in the pack
+	Tokens         int
+	CreatedAt      time.Time
+}
+
+// ContextPackRepository handles conversation context pack database operations
+type ContextPackRepository struct {
+	db *sql.DB
+}
+
+// NewContextPackRepository creates a new context pack repository
+func NewContextPackRepository(db *sql.DB) *ContextPackRepository {
+	return &ContextPackRepository{db: db}
+}
+
+// Save attaches a pack to its conversation, replacing any it had
+func (r *ContextPackRepository) Save(pack *ContextPack) error {
+	filesJSON, err := json.Marshal(pack.Files)
+	if err != nil {
+		return fmt.Errorf("failed to encode context pack files: %w", err)
+	}
+
+	pack.CreatedAt = time.Now()
+	_, err = r.db.Exec(
+		`INSERT INTO conversation_context_packs (conversation_id, user_id, spec, content, files, tokens, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(conversation_id) DO UPDATE SET
+			user_id = excluded.user_id, spec = excluded.spec, content = excluded.content,
+			files = excluded.files, tokens = excluded.tokens, created_at = excluded.created_at`,
+		pack.ConversationID, pack.UserID, pack.Spec, pack.Content, string(filesJSON), pack.Tokens, pack.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save context pack: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a conversation's pack, or nil if it has none
+func (r *ContextPackRepository) Get(conversationID string) (*ContextPack, error) {
+	pack := &ContextPack{}
+	var filesJSON string
+	err := r.db.QueryRow(
+		`SELECT conversation_id, user_id, spec, content, files, tokens, created_at
+		 FROM conversation_context_packs WHERE conversation_id = ?`,
+		conversationID,
+	).Scan(&pack.ConversationID, &pack.UserID, &pack.Spec, &pack.Content, &filesJSON, &pack.Tokens, &pack.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get context pack: %w", err)
+	}
+	if err := json.Unmarshal([]byte(filesJSON), &pack.Files); err != nil {
+		return nil, fmt.Errorf("failed to decode context pack files: %w", err)
+	}
+	return pack, nil
+}
+
+// Delete detaches a conversation's pack, reporting whether it had one
+func (r *ContextPackRepository) Delete(conversationID string) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM conversation_context_packs WHERE conversation_id = ?`, conversationID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete context pack: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete context pack: %w", err)
+	}
+	return rows > 0, nil
+}
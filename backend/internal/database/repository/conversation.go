@@ -3,34 +3,60 @@ package repository
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/security"
 )
 
 // Conversation represents a chat conversation
 type Conversation struct {
-	ID           string
-	UserID       string
-	Title        string
-	Provider     string
-	Model        string
-	SystemPrompt string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	ID              string
+	UserID          string
+	Title           string
+	Provider        string
+	Model           string
+	SystemPrompt    string
+	Folder          string
+	Tags            []string
+	PinnedAt        *time.Time // Pinned conversations list first
+	ArchivedAt      *time.Time // Archived conversations are hidden from the default list
+	ToolHistoryKeep *int       // Recent tool results sent to models whole, older ones being collapsed; nil uses the default
+	LLMDebug        bool       // Provider traffic is captured for debugging
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
 
+// ConversationFilter narrows a user's conversation list
+type ConversationFilter struct {
+	Archived   string // "" for active conversations, "only" for archived ones, "all" for both
+	PinnedOnly bool
+	Folder     string // "" for any folder
+	Tag        string // "" for any tag
+}
+
+// Archive filters for listing conversations
+const (
+	ArchivedOnly = "only"
+	ArchivedAll  = "all"
+)
+
 // Message represents a chat message
 type Message struct {
-	ID             string
-	ConversationID string
-	Role           string
-	Content        string
-	ToolCalls      []ToolCall
-	ToolCallID     string
-	TokensUsed     int
-	CreatedAt      time.Time
+	ID              string
+	ConversationID  string
+	Role            string
+	Content         string
+	ToolCalls       []ToolCall
+	ToolCallID      string
+	TokensUsed      int
+	Metadata        map[string]interface{} // Such as the provider and model of a turn that overrode the conversation's
+	ClientMessageID string                 // ID the sending client gave a user message, if any
+	Status          string                 // "" once complete, or one of the MessageStatus constants
+	CreatedAt       time.Time
 }
 
 // ToolCall represents a tool call in a message
@@ -40,9 +66,18 @@ type ToolCall struct {
 	Parameters map[string]interface{} `json:"parameters"`
 }
 
+// ErrVersionConflict is returned when a conversation was modified concurrently
+var ErrVersionConflict = errors.New("conversation version conflict")
+
+// ErrDuplicateMessage is returned when a conversation already has a message
+// with the client message ID being saved
+var ErrDuplicateMessage = errors.New("duplicate client message ID")
+
 // ConversationRepository handles conversation database operations
 type ConversationRepository struct {
-	db *sql.DB
+	db                *sql.DB
+	encryptionService *security.EncryptionService
+	encrypt           bool // Summaries are stored encrypted
 }
 
 // NewConversationRepository creates a new conversation repository
@@ -50,6 +85,14 @@ func NewConversationRepository(db *sql.DB) *ConversationRepository {
 	return &ConversationRepository{db: db}
 }
 
+// SetEncryption stores new conversation summaries encrypted with the
+// encryption service, as summaries of encrypted messages would otherwise
+// give their content away. Encrypted summaries are read with it either way.
+func (r *ConversationRepository) SetEncryption(encryptionService *security.EncryptionService, encrypt bool) {
+	r.encryptionService = encryptionService
+	r.encrypt = encrypt && encryptionService != nil
+}
+
 // Create creates a new conversation
 func (r *ConversationRepository) Create(userID, provider, model, systemPrompt string) (*Conversation, error) {
 	id := uuid.New().String()
@@ -77,15 +120,10 @@ func (r *ConversationRepository) Create(userID, provider, model, systemPrompt st
 
 // GetByID retrieves a conversation by ID
 func (r *ConversationRepository) GetByID(id string) (*Conversation, error) {
-	conv := &Conversation{}
-	var title, systemPrompt sql.NullString
-
-	err := r.db.QueryRow(
-		`SELECT id, user_id, title, provider, model, system_prompt, created_at, updated_at
-		 FROM conversations WHERE id = ?`,
+	conv, err := scanConversation(r.db.QueryRow(
+		`SELECT `+conversationColumns+` FROM conversations c WHERE c.id = ?`,
 		id,
-	).Scan(&conv.ID, &conv.UserID, &title, &conv.Provider, &conv.Model, &systemPrompt, &conv.CreatedAt, &conv.UpdatedAt)
-
+	))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -93,19 +131,40 @@ func (r *ConversationRepository) GetByID(id string) (*Conversation, error) {
 		return nil, fmt.Errorf("failed to get conversation: %w", err)
 	}
 
-	conv.Title = title.String
-	conv.SystemPrompt = systemPrompt.String
-
+	if err := r.attachTags([]*Conversation{conv}); err != nil {
+		return nil, err
+	}
 	return conv, nil
 }
 
-// ListByUserID retrieves all conversations for a user
-func (r *ConversationRepository) ListByUserID(userID string, limit, offset int) ([]*Conversation, error) {
-	rows, err := r.db.Query(
-		`SELECT id, user_id, title, provider, model, system_prompt, created_at, updated_at
-		 FROM conversations WHERE user_id = ? ORDER BY updated_at DESC LIMIT ? OFFSET ?`,
-		userID, limit, offset,
-	)
+// ListByUserID retrieves a user's conversations matching the filter, pinned
+// ones first and then the most recently updated
+func (r *ConversationRepository) ListByUserID(userID string, filter ConversationFilter, limit, offset int) ([]*Conversation, error) {
+	query := `SELECT ` + conversationColumns + ` FROM conversations c WHERE c.user_id = ?`
+	args := []interface{}{userID}
+
+	switch filter.Archived {
+	case ArchivedOnly:
+		query += ` AND c.archived_at IS NOT NULL`
+	case ArchivedAll:
+	default:
+		query += ` AND c.archived_at IS NULL`
+	}
+	if filter.PinnedOnly {
+		query += ` AND c.pinned_at IS NOT NULL`
+	}
+	if filter.Folder != "" {
+		query += ` AND c.folder = ?`
+		args = append(args, filter.Folder)
+	}
+	if filter.Tag != "" {
+		query += ` AND EXISTS (SELECT 1 FROM conversation_tags t WHERE t.conversation_id = c.id AND t.tag = ?)`
+		args = append(args, filter.Tag)
+	}
+	query += ` ORDER BY c.pinned_at IS NULL, c.pinned_at DESC, c.updated_at DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list conversations: %w", err)
 	}
@@ -113,19 +172,19 @@ func (r *ConversationRepository) ListByUserID(userID string, limit, offset int)
 
 	var conversations []*Conversation
 	for rows.Next() {
-		conv := &Conversation{}
-		var title, systemPrompt sql.NullString
-
-		err := rows.Scan(&conv.ID, &conv.UserID, &title, &conv.Provider, &conv.Model, &systemPrompt, &conv.CreatedAt, &conv.UpdatedAt)
+		conv, err := scanConversation(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan conversation: %w", err)
 		}
-
-		conv.Title = title.String
-		conv.SystemPrompt = systemPrompt.String
 		conversations = append(conversations, conv)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
 
+	if err := r.attachTags(conversations); err != nil {
+		return nil, err
+	}
 	return conversations, nil
 }
 
@@ -150,19 +209,102 @@ func (r *ConversationRepository) Delete(id string) error {
 	return nil
 }
 
+// GetVersion returns the current version of a conversation
+func (r *ConversationRepository) GetVersion(id string) (int64, error) {
+	var version sql.NullInt64
+	err := r.db.QueryRow(`SELECT version FROM conversations WHERE id = ?`, id).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get conversation version: %w", err)
+	}
+	return version.Int64, nil
+}
+
+// SetSummary stores a conversation's summary, as JSON
+func (r *ConversationRepository) SetSummary(id, summary string) error {
+	var value interface{} = summary
+	var nonce []byte
+	if r.encrypt {
+		ciphertext, n, err := r.encryptionService.Encrypt([]byte(summary))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt conversation summary: %w", err)
+		}
+		value, nonce = ciphertext, n
+	}
+
+	_, err := r.db.Exec(`UPDATE conversations SET summary = ?, summary_nonce = ? WHERE id = ?`, value, nonce, id)
+	if err != nil {
+		return fmt.Errorf("failed to save conversation summary: %w", err)
+	}
+	return nil
+}
+
+// GetSummary returns a conversation's summary as JSON, or "" if it has none
+func (r *ConversationRepository) GetSummary(id string) (string, error) {
+	var summary, nonce []byte
+	err := r.db.QueryRow(`SELECT summary, summary_nonce FROM conversations WHERE id = ?`, id).Scan(&summary, &nonce)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get conversation summary: %w", err)
+	}
+	if nonce == nil {
+		return string(summary), nil
+	}
+	if r.encryptionService == nil {
+		return "", fmt.Errorf("conversation summary is encrypted")
+	}
+	plaintext, err := r.encryptionService.Decrypt(summary, nonce)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt conversation summary: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// IncrementVersion bumps the conversation version and returns the new value.
+// If expected is non-nil the update only succeeds when the stored version
+// still matches it; otherwise ErrVersionConflict is returned.
+func (r *ConversationRepository) IncrementVersion(id string, expected *int64) (int64, error) {
+	var result sql.Result
+	var err error
+	if expected != nil {
+		result, err = r.db.Exec(
+			`UPDATE conversations SET version = COALESCE(version, 0) + 1, updated_at = ?
+			 WHERE id = ? AND COALESCE(version, 0) = ?`,
+			time.Now(), id, *expected,
+		)
+	} else {
+		result, err = r.db.Exec(
+			`UPDATE conversations SET version = COALESCE(version, 0) + 1, updated_at = ? WHERE id = ?`,
+			time.Now(), id,
+		)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment conversation version: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment conversation version: %w", err)
+	}
+	if affected == 0 {
+		return 0, ErrVersionConflict
+	}
+
+	return r.GetVersion(id)
+}
+
 // Search searches conversations by title or message content for a user
 func (r *ConversationRepository) Search(userID, query string, limit int) ([]*Conversation, error) {
 	if limit <= 0 {
 		limit = 20
 	}
 
-	// Search in conversation titles and message content
+	// Search in conversation titles and message content; encrypted content
+	// can't be searched
 	searchPattern := "%" + query + "%"
 	rows, err := r.db.Query(
-		`SELECT DISTINCT c.id, c.user_id, c.title, c.provider, c.model, c.system_prompt, c.created_at, c.updated_at
+		`SELECT DISTINCT `+conversationColumns+`
 		 FROM conversations c
 		 LEFT JOIN messages m ON c.id = m.conversation_id
-		 WHERE c.user_id = ? AND (c.title LIKE ? OR m.content LIKE ?)
+		 WHERE c.user_id = ? AND (c.title LIKE ? OR (m.content_nonce IS NULL AND m.content LIKE ?))
 		 ORDER BY c.updated_at DESC
 		 LIMIT ?`,
 		userID, searchPattern, searchPattern, limit,
@@ -174,57 +316,425 @@ func (r *ConversationRepository) Search(userID, query string, limit int) ([]*Con
 
 	var conversations []*Conversation
 	for rows.Next() {
-		conv := &Conversation{}
-		var title, systemPrompt sql.NullString
-
-		err := rows.Scan(&conv.ID, &conv.UserID, &title, &conv.Provider, &conv.Model, &systemPrompt, &conv.CreatedAt, &conv.UpdatedAt)
+		conv, err := scanConversation(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan conversation: %w", err)
 		}
-
-		conv.Title = title.String
-		conv.SystemPrompt = systemPrompt.String
 		conversations = append(conversations, conv)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search conversations: %w", err)
+	}
 
+	if err := r.attachTags(conversations); err != nil {
+		return nil, err
+	}
 	return conversations, nil
 }
 
+// SetArchived archives or unarchives a user's conversations, returning how
+// many were changed
+func (r *ConversationRepository) SetArchived(userID string, ids []string, archived bool) (int64, error) {
+	var archivedAt interface{}
+	if archived {
+		archivedAt = time.Now()
+	}
+	return r.updateOwned(userID, ids, `archived_at = ?`, archivedAt)
+}
+
+// SetPinned pins or unpins a user's conversations, returning how many were
+// changed
+func (r *ConversationRepository) SetPinned(userID string, ids []string, pinned bool) (int64, error) {
+	var pinnedAt interface{}
+	if pinned {
+		pinnedAt = time.Now()
+	}
+	return r.updateOwned(userID, ids, `pinned_at = ?`, pinnedAt)
+}
+
+// SetFolder moves a user's conversations into a folder ("" for none),
+// returning how many were changed
+func (r *ConversationRepository) SetFolder(userID string, ids []string, folder string) (int64, error) {
+	return r.updateOwned(userID, ids, `folder = ?`, sql.NullString{String: folder, Valid: folder != ""})
+}
+
+// SetToolHistoryKeep sets how many recent tool results a user's conversation
+// sends to models whole; nil goes back to the server's default
+func (r *ConversationRepository) SetToolHistoryKeep(userID, id string, keep *int) error {
+	_, err := r.updateOwned(userID, []string{id}, `tool_history_keep = ?`, keep)
+	return err
+}
+
+// SetLLMDebug turns capturing a user's conversation's provider traffic on or
+// off
+func (r *ConversationRepository) SetLLMDebug(userID, id string, enabled bool) error {
+	_, err := r.updateOwned(userID, []string{id}, `llm_debug = ?`, enabled)
+	return err
+}
+
+// updateOwned applies a SET clause to the listed conversations the user owns
+func (r *ConversationRepository) updateOwned(userID string, ids []string, set string, value interface{}) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	args := []interface{}{value, userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	result, err := r.db.Exec(
+		`UPDATE conversations SET `+set+` WHERE user_id = ? AND id IN (`+placeholders(len(ids))+`)`,
+		args...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update conversations: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SetTags replaces a conversation's tags
+func (r *ConversationRepository) SetTags(id string, tags []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM conversation_tags WHERE conversation_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to clear conversation tags: %w", err)
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(
+			`INSERT OR IGNORE INTO conversation_tags (conversation_id, tag) VALUES (?, ?)`,
+			id, tag,
+		); err != nil {
+			return fmt.Errorf("failed to tag conversation: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit conversation tags: %w", err)
+	}
+	return nil
+}
+
+// AddTag tags a user's conversations, returning how many were owned by them
+func (r *ConversationRepository) AddTag(userID string, ids []string, tag string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	args := []interface{}{tag, userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	if _, err := r.db.Exec(
+		`INSERT OR IGNORE INTO conversation_tags (conversation_id, tag)
+		 SELECT id, ? FROM conversations WHERE user_id = ? AND id IN (`+placeholders(len(ids))+`)`,
+		args...,
+	); err != nil {
+		return 0, fmt.Errorf("failed to tag conversations: %w", err)
+	}
+	return r.countOwned(userID, ids)
+}
+
+// RemoveTag untags a user's conversations, returning how many were owned by
+// them
+func (r *ConversationRepository) RemoveTag(userID string, ids []string, tag string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	args := []interface{}{tag, userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	if _, err := r.db.Exec(
+		`DELETE FROM conversation_tags WHERE tag = ? AND conversation_id IN (
+			SELECT id FROM conversations WHERE user_id = ? AND id IN (`+placeholders(len(ids))+`)
+		 )`,
+		args...,
+	); err != nil {
+		return 0, fmt.Errorf("failed to untag conversations: %w", err)
+	}
+	return r.countOwned(userID, ids)
+}
+
+// DeleteOwned deletes a user's conversations, returning how many were
+// deleted
+func (r *ConversationRepository) DeleteOwned(userID string, ids []string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	result, err := r.db.Exec(
+		`DELETE FROM conversations WHERE user_id = ? AND id IN (`+placeholders(len(ids))+`)`,
+		args...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete conversations: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// countOwned counts the listed conversations the user owns
+func (r *ConversationRepository) countOwned(userID string, ids []string) (int64, error) {
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	var count int64
+	err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM conversations WHERE user_id = ? AND id IN (`+placeholders(len(ids))+`)`,
+		args...,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count conversations: %w", err)
+	}
+	return count, nil
+}
+
+// FolderCount is a folder or tag with the number of conversations in it
+type FolderCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// ListFolders lists the folders a user has put conversations in, with how
+// many conversations each holds
+func (r *ConversationRepository) ListFolders(userID string) ([]*FolderCount, error) {
+	return r.listCounts(
+		`SELECT folder, COUNT(*) FROM conversations
+		 WHERE user_id = ? AND folder IS NOT NULL AND folder != ''
+		 GROUP BY folder ORDER BY folder`,
+		userID,
+	)
+}
+
+// ListTags lists the tags a user has used, with how many conversations carry
+// each
+func (r *ConversationRepository) ListTags(userID string) ([]*FolderCount, error) {
+	return r.listCounts(
+		`SELECT t.tag, COUNT(*) FROM conversation_tags t
+		 JOIN conversations c ON c.id = t.conversation_id
+		 WHERE c.user_id = ?
+		 GROUP BY t.tag ORDER BY t.tag`,
+		userID,
+	)
+}
+
+func (r *ConversationRepository) listCounts(query, userID string) ([]*FolderCount, error) {
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversation folders: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []*FolderCount{}
+	for rows.Next() {
+		fc := &FolderCount{}
+		if err := rows.Scan(&fc.Name, &fc.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation folder: %w", err)
+		}
+		counts = append(counts, fc)
+	}
+	return counts, rows.Err()
+}
+
+// attachTags loads the tags of the given conversations
+func (r *ConversationRepository) attachTags(conversations []*Conversation) error {
+	if len(conversations) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*Conversation, len(conversations))
+	args := make([]interface{}, len(conversations))
+	for i, conv := range conversations {
+		byID[conv.ID] = conv
+		args[i] = conv.ID
+	}
+
+	rows, err := r.db.Query(
+		`SELECT conversation_id, tag FROM conversation_tags
+		 WHERE conversation_id IN (`+placeholders(len(args))+`)
+		 ORDER BY tag`,
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get conversation tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var convID, tag string
+		if err := rows.Scan(&convID, &tag); err != nil {
+			return fmt.Errorf("failed to scan conversation tag: %w", err)
+		}
+		if conv := byID[convID]; conv != nil {
+			conv.Tags = append(conv.Tags, tag)
+		}
+	}
+	return rows.Err()
+}
+
+const conversationColumns = `c.id, c.user_id, c.title, c.provider, c.model, c.system_prompt,
+	c.folder, c.pinned_at, c.archived_at, c.tool_history_keep, COALESCE(c.llm_debug, 0), c.created_at, c.updated_at`
+
+func scanConversation(row interface{ Scan(...interface{}) error }) (*Conversation, error) {
+	conv := &Conversation{}
+	var title, systemPrompt, folder sql.NullString
+	var pinnedAt, archivedAt sql.NullTime
+	var toolHistoryKeep sql.NullInt64
+
+	err := row.Scan(&conv.ID, &conv.UserID, &title, &conv.Provider, &conv.Model, &systemPrompt,
+		&folder, &pinnedAt, &archivedAt, &toolHistoryKeep, &conv.LLMDebug, &conv.CreatedAt, &conv.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	conv.Title = title.String
+	conv.SystemPrompt = systemPrompt.String
+	conv.Folder = folder.String
+	if pinnedAt.Valid {
+		conv.PinnedAt = &pinnedAt.Time
+	}
+	if archivedAt.Valid {
+		conv.ArchivedAt = &archivedAt.Time
+	}
+	if toolHistoryKeep.Valid {
+		keep := int(toolHistoryKeep.Int64)
+		conv.ToolHistoryKeep = &keep
+	}
+	return conv, nil
+}
+
+// placeholders returns n comma-separated SQL placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// Statuses of assistant messages saved while their reply streams
+const (
+	MessageStatusPartial     = "partial"     // Still streaming
+	MessageStatusInterrupted = "interrupted" // The server stopped before the reply finished
+)
+
 // MessageRepository handles message database operations
 type MessageRepository struct {
-	db *sql.DB
+	db                *sql.DB
+	encryptionService *security.EncryptionService
+	encrypt           bool
+}
+
+// NewMessageRepository creates a new message repository. With encrypt set,
+// the content and tool calls of new messages are stored encrypted with the
+// encryption service; roles, timestamps, token counts and metadata stay in
+// plaintext. Messages stored either way can be read.
+func NewMessageRepository(db *sql.DB, encryptionService *security.EncryptionService, encrypt bool) *MessageRepository {
+	if encryptionService == nil {
+		encrypt = false
+	}
+	return &MessageRepository{
+		db:                db,
+		encryptionService: encryptionService,
+		encrypt:           encrypt,
+	}
+}
+
+// sealContent returns content as it is stored, with its nonce if it is encrypted
+func (r *MessageRepository) sealContent(content string) (interface{}, []byte, error) {
+	if !r.encrypt {
+		return content, nil, nil
+	}
+	ciphertext, nonce, err := r.encryptionService.Encrypt([]byte(content))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	return ciphertext, nonce, nil
+}
+
+// sealToolCalls returns tool calls as they are stored, NULL if there are
+// none, with their nonce if they are encrypted
+func (r *MessageRepository) sealToolCalls(toolCalls []ToolCall) (interface{}, []byte, error) {
+	if len(toolCalls) == 0 {
+		return nil, nil, nil
+	}
+	data, err := json.Marshal(toolCalls)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal tool calls: %w", err)
+	}
+	if !r.encrypt {
+		return string(data), nil, nil
+	}
+	ciphertext, nonce, err := r.encryptionService.Encrypt(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt tool calls: %w", err)
+	}
+	return ciphertext, nonce, nil
 }
 
-// NewMessageRepository creates a new message repository
-func NewMessageRepository(db *sql.DB) *MessageRepository {
-	return &MessageRepository{db: db}
+// open returns a stored value in plaintext, decrypting it if it has a nonce
+func (r *MessageRepository) open(value, nonce []byte) ([]byte, error) {
+	if nonce == nil {
+		return value, nil
+	}
+	if r.encryptionService == nil {
+		return nil, fmt.Errorf("message is encrypted")
+	}
+	return r.encryptionService.Decrypt(value, nonce)
 }
 
 // Create creates a new message
 func (r *MessageRepository) Create(conversationID, role, content string, toolCalls []ToolCall, toolCallID string) (*Message, error) {
+	return r.create(conversationID, role, content, toolCalls, toolCallID, "", "")
+}
+
+// CreateFromClient creates a user message carrying the ID its client gave
+// it. It returns ErrDuplicateMessage if the conversation already has a
+// message with that ID.
+func (r *MessageRepository) CreateFromClient(conversationID, content, clientMessageID string) (*Message, error) {
+	return r.create(conversationID, "user", content, nil, "", clientMessageID, "")
+}
+
+func (r *MessageRepository) create(conversationID, role, content string, toolCalls []ToolCall, toolCallID, clientMessageID, status string) (*Message, error) {
 	id := uuid.New().String()
 	now := time.Now()
 
-	var toolCallsJSON sql.NullString
-	if len(toolCalls) > 0 {
-		data, err := json.Marshal(toolCalls)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal tool calls: %w", err)
-		}
-		toolCallsJSON = sql.NullString{String: string(data), Valid: true}
+	storedContent, contentNonce, err := r.sealContent(content)
+	if err != nil {
+		return nil, err
+	}
+	storedToolCalls, toolCallsNonce, err := r.sealToolCalls(toolCalls)
+	if err != nil {
+		return nil, err
 	}
 
 	var toolCallIDNull sql.NullString
 	if toolCallID != "" {
 		toolCallIDNull = sql.NullString{String: toolCallID, Valid: true}
 	}
+	var clientMessageIDNull sql.NullString
+	if clientMessageID != "" {
+		clientMessageIDNull = sql.NullString{String: clientMessageID, Valid: true}
+	}
+	var statusNull sql.NullString
+	if status != "" {
+		statusNull = sql.NullString{String: status, Valid: true}
+	}
 
-	_, err := r.db.Exec(
-		`INSERT INTO messages (id, conversation_id, role, content, tool_calls, tool_call_id, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		id, conversationID, role, content, toolCallsJSON, toolCallIDNull, now,
+	_, err = r.db.Exec(
+		`INSERT INTO messages (id, conversation_id, role, content, content_nonce, tool_calls, tool_calls_nonce, tool_call_id, client_message_id, status, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, conversationID, role, storedContent, contentNonce, storedToolCalls, toolCallsNonce, toolCallIDNull, clientMessageIDNull, statusNull, now,
 	)
 	if err != nil {
+		if clientMessageID != "" && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, ErrDuplicateMessage
+		}
 		return nil, fmt.Errorf("failed to create message: %w", err)
 	}
 
@@ -232,21 +742,141 @@ func (r *MessageRepository) Create(conversationID, role, content string, toolCal
 	_, _ = r.db.Exec(`UPDATE conversations SET updated_at = ? WHERE id = ?`, now, conversationID)
 
 	return &Message{
-		ID:             id,
-		ConversationID: conversationID,
-		Role:           role,
-		Content:        content,
-		ToolCalls:      toolCalls,
-		ToolCallID:     toolCallID,
-		CreatedAt:      now,
+		ID:              id,
+		ConversationID:  conversationID,
+		Role:            role,
+		Content:         content,
+		ToolCalls:       toolCalls,
+		ToolCallID:      toolCallID,
+		ClientMessageID: clientMessageID,
+		Status:          status,
+		CreatedAt:       now,
 	}, nil
 }
 
+// CreatePartial creates an assistant message for a reply that is still
+// streaming. Update it with UpdatePartial and Finalize it once it's done.
+func (r *MessageRepository) CreatePartial(conversationID, content string) (*Message, error) {
+	return r.create(conversationID, "assistant", content, nil, "", "", MessageStatusPartial)
+}
+
+// UpdatePartial saves more of a partial message's content
+func (r *MessageRepository) UpdatePartial(id, content string) error {
+	storedContent, contentNonce, err := r.sealContent(content)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
+		`UPDATE messages SET content = ?, content_nonce = ? WHERE id = ? AND status = ?`,
+		storedContent, contentNonce, id, MessageStatusPartial,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update partial message: %w", err)
+	}
+	return nil
+}
+
+// Finalize saves a partial message's full content and tool calls and marks
+// it complete
+func (r *MessageRepository) Finalize(id, content string, toolCalls []ToolCall) error {
+	storedContent, contentNonce, err := r.sealContent(content)
+	if err != nil {
+		return err
+	}
+	storedToolCalls, toolCallsNonce, err := r.sealToolCalls(toolCalls)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(
+		`UPDATE messages SET content = ?, content_nonce = ?, tool_calls = ?, tool_calls_nonce = ?, status = NULL WHERE id = ?`,
+		storedContent, contentNonce, storedToolCalls, toolCallsNonce, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to finalize message: %w", err)
+	}
+	return nil
+}
+
+// InterruptPartials marks messages left partial (e.g. by a restart
+// mid-stream) as interrupted, keeping what was generated
+func (r *MessageRepository) InterruptPartials() (int64, error) {
+	result, err := r.db.Exec(
+		`UPDATE messages SET status = ? WHERE status = ?`,
+		MessageStatusInterrupted, MessageStatusPartial,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to interrupt partial messages: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SetTokensUsed records the tokens an LLM response consumed
+func (r *MessageRepository) SetTokensUsed(id string, tokens int) error {
+	_, err := r.db.Exec(`UPDATE messages SET tokens_used = ? WHERE id = ?`, tokens, id)
+	if err != nil {
+		return fmt.Errorf("failed to set message tokens: %w", err)
+	}
+	return nil
+}
+
+// SetMetadata records metadata on a message, replacing any it had
+func (r *MessageRepository) SetMetadata(id string, metadata map[string]interface{}) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message metadata: %w", err)
+	}
+	_, err = r.db.Exec(`UPDATE messages SET metadata = ? WHERE id = ?`, string(data), id)
+	if err != nil {
+		return fmt.Errorf("failed to set message metadata: %w", err)
+	}
+	return nil
+}
+
+// messageColumns are the columns scanMessage reads
+const messageColumns = `id, conversation_id, role, content, content_nonce, tool_calls, tool_calls_nonce, tool_call_id, tokens_used, metadata, client_message_id, status, created_at`
+
+func (r *MessageRepository) scanMessage(row interface{ Scan(...interface{}) error }) (*Message, error) {
+	msg := &Message{}
+	var content, contentNonce, toolCallsJSON, toolCallsNonce []byte
+	var toolCallID, metadataJSON, clientMessageID, status sql.NullString
+	var tokensUsed sql.NullInt64
+
+	err := row.Scan(&msg.ID, &msg.ConversationID, &msg.Role, &content, &contentNonce, &toolCallsJSON, &toolCallsNonce, &toolCallID, &tokensUsed, &metadataJSON, &clientMessageID, &status, &msg.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if content, err = r.open(content, contentNonce); err != nil {
+		return nil, fmt.Errorf("failed to decrypt message %s: %w", msg.ID, err)
+	}
+	msg.Content = string(content)
+	if toolCallsJSON != nil {
+		if toolCallsJSON, err = r.open(toolCallsJSON, toolCallsNonce); err != nil {
+			return nil, fmt.Errorf("failed to decrypt tool calls of message %s: %w", msg.ID, err)
+		}
+		if err := json.Unmarshal(toolCallsJSON, &msg.ToolCalls); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal tool calls: %w", err)
+		}
+	}
+	if metadataJSON.Valid {
+		if err := json.Unmarshal([]byte(metadataJSON.String), &msg.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal message metadata: %w", err)
+		}
+	}
+
+	msg.ToolCallID = toolCallID.String
+	msg.TokensUsed = int(tokensUsed.Int64)
+	msg.ClientMessageID = clientMessageID.String
+	msg.Status = status.String
+	return msg, nil
+}
+
 // ListByConversationID retrieves all messages for a conversation
 func (r *MessageRepository) ListByConversationID(conversationID string) ([]*Message, error) {
 	rows, err := r.db.Query(
-		`SELECT id, conversation_id, role, content, tool_calls, tool_call_id, tokens_used, created_at
-		 FROM messages WHERE conversation_id = ? ORDER BY created_at ASC`,
+		`SELECT `+messageColumns+`
+		 FROM messages WHERE conversation_id = ? ORDER BY created_at ASC, rowid ASC`,
 		conversationID,
 	)
 	if err != nil {
@@ -256,56 +886,140 @@ func (r *MessageRepository) ListByConversationID(conversationID string) ([]*Mess
 
 	var messages []*Message
 	for rows.Next() {
-		msg := &Message{}
-		var toolCallsJSON, toolCallID sql.NullString
-		var tokensUsed sql.NullInt64
-
-		err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.Role, &msg.Content, &toolCallsJSON, &toolCallID, &tokensUsed, &msg.CreatedAt)
+		msg, err := r.scanMessage(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
 		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// ErrMessageNotFound is returned when a page of messages is asked for
+// relative to a message the conversation doesn't have
+var ErrMessageNotFound = errors.New("message not found")
 
-		if toolCallsJSON.Valid {
-			if err := json.Unmarshal([]byte(toolCallsJSON.String), &msg.ToolCalls); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal tool calls: %w", err)
-			}
+// MessagePage selects a page of a conversation's messages. Without a cursor
+// the page starts at the beginning of the order; with one it holds the
+// messages next to the cursor on that side.
+type MessagePage struct {
+	Before string // Only messages before this message ID
+	After  string // Only messages after this message ID
+	Limit  int    // At most this many messages; 0 for all
+	Newest bool   // Newest first instead of oldest first
+}
+
+// ListPage retrieves a page of a conversation's messages, and whether there
+// are more beyond it, away from the cursor
+func (r *MessageRepository) ListPage(conversationID string, page MessagePage) ([]*Message, bool, error) {
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE conversation_id = ?`
+	args := []interface{}{conversationID}
+
+	for _, cursor := range []struct {
+		id, op string
+	}{{page.Before, "<"}, {page.After, ">"}} {
+		if cursor.id == "" {
+			continue
+		}
+		var exists bool
+		err := r.db.QueryRow(
+			`SELECT EXISTS (SELECT 1 FROM messages WHERE id = ? AND conversation_id = ?)`,
+			cursor.id, conversationID,
+		).Scan(&exists)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to find message: %w", err)
 		}
+		if !exists {
+			return nil, false, ErrMessageNotFound
+		}
+		query += ` AND (created_at, rowid) ` + cursor.op + ` (SELECT created_at, rowid FROM messages WHERE id = ?)`
+		args = append(args, cursor.id)
+	}
 
-		msg.ToolCallID = toolCallID.String
-		msg.TokensUsed = int(tokensUsed.Int64)
+	// Fetch from the cursor outwards: back from a before cursor, forwards from
+	// an after cursor, or from the start of the order without one
+	descending := page.Newest
+	if page.Before != "" && page.After == "" {
+		descending = true
+	} else if page.After != "" {
+		descending = false
+	}
+	if descending {
+		query += ` ORDER BY created_at DESC, rowid DESC`
+	} else {
+		query += ` ORDER BY created_at ASC, rowid ASC`
+	}
+	if page.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, page.Limit+1)
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		msg, err := r.scanMessage(rows)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to scan message: %w", err)
+		}
 		messages = append(messages, msg)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to list messages: %w", err)
+	}
 
-	return messages, nil
+	hasMore := page.Limit > 0 && len(messages) > page.Limit
+	if hasMore {
+		messages = messages[:page.Limit]
+	}
+	if descending != page.Newest {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, hasMore, nil
+}
+
+// CountByConversationID counts a conversation's messages
+func (r *MessageRepository) CountByConversationID(conversationID string) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE conversation_id = ?`, conversationID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+	return count, nil
 }
 
 // GetByID retrieves a message by ID
 func (r *MessageRepository) GetByID(id string) (*Message, error) {
-	msg := &Message{}
-	var toolCallsJSON, toolCallID sql.NullString
-	var tokensUsed sql.NullInt64
-
-	err := r.db.QueryRow(
-		`SELECT id, conversation_id, role, content, tool_calls, tool_call_id, tokens_used, created_at
-		 FROM messages WHERE id = ?`,
-		id,
-	).Scan(&msg.ID, &msg.ConversationID, &msg.Role, &msg.Content, &toolCallsJSON, &toolCallID, &tokensUsed, &msg.CreatedAt)
-
+	msg, err := r.scanMessage(r.db.QueryRow(`SELECT `+messageColumns+` FROM messages WHERE id = ?`, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get message: %w", err)
 	}
+	return msg, nil
+}
 
-	if toolCallsJSON.Valid {
-		if err := json.Unmarshal([]byte(toolCallsJSON.String), &msg.ToolCalls); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal tool calls: %w", err)
-		}
+// GetByClientMessageID retrieves a conversation's message by the ID its
+// client gave it, or nil if there is none
+func (r *MessageRepository) GetByClientMessageID(conversationID, clientMessageID string) (*Message, error) {
+	var id string
+	err := r.db.QueryRow(
+		`SELECT id FROM messages WHERE conversation_id = ? AND client_message_id = ?`,
+		conversationID, clientMessageID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-
-	msg.ToolCallID = toolCallID.String
-	msg.TokensUsed = int(tokensUsed.Int64)
-
-	return msg, nil
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return r.GetByID(id)
 }
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Conversation share roles
+const (
+	ShareRoleViewer = "viewer"
+	ShareRoleEditor = "editor"
+)
+
+// ConversationShare represents another user's access to a conversation
+type ConversationShare struct {
+	ID             string
+	ConversationID string
+	UserID         string
+	Email          string
+	Role           string
+	CreatedAt      time.Time
+}
+
+// ConversationShareRepository handles conversation share database operations
+type ConversationShareRepository struct {
+	db *sql.DB
+}
+
+// NewConversationShareRepository creates a new conversation share repository
+func NewConversationShareRepository(db *sql.DB) *ConversationShareRepository {
+	return &ConversationShareRepository{db: db}
+}
+
+// IsValidShareRole reports whether role is a known share role
+func IsValidShareRole(role string) bool {
+	return role == ShareRoleViewer || role == ShareRoleEditor
+}
+
+// Upsert shares a conversation with a user, updating the role if already shared
+func (r *ConversationShareRepository) Upsert(conversationID, userID, role string) (*ConversationShare, error) {
+	id := uuid.New().String()
+	now := time.Now()
+
+	_, err := r.db.Exec(
+		`INSERT INTO conversation_shares (id, conversation_id, user_id, role, created_at)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(conversation_id, user_id) DO UPDATE SET role = excluded.role`,
+		id, conversationID, userID, role, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to share conversation: %w", err)
+	}
+
+	return r.Get(conversationID, userID)
+}
+
+// Get retrieves the share for a user on a conversation
+func (r *ConversationShareRepository) Get(conversationID, userID string) (*ConversationShare, error) {
+	share := &ConversationShare{}
+
+	err := r.db.QueryRow(
+		`SELECT s.id, s.conversation_id, s.user_id, u.email, s.role, s.created_at
+		 FROM conversation_shares s
+		 JOIN users u ON u.id = s.user_id
+		 WHERE s.conversation_id = ? AND s.user_id = ?`,
+		conversationID, userID,
+	).Scan(&share.ID, &share.ConversationID, &share.UserID, &share.Email, &share.Role, &share.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation share: %w", err)
+	}
+
+	return share, nil
+}
+
+// ListByConversationID retrieves all shares for a conversation
+func (r *ConversationShareRepository) ListByConversationID(conversationID string) ([]*ConversationShare, error) {
+	rows, err := r.db.Query(
+		`SELECT s.id, s.conversation_id, s.user_id, u.email, s.role, s.created_at
+		 FROM conversation_shares s
+		 JOIN users u ON u.id = s.user_id
+		 WHERE s.conversation_id = ?
+		 ORDER BY s.created_at ASC`,
+		conversationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversation shares: %w", err)
+	}
+	defer rows.Close()
+
+	var shares []*ConversationShare
+	for rows.Next() {
+		share := &ConversationShare{}
+		if err := rows.Scan(&share.ID, &share.ConversationID, &share.UserID, &share.Email, &share.Role, &share.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation share: %w", err)
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, nil
+}
+
+// ListSharedWithUser retrieves conversations other users have shared with a user
+func (r *ConversationShareRepository) ListSharedWithUser(userID string) ([]*Conversation, error) {
+	rows, err := r.db.Query(
+		`SELECT c.id, c.user_id, c.title, c.provider, c.model, c.system_prompt, c.created_at, c.updated_at
+		 FROM conversations c
+		 JOIN conversation_shares s ON s.conversation_id = c.id
+		 WHERE s.user_id = ?
+		 ORDER BY c.updated_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shared conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []*Conversation
+	for rows.Next() {
+		conv := &Conversation{}
+		var title, systemPrompt sql.NullString
+
+		err := rows.Scan(&conv.ID, &conv.UserID, &title, &conv.Provider, &conv.Model, &systemPrompt, &conv.CreatedAt, &conv.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+
+		conv.Title = title.String
+		conv.SystemPrompt = systemPrompt.String
+		conversations = append(conversations, conv)
+	}
+
+	return conversations, nil
+}
+
+// Delete removes a user's access to a conversation
+func (r *ConversationShareRepository) Delete(conversationID, userID string) error {
+	_, err := r.db.Exec(
+		`DELETE FROM conversation_shares WHERE conversation_id = ? AND user_id = ?`,
+		conversationID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation share: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Digest frequencies
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DigestSchedule holds when a user's activity digest is sent. Hour and
+// Weekday are in the user's Timezone; Weekday only applies to weekly digests.
+type DigestSchedule struct {
+	UserID     string
+	Frequency  string
+	Hour       int
+	Weekday    time.Weekday
+	Timezone   string
+	Enabled    bool
+	LastSentAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Period returns how much activity one digest covers
+func (s *DigestSchedule) Period() time.Duration {
+	if s.Frequency == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Location returns the schedule's timezone, falling back to UTC
+func (s *DigestSchedule) Location() *time.Location {
+	if loc, err := time.LoadLocation(s.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// LastScheduled returns the latest time at or before now that a digest was
+// scheduled for
+func (s *DigestSchedule) LastScheduled(now time.Time) time.Time {
+	local := now.In(s.Location())
+	scheduled := time.Date(local.Year(), local.Month(), local.Day(), s.Hour, 0, 0, 0, local.Location())
+	if scheduled.After(local) {
+		scheduled = scheduled.AddDate(0, 0, -1)
+	}
+	if s.Frequency == DigestWeekly {
+		for scheduled.Weekday() != s.Weekday {
+			scheduled = scheduled.AddDate(0, 0, -1)
+		}
+	}
+	return scheduled
+}
+
+// Due reports whether a digest should be sent at the given time. A new or
+// changed schedule first sends at its next scheduled time.
+func (s *DigestSchedule) Due(now time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	last := s.UpdatedAt
+	if s.LastSentAt != nil && s.LastSentAt.After(last) {
+		last = *s.LastSentAt
+	}
+	return last.Before(s.LastScheduled(now))
+}
+
+// DigestScheduleRepository handles activity digest schedule database operations
+type DigestScheduleRepository struct {
+	db *sql.DB
+}
+
+// NewDigestScheduleRepository creates a new digest schedule repository
+func NewDigestScheduleRepository(db *sql.DB) *DigestScheduleRepository {
+	return &DigestScheduleRepository{db: db}
+}
+
+// Upsert creates or updates a user's digest schedule
+func (r *DigestScheduleRepository) Upsert(schedule *DigestSchedule) error {
+	now := time.Now()
+	_, err := r.db.Exec(`
+		INSERT INTO digest_schedules (user_id, frequency, hour, weekday, timezone, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			frequency = excluded.frequency,
+			hour = excluded.hour,
+			weekday = excluded.weekday,
+			timezone = excluded.timezone,
+			enabled = excluded.enabled,
+			updated_at = excluded.updated_at
+	`, schedule.UserID, schedule.Frequency, schedule.Hour, int(schedule.Weekday), schedule.Timezone, schedule.Enabled, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to save digest schedule: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a user's digest schedule
+func (r *DigestScheduleRepository) Get(userID string) (*DigestSchedule, error) {
+	row := r.db.QueryRow(`
+		SELECT user_id, frequency, hour, weekday, timezone, enabled, last_sent_at, created_at, updated_at
+		FROM digest_schedules
+		WHERE user_id = ?
+	`, userID)
+
+	schedule, err := scanDigestSchedule(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get digest schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// ListEnabled returns every enabled digest schedule
+func (r *DigestScheduleRepository) ListEnabled() ([]*DigestSchedule, error) {
+	rows, err := r.db.Query(`
+		SELECT user_id, frequency, hour, weekday, timezone, enabled, last_sent_at, created_at, updated_at
+		FROM digest_schedules
+		WHERE enabled = 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list digest schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []*DigestSchedule
+	for rows.Next() {
+		schedule, err := scanDigestSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan digest schedule: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+// MarkSent records when a user's digest was last sent
+func (r *DigestScheduleRepository) MarkSent(userID string, sentAt time.Time) error {
+	_, err := r.db.Exec(`UPDATE digest_schedules SET last_sent_at = ? WHERE user_id = ?`, sentAt, userID)
+	if err != nil {
+		return fmt.Errorf("failed to record digest: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a user's digest schedule
+func (r *DigestScheduleRepository) Delete(userID string) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM digest_schedules WHERE user_id = ?`, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete digest schedule: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete digest schedule: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// scanDigestSchedule scans a schedule from a row
+func scanDigestSchedule(row interface{ Scan(...interface{}) error }) (*DigestSchedule, error) {
+	schedule := &DigestSchedule{}
+	var weekday int
+	var lastSentAt sql.NullTime
+
+	err := row.Scan(
+		&schedule.UserID,
+		&schedule.Frequency,
+		&schedule.Hour,
+		&weekday,
+		&schedule.Timezone,
+		&schedule.Enabled,
+		&lastSentAt,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.Weekday = time.Weekday(weekday)
+	if lastSentAt.Valid {
+		schedule.LastSentAt = &lastSentAt.Time
+	}
+	return schedule, nil
+}
@@ -0,0 +1,347 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Eval run statuses
+const (
+	EvalRunRunning   = "running"
+	EvalRunCompleted = "completed"
+	EvalRunFailed    = "failed"
+	EvalRunCancelled = "cancelled"
+)
+
+// EvalSuite is a benchmark suite of agent tasks
+type EvalSuite struct {
+	ID          string
+	UserID      string
+	Name        string
+	Description string
+	Cases       string // JSON of the suite's cases
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// EvalRun is one run of a suite against a set of targets
+type EvalRun struct {
+	ID          string
+	SuiteID     string
+	UserID      string
+	Status      string // running, completed, failed or cancelled
+	Targets     string // JSON of the providers, models and configs being compared
+	Repeats     int    // Attempts of each case per target
+	Error       string
+	StartedAt   time.Time
+	CompletedAt *time.Time
+}
+
+// EvalResult is the outcome of one attempt at a case by one target
+type EvalResult struct {
+	ID               string
+	RunID            string
+	CaseName         string
+	Target           string
+	Provider         string
+	Model            string
+	Attempt          int
+	Passed           bool
+	LatencyMs        int64 // How long the agent took, not counting time queued or validating
+	TokensUsed       int
+	Output           string
+	ValidationOutput string
+	Error            string
+	CreatedAt        time.Time
+}
+
+// EvalTargetStats aggregates a target's results across a suite's runs
+type EvalTargetStats struct {
+	Target       string
+	Provider     string
+	Model        string
+	Attempts     int
+	Passed       int
+	AvgLatencyMs float64
+	AvgTokens    float64
+}
+
+// EvalRepository handles eval suite, run and result database operations
+type EvalRepository struct {
+	db *sql.DB
+}
+
+// NewEvalRepository creates a new eval repository
+func NewEvalRepository(db *sql.DB) *EvalRepository {
+	return &EvalRepository{db: db}
+}
+
+// CreateSuite stores a new suite
+func (r *EvalRepository) CreateSuite(suite *EvalSuite) error {
+	suite.ID = uuid.New().String()
+	suite.CreatedAt = time.Now()
+	suite.UpdatedAt = suite.CreatedAt
+	_, err := r.db.Exec(
+		`INSERT INTO eval_suites (id, user_id, name, description, cases, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		suite.ID, suite.UserID, suite.Name, suite.Description, suite.Cases, suite.CreatedAt, suite.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create eval suite: %w", err)
+	}
+	return nil
+}
+
+// UpdateSuite replaces a suite's name, description and cases
+func (r *EvalRepository) UpdateSuite(suite *EvalSuite) error {
+	suite.UpdatedAt = time.Now()
+	_, err := r.db.Exec(
+		`UPDATE eval_suites SET name = ?, description = ?, cases = ?, updated_at = ? WHERE id = ? AND user_id = ?`,
+		suite.Name, suite.Description, suite.Cases, suite.UpdatedAt, suite.ID, suite.UserID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update eval suite: %w", err)
+	}
+	return nil
+}
+
+// GetSuite retrieves one of a user's suites, or nil if they have no such suite
+func (r *EvalRepository) GetSuite(userID, id string) (*EvalSuite, error) {
+	suite, err := scanEvalSuite(r.db.QueryRow(
+		`SELECT id, user_id, name, description, cases, created_at, updated_at
+		 FROM eval_suites WHERE id = ? AND user_id = ?`,
+		id, userID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get eval suite: %w", err)
+	}
+	return suite, nil
+}
+
+// ListSuites lists a user's suites, most recently updated first
+func (r *EvalRepository) ListSuites(userID string) ([]*EvalSuite, error) {
+	rows, err := r.db.Query(
+		`SELECT id, user_id, name, description, cases, created_at, updated_at
+		 FROM eval_suites WHERE user_id = ? ORDER BY updated_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list eval suites: %w", err)
+	}
+	defer rows.Close()
+
+	suites := []*EvalSuite{}
+	for rows.Next() {
+		suite, err := scanEvalSuite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan eval suite: %w", err)
+		}
+		suites = append(suites, suite)
+	}
+	return suites, rows.Err()
+}
+
+// DeleteSuite removes one of a user's suites with its runs and results,
+// reporting whether it existed
+func (r *EvalRepository) DeleteSuite(userID, id string) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM eval_suites WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete eval suite: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete eval suite: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// CreateRun stores a new running run
+func (r *EvalRepository) CreateRun(run *EvalRun) error {
+	run.ID = uuid.New().String()
+	run.Status = EvalRunRunning
+	run.StartedAt = time.Now()
+	_, err := r.db.Exec(
+		`INSERT INTO eval_runs (id, suite_id, user_id, status, targets, repeats, started_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		run.ID, run.SuiteID, run.UserID, run.Status, run.Targets, run.Repeats, run.StartedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create eval run: %w", err)
+	}
+	return nil
+}
+
+// FinishRun records a run's final status
+func (r *EvalRepository) FinishRun(run *EvalRun) error {
+	now := time.Now()
+	run.CompletedAt = &now
+	_, err := r.db.Exec(
+		`UPDATE eval_runs SET status = ?, error = ?, completed_at = ? WHERE id = ?`,
+		run.Status, run.Error, run.CompletedAt, run.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to finish eval run: %w", err)
+	}
+	return nil
+}
+
+// GetRun retrieves one of a user's runs, or nil if they have no such run
+func (r *EvalRepository) GetRun(userID, id string) (*EvalRun, error) {
+	run, err := scanEvalRun(r.db.QueryRow(
+		`SELECT id, suite_id, user_id, status, targets, repeats, error, started_at, completed_at
+		 FROM eval_runs WHERE id = ? AND user_id = ?`,
+		id, userID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get eval run: %w", err)
+	}
+	return run, nil
+}
+
+// ListRuns lists a suite's runs, newest first
+func (r *EvalRepository) ListRuns(suiteID string) ([]*EvalRun, error) {
+	rows, err := r.db.Query(
+		`SELECT id, suite_id, user_id, status, targets, repeats, error, started_at, completed_at
+		 FROM eval_runs WHERE suite_id = ? ORDER BY started_at DESC`,
+		suiteID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list eval runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []*EvalRun{}
+	for rows.Next() {
+		run, err := scanEvalRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan eval run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// FailRunningRuns marks runs left running (e.g. by a restart mid-run) as
+// failed
+func (r *EvalRepository) FailRunningRuns() (int64, error) {
+	result, err := r.db.Exec(
+		`UPDATE eval_runs SET status = ?, error = ?, completed_at = ? WHERE status = ?`,
+		EvalRunFailed, "interrupted by a server restart", time.Now(), EvalRunRunning,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail running eval runs: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// AddResult stores the outcome of an attempt
+func (r *EvalRepository) AddResult(result *EvalResult) error {
+	result.ID = uuid.New().String()
+	result.CreatedAt = time.Now()
+	_, err := r.db.Exec(
+		`INSERT INTO eval_results (id, run_id, case_name, target, provider, model, attempt, passed,
+			latency_ms, tokens_used, output, validation_output, error, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		result.ID, result.RunID, result.CaseName, result.Target, result.Provider, result.Model,
+		result.Attempt, result.Passed, result.LatencyMs, result.TokensUsed, result.Output,
+		result.ValidationOutput, result.Error, result.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save eval result: %w", err)
+	}
+	return nil
+}
+
+// ListResults lists a run's results in the order they finished
+func (r *EvalRepository) ListResults(runID string) ([]*EvalResult, error) {
+	rows, err := r.db.Query(
+		`SELECT id, run_id, case_name, target, provider, model, attempt, passed, latency_ms,
+			tokens_used, output, validation_output, error, created_at
+		 FROM eval_results WHERE run_id = ? ORDER BY created_at`,
+		runID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list eval results: %w", err)
+	}
+	defer rows.Close()
+
+	results := []*EvalResult{}
+	for rows.Next() {
+		result := &EvalResult{}
+		var output, validationOutput, errText sql.NullString
+		if err := rows.Scan(&result.ID, &result.RunID, &result.CaseName, &result.Target, &result.Provider,
+			&result.Model, &result.Attempt, &result.Passed, &result.LatencyMs, &result.TokensUsed,
+			&output, &validationOutput, &errText, &result.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan eval result: %w", err)
+		}
+		result.Output = output.String
+		result.ValidationOutput = validationOutput.String
+		result.Error = errText.String
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// SuiteStats aggregates the results of every run of a suite by target
+func (r *EvalRepository) SuiteStats(suiteID string) ([]*EvalTargetStats, error) {
+	rows, err := r.db.Query(
+		`SELECT res.target, res.provider, res.model, COUNT(*), SUM(res.passed),
+			AVG(res.latency_ms), AVG(res.tokens_used)
+		 FROM eval_results res JOIN eval_runs run ON run.id = res.run_id
+		 WHERE run.suite_id = ?
+		 GROUP BY res.target, res.provider, res.model`,
+		suiteID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get eval suite stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []*EvalTargetStats{}
+	for rows.Next() {
+		s := &EvalTargetStats{}
+		if err := rows.Scan(&s.Target, &s.Provider, &s.Model, &s.Attempts, &s.Passed,
+			&s.AvgLatencyMs, &s.AvgTokens); err != nil {
+			return nil, fmt.Errorf("failed to scan eval suite stats: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// scanEvalSuite scans an eval suite row
+func scanEvalSuite(row interface{ Scan(...interface{}) error }) (*EvalSuite, error) {
+	suite := &EvalSuite{}
+	var description sql.NullString
+	if err := row.Scan(&suite.ID, &suite.UserID, &suite.Name, &description, &suite.Cases,
+		&suite.CreatedAt, &suite.UpdatedAt); err != nil {
+		return nil, err
+	}
+	suite.Description = description.String
+	return suite, nil
+}
+
+// scanEvalRun scans an eval run row
+func scanEvalRun(row interface{ Scan(...interface{}) error }) (*EvalRun, error) {
+	run := &EvalRun{}
+	var errText sql.NullString
+	var completedAt sql.NullTime
+	if err := row.Scan(&run.ID, &run.SuiteID, &run.UserID, &run.Status, &run.Targets, &run.Repeats,
+		&errText, &run.StartedAt, &completedAt); err != nil {
+		return nil, err
+	}
+	run.Error = errText.String
+	if completedAt.Valid {
+		run.CompletedAt = &completedAt.Time
+	}
+	return run, nil
+}
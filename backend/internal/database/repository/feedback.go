@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Feedback ratings
+const (
+	FeedbackUp   = 1
+	FeedbackDown = -1
+)
+
+// Feedback is a user's rating of an assistant message
+type Feedback struct {
+	ID             string
+	MessageID      string
+	ConversationID string
+	UserID         string
+	Rating         int // FeedbackUp or FeedbackDown
+	Comment        string
+	Provider       string   // Provider that wrote the message
+	Model          string   // Model that wrote the message
+	Tools          []string // Tools the model used in the turn
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// FeedbackCount totals ratings for a model or tool
+type FeedbackCount struct {
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Tool     string `json:"tool,omitempty"`
+	Up       int    `json:"up"`
+	Down     int    `json:"down"`
+}
+
+// FeedbackRepository handles message feedback database operations
+type FeedbackRepository struct {
+	db *sql.DB
+}
+
+// NewFeedbackRepository creates a new feedback repository
+func NewFeedbackRepository(db *sql.DB) *FeedbackRepository {
+	return &FeedbackRepository{db: db}
+}
+
+// Upsert stores a user's feedback on a message, replacing any they gave
+// before
+func (r *FeedbackRepository) Upsert(feedback *Feedback) error {
+	now := time.Now()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO message_feedback (id, message_id, conversation_id, user_id, rating, comment, provider, model, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(message_id, user_id) DO UPDATE SET
+			rating = excluded.rating,
+			comment = excluded.comment,
+			provider = excluded.provider,
+			model = excluded.model,
+			updated_at = excluded.updated_at`,
+		uuid.New().String(), feedback.MessageID, feedback.ConversationID, feedback.UserID, feedback.Rating,
+		sql.NullString{String: feedback.Comment, Valid: feedback.Comment != ""},
+		feedback.Provider, feedback.Model, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save feedback: %w", err)
+	}
+
+	// The ID and creation time are the earlier feedback's if this replaced it
+	err = tx.QueryRow(
+		`SELECT id, created_at FROM message_feedback WHERE message_id = ? AND user_id = ?`,
+		feedback.MessageID, feedback.UserID,
+	).Scan(&feedback.ID, &feedback.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to get feedback: %w", err)
+	}
+	feedback.UpdatedAt = now
+
+	if _, err := tx.Exec(`DELETE FROM message_feedback_tools WHERE feedback_id = ?`, feedback.ID); err != nil {
+		return fmt.Errorf("failed to clear feedback tools: %w", err)
+	}
+	for _, tool := range feedback.Tools {
+		if _, err := tx.Exec(
+			`INSERT OR IGNORE INTO message_feedback_tools (feedback_id, tool_name) VALUES (?, ?)`,
+			feedback.ID, tool,
+		); err != nil {
+			return fmt.Errorf("failed to save feedback tools: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit feedback: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a user's feedback on a message
+func (r *FeedbackRepository) Delete(messageID, userID string) error {
+	_, err := r.db.Exec(`DELETE FROM message_feedback WHERE message_id = ? AND user_id = ?`, messageID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete feedback: %w", err)
+	}
+	return nil
+}
+
+// ListForConversation retrieves a user's feedback on a conversation's
+// messages, keyed by message ID
+func (r *FeedbackRepository) ListForConversation(conversationID, userID string) (map[string]*Feedback, error) {
+	rows, err := r.db.Query(
+		`SELECT `+feedbackColumns+` FROM message_feedback f
+		 WHERE f.conversation_id = ? AND f.user_id = ?`,
+		conversationID, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feedback: %w", err)
+	}
+	defer rows.Close()
+
+	feedback := make(map[string]*Feedback)
+	for rows.Next() {
+		f, err := scanFeedback(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan feedback: %w", err)
+		}
+		feedback[f.MessageID] = f
+	}
+	return feedback, rows.Err()
+}
+
+// ListRecent retrieves the latest feedback given since the given time, by
+// one user or by everyone if userID is ""
+func (r *FeedbackRepository) ListRecent(userID string, since time.Time, limit int) ([]*Feedback, error) {
+	query := `SELECT ` + feedbackColumns + ` FROM message_feedback f WHERE f.updated_at >= ?`
+	args := []interface{}{since}
+	if userID != "" {
+		query += ` AND f.user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` ORDER BY f.updated_at DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feedback: %w", err)
+	}
+	defer rows.Close()
+
+	feedback := []*Feedback{}
+	for rows.Next() {
+		f, err := scanFeedback(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan feedback: %w", err)
+		}
+		feedback = append(feedback, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list feedback: %w", err)
+	}
+
+	return feedback, r.attachTools(feedback)
+}
+
+// CountByModel totals ratings per model since the given time, for one user
+// or for everyone if userID is ""
+func (r *FeedbackRepository) CountByModel(userID string, since time.Time) ([]*FeedbackCount, error) {
+	query := `SELECT f.provider, f.model,
+			SUM(CASE WHEN f.rating > 0 THEN 1 ELSE 0 END),
+			SUM(CASE WHEN f.rating < 0 THEN 1 ELSE 0 END)
+		 FROM message_feedback f
+		 WHERE f.updated_at >= ?`
+	args := []interface{}{since}
+	if userID != "" {
+		query += ` AND f.user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` GROUP BY f.provider, f.model ORDER BY COUNT(*) DESC, f.provider, f.model`
+
+	return r.listCounts(query, args, func(c *FeedbackCount) []interface{} {
+		return []interface{}{&c.Provider, &c.Model, &c.Up, &c.Down}
+	})
+}
+
+// CountByTool totals ratings of turns that used each tool since the given
+// time, for one user or for everyone if userID is ""
+func (r *FeedbackRepository) CountByTool(userID string, since time.Time) ([]*FeedbackCount, error) {
+	query := `SELECT t.tool_name,
+			SUM(CASE WHEN f.rating > 0 THEN 1 ELSE 0 END),
+			SUM(CASE WHEN f.rating < 0 THEN 1 ELSE 0 END)
+		 FROM message_feedback_tools t
+		 JOIN message_feedback f ON f.id = t.feedback_id
+		 WHERE f.updated_at >= ?`
+	args := []interface{}{since}
+	if userID != "" {
+		query += ` AND f.user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` GROUP BY t.tool_name ORDER BY COUNT(*) DESC, t.tool_name`
+
+	return r.listCounts(query, args, func(c *FeedbackCount) []interface{} {
+		return []interface{}{&c.Tool, &c.Up, &c.Down}
+	})
+}
+
+func (r *FeedbackRepository) listCounts(query string, args []interface{}, dest func(*FeedbackCount) []interface{}) ([]*FeedbackCount, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count feedback: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []*FeedbackCount{}
+	for rows.Next() {
+		c := &FeedbackCount{}
+		if err := rows.Scan(dest(c)...); err != nil {
+			return nil, fmt.Errorf("failed to scan feedback count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// attachTools loads the tools used in the turns the feedback is about
+func (r *FeedbackRepository) attachTools(feedback []*Feedback) error {
+	if len(feedback) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*Feedback, len(feedback))
+	args := make([]interface{}, len(feedback))
+	for i, f := range feedback {
+		byID[f.ID] = f
+		args[i] = f.ID
+	}
+
+	rows, err := r.db.Query(
+		`SELECT feedback_id, tool_name FROM message_feedback_tools
+		 WHERE feedback_id IN (`+placeholders(len(args))+`)
+		 ORDER BY tool_name`,
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get feedback tools: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var feedbackID, tool string
+		if err := rows.Scan(&feedbackID, &tool); err != nil {
+			return fmt.Errorf("failed to scan feedback tool: %w", err)
+		}
+		if f := byID[feedbackID]; f != nil {
+			f.Tools = append(f.Tools, tool)
+		}
+	}
+	return rows.Err()
+}
+
+const feedbackColumns = `f.id, f.message_id, f.conversation_id, f.user_id, f.rating, f.comment,
+	f.provider, f.model, f.created_at, f.updated_at`
+
+func scanFeedback(row interface{ Scan(...interface{}) error }) (*Feedback, error) {
+	f := &Feedback{}
+	var comment sql.NullString
+
+	err := row.Scan(&f.ID, &f.MessageID, &f.ConversationID, &f.UserID, &f.Rating, &comment,
+		&f.Provider, &f.Model, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Comment = comment.String
+	return f, nil
+}
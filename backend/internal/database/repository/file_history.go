@@ -1,11 +1,14 @@
 package repository
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/security"
 )
 
 // FileHistory represents a historical version of a file
@@ -15,32 +18,109 @@ type FileHistory struct {
 	FilePath  string    `json:"file_path"`
 	Content   string    `json:"content"`
 	Operation string    `json:"operation"` // "create", "update", "delete"
+	TurnID    string    `json:"turn_id,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
-// FileHistoryRepository handles file history database operations
+// FileHistoryOptions controls how file history content is stored
+type FileHistoryOptions struct {
+	// Encrypt stores new content encrypted with the encryption service
+	Encrypt bool
+
+	// MaxBytesPerUser caps the distinct content kept for each user. Writes
+	// past it prune the least recently used entries. 0 means no cap.
+	MaxBytesPerUser int64
+}
+
+// FileHistoryStats summarizes file history storage
+type FileHistoryStats struct {
+	Entries        int   `json:"entries"`
+	InlineEntries  int   `json:"inline_entries"` // Entries from before dedup, not yet compacted
+	Blobs          int   `json:"blobs"`          // Distinct contents
+	EncryptedBlobs int   `json:"encrypted_blobs"`
+	LogicalBytes   int64 `json:"logical_bytes"` // Content size summed over entries
+	StoredBytes    int64 `json:"stored_bytes"`  // Content size actually stored
+}
+
+// FileHistoryRepository handles file history database operations. Contents
+// are stored once per distinct content in file_history_blobs, keyed by hash,
+// and entries refer to them.
 type FileHistoryRepository struct {
-	db *sql.DB
+	db                *sql.DB
+	encryptionService *security.EncryptionService
+	options           FileHistoryOptions
 }
 
 // NewFileHistoryRepository creates a new file history repository
-func NewFileHistoryRepository(db *sql.DB) *FileHistoryRepository {
-	return &FileHistoryRepository{db: db}
+func NewFileHistoryRepository(db *sql.DB, encryptionService *security.EncryptionService, options FileHistoryOptions) *FileHistoryRepository {
+	if encryptionService == nil {
+		options.Encrypt = false
+	}
+	return &FileHistoryRepository{
+		db:                db,
+		encryptionService: encryptionService,
+		options:           options,
+	}
+}
+
+// fileHistorySelect selects entries with their content, which is inline for
+// entries that predate content_hash
+const fileHistorySelect = `SELECT h.id, h.user_id, h.file_path, h.content, h.operation, COALESCE(h.turn_id, ''), h.created_at,
+	h.content_hash, b.content, b.nonce
+	FROM file_history h LEFT JOIN file_history_blobs b ON b.hash = h.content_hash`
+
+// fileHistorySize is an entry's content size in bytes
+const fileHistorySize = `CASE WHEN content_hash IS NULL THEN LENGTH(CAST(content AS BLOB)) ELSE size END`
+
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+type sqlScanner interface {
+	Scan(dest ...interface{}) error
 }
 
 // Create creates a new file history entry
 func (r *FileHistoryRepository) Create(userID, filePath, content, operation string) (*FileHistory, error) {
+	return r.CreateForTurn(userID, filePath, content, operation, "")
+}
+
+// CreateForTurn creates a new file history entry attributed to an assistant turn
+func (r *FileHistoryRepository) CreateForTurn(userID, filePath, content, operation, turnID string) (*FileHistory, error) {
 	id := uuid.New().String()
 	now := time.Now()
 
-	_, err := r.db.Exec(
-		`INSERT INTO file_history (id, user_id, file_path, content, operation, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		id, userID, filePath, content, operation, now,
+	var turn sql.NullString
+	if turnID != "" {
+		turn = sql.NullString{String: turnID, Valid: true}
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file history: %w", err)
+	}
+	defer tx.Rollback()
+
+	hash, err := r.putBlob(tx, content)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO file_history (id, user_id, file_path, content, operation, turn_id, created_at, content_hash, size)
+		 VALUES (?, ?, ?, '', ?, ?, ?, ?, ?)`,
+		id, userID, filePath, operation, turn, now, hash, len(content),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file history: %w", err)
 	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create file history: %w", err)
+	}
+
+	// A failed prune is caught up by the next write or compaction
+	if r.options.MaxBytesPerUser > 0 {
+		_, _ = r.PruneUser(userID, r.options.MaxBytesPerUser, id)
+	}
 
 	return &FileHistory{
 		ID:        id,
@@ -48,20 +128,77 @@ func (r *FileHistoryRepository) Create(userID, filePath, content, operation stri
 		FilePath:  filePath,
 		Content:   content,
 		Operation: operation,
+		TurnID:    turnID,
 		CreatedAt: now,
 	}, nil
 }
 
-// ListByFilePath retrieves file history for a specific file
-func (r *FileHistoryRepository) ListByFilePath(userID, filePath string, limit int) ([]*FileHistory, error) {
-	rows, err := r.db.Query(
-		`SELECT id, user_id, file_path, content, operation, created_at
-		 FROM file_history
-		 WHERE user_id = ? AND file_path = ?
-		 ORDER BY created_at DESC
-		 LIMIT ?`,
-		userID, filePath, limit,
+// putBlob stores content unless identical content is already stored,
+// returning its hash
+func (r *FileHistoryRepository) putBlob(exec sqlExecer, content string) (string, error) {
+	data := []byte(content)
+	hash := r.contentHash(data)
+
+	var nonce []byte
+	if r.options.Encrypt {
+		var err error
+		data, nonce, err = r.encryptionService.Encrypt(data)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt file history: %w", err)
+		}
+	}
+
+	_, err := exec.Exec(
+		`INSERT OR IGNORE INTO file_history_blobs (hash, content, nonce, size, created_at) VALUES (?, ?, ?, ?, ?)`,
+		hash, data, nonce, len(content), time.Now(),
 	)
+	if err != nil {
+		return "", fmt.Errorf("failed to store file history content: %w", err)
+	}
+	return hash, nil
+}
+
+// contentHash identifies content for dedup. Encrypted content is keyed with
+// a MAC so the hash doesn't give it away.
+func (r *FileHistoryRepository) contentHash(data []byte) string {
+	if r.options.Encrypt {
+		return "mac:" + r.encryptionService.MAC(data)
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// scanFileHistory scans a row selected with fileHistorySelect
+func (r *FileHistoryRepository) scanFileHistory(row sqlScanner) (*FileHistory, error) {
+	h := &FileHistory{}
+	var hash sql.NullString
+	var blob, nonce []byte
+	err := row.Scan(&h.ID, &h.UserID, &h.FilePath, &h.Content, &h.Operation, &h.TurnID, &h.CreatedAt, &hash, &blob, &nonce)
+	if err != nil {
+		return nil, err
+	}
+	if !hash.Valid {
+		return h, nil
+	}
+
+	if blob == nil {
+		return nil, fmt.Errorf("content of file history %s is missing", h.ID)
+	}
+	if nonce != nil {
+		if r.encryptionService == nil {
+			return nil, fmt.Errorf("content of file history %s is encrypted", h.ID)
+		}
+		if blob, err = r.encryptionService.Decrypt(blob, nonce); err != nil {
+			return nil, err
+		}
+	}
+	h.Content = string(blob)
+	return h, nil
+}
+
+// list runs a query selected with fileHistorySelect
+func (r *FileHistoryRepository) list(query string, args ...interface{}) ([]*FileHistory, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list file history: %w", err)
 	}
@@ -69,8 +206,7 @@ func (r *FileHistoryRepository) ListByFilePath(userID, filePath string, limit in
 
 	var history []*FileHistory
 	for rows.Next() {
-		h := &FileHistory{}
-		err := rows.Scan(&h.ID, &h.UserID, &h.FilePath, &h.Content, &h.Operation, &h.CreatedAt)
+		h, err := r.scanFileHistory(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan file history: %w", err)
 		}
@@ -80,43 +216,68 @@ func (r *FileHistoryRepository) ListByFilePath(userID, filePath string, limit in
 	return history, nil
 }
 
-// ListByUserID retrieves all file history entries for a user
-func (r *FileHistoryRepository) ListByUserID(userID string, limit, offset int) ([]*FileHistory, error) {
-	rows, err := r.db.Query(
-		`SELECT id, user_id, file_path, content, operation, created_at
-		 FROM file_history
-		 WHERE user_id = ?
-		 ORDER BY created_at DESC
-		 LIMIT ? OFFSET ?`,
-		userID, limit, offset,
+// ListByTurnID retrieves the file history entries recorded during a turn, oldest first
+func (r *FileHistoryRepository) ListByTurnID(userID, turnID string) ([]*FileHistory, error) {
+	return r.list(
+		fileHistorySelect+`
+		 WHERE h.user_id = ? AND h.turn_id = ?
+		 ORDER BY h.created_at ASC, h.rowid ASC`,
+		userID, turnID,
 	)
+}
+
+// ListChangesByConversation retrieves the file history entries recorded
+// during a conversation's turns, oldest first. Content is left out.
+func (r *FileHistoryRepository) ListChangesByConversation(conversationID string) ([]*FileHistory, error) {
+	rows, err := r.db.Query(`
+		SELECT h.id, h.user_id, h.file_path, h.operation, h.turn_id, h.created_at
+		FROM file_history h
+		JOIN messages m ON m.id = h.turn_id
+		WHERE m.conversation_id = ?
+		ORDER BY h.created_at ASC, h.rowid ASC
+	`, conversationID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list file history: %w", err)
+		return nil, fmt.Errorf("failed to list file changes: %w", err)
 	}
 	defer rows.Close()
 
-	var history []*FileHistory
+	var entries []*FileHistory
 	for rows.Next() {
 		h := &FileHistory{}
-		err := rows.Scan(&h.ID, &h.UserID, &h.FilePath, &h.Content, &h.Operation, &h.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan file history: %w", err)
+		if err := rows.Scan(&h.ID, &h.UserID, &h.FilePath, &h.Operation, &h.TurnID, &h.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan file change: %w", err)
 		}
-		history = append(history, h)
+		entries = append(entries, h)
 	}
+	return entries, rows.Err()
+}
 
-	return history, nil
+// ListByFilePath retrieves file history for a specific file
+func (r *FileHistoryRepository) ListByFilePath(userID, filePath string, limit int) ([]*FileHistory, error) {
+	return r.list(
+		fileHistorySelect+`
+		 WHERE h.user_id = ? AND h.file_path = ?
+		 ORDER BY h.created_at DESC
+		 LIMIT ?`,
+		userID, filePath, limit,
+	)
 }
 
-// GetByID retrieves a specific file history entry
-func (r *FileHistoryRepository) GetByID(id string) (*FileHistory, error) {
-	h := &FileHistory{}
-	err := r.db.QueryRow(
-		`SELECT id, user_id, file_path, content, operation, created_at
-		 FROM file_history WHERE id = ?`,
-		id,
-	).Scan(&h.ID, &h.UserID, &h.FilePath, &h.Content, &h.Operation, &h.CreatedAt)
+// ListByUserID retrieves all file history entries for a user
+func (r *FileHistoryRepository) ListByUserID(userID string, limit, offset int) ([]*FileHistory, error) {
+	return r.list(
+		fileHistorySelect+`
+		 WHERE h.user_id = ?
+		 ORDER BY h.created_at DESC
+		 LIMIT ? OFFSET ?`,
+		userID, limit, offset,
+	)
+}
 
+// GetByID retrieves a specific file history entry and marks it used, so
+// pruning keeps it longer
+func (r *FileHistoryRepository) GetByID(id string) (*FileHistory, error) {
+	h, err := r.scanFileHistory(r.db.QueryRow(fileHistorySelect+` WHERE h.id = ?`, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -124,21 +285,22 @@ func (r *FileHistoryRepository) GetByID(id string) (*FileHistory, error) {
 		return nil, fmt.Errorf("failed to get file history: %w", err)
 	}
 
+	if _, err := r.db.Exec(`UPDATE file_history SET last_accessed_at = ? WHERE id = ?`, time.Now(), id); err != nil {
+		return nil, fmt.Errorf("failed to update file history: %w", err)
+	}
+
 	return h, nil
 }
 
 // GetLatestByFilePath gets the most recent history entry for a file
 func (r *FileHistoryRepository) GetLatestByFilePath(userID, filePath string) (*FileHistory, error) {
-	h := &FileHistory{}
-	err := r.db.QueryRow(
-		`SELECT id, user_id, file_path, content, operation, created_at
-		 FROM file_history
-		 WHERE user_id = ? AND file_path = ?
-		 ORDER BY created_at DESC
+	h, err := r.scanFileHistory(r.db.QueryRow(
+		fileHistorySelect+`
+		 WHERE h.user_id = ? AND h.file_path = ?
+		 ORDER BY h.created_at DESC
 		 LIMIT 1`,
 		userID, filePath,
-	).Scan(&h.ID, &h.UserID, &h.FilePath, &h.Content, &h.Operation, &h.CreatedAt)
-
+	))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -149,6 +311,291 @@ func (r *FileHistoryRepository) GetLatestByFilePath(userID, filePath string) (*F
 	return h, nil
 }
 
+// GetPrevious gets the entry recorded for the same user and file just
+// before the given one. Returns nil if there is none.
+func (r *FileHistoryRepository) GetPrevious(id string) (*FileHistory, error) {
+	h, err := r.scanFileHistory(r.db.QueryRow(
+		fileHistorySelect+`
+		 JOIN file_history cur ON cur.id = ?
+		 WHERE h.user_id = cur.user_id AND h.file_path = cur.file_path
+		 AND (h.created_at, h.rowid) < (cur.created_at, cur.rowid)
+		 ORDER BY h.created_at DESC, h.rowid DESC
+		 LIMIT 1`,
+		id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get previous file history: %w", err)
+	}
+
+	return h, nil
+}
+
+// UsageByUser returns the bytes of distinct content in a user's history
+func (r *FileHistoryRepository) UsageByUser(userID string) (int64, error) {
+	var usage int64
+	err := r.db.QueryRow(
+		`SELECT COALESCE(SUM(size), 0) FROM (
+			SELECT MAX(`+fileHistorySize+`) AS size
+			FROM file_history WHERE user_id = ?
+			GROUP BY COALESCE(content_hash, id)
+		)`,
+		userID,
+	).Scan(&usage)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file history usage: %w", err)
+	}
+	return usage, nil
+}
+
+// PruneUser deletes a user's least recently used history entries until the
+// distinct content they keep fits in maxBytes. The keepID entry, if any, is
+// never deleted. Returns how many entries were deleted.
+func (r *FileHistoryRepository) PruneUser(userID string, maxBytes int64, keepID string) (int, error) {
+	rows, err := r.db.Query(
+		`SELECT id, COALESCE(content_hash, id), `+fileHistorySize+`
+		 FROM file_history
+		 WHERE user_id = ?
+		 ORDER BY COALESCE(last_accessed_at, created_at) ASC, rowid ASC`,
+		userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list file history: %w", err)
+	}
+
+	type entry struct {
+		id   string
+		key  string
+		size int64
+	}
+	var entries []entry
+	refs := make(map[string]int)
+	var usage int64
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.id, &e.key, &e.size); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan file history: %w", err)
+		}
+		if refs[e.key] == 0 {
+			usage += e.size
+		}
+		refs[e.key]++
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list file history: %w", err)
+	}
+	if usage <= maxBytes {
+		return 0, nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune file history: %w", err)
+	}
+	defer tx.Rollback()
+
+	pruned := 0
+	for _, e := range entries {
+		if usage <= maxBytes {
+			break
+		}
+		if e.id == keepID {
+			continue
+		}
+		if _, err := tx.Exec(`DELETE FROM file_history WHERE id = ?`, e.id); err != nil {
+			return 0, fmt.Errorf("failed to prune file history: %w", err)
+		}
+		pruned++
+		if refs[e.key]--; refs[e.key] == 0 {
+			usage -= e.size
+			if _, err := tx.Exec(
+				`DELETE FROM file_history_blobs WHERE hash = ? AND NOT EXISTS (SELECT 1 FROM file_history WHERE content_hash = ?)`,
+				e.key, e.key,
+			); err != nil {
+				return 0, fmt.Errorf("failed to prune file history: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to prune file history: %w", err)
+	}
+	return pruned, nil
+}
+
+// ListUserIDs returns the users that have file history
+func (r *FileHistoryRepository) ListUserIDs() ([]string, error) {
+	rows, err := r.db.Query(`SELECT DISTINCT user_id FROM file_history`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file history users: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan file history user: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
+
+// MoveInlineContent moves the content of up to limit entries that predate
+// dedup into file_history_blobs. Returns how many entries were moved.
+func (r *FileHistoryRepository) MoveInlineContent(limit int) (int, error) {
+	rows, err := r.db.Query(`SELECT id, content FROM file_history WHERE content_hash IS NULL LIMIT ?`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list file history: %w", err)
+	}
+	type entry struct{ id, content string }
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.id, &e.content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan file history: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+
+	for i, e := range entries {
+		if err := r.moveContent(e.id, e.content); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+// moveContent stores an entry's inline content as a blob
+func (r *FileHistoryRepository) moveContent(id, content string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to compact file history: %w", err)
+	}
+	defer tx.Rollback()
+
+	hash, err := r.putBlob(tx, content)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`UPDATE file_history SET content = '', content_hash = ?, size = ? WHERE id = ?`,
+		hash, len(content), id,
+	); err != nil {
+		return fmt.Errorf("failed to compact file history: %w", err)
+	}
+	return tx.Commit()
+}
+
+// EncryptPlainBlobs encrypts up to limit blobs stored before encryption was
+// turned on. Returns how many blobs were encrypted, which is none when
+// encryption is off.
+func (r *FileHistoryRepository) EncryptPlainBlobs(limit int) (int, error) {
+	if !r.options.Encrypt {
+		return 0, nil
+	}
+
+	rows, err := r.db.Query(`SELECT hash, content FROM file_history_blobs WHERE nonce IS NULL LIMIT ?`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list file history content: %w", err)
+	}
+	type blob struct {
+		hash    string
+		content []byte
+	}
+	var blobs []blob
+	for rows.Next() {
+		var b blob
+		if err := rows.Scan(&b.hash, &b.content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan file history content: %w", err)
+		}
+		blobs = append(blobs, b)
+	}
+	rows.Close()
+
+	for i, b := range blobs {
+		if err := r.encryptBlob(b.hash, string(b.content)); err != nil {
+			return i, err
+		}
+	}
+	return len(blobs), nil
+}
+
+// encryptBlob replaces a plaintext blob with an encrypted one, pointing its
+// entries at the new hash
+func (r *FileHistoryRepository) encryptBlob(oldHash, content string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to encrypt file history: %w", err)
+	}
+	defer tx.Rollback()
+
+	hash, err := r.putBlob(tx, content)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE file_history SET content_hash = ? WHERE content_hash = ?`, hash, oldHash); err != nil {
+		return fmt.Errorf("failed to encrypt file history: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM file_history_blobs WHERE hash = ?`, oldHash); err != nil {
+		return fmt.Errorf("failed to encrypt file history: %w", err)
+	}
+	return tx.Commit()
+}
+
+// DeleteOrphanedBlobs deletes stored content no entry refers to any more,
+// such as after entries expire or their user is deleted. Returns how many
+// blobs were deleted.
+func (r *FileHistoryRepository) DeleteOrphanedBlobs() (int64, error) {
+	result, err := r.db.Exec(
+		`DELETE FROM file_history_blobs
+		 WHERE NOT EXISTS (SELECT 1 FROM file_history WHERE content_hash = file_history_blobs.hash)`,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete orphaned file history content: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Stats summarizes file history storage across all users
+func (r *FileHistoryRepository) Stats() (*FileHistoryStats, error) {
+	stats := &FileHistoryStats{}
+	var inlineBytes int64
+	err := r.db.QueryRow(
+		`SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN content_hash IS NULL THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(`+fileHistorySize+`), 0),
+			COALESCE(SUM(CASE WHEN content_hash IS NULL THEN LENGTH(CAST(content AS BLOB)) ELSE 0 END), 0)
+		 FROM file_history`,
+	).Scan(&stats.Entries, &stats.InlineEntries, &stats.LogicalBytes, &inlineBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file history stats: %w", err)
+	}
+
+	var blobBytes int64
+	err = r.db.QueryRow(
+		`SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN nonce IS NOT NULL THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(LENGTH(content)), 0)
+		 FROM file_history_blobs`,
+	).Scan(&stats.Blobs, &stats.EncryptedBlobs, &blobBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file history stats: %w", err)
+	}
+	stats.StoredBytes = inlineBytes + blobBytes
+
+	return stats, nil
+}
+
 // DeleteOldEntries removes history entries older than the specified duration
 // Keeps at least minKeep entries per file
 func (r *FileHistoryRepository) DeleteOldEntries(userID string, olderThan time.Duration, minKeep int) error {
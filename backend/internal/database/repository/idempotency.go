@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// IdempotencyRecord is the outcome of a request sent with an idempotency
+// key. A record is pending until the request finishes; then it holds the
+// response to replay to retries.
+type IdempotencyRecord struct {
+	UserID         string
+	Key            string
+	Scope          string // The endpoint or message type the key was used for
+	RequestHash    string // Fingerprint of the request, to catch a key reused for another request
+	Completed      bool
+	ResponseStatus int
+	ContentType    string
+	ResponseBody   []byte
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+}
+
+// IdempotencyRepository handles idempotency key database operations
+type IdempotencyRepository struct {
+	db *sql.DB
+}
+
+// NewIdempotencyRepository creates a new idempotency repository
+func NewIdempotencyRepository(db *sql.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// Begin claims a key for a request. If the key is unused (or expired) a
+// pending record is stored and Begin returns nil; otherwise it returns the
+// existing record, whose request should not be run again.
+func (r *IdempotencyRepository) Begin(record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	now := time.Now()
+	if _, err := r.db.Exec(`
+		DELETE FROM idempotency_keys WHERE user_id = ? AND key = ? AND expires_at < ?
+	`, record.UserID, record.Key, now); err != nil {
+		return nil, fmt.Errorf("failed to expire idempotency key: %w", err)
+	}
+
+	record.CreatedAt = now
+	result, err := r.db.Exec(`
+		INSERT INTO idempotency_keys (user_id, key, scope, request_hash, completed, created_at, expires_at)
+		VALUES (?, ?, ?, ?, 0, ?, ?)
+		ON CONFLICT(user_id, key) DO NOTHING
+	`, record.UserID, record.Key, record.Scope, record.RequestHash, record.CreatedAt, record.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store idempotency key: %w", err)
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 1 {
+		return nil, nil
+	}
+
+	existing := &IdempotencyRecord{UserID: record.UserID, Key: record.Key}
+	var status sql.NullInt64
+	var contentType sql.NullString
+	err = r.db.QueryRow(`
+		SELECT scope, request_hash, completed, response_status, content_type, response_body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE user_id = ? AND key = ?
+	`, record.UserID, record.Key).Scan(
+		&existing.Scope, &existing.RequestHash, &existing.Completed, &status, &contentType,
+		&existing.ResponseBody, &existing.CreatedAt, &existing.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		// Released between the insert and the read; let the caller retry
+		return r.Begin(record)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	existing.ResponseStatus = int(status.Int64)
+	existing.ContentType = contentType.String
+	return existing, nil
+}
+
+// Complete stores the response of a request that claimed a key
+func (r *IdempotencyRepository) Complete(userID, key string, status int, contentType string, body []byte) error {
+	_, err := r.db.Exec(`
+		UPDATE idempotency_keys
+		SET completed = 1, response_status = ?, content_type = ?, response_body = ?
+		WHERE user_id = ? AND key = ?
+	`, status, contentType, body, userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Release forgets a key, so a request that failed without side effects can
+// be retried with it
+func (r *IdempotencyRepository) Release(userID, key string) error {
+	_, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE user_id = ? AND key = ?`, userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes keys past their expiry
+func (r *IdempotencyRepository) DeleteExpired() (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at < ?`, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
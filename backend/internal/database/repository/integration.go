@@ -2,9 +2,11 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
+	"github.com/jacklau/prism/internal/integrations/linear"
 	"github.com/jacklau/prism/internal/security"
 )
 
@@ -20,6 +22,70 @@ type IntegrationSettings struct {
 	UpdatedAt  time.Time
 }
 
+// EmailPreferences represents a user's email notification preferences
+type EmailPreferences struct {
+	UserID  string
+	Enabled bool
+	Address string   // overrides the account email when set
+	Events  []string // event types to email
+	// MinDurationSeconds skips agent and swarm completion emails for runs
+	// shorter than this, so only long-running work is reported
+	MinDurationSeconds int
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+// DiscordGuildSettings represents a Discord server linked to a Prism account.
+// Bot commands in the server run as that account.
+type DiscordGuildSettings struct {
+	GuildID    string
+	UserID     string
+	GuildName  string
+	ChannelID  string // when set, commands are only accepted in this channel
+	UseThreads bool   // stream results into a thread instead of the channel
+	Provider   string // overrides the bot's default provider when set
+	Model      string
+	Enabled    bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// LinearSettings represents a user's Linear connection and the automation
+// triggers run from its issue webhooks
+type LinearSettings struct {
+	UserID        string
+	APIKey        string // decrypted, only populated on read
+	WebhookSecret string // decrypted, only populated on read
+	WebhookToken  string // identifies the user in the webhook URL
+	Organization  string
+	Provider      string // overrides the default provider of trigger runs when set
+	Model         string
+	Triggers      []linear.Trigger
+	Enabled       bool
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// NotionSettings represents a user's Notion internal integration token
+type NotionSettings struct {
+	UserID        string
+	Token         string // decrypted, only populated on read
+	WorkspaceName string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// ConfluenceSettings represents a user's Confluence site credentials
+type ConfluenceSettings struct {
+	UserID      string
+	BaseURL     string
+	Email       string // empty when Token is a personal access token
+	Token       string // decrypted, only populated on read
+	DisplayName string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
 // IntegrationRepository handles integration settings database operations
 type IntegrationRepository struct {
 	db                *sql.DB
@@ -242,6 +308,440 @@ func (r *IntegrationRepository) DeletePostHogSettings(userID string) error {
 	return nil
 }
 
+// SetEmailPreferences stores or updates email notification preferences
+func (r *IntegrationRepository) SetEmailPreferences(prefs *EmailPreferences) error {
+	events := prefs.Events
+	if events == nil {
+		events = []string{}
+	}
+	eventsJSON, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+
+	now := time.Now()
+	_, err = r.db.Exec(`
+		INSERT INTO email_settings (user_id, enabled, address, events, min_duration_seconds, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			enabled = excluded.enabled,
+			address = excluded.address,
+			events = excluded.events,
+			min_duration_seconds = excluded.min_duration_seconds,
+			updated_at = excluded.updated_at
+	`, prefs.UserID, prefs.Enabled, prefs.Address, string(eventsJSON), prefs.MinDurationSeconds, now, now)
+
+	if err != nil {
+		return fmt.Errorf("failed to set email preferences: %w", err)
+	}
+	return nil
+}
+
+// GetEmailPreferences retrieves email notification preferences for a user
+func (r *IntegrationRepository) GetEmailPreferences(userID string) (*EmailPreferences, error) {
+	prefs := &EmailPreferences{UserID: userID}
+	var address sql.NullString
+	var eventsJSON string
+
+	err := r.db.QueryRow(`
+		SELECT enabled, address, events, min_duration_seconds, created_at, updated_at
+		FROM email_settings
+		WHERE user_id = ?
+	`, userID).Scan(&prefs.Enabled, &address, &eventsJSON, &prefs.MinDurationSeconds, &prefs.CreatedAt, &prefs.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email preferences: %w", err)
+	}
+
+	prefs.Address = address.String
+	if err := json.Unmarshal([]byte(eventsJSON), &prefs.Events); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal events: %w", err)
+	}
+	return prefs, nil
+}
+
+// DeleteEmailPreferences removes email notification preferences for a user
+func (r *IntegrationRepository) DeleteEmailPreferences(userID string) error {
+	_, err := r.db.Exec(`DELETE FROM email_settings WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete email preferences: %w", err)
+	}
+	return nil
+}
+
+// SetDiscordGuildSettings stores or updates the settings for a Discord server
+func (r *IntegrationRepository) SetDiscordGuildSettings(settings *DiscordGuildSettings) error {
+	now := time.Now()
+	_, err := r.db.Exec(`
+		INSERT INTO discord_guild_settings (guild_id, user_id, guild_name, channel_id, use_threads, provider, model, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(guild_id) DO UPDATE SET
+			user_id = excluded.user_id,
+			guild_name = excluded.guild_name,
+			channel_id = excluded.channel_id,
+			use_threads = excluded.use_threads,
+			provider = excluded.provider,
+			model = excluded.model,
+			enabled = excluded.enabled,
+			updated_at = excluded.updated_at
+	`, settings.GuildID, settings.UserID, settings.GuildName, settings.ChannelID, settings.UseThreads,
+		settings.Provider, settings.Model, settings.Enabled, now, now)
+
+	if err != nil {
+		return fmt.Errorf("failed to set discord guild settings: %w", err)
+	}
+	settings.UpdatedAt = now
+	if settings.CreatedAt.IsZero() {
+		settings.CreatedAt = now
+	}
+	return nil
+}
+
+// GetDiscordGuildSettings retrieves the settings for a Discord server
+func (r *IntegrationRepository) GetDiscordGuildSettings(guildID string) (*DiscordGuildSettings, error) {
+	row := r.db.QueryRow(`
+		SELECT guild_id, user_id, guild_name, channel_id, use_threads, provider, model, enabled, created_at, updated_at
+		FROM discord_guild_settings
+		WHERE guild_id = ?
+	`, guildID)
+
+	settings, err := scanDiscordGuildSettings(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get discord guild settings: %w", err)
+	}
+	return settings, nil
+}
+
+// ListDiscordGuildSettings retrieves the Discord servers linked to a user
+func (r *IntegrationRepository) ListDiscordGuildSettings(userID string) ([]*DiscordGuildSettings, error) {
+	rows, err := r.db.Query(`
+		SELECT guild_id, user_id, guild_name, channel_id, use_threads, provider, model, enabled, created_at, updated_at
+		FROM discord_guild_settings
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list discord guild settings: %w", err)
+	}
+	defer rows.Close()
+
+	var result []*DiscordGuildSettings
+	for rows.Next() {
+		settings, err := scanDiscordGuildSettings(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan discord guild settings: %w", err)
+		}
+		result = append(result, settings)
+	}
+	return result, rows.Err()
+}
+
+// DeleteDiscordGuildSettings unlinks a Discord server. When userID is set,
+// the server is only unlinked if it is linked to that user.
+func (r *IntegrationRepository) DeleteDiscordGuildSettings(guildID, userID string) (bool, error) {
+	query := `DELETE FROM discord_guild_settings WHERE guild_id = ?`
+	args := []interface{}{guildID}
+	if userID != "" {
+		query += ` AND user_id = ?`
+		args = append(args, userID)
+	}
+
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete discord guild settings: %w", err)
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+func scanDiscordGuildSettings(row interface{ Scan(...interface{}) error }) (*DiscordGuildSettings, error) {
+	settings := &DiscordGuildSettings{}
+	var guildName, channelID, provider, model sql.NullString
+	err := row.Scan(&settings.GuildID, &settings.UserID, &guildName, &channelID, &settings.UseThreads,
+		&provider, &model, &settings.Enabled, &settings.CreatedAt, &settings.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	settings.GuildName = guildName.String
+	settings.ChannelID = channelID.String
+	settings.Provider = provider.String
+	settings.Model = model.String
+	return settings, nil
+}
+
+// SetLinearSettings stores or updates a user's Linear settings, generating
+// the webhook token on first save
+func (r *IntegrationRepository) SetLinearSettings(settings *LinearSettings) error {
+	var keyEncrypted, keyNonce, secretEncrypted, secretNonce []byte
+	var err error
+	if settings.APIKey != "" {
+		keyEncrypted, keyNonce, err = r.encryptionService.Encrypt([]byte(settings.APIKey))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt linear API key: %w", err)
+		}
+	}
+	if settings.WebhookSecret != "" {
+		secretEncrypted, secretNonce, err = r.encryptionService.Encrypt([]byte(settings.WebhookSecret))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt linear webhook secret: %w", err)
+		}
+	}
+	if settings.WebhookToken == "" {
+		settings.WebhookToken, err = security.GenerateRandomString(24)
+		if err != nil {
+			return fmt.Errorf("failed to generate linear webhook token: %w", err)
+		}
+	}
+
+	triggers := settings.Triggers
+	if triggers == nil {
+		triggers = []linear.Trigger{}
+	}
+	triggersJSON, err := json.Marshal(triggers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal triggers: %w", err)
+	}
+
+	now := time.Now()
+	_, err = r.db.Exec(`
+		INSERT INTO linear_settings (user_id, api_key_encrypted, api_key_nonce, webhook_secret_encrypted, webhook_secret_nonce,
+			webhook_token, organization, provider, model, triggers, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			api_key_encrypted = excluded.api_key_encrypted,
+			api_key_nonce = excluded.api_key_nonce,
+			webhook_secret_encrypted = excluded.webhook_secret_encrypted,
+			webhook_secret_nonce = excluded.webhook_secret_nonce,
+			webhook_token = excluded.webhook_token,
+			organization = excluded.organization,
+			provider = excluded.provider,
+			model = excluded.model,
+			triggers = excluded.triggers,
+			enabled = excluded.enabled,
+			updated_at = excluded.updated_at
+	`, settings.UserID, keyEncrypted, keyNonce, secretEncrypted, secretNonce, settings.WebhookToken,
+		settings.Organization, settings.Provider, settings.Model, string(triggersJSON), settings.Enabled, now, now)
+
+	if err != nil {
+		return fmt.Errorf("failed to set linear settings: %w", err)
+	}
+	settings.UpdatedAt = now
+	if settings.CreatedAt.IsZero() {
+		settings.CreatedAt = now
+	}
+	return nil
+}
+
+// GetLinearSettings retrieves a user's Linear settings
+func (r *IntegrationRepository) GetLinearSettings(userID string) (*LinearSettings, error) {
+	return r.getLinearSettings(`user_id = ?`, userID)
+}
+
+// GetLinearSettingsByToken retrieves the Linear settings a webhook URL's
+// token belongs to
+func (r *IntegrationRepository) GetLinearSettingsByToken(token string) (*LinearSettings, error) {
+	if token == "" {
+		return nil, nil
+	}
+	return r.getLinearSettings(`webhook_token = ?`, token)
+}
+
+func (r *IntegrationRepository) getLinearSettings(where string, arg string) (*LinearSettings, error) {
+	settings := &LinearSettings{}
+	var keyEncrypted, keyNonce, secretEncrypted, secretNonce []byte
+	var organization, provider, model sql.NullString
+	var triggersJSON string
+
+	err := r.db.QueryRow(`
+		SELECT user_id, api_key_encrypted, api_key_nonce, webhook_secret_encrypted, webhook_secret_nonce,
+			webhook_token, organization, provider, model, triggers, enabled, created_at, updated_at
+		FROM linear_settings
+		WHERE `+where, arg).Scan(&settings.UserID, &keyEncrypted, &keyNonce, &secretEncrypted, &secretNonce,
+		&settings.WebhookToken, &organization, &provider, &model, &triggersJSON, &settings.Enabled,
+		&settings.CreatedAt, &settings.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get linear settings: %w", err)
+	}
+
+	settings.Organization = organization.String
+	settings.Provider = provider.String
+	settings.Model = model.String
+	if err := json.Unmarshal([]byte(triggersJSON), &settings.Triggers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal triggers: %w", err)
+	}
+
+	// Decrypt the API key and webhook secret
+	if len(keyEncrypted) > 0 && len(keyNonce) > 0 {
+		decrypted, err := r.encryptionService.Decrypt(keyEncrypted, keyNonce)
+		if err == nil {
+			settings.APIKey = string(decrypted)
+		}
+	}
+	if len(secretEncrypted) > 0 && len(secretNonce) > 0 {
+		decrypted, err := r.encryptionService.Decrypt(secretEncrypted, secretNonce)
+		if err == nil {
+			settings.WebhookSecret = string(decrypted)
+		}
+	}
+
+	return settings, nil
+}
+
+// DeleteLinearSettings removes a user's Linear settings
+func (r *IntegrationRepository) DeleteLinearSettings(userID string) error {
+	_, err := r.db.Exec(`DELETE FROM linear_settings WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete linear settings: %w", err)
+	}
+	return nil
+}
+
+// SetNotionSettings stores or updates a user's Notion settings
+func (r *IntegrationRepository) SetNotionSettings(settings *NotionSettings) error {
+	tokenEncrypted, tokenNonce, err := r.encryptionService.Encrypt([]byte(settings.Token))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt notion token: %w", err)
+	}
+
+	now := time.Now()
+	_, err = r.db.Exec(`
+		INSERT INTO notion_settings (user_id, token_encrypted, token_nonce, workspace_name, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			token_encrypted = excluded.token_encrypted,
+			token_nonce = excluded.token_nonce,
+			workspace_name = excluded.workspace_name,
+			updated_at = excluded.updated_at
+	`, settings.UserID, tokenEncrypted, tokenNonce, settings.WorkspaceName, now, now)
+
+	if err != nil {
+		return fmt.Errorf("failed to set notion settings: %w", err)
+	}
+	settings.UpdatedAt = now
+	if settings.CreatedAt.IsZero() {
+		settings.CreatedAt = now
+	}
+	return nil
+}
+
+// GetNotionSettings retrieves a user's Notion settings
+func (r *IntegrationRepository) GetNotionSettings(userID string) (*NotionSettings, error) {
+	settings := &NotionSettings{UserID: userID}
+	var tokenEncrypted, tokenNonce []byte
+	var workspaceName sql.NullString
+
+	err := r.db.QueryRow(`
+		SELECT token_encrypted, token_nonce, workspace_name, created_at, updated_at
+		FROM notion_settings
+		WHERE user_id = ?
+	`, userID).Scan(&tokenEncrypted, &tokenNonce, &workspaceName, &settings.CreatedAt, &settings.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notion settings: %w", err)
+	}
+
+	settings.WorkspaceName = workspaceName.String
+	if len(tokenEncrypted) > 0 && len(tokenNonce) > 0 {
+		decrypted, err := r.encryptionService.Decrypt(tokenEncrypted, tokenNonce)
+		if err == nil {
+			settings.Token = string(decrypted)
+		}
+	}
+	return settings, nil
+}
+
+// DeleteNotionSettings removes a user's Notion settings
+func (r *IntegrationRepository) DeleteNotionSettings(userID string) error {
+	_, err := r.db.Exec(`DELETE FROM notion_settings WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete notion settings: %w", err)
+	}
+	return nil
+}
+
+// SetConfluenceSettings stores or updates a user's Confluence settings
+func (r *IntegrationRepository) SetConfluenceSettings(settings *ConfluenceSettings) error {
+	tokenEncrypted, tokenNonce, err := r.encryptionService.Encrypt([]byte(settings.Token))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt confluence token: %w", err)
+	}
+
+	now := time.Now()
+	_, err = r.db.Exec(`
+		INSERT INTO confluence_settings (user_id, base_url, email, token_encrypted, token_nonce, display_name, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			base_url = excluded.base_url,
+			email = excluded.email,
+			token_encrypted = excluded.token_encrypted,
+			token_nonce = excluded.token_nonce,
+			display_name = excluded.display_name,
+			updated_at = excluded.updated_at
+	`, settings.UserID, settings.BaseURL, settings.Email, tokenEncrypted, tokenNonce, settings.DisplayName, now, now)
+
+	if err != nil {
+		return fmt.Errorf("failed to set confluence settings: %w", err)
+	}
+	settings.UpdatedAt = now
+	if settings.CreatedAt.IsZero() {
+		settings.CreatedAt = now
+	}
+	return nil
+}
+
+// GetConfluenceSettings retrieves a user's Confluence settings
+func (r *IntegrationRepository) GetConfluenceSettings(userID string) (*ConfluenceSettings, error) {
+	settings := &ConfluenceSettings{UserID: userID}
+	var tokenEncrypted, tokenNonce []byte
+	var email, displayName sql.NullString
+
+	err := r.db.QueryRow(`
+		SELECT base_url, email, token_encrypted, token_nonce, display_name, created_at, updated_at
+		FROM confluence_settings
+		WHERE user_id = ?
+	`, userID).Scan(&settings.BaseURL, &email, &tokenEncrypted, &tokenNonce, &displayName,
+		&settings.CreatedAt, &settings.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get confluence settings: %w", err)
+	}
+
+	settings.Email = email.String
+	settings.DisplayName = displayName.String
+	if len(tokenEncrypted) > 0 && len(tokenNonce) > 0 {
+		decrypted, err := r.encryptionService.Decrypt(tokenEncrypted, tokenNonce)
+		if err == nil {
+			settings.Token = string(decrypted)
+		}
+	}
+	return settings, nil
+}
+
+// DeleteConfluenceSettings removes a user's Confluence settings
+func (r *IntegrationRepository) DeleteConfluenceSettings(userID string) error {
+	_, err := r.db.Exec(`DELETE FROM confluence_settings WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete confluence settings: %w", err)
+	}
+	return nil
+}
+
 // GetAllSettings retrieves all integration settings for a user
 func (r *IntegrationRepository) GetAllSettings(userID string) (map[string]*IntegrationSettings, error) {
 	result := make(map[string]*IntegrationSettings)
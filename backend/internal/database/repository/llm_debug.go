@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/security"
+)
+
+// LLMDebugEntry is one provider request made for a conversation with LLM
+// debugging on, and the raw response, with secrets redacted
+type LLMDebugEntry struct {
+	ID             string
+	ConversationID string
+	Provider       string
+	Model          string
+	Method         string
+	URL            string
+	StatusCode     int
+	Error          string
+	Duration       time.Duration
+	RequestHeaders map[string]string
+	RequestBody    string
+	ResponseChunks []string
+	Truncated      bool
+	CreatedAt      time.Time
+}
+
+// llmDebugPayload is the part of an entry that may hold conversation content
+type llmDebugPayload struct {
+	RequestHeaders map[string]string `json:"request_headers"`
+	RequestBody    string            `json:"request_body"`
+	ResponseChunks []string          `json:"response_chunks"`
+	Truncated      bool              `json:"truncated,omitempty"`
+}
+
+// LLMDebugRepository handles LLM debug entry database operations
+type LLMDebugRepository struct {
+	db                *sql.DB
+	encryptionService *security.EncryptionService
+	encrypt           bool
+}
+
+// NewLLMDebugRepository creates a new LLM debug repository. With encrypt set,
+// payloads are stored encrypted like message content.
+func NewLLMDebugRepository(db *sql.DB, encryptionService *security.EncryptionService, encrypt bool) *LLMDebugRepository {
+	if encryptionService == nil {
+		encrypt = false
+	}
+	return &LLMDebugRepository{
+		db:                db,
+		encryptionService: encryptionService,
+		encrypt:           encrypt,
+	}
+}
+
+// Create stores an entry, then deletes the conversation's oldest entries
+// beyond keep (0 keeps them all)
+func (r *LLMDebugRepository) Create(entry *LLMDebugEntry, keep int) error {
+	entry.ID = uuid.New().String()
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	payload, err := json.Marshal(llmDebugPayload{
+		RequestHeaders: entry.RequestHeaders,
+		RequestBody:    entry.RequestBody,
+		ResponseChunks: entry.ResponseChunks,
+		Truncated:      entry.Truncated,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal LLM debug payload: %w", err)
+	}
+	var nonce []byte
+	if r.encrypt {
+		if payload, nonce, err = r.encryptionService.Encrypt(payload); err != nil {
+			return fmt.Errorf("failed to encrypt LLM debug payload: %w", err)
+		}
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO llm_debug_entries (id, conversation_id, provider, model, method, url, status_code, error, duration_ms, payload, payload_nonce, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.ID, entry.ConversationID, entry.Provider, entry.Model, entry.Method, entry.URL, entry.StatusCode,
+		sql.NullString{String: entry.Error, Valid: entry.Error != ""}, entry.Duration.Milliseconds(), payload, nonce, entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save LLM debug entry: %w", err)
+	}
+
+	if keep > 0 {
+		_, err = r.db.Exec(`
+			DELETE FROM llm_debug_entries
+			WHERE conversation_id = ? AND id NOT IN (
+				SELECT id FROM llm_debug_entries WHERE conversation_id = ? ORDER BY created_at DESC LIMIT ?
+			)
+		`, entry.ConversationID, entry.ConversationID, keep)
+		if err != nil {
+			return fmt.Errorf("failed to prune LLM debug entries: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListByConversation retrieves a conversation's entries, newest first
+func (r *LLMDebugRepository) ListByConversation(conversationID string, limit int) ([]*LLMDebugEntry, error) {
+	rows, err := r.db.Query(`
+		SELECT id, conversation_id, provider, model, method, url, status_code, error, duration_ms, payload, payload_nonce, created_at
+		FROM llm_debug_entries
+		WHERE conversation_id = ?
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, conversationID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list LLM debug entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*LLMDebugEntry{}
+	for rows.Next() {
+		entry := &LLMDebugEntry{}
+		var errMsg sql.NullString
+		var durationMs int64
+		var payload, nonce []byte
+		err := rows.Scan(&entry.ID, &entry.ConversationID, &entry.Provider, &entry.Model, &entry.Method, &entry.URL,
+			&entry.StatusCode, &errMsg, &durationMs, &payload, &nonce, &entry.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan LLM debug entry: %w", err)
+		}
+		entry.Error = errMsg.String
+		entry.Duration = time.Duration(durationMs) * time.Millisecond
+
+		if nonce != nil {
+			if r.encryptionService == nil {
+				return nil, fmt.Errorf("LLM debug entry %s is encrypted", entry.ID)
+			}
+			if payload, err = r.encryptionService.Decrypt(payload, nonce); err != nil {
+				return nil, fmt.Errorf("failed to decrypt LLM debug entry: %w", err)
+			}
+		}
+		var p llmDebugPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return nil, fmt.Errorf("failed to parse LLM debug entry: %w", err)
+		}
+		entry.RequestHeaders = p.RequestHeaders
+		entry.RequestBody = p.RequestBody
+		entry.ResponseChunks = p.ResponseChunks
+		entry.Truncated = p.Truncated
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// DeleteByConversation removes all of a conversation's entries
+func (r *LLMDebugRepository) DeleteByConversation(conversationID string) error {
+	_, err := r.db.Exec(`DELETE FROM llm_debug_entries WHERE conversation_id = ?`, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to delete LLM debug entries: %w", err)
+	}
+	return nil
+}
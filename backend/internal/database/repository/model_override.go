@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ModelOverride corrects what a provider reports about a model. Nil fields
+// keep the provider's value.
+type ModelOverride struct {
+	Provider              string
+	Model                 string
+	SupportsTools         *bool
+	SupportsVision        *bool
+	SupportsJSONMode      *bool
+	ContextWindow         *int
+	MaxOutputTokens       *int
+	InputPricePerMillion  *float64
+	OutputPricePerMillion *float64
+	UpdatedAt             time.Time
+}
+
+// ModelOverrideRepository handles model override database operations
+type ModelOverrideRepository struct {
+	db *sql.DB
+}
+
+// NewModelOverrideRepository creates a new model override repository
+func NewModelOverrideRepository(db *sql.DB) *ModelOverrideRepository {
+	return &ModelOverrideRepository{db: db}
+}
+
+const modelOverrideColumns = `provider, model, supports_tools, supports_vision, supports_json_mode,
+	context_window, max_output_tokens, input_price_per_million, output_price_per_million, updated_at`
+
+// Upsert stores an override, replacing any existing one for the model
+func (r *ModelOverrideRepository) Upsert(override *ModelOverride) error {
+	override.UpdatedAt = time.Now()
+
+	_, err := r.db.Exec(`
+		INSERT INTO model_overrides (`+modelOverrideColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(provider, model) DO UPDATE SET
+			supports_tools = excluded.supports_tools,
+			supports_vision = excluded.supports_vision,
+			supports_json_mode = excluded.supports_json_mode,
+			context_window = excluded.context_window,
+			max_output_tokens = excluded.max_output_tokens,
+			input_price_per_million = excluded.input_price_per_million,
+			output_price_per_million = excluded.output_price_per_million,
+			updated_at = excluded.updated_at
+	`, override.Provider, override.Model, override.SupportsTools, override.SupportsVision, override.SupportsJSONMode,
+		override.ContextWindow, override.MaxOutputTokens, override.InputPricePerMillion, override.OutputPricePerMillion,
+		override.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save model override: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves the override for a model
+func (r *ModelOverrideRepository) Get(provider, model string) (*ModelOverride, error) {
+	override, err := scanModelOverride(r.db.QueryRow(`
+		SELECT `+modelOverrideColumns+`
+		FROM model_overrides
+		WHERE provider = ? AND model = ?
+	`, provider, model))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model override: %w", err)
+	}
+	return override, nil
+}
+
+// List retrieves all overrides
+func (r *ModelOverrideRepository) List() ([]*ModelOverride, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + modelOverrideColumns + `
+		FROM model_overrides
+		ORDER BY provider, model
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list model overrides: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := []*ModelOverride{}
+	for rows.Next() {
+		override, err := scanModelOverride(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan model override: %w", err)
+		}
+		overrides = append(overrides, override)
+	}
+
+	return overrides, rows.Err()
+}
+
+// Delete removes the override for a model
+func (r *ModelOverrideRepository) Delete(provider, model string) error {
+	_, err := r.db.Exec(`DELETE FROM model_overrides WHERE provider = ? AND model = ?`, provider, model)
+	if err != nil {
+		return fmt.Errorf("failed to delete model override: %w", err)
+	}
+	return nil
+}
+
+func scanModelOverride(row interface{ Scan(...interface{}) error }) (*ModelOverride, error) {
+	override := &ModelOverride{}
+	var tools, vision, jsonMode, contextWindow, maxOutput sql.NullInt64
+	var inputPrice, outputPrice sql.NullFloat64
+
+	err := row.Scan(&override.Provider, &override.Model, &tools, &vision, &jsonMode,
+		&contextWindow, &maxOutput, &inputPrice, &outputPrice, &override.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	override.SupportsTools = nullBool(tools)
+	override.SupportsVision = nullBool(vision)
+	override.SupportsJSONMode = nullBool(jsonMode)
+	override.ContextWindow = nullInt(contextWindow)
+	override.MaxOutputTokens = nullInt(maxOutput)
+	if inputPrice.Valid {
+		override.InputPricePerMillion = &inputPrice.Float64
+	}
+	if outputPrice.Valid {
+		override.OutputPricePerMillion = &outputPrice.Float64
+	}
+	return override, nil
+}
+
+func nullBool(v sql.NullInt64) *bool {
+	if !v.Valid {
+		return nil
+	}
+	b := v.Int64 != 0
+	return &b
+}
+
+func nullInt(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
@@ -0,0 +1,358 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Organization member roles
+const (
+	OrgRoleAdmin  = "admin"  // Manages members and shared keys
+	OrgRoleMember = "member" // Uses shared keys
+)
+
+// Organization is a group of users sharing provider keys
+type Organization struct {
+	ID        string
+	Name      string
+	CreatedBy string
+	CreatedAt time.Time
+	Role      string // The requesting user's role, when listed for a user
+}
+
+// OrganizationMember is a user in an organization
+type OrganizationMember struct {
+	OrganizationID string
+	UserID         string
+	Email          string
+	Role           string
+	CreatedAt      time.Time
+}
+
+// OrganizationKey describes a shared provider key (without the key itself)
+type OrganizationKey struct {
+	Provider  string
+	BaseURL   string
+	CreatedBy string
+	CreatedAt time.Time
+}
+
+// OrganizationUsage is one member's use of a shared provider key
+type OrganizationUsage struct {
+	UserID     string `json:"user_id"`
+	Email      string `json:"email"`
+	Provider   string `json:"provider"`
+	Requests   int    `json:"requests"`
+	TokensUsed int64  `json:"tokens_used"`
+}
+
+// OrganizationRepository handles organization database operations
+type OrganizationRepository struct {
+	db *sql.DB
+}
+
+// NewOrganizationRepository creates a new organization repository
+func NewOrganizationRepository(db *sql.DB) *OrganizationRepository {
+	return &OrganizationRepository{db: db}
+}
+
+// IsValidOrgRole reports whether role is a known organization role
+func IsValidOrgRole(role string) bool {
+	return role == OrgRoleAdmin || role == OrgRoleMember
+}
+
+// Create creates an organization with the user as its first admin
+func (r *OrganizationRepository) Create(name, userID string) (*Organization, error) {
+	org := &Organization{
+		ID:        uuid.New().String(),
+		Name:      name,
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+		Role:      OrgRoleAdmin,
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO organizations (id, name, created_by, created_at) VALUES (?, ?, ?, ?)`,
+		org.ID, org.Name, org.CreatedBy, org.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO organization_members (organization_id, user_id, role, created_at) VALUES (?, ?, ?, ?)`,
+		org.ID, userID, OrgRoleAdmin, org.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add organization admin: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit organization: %w", err)
+	}
+
+	return org, nil
+}
+
+// GetByID retrieves an organization by ID
+func (r *OrganizationRepository) GetByID(id string) (*Organization, error) {
+	org := &Organization{}
+	var createdBy sql.NullString
+
+	err := r.db.QueryRow(
+		`SELECT id, name, created_by, created_at FROM organizations WHERE id = ?`,
+		id,
+	).Scan(&org.ID, &org.Name, &createdBy, &org.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	org.CreatedBy = createdBy.String
+	return org, nil
+}
+
+// ListForUser retrieves the organizations a user belongs to, with their role
+func (r *OrganizationRepository) ListForUser(userID string) ([]*Organization, error) {
+	rows, err := r.db.Query(
+		`SELECT o.id, o.name, o.created_by, o.created_at, m.role
+		 FROM organizations o
+		 JOIN organization_members m ON m.organization_id = o.id
+		 WHERE m.user_id = ?
+		 ORDER BY m.created_at ASC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	var orgs []*Organization
+	for rows.Next() {
+		org := &Organization{}
+		var createdBy sql.NullString
+		if err := rows.Scan(&org.ID, &org.Name, &createdBy, &org.CreatedAt, &org.Role); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		org.CreatedBy = createdBy.String
+		orgs = append(orgs, org)
+	}
+
+	return orgs, rows.Err()
+}
+
+// Delete deletes an organization with its members, keys and usage
+func (r *OrganizationRepository) Delete(id string) error {
+	_, err := r.db.Exec(`DELETE FROM organizations WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+	return nil
+}
+
+// GetMember retrieves a user's membership in an organization
+func (r *OrganizationRepository) GetMember(orgID, userID string) (*OrganizationMember, error) {
+	member := &OrganizationMember{}
+
+	err := r.db.QueryRow(
+		`SELECT m.organization_id, m.user_id, u.email, m.role, m.created_at
+		 FROM organization_members m
+		 JOIN users u ON u.id = m.user_id
+		 WHERE m.organization_id = ? AND m.user_id = ?`,
+		orgID, userID,
+	).Scan(&member.OrganizationID, &member.UserID, &member.Email, &member.Role, &member.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization member: %w", err)
+	}
+
+	return member, nil
+}
+
+// ListMembers retrieves an organization's members
+func (r *OrganizationRepository) ListMembers(orgID string) ([]*OrganizationMember, error) {
+	rows, err := r.db.Query(
+		`SELECT m.organization_id, m.user_id, u.email, m.role, m.created_at
+		 FROM organization_members m
+		 JOIN users u ON u.id = m.user_id
+		 WHERE m.organization_id = ?
+		 ORDER BY m.created_at ASC`,
+		orgID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*OrganizationMember
+	for rows.Next() {
+		member := &OrganizationMember{}
+		if err := rows.Scan(&member.OrganizationID, &member.UserID, &member.Email, &member.Role, &member.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan organization member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// UpsertMember adds a user to an organization, updating the role if they
+// already belong to it
+func (r *OrganizationRepository) UpsertMember(orgID, userID, role string) (*OrganizationMember, error) {
+	_, err := r.db.Exec(
+		`INSERT INTO organization_members (organization_id, user_id, role, created_at)
+		 VALUES (?, ?, ?, ?)
+		 ON CONFLICT(organization_id, user_id) DO UPDATE SET role = excluded.role`,
+		orgID, userID, role, time.Now(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add organization member: %w", err)
+	}
+
+	return r.GetMember(orgID, userID)
+}
+
+// RemoveMember removes a user from an organization
+func (r *OrganizationRepository) RemoveMember(orgID, userID string) error {
+	_, err := r.db.Exec(
+		`DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?`,
+		orgID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to remove organization member: %w", err)
+	}
+	return nil
+}
+
+// CountAdmins counts an organization's admins
+func (r *OrganizationRepository) CountAdmins(orgID string) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM organization_members WHERE organization_id = ? AND role = ?`,
+		orgID, OrgRoleAdmin,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count organization admins: %w", err)
+	}
+	return count, nil
+}
+
+// SetKey stores or replaces an organization's encrypted key for a provider,
+// with the endpoint to use it at ("" for the provider's own)
+func (r *OrganizationRepository) SetKey(orgID, provider string, encryptedKey, nonce []byte, baseURL, userID string) error {
+	_, err := r.db.Exec(
+		`INSERT INTO organization_provider_keys (id, organization_id, provider, encrypted_key, key_nonce, base_url, created_by, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(organization_id, provider) DO UPDATE SET
+			encrypted_key = excluded.encrypted_key,
+			key_nonce = excluded.key_nonce,
+			base_url = excluded.base_url,
+			created_by = excluded.created_by,
+			created_at = excluded.created_at`,
+		uuid.New().String(), orgID, provider, encryptedKey, nonce,
+		sql.NullString{String: baseURL, Valid: baseURL != ""}, userID, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set organization key: %w", err)
+	}
+	return nil
+}
+
+// DeleteKey removes an organization's key for a provider
+func (r *OrganizationRepository) DeleteKey(orgID, provider string) error {
+	_, err := r.db.Exec(
+		`DELETE FROM organization_provider_keys WHERE organization_id = ? AND provider = ?`,
+		orgID, provider,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete organization key: %w", err)
+	}
+	return nil
+}
+
+// ListKeys lists the providers an organization shares keys for
+func (r *OrganizationRepository) ListKeys(orgID string) ([]*OrganizationKey, error) {
+	rows, err := r.db.Query(
+		`SELECT provider, base_url, created_by, created_at
+		 FROM organization_provider_keys
+		 WHERE organization_id = ?
+		 ORDER BY provider ASC`,
+		orgID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*OrganizationKey
+	for rows.Next() {
+		key := &OrganizationKey{}
+		var baseURL, createdBy sql.NullString
+		if err := rows.Scan(&key.Provider, &baseURL, &createdBy, &key.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan organization key: %w", err)
+		}
+		key.BaseURL = baseURL.String
+		key.CreatedBy = createdBy.String
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RecordUsage attributes a request made with an organization's shared key to
+// the member who made it
+func (r *OrganizationRepository) RecordUsage(orgID, userID, provider, model string, tokensUsed int) error {
+	_, err := r.db.Exec(
+		`INSERT INTO organization_key_usage (id, organization_id, user_id, provider, model, tokens_used, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		uuid.New().String(), orgID, userID, provider, model, tokensUsed, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record organization key usage: %w", err)
+	}
+	return nil
+}
+
+// Usage totals requests and tokens per member and provider since the given
+// time, heaviest users first
+func (r *OrganizationRepository) Usage(orgID string, since time.Time) ([]*OrganizationUsage, error) {
+	rows, err := r.db.Query(
+		`SELECT k.user_id, COALESCE(u.email, ''), k.provider, COUNT(*), COALESCE(SUM(k.tokens_used), 0)
+		 FROM organization_key_usage k
+		 LEFT JOIN users u ON u.id = k.user_id
+		 WHERE k.organization_id = ? AND k.created_at >= ?
+		 GROUP BY k.user_id, k.provider
+		 ORDER BY SUM(k.tokens_used) DESC, COUNT(*) DESC`,
+		orgID, since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []*OrganizationUsage{}
+	for rows.Next() {
+		u := &OrganizationUsage{}
+		if err := rows.Scan(&u.UserID, &u.Email, &u.Provider, &u.Requests, &u.TokensUsed); err != nil {
+			return nil, fmt.Errorf("failed to scan organization usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+
+	return usage, rows.Err()
+}
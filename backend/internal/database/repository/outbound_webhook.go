@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/security"
+)
+
+// OutboundWebhook represents a user-registered URL that receives Prism events
+type OutboundWebhook struct {
+	ID             string
+	UserID         string
+	URL            string
+	Secret         string // decrypted, only populated on read
+	Events         []string
+	Enabled        bool
+	LastDeliveryAt *time.Time
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Subscribed reports whether the webhook should receive the given event type
+func (w *OutboundWebhook) Subscribed(eventType string) bool {
+	for _, event := range w.Events {
+		if event == eventType || event == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// OutboundWebhookRepository handles outbound webhook database operations
+type OutboundWebhookRepository struct {
+	db                *sql.DB
+	encryptionService *security.EncryptionService
+}
+
+// NewOutboundWebhookRepository creates a new outbound webhook repository
+func NewOutboundWebhookRepository(db *sql.DB, encryptionService *security.EncryptionService) *OutboundWebhookRepository {
+	return &OutboundWebhookRepository{
+		db:                db,
+		encryptionService: encryptionService,
+	}
+}
+
+const outboundWebhookColumns = `id, user_id, url, secret_encrypted, secret_nonce, events, enabled,
+	last_delivery_at, last_status_code, last_error, created_at, updated_at`
+
+// Create stores a new outbound webhook
+func (r *OutboundWebhookRepository) Create(webhook *OutboundWebhook) error {
+	secretEncrypted, secretNonce, err := r.encryptSecret(webhook.Secret)
+	if err != nil {
+		return err
+	}
+
+	eventsJSON, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+
+	webhook.ID = uuid.New().String()
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = webhook.CreatedAt
+
+	_, err = r.db.Exec(`
+		INSERT INTO outbound_webhooks (id, user_id, url, secret_encrypted, secret_nonce, events, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, webhook.ID, webhook.UserID, webhook.URL, secretEncrypted, secretNonce, string(eventsJSON),
+		webhook.Enabled, webhook.CreatedAt, webhook.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create outbound webhook: %w", err)
+	}
+	return nil
+}
+
+// GetByID retrieves an outbound webhook owned by a user
+func (r *OutboundWebhookRepository) GetByID(id, userID string) (*OutboundWebhook, error) {
+	row := r.db.QueryRow(`
+		SELECT `+outboundWebhookColumns+`
+		FROM outbound_webhooks
+		WHERE id = ? AND user_id = ?
+	`, id, userID)
+
+	webhook, err := r.scanOutboundWebhook(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbound webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// ListByUser retrieves all outbound webhooks for a user
+func (r *OutboundWebhookRepository) ListByUser(userID string) ([]*OutboundWebhook, error) {
+	return r.list(`WHERE user_id = ? ORDER BY created_at DESC`, userID)
+}
+
+// ListEnabledByUser retrieves a user's enabled outbound webhooks
+func (r *OutboundWebhookRepository) ListEnabledByUser(userID string) ([]*OutboundWebhook, error) {
+	return r.list(`WHERE user_id = ? AND enabled = 1`, userID)
+}
+
+func (r *OutboundWebhookRepository) list(where string, args ...interface{}) ([]*OutboundWebhook, error) {
+	rows, err := r.db.Query(`
+		SELECT `+outboundWebhookColumns+`
+		FROM outbound_webhooks
+		`+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outbound webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []*OutboundWebhook
+	for rows.Next() {
+		webhook, err := r.scanOutboundWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbound webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// Update saves a webhook's URL, secret, events and enabled flag
+func (r *OutboundWebhookRepository) Update(webhook *OutboundWebhook) error {
+	secretEncrypted, secretNonce, err := r.encryptSecret(webhook.Secret)
+	if err != nil {
+		return err
+	}
+
+	eventsJSON, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+
+	webhook.UpdatedAt = time.Now()
+	_, err = r.db.Exec(`
+		UPDATE outbound_webhooks
+		SET url = ?, secret_encrypted = ?, secret_nonce = ?, events = ?, enabled = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?
+	`, webhook.URL, secretEncrypted, secretNonce, string(eventsJSON), webhook.Enabled, webhook.UpdatedAt,
+		webhook.ID, webhook.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to update outbound webhook: %w", err)
+	}
+	return nil
+}
+
+// RecordDelivery stores the outcome of the latest delivery to a webhook
+func (r *OutboundWebhookRepository) RecordDelivery(id string, deliveredAt time.Time, statusCode int, deliveryErr string) error {
+	lastError := sql.NullString{String: deliveryErr, Valid: deliveryErr != ""}
+	_, err := r.db.Exec(`
+		UPDATE outbound_webhooks
+		SET last_delivery_at = ?, last_status_code = ?, last_error = ?
+		WHERE id = ?
+	`, deliveredAt, statusCode, lastError, id)
+	if err != nil {
+		return fmt.Errorf("failed to record outbound webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// Delete removes an outbound webhook owned by a user
+func (r *OutboundWebhookRepository) Delete(id, userID string) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM outbound_webhooks WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete outbound webhook: %w", err)
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// encryptSecret encrypts a signing secret; an empty secret is stored as NULL
+func (r *OutboundWebhookRepository) encryptSecret(secret string) ([]byte, []byte, error) {
+	if secret == "" {
+		return nil, nil, nil
+	}
+	encrypted, nonce, err := r.encryptionService.Encrypt([]byte(secret))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	return encrypted, nonce, nil
+}
+
+// scanOutboundWebhook scans a webhook from a row and decrypts its secret
+func (r *OutboundWebhookRepository) scanOutboundWebhook(row interface{ Scan(...interface{}) error }) (*OutboundWebhook, error) {
+	webhook := &OutboundWebhook{}
+	var secretEncrypted, secretNonce []byte
+	var eventsJSON string
+	var lastDeliveryAt sql.NullTime
+	var lastStatusCode sql.NullInt64
+	var lastError sql.NullString
+
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.UserID,
+		&webhook.URL,
+		&secretEncrypted,
+		&secretNonce,
+		&eventsJSON,
+		&webhook.Enabled,
+		&lastDeliveryAt,
+		&lastStatusCode,
+		&lastError,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(eventsJSON), &webhook.Events); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal events: %w", err)
+	}
+	if lastDeliveryAt.Valid {
+		webhook.LastDeliveryAt = &lastDeliveryAt.Time
+	}
+	webhook.LastStatusCode = int(lastStatusCode.Int64)
+	webhook.LastError = lastError.String
+
+	if len(secretEncrypted) > 0 && len(secretNonce) > 0 {
+		decrypted, err := r.encryptionService.Decrypt(secretEncrypted, secretNonce)
+		if err == nil {
+			webhook.Secret = string(decrypted)
+		}
+	}
+
+	return webhook, nil
+}
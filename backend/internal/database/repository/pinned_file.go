@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PinnedFile represents a workspace file pinned to a conversation. Its latest
+// contents are included as context in every request for that conversation.
+type PinnedFile struct {
+	ID             string
+	ConversationID string
+	UserID         string // Owner of the workspace the path is relative to
+	Path           string
+	CreatedAt      time.Time
+}
+
+// PinnedFileRepository handles pinned file database operations
+type PinnedFileRepository struct {
+	db *sql.DB
+}
+
+// NewPinnedFileRepository creates a new pinned file repository
+func NewPinnedFileRepository(db *sql.DB) *PinnedFileRepository {
+	return &PinnedFileRepository{db: db}
+}
+
+// Pin pins a file to a conversation. Pinning an already pinned path returns
+// the existing pin.
+func (r *PinnedFileRepository) Pin(conversationID, userID, path string) (*PinnedFile, error) {
+	existing, err := r.GetByPath(conversationID, path)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	id := uuid.New().String()
+	now := time.Now()
+
+	_, err = r.db.Exec(
+		`INSERT INTO conversation_pinned_files (id, conversation_id, user_id, path, created_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		id, conversationID, userID, path, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pin file: %w", err)
+	}
+
+	return &PinnedFile{
+		ID:             id,
+		ConversationID: conversationID,
+		UserID:         userID,
+		Path:           path,
+		CreatedAt:      now,
+	}, nil
+}
+
+// GetByPath retrieves a pinned file by conversation and path
+func (r *PinnedFileRepository) GetByPath(conversationID, path string) (*PinnedFile, error) {
+	file := &PinnedFile{}
+	err := r.db.QueryRow(
+		`SELECT id, conversation_id, user_id, path, created_at
+		 FROM conversation_pinned_files WHERE conversation_id = ? AND path = ?`,
+		conversationID, path,
+	).Scan(&file.ID, &file.ConversationID, &file.UserID, &file.Path, &file.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pinned file: %w", err)
+	}
+
+	return file, nil
+}
+
+// ListByConversationID returns the files pinned to a conversation, oldest first
+func (r *PinnedFileRepository) ListByConversationID(conversationID string) ([]*PinnedFile, error) {
+	rows, err := r.db.Query(
+		`SELECT id, conversation_id, user_id, path, created_at
+		 FROM conversation_pinned_files WHERE conversation_id = ?
+		 ORDER BY created_at ASC`,
+		conversationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pinned files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []*PinnedFile
+	for rows.Next() {
+		file := &PinnedFile{}
+		if err := rows.Scan(&file.ID, &file.ConversationID, &file.UserID, &file.Path, &file.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan pinned file: %w", err)
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// Count returns the number of files pinned to a conversation
+func (r *PinnedFileRepository) Count(conversationID string) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		`SELECT COUNT(*) FROM conversation_pinned_files WHERE conversation_id = ?`,
+		conversationID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pinned files: %w", err)
+	}
+	return count, nil
+}
+
+// Unpin removes a pinned file from a conversation. It reports whether a pin
+// was removed.
+func (r *PinnedFileRepository) Unpin(conversationID, id string) (bool, error) {
+	result, err := r.db.Exec(
+		`DELETE FROM conversation_pinned_files WHERE id = ? AND conversation_id = ?`,
+		id, conversationID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to unpin file: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to unpin file: %w", err)
+	}
+	return rows > 0, nil
+}
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Tool confirmation modes
+const (
+	ConfirmAlways   = "always"    // Ask before every tool that needs confirmation
+	ConfirmReadOnly = "read_only" // Run read-only tools without asking
+	ConfirmTrusted  = "trusted"   // Also run the tools in TrustedTools without asking
+)
+
+// UserPreferences holds a user's defaults for new conversations and agent
+// runs, how tools are confirmed, and notification and display settings
+type UserPreferences struct {
+	UserID              string
+	DefaultProvider     string
+	DefaultModel        string
+	DefaultSystemPrompt string
+	DefaultTemperature  *float64 // nil uses the provider's default
+	ToolConfirmation    string   // One of the Confirm constants
+	TrustedTools        []string // Tool names, or prefixes ending in "*"
+	MaxToolIterations   int      // Tool calls before the agent checks in; 0 uses the default
+	Timezone            string
+
+	NotificationsEnabled bool
+	NotificationEvents   []string // Event types to be notified of; empty means all
+
+	// UIHints is stored for the client as is, e.g. a theme or layout
+	UIHints map[string]interface{}
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DefaultUserPreferences returns the preferences of a user who hasn't set any
+func DefaultUserPreferences(userID string) *UserPreferences {
+	return &UserPreferences{
+		UserID:               userID,
+		ToolConfirmation:     ConfirmAlways,
+		TrustedTools:         []string{},
+		Timezone:             "UTC",
+		NotificationsEnabled: true,
+		NotificationEvents:   []string{},
+		UIHints:              map[string]interface{}{},
+	}
+}
+
+// WantsNotification reports whether the user wants to be notified of an event type
+func (p *UserPreferences) WantsNotification(eventType string) bool {
+	if !p.NotificationsEnabled {
+		return false
+	}
+	if len(p.NotificationEvents) == 0 {
+		return true
+	}
+	for _, event := range p.NotificationEvents {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// FillModel fills in an empty provider and model from a default. The default
+// model only applies to the default provider.
+func FillModel(provider, model *string, defaultProvider, defaultModel string) {
+	if *provider == "" {
+		*provider = defaultProvider
+		if *model == "" {
+			*model = defaultModel
+		}
+	} else if *model == "" && *provider == defaultProvider {
+		*model = defaultModel
+	}
+}
+
+// UserPreferencesRepository handles user preferences database operations
+type UserPreferencesRepository struct {
+	db *sql.DB
+}
+
+// NewUserPreferencesRepository creates a new user preferences repository
+func NewUserPreferencesRepository(db *sql.DB) *UserPreferencesRepository {
+	return &UserPreferencesRepository{db: db}
+}
+
+// Upsert creates or updates a user's preferences
+func (r *UserPreferencesRepository) Upsert(prefs *UserPreferences) error {
+	trustedTools, err := json.Marshal(nonNilStrings(prefs.TrustedTools))
+	if err != nil {
+		return fmt.Errorf("failed to marshal trusted tools: %w", err)
+	}
+	events, err := json.Marshal(nonNilStrings(prefs.NotificationEvents))
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification events: %w", err)
+	}
+	hints := prefs.UIHints
+	if hints == nil {
+		hints = map[string]interface{}{}
+	}
+	uiHints, err := json.Marshal(hints)
+	if err != nil {
+		return fmt.Errorf("failed to marshal UI hints: %w", err)
+	}
+
+	now := time.Now()
+	_, err = r.db.Exec(`
+		INSERT INTO user_preferences (
+			user_id, default_provider, default_model, default_system_prompt, default_temperature,
+			tool_confirmation, trusted_tools, max_tool_iterations, timezone,
+			notifications_enabled, notification_events, ui_hints, created_at, updated_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			default_provider = excluded.default_provider,
+			default_model = excluded.default_model,
+			default_system_prompt = excluded.default_system_prompt,
+			default_temperature = excluded.default_temperature,
+			tool_confirmation = excluded.tool_confirmation,
+			trusted_tools = excluded.trusted_tools,
+			max_tool_iterations = excluded.max_tool_iterations,
+			timezone = excluded.timezone,
+			notifications_enabled = excluded.notifications_enabled,
+			notification_events = excluded.notification_events,
+			ui_hints = excluded.ui_hints,
+			updated_at = excluded.updated_at
+	`, prefs.UserID, prefs.DefaultProvider, prefs.DefaultModel, prefs.DefaultSystemPrompt, prefs.DefaultTemperature,
+		prefs.ToolConfirmation, string(trustedTools), prefs.MaxToolIterations, prefs.Timezone,
+		prefs.NotificationsEnabled, string(events), string(uiHints), now, now)
+	if err != nil {
+		return fmt.Errorf("failed to save user preferences: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a user's preferences, or nil if they haven't set any
+func (r *UserPreferencesRepository) Get(userID string) (*UserPreferences, error) {
+	prefs := &UserPreferences{UserID: userID}
+	var temperature sql.NullFloat64
+	var trustedTools, events, uiHints string
+
+	err := r.db.QueryRow(`
+		SELECT default_provider, default_model, default_system_prompt, default_temperature,
+			tool_confirmation, trusted_tools, max_tool_iterations, timezone,
+			notifications_enabled, notification_events, ui_hints, created_at, updated_at
+		FROM user_preferences
+		WHERE user_id = ?
+	`, userID).Scan(
+		&prefs.DefaultProvider,
+		&prefs.DefaultModel,
+		&prefs.DefaultSystemPrompt,
+		&temperature,
+		&prefs.ToolConfirmation,
+		&trustedTools,
+		&prefs.MaxToolIterations,
+		&prefs.Timezone,
+		&prefs.NotificationsEnabled,
+		&events,
+		&uiHints,
+		&prefs.CreatedAt,
+		&prefs.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user preferences: %w", err)
+	}
+
+	if temperature.Valid {
+		prefs.DefaultTemperature = &temperature.Float64
+	}
+	if err := json.Unmarshal([]byte(trustedTools), &prefs.TrustedTools); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal trusted tools: %w", err)
+	}
+	if err := json.Unmarshal([]byte(events), &prefs.NotificationEvents); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal notification events: %w", err)
+	}
+	if err := json.Unmarshal([]byte(uiHints), &prefs.UIHints); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal UI hints: %w", err)
+	}
+	return prefs, nil
+}
+
+// GetOrDefault retrieves a user's preferences, or the defaults if they
+// haven't set any
+func (r *UserPreferencesRepository) GetOrDefault(userID string) (*UserPreferences, error) {
+	prefs, err := r.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	if prefs == nil {
+		return DefaultUserPreferences(userID), nil
+	}
+	return prefs, nil
+}
+
+// Delete removes a user's preferences, restoring the defaults
+func (r *UserPreferencesRepository) Delete(userID string) error {
+	_, err := r.db.Exec(`DELETE FROM user_preferences WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user preferences: %w", err)
+	}
+	return nil
+}
+
+// nonNilStrings returns s, or an empty slice if it is nil, so it is stored
+// as [] rather than null
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -17,6 +17,11 @@ type ProviderKey struct {
 	KeyNonce     []byte
 	IsActive     bool
 	CreatedAt    time.Time
+	BaseURL      string // Endpoint of an OpenAI-compatible server; "" for the provider's own
+
+	// OrganizationID is set when the key is shared by one of the user's
+	// organizations rather than their own
+	OrganizationID string
 }
 
 // ProviderKeyRepository handles provider key database operations
@@ -29,20 +34,22 @@ func NewProviderKeyRepository(db *sql.DB) *ProviderKeyRepository {
 	return &ProviderKeyRepository{db: db}
 }
 
-// SetKey stores or updates an encrypted API key for a provider
-func (r *ProviderKeyRepository) SetKey(userID, provider string, encryptedKey, nonce []byte) error {
+// SetKey stores or updates an encrypted API key for a provider, with the
+// endpoint to use it at ("" for the provider's own)
+func (r *ProviderKeyRepository) SetKey(userID, provider string, encryptedKey, nonce []byte, baseURL string) error {
 	id := uuid.New().String()
 	now := time.Now()
 
 	// Use UPSERT to insert or update
 	_, err := r.db.Exec(`
-		INSERT INTO provider_keys (id, user_id, provider, encrypted_key, key_nonce, is_active, created_at)
-		VALUES (?, ?, ?, ?, ?, 1, ?)
+		INSERT INTO provider_keys (id, user_id, provider, encrypted_key, key_nonce, is_active, created_at, base_url)
+		VALUES (?, ?, ?, ?, ?, 1, ?, ?)
 		ON CONFLICT(user_id, provider) DO UPDATE SET
 			encrypted_key = excluded.encrypted_key,
 			key_nonce = excluded.key_nonce,
-			is_active = 1
-	`, id, userID, provider, encryptedKey, nonce, now)
+			is_active = 1,
+			base_url = excluded.base_url
+	`, id, userID, provider, encryptedKey, nonce, now, sql.NullString{String: baseURL, Valid: baseURL != ""})
 
 	if err != nil {
 		return fmt.Errorf("failed to set provider key: %w", err)
@@ -51,12 +58,15 @@ func (r *ProviderKeyRepository) SetKey(userID, provider string, encryptedKey, no
 	return nil
 }
 
-// GetKey retrieves an encrypted API key for a provider
+// GetKey retrieves an encrypted API key for a provider. A user without
+// their own key gets one shared by an organization they belong to, from the
+// organization they joined first.
 func (r *ProviderKeyRepository) GetKey(userID, provider string) (*ProviderKey, error) {
 	key := &ProviderKey{}
+	var baseURL sql.NullString
 
 	err := r.db.QueryRow(`
-		SELECT id, user_id, provider, encrypted_key, key_nonce, is_active, created_at
+		SELECT id, user_id, provider, encrypted_key, key_nonce, is_active, created_at, base_url
 		FROM provider_keys
 		WHERE user_id = ? AND provider = ? AND is_active = 1
 	`, userID, provider).Scan(
@@ -67,15 +77,50 @@ func (r *ProviderKeyRepository) GetKey(userID, provider string) (*ProviderKey, e
 		&key.KeyNonce,
 		&key.IsActive,
 		&key.CreatedAt,
+		&baseURL,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return r.getSharedKey(userID, provider)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get provider key: %w", err)
 	}
 
+	key.BaseURL = baseURL.String
+	return key, nil
+}
+
+// getSharedKey retrieves a provider key shared with a user by an organization
+func (r *ProviderKeyRepository) getSharedKey(userID, provider string) (*ProviderKey, error) {
+	key := &ProviderKey{UserID: userID, IsActive: true}
+	var baseURL sql.NullString
+
+	err := r.db.QueryRow(`
+		SELECT k.id, k.provider, k.encrypted_key, k.key_nonce, k.created_at, k.organization_id, k.base_url
+		FROM organization_provider_keys k
+		JOIN organization_members m ON m.organization_id = k.organization_id
+		WHERE m.user_id = ? AND k.provider = ?
+		ORDER BY m.created_at ASC
+		LIMIT 1
+	`, userID, provider).Scan(
+		&key.ID,
+		&key.Provider,
+		&key.EncryptedKey,
+		&key.KeyNonce,
+		&key.CreatedAt,
+		&key.OrganizationID,
+		&baseURL,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shared provider key: %w", err)
+	}
+
+	key.BaseURL = baseURL.String
 	return key, nil
 }
 
@@ -117,13 +162,18 @@ func (r *ProviderKeyRepository) ListKeys(userID string) ([]ProviderKey, error) {
 	return keys, nil
 }
 
-// HasKey checks if a user has a key for a specific provider
+// HasKey checks if a user has a key for a specific provider, either their
+// own or one shared by an organization they belong to
 func (r *ProviderKeyRepository) HasKey(userID, provider string) (bool, error) {
 	var count int
 	err := r.db.QueryRow(`
-		SELECT COUNT(*) FROM provider_keys
-		WHERE user_id = ? AND provider = ? AND is_active = 1
-	`, userID, provider).Scan(&count)
+		SELECT
+			(SELECT COUNT(*) FROM provider_keys
+			 WHERE user_id = ? AND provider = ? AND is_active = 1) +
+			(SELECT COUNT(*) FROM organization_provider_keys k
+			 JOIN organization_members m ON m.organization_id = k.organization_id
+			 WHERE m.user_id = ? AND k.provider = ?)
+	`, userID, provider, userID, provider).Scan(&count)
 
 	if err != nil {
 		return false, fmt.Errorf("failed to check provider key: %w", err)
@@ -131,3 +181,30 @@ func (r *ProviderKeyRepository) HasKey(userID, provider string) (bool, error) {
 
 	return count > 0, nil
 }
+
+// ListSharedProviders lists the providers organizations share keys for with
+// a user
+func (r *ProviderKeyRepository) ListSharedProviders(userID string) ([]string, error) {
+	rows, err := r.db.Query(`
+		SELECT DISTINCT k.provider
+		FROM organization_provider_keys k
+		JOIN organization_members m ON m.organization_id = k.organization_id
+		WHERE m.user_id = ?
+		ORDER BY k.provider
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shared providers: %w", err)
+	}
+	defer rows.Close()
+
+	providers := []string{}
+	for rows.Next() {
+		var provider string
+		if err := rows.Scan(&provider); err != nil {
+			return nil, fmt.Errorf("failed to scan shared provider: %w", err)
+		}
+		providers = append(providers, provider)
+	}
+
+	return providers, rows.Err()
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/security"
+)
+
+// Secret is a named value in a user's vault. Listings never include the
+// value itself.
+type Secret struct {
+	ID        string
+	UserID    string
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SecretRepository handles user secret database operations. Values are
+// encrypted at rest.
+type SecretRepository struct {
+	db                *sql.DB
+	encryptionService *security.EncryptionService
+}
+
+// NewSecretRepository creates a new secret repository
+func NewSecretRepository(db *sql.DB, encryptionService *security.EncryptionService) *SecretRepository {
+	return &SecretRepository{
+		db:                db,
+		encryptionService: encryptionService,
+	}
+}
+
+// Set stores a user's secret, replacing any with the same name
+func (r *SecretRepository) Set(userID, name, value string) (*Secret, error) {
+	encrypted, nonce, err := r.encryptionService.Encrypt([]byte(value))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	now := time.Now()
+	_, err = r.db.Exec(
+		`INSERT INTO user_secrets (id, user_id, name, value_encrypted, value_nonce, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(user_id, name) DO UPDATE SET
+			value_encrypted = excluded.value_encrypted,
+			value_nonce = excluded.value_nonce,
+			updated_at = excluded.updated_at`,
+		uuid.New().String(), userID, name, encrypted, nonce, now, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save secret: %w", err)
+	}
+
+	secret := &Secret{UserID: userID, Name: name, UpdatedAt: now}
+	err = r.db.QueryRow(
+		`SELECT id, created_at FROM user_secrets WHERE user_id = ? AND name = ?`,
+		userID, name,
+	).Scan(&secret.ID, &secret.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret: %w", err)
+	}
+	return secret, nil
+}
+
+// List retrieves a user's secrets, without their values, ordered by name
+func (r *SecretRepository) List(userID string) ([]*Secret, error) {
+	rows, err := r.db.Query(
+		`SELECT id, user_id, name, created_at, updated_at FROM user_secrets
+		 WHERE user_id = ? ORDER BY name`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	defer rows.Close()
+
+	secrets := []*Secret{}
+	for rows.Next() {
+		secret := &Secret{}
+		if err := rows.Scan(&secret.ID, &secret.UserID, &secret.Name, &secret.CreatedAt, &secret.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan secret: %w", err)
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, rows.Err()
+}
+
+// GetValue retrieves and decrypts a user's secret. It reports false if the
+// user has no secret by that name.
+func (r *SecretRepository) GetValue(userID, name string) (string, bool, error) {
+	var encrypted, nonce []byte
+	err := r.db.QueryRow(
+		`SELECT value_encrypted, value_nonce FROM user_secrets WHERE user_id = ? AND name = ?`,
+		userID, name,
+	).Scan(&encrypted, &nonce)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	value, err := r.encryptionService.Decrypt(encrypted, nonce)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(value), true, nil
+}
+
+// Delete removes a user's secret. It reports false if there was none by that
+// name.
+func (r *SecretRepository) Delete(userID, name string) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM user_secrets WHERE user_id = ? AND name = ?`, userID, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete secret: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete secret: %w", err)
+	}
+	return n > 0, nil
+}
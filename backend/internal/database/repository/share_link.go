@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareLink represents a public read-only link to a conversation transcript
+type ShareLink struct {
+	ID             string
+	ConversationID string
+	UserID         string
+	ExpiresAt      time.Time
+	RevokedAt      *time.Time
+	ViewCount      int
+	CreatedAt      time.Time
+}
+
+// IsActive reports whether the link is neither revoked nor expired
+func (l *ShareLink) IsActive() bool {
+	return l.RevokedAt == nil && time.Now().Before(l.ExpiresAt)
+}
+
+// ShareLinkRepository handles share link database operations
+type ShareLinkRepository struct {
+	db *sql.DB
+}
+
+// NewShareLinkRepository creates a new share link repository
+func NewShareLinkRepository(db *sql.DB) *ShareLinkRepository {
+	return &ShareLinkRepository{db: db}
+}
+
+// Create creates a new share link for a conversation
+func (r *ShareLinkRepository) Create(conversationID, userID string, expiresAt time.Time) (*ShareLink, error) {
+	id := uuid.New().String()
+	now := time.Now()
+
+	_, err := r.db.Exec(
+		`INSERT INTO conversation_share_links (id, conversation_id, user_id, expires_at, created_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		id, conversationID, userID, expiresAt, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	return &ShareLink{
+		ID:             id,
+		ConversationID: conversationID,
+		UserID:         userID,
+		ExpiresAt:      expiresAt,
+		CreatedAt:      now,
+	}, nil
+}
+
+// GetByID retrieves a share link by ID
+func (r *ShareLinkRepository) GetByID(id string) (*ShareLink, error) {
+	link := &ShareLink{}
+	var revokedAt sql.NullTime
+
+	err := r.db.QueryRow(
+		`SELECT id, conversation_id, user_id, expires_at, revoked_at, view_count, created_at
+		 FROM conversation_share_links WHERE id = ?`,
+		id,
+	).Scan(&link.ID, &link.ConversationID, &link.UserID, &link.ExpiresAt, &revokedAt, &link.ViewCount, &link.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share link: %w", err)
+	}
+
+	if revokedAt.Valid {
+		link.RevokedAt = &revokedAt.Time
+	}
+
+	return link, nil
+}
+
+// ListByConversationID retrieves all share links for a conversation
+func (r *ShareLinkRepository) ListByConversationID(conversationID string) ([]*ShareLink, error) {
+	rows, err := r.db.Query(
+		`SELECT id, conversation_id, user_id, expires_at, revoked_at, view_count, created_at
+		 FROM conversation_share_links WHERE conversation_id = ? ORDER BY created_at DESC`,
+		conversationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list share links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []*ShareLink
+	for rows.Next() {
+		link := &ShareLink{}
+		var revokedAt sql.NullTime
+
+		if err := rows.Scan(&link.ID, &link.ConversationID, &link.UserID, &link.ExpiresAt, &revokedAt, &link.ViewCount, &link.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan share link: %w", err)
+		}
+		if revokedAt.Valid {
+			link.RevokedAt = &revokedAt.Time
+		}
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+// Revoke marks a share link as revoked
+func (r *ShareLinkRepository) Revoke(id string) error {
+	_, err := r.db.Exec(
+		`UPDATE conversation_share_links SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`,
+		time.Now(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+	return nil
+}
+
+// IncrementViewCount records a view of a share link
+func (r *ShareLinkRepository) IncrementViewCount(id string) error {
+	_, err := r.db.Exec(
+		`UPDATE conversation_share_links SET view_count = view_count + 1 WHERE id = ?`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update share link views: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SlackLink maps a Slack user in a workspace to a Prism account
+type SlackLink struct {
+	SlackTeamID   string
+	SlackUserID   string
+	SlackUsername string
+	UserID        string
+	CreatedAt     time.Time
+}
+
+// SlackLinkRepository handles Slack account link database operations
+type SlackLinkRepository struct {
+	db *sql.DB
+}
+
+// NewSlackLinkRepository creates a new Slack link repository
+func NewSlackLinkRepository(db *sql.DB) *SlackLinkRepository {
+	return &SlackLinkRepository{db: db}
+}
+
+// Link maps a Slack user to a Prism account, replacing any existing link
+func (r *SlackLinkRepository) Link(link *SlackLink) error {
+	link.CreatedAt = time.Now()
+	_, err := r.db.Exec(`
+		INSERT INTO slack_user_links (slack_team_id, slack_user_id, slack_username, user_id, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(slack_team_id, slack_user_id) DO UPDATE SET
+			slack_username = excluded.slack_username,
+			user_id = excluded.user_id,
+			created_at = excluded.created_at
+	`, link.SlackTeamID, link.SlackUserID, link.SlackUsername, link.UserID, link.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to link slack user: %w", err)
+	}
+	return nil
+}
+
+// GetUserID returns the Prism user linked to a Slack user, or "" if none
+func (r *SlackLinkRepository) GetUserID(teamID, slackUserID string) (string, error) {
+	var userID string
+	err := r.db.QueryRow(`
+		SELECT user_id FROM slack_user_links WHERE slack_team_id = ? AND slack_user_id = ?
+	`, teamID, slackUserID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get slack link: %w", err)
+	}
+	return userID, nil
+}
+
+// ListByUser returns the Slack accounts linked to a Prism user
+func (r *SlackLinkRepository) ListByUser(userID string) ([]*SlackLink, error) {
+	rows, err := r.db.Query(`
+		SELECT slack_team_id, slack_user_id, slack_username, user_id, created_at
+		FROM slack_user_links
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list slack links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []*SlackLink
+	for rows.Next() {
+		link := &SlackLink{}
+		var username sql.NullString
+		if err := rows.Scan(&link.SlackTeamID, &link.SlackUserID, &username, &link.UserID, &link.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan slack link: %w", err)
+		}
+		link.SlackUsername = username.String
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// Unlink removes a Slack user's link. When userID is set, only a link to
+// that Prism user is removed.
+func (r *SlackLinkRepository) Unlink(teamID, slackUserID, userID string) (bool, error) {
+	query := `DELETE FROM slack_user_links WHERE slack_team_id = ? AND slack_user_id = ?`
+	args := []interface{}{teamID, slackUserID}
+	if userID != "" {
+		query += ` AND user_id = ?`
+		args = append(args, userID)
+	}
+
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to unlink slack user: %w", err)
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
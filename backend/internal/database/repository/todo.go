@@ -19,6 +19,18 @@ type Todo struct {
 	UpdatedAt     time.Time
 }
 
+// Todo statuses
+const (
+	TodoStatusPending    = "pending"
+	TodoStatusInProgress = "in_progress"
+	TodoStatusCompleted  = "completed"
+)
+
+// IsValidTodoStatus reports whether status is a known todo status
+func IsValidTodoStatus(status string) bool {
+	return status == TodoStatusPending || status == TodoStatusInProgress || status == TodoStatusCompleted
+}
+
 // TodoRepository handles todo database operations
 type TodoRepository struct {
 	db *sql.DB
@@ -94,6 +106,29 @@ func (r *TodoRepository) GetAll(userID, workspacePath string) ([]*Todo, error) {
 	return todos, rows.Err()
 }
 
+// GetByID retrieves a single todo by ID
+func (r *TodoRepository) GetByID(id string) (*Todo, error) {
+	todo := &Todo{}
+	err := r.db.QueryRow(`
+		SELECT id, user_id, workspace_path, content, active_form, status, created_at, updated_at
+		FROM workspace_todos
+		WHERE id = ?
+	`, id).Scan(&todo.ID, &todo.UserID, &todo.WorkspacePath, &todo.Content, &todo.ActiveForm, &todo.Status, &todo.CreatedAt, &todo.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+// UpdateStatus changes the status of a single todo
+func (r *TodoRepository) UpdateStatus(id, status string) error {
+	_, err := r.db.Exec(`UPDATE workspace_todos SET status = ?, updated_at = ? WHERE id = ?`, status, time.Now(), id)
+	return err
+}
+
 // GetByUserID retrieves all todos for a user across all workspaces
 func (r *TodoRepository) GetByUserID(userID string) ([]*Todo, error) {
 	rows, err := r.db.Query(`
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jacklau/prism/internal/security"
+)
+
+// ToolResult is the full result of a tool call whose message holds a
+// truncated copy
+type ToolResult struct {
+	MessageID string
+	Content   string
+	CreatedAt time.Time
+}
+
+// ToolResultRepository handles full tool result database operations
+type ToolResultRepository struct {
+	db                *sql.DB
+	encryptionService *security.EncryptionService
+	encrypt           bool
+}
+
+// NewToolResultRepository creates a new tool result repository. With
+// encrypt set, new results are stored encrypted like message content.
+func NewToolResultRepository(db *sql.DB, encryptionService *security.EncryptionService, encrypt bool) *ToolResultRepository {
+	if encryptionService == nil {
+		encrypt = false
+	}
+	return &ToolResultRepository{
+		db:                db,
+		encryptionService: encryptionService,
+		encrypt:           encrypt,
+	}
+}
+
+// Save stores the full result for a tool message
+func (r *ToolResultRepository) Save(messageID, content string) error {
+	var stored interface{} = content
+	var nonce []byte
+	if r.encrypt {
+		ciphertext, n, err := r.encryptionService.Encrypt([]byte(content))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt tool result: %w", err)
+		}
+		stored, nonce = ciphertext, n
+	}
+
+	_, err := r.db.Exec(
+		`INSERT INTO tool_results (message_id, content, content_nonce, created_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(message_id) DO UPDATE SET content = excluded.content, content_nonce = excluded.content_nonce`,
+		messageID, stored, nonce, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save tool result: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves the full result for a tool message, or nil if it wasn't
+// truncated
+func (r *ToolResultRepository) Get(messageID string) (*ToolResult, error) {
+	result := &ToolResult{}
+	var content, nonce []byte
+	err := r.db.QueryRow(
+		`SELECT message_id, content, content_nonce, created_at FROM tool_results WHERE message_id = ?`,
+		messageID,
+	).Scan(&result.MessageID, &content, &nonce, &result.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tool result: %w", err)
+	}
+
+	if nonce != nil {
+		if r.encryptionService == nil {
+			return nil, fmt.Errorf("tool result of message %s is encrypted", messageID)
+		}
+		if content, err = r.encryptionService.Decrypt(content, nonce); err != nil {
+			return nil, fmt.Errorf("failed to decrypt tool result: %w", err)
+		}
+	}
+	result.Content = string(content)
+	return result, nil
+}
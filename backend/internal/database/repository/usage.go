@@ -0,0 +1,320 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Usage event kinds
+const (
+	UsageKindTool  = "tool"
+	UsageKindAgent = "agent"
+	UsageKindSwarm = "swarm"
+	UsageKindBuild = "build"
+)
+
+// UsageEvent is a finished agent run, swarm, build or tool execution
+type UsageEvent struct {
+	ID             string
+	UserID         string
+	ConversationID string // Set for events started from a conversation
+	Kind           string
+	Name           string // tool name, agent name, swarm strategy or build command
+	Status         string // "completed" or "failed"
+	DurationMs     int64
+	CreatedAt      time.Time
+}
+
+// UsageSummary aggregates a user's usage over a time window
+type UsageSummary struct {
+	Conversations   int   `json:"conversations"`
+	Messages        int   `json:"messages"`
+	TokensUsed      int64 `json:"tokens_used"`
+	ToolExecutions  int   `json:"tool_executions"`
+	ToolFailures    int   `json:"tool_failures"`
+	AgentRuns       int   `json:"agent_runs"`
+	AgentFailures   int   `json:"agent_failures"`
+	SwarmRuns       int   `json:"swarm_runs"`
+	Builds          int   `json:"builds"`
+	BuildFailures   int   `json:"build_failures"`
+	BuildDurationMs int64 `json:"build_duration_ms"`
+}
+
+// DailyUsage is a user's usage on a single (UTC) day
+type DailyUsage struct {
+	Date            string `json:"date"` // YYYY-MM-DD
+	Messages        int    `json:"messages"`
+	TokensUsed      int64  `json:"tokens_used"`
+	ToolExecutions  int    `json:"tool_executions"`
+	AgentRuns       int    `json:"agent_runs"`
+	Builds          int    `json:"builds"`
+	BuildDurationMs int64  `json:"build_duration_ms"`
+}
+
+// UsageRepository handles usage statistics database operations
+type UsageRepository struct {
+	db *sql.DB
+}
+
+// NewUsageRepository creates a new usage repository
+func NewUsageRepository(db *sql.DB) *UsageRepository {
+	return &UsageRepository{db: db}
+}
+
+// Record stores a usage event
+func (r *UsageRepository) Record(event *UsageEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO usage_events (id, user_id, conversation_id, kind, name, status, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, event.ID, event.UserID, sql.NullString{String: event.ConversationID, Valid: event.ConversationID != ""}, event.Kind, event.Name, event.Status, event.DurationMs, event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record usage event: %w", err)
+	}
+	return nil
+}
+
+// ListByConversation lists the usage events of the given kinds started from
+// a conversation, oldest first
+func (r *UsageRepository) ListByConversation(conversationID string, kinds ...string) ([]*UsageEvent, error) {
+	query := `
+		SELECT id, user_id, kind, COALESCE(name, ''), status, duration_ms, created_at
+		FROM usage_events
+		WHERE conversation_id = ?`
+	args := []interface{}{conversationID}
+	if len(kinds) > 0 {
+		query += ` AND kind IN (?` + strings.Repeat(`, ?`, len(kinds)-1) + `)`
+		for _, kind := range kinds {
+			args = append(args, kind)
+		}
+	}
+	query += ` ORDER BY created_at ASC, rowid ASC`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*UsageEvent
+	for rows.Next() {
+		event := &UsageEvent{ConversationID: conversationID}
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Kind, &event.Name, &event.Status, &event.DurationMs, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan usage event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// Summarize aggregates a user's usage since the given time
+func (r *UsageRepository) Summarize(userID string, since time.Time) (*UsageSummary, error) {
+	summary := &UsageSummary{}
+
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM conversations WHERE user_id = ? AND created_at >= ?
+	`, userID, since).Scan(&summary.Conversations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count conversations: %w", err)
+	}
+
+	err = r.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(m.tokens_used), 0)
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE c.user_id = ? AND m.created_at >= ? AND m.role IN ('user', 'assistant')
+	`, userID, since).Scan(&summary.Messages, &summary.TokensUsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages: %w", err)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT kind, status, COUNT(*), COALESCE(SUM(duration_ms), 0)
+		FROM usage_events
+		WHERE user_id = ? AND created_at >= ?
+		GROUP BY kind, status
+	`, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize usage events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind, status string
+		var count int
+		var durationMs int64
+		if err := rows.Scan(&kind, &status, &count, &durationMs); err != nil {
+			return nil, fmt.Errorf("failed to scan usage events: %w", err)
+		}
+
+		failures := 0
+		if status == "failed" {
+			failures = count
+		}
+		switch kind {
+		case UsageKindTool:
+			summary.ToolExecutions += count
+			summary.ToolFailures += failures
+		case UsageKindAgent:
+			summary.AgentRuns += count
+			summary.AgentFailures += failures
+		case UsageKindSwarm:
+			summary.SwarmRuns += count
+		case UsageKindBuild:
+			summary.Builds += count
+			summary.BuildFailures += failures
+			summary.BuildDurationMs += durationMs
+		}
+	}
+
+	return summary, rows.Err()
+}
+
+// Daily returns a user's usage per day since the given time. Days without
+// any usage are omitted.
+func (r *UsageRepository) Daily(userID string, since time.Time) ([]*DailyUsage, error) {
+	days := make(map[string]*DailyUsage)
+	day := func(date string) *DailyUsage {
+		if days[date] == nil {
+			days[date] = &DailyUsage{Date: date}
+		}
+		return days[date]
+	}
+
+	rows, err := r.db.Query(`
+		SELECT date(m.created_at), COUNT(*), COALESCE(SUM(m.tokens_used), 0)
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE c.user_id = ? AND m.created_at >= ? AND m.role IN ('user', 'assistant')
+		GROUP BY date(m.created_at)
+	`, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily messages: %w", err)
+	}
+	for rows.Next() {
+		var date sql.NullString
+		var count int
+		var tokens int64
+		if err := rows.Scan(&date, &count, &tokens); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan daily messages: %w", err)
+		}
+		if !date.Valid {
+			continue
+		}
+		d := day(date.String)
+		d.Messages = count
+		d.TokensUsed = tokens
+	}
+	rows.Close()
+
+	rows, err = r.db.Query(`
+		SELECT date(created_at), kind, COUNT(*), COALESCE(SUM(duration_ms), 0)
+		FROM usage_events
+		WHERE user_id = ? AND created_at >= ?
+		GROUP BY date(created_at), kind
+	`, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily usage events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var date sql.NullString
+		var kind string
+		var count int
+		var durationMs int64
+		if err := rows.Scan(&date, &kind, &count, &durationMs); err != nil {
+			return nil, fmt.Errorf("failed to scan daily usage events: %w", err)
+		}
+		if !date.Valid {
+			continue
+		}
+		d := day(date.String)
+		switch kind {
+		case UsageKindTool:
+			d.ToolExecutions += count
+		case UsageKindAgent:
+			d.AgentRuns += count
+		case UsageKindBuild:
+			d.Builds += count
+			d.BuildDurationMs += durationMs
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]*DailyUsage, 0, len(days))
+	for _, d := range days {
+		result = append(result, d)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Date < result[j].Date
+	})
+	return result, nil
+}
+
+// Failures returns a user's most recent failed agent runs, swarms, builds
+// and tool executions since the given time, newest first
+func (r *UsageRepository) Failures(userID string, since time.Time, limit int) ([]*UsageEvent, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, kind, COALESCE(name, ''), status, duration_ms, created_at
+		FROM usage_events
+		WHERE user_id = ? AND created_at >= ? AND status = 'failed'
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, userID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failures: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*UsageEvent
+	for rows.Next() {
+		event := &UsageEvent{}
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Kind, &event.Name, &event.Status, &event.DurationMs, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan failure: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// WebhookDeliveries counts the deliveries to a user's GitHub webhooks since
+// the given time by status
+func (r *UsageRepository) WebhookDeliveries(userID string, since time.Time) (map[string]int, error) {
+	rows, err := r.db.Query(`
+		SELECT d.status, COUNT(*)
+		FROM webhook_deliveries d
+		JOIN github_webhooks w ON w.id = d.webhook_id
+		WHERE w.user_id = ? AND d.created_at >= ?
+		GROUP BY d.status
+	`, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook deliveries: %w", err)
+		}
+		counts[status] = count
+	}
+	return counts, rows.Err()
+}
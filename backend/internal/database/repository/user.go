@@ -16,6 +16,7 @@ type User struct {
 	GitHubToken       string
 	GitHubUsername    string
 	GitHubConnectedAt *time.Time
+	IsGuest           bool // Temporary account from guest login, deleted once idle
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
 }
@@ -52,6 +53,29 @@ func (r *UserRepository) Create(email, passwordHash string) (*User, error) {
 	}, nil
 }
 
+// CreateGuest creates a temporary guest user
+func (r *UserRepository) CreateGuest(email, passwordHash string) (*User, error) {
+	id := uuid.New().String()
+	now := time.Now()
+
+	_, err := r.db.Exec(
+		`INSERT INTO users (id, email, password_hash, is_guest, last_active_at, created_at, updated_at) VALUES (?, ?, ?, 1, ?, ?, ?)`,
+		id, email, passwordHash, now, now, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create guest user: %w", err)
+	}
+
+	return &User{
+		ID:           id,
+		Email:        email,
+		PasswordHash: passwordHash,
+		IsGuest:      true,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}, nil
+}
+
 // GetByID retrieves a user by ID
 func (r *UserRepository) GetByID(id string) (*User, error) {
 	user := &User{}
@@ -59,9 +83,9 @@ func (r *UserRepository) GetByID(id string) (*User, error) {
 	var githubConnectedAt sql.NullTime
 
 	err := r.db.QueryRow(
-		`SELECT id, email, password_hash, github_token, github_username, github_connected_at, created_at, updated_at FROM users WHERE id = ?`,
+		`SELECT id, email, password_hash, github_token, github_username, github_connected_at, COALESCE(is_guest, 0), created_at, updated_at FROM users WHERE id = ?`,
 		id,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash, &githubToken, &githubUsername, &githubConnectedAt, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Email, &user.PasswordHash, &githubToken, &githubUsername, &githubConnectedAt, &user.IsGuest, &user.CreatedAt, &user.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -86,9 +110,9 @@ func (r *UserRepository) GetByEmail(email string) (*User, error) {
 	var githubConnectedAt sql.NullTime
 
 	err := r.db.QueryRow(
-		`SELECT id, email, password_hash, github_token, github_username, github_connected_at, created_at, updated_at FROM users WHERE email = ?`,
+		`SELECT id, email, password_hash, github_token, github_username, github_connected_at, COALESCE(is_guest, 0), created_at, updated_at FROM users WHERE email = ?`,
 		email,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash, &githubToken, &githubUsername, &githubConnectedAt, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Email, &user.PasswordHash, &githubToken, &githubUsername, &githubConnectedAt, &user.IsGuest, &user.CreatedAt, &user.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -116,6 +140,67 @@ func (r *UserRepository) EmailExists(email string) (bool, error) {
 	return count > 0, nil
 }
 
+// SetLastActive records when a guest user was last active
+func (r *UserRepository) SetLastActive(id string, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE users SET last_active_at = ? WHERE id = ?`, at, id)
+	if err != nil {
+		return fmt.Errorf("failed to set last active time: %w", err)
+	}
+	return nil
+}
+
+// ListIdleGuests returns the IDs of guest users not active since before
+func (r *UserRepository) ListIdleGuests(before time.Time) ([]string, error) {
+	rows, err := r.db.Query(
+		`SELECT id FROM users WHERE is_guest = 1 AND COALESCE(last_active_at, created_at) < ?`,
+		before,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list idle guests: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan guest: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Delete deletes a user along with everything that references them
+func (r *UserRepository) Delete(id string) error {
+	// Workspace todos aren't tied to the users table by a foreign key
+	if _, err := r.db.Exec(`DELETE FROM workspace_todos WHERE user_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete user todos: %w", err)
+	}
+	if _, err := r.db.Exec(`DELETE FROM users WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
+
+// UpdatePassword sets a user's password hash
+func (r *UserRepository) UpdatePassword(id, passwordHash string) error {
+	_, err := r.db.Exec(`UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?`, passwordHash, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
+
+// UpdateEmail sets a user's email
+func (r *UserRepository) UpdateEmail(id, email string) error {
+	_, err := r.db.Exec(`UPDATE users SET email = ?, updated_at = ? WHERE id = ?`, email, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+	return nil
+}
+
 // Session represents a user session
 type Session struct {
 	ID               string
@@ -48,11 +48,16 @@ func (r *WebhookRepository) Create(config *github.WebhookConfig) error {
 		return fmt.Errorf("failed to marshal triggers: %w", err)
 	}
 
+	autoReview, err := marshalAutoReview(config.AutoReview)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		INSERT INTO github_webhooks (
 			id, user_id, repo_full_name, webhook_secret_encrypted, webhook_secret_nonce,
-			events, auto_run_enabled, auto_run_triggers, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			events, auto_run_enabled, auto_run_triggers, auto_review, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err = r.db.Exec(query,
@@ -64,6 +69,7 @@ func (r *WebhookRepository) Create(config *github.WebhookConfig) error {
 		string(eventsJSON),
 		config.AutoRunEnabled,
 		string(triggersJSON),
+		autoReview,
 		config.CreatedAt,
 		config.UpdatedAt,
 	)
@@ -75,7 +81,7 @@ func (r *WebhookRepository) Create(config *github.WebhookConfig) error {
 func (r *WebhookRepository) GetByID(id string) (*github.WebhookConfig, error) {
 	query := `
 		SELECT id, user_id, repo_full_name, webhook_secret_encrypted, webhook_secret_nonce,
-			   events, auto_run_enabled, auto_run_triggers, created_at, updated_at
+			   events, auto_run_enabled, auto_run_triggers, auto_review, created_at, updated_at
 		FROM github_webhooks
 		WHERE id = ?
 	`
@@ -87,7 +93,7 @@ func (r *WebhookRepository) GetByID(id string) (*github.WebhookConfig, error) {
 func (r *WebhookRepository) GetByRepoName(repoFullName string) (*github.WebhookConfig, error) {
 	query := `
 		SELECT id, user_id, repo_full_name, webhook_secret_encrypted, webhook_secret_nonce,
-			   events, auto_run_enabled, auto_run_triggers, created_at, updated_at
+			   events, auto_run_enabled, auto_run_triggers, auto_review, created_at, updated_at
 		FROM github_webhooks
 		WHERE repo_full_name = ?
 		LIMIT 1
@@ -100,7 +106,7 @@ func (r *WebhookRepository) GetByRepoName(repoFullName string) (*github.WebhookC
 func (r *WebhookRepository) ListByUser(userID string) ([]*github.WebhookConfig, error) {
 	query := `
 		SELECT id, user_id, repo_full_name, webhook_secret_encrypted, webhook_secret_nonce,
-			   events, auto_run_enabled, auto_run_triggers, created_at, updated_at
+			   events, auto_run_enabled, auto_run_triggers, auto_review, created_at, updated_at
 		FROM github_webhooks
 		WHERE user_id = ?
 		ORDER BY created_at DESC
@@ -139,9 +145,14 @@ func (r *WebhookRepository) Update(config *github.WebhookConfig) error {
 		return fmt.Errorf("failed to marshal triggers: %w", err)
 	}
 
+	autoReview, err := marshalAutoReview(config.AutoReview)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE github_webhooks
-		SET events = ?, auto_run_enabled = ?, auto_run_triggers = ?, updated_at = ?
+		SET events = ?, auto_run_enabled = ?, auto_run_triggers = ?, auto_review = ?, updated_at = ?
 		WHERE id = ?
 	`
 
@@ -149,6 +160,7 @@ func (r *WebhookRepository) Update(config *github.WebhookConfig) error {
 		string(eventsJSON),
 		config.AutoRunEnabled,
 		string(triggersJSON),
+		autoReview,
 		config.UpdatedAt,
 		config.ID,
 	)
@@ -163,6 +175,10 @@ func (r *WebhookRepository) Delete(id string) error {
 	return err
 }
 
+// deliveryColumns lists the columns read by scanDelivery
+const deliveryColumns = `id, webhook_id, github_delivery_id, event, action, payload, status, error_message,
+			   attempts, next_attempt_at, processed_at, created_at`
+
 // CreateDelivery creates a new webhook delivery record
 func (r *WebhookRepository) CreateDelivery(delivery *github.WebhookDelivery) error {
 	delivery.ID = uuid.New().String()
@@ -175,18 +191,22 @@ func (r *WebhookRepository) CreateDelivery(delivery *github.WebhookDelivery) err
 
 	query := `
 		INSERT INTO webhook_deliveries (
-			id, webhook_id, event, action, payload, status, error_message, created_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			id, webhook_id, github_delivery_id, event, action, payload, status, error_message,
+			attempts, next_attempt_at, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err = r.db.Exec(query,
 		delivery.ID,
 		delivery.WebhookID,
+		delivery.GitHubDeliveryID,
 		delivery.Event,
 		delivery.Action,
 		string(payloadJSON),
 		delivery.Status,
 		delivery.ErrorMessage,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
 		delivery.CreatedAt,
 	)
 
@@ -197,13 +217,15 @@ func (r *WebhookRepository) CreateDelivery(delivery *github.WebhookDelivery) err
 func (r *WebhookRepository) UpdateDelivery(delivery *github.WebhookDelivery) error {
 	query := `
 		UPDATE webhook_deliveries
-		SET status = ?, error_message = ?, processed_at = ?
+		SET status = ?, error_message = ?, attempts = ?, next_attempt_at = ?, processed_at = ?
 		WHERE id = ?
 	`
 
 	_, err := r.db.Exec(query,
 		delivery.Status,
 		delivery.ErrorMessage,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
 		delivery.ProcessedAt,
 		delivery.ID,
 	)
@@ -211,10 +233,88 @@ func (r *WebhookRepository) UpdateDelivery(delivery *github.WebhookDelivery) err
 	return err
 }
 
+// GetDelivery retrieves a webhook delivery by ID
+func (r *WebhookRepository) GetDelivery(id string) (*github.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE id = ?`
+
+	return scanDelivery(r.db.QueryRow(query, id))
+}
+
+// ClaimDelivery marks a due pending or failed delivery as processing and
+// counts the attempt. It returns false if the delivery was not claimable,
+// e.g. because another worker claimed it first or its retry is not due yet.
+func (r *WebhookRepository) ClaimDelivery(id string, now time.Time) (bool, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = attempts + 1
+		WHERE id = ? AND status IN (?, ?) AND (next_attempt_at IS NULL OR next_attempt_at <= ?)
+	`
+
+	result, err := r.db.Exec(query,
+		github.DeliveryStatusProcessing,
+		id,
+		github.DeliveryStatusPending,
+		github.DeliveryStatusFailed,
+		now,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim delivery: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim delivery: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ListDueDeliveries lists pending deliveries and failed deliveries whose
+// retry is due, oldest first
+func (r *WebhookRepository) ListDueDeliveries(now time.Time, limit int) ([]*github.WebhookDelivery, error) {
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE status IN (?, ?) AND (next_attempt_at IS NULL OR next_attempt_at <= ?)
+		ORDER BY created_at ASC
+		LIMIT ?
+	`
+
+	rows, err := r.db.Query(query, github.DeliveryStatusPending, github.DeliveryStatusFailed, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*github.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ResetProcessingDeliveries returns deliveries left processing (e.g. by a
+// restart mid-delivery) to pending so they are picked up again
+func (r *WebhookRepository) ResetProcessingDeliveries() (int64, error) {
+	result, err := r.db.Exec(
+		`UPDATE webhook_deliveries SET status = ? WHERE status = ?`,
+		github.DeliveryStatusPending,
+		github.DeliveryStatusProcessing,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset processing deliveries: %w", err)
+	}
+	return result.RowsAffected()
+}
+
 // ListDeliveries lists webhook deliveries for a webhook
 func (r *WebhookRepository) ListDeliveries(webhookID string, limit int) ([]*github.WebhookDelivery, error) {
 	query := `
-		SELECT id, webhook_id, event, action, payload, status, error_message, processed_at, created_at
+		SELECT ` + deliveryColumns + `
 		FROM webhook_deliveries
 		WHERE webhook_id = ?
 		ORDER BY created_at DESC
@@ -229,37 +329,57 @@ func (r *WebhookRepository) ListDeliveries(webhookID string, limit int) ([]*gith
 
 	var deliveries []*github.WebhookDelivery
 	for rows.Next() {
-		var delivery github.WebhookDelivery
-		var payloadJSON string
-		var processedAt sql.NullTime
-
-		err := rows.Scan(
-			&delivery.ID,
-			&delivery.WebhookID,
-			&delivery.Event,
-			&delivery.Action,
-			&payloadJSON,
-			&delivery.Status,
-			&delivery.ErrorMessage,
-			&processedAt,
-			&delivery.CreatedAt,
-		)
+		delivery, err := scanDelivery(rows)
 		if err != nil {
 			return nil, err
 		}
+		deliveries = append(deliveries, delivery)
+	}
 
-		if err := json.Unmarshal([]byte(payloadJSON), &delivery.Payload); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
-		}
+	return deliveries, rows.Err()
+}
 
-		if processedAt.Valid {
-			delivery.ProcessedAt = &processedAt.Time
-		}
+// scanDelivery scans a row into a WebhookDelivery
+func scanDelivery(row interface{ Scan(...interface{}) error }) (*github.WebhookDelivery, error) {
+	var delivery github.WebhookDelivery
+	var payloadJSON string
+	var githubDeliveryID, errorMessage sql.NullString
+	var attempts sql.NullInt64
+	var nextAttemptAt, processedAt sql.NullTime
+
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&githubDeliveryID,
+		&delivery.Event,
+		&delivery.Action,
+		&payloadJSON,
+		&delivery.Status,
+		&errorMessage,
+		&attempts,
+		&nextAttemptAt,
+		&processedAt,
+		&delivery.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
 
-		deliveries = append(deliveries, &delivery)
+	if err := json.Unmarshal([]byte(payloadJSON), &delivery.Payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
 
-	return deliveries, rows.Err()
+	delivery.GitHubDeliveryID = githubDeliveryID.String
+	delivery.ErrorMessage = errorMessage.String
+	delivery.Attempts = int(attempts.Int64)
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if processedAt.Valid {
+		delivery.ProcessedAt = &processedAt.Time
+	}
+
+	return &delivery, nil
 }
 
 // CreateExecution creates a new code execution record
@@ -328,11 +448,25 @@ func (r *WebhookRepository) ListExecutions(userID string, limit int) ([]*github.
 	return results, rows.Err()
 }
 
+// marshalAutoReview encodes a webhook's auto review for storage, NULL if it
+// has none
+func marshalAutoReview(review *github.AutoReviewConfig) (interface{}, error) {
+	if review == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(review)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal auto review: %w", err)
+	}
+	return string(data), nil
+}
+
 // scanWebhook scans a single row into a WebhookConfig
 func (r *WebhookRepository) scanWebhook(row *sql.Row) (*github.WebhookConfig, error) {
 	var config github.WebhookConfig
 	var encryptedSecret, nonce []byte
 	var eventsJSON, triggersJSON string
+	var autoReviewJSON sql.NullString
 
 	err := row.Scan(
 		&config.ID,
@@ -343,6 +477,7 @@ func (r *WebhookRepository) scanWebhook(row *sql.Row) (*github.WebhookConfig, er
 		&eventsJSON,
 		&config.AutoRunEnabled,
 		&triggersJSON,
+		&autoReviewJSON,
 		&config.CreatedAt,
 		&config.UpdatedAt,
 	)
@@ -371,6 +506,13 @@ func (r *WebhookRepository) scanWebhook(row *sql.Row) (*github.WebhookConfig, er
 		}
 	}
 
+	// Unmarshal auto review
+	if autoReviewJSON.String != "" {
+		if err := json.Unmarshal([]byte(autoReviewJSON.String), &config.AutoReview); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal auto review: %w", err)
+		}
+	}
+
 	return &config, nil
 }
 
@@ -379,6 +521,7 @@ func (r *WebhookRepository) scanWebhookRow(rows *sql.Rows) (*github.WebhookConfi
 	var config github.WebhookConfig
 	var encryptedSecret, nonce []byte
 	var eventsJSON, triggersJSON string
+	var autoReviewJSON sql.NullString
 
 	err := rows.Scan(
 		&config.ID,
@@ -389,6 +532,7 @@ func (r *WebhookRepository) scanWebhookRow(rows *sql.Rows) (*github.WebhookConfi
 		&eventsJSON,
 		&config.AutoRunEnabled,
 		&triggersJSON,
+		&autoReviewJSON,
 		&config.CreatedAt,
 		&config.UpdatedAt,
 	)
@@ -417,5 +561,12 @@ func (r *WebhookRepository) scanWebhookRow(rows *sql.Rows) (*github.WebhookConfi
 		}
 	}
 
+	// Unmarshal auto review
+	if autoReviewJSON.String != "" {
+		if err := json.Unmarshal([]byte(autoReviewJSON.String), &config.AutoReview); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal auto review: %w", err)
+		}
+	}
+
 	return &config, nil
 }
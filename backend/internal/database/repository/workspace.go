@@ -2,7 +2,9 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,6 +21,37 @@ type Workspace struct {
 	CreatedAt      time.Time
 }
 
+// WorkspaceSettings are a workspace's defaults, used while it is the current
+// workspace. Empty fields fall back to the user's preferences or the usual
+// defaults.
+type WorkspaceSettings struct {
+	DefaultProvider string   `json:"default_provider,omitempty"`
+	DefaultModel    string   `json:"default_model,omitempty"`
+	AllowedTools    []string `json:"allowed_tools,omitempty"`    // Tool names, or prefixes ending in "*"; empty allows all
+	InstructionFile string   `json:"instruction_file,omitempty"` // Relative to the workspace; read besides PRISM.md
+	BuildCommand    string   `json:"build_command,omitempty"`    // e.g. "npm run dev"
+	TestCommand     string   `json:"test_command,omitempty"`     // e.g. "go test ./..."
+
+	// Env is added to the environment of commands run by the shell tools
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// AllowsTool reports whether a tool may be used in the workspace
+func (s *WorkspaceSettings) AllowsTool(name string) bool {
+	if s == nil || len(s.AllowedTools) == 0 {
+		return true
+	}
+	for _, allowed := range s.AllowedTools {
+		if allowed == name {
+			return true
+		}
+		if strings.HasSuffix(allowed, "*") && strings.HasPrefix(name, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
 // WorkspaceRepository handles workspace database operations
 type WorkspaceRepository struct {
 	db *sql.DB
@@ -239,6 +272,141 @@ func (r *WorkspaceRepository) UpdateName(workspaceID, name string) error {
 	return nil
 }
 
+// GetSettings retrieves the settings of a user's workspace by path, or nil if
+// it has none
+func (r *WorkspaceRepository) GetSettings(userID, path string) (*WorkspaceSettings, error) {
+	var raw sql.NullString
+	err := r.db.QueryRow(
+		`SELECT settings FROM user_workspaces WHERE user_id = ? AND path = ?`,
+		userID, path,
+	).Scan(&raw)
+
+	if err == sql.ErrNoRows || (err == nil && (!raw.Valid || raw.String == "")) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace settings: %w", err)
+	}
+
+	settings := &WorkspaceSettings{}
+	if err := json.Unmarshal([]byte(raw.String), settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workspace settings: %w", err)
+	}
+	return settings, nil
+}
+
+// UpdateSettings replaces the settings of a workspace. Nil clears them.
+func (r *WorkspaceRepository) UpdateSettings(workspaceID string, settings *WorkspaceSettings) error {
+	var raw interface{}
+	if settings != nil {
+		encoded, err := json.Marshal(settings)
+		if err != nil {
+			return fmt.Errorf("failed to marshal workspace settings: %w", err)
+		}
+		raw = string(encoded)
+	}
+
+	_, err := r.db.Exec(
+		`UPDATE user_workspaces SET settings = ? WHERE id = ?`,
+		raw, workspaceID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update workspace settings: %w", err)
+	}
+	return nil
+}
+
+// ListRoots retrieves the workspaces a user has open as extra roots, oldest first
+func (r *WorkspaceRepository) ListRoots(userID string) ([]*Workspace, error) {
+	rows, err := r.db.Query(
+		`SELECT id, user_id, path, name, is_current, last_accessed_at, created_at
+		 FROM user_workspaces
+		 WHERE user_id = ? AND is_root = 1
+		 ORDER BY created_at ASC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace roots: %w", err)
+	}
+	defer rows.Close()
+
+	var workspaces []*Workspace
+	for rows.Next() {
+		workspace := &Workspace{}
+		var lastAccessedAt sql.NullTime
+
+		err := rows.Scan(&workspace.ID, &workspace.UserID, &workspace.Path, &workspace.Name,
+			&workspace.IsCurrent, &lastAccessedAt, &workspace.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+
+		if lastAccessedAt.Valid {
+			workspace.LastAccessedAt = &lastAccessedAt.Time
+		}
+
+		workspaces = append(workspaces, workspace)
+	}
+
+	return workspaces, nil
+}
+
+// SetRoot marks whether a workspace is open as an extra root
+func (r *WorkspaceRepository) SetRoot(userID, workspaceID string, isRoot bool) error {
+	_, err := r.db.Exec(
+		`UPDATE user_workspaces SET is_root = ? WHERE id = ? AND user_id = ?`,
+		isRoot, workspaceID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update workspace root: %w", err)
+	}
+	return nil
+}
+
+// GetConversationRoot retrieves the name of the root a conversation's file
+// tools default to, or "" if none was chosen
+func (r *WorkspaceRepository) GetConversationRoot(userID, conversationID string) (string, error) {
+	var name string
+	err := r.db.QueryRow(
+		`SELECT root_name FROM conversation_workspace_roots WHERE user_id = ? AND conversation_id = ?`,
+		userID, conversationID,
+	).Scan(&name)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get conversation root: %w", err)
+	}
+	return name, nil
+}
+
+// SetConversationRoot sets the root a conversation's file tools default to.
+// An empty name clears it.
+func (r *WorkspaceRepository) SetConversationRoot(userID, conversationID, name string) error {
+	if name == "" {
+		_, err := r.db.Exec(
+			`DELETE FROM conversation_workspace_roots WHERE user_id = ? AND conversation_id = ?`,
+			userID, conversationID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to clear conversation root: %w", err)
+		}
+		return nil
+	}
+
+	_, err := r.db.Exec(
+		`INSERT INTO conversation_workspace_roots (user_id, conversation_id, root_name, updated_at)
+		 VALUES (?, ?, ?, ?)
+		 ON CONFLICT(user_id, conversation_id) DO UPDATE SET root_name = excluded.root_name, updated_at = excluded.updated_at`,
+		userID, conversationID, name, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set conversation root: %w", err)
+	}
+	return nil
+}
+
 // Delete removes a workspace by ID
 func (r *WorkspaceRepository) Delete(workspaceID string) error {
 	_, err := r.db.Exec(`DELETE FROM user_workspaces WHERE id = ?`, workspaceID)
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Workspace summary statuses
+const (
+	WorkspaceSummaryRunning   = "running"
+	WorkspaceSummaryCompleted = "completed"
+	WorkspaceSummaryFailed    = "failed"
+)
+
+// WorkspaceSummary is an onboarding summary of a repository in a workspace
+type WorkspaceSummary struct {
+	UserID    string
+	Path      string // Absolute path of the summarized directory
+	Status    string // running, completed or failed
+	Structure string // JSON of the structural scan
+	Summary   string // Markdown summary added to chats in the workspace
+	Error     string
+	Provider  string
+	Model     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// WorkspaceSummaryRepository handles workspace summary database operations
+type WorkspaceSummaryRepository struct {
+	db *sql.DB
+}
+
+// NewWorkspaceSummaryRepository creates a new workspace summary repository
+func NewWorkspaceSummaryRepository(db *sql.DB) *WorkspaceSummaryRepository {
+	return &WorkspaceSummaryRepository{db: db}
+}
+
+// Save stores a summary, replacing any earlier one of the same directory
+func (r *WorkspaceSummaryRepository) Save(summary *WorkspaceSummary) error {
+	now := time.Now()
+	if summary.CreatedAt.IsZero() {
+		summary.CreatedAt = now
+	}
+	summary.UpdatedAt = now
+	_, err := r.db.Exec(
+		`INSERT INTO workspace_summaries (user_id, path, status, structure, summary, error, provider, model, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(user_id, path) DO UPDATE SET
+			status = excluded.status, structure = excluded.structure, summary = excluded.summary,
+			error = excluded.error, provider = excluded.provider, model = excluded.model,
+			created_at = excluded.created_at, updated_at = excluded.updated_at`,
+		summary.UserID, summary.Path, summary.Status, summary.Structure, summary.Summary,
+		summary.Error, summary.Provider, summary.Model, summary.CreatedAt, summary.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save workspace summary: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves the summary of a directory, or nil if it has none
+func (r *WorkspaceSummaryRepository) Get(userID, path string) (*WorkspaceSummary, error) {
+	summary, err := scanWorkspaceSummary(r.db.QueryRow(
+		`SELECT user_id, path, status, structure, summary, error, provider, model, created_at, updated_at
+		 FROM workspace_summaries WHERE user_id = ? AND path = ?`,
+		userID, path,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace summary: %w", err)
+	}
+	return summary, nil
+}
+
+// ListWithin lists the summaries of a directory and the directories under
+// it, ordered by path so a workspace's own summary comes first
+func (r *WorkspaceSummaryRepository) ListWithin(userID, root string) ([]*WorkspaceSummary, error) {
+	prefix := strings.TrimSuffix(root, string(filepath.Separator)) + string(filepath.Separator)
+	rows, err := r.db.Query(
+		`SELECT user_id, path, status, structure, summary, error, provider, model, created_at, updated_at
+		 FROM workspace_summaries
+		 WHERE user_id = ? AND (path = ? OR substr(path, 1, ?) = ?)
+		 ORDER BY path`,
+		userID, root, len(prefix), prefix,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace summaries: %w", err)
+	}
+	defer rows.Close()
+
+	var summaries []*WorkspaceSummary
+	for rows.Next() {
+		summary, err := scanWorkspaceSummary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace summary: %w", err)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+// Delete removes the summary of a directory, reporting whether it had one
+func (r *WorkspaceSummaryRepository) Delete(userID, path string) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM workspace_summaries WHERE user_id = ? AND path = ?`, userID, path)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete workspace summary: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete workspace summary: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// FailRunningSummaries marks summaries left running (e.g. by a restart
+// mid-analysis) as failed so they can be run again
+func (r *WorkspaceSummaryRepository) FailRunningSummaries() (int64, error) {
+	result, err := r.db.Exec(
+		`UPDATE workspace_summaries SET status = ?, error = ?, updated_at = ? WHERE status = ?`,
+		WorkspaceSummaryFailed, "interrupted by a server restart", time.Now(), WorkspaceSummaryRunning,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail running workspace summaries: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// scanWorkspaceSummary scans a workspace summary row
+func scanWorkspaceSummary(row interface{ Scan(...interface{}) error }) (*WorkspaceSummary, error) {
+	summary := &WorkspaceSummary{}
+	var structure, text, errText, provider, model sql.NullString
+	if err := row.Scan(&summary.UserID, &summary.Path, &summary.Status, &structure, &text, &errText,
+		&provider, &model, &summary.CreatedAt, &summary.UpdatedAt); err != nil {
+		return nil, err
+	}
+	summary.Structure = structure.String
+	summary.Summary = text.String
+	summary.Error = errText.String
+	summary.Provider = provider.String
+	summary.Model = model.String
+	return summary, nil
+}
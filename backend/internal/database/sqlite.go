@@ -299,6 +299,16 @@ func (db *DB) Migrate() error {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
+		// File history contents, stored once per distinct content and
+		// encrypted when nonce is set
+		`CREATE TABLE IF NOT EXISTS file_history_blobs (
+			hash TEXT PRIMARY KEY,
+			content BLOB NOT NULL,
+			nonce BLOB,
+			size INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
 		// User workspaces for persistent project directory storage
 		`CREATE TABLE IF NOT EXISTS user_workspaces (
 			id TEXT PRIMARY KEY,
@@ -335,11 +345,523 @@ func (db *DB) Migrate() error {
 			UNIQUE(user_id, type)
 		)`,
 
+		// Conversation shares for collaborative sessions
+		`CREATE TABLE IF NOT EXISTS conversation_shares (
+			id TEXT PRIMARY KEY,
+			conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			role TEXT NOT NULL DEFAULT 'viewer',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(conversation_id, user_id)
+		)`,
+
+		// Public read-only share links for conversations
+		`CREATE TABLE IF NOT EXISTS conversation_share_links (
+			id TEXT PRIMARY KEY,
+			conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			expires_at DATETIME NOT NULL,
+			revoked_at DATETIME,
+			view_count INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS conversation_pinned_files (
+			id TEXT PRIMARY KEY,
+			conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			path TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(conversation_id, path)
+		)`,
+
+		// Workspace checkpoints (snapshots stored as commits in a shadow git repository)
+		`CREATE TABLE IF NOT EXISTS workspace_checkpoints (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			workspace_path TEXT NOT NULL,
+			commit_sha TEXT NOT NULL,
+			tree_sha TEXT NOT NULL,
+			label TEXT,
+			trigger TEXT NOT NULL DEFAULT 'manual',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Scheduled dependency audits per workspace
+		`CREATE TABLE IF NOT EXISTS dependency_audit_schedules (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			workspace_path TEXT NOT NULL,
+			interval_hours INTEGER NOT NULL DEFAULT 24,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			known_vulnerabilities TEXT NOT NULL DEFAULT '[]',
+			last_vulnerability_count INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT,
+			last_run_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, workspace_path)
+		)`,
+
+		// Daily or weekly activity digests; hour and weekday are in the user's timezone
+		`CREATE TABLE IF NOT EXISTS digest_schedules (
+			user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			frequency TEXT NOT NULL DEFAULT 'daily',
+			hour INTEGER NOT NULL DEFAULT 9,
+			weekday INTEGER NOT NULL DEFAULT 1,
+			timezone TEXT NOT NULL DEFAULT 'UTC',
+			enabled INTEGER NOT NULL DEFAULT 1,
+			last_sent_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Per-user defaults for new conversations and agent runs, tool
+		// confirmation, timezone, notification opt-ins and client UI hints
+		`CREATE TABLE IF NOT EXISTS user_preferences (
+			user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			default_provider TEXT NOT NULL DEFAULT '',
+			default_model TEXT NOT NULL DEFAULT '',
+			default_system_prompt TEXT NOT NULL DEFAULT '',
+			default_temperature REAL,
+			tool_confirmation TEXT NOT NULL DEFAULT 'always',
+			trusted_tools TEXT NOT NULL DEFAULT '[]',
+			max_tool_iterations INTEGER NOT NULL DEFAULT 0,
+			timezone TEXT NOT NULL DEFAULT 'UTC',
+			notifications_enabled INTEGER NOT NULL DEFAULT 1,
+			notification_events TEXT NOT NULL DEFAULT '[]',
+			ui_hints TEXT NOT NULL DEFAULT '{}',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Outbound webhooks that receive signed Prism event payloads
+		`CREATE TABLE IF NOT EXISTS outbound_webhooks (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			url TEXT NOT NULL,
+			secret_encrypted BLOB,
+			secret_nonce BLOB,
+			events TEXT NOT NULL DEFAULT '[]',
+			enabled INTEGER NOT NULL DEFAULT 1,
+			last_delivery_at DATETIME,
+			last_status_code INTEGER,
+			last_error TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Per-user email notification preferences
+		`CREATE TABLE IF NOT EXISTS email_settings (
+			user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			address TEXT,
+			events TEXT NOT NULL DEFAULT '[]',
+			min_duration_seconds INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Slack users linked to Prism accounts for slash commands
+		`CREATE TABLE IF NOT EXISTS slack_user_links (
+			slack_team_id TEXT NOT NULL,
+			slack_user_id TEXT NOT NULL,
+			slack_username TEXT,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (slack_team_id, slack_user_id)
+		)`,
+
+		// Discord servers linked to Prism accounts for bot commands
+		`CREATE TABLE IF NOT EXISTS discord_guild_settings (
+			guild_id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			guild_name TEXT,
+			channel_id TEXT,
+			use_threads INTEGER NOT NULL DEFAULT 1,
+			provider TEXT,
+			model TEXT,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Usage of agents, builds and tools, for the usage dashboard
+		`CREATE TABLE IF NOT EXISTS usage_events (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			kind TEXT NOT NULL,
+			name TEXT,
+			status TEXT NOT NULL,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Idempotency keys: responses replayed to retried requests
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			key TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			request_hash TEXT NOT NULL,
+			completed INTEGER NOT NULL DEFAULT 0,
+			response_status INTEGER,
+			content_type TEXT,
+			response_body BLOB,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			PRIMARY KEY (user_id, key)
+		)`,
+
+		// Workspace root a conversation's file tools default to, when the user has several open
+		`CREATE TABLE IF NOT EXISTS conversation_workspace_roots (
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+			root_name TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, conversation_id)
+		)`,
+
+		// Organizations whose admins share provider keys with their members
+		`CREATE TABLE IF NOT EXISTS organizations (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS organization_members (
+			organization_id TEXT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			role TEXT NOT NULL DEFAULT 'member',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (organization_id, user_id)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS organization_provider_keys (
+			id TEXT PRIMARY KEY,
+			organization_id TEXT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+			provider TEXT NOT NULL,
+			encrypted_key BLOB NOT NULL,
+			key_nonce BLOB NOT NULL,
+			created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(organization_id, provider)
+		)`,
+
+		// Requests members made with an organization's shared keys
+		`CREATE TABLE IF NOT EXISTS organization_key_usage (
+			id TEXT PRIMARY KEY,
+			organization_id TEXT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			provider TEXT NOT NULL,
+			model TEXT,
+			tokens_used INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Local corrections to model capabilities and pricing, e.g. for models
+		// served by an OpenAI-compatible server
+		`CREATE TABLE IF NOT EXISTS model_overrides (
+			provider TEXT NOT NULL,
+			model TEXT NOT NULL,
+			supports_tools INTEGER,
+			supports_vision INTEGER,
+			supports_json_mode INTEGER,
+			context_window INTEGER,
+			max_output_tokens INTEGER,
+			input_price_per_million REAL,
+			output_price_per_million REAL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (provider, model)
+		)`,
+
+		// User-defined tags on conversations
+		`CREATE TABLE IF NOT EXISTS conversation_tags (
+			conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (conversation_id, tag)
+		)`,
+
+		// Ratings of assistant messages, for tracking which models and tools
+		// work well
+		`CREATE TABLE IF NOT EXISTS message_feedback (
+			id TEXT PRIMARY KEY,
+			message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			rating INTEGER NOT NULL,
+			comment TEXT,
+			provider TEXT NOT NULL,
+			model TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(message_id, user_id)
+		)`,
+
+		// Tools used in the turn a feedback entry rates
+		`CREATE TABLE IF NOT EXISTS message_feedback_tools (
+			feedback_id TEXT NOT NULL REFERENCES message_feedback(id) ON DELETE CASCADE,
+			tool_name TEXT NOT NULL,
+			PRIMARY KEY (feedback_id, tool_name)
+		)`,
+
+		// Encrypted user secrets, referenced by name as {{secret:NAME}}
+		`CREATE TABLE IF NOT EXISTS user_secrets (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			value_encrypted BLOB NOT NULL,
+			value_nonce BLOB NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, name)
+		)`,
+
+		// Full results of tool calls whose results were truncated in messages
+		`CREATE TABLE IF NOT EXISTS tool_results (
+			message_id TEXT PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+			content TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Workspace context packed into a conversation's system prompt
+		`CREATE TABLE IF NOT EXISTS conversation_context_packs (
+			conversation_id TEXT PRIMARY KEY REFERENCES conversations(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			spec TEXT NOT NULL,
+			content TEXT NOT NULL,
+			files TEXT NOT NULL,
+			tokens INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Onboarding summaries of workspace repositories, added to the
+		// system prompt of chats in the workspace
+		`CREATE TABLE IF NOT EXISTS workspace_summaries (
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			path TEXT NOT NULL,
+			status TEXT NOT NULL,
+			structure TEXT,
+			summary TEXT,
+			error TEXT,
+			provider TEXT,
+			model TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, path)
+		)`,
+
+		// Linear API keys and automation triggers. webhook_token identifies
+		// the user in the URL Linear sends issue webhooks to.
+		`CREATE TABLE IF NOT EXISTS linear_settings (
+			user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			api_key_encrypted BLOB,
+			api_key_nonce BLOB,
+			webhook_secret_encrypted BLOB,
+			webhook_secret_nonce BLOB,
+			webhook_token TEXT NOT NULL UNIQUE,
+			organization TEXT,
+			provider TEXT,
+			model TEXT,
+			triggers TEXT NOT NULL DEFAULT '[]',
+			enabled INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Documentation sources read by the notion_* and confluence_* tools
+		`CREATE TABLE IF NOT EXISTS notion_settings (
+			user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			token_encrypted BLOB,
+			token_nonce BLOB,
+			workspace_name TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS confluence_settings (
+			user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			base_url TEXT NOT NULL,
+			email TEXT,
+			token_encrypted BLOB,
+			token_nonce BLOB,
+			display_name TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Benchmark suites of agent tasks, their runs against providers and
+		// models, and the outcome of each attempt
+		`CREATE TABLE IF NOT EXISTS eval_suites (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			description TEXT,
+			cases TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS eval_runs (
+			id TEXT PRIMARY KEY,
+			suite_id TEXT NOT NULL REFERENCES eval_suites(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			status TEXT NOT NULL,
+			targets TEXT NOT NULL,
+			repeats INTEGER NOT NULL DEFAULT 1,
+			error TEXT,
+			started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS eval_results (
+			id TEXT PRIMARY KEY,
+			run_id TEXT NOT NULL REFERENCES eval_runs(id) ON DELETE CASCADE,
+			case_name TEXT NOT NULL,
+			target TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			model TEXT NOT NULL,
+			attempt INTEGER NOT NULL DEFAULT 1,
+			passed INTEGER NOT NULL DEFAULT 0,
+			latency_ms INTEGER NOT NULL DEFAULT 0,
+			tokens_used INTEGER NOT NULL DEFAULT 0,
+			output TEXT,
+			validation_output TEXT,
+			error TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Sign-in attempts and registrations, for account security
+		`CREATE TABLE IF NOT EXISTS auth_events (
+			id TEXT PRIMARY KEY,
+			user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+			email TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			success INTEGER NOT NULL,
+			reason TEXT,
+			ip TEXT NOT NULL,
+			user_agent TEXT NOT NULL,
+			new_device INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Single-use tokens emailed to reset a password or confirm a new email
+		`CREATE TABLE IF NOT EXISTS account_tokens (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			kind TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			new_email TEXT,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Provider requests and raw responses captured for conversations with
+		// LLM debugging on, secrets redacted. The payload holds the request
+		// body and response chunks, encrypted with MESSAGES_ENCRYPT when
+		// payload_nonce is set.
+		`CREATE TABLE IF NOT EXISTS llm_debug_entries (
+			id TEXT PRIMARY KEY,
+			conversation_id TEXT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+			provider TEXT NOT NULL,
+			model TEXT NOT NULL,
+			method TEXT NOT NULL,
+			url TEXT NOT NULL,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			error TEXT,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			payload BLOB NOT NULL,
+			payload_nonce BLOB,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Per-user concurrency limits set by admins, overriding the server's
+		// defaults. NULL columns use the default.
+		`CREATE TABLE IF NOT EXISTS user_concurrency_limits (
+			user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			max_agents INTEGER,
+			max_swarms INTEGER,
+			max_builds INTEGER,
+			max_shells INTEGER,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+
 		// Add GitHub fields to users table (safe migrations with ALTER TABLE)
 		`ALTER TABLE users ADD COLUMN github_token TEXT`,
 		`ALTER TABLE users ADD COLUMN github_username TEXT`,
 		`ALTER TABLE users ADD COLUMN github_connected_at DATETIME`,
 
+		// Conversation version for optimistic locking on concurrent sends
+		`ALTER TABLE conversations ADD COLUMN version INTEGER DEFAULT 0`,
+
+		// Assistant turn that made a file change, for reviewing and reverting a turn as a unit
+		`ALTER TABLE file_history ADD COLUMN turn_id TEXT`,
+
+		// Webhook delivery retry queue
+		`ALTER TABLE webhook_deliveries ADD COLUMN github_delivery_id TEXT`,
+		`ALTER TABLE webhook_deliveries ADD COLUMN attempts INTEGER DEFAULT 0`,
+		`ALTER TABLE webhook_deliveries ADD COLUMN next_attempt_at DATETIME`,
+
+		// Workspaces open as extra roots alongside the current one (multi-root workspaces)
+		`ALTER TABLE user_workspaces ADD COLUMN is_root INTEGER DEFAULT 0`,
+
+		// Per-workspace defaults for chat, builds and tests, stored as JSON
+		`ALTER TABLE user_workspaces ADD COLUMN settings TEXT`,
+
+		// Per-message details such as a turn's provider/model override
+		`ALTER TABLE messages ADD COLUMN metadata TEXT`,
+
+		// Guest accounts, deleted with their data once idle
+		`ALTER TABLE users ADD COLUMN is_guest INTEGER DEFAULT 0`,
+		`ALTER TABLE users ADD COLUMN last_active_at DATETIME`,
+
+		// File history entries refer to their content in file_history_blobs;
+		// older entries keep it inline until compacted
+		`ALTER TABLE file_history ADD COLUMN content_hash TEXT`,
+		`ALTER TABLE file_history ADD COLUMN size INTEGER DEFAULT 0`,
+		`ALTER TABLE file_history ADD COLUMN last_accessed_at DATETIME`,
+
+		// Custom endpoints for OpenAI-compatible servers, stored with the key
+		`ALTER TABLE provider_keys ADD COLUMN base_url TEXT`,
+		`ALTER TABLE organization_provider_keys ADD COLUMN base_url TEXT`,
+
+		// Organizing conversations: archived ones are hidden from the default
+		// list, pinned ones list first
+		`ALTER TABLE conversations ADD COLUMN folder TEXT`,
+		`ALTER TABLE conversations ADD COLUMN pinned_at DATETIME`,
+		`ALTER TABLE conversations ADD COLUMN archived_at DATETIME`,
+
+		// Summary of a conversation, as JSON, for catching up on it later
+		`ALTER TABLE conversations ADD COLUMN summary TEXT`,
+
+		// Automatic pull request reviews for GitHub webhooks
+		`ALTER TABLE github_webhooks ADD COLUMN auto_review TEXT`,
+
+		// ID a client gave a chat message, so a retried send isn't saved twice
+		`ALTER TABLE messages ADD COLUMN client_message_id TEXT`,
+
+		// Assistant replies saved while streaming: partial, or interrupted if
+		// the server stopped before they finished; NULL once complete
+		`ALTER TABLE messages ADD COLUMN status TEXT`,
+
+		// How many recent tool results a conversation sends to models whole;
+		// NULL uses TOOL_HISTORY_KEEP_RECENT
+		`ALTER TABLE conversations ADD COLUMN tool_history_keep INTEGER`,
+
+		// The conversation an agent run or build was started from, for its timeline
+		`ALTER TABLE usage_events ADD COLUMN conversation_id TEXT`,
+
+		// Nonces of message content, tool calls, full tool results and
+		// conversation summaries stored encrypted with MESSAGES_ENCRYPT; NULL
+		// for plaintext
+		`ALTER TABLE messages ADD COLUMN content_nonce BLOB`,
+		`ALTER TABLE messages ADD COLUMN tool_calls_nonce BLOB`,
+		`ALTER TABLE tool_results ADD COLUMN content_nonce BLOB`,
+		`ALTER TABLE conversations ADD COLUMN summary_nonce BLOB`,
+
+		// Whether a conversation captures its provider traffic for debugging
+		`ALTER TABLE conversations ADD COLUMN llm_debug INTEGER DEFAULT 0`,
+
 		// Indexes
 		`CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_conversations_user_id ON conversations(user_id)`,
@@ -360,9 +882,36 @@ func (db *DB) Migrate() error {
 		`CREATE INDEX IF NOT EXISTS idx_user_integrations_user_id ON user_integrations(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_file_history_user_id ON file_history(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_file_history_file_path ON file_history(user_id, file_path)`,
+		`CREATE INDEX IF NOT EXISTS idx_file_history_turn_id ON file_history(user_id, turn_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_file_history_content_hash ON file_history(content_hash)`,
 		`CREATE INDEX IF NOT EXISTS idx_user_workspaces_user_id ON user_workspaces(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_user_workspaces_current ON user_workspaces(user_id, is_current)`,
 		`CREATE INDEX IF NOT EXISTS idx_workspace_todos_user_workspace ON workspace_todos(user_id, workspace_path)`,
+		`CREATE INDEX IF NOT EXISTS idx_conversation_shares_user_id ON conversation_shares(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_conversation_share_links_conversation_id ON conversation_share_links(conversation_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_conversation_pinned_files_conversation_id ON conversation_pinned_files(conversation_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_workspace_checkpoints_user_workspace ON workspace_checkpoints(user_id, workspace_path)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries(status, next_attempt_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_outbound_webhooks_user_id ON outbound_webhooks(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_slack_user_links_user_id ON slack_user_links(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_discord_guild_settings_user_id ON discord_guild_settings(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_usage_events_user_created ON usage_events(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_usage_events_conversation_id ON usage_events(conversation_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_organization_key_usage_org_created ON organization_key_usage(organization_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_conversations_user_folder ON conversations(user_id, folder)`,
+		`CREATE INDEX IF NOT EXISTS idx_conversation_tags_tag ON conversation_tags(tag)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_feedback_conversation_user ON message_feedback(conversation_id, user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_feedback_updated_at ON message_feedback(updated_at)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_client_message_id ON messages(conversation_id, client_message_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_eval_suites_user_id ON eval_suites(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_eval_runs_suite_id ON eval_runs(suite_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_eval_results_run_id ON eval_results(run_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_auth_events_user_created ON auth_events(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_auth_events_created_at ON auth_events(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_account_tokens_user_kind ON account_tokens(user_id, kind)`,
+		`CREATE INDEX IF NOT EXISTS idx_llm_debug_entries_conversation ON llm_debug_entries(conversation_id, created_at)`,
 	}
 
 	for _, migration := range migrations {
@@ -0,0 +1,164 @@
+// Package desktop runs Prism as a local, single-user app: the server binds to
+// localhost, keeps its data in the user's config directory, signs the browser
+// in as a local user and opens it.
+package desktop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/security"
+)
+
+const (
+	// LocalUserEmail identifies the account desktop mode signs in as
+	LocalUserEmail = "local@prism.local"
+
+	// localHost is the only address desktop mode listens on
+	localHost = "127.0.0.1"
+
+	// secretsFile persists generated secrets across restarts, so stored API
+	// keys stay readable and sessions stay valid
+	secretsFile = "secrets.json"
+)
+
+// secrets are generated on first run when not set in the environment
+type secrets struct {
+	EncryptionKey string `json:"encryption_key"`
+	JWTSecret     string `json:"jwt_secret"`
+}
+
+// Prepare sets up the environment for desktop mode before configuration is
+// loaded. Data lives in PRISM_DATA_DIR, or a prism directory in the user's
+// config directory. Settings already in the environment are kept, except
+// that the server always binds to localhost and guest mode is disabled.
+// Returns the data directory.
+func Prepare() (string, error) {
+	dataDir := os.Getenv("PRISM_DATA_DIR")
+	if dataDir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find config directory: %w", err)
+		}
+		dataDir = filepath.Join(configDir, "prism")
+	}
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	s, err := loadSecrets(filepath.Join(dataDir, secretsFile))
+	if err != nil {
+		return "", err
+	}
+
+	os.Setenv("HOST", localHost)
+	os.Setenv("GUEST_MODE_ENABLED", "false")
+	setDefault("DATABASE_URL", filepath.Join(dataDir, "prism.db"))
+	setDefault("UPLOAD_DIR", filepath.Join(dataDir, "uploads"))
+	setDefault("ENCRYPTION_KEY", s.EncryptionKey)
+	setDefault("JWT_SECRET", s.JWTSecret)
+
+	return dataDir, nil
+}
+
+// setDefault sets an environment variable unless it is already set
+func setDefault(key, value string) {
+	if os.Getenv(key) == "" {
+		os.Setenv(key, value)
+	}
+}
+
+// loadSecrets reads the persisted secrets, generating and saving them on
+// first run
+func loadSecrets(path string) (*secrets, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var s secrets
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if s.EncryptionKey != "" && s.JWTSecret != "" {
+			return &s, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	encryptionKey, err := security.GenerateRandomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	jwtSecret, err := security.GenerateRandomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate JWT secret: %w", err)
+	}
+	s := &secrets{EncryptionKey: encryptionKey, JWTSecret: jwtSecret}
+
+	data, err = json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// EnsureLocalUser returns the desktop user, creating it on first run. The
+// account has a random password nobody knows; it is only reachable through
+// the local token.
+func EnsureLocalUser(userRepo *repository.UserRepository) (*repository.User, error) {
+	user, err := userRepo.GetByEmail(LocalUserEmail)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		return user, nil
+	}
+
+	password, err := security.GenerateRandomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate password: %w", err)
+	}
+	passwordHash, err := security.HashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	return userRepo.Create(LocalUserEmail, passwordHash)
+}
+
+// NewLocalToken generates the token that signs the browser in. A new token is
+// issued on every start, and it is only accepted from localhost.
+func NewLocalToken() (string, error) {
+	return security.GenerateRandomString(32)
+}
+
+// LoginURL returns the address the browser is opened at. The token is passed
+// in the URL fragment, which never reaches the server's request logs.
+func LoginURL(port, token string) string {
+	return fmt.Sprintf("http://%s:%s/#local_token=%s", localHost, port, token)
+}
+
+// OpenBrowser opens url in the user's default browser
+func OpenBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
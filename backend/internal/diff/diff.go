@@ -0,0 +1,263 @@
+// Package diff computes line-based diffs between two versions of a file.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultContext is the number of unchanged lines shown around each change
+const DefaultContext = 3
+
+// maxEdits bounds the work done by the diff algorithm. Inputs that differ by
+// more lines than this are reported as a full replacement.
+const maxEdits = 2000
+
+// OpKind identifies a line operation in a diff
+type OpKind int
+
+const (
+	OpEqual OpKind = iota
+	OpDelete
+	OpInsert
+)
+
+// Op is a single line in a diff
+type Op struct {
+	Kind OpKind
+	Line string
+}
+
+// Stats summarizes the size of a diff
+type Stats struct {
+	Additions int `json:"additions"`
+	Deletions int `json:"deletions"`
+}
+
+// Lines splits text into lines without their trailing newline characters
+func Lines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Compute returns the line operations that turn a into b
+func Compute(a, b []string) []Op {
+	ops, ok := myers(a, b)
+	if !ok {
+		ops = make([]Op, 0, len(a)+len(b))
+		for _, line := range a {
+			ops = append(ops, Op{Kind: OpDelete, Line: line})
+		}
+		for _, line := range b {
+			ops = append(ops, Op{Kind: OpInsert, Line: line})
+		}
+	}
+	return ops
+}
+
+// CountStats counts the added and deleted lines in a set of operations
+func CountStats(ops []Op) Stats {
+	var stats Stats
+	for _, op := range ops {
+		switch op.Kind {
+		case OpInsert:
+			stats.Additions++
+		case OpDelete:
+			stats.Deletions++
+		}
+	}
+	return stats
+}
+
+// Unified returns a unified diff between two texts along with its stats.
+// The diff is empty when the texts are identical.
+func Unified(oldName, newName, oldText, newText string, context int) (string, Stats) {
+	ops := Compute(Lines(oldText), Lines(newText))
+	stats := CountStats(ops)
+	if stats.Additions == 0 && stats.Deletions == 0 {
+		return "", stats
+	}
+	if context < 0 {
+		context = DefaultContext
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Line numbers (1-based) of each op in the old and new text
+	oldLine := make([]int, len(ops))
+	newLine := make([]int, len(ops))
+	o, n := 1, 1
+	for i, op := range ops {
+		oldLine[i], newLine[i] = o, n
+		if op.Kind != OpInsert {
+			o++
+		}
+		if op.Kind != OpDelete {
+			n++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == OpEqual {
+			i++
+			continue
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != OpEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == OpEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				if run-end > context {
+					end += context
+				} else {
+					end = run
+				}
+				break
+			}
+			end = run
+		}
+
+		var oldCount, newCount int
+		for _, op := range ops[start:end] {
+			if op.Kind != OpInsert {
+				oldCount++
+			}
+			if op.Kind != OpDelete {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(oldLine[start], oldCount), hunkRange(newLine[start], newCount))
+		for _, op := range ops[start:end] {
+			switch op.Kind {
+			case OpEqual:
+				sb.WriteString(" ")
+			case OpDelete:
+				sb.WriteString("-")
+			case OpInsert:
+				sb.WriteString("+")
+			}
+			sb.WriteString(op.Line)
+			sb.WriteString("\n")
+		}
+		i = end
+	}
+
+	return sb.String(), stats
+}
+
+// hunkRange formats a hunk header range; empty ranges point at the line before
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// myers computes a shortest edit script with Myers' O(ND) algorithm. It
+// reports false if the inputs differ by more than maxEdits lines.
+func myers(a, b []string) ([]Op, bool) {
+	n, m := len(a), len(b)
+	limit := n + m
+	if limit > maxEdits {
+		limit = maxEdits
+	}
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+
+	// trace[d] holds v[-(d-1)..d-1] as it was before step d
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		snapshot := make([]int, 0, 2*d)
+		if d > 0 {
+			snapshot = append(snapshot, v[offset-d+1:offset+d]...)
+		}
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// backtrack walks the Myers trace from the end to recover the edit script
+func backtrack(a, b []string, trace [][]int) []Op {
+	x, y := len(a), len(b)
+	var ops []Op
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		if d == 0 {
+			for x > 0 && y > 0 {
+				ops = append(ops, Op{Kind: OpEqual, Line: a[x-1]})
+				x--
+				y--
+			}
+			break
+		}
+
+		get := func(k int) int { return trace[d][k+d-1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && get(k-1) < get(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := get(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, Op{Kind: OpEqual, Line: a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, Op{Kind: OpInsert, Line: b[y-1]})
+		} else {
+			ops = append(ops, Op{Kind: OpDelete, Line: a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+
+	// Reverse into forward order
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
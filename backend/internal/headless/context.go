@@ -0,0 +1,143 @@
+package headless
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/jacklau/prism/internal/ignore"
+)
+
+// defaultMaxContextBytes bounds the repository context given to each task
+const defaultMaxContextBytes = 256 * 1024
+
+// buildContext renders the files and diff selected by spec as text for the
+// agent. Files that don't fit within the size limit are listed as omitted.
+func buildContext(ctx context.Context, repoDir string, spec ContextSpec) (string, error) {
+	maxBytes := spec.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxContextBytes
+	}
+
+	var b strings.Builder
+	if spec.DiffBase != "" {
+		diff, err := gitDiff(ctx, repoDir, spec.DiffBase)
+		if err != nil {
+			return "", err
+		}
+		if diff != "" {
+			fmt.Fprintf(&b, "Changes since %s:\n```diff\n%s\n```\n\n", spec.DiffBase, strings.TrimRight(diff, "\n"))
+		}
+	}
+
+	files, err := matchFiles(repoDir, spec.Files)
+	if err != nil {
+		return "", err
+	}
+
+	var omitted []string
+	for _, name := range files {
+		data, err := readTextFile(filepath.Join(repoDir, filepath.FromSlash(name)))
+		if err != nil || data == "" {
+			continue
+		}
+		entry := fmt.Sprintf("File: %s\n```\n%s\n```\n\n", name, strings.TrimRight(data, "\n"))
+		if b.Len()+len(entry) > maxBytes {
+			omitted = append(omitted, name)
+			continue
+		}
+		b.WriteString(entry)
+	}
+	if len(omitted) > 0 {
+		fmt.Fprintf(&b, "Omitted (context size limit): %s\n", strings.Join(omitted, ", "))
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
+
+// gitDiff returns the changes in the checkout since base
+func gitDiff(ctx context.Context, repoDir, base string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "diff", base+"...HEAD")
+	cmd.Dir = repoDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git diff %s: %v: %s", base, err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// matchFiles returns the files under repoDir matching any of the patterns,
+// as sorted slash-separated relative paths
+func matchFiles(repoDir string, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	for _, pattern := range patterns {
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("invalid context pattern %q", pattern)
+		}
+	}
+
+	// Files the repository ignores are never context, but dotfiles such as
+	// .github/ workflows may be asked for
+	matcher := ignore.New(repoDir, true)
+
+	var files []string
+	err := filepath.WalkDir(repoDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == repoDir {
+			return nil
+		}
+		rel, err := filepath.Rel(repoDir, p)
+		if err != nil {
+			return err
+		}
+		if matcher.Match(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		for _, pattern := range patterns {
+			if matched, _ := doublestar.Match(pattern, rel); matched {
+				files = append(files, rel)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search repository: %w", err)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// readTextFile returns a file's contents, or "" for binary files
+func readTextFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return "", nil
+	}
+	return string(data), nil
+}
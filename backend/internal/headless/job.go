@@ -0,0 +1,210 @@
+// Package headless runs agent and swarm jobs without a server, against a
+// repository checkout. It is meant for CI: a job file describes the tasks,
+// results and patches are written to disk, and the outcome is reported
+// through the exit status.
+package headless
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/jacklau/prism/internal/agent"
+	"gopkg.in/yaml.v3"
+)
+
+// Job errors
+var (
+	ErrNoTasks         = errors.New("job has no tasks")
+	ErrNoModel         = errors.New("provider and model are required")
+	ErrInvalidTask     = errors.New("invalid task")
+	ErrUnknownStrategy = errors.New("unknown swarm strategy")
+)
+
+// Job describes a headless run. Settings at the job level are defaults for
+// every task.
+type Job struct {
+	Name         string        `yaml:"name"`
+	Provider     string        `yaml:"provider"`
+	Model        string        `yaml:"model"`
+	SystemPrompt string        `yaml:"system_prompt"`
+	Temperature  float64       `yaml:"temperature"`
+	MaxTokens    int           `yaml:"max_tokens"`
+	Timeout      time.Duration `yaml:"timeout"` // For the whole job; 0 means no limit
+
+	// Sampling controls beyond temperature. Deterministic makes runs as
+	// reproducible as the provider allows, for comparing results across runs.
+	TopP             float64  `yaml:"top_p"`
+	FrequencyPenalty float64  `yaml:"frequency_penalty"`
+	PresencePenalty  float64  `yaml:"presence_penalty"`
+	Stop             []string `yaml:"stop"`
+	Seed             *int64   `yaml:"seed"`
+	Deterministic    bool     `yaml:"deterministic"`
+
+	Context ContextSpec `yaml:"context"`
+
+	// ApplyPatches applies the patches tasks produce to the checkout
+	ApplyPatches bool `yaml:"apply_patches"`
+
+	// ContinueOnFailure keeps running tasks after one fails
+	ContinueOnFailure bool `yaml:"continue_on_failure"`
+
+	Tasks []TaskSpec `yaml:"tasks"`
+}
+
+// ContextSpec selects what of the repository the agents see
+type ContextSpec struct {
+	// Files are glob patterns relative to the repository root; "**" matches
+	// any number of directories
+	Files []string `yaml:"files"`
+
+	// DiffBase includes the changes since this git ref, e.g. origin/main
+	DiffBase string `yaml:"diff_base"`
+
+	// MaxBytes caps the size of the context; 0 uses the default
+	MaxBytes int `yaml:"max_bytes"`
+}
+
+// TaskSpec is one agent task or swarm in a job
+type TaskSpec struct {
+	Name     string `yaml:"name"`
+	Prompt   string `yaml:"prompt"`
+	Provider string `yaml:"provider"`
+	Model    string `yaml:"model"`
+
+	SystemPrompt string `yaml:"system_prompt"`
+
+	// Context overrides the job's context for this task
+	Context *ContextSpec `yaml:"context"`
+
+	// FailPattern marks the task failed when its output matches this
+	// regular expression, e.g. "(?m)^VERDICT: FAIL"
+	FailPattern string `yaml:"fail_pattern"`
+
+	Budget *BudgetSpec `yaml:"budget"`
+
+	// Swarm runs the task with several agents instead of one
+	Swarm *SwarmSpec `yaml:"swarm"`
+
+	failPattern *regexp.Regexp
+}
+
+// BudgetSpec limits the resources a task may consume
+type BudgetSpec struct {
+	MaxTokens    int           `yaml:"max_tokens"`
+	MaxToolCalls int           `yaml:"max_tool_calls"`
+	MaxDuration  time.Duration `yaml:"max_duration"`
+}
+
+// SwarmSpec configures a multi-agent task
+type SwarmSpec struct {
+	Strategy string     `yaml:"strategy"` // parallel, pipeline, debate, consensus, map_reduce, specialist
+	Roles    []RoleSpec `yaml:"roles"`
+}
+
+// RoleSpec is a group of swarm agents with the same role
+type RoleSpec struct {
+	Role         string `yaml:"role"`
+	Count        int    `yaml:"count"`
+	Provider     string `yaml:"provider"`
+	Model        string `yaml:"model"`
+	SystemPrompt string `yaml:"system_prompt"`
+}
+
+// strategies are the swarm strategies a job may use
+var strategies = map[string]bool{
+	string(agent.StrategyParallel):   true,
+	string(agent.StrategyPipeline):   true,
+	string(agent.StrategyDebate):     true,
+	string(agent.StrategyConsensus):  true,
+	string(agent.StrategyMapReduce):  true,
+	string(agent.StrategySpecialist): true,
+}
+
+// LoadJob reads and validates a job file
+func LoadJob(path string) (*Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job: %w", err)
+	}
+
+	var job Job
+	if err := yaml.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to parse job: %w", err)
+	}
+	if err := job.validate(); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// validate checks the job, filling in task names and compiling patterns
+func (j *Job) validate() error {
+	if len(j.Tasks) == 0 {
+		return ErrNoTasks
+	}
+
+	names := make(map[string]bool, len(j.Tasks))
+	for i := range j.Tasks {
+		task := &j.Tasks[i]
+		if task.Name == "" {
+			task.Name = fmt.Sprintf("task-%d", i+1)
+		}
+		// Names are used for artifact files, so must differ once sanitized
+		if names[artifactName(task.Name)] {
+			return fmt.Errorf("%w: duplicate name %q", ErrInvalidTask, task.Name)
+		}
+		names[artifactName(task.Name)] = true
+
+		if task.Prompt == "" {
+			return fmt.Errorf("%w %s: prompt is required", ErrInvalidTask, task.Name)
+		}
+		if j.provider(task) == "" || j.model(task) == "" {
+			return fmt.Errorf("%w: task %s", ErrNoModel, task.Name)
+		}
+		if task.FailPattern != "" {
+			pattern, err := regexp.Compile(task.FailPattern)
+			if err != nil {
+				return fmt.Errorf("%w %s: fail_pattern: %v", ErrInvalidTask, task.Name, err)
+			}
+			task.failPattern = pattern
+		}
+		if task.Swarm != nil {
+			if task.Swarm.Strategy != "" && !strategies[task.Swarm.Strategy] {
+				return fmt.Errorf("%w %q in task %s", ErrUnknownStrategy, task.Swarm.Strategy, task.Name)
+			}
+			for _, role := range task.Swarm.Roles {
+				if role.Role == "" {
+					return fmt.Errorf("%w %s: swarm roles need a role", ErrInvalidTask, task.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// provider returns the provider a task runs with
+func (j *Job) provider(task *TaskSpec) string {
+	if task.Provider != "" {
+		return task.Provider
+	}
+	return j.Provider
+}
+
+// model returns the model a task runs with
+func (j *Job) model(task *TaskSpec) string {
+	if task.Model != "" {
+		return task.Model
+	}
+	return j.Model
+}
+
+// contextSpec returns the context a task sees
+func (j *Job) contextSpec(task *TaskSpec) ContextSpec {
+	if task.Context != nil {
+		return *task.Context
+	}
+	return j.Context
+}
@@ -0,0 +1,47 @@
+package headless
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// patchBlockPattern matches fenced diff blocks in agent output
+var patchBlockPattern = regexp.MustCompile("(?s)```(?:diff|patch)[ \\t]*\\n(.*?)```")
+
+// extractPatch collects the unified diffs in an agent's output into a single
+// patch. Returns "" if the output has none.
+func extractPatch(output string) string {
+	var patches []string
+	for _, match := range patchBlockPattern.FindAllStringSubmatch(output, -1) {
+		patch := strings.TrimRight(match[1], "\n")
+		if strings.Contains(patch, "\n@@") || strings.HasPrefix(patch, "@@") {
+			patches = append(patches, patch+"\n")
+		}
+	}
+	return strings.Join(patches, "")
+}
+
+// applyPatch checks that a patch applies cleanly to the checkout, then
+// applies it
+func applyPatch(ctx context.Context, repoDir, patchFile string) error {
+	if err := git(ctx, repoDir, "apply", "--check", patchFile); err != nil {
+		return err
+	}
+	return git(ctx, repoDir, "apply", patchFile)
+}
+
+// git runs a git command in the checkout
+func git(ctx context.Context, repoDir string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = repoDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
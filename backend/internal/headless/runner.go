@@ -0,0 +1,408 @@
+package headless
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jacklau/prism/internal/agent"
+	"github.com/jacklau/prism/internal/llm"
+)
+
+// Task and job statuses
+const (
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// resultsFile is the report written to the output directory
+const resultsFile = "results.json"
+
+// Options configure a headless run
+type Options struct {
+	RepoDir   string    // The checkout the job runs against
+	OutputDir string    // Where results and patches are written
+	Log       io.Writer // Progress and streamed output; nil discards it
+}
+
+// Report is the outcome of a job, written to results.json
+type Report struct {
+	Job         string        `json:"job,omitempty"`
+	Status      string        `json:"status"`
+	StartedAt   time.Time     `json:"started_at"`
+	CompletedAt time.Time     `json:"completed_at"`
+	DurationMs  int64         `json:"duration_ms"`
+	Tasks       []*TaskReport `json:"tasks"`
+}
+
+// TaskReport is the outcome of one task
+type TaskReport struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // agent or swarm
+	Status   string `json:"status"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	// CheckFailed is set when the output matched the task's fail_pattern
+	CheckFailed bool `json:"check_failed,omitempty"`
+
+	// OutputFile and PatchFile are relative to the output directory
+	OutputFile   string `json:"output_file,omitempty"`
+	PatchFile    string `json:"patch_file,omitempty"`
+	PatchApplied bool   `json:"patch_applied,omitempty"`
+
+	TokensUsed     int    `json:"tokens_used,omitempty"`
+	ToolCalls      int    `json:"tool_calls,omitempty"`
+	BudgetExceeded string `json:"budget_exceeded,omitempty"`
+	DurationMs     int64  `json:"duration_ms"`
+
+	Agents []*SwarmAgentReport `json:"agents,omitempty"`
+}
+
+// SwarmAgentReport is the outcome of one agent in a swarm task
+type SwarmAgentReport struct {
+	Role    string `json:"role"`
+	Success bool   `json:"success"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Runner executes jobs with an in-process agent manager
+type Runner struct {
+	agentManager *agent.Manager
+}
+
+// NewRunner creates a runner using the given LLM providers
+func NewRunner(llmManager *llm.Manager) *Runner {
+	return &Runner{
+		agentManager: agent.NewManager(llmManager, agent.DefaultManagerConfig()),
+	}
+}
+
+// Run executes the job's tasks in order and writes the report and artifacts
+// to the output directory. Tasks after a failure are skipped unless the job
+// continues on failure. The returned error is for problems running the job
+// itself; failed tasks are reported through the report's status.
+func (r *Runner) Run(ctx context.Context, job *Job, opts Options) (*Report, error) {
+	if opts.Log == nil {
+		opts.Log = io.Discard
+	}
+	if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+
+	r.agentManager.Start()
+	defer r.agentManager.Stop()
+
+	report := &Report{
+		Job:       job.Name,
+		Status:    StatusPassed,
+		StartedAt: time.Now(),
+	}
+
+	for i := range job.Tasks {
+		spec := &job.Tasks[i]
+		if report.Status == StatusFailed && !job.ContinueOnFailure {
+			report.Tasks = append(report.Tasks, &TaskReport{
+				Name:     spec.Name,
+				Type:     taskType(spec),
+				Status:   StatusSkipped,
+				Provider: job.provider(spec),
+				Model:    job.model(spec),
+			})
+			continue
+		}
+
+		fmt.Fprintf(opts.Log, "==> %s\n", spec.Name)
+		task := r.runTask(ctx, job, spec, opts)
+		report.Tasks = append(report.Tasks, task)
+		if task.Status == StatusFailed {
+			report.Status = StatusFailed
+		}
+		fmt.Fprintf(opts.Log, "\n<== %s: %s", spec.Name, task.Status)
+		if task.Error != "" {
+			fmt.Fprintf(opts.Log, " (%s)", task.Error)
+		}
+		fmt.Fprintln(opts.Log)
+	}
+
+	report.CompletedAt = time.Now()
+	report.DurationMs = report.CompletedAt.Sub(report.StartedAt).Milliseconds()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(opts.OutputDir, resultsFile), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write results: %w", err)
+	}
+	return report, nil
+}
+
+// runTask runs one task and saves its output and patch
+func (r *Runner) runTask(ctx context.Context, job *Job, spec *TaskSpec, opts Options) *TaskReport {
+	task := &TaskReport{
+		Name:     spec.Name,
+		Type:     taskType(spec),
+		Provider: job.provider(spec),
+		Model:    job.model(spec),
+	}
+	start := time.Now()
+	defer func() {
+		task.DurationMs = time.Since(start).Milliseconds()
+	}()
+
+	repoContext, err := buildContext(ctx, opts.RepoDir, job.contextSpec(spec))
+	if err != nil {
+		task.Status = StatusFailed
+		task.Error = err.Error()
+		return task
+	}
+
+	config := agent.AgentConfig{
+		Name:         spec.Name,
+		Provider:     task.Provider,
+		Model:        task.Model,
+		SystemPrompt: spec.SystemPrompt,
+		Temperature:  job.Temperature,
+		MaxTokens:    job.MaxTokens,
+		Sampling: llm.Sampling{
+			TopP:             job.TopP,
+			FrequencyPenalty: job.FrequencyPenalty,
+			PresencePenalty:  job.PresencePenalty,
+			Stop:             job.Stop,
+			Seed:             job.Seed,
+			Deterministic:    job.Deterministic,
+		},
+	}
+	if config.SystemPrompt == "" {
+		config.SystemPrompt = job.SystemPrompt
+	}
+
+	if spec.Swarm != nil {
+		err = r.runSwarm(ctx, spec, config, repoContext, task, opts.Log)
+	} else {
+		err = r.runAgent(ctx, spec, config, repoContext, task, opts.Log)
+	}
+	if err != nil {
+		task.Status = StatusFailed
+		task.Error = err.Error()
+	}
+
+	if task.Output != "" {
+		name := artifactName(spec.Name)
+		task.OutputFile = name + ".md"
+		if err := os.WriteFile(filepath.Join(opts.OutputDir, task.OutputFile), []byte(task.Output), 0644); err != nil {
+			task.Status = StatusFailed
+			task.Error = fmt.Sprintf("failed to write output: %v", err)
+			return task
+		}
+
+		if patch := extractPatch(task.Output); patch != "" {
+			task.PatchFile = name + ".patch"
+			patchPath := filepath.Join(opts.OutputDir, task.PatchFile)
+			if err := os.WriteFile(patchPath, []byte(patch), 0644); err != nil {
+				task.Status = StatusFailed
+				task.Error = fmt.Sprintf("failed to write patch: %v", err)
+				return task
+			}
+			if job.ApplyPatches && task.Status != StatusFailed {
+				absPatch, _ := filepath.Abs(patchPath)
+				if err := applyPatch(ctx, opts.RepoDir, absPatch); err != nil {
+					task.Status = StatusFailed
+					task.Error = fmt.Sprintf("failed to apply patch: %v", err)
+					return task
+				}
+				task.PatchApplied = true
+			}
+		}
+	}
+
+	if task.Status == "" {
+		task.Status = StatusPassed
+		if spec.failPattern != nil && spec.failPattern.MatchString(task.Output) {
+			task.Status = StatusFailed
+			task.CheckFailed = true
+			task.Error = "output matched fail_pattern"
+		}
+	}
+	return task
+}
+
+// runAgent runs a task with a single agent, streaming its output to the log
+func (r *Runner) runAgent(ctx context.Context, spec *TaskSpec, config agent.AgentConfig, repoContext string, task *TaskReport, log io.Writer) error {
+	var taskOpts []agent.TaskOption
+	if repoContext != "" {
+		taskOpts = append(taskOpts, agent.WithContext(repoContext))
+	}
+	if spec.Budget != nil {
+		taskOpts = append(taskOpts, agent.WithBudget(agent.Budget{
+			MaxTokens:    spec.Budget.MaxTokens,
+			MaxToolCalls: spec.Budget.MaxToolCalls,
+			MaxDuration:  spec.Budget.MaxDuration,
+		}))
+	}
+
+	execution, err := r.agentManager.RunTask(ctx, agent.NewTask(spec.Prompt, taskOpts...), config)
+	if err != nil {
+		return err
+	}
+
+	// Cancel the run when the job times out
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.agentManager.CancelExecution(execution.ID)
+		case <-done:
+		}
+	}()
+
+	if len(execution.Agents) > 0 {
+		for event := range execution.Agents[0].Events() {
+			switch event.Type {
+			case agent.AgentEventStreamChunk:
+				if delta, ok := event.Data["delta"].(string); ok {
+					io.WriteString(log, delta)
+				}
+			case agent.AgentEventToolCall:
+				fmt.Fprintf(log, "\n[tool] %v\n", event.Data["name"])
+			}
+		}
+	}
+	execution.Wait()
+
+	results := execution.GetResults()
+	if len(results) == 0 {
+		if ctx.Err() != nil {
+			return fmt.Errorf("job stopped: %w", ctx.Err())
+		}
+		return errors.New("agent cancelled")
+	}
+	result := results[0]
+	task.Output = result.Output
+	task.TokensUsed = result.TokensUsed
+	task.ToolCalls = result.ToolCalls
+	task.BudgetExceeded = result.BudgetExceeded
+	if !result.Success {
+		return errors.New(result.Error)
+	}
+	return nil
+}
+
+// runSwarm runs a task with a multi-agent swarm. The repository context is
+// prepended to the task, since swarm agents take a single prompt.
+func (r *Runner) runSwarm(ctx context.Context, spec *TaskSpec, config agent.AgentConfig, repoContext string, task *TaskReport, log io.Writer) error {
+	roles := make([]agent.AgentRoleConfig, 0, len(spec.Swarm.Roles))
+	for _, role := range spec.Swarm.Roles {
+		roles = append(roles, agent.AgentRoleConfig{
+			Role:         agent.AgentRole(role.Role),
+			Count:        role.Count,
+			SystemPrompt: role.SystemPrompt,
+			Config: agent.AgentConfig{
+				Provider: role.Provider,
+				Model:    role.Model,
+			},
+		})
+	}
+	if len(roles) == 0 {
+		roles = []agent.AgentRoleConfig{
+			{Role: agent.RoleCoder, Count: 1},
+			{Role: agent.RoleReviewer, Count: 1},
+		}
+	}
+
+	strategy := agent.StrategyParallel
+	if spec.Swarm.Strategy != "" {
+		strategy = agent.SwarmStrategy(spec.Swarm.Strategy)
+	}
+
+	prompt := spec.Prompt
+	if repoContext != "" {
+		prompt = spec.Prompt + "\n\nRepository context:\n" + repoContext
+	}
+
+	swarm, err := r.agentManager.RunMultiAgent(ctx, prompt, strategy, roles, config, nil)
+	if err != nil {
+		return err
+	}
+
+	for event := range swarm.Events() {
+		switch event.Type {
+		case agent.SwarmEventAgentStarted:
+			fmt.Fprintf(log, "[%s] started\n", event.Role)
+		case agent.SwarmEventAgentCompleted:
+			fmt.Fprintf(log, "[%s] completed\n", event.Role)
+		case agent.SwarmEventAgentFailed:
+			fmt.Fprintf(log, "[%s] failed: %v\n", event.Role, event.Data["error"])
+		case agent.SwarmEventSynthesizing:
+			fmt.Fprintln(log, "Synthesizing results")
+		}
+	}
+
+	// The events channel closes once the swarm has finished
+	for _, result := range swarm.Results {
+		task.Agents = append(task.Agents, &SwarmAgentReport{
+			Role:    string(result.Role),
+			Success: result.Success,
+			Output:  result.Output,
+			Error:   result.Error,
+		})
+	}
+	task.Output = swarm.FinalOutput
+	if task.Output == "" {
+		outputs := make([]string, 0, len(swarm.Results))
+		for _, result := range swarm.Results {
+			if result.Output != "" {
+				outputs = append(outputs, result.Output)
+			}
+		}
+		task.Output = strings.Join(outputs, "\n\n")
+	}
+	io.WriteString(log, task.Output)
+
+	if swarm.Status != agent.SwarmStatusCompleted {
+		if swarm.Error != "" {
+			return errors.New(swarm.Error)
+		}
+		return fmt.Errorf("swarm %s", swarm.Status)
+	}
+	return nil
+}
+
+// taskType names the kind of task in reports
+func taskType(spec *TaskSpec) string {
+	if spec.Swarm != nil {
+		return "swarm"
+	}
+	return "agent"
+}
+
+// unsafeNameChars are replaced in artifact file names
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// artifactName turns a task name into a file name
+func artifactName(name string) string {
+	name = strings.Trim(unsafeNameChars.ReplaceAllString(name, "-"), "-.")
+	if name == "" {
+		return "task"
+	}
+	return name
+}
@@ -0,0 +1,190 @@
+// Package ignore decides which files in a workspace are left out of file
+// listings and searches. It follows the .gitignore rules of the workspace
+// (and .prismignore, for files to hide from Prism but not from git) the way
+// git does: patterns apply below the directory of the file they're in,
+// later patterns override earlier ones, and "!" re-includes a path.
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Files are the ignore files read in each directory. Rules in later files
+// take precedence.
+var Files = []string{".gitignore", ".prismignore"}
+
+// Defaults are ignored everywhere unless an ignore file re-includes them
+var Defaults = []string{"node_modules/", "__pycache__/"}
+
+// rule is one pattern line from an ignore file
+type rule struct {
+	base    string // Directory of the ignore file, relative to the root ("" for the root)
+	pattern string // doublestar pattern, relative to base
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher reports which paths under a root directory are ignored. Ignore
+// files are read as directories are first visited, so a Matcher should be
+// used for one walk rather than kept around.
+type Matcher struct {
+	root       string
+	showHidden bool
+	defaults   []rule
+
+	mu    sync.Mutex
+	rules map[string][]rule // Rules read from each directory's ignore files
+}
+
+// New creates a matcher for the tree under root. Dotfiles are ignored
+// unless showHidden is set; .git is always ignored.
+func New(root string, showHidden bool) *Matcher {
+	m := &Matcher{
+		root:       root,
+		showHidden: showHidden,
+		rules:      make(map[string][]rule),
+	}
+	for _, pattern := range Defaults {
+		if r, ok := parseLine("", pattern); ok {
+			m.defaults = append(m.defaults, r)
+		}
+	}
+	return m
+}
+
+// Match reports whether a path relative to the root is ignored, assuming
+// its parent directories are not. Use it while walking the tree, skipping
+// directories it matches.
+func (m *Matcher) Match(relPath string, isDir bool) bool {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if relPath == "." || relPath == "" {
+		return false
+	}
+
+	name := path.Base(relPath)
+	if name == ".git" {
+		return true
+	}
+	if !m.showHidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+
+	ignored := false
+	for _, r := range m.rulesFor(path.Dir(relPath)) {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		sub := relPath
+		if r.base != "" {
+			sub = strings.TrimPrefix(relPath, r.base+"/")
+		}
+		if matched, _ := doublestar.Match(r.pattern, sub); matched {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// Ignored reports whether a path relative to the root is ignored, either
+// itself or because a directory it is in is
+func (m *Matcher) Ignored(relPath string, isDir bool) bool {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	parts := strings.Split(relPath, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.Match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.Match(relPath, isDir)
+}
+
+// rulesFor returns the rules that apply to entries of dir: the defaults,
+// then those of each ignore file from the root down to dir
+func (m *Matcher) rulesFor(dir string) []rule {
+	if dir == "." {
+		dir = ""
+	}
+
+	rules := append([]rule{}, m.defaults...)
+	rules = append(rules, m.dirRules("")...)
+	if dir != "" {
+		parts := strings.Split(dir, "/")
+		for i := range parts {
+			rules = append(rules, m.dirRules(strings.Join(parts[:i+1], "/"))...)
+		}
+	}
+	return rules
+}
+
+// dirRules returns the rules from one directory's ignore files, reading
+// them the first time
+func (m *Matcher) dirRules(dir string) []rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rules, ok := m.rules[dir]; ok {
+		return rules
+	}
+
+	var rules []rule
+	for _, name := range Files {
+		f, err := os.Open(filepath.Join(m.root, filepath.FromSlash(dir), name))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if r, ok := parseLine(dir, scanner.Text()); ok {
+				rules = append(rules, r)
+			}
+		}
+		f.Close()
+	}
+
+	m.rules[dir] = rules
+	return rules
+}
+
+// parseLine parses an ignore file line. Returns false for blank lines,
+// comments and invalid patterns.
+func parseLine(base, line string) (rule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+
+	r := rule{base: base}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule{}, false
+	}
+
+	// A pattern with a slash before its end is relative to the ignore file's
+	// directory; one without matches at any depth below it
+	if strings.Contains(line, "/") {
+		r.pattern = strings.TrimPrefix(line, "/")
+	} else {
+		r.pattern = "**/" + line
+	}
+	if !doublestar.ValidatePattern(r.pattern) {
+		return rule{}, false
+	}
+	return r, true
+}
@@ -0,0 +1,329 @@
+// Package confluence is a read-only client for the Confluence REST API, used
+// to search and read pages with a user's credentials. Confluence Cloud is
+// accessed with an account email and API token; Server and Data Center with
+// a personal access token.
+package confluence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/JohannesKaufmann/html-to-markdown/plugin"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+var (
+	// ErrUnauthorized is returned when Confluence rejects the credentials
+	ErrUnauthorized = errors.New("confluence rejected the credentials")
+	// ErrNotFound is returned for pages that don't exist or can't be viewed
+	ErrNotFound = errors.New("confluence page not found")
+	// ErrInvalidURL is returned for site URLs that aren't http(s) URLs
+	ErrInvalidURL = errors.New("invalid confluence URL")
+)
+
+// APIError is an error returned by the Confluence API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("confluence API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// Credentials identify a user on a Confluence site
+type Credentials struct {
+	BaseURL string // e.g. https://acme.atlassian.net/wiki
+	Email   string // Cloud only; empty for a personal access token
+	Token   string
+}
+
+// User is the Confluence user credentials belong to
+type User struct {
+	DisplayName string `json:"displayName"`
+	Type        string `json:"type"`
+}
+
+// Page is a page found by a search
+type Page struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Space        string    `json:"space,omitempty"`
+	URL          string    `json:"url"`
+	Excerpt      string    `json:"excerpt,omitempty"`
+	LastModified time.Time `json:"last_modified,omitempty"`
+}
+
+// PageContent is a page converted to Markdown
+type PageContent struct {
+	Page
+	Version   int    `json:"version"`
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// Client is a Confluence API client
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient creates a new Confluence client
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: 20 * time.Second,
+		},
+	}
+}
+
+// NormalizeBaseURL checks a site URL and trims it to the base the REST API
+// is under, adding /wiki for Atlassian Cloud sites
+func NormalizeBaseURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", ErrInvalidURL
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	if i := strings.Index(path, "/rest/api"); i >= 0 {
+		path = path[:i]
+	}
+	if strings.HasSuffix(u.Host, ".atlassian.net") && !strings.HasPrefix(path, "/wiki") {
+		path = "/wiki"
+	}
+	return u.Scheme + "://" + u.Host + path, nil
+}
+
+// CurrentUser returns the user credentials belong to, which also checks them
+func (c *Client) CurrentUser(creds Credentials) (*User, error) {
+	var user User
+	if err := c.get(creds, "/rest/api/user/current", nil, &user); err != nil {
+		return nil, err
+	}
+	// Cloud answers bad credentials on some sites with the anonymous user
+	if user.Type == "anonymous" {
+		return nil, ErrUnauthorized
+	}
+	return &user, nil
+}
+
+// Search finds pages whose text matches a query, optionally in one space
+func (c *Client) Search(creds Credentials, query, space string, limit int) ([]Page, error) {
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	cql := fmt.Sprintf(`type = page AND text ~ "%s"`, escapeCQL(query))
+	if space != "" {
+		cql += fmt.Sprintf(` AND space = "%s"`, escapeCQL(space))
+	}
+
+	var result struct {
+		Results []struct {
+			Content struct {
+				ID    string `json:"id"`
+				Title string `json:"title"`
+				Links struct {
+					WebUI string `json:"webui"`
+				} `json:"_links"`
+			} `json:"content"`
+			Excerpt               string `json:"excerpt"`
+			LastModified          string `json:"lastModified"`
+			ResultGlobalContainer struct {
+				Title string `json:"title"`
+			} `json:"resultGlobalContainer"`
+		} `json:"results"`
+	}
+	err := c.get(creds, "/rest/api/search", url.Values{
+		"cql":   {cql},
+		"limit": {strconv.Itoa(limit)},
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]Page, 0, len(result.Results))
+	for _, r := range result.Results {
+		if r.Content.ID == "" {
+			continue
+		}
+		page := Page{
+			ID:      r.Content.ID,
+			Title:   r.Content.Title,
+			Space:   r.ResultGlobalContainer.Title,
+			URL:     creds.BaseURL + r.Content.Links.WebUI,
+			Excerpt: cleanExcerpt(r.Excerpt),
+		}
+		page.LastModified, _ = time.Parse(time.RFC3339, r.LastModified)
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// ReadPage fetches a page and converts its body to Markdown, truncated to
+// maxChars characters
+func (c *Client) ReadPage(creds Credentials, pageID string, maxChars int) (*PageContent, error) {
+	pageID = strings.TrimSpace(pageID)
+	if _, err := strconv.ParseInt(pageID, 10, 64); err != nil {
+		return nil, ErrNotFound
+	}
+
+	var page struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+		Space struct {
+			Name string `json:"name"`
+		} `json:"space"`
+		Version struct {
+			Number int    `json:"number"`
+			When   string `json:"when"`
+		} `json:"version"`
+		Body struct {
+			Storage struct {
+				Value string `json:"value"`
+			} `json:"storage"`
+		} `json:"body"`
+		Links struct {
+			WebUI string `json:"webui"`
+		} `json:"_links"`
+	}
+	err := c.get(creds, "/rest/api/content/"+pageID, url.Values{
+		"expand": {"body.storage,version,space"},
+	}, &page)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := storageToMarkdown(page.Body.Storage.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert page: %w", err)
+	}
+	result := &PageContent{
+		Page: Page{
+			ID:    page.ID,
+			Title: page.Title,
+			Space: page.Space.Name,
+			URL:   creds.BaseURL + page.Links.WebUI,
+		},
+		Version: page.Version.Number,
+		Content: content,
+	}
+	result.LastModified, _ = time.Parse(time.RFC3339, page.Version.When)
+	if maxChars > 0 && len(result.Content) > maxChars {
+		result.Content = result.Content[:maxChars]
+		result.Truncated = true
+	}
+	return result, nil
+}
+
+// get makes an API request and decodes its response into out
+func (c *Client) get(creds Credentials, path string, query url.Values, out interface{}) error {
+	if creds.BaseURL == "" || creds.Token == "" {
+		return ErrUnauthorized
+	}
+
+	endpoint := creds.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if creds.Email != "" {
+		req.SetBasicAuth(creds.Email, creds.Token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+creds.Token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&apiErr)
+		return &APIError{StatusCode: resp.StatusCode, Message: apiErr.Message}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// escapeCQL escapes a value for a double-quoted CQL string
+func escapeCQL(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
+
+var (
+	// codeMacroPattern matches code block macros, capturing the language
+	// parameter (if any) and the code
+	codeMacroPattern = regexp.MustCompile(`(?s)<ac:structured-macro[^>]*ac:name="(?:code|noformat)"[^>]*>(.*?)</ac:structured-macro>`)
+	languagePattern  = regexp.MustCompile(`<ac:parameter ac:name="language">([^<]*)</ac:parameter>`)
+	cdataPattern     = regexp.MustCompile(`(?s)<!\[CDATA\[(.*?)\]\]>`)
+	highlightPattern = regexp.MustCompile(`@@@(end)?hl@@@`)
+)
+
+// storageToMarkdown converts a page body in Confluence storage format
+// (XHTML with ac: macros) to Markdown. Code macros become fenced code blocks;
+// other macros keep their text.
+func storageToMarkdown(storage string) (string, error) {
+	storage = codeMacroPattern.ReplaceAllStringFunc(storage, func(macro string) string {
+		var code string
+		if m := cdataPattern.FindStringSubmatch(macro); m != nil {
+			code = m[1]
+		}
+		class := ""
+		if m := languagePattern.FindStringSubmatch(macro); m != nil {
+			class = ` class="language-` + m[1] + `"`
+		}
+		return "<pre><code" + class + ">" + htmlEscape(code) + "</code></pre>"
+	})
+	storage = cdataPattern.ReplaceAllStringFunc(storage, func(cdata string) string {
+		return htmlEscape(cdataPattern.FindStringSubmatch(cdata)[1])
+	})
+
+	converter := md.NewConverter("", true, nil)
+	converter.Use(plugin.GitHubFlavored())
+	content, err := converter.ConvertString(storage)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(content), nil
+}
+
+// cleanExcerpt removes search highlight markers from an excerpt
+func cleanExcerpt(excerpt string) string {
+	return strings.TrimSpace(highlightPattern.ReplaceAllString(excerpt, ""))
+}
+
+func htmlEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
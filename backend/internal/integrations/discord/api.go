@@ -0,0 +1,183 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const apiBaseURL = "https://discord.com/api/v10"
+
+// InteractionResponseMessage is the interaction callback type that replies
+// with a message
+const InteractionResponseMessage = 4
+
+// MessageFlagEphemeral shows an interaction response only to the user who
+// invoked it
+const MessageFlagEphemeral = 1 << 6
+
+// PermissionManageGuild is the "Manage Server" permission bit
+const PermissionManageGuild = 1 << 5
+
+// ApplicationCommand is a slash command definition
+type ApplicationCommand struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Type        int                        `json:"type,omitempty"`
+	Options     []ApplicationCommandOption `json:"options,omitempty"`
+}
+
+// ApplicationCommandOption is an option or subcommand of a slash command
+type ApplicationCommandOption struct {
+	Type        int                        `json:"type"`
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	Required    bool                       `json:"required,omitempty"`
+	Options     []ApplicationCommandOption `json:"options,omitempty"`
+}
+
+// Application command option types
+const (
+	OptionTypeSubcommand = 1
+	OptionTypeString     = 3
+)
+
+// Interaction is an INTERACTION_CREATE event from the gateway
+type Interaction struct {
+	ID            string           `json:"id"`
+	ApplicationID string           `json:"application_id"`
+	Type          int              `json:"type"`
+	Token         string           `json:"token"`
+	GuildID       string           `json:"guild_id"`
+	ChannelID     string           `json:"channel_id"`
+	Data          *InteractionData `json:"data"`
+	Member        *struct {
+		User        *User  `json:"user"`
+		Permissions string `json:"permissions"`
+	} `json:"member"`
+	User *User `json:"user"` // set instead of Member in DMs
+}
+
+// InteractionData holds the invoked command and its options
+type InteractionData struct {
+	Name    string              `json:"name"`
+	Options []InteractionOption `json:"options"`
+}
+
+// InteractionOption is a command option value or an invoked subcommand
+type InteractionOption struct {
+	Name    string              `json:"name"`
+	Type    int                 `json:"type"`
+	Value   interface{}         `json:"value"`
+	Options []InteractionOption `json:"options"`
+}
+
+// User is a Discord user
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// Message is a Discord message
+type Message struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+}
+
+// Channel is a Discord channel or thread
+type Channel struct {
+	ID string `json:"id"`
+}
+
+// RegisterCommands replaces the bot's global slash commands
+func (c *Client) RegisterCommands(applicationID string, commands []ApplicationCommand) error {
+	return c.callAPI("PUT", "/applications/"+applicationID+"/commands", commands, nil)
+}
+
+// RespondToInteraction sends the initial response to an interaction. Discord
+// requires a response within three seconds of the interaction.
+func (c *Client) RespondToInteraction(interactionID, token, content string, ephemeral bool) error {
+	data := map[string]interface{}{
+		"content": content,
+	}
+	if ephemeral {
+		data["flags"] = MessageFlagEphemeral
+	}
+	return c.callAPI("POST", "/interactions/"+interactionID+"/"+token+"/callback", map[string]interface{}{
+		"type": InteractionResponseMessage,
+		"data": data,
+	}, nil)
+}
+
+// CreateMessage posts a message to a channel or thread
+func (c *Client) CreateMessage(channelID, content string) (*Message, error) {
+	var message Message
+	err := c.callAPI("POST", "/channels/"+channelID+"/messages", map[string]interface{}{
+		"content":          content,
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}, &message)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// EditMessage replaces the content of a message previously posted by the bot
+func (c *Client) EditMessage(channelID, messageID, content string) error {
+	return c.callAPI("PATCH", "/channels/"+channelID+"/messages/"+messageID, map[string]interface{}{
+		"content": content,
+	}, nil)
+}
+
+// StartThread starts a public thread from a message
+func (c *Client) StartThread(channelID, messageID, name string) (*Channel, error) {
+	var thread Channel
+	err := c.callAPI("POST", "/channels/"+channelID+"/messages/"+messageID+"/threads", map[string]interface{}{
+		"name":                  name,
+		"auto_archive_duration": 1440,
+	}, &thread)
+	if err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+// callAPI calls a Discord REST endpoint with the bot token
+func (c *Client) callAPI(method, path string, payload interface{}, out interface{}) error {
+	if c.config.BotToken == "" {
+		return fmt.Errorf("discord bot token is not configured")
+	}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest(method, apiBaseURL+path, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bot "+c.config.BotToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("discord API returned status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
@@ -92,6 +92,30 @@ func (c *Client) buildMessage(event *integrations.Event) string {
 		return "✅ **Tool Approved**"
 	case integrations.EventToolRejected:
 		return "❌ **Tool Rejected**"
+	case integrations.EventVulnerabilitiesFound:
+		return "🛡️ **New Dependency Vulnerabilities**"
+	case integrations.EventAgentCompleted:
+		return "🤖 **Agent Completed**"
+	case integrations.EventAgentFailed:
+		return "🤖 **Agent Failed**"
+	case integrations.EventSwarmCompleted:
+		return "🐝 **Swarm Completed**"
+	case integrations.EventSwarmFailed:
+		return "🐝 **Swarm Failed**"
+	case integrations.EventBuildCompleted:
+		return "🏗️ **Build Succeeded**"
+	case integrations.EventBuildFailed:
+		return "🏗️ **Build Failed**"
+	case integrations.EventConversationSummarized:
+		return "📝 **Conversation Summary**"
+	case integrations.EventActivityDigest:
+		return "📊 **Activity Digest**"
+	case integrations.EventIntegrationTest:
+		return "🔔 **Test Notification**"
+	case integrations.EventLoginNewDevice:
+		return "🔐 **New Sign-in**"
+	case integrations.EventLoginFailures:
+		return "🔐 **Repeated Failed Sign-ins**"
 	default:
 		return fmt.Sprintf("📋 **Event: %s**", event.Type)
 	}
@@ -107,9 +131,12 @@ func (c *Client) buildEmbeds(event *integrations.Event) []map[string]interface{}
 
 	// Set color based on event type
 	switch event.Type {
-	case integrations.EventError:
+	case integrations.EventError, integrations.EventVulnerabilitiesFound,
+		integrations.EventAgentFailed, integrations.EventSwarmFailed, integrations.EventBuildFailed,
+		integrations.EventLoginFailures:
 		embed["color"] = 15158332 // Red
-	case integrations.EventToolApproved:
+	case integrations.EventToolApproved,
+		integrations.EventAgentCompleted, integrations.EventSwarmCompleted, integrations.EventBuildCompleted:
 		embed["color"] = 3066993 // Green
 	case integrations.EventToolRejected:
 		embed["color"] = 15105570 // Orange
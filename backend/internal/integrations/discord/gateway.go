@@ -0,0 +1,350 @@
+package discord
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/websocket"
+)
+
+const (
+	gatewayURL   = "wss://gateway.discord.gg/?v=10&encoding=json"
+	gatewayQuery = "/?v=10&encoding=json"
+
+	// IntentGuilds is the only intent the bot needs; interactions are
+	// delivered regardless of intents
+	IntentGuilds = 1 << 0
+
+	maxReconnectDelay = 2 * time.Minute
+)
+
+// Gateway opcodes
+const (
+	opDispatch       = 0
+	opHeartbeat      = 1
+	opIdentify       = 2
+	opResume         = 6
+	opReconnect      = 7
+	opInvalidSession = 9
+	opHello          = 10
+	opHeartbeatACK   = 11
+)
+
+// Gateway close codes after which reconnecting would fail again
+var fatalCloseCodes = []int{
+	4004, // authentication failed
+	4010, // invalid shard
+	4011, // sharding required
+	4012, // invalid API version
+	4013, // invalid intents
+	4014, // disallowed intents
+}
+
+// errReconnect asks the gateway loop to reconnect
+var errReconnect = errors.New("gateway requested reconnect")
+
+// DispatchHandler receives gateway dispatch events, e.g. READY or
+// INTERACTION_CREATE. It is called from the gateway's read loop and should
+// not block.
+type DispatchHandler func(eventType string, data json.RawMessage)
+
+// gatewayPayload is a message sent or received over the gateway
+type gatewayPayload struct {
+	Op   int             `json:"op"`
+	Data json.RawMessage `json:"d,omitempty"`
+	Seq  *int64          `json:"s,omitempty"`
+	Type string          `json:"t,omitempty"`
+}
+
+// Gateway is a connection to the Discord gateway. It identifies as the bot,
+// keeps the connection alive with heartbeats and resumes or reconnects when
+// the connection drops.
+type Gateway struct {
+	token   string
+	intents int
+	handler DispatchHandler
+
+	conn      *websocket.Conn
+	writeMu   sync.Mutex
+	seq       int64
+	sessionID string
+	resumeURL string
+	acked     bool
+	mu        sync.Mutex
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	doneCh   chan struct{}
+}
+
+// NewGateway creates a new gateway connection for a bot token
+func NewGateway(token string, intents int, handler DispatchHandler) *Gateway {
+	return &Gateway{
+		token:   token,
+		intents: intents,
+		handler: handler,
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+}
+
+// Start connects to the gateway in the background
+func (g *Gateway) Start() {
+	go g.run()
+}
+
+// Stop closes the gateway connection
+func (g *Gateway) Stop() {
+	g.stopOnce.Do(func() {
+		close(g.stopCh)
+		g.mu.Lock()
+		if g.conn != nil {
+			g.conn.Close()
+		}
+		g.mu.Unlock()
+	})
+	<-g.doneCh
+}
+
+// run connects to the gateway and reconnects with backoff until stopped
+func (g *Gateway) run() {
+	defer close(g.doneCh)
+
+	delay := time.Second
+	for {
+		connectedAt := time.Now()
+		err := g.connect()
+
+		select {
+		case <-g.stopCh:
+			return
+		default:
+		}
+
+		if websocket.IsCloseError(err, fatalCloseCodes...) {
+			log.Printf("Discord gateway closed permanently: %v", err)
+			return
+		}
+		if err != errReconnect {
+			log.Printf("Discord gateway disconnected: %v", err)
+		}
+
+		// Reset the backoff after a connection that stayed up for a while
+		if time.Since(connectedAt) > maxReconnectDelay {
+			delay = time.Second
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-g.stopCh:
+			return
+		}
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// connect runs a single gateway session until the connection ends
+func (g *Gateway) connect() error {
+	g.mu.Lock()
+	url := gatewayURL
+	resuming := g.sessionID != "" && g.resumeURL != ""
+	if resuming {
+		url = g.resumeURL + gatewayQuery
+	}
+	g.mu.Unlock()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	g.mu.Lock()
+	g.conn = conn
+	g.acked = true
+	g.mu.Unlock()
+	defer conn.Close()
+
+	// The first message is Hello, with the heartbeat interval
+	var hello struct {
+		HeartbeatInterval int64 `json:"heartbeat_interval"`
+	}
+	payload, err := g.read(conn)
+	if err != nil {
+		return err
+	}
+	if payload.Op != opHello {
+		return fmt.Errorf("expected hello, got opcode %d", payload.Op)
+	}
+	if err := json.Unmarshal(payload.Data, &hello); err != nil {
+		return fmt.Errorf("failed to decode hello: %w", err)
+	}
+
+	if resuming {
+		err = g.sendResume()
+	} else {
+		err = g.sendIdentify()
+	}
+	if err != nil {
+		return err
+	}
+
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+	go g.heartbeat(conn, time.Duration(hello.HeartbeatInterval)*time.Millisecond, heartbeatDone)
+
+	for {
+		payload, err := g.read(conn)
+		if err != nil {
+			return err
+		}
+		if err := g.handle(payload); err != nil {
+			return err
+		}
+	}
+}
+
+// handle processes a gateway message
+func (g *Gateway) handle(payload *gatewayPayload) error {
+	if payload.Seq != nil {
+		g.mu.Lock()
+		g.seq = *payload.Seq
+		g.mu.Unlock()
+	}
+
+	switch payload.Op {
+	case opDispatch:
+		if payload.Type == "READY" {
+			var ready struct {
+				SessionID        string `json:"session_id"`
+				ResumeGatewayURL string `json:"resume_gateway_url"`
+			}
+			if err := json.Unmarshal(payload.Data, &ready); err == nil {
+				g.mu.Lock()
+				g.sessionID = ready.SessionID
+				g.resumeURL = ready.ResumeGatewayURL
+				g.mu.Unlock()
+			}
+		}
+		if g.handler != nil {
+			g.handler(payload.Type, payload.Data)
+		}
+	case opHeartbeat:
+		return g.sendHeartbeat()
+	case opHeartbeatACK:
+		g.mu.Lock()
+		g.acked = true
+		g.mu.Unlock()
+	case opReconnect:
+		return errReconnect
+	case opInvalidSession:
+		// The data is true when the session can still be resumed
+		var resumable bool
+		json.Unmarshal(payload.Data, &resumable)
+		if !resumable {
+			g.mu.Lock()
+			g.sessionID = ""
+			g.resumeURL = ""
+			g.mu.Unlock()
+		}
+		return errReconnect
+	}
+	return nil
+}
+
+// heartbeat sends heartbeats at the interval requested by Discord. If the
+// previous heartbeat was never acknowledged the connection is a zombie and
+// is closed so the gateway reconnects.
+func (g *Gateway) heartbeat(conn *websocket.Conn, interval time.Duration, done chan struct{}) {
+	// The first heartbeat is jittered so clients don't reconnect in lockstep
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(interval))))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			g.mu.Lock()
+			acked := g.acked
+			g.acked = false
+			g.mu.Unlock()
+
+			if !acked {
+				log.Printf("Discord gateway heartbeat was not acknowledged, reconnecting")
+				conn.Close()
+				return
+			}
+			if err := g.sendHeartbeat(); err != nil {
+				conn.Close()
+				return
+			}
+			timer.Reset(interval)
+		case <-done:
+			return
+		}
+	}
+}
+
+func (g *Gateway) sendIdentify() error {
+	return g.send(opIdentify, map[string]interface{}{
+		"token":   g.token,
+		"intents": g.intents,
+		"properties": map[string]string{
+			"os":      runtime.GOOS,
+			"browser": "prism",
+			"device":  "prism",
+		},
+	})
+}
+
+func (g *Gateway) sendResume() error {
+	g.mu.Lock()
+	data := map[string]interface{}{
+		"token":      g.token,
+		"session_id": g.sessionID,
+		"seq":        g.seq,
+	}
+	g.mu.Unlock()
+	return g.send(opResume, data)
+}
+
+func (g *Gateway) sendHeartbeat() error {
+	g.mu.Lock()
+	var seq interface{}
+	if g.seq > 0 {
+		seq = g.seq
+	}
+	g.mu.Unlock()
+	return g.send(opHeartbeat, seq)
+}
+
+// send writes a message to the current connection
+func (g *Gateway) send(op int, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	g.mu.Lock()
+	conn := g.conn
+	g.mu.Unlock()
+
+	g.writeMu.Lock()
+	defer g.writeMu.Unlock()
+	return conn.WriteJSON(&gatewayPayload{Op: op, Data: raw})
+}
+
+func (g *Gateway) read(conn *websocket.Conn) (*gatewayPayload, error) {
+	var payload gatewayPayload
+	if err := conn.ReadJSON(&payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
@@ -0,0 +1,395 @@
+// Package email sends notification emails over SMTP for long-running work
+// such as agent and swarm runs, builds and webhook automations. Which events
+// are emailed is chosen per user in their email preferences.
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+)
+
+const sendTimeout = 30 * time.Second
+
+// EventTest is sent when a user tests their email settings
+const EventTest integrations.EventType = "email.test"
+
+// Account emails carry a single-use token and are sent whatever the user's
+// email preferences
+const (
+	EventPasswordReset integrations.EventType = "account.password_reset"
+	EventEmailChange   integrations.EventType = "account.email_change"
+)
+
+// SupportedEvents lists the event types a user can choose to receive by email
+var SupportedEvents = []integrations.EventType{
+	integrations.EventAgentCompleted,
+	integrations.EventAgentFailed,
+	integrations.EventSwarmCompleted,
+	integrations.EventSwarmFailed,
+	integrations.EventBuildCompleted,
+	integrations.EventBuildFailed,
+	integrations.EventWebhookProcessed,
+	integrations.EventVulnerabilitiesFound,
+	integrations.EventLoginNewDevice,
+	integrations.EventLoginFailures,
+}
+
+// DefaultEvents are emailed when a user enables email without choosing events
+var DefaultEvents = []string{
+	string(integrations.EventAgentCompleted),
+	string(integrations.EventAgentFailed),
+	string(integrations.EventSwarmCompleted),
+	string(integrations.EventSwarmFailed),
+	string(integrations.EventBuildFailed),
+	string(integrations.EventWebhookProcessed),
+	string(integrations.EventLoginNewDevice),
+	string(integrations.EventLoginFailures),
+}
+
+// IsSupportedEvent reports whether an event type can be emailed
+func IsSupportedEvent(eventType string) bool {
+	for _, supported := range SupportedEvents {
+		if string(supported) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Config holds SMTP configuration
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	FromName string
+	// ImplicitTLS connects over TLS from the start (usually port 465)
+	// instead of upgrading with STARTTLS
+	ImplicitTLS bool
+	Enabled     bool
+	// AppURL is linked from emails
+	AppURL string
+}
+
+// Client is an SMTP notification client
+type Client struct {
+	config          *Config
+	integrationRepo *repository.IntegrationRepository
+	userRepo        *repository.UserRepository
+}
+
+// NewClient creates a new email client
+func NewClient(config *Config, integrationRepo *repository.IntegrationRepository, userRepo *repository.UserRepository) *Client {
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	return &Client{
+		config:          config,
+		integrationRepo: integrationRepo,
+		userRepo:        userRepo,
+	}
+}
+
+// Name returns the subscriber name
+func (c *Client) Name() string {
+	return "email"
+}
+
+// Enabled returns whether SMTP is configured
+func (c *Client) Enabled() bool {
+	return c.config.Enabled && c.config.Host != "" && c.config.From != ""
+}
+
+// Handle emails an event to its user if their preferences ask for it
+func (c *Client) Handle(event *integrations.Event) {
+	if !c.Enabled() || event.UserID == "" {
+		return
+	}
+	if !IsSupportedEvent(string(event.Type)) && event.Type != integrations.EventActivityDigest {
+		return
+	}
+
+	prefs, err := c.integrationRepo.GetEmailPreferences(event.UserID)
+	if err != nil {
+		log.Printf("Failed to load email preferences for user %s: %v", event.UserID, err)
+		return
+	}
+	if prefs == nil || !prefs.Enabled || !wants(prefs, event) {
+		return
+	}
+
+	to, err := c.recipient(prefs)
+	if err != nil {
+		log.Printf("Failed to resolve email recipient for user %s: %v", event.UserID, err)
+		return
+	}
+	if to == "" {
+		return
+	}
+
+	if err := c.Send(to, event); err != nil {
+		log.Printf("Failed to send %s email to user %s: %v", event.Type, event.UserID, err)
+	}
+}
+
+// SendTest sends a test email to a user using their current preferences
+func (c *Client) SendTest(userID string) (string, error) {
+	if !c.Enabled() {
+		return "", fmt.Errorf("email is not configured on this server")
+	}
+
+	prefs, err := c.integrationRepo.GetEmailPreferences(userID)
+	if err != nil {
+		return "", err
+	}
+	if prefs == nil {
+		prefs = &repository.EmailPreferences{UserID: userID}
+	}
+
+	to, err := c.recipient(prefs)
+	if err != nil {
+		return "", err
+	}
+	if to == "" {
+		return "", fmt.Errorf("no email address configured")
+	}
+
+	return to, c.Send(to, &integrations.Event{Type: EventTest, UserID: userID})
+}
+
+// SendAccountToken emails a password reset or email change token to an
+// address, with a link to the app that carries it
+func (c *Client) SendAccountToken(to string, eventType integrations.EventType, token string, expiresAt time.Time) error {
+	if !c.Enabled() {
+		return fmt.Errorf("email is not configured on this server")
+	}
+
+	link := ""
+	if c.config.AppURL != "" {
+		path := "/reset-password"
+		if eventType == EventEmailChange {
+			path = "/confirm-email"
+		}
+		link = strings.TrimRight(c.config.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+	}
+
+	msg, err := render(&integrations.Event{
+		Type: eventType,
+		Data: map[string]interface{}{
+			"token":   token,
+			"expires": expiresAt.UTC().Format(time.RFC1123),
+		},
+	}, link)
+	if err != nil {
+		return err
+	}
+
+	body, err := c.buildMessage(to, msg)
+	if err != nil {
+		return err
+	}
+
+	return c.deliver(to, body)
+}
+
+// wants reports whether preferences select an event. Agent and swarm
+// completions shorter than the minimum duration are skipped.
+func wants(prefs *repository.EmailPreferences, event *integrations.Event) bool {
+	// Digests are chosen through their own schedule rather than the event list
+	if event.Type == integrations.EventActivityDigest {
+		return true
+	}
+
+	selected := false
+	for _, e := range prefs.Events {
+		if e == string(event.Type) {
+			selected = true
+			break
+		}
+	}
+	if !selected {
+		return false
+	}
+
+	switch event.Type {
+	case integrations.EventAgentCompleted, integrations.EventSwarmCompleted:
+		if ms, ok := durationData(event); ok && ms < int64(prefs.MinDurationSeconds)*1000 {
+			return false
+		}
+	}
+	return true
+}
+
+// recipient returns the preferred address, falling back to the account email
+func (c *Client) recipient(prefs *repository.EmailPreferences) (string, error) {
+	if prefs.Address != "" {
+		return prefs.Address, nil
+	}
+	user, err := c.userRepo.GetByID(prefs.UserID)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", nil
+	}
+	return user.Email, nil
+}
+
+// Send renders an event and emails it to an address
+func (c *Client) Send(to string, event *integrations.Event) error {
+	msg, err := render(event, c.config.AppURL)
+	if err != nil {
+		return err
+	}
+
+	body, err := c.buildMessage(to, msg)
+	if err != nil {
+		return err
+	}
+
+	return c.deliver(to, body)
+}
+
+// buildMessage assembles a multipart/alternative MIME message
+func (c *Client) buildMessage(to string, msg *message) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	from := c.config.From
+	if c.config.FromName != "" {
+		from = fmt.Sprintf("%s <%s>", mime.QEncoding.Encode("utf-8", c.config.FromName), c.config.From)
+	}
+
+	headers := []string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("utf-8", stripNewlines(msg.Subject)),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + uuid.New().String() + "@prism>",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + writer.Boundary(),
+	}
+
+	var out bytes.Buffer
+	out.WriteString(strings.Join(headers, "\r\n"))
+	out.WriteString("\r\n\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create message part: %w", err)
+		}
+		if _, err := w.Write([]byte(wrapBase64(part.content))); err != nil {
+			return nil, fmt.Errorf("failed to write message part: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close message: %w", err)
+	}
+
+	out.Write(buf.Bytes())
+	return out.Bytes(), nil
+}
+
+// deliver sends a message over SMTP, upgrading to TLS when possible
+func (c *Client) deliver(to string, body []byte) error {
+	addr := net.JoinHostPort(c.config.Host, strconv.Itoa(c.config.Port))
+	tlsConfig := &tls.Config{ServerName: c.config.Host}
+	dialer := &net.Dialer{Timeout: sendTimeout}
+
+	var conn net.Conn
+	var err error
+	if c.config.ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+
+	client, err := smtp.NewClient(conn, c.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if !c.config.ImplicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("failed to start TLS: %w", err)
+			}
+		}
+	}
+
+	if c.config.Username != "" {
+		auth := smtp.PlainAuth("", c.config.Username, c.config.Password, c.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := client.Mail(c.config.From); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("failed to set recipient: %w", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// wrapBase64 encodes content as base64 in 76-character lines
+func wrapBase64(content string) string {
+	encoded := base64.StdEncoding.EncodeToString([]byte(content))
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	return b.String()
+}
+
+func stripNewlines(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
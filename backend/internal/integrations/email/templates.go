@@ -0,0 +1,257 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jacklau/prism/internal/integrations"
+)
+
+// message is the rendered content of a notification email
+type message struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// templateData is passed to the HTML template
+type templateData struct {
+	Title    string
+	Summary  string
+	Status   string // "success", "failure" or "info"; selects the accent color
+	Details  []detail
+	Link     string
+	LinkText string
+	Footer   string
+}
+
+type detail struct {
+	Label string
+	Value string
+}
+
+var htmlTemplate = template.Must(template.New("notification").Parse(`<!DOCTYPE html>
+<html>
+<body style="margin:0;padding:24px;background:#f4f4f5;font-family:-apple-system,BlinkMacSystemFont,'Segoe UI',Helvetica,Arial,sans-serif;color:#18181b;">
+  <table role="presentation" width="100%" cellpadding="0" cellspacing="0" style="max-width:560px;margin:0 auto;background:#ffffff;border-radius:8px;overflow:hidden;">
+    <tr>
+      <td style="height:4px;background:{{if eq .Status "success"}}#16a34a{{else if eq .Status "failure"}}#dc2626{{else}}#6366f1{{end}};"></td>
+    </tr>
+    <tr>
+      <td style="padding:24px;">
+        <h1 style="margin:0 0 8px;font-size:20px;">{{.Title}}</h1>
+        {{if .Summary}}<p style="margin:0 0 16px;font-size:14px;line-height:20px;color:#3f3f46;">{{.Summary}}</p>{{end}}
+        {{if .Details}}
+        <table role="presentation" width="100%" cellpadding="0" cellspacing="0" style="font-size:13px;border-top:1px solid #e4e4e7;">
+          {{range .Details}}
+          <tr>
+            <td style="padding:8px 0;color:#71717a;width:35%;vertical-align:top;">{{.Label}}</td>
+            <td style="padding:8px 0;word-break:break-word;">{{.Value}}</td>
+          </tr>
+          {{end}}
+        </table>
+        {{end}}
+        {{if .Link}}
+        <p style="margin:24px 0 0;">
+          <a href="{{.Link}}" style="display:inline-block;padding:10px 16px;background:#18181b;color:#ffffff;text-decoration:none;border-radius:6px;font-size:14px;">{{.LinkText}}</a>
+        </p>
+        {{end}}
+      </td>
+    </tr>
+  </table>
+  <p style="max-width:560px;margin:16px auto 0;font-size:12px;color:#a1a1aa;text-align:center;">
+    {{.Footer}}
+  </p>
+</body>
+</html>
+`))
+
+// render builds the email for an event
+func render(event *integrations.Event, link string) (*message, error) {
+	data := templateData{
+		Title:    titleFor(event),
+		Status:   statusFor(event),
+		Link:     link,
+		LinkText: "Open Prism",
+		Footer:   "You are receiving this because email notifications are enabled in your Prism integration settings.",
+	}
+	switch event.Type {
+	case EventPasswordReset:
+		data.LinkText = "Reset password"
+		data.Footer = "You are receiving this because a password reset was requested for your Prism account."
+	case EventEmailChange:
+		data.LinkText = "Confirm email"
+		data.Footer = "You are receiving this because this address was entered as the new email of a Prism account."
+	}
+	data.Summary = summaryFor(event)
+	data.Details = detailsFor(event)
+
+	var html bytes.Buffer
+	if err := htmlTemplate.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	var text strings.Builder
+	text.WriteString(data.Title + "\n\n")
+	if data.Summary != "" {
+		text.WriteString(data.Summary + "\n\n")
+	}
+	for _, d := range data.Details {
+		text.WriteString(d.Label + ": " + d.Value + "\n")
+	}
+	if link != "" {
+		text.WriteString("\n" + data.LinkText + ": " + link + "\n")
+	}
+
+	return &message{
+		Subject: "[Prism] " + data.Title,
+		HTML:    html.String(),
+		Text:    text.String(),
+	}, nil
+}
+
+// titleFor returns the email title for an event
+func titleFor(event *integrations.Event) string {
+	switch event.Type {
+	case integrations.EventAgentCompleted:
+		return fmt.Sprintf("Agent %s completed", stringData(event, "agent_name", "run"))
+	case integrations.EventAgentFailed:
+		return fmt.Sprintf("Agent %s failed", stringData(event, "agent_name", "run"))
+	case integrations.EventSwarmCompleted:
+		return "Swarm completed"
+	case integrations.EventSwarmFailed:
+		return "Swarm failed"
+	case integrations.EventBuildCompleted:
+		return "Build succeeded"
+	case integrations.EventBuildFailed:
+		return "Build failed"
+	case integrations.EventWebhookProcessed:
+		if stringData(event, "status", "") == "completed" {
+			return fmt.Sprintf("Webhook automation ran for %s", stringData(event, "repository", "a repository"))
+		}
+		return fmt.Sprintf("Webhook automation failed for %s", stringData(event, "repository", "a repository"))
+	case integrations.EventVulnerabilitiesFound:
+		return "New dependency vulnerabilities found"
+	case integrations.EventActivityDigest:
+		return fmt.Sprintf("Your %s activity digest", stringData(event, "period", "daily"))
+	case integrations.EventLoginNewDevice:
+		return "New sign-in to your account"
+	case integrations.EventLoginFailures:
+		return "Repeated failed sign-ins to your account"
+	case integrations.EventError:
+		return "Error alert"
+	case EventTest:
+		return "Test notification"
+	case EventPasswordReset:
+		return "Reset your password"
+	case EventEmailChange:
+		return "Confirm your new email address"
+	default:
+		return fmt.Sprintf("Event: %s", event.Type)
+	}
+}
+
+// statusFor classifies an event as a success, failure or informational
+func statusFor(event *integrations.Event) string {
+	switch event.Type {
+	case integrations.EventAgentCompleted, integrations.EventSwarmCompleted, integrations.EventBuildCompleted:
+		return "success"
+	case integrations.EventAgentFailed, integrations.EventSwarmFailed, integrations.EventBuildFailed,
+		integrations.EventVulnerabilitiesFound, integrations.EventError, integrations.EventLoginFailures:
+		return "failure"
+	case integrations.EventWebhookProcessed:
+		if stringData(event, "status", "") == "completed" {
+			return "success"
+		}
+		return "failure"
+	default:
+		return "info"
+	}
+}
+
+// summaryFor returns a one-line description of an event
+func summaryFor(event *integrations.Event) string {
+	if errMsg := stringData(event, "error", ""); errMsg != "" {
+		return errMsg
+	}
+	if ms, ok := durationData(event); ok {
+		return "Finished in " + formatDuration(ms) + "."
+	}
+	switch event.Type {
+	case EventTest:
+		return "Email notifications are configured correctly."
+	case EventPasswordReset:
+		return "Someone asked to reset the password of your Prism account. If it was you, use the link or token below to choose a new password. Otherwise you can ignore this email."
+	case EventEmailChange:
+		return "Someone asked to change the email of a Prism account to this address. If it was you, use the link or token below to confirm it. Otherwise you can ignore this email."
+	}
+	return ""
+}
+
+// detailsFor lists an event's data as label/value rows, sorted by label.
+// The error and duration are shown in the summary instead.
+func detailsFor(event *integrations.Event) []detail {
+	var details []detail
+	if event.ConversationID != "" {
+		details = append(details, detail{Label: "Conversation", Value: event.ConversationID})
+	}
+
+	keys := make([]string, 0, len(event.Data))
+	for key := range event.Data {
+		if key == "error" || key == "duration_ms" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := fmt.Sprint(event.Data[key])
+		if value == "" {
+			continue
+		}
+		details = append(details, detail{Label: labelFor(key), Value: value})
+	}
+	return details
+}
+
+// labelFor turns a data key like "agent_name" into "Agent name"
+func labelFor(key string) string {
+	label := strings.ReplaceAll(key, "_", " ")
+	if label == "" {
+		return label
+	}
+	return strings.ToUpper(label[:1]) + label[1:]
+}
+
+func stringData(event *integrations.Event, key, fallback string) string {
+	if s, ok := event.Data[key].(string); ok && s != "" {
+		return s
+	}
+	return fallback
+}
+
+// durationData returns an event's duration_ms, if set
+func durationData(event *integrations.Event) (int64, bool) {
+	switch v := event.Data["duration_ms"].(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func formatDuration(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	if d < time.Second {
+		return d.String()
+	}
+	return d.Round(time.Second).String()
+}
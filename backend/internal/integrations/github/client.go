@@ -0,0 +1,216 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apiBaseURL = "https://api.github.com"
+
+	// maxPullRequestFilePages caps how many pages of changed files are
+	// listed; GitHub returns at most 3000 files for a pull request
+	maxPullRequestFilePages = 30
+)
+
+// ErrInvalidPullRequestURL is returned for URLs that don't point at a pull request
+var ErrInvalidPullRequestURL = errors.New("invalid pull request URL")
+
+// pullRequestURLPattern matches https://github.com/{owner}/{repo}/pull/{number}
+var pullRequestURLPattern = regexp.MustCompile(`^/([A-Za-z0-9_.-]+)/([A-Za-z0-9_.-]+)/pull/(\d+)(/.*)?$`)
+
+// APIError is an unsuccessful response from the GitHub API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("GitHub API error (status %d)", e.StatusCode)
+	}
+	return fmt.Sprintf("GitHub API error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// Client calls the GitHub REST API. Each call takes the token to use, so one
+// client serves every user; an empty token makes an unauthenticated call,
+// which only works for public repositories.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// NewClient creates a new GitHub API client
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		baseURL:    apiBaseURL,
+	}
+}
+
+// ParsePullRequestURL parses a pull request URL such as
+// https://github.com/owner/repo/pull/123 into the repository's full name and
+// the pull request number
+func ParsePullRequestURL(rawURL string) (string, int, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", 0, ErrInvalidPullRequestURL
+	}
+	if host := strings.ToLower(u.Host); host != "github.com" && host != "www.github.com" {
+		return "", 0, ErrInvalidPullRequestURL
+	}
+
+	match := pullRequestURLPattern.FindStringSubmatch(u.Path)
+	if match == nil {
+		return "", 0, ErrInvalidPullRequestURL
+	}
+	number, err := strconv.Atoi(match[3])
+	if err != nil || number <= 0 {
+		return "", 0, ErrInvalidPullRequestURL
+	}
+	return match[1] + "/" + match[2], number, nil
+}
+
+// GetPullRequest fetches a pull request
+func (c *Client) GetPullRequest(token, repoFullName string, number int) (*PullRequest, error) {
+	var pr PullRequest
+	path := fmt.Sprintf("/repos/%s/pulls/%d", repoFullName, number)
+	if err := c.do(http.MethodGet, path, token, nil, &pr); err != nil {
+		return nil, fmt.Errorf("failed to get pull request: %w", err)
+	}
+	return &pr, nil
+}
+
+// ListPullRequestFiles lists the files a pull request changes, with their diffs
+func (c *Client) ListPullRequestFiles(token, repoFullName string, number int) ([]PullRequestFile, error) {
+	var files []PullRequestFile
+	for page := 1; page <= maxPullRequestFilePages; page++ {
+		var batch []PullRequestFile
+		path := fmt.Sprintf("/repos/%s/pulls/%d/files?per_page=100&page=%d", repoFullName, number, page)
+		if err := c.do(http.MethodGet, path, token, nil, &batch); err != nil {
+			return nil, fmt.Errorf("failed to list pull request files: %w", err)
+		}
+		files = append(files, batch...)
+		if len(batch) < 100 {
+			break
+		}
+	}
+	return files, nil
+}
+
+// GetFileContent fetches the raw content of a file at a commit
+func (c *Client) GetFileContent(token, repoFullName, path, ref string) (string, error) {
+	escaped := make([]string, 0, strings.Count(path, "/")+1)
+	for _, segment := range strings.Split(path, "/") {
+		escaped = append(escaped, url.PathEscape(segment))
+	}
+	reqPath := fmt.Sprintf("/repos/%s/contents/%s?ref=%s", repoFullName, strings.Join(escaped, "/"), url.QueryEscape(ref))
+
+	req, err := c.newRequest(http.MethodGet, reqPath, token, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github.raw")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get file content: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get file content: %w", readAPIError(resp))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file content: %w", err)
+	}
+	return string(body), nil
+}
+
+// CreateReview posts a review on a pull request
+func (c *Client) CreateReview(token, repoFullName string, number int, review *ReviewRequest) (*Review, error) {
+	var posted Review
+	path := fmt.Sprintf("/repos/%s/pulls/%d/reviews", repoFullName, number)
+	if err := c.do(http.MethodPost, path, token, review, &posted); err != nil {
+		return nil, fmt.Errorf("failed to create review: %w", err)
+	}
+	return &posted, nil
+}
+
+// newRequest creates a request to the API
+func (c *Client) newRequest(method, path, token string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// do makes a JSON API call and decodes the response into out
+func (c *Client) do(method, path, token string, body, out interface{}) error {
+	req, err := c.newRequest(method, path, token, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return readAPIError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// readAPIError builds an APIError from an unsuccessful response
+func readAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var payload struct {
+		Message string `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		apiErr.Message = payload.Message
+		for _, e := range payload.Errors {
+			if e.Message != "" {
+				apiErr.Message += ": " + e.Message
+			}
+		}
+	}
+	return apiErr
+}
@@ -0,0 +1,91 @@
+package github
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// PullRequestReviewer reviews pull requests in response to events
+type PullRequestReviewer interface {
+	// ReviewPullRequest reviews the pull request of an event on behalf of
+	// the user who configured the webhook
+	ReviewPullRequest(userID string, event *PullRequestEvent, review *AutoReviewConfig) error
+}
+
+// PullRequestProcessor processes GitHub pull request events by running an
+// automatic review when the webhook has one configured
+type PullRequestProcessor struct {
+	reviewer PullRequestReviewer
+}
+
+// NewPullRequestProcessor creates a new pull request processor
+func NewPullRequestProcessor(reviewer PullRequestReviewer) *PullRequestProcessor {
+	return &PullRequestProcessor{
+		reviewer: reviewer,
+	}
+}
+
+// EventType returns the event type this processor handles
+func (p *PullRequestProcessor) EventType() string {
+	return "pull_request"
+}
+
+// Process processes a pull request event
+func (p *PullRequestProcessor) Process(event interface{}, config *WebhookConfig) error {
+	prEvent, ok := event.(*PullRequestEvent)
+	if !ok {
+		return fmt.Errorf("expected PullRequestEvent, got %T", event)
+	}
+	if prEvent.PullRequest == nil {
+		return fmt.Errorf("pull request event has no pull request")
+	}
+
+	review := config.AutoReview
+	if review == nil || !review.Enabled {
+		log.Printf("Auto review disabled for webhook %s", config.ID)
+		return nil
+	}
+	if !p.matches(prEvent, review) {
+		log.Printf("Auto review skipped for action %s on pull request #%d", prEvent.Action, prEvent.PullRequest.Number)
+		return nil
+	}
+
+	log.Printf("Reviewing pull request #%d in %s (%s)", prEvent.PullRequest.Number, config.RepoFullName, prEvent.Action)
+	return p.reviewer.ReviewPullRequest(config.UserID, prEvent, review)
+}
+
+// matches reports whether an auto review applies to an event. Draft pull
+// requests are reviewed once they are marked ready.
+func (p *PullRequestProcessor) matches(event *PullRequestEvent, review *AutoReviewConfig) bool {
+	if event.PullRequest.Draft || event.PullRequest.State == "closed" {
+		return false
+	}
+
+	actions := review.Actions
+	if len(actions) == 0 {
+		actions = DefaultAutoReviewActions
+	}
+	actionMatched := false
+	for _, action := range actions {
+		if action == event.Action {
+			actionMatched = true
+			break
+		}
+	}
+	if !actionMatched {
+		return false
+	}
+
+	if len(review.Labels) == 0 {
+		return true
+	}
+	for _, label := range event.PullRequest.Labels {
+		for _, required := range review.Labels {
+			if strings.EqualFold(label.Name, required) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -109,6 +109,8 @@ type PullRequest struct {
 	User      *User      `json:"user"`
 	Head      *Branch    `json:"head"`
 	Base      *Branch    `json:"base"`
+	Labels    []Label    `json:"labels"`
+	Draft     bool       `json:"draft"`
 	Merged    bool       `json:"merged"`
 	MergedBy  *User      `json:"merged_by"`
 	CreatedAt time.Time  `json:"created_at"`
@@ -166,6 +168,7 @@ type WebhookConfig struct {
 	Events          []string          `json:"events"`
 	AutoRunEnabled  bool              `json:"auto_run_enabled"`
 	AutoRunTriggers []AutoRunTrigger  `json:"auto_run_triggers"`
+	AutoReview      *AutoReviewConfig `json:"auto_review,omitempty"`
 	CreatedAt       time.Time         `json:"created_at"`
 	UpdatedAt       time.Time         `json:"updated_at"`
 }
@@ -181,17 +184,78 @@ type AutoRunTrigger struct {
 	EnvVars     map[string]string `json:"env_vars"`    // Environment variables
 }
 
+// AutoReviewConfig defines when to automatically review pull requests
+type AutoReviewConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Actions  []string `json:"actions,omitempty"`  // Defaults to DefaultAutoReviewActions
+	Labels   []string `json:"labels,omitempty"`   // Filter by labels (optional)
+	Post     bool     `json:"post"`               // Post the findings to the pull request as a review
+	Provider string   `json:"provider,omitempty"` // Optional, defaults to the server's review model
+	Model    string   `json:"model,omitempty"`
+}
+
+// DefaultAutoReviewActions are the pull request actions reviewed when an
+// auto review doesn't list any: new pull requests and new commits
+var DefaultAutoReviewActions = []string{"opened", "reopened", "synchronize", "ready_for_review"}
+
+// PullRequestFile is a file changed by a pull request
+type PullRequestFile struct {
+	Filename         string `json:"filename"`
+	Status           string `json:"status"` // added, removed, modified, renamed, copied, changed or unchanged
+	Additions        int    `json:"additions"`
+	Deletions        int    `json:"deletions"`
+	Changes          int    `json:"changes"`
+	Patch            string `json:"patch"` // Unified diff hunks; empty for binary or very large diffs
+	PreviousFilename string `json:"previous_filename,omitempty"`
+}
+
+// ReviewComment is an inline comment on a line of a pull request's diff
+type ReviewComment struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Side string `json:"side"` // RIGHT for the new version of the file
+	Body string `json:"body"`
+}
+
+// ReviewRequest is a pull request review to post
+type ReviewRequest struct {
+	CommitID string          `json:"commit_id,omitempty"`
+	Body     string          `json:"body"`
+	Event    string          `json:"event"` // COMMENT, APPROVE or REQUEST_CHANGES
+	Comments []ReviewComment `json:"comments,omitempty"`
+}
+
+// Review is a posted pull request review
+type Review struct {
+	ID      int64  `json:"id"`
+	HTMLURL string `json:"html_url"`
+	State   string `json:"state"`
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryStatusPending    = "pending"
+	DeliveryStatusProcessing = "processing"
+	DeliveryStatusCompleted  = "completed"
+	DeliveryStatusFailed     = "failed"      // Failed, retry scheduled
+	DeliveryStatusDeadLetter = "dead_letter" // Out of retries, needs manual redelivery
+	DeliveryStatusSkipped    = "skipped"     // No processor for the event
+)
+
 // WebhookDelivery represents a record of a webhook delivery
 type WebhookDelivery struct {
-	ID            string                 `json:"id"`
-	WebhookID     string                 `json:"webhook_id"`
-	Event         string                 `json:"event"`
-	Action        string                 `json:"action"`
-	Payload       map[string]interface{} `json:"payload"`
-	Status        string                 `json:"status"` // "pending", "processing", "completed", "failed"
-	ErrorMessage  string                 `json:"error_message,omitempty"`
-	ProcessedAt   *time.Time             `json:"processed_at"`
-	CreatedAt     time.Time              `json:"created_at"`
+	ID               string                 `json:"id"`
+	WebhookID        string                 `json:"webhook_id"`
+	GitHubDeliveryID string                 `json:"github_delivery_id,omitempty"`
+	Event            string                 `json:"event"`
+	Action           string                 `json:"action"`
+	Payload          map[string]interface{} `json:"payload"`
+	Status           string                 `json:"status"`
+	ErrorMessage     string                 `json:"error_message,omitempty"`
+	Attempts         int                    `json:"attempts"`
+	NextAttemptAt    *time.Time             `json:"next_attempt_at,omitempty"`
+	ProcessedAt      *time.Time             `json:"processed_at"`
+	CreatedAt        time.Time              `json:"created_at"`
 }
 
 // CodeExecutionResult represents the result of an automatic code execution
@@ -39,6 +39,19 @@ func (h *WebhookHandler) RegisterProcessor(processor EventProcessor) {
 	h.processors[processor.EventType()] = processor
 }
 
+// NewDefaultWebhookHandler creates a webhook handler with the built-in
+// issue and issue comment processors registered, and the pull request
+// processor if a reviewer is given
+func NewDefaultWebhookHandler(runner CodeRunner, reviewer PullRequestReviewer) *WebhookHandler {
+	handler := NewWebhookHandler()
+	handler.RegisterProcessor(NewIssueProcessor(runner))
+	handler.RegisterProcessor(NewIssueCommentProcessor(runner))
+	if reviewer != nil {
+		handler.RegisterProcessor(NewPullRequestProcessor(reviewer))
+	}
+	return handler
+}
+
 // VerifySignature verifies the GitHub webhook signature
 func VerifySignature(payload []byte, signature, secret string) error {
 	if signature == "" {
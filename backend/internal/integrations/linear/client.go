@@ -0,0 +1,283 @@
+// Package linear is a client for the Linear GraphQL API and its webhooks.
+// Requests are made with a user's personal API key.
+package linear
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	apiURL = "https://api.linear.app/graphql"
+
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+// ErrUnauthorized is returned when Linear rejects an API key
+var ErrUnauthorized = errors.New("linear rejected the API key")
+
+// APIError is an error returned by the Linear API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("linear API returned status %d: %s", e.StatusCode, e.Message)
+	}
+	return "linear API error: " + e.Message
+}
+
+// Viewer is the Linear user an API key belongs to
+type Viewer struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Organization struct {
+		Name   string `json:"name"`
+		URLKey string `json:"urlKey"`
+	} `json:"organization"`
+}
+
+// Issue is a Linear issue
+type Issue struct {
+	ID          string    `json:"id"`
+	Identifier  string    `json:"identifier"` // e.g. "ENG-123"
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	URL         string    `json:"url"`
+	Priority    int       `json:"priority"` // 0 none, 1 urgent ... 4 low
+	State       *State    `json:"state,omitempty"`
+	Team        *Team     `json:"team,omitempty"`
+	Assignee    *User     `json:"assignee,omitempty"`
+	Labels      []Label   `json:"labels,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// State is an issue's workflow state
+type State struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"` // backlog, unstarted, started, completed, canceled
+}
+
+// Team is a Linear team
+type Team struct {
+	ID   string `json:"id"`
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// User is a Linear user
+type User struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Label is an issue label
+type Label struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// SearchOptions narrows an issue search
+type SearchOptions struct {
+	Team  string // Team key, e.g. "ENG"
+	State string // Workflow state name, e.g. "In Progress"
+	Limit int
+}
+
+// Client is a Linear API client
+type Client struct {
+	httpClient *http.Client
+	endpoint   string
+}
+
+// NewClient creates a new Linear client
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+		endpoint: apiURL,
+	}
+}
+
+// Viewer returns the user an API key belongs to, which also checks the key
+func (c *Client) Viewer(apiKey string) (*Viewer, error) {
+	var data struct {
+		Viewer Viewer `json:"viewer"`
+	}
+	err := c.query(apiKey, `query { viewer { id name email organization { name urlKey } } }`, nil, &data)
+	if err != nil {
+		return nil, err
+	}
+	return &data.Viewer, nil
+}
+
+// issueFields are the fields fetched for each issue
+const issueFields = `id identifier title description url priority updatedAt
+	state { id name type }
+	team { id key name }
+	assignee { id name }
+	labels { nodes { id name } }`
+
+// issueNode is an issue as returned by the API, with labels in a connection
+type issueNode struct {
+	Issue
+	Labels struct {
+		Nodes []Label `json:"nodes"`
+	} `json:"labels"`
+}
+
+// SearchIssues finds issues matching a search term, most relevant first
+func (c *Client) SearchIssues(apiKey, term string, opts SearchOptions) ([]Issue, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	filter := map[string]interface{}{}
+	if opts.Team != "" {
+		filter["team"] = map[string]interface{}{"key": map[string]string{"eqIgnoreCase": opts.Team}}
+	}
+	if opts.State != "" {
+		filter["state"] = map[string]interface{}{"name": map[string]string{"eqIgnoreCase": opts.State}}
+	}
+
+	var data struct {
+		SearchIssues struct {
+			Nodes []issueNode `json:"nodes"`
+		} `json:"searchIssues"`
+	}
+	query := `query SearchIssues($term: String!, $first: Int, $filter: IssueFilter) {
+		searchIssues(term: $term, first: $first, filter: $filter) { nodes { ` + issueFields + ` } }
+	}`
+	err := c.query(apiKey, query, map[string]interface{}{
+		"term":   term,
+		"first":  limit,
+		"filter": filter,
+	}, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make([]Issue, 0, len(data.SearchIssues.Nodes))
+	for _, node := range data.SearchIssues.Nodes {
+		issue := node.Issue
+		issue.Labels = node.Labels.Nodes
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// CreateComment adds a markdown comment to an issue and returns its URL
+func (c *Client) CreateComment(apiKey, issueID, body string) (string, error) {
+	var data struct {
+		CommentCreate struct {
+			Success bool `json:"success"`
+			Comment struct {
+				URL string `json:"url"`
+			} `json:"comment"`
+		} `json:"commentCreate"`
+	}
+	query := `mutation CreateComment($issueId: String!, $body: String!) {
+		commentCreate(input: { issueId: $issueId, body: $body }) { success comment { url } }
+	}`
+	err := c.query(apiKey, query, map[string]interface{}{
+		"issueId": issueID,
+		"body":    body,
+	}, &data)
+	if err != nil {
+		return "", err
+	}
+	if !data.CommentCreate.Success {
+		return "", &APIError{Message: "comment was not created"}
+	}
+	return data.CommentCreate.Comment.URL, nil
+}
+
+// query runs a GraphQL query and decodes its data into out
+func (c *Client) query(apiKey, query string, variables map[string]interface{}, out interface{}) error {
+	if apiKey == "" {
+		return ErrUnauthorized
+	}
+
+	jsonPayload, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.endpoint, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Personal API keys are sent as is, without a Bearer prefix
+	req.Header.Set("Authorization", apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message    string `json:"message"`
+			Extensions struct {
+				Code string `json:"code"`
+			} `json:"extensions"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+		}
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	if len(result.Errors) > 0 {
+		for _, e := range result.Errors {
+			if e.Extensions.Code == "AUTHENTICATION_ERROR" {
+				return ErrUnauthorized
+			}
+		}
+		messages := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: strings.Join(messages, "; ")}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	}
+
+	if err := json.Unmarshal(result.Data, out); err != nil {
+		return fmt.Errorf("failed to decode response data: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package linear
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxWebhookAge is how old a webhook may be before it is rejected as a replay
+const maxWebhookAge = time.Minute
+
+// maxTriggers caps the automation triggers a user can configure
+const maxTriggers = 20
+
+// Webhook actions that can start a trigger
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+)
+
+var (
+	// ErrInvalidSignature is returned when a webhook's signature does not match
+	ErrInvalidSignature = errors.New("invalid linear signature")
+
+	// ErrStaleRequest is returned when a webhook's timestamp is too old
+	ErrStaleRequest = errors.New("linear webhook timestamp is too old")
+
+	// ErrInvalidPayload is returned when a webhook body can't be parsed
+	ErrInvalidPayload = errors.New("invalid linear webhook payload")
+)
+
+// VerifySignature checks a webhook against its signing secret, using the
+// Linear-Signature header (hex HMAC-SHA256 of the raw body) and the
+// webhookTimestamp in the body
+func VerifySignature(secret, signature string, body []byte, now time.Time) error {
+	if secret == "" || signature == "" {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return ErrInvalidSignature
+	}
+
+	var payload struct {
+		WebhookTimestamp int64 `json:"webhookTimestamp"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.WebhookTimestamp == 0 {
+		return ErrInvalidSignature
+	}
+	age := now.Sub(time.UnixMilli(payload.WebhookTimestamp))
+	if age > maxWebhookAge || age < -maxWebhookAge {
+		return ErrStaleRequest
+	}
+	return nil
+}
+
+// WebhookPayload is the body of a Linear webhook
+type WebhookPayload struct {
+	Action           string          `json:"action"` // create, update or remove
+	Type             string          `json:"type"`   // e.g. "Issue", "Comment"
+	Data             json.RawMessage `json:"data"`
+	URL              string          `json:"url"`
+	UpdatedFrom      json.RawMessage `json:"updatedFrom,omitempty"` // Previous values of changed fields
+	WebhookTimestamp int64           `json:"webhookTimestamp"`
+}
+
+// IssueEvent is an issue webhook
+type IssueEvent struct {
+	Action string
+	Issue  IssueData
+	URL    string
+	// Changed holds the previous values of the fields the update changed
+	Changed map[string]json.RawMessage
+}
+
+// IssueData is an issue as sent in webhooks
+type IssueData struct {
+	ID          string   `json:"id"`
+	Identifier  string   `json:"identifier"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Priority    int      `json:"priority"`
+	URL         string   `json:"url"`
+	State       *State   `json:"state"`
+	Team        *Team    `json:"team"`
+	Assignee    *User    `json:"assignee"`
+	Labels      []Label  `json:"labels"`
+	LabelIDs    []string `json:"labelIds"`
+}
+
+// ParseIssueEvent parses a webhook body, returning nil for webhooks that
+// aren't about issues
+func ParseIssueEvent(body []byte) (*IssueEvent, error) {
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if payload.Type != "Issue" {
+		return nil, nil
+	}
+
+	event := &IssueEvent{Action: payload.Action, URL: payload.URL}
+	if err := json.Unmarshal(payload.Data, &event.Issue); err != nil {
+		return nil, fmt.Errorf("%w: issue: %v", ErrInvalidPayload, err)
+	}
+	if event.URL == "" {
+		event.URL = event.Issue.URL
+	}
+	if len(payload.UpdatedFrom) > 0 {
+		if err := json.Unmarshal(payload.UpdatedFrom, &event.Changed); err != nil {
+			return nil, fmt.Errorf("%w: updatedFrom: %v", ErrInvalidPayload, err)
+		}
+	}
+	return event, nil
+}
+
+// Trigger runs an agent when an issue event matches it. Filters are
+// case-insensitive and empty filters match everything.
+type Trigger struct {
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"` // create, update; empty matches both
+	Teams   []string `json:"teams"`   // Team keys, e.g. "ENG"
+	Labels  []string `json:"labels"`  // Matches issues with any of these labels
+	States  []string `json:"states"`  // Workflow state names, e.g. "Todo"
+	Prompt  string   `json:"prompt"`  // What the agent should do with the issue
+	Comment bool     `json:"comment"` // Post the agent's output as an issue comment
+}
+
+// ValidateTriggers checks a list of triggers before they are saved
+func ValidateTriggers(triggers []Trigger) error {
+	if len(triggers) > maxTriggers {
+		return fmt.Errorf("at most %d triggers can be configured", maxTriggers)
+	}
+	names := make(map[string]bool)
+	for i, trigger := range triggers {
+		name := strings.TrimSpace(trigger.Name)
+		if name == "" {
+			return fmt.Errorf("trigger %d has no name", i+1)
+		}
+		if names[strings.ToLower(name)] {
+			return fmt.Errorf("trigger name %q is used more than once", name)
+		}
+		names[strings.ToLower(name)] = true
+		if strings.TrimSpace(trigger.Prompt) == "" {
+			return fmt.Errorf("trigger %q has no prompt", name)
+		}
+		if len(trigger.Prompt) > 8000 {
+			return fmt.Errorf("trigger %q has a prompt longer than 8000 characters", name)
+		}
+		for _, action := range trigger.Actions {
+			if action != ActionCreate && action != ActionUpdate {
+				return fmt.Errorf("trigger %q has unsupported action %q (use create or update)", name, action)
+			}
+		}
+	}
+	return nil
+}
+
+// Matches reports whether an issue event should start the trigger. Updates
+// only start triggers with a state or label filter when the update moved the
+// issue into a matching state or added a matching label, so editing an issue
+// that already matches doesn't run the agent again.
+func (t *Trigger) Matches(event *IssueEvent) bool {
+	if event.Action != ActionCreate && event.Action != ActionUpdate {
+		return false
+	}
+	if len(t.Actions) > 0 && !containsFold(t.Actions, event.Action) {
+		return false
+	}
+
+	issue := &event.Issue
+	if len(t.Teams) > 0 && (issue.Team == nil || !containsFold(t.Teams, issue.Team.Key)) {
+		return false
+	}
+	if len(t.States) > 0 && (issue.State == nil || !containsFold(t.States, issue.State.Name)) {
+		return false
+	}
+	if len(t.Labels) > 0 && len(matchingLabels(issue.Labels, t.Labels)) == 0 {
+		return false
+	}
+
+	if event.Action == ActionUpdate {
+		if len(t.States) > 0 {
+			if _, changed := event.Changed["stateId"]; !changed {
+				return false
+			}
+		}
+		if len(t.Labels) > 0 && !addedMatchingLabel(event, t.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// addedMatchingLabel reports whether an update added one of the labels
+func addedMatchingLabel(event *IssueEvent, labels []string) bool {
+	raw, changed := event.Changed["labelIds"]
+	if !changed {
+		return false
+	}
+	var previous []string
+	if err := json.Unmarshal(raw, &previous); err != nil {
+		return false
+	}
+	had := make(map[string]bool, len(previous))
+	for _, id := range previous {
+		had[id] = true
+	}
+	for _, label := range matchingLabels(event.Issue.Labels, labels) {
+		if !had[label.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchingLabels returns the issue labels named in names
+func matchingLabels(issueLabels []Label, names []string) []Label {
+	var matching []Label
+	for _, label := range issueLabels {
+		if containsFold(names, label.Name) {
+			matching = append(matching, label)
+		}
+	}
+	return matching
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
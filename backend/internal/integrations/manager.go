@@ -1,27 +1,49 @@
 package integrations
 
 import (
+	"errors"
 	"log"
 	"sync"
+	"time"
 )
 
 // EventType represents the type of event
 type EventType string
 
 const (
-	EventConversationCreated EventType = "conversation.created"
-	EventMessageSent         EventType = "message.sent"
-	EventChatCompleted       EventType = "chat.completed"
-	EventChatStopped         EventType = "chat.stopped"
-	EventToolStarted         EventType = "tool.started"
-	EventToolCompleted       EventType = "tool.completed"
-	EventToolApproved        EventType = "tool.approved"
-	EventToolRejected        EventType = "tool.rejected"
-	EventError               EventType = "error"
-	EventUserLogin           EventType = "user.login"
-	EventUserRegister        EventType = "user.register"
+	EventConversationCreated    EventType = "conversation.created"
+	EventMessageSent            EventType = "message.sent"
+	EventChatCompleted          EventType = "chat.completed"
+	EventChatStopped            EventType = "chat.stopped"
+	EventToolStarted            EventType = "tool.started"
+	EventToolCompleted          EventType = "tool.completed"
+	EventToolApproved           EventType = "tool.approved"
+	EventToolRejected           EventType = "tool.rejected"
+	EventError                  EventType = "error"
+	EventUserLogin              EventType = "user.login"
+	EventUserRegister           EventType = "user.register"
+	EventVulnerabilitiesFound   EventType = "dependency_audit.vulnerabilities_found"
+	EventAgentCompleted         EventType = "agent.completed"
+	EventAgentFailed            EventType = "agent.failed"
+	EventBuildCompleted         EventType = "build.completed"
+	EventBuildFailed            EventType = "build.failed"
+	EventToolExecuted           EventType = "tool.executed"
+	EventSwarmCompleted         EventType = "swarm.completed"
+	EventSwarmFailed            EventType = "swarm.failed"
+	EventWebhookProcessed       EventType = "github_webhook.processed"
+	EventRateLimited            EventType = "rate_limit.exceeded"
+	EventMessageFeedback        EventType = "message.feedback"
+	EventConversationSummarized EventType = "conversation.summarized"
+	EventActivityDigest         EventType = "activity.digest"
+	EventIntegrationTest        EventType = "integration.test"
+	EventLoginNewDevice         EventType = "auth.new_device"
+	EventLoginFailures          EventType = "auth.login_failures"
 )
 
+// ErrProviderNotConfigured is returned by SendTest when no enabled provider
+// has the given name
+var ErrProviderNotConfigured = errors.New("integration is not configured")
+
 // Event represents an event to be tracked or notified
 type Event struct {
 	Type           EventType              `json:"type"`
@@ -47,11 +69,48 @@ type AnalyticsProvider interface {
 	Close() error
 }
 
+// EventSubscriber receives every event passed to the manager, whether it
+// was tracked, notified or both, exactly once
+type EventSubscriber interface {
+	Name() string
+	Handle(event *Event)
+}
+
+// NotificationFilter reports whether a user wants to be notified of an event type
+type NotificationFilter func(userID string, eventType EventType) bool
+
+// UserIntegrations are the integrations a user has configured for themselves
+type UserIntegrations struct {
+	// Notifications receive the user's events in addition to the server's
+	// notification providers
+	Notifications []NotificationProvider
+	// DisabledAnalytics names the server's analytics providers the user has
+	// opted out of
+	DisabledAnalytics []string
+}
+
+// UserIntegrationsLoader loads a user's integrations from their settings. It
+// returns nil if the user hasn't configured any.
+type UserIntegrationsLoader func(userID string) (*UserIntegrations, error)
+
+// cachedUserIntegrations is a user's loaded integrations and when they were loaded
+type cachedUserIntegrations struct {
+	integrations *UserIntegrations
+	loadedAt     time.Time
+}
+
 // Manager manages all integrations
 type Manager struct {
 	notifications []NotificationProvider
 	analytics     []AnalyticsProvider
+	subscribers   []EventSubscriber
+	filter        NotificationFilter
 	mu            sync.RWMutex
+
+	userLoader   UserIntegrationsLoader
+	userCacheTTL time.Duration
+	userCache    map[string]*cachedUserIntegrations
+	userMu       sync.Mutex
 }
 
 // NewManager creates a new integrations manager
@@ -59,6 +118,8 @@ func NewManager() *Manager {
 	return &Manager{
 		notifications: make([]NotificationProvider, 0),
 		analytics:     make([]AnalyticsProvider, 0),
+		subscribers:   make([]EventSubscriber, 0),
+		userCache:     make(map[string]*cachedUserIntegrations),
 	}
 }
 
@@ -78,12 +139,107 @@ func (m *Manager) RegisterAnalytics(provider AnalyticsProvider) {
 	log.Printf("Registered analytics provider: %s (enabled: %v)", provider.Name(), provider.Enabled())
 }
 
+// RegisterSubscriber registers an event subscriber
+func (m *Manager) RegisterSubscriber(subscriber EventSubscriber) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribers = append(m.subscribers, subscriber)
+	log.Printf("Registered event subscriber: %s", subscriber.Name())
+}
+
+// SetNotificationFilter skips notifications for events a user has opted out
+// of. Tracking and subscribers still receive every event.
+func (m *Manager) SetNotificationFilter(filter NotificationFilter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.filter = filter
+}
+
+// SetUserIntegrationsLoader resolves each user's own integrations when their
+// events are sent. Loaded integrations are cached for ttl, or until
+// InvalidateUser is called after the user changes their settings.
+func (m *Manager) SetUserIntegrationsLoader(loader UserIntegrationsLoader, ttl time.Duration) {
+	m.userMu.Lock()
+	defer m.userMu.Unlock()
+	m.userLoader = loader
+	m.userCacheTTL = ttl
+	m.userCache = make(map[string]*cachedUserIntegrations)
+}
+
+// InvalidateUser drops a user's cached integrations so that their next event
+// uses their current settings
+func (m *Manager) InvalidateUser(userID string) {
+	m.userMu.Lock()
+	defer m.userMu.Unlock()
+	delete(m.userCache, userID)
+}
+
+// userIntegrations returns a user's integrations, loading them if they
+// aren't cached. Load errors are logged and treated as no integrations.
+func (m *Manager) userIntegrations(userID string) *UserIntegrations {
+	if userID == "" {
+		return nil
+	}
+
+	m.userMu.Lock()
+	loader := m.userLoader
+	if cached, ok := m.userCache[userID]; ok && time.Since(cached.loadedAt) < m.userCacheTTL {
+		m.userMu.Unlock()
+		return cached.integrations
+	}
+	m.userMu.Unlock()
+	if loader == nil {
+		return nil
+	}
+
+	loaded, err := loader(userID)
+	if err != nil {
+		log.Printf("Failed to load integrations of user %s: %v", userID, err)
+		return nil
+	}
+
+	m.userMu.Lock()
+	m.userCache[userID] = &cachedUserIntegrations{
+		integrations: loaded,
+		loadedAt:     time.Now(),
+	}
+	m.userMu.Unlock()
+	return loaded
+}
+
 // Notify sends a notification to all enabled providers
 func (m *Manager) Notify(event *Event) {
+	m.notify(event)
+	m.publish(event)
+}
+
+// Track sends an event to all enabled analytics providers
+func (m *Manager) Track(event *Event) {
+	m.track(event)
+	m.publish(event)
+}
+
+// TrackAndNotify tracks an event and sends notifications
+func (m *Manager) TrackAndNotify(event *Event) {
+	m.track(event)
+	m.notify(event)
+	m.publish(event)
+}
+
+func (m *Manager) notify(event *Event) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	for _, provider := range m.notifications {
+	if m.filter != nil && event.UserID != "" && !m.filter(event.UserID, event.Type) {
+		return
+	}
+
+	providers := m.notifications
+	if user := m.userIntegrations(event.UserID); user != nil && len(user.Notifications) > 0 {
+		providers = append(append(make([]NotificationProvider, 0, len(providers)+len(user.Notifications)), providers...), user.Notifications...)
+	}
+
+	for _, provider := range providers {
 		if provider.Enabled() {
 			go func(p NotificationProvider) {
 				if err := p.Send(event); err != nil {
@@ -94,13 +250,19 @@ func (m *Manager) Notify(event *Event) {
 	}
 }
 
-// Track sends an event to all enabled analytics providers
-func (m *Manager) Track(event *Event) {
+func (m *Manager) track(event *Event) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	disabled := make(map[string]bool)
+	if user := m.userIntegrations(event.UserID); user != nil {
+		for _, name := range user.DisabledAnalytics {
+			disabled[name] = true
+		}
+	}
+
 	for _, provider := range m.analytics {
-		if provider.Enabled() {
+		if provider.Enabled() && !disabled[provider.Name()] {
 			go func(p AnalyticsProvider) {
 				if err := p.Track(event); err != nil {
 					log.Printf("Failed to track event via %s: %v", p.Name(), err)
@@ -110,10 +272,14 @@ func (m *Manager) Track(event *Event) {
 	}
 }
 
-// TrackAndNotify tracks an event and sends notifications
-func (m *Manager) TrackAndNotify(event *Event) {
-	m.Track(event)
-	m.Notify(event)
+// publish hands an event to every subscriber
+func (m *Manager) publish(event *Event) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, subscriber := range m.subscribers {
+		go subscriber.Handle(event)
+	}
 }
 
 // TrackMessageSent is a convenience method for tracking message sent events
@@ -139,6 +305,119 @@ func (m *Manager) TrackChatCompleted(userID, conversationID, messageID, finishRe
 	})
 }
 
+// TrackToolExecuted is a convenience method for tracking a finished tool execution
+func (m *Manager) TrackToolExecuted(userID, conversationID, executionID, toolName, status string) {
+	m.Track(&Event{
+		Type:           EventToolExecuted,
+		UserID:         userID,
+		ConversationID: conversationID,
+		Data: map[string]interface{}{
+			"execution_id": executionID,
+			"tool_name":    toolName,
+			"status":       status,
+		},
+	})
+}
+
+// TrackAgentFinished is a convenience method for tracking a sub-agent that
+// completed or failed. conversationID is the conversation the run continued,
+// if any.
+func (m *Manager) TrackAgentFinished(userID, conversationID, agentID, agentName string, failed bool, errMsg string, durationMs int64) {
+	event := &Event{
+		Type:           EventAgentCompleted,
+		UserID:         userID,
+		ConversationID: conversationID,
+		Data: map[string]interface{}{
+			"agent_id":    agentID,
+			"agent_name":  agentName,
+			"duration_ms": durationMs,
+		},
+	}
+	if failed {
+		event.Type = EventAgentFailed
+		event.Data["error"] = errMsg
+	}
+	m.TrackAndNotify(event)
+}
+
+// TrackSwarmFinished is a convenience method for tracking a multi-agent swarm
+// that completed or failed
+func (m *Manager) TrackSwarmFinished(userID, swarmID, strategy string, agentCount int, failed bool, errMsg string, durationMs int64) {
+	event := &Event{
+		Type:   EventSwarmCompleted,
+		UserID: userID,
+		Data: map[string]interface{}{
+			"swarm_id":    swarmID,
+			"strategy":    strategy,
+			"agent_count": agentCount,
+			"duration_ms": durationMs,
+		},
+	}
+	if failed {
+		event.Type = EventSwarmFailed
+		event.Data["error"] = errMsg
+	}
+	m.TrackAndNotify(event)
+}
+
+// TrackWebhookProcessed is a convenience method for tracking the final
+// outcome of a GitHub webhook automation delivery
+func (m *Manager) TrackWebhookProcessed(userID, deliveryID, repoFullName, githubEvent, status, errMsg string) {
+	data := map[string]interface{}{
+		"delivery_id": deliveryID,
+		"repository":  repoFullName,
+		"event":       githubEvent,
+		"status":      status,
+	}
+	if errMsg != "" {
+		data["error"] = errMsg
+	}
+	m.Track(&Event{
+		Type:   EventWebhookProcessed,
+		UserID: userID,
+		Data:   data,
+	})
+}
+
+// TrackBuildFinished is a convenience method for tracking a build that
+// succeeded or failed. conversationID is the conversation it was started
+// from, if any.
+func (m *Manager) TrackBuildFinished(userID, conversationID, buildID, command string, success bool, errMsg string, durationMs int64) {
+	event := &Event{
+		Type:           EventBuildCompleted,
+		UserID:         userID,
+		ConversationID: conversationID,
+		Data: map[string]interface{}{
+			"build_id":    buildID,
+			"command":     command,
+			"duration_ms": durationMs,
+		},
+	}
+	if !success {
+		event.Type = EventBuildFailed
+		event.Data["error"] = errMsg
+	}
+	m.TrackAndNotify(event)
+}
+
+// TrackMessageFeedback is a convenience method for tracking a user's rating
+// of an assistant message. The comment itself is not sent.
+func (m *Manager) TrackMessageFeedback(userID, conversationID, messageID, provider, model, rating string, tools []string, hasComment bool) {
+	m.Track(&Event{
+		Type:           EventMessageFeedback,
+		UserID:         userID,
+		ConversationID: conversationID,
+		MessageID:      messageID,
+		Data: map[string]interface{}{
+			"provider":    provider,
+			"model":       model,
+			"rating":      rating,
+			"tools":       tools,
+			"has_comment": hasComment,
+		},
+	})
+}
+
 // TrackError is a convenience method for tracking error events
 func (m *Manager) TrackError(userID, conversationID, code, message string) {
 	m.TrackAndNotify(&Event{
@@ -152,6 +431,29 @@ func (m *Manager) TrackError(userID, conversationID, code, message string) {
 	})
 }
 
+// SendTest sends an event through the named provider right away and returns
+// its delivery error, instead of logging it. Analytics providers are flushed
+// so that the event is delivered before it returns.
+func (m *Manager) SendTest(name string, event *Event) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, provider := range m.notifications {
+		if provider.Name() == name && provider.Enabled() {
+			return provider.Send(event)
+		}
+	}
+	for _, provider := range m.analytics {
+		if provider.Name() == name && provider.Enabled() {
+			if err := provider.Track(event); err != nil {
+				return err
+			}
+			return provider.Flush()
+		}
+	}
+	return ErrProviderNotConfigured
+}
+
 // Flush flushes all analytics providers
 func (m *Manager) Flush() error {
 	m.mu.RLock()
@@ -0,0 +1,178 @@
+package matrix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/integrations"
+)
+
+// Config holds Matrix integration configuration
+type Config struct {
+	HomeserverURL string // e.g. https://matrix.example.com
+	AccessToken   string // access token of the bot user that posts notifications
+	RoomID        string // e.g. !abc123:example.com; the bot must have joined the room
+	Enabled       bool
+}
+
+// Client is a Matrix notification client
+type Client struct {
+	config     *Config
+	httpClient *http.Client
+}
+
+// NewClient creates a new Matrix client
+func NewClient(config *Config) *Client {
+	return &Client{
+		config: config,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Name returns the provider name
+func (c *Client) Name() string {
+	return "matrix"
+}
+
+// Enabled returns whether the provider is enabled
+func (c *Client) Enabled() bool {
+	return c.config.Enabled && c.config.HomeserverURL != "" && c.config.AccessToken != "" && c.config.RoomID != ""
+}
+
+// Send sends a notification to a Matrix room
+func (c *Client) Send(event *integrations.Event) error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	// m.notice marks the message as sent by a bot, so other bots ignore it
+	payload := map[string]interface{}{
+		"msgtype":        "m.notice",
+		"body":           c.buildText(event),
+		"format":         "org.matrix.custom.html",
+		"formatted_body": c.buildHTML(event),
+	}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	// The transaction ID makes the send idempotent if the request is retried
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(c.config.HomeserverURL, "/"),
+		url.PathEscape(c.config.RoomID),
+		url.PathEscape(uuid.New().String()),
+	)
+
+	req, err := http.NewRequest("PUT", endpoint, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("matrix homeserver returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// buildText builds the plain text message body
+func (c *Client) buildText(event *integrations.Event) string {
+	var b strings.Builder
+	b.WriteString(c.getHeaderText(event))
+	for _, field := range fields(event) {
+		b.WriteString(fmt.Sprintf("\n%s: %s", field[0], field[1]))
+	}
+	return b.String()
+}
+
+// buildHTML builds the HTML message body
+func (c *Client) buildHTML(event *integrations.Event) string {
+	var b strings.Builder
+	b.WriteString("<strong>" + html.EscapeString(c.getHeaderText(event)) + "</strong>")
+	if f := fields(event); len(f) > 0 {
+		b.WriteString("<ul>")
+		for _, field := range f {
+			b.WriteString(fmt.Sprintf("<li><b>%s:</b> %s</li>", html.EscapeString(field[0]), html.EscapeString(field[1])))
+		}
+		b.WriteString("</ul>")
+	}
+	return b.String()
+}
+
+// fields returns the event's details as name/value pairs
+func fields(event *integrations.Event) [][2]string {
+	var result [][2]string
+	if event.UserID != "" {
+		result = append(result, [2]string{"User", event.UserID})
+	}
+	if event.ConversationID != "" {
+		result = append(result, [2]string{"Conversation", event.ConversationID})
+	}
+
+	keys := make([]string, 0, len(event.Data))
+	for key := range event.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result = append(result, [2]string{key, fmt.Sprintf("%v", event.Data[key])})
+	}
+	return result
+}
+
+// getHeaderText returns the header text based on event type
+func (c *Client) getHeaderText(event *integrations.Event) string {
+	switch event.Type {
+	case integrations.EventError:
+		return "⚠️ Error Alert"
+	case integrations.EventToolApproved:
+		return "✅ Tool Approved"
+	case integrations.EventToolRejected:
+		return "❌ Tool Rejected"
+	case integrations.EventVulnerabilitiesFound:
+		return "🛡️ New Dependency Vulnerabilities"
+	case integrations.EventAgentCompleted:
+		return "🤖 Agent Completed"
+	case integrations.EventAgentFailed:
+		return "🤖 Agent Failed"
+	case integrations.EventSwarmCompleted:
+		return "🐝 Swarm Completed"
+	case integrations.EventSwarmFailed:
+		return "🐝 Swarm Failed"
+	case integrations.EventBuildCompleted:
+		return "🏗️ Build Succeeded"
+	case integrations.EventBuildFailed:
+		return "🏗️ Build Failed"
+	case integrations.EventActivityDigest:
+		return "📊 Activity Digest"
+	case integrations.EventIntegrationTest:
+		return "🔔 Test Notification"
+	case integrations.EventLoginNewDevice:
+		return "🔐 New Sign-in"
+	case integrations.EventLoginFailures:
+		return "🔐 Repeated Failed Sign-ins"
+	default:
+		return fmt.Sprintf("📋 Event: %s", event.Type)
+	}
+}
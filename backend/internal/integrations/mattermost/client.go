@@ -0,0 +1,184 @@
+package mattermost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/jacklau/prism/internal/integrations"
+)
+
+// Config holds Mattermost integration configuration
+type Config struct {
+	WebhookURL string // incoming webhook URL
+	Channel    string // optional channel override, e.g. "town-square"
+	Username   string // optional display name override
+	Enabled    bool
+}
+
+// Client is a Mattermost notification client
+type Client struct {
+	config     *Config
+	httpClient *http.Client
+}
+
+// NewClient creates a new Mattermost client
+func NewClient(config *Config) *Client {
+	return &Client{
+		config: config,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Name returns the provider name
+func (c *Client) Name() string {
+	return "mattermost"
+}
+
+// Enabled returns whether the provider is enabled
+func (c *Client) Enabled() bool {
+	return c.config.Enabled && c.config.WebhookURL != ""
+}
+
+// Send sends a notification to Mattermost
+func (c *Client) Send(event *integrations.Event) error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	payload := c.buildPayload(event)
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.config.WebhookURL, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("mattermost webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// buildPayload builds the Mattermost message payload using a message attachment
+func (c *Client) buildPayload(event *integrations.Event) map[string]interface{} {
+	headerText := c.getHeaderText(event)
+
+	fields := []map[string]interface{}{}
+	if event.UserID != "" {
+		fields = append(fields, map[string]interface{}{
+			"short": true,
+			"title": "User",
+			"value": event.UserID,
+		})
+	}
+	if event.ConversationID != "" {
+		fields = append(fields, map[string]interface{}{
+			"short": true,
+			"title": "Conversation",
+			"value": event.ConversationID,
+		})
+	}
+
+	keys := make([]string, 0, len(event.Data))
+	for key := range event.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fields = append(fields, map[string]interface{}{
+			"short": true,
+			"title": key,
+			"value": fmt.Sprintf("%v", event.Data[key]),
+		})
+	}
+
+	payload := map[string]interface{}{
+		"text": "#### " + headerText,
+		"attachments": []map[string]interface{}{
+			{
+				"fallback": headerText,
+				"color":    c.getColor(event),
+				"fields":   fields,
+				"ts":       time.Now().Unix(),
+			},
+		},
+	}
+	if c.config.Channel != "" {
+		payload["channel"] = c.config.Channel
+	}
+	if c.config.Username != "" {
+		payload["username"] = c.config.Username
+	}
+	return payload
+}
+
+// getColor returns the attachment color based on event type
+func (c *Client) getColor(event *integrations.Event) string {
+	switch event.Type {
+	case integrations.EventError, integrations.EventVulnerabilitiesFound,
+		integrations.EventAgentFailed, integrations.EventSwarmFailed, integrations.EventBuildFailed:
+		return "#E74C3C" // Red
+	case integrations.EventToolApproved,
+		integrations.EventAgentCompleted, integrations.EventSwarmCompleted, integrations.EventBuildCompleted:
+		return "#2ECC71" // Green
+	case integrations.EventToolRejected:
+		return "#E67E22" // Orange
+	default:
+		return "#3498DB" // Blue
+	}
+}
+
+// getHeaderText returns the header text based on event type
+func (c *Client) getHeaderText(event *integrations.Event) string {
+	switch event.Type {
+	case integrations.EventError:
+		return "⚠️ Error Alert"
+	case integrations.EventToolApproved:
+		return "✅ Tool Approved"
+	case integrations.EventToolRejected:
+		return "❌ Tool Rejected"
+	case integrations.EventVulnerabilitiesFound:
+		return "🛡️ New Dependency Vulnerabilities"
+	case integrations.EventAgentCompleted:
+		return "🤖 Agent Completed"
+	case integrations.EventAgentFailed:
+		return "🤖 Agent Failed"
+	case integrations.EventSwarmCompleted:
+		return "🐝 Swarm Completed"
+	case integrations.EventSwarmFailed:
+		return "🐝 Swarm Failed"
+	case integrations.EventBuildCompleted:
+		return "🏗️ Build Succeeded"
+	case integrations.EventBuildFailed:
+		return "🏗️ Build Failed"
+	case integrations.EventActivityDigest:
+		return "📊 Activity Digest"
+	case integrations.EventIntegrationTest:
+		return "🔔 Test Notification"
+	case integrations.EventLoginNewDevice:
+		return "🔐 New Sign-in"
+	case integrations.EventLoginFailures:
+		return "🔐 Repeated Failed Sign-ins"
+	default:
+		return fmt.Sprintf("📋 Event: %s", event.Type)
+	}
+}
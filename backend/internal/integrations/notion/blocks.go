@@ -0,0 +1,258 @@
+package notion
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// richText is a run of formatted text
+type richText struct {
+	PlainText   string `json:"plain_text"`
+	Href        string `json:"href"`
+	Annotations struct {
+		Bold          bool `json:"bold"`
+		Italic        bool `json:"italic"`
+		Strikethrough bool `json:"strikethrough"`
+		Code          bool `json:"code"`
+	} `json:"annotations"`
+}
+
+// plainText joins rich text without formatting
+func plainText(runs []richText) string {
+	var sb strings.Builder
+	for _, run := range runs {
+		sb.WriteString(run.PlainText)
+	}
+	return sb.String()
+}
+
+// markdown renders rich text as Markdown
+func markdown(runs []richText) string {
+	var sb strings.Builder
+	for _, run := range runs {
+		text := run.PlainText
+		if strings.TrimSpace(text) == "" {
+			sb.WriteString(text)
+			continue
+		}
+		a := run.Annotations
+		switch {
+		case a.Code:
+			text = "`" + text + "`"
+		default:
+			if a.Bold {
+				text = "**" + text + "**"
+			}
+			if a.Italic {
+				text = "_" + text + "_"
+			}
+			if a.Strikethrough {
+				text = "~~" + text + "~~"
+			}
+		}
+		if run.Href != "" {
+			text = "[" + text + "](" + run.Href + ")"
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
+
+// block is a content block of a page
+type block struct {
+	ID          string
+	Type        string
+	HasChildren bool
+	Body        blockBody
+}
+
+// blockBody holds the fields of the block types that are rendered
+type blockBody struct {
+	RichText   []richText   `json:"rich_text"`
+	Checked    bool         `json:"checked"`    // to_do
+	Language   string       `json:"language"`   // code
+	Title      string       `json:"title"`      // child_page, child_database
+	URL        string       `json:"url"`        // bookmark, embed, link_preview
+	Expression string       `json:"expression"` // equation
+	Caption    []richText   `json:"caption"`
+	Cells      [][]richText `json:"cells"` // table_row
+	External   struct {
+		URL string `json:"url"`
+	} `json:"external"`
+	File struct {
+		URL string `json:"url"`
+	} `json:"file"`
+}
+
+func (b *block) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	_ = json.Unmarshal(raw["id"], &b.ID)
+	_ = json.Unmarshal(raw["type"], &b.Type)
+	_ = json.Unmarshal(raw["has_children"], &b.HasChildren)
+	if body, ok := raw[b.Type]; ok {
+		_ = json.Unmarshal(body, &b.Body)
+	}
+	return nil
+}
+
+// renderer renders a page's block tree as Markdown
+type renderer struct {
+	client    *Client
+	token     string
+	maxChars  int
+	blocks    int
+	inList    bool // The last block written was a list item or table row
+	truncated bool
+	sb        strings.Builder
+}
+
+// full reports whether rendering should stop
+func (r *renderer) full() bool {
+	if (r.maxChars > 0 && r.sb.Len() >= r.maxChars) || r.blocks >= maxBlocks {
+		r.truncated = true
+		return true
+	}
+	return false
+}
+
+// render renders the children of a block (or page) at a nesting depth
+func (r *renderer) render(parentID string, depth int) error {
+	indent := strings.Repeat("  ", depth)
+	number := 0
+	cursor := ""
+	for {
+		if r.full() {
+			return nil
+		}
+
+		path := "/blocks/" + parentID + "/children?page_size=100"
+		if cursor != "" {
+			path += "&start_cursor=" + url.QueryEscape(cursor)
+		}
+		var page struct {
+			Results    []block `json:"results"`
+			HasMore    bool    `json:"has_more"`
+			NextCursor string  `json:"next_cursor"`
+		}
+		if err := r.client.call(r.token, "GET", path, nil, &page); err != nil {
+			return err
+		}
+
+		for i := range page.Results {
+			if r.full() {
+				return nil
+			}
+			b := &page.Results[i]
+			r.blocks++
+
+			if b.Type == "numbered_list_item" {
+				number++
+			} else {
+				number = 0
+			}
+			r.renderBlock(b, indent, number)
+
+			// Child pages and databases are separate documents; read them
+			// on their own
+			if b.HasChildren && b.Type != "child_page" && b.Type != "child_database" {
+				if depth+1 >= maxBlockDepth {
+					r.truncated = true
+					continue
+				}
+				if err := r.render(b.ID, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+
+		if !page.HasMore || page.NextCursor == "" {
+			return nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// renderBlock writes one block, without its children
+func (r *renderer) renderBlock(b *block, indent string, number int) {
+	text := markdown(b.Body.RichText)
+	var line string
+	switch b.Type {
+	case "paragraph":
+		line = text
+	case "heading_1":
+		line = "# " + text
+	case "heading_2":
+		line = "## " + text
+	case "heading_3":
+		line = "### " + text
+	case "bulleted_list_item", "toggle":
+		line = "- " + text
+	case "numbered_list_item":
+		line = fmt.Sprintf("%d. %s", number, text)
+	case "to_do":
+		check := " "
+		if b.Body.Checked {
+			check = "x"
+		}
+		line = fmt.Sprintf("- [%s] %s", check, text)
+	case "quote":
+		line = "> " + text
+	case "callout":
+		line = "> " + text
+	case "code":
+		line = "```" + b.Body.Language + "\n" + plainText(b.Body.RichText) + "\n```"
+	case "equation":
+		line = "$$" + b.Body.Expression + "$$"
+	case "divider":
+		line = "---"
+	case "child_page":
+		line = fmt.Sprintf("[Subpage: %s] (id %s)", b.Body.Title, b.ID)
+	case "child_database":
+		line = fmt.Sprintf("[Database: %s] (id %s)", b.Body.Title, b.ID)
+	case "bookmark", "embed", "link_preview":
+		line = b.Body.URL
+	case "image", "file", "pdf", "video":
+		link := b.Body.External.URL
+		if link == "" {
+			link = b.Body.File.URL
+		}
+		caption := plainText(b.Body.Caption)
+		if caption == "" {
+			caption = b.Type
+		}
+		line = fmt.Sprintf("[%s](%s)", caption, link)
+	case "table_row":
+		cells := make([]string, 0, len(b.Body.Cells))
+		for _, cell := range b.Body.Cells {
+			cells = append(cells, strings.ReplaceAll(markdown(cell), "|", "\\|"))
+		}
+		line = "| " + strings.Join(cells, " | ") + " |"
+	default:
+		// Layout blocks (columns, synced blocks, tables) only hold children
+		return
+	}
+
+	// List items and table rows are written without blank lines between
+	// them, so end the list before anything else
+	listed := b.Type == "table_row" || b.Type == "to_do" || strings.HasSuffix(b.Type, "list_item")
+	if r.inList && !listed && indent == "" {
+		r.sb.WriteString("\n")
+	}
+	r.inList = listed
+
+	if strings.TrimSpace(line) == "" {
+		r.sb.WriteString("\n")
+		return
+	}
+	for _, l := range strings.Split(line, "\n") {
+		r.sb.WriteString(indent + l + "\n")
+	}
+	if !listed {
+		r.sb.WriteString("\n")
+	}
+}
@@ -0,0 +1,275 @@
+// Package notion is a read-only client for the Notion API, used to search
+// and read the pages shared with a user's internal integration.
+package notion
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	apiBaseURL = "https://api.notion.com/v1"
+	apiVersion = "2022-06-28"
+
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+
+	// maxBlockDepth is how deep nested blocks (toggles, list children,
+	// columns) are followed when reading a page
+	maxBlockDepth = 4
+	// maxBlocks caps the blocks fetched for one page
+	maxBlocks = 2000
+)
+
+var (
+	// ErrUnauthorized is returned when Notion rejects a token
+	ErrUnauthorized = errors.New("notion rejected the integration token")
+	// ErrNotFound is returned for pages that don't exist or aren't shared
+	// with the integration
+	ErrNotFound = errors.New("notion page not found or not shared with the integration")
+)
+
+// APIError is an error returned by the Notion API
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("notion API returned status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Bot is the integration a token belongs to
+type Bot struct {
+	Name          string `json:"name"`
+	WorkspaceName string `json:"workspace_name"`
+}
+
+// Page is a page or database found by a search
+type Page struct {
+	ID         string    `json:"id"`
+	Object     string    `json:"object"` // page or database
+	Title      string    `json:"title"`
+	URL        string    `json:"url"`
+	LastEdited time.Time `json:"last_edited"`
+}
+
+// PageContent is a page rendered as Markdown
+type PageContent struct {
+	Page
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"` // Some blocks weren't fetched
+}
+
+// Client is a Notion API client
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// NewClient creates a new Notion client
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: 20 * time.Second,
+		},
+		baseURL: apiBaseURL,
+	}
+}
+
+// Me returns the integration a token belongs to, which also checks the token
+func (c *Client) Me(token string) (*Bot, error) {
+	var user struct {
+		Name string `json:"name"`
+		Bot  struct {
+			WorkspaceName string `json:"workspace_name"`
+		} `json:"bot"`
+	}
+	if err := c.call(token, "GET", "/users/me", nil, &user); err != nil {
+		return nil, err
+	}
+	return &Bot{Name: user.Name, WorkspaceName: user.Bot.WorkspaceName}, nil
+}
+
+// rawObject is a page or database as returned by the API
+type rawObject struct {
+	Object         string                 `json:"object"`
+	ID             string                 `json:"id"`
+	URL            string                 `json:"url"`
+	LastEditedTime time.Time              `json:"last_edited_time"`
+	Title          []richText             `json:"title"` // databases
+	Properties     map[string]rawProperty `json:"properties"`
+}
+
+type rawProperty struct {
+	Type  string     `json:"type"`
+	Title []richText `json:"title"`
+}
+
+func (o *rawObject) toPage() Page {
+	title := plainText(o.Title)
+	if title == "" {
+		for _, prop := range o.Properties {
+			if prop.Type == "title" {
+				title = plainText(prop.Title)
+				break
+			}
+		}
+	}
+	if title == "" {
+		title = "Untitled"
+	}
+	return Page{
+		ID:         o.ID,
+		Object:     o.Object,
+		Title:      title,
+		URL:        o.URL,
+		LastEdited: o.LastEditedTime,
+	}
+}
+
+// Search finds the pages and databases shared with the integration whose
+// titles match a query, most recently edited first
+func (c *Client) Search(token, query string, limit int) ([]Page, error) {
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	var result struct {
+		Results []rawObject `json:"results"`
+	}
+	err := c.call(token, "POST", "/search", map[string]interface{}{
+		"query":     query,
+		"page_size": limit,
+		"sort": map[string]string{
+			"direction": "descending",
+			"timestamp": "last_edited_time",
+		},
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]Page, 0, len(result.Results))
+	for i := range result.Results {
+		pages = append(pages, result.Results[i].toPage())
+	}
+	return pages, nil
+}
+
+// ReadPage fetches a page and renders its blocks as Markdown, stopping once
+// maxChars characters have been rendered
+func (c *Client) ReadPage(token, pageID string, maxChars int) (*PageContent, error) {
+	pageID = NormalizeID(pageID)
+	if pageID == "" {
+		return nil, ErrNotFound
+	}
+
+	var page rawObject
+	if err := c.call(token, "GET", "/pages/"+pageID, nil, &page); err != nil {
+		return nil, err
+	}
+
+	r := &renderer{client: c, token: token, maxChars: maxChars}
+	if err := r.render(pageID, 0); err != nil {
+		return nil, err
+	}
+	content := strings.TrimSpace(r.sb.String())
+	if maxChars > 0 && len(content) > maxChars {
+		content = content[:maxChars]
+		r.truncated = true
+	}
+	return &PageContent{
+		Page:      page.toPage(),
+		Content:   content,
+		Truncated: r.truncated,
+	}, nil
+}
+
+// NormalizeID extracts a page ID from an ID or a Notion page URL
+func NormalizeID(id string) string {
+	id = strings.TrimSpace(id)
+	if u, err := url.Parse(id); err == nil && u.Host != "" {
+		id = u.Path
+	}
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		id = id[i+1:]
+	}
+	// Page URLs end in "<title>-<id>"
+	if i := strings.LastIndex(id, "-"); i >= 0 && len(id)-i-1 == 32 {
+		id = id[i+1:]
+	}
+	compact := strings.ReplaceAll(id, "-", "")
+	if len(compact) != 32 {
+		return ""
+	}
+	for _, r := range compact {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return ""
+		}
+	}
+	return compact
+}
+
+// call makes an API request and decodes its response into out
+func (c *Client) call(token, method, path string, payload interface{}, out interface{}) error {
+	if token == "" {
+		return ErrUnauthorized
+	}
+
+	var body io.Reader
+	if payload != nil {
+		jsonPayload, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		body = bytes.NewBuffer(jsonPayload)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Notion-Version", apiVersion)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&apiErr)
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized:
+			return ErrUnauthorized
+		case resp.StatusCode == http.StatusNotFound, apiErr.Code == "object_not_found":
+			return ErrNotFound
+		}
+		return &APIError{StatusCode: resp.StatusCode, Code: apiErr.Code, Message: apiErr.Message}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
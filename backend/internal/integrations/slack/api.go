@@ -0,0 +1,154 @@
+package slack
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	apiBaseURL = "https://slack.com/api"
+
+	// maxRequestAge is how old a signed request may be before it is rejected as a replay
+	maxRequestAge = 5 * time.Minute
+)
+
+var (
+	// ErrInvalidSignature is returned when a request's signature does not match
+	ErrInvalidSignature = errors.New("invalid slack signature")
+
+	// ErrStaleRequest is returned when a request's timestamp is too old
+	ErrStaleRequest = errors.New("slack request timestamp is too old")
+)
+
+// VerifySignature checks a request against Slack's signing secret, using the
+// X-Slack-Request-Timestamp and X-Slack-Signature headers and the raw body
+func VerifySignature(signingSecret, timestamp, signature string, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > maxRequestAge || age < -maxRequestAge {
+		return ErrStaleRequest
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// apiResponse is the common envelope of Slack Web API responses
+type apiResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	TS    string `json:"ts,omitempty"`
+}
+
+// PostMessage posts a message to a channel with the bot token, in a thread
+// when threadTS is set, and returns the new message's timestamp
+func (c *Client) PostMessage(channel, threadTS, text string) (string, error) {
+	payload := map[string]interface{}{
+		"channel": channel,
+		"text":    text,
+	}
+	if threadTS != "" {
+		payload["thread_ts"] = threadTS
+	}
+
+	resp, err := c.callAPI("chat.postMessage", payload)
+	if err != nil {
+		return "", err
+	}
+	return resp.TS, nil
+}
+
+// UpdateMessage replaces the text of a message previously posted by the bot
+func (c *Client) UpdateMessage(channel, ts, text string) error {
+	_, err := c.callAPI("chat.update", map[string]interface{}{
+		"channel": channel,
+		"ts":      ts,
+		"text":    text,
+	})
+	return err
+}
+
+// Respond posts a message to a slash command's response URL. Ephemeral
+// messages are only shown to the user who ran the command.
+func (c *Client) Respond(responseURL, text string, ephemeral bool) error {
+	responseType := "in_channel"
+	if ephemeral {
+		responseType = "ephemeral"
+	}
+
+	jsonPayload, err := json.Marshal(map[string]interface{}{
+		"response_type": responseType,
+		"text":          text,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	resp, err := c.httpClient.Post(responseURL, "application/json", bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("slack response URL returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// callAPI calls a Slack Web API method with the bot token
+func (c *Client) callAPI(method string, payload map[string]interface{}) (*apiResponse, error) {
+	if c.config.BotToken == "" {
+		return nil, fmt.Errorf("slack bot token is not configured")
+	}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", apiBaseURL+"/"+method, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+c.config.BotToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("slack %s returned status %d", method, resp.StatusCode)
+	}
+
+	var result apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("slack %s failed: %s", method, result.Error)
+	}
+	return &result, nil
+}
@@ -162,6 +162,30 @@ func (c *Client) getHeaderText(event *integrations.Event) string {
 		return "🔧 Tool Started"
 	case integrations.EventToolCompleted:
 		return "✔️ Tool Completed"
+	case integrations.EventVulnerabilitiesFound:
+		return "🛡️ New Dependency Vulnerabilities"
+	case integrations.EventAgentCompleted:
+		return "🤖 Agent Completed"
+	case integrations.EventAgentFailed:
+		return "🤖 Agent Failed"
+	case integrations.EventSwarmCompleted:
+		return "🐝 Swarm Completed"
+	case integrations.EventSwarmFailed:
+		return "🐝 Swarm Failed"
+	case integrations.EventBuildCompleted:
+		return "🏗️ Build Succeeded"
+	case integrations.EventBuildFailed:
+		return "🏗️ Build Failed"
+	case integrations.EventConversationSummarized:
+		return "📝 Conversation Summary"
+	case integrations.EventActivityDigest:
+		return "📊 Activity Digest"
+	case integrations.EventIntegrationTest:
+		return "🔔 Test Notification"
+	case integrations.EventLoginNewDevice:
+		return "🔐 New Sign-in"
+	case integrations.EventLoginFailures:
+		return "🔐 Repeated Failed Sign-ins"
 	default:
 		return fmt.Sprintf("📋 Event: %s", event.Type)
 	}
@@ -0,0 +1,259 @@
+// Package webhooks delivers Prism events to user-registered outbound
+// webhooks. Payloads are JSON, signed with the webhook's secret, and retried
+// with exponential backoff when the receiver fails.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+	"github.com/jacklau/prism/internal/security"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultBaseDelay   = 2 * time.Second
+	defaultTimeout     = 10 * time.Second
+
+	// EventPing is sent when a webhook is tested
+	EventPing integrations.EventType = "ping"
+
+	// Request headers sent with every delivery
+	HeaderEvent     = "X-Prism-Event"
+	HeaderDelivery  = "X-Prism-Delivery"
+	HeaderSignature = "X-Prism-Signature"
+)
+
+// SupportedEvents lists the event types a webhook can subscribe to. "*"
+// subscribes to all of them.
+var SupportedEvents = []integrations.EventType{
+	integrations.EventAgentCompleted,
+	integrations.EventAgentFailed,
+	integrations.EventSwarmCompleted,
+	integrations.EventSwarmFailed,
+	integrations.EventBuildCompleted,
+	integrations.EventBuildFailed,
+	integrations.EventToolExecuted,
+	integrations.EventWebhookProcessed,
+	integrations.EventChatCompleted,
+	integrations.EventConversationCreated,
+	integrations.EventVulnerabilitiesFound,
+	integrations.EventError,
+}
+
+// IsSupportedEvent reports whether a webhook can subscribe to an event type
+func IsSupportedEvent(eventType string) bool {
+	if eventType == "*" {
+		return true
+	}
+	for _, supported := range SupportedEvents {
+		if string(supported) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Config holds configuration for the dispatcher
+type Config struct {
+	// MaxAttempts is how many times a delivery is tried before giving up
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry; each retry doubles it
+	BaseDelay time.Duration
+	// Timeout bounds each delivery request
+	Timeout time.Duration
+}
+
+// Payload is the JSON body POSTed to webhooks
+type Payload struct {
+	ID             string                 `json:"id"`
+	Type           integrations.EventType `json:"type"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UserID         string                 `json:"user_id"`
+	ConversationID string                 `json:"conversation_id,omitempty"`
+	MessageID      string                 `json:"message_id,omitempty"`
+	Data           map[string]interface{} `json:"data,omitempty"`
+}
+
+// DeliveryResult describes the outcome of delivering a payload
+type DeliveryResult struct {
+	DeliveryID string `json:"delivery_id"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Attempts   int    `json:"attempts"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Dispatcher delivers events to the outbound webhooks subscribed to them
+type Dispatcher struct {
+	repo       *repository.OutboundWebhookRepository
+	config     Config
+	httpClient *http.Client
+	vault      *security.SecretVault // Resolves secret references in URLs and signing secrets; nil if unset
+}
+
+// NewDispatcher creates a new outbound webhook dispatcher
+func NewDispatcher(repo *repository.OutboundWebhookRepository, config Config) *Dispatcher {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.BaseDelay <= 0 {
+		config.BaseDelay = defaultBaseDelay
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	return &Dispatcher{
+		repo:   repo,
+		config: config,
+		httpClient: &http.Client{
+			Timeout: config.Timeout,
+		},
+	}
+}
+
+// SetSecretVault sets the vault that resolves {{secret:NAME}} references in
+// webhook URLs and signing secrets at delivery time
+func (d *Dispatcher) SetSecretVault(vault *security.SecretVault) {
+	d.vault = vault
+}
+
+// Name returns the subscriber name
+func (d *Dispatcher) Name() string {
+	return "outbound_webhooks"
+}
+
+// Handle delivers an event to each of the user's enabled webhooks that
+// subscribe to its type
+func (d *Dispatcher) Handle(event *integrations.Event) {
+	if event.UserID == "" {
+		return
+	}
+
+	webhooks, err := d.repo.ListEnabledByUser(event.UserID)
+	if err != nil {
+		log.Printf("Failed to list outbound webhooks for user %s: %v", event.UserID, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Subscribed(string(event.Type)) {
+			continue
+		}
+		go d.Deliver(webhook, event)
+	}
+}
+
+// Deliver sends an event to a webhook, retrying failures, and records the
+// outcome on the webhook
+func (d *Dispatcher) Deliver(webhook *repository.OutboundWebhook, event *integrations.Event) *DeliveryResult {
+	payload := &Payload{
+		ID:             uuid.New().String(),
+		Type:           event.Type,
+		CreatedAt:      time.Now().UTC(),
+		UserID:         event.UserID,
+		ConversationID: event.ConversationID,
+		MessageID:      event.MessageID,
+		Data:           event.Data,
+	}
+	result := &DeliveryResult{DeliveryID: payload.ID}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to marshal payload: %v", err)
+		return result
+	}
+
+	delay := d.config.BaseDelay
+	for result.Attempts < d.config.MaxAttempts {
+		if result.Attempts > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		result.Attempts++
+
+		statusCode, retry, err := d.send(webhook, payload, body)
+		result.StatusCode = statusCode
+		result.Error = ""
+		if err == nil {
+			break
+		}
+		result.Error = err.Error()
+		if !retry {
+			break
+		}
+	}
+
+	if result.Error != "" {
+		log.Printf("Outbound webhook %s delivery %s failed after %d attempts: %s",
+			webhook.ID, payload.ID, result.Attempts, result.Error)
+	}
+
+	if err := d.repo.RecordDelivery(webhook.ID, time.Now(), result.StatusCode, result.Error); err != nil {
+		log.Printf("Failed to record outbound webhook delivery: %v", err)
+	}
+
+	return result
+}
+
+// send makes a single delivery attempt. It reports whether a failure is
+// worth retrying: network errors, rate limiting and server errors are.
+func (d *Dispatcher) send(webhook *repository.OutboundWebhook, payload *Payload, body []byte) (int, bool, error) {
+	url, secret := webhook.URL, webhook.Secret
+	resolved := security.ResolvedSecrets{}
+	if d.vault != nil {
+		var err error
+		if url, err = d.vault.Resolve(webhook.UserID, url, resolved); err != nil {
+			return 0, false, fmt.Errorf("failed to resolve URL: %w", err)
+		}
+		if secret, err = d.vault.Resolve(webhook.UserID, secret, resolved); err != nil {
+			return 0, false, fmt.Errorf("failed to resolve secret: %w", err)
+		}
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to create request: %s", resolved.Mask(err.Error()))
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Prism-Webhook/1.0")
+	req.Header.Set(HeaderEvent, string(payload.Type))
+	req.Header.Set(HeaderDelivery, payload.ID)
+	if secret != "" {
+		req.Header.Set(HeaderSignature, Sign(secret, body))
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		// The error quotes the URL, which may hold a secret
+		return 0, true, fmt.Errorf("failed to send request: %s", resolved.Mask(err.Error()))
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, false, nil
+	}
+
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return resp.StatusCode, retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
+
+// Sign returns the signature header value for a payload: the hex HMAC-SHA256
+// of the body keyed with the secret, prefixed with "sha256="
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -13,6 +13,14 @@ import (
 	"github.com/jacklau/prism/internal/llm"
 )
 
+const (
+	// defaultBaseURL is Anthropic's API endpoint
+	defaultBaseURL = "https://api.anthropic.com/v1"
+
+	// checkModel is the model keys are checked with
+	checkModel = "claude-haiku-4-5-20251001"
+)
+
 // Client implements the LLM provider interface for Anthropic
 type Client struct {
 	apiKey  string
@@ -24,8 +32,8 @@ type Client struct {
 func NewClient(apiKey string) *Client {
 	return &Client{
 		apiKey:  apiKey,
-		baseURL: "https://api.anthropic.com/v1",
-		client:  &http.Client{},
+		baseURL: defaultBaseURL,
+		client:  llm.NewHTTPClient(),
 	}
 }
 
@@ -38,28 +46,37 @@ func (c *Client) Name() string {
 func (c *Client) Models() []llm.Model {
 	return []llm.Model{
 		{
-			ID:             "claude-sonnet-4-5-20250929",
-			Name:           "Claude Sonnet 4.5",
-			Description:    "Best balance of intelligence, speed, and cost",
-			ContextWindow:  200000,
-			SupportsTools:  true,
-			SupportsVision: true,
+			ID:               "claude-sonnet-4-5-20250929",
+			Name:             "Claude Sonnet 4.5",
+			Description:      "Best balance of intelligence, speed, and cost",
+			ContextWindow:    200000,
+			MaxOutputTokens:  64000,
+			SupportsTools:    true,
+			SupportsVision:   true,
+			SupportsJSONMode: false,
+			Pricing:          &llm.ModelPricing{InputPerMillion: 3.00, OutputPerMillion: 15.00},
 		},
 		{
-			ID:             "claude-haiku-4-5-20251001",
-			Name:           "Claude Haiku 4.5",
-			Description:    "Fastest model with near-frontier intelligence",
-			ContextWindow:  200000,
-			SupportsTools:  true,
-			SupportsVision: true,
+			ID:               "claude-haiku-4-5-20251001",
+			Name:             "Claude Haiku 4.5",
+			Description:      "Fastest model with near-frontier intelligence",
+			ContextWindow:    200000,
+			MaxOutputTokens:  64000,
+			SupportsTools:    true,
+			SupportsVision:   true,
+			SupportsJSONMode: false,
+			Pricing:          &llm.ModelPricing{InputPerMillion: 1.00, OutputPerMillion: 5.00},
 		},
 		{
-			ID:             "claude-opus-4-5-20251101",
-			Name:           "Claude Opus 4.5",
-			Description:    "Premium model with maximum intelligence",
-			ContextWindow:  200000,
-			SupportsTools:  true,
-			SupportsVision: true,
+			ID:               "claude-opus-4-5-20251101",
+			Name:             "Claude Opus 4.5",
+			Description:      "Premium model with maximum intelligence",
+			ContextWindow:    200000,
+			MaxOutputTokens:  64000,
+			SupportsTools:    true,
+			SupportsVision:   true,
+			SupportsJSONMode: false,
+			Pricing:          &llm.ModelPricing{InputPerMillion: 5.00, OutputPerMillion: 25.00},
 		},
 	}
 }
@@ -74,39 +91,40 @@ func (c *Client) SupportsVision() bool {
 	return true
 }
 
-// ValidateKey validates an API key
-func (c *Client) ValidateKey(ctx context.Context, key string) error {
-	// Anthropic doesn't have a simple key validation endpoint
-	// We'll try a minimal request
+// ValidateKey checks a key with a one-token message
+func (c *Client) ValidateKey(ctx context.Context, check llm.KeyCheck) error {
+	model := check.Model
+	if model == "" {
+		model = checkModel
+	}
 	body := map[string]interface{}{
-		"model":      "claude-haiku-4-5-20251001",
+		"model":      model,
 		"max_tokens": 1,
 		"messages": []map[string]interface{}{
 			{"role": "user", "content": "Hi"},
 		},
 	}
 
-	jsonBody, _ := json.Marshal(body)
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/messages", bytes.NewReader(jsonBody))
+	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", defaultBaseURL+"/messages", bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("x-api-key", key)
+	req.Header.Set("x-api-key", check.Key)
 	req.Header.Set("anthropic-version", "2023-06-01")
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return err
+		return llm.KeyNetworkError(err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusUnauthorized {
-		return fmt.Errorf("invalid API key")
-	}
-
-	return nil
+	return llm.KeyErrorFromResponse(resp)
 }
 
 // HasConfiguredKey returns whether the provider has an API key configured
@@ -216,8 +234,16 @@ func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Str
 	if req.MaxTokens > 0 {
 		body["max_tokens"] = req.MaxTokens
 	}
-	if req.Temperature > 0 {
-		body["temperature"] = req.Temperature
+	if temperature, ok := req.SamplingTemperature(); ok {
+		body["temperature"] = temperature
+	}
+	if req.Deterministic {
+		body["top_k"] = 1
+	} else if req.TopP > 0 {
+		body["top_p"] = req.TopP
+	}
+	if len(req.Stop) > 0 {
+		body["stop_sequences"] = req.Stop
 	}
 	if len(req.Tools) > 0 {
 		body["tools"] = c.convertTools(req.Tools)
@@ -228,12 +254,13 @@ func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Str
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
+	apiKey, _ := llm.RequestCredentials(ctx, c.Name(), c.apiKey, c.baseURL)
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/messages", bytes.NewReader(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	httpReq.Header.Set("x-api-key", c.apiKey)
+	httpReq.Header.Set("x-api-key", apiKey)
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
 	httpReq.Header.Set("Content-Type", "application/json")
 
@@ -0,0 +1,285 @@
+package llm
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultModelCacheTTL is how long a provider's model list is served
+	// before it is fetched again
+	DefaultModelCacheTTL = 5 * time.Minute
+
+	// modelFetchTimeout bounds fetching one provider's models
+	modelFetchTimeout = 10 * time.Second
+
+	// modelRetryInterval is how soon a failed fetch may be retried, so a
+	// provider that is down isn't asked again on every request
+	modelRetryInterval = 30 * time.Second
+)
+
+// ModelFetcher is implemented by providers whose models are fetched from
+// their API, so a failed fetch can be told apart from having no models.
+// Other providers' Models() are cached as they are.
+type ModelFetcher interface {
+	FetchModels(ctx context.Context) ([]Model, error)
+}
+
+// ModelCatalogStatus describes a provider's cached model list
+type ModelCatalogStatus struct {
+	Provider  string     `json:"provider"`
+	Models    int        `json:"models"`
+	FetchedAt *time.Time `json:"fetched_at,omitempty"` // nil until a fetch succeeds
+	Stale     bool       `json:"stale"`
+	Error     string     `json:"error,omitempty"`     // Why the last fetch failed, if it did
+	FailedAt  *time.Time `json:"failed_at,omitempty"` // When the last fetch failed
+}
+
+// catalogEntry is a provider's cached model list
+type catalogEntry struct {
+	models    []Model
+	fetchedAt time.Time
+	err       string
+	failedAt  time.Time
+	fetching  chan struct{} // Closed when the fetch in progress finishes; nil if there is none
+}
+
+// modelCatalog caches each provider's models. Stale lists keep being served
+// while they're refreshed, and a failed refresh keeps the last good list, so
+// a provider that is briefly down doesn't lose its models.
+type modelCatalog struct {
+	ttl     time.Duration
+	entries map[string]*catalogEntry
+	mu      sync.Mutex
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func newModelCatalog() *modelCatalog {
+	return &modelCatalog{
+		ttl:     DefaultModelCacheTTL,
+		entries: make(map[string]*catalogEntry),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// entry returns a provider's entry, creating it if needed. Callers must hold c.mu.
+func (c *modelCatalog) entry(name string) *catalogEntry {
+	entry, ok := c.entries[name]
+	if !ok {
+		entry = &catalogEntry{}
+		c.entries[name] = entry
+	}
+	return entry
+}
+
+// models returns a provider's cached models. Only the first call waits for a
+// fetch; after that stale lists are refreshed in the background.
+func (c *modelCatalog) models(name string, provider Provider) []Model {
+	c.mu.Lock()
+	entry := c.entry(name)
+	done := entry.fetching
+	if done == nil && c.needsFetch(entry) {
+		done = c.startFetch(entry, provider)
+	}
+	if !entry.fetchedAt.IsZero() || done == nil {
+		models := entry.models
+		c.mu.Unlock()
+		return models
+	}
+	c.mu.Unlock()
+
+	<-done
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return entry.models
+}
+
+// refresh fetches a provider's models now and returns the result
+func (c *modelCatalog) refresh(ctx context.Context, name string, provider Provider) (ModelCatalogStatus, error) {
+	c.mu.Lock()
+	entry := c.entry(name)
+	done := entry.fetching
+	if done == nil {
+		done = c.startFetch(entry, provider)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ModelCatalogStatus{}, ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status(name, entry), nil
+}
+
+// refreshAll starts a background refresh of every provider
+func (c *modelCatalog) refreshAll(providers map[string]Provider) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, provider := range providers {
+		if entry := c.entry(name); entry.fetching == nil {
+			c.startFetch(entry, provider)
+		}
+	}
+}
+
+// needsFetch reports whether an entry is missing or stale and not waiting
+// out a recent failure. Callers must hold c.mu.
+func (c *modelCatalog) needsFetch(entry *catalogEntry) bool {
+	if !entry.failedAt.IsZero() && time.Since(entry.failedAt) < modelRetryInterval {
+		return false
+	}
+	return entry.fetchedAt.IsZero() || time.Since(entry.fetchedAt) >= c.ttl
+}
+
+// startFetch fetches a provider's models in the background and returns a
+// channel that is closed when it finishes. Callers must hold c.mu.
+func (c *modelCatalog) startFetch(entry *catalogEntry, provider Provider) chan struct{} {
+	done := make(chan struct{})
+	entry.fetching = done
+
+	go func() {
+		models, err := fetchModels(provider)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if err != nil {
+			entry.err = err.Error()
+			entry.failedAt = time.Now()
+		} else {
+			entry.models = models
+			entry.fetchedAt = time.Now()
+			entry.err = ""
+			entry.failedAt = time.Time{}
+		}
+		entry.fetching = nil
+		close(done)
+	}()
+
+	return done
+}
+
+// fetchModels asks a provider for its models
+func fetchModels(provider Provider) ([]Model, error) {
+	fetcher, ok := provider.(ModelFetcher)
+	if !ok {
+		return provider.Models(), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), modelFetchTimeout)
+	defer cancel()
+	return fetcher.FetchModels(ctx)
+}
+
+// status describes an entry. Callers must hold c.mu.
+func (c *modelCatalog) status(name string, entry *catalogEntry) ModelCatalogStatus {
+	status := ModelCatalogStatus{
+		Provider: name,
+		Models:   len(entry.models),
+		Stale:    entry.fetchedAt.IsZero() || time.Since(entry.fetchedAt) >= c.ttl,
+		Error:    entry.err,
+	}
+	if !entry.fetchedAt.IsZero() {
+		fetchedAt := entry.fetchedAt
+		status.FetchedAt = &fetchedAt
+	}
+	if !entry.failedAt.IsZero() {
+		failedAt := entry.failedAt
+		status.FailedAt = &failedAt
+	}
+	return status
+}
+
+// Models returns a provider's models from the model catalog
+func (m *Manager) Models(providerName string) ([]Model, error) {
+	provider, err := m.GetProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	return m.catalog.models(providerName, provider), nil
+}
+
+// RefreshModels fetches a provider's models now instead of waiting for the
+// cached list to expire. A failed fetch is reported in the returned status
+// and keeps the previous list.
+func (m *Manager) RefreshModels(ctx context.Context, providerName string) (ModelCatalogStatus, error) {
+	provider, err := m.GetProvider(providerName)
+	if err != nil {
+		return ModelCatalogStatus{}, err
+	}
+	return m.catalog.refresh(ctx, providerName, provider)
+}
+
+// ModelCatalog describes the cached model list of every provider
+func (m *Manager) ModelCatalog() []ModelCatalogStatus {
+	providers := m.snapshotProviders()
+
+	m.catalog.mu.Lock()
+	statuses := make([]ModelCatalogStatus, 0, len(providers))
+	for name := range providers {
+		statuses = append(statuses, m.catalog.status(name, m.catalog.entry(name)))
+	}
+	m.catalog.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Provider < statuses[j].Provider })
+	return statuses
+}
+
+// SetModelCacheTTL sets how long model lists are cached. Call it before
+// StartModelRefresh.
+func (m *Manager) SetModelCacheTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultModelCacheTTL
+	}
+	m.catalog.mu.Lock()
+	defer m.catalog.mu.Unlock()
+	m.catalog.ttl = ttl
+}
+
+// StartModelRefresh fetches every provider's models now and again each time
+// the cache TTL passes, so model listings rarely wait on a provider
+func (m *Manager) StartModelRefresh() {
+	m.catalog.mu.Lock()
+	interval := m.catalog.ttl
+	m.catalog.mu.Unlock()
+
+	m.catalog.refreshAll(m.snapshotProviders())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.catalog.stopCh:
+				return
+			case <-ticker.C:
+				m.catalog.refreshAll(m.snapshotProviders())
+			}
+		}
+	}()
+}
+
+// StopModelRefresh stops the background model refresh
+func (m *Manager) StopModelRefresh() {
+	m.catalog.stopOnce.Do(func() { close(m.catalog.stopCh) })
+}
+
+// snapshotProviders copies the registered providers, so they can be used
+// without holding m.mu
+func (m *Manager) snapshotProviders() map[string]Provider {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	providers := make(map[string]Provider, len(m.providers))
+	for name, provider := range m.providers {
+		providers[name] = provider
+	}
+	return providers
+}
@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/security"
+)
+
+// Credentials are the API key and endpoint a request is sent with. Users
+// bring their own keys, so credentials travel with each request instead of
+// being set on the provider instances every user shares.
+type Credentials struct {
+	Provider string // Provider the key belongs to; other providers ignore it
+	APIKey   string
+	BaseURL  string // "" for the provider's default endpoint
+}
+
+// credentialsKey is the context key for a request's credentials
+type credentialsKey struct{}
+
+// WithCredentials returns ctx carrying the credentials requests made with it
+// are sent with. A nil creds leaves ctx as it is, so requests use the
+// provider's own key.
+func WithCredentials(ctx context.Context, creds *Credentials) context.Context {
+	if creds == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, credentialsKey{}, creds)
+}
+
+// CredentialsFrom returns the credentials set with WithCredentials, or nil
+func CredentialsFrom(ctx context.Context) *Credentials {
+	creds, _ := ctx.Value(credentialsKey{}).(*Credentials)
+	return creds
+}
+
+// RequestCredentials returns the API key and base URL a provider sends a
+// request with: those carried by ctx for it, or else the provider's own
+func RequestCredentials(ctx context.Context, provider, apiKey, baseURL string) (string, string) {
+	creds := CredentialsFrom(ctx)
+	if creds == nil || creds.Provider != provider {
+		return apiKey, baseURL
+	}
+	if creds.BaseURL != "" {
+		baseURL = creds.BaseURL
+	}
+	return creds.APIKey, baseURL
+}
+
+// UserCredentials returns the API key and endpoint the user stored for a
+// provider, for services that call providers on their behalf (titles,
+// summaries, bots, reviews), or nil if they stored none. Ollama needs no
+// key.
+func (m *Manager) UserCredentials(providerKeyRepo *repository.ProviderKeyRepository, encryptionService *security.EncryptionService, userID, provider string) *Credentials {
+	if provider == "ollama" || providerKeyRepo == nil || encryptionService == nil {
+		return nil
+	}
+	providerKey, err := providerKeyRepo.GetKey(userID, provider)
+	if err != nil || providerKey == nil {
+		return nil
+	}
+	decryptedKey, err := encryptionService.Decrypt(providerKey.EncryptedKey, providerKey.KeyNonce)
+	if err != nil {
+		return nil
+	}
+	creds := &Credentials{Provider: provider, APIKey: string(decryptedKey)}
+	if m.SupportsBaseURL(provider) {
+		creds.BaseURL = providerKey.BaseURL
+	}
+	return creds
+}
+
+// CanUse reports whether requests to a provider can be made with creds,
+// which may be nil: with them, or with the provider's own key (or none, for
+// providers like Ollama that don't need one)
+func (m *Manager) CanUse(providerName string, creds *Credentials) bool {
+	if _, err := m.GetProvider(providerName); err != nil {
+		return false
+	}
+	return (creds != nil && creds.Provider == providerName) || m.HasValidKey(providerName)
+}
@@ -0,0 +1,175 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacklau/prism/internal/security"
+)
+
+// maxDebugCaptureBytes caps how much of a response's stream is captured
+const maxDebugCaptureBytes = 1 << 20
+
+// DebugExchange is one HTTP exchange with a provider, as sent and received,
+// with secrets redacted
+type DebugExchange struct {
+	Provider       string
+	Model          string
+	Method         string
+	URL            string
+	RequestHeaders map[string]string
+	RequestBody    string
+	StatusCode     int
+	ResponseChunks []string // The response body in the pieces it was read in
+	Truncated      bool     // The response was longer than maxDebugCaptureBytes
+	Error          string
+	StartedAt      time.Time
+	Duration       time.Duration
+}
+
+// DebugRecorder receives the exchanges of requests made with its context,
+// once each response has been read
+type DebugRecorder func(exchange *DebugExchange)
+
+type debugRecorderKey struct{}
+
+// WithDebugRecorder captures the provider traffic of chat requests made with
+// the returned context
+func WithDebugRecorder(ctx context.Context, recorder DebugRecorder) context.Context {
+	return context.WithValue(ctx, debugRecorderKey{}, recorder)
+}
+
+// debugRecorderFrom returns the context's recorder, or nil
+func debugRecorderFrom(ctx context.Context) DebugRecorder {
+	recorder, _ := ctx.Value(debugRecorderKey{}).(DebugRecorder)
+	return recorder
+}
+
+// withDebugModel labels the exchanges a context's recorder receives with the
+// provider and model they were for
+func withDebugModel(ctx context.Context, provider, model string) context.Context {
+	recorder := debugRecorderFrom(ctx)
+	if recorder == nil {
+		return ctx
+	}
+	return WithDebugRecorder(ctx, func(exchange *DebugExchange) {
+		exchange.Provider = provider
+		exchange.Model = model
+		recorder(exchange)
+	})
+}
+
+// NewHTTPClient creates the HTTP client providers send requests with, which
+// captures the traffic of requests whose context has a debug recorder
+func NewHTTPClient() *http.Client {
+	return &http.Client{Transport: &debugTransport{base: http.DefaultTransport}}
+}
+
+// debugTransport captures requests with a recorder in their context
+type debugTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := debugRecorderFrom(req.Context())
+	if recorder == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	exchange := &DebugExchange{
+		Method:         req.Method,
+		URL:            redactURL(req.URL),
+		RequestHeaders: redactHeaders(req.Header),
+		StartedAt:      time.Now(),
+	}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			body.Close()
+			exchange.RequestBody = security.RedactSecrets(string(data))
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		exchange.Error = err.Error()
+		exchange.Duration = time.Since(exchange.StartedAt)
+		recorder(exchange)
+		return nil, err
+	}
+
+	exchange.StatusCode = resp.StatusCode
+	resp.Body = &debugBody{body: resp.Body, exchange: exchange, recorder: recorder}
+	return resp, nil
+}
+
+// debugBody captures a response body as it is read, and records the exchange
+// once it is closed
+type debugBody struct {
+	body     io.ReadCloser
+	exchange *DebugExchange
+	recorder DebugRecorder
+	captured int
+	once     sync.Once
+}
+
+// Read implements io.Reader
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		if b.captured+n > maxDebugCaptureBytes {
+			b.exchange.Truncated = true
+		} else {
+			b.exchange.ResponseChunks = append(b.exchange.ResponseChunks, security.RedactSecrets(string(p[:n])))
+			b.captured += n
+		}
+	}
+	if err != nil && err != io.EOF {
+		b.exchange.Error = err.Error()
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (b *debugBody) Close() error {
+	err := b.body.Close()
+	b.once.Do(func() {
+		b.exchange.Duration = time.Since(b.exchange.StartedAt)
+		b.recorder(b.exchange)
+	})
+	return err
+}
+
+// redactURL hides keys passed in a URL's query, as Google's API takes them
+func redactURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	for name := range query {
+		switch strings.ToLower(name) {
+		case "key", "api_key", "apikey", "access_token", "token":
+			query.Set(name, "[REDACTED]")
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	return security.RedactSecrets(redacted.String())
+}
+
+// redactHeaders flattens request headers, hiding credentials
+func redactHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		value := strings.Join(values, ", ")
+		switch strings.ToLower(name) {
+		case "authorization", "x-api-key", "x-goog-api-key", "api-key", "cookie":
+			value = "[REDACTED]"
+		}
+		headers[name] = security.RedactSecrets(value)
+	}
+	return headers
+}
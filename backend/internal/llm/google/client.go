@@ -5,14 +5,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/jacklau/prism/internal/llm"
 )
 
+// checkModel is the model keys are checked with
+const checkModel = "gemini-2.0-flash"
+
 // Client implements the LLM provider interface for Google AI (Gemini)
 type Client struct {
 	apiKey  string
@@ -25,7 +31,7 @@ func NewClient(apiKey string) *Client {
 	return &Client{
 		apiKey:  apiKey,
 		baseURL: "https://generativelanguage.googleapis.com/v1beta",
-		client:  &http.Client{},
+		client:  llm.NewHTTPClient(),
 	}
 }
 
@@ -38,28 +44,37 @@ func (c *Client) Name() string {
 func (c *Client) Models() []llm.Model {
 	return []llm.Model{
 		{
-			ID:             "gemini-2.5-flash",
-			Name:           "Gemini 2.5 Flash",
-			Description:    "Fast and capable for most tasks",
-			ContextWindow:  1000000,
-			SupportsTools:  true,
-			SupportsVision: true,
+			ID:               "gemini-2.5-flash",
+			Name:             "Gemini 2.5 Flash",
+			Description:      "Fast and capable for most tasks",
+			ContextWindow:    1000000,
+			MaxOutputTokens:  65536,
+			SupportsTools:    true,
+			SupportsVision:   true,
+			SupportsJSONMode: true,
+			Pricing:          &llm.ModelPricing{InputPerMillion: 0.30, OutputPerMillion: 2.50},
 		},
 		{
-			ID:             "gemini-2.5-pro",
-			Name:           "Gemini 2.5 Pro",
-			Description:    "Best for complex reasoning tasks",
-			ContextWindow:  1000000,
-			SupportsTools:  true,
-			SupportsVision: true,
+			ID:               "gemini-2.5-pro",
+			Name:             "Gemini 2.5 Pro",
+			Description:      "Best for complex reasoning tasks",
+			ContextWindow:    1000000,
+			MaxOutputTokens:  65536,
+			SupportsTools:    true,
+			SupportsVision:   true,
+			SupportsJSONMode: true,
+			Pricing:          &llm.ModelPricing{InputPerMillion: 1.25, OutputPerMillion: 10.00},
 		},
 		{
-			ID:             "gemini-2.0-flash",
-			Name:           "Gemini 2.0 Flash",
-			Description:    "Stable multimodal model",
-			ContextWindow:  1000000,
-			SupportsTools:  true,
-			SupportsVision: true,
+			ID:               "gemini-2.0-flash",
+			Name:             "Gemini 2.0 Flash",
+			Description:      "Stable multimodal model",
+			ContextWindow:    1000000,
+			MaxOutputTokens:  8192,
+			SupportsTools:    true,
+			SupportsVision:   true,
+			SupportsJSONMode: true,
+			Pricing:          &llm.ModelPricing{InputPerMillion: 0.10, OutputPerMillion: 0.40},
 		},
 	}
 }
@@ -74,25 +89,38 @@ func (c *Client) SupportsVision() bool {
 	return true
 }
 
-// ValidateKey validates an API key
-func (c *Client) ValidateKey(ctx context.Context, key string) error {
-	url := fmt.Sprintf("%s/models?key=%s", c.baseURL, key)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// ValidateKey checks a key with a one-token generation
+func (c *Client) ValidateKey(ctx context.Context, check llm.KeyCheck) error {
+	model := check.Model
+	if model == "" {
+		model = checkModel
+	}
+	body := map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{"role": "user", "parts": []map[string]interface{}{{"text": "Hi"}}},
+		},
+		"generationConfig": map[string]interface{}{"maxOutputTokens": 1},
+	}
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	endpoint := fmt.Sprintf("%s/models/%s:generateContent?key=%s", c.baseURL, url.PathEscape(model), url.QueryEscape(check.Key))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonBody))
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return err
+		// The request URL holds the key, so leave it out of the error
+		return llm.KeyNetworkError(errors.Unwrap(err))
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("invalid API key: status %d", resp.StatusCode)
-	}
-
-	return nil
+	return llm.KeyErrorFromResponse(resp)
 }
 
 // HasConfiguredKey returns whether the provider has an API key configured
@@ -120,20 +148,62 @@ func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Str
 	if req.MaxTokens > 0 {
 		generationConfig["maxOutputTokens"] = req.MaxTokens
 	}
-	if req.Temperature > 0 {
-		generationConfig["temperature"] = req.Temperature
+	if temperature, ok := req.SamplingTemperature(); ok {
+		generationConfig["temperature"] = temperature
+	}
+	if req.Deterministic {
+		generationConfig["topK"] = 1
+	} else if req.TopP > 0 {
+		generationConfig["topP"] = req.TopP
+	}
+	if req.FrequencyPenalty != 0 {
+		generationConfig["frequencyPenalty"] = req.FrequencyPenalty
+	}
+	if req.PresencePenalty != 0 {
+		generationConfig["presencePenalty"] = req.PresencePenalty
+	}
+	if len(req.Stop) > 0 {
+		generationConfig["stopSequences"] = req.Stop
+	}
+	if seed, ok := req.SamplingSeed(); ok {
+		generationConfig["seed"] = seed
+	}
+	if req.JSONMode {
+		generationConfig["responseMimeType"] = "application/json"
 	}
 	if len(generationConfig) > 0 {
 		body["generationConfig"] = generationConfig
 	}
 
-	// Add tools
+	// Add tools. Gemini may answer with several function calls in one turn,
+	// which are streamed back together and answered together.
+	var tools []map[string]interface{}
 	if len(req.Tools) > 0 {
-		body["tools"] = []map[string]interface{}{
-			{
-				"functionDeclarations": c.convertTools(req.Tools),
-			},
+		tools = append(tools, map[string]interface{}{
+			"functionDeclarations": c.convertTools(req.Tools),
+		})
+	}
+
+	// Ground responses with Google Search
+	if req.SearchGrounding {
+		tools = append(tools, map[string]interface{}{
+			"googleSearch": map[string]interface{}{},
+		})
+	}
+	if len(tools) > 0 {
+		body["tools"] = tools
+	}
+
+	// Add safety settings
+	if len(req.SafetySettings) > 0 {
+		safetySettings := make([]map[string]interface{}, len(req.SafetySettings))
+		for i, setting := range req.SafetySettings {
+			safetySettings[i] = map[string]interface{}{
+				"category":  setting.Category,
+				"threshold": setting.Threshold,
+			}
 		}
+		body["safetySettings"] = safetySettings
 	}
 
 	jsonBody, err := json.Marshal(body)
@@ -141,7 +211,8 @@ func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Str
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/models/%s:streamGenerateContent?key=%s&alt=sse", c.baseURL, req.Model, c.apiKey)
+	apiKey, _ := llm.RequestCredentials(ctx, c.Name(), c.apiKey, c.baseURL)
+	url := fmt.Sprintf("%s/models/%s:streamGenerateContent?key=%s&alt=sse", c.baseURL, req.Model, apiKey)
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -189,7 +260,17 @@ func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Str
 				continue
 			}
 
+			// The prompt itself was rejected by the safety filters
+			if streamResp.PromptFeedback != nil && streamResp.PromptFeedback.BlockReason != "" {
+				chunks <- llm.StreamChunk{
+					Error: fmt.Errorf("prompt blocked: %s", strings.ToLower(streamResp.PromptFeedback.BlockReason)),
+				}
+				return
+			}
+
 			for _, candidate := range streamResp.Candidates {
+				// Collect all function calls in this candidate so parallel calls arrive together
+				var toolCalls []llm.ToolCall
 				for _, part := range candidate.Content.Parts {
 					if part.Text != "" {
 						chunks <- llm.StreamChunk{
@@ -198,15 +279,24 @@ func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Str
 					}
 
 					if part.FunctionCall != nil {
-						chunks <- llm.StreamChunk{
-							ToolCalls: []llm.ToolCall{
-								{
-									ID:         part.FunctionCall.Name, // Gemini doesn't provide IDs
-									Name:       part.FunctionCall.Name,
-									Parameters: part.FunctionCall.Args,
-								},
-							},
-						}
+						// Gemini doesn't provide call IDs, so generate our own; the
+						// function name is recovered from history when responding
+						toolCalls = append(toolCalls, llm.ToolCall{
+							ID:         "call_" + uuid.New().String(),
+							Name:       part.FunctionCall.Name,
+							Parameters: part.FunctionCall.Args,
+						})
+					}
+				}
+				if len(toolCalls) > 0 {
+					chunks <- llm.StreamChunk{
+						ToolCalls: toolCalls,
+					}
+				}
+
+				if citations := groundingCitations(candidate.GroundingMetadata); len(citations) > 0 {
+					chunks <- llm.StreamChunk{
+						Citations: citations,
 					}
 				}
 
@@ -215,9 +305,17 @@ func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Str
 					if finishReason == "stop" || finishReason == "end_turn" {
 						finishReason = "stop"
 					}
-					chunks <- llm.StreamChunk{
+					chunk := llm.StreamChunk{
 						FinishReason: finishReason,
 					}
+					if streamResp.UsageMetadata.TotalTokenCount > 0 {
+						chunk.Usage = &llm.Usage{
+							PromptTokens:     streamResp.UsageMetadata.PromptTokenCount,
+							CompletionTokens: streamResp.UsageMetadata.CandidatesTokenCount,
+							TotalTokens:      streamResp.UsageMetadata.TotalTokenCount,
+						}
+					}
+					chunks <- chunk
 				}
 			}
 		}
@@ -236,6 +334,10 @@ func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Str
 func (c *Client) convertMessages(messages []llm.Message) []map[string]interface{} {
 	var contents []map[string]interface{}
 
+	// Gemini matches function responses by name, so remember which
+	// function each generated call ID belongs to
+	callNames := make(map[string]string)
+
 	for _, msg := range messages {
 		role := msg.Role
 		if role == "assistant" {
@@ -268,18 +370,41 @@ func (c *Client) convertMessages(messages []llm.Message) []map[string]interface{
 			})
 		}
 
+		// Handle function calls made by the model
+		for _, tc := range msg.ToolCalls {
+			callNames[tc.ID] = tc.Name
+			parts = append(parts, map[string]interface{}{
+				"functionCall": map[string]interface{}{
+					"name": tc.Name,
+					"args": tc.Parameters,
+				},
+			})
+		}
+
 		// Handle tool responses
 		if msg.ToolCallID != "" {
-			parts = []map[string]interface{}{
-				{
-					"functionResponse": map[string]interface{}{
-						"name": msg.ToolCallID,
-						"response": map[string]interface{}{
-							"content": msg.Content,
-						},
+			name, ok := callNames[msg.ToolCallID]
+			if !ok {
+				// Older histories used the function name as the call ID
+				name = msg.ToolCallID
+			}
+			part := map[string]interface{}{
+				"functionResponse": map[string]interface{}{
+					"name": name,
+					"response": map[string]interface{}{
+						"content": msg.Content,
 					},
 				},
 			}
+
+			// Responses to parallel calls must be sent back in a single turn
+			if n := len(contents); n > 0 && isFunctionResponseTurn(contents[n-1]) {
+				contents[n-1]["parts"] = append(contents[n-1]["parts"].([]map[string]interface{}), part)
+				continue
+			}
+
+			role = "user"
+			parts = []map[string]interface{}{part}
 		}
 
 		contents = append(contents, map[string]interface{}{
@@ -291,6 +416,16 @@ func (c *Client) convertMessages(messages []llm.Message) []map[string]interface{
 	return contents
 }
 
+// isFunctionResponseTurn reports whether a content entry holds function responses
+func isFunctionResponseTurn(content map[string]interface{}) bool {
+	parts, ok := content["parts"].([]map[string]interface{})
+	if !ok || len(parts) == 0 {
+		return false
+	}
+	_, ok = parts[0]["functionResponse"]
+	return ok
+}
+
 // convertTools converts llm.ToolDefinition to Gemini format
 func (c *Client) convertTools(tools []llm.ToolDefinition) []map[string]interface{} {
 	result := make([]map[string]interface{}, len(tools))
@@ -324,10 +459,42 @@ type geminiStreamResponse struct {
 			Category    string `json:"category"`
 			Probability string `json:"probability"`
 		} `json:"safetyRatings"`
+		GroundingMetadata *geminiGroundingMetadata `json:"groundingMetadata"`
 	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
 	UsageMetadata struct {
 		PromptTokenCount     int `json:"promptTokenCount"`
 		CandidatesTokenCount int `json:"candidatesTokenCount"`
 		TotalTokenCount      int `json:"totalTokenCount"`
 	} `json:"usageMetadata"`
 }
+
+// geminiGroundingMetadata holds the sources of a Google Search grounded response
+type geminiGroundingMetadata struct {
+	GroundingChunks []struct {
+		Web *struct {
+			URI   string `json:"uri"`
+			Title string `json:"title"`
+		} `json:"web"`
+	} `json:"groundingChunks"`
+}
+
+// groundingCitations extracts the web sources from grounding metadata
+func groundingCitations(metadata *geminiGroundingMetadata) []llm.Citation {
+	if metadata == nil {
+		return nil
+	}
+
+	var citations []llm.Citation
+	for _, chunk := range metadata.GroundingChunks {
+		if chunk.Web != nil && chunk.Web.URI != "" {
+			citations = append(citations, llm.Citation{
+				URI:   chunk.Web.URI,
+				Title: chunk.Web.Title,
+			})
+		}
+	}
+	return citations
+}
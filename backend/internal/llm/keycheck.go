@@ -0,0 +1,223 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons a key check fails
+const (
+	KeyReasonInvalid           = "invalid_key"
+	KeyReasonNoBilling         = "no_billing"
+	KeyReasonModelNotPermitted = "model_not_permitted"
+	KeyReasonNetwork           = "network"
+	KeyReasonProviderError     = "provider_error"
+)
+
+const (
+	// maxKeyErrorBody limits how much of an error response is read
+	maxKeyErrorBody = 64 * 1024
+
+	// keyCheckTimeout bounds a single key check
+	keyCheckTimeout = 15 * time.Second
+)
+
+// KeyCheck is a key to validate. Providers check it with a minimal real
+// request, such as a one-token completion.
+type KeyCheck struct {
+	Key     string
+	BaseURL string // Endpoint to check against; "" uses the provider's default
+	Model   string // Model to make the request with; "" uses a small default
+}
+
+// KeyError is returned when a key check fails
+type KeyError struct {
+	Reason     string // One of the KeyReason constants
+	StatusCode int    // 0 if the provider couldn't be reached
+	Message    string // The provider's error message, if any
+}
+
+func (e *KeyError) Error() string {
+	if e.Message == "" {
+		return e.Reason
+	}
+	return e.Reason + ": " + e.Message
+}
+
+// KeyNetworkError reports that the provider couldn't be reached
+func KeyNetworkError(err error) error {
+	return &KeyError{Reason: KeyReasonNetwork, Message: err.Error()}
+}
+
+// KeyErrorFromResponse classifies a provider's response to a key check.
+// Returns nil if it shows the key works, which includes rate limiting that
+// isn't caused by an exhausted quota.
+func KeyErrorFromResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxKeyErrorBody))
+	message := errorMessage(body)
+	reason := classifyKeyFailure(resp.StatusCode, strings.ToLower(message+" "+string(body)))
+	if reason == "" {
+		return nil
+	}
+	return &KeyError{Reason: reason, StatusCode: resp.StatusCode, Message: message}
+}
+
+// classifyKeyFailure picks the reason for an error response from its status
+// and text. Providers word these differently, so the text is checked for the
+// usual phrases before falling back to the status.
+func classifyKeyFailure(status int, text string) string {
+	switch {
+	case status == http.StatusPaymentRequired,
+		containsAny(text, "insufficient_quota", "billing", "credit balance", "exceeded your current quota", "payment"):
+		return KeyReasonNoBilling
+	case status == http.StatusUnauthorized,
+		containsAny(text, "api key not valid", "api_key_invalid", "invalid api key", "invalid x-api-key", "incorrect api key"):
+		return KeyReasonInvalid
+	case (status == http.StatusForbidden || status == http.StatusNotFound || status == http.StatusBadRequest) &&
+		strings.Contains(text, "model") &&
+		containsAny(text, "not found", "does not exist", "not_found", "access", "permission", "not allowed"):
+		return KeyReasonModelNotPermitted
+	case status == http.StatusForbidden:
+		return KeyReasonInvalid
+	case status == http.StatusTooManyRequests:
+		return ""
+	default:
+		return KeyReasonProviderError
+	}
+}
+
+// errorMessage pulls the message out of the error bodies providers send:
+// {"error": {"message": ...}}, {"error": "..."} or plain text
+func errorMessage(body []byte) string {
+	var parsed struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		var nested struct {
+			Message string `json:"message"`
+		}
+		var text string
+		switch {
+		case json.Unmarshal(parsed.Error, &nested) == nil && nested.Message != "":
+			return nested.Message
+		case json.Unmarshal(parsed.Error, &text) == nil && text != "":
+			return text
+		case parsed.Message != "":
+			return parsed.Message
+		}
+	}
+	text := strings.TrimSpace(string(body))
+	if len(text) > 300 {
+		text = text[:300] + "..."
+	}
+	return text
+}
+
+func containsAny(text string, phrases ...string) bool {
+	for _, phrase := range phrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateKey checks a key against a provider
+func (m *Manager) ValidateKey(ctx context.Context, providerName string, check KeyCheck) error {
+	provider, err := m.GetProvider(providerName)
+	if err != nil {
+		return err
+	}
+	if check.BaseURL != "" && !m.SupportsBaseURL(providerName) {
+		return fmt.Errorf("provider %s does not support a custom base URL", providerName)
+	}
+	return provider.ValidateKey(ctx, check)
+}
+
+// KeyStatus is the outcome of a key check
+type KeyStatus struct {
+	Valid     bool      `json:"valid"`
+	Reason    string    `json:"reason,omitempty"`  // Why the check failed
+	Message   string    `json:"message,omitempty"` // The provider's error message
+	CheckedAt time.Time `json:"checked_at"`
+	Cached    bool      `json:"cached"` // Whether the result is from an earlier check
+}
+
+// KeyValidator checks provider keys and remembers the results for a while,
+// so showing the status of several keys doesn't call every provider each time
+type KeyValidator struct {
+	manager *Manager
+	ttl     time.Duration
+
+	results map[string]KeyStatus
+	mu      sync.Mutex
+}
+
+// NewKeyValidator creates a new key validator whose results expire after ttl
+func NewKeyValidator(manager *Manager, ttl time.Duration) *KeyValidator {
+	return &KeyValidator{
+		manager: manager,
+		ttl:     ttl,
+		results: make(map[string]KeyStatus),
+	}
+}
+
+// Check validates a key, reusing an unexpired result unless refresh is set.
+// Network failures aren't remembered, since they say nothing about the key.
+func (v *KeyValidator) Check(ctx context.Context, providerName string, check KeyCheck, refresh bool) (KeyStatus, error) {
+	id := keyFingerprint(providerName, check)
+	now := time.Now()
+
+	v.mu.Lock()
+	cached, ok := v.results[id]
+	v.mu.Unlock()
+	if ok && !refresh && now.Sub(cached.CheckedAt) < v.ttl {
+		cached.Cached = true
+		return cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, keyCheckTimeout)
+	defer cancel()
+
+	status := KeyStatus{Valid: true, CheckedAt: now}
+	if err := v.manager.ValidateKey(ctx, providerName, check); err != nil {
+		var keyErr *KeyError
+		if !errors.As(err, &keyErr) {
+			return KeyStatus{}, err
+		}
+		status = KeyStatus{Reason: keyErr.Reason, Message: keyErr.Message, CheckedAt: now}
+		if keyErr.Reason == KeyReasonNetwork {
+			return status, nil
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for fingerprint, result := range v.results {
+		if now.Sub(result.CheckedAt) >= v.ttl {
+			delete(v.results, fingerprint)
+		}
+	}
+	v.results[id] = status
+	return status, nil
+}
+
+// keyFingerprint identifies a check without keeping the key itself
+func keyFingerprint(providerName string, check KeyCheck) string {
+	sum := sha256.Sum256([]byte(providerName + "\x00" + check.Key + "\x00" + check.BaseURL + "\x00" + check.Model))
+	return hex.EncodeToString(sum[:])
+}
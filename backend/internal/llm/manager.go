@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 )
 
 // Manager manages LLM providers
 type Manager struct {
 	providers map[string]Provider
+	stats     *statsRecorder
+	catalog   *modelCatalog
 	mu        sync.RWMutex
 }
 
@@ -16,6 +19,8 @@ type Manager struct {
 func NewManager() *Manager {
 	return &Manager{
 		providers: make(map[string]Provider),
+		stats:     newStatsRecorder(),
+		catalog:   newModelCatalog(),
 	}
 }
 
@@ -38,16 +43,14 @@ func (m *Manager) GetProvider(name string) (Provider, error) {
 	return provider, nil
 }
 
-// ListProviders returns all registered providers
+// ListProviders returns all registered providers, with their models from
+// the model catalog
 func (m *Manager) ListProviders() []ProviderInfo {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
 	var infos []ProviderInfo
-	for name, provider := range m.providers {
+	for name, provider := range m.snapshotProviders() {
 		infos = append(infos, ProviderInfo{
 			Name:          name,
-			Models:        provider.Models(),
+			Models:        m.catalog.models(name, provider),
 			SupportsTools: provider.SupportsTools(),
 			SupportsVision: provider.SupportsVision(),
 		})
@@ -61,7 +64,72 @@ func (m *Manager) Chat(ctx context.Context, providerName string, req *ChatReques
 	if err != nil {
 		return nil, err
 	}
-	return provider.Chat(ctx, req)
+
+	ctx = withDebugModel(ctx, providerName, req.Model)
+	start := time.Now()
+	stream, err := provider.Chat(ctx, req)
+	if err != nil {
+		m.stats.record(providerName, req.Model, requestSample{at: start, duration: time.Since(start), failed: true}, err.Error())
+		return nil, err
+	}
+	return m.measure(ctx, providerName, req.Model, start, stream), nil
+}
+
+// measure forwards a response stream while recording latency, throughput and errors
+func (m *Manager) measure(ctx context.Context, providerName, model string, start time.Time, stream <-chan StreamChunk) <-chan StreamChunk {
+	out := make(chan StreamChunk, 100)
+
+	go func() {
+		defer close(out)
+
+		sample := requestSample{at: start}
+		var errMsg string
+		firstChunk := true
+		for chunk := range stream {
+			if firstChunk {
+				sample.firstToken = time.Since(start)
+				firstChunk = false
+			}
+			if chunk.Usage != nil {
+				sample.completionTokens = chunk.Usage.CompletionTokens
+			}
+			if chunk.Error != nil && errMsg == "" {
+				errMsg = chunk.Error.Error()
+			}
+
+			// Keep draining if the consumer has gone away so the provider can finish
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+			}
+		}
+
+		// Requests cancelled by the caller say nothing about the provider
+		if ctx.Err() != nil {
+			return
+		}
+
+		sample.duration = time.Since(start)
+		sample.failed = errMsg != ""
+		m.stats.record(providerName, model, sample, errMsg)
+	}()
+
+	return out
+}
+
+// Stats returns rolling latency, error-rate and throughput statistics per provider and model
+func (m *Manager) Stats() []ProviderStats {
+	return m.stats.snapshot()
+}
+
+// ProviderHealth returns the health of a provider based on its recent requests
+func (m *Manager) ProviderHealth(providerName string) string {
+	for _, ps := range m.stats.snapshot() {
+		if ps.Provider == providerName {
+			return ps.Health
+		}
+	}
+	return HealthUnknown
 }
 
 // HasValidKey checks if a provider has a valid API key configured
@@ -89,6 +157,16 @@ func (m *Manager) SetAPIKey(providerName, key string) error {
 	return nil
 }
 
+// SupportsBaseURL reports whether a provider can be pointed at a custom
+// endpoint
+func (m *Manager) SupportsBaseURL(providerName string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.providers[providerName].(BaseURLSetter)
+	return ok
+}
+
 // ProviderInfo contains information about a provider
 type ProviderInfo struct {
 	Name           string  `json:"name"`
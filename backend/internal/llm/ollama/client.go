@@ -27,7 +27,7 @@ func NewClient(baseURL string) *Client {
 	}
 	return &Client{
 		baseURL: baseURL,
-		client:  &http.Client{},
+		client:  llm.NewHTTPClient(),
 	}
 }
 
@@ -38,13 +38,30 @@ func (c *Client) Name() string {
 
 // Models returns available models by querying Ollama
 func (c *Client) Models() []llm.Model {
-	// Fetch models from Ollama
-	resp, err := c.client.Get(c.baseURL + "/api/tags")
+	models, err := c.FetchModels(context.Background())
 	if err != nil {
 		return []llm.Model{}
 	}
+	return models
+}
+
+// FetchModels queries Ollama for the models that have been pulled
+func (c *Client) FetchModels(ctx context.Context) ([]llm.Model, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Ollama: %w", err)
+	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error: status %d", resp.StatusCode)
+	}
+
 	var result struct {
 		Models []struct {
 			Name       string `json:"name"`
@@ -61,7 +78,7 @@ func (c *Client) Models() []llm.Model {
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return []llm.Model{}
+		return nil, fmt.Errorf("failed to decode models: %w", err)
 	}
 
 	models := make([]llm.Model, len(result.Models))
@@ -74,16 +91,17 @@ func (c *Client) Models() []llm.Model {
 		contextWindow := getModelContextWindow(m.Name)
 
 		models[i] = llm.Model{
-			ID:             m.Name,
-			Name:           m.Name,
-			Description:    fmt.Sprintf("Local model - %s", m.Details.ParameterSize),
-			ContextWindow:  contextWindow,
-			SupportsTools:  supportsTools,
-			SupportsVision: supportsVision,
+			ID:               m.Name,
+			Name:             m.Name,
+			Description:      fmt.Sprintf("Local model - %s", m.Details.ParameterSize),
+			ContextWindow:    contextWindow,
+			SupportsTools:    supportsTools,
+			SupportsVision:   supportsVision,
+			SupportsJSONMode: true, // Ollama constrains any model's output with format "json"
 		}
 	}
 
-	return models
+	return models, nil
 }
 
 // SupportsTools returns whether the provider supports tool calling
@@ -96,24 +114,41 @@ func (c *Client) SupportsVision() bool {
 	return false // Depends on model, but generally limited
 }
 
-// ValidateKey validates the connection (Ollama doesn't use API keys)
-func (c *Client) ValidateKey(ctx context.Context, key string) error {
+// ValidateKey checks that Ollama is reachable and, if a model is given, that
+// it has been pulled. Ollama doesn't use API keys.
+func (c *Client) ValidateKey(ctx context.Context, check llm.KeyCheck) error {
 	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/tags", nil)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to connect to Ollama: %w", err)
+		return llm.KeyNetworkError(fmt.Errorf("failed to connect to Ollama: %w", err))
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Ollama not available: status %d", resp.StatusCode)
+	if err := llm.KeyErrorFromResponse(resp); err != nil {
+		return err
+	}
+	if check.Model == "" {
+		return nil
 	}
 
-	return nil
+	var result struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return &llm.KeyError{Reason: llm.KeyReasonProviderError, StatusCode: resp.StatusCode, Message: "failed to read models"}
+	}
+	for _, m := range result.Models {
+		if m.Name == check.Model || strings.TrimSuffix(m.Name, ":latest") == check.Model {
+			return nil
+		}
+	}
+	return &llm.KeyError{Reason: llm.KeyReasonModelNotPermitted, StatusCode: resp.StatusCode, Message: "model not pulled: " + check.Model}
 }
 
 // HasConfiguredKey returns true since Ollama doesn't require an API key
@@ -169,11 +204,33 @@ func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Str
 	if len(req.Tools) > 0 && isToolCapableModel(req.Model) {
 		body["tools"] = c.convertTools(req.Tools)
 	}
+	if req.JSONMode {
+		body["format"] = "json"
+	}
 
-	if req.Temperature > 0 {
-		body["options"] = map[string]interface{}{
-			"temperature": req.Temperature,
-		}
+	options := map[string]interface{}{}
+	if temperature, ok := req.SamplingTemperature(); ok {
+		options["temperature"] = temperature
+	}
+	if req.Deterministic {
+		options["top_k"] = 1
+	} else if req.TopP > 0 {
+		options["top_p"] = req.TopP
+	}
+	if req.FrequencyPenalty != 0 {
+		options["frequency_penalty"] = req.FrequencyPenalty
+	}
+	if req.PresencePenalty != 0 {
+		options["presence_penalty"] = req.PresencePenalty
+	}
+	if len(req.Stop) > 0 {
+		options["stop"] = req.Stop
+	}
+	if seed, ok := req.SamplingSeed(); ok {
+		options["seed"] = seed
+	}
+	if len(options) > 0 {
+		body["options"] = options
 	}
 
 	jsonBody, err := json.Marshal(body)
@@ -13,7 +13,14 @@ import (
 	"github.com/jacklau/prism/internal/llm"
 )
 
-// Client implements the LLM provider interface for OpenAI
+// DefaultBaseURL is OpenAI's API endpoint
+const DefaultBaseURL = "https://api.openai.com/v1"
+
+// checkModel is the model keys are checked with on OpenAI's own API
+const checkModel = "gpt-4o-mini"
+
+// Client implements the LLM provider interface for OpenAI and servers with
+// an OpenAI-compatible API, such as vLLM, LM Studio, llama.cpp and LiteLLM
 type Client struct {
 	apiKey  string
 	baseURL string
@@ -24,8 +31,8 @@ type Client struct {
 func NewClient(apiKey string) *Client {
 	return &Client{
 		apiKey:  apiKey,
-		baseURL: "https://api.openai.com/v1",
-		client:  &http.Client{},
+		baseURL: DefaultBaseURL,
+		client:  llm.NewHTTPClient(),
 	}
 }
 
@@ -38,52 +45,70 @@ func (c *Client) Name() string {
 func (c *Client) Models() []llm.Model {
 	return []llm.Model{
 		{
-			ID:             "o3",
-			Name:           "OpenAI o3",
-			Description:    "Most powerful reasoning model",
-			ContextWindow:  200000,
-			SupportsTools:  true,
-			SupportsVision: true,
+			ID:               "o3",
+			Name:             "OpenAI o3",
+			Description:      "Most powerful reasoning model",
+			ContextWindow:    200000,
+			MaxOutputTokens:  100000,
+			SupportsTools:    true,
+			SupportsVision:   true,
+			SupportsJSONMode: true,
+			Pricing:          &llm.ModelPricing{InputPerMillion: 2.00, OutputPerMillion: 8.00},
 		},
 		{
-			ID:             "o4-mini",
-			Name:           "OpenAI o4-mini",
-			Description:    "Fast, cost-efficient reasoning",
-			ContextWindow:  128000,
-			SupportsTools:  true,
-			SupportsVision: true,
+			ID:               "o4-mini",
+			Name:             "OpenAI o4-mini",
+			Description:      "Fast, cost-efficient reasoning",
+			ContextWindow:    128000,
+			MaxOutputTokens:  100000,
+			SupportsTools:    true,
+			SupportsVision:   true,
+			SupportsJSONMode: true,
+			Pricing:          &llm.ModelPricing{InputPerMillion: 1.10, OutputPerMillion: 4.40},
 		},
 		{
-			ID:             "gpt-4.1",
-			Name:           "GPT-4.1",
-			Description:    "Latest flagship model",
-			ContextWindow:  128000,
-			SupportsTools:  true,
-			SupportsVision: true,
+			ID:               "gpt-4.1",
+			Name:             "GPT-4.1",
+			Description:      "Latest flagship model",
+			ContextWindow:    128000,
+			MaxOutputTokens:  32768,
+			SupportsTools:    true,
+			SupportsVision:   true,
+			SupportsJSONMode: true,
+			Pricing:          &llm.ModelPricing{InputPerMillion: 2.00, OutputPerMillion: 8.00},
 		},
 		{
-			ID:             "gpt-4.1-mini",
-			Name:           "GPT-4.1 Mini",
-			Description:    "Fast and affordable",
-			ContextWindow:  128000,
-			SupportsTools:  true,
-			SupportsVision: true,
+			ID:               "gpt-4.1-mini",
+			Name:             "GPT-4.1 Mini",
+			Description:      "Fast and affordable",
+			ContextWindow:    128000,
+			MaxOutputTokens:  32768,
+			SupportsTools:    true,
+			SupportsVision:   true,
+			SupportsJSONMode: true,
+			Pricing:          &llm.ModelPricing{InputPerMillion: 0.40, OutputPerMillion: 1.60},
 		},
 		{
-			ID:             "gpt-4o",
-			Name:           "GPT-4o",
-			Description:    "Legacy multimodal model",
-			ContextWindow:  128000,
-			SupportsTools:  true,
-			SupportsVision: true,
+			ID:               "gpt-4o",
+			Name:             "GPT-4o",
+			Description:      "Legacy multimodal model",
+			ContextWindow:    128000,
+			MaxOutputTokens:  16384,
+			SupportsTools:    true,
+			SupportsVision:   true,
+			SupportsJSONMode: true,
+			Pricing:          &llm.ModelPricing{InputPerMillion: 2.50, OutputPerMillion: 10.00},
 		},
 		{
-			ID:             "gpt-4o-mini",
-			Name:           "GPT-4o Mini",
-			Description:    "Legacy fast model",
-			ContextWindow:  128000,
-			SupportsTools:  true,
-			SupportsVision: true,
+			ID:               "gpt-4o-mini",
+			Name:             "GPT-4o Mini",
+			Description:      "Legacy fast model",
+			ContextWindow:    128000,
+			MaxOutputTokens:  16384,
+			SupportsTools:    true,
+			SupportsVision:   true,
+			SupportsJSONMode: true,
+			Pricing:          &llm.ModelPricing{InputPerMillion: 0.15, OutputPerMillion: 0.60},
 		},
 	}
 }
@@ -98,26 +123,85 @@ func (c *Client) SupportsVision() bool {
 	return true
 }
 
-// ValidateKey validates an API key
-func (c *Client) ValidateKey(ctx context.Context, key string) error {
-	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/models", nil)
+// ValidateKey checks a key with a one-token completion. Without a model,
+// OpenAI-compatible servers are checked with the first model they list.
+func (c *Client) ValidateKey(ctx context.Context, check llm.KeyCheck) error {
+	baseURL := DefaultBaseURL
+	if check.BaseURL != "" {
+		baseURL = strings.TrimRight(check.BaseURL, "/")
+	}
+
+	model := check.Model
+	if model == "" {
+		model = checkModel
+		if baseURL != DefaultBaseURL {
+			listed, err := c.firstModel(ctx, baseURL, check.Key)
+			if err != nil {
+				return err
+			}
+			model = listed
+		}
+	}
+
+	body := map[string]interface{}{
+		"model":    model,
+		"messages": []map[string]interface{}{{"role": "user", "content": "Hi"}},
+	}
+	// OpenAI's reasoning models only take max_completion_tokens, which
+	// compatible servers don't all know yet
+	if baseURL == DefaultBaseURL {
+		body["max_completion_tokens"] = 1
+	} else {
+		body["max_tokens"] = 1
+	}
+
+	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/chat/completions", bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+check.Key)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return llm.KeyNetworkError(err)
+	}
+	defer resp.Body.Close()
+
+	return llm.KeyErrorFromResponse(resp)
+}
 
+// firstModel returns the first model a server lists for a key
+func (c *Client) firstModel(ctx context.Context, baseURL, key string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/models", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
 	req.Header.Set("Authorization", "Bearer "+key)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return err
+		return "", llm.KeyNetworkError(err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("invalid API key: status %d", resp.StatusCode)
+	if err := llm.KeyErrorFromResponse(resp); err != nil {
+		return "", err
 	}
 
-	return nil
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || len(result.Data) == 0 {
+		return "", &llm.KeyError{Reason: llm.KeyReasonProviderError, StatusCode: resp.StatusCode, Message: "server lists no models"}
+	}
+	return result.Data[0].ID, nil
 }
 
 // HasConfiguredKey returns whether the provider has an API key configured
@@ -130,6 +214,15 @@ func (c *Client) SetAPIKey(key string) {
 	c.apiKey = key
 }
 
+// SetBaseURL points the client at an OpenAI-compatible server, e.g.
+// "http://localhost:8000/v1"; "" restores OpenAI's endpoint
+func (c *Client) SetBaseURL(baseURL string) {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	c.baseURL = strings.TrimRight(baseURL, "/")
+}
+
 // Chat sends a chat request and returns a streaming response
 func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.StreamChunk, error) {
 	// Build request body
@@ -139,27 +232,46 @@ func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Str
 		"stream":   true,
 	}
 
-	if req.Temperature > 0 {
-		body["temperature"] = req.Temperature
+	if temperature, ok := req.SamplingTemperature(); ok {
+		body["temperature"] = temperature
 	}
 	if req.MaxTokens > 0 {
 		body["max_tokens"] = req.MaxTokens
 	}
+	if req.TopP > 0 && !req.Deterministic {
+		body["top_p"] = req.TopP
+	}
+	if req.FrequencyPenalty != 0 {
+		body["frequency_penalty"] = req.FrequencyPenalty
+	}
+	if req.PresencePenalty != 0 {
+		body["presence_penalty"] = req.PresencePenalty
+	}
+	if len(req.Stop) > 0 {
+		body["stop"] = req.Stop
+	}
+	if seed, ok := req.SamplingSeed(); ok {
+		body["seed"] = seed
+	}
 	if len(req.Tools) > 0 {
 		body["tools"] = c.convertTools(req.Tools)
 	}
+	if req.JSONMode {
+		body["response_format"] = map[string]interface{}{"type": "json_object"}
+	}
 
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/chat/completions", bytes.NewReader(jsonBody))
+	apiKey, baseURL := llm.RequestCredentials(ctx, c.Name(), c.apiKey, c.baseURL)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(baseURL, "/")+"/chat/completions", bytes.NewReader(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.client.Do(httpReq)
@@ -191,42 +303,56 @@ func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Str
 		}
 		var toolCallAccumulators []toolCallAccumulator
 
+		// emitToolCalls parses the accumulated arguments and emits the final
+		// tool calls
+		emitToolCalls := func() {
+			if len(toolCallAccumulators) == 0 {
+				return
+			}
+			finalToolCalls := make([]llm.ToolCall, len(toolCallAccumulators))
+			for i, acc := range toolCallAccumulators {
+				var params map[string]interface{}
+				argsStr := acc.Arguments.String()
+				if argsStr != "" {
+					if err := json.Unmarshal([]byte(argsStr), &params); err != nil {
+						params = make(map[string]interface{})
+					}
+				} else {
+					params = make(map[string]interface{})
+				}
+				// Some compatible servers leave out call IDs, which tool
+				// results need to refer to
+				id := acc.ID
+				if id == "" {
+					id = fmt.Sprintf("call_%d", i)
+				}
+				finalToolCalls[i] = llm.ToolCall{
+					ID:         id,
+					Name:       acc.Name,
+					Parameters: params,
+				}
+			}
+			toolCallAccumulators = nil
+			chunks <- llm.StreamChunk{
+				ToolCalls:    finalToolCalls,
+				FinishReason: "tool_calls",
+			}
+		}
+
 		for scanner.Scan() {
 			line := scanner.Text()
 
-			// Skip empty lines and non-data lines
-			if !strings.HasPrefix(line, "data: ") {
+			// Skip empty lines and non-data lines. Compatible servers don't
+			// all put a space after the colon.
+			if !strings.HasPrefix(line, "data:") {
 				continue
 			}
 
-			data := strings.TrimPrefix(line, "data: ")
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
 
 			// Check for stream end
 			if data == "[DONE]" {
-				// Parse accumulated arguments and emit final tool calls
-				if len(toolCallAccumulators) > 0 {
-					finalToolCalls := make([]llm.ToolCall, len(toolCallAccumulators))
-					for i, acc := range toolCallAccumulators {
-						var params map[string]interface{}
-						argsStr := acc.Arguments.String()
-						if argsStr != "" {
-							if err := json.Unmarshal([]byte(argsStr), &params); err != nil {
-								params = make(map[string]interface{})
-							}
-						} else {
-							params = make(map[string]interface{})
-						}
-						finalToolCalls[i] = llm.ToolCall{
-							ID:         acc.ID,
-							Name:       acc.Name,
-							Parameters: params,
-						}
-					}
-					chunks <- llm.StreamChunk{
-						ToolCalls:    finalToolCalls,
-						FinishReason: "tool_calls",
-					}
-				}
+				emitToolCalls()
 				break
 			}
 
@@ -284,7 +410,11 @@ func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest) (<-chan llm.Str
 			chunks <- llm.StreamChunk{
 				Error: err,
 			}
+			return
 		}
+
+		// Some compatible servers close the stream without sending [DONE]
+		emitToolCalls()
 	}()
 
 	return chunks, nil
@@ -21,8 +21,9 @@ type Provider interface {
 	// SupportsVision returns whether the provider supports vision/images
 	SupportsVision() bool
 
-	// ValidateKey validates an API key
-	ValidateKey(ctx context.Context, key string) error
+	// ValidateKey checks an API key with a minimal real request. A rejected
+	// key or unreachable provider is reported as a *KeyError.
+	ValidateKey(ctx context.Context, check KeyCheck) error
 
 	// HasConfiguredKey returns whether the provider has an API key configured
 	// Returns true for providers that don't require an API key (e.g., Ollama)
@@ -32,15 +33,32 @@ type Provider interface {
 	SetAPIKey(key string)
 }
 
+// BaseURLSetter is implemented by providers that can be pointed at another
+// server speaking the same API, such as an OpenAI-compatible one
+type BaseURLSetter interface {
+	// SetBaseURL changes the endpoint requests are sent to; "" restores the
+	// provider's default
+	SetBaseURL(baseURL string)
+}
+
 // Model represents an available model
 type Model struct {
-	ID            string   `json:"id"`
-	Name          string   `json:"name"`
-	Description   string   `json:"description,omitempty"`
-	ContextWindow int      `json:"context_window"`
-	SupportsTools bool     `json:"supports_tools"`
-	SupportsVision bool    `json:"supports_vision"`
-	Capabilities  []string `json:"capabilities,omitempty"`
+	ID               string        `json:"id"`
+	Name             string        `json:"name"`
+	Description      string        `json:"description,omitempty"`
+	ContextWindow    int           `json:"context_window"`
+	MaxOutputTokens  int           `json:"max_output_tokens,omitempty"` // 0 if unknown
+	SupportsTools    bool          `json:"supports_tools"`
+	SupportsVision   bool          `json:"supports_vision"`
+	SupportsJSONMode bool          `json:"supports_json_mode"`
+	Pricing          *ModelPricing `json:"pricing,omitempty"` // nil if unknown
+	Capabilities     []string      `json:"capabilities,omitempty"`
+}
+
+// ModelPricing is a model's list price in US dollars per million tokens
+type ModelPricing struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
 }
 
 // Message represents a chat message
@@ -96,6 +114,70 @@ type ChatRequest struct {
 	Temperature float64          `json:"temperature,omitempty"`
 	MaxTokens   int              `json:"max_tokens,omitempty"`
 	Stream      bool             `json:"stream"`
+
+	// JSONMode constrains the response to a single JSON object where the
+	// provider supports it. The prompt should still ask for JSON, which is
+	// all providers without JSON mode go on.
+	JSONMode bool `json:"json_mode,omitempty"`
+
+	Sampling
+
+	// Provider-specific options, ignored by providers that don't support them
+	SafetySettings  []SafetySetting `json:"safety_settings,omitempty"`  // Google: per-category blocking thresholds
+	SearchGrounding bool            `json:"search_grounding,omitempty"` // Google: ground responses with Google Search
+}
+
+// Sampling holds the sampling controls of a request beyond temperature.
+// Zero values leave the provider's defaults, and providers ignore controls
+// they don't support: Anthropic has no penalties or seed.
+type Sampling struct {
+	TopP             float64  `json:"top_p,omitempty"`
+	FrequencyPenalty float64  `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64  `json:"presence_penalty,omitempty"`
+	Stop             []string `json:"stop,omitempty"` // Sequences that end the response
+	Seed             *int64   `json:"seed,omitempty"`
+
+	// Deterministic makes responses as reproducible as the provider allows:
+	// temperature 0, only the likeliest token where the provider can limit
+	// it (top_k 1), and a fixed seed, 0 unless one is set. Temperature and
+	// TopP are ignored.
+	Deterministic bool `json:"deterministic,omitempty"`
+}
+
+// IsZero reports whether no sampling control is set
+func (s Sampling) IsZero() bool {
+	return s.TopP == 0 && s.FrequencyPenalty == 0 && s.PresencePenalty == 0 &&
+		len(s.Stop) == 0 && s.Seed == nil && !s.Deterministic
+}
+
+// SamplingTemperature returns the temperature to send and whether to send
+// one: 0 in deterministic mode, otherwise the temperature set, if any
+func (r *ChatRequest) SamplingTemperature() (float64, bool) {
+	if r.Deterministic {
+		return 0, true
+	}
+	return r.Temperature, r.Temperature > 0
+}
+
+// SamplingSeed returns the seed to send and whether to send one
+func (s Sampling) SamplingSeed() (int64, bool) {
+	if s.Seed != nil {
+		return *s.Seed, true
+	}
+	return 0, s.Deterministic
+}
+
+// SafetySetting sets the blocking threshold for a harm category,
+// e.g. HARM_CATEGORY_HARASSMENT / BLOCK_ONLY_HIGH
+type SafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+// Citation is a source a grounded response is based on
+type Citation struct {
+	URI   string `json:"uri"`
+	Title string `json:"title,omitempty"`
 }
 
 // StreamChunk represents a chunk of streaming response
@@ -114,6 +196,9 @@ type StreamChunk struct {
 
 	// Usage statistics (only on final chunk)
 	Usage *Usage `json:"usage,omitempty"`
+
+	// Sources used for grounding (if any)
+	Citations []Citation `json:"citations,omitempty"`
 }
 
 // Usage represents token usage statistics
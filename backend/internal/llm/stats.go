@@ -0,0 +1,223 @@
+package llm
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// statsWindow is the number of recent requests kept per provider/model
+const statsWindow = 100
+
+// minHealthSamples is the number of requests needed before judging health
+const minHealthSamples = 5
+
+// Health states reported in ProviderStats
+const (
+	HealthUnknown   = "unknown"
+	HealthHealthy   = "healthy"
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+// requestSample records the outcome of a single chat request
+type requestSample struct {
+	at               time.Time
+	firstToken       time.Duration // time until the first chunk arrived
+	duration         time.Duration // time until the stream finished
+	completionTokens int
+	failed           bool
+}
+
+// modelStatsRecord holds a rolling window of samples for one provider/model
+type modelStatsRecord struct {
+	samples       []requestSample
+	next          int
+	totalRequests int64
+	totalErrors   int64
+	lastError     string
+	lastErrorAt   *time.Time
+	lastSuccessAt *time.Time
+}
+
+// statsRecorder tracks request statistics per provider and model
+type statsRecorder struct {
+	records map[string]map[string]*modelStatsRecord // provider -> model -> record
+	mu      sync.Mutex
+}
+
+func newStatsRecorder() *statsRecorder {
+	return &statsRecorder{
+		records: make(map[string]map[string]*modelStatsRecord),
+	}
+}
+
+// record adds a request outcome; errMsg is empty for successful requests
+func (r *statsRecorder) record(provider, model string, sample requestSample, errMsg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	models, ok := r.records[provider]
+	if !ok {
+		models = make(map[string]*modelStatsRecord)
+		r.records[provider] = models
+	}
+	rec, ok := models[model]
+	if !ok {
+		rec = &modelStatsRecord{samples: make([]requestSample, 0, statsWindow)}
+		models[model] = rec
+	}
+
+	// Rolling window: overwrite the oldest sample once full
+	if len(rec.samples) < statsWindow {
+		rec.samples = append(rec.samples, sample)
+	} else {
+		rec.samples[rec.next] = sample
+	}
+	rec.next = (rec.next + 1) % statsWindow
+
+	rec.totalRequests++
+	at := sample.at
+	if sample.failed {
+		rec.totalErrors++
+		rec.lastError = errMsg
+		rec.lastErrorAt = &at
+	} else {
+		rec.lastSuccessAt = &at
+	}
+}
+
+// snapshot computes statistics for every provider seen so far
+func (r *statsRecorder) snapshot() []ProviderStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]ProviderStats, 0, len(r.records))
+	for provider, models := range r.records {
+		ps := ProviderStats{Provider: provider, Models: make([]ModelStats, 0, len(models))}
+		var all []requestSample
+		for model, rec := range models {
+			ms := summarize(rec.samples)
+			ms.Provider = provider
+			ms.Model = model
+			ms.TotalRequests = rec.totalRequests
+			ms.TotalErrors = rec.totalErrors
+			ms.LastError = rec.lastError
+			ms.LastErrorAt = rec.lastErrorAt
+			ms.LastSuccessAt = rec.lastSuccessAt
+			ps.Models = append(ps.Models, ms)
+			all = append(all, rec.samples...)
+		}
+
+		overall := summarize(all)
+		ps.Requests = overall.Requests
+		ps.Errors = overall.Errors
+		ps.ErrorRate = overall.ErrorRate
+		ps.AvgLatencyMs = overall.AvgLatencyMs
+		ps.P95LatencyMs = overall.P95LatencyMs
+		ps.TokensPerSecond = overall.TokensPerSecond
+		ps.Health = healthFor(overall)
+
+		sort.Slice(ps.Models, func(i, j int) bool { return ps.Models[i].Model < ps.Models[j].Model })
+		result = append(result, ps)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Provider < result[j].Provider })
+	return result
+}
+
+// summarize computes window statistics from a set of samples
+func summarize(samples []requestSample) ModelStats {
+	stats := ModelStats{Requests: len(samples)}
+	if len(samples) == 0 {
+		return stats
+	}
+
+	var latencies []float64
+	var totalDuration float64
+	var tokens int
+	var generation time.Duration
+	for _, s := range samples {
+		if s.failed {
+			stats.Errors++
+			continue
+		}
+		latencies = append(latencies, float64(s.firstToken.Milliseconds()))
+		totalDuration += float64(s.duration.Milliseconds())
+		if s.completionTokens > 0 && s.duration > s.firstToken {
+			tokens += s.completionTokens
+			generation += s.duration - s.firstToken
+		}
+	}
+
+	stats.ErrorRate = float64(stats.Errors) / float64(len(samples))
+	if len(latencies) > 0 {
+		var sum float64
+		for _, l := range latencies {
+			sum += l
+		}
+		stats.AvgLatencyMs = sum / float64(len(latencies))
+		stats.AvgDurationMs = totalDuration / float64(len(latencies))
+
+		sort.Float64s(latencies)
+		idx := int(float64(len(latencies))*0.95+0.5) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= len(latencies) {
+			idx = len(latencies) - 1
+		}
+		stats.P95LatencyMs = latencies[idx]
+	}
+	if generation > 0 {
+		stats.TokensPerSecond = float64(tokens) / generation.Seconds()
+	}
+	return stats
+}
+
+// healthFor classifies a provider from its recent error rate
+func healthFor(stats ModelStats) string {
+	switch {
+	case stats.Requests < minHealthSamples:
+		return HealthUnknown
+	case stats.ErrorRate >= 0.5:
+		return HealthUnhealthy
+	case stats.ErrorRate >= 0.1:
+		return HealthDegraded
+	default:
+		return HealthHealthy
+	}
+}
+
+// ModelStats contains rolling statistics for one provider/model pair.
+// Window fields cover the most recent requests; Total fields cover the
+// lifetime of the process.
+type ModelStats struct {
+	Provider        string     `json:"provider"`
+	Model           string     `json:"model"`
+	Requests        int        `json:"requests"`
+	Errors          int        `json:"errors"`
+	ErrorRate       float64    `json:"error_rate"`
+	AvgLatencyMs    float64    `json:"avg_latency_ms"` // Time to first token
+	P95LatencyMs    float64    `json:"p95_latency_ms"`
+	AvgDurationMs   float64    `json:"avg_duration_ms"`
+	TokensPerSecond float64    `json:"tokens_per_second"`
+	TotalRequests   int64      `json:"total_requests"`
+	TotalErrors     int64      `json:"total_errors"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+	LastSuccessAt   *time.Time `json:"last_success_at,omitempty"`
+}
+
+// ProviderStats contains rolling statistics for a provider across its models
+type ProviderStats struct {
+	Provider        string       `json:"provider"`
+	Health          string       `json:"health"` // unknown, healthy, degraded, unhealthy
+	Requests        int          `json:"requests"`
+	Errors          int          `json:"errors"`
+	ErrorRate       float64      `json:"error_rate"`
+	AvgLatencyMs    float64      `json:"avg_latency_ms"`
+	P95LatencyMs    float64      `json:"p95_latency_ms"`
+	TokensPerSecond float64      `json:"tokens_per_second"`
+	Models          []ModelStats `json:"models"`
+}
@@ -0,0 +1,11 @@
+package llm
+
+// CharsPerToken is the rough ratio of characters to tokens used where text
+// has to be measured without a provider's tokenizer, e.g. to estimate a
+// request's size or turn a token budget into characters
+const CharsPerToken = 4
+
+// EstimateTokens roughly estimates the tokens in a piece of text
+func EstimateTokens(text string) int {
+	return (len(text) + CharsPerToken - 1) / CharsPerToken
+}
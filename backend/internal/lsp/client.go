@@ -0,0 +1,568 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errClientClosed is returned for requests made after the server exited
+var errClientClosed = errors.New("language server is not running")
+
+// openDocument tracks a document the server has been told about
+type openDocument struct {
+	version int
+	text    string
+}
+
+// diagnosticsState holds the latest diagnostics published for a document.
+// generation increases with every publish so callers can wait for a fresh one.
+type diagnosticsState struct {
+	diagnostics []Diagnostic
+	generation  int
+}
+
+// Client is a connection to a single language server process rooted at a
+// workspace directory
+type Client struct {
+	language string
+	root     string
+	server   ServerConfig
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+
+	writeMu   sync.Mutex
+	requestID int64
+	pending   map[string]chan *message
+	pendingMu sync.Mutex
+
+	docs   map[string]*openDocument
+	docsMu sync.Mutex
+
+	diagnostics map[string]*diagnosticsState
+	diagMu      sync.Mutex
+	diagUpdated chan struct{} // closed and replaced on every publish
+
+	lastUsed time.Time
+	usedMu   sync.Mutex
+
+	done chan struct{}
+}
+
+// startClient launches a language server and performs the initialize handshake
+func startClient(ctx context.Context, language, root string, server ServerConfig) (*Client, error) {
+	path, err := exec.LookPath(server.Command)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s (install %s)", ErrServerNotInstalled, server.Command, server.Command)
+	}
+
+	cmd := exec.Command(path, server.Args...)
+	cmd.Dir = root
+	cmd.Env = os.Environ()
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", server.Command, err)
+	}
+
+	c := &Client{
+		language:    language,
+		root:        root,
+		server:      server,
+		cmd:         cmd,
+		stdin:       stdin,
+		stdout:      bufio.NewReaderSize(stdout, 64*1024),
+		pending:     make(map[string]chan *message),
+		docs:        make(map[string]*openDocument),
+		diagnostics: make(map[string]*diagnosticsState),
+		diagUpdated: make(chan struct{}),
+		lastUsed:    time.Now(),
+		done:        make(chan struct{}),
+	}
+
+	go c.readMessages()
+	go drain(stderr)
+	go func() {
+		_ = cmd.Wait()
+		c.close()
+	}()
+
+	if err := c.initialize(ctx); err != nil {
+		c.Shutdown()
+		return nil, fmt.Errorf("failed to initialize %s: %w", server.Command, err)
+	}
+
+	return c, nil
+}
+
+// initialize performs the LSP initialization handshake
+func (c *Client) initialize(ctx context.Context) error {
+	rootURI := pathToURI(c.root)
+	params := initializeParams{
+		ProcessID: os.Getpid(),
+		RootURI:   rootURI,
+		WorkspaceFolders: []workspaceFolder{
+			{URI: rootURI, Name: filepath.Base(c.root)},
+		},
+		Capabilities: clientCapabilities,
+		ClientInfo: clientInfo{
+			Name:    "Prism",
+			Version: "1.0.0",
+		},
+	}
+
+	if err := c.call(ctx, "initialize", params, nil); err != nil {
+		return err
+	}
+	return c.notify("initialized", struct{}{})
+}
+
+// Diagnostics syncs a file with the server and returns its diagnostics. It
+// waits up to wait for the server to publish diagnostics for the current
+// content, then returns whatever is known.
+func (c *Client) Diagnostics(ctx context.Context, path string, wait time.Duration) ([]Diagnostic, bool, error) {
+	c.touch()
+
+	uri := pathToURI(path)
+	c.diagMu.Lock()
+	before := 0
+	if state, ok := c.diagnostics[uri]; ok {
+		before = state.generation
+	}
+	c.diagMu.Unlock()
+
+	changed, err := c.syncDocument(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Unchanged documents already have current diagnostics, if any were published
+	fresh := !changed && before > 0
+	if !fresh {
+		fresh = c.waitForDiagnostics(ctx, uri, before, wait)
+	}
+
+	c.diagMu.Lock()
+	defer c.diagMu.Unlock()
+	if state, ok := c.diagnostics[uri]; ok {
+		return append([]Diagnostic(nil), state.diagnostics...), fresh, nil
+	}
+	return nil, fresh, nil
+}
+
+// AllDiagnostics returns the latest diagnostics published for every
+// document, keyed by absolute path
+func (c *Client) AllDiagnostics() map[string][]Diagnostic {
+	c.touch()
+
+	c.diagMu.Lock()
+	defer c.diagMu.Unlock()
+
+	result := make(map[string][]Diagnostic)
+	for uri, state := range c.diagnostics {
+		if len(state.diagnostics) == 0 {
+			continue
+		}
+		path, err := uriToPath(uri)
+		if err != nil {
+			continue
+		}
+		result[path] = append([]Diagnostic(nil), state.diagnostics...)
+	}
+	return result
+}
+
+// Hover returns hover information at a position as plain text
+func (c *Client) Hover(ctx context.Context, path string, pos Position) (string, error) {
+	c.touch()
+
+	if _, err := c.syncDocument(path); err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	params := textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: pathToURI(path)},
+		Position:     pos,
+	}
+	if err := c.call(ctx, "textDocument/hover", params, &result); err != nil {
+		return "", err
+	}
+	return hoverText(result.Contents), nil
+}
+
+// Definition returns the locations where the symbol at a position is defined
+func (c *Client) Definition(ctx context.Context, path string, pos Position) ([]Location, error) {
+	c.touch()
+
+	if _, err := c.syncDocument(path); err != nil {
+		return nil, err
+	}
+
+	var raw json.RawMessage
+	params := textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: pathToURI(path)},
+		Position:     pos,
+	}
+	if err := c.call(ctx, "textDocument/definition", params, &raw); err != nil {
+		return nil, err
+	}
+	return parseLocations(raw), nil
+}
+
+// Shutdown asks the server to exit, killing it if it does not
+func (c *Client) Shutdown() {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := c.call(ctx, "shutdown", nil, nil); err == nil {
+		_ = c.notify("exit", nil)
+	}
+
+	select {
+	case <-c.done:
+	case <-time.After(3 * time.Second):
+		if c.cmd.Process != nil {
+			_ = c.cmd.Process.Kill()
+		}
+	}
+}
+
+// Alive reports whether the server process is still running
+func (c *Client) Alive() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// IdleSince returns when the client was last used
+func (c *Client) IdleSince() time.Time {
+	c.usedMu.Lock()
+	defer c.usedMu.Unlock()
+	return c.lastUsed
+}
+
+// syncDocument opens a file on the server or sends its new content if it
+// changed on disk. It reports whether anything was sent.
+func (c *Client) syncDocument(path string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file: %w", err)
+	}
+	text := string(content)
+	uri := pathToURI(path)
+
+	c.docsMu.Lock()
+	defer c.docsMu.Unlock()
+
+	doc, ok := c.docs[uri]
+	if !ok {
+		c.docs[uri] = &openDocument{version: 1, text: text}
+		return true, c.notify("textDocument/didOpen", didOpenTextDocumentParams{
+			TextDocument: textDocumentItem{
+				URI:        uri,
+				LanguageID: c.server.languageID(path),
+				Version:    1,
+				Text:       text,
+			},
+		})
+	}
+
+	if doc.text == text {
+		return false, nil
+	}
+	doc.version++
+	doc.text = text
+	return true, c.notify("textDocument/didChange", didChangeTextDocumentParams{
+		TextDocument:   versionedTextDocumentIdentifier{URI: uri, Version: doc.version},
+		ContentChanges: []textDocumentContentChangeEvent{{Text: text}},
+	})
+}
+
+// waitForDiagnostics waits for a publish newer than the given generation.
+// Servers often publish in several passes (e.g. syntax, then types), so after
+// the first new publish it keeps collecting until the server goes quiet.
+func (c *Client) waitForDiagnostics(ctx context.Context, uri string, after int, wait time.Duration) bool {
+	const settle = 300 * time.Millisecond
+
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	received := false
+	for {
+		c.diagMu.Lock()
+		state, ok := c.diagnostics[uri]
+		if ok && state.generation > after {
+			received = true
+			after = state.generation
+		}
+		updated := c.diagUpdated
+		c.diagMu.Unlock()
+
+		var quiet <-chan time.Time
+		if received {
+			quiet = time.After(settle)
+		}
+
+		select {
+		case <-updated:
+		case <-quiet:
+			return true
+		case <-deadline.C:
+			return received
+		case <-ctx.Done():
+			return received
+		case <-c.done:
+			return received
+		}
+	}
+}
+
+// call sends a request and decodes its result into out (if non-nil)
+func (c *Client) call(ctx context.Context, method string, params, out interface{}) error {
+	c.pendingMu.Lock()
+	c.requestID++
+	id := strconv.FormatInt(c.requestID, 10)
+	ch := make(chan *message, 1)
+	c.pending[id] = ch
+	c.pendingMu.Unlock()
+
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}()
+
+	if err := c.write(&outgoingMessage{ID: json.RawMessage(id), Method: method, Params: params}); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if out != nil && len(resp.Result) > 0 {
+			if err := json.Unmarshal(resp.Result, out); err != nil {
+				return fmt.Errorf("invalid %s response: %w", method, err)
+			}
+		}
+		return nil
+	case <-c.done:
+		return errClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// notify sends a notification, which has no response
+func (c *Client) notify(method string, params interface{}) error {
+	return c.write(&outgoingMessage{Method: method, Params: params})
+}
+
+func (c *Client) write(msg *outgoingMessage) error {
+	select {
+	case <-c.done:
+		return errClientClosed
+	default:
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := writeMessage(c.stdin, msg); err != nil {
+		return fmt.Errorf("failed to write to language server: %w", err)
+	}
+	return nil
+}
+
+// readMessages dispatches responses, server requests and notifications
+func (c *Client) readMessages() {
+	for {
+		msg, err := readMessage(c.stdout)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("LSP %s: read error: %v", c.language, err)
+			}
+			c.close()
+			return
+		}
+
+		switch {
+		case msg.isResponse():
+			c.pendingMu.Lock()
+			ch, ok := c.pending[string(msg.ID)]
+			c.pendingMu.Unlock()
+			if ok {
+				ch <- msg
+			}
+		case len(msg.ID) > 0:
+			c.handleServerRequest(msg)
+		case msg.Method == "textDocument/publishDiagnostics":
+			c.handlePublishDiagnostics(msg.Params)
+		}
+	}
+}
+
+// handleServerRequest answers requests the server sends to the client.
+// Configuration requests get empty settings; everything else gets null.
+func (c *Client) handleServerRequest(msg *message) {
+	var result interface{}
+	if msg.Method == "workspace/configuration" {
+		var params configurationParams
+		_ = json.Unmarshal(msg.Params, &params)
+		result = make([]interface{}, len(params.Items))
+	}
+	if err := c.write(&outgoingMessage{ID: msg.ID, Result: result}); err != nil {
+		log.Printf("LSP %s: failed to answer %s: %v", c.language, msg.Method, err)
+	}
+}
+
+func (c *Client) handlePublishDiagnostics(raw json.RawMessage) {
+	var params publishDiagnosticsParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return
+	}
+
+	c.diagMu.Lock()
+	defer c.diagMu.Unlock()
+
+	state, ok := c.diagnostics[params.URI]
+	if !ok {
+		state = &diagnosticsState{}
+		c.diagnostics[params.URI] = state
+	}
+	state.diagnostics = params.Diagnostics
+	state.generation++
+
+	close(c.diagUpdated)
+	c.diagUpdated = make(chan struct{})
+}
+
+func (c *Client) touch() {
+	c.usedMu.Lock()
+	c.lastUsed = time.Now()
+	c.usedMu.Unlock()
+}
+
+// close marks the client as stopped; safe to call more than once
+func (c *Client) close() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+		c.stdin.Close()
+	}
+}
+
+// hoverText flattens the various hover content shapes into plain text
+func hoverText(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	var markup struct {
+		Kind     string `json:"kind"`
+		Language string `json:"language"`
+		Value    string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &markup); err == nil && markup.Value != "" {
+		if markup.Language != "" {
+			return "```" + markup.Language + "\n" + markup.Value + "\n```"
+		}
+		return markup.Value
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err == nil {
+		var text string
+		for _, part := range parts {
+			if t := hoverText(part); t != "" {
+				if text != "" {
+					text += "\n\n"
+				}
+				text += t
+			}
+		}
+		return text
+	}
+
+	return ""
+}
+
+// parseLocations accepts a Location, a list of Locations or a list of
+// LocationLinks
+func parseLocations(raw json.RawMessage) []Location {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var single Location
+	if err := json.Unmarshal(raw, &single); err == nil && single.URI != "" {
+		return []Location{single}
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil
+	}
+
+	var locations []Location
+	for _, item := range items {
+		var loc Location
+		if err := json.Unmarshal(item, &loc); err == nil && loc.URI != "" {
+			locations = append(locations, loc)
+			continue
+		}
+		var link locationLink
+		if err := json.Unmarshal(item, &link); err == nil && link.TargetURI != "" {
+			locations = append(locations, Location{URI: link.TargetURI, Range: link.TargetSelectionRange})
+		}
+	}
+	return locations
+}
+
+// drain discards a stream so the server never blocks writing to it
+func drain(r io.Reader) {
+	_, _ = io.Copy(io.Discard, r)
+}
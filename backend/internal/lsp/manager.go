@@ -0,0 +1,464 @@
+// Package lsp runs language servers (gopls, typescript-language-server,
+// pyright) against user workspaces so tools can report compiler diagnostics
+// and answer hover and go-to-definition queries.
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultIdleTimeout     = 10 * time.Minute
+	defaultDiagnosticsWait = 5 * time.Second
+	defaultStartTimeout    = 30 * time.Second
+)
+
+var (
+	// ErrUnsupportedLanguage is returned for files no configured server handles
+	ErrUnsupportedLanguage = errors.New("no language server configured for this file type")
+
+	// ErrServerNotInstalled is returned when a server's command is not on PATH
+	ErrServerNotInstalled = errors.New("language server is not installed")
+)
+
+// ServerConfig describes how to launch a language server
+type ServerConfig struct {
+	Command string
+	Args    []string
+	// LanguageIDs maps file extensions handled by the server to LSP language IDs
+	LanguageIDs map[string]string
+}
+
+// languageID returns the LSP language ID for a file
+func (s ServerConfig) languageID(path string) string {
+	return s.LanguageIDs[strings.ToLower(filepath.Ext(path))]
+}
+
+// DefaultServers returns the built-in language server configurations
+func DefaultServers() map[string]ServerConfig {
+	return map[string]ServerConfig{
+		"go": {
+			Command:     "gopls",
+			LanguageIDs: map[string]string{".go": "go"},
+		},
+		"typescript": {
+			Command: "typescript-language-server",
+			Args:    []string{"--stdio"},
+			LanguageIDs: map[string]string{
+				".ts":  "typescript",
+				".tsx": "typescriptreact",
+				".mts": "typescript",
+				".cts": "typescript",
+				".js":  "javascript",
+				".jsx": "javascriptreact",
+				".mjs": "javascript",
+				".cjs": "javascript",
+			},
+		},
+		"python": {
+			Command:     "pyright-langserver",
+			Args:        []string{"--stdio"},
+			LanguageIDs: map[string]string{".py": "python", ".pyi": "python"},
+		},
+	}
+}
+
+// Config holds configuration for the language server manager
+type Config struct {
+	// Servers maps a language name to its server; defaults to DefaultServers
+	Servers map[string]ServerConfig
+	// IdleTimeout shuts down servers that have not been used for this long
+	IdleTimeout time.Duration
+	// DiagnosticsWait bounds how long to wait for a server to publish diagnostics
+	DiagnosticsWait time.Duration
+}
+
+// FileDiagnostic is a diagnostic resolved to a workspace-relative location
+// with 1-based line and column numbers
+type FileDiagnostic struct {
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	EndLine  int    `json:"end_line"`
+	Severity string `json:"severity"`
+	Source   string `json:"source,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Message  string `json:"message"`
+}
+
+// DefinitionLocation is a definition resolved to a 1-based position. Path is
+// workspace-relative when the definition is inside the workspace.
+type DefinitionLocation struct {
+	Path    string `json:"path"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Preview string `json:"preview,omitempty"`
+}
+
+// Manager starts language servers on demand, one per workspace and
+// language, and stops them once idle
+type Manager struct {
+	config Config
+
+	clients  map[string]*Client
+	starting map[string]*startCall
+	mu       sync.Mutex
+
+	stopCh chan struct{}
+	stopMu sync.Once
+}
+
+// startCall lets concurrent callers share a single server start
+type startCall struct {
+	done   chan struct{}
+	client *Client
+	err    error
+}
+
+// NewManager creates a new language server manager
+func NewManager(config Config) *Manager {
+	if config.Servers == nil {
+		config.Servers = DefaultServers()
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultIdleTimeout
+	}
+	if config.DiagnosticsWait <= 0 {
+		config.DiagnosticsWait = defaultDiagnosticsWait
+	}
+
+	m := &Manager{
+		config:   config,
+		clients:  make(map[string]*Client),
+		starting: make(map[string]*startCall),
+		stopCh:   make(chan struct{}),
+	}
+	go m.reapIdle()
+	return m
+}
+
+// Diagnostics returns the diagnostics for a workspace file, starting the
+// language server if needed. The boolean reports whether the server
+// published diagnostics for the file's current content within the wait.
+func (m *Manager) Diagnostics(ctx context.Context, root, relPath string) ([]FileDiagnostic, bool, error) {
+	client, absPath, err := m.clientFor(ctx, root, relPath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	diagnostics, fresh, err := client.Diagnostics(ctx, absPath, m.config.DiagnosticsWait)
+	if err != nil {
+		return nil, false, err
+	}
+	return resolveDiagnostics(root, absPath, diagnostics), fresh, nil
+}
+
+// WorkspaceDiagnostics returns every diagnostic currently known from the
+// language servers running for a workspace, without starting any
+func (m *Manager) WorkspaceDiagnostics(root string) []FileDiagnostic {
+	m.mu.Lock()
+	var clients []*Client
+	for _, client := range m.clients {
+		if client.root == root && client.Alive() {
+			clients = append(clients, client)
+		}
+	}
+	m.mu.Unlock()
+
+	var result []FileDiagnostic
+	for _, client := range clients {
+		for path, diagnostics := range client.AllDiagnostics() {
+			result = append(result, resolveDiagnostics(root, path, diagnostics)...)
+		}
+	}
+	sortDiagnostics(result)
+	return result
+}
+
+// Hover returns hover information for the symbol at a 1-based line and column
+func (m *Manager) Hover(ctx context.Context, root, relPath string, line, column int) (string, error) {
+	client, absPath, err := m.clientFor(ctx, root, relPath)
+	if err != nil {
+		return "", err
+	}
+	pos, err := toPosition(absPath, line, column)
+	if err != nil {
+		return "", err
+	}
+	return client.Hover(ctx, absPath, pos)
+}
+
+// Definition returns where the symbol at a 1-based line and column is defined
+func (m *Manager) Definition(ctx context.Context, root, relPath string, line, column int) ([]DefinitionLocation, error) {
+	client, absPath, err := m.clientFor(ctx, root, relPath)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := toPosition(absPath, line, column)
+	if err != nil {
+		return nil, err
+	}
+
+	locations, err := client.Definition(ctx, absPath, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]DefinitionLocation, 0, len(locations))
+	for _, loc := range locations {
+		path, err := uriToPath(loc.URI)
+		if err != nil {
+			continue
+		}
+		lineText := readLine(path, loc.Range.Start.Line)
+		result = append(result, DefinitionLocation{
+			Path:    displayPath(root, path),
+			Line:    loc.Range.Start.Line + 1,
+			Column:  runeColumn(lineText, loc.Range.Start.Character),
+			Preview: strings.TrimSpace(lineText),
+		})
+	}
+	return result, nil
+}
+
+// Stop shuts down every running language server
+func (m *Manager) Stop() {
+	m.stopMu.Do(func() { close(m.stopCh) })
+
+	m.mu.Lock()
+	clients := make([]*Client, 0, len(m.clients))
+	for key, client := range m.clients {
+		clients = append(clients, client)
+		delete(m.clients, key)
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			c.Shutdown()
+		}(client)
+	}
+	wg.Wait()
+}
+
+// clientFor resolves a workspace file and returns the running server for
+// its language, starting one if needed
+func (m *Manager) clientFor(ctx context.Context, root, relPath string) (*Client, string, error) {
+	absPath, err := resolvePath(root, relPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	language, server, ok := m.serverFor(absPath)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnsupportedLanguage, filepath.Ext(absPath))
+	}
+
+	key := language + "\x00" + root
+
+	m.mu.Lock()
+	if client, ok := m.clients[key]; ok && client.Alive() {
+		m.mu.Unlock()
+		return client, absPath, nil
+	}
+	call, ok := m.starting[key]
+	if !ok {
+		call = &startCall{done: make(chan struct{})}
+		m.starting[key] = call
+		go m.start(key, language, root, server, call)
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return nil, "", call.err
+		}
+		return call.client, absPath, nil
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+}
+
+// start launches a server on behalf of every caller waiting on call
+func (m *Manager) start(key, language, root string, server ServerConfig, call *startCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultStartTimeout)
+	defer cancel()
+
+	client, err := startClient(ctx, language, root, server)
+
+	m.mu.Lock()
+	delete(m.starting, key)
+	if err == nil {
+		m.clients[key] = client
+		log.Printf("LSP: started %s for %s", server.Command, root)
+	}
+	m.mu.Unlock()
+
+	call.client, call.err = client, err
+	close(call.done)
+}
+
+// serverFor finds the configured server for a file by extension
+func (m *Manager) serverFor(path string) (string, ServerConfig, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return "", ServerConfig{}, false
+	}
+	for language, server := range m.config.Servers {
+		if _, ok := server.LanguageIDs[ext]; ok {
+			return language, server, true
+		}
+	}
+	return "", ServerConfig{}, false
+}
+
+// reapIdle periodically shuts down servers that have gone unused
+func (m *Manager) reapIdle() {
+	interval := m.config.IdleTimeout / 2
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		var idle []*Client
+		m.mu.Lock()
+		for key, client := range m.clients {
+			if !client.Alive() || time.Since(client.IdleSince()) > m.config.IdleTimeout {
+				idle = append(idle, client)
+				delete(m.clients, key)
+			}
+		}
+		m.mu.Unlock()
+
+		for _, client := range idle {
+			client.Shutdown()
+		}
+	}
+}
+
+// resolvePath joins a workspace-relative path to the root, rejecting paths
+// that escape it
+func resolvePath(root, relPath string) (string, error) {
+	cleanPath := filepath.Clean(relPath)
+	if strings.HasPrefix(cleanPath, "..") || filepath.IsAbs(cleanPath) {
+		return "", fmt.Errorf("path must be a relative path within the workspace")
+	}
+	absPath := filepath.Join(root, cleanPath)
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return "", fmt.Errorf("file not found: %s", relPath)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("path is a directory: %s", relPath)
+	}
+	return absPath, nil
+}
+
+// toPosition converts a 1-based line and character column in a file to an
+// LSP position
+func toPosition(path string, line, column int) (Position, error) {
+	if line < 1 || column < 1 {
+		return Position{}, fmt.Errorf("line and column must be 1 or greater")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Position{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	lines := strings.Split(string(content), "\n")
+	if line > len(lines) {
+		return Position{}, fmt.Errorf("line %d is past the end of the file (%d lines)", line, len(lines))
+	}
+	return Position{Line: line - 1, Character: utf16Offset(lines[line-1], column)}, nil
+}
+
+// resolveDiagnostics converts protocol diagnostics for a file to 1-based,
+// workspace-relative form
+func resolveDiagnostics(root, path string, diagnostics []Diagnostic) []FileDiagnostic {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+
+	var lines []string
+	if content, err := os.ReadFile(path); err == nil {
+		lines = strings.Split(string(content), "\n")
+	}
+
+	result := make([]FileDiagnostic, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		lineText := ""
+		if d.Range.Start.Line < len(lines) {
+			lineText = lines[d.Range.Start.Line]
+		}
+		result = append(result, FileDiagnostic{
+			Path:     displayPath(root, path),
+			Line:     d.Range.Start.Line + 1,
+			Column:   runeColumn(lineText, d.Range.Start.Character),
+			EndLine:  d.Range.End.Line + 1,
+			Severity: d.SeverityName(),
+			Source:   d.Source,
+			Code:     d.CodeString(),
+			Message:  d.Message,
+		})
+	}
+	sortDiagnostics(result)
+	return result
+}
+
+// sortDiagnostics orders diagnostics by file and position
+func sortDiagnostics(diagnostics []FileDiagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// displayPath returns a path relative to the workspace root, or the
+// absolute path if it lies outside (e.g. the standard library)
+func displayPath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// readLine returns a zero-based line of a file, or "" if unavailable
+func readLine(path string, line int) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(string(content), "\n")
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line], "\r")
+}
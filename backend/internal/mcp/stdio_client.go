@@ -6,13 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 	"os/exec"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/security"
 )
 
 // StdioServer represents a local MCP server connected via stdio
@@ -39,6 +39,9 @@ type StdioServer struct {
 	requestID  int64
 	pending    map[int64]chan *jsonRPCResponse
 	pendingMu  sync.Mutex
+	writeMu    sync.Mutex // Serializes writes to stdin; mu is held for all of Start
+	vault      *security.SecretVault // Resolves secret references in Env; nil if unset
+	policy     StdioPolicy
 }
 
 // JSON-RPC 2.0 structures
@@ -132,6 +135,9 @@ type mcpContent struct {
 // StdioClient manages multiple stdio-based MCP servers
 type StdioClient struct {
 	servers    map[string]*StdioServer
+	vault      *security.SecretVault
+	policy     StdioPolicy
+	disabled   bool // Set by an admin to stop and refuse all servers
 	mu         sync.RWMutex
 }
 
@@ -142,9 +148,53 @@ func NewStdioClient() *StdioClient {
 	}
 }
 
+// SetSecretVault sets the vault that resolves {{secret:NAME}} references in
+// servers' environment variables when they start
+func (c *StdioClient) SetSecretVault(vault *security.SecretVault) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.vault = vault
+}
+
+// SetPolicy sets the commands servers may run and how they are run. It
+// applies to servers started afterwards.
+func (c *StdioClient) SetPolicy(policy StdioPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = policy
+}
+
+// CheckCommand reports whether the policy lets servers run a command
+func (c *StdioClient) CheckCommand(command string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.policy.CheckCommand(command)
+}
+
+// Enabled reports whether user-defined servers may run
+func (c *StdioClient) Enabled() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.disabled
+}
+
+// SetEnabled allows or disallows user-defined servers. Disabling them stops
+// every running server; they aren't restarted when they are enabled again.
+func (c *StdioClient) SetEnabled(enabled bool) {
+	c.mu.Lock()
+	c.disabled = !enabled
+	c.mu.Unlock()
+
+	if !enabled {
+		c.StopAll()
+	}
+}
+
 // AddServer adds and starts a new stdio MCP server
 func (c *StdioClient) AddServer(server *StdioServer) error {
 	c.mu.Lock()
+	server.vault = c.vault
+	server.policy = c.policy
 	c.servers[server.ID] = server
 	c.mu.Unlock()
 
@@ -197,11 +247,15 @@ func (c *StdioClient) GetUserServers(userID string) []*StdioServer {
 func (c *StdioClient) StartServer(serverID string) error {
 	c.mu.RLock()
 	server, exists := c.servers[serverID]
+	disabled := c.disabled
 	c.mu.RUnlock()
 
 	if !exists {
 		return fmt.Errorf("server not found: %s", serverID)
 	}
+	if disabled {
+		return ErrStdioDisabled
+	}
 
 	return server.Start()
 }
@@ -219,6 +273,20 @@ func (c *StdioClient) StopServer(serverID string) error {
 	return server.Stop()
 }
 
+// RunningCount returns how many servers are running
+func (c *StdioClient) RunningCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	count := 0
+	for _, server := range c.servers {
+		if server.IsRunning() {
+			count++
+		}
+	}
+	return count
+}
+
 // GetAllTools returns all tools from all running servers for a user
 func (c *StdioClient) GetAllTools(userID string) []*RemoteTool {
 	c.mu.RLock()
@@ -273,14 +341,28 @@ func (s *StdioServer) Start() error {
 		return nil // Already running
 	}
 
-	// Create the command
-	s.cmd = exec.Command(s.Command, s.Args...)
+	if err := s.policy.CheckCommand(s.Command); err != nil {
+		return err
+	}
+
+	// Set up environment, with the user's secrets in place of references
+	env := s.Env
+	if s.vault != nil {
+		var err error
+		env, err = s.vault.ResolveAll(s.UserID, s.Env, security.ResolvedSecrets{})
+		if err != nil {
+			return fmt.Errorf("failed to resolve environment: %w", err)
+		}
+	}
 
-	// Set up environment
-	s.cmd.Env = append(os.Environ(), s.Env...)
+	// Create the command, directly or in a sandbox container
+	var err error
+	s.cmd, err = s.policy.command(s, env)
+	if err != nil {
+		return err
+	}
 
 	// Set up pipes
-	var err error
 	s.stdin, err = s.cmd.StdinPipe()
 	if err != nil {
 		return fmt.Errorf("failed to create stdin pipe: %w", err)
@@ -315,13 +397,13 @@ func (s *StdioServer) Start() error {
 	defer cancel()
 
 	if err := s.initialize(ctx); err != nil {
-		s.Stop()
+		s.stop()
 		return fmt.Errorf("failed to initialize MCP connection: %w", err)
 	}
 
 	// Fetch available tools
 	if err := s.refreshTools(ctx); err != nil {
-		s.Stop()
+		s.stop()
 		return fmt.Errorf("failed to fetch tools: %w", err)
 	}
 
@@ -332,7 +414,11 @@ func (s *StdioServer) Start() error {
 func (s *StdioServer) Stop() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.stop()
+}
 
+// stop stops the process with mu held
+func (s *StdioServer) stop() error {
 	if !s.running {
 		return nil
 	}
@@ -356,6 +442,9 @@ func (s *StdioServer) Stop() error {
 	case <-time.After(5 * time.Second):
 		// Force kill
 		s.cmd.Process.Kill()
+		if s.policy.Sandbox {
+			removeContainer(s.ID)
+		}
 	}
 
 	// Cancel all pending requests
@@ -436,9 +525,9 @@ func (s *StdioServer) sendRequest(ctx context.Context, method string, params int
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	s.mu.Lock()
+	s.writeMu.Lock()
 	_, err = s.stdin.Write(append(data, '\n'))
-	s.mu.Unlock()
+	s.writeMu.Unlock()
 
 	if err != nil {
 		s.pendingMu.Lock()
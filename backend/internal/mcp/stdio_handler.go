@@ -1,6 +1,7 @@
 package mcp
 
 import (
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -36,6 +37,12 @@ func (h *StdioHandler) RegisterRoutes(app fiber.Router) {
 	mcp.Get("/servers/:id/tools", h.GetServerTools)
 }
 
+// RegisterAdminRoutes registers the admin toggle for stdio MCP servers
+func (h *StdioHandler) RegisterAdminRoutes(admin fiber.Router) {
+	admin.Get("/mcp/stdio", h.GetStatus)
+	admin.Put("/mcp/stdio", h.SetEnabled)
+}
+
 // AddServerRequest represents a request to add a stdio MCP server
 type AddStdioServerRequest struct {
 	Name    string   `json:"name"`
@@ -84,6 +91,7 @@ func (h *StdioHandler) ListServers(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{
 		"servers": result,
+		"enabled": h.client.Enabled(),
 	})
 }
 
@@ -110,6 +118,17 @@ func (h *StdioHandler) AddServer(c *fiber.Ctx) error {
 		})
 	}
 
+	if !h.client.Enabled() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": ErrStdioDisabled.Error(),
+		})
+	}
+	if err := h.client.CheckCommand(req.Command); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	now := time.Now()
 	server := &StdioServer{
 		ID:        uuid.New().String(),
@@ -244,6 +263,14 @@ func (h *StdioHandler) UpdateServer(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.Command != nil {
+		if err := h.client.CheckCommand(*req.Command); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
 	// Update fields
 	if req.Name != nil {
 		server.Name = *req.Name
@@ -348,6 +375,11 @@ func (h *StdioHandler) StartServer(c *fiber.Ctx) error {
 
 	// Add to client (which starts it)
 	if err := h.client.AddServer(server); err != nil {
+		if errors.Is(err, ErrStdioDisabled) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 		server.LastError = err.Error()
 		h.repo.Update(server)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -416,6 +448,11 @@ func (h *StdioHandler) RestartServer(c *fiber.Ctx) error {
 
 	// Start fresh
 	if err := h.client.AddServer(server); err != nil {
+		if errors.Is(err, ErrStdioDisabled) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 		server.LastError = err.Error()
 		h.repo.Update(server)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -471,3 +508,36 @@ func (h *StdioHandler) GetServerTools(c *fiber.Ctx) error {
 		"tools": tools,
 	})
 }
+
+// SetStdioEnabledRequest represents an admin's toggle of stdio MCP servers
+type SetStdioEnabledRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// GetStatus reports whether stdio MCP servers are enabled and how many are
+// running
+func (h *StdioHandler) GetStatus(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"enabled": h.client.Enabled(),
+		"running": h.client.RunningCount(),
+	})
+}
+
+// SetEnabled turns user-defined stdio MCP servers on or off for everyone.
+// Turning them off stops every running server. The setting lasts until the
+// server restarts, when MCP_STDIO_ENABLED applies again.
+func (h *StdioHandler) SetEnabled(c *fiber.Ctx) error {
+	var req SetStdioEnabledRequest
+	if err := c.BodyParser(&req); err != nil || req.Enabled == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "enabled is required",
+		})
+	}
+
+	h.client.SetEnabled(*req.Enabled)
+
+	return c.JSON(fiber.Map{
+		"enabled": h.client.Enabled(),
+		"running": h.client.RunningCount(),
+	})
+}
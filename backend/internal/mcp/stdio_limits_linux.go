@@ -0,0 +1,36 @@
+package mcp
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// limitCommand wraps a server command started outside the sandbox with
+// prlimit, so the policy's limits are in place before the server runs any
+// code. Memory is limited through RLIMIT_DATA, which unlike RLIMIT_AS leaves
+// runtimes that reserve large address ranges (such as Node) able to start.
+// RLIMIT_NPROC counts all processes of the user the server runs as, and
+// RLIMIT_CPU is the CPU time after which the server is killed.
+func limitCommand(p StdioPolicy, command string, args []string) (string, []string, error) {
+	var limits []string
+	if p.MemoryLimitMB > 0 {
+		limit := uint64(p.MemoryLimitMB) << 20
+		limits = append(limits, fmt.Sprintf("--data=%d:%d", limit, limit))
+	}
+	if p.MaxProcesses > 0 {
+		limits = append(limits, fmt.Sprintf("--nproc=%d:%d", p.MaxProcesses, p.MaxProcesses))
+	}
+	if p.MaxCPUSeconds > 0 {
+		limits = append(limits, fmt.Sprintf("--cpu=%d:%d", p.MaxCPUSeconds, p.MaxCPUSeconds))
+	}
+	if len(limits) == 0 {
+		return command, args, nil
+	}
+
+	prlimit, err := exec.LookPath("prlimit")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to find prlimit, which limits stdio MCP servers' resources: %w", err)
+	}
+	limits = append(limits, "--", command)
+	return prlimit, append(limits, args...), nil
+}
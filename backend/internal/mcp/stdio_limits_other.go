@@ -0,0 +1,9 @@
+//go:build !linux
+
+package mcp
+
+// limitCommand leaves commands as they are where per-process limits can't
+// be set on a child; use the sandbox to limit servers' resources
+func limitCommand(p StdioPolicy, command string, args []string) (string, []string, error) {
+	return command, args, nil
+}
@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrStdioDisabled is returned when starting a server while an admin has
+// disabled user-defined stdio servers
+var ErrStdioDisabled = errors.New("stdio MCP servers are disabled by the administrator")
+
+// StdioPolicy restricts what stdio MCP servers may run and the resources
+// they get. The zero value allows any command, run directly with no limits.
+type StdioPolicy struct {
+	AllowedCommands []string // Commands servers may run, by name or absolute path; any if empty
+	DeniedCommands  []string // Commands servers may not run, even if allowed
+
+	// Sandbox runs servers in Docker containers rather than as child
+	// processes of the server
+	Sandbox        bool
+	SandboxImage   string
+	SandboxNetwork string
+	// WorkspaceDir returns the user's workspace, mounted at /workspace in
+	// the container; nil mounts nothing
+	WorkspaceDir func(userID string) (string, error)
+
+	MemoryLimitMB int    // 0 for no limit
+	CPULimit      string // Cores, e.g. "0.5"; only enforced in the sandbox
+	MaxProcesses  int    // 0 for no limit
+	MaxCPUSeconds int    // CPU time before a server is killed; 0 for no limit
+}
+
+// CheckCommand reports whether the policy lets servers run a command. A
+// denied name blocks the command under any path. An allowed entry matches
+// the command exactly, or as the absolute path the entry resolves to on
+// PATH, so "node" covers "/usr/bin/node" but not "./node".
+func (p StdioPolicy) CheckCommand(command string) error {
+	if commandDenied(p.DeniedCommands, command) {
+		return fmt.Errorf("command %q is not allowed", command)
+	}
+	if len(p.AllowedCommands) > 0 && !commandAllowed(p.AllowedCommands, command) {
+		return fmt.Errorf("command %q is not allowed. Allowed commands: %s", command, strings.Join(p.AllowedCommands, ", "))
+	}
+	return nil
+}
+
+func commandDenied(list []string, command string) bool {
+	name := filepath.Base(command)
+	for _, entry := range list {
+		if entry == command || entry == name {
+			return true
+		}
+	}
+	return false
+}
+
+func commandAllowed(list []string, command string) bool {
+	for _, entry := range list {
+		if entry == command {
+			return true
+		}
+		if !filepath.IsAbs(command) || strings.ContainsRune(entry, filepath.Separator) {
+			continue
+		}
+		if path, err := exec.LookPath(entry); err == nil && path == filepath.Clean(command) {
+			return true
+		}
+	}
+	return false
+}
+
+// containerName names the Docker container a sandboxed server runs in
+func containerName(serverID string) string {
+	return "prism-mcp-" + serverID
+}
+
+// command prepares the process for a server, with env holding its extra
+// environment variables
+func (p StdioPolicy) command(server *StdioServer, env []string) (*exec.Cmd, error) {
+	if !p.Sandbox {
+		command, args, err := limitCommand(p, server.Command, server.Args)
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.Command(command, args...)
+		cmd.Env = append(os.Environ(), env...)
+		return cmd, nil
+	}
+
+	args := []string{
+		"run", "-i", "--rm",
+		"--name", containerName(server.ID),
+		"--network", p.SandboxNetwork,
+	}
+	if p.MemoryLimitMB > 0 {
+		args = append(args, "--memory", fmt.Sprintf("%dm", p.MemoryLimitMB))
+	}
+	if p.CPULimit != "" {
+		args = append(args, "--cpus", p.CPULimit)
+	}
+	if p.MaxProcesses > 0 {
+		args = append(args, "--pids-limit", fmt.Sprint(p.MaxProcesses))
+	}
+	if p.MaxCPUSeconds > 0 {
+		args = append(args, "--ulimit", fmt.Sprintf("cpu=%d:%d", p.MaxCPUSeconds, p.MaxCPUSeconds))
+	}
+	if p.WorkspaceDir != nil {
+		dir, err := p.WorkspaceDir(server.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get workspace: %w", err)
+		}
+		args = append(args, "-v", dir+":/workspace", "-w", "/workspace")
+	}
+
+	// Variables are passed by name and read from the docker client's
+	// environment, so their values (which may be secrets) aren't in its
+	// command line
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		args = append(args, "-e", name)
+	}
+	args = append(args, p.SandboxImage, server.Command)
+	args = append(args, server.Args...)
+
+	cmd := exec.Command("docker", args...)
+	cmd.Env = append(os.Environ(), env...)
+	return cmd, nil
+}
+
+// removeContainer removes a sandboxed server's container, which killing the
+// docker client can leave running
+func removeContainer(serverID string) {
+	if err := exec.Command("docker", "rm", "-f", containerName(serverID)).Run(); err != nil {
+		log.Printf("Failed to remove container %s: %v", containerName(serverID), err)
+	}
+}
@@ -0,0 +1,198 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/storage"
+)
+
+// Artifact is a file kept from a successful build. Artifacts are copied out
+// of the workspace into the object store, so they stay downloadable after it
+// changes or is removed.
+type Artifact struct {
+	Path     string `json:"path"` // Relative to the workspace the build ran in
+	Size     int64  `json:"size"`
+	Modified int64  `json:"modified"`
+}
+
+// ErrArtifactNotFound is returned for builds and artifacts that don't exist
+// or belong to another user
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// validateArtifactPaths checks that artifact globs are well formed and stay
+// inside the workspace
+func validateArtifactPaths(patterns []string) error {
+	for _, pattern := range patterns {
+		clean := filepath.Clean(pattern)
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid artifact path %q: must be relative to the workspace", pattern)
+		}
+		if _, err := filepath.Match(clean, ""); err != nil {
+			return fmt.Errorf("invalid artifact path %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchArtifact reports whether a workspace-relative file path, or any
+// directory above it, matches one of the globs
+func matchArtifact(patterns []string, relPath string) bool {
+	for p := relPath; p != "." && p != string(filepath.Separator); p = filepath.Dir(p) {
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(filepath.Clean(pattern), p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// artifactPrefix is the storage prefix a build's artifacts are kept under
+func artifactPrefix(userID, buildID string) string {
+	return storage.Join("artifacts", userID, buildID)
+}
+
+// captureArtifacts copies the files matching the build's artifact globs into
+// the object store, stopping once SandboxArtifactMaxBytes would be exceeded.
+// Symlinks and .git directories are skipped.
+func (s *Service) captureArtifacts(build *Build) error {
+	if len(build.ArtifactPaths) == 0 {
+		return nil
+	}
+
+	prefix := artifactPrefix(build.UserID, build.ID)
+	var total int64
+	return filepath.WalkDir(build.WorkDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(build.WorkDir, path)
+		if err != nil || !matchArtifact(build.ArtifactPaths, relPath) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if total+info.Size() > s.config.SandboxArtifactMaxBytes {
+			log.Printf("Build %s artifacts exceed %d bytes; skipping %s", build.ID, s.config.SandboxArtifactMaxBytes, relPath)
+			return nil
+		}
+		total += info.Size()
+
+		return s.storeArtifact(path, storage.Join(prefix, filepath.ToSlash(relPath)), info.Size())
+	})
+}
+
+func (s *Service) storeArtifact(src, key string, size int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open artifact: %w", err)
+	}
+	defer in.Close()
+
+	if err := s.store.Put(context.Background(), key, in, size); err != nil {
+		return fmt.Errorf("failed to store artifact: %w", err)
+	}
+	return nil
+}
+
+// ListArtifacts lists the artifacts kept from one of a user's builds
+func (s *Service) ListArtifacts(userID, buildID string) ([]Artifact, error) {
+	prefix, objects, err := s.userArtifacts(userID, buildID)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := make([]Artifact, 0, len(objects))
+	for _, obj := range objects {
+		artifacts = append(artifacts, Artifact{
+			Path:     strings.TrimPrefix(obj.Key, prefix+"/"),
+			Size:     obj.Size,
+			Modified: obj.Modified.Unix(),
+		})
+	}
+	return artifacts, nil
+}
+
+// OpenArtifact opens one of a build's artifacts for reading. The caller
+// closes the reader.
+func (s *Service) OpenArtifact(userID, buildID, artifactPath string) (io.ReadCloser, *Artifact, error) {
+	if _, err := uuid.Parse(buildID); err != nil {
+		return nil, nil, ErrArtifactNotFound
+	}
+	if !s.ownsBuild(userID, buildID) {
+		return nil, nil, ErrArtifactNotFound
+	}
+
+	clean := filepath.Clean(filepath.FromSlash(artifactPath))
+	if filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return nil, nil, ErrArtifactNotFound
+	}
+
+	relPath := filepath.ToSlash(clean)
+	r, obj, err := s.store.Open(context.Background(), storage.Join(artifactPrefix(userID, buildID), relPath))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, ErrArtifactNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, &Artifact{Path: relPath, Size: obj.Size, Modified: obj.Modified.Unix()}, nil
+}
+
+// ownsBuild reports whether a build in this server's memory is the user's.
+// Builds it doesn't know, from before a restart or on another server sharing
+// the object store, are only found under the user's own prefix.
+func (s *Service) ownsBuild(userID, buildID string) bool {
+	s.mu.RLock()
+	build, ok := s.builds[buildID]
+	s.mu.RUnlock()
+	return !ok || build.UserID == userID
+}
+
+// userArtifacts lists a build's stored artifacts, or returns
+// ErrArtifactNotFound if the build isn't the user's. Builds this server
+// doesn't know are recognised by their stored artifacts.
+func (s *Service) userArtifacts(userID, buildID string) (string, []storage.Object, error) {
+	if _, err := uuid.Parse(buildID); err != nil {
+		return "", nil, ErrArtifactNotFound
+	}
+
+	s.mu.RLock()
+	build, ok := s.builds[buildID]
+	s.mu.RUnlock()
+	if ok && build.UserID != userID {
+		return "", nil, ErrArtifactNotFound
+	}
+
+	prefix := artifactPrefix(userID, buildID)
+	objects, err := s.store.List(context.Background(), prefix)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+	if !ok && len(objects) == 0 {
+		return "", nil, ErrArtifactNotFound
+	}
+	return prefix, objects, nil
+}
@@ -0,0 +1,74 @@
+package sandbox
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// allowedEnvNames are the environment variables workspace env settings may
+// set. Only names that programs read as plain values are allowed: many
+// others make programs load libraries, run commands or fetch code from
+// elsewhere (LD_PRELOAD, GIT_SSH_COMMAND, RUSTFLAGS, GOPROXY, npm_config_*,
+// LESSOPEN...), which would let an allowed command such as git or node run
+// any code.
+var allowedEnvNames = map[string]bool{
+	"NODE_ENV": true, "RAILS_ENV": true, "RACK_ENV": true, "APP_ENV": true, "FLASK_ENV": true,
+	"MIX_ENV": true, "ASPNETCORE_ENVIRONMENT": true, "ENVIRONMENT": true,
+	"CI": true, "DEBUG": true, "LOG_LEVEL": true, "NO_COLOR": true, "FORCE_COLOR": true,
+	"TZ": true, "LANG": true, "LC_ALL": true, "PORT": true, "HOST": true,
+	"DATABASE_URL": true, "REDIS_URL": true,
+	"GOOS": true, "GOARCH": true, "CGO_ENABLED": true, "GO111MODULE": true,
+	"PYTHONUNBUFFERED": true, "PYTHONDONTWRITEBYTECODE": true, "PYTHONIOENCODING": true,
+	"RUST_BACKTRACE": true, "RUST_LOG": true,
+}
+
+// allowedEnvPrefixes start names of variables read only by the application
+// being built, such as those bundlers embed in client code
+var allowedEnvPrefixes = []string{"APP_", "VITE_", "NEXT_PUBLIC_", "REACT_APP_"}
+
+// baseEnvNames are the server's environment variables commands inherit.
+// Everything else, such as the server's own secrets and configuration, is
+// left out.
+var baseEnvNames = []string{"PATH", "HOME", "USER", "LANG", "LC_ALL", "TZ", "TMPDIR", "TERM"}
+
+// IsAllowedEnvName reports whether workspace settings may set an
+// environment variable
+func IsAllowedEnvName(name string) bool {
+	if allowedEnvNames[name] {
+		return true
+	}
+	for _, prefix := range allowedEnvPrefixes {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandEnv returns the environment for commands run for users: the
+// server's base variables with the allowed ones of env added. Names that
+// aren't allowed, e.g. saved before they were rejected, are skipped.
+func CommandEnv(env map[string]string) []string {
+	result := make([]string, 0, len(baseEnvNames)+len(env))
+	for _, name := range baseEnvNames {
+		if _, set := env[name]; set && IsAllowedEnvName(name) {
+			continue
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			result = append(result, name+"="+value)
+		}
+	}
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		if IsAllowedEnvName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result = append(result, name+"="+env[name])
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ListOptions limits a file listing, so clients can show large trees a
+// level at a time
+type ListOptions struct {
+	Root   string // Workspace root name; "" for the default root
+	Path   string // Directory to list, relative to the root; "" for the root itself
+	Depth  int    // Levels of children to include; 0 for no limit
+	Offset int    // Entries of Path to skip
+	Limit  int    // Maximum entries of Path to return; 0 for no limit
+}
+
+// Listing is a page of a directory's entries. Pagination applies to the
+// entries of Path; their children are limited by depth only.
+type Listing struct {
+	Root       string     `json:"root,omitempty"`
+	Path       string     `json:"path"`
+	Files      []FileInfo `json:"files"`
+	Total      int        `json:"total"` // Entries in Path
+	Offset     int        `json:"offset"`
+	NextOffset int        `json:"next_offset,omitempty"` // Offset of the next page, if there is one
+}
+
+// ListDirectory lists a directory in one of a user's workspace roots
+func (s *Service) ListDirectory(userID string, opts ListOptions) (*Listing, error) {
+	if opts.Depth < 0 || opts.Offset < 0 || opts.Limit < 0 {
+		return nil, fmt.Errorf("depth, offset and limit must not be negative")
+	}
+
+	roots, err := s.Roots(userID)
+	if err != nil {
+		return nil, err
+	}
+	root := roots[0]
+	if opts.Root != "" {
+		found := false
+		for _, r := range roots {
+			if r.Name == opts.Root {
+				root, found = r, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("workspace root not found: %s", opts.Root)
+		}
+	}
+
+	relPath := ""
+	if opts.Path != "" {
+		dirPath, err := s.validateSandboxPath(root.Path, opts.Path)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(dirPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to access directory: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("path is not a directory")
+		}
+		if relPath = filepath.Clean(opts.Path); relPath == "." {
+			relPath = ""
+		}
+	}
+
+	// Expanding a directory the ignore rules hide is allowed; only its
+	// entries are filtered
+	matcher := s.IgnoreMatcher(root.Path)
+	entries, err := readEntries(matcher, root.Path, relPath)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &Listing{
+		Path:   relPath,
+		Total:  len(entries),
+		Offset: opts.Offset,
+		Files:  []FileInfo{},
+	}
+	if !root.Default {
+		listing.Root = root.Name
+	}
+
+	if opts.Offset >= len(entries) {
+		return listing, nil
+	}
+	entries = entries[opts.Offset:]
+	if opts.Limit > 0 && len(entries) > opts.Limit {
+		entries = entries[:opts.Limit]
+		listing.NextOffset = opts.Offset + opts.Limit
+	}
+
+	for _, entry := range entries {
+		if fileInfo, ok := s.entryInfo(matcher, root.Path, relPath, entry, opts.Depth); ok {
+			listing.Files = append(listing.Files, fileInfo)
+		}
+	}
+	return listing, nil
+}
@@ -0,0 +1,136 @@
+package sandbox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileConflictError is returned when a write expected a file to have some
+// content but another writer changed it first. CurrentHash lets the caller
+// re-read the file and retry against what is there now.
+type FileConflictError struct {
+	Path        string
+	CurrentHash string
+}
+
+func (e *FileConflictError) Error() string {
+	return fmt.Sprintf("file %s was modified since it was read (current hash %s); read it again and retry", e.Path, e.CurrentHash)
+}
+
+// ContentHash returns the hash writers pass as expectedHash to detect a file
+// changing under them. A missing file hashes to "".
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// fileLock serializes access to one path. refs counts holders and waiters
+// so the entry can be dropped when nobody uses it.
+type fileLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockFile takes the advisory lock for a resolved path and returns its
+// unlock function. Only writers going through the Service honor it; builds
+// and shell commands write the work directory directly.
+func (s *Service) lockFile(safePath string) func() {
+	s.fileLocksMu.Lock()
+	lock, ok := s.fileLocks[safePath]
+	if !ok {
+		lock = &fileLock{}
+		s.fileLocks[safePath] = lock
+	}
+	lock.refs++
+	s.fileLocksMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		s.fileLocksMu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(s.fileLocks, safePath)
+		}
+		s.fileLocksMu.Unlock()
+	}
+}
+
+// UpdateFile reads a file, passes its content to update and writes back what
+// update returns, holding the file's lock throughout so concurrent writers
+// can't interleave. exists is false for a file that doesn't exist yet. If
+// expectedHash is not empty and doesn't match the file's current content, a
+// *FileConflictError is returned and update is not called. Returns the hash
+// of the written content.
+func (s *Service) UpdateFile(userID, filePath, expectedHash string, update func(current string, exists bool) (string, error)) (string, error) {
+	// Resolve the path within its root (handles symlink attacks)
+	safePath, err := s.resolveFilePath(userID, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	unlock := s.lockFile(safePath)
+	defer unlock()
+
+	current, exists := "", true
+	data, err := os.ReadFile(safePath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		exists = false
+	case err != nil:
+		return "", fmt.Errorf("failed to read file: %w", err)
+	default:
+		current = string(data)
+	}
+
+	if expectedHash != "" {
+		currentHash := ""
+		if exists {
+			currentHash = ContentHash(current)
+		}
+		if currentHash != expectedHash {
+			return "", &FileConflictError{Path: filePath, CurrentHash: currentHash}
+		}
+	}
+
+	content, err := update(current, exists)
+	if err != nil {
+		return "", err
+	}
+
+	if err := writeFile(safePath, content); err != nil {
+		return "", err
+	}
+	return ContentHash(content), nil
+}
+
+// WriteFileIfMatch writes content to a file if its current content hashes to
+// expectedHash, or unconditionally if expectedHash is empty. Returns the hash
+// of the written content, or a *FileConflictError.
+func (s *Service) WriteFileIfMatch(userID, filePath, content, expectedHash string) (string, error) {
+	return s.UpdateFile(userID, filePath, expectedHash, func(string, bool) (string, error) {
+		return content, nil
+	})
+}
+
+// writeFile writes content to a resolved path, creating parent directories.
+// Callers hold the path's lock.
+func writeFile(safePath, content string) error {
+	// Create parent directories if needed
+	dir := filepath.Dir(safePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if err := os.WriteFile(safePath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
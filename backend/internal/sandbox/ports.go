@@ -0,0 +1,214 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// portPollInterval is how often a running build's processes are checked for
+// a listening socket until one is found
+const portPollInterval = 500 * time.Millisecond
+
+// portPatterns find the port a dev server reports it is listening on, e.g.
+// "Local: http://localhost:5173/" or "Listening on port 3000"
+var portPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`https?://(?:localhost|127\.0\.0\.1|0\.0\.0\.0|\[::1?\]):(\d{2,5})\b`),
+	regexp.MustCompile(`(?i)\b(?:listening|running|serving|started|ready)\b.*\bport\b\D{0,3}(\d{2,5})\b`),
+	regexp.MustCompile(`(?i)\blistening on\b\D*?:(\d{2,5})\b`),
+}
+
+// portFromOutput returns the port a line of build output says a server is
+// listening on, or 0. Output is only a hint: a build can print any port, so
+// the port is not used until the build's processes are seen listening on it.
+func portFromOutput(line string) int {
+	for _, pattern := range portPatterns {
+		if m := pattern.FindStringSubmatch(line); m != nil {
+			if port, err := strconv.Atoi(m[1]); err == nil && port > 0 && port < 65536 {
+				return port
+			}
+		}
+	}
+	return 0
+}
+
+// setBuildPort records the port a build's server listens on, and the proxy
+// URL it can be previewed at, keeping the first port found
+func (s *Service) setBuildPort(build *Build, port int) {
+	build.mu.Lock()
+	defer build.mu.Unlock()
+	if build.Port == 0 {
+		build.Port = port
+		build.PreviewURL = fmt.Sprintf("%s/preview/build/%s/", s.previewBaseURL(), build.ID)
+	}
+}
+
+// setPortHint records the first port the build's output mentions a server
+// listening on
+func (b *Build) setPortHint(port int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.portHint == 0 {
+		b.portHint = port
+	}
+}
+
+// choosePort picks the port to preview a build at from those its processes
+// listen on: the one its output named if it is among them, otherwise the
+// first
+func (b *Build) choosePort(listening []int) int {
+	b.mu.Lock()
+	hint := b.portHint
+	b.mu.Unlock()
+
+	for _, port := range listening {
+		if port == hint {
+			return port
+		}
+	}
+	return listening[0]
+}
+
+// GetPort returns the port the build's server listens on, or 0 if none has
+// been detected
+func (b *Build) GetPort() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Port
+}
+
+// PreviewURL returns where a build can be previewed: through the build proxy
+// if it has started a server, with a token that lets the user's browser open
+// it, otherwise the user's static preview
+func (s *Service) PreviewURL(build *Build) string {
+	build.mu.Lock()
+	previewURL := build.PreviewURL
+	build.mu.Unlock()
+
+	if previewURL == "" {
+		return s.GetPreviewServer(build.UserID)
+	}
+	if s.previewToken == nil {
+		return previewURL
+	}
+	token, err := s.previewToken(build.ID, build.UserID, time.Now().Add(s.config.PreviewTokenTTL))
+	if err != nil {
+		log.Printf("Failed to sign preview token for build %s: %v", build.ID, err)
+		return previewURL
+	}
+	return previewURL + "?preview_token=" + url.QueryEscape(token)
+}
+
+// watchPort polls the build's process tree for a listening TCP socket until
+// one is found or the build ends. Only ports the build's own processes
+// listen on are proxied, so a build can't point its preview at the server
+// or other local services by printing their address.
+func (s *Service) watchPort(ctx context.Context, build *Build, pid int) {
+	ticker := time.NewTicker(portPollInterval)
+	defer ticker.Stop()
+
+	for build.GetPort() == 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if ports := listeningPorts(pid); len(ports) > 0 {
+			s.setBuildPort(build, build.choosePort(ports))
+		}
+	}
+}
+
+// listeningPorts returns the TCP ports that a process or its descendants
+// listen on. It reads /proc, so it finds nothing on systems without one.
+func listeningPorts(pid int) []int {
+	listening := make(map[string]int) // port by socket inode
+	for _, name := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		readListeningSockets(name, listening)
+	}
+	if len(listening) == 0 {
+		return nil
+	}
+
+	var ports []int
+	for _, p := range processTree(pid) {
+		fds, _ := filepath.Glob(fmt.Sprintf("/proc/%d/fd/*", p))
+		for _, fd := range fds {
+			link, err := os.Readlink(fd)
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			if port, ok := listening[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")]; ok {
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports
+}
+
+// readListeningSockets adds the listening sockets in a /proc/net/tcp style
+// table to the map, keyed by inode
+func readListeningSockets(name string, listening map[string]int) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		// Fields: sl local_address rem_address st ... inode is the 10th
+		if len(fields) < 10 || fields[3] != "0A" {
+			continue
+		}
+		i := strings.LastIndex(fields[1], ":")
+		if i < 0 {
+			continue
+		}
+		port, err := strconv.ParseInt(fields[1][i+1:], 16, 32)
+		if err != nil {
+			continue
+		}
+		listening[fields[9]] = int(port)
+	}
+}
+
+// processTree returns a process and all of its descendants
+func processTree(pid int) []int {
+	children := make(map[int][]int)
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+	for _, stat := range stats {
+		data, err := os.ReadFile(stat)
+		if err != nil {
+			continue
+		}
+		// The command name in parentheses may contain spaces
+		s := string(data)
+		end := strings.LastIndex(s, ")")
+		if end < 0 {
+			continue
+		}
+		fields := strings.Fields(s[end+1:])
+		if len(fields) < 2 {
+			continue
+		}
+		child, err1 := strconv.Atoi(filepath.Base(filepath.Dir(stat)))
+		parent, err2 := strconv.Atoi(fields[1])
+		if err1 == nil && err2 == nil {
+			children[parent] = append(children[parent], child)
+		}
+	}
+
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree
+}
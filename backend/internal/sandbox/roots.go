@@ -0,0 +1,325 @@
+package sandbox
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// WorkspaceRoot is one of the directories a user works in at once, such as
+// the packages of a monorepo. The current workspace is the default root;
+// paths in any other root are written "name:path".
+type WorkspaceRoot struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Default bool   `json:"default"` // Used for paths without a root prefix
+}
+
+// Qualify returns a root-relative path in the form file tools accept
+func (r WorkspaceRoot) Qualify(relPath string) string {
+	if r.Default {
+		return relPath
+	}
+	return r.Name + ":" + relPath
+}
+
+// defaultRootName names the default root when it is the user's sandbox
+// directory rather than a folder they opened
+const defaultRootName = "workspace"
+
+var rootNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// Roots lists a user's workspace roots, the default one first
+func (s *Service) Roots(userID string) ([]WorkspaceRoot, error) {
+	workDir, err := s.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultRoot := WorkspaceRoot{Name: defaultRootName, Path: workDir, Default: true}
+	if filepath.Dir(workDir) != s.baseDir {
+		defaultRoot.Name = rootName(filepath.Base(workDir))
+	}
+	roots := []WorkspaceRoot{defaultRoot}
+
+	extra, err := s.extraRoots(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range extra {
+		// The current workspace may also have been opened as a root
+		if root.Path != workDir {
+			roots = append(roots, root)
+		}
+	}
+	return roots, nil
+}
+
+// extraRoots returns the roots a user opened besides the current
+// workspace, loading them from the database the first time
+func (s *Service) extraRoots(userID string) ([]WorkspaceRoot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if roots, ok := s.userRoots[userID]; ok {
+		return roots, nil
+	}
+
+	roots := []WorkspaceRoot{}
+	if s.workspaceRepo != nil {
+		workspaces, err := s.workspaceRepo.ListRoots(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, workspace := range workspaces {
+			// Skip roots whose directory was removed since
+			if info, statErr := os.Stat(workspace.Path); statErr != nil || !info.IsDir() {
+				continue
+			}
+			roots = append(roots, WorkspaceRoot{Name: workspace.Name, Path: workspace.Path})
+		}
+	}
+
+	s.userRoots[userID] = roots
+	return roots, nil
+}
+
+// AddRoot opens a directory as an extra workspace root. name defaults to
+// the directory's base name and must be unique among the user's roots.
+func (s *Service) AddRoot(userID, dir, name string) (*WorkspaceRoot, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("path is not a directory")
+	}
+
+	if name == "" {
+		name = rootName(filepath.Base(dir))
+	}
+	if !rootNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("root name must be 1-64 letters, digits, '.', '_' or '-'")
+	}
+
+	roots, err := s.Roots(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range roots {
+		if root.Path == dir {
+			return nil, fmt.Errorf("directory is already open as root %q", root.Name)
+		}
+		if root.Name == name {
+			return nil, fmt.Errorf("a root named %q already exists", name)
+		}
+	}
+
+	if s.workspaceRepo != nil {
+		workspace, err := s.workspaceRepo.Create(userID, dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if workspace.Name != name {
+			if err := s.workspaceRepo.UpdateName(workspace.ID, name); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.workspaceRepo.SetRoot(userID, workspace.ID, true); err != nil {
+			return nil, err
+		}
+	}
+
+	root := WorkspaceRoot{Name: name, Path: dir}
+	s.mu.Lock()
+	s.userRoots[userID] = append(s.userRoots[userID], root)
+	s.mu.Unlock()
+
+	return &root, nil
+}
+
+// RemoveRoot closes an extra workspace root. Its files are left alone.
+func (s *Service) RemoveRoot(userID, name string) error {
+	extra, err := s.extraRoots(userID)
+	if err != nil {
+		return err
+	}
+
+	remaining := make([]WorkspaceRoot, 0, len(extra))
+	var removed *WorkspaceRoot
+	for i, root := range extra {
+		if root.Name == name && removed == nil {
+			removed = &extra[i]
+			continue
+		}
+		remaining = append(remaining, root)
+	}
+	if removed == nil {
+		return fmt.Errorf("workspace root not found: %s", name)
+	}
+
+	if s.workspaceRepo != nil {
+		workspace, err := s.workspaceRepo.GetByPath(userID, removed.Path)
+		if err != nil {
+			return err
+		}
+		if workspace != nil {
+			if err := s.workspaceRepo.SetRoot(userID, workspace.ID, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.userRoots[userID] = remaining
+	s.mu.Unlock()
+	return nil
+}
+
+// ResolveRoot splits a path of the form "name:path" into the named root and
+// the path within it. Paths without a known root prefix belong to the
+// default root.
+func (s *Service) ResolveRoot(userID, path string) (WorkspaceRoot, string, error) {
+	roots, err := s.Roots(userID)
+	if err != nil {
+		return WorkspaceRoot{}, "", err
+	}
+	if root, rel, ok := splitRoot(roots, path); ok {
+		return root, rel, nil
+	}
+	return roots[0], path, nil
+}
+
+// splitRoot matches a path's prefix against roots
+func splitRoot(roots []WorkspaceRoot, path string) (WorkspaceRoot, string, bool) {
+	i := strings.Index(path, ":")
+	if i <= 0 {
+		return WorkspaceRoot{}, "", false
+	}
+	for _, root := range roots {
+		if root.Name == path[:i] {
+			return root, path[i+1:], true
+		}
+	}
+	return WorkspaceRoot{}, "", false
+}
+
+// resolveFilePath resolves a possibly root-prefixed path to a validated
+// absolute path inside its root
+func (s *Service) resolveFilePath(userID, filePath string) (string, error) {
+	root, rel, err := s.ResolveRoot(userID, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	// Validate path is within sandbox (handles symlink attacks)
+	return s.validateSandboxPath(root.Path, rel)
+}
+
+// ActiveRoot returns the name of the root a conversation's file tools
+// default to, or "" for the default root
+func (s *Service) ActiveRoot(userID, conversationID string) string {
+	if conversationID == "" {
+		return ""
+	}
+	key := userID + "/" + conversationID
+
+	s.mu.RLock()
+	name, ok := s.activeRoots[key]
+	s.mu.RUnlock()
+	if ok {
+		return name
+	}
+
+	if s.workspaceRepo != nil {
+		var err error
+		if name, err = s.workspaceRepo.GetConversationRoot(userID, conversationID); err != nil {
+			log.Printf("Warning: failed to get conversation root: %v", err)
+			return ""
+		}
+	}
+
+	s.mu.Lock()
+	s.activeRoots[key] = name
+	s.mu.Unlock()
+	return name
+}
+
+// SetActiveRoot sets the root a conversation's file tools default to. An
+// empty name switches back to the default root.
+func (s *Service) SetActiveRoot(userID, conversationID, name string) error {
+	if name != "" {
+		roots, err := s.Roots(userID)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, root := range roots {
+			if root.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("workspace root not found: %s", name)
+		}
+	}
+
+	if s.workspaceRepo != nil {
+		if err := s.workspaceRepo.SetConversationRoot(userID, conversationID, name); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.activeRoots[userID+"/"+conversationID] = name
+	s.mu.Unlock()
+	return nil
+}
+
+// ScopePath prefixes a path without a root with the conversation's active
+// root, so tools in that conversation work in it by default
+func (s *Service) ScopePath(userID, conversationID, path string) string {
+	active := s.ActiveRoot(userID, conversationID)
+	if active == "" {
+		return path
+	}
+
+	roots, err := s.Roots(userID)
+	if err != nil {
+		return path
+	}
+	if _, _, ok := splitRoot(roots, path); ok {
+		return path
+	}
+	for _, root := range roots {
+		// A root that has since been closed falls back to the default
+		if root.Name == active {
+			return root.Qualify(path)
+		}
+	}
+	return path
+}
+
+// rootName turns a directory name into a valid root name
+func rootName(base string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			return r
+		default:
+			return '-'
+		}
+	}, base)
+	name = strings.TrimLeft(name, "-_.")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	if name == "" {
+		return defaultRootName
+	}
+	return name
+}
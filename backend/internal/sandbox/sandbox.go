@@ -13,9 +13,10 @@ import (
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/jacklau/prism/internal/config"
 	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/ignore"
+	"github.com/jacklau/prism/internal/storage"
 )
 
 // BuildStatus represents the status of a build
@@ -27,23 +28,42 @@ const (
 	BuildStatusSuccess   BuildStatus = "success"
 	BuildStatusFailed    BuildStatus = "failed"
 	BuildStatusCancelled BuildStatus = "cancelled"
+
+	// BuildStatusCancelledBeforeStart is for builds stopped before their
+	// command was started
+	BuildStatusCancelledBeforeStart BuildStatus = "cancelled_before_start"
 )
 
+// IsFinished reports whether a build with this status has ended
+func (s BuildStatus) IsFinished() bool {
+	return s != BuildStatusPending && s != BuildStatusRunning
+}
+
 // Build represents a build process
 type Build struct {
-	ID         string
-	UserID     string
-	WorkDir    string
-	Command    string
-	Args       []string
-	Status     BuildStatus
-	StartTime  time.Time
-	EndTime    *time.Time
-	Output     []string
-	Error      string
-	PreviewURL string
-	cancel     context.CancelFunc
-	mu         sync.Mutex
+	ID            string
+	UserID        string
+	WorkDir       string
+	Command       string
+	Args          []string
+	Status        BuildStatus
+	StartTime     time.Time
+	EndTime       *time.Time
+	Output        []string
+	Error         string
+	PreviewURL    string   // Proxy URL of the server the build started, once its port is known
+	Port          int      // Port the build's server listens on, 0 until detected
+	ArtifactPaths []string // Globs of files kept as artifacts if the build succeeds
+	portHint      int      // Port the build's output says a server listens on, until confirmed
+	cancel        context.CancelFunc
+	mu            sync.Mutex
+}
+
+// GetStatus returns the build's status
+func (b *Build) GetStatus() BuildStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Status
 }
 
 // OutputLine represents a line of build output
@@ -64,6 +84,7 @@ type FileInfo struct {
 	Children    []FileInfo `json:"children,omitempty"`
 	Size        int64      `json:"size,omitempty"`
 	Modified    int64      `json:"modified,omitempty"`
+	Collapsed   bool       `json:"collapsed,omitempty"` // Directory whose children weren't listed; expand it to fetch them
 }
 
 // Service manages sandbox environments
@@ -71,9 +92,16 @@ type Service struct {
 	config        *config.Config
 	builds        map[string]*Build
 	userWorkDirs  map[string]string
+	userRoots     map[string][]WorkspaceRoot // Extra roots per user, besides the current workspace
+	activeRoots   map[string]string          // Active root name per user and conversation
 	workspaceRepo *repository.WorkspaceRepository
+	store         storage.Store // Where build artifacts are kept
+	previewToken  PreviewTokenFunc
 	mu            sync.RWMutex
 	baseDir       string
+
+	fileLocks   map[string]*fileLock // Per-path write locks, keyed by resolved path
+	fileLocksMu sync.Mutex
 }
 
 // NewService creates a new sandbox service
@@ -82,12 +110,20 @@ func NewService(cfg *config.Config) (*Service, error) {
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create sandbox directory: %w", err)
 	}
+	store, err := storage.NewLocalStore(cfg.UploadDir)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Service{
 		config:       cfg,
 		builds:       make(map[string]*Build),
 		userWorkDirs: make(map[string]string),
+		userRoots:    make(map[string][]WorkspaceRoot),
+		activeRoots:  make(map[string]string),
+		store:        store,
 		baseDir:      baseDir,
+		fileLocks:    make(map[string]*fileLock),
 	}, nil
 }
 
@@ -96,6 +132,22 @@ func (s *Service) SetWorkspaceRepository(repo *repository.WorkspaceRepository) {
 	s.workspaceRepo = repo
 }
 
+// PreviewTokenFunc signs a token that lets a browser open the preview of a
+// user's build until it expires
+type PreviewTokenFunc func(buildID, userID string, expiresAt time.Time) (string, error)
+
+// SetPreviewTokens sets how the tokens in build preview URLs are signed.
+// Without it, preview URLs carry no token and can't be opened.
+func (s *Service) SetPreviewTokens(sign PreviewTokenFunc) {
+	s.previewToken = sign
+}
+
+// SetObjectStore sets where build artifacts are kept, replacing the default
+// of the upload directory on local disk
+func (s *Service) SetObjectStore(store storage.Store) {
+	s.store = store
+}
+
 // GetOrCreateWorkDir gets or creates a working directory for a user
 func (s *Service) GetOrCreateWorkDir(userID string) (string, error) {
 	s.mu.Lock()
@@ -165,8 +217,19 @@ func (s *Service) SetWorkDir(userID string, dir string) error {
 	return nil
 }
 
-// StartBuild starts a new build process
-func (s *Service) StartBuild(userID, command string, args []string, outputHandler OutputHandler) (*Build, error) {
+// StartBuild starts a new build process with the given ID, which callers
+// choose so they can subscribe to its output first. The build is pending
+// until its command has been started. If it succeeds, files matching
+// artifactPaths, or SandboxArtifactPaths if none are given, are kept as its
+// artifacts.
+func (s *Service) StartBuild(id, userID, command string, args, artifactPaths []string, outputHandler OutputHandler) (*Build, error) {
+	if len(artifactPaths) == 0 {
+		artifactPaths = s.config.SandboxArtifactPaths
+	}
+	if err := validateArtifactPaths(artifactPaths); err != nil {
+		return nil, err
+	}
+
 	workDir, err := s.GetOrCreateWorkDir(userID)
 	if err != nil {
 		return nil, err
@@ -175,15 +238,17 @@ func (s *Service) StartBuild(userID, command string, args []string, outputHandle
 	ctx, cancel := context.WithTimeout(context.Background(), s.config.SandboxTimeout)
 
 	build := &Build{
-		ID:        uuid.New().String(),
+		ID:        id,
 		UserID:    userID,
 		WorkDir:   workDir,
 		Command:   command,
 		Args:      args,
-		Status:    BuildStatusRunning,
+		Status:    BuildStatusPending,
 		StartTime: time.Now(),
 		Output:    make([]string, 0),
 		cancel:    cancel,
+
+		ArtifactPaths: artifactPaths,
 	}
 
 	s.mu.Lock()
@@ -201,6 +266,7 @@ func (s *Service) runBuild(ctx context.Context, build *Build, outputHandler Outp
 
 	cmd := exec.CommandContext(ctx, build.Command, build.Args...)
 	cmd.Dir = build.WorkDir
+	cmd.Env = CommandEnv(nil)
 
 	// Create pipes for stdout and stderr
 	stdout, err := cmd.StdoutPipe()
@@ -215,11 +281,24 @@ func (s *Service) runBuild(ctx context.Context, build *Build, outputHandler Outp
 		return
 	}
 
-	if err := cmd.Start(); err != nil {
+	// Start the command unless the build was stopped while pending
+	build.mu.Lock()
+	if build.Status != BuildStatusPending {
+		build.mu.Unlock()
+		return
+	}
+	build.Status = BuildStatusRunning
+	err = cmd.Start()
+	build.mu.Unlock()
+	if err != nil {
 		s.finishBuild(build, BuildStatusFailed, fmt.Sprintf("failed to start command: %v", err))
 		return
 	}
 
+	// Find the port a dev server listens on, from its output or failing
+	// that from its sockets
+	go s.watchPort(ctx, build, cmd.Process.Pid)
+
 	// Read output concurrently
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -247,6 +326,11 @@ func (s *Service) runBuild(ctx context.Context, build *Build, outputHandler Outp
 		return
 	}
 
+	// Artifacts are in place before the build is reported successful
+	if err := s.captureArtifacts(build); err != nil {
+		log.Printf("Failed to capture artifacts of build %s: %v", build.ID, err)
+	}
+
 	s.finishBuild(build, BuildStatusSuccess, "")
 }
 
@@ -260,6 +344,10 @@ func (s *Service) readOutput(build *Build, r io.Reader, stream string, handler O
 		build.Output = append(build.Output, fmt.Sprintf("[%s] %s", stream, line))
 		build.mu.Unlock()
 
+		if port := portFromOutput(line); port != 0 {
+			build.setPortHint(port)
+		}
+
 		if handler != nil {
 			handler(OutputLine{
 				Content:   line,
@@ -281,21 +369,37 @@ func (s *Service) finishBuild(build *Build, status BuildStatus, errorMsg string)
 	build.Error = errorMsg
 }
 
-// StopBuild stops a running build
-func (s *Service) StopBuild(buildID string) error {
+// StopBuild stops a build and returns the status it ends with. A build whose
+// command hasn't started yet is never run and ends as
+// BuildStatusCancelledBeforeStart.
+func (s *Service) StopBuild(buildID string) (BuildStatus, error) {
 	s.mu.RLock()
 	build, ok := s.builds[buildID]
 	s.mu.RUnlock()
 
 	if !ok {
-		return fmt.Errorf("build not found: %s", buildID)
+		return "", fmt.Errorf("build not found: %s", buildID)
 	}
 
+	build.mu.Lock()
+	status := build.Status
+	switch status {
+	case BuildStatusPending:
+		now := time.Now()
+		status = BuildStatusCancelledBeforeStart
+		build.Status = status
+		build.EndTime = &now
+		build.Error = "build cancelled before start"
+	case BuildStatusRunning:
+		status = BuildStatusCancelled
+	}
+	build.mu.Unlock()
+
 	if build.cancel != nil {
 		build.cancel()
 	}
 
-	return nil
+	return status, nil
 }
 
 // GetBuild gets a build by ID
@@ -318,52 +422,85 @@ func (s *Service) ListFiles(userID string) ([]FileInfo, error) {
 		return nil, err
 	}
 
-	return s.walkDirectory(workDir, "")
+	return s.walkDirectory(s.IgnoreMatcher(workDir), workDir, "", 0)
+}
+
+// IgnoreMatcher returns a matcher for the files under a workspace root that
+// listings and searches should skip
+func (s *Service) IgnoreMatcher(root string) *ignore.Matcher {
+	return ignore.New(root, s.config.SandboxShowHidden)
 }
 
-// walkDirectory recursively walks a directory and returns file info
-func (s *Service) walkDirectory(baseDir, relativePath string) ([]FileInfo, error) {
-	fullPath := filepath.Join(baseDir, relativePath)
-	entries, err := os.ReadDir(fullPath)
+// walkDirectory walks a directory up to depth levels deep (0 for no limit)
+// and returns file info, leaving out ignored files
+func (s *Service) walkDirectory(matcher *ignore.Matcher, baseDir, relativePath string, depth int) ([]FileInfo, error) {
+	entries, err := readEntries(matcher, baseDir, relativePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read directory: %w", err)
+		return nil, err
 	}
 
 	files := make([]FileInfo, 0, len(entries))
 	for _, entry := range entries {
-		// Skip hidden files and common ignore patterns
-		if strings.HasPrefix(entry.Name(), ".") || entry.Name() == "node_modules" {
-			continue
+		if fileInfo, ok := s.entryInfo(matcher, baseDir, relativePath, entry, depth); ok {
+			files = append(files, fileInfo)
 		}
+	}
 
-		info, err := entry.Info()
-		if err != nil {
-			log.Printf("failed to get file info for %s: %v", entry.Name(), err)
-			continue
-		}
+	return files, nil
+}
 
-		filePath := filepath.Join(relativePath, entry.Name())
-		fileInfo := FileInfo{
-			Name:        entry.Name(),
-			Path:        filePath,
-			IsDirectory: entry.IsDir(),
-			Size:        info.Size(),
-			Modified:    info.ModTime().Unix(),
+// readEntries returns the entries of a directory that aren't ignored
+func readEntries(matcher *ignore.Matcher, baseDir, relativePath string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(filepath.Join(baseDir, relativePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	kept := entries[:0]
+	for _, entry := range entries {
+		if !matcher.Match(filepath.Join(relativePath, entry.Name()), entry.IsDir()) {
+			kept = append(kept, entry)
 		}
+	}
+	return kept, nil
+}
+
+// entryInfo describes a directory entry, with its children up to depth
+// levels deep. A directory at the depth limit is returned collapsed.
+func (s *Service) entryInfo(matcher *ignore.Matcher, baseDir, relativePath string, entry os.DirEntry, depth int) (FileInfo, bool) {
+	info, err := entry.Info()
+	if err != nil {
+		log.Printf("failed to get file info for %s: %v", entry.Name(), err)
+		return FileInfo{}, false
+	}
 
-		if entry.IsDir() {
-			children, err := s.walkDirectory(baseDir, filePath)
+	filePath := filepath.Join(relativePath, entry.Name())
+	fileInfo := FileInfo{
+		Name:        entry.Name(),
+		Path:        filePath,
+		IsDirectory: entry.IsDir(),
+		Size:        info.Size(),
+		Modified:    info.ModTime().Unix(),
+	}
+
+	if entry.IsDir() {
+		if depth == 1 {
+			fileInfo.Collapsed = true
+		} else {
+			childDepth := 0
+			if depth > 1 {
+				childDepth = depth - 1
+			}
+			children, err := s.walkDirectory(matcher, baseDir, filePath, childDepth)
 			if err != nil {
 				log.Printf("failed to walk directory %s: %v", filePath, err)
 			} else {
 				fileInfo.Children = children
 			}
 		}
-
-		files = append(files, fileInfo)
 	}
 
-	return files, nil
+	return fileInfo, true
 }
 
 // validateSandboxPath validates that a path is safely within the sandbox work directory
@@ -422,18 +559,16 @@ func (s *Service) validateSandboxPath(workDir, requestedPath string) (string, er
 
 // GetFileContent gets the content of a file
 func (s *Service) GetFileContent(userID, filePath string) (string, error) {
-	workDir, err := s.GetOrCreateWorkDir(userID)
-	if err != nil {
-		return "", err
-	}
-
-	// Validate path is within sandbox (handles symlink attacks)
-	safePath, err := s.validateSandboxPath(workDir, filePath)
+	// Resolve the path within its root (handles symlink attacks)
+	safePath, err := s.resolveFilePath(userID, filePath)
 	if err != nil {
 		return "", err
 	}
 
+	// Wait out any write in progress so a half-written file is never returned
+	unlock := s.lockFile(safePath)
 	content, err := os.ReadFile(safePath)
+	unlock()
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %w", err)
 	}
@@ -443,42 +578,28 @@ func (s *Service) GetFileContent(userID, filePath string) (string, error) {
 
 // WriteFile writes content to a file in the sandbox
 func (s *Service) WriteFile(userID, filePath, content string) error {
-	workDir, err := s.GetOrCreateWorkDir(userID)
+	// Resolve the path within its root (handles symlink attacks)
+	safePath, err := s.resolveFilePath(userID, filePath)
 	if err != nil {
 		return err
 	}
 
-	// Validate path is within sandbox (handles symlink attacks)
-	safePath, err := s.validateSandboxPath(workDir, filePath)
-	if err != nil {
-		return err
-	}
+	unlock := s.lockFile(safePath)
+	defer unlock()
 
-	// Create parent directories if needed
-	dir := filepath.Dir(safePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
-	}
-
-	if err := os.WriteFile(safePath, []byte(content), 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
-	}
-
-	return nil
+	return writeFile(safePath, content)
 }
 
 // DeleteFile deletes a file from the sandbox
 func (s *Service) DeleteFile(userID, filePath string) error {
-	workDir, err := s.GetOrCreateWorkDir(userID)
+	// Resolve the path within its root (handles symlink attacks)
+	safePath, err := s.resolveFilePath(userID, filePath)
 	if err != nil {
 		return err
 	}
 
-	// Validate path is within sandbox (handles symlink attacks)
-	safePath, err := s.validateSandboxPath(workDir, filePath)
-	if err != nil {
-		return err
-	}
+	unlock := s.lockFile(safePath)
+	defer unlock()
 
 	if err := os.RemoveAll(safePath); err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
@@ -489,29 +610,28 @@ func (s *Service) DeleteFile(userID, filePath string) error {
 
 // GetPreviewServer returns the URL for a preview server for a user
 func (s *Service) GetPreviewServer(userID string) string {
-	// Use configured preview URL if set, otherwise use frontend URL
-	baseURL := s.config.SandboxPreviewURL
-	if baseURL == "" {
-		baseURL = s.config.FrontendURL
+	return fmt.Sprintf("%s/preview/%s", s.previewBaseURL(), userID)
+}
+
+// previewBaseURL is the configured preview URL if set, otherwise the
+// frontend URL
+func (s *Service) previewBaseURL() string {
+	if s.config.SandboxPreviewURL != "" {
+		return s.config.SandboxPreviewURL
 	}
-	return fmt.Sprintf("%s/preview/%s", baseURL, userID)
+	return s.config.FrontendURL
 }
 
 // RenameFile renames or moves a file within the sandbox
 func (s *Service) RenameFile(userID, srcPath, destPath string) error {
-	workDir, err := s.GetOrCreateWorkDir(userID)
-	if err != nil {
-		return err
-	}
-
 	// Validate source path is within sandbox
-	safeSrc, err := s.validateSandboxPath(workDir, srcPath)
+	safeSrc, err := s.resolveFilePath(userID, srcPath)
 	if err != nil {
 		return fmt.Errorf("invalid source path: %w", err)
 	}
 
 	// Validate destination path is within sandbox
-	safeDest, err := s.validateSandboxPath(workDir, destPath)
+	safeDest, err := s.resolveFilePath(userID, destPath)
 	if err != nil {
 		return fmt.Errorf("invalid destination path: %w", err)
 	}
@@ -542,13 +662,8 @@ func (s *Service) RenameFile(userID, srcPath, destPath string) error {
 
 // CreateDirectory creates a directory in the sandbox
 func (s *Service) CreateDirectory(userID, dirPath string) error {
-	workDir, err := s.GetOrCreateWorkDir(userID)
-	if err != nil {
-		return err
-	}
-
 	// Validate path is within sandbox
-	safePath, err := s.validateSandboxPath(workDir, dirPath)
+	safePath, err := s.resolveFilePath(userID, dirPath)
 	if err != nil {
 		return err
 	}
@@ -573,3 +688,59 @@ func (s *Service) CreateDirectory(userID, dirPath string) error {
 func (s *Service) GetWorkspaceRepository() *repository.WorkspaceRepository {
 	return s.workspaceRepo
 }
+
+// WorkspaceSettings returns the settings of a user's current workspace, or
+// nil if it has none
+func (s *Service) WorkspaceSettings(userID string) (*repository.WorkspaceSettings, error) {
+	if s.workspaceRepo == nil {
+		return nil, nil
+	}
+	dir, err := s.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.workspaceRepo.GetSettings(userID, dir)
+}
+
+// SetWorkspaceSettings replaces the settings of a user's current workspace,
+// recording the workspace first if it is the default sandbox directory
+func (s *Service) SetWorkspaceSettings(userID string, settings *repository.WorkspaceSettings) error {
+	if s.workspaceRepo == nil {
+		return fmt.Errorf("workspace settings are not available")
+	}
+	dir, err := s.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return err
+	}
+	workspace, err := s.workspaceRepo.Create(userID, dir, filepath.Base(dir))
+	if err != nil {
+		return err
+	}
+	return s.workspaceRepo.UpdateSettings(workspace.ID, settings)
+}
+
+// RemoveUser deletes a user's sandbox directory and forgets their workspace
+// state. Directories the user opened elsewhere on disk are left alone.
+func (s *Service) RemoveUser(userID string) error {
+	if userID == "" || strings.ContainsAny(userID, `/\`) || userID == "." || userID == ".." {
+		return fmt.Errorf("invalid user ID: %q", userID)
+	}
+
+	s.mu.Lock()
+	delete(s.userWorkDirs, userID)
+	delete(s.userRoots, userID)
+	for key := range s.activeRoots {
+		if strings.HasPrefix(key, userID+"/") {
+			delete(s.activeRoots, key)
+		}
+	}
+	s.mu.Unlock()
+
+	if err := os.RemoveAll(filepath.Join(s.baseDir, userID)); err != nil {
+		return fmt.Errorf("failed to remove sandbox directory: %w", err)
+	}
+	if err := s.store.DeletePrefix(context.Background(), artifactPrefix(userID, "")); err != nil {
+		return fmt.Errorf("failed to remove build artifacts: %w", err)
+	}
+	return nil
+}
@@ -3,12 +3,14 @@ package security
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
+	"strings"
 
 	"golang.org/x/crypto/argon2"
 )
@@ -86,6 +88,36 @@ func (s *EncryptionService) Decrypt(ciphertext, nonce []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
+// DecryptHex decrypts a value stored as "nonce_hex:ciphertext_hex", the
+// format GitHub tokens are stored in
+func (s *EncryptionService) DecryptHex(encoded string) ([]byte, error) {
+	nonceHex, ciphertextHex, ok := strings.Cut(encoded, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid encrypted value format")
+	}
+
+	nonce, err := hex.DecodeString(nonceHex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode nonce: %w", err)
+	}
+	ciphertext, err := hex.DecodeString(ciphertextHex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+
+	return s.Decrypt(ciphertext, nonce)
+}
+
+// MAC returns a hex HMAC-SHA256 of data under a key derived from the master
+// key. Unlike a plain hash, it identifies encrypted content without letting
+// anyone who can read the database confirm a guess at it.
+func (s *EncryptionService) MAC(data []byte) string {
+	key := sha256.Sum256(append([]byte("prism-mac:"), s.masterKey...))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 // HashPassword hashes a password using Argon2id
 func HashPassword(password string) (string, error) {
 	salt := make([]byte, 16)
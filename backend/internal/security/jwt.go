@@ -130,6 +130,120 @@ func (s *JWTService) validateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
+// GenerateShareToken generates a signed token for a public conversation share link.
+// The link ID is carried in the token ID claim and the conversation ID in the subject.
+func (s *JWTService) GenerateShareToken(linkID, conversationID string, expiresAt time.Time) (string, error) {
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        linkID,
+			Subject:   conversationID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "prism",
+		},
+		Type: "share",
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signedToken, err := token.SignedString(s.secretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign share token: %w", err)
+	}
+
+	return signedToken, nil
+}
+
+// ValidateShareToken validates a share link token and returns the claims
+func (s *JWTService) ValidateShareToken(tokenString string) (*Claims, error) {
+	claims, err := s.validateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Type != "share" {
+		return nil, fmt.Errorf("invalid token type: expected share, got %s", claims.Type)
+	}
+
+	return claims, nil
+}
+
+// GenerateObserverToken generates a signed token that lets a WebSocket
+// connection watch one of a user's topic streams without acting on it. The
+// token ID is carried in the ID claim and the topic in the subject.
+func (s *JWTService) GenerateObserverToken(tokenID, userID, topic string, expiresAt time.Time) (string, error) {
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Subject:   topic,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "prism",
+		},
+		UserID: userID,
+		Type:   "observer",
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signedToken, err := token.SignedString(s.secretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign observer token: %w", err)
+	}
+
+	return signedToken, nil
+}
+
+// ValidateObserverToken validates an observer token and returns the claims
+func (s *JWTService) ValidateObserverToken(tokenString string) (*Claims, error) {
+	claims, err := s.validateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Type != "observer" {
+		return nil, fmt.Errorf("invalid token type: expected observer, got %s", claims.Type)
+	}
+
+	return claims, nil
+}
+
+// GeneratePreviewToken generates a signed token that lets a browser open
+// the preview of one of a user's builds, which it loads without the user's
+// access token. The build ID is carried in the subject.
+func (s *JWTService) GeneratePreviewToken(buildID, userID string, expiresAt time.Time) (string, error) {
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   buildID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "prism",
+		},
+		UserID: userID,
+		Type:   "preview",
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signedToken, err := token.SignedString(s.secretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign preview token: %w", err)
+	}
+
+	return signedToken, nil
+}
+
+// ValidatePreviewToken validates a build preview token and returns the claims
+func (s *JWTService) ValidatePreviewToken(tokenString string) (*Claims, error) {
+	claims, err := s.validateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Type != "preview" {
+		return nil, fmt.Errorf("invalid token type: expected preview, got %s", claims.Type)
+	}
+
+	return claims, nil
+}
+
 // RefreshTokens generates a new token pair from a valid refresh token
 func (s *JWTService) RefreshTokens(refreshToken string) (*TokenPair, error) {
 	claims, err := s.ValidateRefreshToken(refreshToken)
@@ -0,0 +1,76 @@
+package security
+
+import "regexp"
+
+// redactedPlaceholder replaces secrets found in redacted text
+const redactedPlaceholder = "[REDACTED]"
+
+// secretPatterns match common credential formats. Patterns with a capture
+// group keep the first group (e.g. the key name) and redact the rest.
+var secretPatterns = []*regexp.Regexp{
+	// Provider API keys
+	regexp.MustCompile(`sk-ant-[A-Za-z0-9_\-]{16,}`),
+	regexp.MustCompile(`sk-(?:proj-)?[A-Za-z0-9_\-]{20,}`),
+	regexp.MustCompile(`AIza[0-9A-Za-z_\-]{35}`),
+	// GitHub tokens
+	regexp.MustCompile(`(?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36,}`),
+	regexp.MustCompile(`github_pat_[A-Za-z0-9_]{22,}`),
+	// Slack tokens and webhooks
+	regexp.MustCompile(`xox[abposr]-[A-Za-z0-9\-]{10,}`),
+	regexp.MustCompile(`https://hooks\.slack\.com/services/[A-Za-z0-9/]+`),
+	regexp.MustCompile(`https://(?:discord|discordapp)\.com/api/webhooks/[A-Za-z0-9/_\-]+`),
+	// AWS access keys
+	regexp.MustCompile(`(?:AKIA|ASIA)[0-9A-Z]{16}`),
+	// Private key blocks
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	// JWTs
+	regexp.MustCompile(`eyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`),
+	// Bearer tokens in headers
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._\-]{16,}`),
+	// key=value and "key": "value" assignments for secret-looking names
+	regexp.MustCompile(`(?i)((?:api[_-]?key|secret|token|password|passwd)["']?\s*[:=]\s*["']?)[^\s"',]{6,}`),
+}
+
+// RedactSecrets replaces credentials such as API keys, tokens and private
+// keys in text with a placeholder
+func RedactSecrets(text string) string {
+	for _, pattern := range secretPatterns {
+		if pattern.NumSubexp() > 0 {
+			text = pattern.ReplaceAllString(text, "${1}"+redactedPlaceholder)
+		} else {
+			text = pattern.ReplaceAllString(text, redactedPlaceholder)
+		}
+	}
+	return text
+}
+
+// RedactValue redacts secrets in an arbitrary JSON-like value, walking maps
+// and slices and redacting any string values. Values under secret-looking
+// keys are redacted entirely.
+func RedactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return RedactSecrets(v)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			if secretKeyPattern.MatchString(key) {
+				redacted[key] = redactedPlaceholder
+				continue
+			}
+			redacted[key] = RedactValue(val)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, val := range v {
+			redacted[i] = RedactValue(val)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// secretKeyPattern matches map keys whose values should never be shown
+var secretKeyPattern = regexp.MustCompile(`(?i)^(api[_-]?key|(client[_-]?)?secret|((access|refresh|auth|bot)[_-]?)?token|password|passwd|authorization|credentials?)$`)
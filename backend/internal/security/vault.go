@@ -0,0 +1,204 @@
+package security
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// secretReferencePattern matches a reference to a vault secret, e.g.
+// {{secret:GITHUB_TOKEN}}
+var secretReferencePattern = regexp.MustCompile(`\{\{\s*secret:([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// SecretNamePattern is the form secret names take
+var SecretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// SecretReference returns the reference to a named secret
+func SecretReference(name string) string {
+	return "{{secret:" + name + "}}"
+}
+
+// SecretLookup returns a user's secret by name, reporting false if they
+// have none by that name
+type SecretLookup func(userID, name string) (string, bool, error)
+
+// SecretVault substitutes users' secrets for references to them. Secrets are
+// only resolved at the point of use, so the references are what gets stored
+// in configuration, shown to the LLM and kept in chat history.
+type SecretVault struct {
+	lookup SecretLookup
+}
+
+// NewSecretVault creates a vault that reads secrets with the given lookup
+func NewSecretVault(lookup SecretLookup) *SecretVault {
+	return &SecretVault{lookup: lookup}
+}
+
+// ResolvedSecrets records the secrets substituted for references, by name,
+// so their values can be masked in output
+type ResolvedSecrets map[string]string
+
+// Resolve replaces the secret references in text with the user's secrets,
+// adding them to resolved. It fails if a referenced secret doesn't exist.
+func (v *SecretVault) Resolve(userID, text string, resolved ResolvedSecrets) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	var lookupErr error
+	result := secretReferencePattern.ReplaceAllStringFunc(text, func(ref string) string {
+		if lookupErr != nil {
+			return ref
+		}
+		name := secretReferencePattern.FindStringSubmatch(ref)[1]
+		if value, ok := resolved[name]; ok {
+			return value
+		}
+
+		value, ok, err := v.lookup(userID, name)
+		if err != nil {
+			lookupErr = err
+			return ref
+		}
+		if !ok {
+			lookupErr = fmt.Errorf("secret %s not found", name)
+			return ref
+		}
+		resolved[name] = value
+		return value
+	})
+	if lookupErr != nil {
+		return "", lookupErr
+	}
+	return result, nil
+}
+
+// ResolveAll resolves the secret references in each of the strings
+func (v *SecretVault) ResolveAll(userID string, texts []string, resolved ResolvedSecrets) ([]string, error) {
+	result := make([]string, len(texts))
+	for i, text := range texts {
+		var err error
+		if result[i], err = v.Resolve(userID, text, resolved); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ResolveValue resolves the secret references in the strings of a JSON-like
+// value, walking maps and slices. The value itself is left unchanged.
+func (v *SecretVault) ResolveValue(userID string, value interface{}, resolved ResolvedSecrets) (interface{}, error) {
+	switch val := value.(type) {
+	case string:
+		return v.Resolve(userID, val, resolved)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(val))
+		for key, item := range val {
+			var err error
+			if result[key], err = v.ResolveValue(userID, item, resolved); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, item := range val {
+			var err error
+			if result[i], err = v.ResolveValue(userID, item, resolved); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	default:
+		return value, nil
+	}
+}
+
+// HasSecretReference reports whether any string in a JSON-like value holds
+// a secret reference
+func HasSecretReference(value interface{}) bool {
+	switch val := value.(type) {
+	case string:
+		return secretReferencePattern.MatchString(val)
+	case map[string]interface{}:
+		for _, item := range val {
+			if HasSecretReference(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range val {
+			if HasSecretReference(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// minMaskedSecretLength is the length below which secret values aren't
+// masked, since masking every occurrence of them would garble output
+const minMaskedSecretLength = 4
+
+// Mask replaces the resolved secrets' values in text with references to
+// them, longest values first so one secret containing another is masked
+// whole
+func (r ResolvedSecrets) Mask(text string) string {
+	if len(r) == 0 {
+		return text
+	}
+
+	names := make([]string, 0, len(r))
+	for name, value := range r {
+		if len(value) >= minMaskedSecretLength {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return len(r[names[i]]) > len(r[names[j]])
+	})
+	for _, name := range names {
+		text = strings.ReplaceAll(text, r[name], SecretReference(name))
+	}
+	return text
+}
+
+// MaskValue masks the resolved secrets in the strings of a value. Values
+// other than strings, maps and slices are converted through JSON if they
+// contain a secret.
+func (r ResolvedSecrets) MaskValue(value interface{}) interface{} {
+	if len(r) == 0 {
+		return value
+	}
+
+	switch val := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return r.Mask(val)
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(val))
+		for key, item := range val {
+			masked[key] = r.MaskValue(item)
+		}
+		return masked
+	case []interface{}:
+		masked := make([]interface{}, len(val))
+		for i, item := range val {
+			masked[i] = r.MaskValue(item)
+		}
+		return masked
+	default:
+		data, err := json.Marshal(value)
+		if err != nil || r.Mask(string(data)) == string(data) {
+			return value
+		}
+		var generic interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return value
+		}
+		return r.MaskValue(generic)
+	}
+}
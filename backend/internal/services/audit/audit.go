@@ -0,0 +1,301 @@
+// Package audit scans workspace dependencies for known vulnerabilities with
+// the ecosystem's own tooling (govulncheck, npm audit, pip-audit) and
+// normalizes the results into a single report.
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jacklau/prism/internal/integrations/github"
+	"github.com/jacklau/prism/internal/services/coderunner"
+)
+
+// Supported ecosystems
+const (
+	EcosystemGo     = "go"
+	EcosystemNPM    = "npm"
+	EcosystemPython = "python"
+)
+
+// Normalized severities, from most to least severe
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityModerate = "moderate"
+	SeverityLow      = "low"
+	SeverityUnknown  = "unknown"
+)
+
+const defaultTimeout = 5 * time.Minute
+
+var (
+	// ErrNoManifests is returned when a workspace has no supported dependency manifests
+	ErrNoManifests = errors.New("no supported dependency manifests found (go.mod, package-lock.json, requirements.txt or pyproject.toml)")
+
+	// ErrUnsupportedEcosystem is returned for an unknown ecosystem name
+	ErrUnsupportedEcosystem = errors.New("unsupported ecosystem")
+)
+
+// severityRank orders severities for sorting
+var severityRank = map[string]int{
+	SeverityCritical: 0,
+	SeverityHigh:     1,
+	SeverityModerate: 2,
+	SeverityLow:      3,
+	SeverityUnknown:  4,
+}
+
+// Vulnerability is a single advisory affecting a dependency
+type Vulnerability struct {
+	ID               string   `json:"id"`
+	Aliases          []string `json:"aliases,omitempty"`
+	Ecosystem        string   `json:"ecosystem"`
+	Package          string   `json:"package"`
+	InstalledVersion string   `json:"installed_version,omitempty"`
+	AffectedRange    string   `json:"affected_range,omitempty"`
+	FixedIn          string   `json:"fixed_in,omitempty"`
+	Severity         string   `json:"severity"`
+	Summary          string   `json:"summary,omitempty"`
+	URL              string   `json:"url,omitempty"`
+	// Reachable is set for Go when govulncheck found a call path to the vulnerable code
+	Reachable bool `json:"reachable,omitempty"`
+}
+
+// Key identifies a vulnerability in a package across runs
+func (v Vulnerability) Key() string {
+	return v.Ecosystem + ":" + v.Package + ":" + v.ID
+}
+
+// ScanResult reports how scanning one ecosystem went
+type ScanResult struct {
+	Ecosystem       string `json:"ecosystem"`
+	Tool            string `json:"tool"`
+	Vulnerabilities int    `json:"vulnerabilities"`
+	Error           string `json:"error,omitempty"`
+}
+
+// Report is the normalized result of auditing a workspace
+type Report struct {
+	Scans           []ScanResult    `json:"scans"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+	Counts          map[string]int  `json:"counts"`
+	ScannedAt       time.Time       `json:"scanned_at"`
+}
+
+// Failed reports whether every scan in the report errored
+func (r *Report) Failed() bool {
+	for _, scan := range r.Scans {
+		if scan.Error == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Errors joins the errors of failed scans
+func (r *Report) Errors() string {
+	var errs []string
+	for _, scan := range r.Scans {
+		if scan.Error != "" {
+			errs = append(errs, scan.Ecosystem+": "+scan.Error)
+		}
+	}
+	return strings.Join(errs, "; ")
+}
+
+// scanner describes how to audit one ecosystem
+type scanner struct {
+	tool    string
+	command func(workDir string) string
+	parse   func(stdout []byte) ([]Vulnerability, error)
+}
+
+var scanners = map[string]scanner{
+	EcosystemGo: {
+		tool:    "govulncheck",
+		command: func(string) string { return "govulncheck -json ./..." },
+		parse:   parseGovulncheck,
+	},
+	EcosystemNPM: {
+		tool:    "npm",
+		command: func(string) string { return "npm audit --json" },
+		parse:   parseNPMAudit,
+	},
+	EcosystemPython: {
+		tool: "pip-audit",
+		command: func(workDir string) string {
+			if fileExists(filepath.Join(workDir, "requirements.txt")) {
+				return "pip-audit -r requirements.txt -f json --progress-spinner off"
+			}
+			return "pip-audit -f json --progress-spinner off ."
+		},
+		parse: parsePipAudit,
+	},
+}
+
+// Config holds configuration for dependency audits
+type Config struct {
+	// Timeout bounds each ecosystem's scan
+	Timeout time.Duration
+}
+
+// Service runs dependency audits through the code runner
+type Service struct {
+	runner *coderunner.Runner
+	config Config
+}
+
+// NewService creates a new audit service
+func NewService(runner *coderunner.Runner, config Config) *Service {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	return &Service{runner: runner, config: config}
+}
+
+// DetectEcosystems returns the ecosystems with manifests at the workspace root
+func DetectEcosystems(workDir string) []string {
+	var ecosystems []string
+	if fileExists(filepath.Join(workDir, "go.mod")) {
+		ecosystems = append(ecosystems, EcosystemGo)
+	}
+	if fileExists(filepath.Join(workDir, "package-lock.json")) || fileExists(filepath.Join(workDir, "npm-shrinkwrap.json")) {
+		ecosystems = append(ecosystems, EcosystemNPM)
+	}
+	if fileExists(filepath.Join(workDir, "requirements.txt")) || fileExists(filepath.Join(workDir, "pyproject.toml")) {
+		ecosystems = append(ecosystems, EcosystemPython)
+	}
+	return ecosystems
+}
+
+// Audit scans the given ecosystems in a workspace, or every detected one if
+// none are given. A failing scanner is reported in the result rather than
+// failing the whole audit.
+func (s *Service) Audit(workDir string, ecosystems []string) (*Report, error) {
+	return s.AuditWithProgress(workDir, ecosystems, nil)
+}
+
+// AuditWithProgress runs Audit, calling onScan, if set, before each
+// ecosystem is scanned with its index and the number of ecosystems
+func (s *Service) AuditWithProgress(workDir string, ecosystems []string, onScan func(ecosystem string, index, total int)) (*Report, error) {
+	if len(ecosystems) == 0 {
+		ecosystems = DetectEcosystems(workDir)
+		if len(ecosystems) == 0 {
+			return nil, ErrNoManifests
+		}
+	}
+
+	report := &Report{
+		Scans:           make([]ScanResult, 0, len(ecosystems)),
+		Vulnerabilities: []Vulnerability{},
+		Counts:          make(map[string]int),
+		ScannedAt:       time.Now(),
+	}
+
+	for i, ecosystem := range ecosystems {
+		sc, ok := scanners[ecosystem]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedEcosystem, ecosystem)
+		}
+		if onScan != nil {
+			onScan(ecosystem, i, len(ecosystems))
+		}
+
+		result := ScanResult{Ecosystem: ecosystem, Tool: sc.tool}
+		vulns, err := s.scan(workDir, sc)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			for i := range vulns {
+				vulns[i].Ecosystem = ecosystem
+				if vulns[i].Severity == "" {
+					vulns[i].Severity = SeverityUnknown
+				}
+				report.Counts[vulns[i].Severity]++
+			}
+			result.Vulnerabilities = len(vulns)
+			report.Vulnerabilities = append(report.Vulnerabilities, vulns...)
+		}
+		report.Scans = append(report.Scans, result)
+	}
+
+	sort.SliceStable(report.Vulnerabilities, func(i, j int) bool {
+		a, b := report.Vulnerabilities[i], report.Vulnerabilities[j]
+		if severityRank[a.Severity] != severityRank[b.Severity] {
+			return severityRank[a.Severity] < severityRank[b.Severity]
+		}
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.ID < b.ID
+	})
+
+	return report, nil
+}
+
+// scan runs one scanner and parses its output. Audit tools exit non-zero
+// when they find vulnerabilities, so output is parsed regardless of the
+// exit code and only missing tools or unparseable output are errors.
+func (s *Service) scan(workDir string, sc scanner) ([]Vulnerability, error) {
+	result, err := s.runner.Run(&github.CodeRunRequest{
+		Command:     sc.command(workDir),
+		Environment: "shell",
+		WorkDir:     workDir,
+		Timeout:     int(s.config.Timeout.Seconds()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.ExitCode == 127 || strings.Contains(result.Stderr, "command not found") {
+		return nil, fmt.Errorf("%s is not installed", sc.tool)
+	}
+
+	stdout := strings.TrimSpace(result.Stdout)
+	if stdout == "" {
+		if result.ExitCode != 0 {
+			return nil, fmt.Errorf("%s failed: %s", sc.tool, truncate(strings.TrimSpace(result.Stderr), 500))
+		}
+		return nil, nil
+	}
+
+	vulns, err := sc.parse([]byte(stdout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s output: %w", sc.tool, err)
+	}
+	return vulns, nil
+}
+
+// NormalizeSeverity maps tool-specific severities onto the normalized set
+func NormalizeSeverity(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical":
+		return SeverityCritical
+	case "high":
+		return SeverityHigh
+	case "moderate", "medium":
+		return SeverityModerate
+	case "low", "info":
+		return SeverityLow
+	default:
+		return SeverityUnknown
+	}
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
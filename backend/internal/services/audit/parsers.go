@@ -0,0 +1,258 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// govulncheck -json emits a stream of messages; only OSV entries and
+// findings matter here
+type govulncheckMessage struct {
+	OSV *struct {
+		ID               string   `json:"id"`
+		Aliases          []string `json:"aliases"`
+		Summary          string   `json:"summary"`
+		Details          string   `json:"details"`
+		DatabaseSpecific struct {
+			URL string `json:"url"`
+		} `json:"database_specific"`
+	} `json:"osv"`
+	Finding *struct {
+		OSV          string `json:"osv"`
+		FixedVersion string `json:"fixed_version"`
+		Trace        []struct {
+			Module   string `json:"module"`
+			Version  string `json:"version"`
+			Package  string `json:"package"`
+			Function string `json:"function"`
+		} `json:"trace"`
+	} `json:"finding"`
+}
+
+// parseGovulncheck normalizes govulncheck's JSON stream. Findings are
+// reported per module; a finding whose trace reaches a function means the
+// vulnerable code is called.
+func parseGovulncheck(stdout []byte) ([]Vulnerability, error) {
+	type osvInfo struct {
+		aliases []string
+		summary string
+		url     string
+	}
+	osvs := make(map[string]osvInfo)
+	byKey := make(map[string]*Vulnerability)
+	var order []string
+
+	decoder := json.NewDecoder(bytes.NewReader(stdout))
+	for {
+		var msg govulncheckMessage
+		if err := decoder.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if msg.OSV != nil {
+			info := osvInfo{aliases: msg.OSV.Aliases, summary: msg.OSV.Summary, url: msg.OSV.DatabaseSpecific.URL}
+			if info.summary == "" {
+				info.summary = firstLine(msg.OSV.Details)
+			}
+			if info.url == "" {
+				info.url = "https://pkg.go.dev/vuln/" + msg.OSV.ID
+			}
+			osvs[msg.OSV.ID] = info
+		}
+
+		if msg.Finding == nil || len(msg.Finding.Trace) == 0 {
+			continue
+		}
+		frame := msg.Finding.Trace[0]
+		key := msg.Finding.OSV + "\x00" + frame.Module
+		vuln, ok := byKey[key]
+		if !ok {
+			vuln = &Vulnerability{
+				ID:               msg.Finding.OSV,
+				Package:          frame.Module,
+				InstalledVersion: frame.Version,
+				FixedIn:          msg.Finding.FixedVersion,
+			}
+			byKey[key] = vuln
+			order = append(order, key)
+		}
+		if frame.Function != "" {
+			vuln.Reachable = true
+		}
+	}
+
+	vulns := make([]Vulnerability, 0, len(order))
+	for _, key := range order {
+		vuln := byKey[key]
+		info := osvs[vuln.ID]
+		vuln.Aliases = info.aliases
+		vuln.Summary = info.summary
+		vuln.URL = info.url
+		// govulncheck has no severity; a reachable vulnerability is treated as high
+		if vuln.Reachable {
+			vuln.Severity = SeverityHigh
+		}
+		vulns = append(vulns, *vuln)
+	}
+	return vulns, nil
+}
+
+// npmAuditReport is the npm 7+ audit report format
+type npmAuditReport struct {
+	Vulnerabilities map[string]struct {
+		Name         string            `json:"name"`
+		Severity     string            `json:"severity"`
+		Range        string            `json:"range"`
+		Via          []json.RawMessage `json:"via"`
+		FixAvailable json.RawMessage   `json:"fixAvailable"`
+	} `json:"vulnerabilities"`
+	Error *struct {
+		Code    string `json:"code"`
+		Summary string `json:"summary"`
+	} `json:"error"`
+}
+
+type npmAdvisory struct {
+	Source   json.RawMessage `json:"source"`
+	Name     string          `json:"name"`
+	Title    string          `json:"title"`
+	URL      string          `json:"url"`
+	Severity string          `json:"severity"`
+	Range    string          `json:"range"`
+}
+
+// parseNPMAudit normalizes `npm audit --json`. Packages that are only
+// vulnerable through another package ("via" strings) are skipped; the
+// advisory is reported on the package it applies to.
+func parseNPMAudit(stdout []byte) ([]Vulnerability, error) {
+	var report npmAuditReport
+	if err := json.Unmarshal(stdout, &report); err != nil {
+		return nil, err
+	}
+	if report.Error != nil {
+		return nil, fmt.Errorf("npm audit: %s", firstLine(report.Error.Summary))
+	}
+
+	names := make([]string, 0, len(report.Vulnerabilities))
+	for name := range report.Vulnerabilities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := make(map[string]bool)
+	var vulns []Vulnerability
+	for _, name := range names {
+		entry := report.Vulnerabilities[name]
+		fixedIn := npmFixVersion(entry.FixAvailable)
+
+		for _, raw := range entry.Via {
+			var advisory npmAdvisory
+			if err := json.Unmarshal(raw, &advisory); err != nil {
+				continue // a string naming the dependency it comes through
+			}
+			if advisory.Name != "" && advisory.Name != entry.Name {
+				continue
+			}
+
+			id := advisory.URL[strings.LastIndex(advisory.URL, "/")+1:]
+			if id == "" {
+				id = strings.Trim(string(advisory.Source), `"`)
+			}
+			if seen[name+"\x00"+id] {
+				continue
+			}
+			seen[name+"\x00"+id] = true
+
+			vulns = append(vulns, Vulnerability{
+				ID:            id,
+				Package:       entry.Name,
+				AffectedRange: advisory.Range,
+				FixedIn:       fixedIn,
+				Severity:      NormalizeSeverity(advisory.Severity),
+				Summary:       advisory.Title,
+				URL:           advisory.URL,
+			})
+		}
+	}
+	return vulns, nil
+}
+
+// npmFixVersion reads fixAvailable, which is a bool or the upgrade npm would make
+func npmFixVersion(raw json.RawMessage) string {
+	var fix struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &fix); err == nil && fix.Version != "" {
+		return fix.Name + "@" + fix.Version
+	}
+	return ""
+}
+
+type pipAuditDependency struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Vulns   []struct {
+		ID          string   `json:"id"`
+		FixVersions []string `json:"fix_versions"`
+		Aliases     []string `json:"aliases"`
+		Description string   `json:"description"`
+	} `json:"vulns"`
+}
+
+// parsePipAudit normalizes `pip-audit -f json`, which is either an object
+// with a dependencies list (2.x) or a bare list (older releases)
+func parsePipAudit(stdout []byte) ([]Vulnerability, error) {
+	var deps []pipAuditDependency
+	var wrapped struct {
+		Dependencies []pipAuditDependency `json:"dependencies"`
+	}
+	if err := json.Unmarshal(stdout, &wrapped); err == nil {
+		deps = wrapped.Dependencies
+	} else if err := json.Unmarshal(stdout, &deps); err != nil {
+		return nil, err
+	}
+
+	var vulns []Vulnerability
+	for _, dep := range deps {
+		for _, v := range dep.Vulns {
+			vulns = append(vulns, Vulnerability{
+				ID:               v.ID,
+				Aliases:          v.Aliases,
+				Package:          dep.Name,
+				InstalledVersion: dep.Version,
+				FixedIn:          strings.Join(v.FixVersions, ", "),
+				Severity:         SeverityUnknown,
+				Summary:          truncate(firstLine(v.Description), 300),
+				URL:              pipAdvisoryURL(v.ID),
+			})
+		}
+	}
+	return vulns, nil
+}
+
+// pipAdvisoryURL links to the advisory database for known ID formats
+func pipAdvisoryURL(id string) string {
+	switch {
+	case strings.HasPrefix(id, "GHSA-"):
+		return "https://github.com/advisories/" + id
+	case strings.HasPrefix(id, "PYSEC-"):
+		return "https://osv.dev/vulnerability/" + id
+	default:
+		return ""
+	}
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[:i])
+	}
+	return s
+}
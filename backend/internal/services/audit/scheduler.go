@@ -0,0 +1,189 @@
+package audit
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+)
+
+const (
+	defaultCheckInterval = 5 * time.Minute
+
+	// maxNotifiedVulnerabilities caps how many new vulnerabilities are listed in one notification
+	maxNotifiedVulnerabilities = 10
+)
+
+// Scheduler periodically audits workspaces with an enabled schedule and
+// notifies about vulnerabilities that were not present in the previous run
+type Scheduler struct {
+	service      *Service
+	repo         *repository.AuditScheduleRepository
+	integrations *integrations.Manager
+	interval     time.Duration
+
+	running map[string]bool
+	mu      sync.Mutex
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewScheduler creates a new audit scheduler. checkInterval is how often
+// schedules are checked for being due, not how often audits run.
+func NewScheduler(service *Service, repo *repository.AuditScheduleRepository, integrationManager *integrations.Manager, checkInterval time.Duration) *Scheduler {
+	if checkInterval <= 0 {
+		checkInterval = defaultCheckInterval
+	}
+	return &Scheduler{
+		service:      service,
+		repo:         repo,
+		integrations: integrationManager,
+		interval:     checkInterval,
+		running:      make(map[string]bool),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+// Start begins checking schedules in the background
+func (s *Scheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				s.runDue()
+			}
+		}
+	}()
+}
+
+// Stop stops checking schedules
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+}
+
+// runDue starts an audit for every schedule that is due
+func (s *Scheduler) runDue() {
+	schedules, err := s.repo.ListEnabled()
+	if err != nil {
+		log.Printf("Failed to list audit schedules: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, schedule := range schedules {
+		if !schedule.Due(now) {
+			continue
+		}
+
+		s.mu.Lock()
+		if s.running[schedule.ID] {
+			s.mu.Unlock()
+			continue
+		}
+		s.running[schedule.ID] = true
+		s.mu.Unlock()
+
+		go func(schedule *repository.AuditSchedule) {
+			defer func() {
+				s.mu.Lock()
+				delete(s.running, schedule.ID)
+				s.mu.Unlock()
+			}()
+			s.Run(schedule)
+		}(schedule)
+	}
+}
+
+// Run audits a scheduled workspace, records the result and notifies about
+// new vulnerabilities
+func (s *Scheduler) Run(schedule *repository.AuditSchedule) (*Report, error) {
+	report, err := s.service.Audit(schedule.WorkspacePath, nil)
+	if err == nil && report.Failed() {
+		err = fmt.Errorf("%s", report.Errors())
+	}
+	if err != nil {
+		if recordErr := s.repo.RecordRun(schedule.ID, time.Now(), nil, 0, err.Error()); recordErr != nil {
+			log.Printf("Failed to record audit run for %s: %v", schedule.WorkspacePath, recordErr)
+		}
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(schedule.KnownVulnerabilities))
+	for _, key := range schedule.KnownVulnerabilities {
+		known[key] = true
+	}
+
+	keys := make([]string, 0, len(report.Vulnerabilities))
+	var added []Vulnerability
+	for _, vuln := range report.Vulnerabilities {
+		key := vuln.Key()
+		keys = append(keys, key)
+		if !known[key] {
+			added = append(added, vuln)
+		}
+	}
+
+	// Ecosystems that failed this time keep their previously known
+	// vulnerabilities so they are not reported again once the scan recovers
+	for _, scan := range report.Scans {
+		if scan.Error == "" {
+			continue
+		}
+		prefix := scan.Ecosystem + ":"
+		for _, key := range schedule.KnownVulnerabilities {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	if err := s.repo.RecordRun(schedule.ID, report.ScannedAt, keys, len(report.Vulnerabilities), ""); err != nil {
+		log.Printf("Failed to record audit run for %s: %v", schedule.WorkspacePath, err)
+	}
+
+	if len(added) > 0 {
+		s.notify(schedule, report, added)
+	}
+	return report, nil
+}
+
+// notify sends a summary of new vulnerabilities through the integrations manager
+func (s *Scheduler) notify(schedule *repository.AuditSchedule, report *Report, added []Vulnerability) {
+	if s.integrations == nil {
+		return
+	}
+
+	var lines []string
+	for i, vuln := range added {
+		if i == maxNotifiedVulnerabilities {
+			lines = append(lines, fmt.Sprintf("...and %d more", len(added)-i))
+			break
+		}
+		line := fmt.Sprintf("[%s] %s in %s", vuln.Severity, vuln.ID, vuln.Package)
+		if vuln.FixedIn != "" {
+			line += " (fixed in " + vuln.FixedIn + ")"
+		}
+		lines = append(lines, line)
+	}
+
+	s.integrations.Notify(&integrations.Event{
+		Type:   integrations.EventVulnerabilitiesFound,
+		UserID: schedule.UserID,
+		Data: map[string]interface{}{
+			"workspace":           schedule.WorkspacePath,
+			"new_vulnerabilities": len(added),
+			"total":               len(report.Vulnerabilities),
+			"details":             strings.Join(lines, "\n"),
+		},
+	})
+}
@@ -0,0 +1,212 @@
+package changes
+
+import (
+	"fmt"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/diff"
+	"github.com/jacklau/prism/internal/sandbox"
+)
+
+// maxDiffSize is the largest per-file diff included in a change set, in bytes
+const maxDiffSize = 64 * 1024
+
+// File change statuses
+const (
+	StatusCreated  = "created"
+	StatusModified = "modified"
+	StatusDeleted  = "deleted"
+	StatusRenamed  = "renamed"
+)
+
+// FileChange describes how one file differs from before a turn
+type FileChange struct {
+	Path          string `json:"path"`
+	Status        string `json:"status"` // created, modified, deleted, renamed
+	Diff          string `json:"diff,omitempty"`
+	DiffTruncated bool   `json:"diff_truncated,omitempty"` // Diff omitted because it was too large
+	Additions     int    `json:"additions"`
+	Deletions     int    `json:"deletions"`
+}
+
+// ChangeSet is the set of files changed by tools during one assistant turn
+type ChangeSet struct {
+	TurnID    string       `json:"turn_id"`
+	Files     []FileChange `json:"files"`
+	Additions int          `json:"additions"`
+	Deletions int          `json:"deletions"`
+}
+
+// SkippedFile is a file that could not be reverted
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// RevertResult reports the outcome of reverting a turn
+type RevertResult struct {
+	TurnID   string        `json:"turn_id"`
+	Reverted []string      `json:"reverted"`
+	Skipped  []SkippedFile `json:"skipped,omitempty"`
+}
+
+// Service builds change sets from file history and reverts them
+type Service struct {
+	historyRepo    *repository.FileHistoryRepository
+	sandboxService *sandbox.Service
+}
+
+// NewService creates a new change set service
+func NewService(historyRepo *repository.FileHistoryRepository, sandboxService *sandbox.Service) *Service {
+	return &Service{
+		historyRepo:    historyRepo,
+		sandboxService: sandboxService,
+	}
+}
+
+// originalState is a file's state from before the turn first touched it
+type originalState struct {
+	path      string
+	operation string
+	content   string
+	existed   bool
+}
+
+// originals returns the pre-turn state of every file the turn touched, in
+// the order they were first changed. The first history entry for a path
+// holds its content from before the turn.
+func (s *Service) originals(userID, turnID string) ([]originalState, error) {
+	entries, err := s.historyRepo.ListByTurnID(userID, turnID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var states []originalState
+	for _, entry := range entries {
+		if seen[entry.FilePath] {
+			continue
+		}
+		seen[entry.FilePath] = true
+		states = append(states, originalState{
+			path:      entry.FilePath,
+			operation: entry.Operation,
+			content:   entry.Content,
+			existed:   entry.Operation != "create",
+		})
+	}
+	return states, nil
+}
+
+// Summarize returns the files changed during a turn with per-file diffs
+// against their current contents
+func (s *Service) Summarize(userID, turnID string) (*ChangeSet, error) {
+	states, err := s.originals(userID, turnID)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &ChangeSet{TurnID: turnID, Files: []FileChange{}}
+	for _, state := range states {
+		if state.operation == "rename_dir" {
+			set.Files = append(set.Files, FileChange{Path: state.path, Status: StatusRenamed})
+			continue
+		}
+
+		current, err := s.sandboxService.GetFileContent(userID, state.path)
+		exists := err == nil
+
+		change := FileChange{Path: state.path}
+		oldName, newName := "a/"+state.path, "b/"+state.path
+		switch {
+		case !state.existed && !exists:
+			continue // Created and removed again within the turn
+		case !state.existed:
+			change.Status = StatusCreated
+			oldName = "/dev/null"
+		case !exists && state.operation == "rename":
+			change.Status = StatusRenamed
+			newName = "/dev/null"
+		case !exists:
+			change.Status = StatusDeleted
+			newName = "/dev/null"
+		default:
+			if current == state.content {
+				continue // Changed back to the original
+			}
+			change.Status = StatusModified
+		}
+
+		patch, stats := diff.Unified(oldName, newName, state.content, current, diff.DefaultContext)
+		change.Additions = stats.Additions
+		change.Deletions = stats.Deletions
+		if len(patch) > maxDiffSize {
+			change.DiffTruncated = true
+		} else {
+			change.Diff = patch
+		}
+
+		set.Additions += stats.Additions
+		set.Deletions += stats.Deletions
+		set.Files = append(set.Files, change)
+	}
+	return set, nil
+}
+
+// Revert restores every file changed during a turn to its state before the
+// turn. Files created by the turn are deleted. Each restore is recorded in
+// file history so the revert itself can be undone.
+func (s *Service) Revert(userID, turnID string) (*RevertResult, error) {
+	states, err := s.originals(userID, turnID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RevertResult{TurnID: turnID, Reverted: []string{}}
+	for _, state := range states {
+		if state.operation == "rename_dir" {
+			result.Skipped = append(result.Skipped, SkippedFile{
+				Path:   state.path,
+				Reason: "directory renames cannot be reverted",
+			})
+			continue
+		}
+
+		current, err := s.sandboxService.GetFileContent(userID, state.path)
+		exists := err == nil
+
+		if !state.existed {
+			if !exists {
+				continue
+			}
+			_, _ = s.historyRepo.Create(userID, state.path, current, "delete")
+			if err := s.sandboxService.DeleteFile(userID, state.path); err != nil {
+				result.Skipped = append(result.Skipped, SkippedFile{
+					Path:   state.path,
+					Reason: fmt.Sprintf("failed to delete file: %v", err),
+				})
+				continue
+			}
+			result.Reverted = append(result.Reverted, state.path)
+			continue
+		}
+
+		if exists && current == state.content {
+			continue
+		}
+		if exists {
+			_, _ = s.historyRepo.Create(userID, state.path, current, "update")
+		} else {
+			_, _ = s.historyRepo.Create(userID, state.path, "", "create")
+		}
+		if err := s.sandboxService.WriteFile(userID, state.path, state.content); err != nil {
+			result.Skipped = append(result.Skipped, SkippedFile{
+				Path:   state.path,
+				Reason: fmt.Sprintf("failed to restore file: %v", err),
+			})
+			continue
+		}
+		result.Reverted = append(result.Reverted, state.path)
+	}
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package changes
+
+import (
+	"errors"
+
+	"github.com/jacklau/prism/internal/diff"
+)
+
+// What a history entry can be diffed against
+const (
+	AgainstCurrent  = "current"  // The file as it is now in the workspace
+	AgainstPrevious = "previous" // The file's entry recorded before it
+)
+
+// ErrHistoryNotFound is returned for history entries that don't exist or
+// belong to another user
+var ErrHistoryNotFound = errors.New("history entry not found")
+
+// HistoryDiff is a unified diff between a file history entry and another
+// version of the file
+type HistoryDiff struct {
+	HistoryID     string `json:"history_id"`
+	Path          string `json:"path"`
+	Against       string `json:"against"`
+	AgainstID     string `json:"against_id,omitempty"` // The previous entry, if any
+	Diff          string `json:"diff"`
+	DiffTruncated bool   `json:"diff_truncated,omitempty"` // Diff omitted because it was too large
+	Additions     int    `json:"additions"`
+	Deletions     int    `json:"deletions"`
+}
+
+// DiffHistory diffs a history entry, which holds a file's content from
+// before a change, against the file's current content or against the entry
+// recorded before it. The older version is always the diff's old side.
+func (s *Service) DiffHistory(userID, historyID, against string) (*HistoryDiff, error) {
+	entry, err := s.historyRepo.GetByID(historyID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil || entry.UserID != userID {
+		return nil, ErrHistoryNotFound
+	}
+
+	result := &HistoryDiff{HistoryID: entry.ID, Path: entry.FilePath, Against: against}
+	oldName, newName := "a/"+entry.FilePath, "b/"+entry.FilePath
+	var oldText, newText string
+
+	if against == AgainstPrevious {
+		// A create entry means the file didn't exist before the change
+		if entry.Operation == "create" {
+			newName = "/dev/null"
+		}
+		newText = entry.Content
+
+		previous, err := s.historyRepo.GetPrevious(entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		if previous == nil || previous.Operation == "create" {
+			oldName = "/dev/null"
+		}
+		if previous != nil {
+			result.AgainstID = previous.ID
+			oldText = previous.Content
+		}
+	} else {
+		if entry.Operation == "create" {
+			oldName = "/dev/null"
+		}
+		oldText = entry.Content
+
+		current, err := s.sandboxService.GetFileContent(userID, entry.FilePath)
+		if err != nil {
+			newName = "/dev/null" // Deleted since
+		} else {
+			newText = current
+		}
+	}
+
+	patch, stats := diff.Unified(oldName, newName, oldText, newText, diff.DefaultContext)
+	result.Additions = stats.Additions
+	result.Deletions = stats.Deletions
+	if len(patch) > maxDiffSize {
+		result.DiffTruncated = true
+	} else {
+		result.Diff = patch
+	}
+	return result, nil
+}
@@ -0,0 +1,449 @@
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/storage"
+)
+
+const (
+	defaultMaxPerWorkspace = 50
+	defaultTimeout         = 30 * time.Second
+
+	// refPrefix namespaces checkpoint refs so commits survive garbage collection
+	refPrefix = "refs/prism/checkpoints/"
+)
+
+var (
+	// ErrNotFound is returned when a checkpoint does not exist for the user
+	ErrNotFound = errors.New("checkpoint not found")
+
+	// ErrGitUnavailable is returned when git is not installed
+	ErrGitUnavailable = errors.New("git is required for workspace checkpoints")
+)
+
+// defaultExcludes are never included in snapshots, in addition to the
+// workspace's own .gitignore rules
+var defaultExcludes = []string{
+	"node_modules/",
+	".venv/",
+	"venv/",
+	"__pycache__/",
+	".DS_Store",
+}
+
+// Config holds configuration for workspace checkpoints
+type Config struct {
+	// Dir is where the shadow repositories are stored, outside any workspace
+	Dir string
+	// MaxPerWorkspace is the number of checkpoints kept per workspace; older ones are pruned
+	MaxPerWorkspace int
+	// Timeout bounds each git operation
+	Timeout time.Duration
+	// Store, when set, keeps a git bundle of each shadow repository so
+	// checkpoints survive the loss of Dir and can be restored on another server
+	Store storage.Store
+}
+
+// RestoreResult reports the outcome of a restore
+type RestoreResult struct {
+	Checkpoint *repository.Checkpoint
+	// Backup is a checkpoint of the workspace as it was just before the restore
+	Backup *repository.Checkpoint
+}
+
+// Service snapshots and restores workspaces using a shadow git repository
+// per workspace. The workspace's own .git directory is never touched.
+type Service struct {
+	repo           *repository.CheckpointRepository
+	sandboxService *sandbox.Service
+	config         Config
+
+	// Per-workspace locks so snapshots and restores don't interleave
+	locks   map[string]*sync.Mutex
+	locksMu sync.Mutex
+}
+
+// NewService creates a new checkpoint service
+func NewService(repo *repository.CheckpointRepository, sandboxService *sandbox.Service, config Config) (*Service, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, ErrGitUnavailable
+	}
+	if config.MaxPerWorkspace <= 0 {
+		config.MaxPerWorkspace = defaultMaxPerWorkspace
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+
+	return &Service{
+		repo:           repo,
+		sandboxService: sandboxService,
+		config:         config,
+		locks:          make(map[string]*sync.Mutex),
+	}, nil
+}
+
+// List returns the checkpoints for the user's current workspace, newest first
+func (s *Service) List(userID string) (string, []*repository.Checkpoint, error) {
+	workDir, err := s.sandboxService.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	checkpoints, err := s.repo.ListByWorkspace(userID, workDir)
+	if err != nil {
+		return "", nil, err
+	}
+	return workDir, checkpoints, nil
+}
+
+// Create snapshots the user's current workspace
+func (s *Service) Create(ctx context.Context, userID, label, trigger string) (*repository.Checkpoint, error) {
+	workDir, err := s.sandboxService.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := s.lock(workDir)
+	defer unlock()
+
+	cp, _, err := s.snapshot(ctx, userID, workDir, label, trigger, false)
+	return cp, err
+}
+
+// CreateIfChanged snapshots the user's workspace unless it is unchanged since
+// the latest checkpoint. It reports whether a new checkpoint was created.
+func (s *Service) CreateIfChanged(ctx context.Context, userID, label, trigger string) (*repository.Checkpoint, bool, error) {
+	workDir, err := s.sandboxService.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	unlock := s.lock(workDir)
+	defer unlock()
+
+	return s.snapshot(ctx, userID, workDir, label, trigger, true)
+}
+
+// Restore resets the user's workspace to a checkpoint. The current state is
+// checkpointed first so the restore can itself be undone. Files ignored by
+// the snapshot (e.g. node_modules) are left untouched.
+func (s *Service) Restore(ctx context.Context, userID, checkpointID string) (*RestoreResult, error) {
+	cp, err := s.repo.GetByID(checkpointID)
+	if err != nil {
+		return nil, err
+	}
+	if cp == nil || cp.UserID != userID {
+		return nil, ErrNotFound
+	}
+
+	unlock := s.lock(cp.WorkspacePath)
+	defer unlock()
+
+	label := "Before restoring checkpoint"
+	if cp.Label != "" {
+		label = fmt.Sprintf("Before restoring %q", cp.Label)
+	}
+	backup, _, err := s.snapshot(ctx, userID, cp.WorkspacePath, label, repository.CheckpointTriggerRestore, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checkpoint current state: %w", err)
+	}
+
+	// The snapshot left every current file in the index, so read-tree can
+	// update changed files and remove ones the checkpoint doesn't have in one step
+	if _, err := s.git(ctx, cp.WorkspacePath, "read-tree", "-u", "--reset", cp.CommitSHA); err != nil {
+		return nil, fmt.Errorf("failed to restore checkpoint: %w", err)
+	}
+
+	return &RestoreResult{Checkpoint: cp, Backup: backup}, nil
+}
+
+// Delete removes a checkpoint
+func (s *Service) Delete(ctx context.Context, userID, checkpointID string) error {
+	cp, err := s.repo.GetByID(checkpointID)
+	if err != nil {
+		return err
+	}
+	if cp == nil || cp.UserID != userID {
+		return ErrNotFound
+	}
+
+	unlock := s.lock(cp.WorkspacePath)
+	defer unlock()
+
+	if err := s.remove(ctx, cp); err != nil {
+		return err
+	}
+	s.backup(ctx, cp.WorkspacePath)
+	return nil
+}
+
+// snapshot stages the whole workspace in the shadow repository and records
+// it as a checkpoint. With skipUnchanged, the latest checkpoint is returned
+// instead if the workspace tree has not changed since.
+func (s *Service) snapshot(ctx context.Context, userID, workDir, label, trigger string, skipUnchanged bool) (*repository.Checkpoint, bool, error) {
+	if err := s.ensureRepo(ctx, workDir); err != nil {
+		return nil, false, err
+	}
+
+	if _, err := s.git(ctx, workDir, "add", "-A", "--ignore-errors"); err != nil {
+		return nil, false, fmt.Errorf("failed to stage workspace: %w", err)
+	}
+	tree, err := s.git(ctx, workDir, "write-tree")
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to write tree: %w", err)
+	}
+
+	latest, err := s.repo.GetLatest(userID, workDir)
+	if err != nil {
+		return nil, false, err
+	}
+	if skipUnchanged && latest != nil && latest.TreeSHA == tree {
+		return latest, false, nil
+	}
+
+	if label == "" {
+		label = "Checkpoint"
+	}
+	args := []string{"commit-tree", tree, "-m", label}
+	if latest != nil {
+		args = append(args, "-p", latest.CommitSHA)
+	}
+	commit, err := s.git(ctx, workDir, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create commit: %w", err)
+	}
+
+	id := uuid.New().String()
+	if _, err := s.git(ctx, workDir, "update-ref", refPrefix+id, commit); err != nil {
+		return nil, false, fmt.Errorf("failed to save checkpoint ref: %w", err)
+	}
+
+	cp, err := s.repo.Create(id, userID, workDir, commit, tree, label, trigger)
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.prune(ctx, userID, workDir)
+	s.backup(ctx, workDir)
+	return cp, true, nil
+}
+
+// prune removes the oldest checkpoints beyond the per-workspace limit
+func (s *Service) prune(ctx context.Context, userID, workDir string) {
+	checkpoints, err := s.repo.ListByWorkspace(userID, workDir)
+	if err != nil || len(checkpoints) <= s.config.MaxPerWorkspace {
+		return
+	}
+	for _, cp := range checkpoints[s.config.MaxPerWorkspace:] {
+		if err := s.remove(ctx, cp); err != nil {
+			log.Printf("Failed to prune checkpoint %s: %v", cp.ID, err)
+		}
+	}
+}
+
+// remove deletes a checkpoint's ref and record
+func (s *Service) remove(ctx context.Context, cp *repository.Checkpoint) error {
+	if _, err := s.git(ctx, cp.WorkspacePath, "update-ref", "-d", refPrefix+cp.ID); err != nil {
+		log.Printf("Failed to delete checkpoint ref %s: %v", cp.ID, err)
+	}
+	return s.repo.Delete(cp.ID)
+}
+
+// ensureRepo creates the shadow repository for a workspace if needed,
+// restoring its checkpoints from the object store when a bundle is kept there
+func (s *Service) ensureRepo(ctx context.Context, workDir string) error {
+	gitDir := s.gitDir(workDir)
+	if _, err := os.Stat(filepath.Join(gitDir, "HEAD")); err == nil {
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "init", "--quiet", "--bare", gitDir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create checkpoint repository: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	exclude := strings.Join(defaultExcludes, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(gitDir, "info", "exclude"), []byte(exclude), 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint excludes: %w", err)
+	}
+
+	// Without its earlier commits the repository can't extend the
+	// checkpoint history, so it is only kept if the restore succeeds
+	if err := s.restoreBackup(ctx, workDir); err != nil {
+		os.RemoveAll(gitDir)
+		return fmt.Errorf("failed to restore checkpoints from storage: %w", err)
+	}
+	return nil
+}
+
+// backup replaces the bundle of a workspace's shadow repository in the
+// object store. Failures are logged; the local checkpoints are unaffected.
+func (s *Service) backup(ctx context.Context, workDir string) {
+	if s.config.Store == nil {
+		return
+	}
+	key := s.bundleKey(workDir)
+
+	refs, err := s.git(ctx, workDir, "for-each-ref", "--format=%(refname)", refPrefix)
+	if err != nil {
+		log.Printf("Failed to back up checkpoints: %v", err)
+		return
+	}
+	// git refuses to create empty bundles
+	if refs == "" {
+		if err := s.config.Store.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete checkpoint backup: %v", err)
+		}
+		return
+	}
+
+	bundle := s.gitDir(workDir) + ".bundle"
+	defer os.Remove(bundle)
+	if _, err := s.git(ctx, workDir, "bundle", "create", "--quiet", bundle, "--all"); err != nil {
+		log.Printf("Failed to back up checkpoints: %v", err)
+		return
+	}
+	f, err := os.Open(bundle)
+	if err != nil {
+		log.Printf("Failed to back up checkpoints: %v", err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("Failed to back up checkpoints: %v", err)
+		return
+	}
+	if err := s.config.Store.Put(ctx, key, f, info.Size()); err != nil {
+		log.Printf("Failed to back up checkpoints: %v", err)
+	}
+}
+
+// restoreBackup fetches a workspace's checkpoint refs from its bundle in the
+// object store into a new shadow repository
+func (s *Service) restoreBackup(ctx context.Context, workDir string) error {
+	if s.config.Store == nil {
+		return nil
+	}
+	r, _, err := s.config.Store.Open(ctx, s.bundleKey(workDir))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	bundle := s.gitDir(workDir) + ".bundle"
+	defer os.Remove(bundle)
+	f, err := os.Create(bundle)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle file: %w", err)
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download bundle: %w", err)
+	}
+
+	_, err = s.git(ctx, workDir, "fetch", "--quiet", bundle, refPrefix+"*:"+refPrefix+"*")
+	return err
+}
+
+// git runs a git command against a workspace's shadow repository and
+// returns its trimmed output
+func (s *Service) git(ctx context.Context, workDir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	fullArgs := append([]string{
+		"--git-dir=" + s.gitDir(workDir),
+		"--work-tree=" + workDir,
+		"-c", "user.name=Prism",
+		"-c", "user.email=checkpoints@prism.local",
+		"-c", "core.autocrlf=false",
+	}, args...)
+
+	cmd := exec.CommandContext(ctx, "git", fullArgs...)
+	cmd.Dir = workDir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("git %s timed out after %s", args[0], s.config.Timeout)
+		}
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// RemoveWorkspace deletes every checkpoint snapshot of a workspace, for a
+// workspace that is being deleted. Checkpoint records go with their user.
+func (s *Service) RemoveWorkspace(workDir string) error {
+	unlock := s.lock(workDir)
+	defer unlock()
+
+	if err := os.RemoveAll(s.gitDir(workDir)); err != nil {
+		return fmt.Errorf("failed to remove checkpoints: %w", err)
+	}
+	if s.config.Store != nil {
+		if err := s.config.Store.Delete(context.Background(), s.bundleKey(workDir)); err != nil {
+			return fmt.Errorf("failed to remove checkpoint backup: %w", err)
+		}
+	}
+	return nil
+}
+
+// repoName identifies a workspace's shadow repository
+func repoName(workDir string) string {
+	sum := sha256.Sum256([]byte(workDir))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// gitDir returns the shadow repository path for a workspace
+func (s *Service) gitDir(workDir string) string {
+	return filepath.Join(s.config.Dir, repoName(workDir)+".git")
+}
+
+// bundleKey returns the object store key of a workspace's shadow repository bundle
+func (s *Service) bundleKey(workDir string) string {
+	return storage.Join("checkpoints", repoName(workDir)+".bundle")
+}
+
+// lock serializes checkpoint operations on a workspace
+func (s *Service) lock(workDir string) func() {
+	s.locksMu.Lock()
+	mu, ok := s.locks[workDir]
+	if !ok {
+		mu = &sync.Mutex{}
+		s.locks[workDir] = mu
+	}
+	s.locksMu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
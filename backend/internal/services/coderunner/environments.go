@@ -0,0 +1,247 @@
+package coderunner
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// versionCacheTTL is how long detected toolchain versions are reused
+	versionCacheTTL = 10 * time.Minute
+
+	// versionTimeout bounds each version check (longer in Docker, which may pull the image)
+	versionTimeout       = 10 * time.Second
+	dockerVersionTimeout = 2 * time.Minute
+
+	// containerSourceDir is where source files are written inside containers
+	containerSourceDir = "/tmp/prism"
+)
+
+// cacheMount is a named Docker volume mounted to persist a toolchain's
+// dependency or build cache between runs
+type cacheMount struct {
+	volume string
+	path   string
+}
+
+// environment describes how to execute code for one language. Interpreted
+// languages take the code inline; compiled ones write it to sourceFile and
+// run script, where {dir} is replaced with the source directory.
+type environment struct {
+	name     string
+	language string
+	image    func(c *Config) string
+
+	// Inline execution: interpreter and flag (local) and in-container equivalent
+	localShell, localFlag   string
+	dockerShell, dockerFlag string
+
+	// Source file execution
+	sourceFile string
+	script     string
+
+	versionCmd []string
+	caches     []cacheMount
+}
+
+// compiled reports whether code is written to a source file before running
+func (e *environment) compiled() bool {
+	return e.sourceFile != ""
+}
+
+// buildScript returns the shell script that compiles and runs the source in dir
+func (e *environment) buildScript(dir string) string {
+	return strings.ReplaceAll(e.script, "{dir}", dir)
+}
+
+var shellEnvironment = &environment{
+	name:        "shell",
+	language:    "Shell",
+	image:       func(c *Config) string { return c.ShellImage },
+	localShell:  "bash",
+	localFlag:   "-c",
+	dockerShell: "sh",
+	dockerFlag:  "-c",
+	versionCmd:  []string{"bash", "--version"},
+}
+
+// environments lists every supported environment by name
+var environments = map[string]*environment{
+	"node": {
+		name:        "node",
+		language:    "JavaScript (Node.js)",
+		image:       func(c *Config) string { return c.NodeImage },
+		localShell:  "node",
+		localFlag:   "-e",
+		dockerShell: "node",
+		dockerFlag:  "-e",
+		versionCmd:  []string{"node", "--version"},
+		caches:      []cacheMount{{volume: "npm", path: "/root/.npm"}},
+	},
+	"python": {
+		name:        "python",
+		language:    "Python",
+		image:       func(c *Config) string { return c.PythonImage },
+		localShell:  "python3",
+		localFlag:   "-c",
+		dockerShell: "python3",
+		dockerFlag:  "-c",
+		versionCmd:  []string{"python3", "--version"},
+		caches:      []cacheMount{{volume: "pip", path: "/root/.cache/pip"}},
+	},
+	"shell": shellEnvironment,
+	"bash":  shellEnvironment,
+	"go": {
+		name:       "go",
+		language:   "Go",
+		image:      func(c *Config) string { return c.GoImage },
+		sourceFile: "main.go",
+		script:     "(cd {dir} && go build -o main main.go) && {dir}/main",
+		versionCmd: []string{"go", "version"},
+		caches: []cacheMount{
+			{volume: "go-build", path: "/root/.cache/go-build"},
+			{volume: "go-mod", path: "/go/pkg/mod"},
+		},
+	},
+	"rust": {
+		name:       "rust",
+		language:   "Rust",
+		image:      func(c *Config) string { return c.RustImage },
+		sourceFile: "main.rs",
+		script:     "rustc -O --edition 2021 -o {dir}/main {dir}/main.rs && {dir}/main",
+		versionCmd: []string{"rustc", "--version"},
+		caches:     []cacheMount{{volume: "cargo-registry", path: "/usr/local/cargo/registry"}},
+	},
+	"java": {
+		name:       "java",
+		language:   "Java",
+		image:      func(c *Config) string { return c.JavaImage },
+		sourceFile: "Main.java",
+		// Single-file source launch compiles in memory (Java 11+)
+		script:     "java {dir}/Main.java",
+		versionCmd: []string{"java", "-version"},
+		caches:     []cacheMount{{volume: "maven", path: "/root/.m2"}},
+	},
+	"c": {
+		name:       "c",
+		language:   "C",
+		image:      func(c *Config) string { return c.CImage },
+		sourceFile: "main.c",
+		script:     "cc -O2 -o {dir}/main {dir}/main.c -lm && {dir}/main",
+		versionCmd: []string{"cc", "--version"},
+	},
+	"cpp": {
+		name:       "cpp",
+		language:   "C++",
+		image:      func(c *Config) string { return c.CImage },
+		sourceFile: "main.cpp",
+		script:     "c++ -O2 -std=c++17 -o {dir}/main {dir}/main.cpp && {dir}/main",
+		versionCmd: []string{"c++", "--version"},
+	},
+}
+
+// environmentNames lists environments in display order (aliases excluded)
+var environmentNames = []string{"node", "python", "shell", "go", "rust", "java", "c", "cpp"}
+
+// lookupEnvironment returns the environment for a name. Unknown or empty
+// names fall back to the shell, as they always have.
+func lookupEnvironment(name string) *environment {
+	if env, ok := environments[strings.ToLower(name)]; ok {
+		return env
+	}
+	return shellEnvironment
+}
+
+// EnvironmentInfo describes a supported environment and its toolchain
+type EnvironmentInfo struct {
+	Name      string `json:"name"`
+	Language  string `json:"language"`
+	Image     string `json:"image,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+}
+
+// versionCache holds the last detected environment versions
+type versionCache struct {
+	mu        sync.Mutex
+	infos     []EnvironmentInfo
+	checkedAt time.Time
+}
+
+// Environments returns the supported environments with their toolchain
+// versions. Versions are detected by running each toolchain (locally or in
+// its image) and cached for a few minutes.
+func (r *Runner) Environments(ctx context.Context) []EnvironmentInfo {
+	r.versions.mu.Lock()
+	defer r.versions.mu.Unlock()
+
+	if r.versions.infos != nil && time.Since(r.versions.checkedAt) < versionCacheTTL {
+		return r.versions.infos
+	}
+
+	infos := make([]EnvironmentInfo, len(environmentNames))
+	var wg sync.WaitGroup
+	for i, name := range environmentNames {
+		wg.Add(1)
+		go func(i int, env *environment) {
+			defer wg.Done()
+			infos[i] = r.detectVersion(ctx, env)
+		}(i, environments[name])
+	}
+	wg.Wait()
+
+	r.versions.infos = infos
+	r.versions.checkedAt = time.Now()
+	return infos
+}
+
+// detectVersion runs an environment's version command
+func (r *Runner) detectVersion(ctx context.Context, env *environment) EnvironmentInfo {
+	info := EnvironmentInfo{Name: env.name, Language: env.language}
+
+	var cmd *exec.Cmd
+	if r.config.DockerEnabled {
+		info.Image = env.image(r.config)
+		ctx, cancel := context.WithTimeout(ctx, dockerVersionTimeout)
+		defer cancel()
+		args := append([]string{"run", "--rm", "--network", "none", info.Image}, env.versionCmd...)
+		cmd = exec.CommandContext(ctx, "docker", args...)
+	} else {
+		if _, err := exec.LookPath(env.versionCmd[0]); err != nil {
+			info.Error = env.versionCmd[0] + " is not installed"
+			return info
+		}
+		ctx, cancel := context.WithTimeout(ctx, versionTimeout)
+		defer cancel()
+		cmd = exec.CommandContext(ctx, env.versionCmd[0], env.versionCmd[1:]...)
+	}
+
+	// Some toolchains (java) print their version to stderr
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		info.Error = "version check failed: " + firstLine(output.String())
+		if output.Len() == 0 {
+			info.Error = "version check failed: " + err.Error()
+		}
+		return info
+	}
+
+	info.Version = firstLine(output.String())
+	info.Available = true
+	return info
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[:i])
+	}
+	return s
+}
@@ -4,18 +4,30 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jacklau/prism/internal/integrations/github"
 )
 
+// killWaitDelay is how long to wait for output after a run is killed
+const killWaitDelay = 2 * time.Second
+
 // Runner executes code in sandbox environments
 type Runner struct {
-	config *Config
+	config   *Config
+	versions versionCache
+
+	// Streaming runs in progress, by run ID
+	executions map[string]*Execution
+	mu         sync.Mutex
 }
 
 // Config contains configuration for the code runner
@@ -33,6 +45,14 @@ type Config struct {
 	NodeImage   string `json:"node_image"`
 	PythonImage string `json:"python_image"`
 	ShellImage  string `json:"shell_image"`
+	GoImage     string `json:"go_image"`
+	RustImage   string `json:"rust_image"`
+	JavaImage   string `json:"java_image"`
+	CImage      string `json:"c_image"` // Used for both C and C++
+
+	// Named Docker volumes for dependency and build caches (e.g. Go modules, npm, pip)
+	CacheVolumes      bool   `json:"cache_volumes"`
+	CacheVolumePrefix string `json:"cache_volume_prefix"`
 
 	// Working directory for non-Docker execution
 	WorkDir string `json:"work_dir"`
@@ -41,14 +61,20 @@ type Config struct {
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
-		DockerEnabled: false, // Default to local execution for simplicity
-		MemoryLimit:   "512m",
-		CPULimit:      "0.5",
-		Timeout:       5 * time.Minute,
-		NodeImage:     "node:18-alpine",
-		PythonImage:   "python:3.11-alpine",
-		ShellImage:    "alpine:latest",
-		WorkDir:       "/tmp/coderunner",
+		DockerEnabled:     false, // Default to local execution for simplicity
+		MemoryLimit:       "512m",
+		CPULimit:          "0.5",
+		Timeout:           5 * time.Minute,
+		NodeImage:         "node:18-alpine",
+		PythonImage:       "python:3.11-alpine",
+		ShellImage:        "alpine:latest",
+		GoImage:           "golang:1.22-alpine",
+		RustImage:         "rust:1-slim",
+		JavaImage:         "eclipse-temurin:21-jdk",
+		CImage:            "gcc:13",
+		CacheVolumes:      true,
+		CacheVolumePrefix: "prism-cache",
+		WorkDir:           "/tmp/coderunner",
 	}
 }
 
@@ -57,7 +83,28 @@ func NewRunner(config *Config) *Runner {
 	if config == nil {
 		config = DefaultConfig()
 	}
-	return &Runner{config: config}
+
+	// Fill in any images the caller left unset
+	defaults := DefaultConfig()
+	setDefault(&config.NodeImage, defaults.NodeImage)
+	setDefault(&config.PythonImage, defaults.PythonImage)
+	setDefault(&config.ShellImage, defaults.ShellImage)
+	setDefault(&config.GoImage, defaults.GoImage)
+	setDefault(&config.RustImage, defaults.RustImage)
+	setDefault(&config.JavaImage, defaults.JavaImage)
+	setDefault(&config.CImage, defaults.CImage)
+	setDefault(&config.CacheVolumePrefix, defaults.CacheVolumePrefix)
+
+	return &Runner{
+		config:     config,
+		executions: make(map[string]*Execution),
+	}
+}
+
+func setDefault(value *string, fallback string) {
+	if *value == "" {
+		*value = fallback
+	}
 }
 
 // Run executes code based on the request
@@ -68,56 +115,73 @@ func (r *Runner) Run(request *github.CodeRunRequest) (*github.CodeExecutionResul
 	log.Printf("Starting code execution: id=%s, env=%s, cmd=%s",
 		resultID, request.Environment, request.Command)
 
-	var result *github.CodeExecutionResult
-	var err error
-
-	if r.config.DockerEnabled {
-		result, err = r.runInDocker(request, resultID, startTime)
-	} else {
-		result, err = r.runLocally(request, resultID, startTime)
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout(request))
+	defer cancel()
 
+	cmd, cleanup, err := r.command(ctx, request, resultID)
 	if err != nil {
 		return nil, err
 	}
+	defer cleanup()
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
 
-	return result, nil
+	return newResult(request, resultID, startTime, stdout.String(), stderr.String(), err), nil
 }
 
-// runLocally executes code locally (for development or when Docker is not available)
-func (r *Runner) runLocally(request *github.CodeRunRequest, resultID string, startTime time.Time) (*github.CodeExecutionResult, error) {
-	timeout := r.config.Timeout
+// timeout returns the run timeout for a request
+func (r *Runner) timeout(request *github.CodeRunRequest) time.Duration {
 	if request.Timeout > 0 {
-		timeout = time.Duration(request.Timeout) * time.Second
+		return time.Duration(request.Timeout) * time.Second
 	}
+	return r.config.Timeout
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	// Determine the shell and command based on environment
-	var shell, shellFlag string
-	switch request.Environment {
-	case "node":
-		shell = "node"
-		shellFlag = "-e"
-	case "python":
-		shell = "python3"
-		shellFlag = "-c"
-	case "shell", "bash", "":
-		shell = "bash"
-		shellFlag = "-c"
-	default:
-		shell = "bash"
-		shellFlag = "-c"
+// command prepares the command for a request, locally or in Docker. The
+// returned cleanup function must be called once the command has finished.
+func (r *Runner) command(ctx context.Context, request *github.CodeRunRequest, resultID string) (*exec.Cmd, func(), error) {
+	var cmd *exec.Cmd
+	var cleanup func()
+	if r.config.DockerEnabled {
+		cmd, cleanup = r.dockerCommand(ctx, request, resultID)
+	} else {
+		var err error
+		if cmd, cleanup, err = r.localCommand(ctx, request); err != nil {
+			return nil, nil, err
+		}
 	}
 
+	// Don't wait for background processes holding the output open once
+	// the command has been killed
+	cmd.WaitDelay = killWaitDelay
+	return cmd, cleanup, nil
+}
+
+// localCommand prepares code to run locally (for development or when Docker is not available)
+func (r *Runner) localCommand(ctx context.Context, request *github.CodeRunRequest) (*exec.Cmd, func(), error) {
+	env := lookupEnvironment(request.Environment)
+
+	cleanup := func() {}
 	var cmd *exec.Cmd
-	if request.Environment == "node" || request.Environment == "python" {
-		// For interpreted languages, pass the command directly
-		cmd = exec.CommandContext(ctx, shell, shellFlag, request.Command)
+	if env.compiled() {
+		// Compiled languages are written to a temporary directory and built there
+		srcDir, err := os.MkdirTemp("", "prism-"+env.name+"-")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create source directory: %w", err)
+		}
+		cleanup = func() { os.RemoveAll(srcDir) }
+
+		if err := os.WriteFile(filepath.Join(srcDir, env.sourceFile), []byte(request.Command), 0644); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to write source file: %w", err)
+		}
+		cmd = exec.CommandContext(ctx, "bash", "-c", env.buildScript(srcDir))
 	} else {
-		// For shell commands
-		cmd = exec.CommandContext(ctx, shell, shellFlag, request.Command)
+		cmd = exec.CommandContext(ctx, env.localShell, env.localFlag, request.Command)
 	}
 
 	// Set working directory
@@ -132,93 +196,65 @@ func (r *Runner) runLocally(request *github.CodeRunRequest, resultID string, sta
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
-
-	completedAt := time.Now()
-	exitCode := 0
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else {
-			exitCode = -1
-		}
-	}
-
-	return &github.CodeExecutionResult{
-		ID:          resultID,
-		Command:     request.Command,
-		Environment: request.Environment,
-		ExitCode:    exitCode,
-		Stdout:      stdout.String(),
-		Stderr:      stderr.String(),
-		Duration:    completedAt.Sub(startTime).Milliseconds(),
-		StartedAt:   startTime,
-		CompletedAt: completedAt,
-	}, nil
+	return cmd, cleanup, nil
 }
 
-// runInDocker executes code in a Docker container
-func (r *Runner) runInDocker(request *github.CodeRunRequest, resultID string, startTime time.Time) (*github.CodeExecutionResult, error) {
-	timeout := r.config.Timeout
-	if request.Timeout > 0 {
-		timeout = time.Duration(request.Timeout) * time.Second
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	// Select the appropriate Docker image
-	var image string
-	switch request.Environment {
-	case "node":
-		image = r.config.NodeImage
-	case "python":
-		image = r.config.PythonImage
-	case "shell", "bash", "":
-		image = r.config.ShellImage
-	default:
-		image = r.config.ShellImage
-	}
+// dockerCommand prepares code to run in a Docker container
+func (r *Runner) dockerCommand(ctx context.Context, request *github.CodeRunRequest, resultID string) (*exec.Cmd, func()) {
+	env := lookupEnvironment(request.Environment)
+	containerName := "prism-run-" + resultID
 
 	// Build docker run command
 	args := []string{
 		"run",
 		"--rm",
+		"--name", containerName,
 		"--memory", r.config.MemoryLimit,
 		"--cpus", r.config.CPULimit,
 		"--network", "none", // Disable network by default for security
 	}
 
+	// Mount named volumes so dependency and build caches survive between runs
+	if r.config.CacheVolumes {
+		for _, cache := range env.caches {
+			args = append(args, "-v", fmt.Sprintf("%s-%s:%s", r.config.CacheVolumePrefix, cache.volume, cache.path))
+		}
+	}
+
 	// Add environment variables
 	for k, v := range request.EnvVars {
 		args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
 	}
 
-	// Add the image and command
-	args = append(args, image)
-
-	// Add the appropriate shell command based on environment
-	switch request.Environment {
-	case "node":
-		args = append(args, "node", "-e", request.Command)
-	case "python":
-		args = append(args, "python3", "-c", request.Command)
-	default:
-		args = append(args, "sh", "-c", request.Command)
+	var stdin io.Reader
+	if env.compiled() {
+		// Source is streamed over stdin and written to a file inside the container
+		args = append(args, "-i", env.image(r.config), "sh", "-c",
+			fmt.Sprintf("mkdir -p %s && cat > %s/%s && %s",
+				containerSourceDir, containerSourceDir, env.sourceFile, env.buildScript(containerSourceDir)))
+		stdin = strings.NewReader(request.Command)
+	} else {
+		args = append(args, env.image(r.config), env.dockerShell, env.dockerFlag, request.Command)
 	}
 
 	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdin = stdin
+
+	// Killing the docker client on timeout or cancellation leaves the
+	// container running, so remove it explicitly
+	cleanup := func() {
+		if ctx.Err() != nil {
+			if err := exec.Command("docker", "rm", "-f", containerName).Run(); err != nil {
+				log.Printf("Failed to remove container %s: %v", containerName, err)
+			}
+		}
+	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
+	return cmd, cleanup
+}
 
+// newResult builds the result of a finished command
+func newResult(request *github.CodeRunRequest, resultID string, startTime time.Time, stdout, stderr string, err error) *github.CodeExecutionResult {
 	completedAt := time.Now()
 	exitCode := 0
 	if err != nil {
@@ -234,12 +270,12 @@ func (r *Runner) runInDocker(request *github.CodeRunRequest, resultID string, st
 		Command:     request.Command,
 		Environment: request.Environment,
 		ExitCode:    exitCode,
-		Stdout:      stdout.String(),
-		Stderr:      stderr.String(),
+		Stdout:      stdout,
+		Stderr:      stderr,
 		Duration:    completedAt.Sub(startTime).Milliseconds(),
 		StartedAt:   startTime,
 		CompletedAt: completedAt,
-	}, nil
+	}
 }
 
 // RunScript executes a script file in the appropriate environment
@@ -254,7 +290,7 @@ func (r *Runner) RunScript(script, environment string, envVars map[string]string
 
 // SupportedEnvironments returns a list of supported execution environments
 func (r *Runner) SupportedEnvironments() []string {
-	return []string{"node", "python", "shell", "bash"}
+	return []string{"node", "python", "shell", "bash", "go", "rust", "java", "c", "cpp"}
 }
 
 // ValidateCommand performs basic validation on a command
@@ -0,0 +1,222 @@
+package coderunner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacklau/prism/internal/integrations/github"
+)
+
+// maxOutputLineSize is the longest output line delivered as a single chunk
+const maxOutputLineSize = 1024 * 1024
+
+var (
+	// ErrRunNotFound is returned when a streaming run does not exist or
+	// belongs to another user
+	ErrRunNotFound = errors.New("run not found")
+
+	// ErrRunExists is returned when starting a run with an ID already in use
+	ErrRunExists = errors.New("run already exists")
+)
+
+// OutputLine represents a line of output from a streaming run
+type OutputLine struct {
+	Content   string    `json:"content"`
+	Stream    string    `json:"stream"` // "stdout" or "stderr"
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// OutputHandler is called for every line of output from a streaming run
+type OutputHandler func(line OutputLine)
+
+// StreamOptions configures a streaming run
+type StreamOptions struct {
+	// RunID identifies the run. Callers may choose it up front so they can
+	// subscribe to output before the run starts; one is generated if empty.
+	RunID string
+
+	// UserID is the user who owns the run and may stop it
+	UserID string
+
+	// OnOutput receives output lines as they are produced
+	OnOutput OutputHandler
+}
+
+// Execution is a run whose output is streamed while it executes
+type Execution struct {
+	ID        string
+	UserID    string
+	Request   *github.CodeRunRequest
+	StartedAt time.Time
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	result    *github.CodeExecutionResult
+	cancelled bool
+	mu        sync.Mutex
+}
+
+// Done returns a channel that is closed when the run finishes
+func (e *Execution) Done() <-chan struct{} {
+	return e.done
+}
+
+// Wait blocks until the run finishes and returns its result
+func (e *Execution) Wait() *github.CodeExecutionResult {
+	<-e.done
+	return e.result
+}
+
+// Cancelled reports whether the run was stopped before it finished
+func (e *Execution) Cancelled() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.cancelled
+}
+
+// Start begins a run in the background and streams its output line by line
+// to opts.OnOutput. The returned execution can be waited on, and the run can
+// be stopped with Stop.
+func (r *Runner) Start(request *github.CodeRunRequest, opts StreamOptions) (*Execution, error) {
+	runID := opts.RunID
+	if runID == "" {
+		runID = uuid.New().String()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout(request))
+
+	execution := &Execution{
+		ID:        runID,
+		UserID:    opts.UserID,
+		Request:   request,
+		StartedAt: time.Now(),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	if _, exists := r.executions[runID]; exists {
+		r.mu.Unlock()
+		cancel()
+		return nil, ErrRunExists
+	}
+	r.executions[runID] = execution
+	r.mu.Unlock()
+
+	log.Printf("Starting streaming code execution: id=%s, env=%s, cmd=%s",
+		runID, request.Environment, request.Command)
+
+	cmd, cleanup, err := r.command(ctx, request, runID)
+	if err != nil {
+		r.finish(execution)
+		return nil, err
+	}
+
+	go func() {
+		defer r.finish(execution)
+		defer cleanup()
+		execution.result = r.stream(ctx, cmd, execution, opts.OnOutput)
+	}()
+
+	return execution, nil
+}
+
+// stream runs a prepared command, forwarding output as it arrives
+func (r *Runner) stream(ctx context.Context, cmd *exec.Cmd, execution *Execution, handler OutputHandler) *github.CodeExecutionResult {
+	// Output is kept in full for the final result as well as forwarded
+	var stdout, stderr strings.Builder
+	stdoutLines := &lineWriter{stream: "stdout", output: &stdout, handler: handler}
+	stderrLines := &lineWriter{stream: "stderr", output: &stderr, handler: handler}
+	cmd.Stdout = stdoutLines
+	cmd.Stderr = stderrLines
+
+	err := cmd.Run()
+	stdoutLines.flush()
+	stderrLines.flush()
+
+	if errors.Is(ctx.Err(), context.Canceled) {
+		execution.mu.Lock()
+		execution.cancelled = true
+		execution.mu.Unlock()
+	}
+
+	return newResult(execution.Request, execution.ID, execution.StartedAt, stdout.String(), stderr.String(), err)
+}
+
+// lineWriter splits written output into lines and passes each complete line
+// to a handler. Lines longer than maxOutputLineSize are delivered in pieces.
+type lineWriter struct {
+	stream  string
+	output  *strings.Builder
+	handler OutputHandler
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.output.Write(p)
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+	if len(w.partial) >= maxOutputLineSize {
+		w.flush()
+	}
+	return len(p), nil
+}
+
+// flush delivers any buffered partial line
+func (w *lineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.emit(w.partial)
+		w.partial = nil
+	}
+}
+
+func (w *lineWriter) emit(line []byte) {
+	if w.handler == nil {
+		return
+	}
+	w.handler(OutputLine{
+		Content:   string(line),
+		Stream:    w.stream,
+		Timestamp: time.Now(),
+	})
+}
+
+// finish releases a run's resources and marks it done
+func (r *Runner) finish(execution *Execution) {
+	execution.cancel()
+
+	r.mu.Lock()
+	delete(r.executions, execution.ID)
+	r.mu.Unlock()
+
+	close(execution.done)
+}
+
+// Stop cancels a streaming run owned by the given user
+func (r *Runner) Stop(runID, userID string) error {
+	r.mu.Lock()
+	execution, ok := r.executions[runID]
+	r.mu.Unlock()
+
+	if !ok || execution.UserID != userID {
+		return ErrRunNotFound
+	}
+
+	execution.cancel()
+	return nil
+}
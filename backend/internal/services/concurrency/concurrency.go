@@ -0,0 +1,260 @@
+// Package concurrency limits how many agent runs, swarms, builds and
+// background shells each user may have running at once, so one user can't
+// starve everyone else. Work started over the limit waits in line for one of
+// the user's own runs to finish, up to a queue timeout.
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jacklau/prism/internal/database/repository"
+)
+
+// Kinds of work limited per user
+const (
+	Agents = "agents" // Agent runs, including parallel runs and replays
+	Swarms = "swarms"
+	Builds = "builds"
+	Shells = "shells" // Background shell sessions
+)
+
+// Limits are how many of each kind of work a user may run at once. Zero is
+// unlimited.
+type Limits struct {
+	Agents int `json:"agents"`
+	Swarms int `json:"swarms"`
+	Builds int `json:"builds"`
+	Shells int `json:"shells"`
+}
+
+// Of returns the limit for a kind
+func (l Limits) Of(kind string) int {
+	switch kind {
+	case Agents:
+		return l.Agents
+	case Swarms:
+		return l.Swarms
+	case Builds:
+		return l.Builds
+	case Shells:
+		return l.Shells
+	}
+	return 0
+}
+
+// LimitError is returned when a user is at their limit for a kind of work and
+// none of it finished within the queue timeout
+type LimitError struct {
+	Kind  string
+	Limit int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("concurrent %s limit reached (%d), try again when one finishes", e.Kind, e.Limit)
+}
+
+// slotKey identifies one user's running work of one kind
+type slotKey struct {
+	userID string
+	kind   string
+}
+
+// Limiter hands out per-user slots. A nil limiter allows everything.
+type Limiter struct {
+	defaults     Limits
+	queueTimeout time.Duration
+	repo         *repository.ConcurrencyLimitRepository // Optional per-user overrides
+
+	mu      sync.Mutex
+	running map[slotKey]int
+	changed chan struct{} // Closed and replaced whenever a slot frees up or a limit changes
+}
+
+// NewLimiter creates a limiter with the default limits, which repo may
+// override per user
+func NewLimiter(defaults Limits, queueTimeout time.Duration, repo *repository.ConcurrencyLimitRepository) *Limiter {
+	return &Limiter{
+		defaults:     defaults,
+		queueTimeout: queueTimeout,
+		repo:         repo,
+		running:      make(map[slotKey]int),
+		changed:      make(chan struct{}),
+	}
+}
+
+// Defaults returns the limits of users without overrides
+func (l *Limiter) Defaults() Limits {
+	return l.defaults
+}
+
+// QueueTimeout returns how long work over the limit waits for a slot
+func (l *Limiter) QueueTimeout() time.Duration {
+	return l.queueTimeout
+}
+
+// UserLimits returns a user's limits, with their overrides applied
+func (l *Limiter) UserLimits(userID string) Limits {
+	limits := l.defaults
+	if l.repo == nil {
+		return limits
+	}
+
+	override, err := l.repo.Get(userID)
+	if err != nil {
+		log.Printf("Failed to get concurrency limits for user %s: %v", userID, err)
+		return limits
+	}
+	if override == nil {
+		return limits
+	}
+	for _, field := range []struct {
+		value *int
+		limit *int
+	}{
+		{override.MaxAgents, &limits.Agents},
+		{override.MaxSwarms, &limits.Swarms},
+		{override.MaxBuilds, &limits.Builds},
+		{override.MaxShells, &limits.Shells},
+	} {
+		if field.value != nil {
+			*field.limit = *field.value
+		}
+	}
+	return limits
+}
+
+// Running returns how much of each kind of work a user has running
+func (l *Limiter) Running(userID string) Limits {
+	if l == nil {
+		return Limits{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Limits{
+		Agents: l.running[slotKey{userID, Agents}],
+		Swarms: l.running[slotKey{userID, Swarms}],
+		Builds: l.running[slotKey{userID, Builds}],
+		Shells: l.running[slotKey{userID, Shells}],
+	}
+}
+
+// TryAcquire takes one of the user's slots for a kind of work if one is free.
+// Call release once the work finishes.
+func (l *Limiter) TryAcquire(userID, kind string) (release func(), ok bool) {
+	if l == nil {
+		return func() {}, true
+	}
+
+	release, _ = l.tryAcquire(userID, kind, l.UserLimits(userID).Of(kind))
+	return release, release != nil
+}
+
+// Acquire takes one of the user's slots for a kind of work, waiting for one to
+// free up if they are at their limit. It gives up with a *LimitError after
+// the queue timeout, or with ctx's error if ctx is done first. Call release
+// once the work finishes.
+func (l *Limiter) Acquire(ctx context.Context, userID, kind string) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	limit := l.UserLimits(userID).Of(kind)
+	timeout := time.NewTimer(l.queueTimeout)
+	defer timeout.Stop()
+
+	for {
+		release, changed := l.tryAcquire(userID, kind, limit)
+		if release != nil {
+			return release, nil
+		}
+
+		select {
+		case <-changed:
+		case <-timeout.C:
+			return nil, &LimitError{Kind: kind, Limit: limit}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		limit = l.UserLimits(userID).Of(kind)
+	}
+}
+
+// tryAcquire takes a slot if fewer than limit are running. Otherwise it
+// returns a channel closed when a slot frees up or a limit changes.
+func (l *Limiter) tryAcquire(userID, kind string, limit int) (release func(), changed <-chan struct{}) {
+	key := slotKey{userID, kind}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit > 0 && l.running[key] >= limit {
+		return nil, l.changed
+	}
+	l.running[key]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.release(key) })
+	}, nil
+}
+
+// release frees a slot and wakes anyone waiting for one
+func (l *Limiter) release(key slotKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.running[key]--; l.running[key] <= 0 {
+		delete(l.running, key)
+	}
+	l.wake()
+}
+
+// wake tells waiters to check again. The caller must hold l.mu.
+func (l *Limiter) wake() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// ListOverrides lists the users whose limits differ from the defaults
+func (l *Limiter) ListOverrides() ([]*repository.ConcurrencyLimit, error) {
+	if l.repo == nil {
+		return []*repository.ConcurrencyLimit{}, nil
+	}
+	return l.repo.List()
+}
+
+// SetOverride replaces a user's limits. Work waiting in line sees the new
+// limits straight away.
+func (l *Limiter) SetOverride(limit *repository.ConcurrencyLimit) error {
+	if l.repo == nil {
+		return fmt.Errorf("concurrency limit overrides are not available")
+	}
+	if err := l.repo.Upsert(limit); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.wake()
+	l.mu.Unlock()
+	return nil
+}
+
+// DeleteOverride returns a user to the default limits
+func (l *Limiter) DeleteOverride(userID string) error {
+	if l.repo == nil {
+		return nil
+	}
+	if err := l.repo.Delete(userID); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.wake()
+	l.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,404 @@
+// Package contextpack bundles part of a workspace into one block of prompt
+// context: a file tree plus the contents of the files most relevant to a
+// query, fit to a token budget. A bundle gives a conversation or agent task
+// the lay of a project in one step rather than many file_read rounds.
+package contextpack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/sandbox"
+)
+
+const (
+	// maxFiles bounds how many files a pack considers
+	maxFiles = 5000
+	// maxFileSize is the largest file whose contents are packed; bigger
+	// files are listed in the tree only
+	maxFileSize = 256 * 1024
+	// minPartialChars is the least room worth filling with the start of a
+	// file that doesn't fit whole
+	minPartialChars = 1000
+	// treeShare is the part of the budget the file tree may use
+	treeShare = 5
+)
+
+var (
+	// ErrInvalidSpec is returned for specs with a bad pattern or directory
+	ErrInvalidSpec = errors.New("invalid context pack")
+	// ErrNoFiles is returned when nothing in the workspace matches a spec
+	ErrNoFiles = errors.New("no files matched")
+)
+
+const contextHeader = `The following context was packed from the workspace: its file tree and the contents of the files most relevant to the task, most relevant first. Files marked as truncated were shortened to fit the context budget, and omitted files are listed at the end; read them with file_read if you need them.`
+
+// keyFiles are names that usually say the most about a project
+var keyFiles = map[string]bool{
+	"readme.md": true, "readme": true, "readme.txt": true,
+	"go.mod": true, "package.json": true, "cargo.toml": true, "pyproject.toml": true,
+	"requirements.txt": true, "pom.xml": true, "build.gradle": true, "gemfile": true,
+	"makefile": true, "dockerfile": true, "docker-compose.yml": true,
+	"main.go": true, "main.py": true, "index.ts": true, "index.js": true, "app.py": true,
+	"main.rs": true, "lib.rs": true, "app.tsx": true, "main.tsx": true,
+}
+
+// Spec selects what goes into a pack
+type Spec struct {
+	// Dir is the directory to pack, possibly root-prefixed ("name:path");
+	// the workspace root if empty
+	Dir string `json:"dir,omitempty" validate:"max=4096"`
+	// Globs select files by their path relative to Dir or their name, e.g.
+	// "**/*.go"; every file if empty
+	Globs []string `json:"globs,omitempty" validate:"max=50"`
+	// Query ranks files by how often its words appear in their paths and
+	// contents; without one, key files such as READMEs and manifests and
+	// files near the top of the tree come first
+	Query string `json:"query,omitempty" validate:"max=2000"`
+	// TokenBudget is the approximate size of the pack; the default if 0
+	TokenBudget int `json:"token_budget,omitempty" validate:"min=0"`
+}
+
+// PackedFile is a file whose contents are in a pack
+type PackedFile struct {
+	Path      string `json:"path"`
+	Tokens    int    `json:"tokens"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// Bundle is a packed block of workspace context
+type Bundle struct {
+	Content    string       `json:"content"`
+	Tokens     int          `json:"tokens"`
+	Files      []PackedFile `json:"files"`
+	Omitted    []string     `json:"omitted,omitempty"`
+	TotalFiles int          `json:"total_files"` // Files matched, packed or not
+}
+
+// Config holds configuration for context packs
+type Config struct {
+	DefaultTokenBudget int // Budget for specs that don't give one
+	MaxTokenBudget     int // Largest budget a spec may ask for; 0 for no limit
+}
+
+// Packer builds context packs from users' workspaces
+type Packer struct {
+	sandboxService *sandbox.Service
+	config         Config
+}
+
+// NewPacker creates a new context packer
+func NewPacker(sandboxService *sandbox.Service, config Config) *Packer {
+	return &Packer{
+		sandboxService: sandboxService,
+		config:         config,
+	}
+}
+
+// candidate is a matched file being ranked for a pack
+type candidate struct {
+	path    string // Qualified path, as file tools take it
+	rel     string // Path relative to the packed directory
+	size    int64
+	content string
+	binary  bool
+	score   float64
+}
+
+// Pack builds a bundle of a user's workspace as spec selects
+func (p *Packer) Pack(userID string, spec Spec) (*Bundle, error) {
+	for _, pattern := range spec.Globs {
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("%w: invalid pattern %q", ErrInvalidSpec, pattern)
+		}
+	}
+
+	root, rel, err := p.sandboxService.ResolveRoot(userID, spec.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+	dir := root.Path
+	prefix := ""
+	if rel != "" {
+		cleanPath := filepath.Clean(rel)
+		if strings.HasPrefix(cleanPath, "..") || filepath.IsAbs(cleanPath) {
+			return nil, fmt.Errorf("%w: dir must be a relative path within the workspace", ErrInvalidSpec)
+		}
+		if cleanPath != "." {
+			dir = filepath.Join(root.Path, cleanPath)
+			prefix = filepath.ToSlash(cleanPath) + "/"
+		}
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%w: directory not found: %s", ErrInvalidSpec, spec.Dir)
+	}
+
+	candidates, err := p.collect(root, dir, prefix, spec.Globs)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoFiles
+	}
+
+	rank(candidates, spec.Query)
+
+	budget := p.budget(spec.TokenBudget) * llm.CharsPerToken
+	return render(candidates, budget), nil
+}
+
+// budget returns the token budget for a pack
+func (p *Packer) budget(requested int) int {
+	budget := requested
+	if budget <= 0 {
+		budget = p.config.DefaultTokenBudget
+	}
+	if p.config.MaxTokenBudget > 0 && budget > p.config.MaxTokenBudget {
+		budget = p.config.MaxTokenBudget
+	}
+	return budget
+}
+
+// collect finds the files under dir that the globs select, leaving out
+// those the workspace ignores
+func (p *Packer) collect(root sandbox.WorkspaceRoot, dir, prefix string, globs []string) ([]*candidate, error) {
+	matcher := p.sandboxService.IgnoreMatcher(root.Path)
+
+	var candidates []*candidate
+	err := filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip unreadable entries
+		}
+		if filePath == dir {
+			return nil
+		}
+		rootRel, err := filepath.Rel(root.Path, filePath)
+		if err != nil {
+			return nil
+		}
+		if matcher.Match(rootRel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel := strings.TrimPrefix(filepath.ToSlash(rootRel), prefix)
+		if len(globs) > 0 && !matchesAny(globs, rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		c := &candidate{
+			path: root.Qualify(filepath.ToSlash(rootRel)),
+			rel:  rel,
+			size: info.Size(),
+		}
+		if info.Size() <= maxFileSize {
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				return nil
+			}
+			if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+				c.binary = true
+			} else {
+				c.content = string(data)
+			}
+		}
+		candidates = append(candidates, c)
+
+		if len(candidates) >= maxFiles {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search workspace: %w", err)
+	}
+	return candidates, nil
+}
+
+// matchesAny reports whether a relative path or its file name matches one
+// of the patterns
+func matchesAny(patterns []string, rel string) bool {
+	name := path.Base(rel)
+	for _, pattern := range patterns {
+		if matched, _ := doublestar.Match(pattern, rel); matched {
+			return true
+		}
+		if matched, _ := doublestar.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// rank scores candidates and sorts them most relevant first. Query words
+// count most in a file's path, then in its contents; key files and files
+// near the top of the tree get a boost, and large files a small penalty.
+func rank(candidates []*candidate, query string) {
+	terms := queryTerms(query)
+	for _, c := range candidates {
+		lowerPath := strings.ToLower(c.rel)
+		lowerContent := strings.ToLower(c.content)
+		for _, term := range terms {
+			if strings.Contains(lowerPath, term) {
+				c.score += 10
+			}
+			hits := strings.Count(lowerContent, term)
+			if hits > 5 {
+				hits = 5
+			}
+			c.score += float64(hits)
+		}
+		if keyFiles[strings.ToLower(path.Base(c.rel))] {
+			c.score += 5
+		}
+		c.score -= float64(strings.Count(c.rel, "/")) * 0.5
+		c.score -= float64(c.size) / maxFileSize
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].rel < candidates[j].rel
+	})
+}
+
+// queryTerms splits a query into lowercase words, dropping very short ones
+func queryTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !(r == '_' || r == '-' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r > 127)
+	}) {
+		if len(word) >= 3 && !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// render writes the tree and as many ranked files as fit budget characters
+func render(candidates []*candidate, budget int) *Bundle {
+	bundle := &Bundle{
+		Files:      []PackedFile{},
+		TotalFiles: len(candidates),
+	}
+
+	var sb strings.Builder
+	sb.WriteString(contextHeader)
+	sb.WriteString("\n\n<workspace_tree>\n")
+	sb.WriteString(renderTree(candidates, budget/treeShare))
+	sb.WriteString("</workspace_tree>")
+
+	for _, c := range candidates {
+		if c.binary || c.size > maxFileSize || c.content == "" {
+			continue
+		}
+
+		remaining := budget - sb.Len()
+		entry := fmt.Sprintf("\n\n<file path=%q>\n%s\n</file>", c.path, c.content)
+		if len(entry) <= remaining {
+			sb.WriteString(entry)
+			bundle.Files = append(bundle.Files, PackedFile{Path: c.path, Tokens: llm.EstimateTokens(c.content)})
+			continue
+		}
+
+		// Fill the room that is left with the start of the file
+		room := remaining - len(c.path) - 64
+		if room < minPartialChars {
+			bundle.Omitted = append(bundle.Omitted, c.path)
+			continue
+		}
+		content := truncate(c.content, room)
+		shown := strings.Count(content, "\n") + 1
+		fmt.Fprintf(&sb, "\n\n<file path=%q truncated=\"true\">\n%s\n... [truncated: showing %d of %d lines]\n</file>",
+			c.path, content, shown, strings.Count(c.content, "\n")+1)
+		bundle.Files = append(bundle.Files, PackedFile{Path: c.path, Tokens: llm.EstimateTokens(content), Truncated: true})
+	}
+
+	if len(bundle.Omitted) > 0 {
+		fmt.Fprintf(&sb, "\n\nOmitted to fit the budget: %s", strings.Join(bundle.Omitted, ", "))
+	}
+
+	bundle.Content = sb.String()
+	bundle.Tokens = llm.EstimateTokens(bundle.Content)
+	return bundle
+}
+
+// renderTree lists the candidates as an indented tree, sorted by path, in
+// at most limit characters
+func renderTree(candidates []*candidate, limit int) string {
+	paths := make([]string, len(candidates))
+	for i, c := range candidates {
+		paths[i] = c.rel
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	var printed []string // Directories of the previous path
+	for i, p := range paths {
+		dirs := strings.Split(p, "/")
+		name := dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+
+		var lines strings.Builder
+		for depth, dir := range dirs {
+			if depth < len(printed) && printed[depth] == dir {
+				continue
+			}
+			printed = printed[:depth]
+			fmt.Fprintf(&lines, "%s%s/\n", strings.Repeat("  ", depth), dir)
+			printed = append(printed, dir)
+		}
+		if len(printed) > len(dirs) {
+			printed = printed[:len(dirs)]
+		}
+		fmt.Fprintf(&lines, "%s%s\n", strings.Repeat("  ", len(dirs)), name)
+
+		if sb.Len()+lines.Len() > limit {
+			fmt.Fprintf(&sb, "... %d more files\n", len(paths)-i)
+			break
+		}
+		sb.WriteString(lines.String())
+	}
+	return sb.String()
+}
+
+// truncate shortens s to at most limit bytes, preferring to cut at a line
+// boundary and never splitting a UTF-8 sequence
+func truncate(s string, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	if len(s) <= limit {
+		return s
+	}
+	cut := s[:limit]
+	if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+		return cut[:i]
+	}
+	for len(cut) > 0 && !utf8.ValidString(cut) {
+		cut = cut[:len(cut)-1]
+	}
+	return cut
+}
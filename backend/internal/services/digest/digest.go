@@ -0,0 +1,229 @@
+// Package digest sends each user a daily or weekly summary of their activity
+// (agent runs, builds, webhook automations and what failed) through the
+// notification integrations, on a schedule the user chooses.
+package digest
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+	"github.com/jacklau/prism/internal/integrations/github"
+)
+
+const (
+	defaultCheckInterval = 5 * time.Minute
+
+	// maxListedFailures caps how many recent failures a digest lists
+	maxListedFailures = 5
+)
+
+// Failure is a failed run listed in a digest
+type Failure struct {
+	Kind      string    `json:"kind"` // "agent", "swarm", "build" or "tool"
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Digest summarizes a user's activity over a period
+type Digest struct {
+	Frequency          string    `json:"frequency"`
+	Since              time.Time `json:"since"`
+	Until              time.Time `json:"until"`
+	Conversations      int       `json:"conversations"`
+	Messages           int       `json:"messages"`
+	TokensUsed         int64     `json:"tokens_used"`
+	AgentRuns          int       `json:"agent_runs"`
+	AgentFailures      int       `json:"agent_failures"`
+	SwarmRuns          int       `json:"swarm_runs"`
+	Builds             int       `json:"builds"`
+	BuildFailures      int       `json:"build_failures"`
+	ToolFailures       int       `json:"tool_failures"`
+	WebhookAutomations int       `json:"webhook_automations"` // Deliveries processed, including failures
+	WebhookFailures    int       `json:"webhook_failures"`
+	RecentFailures     []Failure `json:"recent_failures"`
+}
+
+// Empty reports whether there was no activity in the period
+func (d *Digest) Empty() bool {
+	return d.Messages == 0 && d.AgentRuns == 0 && d.SwarmRuns == 0 && d.Builds == 0 &&
+		d.ToolFailures == 0 && d.WebhookAutomations == 0
+}
+
+// Service builds activity digests and sends the ones that are due
+type Service struct {
+	scheduleRepo *repository.DigestScheduleRepository
+	usageRepo    *repository.UsageRepository
+	integrations *integrations.Manager
+	interval     time.Duration
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewService creates a new digest service. checkInterval is how often
+// schedules are checked for being due.
+func NewService(scheduleRepo *repository.DigestScheduleRepository, usageRepo *repository.UsageRepository, integrationManager *integrations.Manager, checkInterval time.Duration) *Service {
+	if checkInterval <= 0 {
+		checkInterval = defaultCheckInterval
+	}
+	return &Service{
+		scheduleRepo: scheduleRepo,
+		usageRepo:    usageRepo,
+		integrations: integrationManager,
+		interval:     checkInterval,
+		stopCh:       make(chan struct{}),
+	}
+}
+
+// Start begins checking schedules in the background
+func (s *Service) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				s.sendDue()
+			}
+		}
+	}()
+}
+
+// Stop stops checking schedules
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+}
+
+// sendDue sends every digest that is due. Digests without any activity are
+// skipped but still count as sent, so the next one covers a fresh period.
+func (s *Service) sendDue() {
+	schedules, err := s.scheduleRepo.ListEnabled()
+	if err != nil {
+		log.Printf("Failed to list digest schedules: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, schedule := range schedules {
+		if !schedule.Due(now) {
+			continue
+		}
+
+		digest, err := s.Build(schedule, now)
+		if err != nil {
+			log.Printf("Failed to build digest for user %s: %v", schedule.UserID, err)
+			continue
+		}
+		if !digest.Empty() {
+			s.Send(schedule, digest)
+		}
+		if err := s.scheduleRepo.MarkSent(schedule.UserID, now); err != nil {
+			log.Printf("Failed to record digest for user %s: %v", schedule.UserID, err)
+		}
+	}
+}
+
+// Build aggregates a user's activity for the period of their schedule
+// ending at the given time. The period starts at the previous digest if that
+// was sent more recently.
+func (s *Service) Build(schedule *repository.DigestSchedule, until time.Time) (*Digest, error) {
+	since := until.Add(-schedule.Period())
+	if schedule.LastSentAt != nil && schedule.LastSentAt.After(since) {
+		since = *schedule.LastSentAt
+	}
+
+	summary, err := s.usageRepo.Summarize(schedule.UserID, since)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := s.usageRepo.WebhookDeliveries(schedule.UserID, since)
+	if err != nil {
+		return nil, err
+	}
+	failures, err := s.usageRepo.Failures(schedule.UserID, since, maxListedFailures)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := &Digest{
+		Frequency:       schedule.Frequency,
+		Since:           since,
+		Until:           until,
+		Conversations:   summary.Conversations,
+		Messages:        summary.Messages,
+		TokensUsed:      summary.TokensUsed,
+		AgentRuns:       summary.AgentRuns,
+		AgentFailures:   summary.AgentFailures,
+		SwarmRuns:       summary.SwarmRuns,
+		Builds:          summary.Builds,
+		BuildFailures:   summary.BuildFailures,
+		ToolFailures:    summary.ToolFailures,
+		WebhookFailures: deliveries[github.DeliveryStatusFailed] + deliveries[github.DeliveryStatusDeadLetter],
+		RecentFailures:  make([]Failure, 0, len(failures)),
+	}
+	digest.WebhookAutomations = deliveries[github.DeliveryStatusCompleted] + digest.WebhookFailures
+	for _, failure := range failures {
+		digest.RecentFailures = append(digest.RecentFailures, Failure{
+			Kind:      failure.Kind,
+			Name:      failure.Name,
+			CreatedAt: failure.CreatedAt,
+		})
+	}
+	return digest, nil
+}
+
+// Send notifies the user's integrations of a digest
+func (s *Service) Send(schedule *repository.DigestSchedule, digest *Digest) {
+	if s.integrations == nil {
+		return
+	}
+	s.integrations.Notify(&integrations.Event{
+		Type:   integrations.EventActivityDigest,
+		UserID: schedule.UserID,
+		Data:   eventData(digest, schedule.Location()),
+	})
+}
+
+// eventData renders a digest as the fields of a notification
+func eventData(digest *Digest, loc *time.Location) map[string]interface{} {
+	data := map[string]interface{}{
+		"period":              digest.Frequency,
+		"since":               digest.Since.In(loc).Format("Jan 2 15:04 MST"),
+		"messages":            digest.Messages,
+		"agent_runs":          withFailures(digest.AgentRuns, digest.AgentFailures),
+		"swarm_runs":          digest.SwarmRuns,
+		"builds":              withFailures(digest.Builds, digest.BuildFailures),
+		"webhook_automations": withFailures(digest.WebhookAutomations, digest.WebhookFailures),
+	}
+	if digest.ToolFailures > 0 {
+		data["tool_failures"] = digest.ToolFailures
+	}
+	if len(digest.RecentFailures) > 0 {
+		lines := make([]string, 0, len(digest.RecentFailures))
+		for _, failure := range digest.RecentFailures {
+			line := failure.Kind
+			if failure.Name != "" {
+				line += " " + failure.Name
+			}
+			lines = append(lines, fmt.Sprintf("• %s (%s)", line, failure.CreatedAt.In(loc).Format("Jan 2 15:04")))
+		}
+		data["recent_failures"] = strings.Join(lines, "\n")
+	}
+	return data
+}
+
+// withFailures formats a count with how many of them failed
+func withFailures(total, failed int) string {
+	if failed == 0 {
+		return fmt.Sprint(total)
+	}
+	return fmt.Sprintf("%d (%d failed)", total, failed)
+}
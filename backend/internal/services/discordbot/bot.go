@@ -0,0 +1,463 @@
+// Package discordbot runs Prism as a Discord bot. The bot connects to the
+// Discord gateway and handles the /prism slash command: servers are linked
+// to a Prism account, and members of a linked server can start agent tasks
+// whose output is streamed into the channel or a thread.
+package discordbot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacklau/prism/internal/agent"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+	"github.com/jacklau/prism/internal/integrations/discord"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/security"
+)
+
+const (
+	defaultUpdateInterval = 1500 * time.Millisecond
+
+	// linkCodeTTL is how long a link code from /prism link can be redeemed
+	linkCodeTTL = 10 * time.Minute
+
+	// linkCodeAlphabet omits characters that are easily confused (0/O, 1/I)
+	linkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	linkCodeLength   = 8
+
+	// interactionTypeCommand is the interaction type of a slash command
+	interactionTypeCommand = 2
+
+	systemPrompt = `You are Prism, answering a question asked from Discord. Be concise and format your answer with Discord markdown.`
+)
+
+// ErrInvalidLinkCode is returned when a link code is unknown or expired
+var ErrInvalidLinkCode = errors.New("invalid or expired link code")
+
+// commands are the slash commands registered for the bot
+var commands = []discord.ApplicationCommand{
+	{
+		Name:        "prism",
+		Description: "Run Prism agents from Discord",
+		Options: []discord.ApplicationCommandOption{
+			{
+				Type:        discord.OptionTypeSubcommand,
+				Name:        "ask",
+				Description: "Ask an agent; the answer is streamed into the channel",
+				Options: []discord.ApplicationCommandOption{
+					{
+						Type:        discord.OptionTypeString,
+						Name:        "prompt",
+						Description: "What to ask",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discord.OptionTypeSubcommand,
+				Name:        "link",
+				Description: "Link this server to your Prism account (requires Manage Server)",
+			},
+			{
+				Type:        discord.OptionTypeSubcommand,
+				Name:        "unlink",
+				Description: "Unlink this server from Prism (requires Manage Server)",
+			},
+		},
+	},
+}
+
+// Config holds configuration for the Discord bot
+type Config struct {
+	BotToken string
+	// Provider and Model answer /prism ask unless a server overrides them
+	Provider string
+	Model    string
+	// UpdateInterval is how often streamed replies are edited
+	UpdateInterval time.Duration
+}
+
+// pendingLink is a link code waiting to be redeemed in Prism
+type pendingLink struct {
+	guildID   string
+	expiresAt time.Time
+}
+
+// Bot handles /prism slash commands received over the Discord gateway
+type Bot struct {
+	discord           *discord.Client
+	gateway           *discord.Gateway
+	integrationRepo   *repository.IntegrationRepository
+	agents            *agent.Manager
+	llmManager        *llm.Manager
+	providerKeyRepo   *repository.ProviderKeyRepository
+	encryptionService *security.EncryptionService
+	integrations      *integrations.Manager
+	config            Config
+
+	pending    map[string]*pendingLink
+	guildNames map[string]string
+	mu         sync.Mutex
+}
+
+// NewBot creates a new Discord bot
+func NewBot(
+	discordClient *discord.Client,
+	integrationRepo *repository.IntegrationRepository,
+	agents *agent.Manager,
+	llmManager *llm.Manager,
+	providerKeyRepo *repository.ProviderKeyRepository,
+	encryptionService *security.EncryptionService,
+	integrationManager *integrations.Manager,
+	config Config,
+) *Bot {
+	if config.UpdateInterval <= 0 {
+		config.UpdateInterval = defaultUpdateInterval
+	}
+	b := &Bot{
+		discord:           discordClient,
+		integrationRepo:   integrationRepo,
+		agents:            agents,
+		llmManager:        llmManager,
+		providerKeyRepo:   providerKeyRepo,
+		encryptionService: encryptionService,
+		integrations:      integrationManager,
+		config:            config,
+		pending:           make(map[string]*pendingLink),
+		guildNames:        make(map[string]string),
+	}
+	b.gateway = discord.NewGateway(config.BotToken, discord.IntentGuilds, b.handleDispatch)
+	return b
+}
+
+// Start connects the bot to the Discord gateway
+func (b *Bot) Start() {
+	b.gateway.Start()
+}
+
+// Stop disconnects the bot from the Discord gateway
+func (b *Bot) Stop() {
+	b.gateway.Stop()
+}
+
+// handleDispatch handles gateway events
+func (b *Bot) handleDispatch(eventType string, data json.RawMessage) {
+	switch eventType {
+	case "READY":
+		var ready struct {
+			Application struct {
+				ID string `json:"id"`
+			} `json:"application"`
+		}
+		if err := json.Unmarshal(data, &ready); err != nil {
+			log.Printf("Failed to decode Discord READY event: %v", err)
+			return
+		}
+		go func() {
+			if err := b.discord.RegisterCommands(ready.Application.ID, commands); err != nil {
+				log.Printf("Failed to register Discord commands: %v", err)
+				return
+			}
+			log.Println("Discord bot connected and commands registered")
+		}()
+
+	case "GUILD_CREATE", "GUILD_UPDATE":
+		// Remember server names so linked servers can be shown by name
+		var guild struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(data, &guild); err == nil && guild.ID != "" {
+			b.mu.Lock()
+			b.guildNames[guild.ID] = guild.Name
+			b.mu.Unlock()
+		}
+
+	case "INTERACTION_CREATE":
+		var interaction discord.Interaction
+		if err := json.Unmarshal(data, &interaction); err != nil {
+			log.Printf("Failed to decode Discord interaction: %v", err)
+			return
+		}
+		if interaction.Type != interactionTypeCommand || interaction.Data == nil || interaction.Data.Name != "prism" {
+			return
+		}
+		go b.handleInteraction(&interaction)
+	}
+}
+
+// handleInteraction handles a /prism command. The reply is shown only to
+// the user who ran the command; long-running work continues in the
+// background.
+func (b *Bot) handleInteraction(interaction *discord.Interaction) {
+	reply := b.handleCommand(interaction)
+	if err := b.discord.RespondToInteraction(interaction.ID, interaction.Token, reply, true); err != nil {
+		log.Printf("Failed to respond to Discord interaction: %v", err)
+	}
+}
+
+func (b *Bot) handleCommand(interaction *discord.Interaction) string {
+	if interaction.GuildID == "" || interaction.Member == nil || interaction.Member.User == nil {
+		return "Prism commands can only be used in a server."
+	}
+	if len(interaction.Data.Options) == 0 {
+		return "Usage: `/prism ask`, `/prism link` or `/prism unlink`"
+	}
+	sub := interaction.Data.Options[0]
+
+	if b.integrations != nil {
+		b.integrations.Track(&integrations.Event{
+			Type: "discord.command",
+			Data: map[string]interface{}{
+				"subcommand": sub.Name,
+				"guild_id":   interaction.GuildID,
+			},
+		})
+	}
+
+	switch sub.Name {
+	case "link":
+		return b.handleLink(interaction)
+	case "unlink":
+		return b.handleUnlink(interaction)
+	case "ask":
+		return b.handleAsk(interaction, stringOption(sub.Options, "prompt"))
+	default:
+		return fmt.Sprintf("Unknown command `%s`.", sub.Name)
+	}
+}
+
+func (b *Bot) handleAsk(interaction *discord.Interaction, prompt string) string {
+	if prompt == "" {
+		return "Usage: `/prism ask prompt:<question>`"
+	}
+	if b.agents == nil {
+		return "Agents are not available on this Prism server."
+	}
+
+	settings, err := b.integrationRepo.GetDiscordGuildSettings(interaction.GuildID)
+	if err != nil {
+		log.Printf("Failed to get Discord guild settings: %v", err)
+		return "Something went wrong looking up this server's Prism account. Please try again."
+	}
+	if settings == nil {
+		return "This server isn't linked to Prism yet. Someone with Manage Server can run `/prism link` to connect it."
+	}
+	if !settings.Enabled {
+		return "Prism is disabled in this server."
+	}
+	if settings.ChannelID != "" && settings.ChannelID != interaction.ChannelID {
+		return fmt.Sprintf("Prism commands can only be used in <#%s>.", settings.ChannelID)
+	}
+
+	provider, model := b.config.Provider, b.config.Model
+	if settings.Provider != "" && settings.Model != "" {
+		provider, model = settings.Provider, settings.Model
+	}
+
+	creds := b.llmManager.UserCredentials(b.providerKeyRepo, b.encryptionService, settings.UserID, provider)
+	if !b.llmManager.CanUse(provider, creds) {
+		return fmt.Sprintf("No API key is configured for %s. Add one in Prism under Settings.", provider)
+	}
+
+	go b.ask(interaction, settings, provider, model, creds, prompt)
+	if settings.UseThreads {
+		return "Asking Prism… the answer will appear in a thread."
+	}
+	return "Asking Prism…"
+}
+
+// ask runs an agent and streams its answer into the channel or a thread
+func (b *Bot) ask(interaction *discord.Interaction, settings *repository.DiscordGuildSettings, provider, model string, creds *llm.Credentials, prompt string) {
+	header := fmt.Sprintf("<@%s> asked: %s", interaction.Member.User.ID, truncate(prompt, 300))
+	stream, err := b.startStream(interaction.ChannelID, header, truncate(strings.Join(strings.Fields(prompt), " "), 90), settings.UseThreads)
+	if err != nil {
+		log.Printf("Failed to start Discord reply: %v", err)
+		return
+	}
+
+	task := agent.NewTask(prompt)
+	execution, err := b.agents.RunTask(context.Background(), task, agent.AgentConfig{
+		Name:         "discord",
+		Provider:     provider,
+		Model:        model,
+		SystemPrompt: systemPrompt,
+		Credentials:  creds,
+	})
+	if err != nil {
+		stream.finish(":x: " + err.Error())
+		return
+	}
+
+	startTime := time.Now()
+	agentInstance := execution.Agents[0]
+	for event := range agentInstance.Events() {
+		switch event.Type {
+		case agent.AgentEventStarted:
+			// Don't count time spent in the agent pool's queue
+			startTime = time.Now()
+		case agent.AgentEventStreamChunk:
+			if delta, ok := event.Data["delta"].(string); ok {
+				stream.append(delta)
+			}
+		case agent.AgentEventCompleted:
+			output, _ := event.Data["output"].(string)
+			stream.finish(output)
+			if b.integrations != nil {
+				b.integrations.TrackAgentFinished(settings.UserID, "", agentInstance.ID, "discord", false, "", time.Since(startTime).Milliseconds())
+			}
+			return
+		case agent.AgentEventFailed:
+			errMsg, _ := event.Data["error"].(string)
+			stream.finish(":x: Agent failed: " + errMsg)
+			if b.integrations != nil {
+				b.integrations.TrackAgentFinished(settings.UserID, "", agentInstance.ID, "discord", true, errMsg, time.Since(startTime).Milliseconds())
+			}
+			return
+		case agent.AgentEventCancelled:
+			stream.finish(":no_entry_sign: Cancelled")
+			return
+		}
+	}
+	stream.finish("")
+}
+
+// handleLink issues a one-time code that links the server to the Prism
+// account that redeems it
+func (b *Bot) handleLink(interaction *discord.Interaction) string {
+	if !canManageGuild(interaction) {
+		return "You need the Manage Server permission to link this server."
+	}
+
+	code, err := generateLinkCode()
+	if err != nil {
+		return "Something went wrong creating a link code. Please try again."
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	for c, link := range b.pending {
+		if now.After(link.expiresAt) {
+			delete(b.pending, c)
+		}
+	}
+	b.pending[code] = &pendingLink{
+		guildID:   interaction.GuildID,
+		expiresAt: now.Add(linkCodeTTL),
+	}
+	b.mu.Unlock()
+
+	return fmt.Sprintf("To link this server, enter code **%s** in Prism under Settings → Integrations → Discord. "+
+		"The code expires in %d minutes. Agent tasks started here will use that account's API keys.", code, int(linkCodeTTL.Minutes()))
+}
+
+func (b *Bot) handleUnlink(interaction *discord.Interaction) string {
+	if !canManageGuild(interaction) {
+		return "You need the Manage Server permission to unlink this server."
+	}
+
+	removed, err := b.integrationRepo.DeleteDiscordGuildSettings(interaction.GuildID, "")
+	if err != nil {
+		log.Printf("Failed to unlink Discord guild: %v", err)
+		return "Something went wrong unlinking this server. Please try again."
+	}
+	if !removed {
+		return "This server isn't linked to Prism."
+	}
+	return "This server has been unlinked from Prism."
+}
+
+// CompleteLink redeems a link code for a Prism user. Relinking a server
+// keeps its existing settings.
+func (b *Bot) CompleteLink(code, userID string) (*repository.DiscordGuildSettings, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	b.mu.Lock()
+	pending, ok := b.pending[code]
+	if ok {
+		delete(b.pending, code)
+	}
+	b.mu.Unlock()
+
+	if !ok || time.Now().After(pending.expiresAt) {
+		return nil, ErrInvalidLinkCode
+	}
+
+	settings, err := b.integrationRepo.GetDiscordGuildSettings(pending.guildID)
+	if err != nil {
+		return nil, err
+	}
+	if settings == nil {
+		settings = &repository.DiscordGuildSettings{
+			GuildID:    pending.guildID,
+			UseThreads: true,
+			Enabled:    true,
+		}
+	}
+	settings.UserID = userID
+	if name := b.GuildName(pending.guildID); name != "" {
+		settings.GuildName = name
+	}
+
+	if err := b.integrationRepo.SetDiscordGuildSettings(settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// GuildName returns the name of a server the bot is in, or "" if unknown
+func (b *Bot) GuildName(guildID string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.guildNames[guildID]
+}
+
+// canManageGuild reports whether the invoking member has Manage Server
+func canManageGuild(interaction *discord.Interaction) bool {
+	permissions, err := strconv.ParseUint(interaction.Member.Permissions, 10, 64)
+	if err != nil {
+		return false
+	}
+	return permissions&discord.PermissionManageGuild != 0
+}
+
+// stringOption returns the value of a string option, or "" if not set
+func stringOption(options []discord.InteractionOption, name string) string {
+	for _, option := range options {
+		if option.Name == name {
+			value, _ := option.Value.(string)
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// truncate shortens text to at most max characters. Thread names are
+// limited to 100 characters, and headers are kept short so the answer fits
+// in the same message.
+func truncate(text string, max int) string {
+	if runes := []rune(text); len(runes) > max {
+		return string(runes[:max]) + "…"
+	}
+	return text
+}
+
+func generateLinkCode() (string, error) {
+	buf := make([]byte, linkCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, v := range buf {
+		buf[i] = linkCodeAlphabet[int(v)%len(linkCodeAlphabet)]
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,173 @@
+package discordbot
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxMessageLength keeps messages under Discord's 2,000 character limit
+const maxMessageLength = 1900
+
+// replyStream is a reply that is edited as an answer streams in. Edits are
+// throttled to the bot's update interval to stay within Discord's rate
+// limits.
+type replyStream struct {
+	bot       *Bot
+	channelID string // the thread when replying in a thread
+	messageID string
+	prefix    string // shown above the answer when not replying in a thread
+
+	buf      strings.Builder
+	dirty    bool
+	finished bool
+	mu       sync.Mutex
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+}
+
+// startStream posts the header message and a placeholder reply, in a
+// thread started from the header when useThread is set, then starts
+// periodically updating the reply
+func (b *Bot) startStream(channelID, header, name string, useThread bool) (*replyStream, error) {
+	s := &replyStream{
+		bot:    b,
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+
+	if useThread {
+		parent, err := b.discord.CreateMessage(channelID, header)
+		if err != nil {
+			return nil, err
+		}
+		thread, err := b.discord.StartThread(channelID, parent.ID, name)
+		if err != nil {
+			// Fall back to replying in the channel, e.g. when the bot can't
+			// create threads there
+			log.Printf("Failed to start Discord thread: %v", err)
+			s.channelID = channelID
+		} else {
+			s.channelID = thread.ID
+		}
+	} else {
+		s.channelID = channelID
+		s.prefix = header + "\n\n"
+	}
+
+	message, err := b.discord.CreateMessage(s.channelID, s.prefix+"*Thinking…*")
+	if err != nil {
+		return nil, err
+	}
+	s.messageID = message.ID
+
+	go s.loop()
+	return s, nil
+}
+
+// append adds streamed text to the reply
+func (s *replyStream) append(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return
+	}
+	s.buf.WriteString(text)
+	s.dirty = true
+}
+
+func (s *replyStream) loop() {
+	defer close(s.doneCh)
+
+	ticker := time.NewTicker(s.bot.config.UpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if !s.dirty {
+				s.mu.Unlock()
+				continue
+			}
+			s.dirty = false
+			text := s.buf.String()
+			s.mu.Unlock()
+
+			s.update(s.prefix + tail(text, maxMessageLength-len(s.prefix)) + " …")
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// finish stops streaming and writes the final answer, replacing the
+// streamed text. Answers too long for one message are continued in further
+// messages. An empty final keeps the streamed text.
+func (s *replyStream) finish(final string) {
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.finished = true
+	output := s.buf.String()
+	s.mu.Unlock()
+
+	close(s.stopCh)
+	<-s.doneCh
+
+	if final == "" {
+		final = output
+	}
+	if strings.TrimSpace(final) == "" {
+		final = "*No response*"
+	}
+
+	chunks := splitMessage(final, maxMessageLength-len(s.prefix))
+	s.update(s.prefix + chunks[0])
+	for _, chunk := range chunks[1:] {
+		if _, err := s.bot.discord.CreateMessage(s.channelID, chunk); err != nil {
+			log.Printf("Failed to post Discord message: %v", err)
+			return
+		}
+	}
+}
+
+func (s *replyStream) update(text string) {
+	if err := s.bot.discord.EditMessage(s.channelID, s.messageID, text); err != nil {
+		log.Printf("Failed to update Discord message: %v", err)
+	}
+}
+
+// tail returns at most max bytes from the end of text
+func tail(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	text = text[len(text)-max+len("…"):]
+	for len(text) > 0 && !utf8.RuneStart(text[0]) {
+		text = text[1:]
+	}
+	return "…" + text
+}
+
+// splitMessage splits text into chunks of at most max bytes, preferring to
+// break at line boundaries
+func splitMessage(text string, max int) []string {
+	var chunks []string
+	for len(text) > max {
+		cut := strings.LastIndexByte(text[:max], '\n')
+		if cut <= 0 {
+			cut = max
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		chunks = append(chunks, text[:cut])
+		text = strings.TrimLeft(text[cut:], "\n")
+	}
+	return append(chunks, text)
+}
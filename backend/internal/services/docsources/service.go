@@ -0,0 +1,161 @@
+// Package docsources reads internal documentation from the Notion and
+// Confluence accounts users connect, so agents can pull pages into context.
+// Credentials are stored encrypted in the integration repository and checked
+// against the source when they are saved.
+package docsources
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations/confluence"
+	"github.com/jacklau/prism/internal/integrations/notion"
+)
+
+const defaultMaxPageChars = 40000
+
+var (
+	// ErrNotionNotConnected is returned when a user has no Notion token
+	ErrNotionNotConnected = errors.New("notion not connected")
+	// ErrConfluenceNotConnected is returned when a user has no Confluence credentials
+	ErrConfluenceNotConnected = errors.New("confluence not connected")
+)
+
+// Config holds configuration for documentation sources
+type Config struct {
+	// MaxPageChars truncates pages read into an agent's context
+	MaxPageChars int
+}
+
+// Service searches and reads users' documentation sources
+type Service struct {
+	notion     *notion.Client
+	confluence *confluence.Client
+	repo       *repository.IntegrationRepository
+	config     Config
+}
+
+// NewService creates a new documentation source service
+func NewService(notionClient *notion.Client, confluenceClient *confluence.Client, repo *repository.IntegrationRepository, config Config) *Service {
+	if config.MaxPageChars <= 0 {
+		config.MaxPageChars = defaultMaxPageChars
+	}
+	return &Service{
+		notion:     notionClient,
+		confluence: confluenceClient,
+		repo:       repo,
+		config:     config,
+	}
+}
+
+// ConnectNotion checks a Notion integration token and saves it for a user
+func (s *Service) ConnectNotion(userID, token string) (*repository.NotionSettings, error) {
+	token = strings.TrimSpace(token)
+	bot, err := s.notion.Me(token)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &repository.NotionSettings{
+		UserID:        userID,
+		Token:         token,
+		WorkspaceName: bot.WorkspaceName,
+	}
+	if err := s.repo.SetNotionSettings(settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// ConnectConfluence checks Confluence credentials and saves them for a user
+func (s *Service) ConnectConfluence(userID, baseURL, email, token string) (*repository.ConfluenceSettings, error) {
+	baseURL, err := confluence.NormalizeBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	creds := confluence.Credentials{
+		BaseURL: baseURL,
+		Email:   strings.TrimSpace(email),
+		Token:   strings.TrimSpace(token),
+	}
+	user, err := s.confluence.CurrentUser(creds)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &repository.ConfluenceSettings{
+		UserID:      userID,
+		BaseURL:     creds.BaseURL,
+		Email:       creds.Email,
+		Token:       creds.Token,
+		DisplayName: user.DisplayName,
+	}
+	if err := s.repo.SetConfluenceSettings(settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// SearchNotion searches the Notion pages shared with a user's integration
+func (s *Service) SearchNotion(userID, query string, limit int) ([]notion.Page, error) {
+	token, err := s.notionToken(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.notion.Search(token, query, limit)
+}
+
+// ReadNotionPage reads a Notion page as Markdown
+func (s *Service) ReadNotionPage(userID, pageID string) (*notion.PageContent, error) {
+	token, err := s.notionToken(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.notion.ReadPage(token, pageID, s.config.MaxPageChars)
+}
+
+// SearchConfluence searches the Confluence pages a user can view,
+// optionally in one space
+func (s *Service) SearchConfluence(userID, query, space string, limit int) ([]confluence.Page, error) {
+	creds, err := s.confluenceCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.confluence.Search(creds, query, space, limit)
+}
+
+// ReadConfluencePage reads a Confluence page as Markdown
+func (s *Service) ReadConfluencePage(userID, pageID string) (*confluence.PageContent, error) {
+	creds, err := s.confluenceCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.confluence.ReadPage(creds, pageID, s.config.MaxPageChars)
+}
+
+func (s *Service) notionToken(userID string) (string, error) {
+	settings, err := s.repo.GetNotionSettings(userID)
+	if err != nil {
+		return "", err
+	}
+	if settings == nil || settings.Token == "" {
+		return "", ErrNotionNotConnected
+	}
+	return settings.Token, nil
+}
+
+func (s *Service) confluenceCredentials(userID string) (confluence.Credentials, error) {
+	settings, err := s.repo.GetConfluenceSettings(userID)
+	if err != nil {
+		return confluence.Credentials{}, err
+	}
+	if settings == nil || settings.Token == "" {
+		return confluence.Credentials{}, ErrConfluenceNotConnected
+	}
+	return confluence.Credentials{
+		BaseURL: settings.BaseURL,
+		Email:   settings.Email,
+		Token:   settings.Token,
+	}, nil
+}
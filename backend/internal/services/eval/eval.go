@@ -0,0 +1,779 @@
+// Package eval benchmarks models on a user's own agent tasks. A suite is a
+// list of cases, each a task prompt and a validation script. Running a suite
+// gives every case to an agent for each chosen provider, model and config,
+// in parallel through the agent pool. The case's script then checks the
+// agent's output in the code runner sandbox. Each attempt's outcome, latency
+// and token use is stored, so targets can be compared by pass rate and speed.
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacklau/prism/internal/agent"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations/github"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/security"
+	"github.com/jacklau/prism/internal/services/coderunner"
+)
+
+const (
+	// maxEnvOutputBytes caps the agent output given to a validation script,
+	// keeping it under the kernel's limit on one environment variable
+	maxEnvOutputBytes = 96 * 1024
+	// maxStoredOutputBytes caps the agent and validation output kept per attempt
+	maxStoredOutputBytes = 32 * 1024
+	// maxValidations is how many validation scripts run at once per run
+	maxValidations = 4
+)
+
+var (
+	// ErrInvalidRequest is returned for requests that can't be served as given
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrNotFound is returned for suites and runs the user doesn't have
+	ErrNotFound = errors.New("not found")
+	// ErrNoAPIKey is returned when a target's provider has no key
+	ErrNoAPIKey = errors.New("API key not configured for provider")
+)
+
+// Config holds configuration for eval runs
+type Config struct {
+	// CaseTimeout bounds each agent attempt at a case
+	CaseTimeout time.Duration
+	// MaxAttempts caps the attempts of a run: cases × targets × repeats
+	MaxAttempts int
+}
+
+// Validation checks an agent's output. The script gets the output in the
+// EVAL_OUTPUT environment variable, with the case, provider and model in
+// EVAL_CASE, EVAL_PROVIDER and EVAL_MODEL, and passes by exiting with 0.
+type Validation struct {
+	Script         string `json:"script" validate:"required,max=65536"`
+	Environment    string `json:"environment,omitempty" validate:"max=20"` // Code runner environment, defaults to shell
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty" validate:"min=0,max=600"`
+}
+
+// Case is one task of a suite
+type Case struct {
+	Name       string     `json:"name" validate:"required,max=100"`
+	Prompt     string     `json:"prompt" validate:"required,max=100000"`
+	Context    string     `json:"context,omitempty" validate:"max=200000"`
+	Validation Validation `json:"validation"`
+}
+
+// SuiteRequest creates or replaces a suite
+type SuiteRequest struct {
+	Name        string `json:"name" validate:"required,max=200"`
+	Description string `json:"description" validate:"max=2000"`
+	Cases       []Case `json:"cases" validate:"required,min=1,max=100"`
+}
+
+// Suite is a benchmark suite
+type Suite struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Cases       []Case    `json:"cases"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Target is a provider, model and agent config to benchmark
+type Target struct {
+	Name         string  `json:"name" validate:"max=100"` // Label in results, defaults to provider/model
+	Provider     string  `json:"provider" validate:"required,max=50"`
+	Model        string  `json:"model" validate:"required,max=100"`
+	SystemPrompt string  `json:"system_prompt,omitempty" validate:"max=20000"`
+	Temperature  float64 `json:"temperature,omitempty" validate:"min=0,max=2"`
+	MaxTokens    int     `json:"max_tokens,omitempty" validate:"min=0,max=200000"`
+	llm.Sampling
+}
+
+// RunRequest starts a run of a suite
+type RunRequest struct {
+	Targets []Target `json:"targets" validate:"required,min=1,max=10"`
+	Repeats int      `json:"repeats" validate:"min=0,max=10"` // Attempts of each case per target, defaults to 1
+}
+
+// Result is the outcome of one attempt at a case by one target
+type Result struct {
+	Case             string    `json:"case"`
+	Target           string    `json:"target"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	Attempt          int       `json:"attempt"`
+	Passed           bool      `json:"passed"`
+	LatencyMs        int64     `json:"latency_ms"`
+	TokensUsed       int       `json:"tokens_used"`
+	Output           string    `json:"output,omitempty"`
+	ValidationOutput string    `json:"validation_output,omitempty"`
+	Error            string    `json:"error,omitempty"`
+	CompletedAt      time.Time `json:"completed_at"`
+}
+
+// TargetSummary sums up a target's results
+type TargetSummary struct {
+	Target       string  `json:"target"`
+	Provider     string  `json:"provider"`
+	Model        string  `json:"model"`
+	Attempts     int     `json:"attempts"`
+	Passed       int     `json:"passed"`
+	PassRate     float64 `json:"pass_rate"`
+	AvgLatencyMs int64   `json:"avg_latency_ms"`
+	P50LatencyMs int64   `json:"p50_latency_ms,omitempty"`
+	P95LatencyMs int64   `json:"p95_latency_ms,omitempty"`
+	AvgTokens    int     `json:"avg_tokens"`
+}
+
+// Run is a run of a suite
+type Run struct {
+	ID          string          `json:"id"`
+	SuiteID     string          `json:"suite_id"`
+	Status      string          `json:"status"` // running, completed, failed or cancelled
+	Targets     []Target        `json:"targets"`
+	Repeats     int             `json:"repeats"`
+	Error       string          `json:"error,omitempty"`
+	StartedAt   time.Time       `json:"started_at"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	Summary     []TargetSummary `json:"summary,omitempty"`
+	Results     []Result        `json:"results,omitempty"`
+}
+
+// Service stores suites and runs them
+type Service struct {
+	agents            *agent.Manager
+	runner            *coderunner.Runner
+	repo              *repository.EvalRepository
+	llmManager        *llm.Manager
+	providerKeyRepo   *repository.ProviderKeyRepository
+	encryptionService *security.EncryptionService
+	config            Config
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc // Runs in progress, by ID
+}
+
+// NewService creates a new eval service
+func NewService(
+	agents *agent.Manager,
+	runner *coderunner.Runner,
+	repo *repository.EvalRepository,
+	llmManager *llm.Manager,
+	providerKeyRepo *repository.ProviderKeyRepository,
+	encryptionService *security.EncryptionService,
+	config Config,
+) *Service {
+	if config.CaseTimeout <= 0 {
+		config.CaseTimeout = 10 * time.Minute
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 200
+	}
+	return &Service{
+		agents:            agents,
+		runner:            runner,
+		repo:              repo,
+		llmManager:        llmManager,
+		providerKeyRepo:   providerKeyRepo,
+		encryptionService: encryptionService,
+		config:            config,
+		running:           make(map[string]context.CancelFunc),
+	}
+}
+
+// Start marks runs interrupted by a previous shutdown as failed
+func (s *Service) Start() {
+	if n, err := s.repo.FailRunningRuns(); err != nil {
+		log.Printf("Failed to recover interrupted eval runs: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted eval runs as failed", n)
+	}
+}
+
+// CreateSuite stores a new suite for a user
+func (s *Service) CreateSuite(userID string, req SuiteRequest) (*Suite, error) {
+	record := &repository.EvalSuite{UserID: userID}
+	if err := fillSuite(record, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateSuite(record); err != nil {
+		return nil, err
+	}
+	return toSuite(record)
+}
+
+// UpdateSuite replaces one of a user's suites. Earlier runs keep their
+// results.
+func (s *Service) UpdateSuite(userID, id string, req SuiteRequest) (*Suite, error) {
+	record, err := s.getSuite(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fillSuite(record, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateSuite(record); err != nil {
+		return nil, err
+	}
+	return toSuite(record)
+}
+
+// GetSuite returns one of a user's suites
+func (s *Service) GetSuite(userID, id string) (*Suite, error) {
+	record, err := s.getSuite(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return toSuite(record)
+}
+
+// ListSuites lists a user's suites
+func (s *Service) ListSuites(userID string) ([]*Suite, error) {
+	records, err := s.repo.ListSuites(userID)
+	if err != nil {
+		return nil, err
+	}
+	suites := make([]*Suite, 0, len(records))
+	for _, record := range records {
+		suite, err := toSuite(record)
+		if err != nil {
+			return nil, err
+		}
+		suites = append(suites, suite)
+	}
+	return suites, nil
+}
+
+// DeleteSuite removes one of a user's suites with its runs, stopping any
+// that are still running
+func (s *Service) DeleteSuite(userID, id string) error {
+	runs, err := s.repo.ListRuns(id)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.repo.DeleteSuite(userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotFound
+	}
+	for _, run := range runs {
+		s.cancel(run.ID)
+	}
+	return nil
+}
+
+// StartRun starts running a suite against the requested targets in the
+// background and returns the running run. Poll GetRun for the results.
+func (s *Service) StartRun(userID, suiteID string, req RunRequest) (*Run, error) {
+	record, err := s.getSuite(userID, suiteID)
+	if err != nil {
+		return nil, err
+	}
+	suite, err := toSuite(record)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Repeats <= 0 {
+		req.Repeats = 1
+	}
+	if attempts := len(suite.Cases) * len(req.Targets) * req.Repeats; attempts > s.config.MaxAttempts {
+		return nil, fmt.Errorf("%w: the run would make %d attempts, more than the limit of %d", ErrInvalidRequest, attempts, s.config.MaxAttempts)
+	}
+	names := make(map[string]bool)
+	creds := make(map[string]*llm.Credentials)
+	for i := range req.Targets {
+		target := &req.Targets[i]
+		if target.Name == "" {
+			target.Name = target.Provider + "/" + target.Model
+		}
+		if names[target.Name] {
+			return nil, fmt.Errorf("%w: target name %q is used twice", ErrInvalidRequest, target.Name)
+		}
+		names[target.Name] = true
+
+		if _, ok := creds[target.Provider]; !ok {
+			creds[target.Provider] = s.llmManager.UserCredentials(s.providerKeyRepo, s.encryptionService, userID, target.Provider)
+		}
+		if !s.llmManager.CanUse(target.Provider, creds[target.Provider]) {
+			return nil, fmt.Errorf("%w: %s", ErrNoAPIKey, target.Provider)
+		}
+	}
+
+	targetsJSON, err := json.Marshal(req.Targets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode targets: %w", err)
+	}
+	run := &repository.EvalRun{
+		SuiteID: suiteID,
+		UserID:  userID,
+		Targets: string(targetsJSON),
+		Repeats: req.Repeats,
+	}
+	if err := s.repo.CreateRun(run); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.running[run.ID] = cancel
+	s.mu.Unlock()
+
+	go func() {
+		defer s.cancel(run.ID)
+		s.run(ctx, suite, run, req.Targets, creds)
+	}()
+	return &Run{
+		ID:        run.ID,
+		SuiteID:   run.SuiteID,
+		Status:    run.Status,
+		Targets:   req.Targets,
+		Repeats:   run.Repeats,
+		StartedAt: run.StartedAt,
+	}, nil
+}
+
+// GetRun returns one of a user's runs with its results so far and a summary
+// of each target's
+func (s *Service) GetRun(userID, id string) (*Run, error) {
+	record, err := s.repo.GetRun(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrNotFound
+	}
+	run, err := toRun(record)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := s.repo.ListResults(id)
+	if err != nil {
+		return nil, err
+	}
+	run.Results = make([]Result, 0, len(records))
+	for _, r := range records {
+		run.Results = append(run.Results, Result{
+			Case:             r.CaseName,
+			Target:           r.Target,
+			Provider:         r.Provider,
+			Model:            r.Model,
+			Attempt:          r.Attempt,
+			Passed:           r.Passed,
+			LatencyMs:        r.LatencyMs,
+			TokensUsed:       r.TokensUsed,
+			Output:           r.Output,
+			ValidationOutput: r.ValidationOutput,
+			Error:            r.Error,
+			CompletedAt:      r.CreatedAt,
+		})
+	}
+	run.Summary = summarize(run.Targets, run.Results)
+	return run, nil
+}
+
+// ListRuns lists the runs of one of a user's suites, without their results
+func (s *Service) ListRuns(userID, suiteID string) ([]*Run, error) {
+	if _, err := s.getSuite(userID, suiteID); err != nil {
+		return nil, err
+	}
+	records, err := s.repo.ListRuns(suiteID)
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]*Run, 0, len(records))
+	for _, record := range records {
+		run, err := toRun(record)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// StopRun cancels one of a user's runs. Attempts already finished keep
+// their results.
+func (s *Service) StopRun(userID, id string) (bool, error) {
+	record, err := s.repo.GetRun(userID, id)
+	if err != nil {
+		return false, err
+	}
+	if record == nil {
+		return false, ErrNotFound
+	}
+	return s.cancel(id), nil
+}
+
+// Stats summarizes every run of one of a user's suites by target, with the
+// best pass rate first and faster targets first among equals
+func (s *Service) Stats(userID, suiteID string) ([]TargetSummary, error) {
+	if _, err := s.getSuite(userID, suiteID); err != nil {
+		return nil, err
+	}
+	stats, err := s.repo.SuiteStats(suiteID)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]TargetSummary, 0, len(stats))
+	for _, stat := range stats {
+		summary := TargetSummary{
+			Target:       stat.Target,
+			Provider:     stat.Provider,
+			Model:        stat.Model,
+			Attempts:     stat.Attempts,
+			Passed:       stat.Passed,
+			AvgLatencyMs: int64(stat.AvgLatencyMs),
+			AvgTokens:    int(stat.AvgTokens),
+		}
+		if stat.Attempts > 0 {
+			summary.PassRate = float64(stat.Passed) / float64(stat.Attempts)
+		}
+		summaries = append(summaries, summary)
+	}
+	sortSummaries(summaries)
+	return summaries, nil
+}
+
+// attempt identifies the case and target of an agent task
+type attempt struct {
+	caseIndex int
+	target    Target
+	number    int
+}
+
+// run gives each case to each target's agents, using the run owner's
+// credentials for the target's provider, and validates their outputs
+func (s *Service) run(ctx context.Context, suite *Suite, record *repository.EvalRun, targets []Target, creds map[string]*llm.Credentials) {
+	attempts := make(map[string]attempt)
+	var executions []*agent.Execution
+	var startErr error
+	for _, target := range targets {
+		var tasks []*agent.Task
+		for i, c := range suite.Cases {
+			for n := 1; n <= record.Repeats; n++ {
+				task := agent.NewTask(c.Prompt,
+					agent.WithContext(c.Context),
+					agent.WithTimeout(s.config.CaseTimeout),
+				)
+				attempts[task.ID] = attempt{caseIndex: i, target: target, number: n}
+				tasks = append(tasks, task)
+			}
+		}
+
+		execution, err := s.agents.RunParallel(ctx, tasks, agent.AgentConfig{
+			Name:         "eval-" + target.Name,
+			Provider:     target.Provider,
+			Model:        target.Model,
+			SystemPrompt: target.SystemPrompt,
+			Temperature:  target.Temperature,
+			MaxTokens:    target.MaxTokens,
+			Sampling:     target.Sampling,
+			Credentials:  creds[target.Provider],
+		})
+		if err != nil {
+			startErr = fmt.Errorf("failed to start agents for %s: %w", target.Name, err)
+			break
+		}
+		executions = append(executions, execution)
+	}
+
+	// Stopping the run cancels the agents still queued or running
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			for _, execution := range executions {
+				_ = s.agents.CancelExecution(execution.ID)
+			}
+		case <-done:
+		}
+	}()
+	if startErr != nil {
+		for _, execution := range executions {
+			_ = s.agents.CancelExecution(execution.ID)
+		}
+	}
+
+	validations := make(chan struct{}, maxValidations)
+	var wg sync.WaitGroup
+	for _, execution := range executions {
+		execution.Wait()
+		for _, result := range execution.GetResults() {
+			a, ok := attempts[result.TaskID]
+			if !ok {
+				continue
+			}
+			delete(attempts, result.TaskID)
+			wg.Add(1)
+			go func(a attempt, result *agent.AgentResult) {
+				defer wg.Done()
+				validations <- struct{}{}
+				defer func() { <-validations }()
+				s.record(ctx, record.ID, suite.Cases[a.caseIndex], a, result)
+			}(a, result)
+		}
+	}
+	wg.Wait()
+
+	switch {
+	case startErr != nil:
+		record.Status = repository.EvalRunFailed
+		record.Error = startErr.Error()
+	case ctx.Err() != nil:
+		record.Status = repository.EvalRunCancelled
+	default:
+		record.Status = repository.EvalRunCompleted
+		// Attempts whose agents never reported, such as ones cut short by
+		// shutdown, count as failures
+		for _, a := range attempts {
+			s.save(&repository.EvalResult{
+				RunID:    record.ID,
+				CaseName: suite.Cases[a.caseIndex].Name,
+				Target:   a.target.Name,
+				Provider: a.target.Provider,
+				Model:    a.target.Model,
+				Attempt:  a.number,
+				Error:    "agent did not finish",
+			})
+		}
+	}
+	if err := s.repo.FinishRun(record); err != nil {
+		log.Printf("Failed to finish eval run %s: %v", record.ID, err)
+	}
+	log.Printf("Eval run %s of suite %s %s", record.ID, suite.ID, record.Status)
+}
+
+// record validates an agent's output and stores the attempt's outcome.
+// Attempts cancelled with the run aren't stored.
+func (s *Service) record(ctx context.Context, runID string, c Case, a attempt, result *agent.AgentResult) {
+	cancelled := result.Status == agent.AgentStatusCancelled || result.Status == agent.AgentStatusCancelledBeforeStart
+	if cancelled && ctx.Err() != nil {
+		return
+	}
+
+	outcome := &repository.EvalResult{
+		RunID:      runID,
+		CaseName:   c.Name,
+		Target:     a.target.Name,
+		Provider:   a.target.Provider,
+		Model:      a.target.Model,
+		Attempt:    a.number,
+		LatencyMs:  result.Duration.Milliseconds(),
+		TokensUsed: result.TokensUsed,
+		Output:     truncate(result.Output, maxStoredOutputBytes),
+	}
+	if !result.Success {
+		outcome.Error = result.Error
+		if outcome.Error == "" {
+			outcome.Error = "agent " + string(result.Status)
+		}
+		s.save(outcome)
+		return
+	}
+
+	passed, validationOutput, err := s.validate(c, a.target, result.Output)
+	outcome.Passed = passed
+	outcome.ValidationOutput = truncate(validationOutput, maxStoredOutputBytes)
+	if err != nil {
+		outcome.Error = "validation did not run: " + err.Error()
+	}
+	s.save(outcome)
+}
+
+// validate runs a case's validation script over an agent's output
+func (s *Service) validate(c Case, target Target, output string) (bool, string, error) {
+	environment := c.Validation.Environment
+	if environment == "" {
+		environment = "shell"
+	}
+	env := map[string]string{
+		"EVAL_OUTPUT":   truncate(output, maxEnvOutputBytes),
+		"EVAL_CASE":     c.Name,
+		"EVAL_PROVIDER": target.Provider,
+		"EVAL_MODEL":    target.Model,
+	}
+	if len(output) > maxEnvOutputBytes {
+		env["EVAL_OUTPUT_TRUNCATED"] = "1"
+	}
+
+	result, err := s.runner.Run(&github.CodeRunRequest{
+		Command:     c.Validation.Script,
+		Environment: environment,
+		EnvVars:     env,
+		Timeout:     c.Validation.TimeoutSeconds,
+	})
+	if err != nil {
+		return false, "", err
+	}
+	validationOutput := strings.TrimSpace(result.Stdout + "\n" + result.Stderr)
+	return result.ExitCode == 0, validationOutput, nil
+}
+
+// save stores an attempt's outcome
+func (s *Service) save(result *repository.EvalResult) {
+	if err := s.repo.AddResult(result); err != nil {
+		log.Printf("Failed to save eval result for %s: %v", result.CaseName, err)
+	}
+}
+
+// cancel stops a run in progress, reporting whether it was running
+func (s *Service) cancel(id string) bool {
+	s.mu.Lock()
+	cancel, ok := s.running[id]
+	delete(s.running, id)
+	s.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// getSuite returns one of a user's suites or ErrNotFound
+func (s *Service) getSuite(userID, id string) (*repository.EvalSuite, error) {
+	record, err := s.repo.GetSuite(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+// fillSuite sets a suite record from a request
+func fillSuite(record *repository.EvalSuite, req SuiteRequest) error {
+	names := make(map[string]bool)
+	for _, c := range req.Cases {
+		if names[c.Name] {
+			return fmt.Errorf("%w: case name %q is used twice", ErrInvalidRequest, c.Name)
+		}
+		names[c.Name] = true
+	}
+	casesJSON, err := json.Marshal(req.Cases)
+	if err != nil {
+		return fmt.Errorf("failed to encode cases: %w", err)
+	}
+	record.Name = req.Name
+	record.Description = req.Description
+	record.Cases = string(casesJSON)
+	return nil
+}
+
+// toSuite converts a suite record for the API
+func toSuite(record *repository.EvalSuite) (*Suite, error) {
+	suite := &Suite{
+		ID:          record.ID,
+		Name:        record.Name,
+		Description: record.Description,
+		CreatedAt:   record.CreatedAt,
+		UpdatedAt:   record.UpdatedAt,
+	}
+	if err := json.Unmarshal([]byte(record.Cases), &suite.Cases); err != nil {
+		return nil, fmt.Errorf("failed to decode cases: %w", err)
+	}
+	return suite, nil
+}
+
+// toRun converts a run record for the API
+func toRun(record *repository.EvalRun) (*Run, error) {
+	run := &Run{
+		ID:          record.ID,
+		SuiteID:     record.SuiteID,
+		Status:      record.Status,
+		Repeats:     record.Repeats,
+		Error:       record.Error,
+		StartedAt:   record.StartedAt,
+		CompletedAt: record.CompletedAt,
+	}
+	if err := json.Unmarshal([]byte(record.Targets), &run.Targets); err != nil {
+		return nil, fmt.Errorf("failed to decode targets: %w", err)
+	}
+	return run, nil
+}
+
+// summarize sums up each target's results, in the order of the run's
+// targets
+func summarize(targets []Target, results []Result) []TargetSummary {
+	latencies := make(map[string][]int64)
+	summaries := make(map[string]*TargetSummary)
+	for _, target := range targets {
+		summaries[target.Name] = &TargetSummary{Target: target.Name, Provider: target.Provider, Model: target.Model}
+	}
+	tokens := make(map[string]int)
+	for _, result := range results {
+		summary, ok := summaries[result.Target]
+		if !ok {
+			continue
+		}
+		summary.Attempts++
+		if result.Passed {
+			summary.Passed++
+		}
+		latencies[result.Target] = append(latencies[result.Target], result.LatencyMs)
+		tokens[result.Target] += result.TokensUsed
+	}
+
+	list := make([]TargetSummary, 0, len(targets))
+	for _, target := range targets {
+		summary := summaries[target.Name]
+		if summary.Attempts > 0 {
+			summary.PassRate = float64(summary.Passed) / float64(summary.Attempts)
+			summary.AvgTokens = tokens[target.Name] / summary.Attempts
+
+			values := latencies[target.Name]
+			sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+			var total int64
+			for _, value := range values {
+				total += value
+			}
+			summary.AvgLatencyMs = total / int64(len(values))
+			summary.P50LatencyMs = percentile(values, 50)
+			summary.P95LatencyMs = percentile(values, 95)
+		}
+		list = append(list, *summary)
+	}
+	return list
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// sortSummaries orders targets by pass rate, then by latency
+func sortSummaries(summaries []TargetSummary) {
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if summaries[i].PassRate != summaries[j].PassRate {
+			return summaries[i].PassRate > summaries[j].PassRate
+		}
+		return summaries[i].AvgLatencyMs < summaries[j].AvgLatencyMs
+	})
+}
+
+// truncate cuts s to at most n bytes, marking the cut
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "\n[truncated]"
+}
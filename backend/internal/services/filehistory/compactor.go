@@ -0,0 +1,170 @@
+// Package filehistory compacts stored file history: it moves content saved
+// before dedup into shared blobs, encrypts content saved before encryption
+// was turned on, enforces per-user size caps and deletes content nothing
+// refers to any more.
+package filehistory
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jacklau/prism/internal/database/repository"
+)
+
+// batchSize is how many entries or blobs are rewritten per query
+const batchSize = 200
+
+// ErrCompactionRunning is returned when a compaction is already in progress
+var ErrCompactionRunning = errors.New("a file history compaction is already running")
+
+// Config holds configuration for file history compaction
+type Config struct {
+	// MaxBytesPerUser is the cap each user's history is pruned to; 0 means
+	// no cap
+	MaxBytesPerUser int64
+
+	// Interval is how often compaction runs in the background; 0 means it
+	// only runs when asked
+	Interval time.Duration
+}
+
+// Report describes what a compaction did
+type Report struct {
+	EntriesMoved     int   `json:"entries_moved"`   // Inline contents moved into blobs
+	BlobsEncrypted   int   `json:"blobs_encrypted"` // Plaintext blobs encrypted
+	UsersPruned      int   `json:"users_pruned"`    // Users over their cap
+	EntriesPruned    int   `json:"entries_pruned"`  // Entries deleted to fit caps
+	BlobsDeleted     int64 `json:"blobs_deleted"`   // Contents no entry referred to
+	StoredBytesSaved int64 `json:"stored_bytes_saved"`
+	DurationMs       int64 `json:"duration_ms"`
+}
+
+// Compactor compacts file history, on a schedule or on demand
+type Compactor struct {
+	repo   *repository.FileHistoryRepository
+	config Config
+
+	mu sync.Mutex // Held while compacting
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewCompactor creates a file history compactor
+func NewCompactor(repo *repository.FileHistoryRepository, config Config) *Compactor {
+	return &Compactor{
+		repo:   repo,
+		config: config,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start begins compacting in the background every Interval
+func (c *Compactor) Start() {
+	if c.config.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stopCh:
+				return
+			case <-ticker.C:
+				report, err := c.Compact()
+				if err != nil {
+					if !errors.Is(err, ErrCompactionRunning) {
+						log.Printf("File history compaction failed: %v", err)
+					}
+					continue
+				}
+				log.Printf("Compacted file history: %d entries moved, %d pruned, %d blobs deleted, %d bytes saved",
+					report.EntriesMoved, report.EntriesPruned, report.BlobsDeleted, report.StoredBytesSaved)
+			}
+		}
+	}()
+}
+
+// Stop stops compacting in the background
+func (c *Compactor) Stop() {
+	c.stopOnce.Do(func() { close(c.stopCh) })
+}
+
+// Stats summarizes file history storage
+func (c *Compactor) Stats() (*repository.FileHistoryStats, error) {
+	return c.repo.Stats()
+}
+
+// Compact runs one compaction. Returns ErrCompactionRunning if one is
+// already in progress.
+func (c *Compactor) Compact() (*Report, error) {
+	if !c.mu.TryLock() {
+		return nil, ErrCompactionRunning
+	}
+	defer c.mu.Unlock()
+
+	start := time.Now()
+	report := &Report{}
+
+	before, err := c.repo.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		moved, err := c.repo.MoveInlineContent(batchSize)
+		report.EntriesMoved += moved
+		if err != nil {
+			return nil, err
+		}
+		if moved < batchSize {
+			break
+		}
+	}
+
+	for {
+		encrypted, err := c.repo.EncryptPlainBlobs(batchSize)
+		report.BlobsEncrypted += encrypted
+		if err != nil {
+			return nil, err
+		}
+		if encrypted < batchSize {
+			break
+		}
+	}
+
+	if c.config.MaxBytesPerUser > 0 {
+		userIDs, err := c.repo.ListUserIDs()
+		if err != nil {
+			return nil, err
+		}
+		for _, userID := range userIDs {
+			pruned, err := c.repo.PruneUser(userID, c.config.MaxBytesPerUser, "")
+			if err != nil {
+				return nil, err
+			}
+			if pruned > 0 {
+				report.UsersPruned++
+				report.EntriesPruned += pruned
+			}
+		}
+	}
+
+	if report.BlobsDeleted, err = c.repo.DeleteOrphanedBlobs(); err != nil {
+		return nil, err
+	}
+
+	after, err := c.repo.Stats()
+	if err != nil {
+		return nil, err
+	}
+	report.StoredBytesSaved = before.StoredBytes - after.StoredBytes
+	report.DurationMs = time.Since(start).Milliseconds()
+
+	return report, nil
+}
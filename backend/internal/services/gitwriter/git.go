@@ -0,0 +1,202 @@
+package gitwriter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// gitTimeout bounds a single git command
+	gitTimeout = 30 * time.Second
+
+	// emptyTree is git's hash of the empty tree, the base of the changes in
+	// a repository without commits
+	emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+)
+
+// ChangedFile is a file in a set of changes
+type ChangedFile struct {
+	Path      string `json:"path"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary,omitempty"`
+	Untracked bool   `json:"untracked,omitempty"`
+}
+
+// Commit is a commit in a changelog's range
+type Commit struct {
+	SHA     string `json:"sha"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+	Body    string `json:"-"`
+}
+
+// runGit runs a git command in dir and returns its output
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-c", "core.quotepath=false"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_PAGER=cat")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// exitCode returns the exit code of a failed git command, or -1 if it didn't
+// run to completion
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// headOrEmptyTree returns HEAD, or the empty tree if the repository has no
+// commits yet
+func headOrEmptyTree(ctx context.Context, dir string) string {
+	if _, err := runGit(ctx, dir, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		return emptyTree
+	}
+	return "HEAD"
+}
+
+// hasStagedChanges reports whether the index differs from HEAD
+func hasStagedChanges(ctx context.Context, dir string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", "diff", "--cached", "--quiet", "--no-ext-diff")
+	cmd.Dir = dir
+	err := cmd.Run()
+	switch {
+	case err == nil:
+		return false, nil
+	case exitCode(err) == 1:
+		return true, nil
+	default:
+		return false, fmt.Errorf("git diff: %w", err)
+	}
+}
+
+// diffArgs returns the git diff arguments selecting staged changes, or every
+// change in the working tree against base
+func diffArgs(staged bool, base string) []string {
+	if staged {
+		return []string{"diff", "--cached", "--no-ext-diff", "--no-color"}
+	}
+	return []string{"diff", base, "--no-ext-diff", "--no-color"}
+}
+
+// changedFiles lists the files in a diff with their line counts
+func changedFiles(ctx context.Context, dir string, args []string) ([]ChangedFile, error) {
+	out, err := runGit(ctx, dir, append(args, "--numstat")...)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []ChangedFile
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		file := ChangedFile{Path: fields[2]}
+		if fields[0] == "-" {
+			file.Binary = true
+		} else {
+			file.Additions, _ = strconv.Atoi(fields[0])
+			file.Deletions, _ = strconv.Atoi(fields[1])
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// untrackedFiles lists files git doesn't track yet and doesn't ignore
+func untrackedFiles(ctx context.Context, dir string) ([]string, error) {
+	out, err := runGit(ctx, dir, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// validRef reports whether a ref is safe to pass to git: it can't be read as
+// an option or a range
+func validRef(ref string) bool {
+	return ref != "" && len(ref) <= 256 && !strings.HasPrefix(ref, "-") &&
+		!strings.Contains(ref, "..") && !strings.ContainsAny(ref, " \t\n\x00")
+}
+
+// resolveCommit resolves a ref to a commit hash
+func resolveCommit(ctx context.Context, dir, ref string) (string, error) {
+	out, err := runGit(ctx, dir, "rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// previousTag returns the latest tag before a commit, or "" if there is none
+func previousTag(ctx context.Context, dir, commit string) string {
+	out, err := runGit(ctx, dir, "describe", "--tags", "--abbrev=0", commit+"^")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// listCommits lists up to limit non-merge commits reachable from to but not
+// from from, newest first; with no from, every commit up to to. It reports
+// whether there were more.
+func listCommits(ctx context.Context, dir, from, to string, limit int) ([]Commit, bool, error) {
+	rangeArg := to
+	if from != "" {
+		rangeArg = from + ".." + to
+	}
+	out, err := runGit(ctx, dir, "log", "--no-merges", "--date=short",
+		"--format=%H%x1f%an%x1f%ad%x1f%s%x1f%b%x1e", "-n", strconv.Itoa(limit+1), rangeArg, "--")
+	if err != nil {
+		return nil, false, err
+	}
+
+	var commits []Commit
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimLeft(record, "\n"), "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+		commits = append(commits, Commit{
+			SHA:     fields[0],
+			Author:  fields[1],
+			Date:    fields[2],
+			Subject: fields[3],
+			Body:    strings.TrimSpace(fields[4]),
+		})
+	}
+	if len(commits) > limit {
+		return commits[:limit], true, nil
+	}
+	return commits, false, nil
+}
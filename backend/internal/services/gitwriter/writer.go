@@ -0,0 +1,456 @@
+// Package gitwriter writes git prose with an LLM: conventional commit
+// messages for the changes in a workspace repository, and changelogs of the
+// commits between two refs.
+package gitwriter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/security"
+)
+
+const (
+	// maxDiffChars limits how much of a diff is sent to the model; the file
+	// list always covers every change
+	maxDiffChars = 48000
+	// maxListedUntracked caps the untracked files named to the model
+	maxListedUntracked = 50
+	// maxChangelogCommits caps the commits a changelog covers
+	maxChangelogCommits = 500
+	// maxCommitBodyChars limits how much of each commit's body is sent
+	maxCommitBodyChars = 500
+
+	// generateTimeout bounds a single generation call
+	generateTimeout = 2 * time.Minute
+)
+
+const commitPrompt = `Write a git commit message for the changes below in the Conventional Commits format.
+
+The subject line is "type(scope): summary", where type is one of feat, fix, docs, style, refactor, perf, test, build, ci, chore or revert; scope is optional and names the area changed; and the summary is in the imperative mood, lowercase, without a trailing period, keeping the whole line under 72 characters. Add "!" after the type or scope for a breaking change.
+
+If the change needs explaining, follow the subject with a blank line and a body wrapped at 72 columns saying what changed and why, not how. Describe a breaking change in a "BREAKING CHANGE:" footer.
+
+Reply with the commit message only, with no code fence or commentary.`
+
+const changelogPrompt = `Write a changelog in Markdown for the commits below, for the people who use the project.
+
+Group the changes under "### Breaking Changes", "### Features", "### Fixes", "### Performance" and "### Other" headings, in that order, leaving out empty groups. Write one bullet per change users would notice, merging commits that make up one change, and leave out commits that only touch tests, CI, formatting or internal refactoring unless nothing else changed.
+
+Reply with the changelog only, without a title, code fence or commentary.`
+
+var (
+	// ErrInvalidRequest is returned for requests that can't be served as given
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrNotRepository is returned when the directory isn't in a git repository
+	ErrNotRepository = errors.New("not a git repository")
+	// ErrNoChanges is returned when there is nothing to commit
+	ErrNoChanges = errors.New("no changes to commit")
+	// ErrNoCommits is returned when a changelog's range has no commits
+	ErrNoCommits = errors.New("no commits in range")
+	// ErrNoAPIKey is returned when the chosen provider has no key
+	ErrNoAPIKey = errors.New("API key not configured for provider")
+)
+
+// conventionalSubject matches a Conventional Commits subject line
+var conventionalSubject = regexp.MustCompile(`^(feat|fix|docs|style|refactor|perf|test|build|ci|chore|revert)(\(([^)]+)\))?(!)?: \S`)
+
+// Change sources for a commit message
+const (
+	SourceStaged  = "staged"
+	SourceWorking = "working"
+)
+
+// Config holds configuration for the writer
+type Config struct {
+	// Provider and Model write for requests that don't choose a model
+	Provider string
+	Model    string
+}
+
+// CommitRequest asks for a commit message
+type CommitRequest struct {
+	Dir string `json:"dir" validate:"max=1024"` // Repository directory within the workspace, defaults to its root
+	// Source is "staged" for the staged changes or "working" for every
+	// change in the working tree; by default the staged changes if there
+	// are any, otherwise the working tree
+	Source   string `json:"source" validate:"oneof=staged working"`
+	Hint     string `json:"hint" validate:"max=2000"` // What the change is for, in the user's words
+	Provider string `json:"provider" validate:"max=50"`
+	Model    string `json:"model" validate:"max=100"`
+}
+
+// CommitSuggestion is a suggested commit message
+type CommitSuggestion struct {
+	Message      string        `json:"message"`
+	Subject      string        `json:"subject"`
+	Body         string        `json:"body,omitempty"`
+	Type         string        `json:"type,omitempty"`
+	Scope        string        `json:"scope,omitempty"`
+	Breaking     bool          `json:"breaking"`
+	Conventional bool          `json:"conventional"` // The subject follows Conventional Commits
+	Source       string        `json:"source"`
+	Files        []ChangedFile `json:"files"`
+	Truncated    bool          `json:"truncated"` // The diff was cut short for the model
+	Provider     string        `json:"provider"`
+	Model        string        `json:"model"`
+}
+
+// ChangelogRequest asks for a changelog
+type ChangelogRequest struct {
+	Dir string `json:"dir" validate:"max=1024"` // Repository directory within the workspace, defaults to its root
+	// From is the ref the changelog starts after; by default the latest tag
+	// before To, or the start of history if there is none
+	From     string `json:"from" validate:"max=256"`
+	To       string `json:"to" validate:"max=256"` // Defaults to HEAD
+	Provider string `json:"provider" validate:"max=50"`
+	Model    string `json:"model" validate:"max=100"`
+}
+
+// Changelog is a generated changelog
+type Changelog struct {
+	From      string   `json:"from,omitempty"` // "" for the start of history
+	To        string   `json:"to"`
+	Commits   []Commit `json:"commits"`
+	Changelog string   `json:"changelog"`
+	Truncated bool     `json:"truncated"` // The range had more commits than were covered
+	Provider  string   `json:"provider"`
+	Model     string   `json:"model"`
+}
+
+// Writer writes commit messages and changelogs
+type Writer struct {
+	sandboxService    *sandbox.Service
+	llmManager        *llm.Manager
+	providerKeyRepo   *repository.ProviderKeyRepository
+	encryptionService *security.EncryptionService
+	config            Config
+}
+
+// NewWriter creates a new writer
+func NewWriter(
+	sandboxService *sandbox.Service,
+	llmManager *llm.Manager,
+	providerKeyRepo *repository.ProviderKeyRepository,
+	encryptionService *security.EncryptionService,
+	config Config,
+) *Writer {
+	return &Writer{
+		sandboxService:    sandboxService,
+		llmManager:        llmManager,
+		providerKeyRepo:   providerKeyRepo,
+		encryptionService: encryptionService,
+		config:            config,
+	}
+}
+
+// SuggestCommit writes a commit message for the changes in a workspace
+// repository
+func (w *Writer) SuggestCommit(ctx context.Context, userID string, req CommitRequest) (*CommitSuggestion, error) {
+	dir, err := w.repoDir(ctx, userID, req.Dir)
+	if err != nil {
+		return nil, err
+	}
+	source := req.Source
+	if source == "" {
+		staged, err := hasStagedChanges(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		source = SourceWorking
+		if staged {
+			source = SourceStaged
+		}
+	}
+
+	args := diffArgs(source == SourceStaged, headOrEmptyTree(ctx, dir))
+	files, err := changedFiles(ctx, dir, args)
+	if err != nil {
+		return nil, err
+	}
+	if source == SourceWorking {
+		untracked, err := untrackedFiles(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range untracked {
+			files = append(files, ChangedFile{Path: path, Untracked: true})
+		}
+	}
+	if len(files) == 0 {
+		return nil, ErrNoChanges
+	}
+
+	ctx, provider, model, err := w.model(ctx, userID, req.Provider, req.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := runGit(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	truncated := false
+	if len(diff) > maxDiffChars {
+		diff = diff[:maxDiffChars]
+		truncated = true
+	}
+
+	message, err := w.generate(ctx, provider, model, commitPrompt, commitInput(req.Hint, files, diff, truncated), 600)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestion := parseCommitMessage(cleanOutput(message))
+	if suggestion.Subject == "" {
+		return nil, fmt.Errorf("model returned an empty commit message")
+	}
+	suggestion.Source = source
+	suggestion.Files = files
+	suggestion.Truncated = truncated
+	suggestion.Provider = provider
+	suggestion.Model = model
+	return suggestion, nil
+}
+
+// Changelog writes a changelog of the commits between two refs of a
+// workspace repository
+func (w *Writer) Changelog(ctx context.Context, userID string, req ChangelogRequest) (*Changelog, error) {
+	to := req.To
+	if to == "" {
+		to = "HEAD"
+	}
+	for _, ref := range []string{req.From, to} {
+		if ref != "" && !validRef(ref) {
+			return nil, fmt.Errorf("%w: invalid ref %q", ErrInvalidRequest, ref)
+		}
+	}
+
+	dir, err := w.repoDir(ctx, userID, req.Dir)
+	if err != nil {
+		return nil, err
+	}
+	toCommit, err := resolveCommit(ctx, dir, to)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown ref %q", ErrInvalidRequest, to)
+	}
+	from := req.From
+	if from == "" {
+		from = previousTag(ctx, dir, toCommit)
+	}
+	var fromCommit string
+	if from != "" {
+		if fromCommit, err = resolveCommit(ctx, dir, from); err != nil {
+			return nil, fmt.Errorf("%w: unknown ref %q", ErrInvalidRequest, from)
+		}
+	}
+
+	commits, truncated, err := listCommits(ctx, dir, fromCommit, toCommit, maxChangelogCommits)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, ErrNoCommits
+	}
+
+	ctx, provider, model, err := w.model(ctx, userID, req.Provider, req.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	changelog, err := w.generate(ctx, provider, model, changelogPrompt, changelogInput(commits, truncated), 2000)
+	if err != nil {
+		return nil, err
+	}
+	changelog = cleanOutput(changelog)
+	if changelog == "" {
+		return nil, fmt.Errorf("model returned an empty changelog")
+	}
+
+	return &Changelog{
+		From:      from,
+		To:        to,
+		Commits:   commits,
+		Changelog: changelog,
+		Truncated: truncated,
+		Provider:  provider,
+		Model:     model,
+	}, nil
+}
+
+// repoDir resolves a directory within the user's workspace and checks that
+// it is in a git repository
+func (w *Writer) repoDir(ctx context.Context, userID, path string) (string, error) {
+	root, rel, err := w.sandboxService.ResolveRoot(userID, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get workspace: %w", err)
+	}
+	dir := root.Path
+	if rel != "" {
+		cleanPath := filepath.Clean(rel)
+		if strings.HasPrefix(cleanPath, "..") || filepath.IsAbs(cleanPath) {
+			return "", fmt.Errorf("%w: dir must be a relative path within the workspace", ErrInvalidRequest)
+		}
+		dir = filepath.Join(root.Path, cleanPath)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%w: directory not found: %s", ErrInvalidRequest, path)
+	}
+
+	if _, err := runGit(ctx, dir, "rev-parse", "--show-toplevel"); err != nil {
+		return "", ErrNotRepository
+	}
+	return dir, nil
+}
+
+// model picks the provider and model to write with, and returns ctx carrying
+// the user's key for it
+func (w *Writer) model(ctx context.Context, userID, provider, model string) (context.Context, string, string, error) {
+	if model == "" {
+		provider, model = w.config.Provider, w.config.Model
+	} else if provider == "" {
+		provider = w.config.Provider
+	}
+	if provider == "" || model == "" {
+		return nil, "", "", fmt.Errorf("%w: provider and model are required", ErrInvalidRequest)
+	}
+
+	creds := w.llmManager.UserCredentials(w.providerKeyRepo, w.encryptionService, userID, provider)
+	if !w.llmManager.CanUse(provider, creds) {
+		return nil, "", "", fmt.Errorf("%w: %s", ErrNoAPIKey, provider)
+	}
+	return llm.WithCredentials(ctx, creds), provider, model, nil
+}
+
+// generate makes one LLM call and returns its text
+func (w *Writer) generate(ctx context.Context, provider, model, systemPrompt, input string, maxTokens int) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, generateTimeout)
+	defer cancel()
+
+	stream, err := w.llmManager.Chat(ctx, provider, &llm.ChatRequest{
+		Model: model,
+		Messages: []llm.Message{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: input},
+		},
+		Temperature: 0.2,
+		MaxTokens:   maxTokens,
+		Stream:      true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate: %w", err)
+	}
+
+	var response strings.Builder
+	for chunk := range stream {
+		if chunk.Error != nil {
+			return "", fmt.Errorf("failed to generate: %w", chunk.Error)
+		}
+		response.WriteString(chunk.Delta)
+	}
+	return response.String(), nil
+}
+
+// commitInput renders the changes a commit message is written for
+func commitInput(hint string, files []ChangedFile, diff string, truncated bool) string {
+	var b strings.Builder
+	if hint = strings.TrimSpace(hint); hint != "" {
+		fmt.Fprintf(&b, "What the change is for: %s\n\n", hint)
+	}
+
+	b.WriteString("Files changed:\n")
+	untracked := 0
+	for _, file := range files {
+		switch {
+		case file.Untracked:
+			untracked++
+			if untracked <= maxListedUntracked {
+				fmt.Fprintf(&b, "- %s (new, untracked)\n", file.Path)
+			}
+		case file.Binary:
+			fmt.Fprintf(&b, "- %s (binary)\n", file.Path)
+		default:
+			fmt.Fprintf(&b, "- %s (+%d -%d)\n", file.Path, file.Additions, file.Deletions)
+		}
+	}
+	if untracked > maxListedUntracked {
+		fmt.Fprintf(&b, "- and %d more new files\n", untracked-maxListedUntracked)
+	}
+
+	if strings.TrimSpace(diff) != "" {
+		fmt.Fprintf(&b, "\nDiff:\n```diff\n%s\n```\n", diff)
+	}
+	if truncated {
+		b.WriteString("The diff was cut short; the file list covers every change.\n")
+	}
+	return b.String()
+}
+
+// changelogInput renders the commits a changelog is written for
+func changelogInput(commits []Commit, truncated bool) string {
+	var b strings.Builder
+	b.WriteString("Commits, newest first:\n")
+	for _, commit := range commits {
+		fmt.Fprintf(&b, "\n- %s %s", commit.SHA[:min(7, len(commit.SHA))], commit.Subject)
+		if body := commit.Body; body != "" {
+			if len(body) > maxCommitBodyChars {
+				body = body[:maxCommitBodyChars] + "…"
+			}
+			fmt.Fprintf(&b, "\n  %s", strings.ReplaceAll(body, "\n", "\n  "))
+		}
+	}
+	if truncated {
+		fmt.Fprintf(&b, "\n\nOnly the latest %d commits are listed.", len(commits))
+	}
+	return b.String()
+}
+
+// cleanOutput strips a code fence or quotes a model wrapped its reply in
+func cleanOutput(raw string) string {
+	text := strings.TrimSpace(raw)
+	if strings.HasPrefix(text, "```") {
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		} else {
+			text = ""
+		}
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+	return strings.TrimSpace(strings.Trim(strings.TrimSpace(text), "\"'"))
+}
+
+// parseCommitMessage splits a commit message into its parts
+func parseCommitMessage(message string) *CommitSuggestion {
+	subject, body, _ := strings.Cut(message, "\n")
+	suggestion := &CommitSuggestion{
+		Message: message,
+		Subject: strings.TrimSpace(subject),
+		Body:    strings.TrimSpace(body),
+	}
+	if match := conventionalSubject.FindStringSubmatch(suggestion.Subject); match != nil {
+		suggestion.Conventional = true
+		suggestion.Type = match[1]
+		suggestion.Scope = match[3]
+		suggestion.Breaking = match[4] == "!"
+	}
+	if strings.Contains(suggestion.Body, "BREAKING CHANGE:") || strings.Contains(suggestion.Body, "BREAKING-CHANGE:") {
+		suggestion.Breaking = true
+	}
+	return suggestion
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,207 @@
+// Package guest enforces the limits on guest accounts: tools they may not
+// use, and deletion of idle guests together with their data, so a guest's
+// workspace lasts only as long as they are using it.
+package guest
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/services/checkpoint"
+)
+
+const defaultCheckInterval = 5 * time.Minute
+
+// Config holds configuration for guest accounts
+type Config struct {
+	// IdleTimeout is how long a guest may be inactive before they and their
+	// data are deleted
+	IdleTimeout time.Duration
+
+	// DeniedTools are the tools guests may not use
+	DeniedTools []string
+
+	// CheckInterval is how often idle guests are looked for
+	CheckInterval time.Duration
+}
+
+// Service tracks guest activity and purges idle guests. A nil Service
+// treats every user as a regular user.
+type Service struct {
+	users       *repository.UserRepository
+	sandbox     *sandbox.Service
+	checkpoints *checkpoint.Service
+	config      Config
+	denied      map[string]bool
+
+	mu       sync.Mutex
+	guests   map[string]bool      // Whether each user seen so far is a guest
+	activity map[string]time.Time // Guest activity not yet saved
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewService creates a guest service. sandboxService and checkpoints may be
+// nil if those features are disabled.
+func NewService(users *repository.UserRepository, sandboxService *sandbox.Service, checkpoints *checkpoint.Service, config Config) *Service {
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = defaultCheckInterval
+		if config.IdleTimeout > 0 && config.IdleTimeout < config.CheckInterval {
+			config.CheckInterval = config.IdleTimeout
+		}
+	}
+
+	denied := make(map[string]bool, len(config.DeniedTools))
+	for _, name := range config.DeniedTools {
+		denied[name] = true
+	}
+
+	return &Service{
+		users:       users,
+		sandbox:     sandboxService,
+		checkpoints: checkpoints,
+		config:      config,
+		denied:      denied,
+		guests:      make(map[string]bool),
+		activity:    make(map[string]time.Time),
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// IsGuest reports whether a user is a guest
+func (s *Service) IsGuest(userID string) bool {
+	if s == nil || userID == "" {
+		return false
+	}
+
+	s.mu.Lock()
+	isGuest, ok := s.guests[userID]
+	s.mu.Unlock()
+	if ok {
+		return isGuest
+	}
+
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		log.Printf("Failed to look up user %s: %v", userID, err)
+		return false
+	}
+	// A purged guest's access token stays valid until it expires, so users
+	// that no longer exist keep the guest limits
+	isGuest = user == nil || user.IsGuest
+
+	s.mu.Lock()
+	s.guests[userID] = isGuest
+	s.mu.Unlock()
+	return isGuest
+}
+
+// DeniesTool reports whether a user may not use a tool because they are a
+// guest
+func (s *Service) DeniesTool(userID, toolName string) bool {
+	if s == nil || !s.denied[toolName] {
+		return false
+	}
+	return s.IsGuest(userID)
+}
+
+// Touch records activity by a user, postponing their deletion if they are a
+// guest
+func (s *Service) Touch(userID string) {
+	if !s.IsGuest(userID) {
+		return
+	}
+	s.mu.Lock()
+	s.activity[userID] = time.Now()
+	s.mu.Unlock()
+}
+
+// Start begins purging idle guests in the background
+func (s *Service) Start() {
+	go func() {
+		ticker := time.NewTicker(s.config.CheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				s.purgeIdle()
+			}
+		}
+	}()
+}
+
+// Stop stops purging idle guests, saving their recent activity
+func (s *Service) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		s.saveActivity()
+	})
+}
+
+// saveActivity writes recorded guest activity to the database
+func (s *Service) saveActivity() {
+	s.mu.Lock()
+	activity := s.activity
+	s.activity = make(map[string]time.Time)
+	s.mu.Unlock()
+
+	for userID, at := range activity {
+		if err := s.users.SetLastActive(userID, at); err != nil {
+			log.Printf("Failed to save guest activity for %s: %v", userID, err)
+		}
+	}
+}
+
+// purgeIdle deletes every guest who has been inactive for the idle timeout
+func (s *Service) purgeIdle() {
+	s.saveActivity()
+	if s.config.IdleTimeout <= 0 {
+		return
+	}
+
+	ids, err := s.users.ListIdleGuests(time.Now().Add(-s.config.IdleTimeout))
+	if err != nil {
+		log.Printf("Failed to list idle guests: %v", err)
+		return
+	}
+	for _, userID := range ids {
+		if err := s.Purge(userID); err != nil {
+			log.Printf("Failed to purge guest %s: %v", userID, err)
+			continue
+		}
+		log.Printf("Purged idle guest %s", userID)
+	}
+}
+
+// Purge deletes a guest, their workspace and checkpoints, and everything
+// stored for them
+func (s *Service) Purge(userID string) error {
+	if s.sandbox != nil {
+		if s.checkpoints != nil {
+			if workDir, err := s.sandbox.GetOrCreateWorkDir(userID); err == nil {
+				if err := s.checkpoints.RemoveWorkspace(workDir); err != nil {
+					return err
+				}
+			}
+		}
+		if err := s.sandbox.RemoveUser(userID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.users.Delete(userID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.activity, userID)
+	s.mu.Unlock()
+	return nil
+}
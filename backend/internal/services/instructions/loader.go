@@ -0,0 +1,226 @@
+package instructions
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jacklau/prism/internal/sandbox"
+)
+
+// FileName is the instruction file looked up in every workspace directory
+const FileName = "PRISM.md"
+
+// rootAlternate is an additional instruction file read from the workspace root only
+var rootAlternate = filepath.Join(".prism", "instructions.md")
+
+const (
+	defaultMaxDepth = 4
+	defaultMaxBytes = 32 * 1024
+)
+
+// skipDirs are never searched for nested instruction files
+var skipDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"dist":         true,
+	"build":        true,
+	"target":       true,
+	"__pycache__":  true,
+	"venv":         true,
+}
+
+const instructionsHeader = `The following project instructions were provided by the user in instruction files in the workspace. Follow them when working in this project. Instructions from a subdirectory apply to files under that directory and take precedence over more general ones.`
+
+// Config holds configuration for the instruction loader
+type Config struct {
+	// MaxDepth limits how deep below the workspace root nested files are found
+	MaxDepth int
+	// MaxBytes caps the combined size of all loaded instructions
+	MaxBytes int
+}
+
+// Loader reads project instruction files (PRISM.md) from a user's workspace
+type Loader struct {
+	sandboxService *sandbox.Service
+	config         Config
+}
+
+// NewLoader creates a new project instruction loader
+func NewLoader(sandboxService *sandbox.Service, config Config) *Loader {
+	if config.MaxDepth <= 0 {
+		config.MaxDepth = defaultMaxDepth
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultMaxBytes
+	}
+	return &Loader{
+		sandboxService: sandboxService,
+		config:         config,
+	}
+}
+
+// instructionFile is one instruction file found in the workspace
+type instructionFile struct {
+	dir     string // workspace-relative directory, "" for the root
+	path    string // workspace-relative file path
+	content string
+}
+
+// Load returns the merged instructions for the user's current workspace, or
+// an empty string if the workspace has none. Root instructions come first,
+// followed by nested directories from shallowest to deepest.
+func (l *Loader) Load(userID string) string {
+	workDir, err := l.sandboxService.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return ""
+	}
+
+	files := l.find(userID, workDir)
+	if len(files) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(instructionsHeader)
+	remaining := l.config.MaxBytes
+	for _, file := range files {
+		content := file.content
+		if len(content) > remaining {
+			content = strings.ToValidUTF8(content[:remaining], "") + "\n... [truncated]"
+		}
+		remaining -= len(file.content)
+
+		scope := "the whole project"
+		if file.dir != "" {
+			scope = file.dir + "/"
+		}
+		fmt.Fprintf(&sb, "\n\n<project_instructions source=%q scope=%q>\n%s\n</project_instructions>",
+			file.path, scope, strings.TrimSpace(content))
+
+		if remaining <= 0 {
+			break
+		}
+	}
+	return sb.String()
+}
+
+// Merge appends loaded instructions to a system prompt
+func Merge(systemPrompt, instructions string) string {
+	if instructions == "" {
+		return systemPrompt
+	}
+	if systemPrompt == "" {
+		return instructions
+	}
+	return systemPrompt + "\n\n" + instructions
+}
+
+// customFile returns the instruction file named in the workspace's settings,
+// or "" if there is none or it is one of the files read anyway
+func (l *Loader) customFile(userID string) string {
+	settings, err := l.sandboxService.WorkspaceSettings(userID)
+	if err != nil || settings == nil || settings.InstructionFile == "" {
+		return ""
+	}
+	custom := filepath.FromSlash(settings.InstructionFile)
+	if custom == rootAlternate || filepath.Base(custom) == FileName {
+		return ""
+	}
+	return custom
+}
+
+// find locates instruction files in the workspace, ordered root first and
+// then by depth and path
+func (l *Loader) find(userID, workDir string) []instructionFile {
+	var files []instructionFile
+
+	// Root-only alternate location, read before the root PRISM.md
+	if content := l.read(userID, rootAlternate); content != "" {
+		files = append(files, instructionFile{path: filepath.ToSlash(rootAlternate), content: content})
+	}
+
+	// The workspace's own instruction file, if its settings name one. It
+	// applies to the whole project like the root files.
+	if custom := l.customFile(userID); custom != "" {
+		if content := l.read(userID, custom); content != "" {
+			files = append(files, instructionFile{path: filepath.ToSlash(custom), content: content})
+		}
+	}
+
+	err := filepath.WalkDir(workDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		rel, relErr := filepath.Rel(workDir, path)
+		if relErr != nil {
+			return nil
+		}
+
+		if d.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			name := d.Name()
+			if strings.HasPrefix(name, ".") || skipDirs[name] {
+				return filepath.SkipDir
+			}
+			if strings.Count(rel, string(filepath.Separator))+1 > l.config.MaxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.Name() != FileName {
+			return nil
+		}
+		content := l.read(userID, rel)
+		if content == "" {
+			return nil
+		}
+
+		dir := filepath.ToSlash(filepath.Dir(rel))
+		if dir == "." {
+			dir = ""
+		}
+		files = append(files, instructionFile{dir: dir, path: filepath.ToSlash(rel), content: content})
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to search workspace for instruction files: %v", err)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		di, dj := depth(files[i].dir), depth(files[j].dir)
+		if di != dj {
+			return di < dj
+		}
+		return files[i].dir < files[j].dir
+	})
+	return files
+}
+
+// read returns the trimmed contents of a workspace file, or "" if it can't be read
+func (l *Loader) read(userID, relPath string) string {
+	content, err := l.sandboxService.GetFileContent(userID, relPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to read instruction file %s: %v", relPath, err)
+		}
+		return ""
+	}
+	return strings.TrimSpace(content)
+}
+
+// depth returns the nesting level of a workspace-relative directory
+func depth(dir string) int {
+	if dir == "" {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
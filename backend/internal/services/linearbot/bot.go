@@ -0,0 +1,289 @@
+// Package linearbot runs agents from Linear issue webhooks. Each user
+// connects Linear with a personal API key and configures triggers; when an
+// issue is created or updated in a way that matches a trigger, an agent is
+// given the trigger's prompt and the issue, and its answer can be posted
+// back to the issue as a comment.
+package linearbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacklau/prism/internal/agent"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+	"github.com/jacklau/prism/internal/integrations/linear"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/security"
+)
+
+const (
+	defaultTimeout = 10 * time.Minute
+
+	// maxCommentChars truncates agent output posted as an issue comment
+	maxCommentChars = 50000
+	// maxDescriptionChars truncates long issue descriptions in the agent's context
+	maxDescriptionChars = 8000
+
+	systemPrompt = `You are Prism, an assistant run automatically from a Linear issue. Follow the instructions you are given for the issue below. Your answer may be posted to the issue as a comment, so write it for the issue's team: use Markdown, be specific and don't address the automation itself.`
+)
+
+var (
+	// ErrNotConnected is returned when a user has no Linear API key
+	ErrNotConnected = errors.New("linear account not connected")
+	// ErrUnknownWebhook is returned for webhook URLs with an unknown token
+	ErrUnknownWebhook = errors.New("unknown linear webhook")
+)
+
+// Config holds configuration for Linear automation
+type Config struct {
+	// Provider and Model run triggers for users who don't choose a model
+	Provider string
+	Model    string
+	// Timeout bounds each trigger's agent run
+	Timeout time.Duration
+}
+
+// Bot runs agents from Linear issue webhooks
+type Bot struct {
+	linear            *linear.Client
+	repo              *repository.IntegrationRepository
+	agents            *agent.Manager
+	llmManager        *llm.Manager
+	providerKeyRepo   *repository.ProviderKeyRepository
+	encryptionService *security.EncryptionService
+	integrations      *integrations.Manager
+	config            Config
+
+	// running holds the issue and trigger pairs with an agent in progress,
+	// so a burst of webhooks for one issue doesn't start duplicate runs
+	running map[string]bool
+	mu      sync.Mutex
+}
+
+// NewBot creates a new Linear bot. The agent manager may be nil, in which
+// case webhooks are accepted but no triggers run.
+func NewBot(
+	linearClient *linear.Client,
+	repo *repository.IntegrationRepository,
+	agents *agent.Manager,
+	llmManager *llm.Manager,
+	providerKeyRepo *repository.ProviderKeyRepository,
+	encryptionService *security.EncryptionService,
+	integrationManager *integrations.Manager,
+	config Config,
+) *Bot {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	return &Bot{
+		linear:            linearClient,
+		repo:              repo,
+		agents:            agents,
+		llmManager:        llmManager,
+		providerKeyRepo:   providerKeyRepo,
+		encryptionService: encryptionService,
+		integrations:      integrationManager,
+		config:            config,
+		running:           make(map[string]bool),
+	}
+}
+
+// CheckKey checks a Linear API key and returns the user it belongs to
+func (b *Bot) CheckKey(apiKey string) (*linear.Viewer, error) {
+	return b.linear.Viewer(apiKey)
+}
+
+// SearchIssues searches the issues visible to a user's Linear API key
+func (b *Bot) SearchIssues(userID, term string, opts linear.SearchOptions) ([]linear.Issue, error) {
+	settings, err := b.repo.GetLinearSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	if settings == nil || settings.APIKey == "" {
+		return nil, ErrNotConnected
+	}
+	return b.linear.SearchIssues(settings.APIKey, term, opts)
+}
+
+// HandleWebhook verifies a webhook sent to a user's webhook URL and starts
+// the agents of the triggers it matches, returning how many were started.
+// Agents run in the background; Linear expects a quick response.
+func (b *Bot) HandleWebhook(token, signature string, body []byte) (int, error) {
+	settings, err := b.repo.GetLinearSettingsByToken(token)
+	if err != nil {
+		return 0, err
+	}
+	if settings == nil {
+		return 0, ErrUnknownWebhook
+	}
+	if err := linear.VerifySignature(settings.WebhookSecret, signature, body, time.Now()); err != nil {
+		return 0, err
+	}
+
+	event, err := linear.ParseIssueEvent(body)
+	if err != nil {
+		return 0, err
+	}
+	if event == nil || !settings.Enabled || b.agents == nil {
+		return 0, nil
+	}
+
+	if b.integrations != nil {
+		b.integrations.Track(&integrations.Event{
+			Type:   "linear.webhook_received",
+			UserID: settings.UserID,
+			Data: map[string]interface{}{
+				"action": event.Action,
+				"issue":  event.Issue.Identifier,
+			},
+		})
+	}
+
+	started := 0
+	for i := range settings.Triggers {
+		trigger := settings.Triggers[i]
+		if !trigger.Matches(event) || !b.claim(event.Issue.ID, trigger.Name) {
+			continue
+		}
+		started++
+		go b.run(settings, trigger, event)
+	}
+	return started, nil
+}
+
+// claim marks a trigger as running for an issue, returning false if it
+// already is
+func (b *Bot) claim(issueID, triggerName string) bool {
+	key := issueID + "/" + strings.ToLower(triggerName)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.running[key] {
+		return false
+	}
+	b.running[key] = true
+	return true
+}
+
+func (b *Bot) release(issueID, triggerName string) {
+	b.mu.Lock()
+	delete(b.running, issueID+"/"+strings.ToLower(triggerName))
+	b.mu.Unlock()
+}
+
+// run runs a trigger's agent on an issue and posts its output if asked
+func (b *Bot) run(settings *repository.LinearSettings, trigger linear.Trigger, event *linear.IssueEvent) {
+	defer b.release(event.Issue.ID, trigger.Name)
+
+	issue := event.Issue.Identifier
+	provider, model := b.config.Provider, b.config.Model
+	if settings.Model != "" {
+		model = settings.Model
+		if settings.Provider != "" {
+			provider = settings.Provider
+		}
+	}
+
+	creds := b.llmManager.UserCredentials(b.providerKeyRepo, b.encryptionService, settings.UserID, provider)
+	if !b.llmManager.CanUse(provider, creds) {
+		log.Printf("Linear trigger %q on %s not run: no API key configured for %s", trigger.Name, issue, provider)
+		if trigger.Comment {
+			b.comment(settings, trigger, event, fmt.Sprintf("Prism couldn't run **%s**: no API key is configured for %s. Add one in Prism under Settings.", trigger.Name, provider))
+		}
+		return
+	}
+
+	task := agent.NewTask(trigger.Prompt,
+		agent.WithContext(issueContext(event)),
+		agent.WithTimeout(b.config.Timeout),
+	)
+	execution, err := b.agents.RunTask(context.Background(), task, agent.AgentConfig{
+		Name:         "linear",
+		Provider:     provider,
+		Model:        model,
+		SystemPrompt: systemPrompt,
+		Credentials:  creds,
+	})
+	if err != nil {
+		log.Printf("Failed to start Linear trigger %q on %s: %v", trigger.Name, issue, err)
+		return
+	}
+
+	startTime := time.Now()
+	execution.Wait()
+	results := execution.GetResults()
+	if len(results) == 0 {
+		log.Printf("Linear trigger %q on %s finished without a result", trigger.Name, issue)
+		return
+	}
+	result := results[0]
+
+	if b.integrations != nil {
+		b.integrations.TrackAgentFinished(settings.UserID, "", result.AgentID, "linear", !result.Success, result.Error, time.Since(startTime).Milliseconds())
+	}
+	if !result.Success {
+		log.Printf("Linear trigger %q on %s failed: %s", trigger.Name, issue, result.Error)
+		if trigger.Comment {
+			b.comment(settings, trigger, event, fmt.Sprintf("Prism's **%s** run failed: %s", trigger.Name, result.Error))
+		}
+		return
+	}
+
+	log.Printf("Linear trigger %q ran on %s", trigger.Name, issue)
+	if trigger.Comment && strings.TrimSpace(result.Output) != "" {
+		b.comment(settings, trigger, event, result.Output)
+	}
+}
+
+// comment posts a trigger's output to the issue
+func (b *Bot) comment(settings *repository.LinearSettings, trigger linear.Trigger, event *linear.IssueEvent, text string) {
+	if len(text) > maxCommentChars {
+		text = text[:maxCommentChars] + "\n\n…(truncated)"
+	}
+	body := fmt.Sprintf("%s\n\n---\n_Posted by Prism (trigger: %s)_", text, trigger.Name)
+	if _, err := b.linear.CreateComment(settings.APIKey, event.Issue.ID, body); err != nil {
+		log.Printf("Failed to comment on Linear issue %s: %v", event.Issue.Identifier, err)
+	}
+}
+
+// issueContext describes the issue for the agent
+func issueContext(event *linear.IssueEvent) string {
+	issue := &event.Issue
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Linear issue %s: %s\n", issue.Identifier, issue.Title)
+	if event.URL != "" {
+		fmt.Fprintf(&sb, "URL: %s\n", event.URL)
+	}
+	if issue.Team != nil {
+		fmt.Fprintf(&sb, "Team: %s (%s)\n", issue.Team.Name, issue.Team.Key)
+	}
+	if issue.State != nil {
+		fmt.Fprintf(&sb, "State: %s\n", issue.State.Name)
+	}
+	if issue.Assignee != nil {
+		fmt.Fprintf(&sb, "Assignee: %s\n", issue.Assignee.Name)
+	}
+	if len(issue.Labels) > 0 {
+		names := make([]string, 0, len(issue.Labels))
+		for _, label := range issue.Labels {
+			names = append(names, label.Name)
+		}
+		fmt.Fprintf(&sb, "Labels: %s\n", strings.Join(names, ", "))
+	}
+	fmt.Fprintf(&sb, "Event: issue %sd\n", event.Action)
+
+	description := strings.TrimSpace(issue.Description)
+	if len(description) > maxDescriptionChars {
+		description = description[:maxDescriptionChars] + "\n…(truncated)"
+	}
+	if description == "" {
+		description = "(no description)"
+	}
+	fmt.Fprintf(&sb, "\nDescription:\n%s\n", description)
+	return sb.String()
+}
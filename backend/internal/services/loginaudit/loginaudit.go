@@ -0,0 +1,149 @@
+// Package loginaudit records sign-in attempts and registrations, and alerts
+// users through the notification integrations when they sign in from a new
+// device or someone keeps failing to sign in as them.
+package loginaudit
+
+import (
+	"log"
+	"time"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+)
+
+// maxUserAgentLength caps the user agent stored with an event
+const maxUserAgentLength = 512
+
+// Reasons a sign-in failed
+const (
+	ReasonUnknownEmail  = "unknown_email"
+	ReasonWrongPassword = "wrong_password"
+)
+
+// Config controls alerting and retention
+type Config struct {
+	// FailureThreshold failed sign-ins within FailureWindow trigger an
+	// alert. 0 disables failure alerts.
+	FailureThreshold int
+	FailureWindow    time.Duration
+
+	// Retention is how long events are kept. 0 keeps them forever.
+	Retention time.Duration
+}
+
+// Attempt describes a sign-in attempt or registration
+type Attempt struct {
+	UserID    string // Empty if no account has the email
+	Email     string
+	Kind      string // repository.AuthEventLogin or repository.AuthEventRegister
+	Success   bool
+	Reason    string // Why it failed
+	IP        string
+	UserAgent string
+}
+
+// Service records auth events and raises alerts on them
+type Service struct {
+	repo         *repository.AuthEventRepository
+	integrations *integrations.Manager
+	config       Config
+}
+
+// NewService creates a new login audit service. integrationManager may be
+// nil, in which case events are recorded without alerts.
+func NewService(repo *repository.AuthEventRepository, integrationManager *integrations.Manager, config Config) *Service {
+	return &Service{
+		repo:         repo,
+		integrations: integrationManager,
+		config:       config,
+	}
+}
+
+// Record stores an attempt and sends any alert it calls for. Failures are
+// logged rather than returned so that they never block signing in.
+func (s *Service) Record(attempt Attempt) {
+	if len(attempt.UserAgent) > maxUserAgentLength {
+		attempt.UserAgent = attempt.UserAgent[:maxUserAgentLength]
+	}
+	event := &repository.AuthEvent{
+		UserID:    attempt.UserID,
+		Email:     attempt.Email,
+		Kind:      attempt.Kind,
+		Success:   attempt.Success,
+		Reason:    attempt.Reason,
+		IP:        attempt.IP,
+		UserAgent: attempt.UserAgent,
+	}
+
+	// A sign-in from a user agent the user hasn't used before is a new
+	// device, unless it's their first (registering counts as one)
+	if attempt.Success && attempt.UserID != "" && attempt.Kind == repository.AuthEventLogin {
+		known, anySuccess, err := s.repo.KnownDevice(attempt.UserID, attempt.UserAgent)
+		if err != nil {
+			log.Printf("Failed to check devices of user %s: %v", attempt.UserID, err)
+		} else {
+			event.NewDevice = anySuccess && !known
+		}
+	}
+
+	if err := s.repo.Record(event); err != nil {
+		log.Printf("Failed to record sign-in of user %s: %v", attempt.UserID, err)
+		return
+	}
+
+	if event.NewDevice {
+		s.notify(integrations.EventLoginNewDevice, event, nil)
+	}
+	if !attempt.Success && attempt.UserID != "" && s.config.FailureThreshold > 0 {
+		s.checkFailures(event)
+	}
+
+	if s.config.Retention > 0 {
+		if _, err := s.repo.DeleteOlderThan(time.Now().Add(-s.config.Retention)); err != nil {
+			log.Printf("Failed to prune auth events: %v", err)
+		}
+	}
+}
+
+// List returns a user's most recent auth events
+func (s *Service) List(userID string, limit int) ([]*repository.AuthEvent, error) {
+	return s.repo.ListByUser(userID, limit)
+}
+
+// checkFailures alerts when a failed sign-in brings the user's failures
+// within the window to the threshold. Later failures in the same burst
+// don't alert again until the count drops back below it.
+func (s *Service) checkFailures(event *repository.AuthEvent) {
+	count, err := s.repo.CountFailuresSince(event.UserID, event.CreatedAt.Add(-s.config.FailureWindow))
+	if err != nil {
+		log.Printf("Failed to count failed sign-ins of user %s: %v", event.UserID, err)
+		return
+	}
+	if count == s.config.FailureThreshold {
+		s.notify(integrations.EventLoginFailures, event, map[string]interface{}{
+			"failures": count,
+			"window":   s.config.FailureWindow.String(),
+		})
+	}
+}
+
+// notify sends an alert about an event to the user's integrations
+func (s *Service) notify(eventType integrations.EventType, event *repository.AuthEvent, extra map[string]interface{}) {
+	if s.integrations == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"email":      event.Email,
+		"ip":         event.IP,
+		"user_agent": event.UserAgent,
+		"time":       event.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	for key, value := range extra {
+		data[key] = value
+	}
+	s.integrations.Notify(&integrations.Event{
+		Type:   eventType,
+		UserID: event.UserID,
+		Data:   data,
+	})
+}
@@ -0,0 +1,153 @@
+// Package modelinfo reports what a model can do: tools, vision, JSON mode,
+// context window, output limit and pricing. It combines what providers
+// report about their models with local overrides, which correct or fill in
+// details, e.g. for models served by an OpenAI-compatible server.
+package modelinfo
+
+import (
+	"errors"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/llm"
+)
+
+// ErrProviderNotFound is returned for providers that aren't registered
+var ErrProviderNotFound = errors.New("provider not found")
+
+// Capabilities describes a model
+type Capabilities struct {
+	Provider         string            `json:"provider"`
+	Model            string            `json:"model"`
+	Name             string            `json:"name,omitempty"`
+	Description      string            `json:"description,omitempty"`
+	SupportsTools    bool              `json:"supports_tools"`
+	SupportsVision   bool              `json:"supports_vision"`
+	SupportsJSONMode bool              `json:"supports_json_mode"`
+	ContextWindow    int               `json:"context_window,omitempty"`    // 0 if unknown
+	MaxOutputTokens  int               `json:"max_output_tokens,omitempty"` // 0 if unknown
+	Pricing          *llm.ModelPricing `json:"pricing,omitempty"`           // nil if unknown
+
+	// Known is false for models the provider doesn't list and nobody has
+	// overridden; their tools and vision support are the provider's defaults
+	Known bool `json:"known"`
+
+	// Overridden lists the fields set by a local override
+	Overridden []string `json:"overridden,omitempty"`
+}
+
+// Service looks up model capabilities
+type Service struct {
+	llmManager *llm.Manager
+	overrides  *repository.ModelOverrideRepository
+}
+
+// NewService creates a new model info service
+func NewService(llmManager *llm.Manager, overrides *repository.ModelOverrideRepository) *Service {
+	return &Service{
+		llmManager: llmManager,
+		overrides:  overrides,
+	}
+}
+
+// Get returns a model's capabilities
+func (s *Service) Get(providerName, modelID string) (*Capabilities, error) {
+	provider, err := s.llmManager.GetProvider(providerName)
+	if err != nil {
+		return nil, ErrProviderNotFound
+	}
+	models, err := s.llmManager.Models(providerName)
+	if err != nil {
+		return nil, ErrProviderNotFound
+	}
+
+	caps := &Capabilities{
+		Provider:       providerName,
+		Model:          modelID,
+		SupportsTools:  provider.SupportsTools(),
+		SupportsVision: provider.SupportsVision(),
+	}
+	for _, m := range models {
+		if m.ID != modelID {
+			continue
+		}
+		caps.Name = m.Name
+		caps.Description = m.Description
+		caps.SupportsTools = m.SupportsTools
+		caps.SupportsVision = m.SupportsVision
+		caps.SupportsJSONMode = m.SupportsJSONMode
+		caps.ContextWindow = m.ContextWindow
+		caps.MaxOutputTokens = m.MaxOutputTokens
+		if m.Pricing != nil {
+			pricing := *m.Pricing
+			caps.Pricing = &pricing
+		}
+		caps.Known = true
+		break
+	}
+
+	override, err := s.overrides.Get(providerName, modelID)
+	if err != nil {
+		return nil, err
+	}
+	if override != nil {
+		applyOverride(caps, override)
+	}
+
+	return caps, nil
+}
+
+// ListOverrides lists all local overrides
+func (s *Service) ListOverrides() ([]*repository.ModelOverride, error) {
+	return s.overrides.List()
+}
+
+// SetOverride stores a local override for a model
+func (s *Service) SetOverride(override *repository.ModelOverride) error {
+	if _, err := s.llmManager.GetProvider(override.Provider); err != nil {
+		return ErrProviderNotFound
+	}
+	return s.overrides.Upsert(override)
+}
+
+// DeleteOverride removes a model's local override
+func (s *Service) DeleteOverride(providerName, modelID string) error {
+	return s.overrides.Delete(providerName, modelID)
+}
+
+// applyOverride replaces the fields an override sets
+func applyOverride(caps *Capabilities, override *repository.ModelOverride) {
+	caps.Known = true
+
+	if override.SupportsTools != nil {
+		caps.SupportsTools = *override.SupportsTools
+		caps.Overridden = append(caps.Overridden, "supports_tools")
+	}
+	if override.SupportsVision != nil {
+		caps.SupportsVision = *override.SupportsVision
+		caps.Overridden = append(caps.Overridden, "supports_vision")
+	}
+	if override.SupportsJSONMode != nil {
+		caps.SupportsJSONMode = *override.SupportsJSONMode
+		caps.Overridden = append(caps.Overridden, "supports_json_mode")
+	}
+	if override.ContextWindow != nil {
+		caps.ContextWindow = *override.ContextWindow
+		caps.Overridden = append(caps.Overridden, "context_window")
+	}
+	if override.MaxOutputTokens != nil {
+		caps.MaxOutputTokens = *override.MaxOutputTokens
+		caps.Overridden = append(caps.Overridden, "max_output_tokens")
+	}
+	if override.InputPricePerMillion != nil || override.OutputPricePerMillion != nil {
+		if caps.Pricing == nil {
+			caps.Pricing = &llm.ModelPricing{}
+		}
+		if override.InputPricePerMillion != nil {
+			caps.Pricing.InputPerMillion = *override.InputPricePerMillion
+		}
+		if override.OutputPricePerMillion != nil {
+			caps.Pricing.OutputPerMillion = *override.OutputPricePerMillion
+		}
+		caps.Overridden = append(caps.Overridden, "pricing")
+	}
+}
@@ -0,0 +1,464 @@
+// Package onboarding explains repositories. When a repository is cloned into
+// a workspace, or on request, an analysis job scans its structure
+// (languages, entry points, build commands and modules), packs its key files
+// and has an analyst agent write an onboarding summary. The summary is
+// stored per directory and added to the system prompt of chats in the
+// workspace, so every conversation starts knowing the lay of the project.
+package onboarding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacklau/prism/internal/agent"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/security"
+	"github.com/jacklau/prism/internal/services/contextpack"
+)
+
+const (
+	// maxContextBytes caps the combined size of the summaries added to a
+	// chat's system prompt
+	maxContextBytes = 16 * 1024
+	// packQuery ranks the files packed for the analyst
+	packQuery = "readme overview architecture main entry server app config build docs"
+)
+
+const analystSystemPrompt = `You are a senior engineer onboarding onto an unfamiliar codebase. You write concise, accurate onboarding notes for other engineers and for an AI assistant that will work in the repository. Only state what the provided structure and files support; say so when something is unclear.`
+
+const analystPrompt = `Write an onboarding summary of this repository in Markdown, using the structural scan and the packed files in your context. Use these sections:
+
+### Overview
+What the project is and does, in two or three sentences.
+
+### Languages and Stack
+The main languages, frameworks and notable dependencies.
+
+### Entry Points
+Where programs start and what each one runs.
+
+### Build, Test and Run
+The commands to install dependencies, build, test and run the project, and the directory to run them in.
+
+### Key Modules
+The most important directories and what each is responsible for, one bullet each.
+
+### Conventions
+Patterns a contributor should follow: code layout, error handling, testing and configuration.
+
+Keep the whole summary under 600 words. Reply with the summary only, without a title or code fence.`
+
+const contextHeader = `The following onboarding summaries describe repositories in the current workspace. They were written when each repository was analyzed and may be out of date; check the files before relying on details.`
+
+var (
+	// ErrInvalidRequest is returned for requests that can't be served as given
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrAlreadyRunning is returned when the directory is already being analyzed
+	ErrAlreadyRunning = errors.New("an analysis of this directory is already running")
+	// ErrNoAPIKey is returned when the chosen provider has no key
+	ErrNoAPIKey = errors.New("API key not configured for provider")
+)
+
+// Config holds configuration for repository analysis
+type Config struct {
+	// Provider and Model run the analyst for requests that don't choose a model
+	Provider string
+	Model    string
+	// Timeout bounds the analyst's run
+	Timeout time.Duration
+	// TokenBudget is the size of the context pack given to the analyst
+	TokenBudget int
+}
+
+// Request asks for a directory to be analyzed
+type Request struct {
+	Dir      string `json:"dir" validate:"max=4096"` // Directory within the workspace, defaults to its root
+	Provider string `json:"provider" validate:"max=50"`
+	Model    string `json:"model" validate:"max=100"`
+}
+
+// Summary is the onboarding summary of a directory
+type Summary struct {
+	Path      string     `json:"path"`
+	Status    string     `json:"status"` // running, completed or failed
+	Structure *Structure `json:"structure,omitempty"`
+	Summary   string     `json:"summary,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Provider  string     `json:"provider,omitempty"`
+	Model     string     `json:"model,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Analyzer runs repository analysis jobs and serves their summaries
+type Analyzer struct {
+	sandboxService    *sandbox.Service
+	packer            *contextpack.Packer
+	agents            *agent.Manager
+	summaryRepo       *repository.WorkspaceSummaryRepository
+	llmManager        *llm.Manager
+	providerKeyRepo   *repository.ProviderKeyRepository
+	encryptionService *security.EncryptionService
+	config            Config
+
+	mu      sync.Mutex
+	running map[string]bool // Directories being analyzed, by user and path
+}
+
+// NewAnalyzer creates a new repository analyzer
+func NewAnalyzer(
+	sandboxService *sandbox.Service,
+	packer *contextpack.Packer,
+	agents *agent.Manager,
+	summaryRepo *repository.WorkspaceSummaryRepository,
+	llmManager *llm.Manager,
+	providerKeyRepo *repository.ProviderKeyRepository,
+	encryptionService *security.EncryptionService,
+	config Config,
+) *Analyzer {
+	return &Analyzer{
+		sandboxService:    sandboxService,
+		packer:            packer,
+		agents:            agents,
+		summaryRepo:       summaryRepo,
+		llmManager:        llmManager,
+		providerKeyRepo:   providerKeyRepo,
+		encryptionService: encryptionService,
+		config:            config,
+		running:           make(map[string]bool),
+	}
+}
+
+// Start marks analyses interrupted by a previous shutdown as failed
+func (a *Analyzer) Start() {
+	if n, err := a.summaryRepo.FailRunningSummaries(); err != nil {
+		log.Printf("Failed to recover interrupted repository analyses: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted repository analyses as failed", n)
+	}
+}
+
+// Analyze starts analyzing a directory of the user's workspace in the
+// background and returns its running summary. Any earlier summary of the
+// directory stays in use until the analysis finishes.
+func (a *Analyzer) Analyze(userID string, req Request) (*Summary, error) {
+	root, rel, abs, err := a.resolve(userID, req.Dir)
+	if err != nil {
+		return nil, err
+	}
+	provider, model := a.model(req.Provider, req.Model)
+	if provider == "" || model == "" {
+		return nil, fmt.Errorf("%w: provider and model are required", ErrInvalidRequest)
+	}
+	if !a.llmManager.CanUse(provider, a.llmManager.UserCredentials(a.providerKeyRepo, a.encryptionService, userID, provider)) {
+		return nil, fmt.Errorf("%w: %s", ErrNoAPIKey, provider)
+	}
+	return a.start(userID, root, rel, abs, provider, model)
+}
+
+// AnalyzeClone starts analyzing a repository just cloned into the user's
+// workspace. Without a key for the configured provider, the summary holds
+// the structural scan only.
+func (a *Analyzer) AnalyzeClone(userID, dir string) (*Summary, error) {
+	root, rel, abs, err := a.resolve(userID, dir)
+	if err != nil {
+		return nil, err
+	}
+	provider, model := a.model("", "")
+	return a.start(userID, root, rel, abs, provider, model)
+}
+
+// Get returns the summary of a directory of the user's workspace, or nil if
+// it has none
+func (a *Analyzer) Get(userID, dir string) (*Summary, error) {
+	_, _, abs, err := a.resolve(userID, dir)
+	if err != nil {
+		return nil, err
+	}
+	record, err := a.summaryRepo.Get(userID, abs)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	return toSummary(record), nil
+}
+
+// Delete removes the summary of a directory of the user's workspace,
+// reporting whether it had one
+func (a *Analyzer) Delete(userID, dir string) (bool, error) {
+	_, _, abs, err := a.resolve(userID, dir)
+	if err != nil {
+		return false, err
+	}
+	return a.summaryRepo.Delete(userID, abs)
+}
+
+// Context returns the summaries of the user's current workspace and the
+// repositories in it, for a chat's system prompt, or "" if there are none
+func (a *Analyzer) Context(userID string) string {
+	workDir, err := a.sandboxService.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return ""
+	}
+	records, err := a.summaryRepo.ListWithin(userID, workDir)
+	if err != nil {
+		log.Printf("Failed to list workspace summaries for user %s: %v", userID, err)
+		return ""
+	}
+
+	var sb strings.Builder
+	remaining := maxContextBytes
+	for _, record := range records {
+		if record.Summary == "" {
+			continue
+		}
+		if _, err := os.Stat(record.Path); err != nil {
+			continue // The repository was removed
+		}
+		if sb.Len() == 0 {
+			sb.WriteString(contextHeader)
+		}
+		rel, err := filepath.Rel(workDir, record.Path)
+		if err != nil {
+			continue
+		}
+		content := record.Summary
+		if len(content) > remaining {
+			content = strings.ToValidUTF8(content[:remaining], "") + "\n... [truncated]"
+		}
+		remaining -= len(record.Summary)
+
+		fmt.Fprintf(&sb, "\n\n<repository_summary path=%q updated=%q>\n%s\n</repository_summary>",
+			filepath.ToSlash(rel), record.UpdatedAt.Format("2006-01-02"), strings.TrimSpace(content))
+
+		if remaining <= 0 {
+			break
+		}
+	}
+	return sb.String()
+}
+
+// start records a running summary and analyzes the directory in the
+// background
+func (a *Analyzer) start(userID string, root sandbox.WorkspaceRoot, rel, abs, provider, model string) (*Summary, error) {
+	key := userID + "\x00" + abs
+	a.mu.Lock()
+	if a.running[key] {
+		a.mu.Unlock()
+		return nil, ErrAlreadyRunning
+	}
+	a.running[key] = true
+	a.mu.Unlock()
+
+	record := &repository.WorkspaceSummary{
+		UserID:   userID,
+		Path:     abs,
+		Status:   repository.WorkspaceSummaryRunning,
+		Provider: provider,
+		Model:    model,
+	}
+	// An earlier summary stays in use until the new one is ready
+	previous, err := a.summaryRepo.Get(userID, abs)
+	if err == nil && previous != nil {
+		record.Structure = previous.Structure
+		record.Summary = previous.Summary
+	}
+	if err := a.summaryRepo.Save(record); err != nil {
+		a.finish(key)
+		return nil, err
+	}
+
+	go func() {
+		defer a.finish(key)
+		a.run(userID, root, rel, record)
+	}()
+	return toSummary(record), nil
+}
+
+// finish clears a directory's running mark
+func (a *Analyzer) finish(key string) {
+	a.mu.Lock()
+	delete(a.running, key)
+	a.mu.Unlock()
+}
+
+// run scans a directory, has the analyst summarize it and stores the result
+func (a *Analyzer) run(userID string, root sandbox.WorkspaceRoot, rel string, record *repository.WorkspaceSummary) {
+	structure, err := scan(a.sandboxService.IgnoreMatcher(root.Path), root.Path, record.Path)
+	if err != nil {
+		a.fail(record, err)
+		return
+	}
+	structureJSON, err := json.Marshal(structure)
+	if err != nil {
+		a.fail(record, fmt.Errorf("failed to encode structure: %w", err))
+		return
+	}
+	record.Structure = string(structureJSON)
+
+	summary, err := a.analyze(userID, root, rel, structure, record.Provider, record.Model)
+	if err != nil {
+		// The structural scan is still worth having without the analyst
+		log.Printf("Analyst failed for %s: %v", record.Path, err)
+		record.Error = "analyst did not run: " + err.Error()
+		summary = structure.render()
+	}
+	record.Summary = summary
+	record.Status = repository.WorkspaceSummaryCompleted
+	a.save(record)
+	log.Printf("Analyzed repository %s (%d files)", record.Path, structure.Files)
+}
+
+// analyze has the analyst agent write a summary of a scanned directory
+func (a *Analyzer) analyze(userID string, root sandbox.WorkspaceRoot, rel string, structure *Structure, provider, model string) (string, error) {
+	creds := a.llmManager.UserCredentials(a.providerKeyRepo, a.encryptionService, userID, provider)
+	if !a.llmManager.CanUse(provider, creds) {
+		return "", fmt.Errorf("%w: %s", ErrNoAPIKey, provider)
+	}
+
+	taskContext := "Structural scan:\n\n" + structure.render()
+	bundle, err := a.packer.Pack(userID, contextpack.Spec{
+		Dir:         root.Qualify(filepath.ToSlash(rel)),
+		Query:       packQuery,
+		TokenBudget: a.config.TokenBudget,
+	})
+	switch {
+	case err == nil:
+		taskContext += "\n\n" + bundle.Content
+	case !errors.Is(err, contextpack.ErrNoFiles):
+		return "", fmt.Errorf("failed to pack repository: %w", err)
+	}
+
+	task := agent.NewTask(analystPrompt,
+		agent.WithContext(taskContext),
+		agent.WithTimeout(a.config.Timeout),
+	)
+	execution, err := a.agents.RunTask(context.Background(), task, agent.AgentConfig{
+		Name:         "repo-analyst",
+		Provider:     provider,
+		Model:        model,
+		SystemPrompt: analystSystemPrompt,
+		Credentials:  creds,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start analyst: %w", err)
+	}
+	execution.Wait()
+
+	for _, result := range execution.GetResults() {
+		if !result.Success {
+			if result.Error != "" {
+				return "", errors.New(result.Error)
+			}
+			return "", fmt.Errorf("analyst %s", result.Status)
+		}
+		if summary := cleanSummary(result.Output); summary != "" {
+			return summary, nil
+		}
+	}
+	return "", fmt.Errorf("analyst returned no summary")
+}
+
+// fail records a failed analysis
+func (a *Analyzer) fail(record *repository.WorkspaceSummary, err error) {
+	log.Printf("Repository analysis of %s failed: %v", record.Path, err)
+	record.Status = repository.WorkspaceSummaryFailed
+	record.Error = err.Error() // Keeps any earlier summary
+	a.save(record)
+}
+
+// save stores a finished analysis, unless its summary was deleted while it
+// ran
+func (a *Analyzer) save(record *repository.WorkspaceSummary) {
+	existing, err := a.summaryRepo.Get(record.UserID, record.Path)
+	if err != nil {
+		log.Printf("Failed to get workspace summary for %s: %v", record.Path, err)
+		return
+	}
+	if existing == nil {
+		return
+	}
+	if err := a.summaryRepo.Save(record); err != nil {
+		log.Printf("Failed to save workspace summary for %s: %v", record.Path, err)
+	}
+}
+
+// resolve resolves a directory within the user's workspace to its root, its
+// path within the root and its absolute path
+func (a *Analyzer) resolve(userID, dir string) (sandbox.WorkspaceRoot, string, string, error) {
+	root, rel, err := a.sandboxService.ResolveRoot(userID, dir)
+	if err != nil {
+		return sandbox.WorkspaceRoot{}, "", "", fmt.Errorf("failed to get workspace: %w", err)
+	}
+	abs := root.Path
+	if rel != "" {
+		cleanPath := filepath.Clean(rel)
+		if strings.HasPrefix(cleanPath, "..") || filepath.IsAbs(cleanPath) {
+			return sandbox.WorkspaceRoot{}, "", "", fmt.Errorf("%w: dir must be a relative path within the workspace", ErrInvalidRequest)
+		}
+		if cleanPath == "." {
+			cleanPath = ""
+		}
+		rel = cleanPath
+		abs = filepath.Join(root.Path, cleanPath)
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return sandbox.WorkspaceRoot{}, "", "", fmt.Errorf("%w: directory not found: %s", ErrInvalidRequest, dir)
+	}
+	return root, rel, abs, nil
+}
+
+// model picks the provider and model for an analysis
+func (a *Analyzer) model(provider, model string) (string, string) {
+	if model == "" {
+		return a.config.Provider, a.config.Model
+	}
+	if provider == "" {
+		provider = a.config.Provider
+	}
+	return provider, model
+}
+
+// cleanSummary strips a code fence a model wrapped its summary in
+func cleanSummary(raw string) string {
+	text := strings.TrimSpace(raw)
+	if strings.HasPrefix(text, "```") {
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		} else {
+			text = ""
+		}
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+	return strings.TrimSpace(text)
+}
+
+// toSummary converts a stored summary for a response
+func toSummary(record *repository.WorkspaceSummary) *Summary {
+	summary := &Summary{
+		Path:      record.Path,
+		Status:    record.Status,
+		Summary:   record.Summary,
+		Error:     record.Error,
+		Provider:  record.Provider,
+		Model:     record.Model,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+	}
+	if record.Structure != "" {
+		var structure Structure
+		if json.Unmarshal([]byte(record.Structure), &structure) == nil {
+			summary.Structure = &structure
+		}
+	}
+	return summary
+}
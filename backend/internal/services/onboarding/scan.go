@@ -0,0 +1,488 @@
+package onboarding
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jacklau/prism/internal/ignore"
+)
+
+const (
+	// maxScanFiles bounds how many files a scan looks at
+	maxScanFiles = 20000
+	// maxManifestDepth is how deep below the repository root manifests are
+	// read for build commands
+	maxManifestDepth = 2
+	// maxEntryPoints, maxModules and maxLanguages cap the scan's lists
+	maxEntryPoints = 20
+	maxModules     = 40
+	maxLanguages   = 10
+	// maxManifestSize is the largest manifest that is read
+	maxManifestSize = 256 * 1024
+)
+
+// Structure is the structural summary of a repository
+type Structure struct {
+	Name          string         `json:"name"`
+	Files         int            `json:"files"`
+	Truncated     bool           `json:"truncated,omitempty"` // The scan stopped at its file limit
+	Languages     []Language     `json:"languages"`
+	Manifests     []string       `json:"manifests"`
+	EntryPoints   []string       `json:"entry_points"`
+	BuildCommands []BuildCommand `json:"build_commands"`
+	Modules       []Module       `json:"modules"`
+}
+
+// Language is a programming language used in a repository
+type Language struct {
+	Name  string  `json:"name"`
+	Files int     `json:"files"`
+	Share float64 `json:"share"` // Percent of the repository's code by size
+}
+
+// BuildCommand is a command for building, testing or running a repository,
+// read from one of its manifests
+type BuildCommand struct {
+	Purpose string `json:"purpose"` // install, build, test, run, lint or container
+	Command string `json:"command"`
+	Dir     string `json:"dir,omitempty"` // Directory to run it in, "" for the root
+	Source  string `json:"source"`        // Manifest the command comes from
+}
+
+// Module is a top-level directory of a repository, or a package within a
+// source directory such as src or internal
+type Module struct {
+	Path     string `json:"path"`
+	Files    int    `json:"files"`
+	Language string `json:"language,omitempty"` // Most used language, by files
+}
+
+// languages maps file extensions to programming languages
+var languages = map[string]string{
+	".go": "Go", ".py": "Python", ".rs": "Rust", ".java": "Java", ".kt": "Kotlin", ".kts": "Kotlin",
+	".js": "JavaScript", ".jsx": "JavaScript", ".mjs": "JavaScript", ".cjs": "JavaScript",
+	".ts": "TypeScript", ".tsx": "TypeScript", ".vue": "Vue", ".svelte": "Svelte",
+	".rb": "Ruby", ".php": "PHP", ".cs": "C#", ".fs": "F#", ".swift": "Swift", ".m": "Objective-C",
+	".c": "C", ".h": "C", ".cpp": "C++", ".cc": "C++", ".cxx": "C++", ".hpp": "C++",
+	".scala": "Scala", ".dart": "Dart", ".ex": "Elixir", ".exs": "Elixir", ".erl": "Erlang",
+	".hs": "Haskell", ".clj": "Clojure", ".lua": "Lua", ".r": "R", ".jl": "Julia", ".zig": "Zig",
+	".sh": "Shell", ".bash": "Shell", ".ps1": "PowerShell", ".sql": "SQL",
+	".html": "HTML", ".css": "CSS", ".scss": "CSS", ".sass": "CSS", ".less": "CSS",
+}
+
+// sourceDirs hold a repository's packages, so their subdirectories are
+// listed as modules too
+var sourceDirs = map[string]bool{
+	"src": true, "internal": true, "pkg": true, "lib": true, "libs": true, "cmd": true,
+	"packages": true, "apps": true, "services": true, "modules": true, "crates": true,
+}
+
+// entryPointNames are file names that usually start a program
+var entryPointNames = map[string]bool{
+	"main.py": true, "__main__.py": true, "app.py": true, "manage.py": true, "wsgi.py": true, "asgi.py": true,
+	"main.rs": true, "main.ts": true, "main.tsx": true, "main.js": true, "index.ts": true, "index.tsx": true,
+	"index.js": true, "server.ts": true, "server.js": true, "app.ts": true, "app.js": true,
+	"Program.cs": true, "Main.java": true, "Application.java": true, "main.c": true, "main.cpp": true,
+}
+
+// goMainPackage matches the package clause of a Go program
+var goMainPackage = regexp.MustCompile(`(?m)^package main\b`)
+
+// makeTarget matches a Makefile rule's target
+var makeTarget = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_.-]*)\s*:([^=]|$)`)
+
+// commandPurposes maps script and target names to what they are for
+var commandPurposes = map[string]string{
+	"install": "install", "deps": "install", "setup": "install",
+	"build": "build", "compile": "build", "all": "build",
+	"test": "test", "tests": "test", "check": "test",
+	"start": "run", "run": "run", "dev": "run", "serve": "run",
+	"lint": "lint", "fmt": "lint", "format": "lint",
+}
+
+// scannedFile is a file found by a scan
+type scannedFile struct {
+	rel  string // Slash-separated path relative to the repository
+	size int64
+}
+
+// scan builds the structural summary of the repository in dir. Files the
+// workspace ignores are left out.
+func scan(matcher *ignore.Matcher, rootPath, dir string) (*Structure, error) {
+	structure := &Structure{
+		Name:          filepath.Base(dir),
+		Languages:     []Language{},
+		Manifests:     []string{},
+		EntryPoints:   []string{},
+		BuildCommands: []BuildCommand{},
+		Modules:       []Module{},
+	}
+
+	var files []scannedFile
+	err := filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip unreadable entries
+		}
+		if filePath == dir {
+			return nil
+		}
+		rootRel, err := filepath.Rel(rootPath, filePath)
+		if err != nil {
+			return nil
+		}
+		if matcher.Match(rootRel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, scannedFile{rel: filepath.ToSlash(rel), size: info.Size()})
+		if len(files) >= maxScanFiles {
+			structure.Truncated = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan repository: %w", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].rel < files[j].rel })
+
+	structure.Files = len(files)
+	structure.Languages = countLanguages(files)
+	structure.Modules = findModules(files)
+
+	present := make(map[string]bool, len(files))
+	for _, file := range files {
+		present[file.rel] = true
+	}
+	entryPoints := make(map[string]bool)
+	for _, file := range files {
+		depth := strings.Count(file.rel, "/")
+		name := path.Base(file.rel)
+		if depth <= maxManifestDepth {
+			if commands, entries, ok := readManifest(dir, file.rel, present); ok {
+				structure.Manifests = append(structure.Manifests, file.rel)
+				structure.BuildCommands = append(structure.BuildCommands, commands...)
+				for _, entry := range entries {
+					entryPoints[entry] = true
+				}
+			}
+		}
+		if isEntryPoint(dir, file.rel, name, depth) {
+			entryPoints[file.rel] = true
+		}
+	}
+	for entry := range entryPoints {
+		structure.EntryPoints = append(structure.EntryPoints, entry)
+	}
+	sort.Strings(structure.EntryPoints)
+	if len(structure.EntryPoints) > maxEntryPoints {
+		structure.EntryPoints = structure.EntryPoints[:maxEntryPoints]
+	}
+	return structure, nil
+}
+
+// countLanguages totals the files and size of each language, most used first
+func countLanguages(files []scannedFile) []Language {
+	counts := make(map[string]*Language)
+	sizes := make(map[string]int64)
+	var total int64
+	for _, file := range files {
+		name, ok := languages[strings.ToLower(path.Ext(file.rel))]
+		if !ok {
+			continue
+		}
+		if counts[name] == nil {
+			counts[name] = &Language{Name: name}
+		}
+		counts[name].Files++
+		sizes[name] += file.size
+		total += file.size
+	}
+
+	result := make([]Language, 0, len(counts))
+	for name, language := range counts {
+		if total > 0 {
+			language.Share = float64(sizes[name]*1000/total) / 10
+		}
+		result = append(result, *language)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if sizes[result[i].Name] != sizes[result[j].Name] {
+			return sizes[result[i].Name] > sizes[result[j].Name]
+		}
+		return result[i].Name < result[j].Name
+	})
+	if len(result) > maxLanguages {
+		result = result[:maxLanguages]
+	}
+	return result
+}
+
+// findModules lists the top-level directories, and the packages in source
+// directories, with their file counts
+func findModules(files []scannedFile) []Module {
+	counts := make(map[string]int)
+	langs := make(map[string]map[string]int)
+	count := func(module, language string) {
+		counts[module]++
+		if language == "" {
+			return
+		}
+		if langs[module] == nil {
+			langs[module] = make(map[string]int)
+		}
+		langs[module][language]++
+	}
+
+	for _, file := range files {
+		parts := strings.Split(file.rel, "/")
+		if len(parts) < 2 || strings.HasPrefix(parts[0], ".") {
+			continue
+		}
+		language := languages[strings.ToLower(path.Ext(file.rel))]
+		count(parts[0], language)
+		// Source directories at the top or one level down, as in a
+		// monorepo's backend/internal, have their packages listed
+		for i := 0; i < 2 && i+2 < len(parts); i++ {
+			if !sourceDirs[parts[i]] {
+				continue
+			}
+			if i > 0 {
+				count(strings.Join(parts[:i+1], "/"), language)
+			}
+			count(strings.Join(parts[:i+2], "/"), language)
+		}
+	}
+
+	modules := make([]Module, 0, len(counts))
+	for modulePath, files := range counts {
+		module := Module{Path: modulePath, Files: files}
+		best := 0
+		for language, n := range langs[modulePath] {
+			if n > best || (n == best && language < module.Language) {
+				module.Language, best = language, n
+			}
+		}
+		modules = append(modules, module)
+	}
+	if len(modules) > maxModules {
+		// Keep the largest
+		sort.Slice(modules, func(i, j int) bool { return modules[i].Files > modules[j].Files })
+		modules = modules[:maxModules]
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Path < modules[j].Path })
+	return modules
+}
+
+// isEntryPoint reports whether a file looks like where a program starts
+func isEntryPoint(dir, rel, name string, depth int) bool {
+	switch {
+	case name == "main.go":
+		// Go programs can live at any depth, commonly under cmd/
+		data, err := readSmall(filepath.Join(dir, filepath.FromSlash(rel)))
+		return err == nil && goMainPackage.Match(data)
+	case strings.HasPrefix(rel, "src/bin/") && strings.HasSuffix(rel, ".rs") && depth == 2:
+		return true
+	case entryPointNames[name]:
+		// Deeper files of these names are usually modules, such as a
+		// package's index.ts
+		return depth <= 1
+	}
+	return false
+}
+
+// readManifest derives build commands and entry points from a manifest. It
+// reports false for files that aren't manifests.
+func readManifest(dir, rel string, present map[string]bool) ([]BuildCommand, []string, bool) {
+	manifestDir := path.Dir(rel)
+	if manifestDir == "." {
+		manifestDir = ""
+	}
+	has := func(name string) bool { return present[path.Join(manifestDir, name)] }
+	cmd := func(purpose, command string) BuildCommand {
+		return BuildCommand{Purpose: purpose, Command: command, Dir: manifestDir, Source: rel}
+	}
+
+	switch name := path.Base(rel); strings.ToLower(name) {
+	case "go.mod":
+		return []BuildCommand{cmd("build", "go build ./..."), cmd("test", "go test ./...")}, nil, true
+
+	case "package.json":
+		data, err := readSmall(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, nil, false
+		}
+		var pkg struct {
+			Main    string            `json:"main"`
+			Bin     json.RawMessage   `json:"bin"`
+			Scripts map[string]string `json:"scripts"`
+		}
+		if err := json.Unmarshal(data, &pkg); err != nil {
+			return nil, nil, true
+		}
+		runner := "npm"
+		switch {
+		case has("pnpm-lock.yaml"):
+			runner = "pnpm"
+		case has("yarn.lock"):
+			runner = "yarn"
+		case has("bun.lockb"), has("bun.lock"):
+			runner = "bun"
+		}
+		commands := []BuildCommand{cmd("install", runner+" install")}
+		scripts := make([]string, 0, len(pkg.Scripts))
+		for script := range pkg.Scripts {
+			scripts = append(scripts, script)
+		}
+		sort.Strings(scripts)
+		for _, script := range scripts {
+			if purpose, ok := commandPurposes[script]; ok && purpose != "install" {
+				commands = append(commands, cmd(purpose, runner+" run "+script))
+			}
+		}
+
+		var entries []string
+		if pkg.Main != "" {
+			entries = append(entries, path.Clean(path.Join(manifestDir, pkg.Main)))
+		}
+		var bin string
+		var bins map[string]string
+		if json.Unmarshal(pkg.Bin, &bin) == nil && bin != "" {
+			entries = append(entries, path.Clean(path.Join(manifestDir, bin)))
+		} else if json.Unmarshal(pkg.Bin, &bins) == nil {
+			for _, target := range bins {
+				entries = append(entries, path.Clean(path.Join(manifestDir, target)))
+			}
+		}
+		return commands, entries, true
+
+	case "cargo.toml":
+		commands := []BuildCommand{cmd("build", "cargo build"), cmd("test", "cargo test")}
+		if has("src/main.rs") {
+			commands = append(commands, cmd("run", "cargo run"))
+		}
+		return commands, nil, true
+
+	case "pyproject.toml":
+		commands := []BuildCommand{cmd("install", "pip install -e .")}
+		if has("pytest.ini") || has("conftest.py") || has("tests/__init__.py") || has("tests/conftest.py") {
+			commands = append(commands, cmd("test", "pytest"))
+		}
+		return commands, nil, true
+
+	case "requirements.txt":
+		return []BuildCommand{cmd("install", "pip install -r requirements.txt")}, nil, true
+
+	case "makefile":
+		data, err := readSmall(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, nil, false
+		}
+		var commands []BuildCommand
+		seen := make(map[string]bool)
+		for _, line := range strings.Split(string(data), "\n") {
+			match := makeTarget.FindStringSubmatch(line)
+			if match == nil || seen[match[1]] {
+				continue
+			}
+			seen[match[1]] = true
+			if purpose, ok := commandPurposes[match[1]]; ok {
+				commands = append(commands, cmd(purpose, "make "+match[1]))
+			}
+		}
+		return commands, nil, true
+
+	case "pom.xml":
+		return []BuildCommand{cmd("build", "mvn package"), cmd("test", "mvn test")}, nil, true
+
+	case "build.gradle", "build.gradle.kts":
+		gradle := "gradle"
+		if has("gradlew") {
+			gradle = "./gradlew"
+		}
+		return []BuildCommand{cmd("build", gradle+" build"), cmd("test", gradle+" test")}, nil, true
+
+	case "dockerfile":
+		return []BuildCommand{cmd("container", "docker build .")}, nil, true
+
+	case "docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml":
+		return []BuildCommand{cmd("container", "docker compose up")}, nil, true
+	}
+	return nil, nil, false
+}
+
+// readSmall reads a file if it is no bigger than a manifest may be
+func readSmall(filePath string) ([]byte, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxManifestSize {
+		return nil, fmt.Errorf("%s is too large", filePath)
+	}
+	return os.ReadFile(filePath)
+}
+
+// render writes a structure as Markdown
+func (s *Structure) render() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Repository %s: %d files", s.Name, s.Files)
+	if s.Truncated {
+		b.WriteString(" (scan stopped early)")
+	}
+	b.WriteString("\n")
+
+	if len(s.Languages) > 0 {
+		b.WriteString("\nLanguages:\n")
+		for _, language := range s.Languages {
+			fmt.Fprintf(&b, "- %s: %d files, %.1f%%\n", language.Name, language.Files, language.Share)
+		}
+	}
+	if len(s.EntryPoints) > 0 {
+		b.WriteString("\nEntry points:\n")
+		for _, entry := range s.EntryPoints {
+			fmt.Fprintf(&b, "- %s\n", entry)
+		}
+	}
+	if len(s.BuildCommands) > 0 {
+		b.WriteString("\nBuild commands:\n")
+		for _, command := range s.BuildCommands {
+			if command.Dir != "" {
+				fmt.Fprintf(&b, "- %s: `cd %s && %s` (%s)\n", command.Purpose, command.Dir, command.Command, command.Source)
+			} else {
+				fmt.Fprintf(&b, "- %s: `%s` (%s)\n", command.Purpose, command.Command, command.Source)
+			}
+		}
+	}
+	if len(s.Modules) > 0 {
+		b.WriteString("\nModules:\n")
+		for _, module := range s.Modules {
+			if module.Language != "" {
+				fmt.Fprintf(&b, "- %s/: %d files, mostly %s\n", module.Path, module.Files, module.Language)
+			} else {
+				fmt.Fprintf(&b, "- %s/: %d files\n", module.Path, module.Files)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,143 @@
+package pinning
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/sandbox"
+)
+
+const contextHeader = `The user has pinned the following workspace files to this conversation. Their latest contents are included below on every request, so you do not need to read them with file_read. Files marked as truncated were shortened to fit the context budget; read them directly if you need the omitted part.`
+
+// Config holds configuration for pinned file context
+type Config struct {
+	// TokenBudget is the approximate number of tokens shared by all pinned files
+	TokenBudget int
+}
+
+// ContextBuilder renders the files pinned to a conversation into prompt context
+type ContextBuilder struct {
+	pinnedFileRepo *repository.PinnedFileRepository
+	sandboxService *sandbox.Service
+	config         Config
+}
+
+// NewContextBuilder creates a new pinned file context builder
+func NewContextBuilder(
+	pinnedFileRepo *repository.PinnedFileRepository,
+	sandboxService *sandbox.Service,
+	config Config,
+) *ContextBuilder {
+	return &ContextBuilder{
+		pinnedFileRepo: pinnedFileRepo,
+		sandboxService: sandboxService,
+		config:         config,
+	}
+}
+
+// pinnedContent is a pinned file with its current contents
+type pinnedContent struct {
+	path      string
+	content   string
+	missing   bool
+	truncated bool
+	lines     int // line count of the full file
+}
+
+// Build returns the context block for a conversation's pinned files, or an
+// empty string if nothing is pinned. Files are read fresh on every call.
+func (b *ContextBuilder) Build(conversationID string) string {
+	pins, err := b.pinnedFileRepo.ListByConversationID(conversationID)
+	if err != nil {
+		log.Printf("Failed to list pinned files for conversation %s: %v", conversationID, err)
+		return ""
+	}
+	if len(pins) == 0 {
+		return ""
+	}
+
+	files := make([]*pinnedContent, 0, len(pins))
+	for _, pin := range pins {
+		file := &pinnedContent{path: pin.Path}
+		content, err := b.sandboxService.GetFileContent(pin.UserID, pin.Path)
+		if err != nil {
+			file.missing = true
+		} else {
+			file.content = content
+			file.lines = strings.Count(content, "\n") + 1
+		}
+		files = append(files, file)
+	}
+
+	fitToBudget(files, b.config.TokenBudget*llm.CharsPerToken)
+
+	var sb strings.Builder
+	sb.WriteString(contextHeader)
+	for _, file := range files {
+		sb.WriteString("\n\n")
+		switch {
+		case file.missing:
+			fmt.Fprintf(&sb, "<pinned_file path=%q status=\"unavailable\" />", file.path)
+		case file.truncated:
+			shown := 0
+			if file.content != "" {
+				shown = strings.Count(file.content, "\n") + 1
+			}
+			fmt.Fprintf(&sb, "<pinned_file path=%q truncated=\"true\">\n%s\n... [truncated: showing %d of %d lines]\n</pinned_file>",
+				file.path, file.content, shown, file.lines)
+		default:
+			fmt.Fprintf(&sb, "<pinned_file path=%q>\n%s\n</pinned_file>", file.path, file.content)
+		}
+	}
+	return sb.String()
+}
+
+// fitToBudget truncates file contents so their total length stays within
+// budget characters. Smaller files are kept whole where possible and the
+// remaining space is split evenly between the larger ones.
+func fitToBudget(files []*pinnedContent, budget int) {
+	if budget <= 0 {
+		return
+	}
+
+	order := make([]*pinnedContent, 0, len(files))
+	for _, file := range files {
+		if !file.missing {
+			order = append(order, file)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(order[i].content) < len(order[j].content)
+	})
+
+	remaining := budget
+	for i, file := range order {
+		share := remaining / (len(order) - i)
+		if len(file.content) > share {
+			file.content = truncate(file.content, share)
+			file.truncated = true
+		}
+		remaining -= len(file.content)
+	}
+}
+
+// truncate shortens s to at most limit bytes, preferring to cut at a line
+// boundary and never splitting a UTF-8 sequence
+func truncate(s string, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	cut := s[:limit]
+	if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+		return cut[:i]
+	}
+	for len(cut) > 0 && !utf8.ValidString(cut) {
+		cut = cut[:len(cut)-1]
+	}
+	return cut
+}
@@ -0,0 +1,596 @@
+// Package prreview reviews GitHub pull requests with agents. Each changed
+// file gets its own reviewer agent, given the file's diff and the pull
+// request and file around it; their findings are aggregated into one review,
+// which can be posted back to the pull request with the user's GitHub token.
+package prreview
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jacklau/prism/internal/agent"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations/github"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/security"
+)
+
+const (
+	defaultMaxFiles    = 30
+	defaultFileTimeout = 5 * time.Minute
+
+	// maxPatchBytes skips files whose diff is too big to review in one go
+	maxPatchBytes = 60 * 1024
+	// maxFileContextBytes is the largest file whose full content is given to
+	// its reviewer alongside the diff
+	maxFileContextBytes = 48 * 1024
+	// maxDescriptionChars truncates long pull request descriptions
+	maxDescriptionChars = 4000
+	// maxListedFiles caps the changed files listed in each reviewer's context
+	maxListedFiles = 200
+
+	systemPrompt = `You are a meticulous code reviewer reviewing one file of a GitHub pull request. Report real problems the change introduces or exposes: bugs, security issues, data loss, race conditions, broken error handling, performance traps and clear maintainability problems. Don't comment on style a formatter would fix, don't restate what the change does and don't praise it.
+
+Refer to lines by the numbers at the start of the diff lines, which are line numbers in the new version of the file; use 0 for a finding about the file as a whole.
+
+Reply with only a JSON object, with no other text:
+{"summary": "<one or two sentences on the change to this file>", "findings": [{"line": 12, "severity": "critical|warning|suggestion", "message": "<the problem and how to fix it>"}]}
+Leave findings empty if the change looks right.`
+)
+
+// Finding severities, most severe first
+const (
+	SeverityCritical   = "critical"
+	SeverityWarning    = "warning"
+	SeveritySuggestion = "suggestion"
+)
+
+var (
+	// ErrGitHubNotConnected is returned when posting a review for a user
+	// without a connected GitHub account
+	ErrGitHubNotConnected = errors.New("GitHub account not connected")
+	// ErrNoReviewableFiles is returned for pull requests with no text
+	// changes to review
+	ErrNoReviewableFiles = errors.New("pull request has no reviewable files")
+	// ErrNoAPIKey is returned when the review model's provider has no key
+	ErrNoAPIKey = errors.New("no API key configured for the review provider")
+)
+
+// hunkHeaderPattern matches a diff hunk header, capturing the first line of
+// the hunk in the new version of the file
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// Config holds configuration for pull request reviews
+type Config struct {
+	// Provider and Model review pull requests that don't choose a model
+	Provider string
+	Model    string
+	// MaxFiles is how many files of a pull request are reviewed; the rest
+	// are listed as skipped
+	MaxFiles int
+	// FileTimeout bounds each file's reviewer agent
+	FileTimeout time.Duration
+}
+
+// Request asks for a pull request review
+type Request struct {
+	URL      string `json:"url" validate:"required,max=500"`
+	Post     bool   `json:"post"` // Post the findings to the pull request as a review
+	Provider string `json:"provider" validate:"max=50"`
+	Model    string `json:"model" validate:"max=100"`
+}
+
+// Finding is a problem a reviewer found
+type Finding struct {
+	Path     string `json:"path"`
+	Line     int    `json:"line,omitempty"` // Line in the new version of the file, 0 for the file as a whole
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// FileReview is the review of one changed file
+type FileReview struct {
+	Path     string    `json:"path"`
+	Status   string    `json:"status"`
+	Summary  string    `json:"summary,omitempty"`
+	Findings []Finding `json:"findings"`
+	Skipped  string    `json:"skipped,omitempty"` // Why the file wasn't reviewed
+	Error    string    `json:"error,omitempty"`   // Why its review failed
+}
+
+// Result is the aggregated review of a pull request
+type Result struct {
+	Repo      string       `json:"repo"`
+	Number    int          `json:"number"`
+	Title     string       `json:"title"`
+	URL       string       `json:"url"`
+	HeadSHA   string       `json:"head_sha"`
+	Provider  string       `json:"provider"`
+	Model     string       `json:"model"`
+	Files     []FileReview `json:"files"`
+	Findings  []Finding    `json:"findings"` // Every file's findings, most severe first
+	Summary   string       `json:"summary"`  // Markdown summary of the review
+	Posted    bool         `json:"posted"`
+	ReviewURL string       `json:"review_url,omitempty"`
+}
+
+// Service reviews pull requests
+type Service struct {
+	github            *github.Client
+	agents            *agent.Manager
+	userRepo          *repository.UserRepository
+	llmManager        *llm.Manager
+	providerKeyRepo   *repository.ProviderKeyRepository
+	encryptionService *security.EncryptionService
+	config            Config
+}
+
+// NewService creates a new pull request review service
+func NewService(
+	githubClient *github.Client,
+	agents *agent.Manager,
+	userRepo *repository.UserRepository,
+	llmManager *llm.Manager,
+	providerKeyRepo *repository.ProviderKeyRepository,
+	encryptionService *security.EncryptionService,
+	config Config,
+) *Service {
+	if config.MaxFiles <= 0 {
+		config.MaxFiles = defaultMaxFiles
+	}
+	if config.FileTimeout <= 0 {
+		config.FileTimeout = defaultFileTimeout
+	}
+	return &Service{
+		github:            githubClient,
+		agents:            agents,
+		userRepo:          userRepo,
+		llmManager:        llmManager,
+		providerKeyRepo:   providerKeyRepo,
+		encryptionService: encryptionService,
+		config:            config,
+	}
+}
+
+// Review reviews the pull request at a URL for a user, posting the review
+// if asked. It blocks until every file's reviewer has finished.
+func (s *Service) Review(userID string, req Request) (*Result, error) {
+	repo, number, err := github.ParsePullRequestURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	provider, model := s.config.Provider, s.config.Model
+	if req.Model != "" {
+		model = req.Model
+		if req.Provider != "" {
+			provider = req.Provider
+		}
+	}
+	return s.review(userID, repo, number, provider, model, req.Post)
+}
+
+// ReviewPullRequest reviews the pull request of a webhook event for the user
+// who configured the webhook
+func (s *Service) ReviewPullRequest(userID string, event *github.PullRequestEvent, review *github.AutoReviewConfig) error {
+	if event.Repo == nil || event.PullRequest == nil {
+		return fmt.Errorf("pull request event has no repository or pull request")
+	}
+	provider, model := s.config.Provider, s.config.Model
+	if review.Model != "" {
+		model = review.Model
+		if review.Provider != "" {
+			provider = review.Provider
+		}
+	}
+
+	result, err := s.review(userID, event.Repo.FullName, event.PullRequest.Number, provider, model, review.Post)
+	if err != nil {
+		return err
+	}
+	log.Printf("Reviewed pull request #%d in %s: %d findings (posted: %v)", result.Number, result.Repo, len(result.Findings), result.Posted)
+	return nil
+}
+
+// review runs the reviewers over a pull request and aggregates their findings
+func (s *Service) review(userID, repo string, number int, provider, model string, post bool) (*Result, error) {
+	if provider == "" || model == "" {
+		return nil, agent.ErrInvalidAgentConfig
+	}
+	token, err := s.githubToken(userID)
+	if err != nil {
+		return nil, err
+	}
+	if post && token == "" {
+		return nil, ErrGitHubNotConnected
+	}
+
+	creds := s.llmManager.UserCredentials(s.providerKeyRepo, s.encryptionService, userID, provider)
+	if !s.llmManager.CanUse(provider, creds) {
+		return nil, ErrNoAPIKey
+	}
+
+	pr, err := s.github.GetPullRequest(token, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.github.ListPullRequestFiles(token, repo, number)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Repo:     repo,
+		Number:   number,
+		Title:    pr.Title,
+		URL:      pr.HTMLURL,
+		Provider: provider,
+		Model:    model,
+		Files:    make([]FileReview, len(files)),
+		Findings: []Finding{},
+	}
+	if pr.Head != nil {
+		result.HeadSHA = pr.Head.SHA
+	}
+
+	// Pick the files to review and give each its own reviewer
+	prContext := pullRequestContext(repo, pr, files)
+	var tasks []*agent.Task
+	taskFiles := make(map[string]int)
+	commentable := make(map[string]map[int]bool)
+	for i, file := range files {
+		result.Files[i] = FileReview{Path: file.Filename, Status: file.Status, Findings: []Finding{}}
+		switch {
+		case file.Status == "removed":
+			result.Files[i].Skipped = "removed"
+		case file.Patch == "":
+			result.Files[i].Skipped = "no text diff"
+		case len(file.Patch) > maxPatchBytes:
+			result.Files[i].Skipped = "diff too large"
+		case len(tasks) >= s.config.MaxFiles:
+			result.Files[i].Skipped = "over the file limit"
+		}
+		if result.Files[i].Skipped != "" {
+			continue
+		}
+
+		numbered, lines := annotatePatch(file.Patch)
+		commentable[file.Filename] = lines
+		task := agent.NewTask(
+			filePrompt(file, numbered),
+			agent.WithContext(prContext+s.fileContext(token, repo, result.HeadSHA, file)),
+			agent.WithTimeout(s.config.FileTimeout),
+		)
+		taskFiles[task.ID] = i
+		tasks = append(tasks, task)
+	}
+	if len(tasks) == 0 {
+		return nil, ErrNoReviewableFiles
+	}
+
+	execution, err := s.agents.RunParallel(context.Background(), tasks, agent.AgentConfig{
+		Name:         "pr-reviewer",
+		Provider:     provider,
+		Model:        model,
+		SystemPrompt: systemPrompt,
+		Credentials:  creds,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start reviewers: %w", err)
+	}
+	execution.Wait()
+
+	reported := make(map[string]bool)
+	for _, agentResult := range execution.GetResults() {
+		i, ok := taskFiles[agentResult.TaskID]
+		if !ok {
+			continue
+		}
+		reported[agentResult.TaskID] = true
+		applyAgentResult(&result.Files[i], agentResult)
+		result.Findings = append(result.Findings, result.Files[i].Findings...)
+	}
+	for _, task := range tasks {
+		// Reviewers that never reported, such as ones cut short by shutdown
+		if !reported[task.ID] {
+			result.Files[taskFiles[task.ID]].Error = "reviewer did not finish"
+		}
+	}
+	sortFindings(result.Findings)
+	result.Summary = renderSummary(result, result.Findings)
+
+	if post {
+		if err := s.post(token, result, commentable); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// post posts a review to the pull request, with findings on lines of the
+// diff as inline comments and the rest in the review's body
+func (s *Service) post(token string, result *Result, commentable map[string]map[int]bool) error {
+	var comments []github.ReviewComment
+	var bodyFindings []Finding
+	for _, finding := range result.Findings {
+		if finding.Line > 0 && commentable[finding.Path][finding.Line] {
+			comments = append(comments, github.ReviewComment{
+				Path: finding.Path,
+				Line: finding.Line,
+				Side: "RIGHT",
+				Body: fmt.Sprintf("**%s**: %s", finding.Severity, finding.Message),
+			})
+			continue
+		}
+		bodyFindings = append(bodyFindings, finding)
+	}
+
+	review := &github.ReviewRequest{
+		CommitID: result.HeadSHA,
+		Body:     renderSummary(result, bodyFindings),
+		Event:    "COMMENT",
+		Comments: comments,
+	}
+	posted, err := s.github.CreateReview(token, result.Repo, result.Number, review)
+
+	// GitHub rejects the whole review if it can't place a comment, such as
+	// when the pull request moved on while it was being reviewed; fall back
+	// to listing every finding in the body
+	var apiErr *github.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == 422 && len(comments) > 0 {
+		review.Body = result.Summary
+		review.Comments = nil
+		posted, err = s.github.CreateReview(token, result.Repo, result.Number, review)
+	}
+	if err != nil {
+		return err
+	}
+
+	result.Posted = true
+	result.ReviewURL = posted.HTMLURL
+	return nil
+}
+
+// githubToken returns the user's GitHub OAuth token, or "" if they haven't
+// connected GitHub
+func (s *Service) githubToken(userID string) (string, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil || user.GitHubToken == "" {
+		return "", nil
+	}
+	token, err := s.encryptionService.DecryptHex(user.GitHubToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt GitHub token: %w", err)
+	}
+	return string(token), nil
+}
+
+// fileContext returns the full content of a changed file at the head commit,
+// so its reviewer can see the code around the diff
+func (s *Service) fileContext(token, repo, ref string, file github.PullRequestFile) string {
+	if ref == "" {
+		return ""
+	}
+	content, err := s.github.GetFileContent(token, repo, file.Filename, ref)
+	if err != nil {
+		log.Printf("Failed to get %s for review: %v", file.Filename, err)
+		return ""
+	}
+	if len(content) > maxFileContextBytes {
+		return fmt.Sprintf("\n\n%s is too large to include in full; review it from the diff.", file.Filename)
+	}
+	return fmt.Sprintf("\n\nFull content of %s after the change:\n```\n%s\n```", file.Filename, content)
+}
+
+// pullRequestContext describes the pull request every reviewer works in
+func pullRequestContext(repo string, pr *github.PullRequest, files []github.PullRequestFile) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Pull request #%d in %s: %s\n", pr.Number, repo, pr.Title)
+	if pr.Base != nil && pr.Head != nil {
+		fmt.Fprintf(&b, "Merging %s into %s\n", pr.Head.Ref, pr.Base.Ref)
+	}
+
+	if description := strings.TrimSpace(pr.Body); description != "" {
+		if len(description) > maxDescriptionChars {
+			description = description[:maxDescriptionChars] + "…"
+		}
+		fmt.Fprintf(&b, "\nDescription:\n%s\n", description)
+	}
+
+	b.WriteString("\nFiles changed:\n")
+	for i, file := range files {
+		if i == maxListedFiles {
+			fmt.Fprintf(&b, "- and %d more\n", len(files)-maxListedFiles)
+			break
+		}
+		fmt.Fprintf(&b, "- %s (%s, +%d -%d)\n", file.Filename, file.Status, file.Additions, file.Deletions)
+	}
+	return b.String()
+}
+
+// filePrompt asks a reviewer to review one file's diff
+func filePrompt(file github.PullRequestFile, numberedPatch string) string {
+	status := file.Status
+	if file.PreviousFilename != "" {
+		status += " from " + file.PreviousFilename
+	}
+	return fmt.Sprintf("Review the changes to %s (%s). The diff, with lines numbered in the new version of the file:\n```diff\n%s\n```",
+		file.Filename, status, numberedPatch)
+}
+
+// annotatePatch numbers the lines of a diff by their line in the new version
+// of the file, and returns the lines a review comment can be placed on:
+// those added or kept as context
+func annotatePatch(patch string) (string, map[int]bool) {
+	commentable := make(map[int]bool)
+	var b strings.Builder
+	line := 0
+	for _, text := range strings.Split(patch, "\n") {
+		if match := hunkHeaderPattern.FindStringSubmatch(text); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			b.WriteString(text + "\n")
+			continue
+		}
+		if line == 0 || strings.HasPrefix(text, "-") || strings.HasPrefix(text, `\`) {
+			fmt.Fprintf(&b, "%6s %s\n", "", text)
+			continue
+		}
+		commentable[line] = true
+		fmt.Fprintf(&b, "%6d %s\n", line, text)
+		line++
+	}
+	return strings.TrimRight(b.String(), "\n"), commentable
+}
+
+// agentReview is the review a reviewer agent replies with
+type agentReview struct {
+	Summary  string `json:"summary"`
+	Findings []struct {
+		Line     int    `json:"line"`
+		Severity string `json:"severity"`
+		Message  string `json:"message"`
+	} `json:"findings"`
+}
+
+// applyAgentResult records a reviewer's reply on its file's review
+func applyAgentResult(file *FileReview, result *agent.AgentResult) {
+	if !result.Success {
+		file.Error = result.Error
+		if file.Error == "" {
+			file.Error = string(result.Status)
+		}
+		return
+	}
+
+	review, err := parseAgentReview(result.Output)
+	if err != nil {
+		file.Error = "reviewer replied with an unreadable review"
+		return
+	}
+	file.Summary = strings.TrimSpace(review.Summary)
+	for _, finding := range review.Findings {
+		message := strings.TrimSpace(finding.Message)
+		if message == "" {
+			continue
+		}
+		line := finding.Line
+		if line < 0 {
+			line = 0
+		}
+		file.Findings = append(file.Findings, Finding{
+			Path:     file.Path,
+			Line:     line,
+			Severity: normalizeSeverity(finding.Severity),
+			Message:  message,
+		})
+	}
+}
+
+// parseAgentReview parses a reviewer's reply, tolerating text or a code
+// fence around the JSON object
+func parseAgentReview(output string) (*agentReview, error) {
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in reply")
+	}
+	var review agentReview
+	if err := json.Unmarshal([]byte(output[start:end+1]), &review); err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// normalizeSeverity maps the severities reviewers use onto the three known ones
+func normalizeSeverity(severity string) string {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case SeverityCritical, "error", "high", "blocker":
+		return SeverityCritical
+	case SeverityWarning, "medium", "major":
+		return SeverityWarning
+	default:
+		return SeveritySuggestion
+	}
+}
+
+// severityRank orders severities, most severe first
+func severityRank(severity string) int {
+	switch severity {
+	case SeverityCritical:
+		return 0
+	case SeverityWarning:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// sortFindings sorts findings by severity, then by file and line
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if severityRank(a.Severity) != severityRank(b.Severity) {
+			return severityRank(a.Severity) < severityRank(b.Severity)
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Line < b.Line
+	})
+}
+
+// renderSummary renders the markdown summary of a review, listing the given
+// findings
+func renderSummary(result *Result, findings []Finding) string {
+	counts := make(map[string]int)
+	reviewed := 0
+	for _, file := range result.Files {
+		if file.Skipped == "" {
+			reviewed++
+		}
+		for _, finding := range file.Findings {
+			counts[finding.Severity]++
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("### Prism review\n\n")
+	fmt.Fprintf(&b, "Reviewed %d of %d files with %s/%s: %d critical, %d warnings, %d suggestions.\n",
+		reviewed, len(result.Files), result.Provider, result.Model,
+		counts[SeverityCritical], counts[SeverityWarning], counts[SeveritySuggestion])
+
+	if len(findings) > 0 {
+		b.WriteString("\n")
+		for _, finding := range findings {
+			location := finding.Path
+			if finding.Line > 0 {
+				location = fmt.Sprintf("%s:%d", finding.Path, finding.Line)
+			}
+			fmt.Fprintf(&b, "- **%s** `%s`: %s\n", finding.Severity, location, finding.Message)
+		}
+	}
+
+	var notes []string
+	for _, file := range result.Files {
+		switch {
+		case file.Error != "":
+			notes = append(notes, fmt.Sprintf("- `%s`: review failed (%s)", file.Path, file.Error))
+		case file.Skipped != "" && file.Skipped != "removed":
+			notes = append(notes, fmt.Sprintf("- `%s`: not reviewed (%s)", file.Path, file.Skipped))
+		}
+	}
+	if len(notes) > 0 {
+		b.WriteString("\n" + strings.Join(notes, "\n") + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,175 @@
+// Package ratelimit limits how often a client may hit an endpoint or send a
+// WebSocket message, using a sliding window per key (an IP address or a user
+// ID). Unlike a fixed window, a sliding window does not let a client send
+// twice the limit across a window boundary.
+package ratelimit
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limiter names
+const (
+	Login    = "login"
+	Register = "register"
+	Chat     = "chat"
+	Agent    = "agent"
+	Tool     = "tool" // Tool calls, including those agents make
+
+	// Lower chat and agent limits applied to guests on top of the above
+	GuestChat  = "guest_chat"
+	GuestAgent = "guest_agent"
+)
+
+// Limiter allows at most limit events per key within any window-long span
+type Limiter struct {
+	name   string
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	events    map[string][]time.Time // Event times per key, oldest first
+	lastSweep time.Time
+	allowed   uint64
+	rejected  uint64
+}
+
+// NewLimiter creates a limiter. Returns nil if limit is not positive; a nil
+// limiter allows everything.
+func NewLimiter(name string, limit int, window time.Duration) *Limiter {
+	if limit <= 0 || window <= 0 {
+		return nil
+	}
+	return &Limiter{
+		name:   name,
+		limit:  limit,
+		window: window,
+		events: make(map[string][]time.Time),
+	}
+}
+
+// Allow records an event for key if it is within the limit. When it is not,
+// it returns false and how long until the key may try again.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	now := time.Now()
+	cutoff := now.Add(-l.window)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now, cutoff)
+
+	events := l.events[key]
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	events = events[i:]
+
+	if len(events) >= l.limit {
+		l.events[key] = events
+		l.rejected++
+		return false, events[0].Sub(cutoff)
+	}
+
+	l.events[key] = append(events, now)
+	l.allowed++
+	return true, 0
+}
+
+// sweep drops keys with no events inside the window, at most once per
+// window, so idle clients don't accumulate. Callers hold mu.
+func (l *Limiter) sweep(now, cutoff time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+	for key, events := range l.events {
+		if len(events) == 0 || !events[len(events)-1].After(cutoff) {
+			delete(l.events, key)
+		}
+	}
+}
+
+// Stats reports a limiter's configuration and counters
+type Stats struct {
+	Name          string `json:"name"`
+	Limit         int    `json:"limit"`
+	WindowSeconds int    `json:"window_seconds"`
+	Allowed       uint64 `json:"allowed"`
+	Rejected      uint64 `json:"rejected"`
+	ActiveKeys    int    `json:"active_keys"` // Keys with events in the last window
+}
+
+// Stats returns the limiter's counters
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return Stats{
+		Name:          l.name,
+		Limit:         l.limit,
+		WindowSeconds: int(l.window / time.Second),
+		Allowed:       l.allowed,
+		Rejected:      l.rejected,
+		ActiveKeys:    len(l.events),
+	}
+}
+
+// Set holds the server's named limiters
+type Set struct {
+	limiters map[string]*Limiter
+
+	// OnLimited, if set, is called whenever a request is rejected
+	OnLimited func(name, key string)
+}
+
+// NewSet creates an empty set
+func NewSet() *Set {
+	return &Set{limiters: make(map[string]*Limiter)}
+}
+
+// Add registers a limiter under its name. Nil (disabled) limiters are
+// ignored.
+func (s *Set) Add(l *Limiter) {
+	if l != nil {
+		s.limiters[l.name] = l
+	}
+}
+
+// Get returns the named limiter, or nil if it is not configured
+func (s *Set) Get(name string) *Limiter {
+	if s == nil {
+		return nil
+	}
+	return s.limiters[name]
+}
+
+// Allow checks key against the named limiter. Limiters that are not
+// configured allow everything.
+func (s *Set) Allow(name, key string) (bool, time.Duration) {
+	ok, retryAfter := s.Get(name).Allow(key)
+	if !ok && s.OnLimited != nil {
+		s.OnLimited(name, key)
+	}
+	return ok, retryAfter
+}
+
+// Stats returns the counters of every configured limiter, sorted by name
+func (s *Set) Stats() []Stats {
+	if s == nil {
+		return []Stats{}
+	}
+	stats := make([]Stats, 0, len(s.limiters))
+	for _, l := range s.limiters {
+		stats = append(stats, l.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
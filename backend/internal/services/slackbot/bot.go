@@ -0,0 +1,406 @@
+// Package slackbot handles the /prism Slack slash command. Linked Slack users
+// can ask an agent a question or run a command in their workspace; progress
+// is streamed into a thread in the channel the command was used in.
+package slackbot
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacklau/prism/internal/agent"
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+	"github.com/jacklau/prism/internal/integrations/github"
+	"github.com/jacklau/prism/internal/integrations/slack"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/security"
+	"github.com/jacklau/prism/internal/services/coderunner"
+)
+
+const (
+	defaultUpdateInterval = 1500 * time.Millisecond
+
+	// linkCodeTTL is how long a link code from /prism link can be redeemed
+	linkCodeTTL = 10 * time.Minute
+
+	// linkCodeAlphabet omits characters that are easily confused (0/O, 1/I)
+	linkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	linkCodeLength   = 8
+
+	systemPrompt = `You are Prism, answering a question asked from Slack. Be concise and format your answer with Slack mrkdwn: *bold*, _italic_, ` + "`code`" + ` and ` + "```code blocks```" + `.`
+)
+
+// ErrInvalidLinkCode is returned when a link code is unknown or expired
+var ErrInvalidLinkCode = errors.New("invalid or expired link code")
+
+const usage = "*Prism commands*\n" +
+	"• `/prism ask <question>` - ask an agent; the answer streams into a thread\n" +
+	"• `/prism run [--env <environment>] <command>` - run a command in your Prism workspace\n" +
+	"• `/prism link` - connect your Slack account to Prism\n" +
+	"• `/prism unlink` - disconnect your Slack account"
+
+// Config holds configuration for the Slack bot
+type Config struct {
+	// SigningSecret verifies that slash command requests come from Slack
+	SigningSecret string
+	// Provider and Model answer /prism ask
+	Provider string
+	Model    string
+	// UpdateInterval is how often streamed replies are edited
+	UpdateInterval time.Duration
+}
+
+// Command is a slash command invocation
+type Command struct {
+	TeamID      string
+	UserID      string
+	UserName    string
+	ChannelID   string
+	Text        string
+	ResponseURL string
+}
+
+// pendingLink is a link code waiting to be redeemed in Prism
+type pendingLink struct {
+	teamID    string
+	userID    string
+	userName  string
+	expiresAt time.Time
+}
+
+// Bot handles /prism slash commands
+type Bot struct {
+	slack             *slack.Client
+	links             *repository.SlackLinkRepository
+	agents            *agent.Manager
+	runner            *coderunner.Runner
+	sandbox           *sandbox.Service
+	llmManager        *llm.Manager
+	providerKeyRepo   *repository.ProviderKeyRepository
+	encryptionService *security.EncryptionService
+	integrations      *integrations.Manager
+	config            Config
+
+	pending map[string]*pendingLink
+	mu      sync.Mutex
+}
+
+// NewBot creates a new Slack bot. The agent manager, code runner and sandbox
+// may be nil, in which case the commands that need them are unavailable.
+func NewBot(
+	slackClient *slack.Client,
+	links *repository.SlackLinkRepository,
+	agents *agent.Manager,
+	runner *coderunner.Runner,
+	sandboxService *sandbox.Service,
+	llmManager *llm.Manager,
+	providerKeyRepo *repository.ProviderKeyRepository,
+	encryptionService *security.EncryptionService,
+	integrationManager *integrations.Manager,
+	config Config,
+) *Bot {
+	if config.UpdateInterval <= 0 {
+		config.UpdateInterval = defaultUpdateInterval
+	}
+	return &Bot{
+		slack:             slackClient,
+		links:             links,
+		agents:            agents,
+		runner:            runner,
+		sandbox:           sandboxService,
+		llmManager:        llmManager,
+		providerKeyRepo:   providerKeyRepo,
+		encryptionService: encryptionService,
+		integrations:      integrationManager,
+		config:            config,
+		pending:           make(map[string]*pendingLink),
+	}
+}
+
+// Verify checks that a request was signed by Slack
+func (b *Bot) Verify(timestamp, signature string, body []byte) error {
+	return slack.VerifySignature(b.config.SigningSecret, timestamp, signature, body, time.Now())
+}
+
+// HandleCommand handles a slash command and returns the immediate reply,
+// which is shown only to the user. Slack requires a reply within three
+// seconds, so long-running work continues in the background.
+func (b *Bot) HandleCommand(cmd *Command) string {
+	sub, args := splitCommand(cmd.Text)
+
+	if b.integrations != nil && sub != "" {
+		b.integrations.Track(&integrations.Event{
+			Type: "slack.command",
+			Data: map[string]interface{}{
+				"subcommand": sub,
+				"team_id":    cmd.TeamID,
+			},
+		})
+	}
+
+	switch sub {
+	case "", "help":
+		return usage
+	case "link":
+		return b.handleLink(cmd)
+	case "unlink":
+		return b.handleUnlink(cmd)
+	case "ask", "run":
+	default:
+		return fmt.Sprintf("Unknown command `%s`.\n\n%s", sub, usage)
+	}
+
+	userID, err := b.links.GetUserID(cmd.TeamID, cmd.UserID)
+	if err != nil {
+		log.Printf("Failed to look up Slack link: %v", err)
+		return "Something went wrong looking up your Prism account. Please try again."
+	}
+	if userID == "" {
+		return "Your Slack account isn't linked to Prism yet. Run `/prism link` to connect it."
+	}
+
+	if sub == "ask" {
+		return b.handleAsk(cmd, userID, args)
+	}
+	return b.handleRun(cmd, userID, args)
+}
+
+func (b *Bot) handleAsk(cmd *Command, userID, prompt string) string {
+	if prompt == "" {
+		return "Usage: `/prism ask <question>`"
+	}
+	if b.agents == nil {
+		return "Agents are not available on this Prism server."
+	}
+
+	creds := b.llmManager.UserCredentials(b.providerKeyRepo, b.encryptionService, userID, b.config.Provider)
+	if !b.llmManager.CanUse(b.config.Provider, creds) {
+		return fmt.Sprintf("No API key is configured for %s. Add one in Prism under Settings.", b.config.Provider)
+	}
+
+	go b.ask(cmd, userID, creds, prompt)
+	return "Asking Prism… the answer will appear in a thread."
+}
+
+// ask runs an agent and streams its answer into a thread
+func (b *Bot) ask(cmd *Command, userID string, creds *llm.Credentials, prompt string) {
+	stream, err := b.startThread(cmd, fmt.Sprintf("<@%s> asked: %s", cmd.UserID, escape(prompt)), "_Thinking…_", false)
+	if err != nil {
+		b.respondError(cmd, err)
+		return
+	}
+
+	task := agent.NewTask(prompt)
+	execution, err := b.agents.RunTask(context.Background(), task, agent.AgentConfig{
+		Name:         "slack",
+		Provider:     b.config.Provider,
+		Model:        b.config.Model,
+		SystemPrompt: systemPrompt,
+		Credentials:  creds,
+	})
+	if err != nil {
+		stream.finish(":x: " + escape(err.Error()))
+		return
+	}
+
+	startTime := time.Now()
+	agentInstance := execution.Agents[0]
+	for event := range agentInstance.Events() {
+		switch event.Type {
+		case agent.AgentEventStarted:
+			// Don't count time spent in the agent pool's queue
+			startTime = time.Now()
+		case agent.AgentEventStreamChunk:
+			if delta, ok := event.Data["delta"].(string); ok {
+				stream.append(delta)
+			}
+		case agent.AgentEventCompleted:
+			output, _ := event.Data["output"].(string)
+			stream.finish(escape(output))
+			if b.integrations != nil {
+				b.integrations.TrackAgentFinished(userID, "", agentInstance.ID, "slack", false, "", time.Since(startTime).Milliseconds())
+			}
+			return
+		case agent.AgentEventFailed:
+			errMsg, _ := event.Data["error"].(string)
+			stream.finish(":x: Agent failed: " + escape(errMsg))
+			if b.integrations != nil {
+				b.integrations.TrackAgentFinished(userID, "", agentInstance.ID, "slack", true, errMsg, time.Since(startTime).Milliseconds())
+			}
+			return
+		case agent.AgentEventCancelled:
+			stream.finish(":no_entry_sign: Cancelled")
+			return
+		}
+	}
+	stream.finish("")
+}
+
+func (b *Bot) handleRun(cmd *Command, userID, args string) string {
+	if b.runner == nil {
+		return "The code runner is not available on this Prism server."
+	}
+
+	req := &github.CodeRunRequest{Environment: "shell"}
+	if rest := strings.TrimPrefix(args, "--env "); rest != args {
+		req.Environment, req.Command = splitCommand(rest)
+	} else {
+		req.Command = args
+	}
+	if req.Command == "" {
+		return "Usage: `/prism run [--env <environment>] <command>`"
+	}
+	if err := coderunner.ValidateCommand(req.Command); err != nil {
+		return "Can't run that command: " + err.Error()
+	}
+
+	// Run in the user's workspace when one is available
+	if b.sandbox != nil {
+		if workDir, err := b.sandbox.GetOrCreateWorkDir(userID); err == nil {
+			req.WorkDir = workDir
+		}
+	}
+
+	go b.run(cmd, userID, req)
+	return "Running… output will appear in a thread."
+}
+
+// run executes a command and streams its output into a thread
+func (b *Bot) run(cmd *Command, userID string, req *github.CodeRunRequest) {
+	header := fmt.Sprintf("<@%s> ran `%s` (%s)", cmd.UserID, escape(req.Command), req.Environment)
+	stream, err := b.startThread(cmd, header, "_Running…_", true)
+	if err != nil {
+		b.respondError(cmd, err)
+		return
+	}
+
+	execution, err := b.runner.Start(req, coderunner.StreamOptions{
+		UserID: userID,
+		OnOutput: func(line coderunner.OutputLine) {
+			stream.append(line.Content + "\n")
+		},
+	})
+	if err != nil {
+		stream.finish(":x: " + escape(err.Error()))
+		return
+	}
+
+	result := execution.Wait()
+	status := fmt.Sprintf(":white_check_mark: Exited with code 0 in %dms", result.Duration)
+	if result.ExitCode != 0 {
+		status = fmt.Sprintf(":x: Exited with code %d in %dms", result.ExitCode, result.Duration)
+	}
+	stream.finish(status)
+}
+
+// handleLink issues a one-time code the user redeems in Prism to link accounts
+func (b *Bot) handleLink(cmd *Command) string {
+	code, err := generateLinkCode()
+	if err != nil {
+		return "Something went wrong creating a link code. Please try again."
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	for c, link := range b.pending {
+		if now.After(link.expiresAt) {
+			delete(b.pending, c)
+		}
+	}
+	b.pending[code] = &pendingLink{
+		teamID:    cmd.TeamID,
+		userID:    cmd.UserID,
+		userName:  cmd.UserName,
+		expiresAt: now.Add(linkCodeTTL),
+	}
+	b.mu.Unlock()
+
+	return fmt.Sprintf("To link your Slack account, enter code *%s* in Prism under Settings → Integrations → Slack. "+
+		"The code expires in %d minutes.", code, int(linkCodeTTL.Minutes()))
+}
+
+func (b *Bot) handleUnlink(cmd *Command) string {
+	removed, err := b.links.Unlink(cmd.TeamID, cmd.UserID, "")
+	if err != nil {
+		log.Printf("Failed to unlink Slack user: %v", err)
+		return "Something went wrong unlinking your account. Please try again."
+	}
+	if !removed {
+		return "Your Slack account isn't linked to Prism."
+	}
+	return "Your Slack account has been unlinked from Prism."
+}
+
+// CompleteLink redeems a link code for a Prism user
+func (b *Bot) CompleteLink(code, userID string) (*repository.SlackLink, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	b.mu.Lock()
+	pending, ok := b.pending[code]
+	if ok {
+		delete(b.pending, code)
+	}
+	b.mu.Unlock()
+
+	if !ok || time.Now().After(pending.expiresAt) {
+		return nil, ErrInvalidLinkCode
+	}
+
+	link := &repository.SlackLink{
+		SlackTeamID:   pending.teamID,
+		SlackUserID:   pending.userID,
+		SlackUsername: pending.userName,
+		UserID:        userID,
+	}
+	if err := b.links.Link(link); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// respondError tells the user a background command failed to start
+func (b *Bot) respondError(cmd *Command, err error) {
+	log.Printf("Slack command failed: %v", err)
+	if cmd.ResponseURL == "" {
+		return
+	}
+	text := ":x: " + escape(err.Error())
+	if strings.Contains(err.Error(), "not_in_channel") || strings.Contains(err.Error(), "channel_not_found") {
+		text = ":x: Prism can't post in this channel. Invite the Prism app to the channel and try again."
+	}
+	if err := b.slack.Respond(cmd.ResponseURL, text, true); err != nil {
+		log.Printf("Failed to respond to Slack command: %v", err)
+	}
+}
+
+// splitCommand splits text into its first word (lowercased) and the rest
+func splitCommand(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	if i := strings.IndexAny(text, " \t\n"); i >= 0 {
+		return strings.ToLower(text[:i]), strings.TrimSpace(text[i+1:])
+	}
+	return strings.ToLower(text), ""
+}
+
+func generateLinkCode() (string, error) {
+	buf := make([]byte, linkCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, v := range buf {
+		buf[i] = linkCodeAlphabet[int(v)%len(linkCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// escape escapes the characters Slack treats as control sequences
+func escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
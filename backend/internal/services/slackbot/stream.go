@@ -0,0 +1,197 @@
+package slackbot
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxMessageLength keeps messages well under Slack's 40,000 character limit
+// and short enough to read in a thread
+const maxMessageLength = 3500
+
+// threadStream is a threaded reply that is edited as output arrives. Edits
+// are throttled to the bot's update interval to stay within Slack's rate
+// limits.
+type threadStream struct {
+	bot       *Bot
+	channel   string
+	threadTS  string
+	ts        string
+	codeBlock bool // output is shown in a code block, tail first
+
+	buf      strings.Builder
+	dirty    bool
+	finished bool
+	mu       sync.Mutex
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+}
+
+// startThread posts the parent message and a placeholder reply in its
+// thread, then starts periodically updating the reply
+func (b *Bot) startThread(cmd *Command, header, placeholder string, codeBlock bool) (*threadStream, error) {
+	threadTS, err := b.slack.PostMessage(cmd.ChannelID, "", header)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := b.slack.PostMessage(cmd.ChannelID, threadTS, placeholder)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &threadStream{
+		bot:       b,
+		channel:   cmd.ChannelID,
+		threadTS:  threadTS,
+		ts:        ts,
+		codeBlock: codeBlock,
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	go s.loop()
+	return s, nil
+}
+
+// append adds output to the reply
+func (s *threadStream) append(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return
+	}
+	s.buf.WriteString(text)
+	s.dirty = true
+}
+
+func (s *threadStream) loop() {
+	defer close(s.doneCh)
+
+	ticker := time.NewTicker(s.bot.config.UpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if !s.dirty {
+				s.mu.Unlock()
+				continue
+			}
+			s.dirty = false
+			text := s.render(s.buf.String(), "")
+			s.mu.Unlock()
+
+			if err := s.bot.slack.UpdateMessage(s.channel, s.ts, text); err != nil {
+				log.Printf("Failed to update Slack message: %v", err)
+			}
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// finish stops streaming and writes the final reply. For answers, final
+// replaces the streamed text and anything too long for one message is
+// continued in further replies; for command output, final is a status line
+// shown below the output.
+func (s *threadStream) finish(final string) {
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.finished = true
+	output := s.buf.String()
+	s.mu.Unlock()
+
+	close(s.stopCh)
+	<-s.doneCh
+
+	if s.codeBlock {
+		s.update(s.render(output, final))
+		return
+	}
+
+	if final == "" {
+		final = escape(output)
+	}
+	if strings.TrimSpace(final) == "" {
+		final = "_No response_"
+	}
+
+	chunks := splitMessage(final, maxMessageLength)
+	s.update(chunks[0])
+	for _, chunk := range chunks[1:] {
+		if _, err := s.bot.slack.PostMessage(s.channel, s.threadTS, chunk); err != nil {
+			log.Printf("Failed to post Slack message: %v", err)
+			return
+		}
+	}
+}
+
+func (s *threadStream) update(text string) {
+	if err := s.bot.slack.UpdateMessage(s.channel, s.ts, text); err != nil {
+		log.Printf("Failed to update Slack message: %v", err)
+	}
+}
+
+// render formats the reply. While streaming, answers show their most recent
+// text; command output always shows its tail in a code block.
+func (s *threadStream) render(output, status string) string {
+	if !s.codeBlock {
+		return escape(tail(output, maxMessageLength)) + " …"
+	}
+
+	var b strings.Builder
+	if strings.TrimSpace(output) != "" {
+		b.WriteString("```\n")
+		b.WriteString(escape(strings.TrimRight(tail(output, maxMessageLength-200), "\n")))
+		b.WriteString("\n```")
+	}
+	if status != "" {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(status)
+	} else if b.Len() == 0 {
+		b.WriteString("_Running…_")
+	}
+	return b.String()
+}
+
+// tail returns at most max bytes from the end of text, starting on a line
+// boundary where possible
+func tail(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	text = text[len(text)-max:]
+	if i := strings.IndexByte(text, '\n'); i >= 0 && i < len(text)-1 {
+		text = text[i+1:]
+	}
+	for len(text) > 0 && !utf8.RuneStart(text[0]) {
+		text = text[1:]
+	}
+	return "…\n" + text
+}
+
+// splitMessage splits text into chunks of at most max bytes, preferring to
+// break at line boundaries
+func splitMessage(text string, max int) []string {
+	var chunks []string
+	for len(text) > max {
+		cut := strings.LastIndexByte(text[:max], '\n')
+		if cut <= 0 {
+			cut = max
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		chunks = append(chunks, text[:cut])
+		text = strings.TrimLeft(text[cut:], "\n")
+	}
+	return append(chunks, text)
+}
@@ -0,0 +1,360 @@
+package speech
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/security"
+)
+
+// Speech providers
+const (
+	ProviderOpenAI     = "openai"     // OpenAI TTS, using the user's stored OpenAI key
+	ProviderElevenLabs = "elevenlabs" // ElevenLabs, using the server's API key
+	ProviderPiper      = "piper"      // A local piper HTTP server
+)
+
+const (
+	openAIEndpoint     = "https://api.openai.com/v1/audio/speech"
+	elevenLabsEndpoint = "https://api.elevenlabs.io/v1/text-to-speech/"
+
+	// Defaults used when no model or voice is configured
+	defaultOpenAIModel       = "tts-1"
+	defaultOpenAIVoice       = "alloy"
+	defaultElevenLabsModel   = "eleven_multilingual_v2"
+	defaultElevenLabsVoiceID = "21m00Tcm4TlvDq8ikWAM"
+
+	// Per-request text limits. Longer text is synthesized in chunks whose
+	// MP3 streams are played back to back. Piper returns WAV, which can't be
+	// concatenated, but runs locally without a limit.
+	openAIMaxChars     = 4096
+	elevenLabsMaxChars = 5000
+
+	// defaultTimeout bounds synthesizing a single chunk
+	defaultTimeout = 2 * time.Minute
+
+	// maxErrorBody limits how much of a failed response is included in errors
+	maxErrorBody = 1024
+)
+
+// Speech errors
+var (
+	ErrNoProvider       = errors.New("no text-to-speech provider is available")
+	ErrUnknownProvider  = errors.New("unknown text-to-speech provider")
+	ErrProviderNotReady = errors.New("text-to-speech provider is not configured")
+	ErrNothingToSpeak   = errors.New("message has no text to speak")
+)
+
+// Config holds configuration for speech synthesis
+type Config struct {
+	OpenAIModel string
+	OpenAIVoice string
+
+	ElevenLabsAPIKey  string
+	ElevenLabsVoiceID string
+	ElevenLabsModel   string
+
+	// PiperURL is the address of a piper HTTP server. Piper is disabled when empty.
+	PiperURL   string
+	PiperVoice string
+
+	Timeout time.Duration
+
+	// MaxChars caps how much of a message is spoken; 0 means no limit
+	MaxChars int
+}
+
+// Request is text to synthesize
+type Request struct {
+	Provider string // Optional: defaults to the first available provider
+	Voice    string // Optional: overrides the provider's configured voice
+	Text     string // Markdown text, converted to speakable plain text
+}
+
+// Speech is a stream of synthesized audio. The caller must close Audio.
+type Speech struct {
+	Provider    string
+	ContentType string
+	Audio       io.ReadCloser
+}
+
+// Service synthesizes speech with OpenAI, ElevenLabs or a local piper server
+type Service struct {
+	providerKeyRepo   *repository.ProviderKeyRepository
+	encryptionService *security.EncryptionService
+	config            Config
+	client            *http.Client
+}
+
+// NewService creates a new speech service
+func NewService(
+	providerKeyRepo *repository.ProviderKeyRepository,
+	encryptionService *security.EncryptionService,
+	config Config,
+) *Service {
+	if config.OpenAIModel == "" {
+		config.OpenAIModel = defaultOpenAIModel
+	}
+	if config.OpenAIVoice == "" {
+		config.OpenAIVoice = defaultOpenAIVoice
+	}
+	if config.ElevenLabsModel == "" {
+		config.ElevenLabsModel = defaultElevenLabsModel
+	}
+	if config.ElevenLabsVoiceID == "" {
+		config.ElevenLabsVoiceID = defaultElevenLabsVoiceID
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	return &Service{
+		providerKeyRepo:   providerKeyRepo,
+		encryptionService: encryptionService,
+		config:            config,
+		client:            &http.Client{},
+	}
+}
+
+// Providers returns the providers the user can synthesize speech with, in
+// order of preference
+func (s *Service) Providers(userID string) []string {
+	providers := []string{}
+	if s.openAIKey(userID) != "" {
+		providers = append(providers, ProviderOpenAI)
+	}
+	if s.config.ElevenLabsAPIKey != "" {
+		providers = append(providers, ProviderElevenLabs)
+	}
+	if s.config.PiperURL != "" {
+		providers = append(providers, ProviderPiper)
+	}
+	return providers
+}
+
+// synthesizer sends one chunk of text to a provider
+type synthesizer struct {
+	provider    string
+	maxChars    int
+	contentType string
+	request     func(ctx context.Context, text string) (*http.Request, error)
+}
+
+// Synthesize converts text to speech. The first chunk is requested before
+// returning so provider errors are reported up front; the remaining chunks
+// are requested as the audio is read.
+func (s *Service) Synthesize(ctx context.Context, userID string, req *Request) (*Speech, error) {
+	text := SpeakableText(req.Text)
+	if s.config.MaxChars > 0 {
+		text = truncate(text, s.config.MaxChars)
+	}
+	if text == "" {
+		return nil, ErrNothingToSpeak
+	}
+
+	provider := req.Provider
+	if provider == "" {
+		providers := s.Providers(userID)
+		if len(providers) == 0 {
+			return nil, ErrNoProvider
+		}
+		provider = providers[0]
+	}
+
+	synth, err := s.synthesizer(userID, provider, req.Voice)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := splitText(text, synth.maxChars)
+	first, contentType, err := s.fetch(ctx, synth, chunks[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 1 {
+		return &Speech{Provider: provider, ContentType: contentType, Audio: first}, nil
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		defer first.Close()
+		if _, err := io.Copy(writer, first); err != nil {
+			writer.CloseWithError(err)
+			return
+		}
+		for _, chunk := range chunks[1:] {
+			audio, _, err := s.fetch(ctx, synth, chunk)
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			_, err = io.Copy(writer, audio)
+			audio.Close()
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+		writer.Close()
+	}()
+
+	return &Speech{Provider: provider, ContentType: contentType, Audio: reader}, nil
+}
+
+// synthesizer builds requests for a provider
+func (s *Service) synthesizer(userID, provider, voice string) (*synthesizer, error) {
+	switch provider {
+	case ProviderOpenAI:
+		apiKey := s.openAIKey(userID)
+		if apiKey == "" {
+			return nil, fmt.Errorf("%w: add an OpenAI API key in Settings", ErrProviderNotReady)
+		}
+		if voice == "" {
+			voice = s.config.OpenAIVoice
+		}
+		return &synthesizer{
+			provider:    provider,
+			maxChars:    openAIMaxChars,
+			contentType: "audio/mpeg",
+			request: func(ctx context.Context, text string) (*http.Request, error) {
+				req, err := jsonRequest(ctx, openAIEndpoint, map[string]interface{}{
+					"model":           s.config.OpenAIModel,
+					"voice":           voice,
+					"input":           text,
+					"response_format": "mp3",
+				})
+				if err != nil {
+					return nil, err
+				}
+				req.Header.Set("Authorization", "Bearer "+apiKey)
+				return req, nil
+			},
+		}, nil
+
+	case ProviderElevenLabs:
+		if s.config.ElevenLabsAPIKey == "" {
+			return nil, fmt.Errorf("%w: ELEVENLABS_API_KEY is not set", ErrProviderNotReady)
+		}
+		if voice == "" {
+			voice = s.config.ElevenLabsVoiceID
+		}
+		return &synthesizer{
+			provider:    provider,
+			maxChars:    elevenLabsMaxChars,
+			contentType: "audio/mpeg",
+			request: func(ctx context.Context, text string) (*http.Request, error) {
+				req, err := jsonRequest(ctx, elevenLabsEndpoint+url.PathEscape(voice)+"/stream", map[string]interface{}{
+					"text":     text,
+					"model_id": s.config.ElevenLabsModel,
+				})
+				if err != nil {
+					return nil, err
+				}
+				req.Header.Set("xi-api-key", s.config.ElevenLabsAPIKey)
+				req.Header.Set("Accept", "audio/mpeg")
+				return req, nil
+			},
+		}, nil
+
+	case ProviderPiper:
+		if s.config.PiperURL == "" {
+			return nil, fmt.Errorf("%w: TTS_PIPER_URL is not set", ErrProviderNotReady)
+		}
+		if voice == "" {
+			voice = s.config.PiperVoice
+		}
+		return &synthesizer{
+			provider:    provider,
+			contentType: "audio/wav",
+			request: func(ctx context.Context, text string) (*http.Request, error) {
+				body := map[string]interface{}{"text": text}
+				if voice != "" {
+					body["voice"] = voice
+				}
+				return jsonRequest(ctx, s.config.PiperURL, body)
+			},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, provider)
+}
+
+// fetch synthesizes one chunk and returns its audio stream and content type
+func (s *Service) fetch(ctx context.Context, synth *synthesizer, text string) (io.ReadCloser, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+
+	req, err := synth.request(ctx, text)
+	if err != nil {
+		cancel()
+		return nil, "", fmt.Errorf("failed to build speech request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, "", fmt.Errorf("speech request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		resp.Body.Close()
+		cancel()
+		return nil, "", fmt.Errorf("%s speech synthesis failed: status %d: %s", synth.provider, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "audio/") {
+		contentType = synth.contentType
+	}
+	return &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}, contentType, nil
+}
+
+// cancelOnClose releases a request's context once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// jsonRequest builds a POST request with a JSON body
+func jsonRequest(ctx context.Context, endpoint string, body map[string]interface{}) (*http.Request, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// openAIKey returns the user's stored OpenAI API key, or "" if they have
+// none. A key for an OpenAI-compatible server isn't sent to OpenAI.
+func (s *Service) openAIKey(userID string) string {
+	if s.providerKeyRepo == nil || s.encryptionService == nil {
+		return ""
+	}
+	providerKey, err := s.providerKeyRepo.GetKey(userID, ProviderOpenAI)
+	if err != nil || providerKey == nil || providerKey.BaseURL != "" {
+		return ""
+	}
+	decryptedKey, err := s.encryptionService.Decrypt(providerKey.EncryptedKey, providerKey.KeyNonce)
+	if err != nil {
+		return ""
+	}
+	return string(decryptedKey)
+}
@@ -0,0 +1,84 @@
+package speech
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	codeBlockPattern  = regexp.MustCompile("(?s)```.*?(```|$)")
+	inlineCodePattern = regexp.MustCompile("`([^`]*)`")
+	imagePattern      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	linkPattern       = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	linePrefixPattern = regexp.MustCompile(`(?m)^[ \t]*(#{1,6}[ \t]+|>[ \t]?|[-*+][ \t]+|\d+\.[ \t]+)`)
+	emphasisPattern   = regexp.MustCompile(`(\*{1,3}|_{2,3}|~~)([^*_~\n]+)(\*{1,3}|_{2,3}|~~)`)
+	tableRulePattern  = regexp.MustCompile(`(?m)^[ \t]*\|?[ \t]*:?-{3,}.*$`)
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// SpeakableText converts a markdown message to plain text suited for
+// reading aloud. Code blocks are replaced with a short note rather than read
+// out symbol by symbol.
+func SpeakableText(markdown string) string {
+	text := codeBlockPattern.ReplaceAllString(markdown, "\n(Code block omitted.)\n")
+	text = inlineCodePattern.ReplaceAllString(text, "$1")
+	text = imagePattern.ReplaceAllString(text, "$1")
+	text = linkPattern.ReplaceAllString(text, "$1")
+	text = linePrefixPattern.ReplaceAllString(text, "")
+	text = emphasisPattern.ReplaceAllString(text, "$2")
+	text = tableRulePattern.ReplaceAllString(text, "")
+	text = strings.ReplaceAll(text, "|", " ")
+	text = blankLinesPattern.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// truncate shortens text to at most limit bytes, ending at a sentence or
+// word boundary where possible
+func truncate(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	return strings.TrimSpace(text[:cutPoint(text, limit)])
+}
+
+// splitText splits text into chunks of at most limit bytes, breaking at
+// paragraph, sentence or word boundaries where possible. A limit of 0 keeps
+// the text whole.
+func splitText(text string, limit int) []string {
+	if limit <= 0 || len(text) <= limit {
+		return []string{text}
+	}
+
+	var chunks []string
+	for len(text) > limit {
+		cut := cutPoint(text, limit)
+		if chunk := strings.TrimSpace(text[:cut]); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		text = text[cut:]
+	}
+	if text = strings.TrimSpace(text); text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// cutPoint returns where to break text so the first part is at most limit
+// bytes, preferring the latest paragraph, sentence, then word boundary
+func cutPoint(text string, limit int) int {
+	window := text[:limit]
+	for _, separators := range []string{"\n", ".!?", " \t"} {
+		// Don't break so early that chunks become tiny
+		if i := strings.LastIndexAny(window, separators); i > limit/2 {
+			return i + 1
+		}
+	}
+
+	// No boundary: cut at the last complete UTF-8 character
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return cut
+}
@@ -0,0 +1,292 @@
+package summarizing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/security"
+)
+
+const (
+	// maxMessageLength limits how much of each message is sent to the model
+	maxMessageLength = 2000
+
+	// maxTranscriptLength limits the whole transcript; older messages are
+	// left out first, apart from the opening request
+	maxTranscriptLength = 48000
+
+	// maxToolLength limits each tool call's parameters and result
+	maxToolLength = 300
+
+	// summarizeTimeout bounds a single summary call
+	summarizeTimeout = 2 * time.Minute
+)
+
+// ErrNoContent is returned when a conversation has nothing to summarize yet
+var ErrNoContent = errors.New("conversation has no messages to summarize")
+
+const summaryPrompt = `Summarize the conversation below between a user and an AI agent so someone can catch up on it later. Reply with a JSON object only, no code fence, with these fields:
+- "overview": two to four sentences on what the user wanted and what was done
+- "decisions": decisions that were made, one short sentence each
+- "files_touched": paths of files that were created, changed or deleted
+- "follow_ups": work left to do or open questions, one short sentence each
+Use empty arrays where there is nothing to list.`
+
+// fileTools are the tools that change files, whose path parameters are
+// counted as touched
+var fileTools = map[string]bool{
+	"file_write":           true,
+	"file_delete":          true,
+	"file_rename":          true,
+	"file_mkdir":           true,
+	"file_history_restore": true,
+	"edit":                 true,
+	"multi_edit":           true,
+	"notebook_edit":        true,
+}
+
+// Config holds configuration for conversation summaries
+type Config struct {
+	// Provider and Model optionally pin summaries to one model. When empty,
+	// the conversation's own provider and model are used.
+	Provider string
+	Model    string
+}
+
+// Summary is a structured digest of a conversation
+type Summary struct {
+	Overview     string    `json:"overview"`
+	Decisions    []string  `json:"decisions"`
+	FilesTouched []string  `json:"files_touched"`
+	FollowUps    []string  `json:"follow_ups"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	MessageCount int       `json:"message_count"` // Messages the summary covers
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Summarizer writes conversation summaries with an LLM call
+type Summarizer struct {
+	llmManager        *llm.Manager
+	providerKeyRepo   *repository.ProviderKeyRepository
+	encryptionService *security.EncryptionService
+	config            Config
+}
+
+// NewSummarizer creates a new conversation summarizer
+func NewSummarizer(
+	llmManager *llm.Manager,
+	providerKeyRepo *repository.ProviderKeyRepository,
+	encryptionService *security.EncryptionService,
+	config Config,
+) *Summarizer {
+	return &Summarizer{
+		llmManager:        llmManager,
+		providerKeyRepo:   providerKeyRepo,
+		encryptionService: encryptionService,
+		config:            config,
+	}
+}
+
+// Summarize returns a summary of a conversation's messages. Provider and
+// model choose the model to use; when empty, the configured or the
+// conversation's own model is used.
+func (s *Summarizer) Summarize(ctx context.Context, userID string, conversation *repository.Conversation, messages []*repository.Message, provider, model string) (*Summary, error) {
+	transcript := buildTranscript(messages)
+	if transcript == "" {
+		return nil, ErrNoContent
+	}
+
+	if provider == "" || model == "" {
+		provider, model = conversation.Provider, conversation.Model
+		if s.config.Provider != "" && s.config.Model != "" {
+			provider, model = s.config.Provider, s.config.Model
+		}
+	}
+
+	creds := s.llmManager.UserCredentials(s.providerKeyRepo, s.encryptionService, userID, provider)
+	if !s.llmManager.CanUse(provider, creds) {
+		return nil, fmt.Errorf("API key not configured for provider: %s", provider)
+	}
+
+	ctx, cancel := context.WithTimeout(llm.WithCredentials(ctx, creds), summarizeTimeout)
+	defer cancel()
+
+	stream, err := s.llmManager.Chat(ctx, provider, &llm.ChatRequest{
+		Model: model,
+		Messages: []llm.Message{
+			{Role: "system", Content: summaryPrompt},
+			{Role: "user", Content: transcript},
+		},
+		Temperature: 0.2,
+		MaxTokens:   1024,
+		Stream:      true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+
+	var response strings.Builder
+	for chunk := range stream {
+		if chunk.Error != nil {
+			return nil, fmt.Errorf("failed to summarize conversation: %w", chunk.Error)
+		}
+		response.WriteString(chunk.Delta)
+	}
+
+	summary := parseSummary(response.String())
+	if summary.Overview == "" && len(summary.Decisions) == 0 && len(summary.FollowUps) == 0 {
+		return nil, fmt.Errorf("model returned an empty summary")
+	}
+	summary.FilesTouched = mergePaths(touchedFiles(messages), summary.FilesTouched)
+	summary.Provider = provider
+	summary.Model = model
+	summary.MessageCount = len(messages)
+	summary.CreatedAt = time.Now()
+	return summary, nil
+}
+
+// buildTranscript renders the conversation as plain text. When it is too
+// long, the opening request is kept along with as many of the latest
+// messages as fit.
+func buildTranscript(messages []*repository.Message) string {
+	var parts []string
+	for _, msg := range messages {
+		if part := renderMessage(msg); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+
+	size := len(parts[0])
+	start := len(parts)
+	for start > 1 && size+len(parts[start-1]) <= maxTranscriptLength {
+		start--
+		size += len(parts[start])
+	}
+
+	kept := []string{parts[0]}
+	if start > 1 {
+		kept = append(kept, fmt.Sprintf("[%d messages left out]", start-1))
+	}
+	kept = append(kept, parts[start:]...)
+	return strings.Join(kept, "\n\n")
+}
+
+// renderMessage renders one message with its tool calls, or "" if there is
+// nothing to show
+func renderMessage(msg *repository.Message) string {
+	var b strings.Builder
+	if content := strings.TrimSpace(msg.Content); content != "" {
+		limit := maxMessageLength
+		if msg.Role == "tool" {
+			limit = maxToolLength
+		}
+		fmt.Fprintf(&b, "%s: %s", msg.Role, truncate(content, limit))
+	}
+	for _, tc := range msg.ToolCalls {
+		params, _ := json.Marshal(tc.Parameters)
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s called %s: %s", msg.Role, tc.Name, truncate(string(params), maxToolLength))
+	}
+	return b.String()
+}
+
+// truncate cuts text to a number of characters
+func truncate(text string, limit int) string {
+	if runes := []rune(text); len(runes) > limit {
+		return string(runes[:limit]) + "..."
+	}
+	return text
+}
+
+// parseSummary reads the model's JSON reply. A reply that isn't JSON is
+// kept whole as the overview.
+func parseSummary(raw string) *Summary {
+	text := strings.TrimSpace(raw)
+	if start, end := strings.Index(text, "{"), strings.LastIndex(text, "}"); start >= 0 && end > start {
+		summary := &Summary{}
+		if err := json.Unmarshal([]byte(text[start:end+1]), summary); err == nil {
+			summary.Overview = strings.TrimSpace(summary.Overview)
+			summary.Decisions = cleanList(summary.Decisions)
+			summary.FilesTouched = cleanList(summary.FilesTouched)
+			summary.FollowUps = cleanList(summary.FollowUps)
+			return summary
+		}
+	}
+	return &Summary{
+		Overview:     text,
+		Decisions:    []string{},
+		FilesTouched: []string{},
+		FollowUps:    []string{},
+	}
+}
+
+// cleanList drops blank items
+func cleanList(items []string) []string {
+	cleaned := []string{}
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			cleaned = append(cleaned, item)
+		}
+	}
+	return cleaned
+}
+
+// touchedFiles lists the paths the conversation's file tools were called
+// with, in the order they were first touched
+func touchedFiles(messages []*repository.Message) []string {
+	var paths []string
+	for _, msg := range messages {
+		for _, tc := range msg.ToolCalls {
+			if !fileTools[tc.Name] {
+				continue
+			}
+			paths = append(paths, toolPaths(tc.Parameters)...)
+		}
+	}
+	return paths
+}
+
+// toolPaths returns the paths in a file tool's parameters
+func toolPaths(params map[string]interface{}) []string {
+	var paths []string
+	for _, key := range []string{"path", "file_path", "source_path", "dest_path", "notebook_path"} {
+		if path, ok := params[key].(string); ok && path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if edits, ok := params["edits"].([]interface{}); ok {
+		for _, edit := range edits {
+			if fields, ok := edit.(map[string]interface{}); ok {
+				paths = append(paths, toolPaths(fields)...)
+			}
+		}
+	}
+	return paths
+}
+
+// mergePaths combines path lists, dropping repeats
+func mergePaths(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	merged := []string{}
+	for _, list := range lists {
+		for _, path := range list {
+			if !seen[path] {
+				seen[path] = true
+				merged = append(merged, path)
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,153 @@
+package titling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/security"
+)
+
+const (
+	// maxTitleLength is the maximum length of a generated title, in characters
+	maxTitleLength = 60
+
+	// maxExcerptLength limits how much of each message is sent to the model
+	maxExcerptLength = 1000
+
+	// generateTimeout bounds a single title generation call
+	generateTimeout = 30 * time.Second
+)
+
+// ErrNoContent is returned when a conversation has nothing to title yet
+var ErrNoContent = errors.New("conversation has no messages to title")
+
+const titlePrompt = `Write a short title (3 to 6 words) for the conversation below. Reply with the title only: no quotes, no trailing punctuation, no prefix like "Title:".`
+
+// Config holds configuration for title generation
+type Config struct {
+	// Provider and Model optionally pin title generation to a cheap model.
+	// When empty, the conversation's own provider and model are used.
+	Provider string
+	Model    string
+}
+
+// Generator produces concise conversation titles with a small LLM call
+type Generator struct {
+	llmManager        *llm.Manager
+	providerKeyRepo   *repository.ProviderKeyRepository
+	encryptionService *security.EncryptionService
+	config            Config
+}
+
+// NewGenerator creates a new title generator
+func NewGenerator(
+	llmManager *llm.Manager,
+	providerKeyRepo *repository.ProviderKeyRepository,
+	encryptionService *security.EncryptionService,
+	config Config,
+) *Generator {
+	return &Generator{
+		llmManager:        llmManager,
+		providerKeyRepo:   providerKeyRepo,
+		encryptionService: encryptionService,
+		config:            config,
+	}
+}
+
+// Generate returns a title for a conversation based on its messages
+func (g *Generator) Generate(ctx context.Context, userID string, conversation *repository.Conversation, messages []*repository.Message) (string, error) {
+	excerpt := buildExcerpt(messages)
+	if excerpt == "" {
+		return "", ErrNoContent
+	}
+
+	provider, model := conversation.Provider, conversation.Model
+	if g.config.Provider != "" && g.config.Model != "" {
+		provider, model = g.config.Provider, g.config.Model
+	}
+
+	creds := g.llmManager.UserCredentials(g.providerKeyRepo, g.encryptionService, userID, provider)
+	if !g.llmManager.CanUse(provider, creds) {
+		return "", fmt.Errorf("API key not configured for provider: %s", provider)
+	}
+
+	ctx, cancel := context.WithTimeout(llm.WithCredentials(ctx, creds), generateTimeout)
+	defer cancel()
+
+	stream, err := g.llmManager.Chat(ctx, provider, &llm.ChatRequest{
+		Model: model,
+		Messages: []llm.Message{
+			{Role: "system", Content: titlePrompt},
+			{Role: "user", Content: excerpt},
+		},
+		Temperature: 0.3,
+		MaxTokens:   30,
+		Stream:      true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate title: %w", err)
+	}
+
+	var response strings.Builder
+	for chunk := range stream {
+		if chunk.Error != nil {
+			return "", fmt.Errorf("failed to generate title: %w", chunk.Error)
+		}
+		response.WriteString(chunk.Delta)
+	}
+
+	title := cleanTitle(response.String())
+	if title == "" {
+		return "", fmt.Errorf("model returned an empty title")
+	}
+	return title, nil
+}
+
+// buildExcerpt renders the opening user/assistant messages as plain text
+func buildExcerpt(messages []*repository.Message) string {
+	var b strings.Builder
+	count := 0
+	for _, msg := range messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		content := strings.TrimSpace(msg.Content)
+		if content == "" {
+			continue
+		}
+		if runes := []rune(content); len(runes) > maxExcerptLength {
+			content = string(runes[:maxExcerptLength]) + "..."
+		}
+		fmt.Fprintf(&b, "%s: %s\n\n", msg.Role, content)
+
+		// The first exchange is enough to name the conversation
+		count++
+		if count >= 4 {
+			break
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// cleanTitle normalizes a model response into a single short title line
+func cleanTitle(raw string) string {
+	title := strings.TrimSpace(raw)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	for _, prefix := range []string{"Title:", "title:", "TITLE:"} {
+		title = strings.TrimPrefix(title, prefix)
+	}
+	title = strings.Trim(strings.TrimSpace(title), "\"'`*#")
+	title = strings.TrimRight(strings.TrimSpace(title), ".")
+
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = strings.TrimSpace(string(runes[:maxTitleLength])) + "..."
+	}
+	return title
+}
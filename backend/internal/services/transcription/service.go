@@ -0,0 +1,265 @@
+package transcription
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/security"
+)
+
+// Transcription providers
+const (
+	ProviderOpenAI = "openai" // OpenAI Whisper, using the user's stored OpenAI key
+	ProviderLocal  = "local"  // A local whisper.cpp or OpenAI-compatible server
+)
+
+const (
+	// openAIEndpoint is OpenAI's transcription API
+	openAIEndpoint = "https://api.openai.com/v1/audio/transcriptions"
+
+	// defaultOpenAIModel is used when no OpenAI model is configured
+	defaultOpenAIModel = "whisper-1"
+
+	// defaultTimeout bounds a single transcription call
+	defaultTimeout = 2 * time.Minute
+
+	// maxErrorBody limits how much of a failed response is included in errors
+	maxErrorBody = 1024
+)
+
+// SupportedExtensions are the audio formats accepted for transcription
+var SupportedExtensions = map[string]bool{
+	".flac": true,
+	".m4a":  true,
+	".mp3":  true,
+	".mp4":  true,
+	".mpeg": true,
+	".mpga": true,
+	".oga":  true,
+	".ogg":  true,
+	".wav":  true,
+	".webm": true,
+}
+
+// Transcription errors
+var (
+	ErrNoProvider         = errors.New("no transcription provider is available")
+	ErrUnknownProvider    = errors.New("unknown transcription provider")
+	ErrProviderNotReady   = errors.New("transcription provider is not configured")
+	ErrUnsupportedFormat  = errors.New("unsupported audio format")
+	ErrTranscriptionEmpty = errors.New("transcription returned no text")
+)
+
+// Config holds configuration for transcription
+type Config struct {
+	// LocalURL is the transcription endpoint of a local server, e.g. a
+	// whisper.cpp server's /inference or an OpenAI-compatible
+	// /v1/audio/transcriptions. Local transcription is disabled when empty.
+	LocalURL   string
+	LocalModel string
+
+	OpenAIModel string
+	Timeout     time.Duration
+}
+
+// Request is an audio file to transcribe
+type Request struct {
+	Provider string    // Optional: defaults to the first available provider
+	Filename string    // Original file name; its extension identifies the format
+	Audio    io.Reader // Audio content
+	Language string    // Optional ISO-639-1 language hint
+	Prompt   string    // Optional text to guide spelling and style
+}
+
+// Result is a finished transcription
+type Result struct {
+	Text     string `json:"text"`
+	Provider string `json:"provider"`
+	Language string `json:"language,omitempty"`
+}
+
+// Service transcribes audio with OpenAI Whisper or a local server
+type Service struct {
+	providerKeyRepo   *repository.ProviderKeyRepository
+	encryptionService *security.EncryptionService
+	config            Config
+	client            *http.Client
+}
+
+// NewService creates a new transcription service
+func NewService(
+	providerKeyRepo *repository.ProviderKeyRepository,
+	encryptionService *security.EncryptionService,
+	config Config,
+) *Service {
+	if config.OpenAIModel == "" {
+		config.OpenAIModel = defaultOpenAIModel
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	return &Service{
+		providerKeyRepo:   providerKeyRepo,
+		encryptionService: encryptionService,
+		config:            config,
+		client:            &http.Client{},
+	}
+}
+
+// Providers returns the providers the user can transcribe with, in order of
+// preference
+func (s *Service) Providers(userID string) []string {
+	providers := []string{}
+	if s.openAIKey(userID) != "" {
+		providers = append(providers, ProviderOpenAI)
+	}
+	if s.config.LocalURL != "" {
+		providers = append(providers, ProviderLocal)
+	}
+	return providers
+}
+
+// Transcribe converts speech in an audio file to text
+func (s *Service) Transcribe(ctx context.Context, userID string, req *Request) (*Result, error) {
+	if !SupportedExtensions[strings.ToLower(filepath.Ext(req.Filename))] {
+		return nil, ErrUnsupportedFormat
+	}
+
+	provider := req.Provider
+	if provider == "" {
+		providers := s.Providers(userID)
+		if len(providers) == 0 {
+			return nil, ErrNoProvider
+		}
+		provider = providers[0]
+	}
+
+	var endpoint, apiKey, model string
+	switch provider {
+	case ProviderOpenAI:
+		apiKey = s.openAIKey(userID)
+		if apiKey == "" {
+			return nil, fmt.Errorf("%w: add an OpenAI API key in Settings", ErrProviderNotReady)
+		}
+		endpoint, model = openAIEndpoint, s.config.OpenAIModel
+	case ProviderLocal:
+		if s.config.LocalURL == "" {
+			return nil, fmt.Errorf("%w: TRANSCRIPTION_LOCAL_URL is not set", ErrProviderNotReady)
+		}
+		endpoint, model = s.config.LocalURL, s.config.LocalModel
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, provider)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	text, language, err := s.post(ctx, endpoint, apiKey, model, req)
+	if err != nil {
+		return nil, err
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrTranscriptionEmpty
+	}
+
+	language = strings.TrimSpace(language)
+	if language == "" {
+		language = req.Language
+	}
+
+	return &Result{
+		Text:     text,
+		Provider: provider,
+		Language: language,
+	}, nil
+}
+
+// post sends the audio as an OpenAI-style multipart transcription request,
+// which whisper.cpp's server also accepts
+func (s *Service) post(ctx context.Context, endpoint, apiKey, model string, req *Request) (string, string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile("file", filepath.Base(req.Filename))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to build transcription request: %w", err)
+	}
+	if _, err := io.Copy(part, req.Audio); err != nil {
+		return "", "", fmt.Errorf("failed to read audio: %w", err)
+	}
+
+	fields := map[string]string{
+		"model":           model,
+		"response_format": "json",
+		"language":        req.Language,
+		"prompt":          req.Prompt,
+	}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(name, value); err != nil {
+			return "", "", fmt.Errorf("failed to build transcription request: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", "", fmt.Errorf("failed to build transcription request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, &body)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to build transcription request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", writer.FormDataContentType())
+	if apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return "", "", fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return "", "", fmt.Errorf("transcription failed: status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	var result struct {
+		Text     string `json:"text"`
+		Language string `json:"language"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", "", fmt.Errorf("failed to decode transcription response: %w", err)
+	}
+	return result.Text, result.Language, nil
+}
+
+// openAIKey returns the user's stored OpenAI API key, or "" if they have
+// none. A key for an OpenAI-compatible server isn't sent to OpenAI.
+func (s *Service) openAIKey(userID string) string {
+	if s.providerKeyRepo == nil || s.encryptionService == nil {
+		return ""
+	}
+	providerKey, err := s.providerKeyRepo.GetKey(userID, ProviderOpenAI)
+	if err != nil || providerKey == nil || providerKey.BaseURL != "" {
+		return ""
+	}
+	decryptedKey, err := s.encryptionService.Decrypt(providerKey.EncryptedKey, providerKey.KeyNonce)
+	if err != nil {
+		return ""
+	}
+	return string(decryptedKey)
+}
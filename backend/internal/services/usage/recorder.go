@@ -0,0 +1,87 @@
+// Package usage records finished agent runs, swarms, builds and tool
+// executions so per-user usage can be reported without an external
+// analytics vendor.
+package usage
+
+import (
+	"log"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+)
+
+// Recorder stores usage events as they are tracked. It subscribes to the
+// integrations manager, so anything tracked there is counted.
+type Recorder struct {
+	repo *repository.UsageRepository
+}
+
+// NewRecorder creates a new usage recorder
+func NewRecorder(repo *repository.UsageRepository) *Recorder {
+	return &Recorder{repo: repo}
+}
+
+// Name returns the subscriber name
+func (r *Recorder) Name() string {
+	return "usage"
+}
+
+// Handle records an event if it represents countable usage
+func (r *Recorder) Handle(event *integrations.Event) {
+	if event.UserID == "" {
+		return
+	}
+
+	usageEvent := &repository.UsageEvent{
+		UserID:         event.UserID,
+		ConversationID: event.ConversationID,
+		Status:         "completed",
+		DurationMs:     int64Value(event.Data["duration_ms"]),
+	}
+
+	switch event.Type {
+	case integrations.EventToolExecuted:
+		usageEvent.Kind = repository.UsageKindTool
+		usageEvent.Name = stringValue(event.Data["tool_name"])
+		if status := stringValue(event.Data["status"]); status != "" {
+			usageEvent.Status = status
+		}
+	case integrations.EventAgentCompleted, integrations.EventAgentFailed:
+		usageEvent.Kind = repository.UsageKindAgent
+		usageEvent.Name = stringValue(event.Data["agent_name"])
+	case integrations.EventSwarmCompleted, integrations.EventSwarmFailed:
+		usageEvent.Kind = repository.UsageKindSwarm
+		usageEvent.Name = stringValue(event.Data["strategy"])
+	case integrations.EventBuildCompleted, integrations.EventBuildFailed:
+		usageEvent.Kind = repository.UsageKindBuild
+		usageEvent.Name = stringValue(event.Data["command"])
+	default:
+		return
+	}
+
+	switch event.Type {
+	case integrations.EventAgentFailed, integrations.EventSwarmFailed, integrations.EventBuildFailed:
+		usageEvent.Status = "failed"
+	}
+
+	if err := r.repo.Record(usageEvent); err != nil {
+		log.Printf("Failed to record usage event: %v", err)
+	}
+}
+
+func stringValue(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+func int64Value(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
@@ -0,0 +1,266 @@
+// Package webhookqueue persists incoming GitHub webhook deliveries and
+// processes them with retries. Deliveries that keep failing are moved to a
+// dead-letter state where they wait for a manual redelivery.
+package webhookqueue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jacklau/prism/internal/database/repository"
+	"github.com/jacklau/prism/internal/integrations"
+	"github.com/jacklau/prism/internal/integrations/github"
+)
+
+const (
+	defaultMaxAttempts  = 5
+	defaultBaseDelay    = 30 * time.Second
+	defaultMaxDelay     = time.Hour
+	defaultPollInterval = 15 * time.Second
+
+	// pollBatchSize caps how many due deliveries are processed per poll
+	pollBatchSize = 50
+)
+
+// ErrDeliveryInProgress is returned when redelivering a delivery that is
+// currently being processed
+var ErrDeliveryInProgress = errors.New("delivery is being processed")
+
+// Config holds configuration for the delivery queue
+type Config struct {
+	// MaxAttempts is how many times a delivery is tried before it is dead-lettered
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry; each retry doubles it
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between retries
+	MaxDelay time.Duration
+	// PollInterval is how often due retries are checked for
+	PollInterval time.Duration
+}
+
+// Queue processes webhook deliveries, retrying failures with exponential backoff
+type Queue struct {
+	repo         *repository.WebhookRepository
+	handler      *github.WebhookHandler
+	integrations *integrations.Manager
+	config       Config
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewQueue creates a new webhook delivery queue
+func NewQueue(repo *repository.WebhookRepository, handler *github.WebhookHandler, integrationManager *integrations.Manager, config Config) *Queue {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.BaseDelay <= 0 {
+		config.BaseDelay = defaultBaseDelay
+	}
+	if config.MaxDelay <= 0 {
+		config.MaxDelay = defaultMaxDelay
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultPollInterval
+	}
+	return &Queue{
+		repo:         repo,
+		handler:      handler,
+		integrations: integrationManager,
+		config:       config,
+		stopCh:       make(chan struct{}),
+	}
+}
+
+// Start recovers deliveries interrupted by a previous shutdown and begins
+// processing due retries in the background
+func (q *Queue) Start() {
+	if n, err := q.repo.ResetProcessingDeliveries(); err != nil {
+		log.Printf("Failed to recover interrupted webhook deliveries: %v", err)
+	} else if n > 0 {
+		log.Printf("Requeued %d interrupted webhook deliveries", n)
+	}
+
+	go func() {
+		ticker := time.NewTicker(q.config.PollInterval)
+		defer ticker.Stop()
+
+		q.processDue()
+		for {
+			select {
+			case <-q.stopCh:
+				return
+			case <-ticker.C:
+				q.processDue()
+			}
+		}
+	}()
+}
+
+// Stop stops processing retries
+func (q *Queue) Stop() {
+	q.stopOnce.Do(func() { close(q.stopCh) })
+}
+
+// Enqueue records a delivery for a configured webhook and starts processing
+// it immediately. The raw payload is kept so the delivery can be retried.
+func (q *Queue) Enqueue(config *github.WebhookConfig, eventType, action, githubDeliveryID string, payload []byte) (*github.WebhookDelivery, error) {
+	delivery := &github.WebhookDelivery{
+		WebhookID:        config.ID,
+		GitHubDeliveryID: githubDeliveryID,
+		Event:            eventType,
+		Action:           action,
+		Status:           github.DeliveryStatusPending,
+	}
+	if err := json.Unmarshal(payload, &delivery.Payload); err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+
+	if err := q.repo.CreateDelivery(delivery); err != nil {
+		return nil, fmt.Errorf("failed to record delivery: %w", err)
+	}
+
+	go q.process(delivery)
+	return delivery, nil
+}
+
+// Redeliver resets a delivery's attempts and processes it again
+func (q *Queue) Redeliver(delivery *github.WebhookDelivery) error {
+	if delivery.Status == github.DeliveryStatusProcessing {
+		return ErrDeliveryInProgress
+	}
+
+	delivery.Status = github.DeliveryStatusPending
+	delivery.ErrorMessage = ""
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = nil
+	delivery.ProcessedAt = nil
+	if err := q.repo.UpdateDelivery(delivery); err != nil {
+		return fmt.Errorf("failed to reset delivery: %w", err)
+	}
+
+	go q.process(delivery)
+	return nil
+}
+
+// processDue processes every delivery whose next attempt is due
+func (q *Queue) processDue() {
+	deliveries, err := q.repo.ListDueDeliveries(time.Now(), pollBatchSize)
+	if err != nil {
+		log.Printf("Failed to list due webhook deliveries: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		select {
+		case <-q.stopCh:
+			return
+		default:
+		}
+		q.process(delivery)
+	}
+}
+
+// process claims a delivery, runs it and records the outcome
+func (q *Queue) process(delivery *github.WebhookDelivery) {
+	claimed, err := q.repo.ClaimDelivery(delivery.ID, time.Now())
+	if err != nil {
+		log.Printf("Failed to claim webhook delivery %s: %v", delivery.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	// Reload so the attempt count reflects the claim
+	delivery, err = q.repo.GetDelivery(delivery.ID)
+	if err != nil {
+		log.Printf("Failed to load webhook delivery: %v", err)
+		return
+	}
+
+	config, err := q.repo.GetByID(delivery.WebhookID)
+	if err == nil {
+		err = q.deliver(delivery, config)
+	}
+
+	now := time.Now()
+	delivery.NextAttemptAt = nil
+	delivery.ErrorMessage = ""
+
+	switch {
+	case err == nil:
+		delivery.Status = github.DeliveryStatusCompleted
+		delivery.ProcessedAt = &now
+
+	case errors.Is(err, github.ErrUnsupportedEvent):
+		delivery.Status = github.DeliveryStatusSkipped
+		delivery.ErrorMessage = err.Error()
+		delivery.ProcessedAt = &now
+
+	case delivery.Attempts >= q.config.MaxAttempts:
+		delivery.Status = github.DeliveryStatusDeadLetter
+		delivery.ErrorMessage = err.Error()
+		delivery.ProcessedAt = &now
+		log.Printf("Webhook delivery %s dead-lettered after %d attempts: %v", delivery.ID, delivery.Attempts, err)
+
+		if q.integrations != nil {
+			userID := ""
+			if config != nil {
+				userID = config.UserID
+			}
+			q.integrations.TrackError(userID, "", "webhook_dead_letter",
+				fmt.Sprintf("delivery %s (%s) failed after %d attempts: %v", delivery.ID, delivery.Event, delivery.Attempts, err))
+		}
+
+	default:
+		next := now.Add(q.backoff(delivery.Attempts))
+		delivery.Status = github.DeliveryStatusFailed
+		delivery.ErrorMessage = err.Error()
+		delivery.NextAttemptAt = &next
+		log.Printf("Webhook delivery %s failed (attempt %d/%d), retrying at %s: %v",
+			delivery.ID, delivery.Attempts, q.config.MaxAttempts, next.Format(time.RFC3339), err)
+	}
+
+	if err := q.repo.UpdateDelivery(delivery); err != nil {
+		log.Printf("Failed to update webhook delivery %s: %v", delivery.ID, err)
+	}
+
+	// Report final outcomes of automation runs; retries and skipped events are not reported
+	if q.integrations != nil && config != nil &&
+		(delivery.Status == github.DeliveryStatusCompleted || delivery.Status == github.DeliveryStatusDeadLetter) {
+		q.integrations.TrackWebhookProcessed(config.UserID, delivery.ID, config.RepoFullName, delivery.Event,
+			delivery.Status, delivery.ErrorMessage)
+	}
+}
+
+// deliver parses a delivery's payload and runs the event processors
+func (q *Queue) deliver(delivery *github.WebhookDelivery, config *github.WebhookConfig) error {
+	payload, err := json.Marshal(delivery.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	event, err := github.ParseEvent(delivery.Event, payload)
+	if err != nil {
+		return err
+	}
+
+	return q.handler.HandleWebhook(delivery.Event, event, config)
+}
+
+// backoff returns the delay before the retry following the given attempt
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.config.BaseDelay
+	for i := 1; i < attempt && delay < q.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.config.MaxDelay {
+		delay = q.config.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,99 @@
+// Package storage stores files that must outlive a single server, such as
+// build artifacts and workspace checkpoint bundles, under slash-separated
+// keys. Files are kept on local disk by default, or in an S3-compatible
+// bucket (AWS S3, MinIO, R2) so several replicas can share them.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Backends supported by New
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// ErrNotFound is returned for keys that don't exist
+var ErrNotFound = errors.New("object not found")
+
+// Object describes a stored file
+type Object struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+}
+
+// Store is a flat key/value file store. Keys are slash-separated paths;
+// prefixes passed to List and DeletePrefix are treated as directories.
+type Store interface {
+	// Put stores size bytes read from r under key, replacing any existing file
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Open returns a reader for the file stored under key
+	Open(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	// List returns the files under a prefix, at any depth
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// Delete removes the file stored under key; missing keys are not an error
+	Delete(ctx context.Context, key string) error
+	// DeletePrefix removes every file under a prefix
+	DeletePrefix(ctx context.Context, prefix string) error
+	// Remote reports whether files are kept off this server's disk
+	Remote() bool
+}
+
+// Config holds configuration for object storage
+type Config struct {
+	Backend  string // local or s3
+	LocalDir string // Root directory of the local backend
+	S3       S3Config
+}
+
+// New creates the store selected by the configuration
+func New(config Config) (Store, error) {
+	switch config.Backend {
+	case "", BackendLocal:
+		return NewLocalStore(config.LocalDir)
+	case BackendS3:
+		return NewS3Store(config.S3)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q (use %s or %s)", config.Backend, BackendLocal, BackendS3)
+}
+
+// Join builds a key from path segments
+func Join(parts ...string) string {
+	nonEmpty := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.Trim(part, "/"); part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, "/")
+}
+
+// validKey reports whether a key is a relative path without empty, "." or
+// ".." segments
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// dirPrefix normalizes a prefix to end in a slash
+func dirPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jacklau/prism/internal/llm"
 	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/services/concurrency"
 )
 
 const (
@@ -21,20 +22,29 @@ const (
 	maxBackgroundOutput    = 1024 * 1024 // 1MB
 )
 
+// SecretMaskKey is the context key for a func(string) string masking the
+// secrets resolved into a tool's parameters. Background shells keep their
+// command line and output after the call, so they mask them with it.
+const SecretMaskKey contextKey = "secretMask"
+
 // BackgroundShell represents a shell process running in the background
 type BackgroundShell struct {
 	ID        string
 	UserID    string
 	Command   string
 	Args      []string
+	Display   string // Command line shown to the user, with secrets masked
 	WorkDir   string
+	Env       []string // nil inherits the server's environment
 	StartTime time.Time
+	EndTime   time.Time // Set once Done
 	Stdout    *strings.Builder
 	Stderr    *strings.Builder
 	Done      bool
 	ExitCode  int
 	Error     string
 	cancel    context.CancelFunc
+	mask      func(string) string // Masks secrets in output; nil if none were used
 	mu        sync.Mutex
 }
 
@@ -44,6 +54,7 @@ type BackgroundShellManager struct {
 	mu      sync.RWMutex
 	sandbox *sandbox.Service
 	config  ShellExecConfig
+	limiter *concurrency.Limiter // Per-user shell limit; maxBackgroundShells if nil
 }
 
 // NewBackgroundShellManager creates a new background shell manager
@@ -55,42 +66,73 @@ func NewBackgroundShellManager(sandbox *sandbox.Service, config ShellExecConfig)
 	}
 }
 
-// StartBackground starts a command in the background
-func (m *BackgroundShellManager) StartBackground(ctx context.Context, userID, command string, args []string, workDir string) (*BackgroundShell, error) {
+// SetLimiter limits each user's running shells with the per-user
+// concurrency limits instead of maxBackgroundShells
+func (m *BackgroundShellManager) SetLimiter(limiter *concurrency.Limiter) {
+	m.limiter = limiter
+}
+
+// StartBackground starts a command in the background. env is the command's
+// environment, or nil to inherit the server's. A user at their concurrency
+// limit waits for one of their shells to finish, until ctx is done or the
+// limiter's queue timeout.
+func (m *BackgroundShellManager) StartBackground(ctx context.Context, userID, command string, args []string, workDir string, env []string) (*BackgroundShell, error) {
+	release := func() {}
+	if m.limiter != nil {
+		var err error
+		if release, err = m.limiter.Acquire(ctx, userID, concurrency.Shells); err != nil {
+			return nil, err
+		}
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Count user's shells
-	userShellCount := 0
-	for _, shell := range m.shells {
-		if shell.UserID == userID && !shell.Done {
-			userShellCount++
+	if m.limiter == nil {
+		// Count user's shells
+		userShellCount := 0
+		for _, shell := range m.shells {
+			if shell.UserID == userID && !shell.Done {
+				userShellCount++
+			}
+		}
+		if userShellCount >= maxBackgroundShells {
+			return nil, fmt.Errorf("maximum number of background shells reached (%d)", maxBackgroundShells)
 		}
-	}
-	if userShellCount >= maxBackgroundShells {
-		return nil, fmt.Errorf("maximum number of background shells reached (%d)", maxBackgroundShells)
 	}
 
 	// Create shell
 	shellID := uuid.New().String()[:8]
 	shellCtx, cancel := context.WithTimeout(context.Background(), maxBackgroundShellTime)
 
+	display := strings.TrimSpace(command + " " + strings.Join(args, " "))
+	mask, _ := ctx.Value(SecretMaskKey).(func(string) string)
+	if mask != nil {
+		display = mask(display)
+	}
+
 	shell := &BackgroundShell{
 		ID:        shellID,
 		UserID:    userID,
 		Command:   command,
 		Args:      args,
+		Display:   display,
 		WorkDir:   workDir,
+		Env:       env,
 		StartTime: time.Now(),
 		Stdout:    &strings.Builder{},
 		Stderr:    &strings.Builder{},
 		cancel:    cancel,
+		mask:      mask,
 	}
 
 	m.shells[shellID] = shell
 
-	// Start the command
-	go m.runCommand(shellCtx, shell)
+	// Start the command, holding the user's slot until it ends
+	go func() {
+		defer release()
+		m.runCommand(shellCtx, shell)
+	}()
 
 	return shell, nil
 }
@@ -100,6 +142,7 @@ func (m *BackgroundShellManager) runCommand(ctx context.Context, shell *Backgrou
 
 	cmd := exec.CommandContext(ctx, shell.Command, shell.Args...)
 	cmd.Dir = shell.WorkDir
+	cmd.Env = shell.Env
 
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
@@ -140,7 +183,7 @@ func (m *BackgroundShellManager) runCommand(ctx context.Context, shell *Backgrou
 		for scanner.Scan() {
 			shell.mu.Lock()
 			if shell.Stdout.Len() < maxBackgroundOutput {
-				shell.Stdout.WriteString(scanner.Text())
+				shell.Stdout.WriteString(shell.maskOutput(scanner.Text()))
 				shell.Stdout.WriteString("\n")
 			}
 			shell.mu.Unlock()
@@ -154,7 +197,7 @@ func (m *BackgroundShellManager) runCommand(ctx context.Context, shell *Backgrou
 		for scanner.Scan() {
 			shell.mu.Lock()
 			if shell.Stderr.Len() < maxBackgroundOutput {
-				shell.Stderr.WriteString(scanner.Text())
+				shell.Stderr.WriteString(shell.maskOutput(scanner.Text()))
 				shell.Stderr.WriteString("\n")
 			}
 			shell.mu.Unlock()
@@ -166,6 +209,7 @@ func (m *BackgroundShellManager) runCommand(ctx context.Context, shell *Backgrou
 
 	shell.mu.Lock()
 	shell.Done = true
+	shell.EndTime = time.Now()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			shell.ExitCode = exitErr.ExitCode()
@@ -183,6 +227,15 @@ func (m *BackgroundShellManager) runCommand(ctx context.Context, shell *Backgrou
 	shell.mu.Unlock()
 }
 
+// maskOutput masks the secrets the shell's command was given in a line of
+// its output
+func (s *BackgroundShell) maskOutput(line string) string {
+	if s.mask == nil {
+		return line
+	}
+	return s.mask(line)
+}
+
 // GetShell retrieves a background shell by ID
 func (m *BackgroundShellManager) GetShell(shellID string) (*BackgroundShell, bool) {
 	m.mu.RLock()
@@ -319,7 +372,7 @@ func (t *BashOutputTool) Execute(ctx context.Context, params map[string]interfac
 		"stderr":    stderr,
 		"done":      done,
 		"exit_code": exitCode,
-		"command":   shell.Command + " " + strings.Join(shell.Args, " "),
+		"command":   shell.Display,
 		"duration":  time.Since(shell.StartTime).Milliseconds(),
 	}
 
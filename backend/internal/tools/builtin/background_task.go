@@ -0,0 +1,291 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jacklau/prism/internal/llm"
+)
+
+// defaultTaskLogLines is how many lines task_logs returns by default
+const defaultTaskLogLines = 100
+
+// RunBackgroundTool starts a long command, such as a dev server or a large
+// build, as a background task and returns right away. The agent checks on it
+// with task_status and task_logs. Tasks are background shells, so bash_output
+// and kill_shell work on them too.
+type RunBackgroundTool struct {
+	shell *ShellExecTool
+}
+
+// NewRunBackgroundTool creates a new run background tool
+func NewRunBackgroundTool(shell *ShellExecTool) *RunBackgroundTool {
+	return &RunBackgroundTool{shell: shell}
+}
+
+func (t *RunBackgroundTool) Name() string {
+	return "run_background"
+}
+
+func (t *RunBackgroundTool) Description() string {
+	return "Start a long-running command line in the background, e.g. 'npm run dev' or 'make release', and return a task_id immediately without waiting for it. Check on it later with task_status and read its output with task_logs; stop it with kill_shell. Tasks are stopped after 30 minutes. The command line is split like run_shell's, with the same restrictions."
+}
+
+func (t *RunBackgroundTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"command": {
+				Type:        "string",
+				Description: "The command line to run",
+			},
+			"cwd": {
+				Type:        "string",
+				Description: "Optional working directory (relative to workspace). Defaults to workspace root." + rootPathHelp,
+			},
+		},
+		Required: []string{"command"},
+	}
+}
+
+func (t *RunBackgroundTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	line, _ := params["command"].(string)
+	words, err := splitCommandLine(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("command parameter is required")
+	}
+
+	args := make([]interface{}, 0, len(words)-1)
+	for _, word := range words[1:] {
+		args = append(args, word)
+	}
+	shellParams := map[string]interface{}{
+		"command":           words[0],
+		"args":              args,
+		"run_in_background": true,
+	}
+	if cwd, ok := params["cwd"]; ok {
+		shellParams["cwd"] = cwd
+	}
+
+	result, err := t.shell.Execute(ctx, shellParams)
+	if err != nil {
+		return nil, err
+	}
+	started, _ := result.(map[string]interface{})
+	return map[string]interface{}{
+		"task_id": started["shell_id"],
+		"command": started["command"],
+		"status":  "running",
+		"message": "Task started in the background. Use task_status to check whether it has finished and task_logs to read its output.",
+	}, nil
+}
+
+func (t *RunBackgroundTool) RequiresConfirmation() bool {
+	return true
+}
+
+// TaskStatusTool reports the state of background tasks
+type TaskStatusTool struct {
+	shellManager *BackgroundShellManager
+}
+
+// NewTaskStatusTool creates a new task status tool
+func NewTaskStatusTool(shellManager *BackgroundShellManager) *TaskStatusTool {
+	return &TaskStatusTool{shellManager: shellManager}
+}
+
+func (t *TaskStatusTool) Name() string {
+	return "task_status"
+}
+
+func (t *TaskStatusTool) Description() string {
+	return "Check on a background task started with run_background: whether it is running, completed or failed, its exit code, how long it has run and how much output it has written. Without a task_id, lists all your background tasks."
+}
+
+func (t *TaskStatusTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"task_id": {
+				Type:        "string",
+				Description: "The task to check (optional; omit to list all tasks)",
+			},
+		},
+	}
+}
+
+func (t *TaskStatusTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	taskID, _ := params["task_id"].(string)
+	if taskID != "" {
+		shell, err := userShell(t.shellManager, userID, taskID)
+		if err != nil {
+			return nil, err
+		}
+		return taskStatus(shell), nil
+	}
+
+	shells := t.shellManager.ListUserShells(userID)
+	sort.Slice(shells, func(i, j int) bool {
+		return shells[i].StartTime.Before(shells[j].StartTime)
+	})
+	tasks := make([]map[string]interface{}, 0, len(shells))
+	for _, shell := range shells {
+		tasks = append(tasks, taskStatus(shell))
+	}
+	return map[string]interface{}{
+		"tasks": tasks,
+		"count": len(tasks),
+	}, nil
+}
+
+func (t *TaskStatusTool) RequiresConfirmation() bool {
+	return false
+}
+
+// TaskLogsTool reads the output of a background task
+type TaskLogsTool struct {
+	shellManager *BackgroundShellManager
+}
+
+// NewTaskLogsTool creates a new task logs tool
+func NewTaskLogsTool(shellManager *BackgroundShellManager) *TaskLogsTool {
+	return &TaskLogsTool{shellManager: shellManager}
+}
+
+func (t *TaskLogsTool) Name() string {
+	return "task_logs"
+}
+
+func (t *TaskLogsTool) Description() string {
+	return "Read the output of a background task started with run_background. Returns the last lines of its stdout and stderr (100 by default), optionally only those matching a regex filter, along with its status."
+}
+
+func (t *TaskLogsTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"task_id": {
+				Type:        "string",
+				Description: "The task to read the output of",
+			},
+			"lines": {
+				Type:        "number",
+				Description: "How many of the last lines of each stream to return (default 100, 0 for all)",
+			},
+			"filter": {
+				Type:        "string",
+				Description: "Optional regex pattern to filter output lines",
+			},
+		},
+		Required: []string{"task_id"},
+	}
+}
+
+func (t *TaskLogsTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	taskID, _ := params["task_id"].(string)
+	if taskID == "" {
+		return nil, fmt.Errorf("task_id parameter is required")
+	}
+	shell, err := userShell(t.shellManager, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := defaultTaskLogLines
+	if n, ok := params["lines"].(float64); ok && n >= 0 {
+		lines = int(n)
+	}
+	var re *regexp.Regexp
+	if filter, _ := params["filter"].(string); filter != "" {
+		if re, err = regexp.Compile(filter); err != nil {
+			return nil, fmt.Errorf("invalid filter pattern: %w", err)
+		}
+	}
+
+	shell.mu.Lock()
+	stdout := shell.Stdout.String()
+	stderr := shell.Stderr.String()
+	shell.mu.Unlock()
+
+	result := taskStatus(shell)
+	result["stdout"] = lastLines(stdout, re, lines)
+	result["stderr"] = lastLines(stderr, re, lines)
+	return result, nil
+}
+
+func (t *TaskLogsTool) RequiresConfirmation() bool {
+	return false
+}
+
+// userShell looks up one of a user's background shells
+func userShell(manager *BackgroundShellManager, userID, shellID string) (*BackgroundShell, error) {
+	shell, ok := manager.GetShell(shellID)
+	if !ok || shell.UserID != userID {
+		return nil, fmt.Errorf("task not found: %s", shellID)
+	}
+	return shell, nil
+}
+
+// taskStatus describes a background shell as a task, without its output
+func taskStatus(shell *BackgroundShell) map[string]interface{} {
+	shell.mu.Lock()
+	defer shell.mu.Unlock()
+
+	status := "running"
+	end := time.Now()
+	if shell.Done {
+		end = shell.EndTime
+		status = "completed"
+		if shell.ExitCode != 0 || shell.Error != "" {
+			status = "failed"
+		}
+	}
+
+	result := map[string]interface{}{
+		"task_id":      shell.ID,
+		"command":      shell.Display,
+		"status":       status,
+		"started_at":   shell.StartTime.Format(time.RFC3339),
+		"duration":     end.Sub(shell.StartTime).Milliseconds(),
+		"stdout_bytes": shell.Stdout.Len(),
+		"stderr_bytes": shell.Stderr.Len(),
+	}
+	if shell.Done {
+		result["exit_code"] = shell.ExitCode
+	}
+	if shell.Error != "" {
+		result["error"] = shell.Error
+	}
+	return result
+}
+
+// lastLines returns the last n lines of output, or all of them if n is 0,
+// keeping only lines matching re if it is set
+func lastLines(output string, re *regexp.Regexp, n int) string {
+	if re != nil {
+		output = filterLines(output, re)
+	}
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -24,7 +24,7 @@ func (t *CodeExecutionTool) Name() string {
 }
 
 func (t *CodeExecutionTool) Description() string {
-	return "Execute code in a sandboxed environment. Supports Python, Node.js (JavaScript), and Shell scripts. Returns the output (stdout/stderr) and exit code. Use this for running code, scripts, or shell commands."
+	return "Execute code in a sandboxed environment. Supports Python, Node.js (JavaScript), Shell scripts, Go, Rust, Java, C and C++. Interpreted code runs as given; compiled languages take a complete program (package main for Go, a Main class for Java) that is built and then run. Returns the output (stdout/stderr) and exit code. Use this for running code, scripts, or shell commands."
 }
 
 func (t *CodeExecutionTool) Parameters() llm.JSONSchema {
@@ -38,7 +38,7 @@ func (t *CodeExecutionTool) Parameters() llm.JSONSchema {
 			"environment": {
 				Type:        "string",
 				Description: "The execution environment",
-				Enum:        []string{"python", "node", "shell"},
+				Enum:        []string{"python", "node", "shell", "go", "rust", "java", "c", "cpp"},
 			},
 		},
 		Required: []string{"code", "environment"},
@@ -58,10 +58,10 @@ func (t *CodeExecutionTool) Execute(ctx context.Context, params map[string]inter
 
 	// Validate environment
 	switch environment {
-	case "python", "node", "shell":
+	case "python", "node", "shell", "go", "rust", "java", "c", "cpp":
 		// valid
 	default:
-		return nil, fmt.Errorf("invalid environment: %s (must be python, node, or shell)", environment)
+		return nil, fmt.Errorf("invalid environment: %s (must be python, node, shell, go, rust, java, c, or cpp)", environment)
 	}
 
 	req := &github.CodeRunRequest{
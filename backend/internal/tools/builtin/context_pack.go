@@ -0,0 +1,82 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/services/contextpack"
+)
+
+// PackContextTool packs a workspace directory into one block of context
+type PackContextTool struct {
+	sandbox *sandbox.Service
+	packer  *contextpack.Packer
+}
+
+// NewPackContextTool creates a new context pack tool
+func NewPackContextTool(sandbox *sandbox.Service, packer *contextpack.Packer) *PackContextTool {
+	return &PackContextTool{sandbox: sandbox, packer: packer}
+}
+
+func (t *PackContextTool) Name() string {
+	return "pack_context"
+}
+
+func (t *PackContextTool) Description() string {
+	return "Get an overview of a workspace directory in one call: its file tree plus the contents of its most relevant files, fit to a token budget. Files are ranked by how well their paths and contents match the query, with READMEs, manifests and entry points first when there is none. Use this to get oriented in a project or an unfamiliar area of it instead of listing and reading files one at a time; then read anything it truncated or omitted with file_read."
+}
+
+func (t *PackContextTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"dir": {
+				Type:        "string",
+				Description: "Directory to pack (optional, defaults to workspace root). Must be a relative path." + rootPathHelp,
+			},
+			"globs": {
+				Type:        "array",
+				Description: "Only pack files matching these glob patterns, e.g. ['**/*.go', 'go.mod'] (optional)",
+			},
+			"query": {
+				Type:        "string",
+				Description: "What you are working on, e.g. 'websocket authentication'; files mentioning it rank first (optional)",
+			},
+			"token_budget": {
+				Type:        "number",
+				Description: "Approximate size of the packed context in tokens (optional)",
+			},
+		},
+	}
+}
+
+func (t *PackContextTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	dir, _ := params["dir"].(string)
+	spec := contextpack.Spec{
+		Dir: toolPath(ctx, t.sandbox, userID, dir),
+	}
+	if globs, ok := params["globs"].([]interface{}); ok {
+		for _, glob := range globs {
+			if s, ok := glob.(string); ok && s != "" {
+				spec.Globs = append(spec.Globs, s)
+			}
+		}
+	}
+	spec.Query, _ = params["query"].(string)
+	if budget, ok := params["token_budget"].(float64); ok && budget > 0 {
+		spec.TokenBudget = int(budget)
+	}
+
+	return t.packer.Pack(userID, spec)
+}
+
+func (t *PackContextTool) RequiresConfirmation() bool {
+	return false
+}
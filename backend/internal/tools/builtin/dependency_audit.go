@@ -0,0 +1,86 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/services/audit"
+	"github.com/jacklau/prism/internal/tools"
+)
+
+// DependencyAuditTool scans workspace dependencies for known vulnerabilities
+type DependencyAuditTool struct {
+	sandbox *sandbox.Service
+	audit   *audit.Service
+}
+
+// NewDependencyAuditTool creates a new dependency audit tool
+func NewDependencyAuditTool(sandbox *sandbox.Service, auditService *audit.Service) *DependencyAuditTool {
+	return &DependencyAuditTool{sandbox: sandbox, audit: auditService}
+}
+
+func (t *DependencyAuditTool) Name() string {
+	return "dependency_audit"
+}
+
+func (t *DependencyAuditTool) Description() string {
+	return "Scan the workspace's dependencies for known security vulnerabilities using govulncheck (Go), npm audit (Node.js) and pip-audit (Python). Ecosystems are detected from go.mod, package-lock.json, requirements.txt or pyproject.toml at the workspace root. Returns normalized findings with severity, affected package and the version that fixes each issue."
+}
+
+func (t *DependencyAuditTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"ecosystem": {
+				Type:        "string",
+				Description: "Only scan this ecosystem (optional, defaults to every detected one)",
+				Enum:        []string{audit.EcosystemGo, audit.EcosystemNPM, audit.EcosystemPython},
+			},
+		},
+	}
+}
+
+func (t *DependencyAuditTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return t.ExecuteWithProgress(ctx, params, nil)
+}
+
+// ExecuteWithProgress runs the audit like Execute, reporting each
+// ecosystem's scan as it starts
+func (t *DependencyAuditTool) ExecuteWithProgress(ctx context.Context, params map[string]interface{}, reportProgress tools.ProgressReporter) (interface{}, error) {
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	workDir, err := t.sandbox.GetOrCreateWorkDir(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	var ecosystems []string
+	if ecosystem, ok := params["ecosystem"].(string); ok && ecosystem != "" {
+		ecosystems = []string{ecosystem}
+	}
+
+	report, err := t.audit.AuditWithProgress(workDir, ecosystems, func(ecosystem string, index, total int) {
+		reportProgress.Report(tools.Progress{
+			Message: fmt.Sprintf("Scanning %s dependencies", ecosystem),
+			Current: int64(index),
+			Total:   int64(total),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if report.Failed() {
+		return nil, fmt.Errorf("dependency audit failed: %s", report.Errors())
+	}
+
+	return report, nil
+}
+
+func (t *DependencyAuditTool) RequiresConfirmation() bool {
+	return false
+}
@@ -0,0 +1,274 @@
+package builtin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jacklau/prism/internal/integrations/confluence"
+	"github.com/jacklau/prism/internal/integrations/notion"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/services/docsources"
+)
+
+// docSourceError explains documentation source errors in terms the model
+// can act on
+func docSourceError(source string, err error) error {
+	switch {
+	case errors.Is(err, docsources.ErrNotionNotConnected), errors.Is(err, docsources.ErrConfluenceNotConnected):
+		return fmt.Errorf("%s is not connected; ask the user to connect it in Settings → Integrations", source)
+	case errors.Is(err, notion.ErrUnauthorized), errors.Is(err, confluence.ErrUnauthorized):
+		return fmt.Errorf("%s rejected the saved credentials; ask the user to reconnect it in Settings → Integrations", source)
+	case errors.Is(err, notion.ErrNotFound), errors.Is(err, confluence.ErrNotFound):
+		return fmt.Errorf("%s page not found or not accessible with the user's credentials", source)
+	}
+	return fmt.Errorf("%s request failed: %w", source, err)
+}
+
+// docSourceUserID returns the user a documentation source tool runs for
+func docSourceUserID(ctx context.Context) (string, error) {
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok || userID == "" {
+		return "", fmt.Errorf("user ID not found in context")
+	}
+	return userID, nil
+}
+
+// docSourceLimit reads the optional limit parameter of a search tool
+func docSourceLimit(params map[string]interface{}) int {
+	if n, ok := params["limit"].(float64); ok && n >= 1 {
+		return int(n)
+	}
+	return 10
+}
+
+// NotionSearchTool searches the user's Notion pages
+type NotionSearchTool struct {
+	docs *docsources.Service
+}
+
+// NewNotionSearchTool creates a new Notion search tool
+func NewNotionSearchTool(docs *docsources.Service) *NotionSearchTool {
+	return &NotionSearchTool{docs: docs}
+}
+
+func (t *NotionSearchTool) Name() string {
+	return "notion_search"
+}
+
+func (t *NotionSearchTool) Description() string {
+	return "Search the Notion pages and databases shared with the user's Notion integration by title. Returns each match's ID, title, URL and when it was last edited, most recent first. Use notion_read_page with an ID to read a page. Requires the user to have connected Notion in Settings."
+}
+
+func (t *NotionSearchTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"query": {
+				Type:        "string",
+				Description: "Text to search page titles for",
+			},
+			"limit": {
+				Type:        "integer",
+				Description: "Maximum number of pages to return (1-50)",
+				Default:     10,
+			},
+		},
+		Required: []string{"query"},
+	}
+}
+
+func (t *NotionSearchTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	userID, err := docSourceUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query, ok := params["query"].(string)
+	if !ok || query == "" {
+		return nil, fmt.Errorf("query parameter is required")
+	}
+
+	pages, err := t.docs.SearchNotion(userID, query, docSourceLimit(params))
+	if err != nil {
+		return nil, docSourceError("notion", err)
+	}
+	return map[string]interface{}{
+		"query": query,
+		"pages": pages,
+		"count": len(pages),
+	}, nil
+}
+
+func (t *NotionSearchTool) RequiresConfirmation() bool {
+	return false
+}
+
+// NotionReadPageTool reads a Notion page as Markdown
+type NotionReadPageTool struct {
+	docs *docsources.Service
+}
+
+// NewNotionReadPageTool creates a new Notion page read tool
+func NewNotionReadPageTool(docs *docsources.Service) *NotionReadPageTool {
+	return &NotionReadPageTool{docs: docs}
+}
+
+func (t *NotionReadPageTool) Name() string {
+	return "notion_read_page"
+}
+
+func (t *NotionReadPageTool) Description() string {
+	return "Read a Notion page as Markdown, including nested blocks. Subpages are listed with their IDs rather than included; read them separately if needed. Long pages are truncated. Accepts a page ID from notion_search or a Notion page URL."
+}
+
+func (t *NotionReadPageTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"page_id": {
+				Type:        "string",
+				Description: "The page ID or URL",
+			},
+		},
+		Required: []string{"page_id"},
+	}
+}
+
+func (t *NotionReadPageTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	userID, err := docSourceUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pageID, ok := params["page_id"].(string)
+	if !ok || pageID == "" {
+		return nil, fmt.Errorf("page_id parameter is required")
+	}
+
+	page, err := t.docs.ReadNotionPage(userID, pageID)
+	if err != nil {
+		return nil, docSourceError("notion", err)
+	}
+	return page, nil
+}
+
+func (t *NotionReadPageTool) RequiresConfirmation() bool {
+	return false
+}
+
+// ConfluenceSearchTool searches the user's Confluence pages
+type ConfluenceSearchTool struct {
+	docs *docsources.Service
+}
+
+// NewConfluenceSearchTool creates a new Confluence search tool
+func NewConfluenceSearchTool(docs *docsources.Service) *ConfluenceSearchTool {
+	return &ConfluenceSearchTool{docs: docs}
+}
+
+func (t *ConfluenceSearchTool) Name() string {
+	return "confluence_search"
+}
+
+func (t *ConfluenceSearchTool) Description() string {
+	return "Search the full text of the Confluence pages the user can view. Returns each match's ID, title, space, URL and an excerpt. Use confluence_read_page with an ID to read a page. Requires the user to have connected Confluence in Settings."
+}
+
+func (t *ConfluenceSearchTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"query": {
+				Type:        "string",
+				Description: "Text to search pages for",
+			},
+			"space": {
+				Type:        "string",
+				Description: "Only return pages in the space with this key, e.g. 'ENG' (optional)",
+			},
+			"limit": {
+				Type:        "integer",
+				Description: "Maximum number of pages to return (1-50)",
+				Default:     10,
+			},
+		},
+		Required: []string{"query"},
+	}
+}
+
+func (t *ConfluenceSearchTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	userID, err := docSourceUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query, ok := params["query"].(string)
+	if !ok || query == "" {
+		return nil, fmt.Errorf("query parameter is required")
+	}
+	space, _ := params["space"].(string)
+
+	pages, err := t.docs.SearchConfluence(userID, query, space, docSourceLimit(params))
+	if err != nil {
+		return nil, docSourceError("confluence", err)
+	}
+	return map[string]interface{}{
+		"query": query,
+		"pages": pages,
+		"count": len(pages),
+	}, nil
+}
+
+func (t *ConfluenceSearchTool) RequiresConfirmation() bool {
+	return false
+}
+
+// ConfluenceReadPageTool reads a Confluence page as Markdown
+type ConfluenceReadPageTool struct {
+	docs *docsources.Service
+}
+
+// NewConfluenceReadPageTool creates a new Confluence page read tool
+func NewConfluenceReadPageTool(docs *docsources.Service) *ConfluenceReadPageTool {
+	return &ConfluenceReadPageTool{docs: docs}
+}
+
+func (t *ConfluenceReadPageTool) Name() string {
+	return "confluence_read_page"
+}
+
+func (t *ConfluenceReadPageTool) Description() string {
+	return "Read a Confluence page as Markdown. Long pages are truncated. Takes the numeric page ID returned by confluence_search."
+}
+
+func (t *ConfluenceReadPageTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"page_id": {
+				Type:        "string",
+				Description: "The numeric page ID",
+			},
+		},
+		Required: []string{"page_id"},
+	}
+}
+
+func (t *ConfluenceReadPageTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	userID, err := docSourceUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pageID, ok := params["page_id"].(string)
+	if !ok || pageID == "" {
+		return nil, fmt.Errorf("page_id parameter is required")
+	}
+
+	page, err := t.docs.ReadConfluencePage(userID, pageID)
+	if err != nil {
+		return nil, docSourceError("confluence", err)
+	}
+	return page, nil
+}
+
+func (t *ConfluenceReadPageTool) RequiresConfirmation() bool {
+	return false
+}
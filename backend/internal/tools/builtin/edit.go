@@ -26,7 +26,7 @@ func (t *EditTool) Name() string {
 }
 
 func (t *EditTool) Description() string {
-	return `Performs exact string replacements in files. The old_string must be unique in the file unless replace_all is true. Use this for precise edits instead of rewriting entire files. Always read the file first before editing.`
+	return `Performs exact string replacements in files. The old_string must be unique in the file unless replace_all is true. Use this for precise edits instead of rewriting entire files. Always read the file first before editing. Pass the hash from file_read as expected_hash to fail instead of editing a file that changed since.`
 }
 
 func (t *EditTool) Parameters() llm.JSONSchema {
@@ -64,6 +64,7 @@ func (t *EditTool) Execute(ctx context.Context, params map[string]interface{}) (
 	if !ok || filePath == "" {
 		return nil, fmt.Errorf("file_path parameter is required")
 	}
+	filePath = toolPath(ctx, t.sandbox, userID, filePath)
 
 	oldString, ok := params["old_string"].(string)
 	if !ok {
@@ -84,44 +85,46 @@ func (t *EditTool) Execute(ctx context.Context, params map[string]interface{}) (
 		replaceAll = ra
 	}
 
-	// Read current file content
-	content, err := t.sandbox.GetFileContent(userID, filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
+	expectedHash, _ := params["expected_hash"].(string)
 
-	// Count occurrences
-	count := strings.Count(content, oldString)
-	if count == 0 {
-		return nil, fmt.Errorf("old_string not found in file")
-	}
+	// Read, replace and write under the file's lock so a concurrent writer
+	// can't slip in between
+	count := 0
+	hash, err := t.sandbox.UpdateFile(userID, filePath, expectedHash, func(content string, exists bool) (string, error) {
+		if !exists {
+			return "", fmt.Errorf("file not found: %s", filePath)
+		}
 
-	if !replaceAll && count > 1 {
-		return nil, fmt.Errorf("old_string found %d times in file. Either provide more context to make it unique, or use replace_all: true", count)
-	}
+		// Count occurrences
+		count = strings.Count(content, oldString)
+		if count == 0 {
+			return "", fmt.Errorf("old_string not found in file")
+		}
 
-	// Save to history before modifying
-	if t.historyRepo != nil {
-		_, _ = t.historyRepo.Create(userID, filePath, content, "edit")
-	}
+		if !replaceAll && count > 1 {
+			return "", fmt.Errorf("old_string found %d times in file. Either provide more context to make it unique, or use replace_all: true", count)
+		}
 
-	// Perform replacement
-	var newContent string
-	if replaceAll {
-		newContent = strings.ReplaceAll(content, oldString, newString)
-	} else {
-		newContent = strings.Replace(content, oldString, newString, 1)
-	}
+		// Save to history before modifying
+		if t.historyRepo != nil {
+			recordHistory(ctx, t.historyRepo, userID, filePath, content, "edit")
+		}
 
-	// Write back
-	if err := t.sandbox.WriteFile(userID, filePath, newContent); err != nil {
-		return nil, fmt.Errorf("failed to write file: %w", err)
+		// Perform replacement
+		if replaceAll {
+			return strings.ReplaceAll(content, oldString, newString), nil
+		}
+		return strings.Replace(content, oldString, newString, 1), nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return map[string]interface{}{
 		"success":      true,
 		"path":         filePath,
 		"replacements": count,
+		"hash":         hash,
 	}, nil
 }
 
@@ -145,7 +148,7 @@ func (t *MultiEditTool) Name() string {
 }
 
 func (t *MultiEditTool) Description() string {
-	return `Performs batch edits across multiple files in a single operation. Each edit specifies a file path, old string, and new string. All edits are validated before any are applied.`
+	return `Performs batch edits across multiple files in a single operation. Each edit specifies a file path, old string, and new string. All edits are validated before any are applied, and a file changed by someone else after validation is reported as a conflict rather than overwritten.`
 }
 
 func (t *MultiEditTool) Parameters() llm.JSONSchema {
@@ -201,6 +204,7 @@ func (t *MultiEditTool) Execute(ctx context.Context, params map[string]interface
 		if filePath == "" || oldString == "" {
 			return nil, fmt.Errorf("edit %d: file_path and old_string are required", i)
 		}
+		filePath = toolPath(ctx, t.sandbox, userID, filePath)
 
 		edits = append(edits, EditOperation{
 			FilePath:  filePath,
@@ -242,14 +246,14 @@ func (t *MultiEditTool) Execute(ctx context.Context, params map[string]interface
 	// Phase 2: Save all originals to history
 	if t.historyRepo != nil {
 		for _, ve := range validatedEdits {
-			_, _ = t.historyRepo.Create(userID, ve.edit.FilePath, ve.originalContent, "multi_edit")
+			recordHistory(ctx, t.historyRepo, userID, ve.edit.FilePath, ve.originalContent, "multi_edit")
 		}
 	}
 
-	// Phase 3: Apply all edits
+	// Phase 3: Apply all edits, unless a file changed since it was validated
 	results := make([]EditResult, 0, len(validatedEdits))
 	for _, ve := range validatedEdits {
-		err := t.sandbox.WriteFile(userID, ve.edit.FilePath, ve.newContent)
+		_, err := t.sandbox.WriteFileIfMatch(userID, ve.edit.FilePath, ve.newContent, sandbox.ContentHash(ve.originalContent))
 		if err != nil {
 			results = append(results, EditResult{
 				FilePath: ve.edit.FilePath,
@@ -2,11 +2,13 @@ package builtin
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/jacklau/prism/internal/database/repository"
 	"github.com/jacklau/prism/internal/llm"
 	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/services/changes"
 )
 
 // userIDKey is the context key for user ID
@@ -14,6 +16,17 @@ type contextKey string
 
 const UserIDKey contextKey = "userID"
 
+// TurnIDKey is the context key for the assistant turn a tool runs in. File
+// history entries are tagged with it so a turn's changes can be reviewed and
+// reverted as a unit.
+const TurnIDKey contextKey = "turnID"
+
+// recordHistory saves a file history entry, attributing it to the current turn
+func recordHistory(ctx context.Context, historyRepo *repository.FileHistoryRepository, userID, path, content, operation string) {
+	turnID, _ := ctx.Value(TurnIDKey).(string)
+	_, _ = historyRepo.CreateForTurn(userID, path, content, operation, turnID)
+}
+
 // FileReadTool reads file content from the user's sandbox
 type FileReadTool struct {
 	sandbox *sandbox.Service
@@ -38,7 +51,7 @@ func (t *FileReadTool) Parameters() llm.JSONSchema {
 		Properties: map[string]llm.JSONProperty{
 			"path": {
 				Type:        "string",
-				Description: "The relative path to the file to read (e.g., 'src/main.py' or 'index.html')",
+				Description: "The relative path to the file to read (e.g., 'src/main.py' or 'index.html')." + rootPathHelp,
 			},
 		},
 		Required: []string{"path"},
@@ -55,6 +68,7 @@ func (t *FileReadTool) Execute(ctx context.Context, params map[string]interface{
 	if !ok || path == "" {
 		return nil, fmt.Errorf("path parameter is required")
 	}
+	path = toolPath(ctx, t.sandbox, userID, path)
 
 	content, err := t.sandbox.GetFileContent(userID, path)
 	if err != nil {
@@ -64,6 +78,7 @@ func (t *FileReadTool) Execute(ctx context.Context, params map[string]interface{
 	return map[string]interface{}{
 		"content": content,
 		"path":    path,
+		"hash":    sandbox.ContentHash(content),
 	}, nil
 }
 
@@ -87,7 +102,7 @@ func (t *FileWriteTool) Name() string {
 }
 
 func (t *FileWriteTool) Description() string {
-	return "Write content to a file in the user's sandbox workspace. Creates the file if it doesn't exist, or overwrites if it does. Parent directories are created automatically."
+	return "Write content to a file in the user's sandbox workspace. Creates the file if it doesn't exist, or overwrites if it does. Parent directories are created automatically. Pass the hash from file_read as expected_hash to fail instead of overwriting changes made since."
 }
 
 func (t *FileWriteTool) Parameters() llm.JSONSchema {
@@ -96,7 +111,7 @@ func (t *FileWriteTool) Parameters() llm.JSONSchema {
 		Properties: map[string]llm.JSONProperty{
 			"path": {
 				Type:        "string",
-				Description: "The relative path to the file to write (e.g., 'src/main.py' or 'index.html')",
+				Description: "The relative path to the file to write (e.g., 'src/main.py' or 'index.html')." + rootPathHelp,
 			},
 			"content": {
 				Type:        "string",
@@ -117,25 +132,29 @@ func (t *FileWriteTool) Execute(ctx context.Context, params map[string]interface
 	if !ok || path == "" {
 		return nil, fmt.Errorf("path parameter is required")
 	}
+	path = toolPath(ctx, t.sandbox, userID, path)
 
 	content, ok := params["content"].(string)
 	if !ok {
 		return nil, fmt.Errorf("content parameter is required")
 	}
 
-	// Save file history before writing (for existing files)
-	if t.historyRepo != nil {
-		existingContent, err := t.sandbox.GetFileContent(userID, path)
-		if err == nil && existingContent != "" {
-			// File exists, save its current content to history
-			_, _ = t.historyRepo.Create(userID, path, existingContent, "update")
-		} else {
-			// New file, record creation
-			_, _ = t.historyRepo.Create(userID, path, "", "create")
-		}
-	}
+	expectedHash, _ := params["expected_hash"].(string)
 
-	if err := t.sandbox.WriteFile(userID, path, content); err != nil {
+	hash, err := t.sandbox.UpdateFile(userID, path, expectedHash, func(existingContent string, exists bool) (string, error) {
+		// Save file history before writing (for existing files)
+		if t.historyRepo != nil {
+			if exists && existingContent != "" {
+				// File exists, save its current content to history
+				recordHistory(ctx, t.historyRepo, userID, path, existingContent, "update")
+			} else {
+				// New file, record creation
+				recordHistory(ctx, t.historyRepo, userID, path, "", "create")
+			}
+		}
+		return content, nil
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -143,6 +162,7 @@ func (t *FileWriteTool) Execute(ctx context.Context, params map[string]interface
 		"success": true,
 		"path":    path,
 		"bytes":   len(content),
+		"hash":    hash,
 	}, nil
 }
 
@@ -238,13 +258,14 @@ func (t *FileDeleteTool) Execute(ctx context.Context, params map[string]interfac
 	if !ok || path == "" {
 		return nil, fmt.Errorf("path parameter is required")
 	}
+	path = toolPath(ctx, t.sandbox, userID, path)
 
 	// Save file history before deleting
 	if t.historyRepo != nil {
 		existingContent, err := t.sandbox.GetFileContent(userID, path)
 		if err == nil {
 			// Save the file content before deletion
-			_, _ = t.historyRepo.Create(userID, path, existingContent, "delete")
+			recordHistory(ctx, t.historyRepo, userID, path, existingContent, "delete")
 		}
 	}
 
@@ -430,7 +451,7 @@ func (t *FileHistoryRestoreTool) Execute(ctx context.Context, params map[string]
 	// Save current file content to history before restoring
 	existingContent, err := t.sandbox.GetFileContent(userID, historyEntry.FilePath)
 	if err == nil && existingContent != "" {
-		_, _ = t.historyRepo.Create(userID, historyEntry.FilePath, existingContent, "update")
+		recordHistory(ctx, t.historyRepo, userID, historyEntry.FilePath, existingContent, "update")
 	}
 
 	// Restore the file content
@@ -524,6 +545,81 @@ func (t *FileHistoryGetTool) RequiresConfirmation() bool {
 	return false
 }
 
+// FileHistoryDiffTool shows what changed between a history entry and the
+// file's current or previous version
+type FileHistoryDiffTool struct {
+	changeService *changes.Service
+}
+
+// NewFileHistoryDiffTool creates a new file history diff tool
+func NewFileHistoryDiffTool(changeService *changes.Service) *FileHistoryDiffTool {
+	return &FileHistoryDiffTool{changeService: changeService}
+}
+
+func (t *FileHistoryDiffTool) Name() string {
+	return "file_history_diff"
+}
+
+func (t *FileHistoryDiffTool) Description() string {
+	return "Get a unified diff between a file history entry and the file's current content or its previous history entry. Cheaper than fetching both versions when you only need to see what changed."
+}
+
+func (t *FileHistoryDiffTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"history_id": {
+				Type:        "string",
+				Description: "The ID of the history entry to diff",
+			},
+			"against": {
+				Type:        "string",
+				Description: "What to diff the entry against: the file as it is now (current, the default) or the entry recorded before it (previous)",
+				Enum:        []string{changes.AgainstCurrent, changes.AgainstPrevious},
+			},
+		},
+		Required: []string{"history_id"},
+	}
+}
+
+func (t *FileHistoryDiffTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	if t.changeService == nil {
+		return nil, fmt.Errorf("file history not available")
+	}
+
+	historyID, ok := params["history_id"].(string)
+	if !ok || historyID == "" {
+		return nil, fmt.Errorf("history_id parameter is required")
+	}
+
+	against := changes.AgainstCurrent
+	if a, ok := params["against"].(string); ok && a != "" {
+		against = a
+	}
+	if against != changes.AgainstCurrent && against != changes.AgainstPrevious {
+		return nil, fmt.Errorf("against must be %q or %q", changes.AgainstCurrent, changes.AgainstPrevious)
+	}
+
+	result, err := t.changeService.DiffHistory(userID, historyID, against)
+	if err != nil {
+		if errors.Is(err, changes.ErrHistoryNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to diff history entry: %w", err)
+	}
+
+	return result, nil
+}
+
+func (t *FileHistoryDiffTool) RequiresConfirmation() bool {
+	return false
+}
+
 // FileRenameTool renames or moves a file in the user's sandbox
 type FileRenameTool struct {
 	sandbox     *sandbox.Service
@@ -570,15 +666,27 @@ func (t *FileRenameTool) Execute(ctx context.Context, params map[string]interfac
 	if !ok || sourcePath == "" {
 		return nil, fmt.Errorf("source_path parameter is required")
 	}
+	sourcePath = toolPath(ctx, t.sandbox, userID, sourcePath)
 
 	destPath, ok := params["dest_path"].(string)
 	if !ok || destPath == "" {
 		return nil, fmt.Errorf("dest_path parameter is required")
 	}
+	destPath = toolPath(ctx, t.sandbox, userID, destPath)
 
-	// Record in history before rename
+	// Record in history before rename, keeping enough to move the file back
 	if t.historyRepo != nil {
-		_, _ = t.historyRepo.Create(userID, sourcePath, "", "rename")
+		if existingContent, err := t.sandbox.GetFileContent(userID, sourcePath); err == nil {
+			recordHistory(ctx, t.historyRepo, userID, sourcePath, existingContent, "rename")
+			if destContent, err := t.sandbox.GetFileContent(userID, destPath); err == nil {
+				recordHistory(ctx, t.historyRepo, userID, destPath, destContent, "update")
+			} else {
+				recordHistory(ctx, t.historyRepo, userID, destPath, "", "create")
+			}
+		} else {
+			// Directories have no content to keep
+			recordHistory(ctx, t.historyRepo, userID, sourcePath, "", "rename_dir")
+		}
 	}
 
 	if err := t.sandbox.RenameFile(userID, sourcePath, destPath); err != nil {
@@ -637,6 +745,7 @@ func (t *FileCreateDirectoryTool) Execute(ctx context.Context, params map[string
 	if !ok || path == "" {
 		return nil, fmt.Errorf("path parameter is required")
 	}
+	path = toolPath(ctx, t.sandbox, userID, path)
 
 	if err := t.sandbox.CreateDirectory(userID, path); err != nil {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
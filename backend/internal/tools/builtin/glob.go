@@ -6,26 +6,12 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
 
 	"github.com/bmatcuk/doublestar/v4"
 	"github.com/jacklau/prism/internal/llm"
 	"github.com/jacklau/prism/internal/sandbox"
 )
 
-// Default directories to skip during glob operations
-var defaultSkipDirs = map[string]bool{
-	".git":         true,
-	"node_modules": true,
-	"vendor":       true,
-	".venv":        true,
-	"__pycache__":  true,
-	".cache":       true,
-	"dist":         true,
-	"build":        true,
-	".next":        true,
-}
-
 // GlobTool finds files matching glob patterns
 type GlobTool struct {
 	sandbox *sandbox.Service
@@ -54,7 +40,7 @@ func (t *GlobTool) Parameters() llm.JSONSchema {
 			},
 			"path": {
 				Type:        "string",
-				Description: "The directory to search in (optional, defaults to workspace root). Must be a relative path.",
+				Description: "The directory to search in (optional, defaults to workspace root). Must be a relative path." + rootPathHelp,
 			},
 		},
 		Required: []string{"pattern"},
@@ -80,22 +66,15 @@ func (t *GlobTool) Execute(ctx context.Context, params map[string]interface{}) (
 		return nil, fmt.Errorf("pattern parameter is required")
 	}
 
-	// Get workspace directory
-	workDir, err := t.sandbox.GetOrCreateWorkDir(userID)
+	// Resolve the optional path within its workspace root
+	pathParam, _ := params["path"].(string)
+	root, searchDir, err := toolDir(ctx, t.sandbox, userID, pathParam)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get workspace: %w", err)
+		return nil, err
 	}
+	workDir := root.Path
 
-	// Handle optional path parameter
-	searchDir := workDir
-	if pathParam, ok := params["path"].(string); ok && pathParam != "" {
-		// Sanitize path
-		cleanPath := filepath.Clean(pathParam)
-		if strings.HasPrefix(cleanPath, "..") || filepath.IsAbs(cleanPath) {
-			return nil, fmt.Errorf("path must be a relative path within the workspace")
-		}
-		searchDir = filepath.Join(workDir, cleanPath)
-
+	if searchDir != workDir {
 		// Verify the directory exists
 		info, err := os.Stat(searchDir)
 		if err != nil {
@@ -123,6 +102,10 @@ func (t *GlobTool) Execute(ctx context.Context, params map[string]interface{}) (
 		matches = matches[:maxResults]
 	}
 
+	for i := range matches {
+		matches[i].Path = root.Qualify(matches[i].Path)
+	}
+
 	return map[string]interface{}{
 		"files": matches,
 		"count": len(matches),
@@ -131,6 +114,7 @@ func (t *GlobTool) Execute(ctx context.Context, params map[string]interface{}) (
 
 func (t *GlobTool) findMatches(searchDir, workDir, pattern string) ([]FileMatch, error) {
 	var matches []FileMatch
+	matcher := t.sandbox.IgnoreMatcher(workDir)
 
 	// Use doublestar for ** pattern support
 	err := filepath.WalkDir(searchDir, func(path string, d os.DirEntry, err error) error {
@@ -138,12 +122,16 @@ func (t *GlobTool) findMatches(searchDir, workDir, pattern string) ([]FileMatch,
 			return nil // Skip errors and continue
 		}
 
-		// Skip hidden directories and common large directories
-		if d.IsDir() {
-			name := d.Name()
-			if strings.HasPrefix(name, ".") || defaultSkipDirs[name] {
-				return filepath.SkipDir
+		// Skip files and directories the workspace ignores
+		if path != searchDir {
+			if workspaceRelPath, err := filepath.Rel(workDir, path); err == nil && matcher.Match(workspaceRelPath, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
 			}
+		}
+		if d.IsDir() {
 			return nil
 		}
 
@@ -7,7 +7,6 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"strings"
 	"unicode/utf8"
 
 	"github.com/bmatcuk/doublestar/v4"
@@ -49,7 +48,7 @@ func (t *GrepTool) Parameters() llm.JSONSchema {
 			},
 			"path": {
 				Type:        "string",
-				Description: "File or directory to search in (optional, defaults to workspace root)",
+				Description: "File or directory to search in (optional, defaults to workspace root)." + rootPathHelp,
 			},
 			"glob": {
 				Type:        "string",
@@ -106,21 +105,13 @@ func (t *GrepTool) Execute(ctx context.Context, params map[string]interface{}) (
 		return nil, fmt.Errorf("pattern parameter is required")
 	}
 
-	// Get workspace directory
-	workDir, err := t.sandbox.GetOrCreateWorkDir(userID)
+	// Resolve the optional path within its workspace root
+	pathParam, _ := params["path"].(string)
+	root, searchPath, err := toolDir(ctx, t.sandbox, userID, pathParam)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get workspace: %w", err)
-	}
-
-	// Handle optional path parameter
-	searchPath := workDir
-	if pathParam, ok := params["path"].(string); ok && pathParam != "" {
-		cleanPath := filepath.Clean(pathParam)
-		if strings.HasPrefix(cleanPath, "..") || filepath.IsAbs(cleanPath) {
-			return nil, fmt.Errorf("path must be a relative path within the workspace")
-		}
-		searchPath = filepath.Join(workDir, cleanPath)
+		return nil, err
 	}
+	workDir := root.Path
 
 	// Parse options
 	outputMode := "files_with_matches"
@@ -171,7 +162,7 @@ func (t *GrepTool) Execute(ctx context.Context, params map[string]interface{}) (
 
 	var filesToSearch []string
 	if info.IsDir() {
-		filesToSearch, err = t.collectFiles(searchPath, globPattern)
+		filesToSearch, err = t.collectFiles(workDir, searchPath, globPattern)
 		if err != nil {
 			return nil, fmt.Errorf("failed to collect files: %w", err)
 		}
@@ -186,6 +177,9 @@ func (t *GrepTool) Execute(ctx context.Context, params map[string]interface{}) (
 		if err != nil {
 			return nil, err
 		}
+		for i := range matches {
+			matches[i].File = root.Qualify(matches[i].File)
+		}
 		return map[string]interface{}{
 			"matches": matches,
 			"count":   len(matches),
@@ -196,6 +190,9 @@ func (t *GrepTool) Execute(ctx context.Context, params map[string]interface{}) (
 		if err != nil {
 			return nil, err
 		}
+		for i := range counts {
+			counts[i].File = root.Qualify(counts[i].File)
+		}
 		return map[string]interface{}{
 			"counts": counts,
 			"total":  total,
@@ -206,6 +203,9 @@ func (t *GrepTool) Execute(ctx context.Context, params map[string]interface{}) (
 		if err != nil {
 			return nil, err
 		}
+		for i := range files {
+			files[i] = root.Qualify(files[i])
+		}
 		return map[string]interface{}{
 			"files": files,
 			"count": len(files),
@@ -213,21 +213,28 @@ func (t *GrepTool) Execute(ctx context.Context, params map[string]interface{}) (
 	}
 }
 
-func (t *GrepTool) collectFiles(dir, globPattern string) ([]string, error) {
+// collectFiles lists the files to search under dir, which is inside the
+// workspace root workDir
+func (t *GrepTool) collectFiles(workDir, dir, globPattern string) ([]string, error) {
 	var files []string
 	count := 0
+	matcher := t.sandbox.IgnoreMatcher(workDir)
 
 	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return nil // Skip errors
 		}
 
-		// Skip hidden and common large directories
-		if d.IsDir() {
-			name := d.Name()
-			if strings.HasPrefix(name, ".") || defaultSkipDirs[name] {
-				return filepath.SkipDir
+		// Skip files and directories the workspace ignores
+		if path != dir {
+			if relPath, err := filepath.Rel(workDir, path); err == nil && matcher.Match(relPath, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
 			}
+		}
+		if d.IsDir() {
 			return nil
 		}
 
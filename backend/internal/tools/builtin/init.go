@@ -3,10 +3,18 @@ package builtin
 import (
 	"database/sql"
 
+	"github.com/jacklau/prism/internal/agent"
 	"github.com/jacklau/prism/internal/database/repository"
 	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/lsp"
 	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/services/audit"
+	"github.com/jacklau/prism/internal/services/changes"
 	"github.com/jacklau/prism/internal/services/coderunner"
+	"github.com/jacklau/prism/internal/services/concurrency"
+	"github.com/jacklau/prism/internal/services/contextpack"
+	"github.com/jacklau/prism/internal/services/docsources"
+	"github.com/jacklau/prism/internal/services/linearbot"
 	"github.com/jacklau/prism/internal/tools"
 )
 
@@ -23,18 +31,53 @@ type Config struct {
 	// File history repository for tracking file changes
 	FileHistoryRepo *repository.FileHistoryRepository
 
+	// Change service for diffing file history entries (optional)
+	ChangeService *changes.Service
+
 	// Shell execution configuration
 	ShellExecConfig *ShellExecConfig
 
 	// Todo repository for task tracking
 	TodoRepo *repository.TodoRepository
 
+	// Called after the agent updates the todo list, e.g. to push plan updates to the UI
+	OnTodosUpdated TodoUpdateCallback
+
 	// LLM provider for WebFetch AI analysis (optional)
 	LLMProvider llm.Provider
+
+	// Agent manager for delegating subtasks to child agents (optional)
+	AgentManager     *agent.Manager
+	SpawnAgentConfig *SpawnAgentConfig
+
+	// Language server manager for diagnostics, hover and definitions (optional)
+	LSPManager *lsp.Manager
+
+	// Dependency audit service for vulnerability scans (optional)
+	AuditService *audit.Service
+
+	// Packer for workspace context bundles (optional)
+	ContextPacker *contextpack.Packer
+
+	// Linear bot for searching users' Linear issues (optional)
+	LinearBot *linearbot.Bot
+
+	// Documentation sources for reading users' Notion and Confluence pages (optional)
+	DocSources *docsources.Service
+
+	// Per-user limit on running background shells (optional; without it each
+	// user may run 10)
+	ConcurrencyLimiter *concurrency.Limiter
+
+	// Middleware run around every tool call, outermost first, e.g.
+	// AuditMiddleware, RateLimitMiddleware and RedactSecretsMiddleware
+	Middleware []tools.Middleware
 }
 
 // RegisterAll registers all built-in tools with the registry
 func RegisterAll(registry *tools.Registry, sandbox *sandbox.Service, runner *coderunner.Runner, db *sql.DB, config Config) error {
+	registry.Use(config.Middleware...)
+
 	// File operation tools
 	if err := registry.Register(NewFileReadTool(sandbox)); err != nil {
 		return err
@@ -66,6 +109,11 @@ func RegisterAll(registry *tools.Registry, sandbox *sandbox.Service, runner *cod
 		if err := registry.Register(NewFileHistoryRestoreTool(sandbox, config.FileHistoryRepo)); err != nil {
 			return err
 		}
+		if config.ChangeService != nil {
+			if err := registry.Register(NewFileHistoryDiffTool(config.ChangeService)); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Code execution tool
@@ -82,12 +130,23 @@ func RegisterAll(registry *tools.Registry, sandbox *sandbox.Service, runner *cod
 
 	// Background shell manager for background execution
 	backgroundMgr := NewBackgroundShellManager(sandbox, shellConfig)
+	backgroundMgr.SetLimiter(config.ConcurrencyLimiter)
 	shellExecTool.SetBackgroundManager(backgroundMgr)
 
 	if err := registry.Register(shellExecTool); err != nil {
 		return err
 	}
 
+	// Command line tool for running a typed command through the shell tool
+	if err := registry.Register(NewRunShellTool(shellExecTool)); err != nil {
+		return err
+	}
+
+	// Test tool running the workspace's test command through the shell tool
+	if err := registry.Register(NewRunTestsTool(sandbox, shellExecTool)); err != nil {
+		return err
+	}
+
 	// Background shell tools (bash_output, kill_shell)
 	if err := registry.Register(NewBashOutputTool(backgroundMgr)); err != nil {
 		return err
@@ -96,6 +155,17 @@ func RegisterAll(registry *tools.Registry, sandbox *sandbox.Service, runner *cod
 		return err
 	}
 
+	// Background task tools (run_background, task_status, task_logs)
+	if err := registry.Register(NewRunBackgroundTool(shellExecTool)); err != nil {
+		return err
+	}
+	if err := registry.Register(NewTaskStatusTool(backgroundMgr)); err != nil {
+		return err
+	}
+	if err := registry.Register(NewTaskLogsTool(backgroundMgr)); err != nil {
+		return err
+	}
+
 	// Glob tool for file pattern matching
 	if err := registry.Register(NewGlobTool(sandbox)); err != nil {
 		return err
@@ -137,12 +207,75 @@ func RegisterAll(registry *tools.Registry, sandbox *sandbox.Service, runner *cod
 		return err
 	}
 
+	// Language server tools (diagnostics, hover, go to definition)
+	if config.LSPManager != nil {
+		if err := registry.Register(NewGetDiagnosticsTool(sandbox, config.LSPManager)); err != nil {
+			return err
+		}
+		if err := registry.Register(NewLSPHoverTool(sandbox, config.LSPManager)); err != nil {
+			return err
+		}
+		if err := registry.Register(NewLSPDefinitionTool(sandbox, config.LSPManager)); err != nil {
+			return err
+		}
+	}
+
+	// Dependency vulnerability audit tool
+	if config.AuditService != nil {
+		if err := registry.Register(NewDependencyAuditTool(sandbox, config.AuditService)); err != nil {
+			return err
+		}
+	}
+
+	// Workspace context pack tool
+	if config.ContextPacker != nil {
+		if err := registry.Register(NewPackContextTool(sandbox, config.ContextPacker)); err != nil {
+			return err
+		}
+	}
+
+	// Linear issue search tool (uses each user's own Linear API key)
+	if config.LinearBot != nil {
+		if err := registry.Register(NewLinearSearchIssuesTool(config.LinearBot)); err != nil {
+			return err
+		}
+	}
+
+	// Notion and Confluence page tools (use each user's own credentials)
+	if config.DocSources != nil {
+		if err := registry.Register(NewNotionSearchTool(config.DocSources)); err != nil {
+			return err
+		}
+		if err := registry.Register(NewNotionReadPageTool(config.DocSources)); err != nil {
+			return err
+		}
+		if err := registry.Register(NewConfluenceSearchTool(config.DocSources)); err != nil {
+			return err
+		}
+		if err := registry.Register(NewConfluenceReadPageTool(config.DocSources)); err != nil {
+			return err
+		}
+	}
+
 	// Todo tools for task tracking
 	if config.TodoRepo != nil {
 		if err := registry.Register(NewTodoReadTool(sandbox, config.TodoRepo)); err != nil {
 			return err
 		}
-		if err := registry.Register(NewTodoWriteTool(sandbox, config.TodoRepo)); err != nil {
+		todoWriteTool := NewTodoWriteTool(sandbox, config.TodoRepo)
+		todoWriteTool.SetUpdateCallback(config.OnTodosUpdated)
+		if err := registry.Register(todoWriteTool); err != nil {
+			return err
+		}
+	}
+
+	// Sub-agent delegation tool (only if an agent manager is available)
+	if config.AgentManager != nil {
+		spawnConfig := DefaultSpawnAgentConfig()
+		if config.SpawnAgentConfig != nil {
+			spawnConfig = *config.SpawnAgentConfig
+		}
+		if err := registry.Register(NewSpawnAgentTool(config.AgentManager, spawnConfig)); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,100 @@
+package builtin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jacklau/prism/internal/integrations/linear"
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/services/linearbot"
+)
+
+// maxLinearDescriptionChars truncates issue descriptions in search results
+const maxLinearDescriptionChars = 1000
+
+// LinearSearchIssuesTool searches the user's Linear issues
+type LinearSearchIssuesTool struct {
+	bot *linearbot.Bot
+}
+
+// NewLinearSearchIssuesTool creates a new Linear issue search tool
+func NewLinearSearchIssuesTool(bot *linearbot.Bot) *LinearSearchIssuesTool {
+	return &LinearSearchIssuesTool{bot: bot}
+}
+
+func (t *LinearSearchIssuesTool) Name() string {
+	return "linear_search_issues"
+}
+
+func (t *LinearSearchIssuesTool) Description() string {
+	return "Search the issues in the user's Linear workspace. Returns matching issues with their identifier (e.g. ENG-123), title, state, team, assignee, labels, URL and the start of their description. Use this to find the issue a task refers to or to check what is already tracked. Requires the user to have connected Linear in Settings."
+}
+
+func (t *LinearSearchIssuesTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"query": {
+				Type:        "string",
+				Description: "Text to search issue titles, descriptions and identifiers for",
+			},
+			"team": {
+				Type:        "string",
+				Description: "Only return issues of the team with this key, e.g. 'ENG' (optional)",
+			},
+			"state": {
+				Type:        "string",
+				Description: "Only return issues in this workflow state, e.g. 'In Progress' (optional)",
+			},
+			"limit": {
+				Type:        "integer",
+				Description: "Maximum number of issues to return (1-50)",
+				Default:     10,
+			},
+		},
+		Required: []string{"query"},
+	}
+}
+
+func (t *LinearSearchIssuesTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	query, ok := params["query"].(string)
+	if !ok || query == "" {
+		return nil, fmt.Errorf("query parameter is required")
+	}
+	opts := linear.SearchOptions{Limit: 10}
+	opts.Team, _ = params["team"].(string)
+	opts.State, _ = params["state"].(string)
+	if n, ok := params["limit"].(float64); ok && n >= 1 {
+		opts.Limit = int(n)
+	}
+
+	issues, err := t.bot.SearchIssues(userID, query, opts)
+	if errors.Is(err, linearbot.ErrNotConnected) {
+		return nil, fmt.Errorf("linear is not connected; ask the user to add a Linear API key in Settings → Integrations")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("linear search failed: %w", err)
+	}
+
+	for i := range issues {
+		if len(issues[i].Description) > maxLinearDescriptionChars {
+			issues[i].Description = issues[i].Description[:maxLinearDescriptionChars] + "…"
+		}
+	}
+
+	return map[string]interface{}{
+		"query":  query,
+		"issues": issues,
+		"count":  len(issues),
+	}, nil
+}
+
+func (t *LinearSearchIssuesTool) RequiresConfirmation() bool {
+	return false
+}
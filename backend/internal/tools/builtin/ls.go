@@ -35,7 +35,7 @@ func (t *LSTool) Parameters() llm.JSONSchema {
 		Properties: map[string]llm.JSONProperty{
 			"path": {
 				Type:        "string",
-				Description: "The directory path to list (optional, defaults to workspace root). Must be a relative path.",
+				Description: "The directory path to list (optional, defaults to workspace root). Must be a relative path." + rootPathHelp,
 			},
 			"show_hidden": {
 				Type:        "boolean",
@@ -62,21 +62,13 @@ func (t *LSTool) Execute(ctx context.Context, params map[string]interface{}) (in
 		return nil, fmt.Errorf("user ID not found in context")
 	}
 
-	// Get workspace directory
-	workDir, err := t.sandbox.GetOrCreateWorkDir(userID)
+	// Resolve the optional path within its workspace root
+	pathParam, _ := params["path"].(string)
+	root, listDir, err := toolDir(ctx, t.sandbox, userID, pathParam)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get workspace: %w", err)
-	}
-
-	// Handle optional path parameter
-	listDir := workDir
-	if pathParam, ok := params["path"].(string); ok && pathParam != "" {
-		cleanPath := filepath.Clean(pathParam)
-		if strings.HasPrefix(cleanPath, "..") || filepath.IsAbs(cleanPath) {
-			return nil, fmt.Errorf("path must be a relative path within the workspace")
-		}
-		listDir = filepath.Join(workDir, cleanPath)
+		return nil, err
 	}
+	workDir := root.Path
 
 	showHidden := false
 	if sh, ok := params["show_hidden"].(bool); ok {
@@ -126,7 +118,7 @@ func (t *LSTool) Execute(ctx context.Context, params map[string]interface{}) (in
 
 		fileEntries = append(fileEntries, FileEntry{
 			Name:     name,
-			Path:     relPath,
+			Path:     root.Qualify(relPath),
 			Type:     fileType,
 			Size:     info.Size(),
 			Modified: info.ModTime().Unix(),
@@ -140,11 +132,23 @@ func (t *LSTool) Execute(ctx context.Context, params map[string]interface{}) (in
 		relDir = ""
 	}
 
-	return map[string]interface{}{
-		"path":    relDir,
+	result := map[string]interface{}{
+		"path":    root.Qualify(relDir),
 		"entries": fileEntries,
 		"count":   len(fileEntries),
-	}, nil
+	}
+
+	// Let the model know about the other roots it can list
+	if roots, err := t.sandbox.Roots(userID); err == nil && len(roots) > 1 {
+		names := make([]string, len(roots))
+		for i, r := range roots {
+			names[i] = r.Name
+		}
+		result["root"] = root.Name
+		result["roots"] = names
+	}
+
+	return result, nil
 }
 
 func (t *LSTool) RequiresConfirmation() bool {
@@ -0,0 +1,248 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/lsp"
+	"github.com/jacklau/prism/internal/sandbox"
+)
+
+// maxDiagnostics caps how many diagnostics are returned in one call
+const maxDiagnostics = 200
+
+// GetDiagnosticsTool reports compiler errors and warnings from language servers
+type GetDiagnosticsTool struct {
+	sandbox *sandbox.Service
+	manager *lsp.Manager
+}
+
+// NewGetDiagnosticsTool creates a new diagnostics tool
+func NewGetDiagnosticsTool(sandbox *sandbox.Service, manager *lsp.Manager) *GetDiagnosticsTool {
+	return &GetDiagnosticsTool{sandbox: sandbox, manager: manager}
+}
+
+func (t *GetDiagnosticsTool) Name() string {
+	return "get_diagnostics"
+}
+
+func (t *GetDiagnosticsTool) Description() string {
+	return "Get compiler errors, type errors and warnings for a file from its language server (gopls for Go, typescript-language-server for TypeScript/JavaScript, pyright for Python). Use this after editing a file to check it compiles instead of running a full build. Without a path, returns the diagnostics already known for files checked earlier in the workspace."
+}
+
+func (t *GetDiagnosticsTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"path": {
+				Type:        "string",
+				Description: "The file to check, relative to the workspace root (optional)",
+			},
+		},
+	}
+}
+
+func (t *GetDiagnosticsTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	// The workspace is the root the optional path is in
+	path, _ := params["path"].(string)
+	root, path, err := t.sandbox.ResolveRoot(userID, toolPath(ctx, t.sandbox, userID, path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+	workDir := root.Path
+
+	var diagnostics []lsp.FileDiagnostic
+	result := map[string]interface{}{}
+	if path == "" {
+		diagnostics = t.manager.WorkspaceDiagnostics(workDir)
+	} else {
+		var fresh bool
+		diagnostics, fresh, err = t.manager.Diagnostics(ctx, workDir, path)
+		if err != nil {
+			return nil, err
+		}
+		result["path"] = root.Qualify(path)
+		if !fresh {
+			result["note"] = "the language server did not finish analyzing the file in time; results may be incomplete"
+		}
+	}
+
+	errorCount, warningCount := 0, 0
+	for _, d := range diagnostics {
+		switch d.Severity {
+		case "error":
+			errorCount++
+		case "warning":
+			warningCount++
+		}
+	}
+
+	result["errors"] = errorCount
+	result["warnings"] = warningCount
+	result["count"] = len(diagnostics)
+	if len(diagnostics) > maxDiagnostics {
+		diagnostics = diagnostics[:maxDiagnostics]
+		result["truncated"] = true
+	}
+	if diagnostics == nil {
+		diagnostics = []lsp.FileDiagnostic{}
+	}
+	result["diagnostics"] = diagnostics
+
+	return result, nil
+}
+
+func (t *GetDiagnosticsTool) RequiresConfirmation() bool {
+	return false
+}
+
+// LSPHoverTool looks up type and documentation for a symbol
+type LSPHoverTool struct {
+	sandbox *sandbox.Service
+	manager *lsp.Manager
+}
+
+// NewLSPHoverTool creates a new hover tool
+func NewLSPHoverTool(sandbox *sandbox.Service, manager *lsp.Manager) *LSPHoverTool {
+	return &LSPHoverTool{sandbox: sandbox, manager: manager}
+}
+
+func (t *LSPHoverTool) Name() string {
+	return "lsp_hover"
+}
+
+func (t *LSPHoverTool) Description() string {
+	return "Get the type signature and documentation of the symbol at a position in a file, as an editor would show on hover. Supports Go, TypeScript/JavaScript and Python."
+}
+
+func (t *LSPHoverTool) Parameters() llm.JSONSchema {
+	return positionParameters()
+}
+
+func (t *LSPHoverTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	workDir, path, line, column, err := parsePositionParams(ctx, t.sandbox, params)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := t.manager.Hover(ctx, workDir, path, line, column)
+	if err != nil {
+		return nil, err
+	}
+	if text == "" {
+		return map[string]interface{}{
+			"found":   false,
+			"message": "no hover information at this position",
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"found": true,
+		"hover": text,
+	}, nil
+}
+
+func (t *LSPHoverTool) RequiresConfirmation() bool {
+	return false
+}
+
+// LSPDefinitionTool finds where a symbol is defined
+type LSPDefinitionTool struct {
+	sandbox *sandbox.Service
+	manager *lsp.Manager
+}
+
+// NewLSPDefinitionTool creates a new go-to-definition tool
+func NewLSPDefinitionTool(sandbox *sandbox.Service, manager *lsp.Manager) *LSPDefinitionTool {
+	return &LSPDefinitionTool{sandbox: sandbox, manager: manager}
+}
+
+func (t *LSPDefinitionTool) Name() string {
+	return "lsp_definition"
+}
+
+func (t *LSPDefinitionTool) Description() string {
+	return "Find where the symbol at a position in a file is defined (go to definition). Returns file paths with 1-based line and column numbers. Supports Go, TypeScript/JavaScript and Python."
+}
+
+func (t *LSPDefinitionTool) Parameters() llm.JSONSchema {
+	return positionParameters()
+}
+
+func (t *LSPDefinitionTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	workDir, path, line, column, err := parsePositionParams(ctx, t.sandbox, params)
+	if err != nil {
+		return nil, err
+	}
+
+	locations, err := t.manager.Definition(ctx, workDir, path, line, column)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"definitions": locations,
+		"count":       len(locations),
+	}, nil
+}
+
+func (t *LSPDefinitionTool) RequiresConfirmation() bool {
+	return false
+}
+
+// positionParameters is the schema shared by position-based LSP tools
+func positionParameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"path": {
+				Type:        "string",
+				Description: "The file containing the symbol, relative to the workspace root",
+			},
+			"line": {
+				Type:        "number",
+				Description: "The line number of the symbol (1-based)",
+			},
+			"column": {
+				Type:        "number",
+				Description: "The column of the symbol within the line (1-based, in characters)",
+			},
+		},
+		Required: []string{"path", "line", "column"},
+	}
+}
+
+// parsePositionParams extracts the workspace, file and 1-based position
+// for position-based LSP tools
+func parsePositionParams(ctx context.Context, sandbox *sandbox.Service, params map[string]interface{}) (string, string, int, int, error) {
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok || userID == "" {
+		return "", "", 0, 0, fmt.Errorf("user ID not found in context")
+	}
+
+	path, ok := params["path"].(string)
+	if !ok || path == "" {
+		return "", "", 0, 0, fmt.Errorf("path parameter is required")
+	}
+	line, ok := params["line"].(float64)
+	if !ok {
+		return "", "", 0, 0, fmt.Errorf("line parameter is required")
+	}
+	column, ok := params["column"].(float64)
+	if !ok {
+		return "", "", 0, 0, fmt.Errorf("column parameter is required")
+	}
+
+	root, path, err := sandbox.ResolveRoot(userID, toolPath(ctx, sandbox, userID, path))
+	if err != nil {
+		return "", "", 0, 0, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	return root.Path, path, int(line), int(column), nil
+}
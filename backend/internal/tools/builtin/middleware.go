@@ -0,0 +1,121 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/jacklau/prism/internal/security"
+	"github.com/jacklau/prism/internal/services/ratelimit"
+	"github.com/jacklau/prism/internal/tools"
+)
+
+// AuditMiddleware logs each tool call with the user who made it, how long it
+// took and whether it succeeded. Parameters and results are not logged, as
+// they may hold file contents or secrets.
+func AuditMiddleware() tools.Middleware {
+	return func(next tools.ToolHandler) tools.ToolHandler {
+		return func(ctx context.Context, call *tools.ToolCall) (*tools.ToolResult, error) {
+			start := time.Now()
+			result, err := next(ctx, call)
+			elapsed := time.Since(start).Round(time.Millisecond)
+
+			userID, _ := ctx.Value(UserIDKey).(string)
+			switch {
+			case err != nil:
+				log.Printf("Tool %s for user %s stopped after %s: %v", call.Name, userID, elapsed, err)
+			case !result.Success:
+				log.Printf("Tool %s for user %s failed after %s: %s", call.Name, userID, elapsed, result.Error)
+			default:
+				log.Printf("Tool %s for user %s succeeded in %s", call.Name, userID, elapsed)
+			}
+			return result, err
+		}
+	}
+}
+
+// RateLimitMiddleware fails tool calls a user makes over the set's
+// ratelimit.Tool limit. Calls without a user are not limited.
+func RateLimitMiddleware(limits *ratelimit.Set) tools.Middleware {
+	return tools.Before(func(ctx context.Context, call *tools.ToolCall) error {
+		userID, _ := ctx.Value(UserIDKey).(string)
+		if userID == "" {
+			return nil
+		}
+		if ok, retryAfter := limits.Allow(ratelimit.Tool, userID); !ok {
+			seconds := int(math.Max(1, math.Ceil(retryAfter.Seconds())))
+			return fmt.Errorf("tool rate limit exceeded, try again in %ds", seconds)
+		}
+		return nil
+	})
+}
+
+// RedactSecretsMiddleware hides credentials such as API keys and tokens in
+// tool results, errors and progress updates before they reach the model or
+// the client
+func RedactSecretsMiddleware() tools.Middleware {
+	return func(next tools.ToolHandler) tools.ToolHandler {
+		return func(ctx context.Context, call *tools.ToolCall) (*tools.ToolResult, error) {
+			if call.Report != nil {
+				redacted := *call
+				report := call.Report
+				redacted.Report = func(p tools.Progress) {
+					p.Message = security.RedactSecrets(p.Message)
+					report(p)
+				}
+				call = &redacted
+			}
+
+			result, err := next(ctx, call)
+			if result != nil {
+				result.Error = security.RedactSecrets(result.Error)
+				result.Result = redactResult(result.Result)
+			}
+			return result, err
+		}
+	}
+}
+
+// redactResult redacts the secrets in a tool result. Results other than
+// strings are redacted in their JSON form, which is what the model sees.
+func redactResult(result interface{}) interface{} {
+	switch r := result.(type) {
+	case nil:
+		return nil
+	case string:
+		return security.RedactSecrets(r)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return result
+	}
+	if security.RedactSecrets(string(data)) == string(data) {
+		return result
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return result
+	}
+	return redactValue(value)
+}
+
+// redactValue redacts the strings in a decoded JSON value
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return security.RedactSecrets(v)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = redactValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
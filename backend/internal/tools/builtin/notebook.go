@@ -98,6 +98,7 @@ func (t *NotebookReadTool) Execute(ctx context.Context, params map[string]interf
 	if !ok || notebookPath == "" {
 		return nil, fmt.Errorf("notebook_path parameter is required")
 	}
+	notebookPath = toolPath(ctx, t.sandbox, userID, notebookPath)
 
 	// Validate it's an ipynb file
 	if !strings.HasSuffix(strings.ToLower(notebookPath), ".ipynb") {
@@ -267,6 +268,7 @@ func (t *NotebookEditTool) Execute(ctx context.Context, params map[string]interf
 	if !ok || notebookPath == "" {
 		return nil, fmt.Errorf("notebook_path parameter is required")
 	}
+	notebookPath = toolPath(ctx, t.sandbox, userID, notebookPath)
 
 	cellNumber, ok := params["cell_number"].(float64)
 	if !ok {
@@ -316,7 +318,7 @@ func (t *NotebookEditTool) Execute(ctx context.Context, params map[string]interf
 
 	// Save to history before modifying
 	if t.historyRepo != nil {
-		_, _ = t.historyRepo.Create(userID, notebookPath, content, "notebook_edit")
+		recordHistory(ctx, t.historyRepo, userID, notebookPath, content, "notebook_edit")
 	}
 
 	// Perform the edit
@@ -0,0 +1,42 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/jacklau/prism/internal/sandbox"
+)
+
+// ConversationIDKey is the context key for the conversation a tool runs in.
+// File tools default to that conversation's active workspace root.
+const ConversationIDKey contextKey = "conversationID"
+
+// rootPathHelp describes root prefixes in path parameter descriptions
+const rootPathHelp = " In a multi-root workspace, prefix the path with a root name to use another root (e.g. 'api:src/main.go')."
+
+// toolPath scopes a file path given to a tool to the conversation's active
+// workspace root, unless it already names a root
+func toolPath(ctx context.Context, sb *sandbox.Service, userID, path string) string {
+	conversationID, _ := ctx.Value(ConversationIDKey).(string)
+	return sb.ScopePath(userID, conversationID, path)
+}
+
+// toolDir resolves an optional, possibly root-prefixed directory path given
+// to a tool. Returns the root it is in and the absolute directory.
+func toolDir(ctx context.Context, sb *sandbox.Service, userID, path string) (sandbox.WorkspaceRoot, string, error) {
+	root, rel, err := sb.ResolveRoot(userID, toolPath(ctx, sb, userID, path))
+	if err != nil {
+		return sandbox.WorkspaceRoot{}, "", fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	if rel == "" {
+		return root, root.Path, nil
+	}
+	cleanPath := filepath.Clean(rel)
+	if strings.HasPrefix(cleanPath, "..") || filepath.IsAbs(cleanPath) {
+		return sandbox.WorkspaceRoot{}, "", fmt.Errorf("path must be a relative path within the workspace")
+	}
+	return root, filepath.Join(root.Path, cleanPath), nil
+}
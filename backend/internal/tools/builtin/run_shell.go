@@ -0,0 +1,151 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/tools"
+)
+
+// RunShellTool runs a command given as a single command line, the way it
+// would be typed in a terminal. The line is split into words without a shell,
+// so pipes, redirection and chaining aren't available, and the command goes
+// through the shell tool's allow and deny lists and blocked patterns.
+type RunShellTool struct {
+	shell *ShellExecTool
+}
+
+// NewRunShellTool creates a new run shell tool
+func NewRunShellTool(shell *ShellExecTool) *RunShellTool {
+	return &RunShellTool{shell: shell}
+}
+
+func (t *RunShellTool) Name() string {
+	return "run_shell"
+}
+
+func (t *RunShellTool) Description() string {
+	return "Run a command line in the workspace, e.g. 'git log --oneline -5' or 'go test ./... -run \"TestParse\"'. Quotes group words as in a shell, but there is no shell: pipes, redirection, && and variable expansion are not supported. Only allowed commands can run (" + strings.Join(t.shell.GetAllowedCommands(), ", ") + "). The workspace's env settings are set for the command."
+}
+
+func (t *RunShellTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"command": {
+				Type:        "string",
+				Description: "The command line to run",
+			},
+			"cwd": {
+				Type:        "string",
+				Description: "Optional working directory (relative to workspace). Defaults to workspace root." + rootPathHelp,
+			},
+			"timeout": {
+				Type:        "number",
+				Description: "Timeout in seconds (max 1800 = 30 minutes). Defaults to 300 (5 minutes).",
+			},
+		},
+		Required: []string{"command"},
+	}
+}
+
+func (t *RunShellTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return t.ExecuteWithProgress(ctx, params, nil)
+}
+
+// ExecuteWithProgress runs the command line like Execute, reporting each line
+// of its output as it is written
+func (t *RunShellTool) ExecuteWithProgress(ctx context.Context, params map[string]interface{}, report tools.ProgressReporter) (interface{}, error) {
+	line, _ := params["command"].(string)
+	words, err := splitCommandLine(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("command parameter is required")
+	}
+
+	args := make([]interface{}, 0, len(words)-1)
+	for _, word := range words[1:] {
+		args = append(args, word)
+	}
+
+	shellParams := map[string]interface{}{
+		"command": words[0],
+		"args":    args,
+	}
+	for _, key := range []string{"cwd", "timeout"} {
+		if value, ok := params[key]; ok {
+			shellParams[key] = value
+		}
+	}
+	return t.shell.ExecuteWithProgress(ctx, shellParams, report)
+}
+
+func (t *RunShellTool) RequiresConfirmation() bool {
+	return true
+}
+
+// splitCommandLine splits a command line into words. Single quotes keep
+// everything literally, double quotes and backslashes escape as in a POSIX
+// shell. Unquoted shell operators are rejected rather than passed on as
+// arguments, since no shell interprets them.
+func splitCommandLine(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' {
+				escaped = true
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case strings.ContainsRune("|&;<>`$()", r):
+			return nil, fmt.Errorf("unquoted %q: run_shell runs a single command without a shell, so pipes, redirection, chaining and expansion are not supported", r)
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in command", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("command ends with a backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
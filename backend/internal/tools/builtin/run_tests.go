@@ -0,0 +1,91 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jacklau/prism/internal/llm"
+	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/tools"
+)
+
+// RunTestsTool runs the test command set in the current workspace's
+// settings. It goes through the shell tool, so the command is subject to the
+// same allowlist and blocked patterns.
+type RunTestsTool struct {
+	sandbox *sandbox.Service
+	shell   *ShellExecTool
+}
+
+// NewRunTestsTool creates a new run tests tool
+func NewRunTestsTool(sandbox *sandbox.Service, shell *ShellExecTool) *RunTestsTool {
+	return &RunTestsTool{sandbox: sandbox, shell: shell}
+}
+
+func (t *RunTestsTool) Name() string {
+	return "run_tests"
+}
+
+func (t *RunTestsTool) Description() string {
+	return "Run the workspace's test command, as set in its workspace settings (e.g. 'go test ./...' or 'npm test'). Extra arguments, such as a package or test filter, are appended to the command. Fails if the workspace has no test command; use shell_execute instead then."
+}
+
+func (t *RunTestsTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"args": {
+				Type:        "array",
+				Description: "Extra arguments appended to the test command (optional)",
+			},
+			"timeout": {
+				Type:        "number",
+				Description: "Timeout in seconds (max 1800 = 30 minutes). Defaults to 300 (5 minutes).",
+			},
+		},
+	}
+}
+
+func (t *RunTestsTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return t.ExecuteWithProgress(ctx, params, nil)
+}
+
+// ExecuteWithProgress runs the tests like Execute, reporting each line of
+// their output as it is written
+func (t *RunTestsTool) ExecuteWithProgress(ctx context.Context, params map[string]interface{}, report tools.ProgressReporter) (interface{}, error) {
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	settings, err := t.sandbox.WorkspaceSettings(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace settings: %w", err)
+	}
+	if settings == nil || strings.TrimSpace(settings.TestCommand) == "" {
+		return nil, fmt.Errorf("no test command is set for this workspace")
+	}
+
+	fields := strings.Fields(settings.TestCommand)
+	args := make([]interface{}, 0, len(fields)-1)
+	for _, arg := range fields[1:] {
+		args = append(args, arg)
+	}
+	if extra, ok := params["args"].([]interface{}); ok {
+		args = append(args, extra...)
+	}
+
+	shellParams := map[string]interface{}{
+		"command": fields[0],
+		"args":    args,
+	}
+	if timeout, ok := params["timeout"]; ok {
+		shellParams["timeout"] = timeout
+	}
+	return t.shell.ExecuteWithProgress(ctx, shellParams, report)
+}
+
+func (t *RunTestsTool) RequiresConfirmation() bool {
+	return true
+}
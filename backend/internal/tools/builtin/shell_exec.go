@@ -13,11 +13,13 @@ import (
 
 	"github.com/jacklau/prism/internal/llm"
 	"github.com/jacklau/prism/internal/sandbox"
+	"github.com/jacklau/prism/internal/tools"
 )
 
 // ShellExecConfig holds configuration for shell command execution
 type ShellExecConfig struct {
 	AllowedCommands []string
+	DeniedCommands  []string // Never run, even if in AllowedCommands
 	BlockedPatterns []string
 	MaxTimeout      time.Duration
 	MaxOutputSize   int
@@ -117,7 +119,7 @@ func (t *ShellExecTool) Parameters() llm.JSONSchema {
 			},
 			"cwd": {
 				Type:        "string",
-				Description: "Optional working directory (relative to workspace). Defaults to workspace root.",
+				Description: "Optional working directory (relative to workspace). Defaults to workspace root." + rootPathHelp,
 			},
 			"timeout": {
 				Type:        "number",
@@ -133,6 +135,12 @@ func (t *ShellExecTool) Parameters() llm.JSONSchema {
 }
 
 func (t *ShellExecTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return t.ExecuteWithProgress(ctx, params, nil)
+}
+
+// ExecuteWithProgress runs a command like Execute, reporting each line of
+// its output as it is written so long builds and test runs don't look hung
+func (t *ShellExecTool) ExecuteWithProgress(ctx context.Context, params map[string]interface{}, report tools.ProgressReporter) (interface{}, error) {
 	userID, ok := ctx.Value(UserIDKey).(string)
 	if !ok || userID == "" {
 		return nil, fmt.Errorf("user ID not found in context")
@@ -145,6 +153,9 @@ func (t *ShellExecTool) Execute(ctx context.Context, params map[string]interface
 	}
 
 	// Validate command is in whitelist
+	if t.isCommandDenied(command) {
+		return nil, fmt.Errorf("command '%s' is not allowed on this server", command)
+	}
 	if !t.isCommandAllowed(command) {
 		return nil, fmt.Errorf("command '%s' is not allowed. Allowed commands: %s", command, strings.Join(t.config.AllowedCommands, ", "))
 	}
@@ -167,20 +178,17 @@ func (t *ShellExecTool) Execute(ctx context.Context, params map[string]interface
 		return nil, fmt.Errorf("command contains blocked pattern: %s", pattern)
 	}
 
-	// Get workspace directory
-	workDir, err := t.sandbox.GetOrCreateWorkDir(userID)
+	// Run in the optional cwd, resolved within its workspace root
+	cwdParam, _ := params["cwd"].(string)
+	_, workDir, err := toolDir(ctx, t.sandbox, userID, cwdParam)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get workspace: %w", err)
+		return nil, err
 	}
 
-	// Handle custom working directory
-	if cwdParam, ok := params["cwd"].(string); ok && cwdParam != "" {
-		// Ensure cwd is relative and doesn't escape workspace
-		cwdParam = filepath.Clean(cwdParam)
-		if strings.HasPrefix(cwdParam, "..") || filepath.IsAbs(cwdParam) {
-			return nil, fmt.Errorf("cwd must be a relative path within the workspace")
-		}
-		workDir = filepath.Join(workDir, cwdParam)
+	// Commands get the workspace's environment variables, not the server's
+	env, err := t.commandEnv(userID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check for background execution
@@ -194,7 +202,7 @@ func (t *ShellExecTool) Execute(ctx context.Context, params map[string]interface
 			return nil, fmt.Errorf("background execution not available")
 		}
 
-		shell, err := t.backgroundMgr.StartBackground(ctx, userID, command, args, workDir)
+		shell, err := t.backgroundMgr.StartBackground(ctx, userID, command, args, workDir, env)
 		if err != nil {
 			return nil, fmt.Errorf("failed to start background shell: %w", err)
 		}
@@ -237,6 +245,7 @@ func (t *ShellExecTool) Execute(ctx context.Context, params map[string]interface
 	// Create the command
 	cmd := exec.CommandContext(execCtx, command, args...)
 	cmd.Dir = workDir
+	cmd.Env = env
 
 	// Set up pipes for stdout and stderr
 	stdoutPipe, err := cmd.StdoutPipe()
@@ -257,6 +266,7 @@ func (t *ShellExecTool) Execute(ctx context.Context, params map[string]interface
 
 	// Collect output
 	var stdout, stderr strings.Builder
+	var truncated bool
 	var outputMu sync.Mutex
 	var wg sync.WaitGroup
 
@@ -269,6 +279,8 @@ func (t *ShellExecTool) Execute(ctx context.Context, params map[string]interface
 			if builder.Len() < t.config.MaxOutputSize {
 				builder.WriteString(line)
 				builder.WriteString("\n")
+			} else {
+				truncated = true
 			}
 			outputMu.Unlock()
 
@@ -276,6 +288,7 @@ func (t *ShellExecTool) Execute(ctx context.Context, params map[string]interface
 			if t.outputCallback != nil {
 				t.outputCallback(streamName, line)
 			}
+			report.Report(tools.Progress{Message: line})
 		}
 	}
 
@@ -322,6 +335,7 @@ func (t *ShellExecTool) Execute(ctx context.Context, params map[string]interface
 		"stderr":    stderr.String(),
 		"exit_code": exitCode,
 		"success":   exitCode == 0,
+		"truncated": truncated,
 		"duration":  duration.Milliseconds(),
 		"command":   fullCommand,
 		"cwd":       workDir,
@@ -345,6 +359,31 @@ func (t *ShellExecTool) isCommandAllowed(command string) bool {
 	return false
 }
 
+// isCommandDenied checks if a command is in the deny list
+func (t *ShellExecTool) isCommandDenied(command string) bool {
+	command = filepath.Base(command)
+
+	for _, denied := range t.config.DeniedCommands {
+		if command == denied {
+			return true
+		}
+	}
+	return false
+}
+
+// commandEnv returns the environment for a user's commands: the server's
+// base variables with the current workspace's env settings added
+func (t *ShellExecTool) commandEnv(userID string) ([]string, error) {
+	settings, err := t.sandbox.WorkspaceSettings(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace settings: %w", err)
+	}
+	if settings == nil {
+		return sandbox.CommandEnv(nil), nil
+	}
+	return sandbox.CommandEnv(settings.Env), nil
+}
+
 // isCommandBlocked checks if the full command matches any blocked patterns
 func (t *ShellExecTool) isCommandBlocked(fullCommand string) (bool, string) {
 	for _, pattern := range t.config.BlockedPatterns {
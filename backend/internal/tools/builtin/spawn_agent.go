@@ -0,0 +1,232 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jacklau/prism/internal/agent"
+	"github.com/jacklau/prism/internal/llm"
+)
+
+// Context keys used by spawn_agent to pick a model and track nesting
+const (
+	ProviderKey   contextKey = "provider"
+	ModelKey      contextKey = "model"
+	AgentDepthKey contextKey = "agentDepth"
+)
+
+// defaultSubAgentPrompt is used when the caller does not provide a system prompt
+const defaultSubAgentPrompt = `You are a focused sub-agent working on a single subtask delegated by another assistant. Complete only the task you are given, be thorough but concise, and finish with a clear summary of your findings that the delegating assistant can act on directly.`
+
+// SpawnAgentConfig holds limits for sub-agent delegation
+type SpawnAgentConfig struct {
+	MaxDepth      int
+	MaxConcurrent int
+	Timeout       time.Duration
+
+	// Instructions optionally returns the project instructions (PRISM.md) for
+	// a user's workspace, which are appended to the sub-agent's system prompt
+	Instructions func(userID string) string
+}
+
+// DefaultSpawnAgentConfig returns the default configuration
+func DefaultSpawnAgentConfig() SpawnAgentConfig {
+	return SpawnAgentConfig{
+		MaxDepth:      2,
+		MaxConcurrent: 3,
+		Timeout:       5 * time.Minute,
+	}
+}
+
+// SpawnAgentTool delegates a focused subtask to a child agent
+type SpawnAgentTool struct {
+	manager *agent.Manager
+	config  SpawnAgentConfig
+	slots   chan struct{}
+}
+
+// NewSpawnAgentTool creates a new spawn agent tool
+func NewSpawnAgentTool(manager *agent.Manager, config SpawnAgentConfig) *SpawnAgentTool {
+	defaults := DefaultSpawnAgentConfig()
+	if config.MaxDepth <= 0 {
+		config.MaxDepth = defaults.MaxDepth
+	}
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = defaults.MaxConcurrent
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+
+	return &SpawnAgentTool{
+		manager: manager,
+		config:  config,
+		slots:   make(chan struct{}, config.MaxConcurrent),
+	}
+}
+
+func (t *SpawnAgentTool) Name() string {
+	return "spawn_agent"
+}
+
+func (t *SpawnAgentTool) Description() string {
+	return `Delegate a focused subtask to a child agent and receive its final answer as the result. Use this for self-contained work that benefits from a fresh context, such as exploring a library's API, summarizing a long document, or drafting an isolated piece of code. Give the sub-agent everything it needs in 'task' and 'context'; it cannot see this conversation.`
+}
+
+func (t *SpawnAgentTool) Parameters() llm.JSONSchema {
+	return llm.JSONSchema{
+		Type: "object",
+		Properties: map[string]llm.JSONProperty{
+			"task": {
+				Type:        "string",
+				Description: "The subtask for the child agent, written as a complete, self-contained instruction",
+			},
+			"context": {
+				Type:        "string",
+				Description: "Optional background information the child agent needs (file contents, constraints, prior findings)",
+			},
+			"system_prompt": {
+				Type:        "string",
+				Description: "Optional system prompt to specialize the child agent",
+			},
+			"provider": {
+				Type:        "string",
+				Description: "Optional LLM provider for the child agent. Defaults to the current conversation's provider.",
+			},
+			"model": {
+				Type:        "string",
+				Description: "Optional model for the child agent. Defaults to the current conversation's model.",
+			},
+		},
+		Required: []string{"task"},
+	}
+}
+
+func (t *SpawnAgentTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	userID, ok := ctx.Value(UserIDKey).(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("user ID not found in context")
+	}
+
+	prompt, ok := params["task"].(string)
+	if !ok || prompt == "" {
+		return nil, fmt.Errorf("task parameter is required")
+	}
+
+	// Enforce recursion depth
+	depth, _ := ctx.Value(AgentDepthKey).(int)
+	if depth >= t.config.MaxDepth {
+		return nil, fmt.Errorf("sub-agent depth limit reached (max %d)", t.config.MaxDepth)
+	}
+
+	// Resolve provider and model, falling back to the calling conversation's
+	provider, _ := params["provider"].(string)
+	if provider == "" {
+		provider, _ = ctx.Value(ProviderKey).(string)
+	}
+	model, _ := params["model"].(string)
+	if model == "" {
+		model, _ = ctx.Value(ModelKey).(string)
+	}
+	if provider == "" || model == "" {
+		return nil, fmt.Errorf("provider and model are required when not running inside a conversation")
+	}
+
+	systemPrompt, _ := params["system_prompt"].(string)
+	if systemPrompt == "" {
+		systemPrompt = defaultSubAgentPrompt
+	}
+	if t.config.Instructions != nil {
+		if projectInstructions := t.config.Instructions(userID); projectInstructions != "" {
+			systemPrompt += "\n\n" + projectInstructions
+		}
+	}
+
+	// Enforce concurrency cap without blocking the calling agent
+	select {
+	case t.slots <- struct{}{}:
+		defer func() { <-t.slots }()
+	default:
+		return nil, fmt.Errorf("too many sub-agents running (max %d), wait for one to finish", t.config.MaxConcurrent)
+	}
+
+	opts := []agent.TaskOption{
+		agent.WithTimeout(t.config.Timeout),
+		agent.WithMetadata(map[string]interface{}{
+			"user_id": userID,
+			"depth":   depth + 1,
+		}),
+	}
+	if taskContext, ok := params["context"].(string); ok && taskContext != "" {
+		opts = append(opts, agent.WithContext(taskContext))
+	}
+	task := agent.NewTask(prompt, opts...)
+
+	config := agent.AgentConfig{
+		Name:         "sub-agent",
+		Provider:     provider,
+		Model:        model,
+		SystemPrompt: systemPrompt,
+		Credentials:  llm.CredentialsFrom(ctx),
+		Metadata: map[string]string{
+			"user_id": userID,
+			"depth":   fmt.Sprintf("%d", depth+1),
+		},
+	}
+
+	childCtx := context.WithValue(ctx, AgentDepthKey, depth+1)
+	execution, err := t.manager.RunTask(childCtx, task, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start sub-agent: %w", err)
+	}
+
+	if err := t.wait(ctx, execution); err != nil {
+		return nil, err
+	}
+
+	results := execution.GetResults()
+	if len(results) == 0 {
+		return nil, fmt.Errorf("sub-agent finished without a result")
+	}
+	result := results[0]
+	if !result.Success {
+		return nil, fmt.Errorf("sub-agent failed: %s", result.Error)
+	}
+
+	response := map[string]interface{}{
+		"agent_id":    result.AgentID,
+		"output":      result.Output,
+		"provider":    provider,
+		"model":       model,
+		"duration_ms": result.Duration.Milliseconds(),
+	}
+	if result.Usage != nil {
+		response["usage"] = result.Usage
+	}
+	return response, nil
+}
+
+// wait blocks until the execution finishes, cancelling it if the caller goes away
+func (t *SpawnAgentTool) wait(ctx context.Context, execution *agent.Execution) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		status := execution.GetStatus()
+		if status != agent.ExecutionStatusRunning && status != agent.ExecutionStatusPending {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = t.manager.CancelExecution(execution.ID)
+			return fmt.Errorf("sub-agent cancelled: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *SpawnAgentTool) RequiresConfirmation() bool {
+	return false
+}
@@ -9,10 +9,14 @@ import (
 	"github.com/jacklau/prism/internal/sandbox"
 )
 
+// TodoUpdateCallback is called after a workspace's todo list changes
+type TodoUpdateCallback func(userID, workspacePath string, todos []*repository.Todo)
+
 // TodoWriteTool manages task lists for the current workspace
 type TodoWriteTool struct {
 	sandbox  *sandbox.Service
 	todoRepo *repository.TodoRepository
+	onUpdate TodoUpdateCallback
 }
 
 // NewTodoWriteTool creates a new todo write tool
@@ -20,12 +24,17 @@ func NewTodoWriteTool(sandbox *sandbox.Service, todoRepo *repository.TodoReposit
 	return &TodoWriteTool{sandbox: sandbox, todoRepo: todoRepo}
 }
 
+// SetUpdateCallback sets a callback invoked with the saved plan after each write
+func (t *TodoWriteTool) SetUpdateCallback(cb TodoUpdateCallback) {
+	t.onUpdate = cb
+}
+
 func (t *TodoWriteTool) Name() string {
 	return "todo_write"
 }
 
 func (t *TodoWriteTool) Description() string {
-	return `Create and manage a structured task list for the current workspace. Use this to track progress on complex multi-step tasks. Each todo has content (what to do), status (pending/in_progress/completed), and activeForm (present continuous description).`
+	return `Create and manage a structured task list for the current workspace. Use this to track progress on complex multi-step tasks. Each todo has content (what to do), status (pending/in_progress/completed), and activeForm (present continuous description). The list is shown to the user as a live plan; pass the id from todo_read to keep an existing item.`
 }
 
 func (t *TodoWriteTool) Parameters() llm.JSONSchema {
@@ -34,7 +43,7 @@ func (t *TodoWriteTool) Parameters() llm.JSONSchema {
 		Properties: map[string]llm.JSONProperty{
 			"todos": {
 				Type:        "array",
-				Description: "Array of todo items. Each item should have 'content' (string), 'status' (pending/in_progress/completed), and 'activeForm' (string)",
+				Description: "Array of todo items. Each item should have 'content' (string), 'status' (pending/in_progress/completed), 'activeForm' (string), and optionally 'id' (string) of an existing item",
 			},
 		},
 		Required: []string{"todos"},
@@ -77,6 +86,7 @@ func (t *TodoWriteTool) Execute(ctx context.Context, params map[string]interface
 			return nil, fmt.Errorf("todo %d is not a valid object", i)
 		}
 
+		id, _ := todoMap["id"].(string)
 		content, _ := todoMap["content"].(string)
 		status, _ := todoMap["status"].(string)
 		activeForm, _ := todoMap["activeForm"].(string)
@@ -87,9 +97,9 @@ func (t *TodoWriteTool) Execute(ctx context.Context, params map[string]interface
 
 		// Validate status
 		if status == "" {
-			status = "pending"
+			status = repository.TodoStatusPending
 		}
-		if status != "pending" && status != "in_progress" && status != "completed" {
+		if !repository.IsValidTodoStatus(status) {
 			return nil, fmt.Errorf("todo %d: status must be 'pending', 'in_progress', or 'completed'", i)
 		}
 
@@ -98,6 +108,7 @@ func (t *TodoWriteTool) Execute(ctx context.Context, params map[string]interface
 		}
 
 		todos = append(todos, repository.Todo{
+			ID:            id,
 			UserID:        userID,
 			WorkspacePath: workspacePath,
 			Content:       content,
@@ -111,18 +122,29 @@ func (t *TodoWriteTool) Execute(ctx context.Context, params map[string]interface
 		return nil, fmt.Errorf("failed to save todos: %w", err)
 	}
 
+	// Reload to pick up generated IDs
+	saved, err := t.todoRepo.GetAll(userID, workspacePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todos: %w", err)
+	}
+
+	if t.onUpdate != nil {
+		t.onUpdate(userID, workspacePath, saved)
+	}
+
 	// Return the updated list
 	return map[string]interface{}{
 		"success": true,
-		"count":   len(todos),
-		"todos":   formatTodos(todos),
+		"count":   len(saved),
+		"todos":   formatTodos(saved),
 	}, nil
 }
 
-func formatTodos(todos []repository.Todo) []map[string]interface{} {
+func formatTodos(todos []*repository.Todo) []map[string]interface{} {
 	result := make([]map[string]interface{}, len(todos))
 	for i, todo := range todos {
 		result[i] = map[string]interface{}{
+			"id":          todo.ID,
 			"content":     todo.Content,
 			"status":      todo.Status,
 			"active_form": todo.ActiveForm,
@@ -185,14 +207,7 @@ func (t *TodoReadTool) Execute(ctx context.Context, params map[string]interface{
 	}
 
 	// Format for response
-	result := make([]map[string]interface{}, len(todos))
-	for i, todo := range todos {
-		result[i] = map[string]interface{}{
-			"content":     todo.Content,
-			"status":      todo.Status,
-			"active_form": todo.ActiveForm,
-		}
-	}
+	result := formatTodos(todos)
 
 	return map[string]interface{}{
 		"todos": result,
@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jacklau/prism/internal/llm"
+)
+
+const (
+	// collapsedPreviewBytes is how much of a collapsed tool result is kept
+	collapsedPreviewBytes = 200
+
+	// collapsedParamBytes is how long a string parameter of a collapsed
+	// tool call can be before it is cut too, e.g. a file's new contents
+	collapsedParamBytes = 200
+)
+
+// CollapseToolResults shortens all but the keepRecent most recent tool
+// results in a history to a short summary, and cuts long string parameters
+// of the calls that produced them. Calls and results stay paired, so the
+// model still sees which tools it used and how they went. keepRecent of zero
+// or less keeps every result whole. The messages passed in are not modified.
+func CollapseToolResults(messages []llm.Message, keepRecent int) []llm.Message {
+	if keepRecent <= 0 {
+		return messages
+	}
+
+	var results []int
+	for i, msg := range messages {
+		if msg.Role == "tool" {
+			results = append(results, i)
+		}
+	}
+	if len(results) <= keepRecent {
+		return messages
+	}
+
+	names := make(map[string]string)
+	for _, msg := range messages {
+		for _, tc := range msg.ToolCalls {
+			names[tc.ID] = tc.Name
+		}
+	}
+
+	shaped := make([]llm.Message, len(messages))
+	copy(shaped, messages)
+
+	collapsed := make(map[string]bool)
+	for _, i := range results[:len(results)-keepRecent] {
+		msg := shaped[i]
+		if len(msg.Content) > 2*collapsedPreviewBytes {
+			msg.Content = summarizeToolResult(names[msg.ToolCallID], msg.Content)
+			shaped[i] = msg
+		}
+		collapsed[msg.ToolCallID] = true
+	}
+
+	for i, msg := range shaped {
+		if len(msg.ToolCalls) == 0 {
+			continue
+		}
+		calls := make([]llm.ToolCall, len(msg.ToolCalls))
+		for j, tc := range msg.ToolCalls {
+			if collapsed[tc.ID] {
+				tc.Parameters = shortenParameters(tc.Parameters)
+			}
+			calls[j] = tc
+		}
+		shaped[i].ToolCalls = calls
+	}
+	return shaped
+}
+
+// summarizeToolResult replaces a tool result with its size and beginning
+func summarizeToolResult(toolName, content string) string {
+	if toolName == "" {
+		toolName = "tool"
+	}
+	return fmt.Sprintf("[Earlier %s result collapsed to save context: %d bytes, beginning %q. Run the tool again if you need it in full.]",
+		toolName, len(content), preview(content, collapsedPreviewBytes))
+}
+
+// shortenParameters copies tool call parameters with long strings cut
+func shortenParameters(params map[string]interface{}) map[string]interface{} {
+	shortened := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		if s, ok := value.(string); ok && len(s) > collapsedParamBytes {
+			value = fmt.Sprintf("%s [... %d bytes omitted]", preview(s, collapsedParamBytes), len(s)-collapsedParamBytes)
+		}
+		shortened[key] = value
+	}
+	return shortened
+}
+
+// preview returns about the first n bytes of s, cut on a character boundary
+func preview(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
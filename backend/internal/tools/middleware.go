@@ -0,0 +1,55 @@
+package tools
+
+import (
+	"context"
+	"errors"
+)
+
+// ToolCall is a tool execution passing through the registry's middleware
+type ToolCall struct {
+	Name   string
+	Params map[string]interface{}
+	Report ProgressReporter // nil if the caller doesn't want progress updates
+}
+
+// ToolHandler runs a tool call. Like ExecuteWithProgress, it reports a
+// tool's failure in the result and returns an error only if the call was
+// cancelled.
+type ToolHandler func(ctx context.Context, call *ToolCall) (*ToolResult, error)
+
+// Middleware wraps every tool execution the registry runs, e.g. to audit,
+// rate limit or rewrite results, without changing the tools themselves. It
+// may change the call before passing it to next, or answer it without
+// calling next.
+type Middleware func(next ToolHandler) ToolHandler
+
+// Before returns middleware that runs hook before each tool. If hook returns
+// an error the tool doesn't run, and fails with the error.
+func Before(hook func(ctx context.Context, call *ToolCall) error) Middleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, call *ToolCall) (*ToolResult, error) {
+			if err := hook(ctx, call); err != nil {
+				if errors.Is(err, ErrToolCancelled) {
+					return nil, err
+				}
+				return &ToolResult{
+					Success: false,
+					Error:   err.Error(),
+				}, nil
+			}
+			return next(ctx, call)
+		}
+	}
+}
+
+// After returns middleware that runs hook once each tool finishes. hook may
+// change the result, which is nil if the call was cancelled.
+func After(hook func(ctx context.Context, call *ToolCall, result *ToolResult, err error)) Middleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx context.Context, call *ToolCall) (*ToolResult, error) {
+			result, err := next(ctx, call)
+			hook(ctx, call, result, err)
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package tools
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Progress is an incremental status update from a running tool
+type Progress struct {
+	Message string `json:"message"`
+	Current int64  `json:"current,omitempty"` // Units done so far, with Total
+	Total   int64  `json:"total,omitempty"`   // 0 if the amount of work is unknown
+}
+
+// ProgressReporter receives a running tool's progress updates. It may be
+// called from several goroutines at once.
+type ProgressReporter func(Progress)
+
+// Report sends an update, doing nothing on a nil reporter
+func (r ProgressReporter) Report(p Progress) {
+	if r != nil {
+		r(p)
+	}
+}
+
+// ProgressTool is implemented by tools that can report progress while they
+// run, such as clones, test suites and index builds. Other tools are run
+// through Execute and only report their final result.
+type ProgressTool interface {
+	Tool
+
+	// ExecuteWithProgress runs the tool like Execute, sending updates to
+	// report, which may be nil
+	ExecuteWithProgress(ctx context.Context, params map[string]interface{}, report ProgressReporter) (interface{}, error)
+}
+
+// ThrottleProgress passes updates on to report at most once per interval,
+// dropping those in between; the tool's result follows soon enough that the
+// last update being dropped doesn't matter. The returned stop function drops
+// all later updates, for tools still running after their execution returned.
+func ThrottleProgress(report ProgressReporter, interval time.Duration) (ProgressReporter, func()) {
+	var mu sync.Mutex
+	var last time.Time
+	stopped := false
+
+	throttled := func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped || time.Since(last) < interval {
+			return
+		}
+		last = time.Now()
+		report(p)
+	}
+	stop := func() {
+		mu.Lock()
+		stopped = true
+		mu.Unlock()
+	}
+	return throttled, stop
+}
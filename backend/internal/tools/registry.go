@@ -2,8 +2,10 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/jacklau/prism/internal/llm"
 )
@@ -58,10 +60,21 @@ type ExecutionResult struct {
 	Error   string      `json:"error,omitempty"`
 }
 
+// ParamResolver runs the named tool through run with its parameters
+// prepared for execution, e.g. with secret references resolved, and returns
+// what the tool returned. It passes ctx and report, which may be nil, on to
+// run, wrapped if the tool needs to know about the preparation or its
+// updates need the same treatment as its result.
+type ParamResolver func(ctx context.Context, name string, params map[string]interface{}, report ProgressReporter, run func(context.Context, map[string]interface{}, ProgressReporter) (interface{}, error)) (interface{}, error)
+
 // Registry manages the collection of available tools
 type Registry struct {
 	tools             map[string]Tool
 	pendingExecutions map[string]*PendingExecution
+	timeouts          map[string]time.Duration
+	defaultTimeout    time.Duration
+	paramResolver     ParamResolver // nil if parameters are passed as given
+	middleware        []Middleware  // Outermost first
 	mu                sync.RWMutex
 }
 
@@ -70,9 +83,51 @@ func NewRegistry() *Registry {
 	return &Registry{
 		tools:             make(map[string]Tool),
 		pendingExecutions: make(map[string]*PendingExecution),
+		timeouts:          make(map[string]time.Duration),
+		defaultTimeout:    DefaultToolTimeout,
 	}
 }
 
+// SetDefaultTimeout sets the timeout for tools without a specific one
+func (r *Registry) SetDefaultTimeout(timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaultTimeout = timeout
+}
+
+// SetTimeout sets the timeout for a tool by name. The name may also refer
+// to an MCP tool, which is not stored in the registry.
+func (r *Registry) SetTimeout(name string, timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timeouts[name] = timeout
+}
+
+// TimeoutFor returns the execution timeout for a tool by name
+func (r *Registry) TimeoutFor(name string) time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if timeout, ok := r.timeouts[name]; ok {
+		return timeout
+	}
+	return r.defaultTimeout
+}
+
+// SetParamResolver sets how parameters are prepared before a tool runs
+func (r *Registry) SetParamResolver(resolver ParamResolver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paramResolver = resolver
+}
+
+// Use adds middleware around every tool execution. Middleware added first
+// runs outermost: it sees each call first and its result last.
+func (r *Registry) Use(middleware ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, middleware...)
+}
+
 // Register adds a tool to the registry
 func (r *Registry) Register(tool Tool) error {
 	r.mu.Lock()
@@ -123,8 +178,29 @@ func (r *Registry) ToLLMTools() []llm.ToolDefinition {
 	return defs
 }
 
-// Execute runs a tool by name with the given parameters
+// Execute runs a tool by name with the given parameters, bounded by the
+// tool's timeout. It returns ErrToolCancelled if ctx is cancelled first.
 func (r *Registry) Execute(ctx context.Context, name string, params map[string]interface{}) (*ToolResult, error) {
+	return r.ExecuteWithProgress(ctx, name, params, nil)
+}
+
+// ExecuteWithProgress runs a tool like Execute, sending its progress updates
+// to report if it is a ProgressTool
+func (r *Registry) ExecuteWithProgress(ctx context.Context, name string, params map[string]interface{}, report ProgressReporter) (*ToolResult, error) {
+	r.mu.RLock()
+	middleware := r.middleware
+	r.mu.RUnlock()
+
+	handler := ToolHandler(r.execute)
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler(ctx, &ToolCall{Name: name, Params: params, Report: report})
+}
+
+// execute runs a tool call once it has passed through the middleware
+func (r *Registry) execute(ctx context.Context, call *ToolCall) (*ToolResult, error) {
+	name, params, report := call.Name, call.Params, call.Report
 	tool, ok := r.Get(name)
 	if !ok {
 		return &ToolResult{
@@ -133,7 +209,27 @@ func (r *Registry) Execute(ctx context.Context, name string, params map[string]i
 		}, nil
 	}
 
-	result, err := tool.Execute(ctx, params)
+	r.mu.RLock()
+	resolver := r.paramResolver
+	r.mu.RUnlock()
+
+	execute := func(ctx context.Context, params map[string]interface{}, report ProgressReporter) (interface{}, error) {
+		if pt, ok := tool.(ProgressTool); ok {
+			return pt.ExecuteWithProgress(ctx, params, report)
+		}
+		return tool.Execute(ctx, params)
+	}
+
+	result, err := ExecuteWithTimeout(ctx, r.TimeoutFor(name), func(ctx context.Context) (interface{}, error) {
+		if resolver == nil {
+			return execute(ctx, params, report)
+		}
+		return resolver(ctx, name, params, report, execute)
+	})
+	if errors.Is(err, ErrToolCancelled) {
+		// Cancellation stops the agentic loop, so it is surfaced to the caller
+		return nil, err
+	}
 	if err != nil {
 		return &ToolResult{
 			Success: false,
@@ -169,8 +265,9 @@ func (r *Registry) RemovePendingExecution(id string) {
 	delete(r.pendingExecutions, id)
 }
 
-// ExecutePending executes a pending tool call after confirmation
-func (r *Registry) ExecutePending(ctx context.Context, id string) (*ToolResult, error) {
+// ExecutePending executes a pending tool call after confirmation, sending
+// its progress updates to report
+func (r *Registry) ExecutePending(ctx context.Context, id string, report ProgressReporter) (*ToolResult, error) {
 	exec, ok := r.GetPendingExecution(id)
 	if !ok {
 		return &ToolResult{
@@ -179,7 +276,7 @@ func (r *Registry) ExecutePending(ctx context.Context, id string) (*ToolResult,
 		}, nil
 	}
 
-	result, err := r.Execute(ctx, exec.ToolName, exec.Parameters)
+	result, err := r.ExecuteWithProgress(ctx, exec.ToolName, exec.Parameters, report)
 	r.RemovePendingExecution(id)
 	return result, err
 }
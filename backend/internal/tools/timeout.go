@@ -0,0 +1,66 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultToolTimeout is used for tools without a configured timeout
+const DefaultToolTimeout = 5 * time.Minute
+
+var (
+	// ErrToolTimeout is returned when a tool does not finish before its deadline
+	ErrToolTimeout = errors.New("tool execution timed out")
+
+	// ErrToolCancelled is returned when the caller cancels a running tool, e.g. on chat.stop
+	ErrToolCancelled = errors.New("tool execution cancelled")
+)
+
+// ExecuteWithTimeout runs fn with a deadline derived from ctx. It returns
+// ErrToolCancelled if ctx is cancelled first and ErrToolTimeout if the
+// deadline passes. A timeout of zero or less means no deadline.
+//
+// fn receives the derived context and should stop when it is done; if it
+// does not, ExecuteWithTimeout still returns and fn's result is discarded.
+func ExecuteWithTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	var execCtx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		execCtx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		execCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+
+	go func() {
+		result, err := fn(execCtx)
+		done <- outcome{result: result, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		// A tool that returns because its context ended is reported the same way
+		if o.err != nil && execCtx.Err() != nil {
+			return nil, contextError(ctx, timeout)
+		}
+		return o.result, o.err
+	case <-execCtx.Done():
+		return nil, contextError(ctx, timeout)
+	}
+}
+
+// contextError maps the end of an execution context to ErrToolCancelled or ErrToolTimeout
+func contextError(parent context.Context, timeout time.Duration) error {
+	if parent.Err() != nil {
+		return ErrToolCancelled
+	}
+	return fmt.Errorf("%w after %s", ErrToolTimeout, timeout)
+}
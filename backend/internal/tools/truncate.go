@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// truncationLineWindow is how far from a cut point a line break is looked
+// for, so results are cut between lines where possible
+const truncationLineWindow = 512
+
+// TruncateResult cuts a serialized tool result longer than maxBytes down to
+// its first two thirds and last third of maxBytes, with a marker between
+// them saying how much was left out. Cuts fall on line breaks, raw or
+// JSON-escaped, near the limit when there are any. It reports whether the
+// result was cut; maxBytes of zero or less never cuts.
+func TruncateResult(content string, maxBytes int) (string, bool) {
+	if maxBytes <= 0 || len(content) <= maxBytes {
+		return content, false
+	}
+
+	headLen := maxBytes * 2 / 3
+	head := content[:headCut(content, headLen)]
+	tail := content[tailCut(content, len(content)-(maxBytes-headLen)):]
+
+	marker := fmt.Sprintf("\n\n[... %d of %d bytes omitted. Narrow the request, e.g. read a smaller range, to see the rest ...]\n\n",
+		len(content)-len(head)-len(tail), len(content))
+	return head + marker + tail, true
+}
+
+// headCut returns where to end a head of about n bytes: after the last line
+// break before n, or at n moved back to a character boundary
+func headCut(s string, n int) int {
+	start := n - truncationLineWindow
+	if start < 0 {
+		start = 0
+	}
+	window := s[start:n]
+
+	cut := -1
+	if i := strings.LastIndex(window, "\n"); i >= 0 {
+		cut = i + 1
+	}
+	if i := strings.LastIndex(window, `\n`); i >= 0 && i+2 > cut {
+		cut = i + 2
+	}
+	if cut >= 0 {
+		return start + cut
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
+
+// tailCut returns where to start a tail from about n: after the first line
+// break from n, or at n moved forward to a character boundary
+func tailCut(s string, n int) int {
+	end := n + truncationLineWindow
+	if end > len(s) {
+		end = len(s)
+	}
+	window := s[n:end]
+
+	cut := -1
+	if i := strings.Index(window, "\n"); i >= 0 {
+		cut = i + 1
+	}
+	if i := strings.Index(window, `\n`); i >= 0 && (cut < 0 || i+2 < cut) {
+		cut = i + 2
+	}
+	if cut >= 0 {
+		return n + cut
+	}
+
+	for n < len(s) && !utf8.RuneStart(s[n]) {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,23 @@
+//go:build embedfrontend
+
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// dist holds the frontend build, copied here before compiling with the
+// embedfrontend tag (see `make build-single`)
+//
+//go:embed all:dist
+var dist embed.FS
+
+// embeddedFS returns the frontend build embedded in the binary
+func embeddedFS() fs.FS {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil
+	}
+	return sub
+}
@@ -0,0 +1,11 @@
+//go:build !embedfrontend
+
+package web
+
+import "io/fs"
+
+// embeddedFS returns nil: this binary was built without the embedfrontend
+// tag, so the frontend can only be served from a directory
+func embeddedFS() fs.FS {
+	return nil
+}
@@ -0,0 +1,90 @@
+// Package web serves the built frontend from the Go server, so Prism can be
+// deployed as a single binary without a separate web server.
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// indexFile is served for every client-side route
+	indexFile = "index.html"
+
+	// assetsDir holds Vite's content-hashed build output, which never
+	// changes under the same name
+	assetsDir = "assets/"
+
+	cacheImmutable   = "public, max-age=31536000, immutable"
+	cacheRevalidated = "no-cache"
+)
+
+// FS returns the frontend files to serve: the directory dir if set,
+// otherwise the build embedded in the binary. Returns nil if there is
+// nothing to serve.
+func FS(dir string) (fs.FS, error) {
+	if dir != "" {
+		if _, err := os.Stat(filepath.Join(dir, indexFile)); err != nil {
+			return nil, fmt.Errorf("frontend directory %s has no %s: %w", dir, indexFile, err)
+		}
+		return os.DirFS(dir), nil
+	}
+	return embeddedFS(), nil
+}
+
+// Handler serves the frontend. Existing files are served as-is; any other GET
+// request outside /api falls back to index.html so client-side routes work on
+// reload. Hashed assets are cached forever and everything else is
+// revalidated, so a new deployment is picked up immediately.
+func Handler(fsys fs.FS) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+			return c.Next()
+		}
+		if c.Path() == "/api" || strings.HasPrefix(c.Path(), "/api/") {
+			return c.Next()
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+c.Path()), "/")
+		if name == "" {
+			name = indexFile
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		switch {
+		case err == nil:
+		case errors.Is(err, fs.ErrNotExist) && path.Ext(name) == "":
+			// A client-side route
+			name = indexFile
+			if data, err = fs.ReadFile(fsys, name); err != nil {
+				return err
+			}
+		case errors.Is(err, fs.ErrNotExist), isDir(fsys, name):
+			// A missing file (e.g. an asset from an older build) or a directory
+			return c.Next()
+		default:
+			return err
+		}
+
+		if strings.HasPrefix(name, assetsDir) {
+			c.Set(fiber.HeaderCacheControl, cacheImmutable)
+		} else {
+			c.Set(fiber.HeaderCacheControl, cacheRevalidated)
+		}
+		c.Type(strings.TrimPrefix(path.Ext(name), "."))
+		return c.Send(data)
+	}
+}
+
+// isDir reports whether name is a directory in fsys
+func isDir(fsys fs.FS, name string) bool {
+	info, err := fs.Stat(fsys, name)
+	return err == nil && info.IsDir()
+}
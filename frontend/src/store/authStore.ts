@@ -115,6 +115,21 @@ export const authApi = {
     return response.json();
   },
 
+  async localLogin(token: string): Promise<AuthResponse> {
+    const response = await fetch(`${API_BASE}/auth/local`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ token }),
+    });
+
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || 'Local login failed');
+    }
+
+    return response.json();
+  },
+
   async isGuestModeEnabled(): Promise<boolean> {
     try {
       const response = await fetch(`${API_BASE}/guest-mode`);
@@ -211,6 +226,32 @@ export const registerUser = async (credentials: RegisterCredentials) => {
   return response;
 };
 
+// Take the desktop mode sign-in token from the URL fragment, removing it so
+// it doesn't linger in the address bar
+const takeLocalToken = (): string | null => {
+  const params = new URLSearchParams(window.location.hash.slice(1));
+  const token = params.get('local_token');
+  if (token) {
+    window.history.replaceState(null, '', window.location.pathname + window.location.search);
+  }
+  return token;
+};
+
+// Sign in as the desktop mode's local user
+const loginWithLocalToken = async (token: string) => {
+  const { setUser, setTokens } = useAuthStore.getState();
+
+  const response = await authApi.localLogin(token);
+  setTokens(response.access_token, response.refresh_token);
+  setUser(response.user);
+
+  // Connect services with token
+  apiService.setToken(response.access_token);
+  wsService.connect(response.access_token);
+
+  return response;
+};
+
 // Track ongoing guest login to prevent concurrent attempts
 let guestLoginPromise: Promise<AuthResponse> | null = null;
 
@@ -315,6 +356,17 @@ export const initAuth = async () => {
 
   initAuthPromise = (async () => {
     try {
+      // Desktop mode opens the app with a token that signs in the local user
+      const localToken = takeLocalToken();
+      if (localToken) {
+        try {
+          await loginWithLocalToken(localToken);
+          return;
+        } catch {
+          // Local login failed, fall back to any existing session
+        }
+      }
+
       const { accessToken, user, setUser, setLoading, clearAuth } = useAuthStore.getState();
 
       // If no token, check if guest mode is enabled and auto-login